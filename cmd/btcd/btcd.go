@@ -626,7 +626,7 @@ func (s *rpcServer) jsonRPCRead(w http.ResponseWriter, r *http.Request) {
 	hj, ok := w.(http.Hijacker)
 	if !ok {
 		errMsg := "webserver doesn't support hijacking"
-		fmt.Printf(errMsg)
+		fmt.Print(errMsg)
 		errCode := http.StatusInternalServerError
 		http.Error(w, strconv.Itoa(errCode)+" "+errMsg, errCode)
 		return
@@ -768,8 +768,8 @@ func (s *rpcServer) Start() {
 	s.listeners = listeners
 
 	for _, listener := range listeners {
+		s.wg.Add(1)
 		go func(listener net.Listener) {
-			s.wg.Add(1)
 			fmt.Printf("RPC server listening on %s\n", listener.Addr())
 			httpServer.Serve(listener)
 			fmt.Printf("RPC listener done for %s\n", listener.Addr())
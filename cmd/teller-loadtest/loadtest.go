@@ -0,0 +1,96 @@
+// teller-loadtest sends a mix of bind, status and config requests to a teller instance,
+// and reports the latency percentiles and error rates of each request kind
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/pflag"
+
+	"github.com/skycoin/teller/src/loadtest"
+)
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	targetOpt := pflag.StringP("target", "t", "http://127.0.0.1:7071", "base URL of the teller instance")
+	durationOpt := pflag.DurationP("duration", "d", time.Second*30, "how long to send requests for, unless --requests is set")
+	requestsOpt := pflag.IntP("requests", "n", 0, "total number of requests to send, overrides --duration")
+	concurrencyOpt := pflag.IntP("concurrency", "c", 10, "number of concurrent clients")
+	rateOpt := pflag.Float64P("rate", "r", 0, "maximum requests per second of all clients, 0 for no limit")
+	mixOpt := pflag.StringP("mix", "m", "bind=1,status=8,config=1", "relative weight of each request kind")
+	coinTypeOpt := pflag.String("coin-type", "BTC", "coin type of bind requests")
+	timeoutOpt := pflag.Duration("timeout", time.Second*10, "timeout of each request")
+	jsonOpt := pflag.Bool("json", false, "print the report as json")
+	pflag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options]\n\n", filepath.Base(os.Args[0]))
+		fmt.Fprintln(os.Stderr, "Sends a mix of bind, status and config requests to a teller instance, and reports")
+		fmt.Fprintln(os.Stderr, "the latency percentiles and error rates of each request kind.")
+		fmt.Fprintln(os.Stderr, "Bind requests use up deposit addresses, only run it against a test instance.")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Options:")
+		pflag.PrintDefaults()
+	}
+	pflag.Parse()
+
+	mix, err := loadtest.ParseMix(*mixOpt)
+	if err != nil {
+		return err
+	}
+
+	cfg := loadtest.Config{
+		Target:      *targetOpt,
+		Duration:    *durationOpt,
+		Requests:    *requestsOpt,
+		Concurrency: *concurrencyOpt,
+		Rate:        *rateOpt,
+		Mix:         mix,
+		CoinType:    *coinTypeOpt,
+		Timeout:     *timeoutOpt,
+	}
+
+	r, err := loadtest.NewRunner(cfg)
+	if err != nil {
+		return err
+	}
+
+	// Interrupting the run still prints the report of the requests sent so far
+	quit := make(chan struct{})
+	sigC := make(chan os.Signal, 1)
+	signal.Notify(sigC, os.Interrupt)
+	go func() {
+		<-sigC
+		signal.Stop(sigC)
+		close(quit)
+	}()
+
+	if *requestsOpt > 0 {
+		fmt.Fprintf(os.Stderr, "Sending %d requests to %s with %d clients\n", cfg.Requests, cfg.Target, cfg.Concurrency)
+	} else {
+		fmt.Fprintf(os.Stderr, "Sending requests to %s for %s with %d clients\n", cfg.Target, cfg.Duration, cfg.Concurrency)
+	}
+
+	rep := r.Run(quit)
+
+	if *jsonOpt {
+		b, err := json.MarshalIndent(rep, "", "    ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+		return nil
+	}
+
+	rep.Print(os.Stdout)
+	return nil
+}
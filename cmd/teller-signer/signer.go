@@ -0,0 +1,106 @@
+// teller-signer holds the skycoin hot wallet on a separate host, and signs the transactions of a teller instance.
+// teller and the signer authenticate each other with mutual TLS.
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+
+	"github.com/spf13/pflag"
+
+	"github.com/skycoin/skycoin/src/util/droplet"
+
+	"github.com/skycoin/teller/src/signer"
+	"github.com/skycoin/teller/src/util/logger"
+)
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	walletOpt := pflag.StringP("wallet", "w", "", "path of the hot wallet file")
+	addrOpt := pflag.StringP("addr", "a", "0.0.0.0:7090", "address to listen on")
+	certOpt := pflag.String("cert", "", "signer certificate file")
+	keyOpt := pflag.String("key", "", "signer key file")
+	clientCAOpt := pflag.String("client-ca", "", "CA certificate file that teller client certificates are verified with")
+	maxCoinsOpt := pflag.String("max-coins", "0", "maximum SKY sent by a transaction, 0 for no limit")
+	logFileOpt := pflag.String("log-file", "", "file to log to, in addition to stdout")
+	pflag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options]\n\n", filepath.Base(os.Args[0]))
+		fmt.Fprintln(os.Stderr, "Holds the skycoin hot wallet, and signs the transactions of a teller instance")
+		fmt.Fprintln(os.Stderr, "configured with sky_signer.enabled.")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Options:")
+		pflag.PrintDefaults()
+	}
+	pflag.Parse()
+
+	for _, o := range []struct {
+		name, value string
+	}{
+		{"wallet", *walletOpt},
+		{"cert", *certOpt},
+		{"key", *keyOpt},
+		{"client-ca", *clientCAOpt},
+	} {
+		if o.value == "" {
+			pflag.Usage()
+			return fmt.Errorf("--%s is required", o.name)
+		}
+	}
+
+	maxCoins, err := droplet.FromString(*maxCoinsOpt)
+	if err != nil {
+		return fmt.Errorf("Invalid --max-coins: %v", err)
+	}
+
+	log, err := logger.NewLogger(*logFileOpt, false)
+	if err != nil {
+		return err
+	}
+
+	wlt, err := signer.LoadWallet(*walletOpt, maxCoins)
+	if err != nil {
+		return fmt.Errorf("Failed to load wallet %s: %v", *walletOpt, err)
+	}
+
+	var files [3][]byte
+	for i, f := range []string{*certOpt, *keyOpt, *clientCAOpt} {
+		b, err := ioutil.ReadFile(f)
+		if err != nil {
+			return err
+		}
+		files[i] = b
+	}
+
+	tlsConfig, err := signer.ServerTLSConfig(files[0], files[1], files[2])
+	if err != nil {
+		return err
+	}
+
+	s := signer.NewServer(log, *addrOpt, wlt, tlsConfig)
+
+	errC := make(chan error, 1)
+	go func() {
+		errC <- s.Run()
+	}()
+
+	sigC := make(chan os.Signal, 1)
+	signal.Notify(sigC, os.Interrupt)
+
+	select {
+	case err := <-errC:
+		return err
+	case <-sigC:
+		signal.Stop(sigC)
+		s.Shutdown()
+		return <-errC
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/skycoin/skycoin/src/cipher"
+	"github.com/skycoin/skycoin/src/util/droplet"
+
+	"github.com/skycoin/teller/src/archive"
+	"github.com/skycoin/teller/src/audit"
+	"github.com/skycoin/teller/src/config"
+	"github.com/skycoin/teller/src/exchange"
+	"github.com/skycoin/teller/src/report"
+)
+
+// exportFormatAudit is the export format of audit snapshots
+const exportFormatAudit = "audit"
+
+// exportAudit writes an audit snapshot of every deposit of the db at dbPath, and of the deposit archives
+// in archiveDir if it is set, to the new directory outDir. The manifest is signed with the secret key
+// in the file signKeyPath, if it is set. The db is opened read-only, so teller must not be running.
+func exportAudit(dbPath string, enc config.Encryption, archiveDir, outDir, signKeyPath string) error {
+	if outDir == "" {
+		return errors.New("export --format audit requires --out, the directory of the snapshot")
+	}
+
+	var seckey cipher.SecKey
+	if signKeyPath != "" {
+		var err error
+		seckey, err = readSecKey(signKeyPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	db, err := bolt.Open(dbPath, 0700, &bolt.Options{
+		Timeout:  1 * time.Second,
+		ReadOnly: true,
+	})
+	if err != nil {
+		return fmt.Errorf("Open db %s failed: %v", dbPath, err)
+	}
+	defer db.Close()
+
+	c, err := loadDBCipher(db, enc)
+	if err != nil {
+		return fmt.Errorf("Open db encryption failed: %v", err)
+	}
+
+	events, err := exchange.LoadDepositEvents(db, c)
+	if err != nil {
+		return fmt.Errorf("exchange.LoadDepositEvents failed: %v", err)
+	}
+
+	// The events of the archived deposits were removed from the db
+	if archiveDir != "" {
+		archived, err := loadArchivedEvents(archiveDir)
+		if err != nil {
+			return fmt.Errorf("Read deposit archives failed: %v", err)
+		}
+		events = append(archived, events...)
+	}
+
+	m, err := audit.Write(outDir, report.Ledger(events))
+	if err != nil {
+		return err
+	}
+
+	skySent, err := droplet.ToString(m.SkySent)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Exported %d deposits and %d sends of %s SKY to %s\n", m.Deposits, m.Sends, skySent, outDir)
+
+	if signKeyPath != "" {
+		addr, err := audit.Sign(outDir, seckey)
+		if err != nil {
+			return fmt.Errorf("Sign the snapshot failed: %v", err)
+		}
+
+		fmt.Printf("Signed the manifest with the secret key of %s\n", addr)
+	}
+
+	return nil
+}
+
+// readSecKey reads the hex secret key of a skycoin address from a file
+func readSecKey(path string) (cipher.SecKey, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return cipher.SecKey{}, err
+	}
+
+	seckey, err := cipher.SecKeyFromHex(strings.TrimSpace(string(b)))
+	if err != nil {
+		return cipher.SecKey{}, fmt.Errorf("%s: %v", path, err)
+	}
+
+	if err := seckey.Verify(); err != nil {
+		return cipher.SecKey{}, fmt.Errorf("%s: %v", path, err)
+	}
+
+	return seckey, nil
+}
+
+// loadArchivedEvents returns the events of the deposits of every archive in dir, oldest archive first.
+// There are none if dir does not exist.
+func loadArchivedEvents(dir string) ([]exchange.DepositEvent, error) {
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	store, err := archive.NewStore(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	names, err := store.Names()
+	if err != nil {
+		return nil, err
+	}
+
+	var events []exchange.DepositEvent
+	for _, name := range names {
+		ads, err := store.Read(name)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+
+		for _, ad := range ads {
+			events = append(events, ad.Events...)
+		}
+	}
+
+	return events, nil
+}
+
+// verifyExport verifies the audit snapshot in dir. If signer is set, the snapshot must be signed by that skycoin address.
+func verifyExport(dir, signer string) error {
+	if dir == "" {
+		return errors.New("verify-export requires the directory of the snapshot")
+	}
+
+	v, err := audit.Verify(dir, signer)
+	if err != nil {
+		return fmt.Errorf("Verification failed: %v", err)
+	}
+
+	skySent, err := droplet.ToString(v.Manifest.SkySent)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("The files match the manifest: %d deposits and %d sends of %s SKY\n", v.Manifest.Deposits, v.Manifest.Sends, skySent)
+
+	switch {
+	case v.Signer == "":
+		fmt.Println("The snapshot is not signed")
+	case signer == "":
+		fmt.Printf("Signed by %s, check that it is the operator's address, or pass it with --signer\n", v.Signer)
+	default:
+		fmt.Printf("Signed by %s\n", v.Signer)
+	}
+
+	return nil
+}
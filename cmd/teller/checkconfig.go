@@ -0,0 +1,338 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/skycoin/teller/src/addrs"
+	"github.com/skycoin/teller/src/backup"
+	"github.com/skycoin/teller/src/config"
+	"github.com/skycoin/teller/src/pricing"
+	"github.com/skycoin/teller/src/scanner"
+	"github.com/skycoin/teller/src/util/redisutil"
+)
+
+// checkTimeout is the timeout of each connection made by check-config
+const checkTimeout = time.Second * 5
+
+// configCheck checks a part of the config that Validate can't, e.g. by loading a file or connecting to a node
+type configCheck struct {
+	key   string
+	check func() error
+}
+
+// checkConfig loads and validates the config, then checks that the files it refers to can be loaded
+// and that the nodes and services it uses are reachable. Every problem found is printed, and an error
+// is returned if there are any, without starting teller.
+func checkConfig(configName, appDir string) error {
+	path, err := config.FindFile(configName, appDir)
+	if err != nil {
+		return fmt.Errorf("Find config file failed: %v", err)
+	}
+
+	cfg, err := config.Read(configName, appDir)
+	if err != nil {
+		return fmt.Errorf("Config error:\n%v", err)
+	}
+
+	var problems []string
+	if err := cfg.Validate(); err != nil {
+		problems = append(problems, strings.Split(err.Error(), "\n")...)
+	}
+
+	for _, c := range configChecks(cfg) {
+		if err := c.check(); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", c.key, err))
+		}
+	}
+
+	if len(problems) == 0 {
+		fmt.Printf("%s is valid\n", path)
+		return nil
+	}
+
+	fmt.Printf("%s has %d problems:\n", path, len(problems))
+	for _, p := range problems {
+		fmt.Printf("  - %s\n", p)
+	}
+
+	return fmt.Errorf("Config check failed, %d problems found", len(problems))
+}
+
+// configChecks returns the checks of the parts of cfg that teller uses.
+// Files that don't exist are skipped, since Validate reports them.
+func configChecks(cfg config.Config) []configCheck {
+	var checks []configCheck
+	add := func(key string, check func() error) {
+		checks = append(checks, configCheck{
+			key:   key,
+			check: check,
+		})
+	}
+
+	addAddresses := func(key, path string, load func(io.Reader) ([]string, error)) {
+		if !fileExists(path) {
+			return
+		}
+
+		add(key, func() error {
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			_, err = load(f)
+			return err
+		})
+	}
+
+	// The address files are not used if addresses are fetched from an address service
+	if !cfg.AddressProvider.Enabled {
+		addAddresses("btc_addresses", cfg.BtcAddresses, addrs.LoadBTCAddresses)
+		if cfg.LtcScanner.Enabled {
+			addAddresses("ltc_addresses", cfg.LtcAddresses, addrs.LoadLTCAddresses)
+		}
+		if cfg.ERC20Scanner.Enabled {
+			addAddresses("eth_addresses", cfg.EthAddresses, addrs.LoadETHAddresses)
+		}
+	}
+
+	if cfg.Web.TLSCert != "" && cfg.Web.TLSKey != "" {
+		add("web.tls_cert", func() error {
+			_, err := tls.LoadX509KeyPair(cfg.Web.TLSCert, cfg.Web.TLSKey)
+			return err
+		})
+	}
+
+	if cfg.AdminPanel.TLSCert != "" && cfg.AdminPanel.TLSKey != "" {
+		add("admin_panel.tls_cert", func() error {
+			_, _, err := newAdminAuth(cfg.AdminPanel)
+			return err
+		})
+	}
+
+	if cfg.Pricing.Enabled && cfg.Pricing.GeoIPFile != "" {
+		add("pricing.geoip_file", func() error {
+			f, err := os.Open(cfg.Pricing.GeoIPFile)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			_, err = pricing.NewNetworkLocator(f)
+			return err
+		})
+	}
+
+	if !cfg.Dummy.Sender {
+		// The hot wallet or remote signer is checked by listing its addresses
+		if cfg.SkySigner.Enabled {
+			if fileExists(cfg.SkySigner.Cert) && fileExists(cfg.SkySigner.Key) && fileExists(cfg.SkySigner.CA) && cfg.SkySigner.URL != "" {
+				add("sky_signer.url", func() error {
+					return checkSigner(cfg)
+				})
+			}
+		} else if fileExists(cfg.SkyExchanger.Wallet) {
+			add("sky_exchanger.wallet", func() error {
+				return checkSigner(cfg)
+			})
+		}
+
+		// Validate only checks that one of the nodes is reachable
+		if len(cfg.SkyRPC.FallbackAddresses) != 0 {
+			for i, a := range cfg.SkyRPC.Addresses() {
+				key := "sky_rpc.address"
+				if i > 0 {
+					key = fmt.Sprintf("sky_rpc.fallback_addresses[%d]", i-1)
+				}
+
+				a := a
+				add(key, func() error {
+					return checkDial(a)
+				})
+			}
+		}
+	}
+
+	if !cfg.Dummy.Scanner {
+		switch cfg.BtcScanner.Backend {
+		case config.BtcScannerBackendBtcd:
+			nodes := append([]config.BtcRPCNode{{
+				Server: cfg.BtcRPC.Server,
+				User:   cfg.BtcRPC.User,
+				Pass:   cfg.BtcRPC.Pass,
+				Cert:   cfg.BtcRPC.Cert,
+			}}, cfg.BtcRPC.FallbackNodes...)
+
+			for i, n := range nodes {
+				if n.Server == "" || !fileExists(n.Cert) {
+					continue
+				}
+
+				key := "btc_rpc.server"
+				if i > 0 {
+					key = fmt.Sprintf("btc_rpc.fallback_nodes[%d].server", i-1)
+				}
+
+				n := n
+				add(key, func() error {
+					return checkBtcd(n)
+				})
+			}
+		case config.BtcScannerBackendElectrum:
+			if cfg.BtcScanner.ElectrumServer != "" {
+				add("btc_scanner.electrum_server", func() error {
+					return checkDial(cfg.BtcScanner.ElectrumServer)
+				})
+			}
+		case config.BtcScannerBackendBlockbook:
+			if cfg.BtcScanner.BlockbookURL != "" {
+				add("btc_scanner.blockbook_url", func() error {
+					return checkHTTP(cfg.BtcScanner.BlockbookURL)
+				})
+			}
+		}
+
+		if cfg.LtcScanner.Enabled && cfg.LtcRPC.Server != "" {
+			add("ltc_rpc.server", func() error {
+				c, err := scanner.NewLtcRPCClient(cfg.LtcRPC.Server, cfg.LtcRPC.User, cfg.LtcRPC.Pass)
+				if err != nil {
+					return err
+				}
+				defer c.Shutdown()
+
+				_, err = c.GetBlockCount()
+				return err
+			})
+		}
+
+		if cfg.ERC20Scanner.Enabled && cfg.EthRPC.URL != "" {
+			add("eth_rpc.url", func() error {
+				_, err := scanner.NewEthClient(cfg.EthRPC.URL).BlockNumber()
+				return err
+			})
+		}
+	}
+
+	if (cfg.Web.RateLimitBackend == config.RateLimitBackendRedis || cfg.HA.Enabled) && cfg.Redis.Addr != "" {
+		add("redis.addr", func() error {
+			c := redisutil.NewClient(redisutil.Config{
+				Addr:        cfg.Redis.Addr,
+				Password:    cfg.Redis.Password,
+				DB:          cfg.Redis.DB,
+				DialTimeout: checkTimeout,
+			})
+			defer c.Close()
+
+			_, err := c.Do("PING")
+			return err
+		})
+	}
+
+	if cfg.Alerts.Enabled && cfg.Alerts.SMTP.Enabled && cfg.Alerts.SMTP.Addr != "" {
+		add("alerts.smtp.addr", func() error {
+			return checkDial(cfg.Alerts.SMTP.Addr)
+		})
+	}
+
+	if cfg.Backup.Enabled && cfg.Backup.S3.Enabled {
+		// Listing the snapshots checks the endpoint, the bucket and the credentials
+		add("backup.s3.bucket", func() error {
+			s3, err := backup.NewS3(backup.S3Config{
+				Endpoint:        cfg.Backup.S3.Endpoint,
+				Region:          cfg.Backup.S3.Region,
+				Bucket:          cfg.Backup.S3.Bucket,
+				AccessKeyID:     cfg.Backup.S3.AccessKeyID,
+				SecretAccessKey: cfg.Backup.S3.SecretAccessKey,
+			})
+			if err != nil {
+				return err
+			}
+
+			_, err = s3.List(cfg.Backup.S3.Prefix)
+			return err
+		})
+	}
+
+	return checks
+}
+
+// checkSigner checks that the hot wallet or remote signer can list its addresses
+func checkSigner(cfg config.Config) error {
+	s, err := newTxSigner(cfg)
+	if err != nil {
+		return err
+	}
+
+	addrs, err := s.Addresses()
+	if err != nil {
+		return err
+	}
+
+	if len(addrs) == 0 {
+		return errors.New("no addresses to send from")
+	}
+
+	return nil
+}
+
+// checkBtcd checks that a btcd node accepts its RPC credentials
+func checkBtcd(node config.BtcRPCNode) error {
+	// The logger is only used when connecting in the background
+	log := logrus.New()
+	log.Out = ioutil.Discard
+
+	if err := checkDial(node.Server); err != nil {
+		return err
+	}
+
+	c, err := newBtcdClient(log, node, nil)
+	if err != nil {
+		return err
+	}
+	defer c.Shutdown()
+
+	_, err = c.GetBlockCount()
+	return err
+}
+
+// checkDial checks that a TCP address accepts connections
+func checkDial(addr string) error {
+	conn, err := net.DialTimeout("tcp", addr, checkTimeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// checkHTTP checks that an HTTP server responds, with any status
+func checkHTTP(url string) error {
+	c := &http.Client{
+		Timeout: checkTimeout,
+	}
+
+	rsp, err := c.Get(url)
+	if err != nil {
+		return err
+	}
+	return rsp.Body.Close()
+}
+
+func fileExists(path string) bool {
+	if path == "" {
+		return false
+	}
+	_, err := os.Stat(path)
+	return err == nil
+}
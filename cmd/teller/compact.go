@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/sirupsen/logrus"
+
+	"github.com/skycoin/teller/src/util/compact"
+)
+
+// compactDB compacts the db into a new file and swaps it in, keeping the db with a .bak suffix.
+// Teller must not be running, a running teller compacts its db with POST /api/compact instead.
+func compactDB(configName, appDir string) error {
+	cfg, err := loadConfig(configName, appDir, false)
+	if err != nil {
+		return fmt.Errorf("Config error:\n%v", err)
+	}
+
+	dbPath := filepath.Join(appDir, cfg.DBFilename)
+
+	if _, err := os.Stat(dbPath); os.IsNotExist(err) {
+		return fmt.Errorf("%s does not exist", dbPath)
+	}
+
+	db, err := bolt.Open(dbPath, 0700, &bolt.Options{
+		Timeout: 1 * time.Second,
+	})
+	if err != nil {
+		return fmt.Errorf("Open db %s failed: %v", dbPath, err)
+	}
+
+	res, err := compact.Compact(db, compact.PendingPath(dbPath))
+	if err != nil {
+		db.Close()
+		return fmt.Errorf("Compact db %s failed: %v", dbPath, err)
+	}
+
+	// Nothing wrote to the db since it was copied, so Swap only swaps the files
+	db, err = compact.Swap(logrus.New(), db, &bolt.Options{
+		Timeout: 1 * time.Second,
+	})
+	if err != nil {
+		if db != nil {
+			db.Close()
+		}
+		return fmt.Errorf("Swap compacted db %s failed: %v", dbPath, err)
+	}
+
+	if err := db.Close(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Compacted %s from %d to %d bytes, the original db was kept at %s\n", dbPath, res.DBSize, res.CompactedSize, compact.BackupPath(dbPath))
+
+	return nil
+}
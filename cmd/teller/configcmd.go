@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/skycoin/teller/src/config"
+)
+
+// configInit writes a config file for preset to outPath, or to stdout if outPath is empty.
+// An existing file at outPath is not overwritten.
+func configInit(preset, outPath string) error {
+	var buf bytes.Buffer
+	if err := config.Init(&buf, preset); err != nil {
+		return err
+	}
+
+	if outPath == "" {
+		_, err := os.Stdout.Write(buf.Bytes())
+		return err
+	}
+
+	if _, err := os.Stat(outPath); !os.IsNotExist(err) {
+		return fmt.Errorf("%s already exists", outPath)
+	}
+
+	if err := ioutil.WriteFile(outPath, buf.Bytes(), 0600); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Wrote %s config to %s\n", preset, outPath)
+	return nil
+}
+
+// configUpgrade rewrites the config file that teller would load in the current schema.
+// If outPath is empty, the file is rewritten in place and the original is kept with a .bak suffix.
+func configUpgrade(configName, appDir, outPath string) error {
+	path, err := config.FindFile(configName, appDir)
+	if err != nil {
+		return fmt.Errorf("Find config file failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	unknown, err := config.Upgrade(&buf, path)
+	if err != nil {
+		return fmt.Errorf("Upgrade %s failed: %v", path, err)
+	}
+
+	for _, k := range unknown {
+		fmt.Fprintf(os.Stderr, "Unknown key %s is kept commented out\n", k)
+	}
+
+	if outPath == "" {
+		bakPath := path + ".bak"
+		if _, err := os.Stat(bakPath); !os.IsNotExist(err) {
+			return fmt.Errorf("%s already exists", bakPath)
+		}
+
+		if err := os.Rename(path, bakPath); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(os.Stderr, "Saved the original config to %s\n", bakPath)
+		outPath = path
+	} else if _, err := os.Stat(outPath); !os.IsNotExist(err) {
+		return fmt.Errorf("%s already exists", outPath)
+	}
+
+	if err := ioutil.WriteFile(outPath, buf.Bytes(), 0600); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Wrote upgraded config to %s\n", outPath)
+	return nil
+}
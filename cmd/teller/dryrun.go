@@ -0,0 +1,28 @@
+package main
+
+import (
+	"github.com/skycoin/teller/src/config"
+)
+
+// dryRunDBSuffix is appended to the db path in a dry run, so that simulated deposits
+// are never recorded in the db of real deposits
+const dryRunDBSuffix = ".dry-run"
+
+// loadConfig loads and validates the config. A dry run always uses the dummy scanner,
+// which is fed simulated deposits, so the scanner backends don't need to be configured.
+func loadConfig(configName, appDir string, dryRun bool) (config.Config, error) {
+	cfg, err := config.Read(configName, appDir)
+	if err != nil {
+		return config.Config{}, err
+	}
+
+	if dryRun {
+		cfg.Dummy.Scanner = true
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return config.Config{}, err
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/skycoin/teller/src/config"
+	"github.com/skycoin/teller/src/exchange"
+	"github.com/skycoin/teller/src/report"
+)
+
+// exportDeposits writes every deposit of the db at dbPath in format to outPath, or to stdout if outPath is empty.
+// The db is opened read-only, so teller must not be running.
+func exportDeposits(dbPath string, enc config.Encryption, format, outPath string) error {
+	if format != report.FormatJSON && format != report.FormatCSV {
+		return report.ErrInvalidFormat
+	}
+
+	db, err := bolt.Open(dbPath, 0700, &bolt.Options{
+		Timeout:  1 * time.Second,
+		ReadOnly: true,
+	})
+	if err != nil {
+		return fmt.Errorf("Open db %s failed: %v", dbPath, err)
+	}
+	defer db.Close()
+
+	c, err := loadDBCipher(db, enc)
+	if err != nil {
+		return fmt.Errorf("Open db encryption failed: %v", err)
+	}
+
+	events, err := exchange.LoadDepositEvents(db, c)
+	if err != nil {
+		return fmt.Errorf("exchange.LoadDepositEvents failed: %v", err)
+	}
+
+	ledger := report.Ledger(events)
+
+	var w io.Writer = os.Stdout
+	var f *os.File
+	if outPath != "" {
+		if _, err := os.Stat(outPath); !os.IsNotExist(err) {
+			return fmt.Errorf("%s already exists", outPath)
+		}
+
+		f, err = os.OpenFile(outPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	bw := bufio.NewWriter(w)
+	if err := report.WriteLedger(bw, ledger, format); err != nil {
+		return err
+	}
+
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+
+	if f != nil {
+		if err := f.Close(); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(os.Stderr, "Exported %d deposits to %s\n", len(ledger), outPath)
+	}
+
+	return nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/skycoin/teller/src/util/logger"
+)
+
+// logLevelToggler switches the log level between debug and the configured level when teller receives SIGUSR1.
+// SIGUSR2 is taken by the upgrader.
+type logLevelToggler struct {
+	log    logrus.FieldLogger
+	levels *logger.LevelSetter
+	quit   chan struct{}
+	done   chan struct{}
+}
+
+func newLogLevelToggler(log logrus.FieldLogger, levels *logger.LevelSetter) *logLevelToggler {
+	return &logLevelToggler{
+		log:    log.WithField("prefix", "teller.loglevel"),
+		levels: levels,
+		quit:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+// Run toggles the log level on each SIGUSR1 until Shutdown is called
+func (l *logLevelToggler) Run() error {
+	defer close(l.done)
+
+	sigC := make(chan os.Signal, 1)
+	signal.Notify(sigC, syscall.SIGUSR1)
+	defer signal.Stop(sigC)
+
+	for {
+		select {
+		case <-l.quit:
+			return nil
+		case <-sigC:
+			level := l.levels.Toggle()
+			// Logged at warning level, so that it is logged with any level
+			logger.Audit(l.log).WithField("level", level.String()).Warn("Set log level by SIGUSR1")
+		}
+	}
+}
+
+// Shutdown stops the logLevelToggler
+func (l *logLevelToggler) Shutdown() {
+	close(l.quit)
+	<-l.done
+}
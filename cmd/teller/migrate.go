@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/sirupsen/logrus"
+
+	"github.com/skycoin/teller/src/exchange"
+	"github.com/skycoin/teller/src/util/migrate"
+)
+
+// migratedStores are the stores of the db whose schema is versioned by migrations.
+// Opening a store creates its buckets and applies its pending migrations.
+var migratedStores = []struct {
+	name       string
+	migrations []migrate.Migration
+	open       func(logrus.FieldLogger, *bolt.DB) error
+}{
+	{
+		name:       exchange.SchemaName,
+		migrations: exchange.Migrations,
+		// The deposits are encrypted by teller at startup, since the migrations don't need the passphrase
+		open: func(log logrus.FieldLogger, db *bolt.DB) error {
+			_, err := exchange.NewStore(log, db, nil)
+			return err
+		},
+	},
+}
+
+// migrateDB applies the pending migrations of the db, or only prints them if dryRun is set.
+// Teller applies them at startup too, so the command is only needed to see or apply them ahead of a start.
+// Teller must not be running.
+func migrateDB(configName, appDir string, dryRun bool) error {
+	cfg, err := loadConfig(configName, appDir, false)
+	if err != nil {
+		return fmt.Errorf("Config error:\n%v", err)
+	}
+
+	dbPath := filepath.Join(appDir, cfg.DBFilename)
+
+	if _, err := os.Stat(dbPath); os.IsNotExist(err) {
+		return fmt.Errorf("%s does not exist, teller creates it at the latest schema version", dbPath)
+	}
+
+	db, err := bolt.Open(dbPath, 0700, &bolt.Options{
+		Timeout:  1 * time.Second,
+		ReadOnly: dryRun,
+	})
+	if err != nil {
+		return fmt.Errorf("Open db %s failed: %v", dbPath, err)
+	}
+	defer db.Close()
+
+	log := logrus.New()
+
+	for _, s := range migratedStores {
+		v, err := migrate.Version(db, s.name)
+		if err != nil {
+			return err
+		}
+
+		pending, err := migrate.Pending(db, s.name, s.migrations)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Store %s is at schema version %d, %d pending migrations\n", s.name, v, len(pending))
+		for _, m := range pending {
+			fmt.Printf("  %d: %s\n", m.Version, m.Description)
+		}
+
+		if dryRun || len(pending) == 0 {
+			continue
+		}
+
+		if err := s.open(log, db); err != nil {
+			return fmt.Errorf("Migrate store %s failed: %v", s.name, err)
+		}
+
+		fmt.Printf("Migrated store %s to schema version %d\n", s.name, pending[len(pending)-1].Version)
+	}
+
+	return nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/sirupsen/logrus"
+
+	"github.com/skycoin/teller/src/config"
+	"github.com/skycoin/teller/src/scanner"
+)
+
+// readOnlyDBSuffix is appended to the db path for the copy of the db that a read-only teller runs against,
+// so that the db is never changed, even by the stores that create their buckets at startup
+const readOnlyDBSuffix = ".read-only"
+
+// copyDB copies the db at path to copyPath, overwriting it. The db is opened read-only, so the copy
+// fails if a teller is running with the db.
+func copyDB(path, copyPath string) error {
+	db, err := bolt.Open(path, 0600, &bolt.Options{
+		Timeout:  1 * time.Second,
+		ReadOnly: true,
+	})
+	if err != nil {
+		return fmt.Errorf("Open db failed: %v", err)
+	}
+	defer db.Close()
+
+	return db.View(func(tx *bolt.Tx) error {
+		return tx.CopyFile(copyPath, 0600)
+	})
+}
+
+// scanStores lists the scan addresses of the scanner stores, for the admin API of a read-only teller,
+// which runs no scanner
+type scanStores []*scanner.BTCStore
+
+// newScanStores returns the scanner stores of the enabled coin types
+func newScanStores(log logrus.FieldLogger, db *bolt.DB, cfg config.Config) (scanStores, error) {
+	btcStore, err := scanner.NewStore(log, db)
+	if err != nil {
+		return nil, err
+	}
+	stores := scanStores{btcStore}
+
+	if cfg.LtcScanner.Enabled {
+		ltcStore, err := scanner.NewLTCStore(log, db)
+		if err != nil {
+			return nil, err
+		}
+		stores = append(stores, ltcStore)
+	}
+
+	if cfg.ERC20Scanner.Enabled {
+		erc20Store, err := scanner.NewERC20Store(log, db)
+		if err != nil {
+			return nil, err
+		}
+		stores = append(stores, erc20Store)
+	}
+
+	return stores, nil
+}
+
+// GetScanAddresses returns the scan addresses of all stores
+func (s scanStores) GetScanAddresses() ([]string, error) {
+	var addrs []string
+	for _, store := range s {
+		a, err := store.GetScanAddresses()
+		if err != nil {
+			return nil, err
+		}
+		addrs = append(addrs, a...)
+	}
+	return addrs, nil
+}
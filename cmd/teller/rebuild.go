@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/sirupsen/logrus"
+
+	"github.com/skycoin/teller/src/config"
+	"github.com/skycoin/teller/src/exchange"
+	"github.com/skycoin/teller/src/util/dbcrypt"
+)
+
+// rebuildState reconstructs the exchange state from the event log of the db at dbPath
+// into a new db at outPath, then verifies that it matches the db at dbPath.
+// The db at dbPath is opened read-only, so teller must not be running.
+func rebuildState(log logrus.FieldLogger, enc config.Encryption, dbPath, outPath string) error {
+	log = log.WithFields(logrus.Fields{
+		"dbPath":  dbPath,
+		"outPath": outPath,
+	})
+
+	if _, err := os.Stat(outPath); !os.IsNotExist(err) {
+		err := fmt.Errorf("%s already exists", outPath)
+		log.WithError(err).Error("Rebuild state failed")
+		return err
+	}
+
+	db, err := bolt.Open(dbPath, 0700, &bolt.Options{
+		Timeout:  1 * time.Second,
+		ReadOnly: true,
+	})
+	if err != nil {
+		log.WithError(err).Error("Open db failed")
+		return err
+	}
+	defer db.Close()
+
+	c, err := loadDBCipher(db, enc)
+	if err != nil {
+		log.WithError(err).Error("Open db encryption failed")
+		return err
+	}
+
+	events, err := exchange.LoadDepositEvents(db, c)
+	if err != nil {
+		log.WithError(err).Error("exchange.LoadDepositEvents failed")
+		return err
+	}
+
+	log = log.WithField("events", len(events))
+	log.Info("Rebuilding state from event log")
+
+	outDB, err := bolt.Open(outPath, 0700, &bolt.Options{
+		Timeout: 1 * time.Second,
+	})
+	if err != nil {
+		log.WithError(err).Error("Open rebuilt db failed")
+		return err
+	}
+	defer outDB.Close()
+
+	// The rebuilt db is encrypted with the key of the db, so that it can replace it
+	if encrypted, err := dbcrypt.IsEncrypted(db); err != nil {
+		log.WithError(err).Error("dbcrypt.IsEncrypted failed")
+		return err
+	} else if encrypted {
+		if err := dbcrypt.CopyKey(db, outDB); err != nil {
+			log.WithError(err).Error("dbcrypt.CopyKey failed")
+			return err
+		}
+	}
+
+	if err := exchange.RebuildState(outDB, c, events); err != nil {
+		log.WithError(err).Error("exchange.RebuildState failed")
+		return err
+	}
+
+	diffs, err := exchange.CompareState(db, outDB, c)
+	if err != nil {
+		log.WithError(err).Error("exchange.CompareState failed")
+		return err
+	}
+
+	for _, d := range diffs {
+		log.Warn(d)
+		fmt.Println(d)
+	}
+
+	if len(diffs) != 0 {
+		return fmt.Errorf("rebuilt state in %s does not match %s, %d differences found", outPath, dbPath, len(diffs))
+	}
+
+	log.Info("Rebuilt state matches the db")
+	fmt.Printf("Rebuilt state from %d events into %s, it matches %s\n", len(events), outPath, dbPath)
+
+	return nil
+}
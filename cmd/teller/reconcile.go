@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/sirupsen/logrus"
+
+	"github.com/skycoin/teller/src/addrs"
+	"github.com/skycoin/teller/src/config"
+	"github.com/skycoin/teller/src/exchange"
+	"github.com/skycoin/teller/src/recovery"
+	"github.com/skycoin/teller/src/scanner"
+)
+
+// reconcile compares the deposits to the pool addresses found on the BTC and LTC nodes, and the payouts
+// of the hot wallet found on the skycoin node, with the db at dbPath, and prints the discrepancies.
+// The db at dbPath is opened read-only, so teller must not be running.
+func reconcile(log logrus.FieldLogger, cfg config.Config, dbPath string, quit <-chan struct{}) error {
+	log = log.WithField("dbPath", dbPath)
+
+	if cfg.ERC20Scanner.Enabled {
+		log.Warn("ERC20 token deposits are not reconciled")
+	}
+
+	db, err := bolt.Open(dbPath, 0700, &bolt.Options{
+		Timeout:  1 * time.Second,
+		ReadOnly: true,
+	})
+	if err != nil {
+		log.WithError(err).Error("Open db failed")
+		return err
+	}
+	defer db.Close()
+
+	c, err := loadDBCipher(db, cfg.Encryption)
+	if err != nil {
+		log.WithError(err).Error("Open db encryption failed")
+		return err
+	}
+
+	dis, err := exchange.LoadDepositInfos(db, c)
+	if err != nil {
+		log.WithError(err).Error("exchange.LoadDepositInfos failed")
+		return err
+	}
+
+	bound, err := exchange.LoadBoundAddresses(db, c)
+	if err != nil {
+		log.WithError(err).Error("exchange.LoadBoundAddresses failed")
+		return err
+	}
+
+	// The addresses of the address files are scanned, with every address the db bound or received a deposit to,
+	// since addresses of the address_provider or removed from the files are not in the files
+	poolAddrs := make(map[string][]string)
+	if !cfg.AddressProvider.Enabled {
+		poolAddrs, err = poolAddresses(cfg)
+		if err != nil {
+			log.WithError(err).Error("Load pool addresses failed")
+			return err
+		}
+	}
+
+	scanAddrs := make(map[string]map[string]struct{})
+	add := func(coinType, addr string) {
+		if scanAddrs[coinType] == nil {
+			scanAddrs[coinType] = make(map[string]struct{})
+		}
+		scanAddrs[coinType][addr] = struct{}{}
+	}
+
+	for coinType, as := range poolAddrs {
+		for _, a := range as {
+			add(coinType, a)
+		}
+	}
+
+	for _, di := range dis {
+		add(di.CoinType, di.DepositAddress)
+	}
+
+	for a := range bound {
+		if addrs.VerifyBTCAddress(a) == nil {
+			add(scanner.CoinTypeBTC, a)
+		} else if addrs.VerifyLTCAddress(a) == nil {
+			add(scanner.CoinTypeLTC, a)
+		}
+	}
+
+	addrLists := make(map[string][]string, len(scanAddrs))
+	for coinType, as := range scanAddrs {
+		for a := range as {
+			addrLists[coinType] = append(addrLists[coinType], a)
+		}
+	}
+
+	deposits, err := scanDeposits(log, cfg, addrLists, quit)
+	if err != nil {
+		return err
+	}
+
+	payouts, err := hotWalletPayouts(log, cfg)
+	if err != nil {
+		return err
+	}
+
+	r := recovery.Reconcile(deposits, payouts, dis)
+
+	printReconciliation(r)
+
+	log.WithFields(logrus.Fields{
+		"deposits":         len(deposits),
+		"payouts":          len(payouts),
+		"missingDeposits":  len(r.MissingDeposits),
+		"unsentDeposits":   len(r.UnsentDeposits),
+		"unmatchedPayouts": len(r.UnmatchedPayouts),
+	}).Info("Reconciled db with the chains")
+
+	if r.Len() != 0 {
+		return fmt.Errorf("%d discrepancies found between %s and the chains", r.Len(), dbPath)
+	}
+
+	fmt.Printf("Reconciled %d deposits and %d payouts with %s, no discrepancies found\n", len(deposits), len(payouts), dbPath)
+
+	return nil
+}
+
+// printReconciliation prints the discrepancies found by recovery.Reconcile
+func printReconciliation(r recovery.Reconciliation) {
+	fmt.Printf("Missing deposits: %d\n", len(r.MissingDeposits))
+	for _, d := range r.MissingDeposits {
+		fmt.Printf("  %s to %s, %d %s, at height %d\n", d.ID(), d.Address, d.Value, d.CoinType, d.Height)
+	}
+
+	fmt.Printf("Unsent confirmed deposits: %d\n", len(r.UnsentDeposits))
+	for _, d := range r.UnsentDeposits {
+		fmt.Printf("  %s to %s, %d %s, status %s\n", d.Deposit.ID(), d.Deposit.Address, d.Deposit.Value, d.Deposit.CoinType, d.DepositInfo.Status)
+	}
+
+	fmt.Printf("Sends with no matching deposit: %d\n", len(r.UnmatchedPayouts))
+	for _, p := range r.UnmatchedPayouts {
+		fmt.Printf("  %s:%s -> %s %s SKY\n", p.Txid, p.Output, p.Address, skyString(p.Droplets))
+	}
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/sirupsen/logrus"
+	"github.com/skycoin/skycoin/src/api/webrpc"
+	"github.com/skycoin/skycoin/src/util/droplet"
+
+	"github.com/skycoin/teller/src/addrs"
+	"github.com/skycoin/teller/src/config"
+	"github.com/skycoin/teller/src/exchange"
+	"github.com/skycoin/teller/src/recovery"
+	"github.com/skycoin/teller/src/scanner"
+	"github.com/skycoin/teller/src/util/dbcrypt"
+)
+
+// recoverState rebuilds a best-effort deposit db at outPath after the db was lost. The deposits to the addresses
+// of the address files are scanned from the BTC and LTC nodes, and matched with the payouts of the hot wallet
+// found on the skycoin node. Matched deposits are saved as done and their addresses are marked as used.
+// Every deposit and payout that could not be matched is printed, for the operator to review.
+func recoverState(log logrus.FieldLogger, cfg config.Config, dbPassphrase, outPath string, maxDelay time.Duration, quit <-chan struct{}) error {
+	log = log.WithField("outPath", outPath)
+
+	if _, err := os.Stat(outPath); !os.IsNotExist(err) {
+		err := fmt.Errorf("%s already exists", outPath)
+		log.WithError(err).Error("Recover state failed")
+		return err
+	}
+
+	if cfg.AddressProvider.Enabled {
+		err := errors.New("address_provider is enabled, recover needs the address files of the pools")
+		log.WithError(err).Error("Recover state failed")
+		return err
+	}
+
+	if cfg.ERC20Scanner.Enabled {
+		log.Warn("ERC20 token deposits are not recovered")
+	}
+
+	poolAddrs, err := poolAddresses(cfg)
+	if err != nil {
+		log.WithError(err).Error("Load pool addresses failed")
+		return err
+	}
+
+	deposits, err := scanDeposits(log, cfg, poolAddrs, quit)
+	if err != nil {
+		return err
+	}
+
+	payouts, err := hotWalletPayouts(log, cfg)
+	if err != nil {
+		return err
+	}
+
+	rate, ltcRate, _ := exchangeRates(cfg)
+	rates := map[string]string{
+		scanner.CoinTypeBTC: rate,
+	}
+	if ltcRate != "" {
+		rates[scanner.CoinTypeLTC] = ltcRate
+	}
+
+	r, err := recovery.MatchDeposits(recovery.Config{
+		Rates:       rates,
+		MaxDecimals: cfg.SkyExchanger.MaxDecimals,
+		Fee: exchange.Fee{
+			Percent:       cfg.SkyExchanger.FeePercent,
+			FixedDroplets: cfg.SkyExchanger.FeeFixedDroplets,
+		},
+		MaxDelay: maxDelay,
+	}, deposits, payouts)
+	if err != nil {
+		log.WithError(err).Error("recovery.MatchDeposits failed")
+		return err
+	}
+
+	outDB, err := bolt.Open(outPath, 0700, &bolt.Options{
+		Timeout: 1 * time.Second,
+	})
+	if err != nil {
+		log.WithError(err).Error("Open recovered db failed")
+		return err
+	}
+	defer outDB.Close()
+
+	var dbCipher *dbcrypt.Cipher
+	if cfg.Encryption.Enabled {
+		dbCipher, err = dbcrypt.Open(outDB, dbPassphrase)
+		if err != nil {
+			log.WithError(err).Error("dbcrypt.Open failed")
+			return err
+		}
+	}
+
+	store, err := exchange.NewStore(log, outDB, dbCipher)
+	if err != nil {
+		log.WithError(err).Error("exchange.NewStore failed")
+		return err
+	}
+
+	if err := recovery.Write(store, r, confirmationsRequired(cfg)); err != nil {
+		log.WithError(err).Error("recovery.Write failed")
+		return err
+	}
+
+	// Every address that received a deposit was given out, whether the deposit was matched or not.
+	// It is marked as used in its pool, and scanned for deposits again.
+	usedAddrs := make(map[string][]string)
+	for _, d := range deposits {
+		usedAddrs[d.CoinType] = append(usedAddrs[d.CoinType], d.Address)
+	}
+
+	newUsedStores := map[string]func(*bolt.DB, *dbcrypt.Cipher) (*addrs.Store, error){
+		scanner.CoinTypeBTC: addrs.NewBTCUsedStore,
+		scanner.CoinTypeLTC: addrs.NewLTCUsedStore,
+	}
+	newScanStores := map[string]func(logrus.FieldLogger, *bolt.DB) (*scanner.BTCStore, error){
+		scanner.CoinTypeBTC: scanner.NewStore,
+		scanner.CoinTypeLTC: scanner.NewLTCStore,
+	}
+	for coinType, used := range usedAddrs {
+		usedStore, err := newUsedStores[coinType](outDB, dbCipher)
+		if err != nil {
+			log.WithError(err).Error("Create used address store failed")
+			return err
+		}
+
+		scanStore, err := newScanStores[coinType](log, outDB)
+		if err != nil {
+			log.WithError(err).Error("Create scanner store failed")
+			return err
+		}
+
+		for _, a := range used {
+			if isUsed, err := usedStore.IsUsed(a); err != nil {
+				log.WithError(err).Error("Check address is used failed")
+				return err
+			} else if isUsed {
+				continue
+			}
+
+			if err := usedStore.Put(a); err != nil {
+				log.WithError(err).Error("Mark address as used failed")
+				return err
+			}
+
+			if err := scanStore.AddScanAddress(a); err != nil {
+				log.WithError(err).Error("AddScanAddress failed")
+				return err
+			}
+		}
+	}
+
+	printRecoveryReport(r)
+
+	log.WithFields(logrus.Fields{
+		"matches":           len(r.Matches),
+		"unmatchedDeposits": len(r.UnmatchedDeposits),
+		"unmatchedPayouts":  len(r.UnmatchedPayouts),
+	}).Info("Recovered state")
+
+	return nil
+}
+
+// poolAddresses loads the addresses of the BTC address file, and of the LTC address file if LTC is enabled
+func poolAddresses(cfg config.Config) (map[string][]string, error) {
+	btcAddrs, err := loadAddressFile(cfg.BtcAddresses, addrs.LoadBTCAddresses)
+	if err != nil {
+		return nil, err
+	}
+	for i, a := range btcAddrs {
+		btcAddrs[i] = addrs.NormalizeBTCAddress(a)
+	}
+
+	poolAddrs := map[string][]string{
+		scanner.CoinTypeBTC: btcAddrs,
+	}
+
+	if cfg.LtcScanner.Enabled {
+		poolAddrs[scanner.CoinTypeLTC], err = loadAddressFile(cfg.LtcAddresses, addrs.LoadLTCAddresses)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return poolAddrs, nil
+}
+
+// loadAddressFile loads the addresses of an address file
+func loadAddressFile(path string, load func(io.Reader) ([]string, error)) ([]string, error) {
+	f, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Load deposit address list failed: %v", err)
+	}
+
+	return load(bytes.NewReader(f))
+}
+
+// scanDeposits scans the BTC blocks of the btcd node, and the LTC blocks if LTC is enabled,
+// for deposits to scanAddrs, keyed by coin type. The blocks are scanned from the initial scan height
+// to the last block the scanner would have scanned, the one with the required confirmations.
+func scanDeposits(log logrus.FieldLogger, cfg config.Config, scanAddrs map[string][]string, quit <-chan struct{}) ([]recovery.Deposit, error) {
+	if cfg.BtcScanner.Backend != config.BtcScannerBackendBtcd {
+		err := fmt.Errorf("btc_scanner.backend is %q, the blocks of a btcd node must be scanned", cfg.BtcScanner.Backend)
+		log.WithError(err).Error("Scan deposits failed")
+		return nil, err
+	}
+
+	btcrpc, err := newBtcdClient(log, config.BtcRPCNode{
+		Server: cfg.BtcRPC.Server,
+		User:   cfg.BtcRPC.User,
+		Pass:   cfg.BtcRPC.Pass,
+		Cert:   cfg.BtcRPC.Cert,
+	}, nil)
+	if err != nil {
+		log.WithError(err).Error("Connect to btcd failed")
+		return nil, err
+	}
+	defer btcrpc.Shutdown()
+
+	deposits, err := scanPool(log, btcrpc, scanner.CoinTypeBTC, scanAddrs[scanner.CoinTypeBTC], cfg.BtcScanner.InitialScanHeight, cfg.BtcScanner.ConfirmationsRequired, quit)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.LtcScanner.Enabled {
+		ltcrpc, err := scanner.NewLtcRPCClient(cfg.LtcRPC.Server, cfg.LtcRPC.User, cfg.LtcRPC.Pass)
+		if err != nil {
+			log.WithError(err).Error("Connect to ltc node failed")
+			return nil, err
+		}
+		defer ltcrpc.Shutdown()
+
+		ltcDeposits, err := scanPool(log, ltcrpc, scanner.CoinTypeLTC, scanAddrs[scanner.CoinTypeLTC], cfg.LtcScanner.InitialScanHeight, cfg.LtcScanner.ConfirmationsRequired, quit)
+		if err != nil {
+			return nil, err
+		}
+		deposits = append(deposits, ltcDeposits...)
+	}
+
+	return deposits, nil
+}
+
+// scanPool scans the blocks of a node from initialHeight to the last block with the required confirmations
+// for deposits to the addresses of a pool
+func scanPool(log logrus.FieldLogger, client scanner.BtcRPCClient, coinType string, poolAddrs []string, initialHeight, confirmations int64, quit <-chan struct{}) ([]recovery.Deposit, error) {
+	best, err := client.GetBlockCount()
+	if err != nil {
+		log.WithError(err).WithField("coinType", coinType).Error("GetBlockCount failed")
+		return nil, err
+	}
+
+	deposits, err := recovery.ScanChain(log, client, coinType, poolAddrs, initialHeight, best-confirmations, quit)
+	if err != nil {
+		log.WithError(err).WithField("coinType", coinType).Error("recovery.ScanChain failed")
+		return nil, err
+	}
+
+	return deposits, nil
+}
+
+// hotWalletPayouts returns the payouts of the hot wallet, or of the addresses of the remote signer,
+// found on the skycoin node
+func hotWalletPayouts(log logrus.FieldLogger, cfg config.Config) ([]recovery.Payout, error) {
+	txSigner, err := newTxSigner(cfg)
+	if err != nil {
+		log.WithError(err).Error("newTxSigner failed")
+		return nil, err
+	}
+
+	walletAddrs, err := txSigner.Addresses()
+	if err != nil {
+		log.WithError(err).Error("Get hot wallet addresses failed")
+		return nil, err
+	}
+
+	payouts, err := recovery.FindPayouts(&webrpc.Client{
+		Addr: cfg.SkyRPC.Address,
+	}, walletAddrs)
+	if err != nil {
+		log.WithError(err).Error("recovery.FindPayouts failed")
+		return nil, err
+	}
+
+	log.WithField("payouts", len(payouts)).Info("Found payouts of the hot wallet")
+
+	return payouts, nil
+}
+
+// printRecoveryReport prints the matched deposits and what could not be matched
+func printRecoveryReport(r recovery.Report) {
+	fmt.Printf("Matched deposits: %d\n", len(r.Matches))
+	for _, m := range r.Matches {
+		var note string
+		if m.Ambiguous {
+			note = " (ambiguous, other payouts of the same amount)"
+		}
+		fmt.Printf("  %s -> %s %s SKY in %s%s\n", m.Deposit.ID(), m.Payout.Address, skyString(m.Payout.Droplets), m.Payout.Txid, note)
+	}
+
+	fmt.Printf("Unmatched deposits: %d\n", len(r.UnmatchedDeposits))
+	for _, d := range r.UnmatchedDeposits {
+		fmt.Printf("  %s to %s, %d %s: %s\n", d.Deposit.ID(), d.Deposit.Address, d.Deposit.Value, d.Deposit.CoinType, d.Reason)
+	}
+
+	fmt.Printf("Unmatched payouts: %d\n", len(r.UnmatchedPayouts))
+	for _, p := range r.UnmatchedPayouts {
+		fmt.Printf("  %s:%s -> %s %s SKY\n", p.Txid, p.Output, p.Address, skyString(p.Droplets))
+	}
+}
+
+// skyString formats droplets as SKY
+func skyString(droplets uint64) string {
+	s, err := droplet.ToString(droplets)
+	if err != nil {
+		return fmt.Sprintf("%d droplets", droplets)
+	}
+	return s
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/skycoin/teller/src/config"
+	"github.com/skycoin/teller/src/exchange"
+	"github.com/skycoin/teller/src/teller"
+	"github.com/skycoin/teller/src/util/logger"
+)
+
+// configReloader re-reads the config file when teller receives SIGHUP, and applies the settings
+// that can be changed while teller is running to the exchange and the HTTP API, see config.Reload
+type configReloader struct {
+	log        logrus.FieldLogger
+	configName string
+	appDir     string
+	dryRun     bool
+	cfg        config.Config
+	exchange   *exchange.Exchange
+	teller     *teller.Teller
+	quit       chan struct{}
+	done       chan struct{}
+}
+
+func newConfigReloader(log logrus.FieldLogger, configName, appDir string, dryRun bool, cfg config.Config, e *exchange.Exchange, t *teller.Teller) *configReloader {
+	return &configReloader{
+		log:        log.WithField("prefix", "teller.reload"),
+		configName: configName,
+		appDir:     appDir,
+		dryRun:     dryRun,
+		cfg:        cfg,
+		exchange:   e,
+		teller:     t,
+		quit:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+}
+
+// Run reloads the config on each SIGHUP until Shutdown is called
+func (r *configReloader) Run() error {
+	defer close(r.done)
+
+	sigC := make(chan os.Signal, 1)
+	signal.Notify(sigC, syscall.SIGHUP)
+	defer signal.Stop(sigC)
+
+	for {
+		select {
+		case <-r.quit:
+			return nil
+		case <-sigC:
+			r.reload()
+		}
+	}
+}
+
+// Shutdown stops the configReloader
+func (r *configReloader) Shutdown() {
+	close(r.quit)
+	<-r.done
+}
+
+// reload re-reads and validates the config file and applies its dynamic settings.
+// If the config is invalid, the running config is kept.
+func (r *configReloader) reload() {
+	log := r.log
+	log.Info("Received SIGHUP, reloading config")
+
+	newCfg, err := loadConfig(r.configName, r.appDir, r.dryRun)
+	if err != nil {
+		log.WithError(err).Error("Config reload failed, keeping the running config")
+		return
+	}
+
+	cfg, applied, ignored := config.Reload(r.cfg, newCfg)
+
+	for _, c := range ignored {
+		log.WithFields(logrus.Fields{
+			"key": c.Key,
+			"old": c.Old,
+			"new": c.New,
+		}).Warn("Config value changed, restart teller to apply it")
+	}
+
+	if len(applied) == 0 {
+		log.Info("No config value to apply")
+		return
+	}
+
+	rate, ltcRate, tokenRates := exchangeRates(cfg)
+	if err := r.exchange.SetRates(rate, ltcRate, tokenRates); err != nil {
+		log.WithError(err).Error("exchange.SetRates failed, keeping the running config")
+		return
+	}
+
+	if err := r.teller.Reload(cfg); err != nil {
+		log.WithError(err).Error("teller.Reload failed, keeping the running config")
+
+		// Restore the running exchange rates, which are valid
+		if err := r.exchange.SetRates(exchangeRates(r.cfg)); err != nil {
+			log.WithError(err).Error("exchange.SetRates of the running rates failed")
+		}
+		return
+	}
+
+	r.cfg = cfg
+
+	for _, c := range applied {
+		logger.Audit(log).WithFields(logrus.Fields{
+			"key": c.Key,
+			"old": c.Old,
+			"new": c.New,
+		}).Info("Config value changed")
+	}
+
+	log.WithField("changes", len(applied)).Info("Config reloaded")
+}
+
+// exchangeRates returns the SKY/BTC rate, the SKY/LTC rate if LTC is enabled,
+// and the SKY/token rates of the ERC20 tokens if they are enabled
+func exchangeRates(cfg config.Config) (string, string, map[string]string) {
+	var ltcRate string
+	if cfg.LtcScanner.Enabled {
+		ltcRate = cfg.SkyExchanger.SkyLtcExchangeRate
+	}
+
+	var tokenRates map[string]string
+	if cfg.ERC20Scanner.Enabled {
+		tokenRates = make(map[string]string, len(cfg.ERC20Scanner.Tokens))
+		for _, t := range cfg.ERC20Scanner.Tokens {
+			tokenRates[t.Symbol] = t.SkyExchangeRate
+		}
+	}
+
+	return cfg.SkyExchanger.SkyBtcExchangeRate, ltcRate, tokenRates
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/skycoin/teller/src/backup"
+	"github.com/skycoin/teller/src/config"
+)
+
+// newBackupConfig returns the backup.Config of cfg, with its directories relative to appDir,
+// and the client of the bucket, nil if backup.s3.enabled is not set
+func newBackupConfig(cfg config.Config, appDir string) (backup.Config, *backup.S3, error) {
+	backupCfg := backup.Config{
+		Dir:        absPath(appDir, cfg.Backup.Dir),
+		Interval:   cfg.Backup.Interval,
+		Keep:       cfg.Backup.Keep,
+		Passphrase: cfg.Backup.Passphrase,
+		S3Prefix:   cfg.Backup.S3.Prefix,
+		S3Keep:     cfg.Backup.S3.Keep,
+	}
+
+	if !cfg.Backup.S3.Enabled {
+		return backupCfg, nil, nil
+	}
+
+	// The archived deposits are not in the snapshots, so the archives are uploaded too
+	if cfg.Archive.Enabled {
+		backupCfg.ArchiveDir = absPath(appDir, cfg.Archive.Dir)
+	}
+
+	s3, err := backup.NewS3(backup.S3Config{
+		Endpoint:        cfg.Backup.S3.Endpoint,
+		Region:          cfg.Backup.S3.Region,
+		Bucket:          cfg.Backup.S3.Bucket,
+		AccessKeyID:     cfg.Backup.S3.AccessKeyID,
+		SecretAccessKey: cfg.Backup.S3.SecretAccessKey,
+	})
+	if err != nil {
+		return backup.Config{}, nil, err
+	}
+
+	return backupCfg, s3, nil
+}
+
+// absPath returns path relative to appDir unless it is absolute
+func absPath(appDir, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(appDir, path)
+}
+
+// restoreBackup decrypts a snapshot of backup.dir, or of the bucket if backup.s3.enabled, into a new db at outPath
+// and verifies it. The deposit archives missing from archive.dir are fetched from the bucket.
+// The db is not replaced, stop teller and move the restored db to the db path to use it.
+func restoreBackup(configName, appDir, snapshot, outPath string) error {
+	cfg, err := loadConfig(configName, appDir, false)
+	if err != nil {
+		return fmt.Errorf("Config error:\n%v", err)
+	}
+
+	if !cfg.Backup.Enabled {
+		return errors.New("restore requires backup.enabled")
+	}
+
+	if outPath == "" {
+		outPath = filepath.Join(appDir, cfg.DBFilename) + ".restored"
+	}
+
+	backupCfg, s3, err := newBackupConfig(cfg, appDir)
+	if err != nil {
+		return err
+	}
+
+	restored, err := backup.Restore(backup.RestoreConfig{
+		Dir:        backupCfg.Dir,
+		Passphrase: backupCfg.Passphrase,
+		S3:         s3,
+		S3Prefix:   backupCfg.S3Prefix,
+		ArchiveDir: backupCfg.ArchiveDir,
+	}, snapshot, outPath)
+	if err != nil {
+		return fmt.Errorf("Restore failed: %v", err)
+	}
+
+	fmt.Printf("Restored snapshot %s into %s, it passed the db consistency check\n", restored.Snapshot, outPath)
+	for _, name := range restored.Archives {
+		fmt.Printf("Fetched deposit archive %s\n", name)
+	}
+
+	return nil
+}
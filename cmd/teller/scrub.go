@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/skycoin/teller/src/config"
+	"github.com/skycoin/teller/src/util/logger"
+)
+
+// scrubConfig returns the logger.ScrubConfig of the config, nil if logging.scrub_pii is disabled
+func scrubConfig(cfg config.Config) *logger.ScrubConfig {
+	if !cfg.Logging.ScrubPII {
+		return nil
+	}
+
+	return &logger.ScrubConfig{
+		Mode:   cfg.Logging.ScrubMode,
+		Secret: cfg.Logging.ScrubSecret,
+	}
+}
+
+// scrubHash prints the scrubbed form of an address, so that support can find its entries in the scrubbed logs
+func scrubHash(configName, appDir, addr string) error {
+	if addr == "" {
+		return errors.New("scrub-hash requires the address")
+	}
+
+	cfg, err := loadConfig(configName, appDir, false)
+	if err != nil {
+		return fmt.Errorf("Config error:\n%v", err)
+	}
+
+	scrub := scrubConfig(cfg)
+	if scrub == nil {
+		return errors.New("logging.scrub_pii is disabled, the logs have the addresses")
+	}
+
+	h, err := logger.NewScrubHook(*scrub)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(h.Scrub(addr))
+
+	return nil
+}
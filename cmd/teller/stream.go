@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/skycoin/teller/src/config"
+	"github.com/skycoin/teller/src/outbox"
+)
+
+// newStreamRelay returns the relay of the stream.backend
+func newStreamRelay(cfg config.Stream) (outbox.Relay, error) {
+	switch cfg.Backend {
+	case config.StreamBackendNATS:
+		return outbox.NewNATSRelay(outbox.NATSConfig{
+			URL:      cfg.URL,
+			Subject:  cfg.Topic,
+			User:     cfg.User,
+			Password: cfg.Password,
+			Token:    cfg.Token,
+		})
+	case config.StreamBackendKafka:
+		return outbox.NewKafkaRelay(outbox.KafkaConfig{
+			ProxyURL: cfg.URL,
+			Topic:    cfg.Topic,
+			User:     cfg.User,
+			Password: cfg.Password,
+		})
+	default:
+		return nil, fmt.Errorf("unknown stream backend %q", cfg.Backend)
+	}
+}
@@ -4,7 +4,11 @@ package main
 
 import (
 	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
@@ -12,22 +16,60 @@ import (
 	"os/user"
 	"path/filepath"
 	"runtime/pprof"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/boltdb/bolt"
 	btcrpcclient "github.com/btcsuite/btcd/rpcclient"
 	"github.com/google/gops/agent"
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/pflag"
+	"golang.org/x/crypto/ssh/terminal"
+
+	"github.com/skycoin/skycoin/src/util/droplet"
 
 	"github.com/skycoin/teller/src/addrs"
+	"github.com/skycoin/teller/src/alert"
+	"github.com/skycoin/teller/src/apikey"
+	"github.com/skycoin/teller/src/archive"
+	"github.com/skycoin/teller/src/backup"
+	"github.com/skycoin/teller/src/campaign"
+	"github.com/skycoin/teller/src/captcha"
 	"github.com/skycoin/teller/src/config"
+	"github.com/skycoin/teller/src/dashboard"
 	"github.com/skycoin/teller/src/exchange"
+	"github.com/skycoin/teller/src/ipfilter"
+	"github.com/skycoin/teller/src/kyc"
+	"github.com/skycoin/teller/src/leader"
 	"github.com/skycoin/teller/src/monitor"
+	"github.com/skycoin/teller/src/notify"
+	"github.com/skycoin/teller/src/outbox"
+	"github.com/skycoin/teller/src/ownership"
+	"github.com/skycoin/teller/src/pricing"
+	"github.com/skycoin/teller/src/privacy"
+	"github.com/skycoin/teller/src/promo"
+	"github.com/skycoin/teller/src/quote"
+	"github.com/skycoin/teller/src/ratelimit"
+	"github.com/skycoin/teller/src/rbac"
+	"github.com/skycoin/teller/src/report"
 	"github.com/skycoin/teller/src/scanner"
+	"github.com/skycoin/teller/src/screening"
+	"github.com/skycoin/teller/src/secrets"
 	"github.com/skycoin/teller/src/sender"
+	"github.com/skycoin/teller/src/sentry"
+	"github.com/skycoin/teller/src/settlement"
+	"github.com/skycoin/teller/src/signer"
+	"github.com/skycoin/teller/src/support"
 	"github.com/skycoin/teller/src/teller"
+	"github.com/skycoin/teller/src/tor"
+	"github.com/skycoin/teller/src/tracing"
+	"github.com/skycoin/teller/src/util/compact"
+	"github.com/skycoin/teller/src/util/dbcrypt"
 	"github.com/skycoin/teller/src/util/logger"
+	"github.com/skycoin/teller/src/util/qrutil"
+	"github.com/skycoin/teller/src/util/redisutil"
 )
 
 func main() {
@@ -47,20 +89,117 @@ func run() error {
 
 	appDirOpt := pflag.StringP("dir", "d", defaultAppDir, "application data directory")
 	configNameOpt := pflag.StringP("config", "c", "config", "name of configuration file")
+	rebuildOutOpt := pflag.String("rebuild-out", "", "path of the db written by rebuild-state, defaults to the db path with a .rebuilt suffix")
+	recoverOutOpt := pflag.String("recover-out", "", "path of the db written by recover, defaults to the db path with a .recovered suffix")
+	recoverMaxDelayOpt := pflag.Duration("recover-max-delay", 0, "maximum time between a deposit and the payout recover matches it with, 0 for no limit")
+	restoreOutOpt := pflag.String("restore-out", "", "path of the db written by restore, defaults to the db path with a .restored suffix")
+	restoreSnapshotOpt := pflag.String("restore-snapshot", "", "name of the snapshot restored by restore, defaults to the latest one")
+	presetOpt := pflag.String("preset", config.PresetProduction, fmt.Sprintf("deployment profile of config init, one of %s", strings.Join(config.Presets, ", ")))
+	outOpt := pflag.StringP("out", "o", "", "file written by config init, config upgrade or export. config init and export default to stdout, config upgrade to the config file, keeping the original with a .bak suffix")
+	formatOpt := pflag.String("format", report.FormatCSV, "format of export, csv, json or audit, a signed snapshot directory for auditors")
+	signKeyOpt := pflag.String("sign-key", "", "file of the hex secret key of the operator's skycoin address that export --format audit signs the snapshot with")
+	signerOpt := pflag.String("signer", "", "skycoin address that verify-export requires the snapshot to be signed by")
+	dryRunOpt := pflag.Bool("dry-run", false, "simulate deposits with the dummy scanner and log sends instead of broadcasting them, using a separate db. With migrate, only print the pending migrations")
+	dryRunDepositsOpt := pflag.String("dry-run-deposits", "", "JSON file of simulated deposits fed to the dummy scanner at startup, requires --dry-run")
+	readOnlyOpt := pflag.Bool("read-only", false, "serve the status, config and admin read endpoints from a copy of the db, without scanning, processing or sending deposits")
+	pflag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] [rebuild-state | recover | reconcile | export | verify-export DIR | migrate | compact | restore | check-config | scrub-hash ADDRESS | config init | config upgrade]\n", os.Args[0])
+		fmt.Fprintln(os.Stderr, "\nCommands:")
+		fmt.Fprintln(os.Stderr, "  rebuild-state   rebuild the deposit state from the event log into a new db and verify it matches the db")
+		fmt.Fprintln(os.Stderr, "  recover         rebuild a best-effort db from the blockchains and the hot wallet history, after the db was lost")
+		fmt.Fprintln(os.Stderr, "  reconcile       compare the deposits and hot wallet payouts on the chains with the db, and print the discrepancies")
+		fmt.Fprintln(os.Stderr, "  export          write every deposit and its payout in the --format, for accounting")
+		fmt.Fprintln(os.Stderr, "  verify-export   check that an export --format audit snapshot was not altered, and who signed it")
+		fmt.Fprintln(os.Stderr, "  migrate         apply the pending schema migrations of the db, or print them with --dry-run")
+		fmt.Fprintln(os.Stderr, "  compact         compact the db into a new file and swap it in, keeping the original db with a .bak suffix")
+		fmt.Fprintln(os.Stderr, "  restore         decrypt and verify the latest backup snapshot, or --restore-snapshot, into a new db")
+		fmt.Fprintln(os.Stderr, "  check-config    validate the config and check the files and services it refers to, without starting teller")
+		fmt.Fprintln(os.Stderr, "  scrub-hash      print the form of an address in the logs scrubbed by logging.scrub_pii, to find its entries")
+		fmt.Fprintln(os.Stderr, "  config init     write a fully commented config file for the --preset deployment profile")
+		fmt.Fprintln(os.Stderr, "  config upgrade  rewrite the config file in the current schema, keeping its values")
+		fmt.Fprintln(os.Stderr, "\nFlags:")
+		pflag.PrintDefaults()
+	}
 	pflag.Parse()
 
+	switch pflag.Arg(0) {
+	case "", "rebuild-state", "recover", "reconcile", "export":
+	case "check-config":
+		return checkConfig(*configNameOpt, *appDirOpt)
+	case "scrub-hash":
+		return scrubHash(*configNameOpt, *appDirOpt, pflag.Arg(1))
+	case "verify-export":
+		return verifyExport(pflag.Arg(1), *signerOpt)
+	case "migrate":
+		return migrateDB(*configNameOpt, *appDirOpt, *dryRunOpt)
+	case "compact":
+		return compactDB(*configNameOpt, *appDirOpt)
+	case "restore":
+		return restoreBackup(*configNameOpt, *appDirOpt, *restoreSnapshotOpt, *restoreOutOpt)
+	case "config":
+		switch pflag.Arg(1) {
+		case "init":
+			return configInit(*presetOpt, *outOpt)
+		case "upgrade":
+			return configUpgrade(*configNameOpt, *appDirOpt, *outOpt)
+		default:
+			pflag.Usage()
+			return fmt.Errorf("unknown config command %q", pflag.Arg(1))
+		}
+	default:
+		pflag.Usage()
+		return fmt.Errorf("unknown command %q", pflag.Arg(0))
+	}
+
 	if err := createFolderIfNotExist(*appDirOpt); err != nil {
 		fmt.Println("Create application data directory failed:", err)
 		return err
 	}
 
-	cfg, err := config.Load(*configNameOpt, *appDirOpt)
+	if *dryRunDepositsOpt != "" && !*dryRunOpt {
+		return errors.New("--dry-run-deposits requires --dry-run")
+	}
+
+	if *readOnlyOpt && (pflag.Arg(0) != "" || *dryRunOpt) {
+		return errors.New("--read-only can't be used with a command or --dry-run")
+	}
+
+	cfg, err := loadConfig(*configNameOpt, *appDirOpt, *dryRunOpt)
 	if err != nil {
 		return fmt.Errorf("Config error:\n%v", err)
 	}
 
+	dbPath := filepath.Join(*appDirOpt, cfg.DBFilename)
+	if *dryRunOpt {
+		dbPath += dryRunDBSuffix
+	}
+
+	// export writes to stdout by default, so it runs before the logger is created
+	if pflag.Arg(0) == "export" {
+		if *formatOpt == exportFormatAudit {
+			var archiveDir string
+			if cfg.Archive.Enabled {
+				archiveDir = absPath(*appDirOpt, cfg.Archive.Dir)
+			}
+			return exportAudit(dbPath, cfg.Encryption, archiveDir, *outOpt, *signKeyOpt)
+		}
+
+		return exportDeposits(dbPath, cfg.Encryption, *formatOpt, *outOpt)
+	}
+
 	// Init logger
-	rusloggger, err := logger.NewLogger(cfg.LogFilename, cfg.Debug)
+	rusloggger, err := logger.New(logger.Config{
+		Debug:         cfg.Debug,
+		JSON:          cfg.Logging.Format == config.LogFormatJSON,
+		Filename:      cfg.LogFilename,
+		AuditFilename: cfg.Logging.AuditFile,
+		Rotate: logger.RotateConfig{
+			MaxSize:    int64(cfg.Logging.MaxSizeMB) * 1024 * 1024,
+			MaxAge:     cfg.Logging.MaxAge,
+			MaxBackups: cfg.Logging.MaxBackups,
+		},
+		Scrub: scrubConfig(cfg),
+	})
 	if err != nil {
 		fmt.Println("Failed to create Logrus logger:", err)
 		return err
@@ -70,6 +209,72 @@ func run() error {
 
 	log.WithField("config", cfg.Redacted()).Info("Loaded teller config")
 
+	// Errors are reported from here on. The client is shut down last, sending the errors of the shutdown
+	if cfg.Sentry.Enabled {
+		// The server name is left out if the hostname can't be read
+		host, _ := os.Hostname()
+
+		sentryClient, err := sentry.NewClient(log, sentry.Config{
+			DSN:         cfg.Sentry.DSN,
+			Environment: cfg.Sentry.Environment,
+			ServerName:  host,
+		})
+		if err != nil {
+			log.WithError(err).Error("sentry.NewClient failed")
+			return err
+		}
+
+		go sentryClient.Run()
+		defer sentryClient.Shutdown()
+
+		rusloggger.Hooks.Add(sentry.NewHook(sentryClient))
+	}
+
+	if *dryRunOpt {
+		log.WithField("db", dbPath).Warn("Dry run, deposits are simulated and skycoin is not broadcast")
+	}
+
+	if *readOnlyOpt {
+		log.WithField("db", dbPath).Warn("Read-only, serving a copy of the db without scanning, processing or sending deposits")
+	}
+
+	if pflag.Arg(0) == "rebuild-state" {
+		outPath := *rebuildOutOpt
+		if outPath == "" {
+			outPath = dbPath + ".rebuilt"
+		}
+		return rebuildState(log, cfg.Encryption, dbPath, outPath)
+	}
+
+	if pflag.Arg(0) == "reconcile" {
+		quit := make(chan struct{})
+		go catchInterrupt(quit)
+
+		return reconcile(log, cfg, dbPath, quit)
+	}
+
+	// The passphrase is prompted for before anything else is started, since teller waits for it
+	var dbPassphrase string
+	if cfg.Encryption.Enabled {
+		dbPassphrase, err = readDBPassphrase(cfg.Encryption)
+		if err != nil {
+			log.WithError(err).Error("Read db encryption passphrase failed")
+			return err
+		}
+	}
+
+	if pflag.Arg(0) == "recover" {
+		outPath := *recoverOutOpt
+		if outPath == "" {
+			outPath = dbPath + ".recovered"
+		}
+
+		quit := make(chan struct{})
+		go catchInterrupt(quit)
+
+		return recoverState(log, cfg, dbPassphrase, outPath, *recoverMaxDelayOpt, quit)
+	}
+
 	if cfg.Profile {
 		// Start gops agent, for profiling
 		if err := agent.Listen(&agent.Options{
@@ -83,13 +288,27 @@ func run() error {
 	quit := make(chan struct{})
 	go catchInterrupt(quit)
 
-	// Open db
-	dbPath := filepath.Join(*appDirOpt, cfg.DBFilename)
-	db, err := bolt.Open(dbPath, 0700, &bolt.Options{
-		Timeout: 1 * time.Second,
-	})
-	if err != nil {
-		log.WithError(err).Error("Open db failed")
+	// The pid file belongs to the teller that processes the deposits
+	pidFile := cfg.Upgrade.PIDFile
+	if *readOnlyOpt {
+		pidFile = ""
+	}
+	if pidFile != "" && !filepath.IsAbs(pidFile) {
+		pidFile = filepath.Join(*appDirOpt, pidFile)
+	}
+
+	// The new process of an upgrade takes over before the old one exits,
+	// so it waits for the old one to finish its in-flight sends and release the db
+	dbTimeout := 1 * time.Second
+	if isUpgrade() {
+		dbTimeout = cfg.Upgrade.Timeout
+		log.WithField("timeout", dbTimeout).Info("Started by an upgrade, waiting for the old process to release the db")
+		if err := upgradeReady(pidFile); err != nil {
+			log.WithError(err).Error("upgradeReady failed")
+			return err
+		}
+	} else if err := writePIDFile(pidFile); err != nil {
+		log.WithError(err).Error("writePIDFile failed")
 		return err
 	}
 
@@ -101,6 +320,7 @@ func run() error {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
+			defer logger.LogPanic(log.WithField("task", name))
 			err := f()
 			if err != nil {
 				log.WithError(err).Errorf("Backgrounded task %s failed", name)
@@ -111,40 +331,122 @@ func run() error {
 		}()
 	}
 
+	// With ha enabled, only the leader opens the db, so a standby waits to be elected
+	// before starting. The old leader may still be releasing the db when the lock expires.
+	// A read-only teller doesn't take part in the election.
+	var elector *leader.Elector
+	if cfg.HA.Enabled && !*readOnlyOpt {
+		redisClient := redisutil.NewClient(redisutil.Config{
+			Addr:     cfg.Redis.Addr,
+			Password: cfg.Redis.Password,
+			DB:       cfg.Redis.DB,
+		})
+		defer redisClient.Close()
+
+		elector, err = leader.NewElector(log, redisClient, leader.Config{
+			Key:         cfg.HA.LockKey,
+			ID:          haInstanceID(cfg.HA),
+			TTL:         cfg.HA.LockTTL,
+			RetryPeriod: cfg.HA.RetryPeriod,
+		})
+		if err != nil {
+			log.WithError(err).Error("leader.NewElector failed")
+			return err
+		}
+
+		background("elector.Run", errC, elector.Run)
+
+		log.Info("Standby, waiting to be elected leader")
+		select {
+		case <-elector.Elected():
+		case <-quit:
+			elector.Shutdown()
+			wg.Wait()
+			return nil
+		}
+
+		if dbTimeout < cfg.HA.LockTTL {
+			dbTimeout = cfg.HA.LockTTL
+		}
+	}
+
+	// A read-only teller runs against a copy of the db, which is removed on shutdown
+	if *readOnlyOpt {
+		copyPath := dbPath + readOnlyDBSuffix
+		if err := copyDB(dbPath, copyPath); err != nil {
+			log.WithError(err).Error("copyDB failed")
+			return err
+		}
+		defer os.Remove(copyPath)
+
+		dbPath = copyPath
+	}
+
+	// Open db
+	dbOpts := &bolt.Options{
+		Timeout: dbTimeout,
+	}
+	db, err := bolt.Open(dbPath, 0700, dbOpts)
+	if err != nil {
+		log.WithError(err).Error("Open db failed")
+		return err
+	}
+
+	// A compaction requested with /api/compact is swapped in before anything writes to the db
+	db, err = compact.Swap(log, db, dbOpts)
+	if err != nil {
+		log.WithError(err).Error("compact.Swap failed")
+		return err
+	}
+
+	// Encrypts the address pools, the deposits and API key secrets, nil if encryption is disabled
+	var dbCipher *dbcrypt.Cipher
+	if cfg.Encryption.Enabled {
+		dbCipher, err = dbcrypt.Open(db, dbPassphrase)
+		if err != nil {
+			log.WithError(err).Error("dbcrypt.Open failed")
+			return err
+		}
+	} else if encrypted, err := dbcrypt.IsEncrypted(db); err != nil {
+		log.WithError(err).Error("dbcrypt.IsEncrypted failed")
+		return err
+	} else if encrypted {
+		log.WithError(errDBEncrypted).Error("Open db failed")
+		return errDBEncrypted
+	}
+
 	var btcScanner *scanner.BTCScanner
+	var addrScanner *scanner.AddressScanner
+	var ltcScanner *scanner.BTCScanner
+	var erc20Scanner *scanner.ERC20Scanner
+	var multiplexer *scanner.Multiplexer
 	var scanService scanner.Scanner
+	var skyNodes *sender.SkyNodes
 	var sendService *sender.SendService
 	var sendRPC sender.Sender
+	var topUpWatcher *sender.TopUpWatcher
+	var balanceMonitor *sender.BalanceMonitor
+	var dummyScanner *scanner.DummyScanner
+	var readOnlyScanStores scanStores
 
 	dummyMux := http.NewServeMux()
 
-	if cfg.Dummy.Scanner {
-		log.Info("btcd disabled, running dummy scanner")
+	if *readOnlyOpt {
+		// Nothing is scanned, the admin API lists the scan addresses of the db
+		log.Info("Read-only, running no scanner")
 		scanService = scanner.NewDummyScanner(log)
-		scanService.(*scanner.DummyScanner).BindHandlers(dummyMux)
-	} else {
-		// create btc rpc client
-		certs, err := ioutil.ReadFile(cfg.BtcRPC.Cert)
-		if err != nil {
-			return fmt.Errorf("Failed to read cfg.BtcRPC.Cert %s: %v", cfg.BtcRPC.Cert, err)
-		}
 
-		log.Info("Connecting to btcd")
-
-		btcrpc, err := btcrpcclient.New(&btcrpcclient.ConnConfig{
-			Endpoint:     "ws",
-			Host:         cfg.BtcRPC.Server,
-			User:         cfg.BtcRPC.User,
-			Pass:         cfg.BtcRPC.Pass,
-			Certificates: certs,
-		}, nil)
+		readOnlyScanStores, err = newScanStores(log, db, cfg)
 		if err != nil {
-			log.WithError(err).Error("Connect btcd failed")
+			log.WithError(err).Error("newScanStores failed")
 			return err
 		}
-
-		log.Info("Connect to btcd succeeded")
-
+	} else if cfg.Dummy.Scanner {
+		log.Info("btcd disabled, running dummy scanner")
+		dummyScanner = scanner.NewDummyScanner(log)
+		dummyScanner.BindHandlers(dummyMux)
+		scanService = dummyScanner
+	} else {
 		// create scan service
 		scanStore, err := scanner.NewStore(log, db)
 		if err != nil {
@@ -152,27 +454,226 @@ func run() error {
 			return err
 		}
 
-		btcScanner, err = scanner.NewBTCScanner(log, scanStore, btcrpc, scanner.Config{
-			ScanPeriod:            cfg.BtcScanner.ScanPeriod,
-			ConfirmationsRequired: cfg.BtcScanner.ConfirmationsRequired,
-			InitialScanHeight:     cfg.BtcScanner.InitialScanHeight,
-		})
-		if err != nil {
-			log.WithError(err).Error("Open scan service failed")
+		var btcScanService scanner.Scanner
+		switch cfg.BtcScanner.Backend {
+		case config.BtcScannerBackendElectrum, config.BtcScannerBackendBlockbook:
+			// Each scan shard has its own backend connection
+			backends := make([]scanner.AddressBackend, cfg.BtcScanner.ScanShards)
+			if cfg.BtcScanner.Backend == config.BtcScannerBackendElectrum {
+				var cert []byte
+				if cfg.BtcScanner.ElectrumCert != "" {
+					cert, err = ioutil.ReadFile(cfg.BtcScanner.ElectrumCert)
+					if err != nil {
+						return fmt.Errorf("Failed to read cfg.BtcScanner.ElectrumCert %s: %v", cfg.BtcScanner.ElectrumCert, err)
+					}
+				}
+
+				log.WithField("server", cfg.BtcScanner.ElectrumServer).WithField("shards", cfg.BtcScanner.ScanShards).Info("Using electrum scanner backend")
+				for i := range backends {
+					backends[i], err = scanner.NewElectrumClient(cfg.BtcScanner.ElectrumServer, cfg.BtcScanner.ElectrumTLS, cert)
+					if err != nil {
+						log.WithError(err).Error("scanner.NewElectrumClient failed")
+						return err
+					}
+				}
+			} else {
+				log.WithField("url", cfg.BtcScanner.BlockbookURL).WithField("shards", cfg.BtcScanner.ScanShards).Info("Using blockbook scanner backend")
+				for i := range backends {
+					backends[i] = scanner.NewBlockbookClient(cfg.BtcScanner.BlockbookURL)
+				}
+			}
+
+			addrScanner, err = scanner.NewShardedAddressScanner(log, scanStore, backends, scanner.Config{
+				ScanPeriod:            cfg.BtcScanner.ScanPeriod,
+				ConfirmationsRequired: cfg.BtcScanner.ConfirmationsRequired,
+				InitialScanHeight:     cfg.BtcScanner.InitialScanHeight,
+			})
+			if err != nil {
+				log.WithError(err).Error("Open scan service failed")
+				return err
+			}
+
+			background("addrScanner.Run", errC, addrScanner.Run)
+			btcScanService = addrScanner
+
+		default:
+			// create btc rpc client
+			log.Info("Connecting to btcd")
+
+			btcrpc, err := newBtcdClient(log, config.BtcRPCNode{
+				Server: cfg.BtcRPC.Server,
+				User:   cfg.BtcRPC.User,
+				Pass:   cfg.BtcRPC.Pass,
+				Cert:   cfg.BtcRPC.Cert,
+			}, nil)
+			if err != nil {
+				log.WithError(err).Error("Connect btcd failed")
+				return err
+			}
+
+			log.Info("Connect to btcd succeeded")
+
+			var btcClient scanner.BtcRPCClient = btcrpc
+			if len(cfg.BtcRPC.FallbackNodes) != 0 {
+				nodes := []scanner.FailoverNode{
+					{
+						Name:   cfg.BtcRPC.Server,
+						Client: btcrpc,
+					},
+				}
+
+				// Fallback nodes that are down connect in the background, so they don't stop teller from starting
+				for _, n := range cfg.BtcRPC.FallbackNodes {
+					c, err := newBtcdClient(log, n, quit)
+					if err != nil {
+						log.WithError(err).WithField("node", n.Server).Error("Create fallback btcd client failed")
+						return err
+					}
+
+					nodes = append(nodes, scanner.FailoverNode{
+						Name:   n.Server,
+						Client: c,
+					})
+				}
+
+				failoverClient, err := scanner.NewFailoverBtcRPCClient(log, nodes, cfg.BtcRPC.HealthCheckPeriod)
+				if err != nil {
+					log.WithError(err).Error("scanner.NewFailoverBtcRPCClient failed")
+					return err
+				}
+
+				background("failoverClient.Run", errC, failoverClient.Run)
+				btcClient = failoverClient
+			}
+
+			btcScanner, err = scanner.NewBTCScanner(log, scanStore, btcClient, scanner.Config{
+				ScanPeriod:            cfg.BtcScanner.ScanPeriod,
+				ConfirmationsRequired: cfg.BtcScanner.ConfirmationsRequired,
+				InitialScanHeight:     cfg.BtcScanner.InitialScanHeight,
+				ZMQAddress:            cfg.BtcScanner.ZMQAddress,
+				ScanConcurrency:       cfg.BtcScanner.ScanConcurrency,
+			})
+			if err != nil {
+				log.WithError(err).Error("Open scan service failed")
+				return err
+			}
+
+			background("btcScanner.Run", errC, btcScanner.Run)
+			btcScanService = btcScanner
+		}
+
+		multiplexer = scanner.NewMultiplexer(log)
+		if err := multiplexer.AddScanner(btcScanService, scanner.CoinTypeBTC); err != nil {
+			log.WithError(err).Error("multiplexer.AddScanner of BTC failed")
 			return err
 		}
 
-		background("btcScanner.Run", errC, btcScanner.Run)
+		if cfg.LtcScanner.Enabled {
+			log.Info("Connecting to litecoind")
+
+			ltcrpc, err := scanner.NewLtcRPCClient(cfg.LtcRPC.Server, cfg.LtcRPC.User, cfg.LtcRPC.Pass)
+			if err != nil {
+				log.WithError(err).Error("Connect litecoind failed")
+				return err
+			}
+
+			ltcScanStore, err := scanner.NewLTCStore(log, db)
+			if err != nil {
+				log.WithError(err).Error("scanner.NewLTCStore failed")
+				return err
+			}
+
+			ltcScanner, err = scanner.NewLTCScanner(log, ltcScanStore, ltcrpc, scanner.Config{
+				ScanPeriod:            cfg.LtcScanner.ScanPeriod,
+				ConfirmationsRequired: cfg.LtcScanner.ConfirmationsRequired,
+				InitialScanHeight:     cfg.LtcScanner.InitialScanHeight,
+				ZMQAddress:            cfg.LtcScanner.ZMQAddress,
+				ScanConcurrency:       cfg.LtcScanner.ScanConcurrency,
+			})
+			if err != nil {
+				log.WithError(err).Error("Open LTC scan service failed")
+				return err
+			}
+
+			background("ltcScanner.Run", errC, ltcScanner.Run)
+
+			if err := multiplexer.AddScanner(ltcScanner, scanner.CoinTypeLTC); err != nil {
+				log.WithError(err).Error("multiplexer.AddScanner of LTC failed")
+				return err
+			}
+		}
+
+		if cfg.ERC20Scanner.Enabled {
+			ethrpc := scanner.NewEthClient(cfg.EthRPC.URL)
+
+			erc20ScanStore, err := scanner.NewERC20Store(log, db)
+			if err != nil {
+				log.WithError(err).Error("scanner.NewERC20Store failed")
+				return err
+			}
+
+			var tokens []scanner.ERC20Token
+			for _, t := range cfg.ERC20Scanner.Tokens {
+				tokens = append(tokens, scanner.ERC20Token{
+					Symbol:   t.Symbol,
+					Contract: t.Contract,
+					Decimals: t.Decimals,
+				})
+			}
+
+			erc20Scanner, err = scanner.NewERC20Scanner(log, erc20ScanStore, ethrpc, tokens, scanner.Config{
+				ScanPeriod:            cfg.ERC20Scanner.ScanPeriod,
+				ConfirmationsRequired: cfg.ERC20Scanner.ConfirmationsRequired,
+				InitialScanHeight:     cfg.ERC20Scanner.InitialScanHeight,
+			})
+			if err != nil {
+				log.WithError(err).Error("Open ERC20 scan service failed")
+				return err
+			}
+
+			background("erc20Scanner.Run", errC, erc20Scanner.Run)
+
+			// The deposits of all tokens come from the same scanner
+			for _, t := range tokens {
+				if err := multiplexer.AddScanner(erc20Scanner, t.Symbol); err != nil {
+					log.WithError(err).WithField("token", t.Symbol).Error("multiplexer.AddScanner of ERC20 token failed")
+					return err
+				}
+			}
+		}
+
+		background("multiplexer.Run", errC, multiplexer.Run)
 
-		scanService = btcScanner
+		scanService = multiplexer
 	}
 
-	if cfg.Dummy.Sender {
+	if *readOnlyOpt {
+		// Nothing is sent, the exchange is not run
+		log.Info("Read-only, running no sender")
+		sendRPC = sender.NewDummySender(log)
+	} else if cfg.Dummy.Sender {
 		log.Info("skyd disabled, running dummy sender")
 		sendRPC = sender.NewDummySender(log)
 		sendRPC.(*sender.DummySender).BindHandlers(dummyMux)
 	} else {
-		skyRPC, err := sender.NewRPC(cfg.SkyExchanger.Wallet, cfg.SkyRPC.Address)
+		skyNodes, err = sender.NewSkyNodes(log, cfg.SkyRPC.Addresses(), sender.NodesConfig{
+			CheckPeriod: cfg.SkyRPC.HealthCheckPeriod,
+			MaxBackoff:  cfg.SkyRPC.MaxBackoff,
+		})
+		if err != nil {
+			log.WithError(err).Error("sender.NewSkyNodes failed")
+			return err
+		}
+
+		background("skyNodes.Run", errC, skyNodes.Run)
+
+		txSigner, err := newTxSigner(cfg)
+		if err != nil {
+			log.WithError(err).Error("newTxSigner failed")
+			return err
+		}
+
+		skyRPC, err := sender.NewRPC(txSigner, skyNodes)
 		if err != nil {
 			log.WithError(err).Error("sender.NewRPC failed")
 			return err
@@ -183,9 +684,55 @@ func run() error {
 		background("sendService.Run", errC, sendService.Run)
 
 		sendRPC = sender.NewRetrySender(sendService)
+
+		if cfg.WalletBalance.Enabled {
+			// Validated by cfg.Validate()
+			lowBalance, err := droplet.FromString(cfg.WalletBalance.LowBalance)
+			if err != nil {
+				log.WithError(err).Error("Invalid wallet_balance.low_balance")
+				return err
+			}
+
+			// Started once the outbox is set up, so that its alerts are relayed
+			balanceMonitor = sender.NewBalanceMonitor(log, skyRPC, sender.BalanceConfig{
+				CheckPeriod: cfg.WalletBalance.CheckPeriod,
+				LowBalance:  lowBalance,
+				Pause:       cfg.WalletBalance.PauseDeposits,
+			})
+		}
+
+		if cfg.WalletTopUp.Enabled {
+			senderStore, err := sender.NewStore(log, db)
+			if err != nil {
+				log.WithError(err).Error("sender.NewStore failed")
+				return err
+			}
+
+			// Validated by cfg.Validate()
+			resumeBalance, err := droplet.FromString(cfg.WalletTopUp.ResumeBalance)
+			if err != nil {
+				log.WithError(err).Error("Invalid wallet_topup.resume_balance")
+				return err
+			}
+
+			topUpWatcher = sender.NewTopUpWatcher(log, senderStore, skyRPC, sender.TopUpConfig{
+				CheckPeriod:   cfg.WalletTopUp.CheckPeriod,
+				ResumeBalance: resumeBalance,
+			})
+
+			if balanceMonitor != nil {
+				topUpWatcher.SetResumer(balanceMonitor)
+			}
+
+			background("topUpWatcher.Run", errC, topUpWatcher.Run)
+		}
+	}
+
+	if *dryRunOpt {
+		sendRPC = sender.NewDryRunSender(log, sendRPC)
 	}
 
-	if cfg.Dummy.Scanner || cfg.Dummy.Sender {
+	if (cfg.Dummy.Scanner || cfg.Dummy.Sender) && !*readOnlyOpt {
 		log.Infof("Starting dummy admin interface listener on http://%s", cfg.Dummy.HTTPAddr)
 		go func() {
 			if err := http.ListenAndServe(cfg.Dummy.HTTPAddr, dummyMux); err != nil {
@@ -194,80 +741,1079 @@ func run() error {
 		}()
 	}
 
-	// create exchange service
-	exchangeStore, err := exchange.NewStore(log, db)
-	if err != nil {
-		log.WithError(err).Error("exchange.NewStore failed")
-		return err
+	// create the alert notifier. It is started once its checks are added. A read-only teller doesn't alert.
+	var notifier *alert.Notifier
+	if cfg.Alerts.Enabled && !*readOnlyOpt {
+		notifier, err = newNotifier(log, cfg.Alerts)
+		if err != nil {
+			log.WithError(err).Error("newNotifier failed")
+			return err
+		}
+
+		if balanceMonitor != nil {
+			balanceMonitor.SetAlerter(notifier)
+		}
+
+		// Only the block scanners track how far behind they are
+		blockScanners := map[string]*scanner.BTCScanner{
+			scanner.CoinTypeBTC: btcScanner,
+			scanner.CoinTypeLTC: ltcScanner,
+		}
+		for coinType, s := range blockScanners {
+			if s == nil {
+				continue
+			}
+
+			coinType, s := coinType, s
+			notifier.AddCheck(alert.EventScannerBehind, func() string {
+				if n := s.Behind(); n > cfg.Alerts.ScannerBehindBlocks {
+					return fmt.Sprintf("%s scanner is %d confirmed blocks behind", coinType, n)
+				}
+				return ""
+			})
+		}
 	}
 
-	exchangeClient, err := exchange.NewExchange(log, exchangeStore, scanService, sendRPC, exchange.Config{
-		Rate: cfg.SkyExchanger.SkyBtcExchangeRate,
-		TxConfirmationCheckWait: cfg.SkyExchanger.TxConfirmationCheckWait,
-		MaxDecimals:             cfg.SkyExchanger.MaxDecimals,
-	})
-	if err != nil {
-		log.WithError(err).Error("exchange.NewExchange failed")
-		return err
+	// create the tracer, exporting the spans of the API requests and deposits
+	var tracer *tracing.Tracer
+	if cfg.Tracing.Enabled {
+		exporter := tracing.NewOTLPExporter(cfg.Tracing.OTLPEndpoint, cfg.Tracing.ServiceName)
+		tracer, err = tracing.NewTracer(log, exporter, tracing.Config{
+			SampleRatio: cfg.Tracing.SampleRatio,
+		})
+		if err != nil {
+			log.WithError(err).Error("tracing.NewTracer failed")
+			return err
+		}
+
+		background("tracer.Run", errC, tracer.Run)
 	}
 
-	background("exchangeClient.Run", errC, exchangeClient.Run)
+	// create pricing regions
+	var pricer *pricing.Pricer
+	var regions map[string]pricing.Region
+	if cfg.Pricing.Enabled {
+		var locator pricing.Locator
+		if cfg.Pricing.GeoIPHeader != "" {
+			locator = pricing.HeaderLocator(cfg.Pricing.GeoIPHeader)
+		} else {
+			f, err := os.Open(cfg.Pricing.GeoIPFile)
+			if err != nil {
+				log.WithError(err).Error("Open pricing.geoip_file failed")
+				return err
+			}
 
-	// create bitcoin address manager
-	f, err := ioutil.ReadFile(cfg.BtcAddresses)
-	if err != nil {
-		log.WithError(err).Error("Load deposit bitcoin address list failed")
-		return err
+			locator, err = pricing.NewNetworkLocator(f)
+			f.Close()
+			if err != nil {
+				log.WithError(err).Error("pricing.NewNetworkLocator failed")
+				return err
+			}
+		}
+
+		regions = make(map[string]pricing.Region, len(cfg.Pricing.Regions))
+		var regionList []pricing.Region
+		for _, r := range cfg.Pricing.Regions {
+			var minSky uint64
+			if r.MinSky != "" {
+				// Validated by cfg.Validate()
+				minSky, err = droplet.FromString(r.MinSky)
+				if err != nil {
+					log.WithError(err).Error("Invalid pricing.regions.min_sky")
+					return err
+				}
+			}
+
+			region := pricing.Region{
+				Name:         r.Name,
+				Countries:    r.Countries,
+				BonusPercent: r.BonusPercent,
+				MinSky:       minSky,
+			}
+			regions[r.Name] = region
+			regionList = append(regionList, region)
+		}
+
+		pricer, err = pricing.NewPricer(locator, regionList)
+		if err != nil {
+			log.WithError(err).Error("pricing.NewPricer failed")
+			return err
+		}
 	}
 
-	btcAddrMgr, err := addrs.NewBTCAddrs(log, db, bytes.NewReader(f))
+	// create exchange service
+	exchangeStore, err := exchange.NewStore(log, db, dbCipher)
 	if err != nil {
-		log.WithError(err).Error("Create bitcoin deposit address manager failed")
+		log.WithError(err).Error("exchange.NewStore failed")
 		return err
 	}
 
-	tellerServer := teller.New(log, exchangeClient, btcAddrMgr, cfg)
-
-	// Run the service
-	background("tellerServer.Run", errC, tellerServer.Run)
+	// create the outbox dispatcher, relaying deposit status changes to the webhook.
+	// The deposits of a read-only teller don't change.
+	var outboxDispatcher *outbox.Dispatcher
+	if cfg.Outbox.Enabled && !*readOnlyOpt {
+		outboxStore, err := outbox.NewStore(db)
+		if err != nil {
+			log.WithError(err).Error("outbox.NewStore failed")
+			return err
+		}
 
-	// start monitor service
-	monitorCfg := monitor.Config{
-		Addr: cfg.AdminPanel.Host,
-	}
-	monitorService := monitor.New(log, monitorCfg, btcAddrMgr, exchangeClient, btcScanner)
+		webhook, err := outbox.NewWebhookRelay(cfg.Outbox.WebhookURL, cfg.Outbox.WebhookSecret)
+		if err != nil {
+			log.WithError(err).Error("outbox.NewWebhookRelay failed")
+			return err
+		}
 
-	background("monitorService.Run", errC, monitorService.Run)
+		exchangeStore.EnableOutbox()
 
-	var finalErr error
-	select {
-	case <-quit:
-	case finalErr = <-errC:
-		if finalErr != nil {
-			log.WithError(finalErr).Error("Goroutine error")
+		if balanceMonitor != nil {
+			balanceMonitor.SetOutbox(outboxStore)
 		}
-	}
 
-	log.Info("Shutting down...")
+		outboxDispatcher = outbox.NewDispatcher(log, outboxStore, webhook, outbox.DispatcherConfig{
+			Period:     cfg.Outbox.DispatchPeriod,
+			MaxBackoff: cfg.Outbox.MaxBackoff,
+		})
 
-	if monitorService != nil {
-		log.Info("Shutting down monitorService")
-		monitorService.Shutdown()
+		background("outboxDispatcher.Run", errC, outboxDispatcher.Run)
+	}
+
+	// create the stream dispatcher, publishing deposit lifecycle events to NATS or Kafka.
+	// The events have their own outbox queue, so that a stream that is down doesn't hold up the webhook.
+	var streamDispatcher *outbox.Dispatcher
+	var streamRelay outbox.Relay
+	if cfg.Stream.Enabled && !*readOnlyOpt {
+		streamStore, err := outbox.NewQueueStore(db, exchange.StreamQueue)
+		if err != nil {
+			log.WithError(err).Error("outbox.NewQueueStore failed")
+			return err
+		}
+
+		streamRelay, err = newStreamRelay(cfg.Stream)
+		if err != nil {
+			log.WithError(err).Error("newStreamRelay failed")
+			return err
+		}
+
+		exchangeStore.EnableStream()
+
+		streamDispatcher = outbox.NewDispatcher(log.WithField("queue", exchange.StreamQueue), streamStore, streamRelay, outbox.DispatcherConfig{
+			Period:     cfg.Stream.DispatchPeriod,
+			MaxBackoff: cfg.Stream.MaxBackoff,
+		})
+
+		background("streamDispatcher.Run", errC, streamDispatcher.Run)
+	}
+
+	// create the notify dispatcher, emailing users who left an email address when binding of their deposits.
+	// The email addresses are encrypted with their own key, whether or not the db is encrypted.
+	// A read-only teller only reads them for the privacy export admin API.
+	var notifyStore *notify.Store
+	var notifyDispatcher *outbox.Dispatcher
+	if cfg.Notifications.Enabled {
+		notifyCipher, err := dbcrypt.OpenKey(db, notify.KeyName, cfg.Notifications.Secret)
+		if err != nil {
+			log.WithError(err).Error("dbcrypt.OpenKey failed")
+			return err
+		}
+
+		notifyStore, err = notify.NewStore(db, notifyCipher)
+		if err != nil {
+			log.WithError(err).Error("notify.NewStore failed")
+			return err
+		}
+	}
+
+	if notifyStore != nil && !*readOnlyOpt {
+		smtpCfg := cfg.Alerts.SMTP
+		if cfg.Notifications.From != "" {
+			smtpCfg.From = cfg.Notifications.From
+		}
+
+		mailer, err := newSMTPSink(smtpCfg)
+		if err != nil {
+			log.WithError(err).Error("newSMTPSink failed")
+			return err
+		}
+
+		tmpl, err := notify.NewTemplate(cfg.Notifications.SubjectTemplate, cfg.Notifications.Template)
+		if err != nil {
+			log.WithError(err).Error("notify.NewTemplate failed")
+			return err
+		}
+
+		userNotifier, err := notify.NewNotifier(log, notifyStore, mailer, notify.Config{
+			BaseURL:  cfg.Notifications.BaseURL,
+			Template: tmpl,
+		})
+		if err != nil {
+			log.WithError(err).Error("notify.NewNotifier failed")
+			return err
+		}
+
+		notifyQueue, err := outbox.NewQueueStore(db, notify.Queue)
+		if err != nil {
+			log.WithError(err).Error("outbox.NewQueueStore failed")
+			return err
+		}
+
+		exchangeStore.EnableNotifications()
+
+		notifyDispatcher = outbox.NewDispatcher(log.WithField("queue", notify.Queue), notifyQueue, userNotifier, outbox.DispatcherConfig{
+			Period:     cfg.Notifications.DispatchPeriod,
+			MaxBackoff: cfg.Notifications.MaxBackoff,
+		})
+
+		background("notifyDispatcher.Run", errC, notifyDispatcher.Run)
+	}
+
+	if balanceMonitor != nil {
+		background("balanceMonitor.Run", errC, balanceMonitor.Run)
+	}
+
+	// create the settlement notifier, notifying the partner of payouts until it acknowledges them.
+	// A read-only teller only lists the settlements with the admin API.
+	var settlementStore *settlement.Store
+	var settlementNotifier *settlement.Notifier
+	if cfg.Settlement.Enabled {
+		settlementStore, err = settlement.NewStore(db)
+		if err != nil {
+			log.WithError(err).Error("settlement.NewStore failed")
+			return err
+		}
+	}
+
+	if settlementStore != nil && !*readOnlyOpt {
+		partner, err := settlement.NewWebhookPartner(cfg.Settlement.WebhookURL, cfg.Settlement.WebhookSecret)
+		if err != nil {
+			log.WithError(err).Error("settlement.NewWebhookPartner failed")
+			return err
+		}
+
+		exchangeStore.EnableSettlements()
+
+		settlementNotifier = settlement.NewNotifier(log, settlementStore, partner, settlement.NotifierConfig{
+			CheckPeriod: cfg.Settlement.CheckPeriod,
+			RetryPeriod: cfg.Settlement.RetryPeriod,
+		})
+
+		background("settlementNotifier.Run", errC, settlementNotifier.Run)
+	}
+
+	rate, ltcRate, tokenRates := exchangeRates(cfg)
+	exchangeCfg := exchange.Config{
+		Rate:                    rate,
+		LtcRate:                 ltcRate,
+		TokenRates:              tokenRates,
+		TxConfirmationCheckWait: cfg.SkyExchanger.TxConfirmationCheckWait,
+		MaxDecimals:             cfg.SkyExchanger.MaxDecimals,
+		BatchWindow:             cfg.SkyExchanger.BatchWindow,
+		BatchMaxSize:            cfg.SkyExchanger.BatchMaxSize,
+		Regions:                 regions,
+		Fee: exchange.Fee{
+			Percent:       cfg.SkyExchanger.FeePercent,
+			FixedDroplets: cfg.SkyExchanger.FeeFixedDroplets,
+		},
+		ConfirmationsRequired:    confirmationsRequired(cfg),
+		DrainTimeout:             cfg.SkyExchanger.DrainTimeout,
+		DoubleSpendConfirmations: cfg.SkyExchanger.DoubleSpendConfirmations,
+		DoubleSpendCheckInterval: cfg.SkyExchanger.DoubleSpendCheckPeriod,
+		HideDust:                 cfg.Teller.HideDust,
+	}
+
+	// Validated by cfg.Validate()
+	exchangeCfg.ConfirmationTiers, err = confirmationTiers(cfg)
+	if err != nil {
+		log.WithError(err).Error("Invalid confirmation_tiers")
+		return err
+	}
+
+	// Validated by cfg.Validate()
+	exchangeCfg.DustThresholds, err = dustThresholds(cfg)
+	if err != nil {
+		log.WithError(err).Error("Invalid dust_threshold")
+		return err
+	}
+
+	if cfg.Teller.MaxSkyPerAddress != "" {
+		// Validated by cfg.Validate()
+		exchangeCfg.MaxSkyPerAddress, err = droplet.FromString(cfg.Teller.MaxSkyPerAddress)
+		if err != nil {
+			log.WithError(err).Error("Invalid teller.max_sky_per_addr")
+			return err
+		}
+	}
+
+	if cfg.KYC.Enabled {
+		exchangeCfg.KYCRecheckInterval = cfg.KYC.RecheckInterval
+
+		if cfg.KYC.Threshold != "" {
+			// Validated by cfg.Validate()
+			exchangeCfg.KYCThreshold, err = droplet.FromString(cfg.KYC.Threshold)
+			if err != nil {
+				log.WithError(err).Error("Invalid kyc.threshold")
+				return err
+			}
+		}
+	}
+
+	exchangeClient, err := exchange.NewExchange(log, exchangeStore, scanService, sendRPC, exchangeCfg)
+	if err != nil {
+		log.WithError(err).Error("exchange.NewExchange failed")
+		return err
+	}
+
+	if balanceMonitor != nil {
+		exchangeClient.SetPauser(balanceMonitor)
+	}
+
+	if notifier != nil {
+		exchangeClient.SetAlerter(notifier)
+
+		// unusual deposits and binds are alerted
+		anomalyCfg := alert.AnomalyConfig{
+			RepeatedDeposits:       cfg.Alerts.RepeatedDeposits,
+			RepeatedDepositsWindow: cfg.Alerts.RepeatedDepositsWindow,
+			BindSpikeFactor:        cfg.Alerts.BindSpikeFactor,
+			BindSpikeMin:           cfg.Alerts.BindSpikeMin,
+			BindSpikeWindow:        cfg.Alerts.BindSpikeWindow,
+			BindSpikeBaseline:      cfg.Alerts.BindSpikeBaseline,
+		}
+		if cfg.Alerts.LargeDeposit != "" {
+			// Validated by cfg.Validate()
+			anomalyCfg.LargeDeposit, err = qrutil.ParseAmount(cfg.Alerts.LargeDeposit)
+			if err != nil {
+				log.WithError(err).Error("Invalid alerts.large_deposit")
+				return err
+			}
+		}
+		exchangeClient.SetAnomalyDetector(alert.NewAnomalyDetector(notifier, anomalyCfg))
+	}
+
+	if tracer != nil {
+		exchangeClient.SetTracer(tracer)
+	}
+
+	// campaigns have their own deposit address pools, rates and caps
+	var campaignMgr *campaign.Manager
+	if cfg.Campaigns.Enabled {
+		coinTypes := []string{scanner.CoinTypeBTC}
+		if cfg.LtcScanner.Enabled {
+			coinTypes = append(coinTypes, scanner.CoinTypeLTC)
+		}
+		if cfg.ERC20Scanner.Enabled {
+			for _, t := range cfg.ERC20Scanner.Tokens {
+				coinTypes = append(coinTypes, t.Symbol)
+			}
+		}
+
+		campaignMgr, err = campaign.NewManager(log, db, dbCipher, coinTypes)
+		if err != nil {
+			log.WithError(err).Error("campaign.NewManager failed")
+			return err
+		}
+
+		exchangeClient.SetCampaigns(campaignMgr)
+	}
+
+	// quotes fix the rate of the deposits to an address until they expire
+	var quoteMgr *quote.Manager
+	if cfg.Quotes.Enabled {
+		// The amounts were validated by cfg.Validate
+		quoteCfg := quote.Config{
+			TTL: cfg.Quotes.TTL,
+		}
+		if cfg.Quotes.MinAmount != "" {
+			quoteCfg.MinAmount, _ = qrutil.ParseAmount(cfg.Quotes.MinAmount)
+		}
+		if cfg.Quotes.MaxAmount != "" {
+			quoteCfg.MaxAmount, _ = qrutil.ParseAmount(cfg.Quotes.MaxAmount)
+		}
+
+		quoteMgr, err = quote.NewManager(db, quoteCfg)
+		if err != nil {
+			log.WithError(err).Error("quote.NewManager failed")
+			return err
+		}
+
+		exchangeClient.SetQuotes(quoteMgr)
+	}
+
+	// promo codes give the deposits to the addresses bound with them a bonus
+	var promoMgr *promo.Manager
+	if cfg.PromoCodes.Enabled {
+		promoMgr, err = promo.NewManager(db)
+		if err != nil {
+			log.WithError(err).Error("promo.NewManager failed")
+			return err
+		}
+
+		exchangeClient.SetPromoCodes(promoMgr)
+	}
+
+	// deposits of skycoin addresses whose owners did not pass KYC are held
+	var kycClient *kyc.Client
+	if cfg.KYC.Enabled {
+		kycClient, err = kyc.NewClient(cfg.KYC.URL, cfg.KYC.APIKey, cfg.KYC.Timeout)
+		if err != nil {
+			log.WithError(err).Error("kyc.NewClient failed")
+			return err
+		}
+
+		exchangeClient.SetKYC(kycClient)
+	}
+
+	// deposits flagged by screening are held for review
+	if cfg.Screening.Enabled {
+		switch cfg.Screening.Provider {
+		case screening.ProviderRules:
+			var rules screening.Rules
+			if cfg.Screening.MaxValue != "" {
+				// Validated by cfg.Validate()
+				rules.MaxValue, err = qrutil.ParseAmount(cfg.Screening.MaxValue)
+				if err != nil {
+					log.WithError(err).Error("Invalid screening.max_value")
+					return err
+				}
+			}
+			exchangeClient.SetScreener(rules)
+		case screening.ProviderAPI:
+			screeningClient, err := screening.NewClient(cfg.Screening.URL, cfg.Screening.APIKey, cfg.Screening.Timeout)
+			if err != nil {
+				log.WithError(err).Error("screening.NewClient failed")
+				return err
+			}
+			exchangeClient.SetScreener(screeningClient)
+		}
+	}
+
+	// the scanners report the best heights that deposit confirmations are counted from.
+	// The block scanners also check deposits for double spends, the address scanner can't see the inputs of deposits.
+	switch {
+	case btcScanner != nil:
+		exchangeClient.SetBestHeighter(scanner.CoinTypeBTC, btcScanner)
+		exchangeClient.SetDepositChecker(scanner.CoinTypeBTC, btcScanner)
+	case addrScanner != nil:
+		exchangeClient.SetBestHeighter(scanner.CoinTypeBTC, addrScanner)
+	}
+
+	if ltcScanner != nil {
+		exchangeClient.SetBestHeighter(scanner.CoinTypeLTC, ltcScanner)
+		exchangeClient.SetDepositChecker(scanner.CoinTypeLTC, ltcScanner)
+	}
+
+	if erc20Scanner != nil {
+		for _, t := range cfg.ERC20Scanner.Tokens {
+			exchangeClient.SetBestHeighter(t.Symbol, erc20Scanner)
+		}
+	}
+
+	if !*readOnlyOpt {
+		background("exchangeClient.Run", errC, exchangeClient.Run)
+	}
+
+	// feed the simulated deposits of a dry run once the exchange is reading them
+	if *dryRunDepositsOpt != "" {
+		deposits, err := scanner.ReadDummyDeposits(*dryRunDepositsOpt)
+		if err != nil {
+			log.WithError(err).Error("scanner.ReadDummyDeposits failed")
+			return err
+		}
+
+		go dummyScanner.FeedDeposits(deposits, quit)
+	}
+
+	// create the daily reconciliation report scheduler. A read-only teller only serves the reports with the admin API.
+	var reportScheduler *report.Scheduler
+	if cfg.Reports.Enabled {
+		reportsDir := cfg.Reports.Dir
+		if !filepath.IsAbs(reportsDir) {
+			reportsDir = filepath.Join(*appDirOpt, reportsDir)
+		}
+
+		reportStore, err := report.NewStore(reportsDir)
+		if err != nil {
+			log.WithError(err).Error("report.NewStore failed")
+			return err
+		}
+
+		reportScheduler = report.NewScheduler(log, exchangeStore, reportStore, report.SchedulerConfig{
+			CheckPeriod: cfg.Reports.CheckPeriod,
+		})
+
+		if cfg.Reports.Email {
+			mailer, err := newSMTPSink(cfg.Alerts.SMTP)
+			if err != nil {
+				log.WithError(err).Error("newSMTPSink failed")
+				return err
+			}
+
+			reportScheduler.SetMailer(mailer)
+		}
+
+		if !*readOnlyOpt {
+			background("reportScheduler.Run", errC, reportScheduler.Run)
+		}
+	}
+
+	// create the archiver of the processed deposits. A read-only teller only reads the archives with the admin API.
+	var archiver *archive.Archiver
+	if cfg.Archive.Enabled {
+		archiveDir := cfg.Archive.Dir
+		if !filepath.IsAbs(archiveDir) {
+			archiveDir = filepath.Join(*appDirOpt, archiveDir)
+		}
+
+		archiveStore, err := archive.NewStore(archiveDir)
+		if err != nil {
+			log.WithError(err).Error("archive.NewStore failed")
+			return err
+		}
+
+		archiver = archive.NewArchiver(log, exchangeStore, archiveStore, archive.Config{
+			Retention:   cfg.Archive.Retention(),
+			CheckPeriod: cfg.Archive.CheckPeriod,
+		})
+
+		if !*readOnlyOpt {
+			background("archiver.Run", errC, archiver.Run)
+		}
+	}
+
+	// create the backuper of the db
+	var backuper *backup.Backuper
+	if cfg.Backup.Enabled && !*readOnlyOpt {
+		backupCfg, s3, err := newBackupConfig(cfg, *appDirOpt)
+		if err != nil {
+			log.WithError(err).Error("newBackupConfig failed")
+			return err
+		}
+
+		backuper, err = backup.NewBackuper(log, db, s3, backupCfg)
+		if err != nil {
+			log.WithError(err).Error("backup.NewBackuper failed")
+			return err
+		}
+
+		background("backuper.Run", errC, backuper.Run)
+	}
+
+	// create the deposit address providers, of the address files or of the remote address service
+	var addrClient *addrs.RemoteClient
+	if cfg.AddressProvider.Enabled {
+		addrClient, err = addrs.NewRemoteClient(cfg.AddressProvider.URL, cfg.AddressProvider.APIKey, cfg.AddressProvider.Timeout)
+		if err != nil {
+			log.WithError(err).Error("addrs.NewRemoteClient failed")
+			return err
+		}
+	}
+
+	var btcAddrMgr addrs.AddressProvider
+	if addrClient != nil {
+		btcAddrMgr, err = addrs.NewBTCRemoteAddrs(log, db, dbCipher, addrClient, cfg.AddressProvider.BatchSize)
+	} else {
+		btcAddrMgr, err = newFileAddrs(log, db, dbCipher, cfg.BtcAddresses, addrs.NewBTCAddrs)
+	}
+	if err != nil {
+		log.WithError(err).Error("Create bitcoin deposit address manager failed")
+		return err
+	}
+
+	addrManager := addrs.NewAddrManager()
+	if err := addrManager.PushGenerator(btcAddrMgr, scanner.CoinTypeBTC); err != nil {
+		log.WithError(err).Error("addrManager.PushGenerator of BTC failed")
+		return err
+	}
+
+	if cfg.LtcScanner.Enabled {
+		// create litecoin address manager
+		var ltcAddrMgr addrs.AddressProvider
+		if addrClient != nil {
+			ltcAddrMgr, err = addrs.NewLTCRemoteAddrs(log, db, dbCipher, addrClient, cfg.AddressProvider.BatchSize)
+		} else {
+			ltcAddrMgr, err = newFileAddrs(log, db, dbCipher, cfg.LtcAddresses, addrs.NewLTCAddrs)
+		}
+		if err != nil {
+			log.WithError(err).Error("Create litecoin deposit address manager failed")
+			return err
+		}
+
+		if err := addrManager.PushGenerator(ltcAddrMgr, scanner.CoinTypeLTC); err != nil {
+			log.WithError(err).Error("addrManager.PushGenerator of LTC failed")
+			return err
+		}
+	}
+
+	if cfg.ERC20Scanner.Enabled {
+		// create ethereum address manager, shared by all tokens
+		var ethAddrMgr addrs.AddressProvider
+		if addrClient != nil {
+			ethAddrMgr, err = addrs.NewETHRemoteAddrs(log, db, dbCipher, addrClient, cfg.AddressProvider.BatchSize)
+		} else {
+			ethAddrMgr, err = newFileAddrs(log, db, dbCipher, cfg.EthAddresses, addrs.NewETHAddrs)
+		}
+		if err != nil {
+			log.WithError(err).Error("Create ethereum deposit address manager failed")
+			return err
+		}
+
+		for _, t := range cfg.ERC20Scanner.Tokens {
+			if err := addrManager.PushGenerator(ethAddrMgr, t.Symbol); err != nil {
+				log.WithError(err).WithField("token", t.Symbol).Error("addrManager.PushGenerator of ERC20 token failed")
+				return err
+			}
+		}
+	}
+
+	// Fail fast if an address is in two pools, or would be bound twice
+	poolListers := []addrs.PoolLister{addrManager}
+	if campaignMgr != nil {
+		poolListers = append(poolListers, campaignMgr)
+	}
+	conflictChecker := addrs.NewConflictChecker(exchangeStore, poolListers...)
+	if err := conflictChecker.Check(); err != nil {
+		log.WithError(err).Error("Deposit address pools conflict, fix the address files or campaign pools")
+		return err
+	}
+	addrManager.SetConflictChecker(conflictChecker)
+	if campaignMgr != nil {
+		campaignMgr.SetConflictChecker(conflictChecker)
+	}
+
+	var limitStore ratelimit.Store
+	var boltLimitStore *ratelimit.BoltStore
+	switch cfg.Web.RateLimitBackend {
+	case config.RateLimitBackendRedis:
+		redisClient := redisutil.NewClient(redisutil.Config{
+			Addr:     cfg.Redis.Addr,
+			Password: cfg.Redis.Password,
+			DB:       cfg.Redis.DB,
+		})
+		defer redisClient.Close()
+
+		limitStore, err = ratelimit.NewRedisStore(redisClient, "teller:ratelimit:")
+		if err != nil {
+			log.WithError(err).Error("ratelimit.NewRedisStore failed")
+			return err
+		}
+	default:
+		boltLimitStore, err = ratelimit.NewBoltStore(log, db)
+		if err != nil {
+			log.WithError(err).Error("ratelimit.NewBoltStore failed")
+			return err
+		}
+
+		background("boltLimitStore.Run", errC, boltLimitStore.Run)
+		limitStore = boltLimitStore
+	}
+
+	var captchaVerifier teller.CaptchaVerifier
+	if cfg.Captcha.Enabled {
+		captchaVerifier, err = captcha.NewVerifier(cfg.Captcha.Provider, cfg.Captcha.Secret)
+		if err != nil {
+			log.WithError(err).Error("captcha.NewVerifier failed")
+			return err
+		}
+	}
+
+	var supportStore *support.Store
+	var supportTokens teller.SupportTokenAuthorizer
+	if cfg.SupportTokens.Enabled {
+		supportStore, err = support.NewStore(db, support.Config{
+			DefaultTTL: cfg.SupportTokens.DefaultTTL,
+			MaxTTL:     cfg.SupportTokens.MaxTTL,
+		})
+		if err != nil {
+			log.WithError(err).Error("support.NewStore failed")
+			return err
+		}
+		supportTokens = supportStore
+	}
+
+	var apiKeyStore *apikey.Store
+	if cfg.APIKeys.Enabled {
+		apiKeyStore, err = apikey.NewStore(db, apikey.Config{
+			MaxClockSkew:             cfg.APIKeys.MaxClockSkew,
+			DefaultMaxBoundAddresses: cfg.APIKeys.MaxBoundBtcAddresses,
+			Cipher:                   dbCipher,
+		})
+		if err != nil {
+			log.WithError(err).Error("apikey.NewStore failed")
+			return err
+		}
+	}
+
+	// IP bans are kept in memory, they are lifted on restart
+	ipFilter, err := ipfilter.NewFilter(cfg.Web.IPAllowlist, cfg.Web.IPDenylist)
+	if err != nil {
+		log.WithError(err).Error("ipfilter.NewFilter failed")
+		return err
+	}
+
+	tellerServer := teller.New(log, exchangeClient, addrManager, limitStore, captchaVerifier, pricer, supportTokens, cfg)
+	tellerServer.SetIPFilter(ipFilter)
+
+	if *readOnlyOpt {
+		tellerServer.SetReadOnly()
+	}
+
+	if tracer != nil {
+		tellerServer.SetTracer(tracer)
+	}
+
+	if apiKeyStore != nil {
+		tellerServer.SetAPIKeys(apiKeyStore)
+	}
+
+	// status requests prove the ownership of their skycoin address
+	if cfg.StatusChallenge.Enabled {
+		challenger, err := ownership.NewChallenger([]byte(cfg.StatusChallenge.Secret), cfg.StatusChallenge.TTL)
+		if err != nil {
+			log.WithError(err).Error("ownership.NewChallenger failed")
+			return err
+		}
+
+		tellerServer.SetOwnership(challenger)
+	}
+
+	// bind requests are signed with the secret key of their skycoin address
+	if cfg.BindSignature.Enabled {
+		tellerServer.SetBindSignatures(ownership.NewBindVerifier(cfg.BindSignature.MaxClockSkew))
+	}
+
+	if campaignMgr != nil {
+		tellerServer.SetCampaigns(campaignMgr)
+	}
+
+	if quoteMgr != nil {
+		tellerServer.SetQuotes(quoteMgr)
+	}
+
+	if promoMgr != nil {
+		tellerServer.SetPromoCodes(promoMgr)
+	}
+
+	if kycClient != nil && cfg.KYC.AtBind {
+		tellerServer.SetKYC(kycClient)
+	}
+
+	if notifyStore != nil && !*readOnlyOpt {
+		tellerServer.SetNotifications(notifyStore)
+	}
+
+	if notifier != nil {
+		tellerServer.SetErrorCounter(alert.NewHTTPErrorCounter(notifier, cfg.Alerts.HTTPErrors, cfg.Alerts.HTTPErrorsWindow))
+
+		notifier.AddCheck(alert.EventAddressPoolLow, func() string {
+			if n := btcAddrMgr.Remaining(); n < cfg.Alerts.AddressPoolLow {
+				if cfg.AddressProvider.Enabled {
+					return fmt.Sprintf("Only %d BTC deposit addresses are left in the address service", n)
+				}
+				return fmt.Sprintf("Only %d BTC deposit addresses are left, add more with the /api/addresses admin API", n)
+			}
+			return ""
+		})
+
+		background("notifier.Run", errC, notifier.Run)
+	}
+
+	// Run the service
+	background("tellerServer.Run", errC, tellerServer.Run)
+
+	// publish the HTTP listener as a tor hidden service. A read-only teller would take over the address of the service.
+	var torService *tor.Service
+	if cfg.Tor.Enabled && !*readOnlyOpt {
+		keyFile := cfg.Tor.KeyFile
+		if !filepath.IsAbs(keyFile) {
+			keyFile = filepath.Join(*appDirOpt, keyFile)
+		}
+
+		torService = tor.NewService(log, tor.Config{
+			ControlAddr:     cfg.Tor.ControlAddr,
+			ControlPassword: cfg.Tor.ControlPassword,
+			KeyFile:         keyFile,
+			VirtualPort:     cfg.Tor.VirtualPort,
+			Target:          cfg.TorTarget(),
+			RetryDelay:      cfg.Tor.RetryDelay,
+		})
+
+		background("torService.Run", errC, torService.Run)
+	}
+
+	// reload the exchange rates, rate limits and max bound addresses on SIGHUP
+	reloader := newConfigReloader(log, *configNameOpt, *appDirOpt, *dryRunOpt, cfg, exchangeClient, tellerServer)
+	background("reloader.Run", errC, reloader.Run)
+
+	upgrader := newUpgrader(log, cfg.Upgrade.Timeout, pidFile)
+	background("upgrader.Run", errC, upgrader.Run)
+
+	// switch the log level between debug and the configured level on SIGUSR1
+	logLevels := logger.NewLevelSetter(rusloggger)
+	logLevelToggler := newLogLevelToggler(log, logLevels)
+	background("logLevelToggler.Run", errC, logLevelToggler.Run)
+
+	// renew the secrets provider credentials, so that the secrets can be fetched again on reload
+	var secretsRenewer *secrets.Renewer
+	if cfg.Secrets.Provider != "" {
+		secretsProvider, err := cfg.Secrets.NewProvider()
+		if err != nil {
+			log.WithError(err).Error("cfg.Secrets.NewProvider failed")
+			return err
+		}
+
+		secretsRenewer = secrets.NewRenewer(log, secretsProvider, secrets.RenewerConfig{
+			RenewPeriod: cfg.Secrets.RenewPeriod,
+		})
+
+		background("secretsRenewer.Run", errC, secretsRenewer.Run)
+	}
+
+	// start monitor service
+	monitorCfg := monitor.Config{
+		Addr:     cfg.AdminPanel.Host,
+		ReadOnly: *readOnlyOpt,
+	}
+	monitorCfg.Auth, monitorCfg.TLS, err = newAdminAuth(cfg.AdminPanel)
+	if err != nil {
+		log.WithError(err).Error("Create admin API auth failed")
+		return err
+	}
+	if monitorCfg.Auth == nil {
+		log.Warning("admin_panel.principals is empty, the admin API is open to anyone who can connect to admin_panel.host")
+	}
+	var scanAddrs monitor.ScanAddressGetter = scanService
+	if readOnlyScanStores != nil {
+		scanAddrs = readOnlyScanStores
+	}
+	monitorService := monitor.New(log, monitorCfg, btcAddrMgr, exchangeClient, scanAddrs)
+	monitorService.Pauser = exchangeClient
+	monitorService.Maintenance = tellerServer
+	monitorService.LogLevel = logLevels
+	monitorService.Reprocessor = exchangeClient
+	monitorService.Auditor = exchangeClient
+	monitorService.Events = exchangeStore
+	monitorService.Addresses = addrManager
+	if topUpWatcher != nil {
+		monitorService.TopUpGetter = topUpWatcher
+	}
+	if balanceMonitor != nil {
+		monitorService.BalanceGetter = balanceMonitor
+	}
+	if settlementStore != nil {
+		monitorService.Settlements = settlementStore
+	}
+	if supportStore != nil {
+		monitorService.SupportTokens = supportStore
+	}
+	if apiKeyStore != nil {
+		monitorService.APIKeys = apiKeyStore
+	}
+	monitorService.IPBans = ipFilter
+	if multiplexer != nil {
+		monitorService.Rescanner = multiplexer
+	}
+	if reportScheduler != nil {
+		monitorService.Reports = reportScheduler
+	}
+	if archiver != nil {
+		monitorService.Archive = archiver
+	}
+	if !*readOnlyOpt {
+		monitorService.Compactor = compact.NewCompactor(log, db)
+	}
+	if campaignMgr != nil {
+		monitorService.Campaigns = campaignMgr
+	}
+	if promoMgr != nil {
+		monitorService.PromoCodes = promoMgr
+	}
+
+	privacyMgr := privacy.New(exchangeStore)
+	if archiver != nil {
+		privacyMgr.Archive = archiver
+	}
+	if settlementStore != nil {
+		privacyMgr.Settlements = settlementStore
+	}
+	if supportStore != nil {
+		privacyMgr.SupportTokens = supportStore
+	}
+	if notifyStore != nil {
+		privacyMgr.Subscriptions = notifyStore
+	}
+	monitorService.Privacy = privacyMgr
+
+	if kycClient != nil {
+		monitorService.KYC = exchangeClient
+	}
+
+	// deposits are held for review by screening and by the lifetime purchase limit
+	if cfg.Screening.Enabled || cfg.Teller.MaxSkyPerAddress != "" {
+		monitorService.Reviewer = exchangeClient
+	}
+
+	background("monitorService.Run", errC, monitorService.Run)
+
+	var adminDashboard *dashboard.Dashboard
+	if cfg.AdminDashboard.Enabled {
+		adminDashboard, err = dashboard.New(log, dashboard.Config{
+			Addr:     cfg.AdminDashboard.Host,
+			Username: cfg.AdminDashboard.Username,
+			Password: cfg.AdminDashboard.Password,
+		}, monitorService.Handler())
+		if err != nil {
+			log.WithError(err).Error("dashboard.New failed")
+			return err
+		}
+
+		background("adminDashboard.Run", errC, adminDashboard.Run)
+	}
+
+	var finalErr error
+	select {
+	case <-quit:
+	case <-upgrader.Upgraded():
+	case finalErr = <-errC:
+		if finalErr != nil {
+			log.WithError(finalErr).Error("Goroutine error")
+		}
+	}
+
+	log.Info("Shutting down...")
+
+	log.Info("Shutting down reloader")
+	reloader.Shutdown()
+
+	log.Info("Shutting down upgrader")
+	upgrader.Shutdown()
+
+	log.Info("Shutting down logLevelToggler")
+	logLevelToggler.Shutdown()
+
+	if secretsRenewer != nil {
+		log.Info("Shutting down secretsRenewer")
+		secretsRenewer.Shutdown()
+	}
+
+	if adminDashboard != nil {
+		log.Info("Shutting down adminDashboard")
+		adminDashboard.Shutdown()
+	}
+
+	if monitorService != nil {
+		log.Info("Shutting down monitorService")
+		monitorService.Shutdown()
+	}
+
+	// remove the hidden service before the HTTP listener closes
+	if torService != nil {
+		log.Info("Shutting down torService")
+		torService.Shutdown()
+	}
+
+	// close the teller service
+	log.Info("Shutting down tellerServer")
+	tellerServer.Shutdown()
+
+	// save the rate limits after the API, which takes from them
+	if boltLimitStore != nil {
+		log.Info("Shutting down boltLimitStore")
+		boltLimitStore.Shutdown()
 	}
 
-	// close the teller service
-	log.Info("Shutting down tellerServer")
-	tellerServer.Shutdown()
-
 	// close the scan service
 	if btcScanner != nil {
 		log.Info("Shutting down btcScanner")
 		btcScanner.Shutdown()
 	}
 
-	// close exchange service
-	log.Info("Shutting down exchangeClient")
-	exchangeClient.Shutdown()
+	if addrScanner != nil {
+		log.Info("Shutting down addrScanner")
+		addrScanner.Shutdown()
+	}
+
+	if ltcScanner != nil {
+		log.Info("Shutting down ltcScanner")
+		ltcScanner.Shutdown()
+	}
+
+	if erc20Scanner != nil {
+		log.Info("Shutting down erc20Scanner")
+		erc20Scanner.Shutdown()
+	}
+
+	if multiplexer != nil {
+		log.Info("Shutting down multiplexer")
+		multiplexer.Shutdown()
+	}
+
+	// close exchange service, which a read-only teller doesn't run, like the report scheduler and the archiver
+	if !*readOnlyOpt {
+		log.Info("Shutting down exchangeClient")
+		exchangeClient.Shutdown()
+	}
+
+	// close the report scheduler
+	if reportScheduler != nil && !*readOnlyOpt {
+		log.Info("Shutting down reportScheduler")
+		reportScheduler.Shutdown()
+	}
+
+	// close the archiver
+	if archiver != nil && !*readOnlyOpt {
+		log.Info("Shutting down archiver")
+		archiver.Shutdown()
+	}
+
+	// close the backuper
+	if backuper != nil {
+		log.Info("Shutting down backuper")
+		backuper.Shutdown()
+	}
+
+	// close the outbox dispatcher after the exchange, which emits its messages.
+	// Undelivered messages stay in the outbox until the next start.
+	if outboxDispatcher != nil {
+		log.Info("Shutting down outboxDispatcher")
+		outboxDispatcher.Shutdown()
+	}
+
+	// close the stream dispatcher, and then the connection of its relay
+	if streamDispatcher != nil {
+		log.Info("Shutting down streamDispatcher")
+		streamDispatcher.Shutdown()
+
+		if c, ok := streamRelay.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				log.WithError(err).Error("Close stream relay failed")
+			}
+		}
+	}
+
+	// close the notify dispatcher. Unsent notifications stay in the outbox until the next start.
+	if notifyDispatcher != nil {
+		log.Info("Shutting down notifyDispatcher")
+		notifyDispatcher.Shutdown()
+	}
+
+	// close the settlement notifier after the exchange, which adds its settlements.
+	// Unacknowledged settlements are notified again after the next start.
+	if settlementNotifier != nil {
+		log.Info("Shutting down settlementNotifier")
+		settlementNotifier.Shutdown()
+	}
+
+	// close the hot wallet top-up watcher
+	if topUpWatcher != nil {
+		log.Info("Shutting down topUpWatcher")
+		topUpWatcher.Shutdown()
+	}
+
+	// close the hot wallet balance monitor
+	if balanceMonitor != nil {
+		log.Info("Shutting down balanceMonitor")
+		balanceMonitor.Shutdown()
+	}
 
 	// close the skycoin send service
 	if sendService != nil {
@@ -275,6 +1821,30 @@ func run() error {
 		sendService.Shutdown()
 	}
 
+	// close the skycoin node health checks
+	if skyNodes != nil {
+		log.Info("Shutting down skyNodes")
+		skyNodes.Shutdown()
+	}
+
+	// close the tracer after the exchange and the API, exporting their last spans
+	if tracer != nil {
+		log.Info("Shutting down tracer")
+		tracer.Shutdown()
+	}
+
+	// close the alert notifier last, so that it can alert failures during shutdown
+	if notifier != nil {
+		log.Info("Shutting down notifier")
+		notifier.Shutdown()
+	}
+
+	// release the leader lock once everything using the db is stopped
+	if elector != nil {
+		log.Info("Shutting down elector")
+		elector.Shutdown()
+	}
+
 	log.Info("Waiting for goroutines to exit")
 
 	wg.Wait()
@@ -284,6 +1854,414 @@ func run() error {
 	return finalErr
 }
 
+// haInstanceID returns ha.instance_id, defaulting to the hostname and pid
+func haInstanceID(cfg config.HA) string {
+	if cfg.InstanceID != "" {
+		return cfg.InstanceID
+	}
+
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+// newBtcdClient creates a websocket RPC client of a btcd node. If quit is nil, it connects to the node
+// before returning. Otherwise it connects in the background, retrying until it connects or quit is closed.
+func newBtcdClient(log logrus.FieldLogger, node config.BtcRPCNode, quit <-chan struct{}) (*btcrpcclient.Client, error) {
+	certs, err := ioutil.ReadFile(node.Cert)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read btcd cert %s: %v", node.Cert, err)
+	}
+
+	c, err := btcrpcclient.New(&btcrpcclient.ConnConfig{
+		Endpoint:            "ws",
+		Host:                node.Server,
+		User:                node.User,
+		Pass:                node.Pass,
+		Certificates:        certs,
+		DisableConnectOnNew: quit != nil,
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if quit != nil {
+		go func() {
+			for {
+				// Connect waits a few seconds after a failed attempt
+				if err := c.Connect(1); err == nil {
+					log.WithField("node", node.Server).Info("Connect to btcd succeeded")
+					return
+				}
+
+				select {
+				case <-quit:
+					return
+				default:
+				}
+			}
+		}()
+	}
+
+	return c, nil
+}
+
+// newTxSigner returns the remote signer if sky_signer.enabled is set, or else the local hot wallet
+func newTxSigner(cfg config.Config) (signer.TxSigner, error) {
+	if !cfg.SkySigner.Enabled {
+		return signer.LoadWallet(cfg.SkyExchanger.Wallet, 0)
+	}
+
+	var files [3][]byte
+	for i, f := range []string{cfg.SkySigner.Cert, cfg.SkySigner.Key, cfg.SkySigner.CA} {
+		b, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read sky_signer file %s: %v", f, err)
+		}
+		files[i] = b
+	}
+
+	tlsConfig, err := signer.ClientTLSConfig(files[0], files[1], files[2])
+	if err != nil {
+		return nil, err
+	}
+
+	return signer.NewClient(cfg.SkySigner.URL, tlsConfig)
+}
+
+// confirmationsRequired returns the confirmations that the scanner of each enabled coin type requires
+func confirmationsRequired(cfg config.Config) map[string]int64 {
+	confirmations := map[string]int64{
+		scanner.CoinTypeBTC: cfg.BtcScanner.ConfirmationsRequired,
+	}
+
+	if cfg.LtcScanner.Enabled {
+		confirmations[scanner.CoinTypeLTC] = cfg.LtcScanner.ConfirmationsRequired
+	}
+
+	if cfg.ERC20Scanner.Enabled {
+		for _, t := range cfg.ERC20Scanner.Tokens {
+			confirmations[t.Symbol] = cfg.ERC20Scanner.ConfirmationsRequired
+		}
+	}
+
+	return confirmations
+}
+
+// confirmationTiers returns the confirmation tiers of each enabled coin type
+func confirmationTiers(cfg config.Config) (map[string][]exchange.ConfirmationTier, error) {
+	tiers := make(map[string][]exchange.ConfirmationTier)
+
+	add := func(coinType string, cts []config.ConfirmationTier) error {
+		for _, ct := range cts {
+			minValue, err := qrutil.ParseAmount(ct.MinValue)
+			if err != nil {
+				return err
+			}
+
+			tiers[coinType] = append(tiers[coinType], exchange.ConfirmationTier{
+				MinValue:      minValue,
+				Confirmations: ct.Confirmations,
+			})
+		}
+		return nil
+	}
+
+	if err := add(scanner.CoinTypeBTC, cfg.BtcScanner.ConfirmationTiers); err != nil {
+		return nil, err
+	}
+
+	if cfg.LtcScanner.Enabled {
+		if err := add(scanner.CoinTypeLTC, cfg.LtcScanner.ConfirmationTiers); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.ERC20Scanner.Enabled {
+		for _, t := range cfg.ERC20Scanner.Tokens {
+			if err := add(t.Symbol, cfg.ERC20Scanner.ConfirmationTiers); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return tiers, nil
+}
+
+// dustThresholds returns the dust thresholds of the enabled coin types that have one
+func dustThresholds(cfg config.Config) (map[string]int64, error) {
+	thresholds := make(map[string]int64)
+
+	add := func(coinType, threshold string) error {
+		if threshold == "" {
+			return nil
+		}
+
+		n, err := qrutil.ParseAmount(threshold)
+		if err != nil {
+			return err
+		}
+
+		thresholds[coinType] = n
+		return nil
+	}
+
+	if err := add(scanner.CoinTypeBTC, cfg.BtcScanner.DustThreshold); err != nil {
+		return nil, err
+	}
+
+	if cfg.LtcScanner.Enabled {
+		if err := add(scanner.CoinTypeLTC, cfg.LtcScanner.DustThreshold); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.ERC20Scanner.Enabled {
+		for _, t := range cfg.ERC20Scanner.Tokens {
+			if err := add(t.Symbol, cfg.ERC20Scanner.DustThreshold); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return thresholds, nil
+}
+
+// newNotifier creates an alert notifier with the sinks enabled in cfg
+func newNotifier(log logrus.FieldLogger, cfg config.Alerts) (*alert.Notifier, error) {
+	// Validated by cfg.Validate()
+	severities, err := cfg.Severity.Severities()
+	if err != nil {
+		return nil, err
+	}
+
+	n := alert.NewNotifier(log, alert.Config{
+		Cooldown:    cfg.Cooldown,
+		CheckPeriod: cfg.CheckPeriod,
+		Severities:  severities,
+	})
+
+	addSink := func(s alert.Sink, minSeverity string) error {
+		// Validated by cfg.Validate()
+		sev, err := alert.ParseSeverity(minSeverity)
+		if err != nil {
+			return fmt.Errorf("alerts.%s.min_severity invalid: %v", s.Name(), err)
+		}
+
+		log.WithField("sink", s.Name()).WithField("minSeverity", sev).Info("Sending alerts")
+		n.AddSink(s, sev)
+		return nil
+	}
+
+	if cfg.SMTP.Enabled {
+		s, err := newSMTPSink(cfg.SMTP)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := addSink(s, cfg.SMTP.MinSeverity); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.Slack.Enabled {
+		s, err := alert.NewSlackSink(cfg.Slack.WebhookURL)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := addSink(s, cfg.Slack.MinSeverity); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.Telegram.Enabled {
+		s, err := alert.NewTelegramSink(cfg.Telegram.BotToken, cfg.Telegram.ChatID)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := addSink(s, cfg.Telegram.MinSeverity); err != nil {
+			return nil, err
+		}
+	}
+
+	for i, c := range cfg.Sinks {
+		sc := c.SinkConfig()
+		sc.Log = log
+
+		// Validated by cfg.Validate()
+		s, err := alert.NewSink(c.Type, sc)
+		if err != nil {
+			return nil, fmt.Errorf("alerts.sinks[%d] invalid: %v", i, err)
+		}
+
+		opts, err := c.Options()
+		if err != nil {
+			return nil, fmt.Errorf("alerts.sinks[%d] invalid: %v", i, err)
+		}
+
+		log.WithFields(logrus.Fields{
+			"sink":        c.Name,
+			"type":        c.Type,
+			"minSeverity": opts.MinSeverity,
+		}).Info("Sending alerts")
+		n.AddNamedSink(c.Name, s, opts)
+	}
+
+	for _, r := range cfg.Routes {
+		n.AddRoute(alert.Route{
+			Events: r.Events,
+			Sinks:  r.Sinks,
+		})
+	}
+
+	return n, nil
+}
+
+// newAdminAuth creates the authenticator of the admin API principals, nil if there are none,
+// and the TLS config of the admin listener, nil if the admin API is served over plain HTTP
+func newAdminAuth(cfg config.AdminPanel) (*rbac.Authenticator, *tls.Config, error) {
+	var auth *rbac.Authenticator
+	if len(cfg.Principals) != 0 {
+		principals := make([]rbac.Principal, len(cfg.Principals))
+		for i, p := range cfg.Principals {
+			// Validated by cfg.Validate()
+			role, err := rbac.ParseRole(p.Role)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			principals[i] = rbac.Principal{
+				Name:         p.Name,
+				Role:         role,
+				Token:        p.Token,
+				ClientCertCN: p.ClientCertCN,
+			}
+		}
+
+		var err error
+		auth, err = rbac.NewAuthenticator(principals)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if cfg.TLSCert == "" {
+		return auth, nil, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(cfg.TLSCert, cfg.TLSKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to load admin_panel.tls_cert: %v", err)
+	}
+
+	tlsCfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if cfg.ClientCA != "" {
+		ca, err := ioutil.ReadFile(cfg.ClientCA)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Failed to read admin_panel.client_ca: %v", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, nil, errors.New("admin_panel.client_ca has no PEM certificates")
+		}
+
+		// Principals with a token can connect without a client certificate
+		tlsCfg.ClientCAs = pool
+		tlsCfg.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	return auth, tlsCfg, nil
+}
+
+// newSMTPSink creates the SMTP sink of alerts, which also emails the daily reports
+func newSMTPSink(cfg config.AlertSMTP) (*alert.SMTPSink, error) {
+	return alert.NewSMTPSink(alert.SMTPConfig{
+		Addr:     cfg.Addr,
+		Username: cfg.Username,
+		Password: cfg.Password,
+		From:     cfg.From,
+		To:       cfg.To,
+	})
+}
+
+// newFileAddrs creates the address pool of an address file
+func newFileAddrs(log logrus.FieldLogger, db *bolt.DB, c *dbcrypt.Cipher, path string, newAddrs func(logrus.FieldLogger, *bolt.DB, *dbcrypt.Cipher, io.Reader) (*addrs.Addrs, error)) (*addrs.Addrs, error) {
+	f, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Load deposit address list failed: %v", err)
+	}
+
+	return newAddrs(log, db, c, bytes.NewReader(f))
+}
+
+// errDBEncrypted is returned if the db is encrypted and encryption is disabled
+var errDBEncrypted = errors.New("The db is encrypted, encryption.enabled is required")
+
+// loadDBCipher returns the Cipher the exchange state of a db opened read-only is encrypted with,
+// nil if it is not encrypted. The passphrase is only read if the db is encrypted.
+func loadDBCipher(db *bolt.DB, cfg config.Encryption) (*dbcrypt.Cipher, error) {
+	encrypted, err := dbcrypt.IsEncrypted(db)
+	if err != nil {
+		return nil, err
+	}
+
+	if !encrypted {
+		return nil, nil
+	}
+
+	if !cfg.Enabled {
+		return nil, errDBEncrypted
+	}
+
+	passphrase, err := readDBPassphrase(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("Read db encryption passphrase failed: %v", err)
+	}
+
+	c, err := dbcrypt.Open(db, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	return exchange.StateCipher(db, c)
+}
+
+// readDBPassphrase returns the db encryption passphrase of the config,
+// or prompts for it if it is empty and stdin is a terminal
+func readDBPassphrase(cfg config.Encryption) (string, error) {
+	if cfg.Passphrase != "" {
+		return cfg.Passphrase, nil
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !terminal.IsTerminal(fd) {
+		return "", errors.New("encryption.passphrase missing and stdin is not a terminal to prompt for it")
+	}
+
+	fmt.Fprint(os.Stderr, "DB encryption passphrase: ")
+	b, err := terminal.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+
+	if len(b) == 0 {
+		return "", dbcrypt.ErrEmptyPassphrase
+	}
+
+	return string(b), nil
+}
+
 func createFolderIfNotExist(path string) error {
 	if _, err := os.Stat(path); os.IsNotExist(err) {
 		// create the dir
@@ -302,9 +2280,10 @@ func printProgramStatus() {
 	}
 }
 
+// catchInterrupt closes quit on os.Interrupt, or SIGTERM, which systemd stops services with
 func catchInterrupt(quit chan<- struct{}) {
 	sigchan := make(chan os.Signal, 1)
-	signal.Notify(sigchan, os.Interrupt)
+	signal.Notify(sigchan, os.Interrupt, syscall.SIGTERM)
 	<-sigchan
 	signal.Stop(sigchan)
 	close(quit)
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/skycoin/teller/src/util/listenutil"
+)
+
+// upgradeReadyEnv is the environment variable with the file descriptor that the new process of an
+// upgrade writes to when it is ready to take over
+const upgradeReadyEnv = "TELLER_UPGRADE_READY_FD"
+
+// upgrader performs zero-downtime upgrades when teller receives SIGUSR2. It starts a new process of the
+// teller binary, passing it the listening sockets, and waits for it to be ready. The running process then
+// shuts down gracefully, finishing its in-flight sends, while the new process waits for the db and
+// accepts the connections queued on the sockets. If the new process fails to start, the running one
+// keeps running.
+type upgrader struct {
+	log      logrus.FieldLogger
+	timeout  time.Duration
+	pidFile  string
+	upgraded chan struct{}
+	quit     chan struct{}
+	done     chan struct{}
+}
+
+func newUpgrader(log logrus.FieldLogger, timeout time.Duration, pidFile string) *upgrader {
+	return &upgrader{
+		log:      log.WithField("prefix", "teller.upgrade"),
+		timeout:  timeout,
+		pidFile:  pidFile,
+		upgraded: make(chan struct{}),
+		quit:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Run upgrades on each SIGUSR2 until an upgrade succeeds or Shutdown is called
+func (u *upgrader) Run() error {
+	defer close(u.done)
+
+	sigC := make(chan os.Signal, 1)
+	signal.Notify(sigC, syscall.SIGUSR2)
+	defer signal.Stop(sigC)
+
+	for {
+		select {
+		case <-u.quit:
+			return nil
+		case <-sigC:
+			u.log.Info("Received SIGUSR2, upgrading")
+
+			if err := u.upgrade(); err != nil {
+				u.log.WithError(err).Error("Upgrade failed, keeping the running process")
+
+				// The new process may have written its pid before failing
+				if err := writePIDFile(u.pidFile); err != nil {
+					u.log.WithError(err).Error("writePIDFile failed")
+				}
+				continue
+			}
+
+			u.log.Info("The new process is ready, shutting down")
+			close(u.upgraded)
+			return nil
+		}
+	}
+}
+
+// Upgraded is closed when the new process of an upgrade is ready and this one should shut down
+func (u *upgrader) Upgraded() <-chan struct{} {
+	return u.upgraded
+}
+
+// Shutdown stops the upgrader
+func (u *upgrader) Shutdown() {
+	close(u.quit)
+	<-u.done
+}
+
+// upgrade starts a new process of the teller executable with the same arguments, passing it the open
+// listeners, and waits for it to be ready. The new process is killed if it is not ready within the timeout.
+func (u *upgrader) upgrade() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	addrs, files, err := listenutil.Files()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+
+	addrsJSON, err := json.Marshal(addrs)
+	if err != nil {
+		return err
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	// The listeners are passed from file descriptor 3, followed by the ready pipe
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = append(files, w)
+	cmd.Env = append(os.Environ(),
+		listenutil.InheritedEnv+"="+string(addrsJSON),
+		fmt.Sprintf("%s=%d", upgradeReadyEnv, 3+len(files)),
+	)
+
+	u.log.WithFields(logrus.Fields{
+		"exe":   exe,
+		"addrs": addrs,
+	}).Info("Starting the new process")
+
+	err = cmd.Start()
+	w.Close()
+	if err := listenutil.SetNonblock(); err != nil {
+		u.log.WithError(err).Error("listenutil.SetNonblock failed")
+	}
+	if err != nil {
+		return err
+	}
+
+	log := u.log.WithField("pid", cmd.Process.Pid)
+
+	// The read fails with io.EOF if the new process exits before it is ready
+	readyC := make(chan error, 1)
+	go func() {
+		_, err := r.Read(make([]byte, 1))
+		readyC <- err
+	}()
+
+	// Reap the new process if it exits while this process is still running
+	go cmd.Wait() // nolint: errcheck
+
+	select {
+	case err := <-readyC:
+		if err != nil {
+			return fmt.Errorf("the new process exited before it was ready: %v", err)
+		}
+		log.Info("The new process is ready")
+		return nil
+	case <-time.After(u.timeout):
+		err = errors.New("timed out waiting for the new process to be ready")
+	case <-u.quit:
+		err = errors.New("shutting down")
+	}
+
+	if err := cmd.Process.Kill(); err != nil {
+		log.WithError(err).Error("Killing the new process failed")
+	}
+
+	return err
+}
+
+// isUpgrade reports whether this process was started by an upgrade
+func isUpgrade() bool {
+	return os.Getenv(upgradeReadyEnv) != ""
+}
+
+// upgradeReady writes the pid file, then tells the process that started this one with an upgrade
+// that this process is ready to take over. It does nothing if this process was not started by an upgrade.
+func upgradeReady(pidFile string) error {
+	v := os.Getenv(upgradeReadyEnv)
+	if v == "" {
+		return nil
+	}
+	defer os.Unsetenv(upgradeReadyEnv) // nolint: errcheck
+
+	fd, err := strconv.Atoi(v)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %v", upgradeReadyEnv, err)
+	}
+
+	if err := writePIDFile(pidFile); err != nil {
+		return err
+	}
+
+	f := os.NewFile(uintptr(fd), "upgrade ready pipe")
+	defer f.Close()
+
+	_, err = f.Write([]byte{1})
+	return err
+}
+
+// writePIDFile writes the pid of this process to path, if set
+func writePIDFile(path string) error {
+	if path == "" {
+		return nil
+	}
+
+	return ioutil.WriteFile(path, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644)
+}
@@ -1,38 +1,100 @@
-// Package addrs manages deposit bitcoin addresses
+// Package addrs manages deposit addresses, from address files or a remote address service
 package addrs
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
 
 	"github.com/boltdb/bolt"
 	"github.com/sirupsen/logrus"
+
+	"github.com/skycoin/teller/src/util/dbcrypt"
+	"github.com/skycoin/teller/src/util/dbutil"
+)
+
+var (
+	// ErrDepositAddressEmpty represents all deposit addresses are used
+	ErrDepositAddressEmpty = errors.New("Deposit address pool is empty")
+
+	// ErrCoinTypeNotRegistered is returned by AddrManager if there is no generator for the coin type
+	ErrCoinTypeNotRegistered = errors.New("Coin type is not registered")
+
+	// ErrAddressNotInPool is returned when releasing an address that was not loaded into the pool
+	ErrAddressNotInPool = errors.New("Address is not in the deposit address pool")
+
+	// ErrAddNotSupported is returned when adding addresses to a pool that is not loaded from an address file,
+	// e.g. of a remote address service
+	ErrAddNotSupported = errors.New("Deposit addresses can't be added to this pool")
+
+	// Deposit addresses added to the address file pools at runtime, used address bucket key -> [addrs].
+	// Encrypted if encryption is enabled.
+	addedAddrsBkt = []byte("added_addrs")
 )
 
-// ErrDepositAddressEmpty represents all deposit addresses are used
-var ErrDepositAddressEmpty = errors.New("Deposit address pool is empty")
+// DuplicateAddressErr is returned when adding an address that is in the pool already, or was given out
+type DuplicateAddressErr struct {
+	Address string
+}
+
+func (e DuplicateAddressErr) Error() string {
+	return fmt.Sprintf("Deposit address `%s` is in the pool already or was given out", e.Address)
+}
 
 // AddrGenerator generate new deposit address
 type AddrGenerator interface {
 	NewAddress() (string, error)
 }
 
+// AddressProvider provides the deposit addresses of a coin type, from an address pool loaded from a file,
+// or from a remote address service
+type AddressProvider interface {
+	AddrGenerator
+	// Remaining returns the number of addresses that can still be given out
+	Remaining() uint64
+}
+
+// AddrReleaser takes back deposit addresses that were given out, so that they can be given out again
+type AddrReleaser interface {
+	Release(addr string) error
+}
+
+// AddrAdder adds deposit addresses to a pool at runtime
+type AddrAdder interface {
+	Add(addresses []string) (uint64, error)
+}
+
 // Addrs manages deposit addresses
 type Addrs struct {
 	sync.RWMutex
 	log       logrus.FieldLogger
-	used      *Store   // all used addresses
-	addresses []string // address pool for deposit
+	used      *Store              // all used addresses
+	addresses []string            // address pool for deposit
+	loaded    map[string]struct{} // all addresses of the pool, used or not
+
+	// Set for the pools of the address files, which addresses can be added to at runtime
+	db        *bolt.DB
+	c         *dbcrypt.Cipher
+	bucketKey string
+	prepare   func([]string) ([]string, error) // normalizes and verifies added addresses
 }
 
-// NewAddrs creates Addrs instance, will load and verify the addresses
-func NewAddrs(log logrus.FieldLogger, db *bolt.DB, addresses []string, bucketKey string) (*Addrs, error) {
-	used, err := NewStore(db, bucketKey)
+// NewAddrs creates Addrs instance, will load and verify the addresses.
+// c encrypts the used addresses, nil to store them as they are.
+func NewAddrs(log logrus.FieldLogger, db *bolt.DB, c *dbcrypt.Cipher, addresses []string, bucketKey string) (*Addrs, error) {
+	used, err := NewStore(db, c, bucketKey)
 	if err != nil {
 		return nil, err
 	}
 
+	loaded := make(map[string]struct{}, len(addresses))
+	for _, addr := range addresses {
+		loaded[addr] = struct{}{}
+	}
+
 	addresses, err = removeUsedAddresses(used, addresses)
 	if err != nil {
 		return nil, err
@@ -42,9 +104,79 @@ func NewAddrs(log logrus.FieldLogger, db *bolt.DB, addresses []string, bucketKey
 		log:       log.WithField("prefix", "addrs"),
 		used:      used,
 		addresses: addresses,
+		loaded:    loaded,
 	}, nil
 }
 
+// newFileAddrs creates the Addrs of an address file, with the addresses that were added to it at runtime.
+// prepare normalizes and verifies the added addresses.
+func newFileAddrs(log logrus.FieldLogger, db *bolt.DB, c *dbcrypt.Cipher, addresses []string, bucketKey string, prepare func([]string) ([]string, error)) (*Addrs, error) {
+	var added []string
+	if err := db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(addedAddrsBkt); err != nil {
+			return dbutil.NewCreateBucketFailedErr(addedAddrsBkt, err)
+		}
+
+		if err := c.MigrateTx(tx, addedAddrsBkt, func(k, v []byte) ([]byte, []byte, error) {
+			v, err := c.Encrypt(v)
+			return k, v, err
+		}); err != nil {
+			return err
+		}
+
+		var err error
+		added, err = getAddedAddresses(tx, c, bucketKey)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	inFile := make(map[string]struct{}, len(addresses))
+	for _, addr := range addresses {
+		inFile[addr] = struct{}{}
+	}
+
+	// An added address may have been put in the address file later
+	all := addresses
+	for _, addr := range added {
+		if _, ok := inFile[addr]; !ok {
+			all = append(all, addr)
+		}
+	}
+
+	a, err := NewAddrs(log, db, c, all, bucketKey)
+	if err != nil {
+		return nil, err
+	}
+
+	a.db = db
+	a.c = c
+	a.bucketKey = bucketKey
+	a.prepare = prepare
+
+	return a, nil
+}
+
+// getAddedAddresses returns the addresses added at runtime to the pool of a used address bucket
+func getAddedAddresses(tx *bolt.Tx, c *dbcrypt.Cipher, bucketKey string) ([]string, error) {
+	v := tx.Bucket(addedAddrsBkt).Get([]byte(bucketKey))
+	if v == nil {
+		return nil, nil
+	}
+
+	v, err := c.Decrypt(v)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt added addresses failed: %v", err)
+	}
+
+	var addrs []string
+	if err := json.Unmarshal(v, &addrs); err != nil {
+		return nil, fmt.Errorf("decode added addresses failed: %v", err)
+	}
+
+	return addrs, nil
+}
+
 func removeUsedAddresses(s *Store, addrs []string) ([]string, error) {
 	var newAddrs []string
 
@@ -95,6 +227,103 @@ func (a *Addrs) NewAddress() (string, error) {
 	return chosenAddr, nil
 }
 
+// Release returns a used address to the pool, e.g. when its binding expired unused.
+// Returns ErrAddressNotInPool if the address is not one of the addresses of the pool.
+func (a *Addrs) Release(addr string) error {
+	a.Lock()
+	defer a.Unlock()
+
+	if _, ok := a.loaded[addr]; !ok {
+		return ErrAddressNotInPool
+	}
+
+	if err := a.used.Delete(addr); err != nil {
+		return fmt.Errorf("Delete address from used pool failed: %v", err)
+	}
+
+	for _, x := range a.addresses {
+		if x == addr {
+			return nil
+		}
+	}
+
+	a.addresses = append(a.addresses, addr)
+	a.log.WithField("addr", addr).Info("Released address to the pool")
+	return nil
+}
+
+// Add adds deposit addresses to the pool, and saves them so that they are loaded again with the address file.
+// The addresses are normalized and verified like the addresses of the file. Returns a DuplicateAddressErr if an
+// address is in the pool already or was given out, ErrAddNotSupported if the pool is not of an address file.
+// Returns the number of addresses remaining in the pool.
+func (a *Addrs) Add(addresses []string) (uint64, error) {
+	if a.prepare == nil {
+		return 0, ErrAddNotSupported
+	}
+
+	addresses, err := a.prepare(addresses)
+	if err != nil {
+		return 0, err
+	}
+
+	a.Lock()
+	defer a.Unlock()
+
+	for _, addr := range addresses {
+		if _, ok := a.loaded[addr]; ok {
+			return 0, DuplicateAddressErr{Address: addr}
+		}
+
+		if used, err := a.used.IsUsed(addr); err != nil {
+			return 0, err
+		} else if used {
+			return 0, DuplicateAddressErr{Address: addr}
+		}
+	}
+
+	if err := a.db.Update(func(tx *bolt.Tx) error {
+		added, err := getAddedAddresses(tx, a.c, a.bucketKey)
+		if err != nil {
+			return err
+		}
+
+		v, err := json.Marshal(append(added, addresses...))
+		if err != nil {
+			return err
+		}
+
+		v, err = a.c.Encrypt(v)
+		if err != nil {
+			return err
+		}
+
+		return dbutil.PutBucketValue(tx, addedAddrsBkt, a.bucketKey, v)
+	}); err != nil {
+		return 0, err
+	}
+
+	for _, addr := range addresses {
+		a.loaded[addr] = struct{}{}
+	}
+	a.addresses = append(a.addresses, addresses...)
+
+	a.log.WithField("added", len(addresses)).Info("Added addresses to the pool")
+	return uint64(len(a.addresses)), nil
+}
+
+// all returns all addresses of the pool, used or not
+func (a *Addrs) all() []string {
+	a.RLock()
+	defer a.RUnlock()
+
+	addrs := make([]string, 0, len(a.loaded))
+	for addr := range a.loaded {
+		addrs = append(addrs, addr)
+	}
+
+	return addrs
+}
+
 // Remaining returns the rest btc address number
 func (a *Addrs) Remaining() uint64 {
 	a.RLock()
@@ -102,3 +331,144 @@ func (a *Addrs) Remaining() uint64 {
 
 	return uint64(len(a.addresses))
 }
+
+// AddrManager keeps a deposit address generator for each coin type
+type AddrManager struct {
+	sync.RWMutex
+	generators map[string]AddrGenerator
+	checker    *ConflictChecker
+}
+
+// NewAddrManager creates an empty AddrManager
+func NewAddrManager() *AddrManager {
+	return &AddrManager{
+		generators: make(map[string]AddrGenerator),
+	}
+}
+
+// PushGenerator registers the address generator of a coin type
+func (m *AddrManager) PushGenerator(g AddrGenerator, coinType string) error {
+	m.Lock()
+	defer m.Unlock()
+
+	if _, ok := m.generators[coinType]; ok {
+		return fmt.Errorf("Coin type %s is already registered", coinType)
+	}
+
+	m.generators[coinType] = g
+	return nil
+}
+
+// NewAddress returns a new deposit address of a coin type
+func (m *AddrManager) NewAddress(coinType string) (string, error) {
+	m.RLock()
+	g, ok := m.generators[coinType]
+	m.RUnlock()
+
+	if !ok {
+		return "", ErrCoinTypeNotRegistered
+	}
+
+	return g.NewAddress()
+}
+
+// Remaining returns the number of addresses that can still be given out, by coin type.
+// Generators that are not an AddressProvider are skipped.
+func (m *AddrManager) Remaining() map[string]uint64 {
+	m.RLock()
+	defer m.RUnlock()
+
+	remaining := make(map[string]uint64, len(m.generators))
+	for coinType, g := range m.generators {
+		if p, ok := g.(AddressProvider); ok {
+			remaining[coinType] = p.Remaining()
+		}
+	}
+
+	return remaining
+}
+
+// SetConflictChecker sets the ConflictChecker that AddAddresses checks the addresses with
+func (m *AddrManager) SetConflictChecker(c *ConflictChecker) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.checker = c
+}
+
+// AddAddresses adds deposit addresses to the pool of a coin type at runtime, see Addrs.Add.
+// Returns ErrAddNotSupported if the pool of the coin type can't take addresses, e.g. of a remote address service.
+// If a ConflictChecker is set, an AddressConflictErr is returned if an address is in any pool or bound already.
+func (m *AddrManager) AddAddresses(coinType string, addresses []string) (uint64, error) {
+	m.RLock()
+	g, ok := m.generators[coinType]
+	checker := m.checker
+	m.RUnlock()
+
+	if !ok {
+		return 0, ErrCoinTypeNotRegistered
+	}
+
+	adder, ok := g.(AddrAdder)
+	if !ok {
+		return 0, ErrAddNotSupported
+	}
+
+	if checker != nil {
+		if err := checker.CheckNew(addresses); err != nil {
+			return 0, err
+		}
+	}
+
+	return adder.Add(addresses)
+}
+
+// Pools returns the address file pools, named by the coin types they are registered for.
+// Implements PoolLister.
+func (m *AddrManager) Pools() []Pool {
+	m.RLock()
+	defer m.RUnlock()
+
+	// The ETH pool is registered for each ERC20 token
+	coinTypes := make(map[*Addrs][]string)
+	for coinType, g := range m.generators {
+		if a, ok := g.(*Addrs); ok {
+			coinTypes[a] = append(coinTypes[a], coinType)
+		}
+	}
+
+	pools := make([]Pool, 0, len(coinTypes))
+	for a, cts := range coinTypes {
+		sort.Strings(cts)
+		pools = append(pools, Pool{
+			Name:  strings.Join(cts, "/"),
+			Addrs: a,
+		})
+	}
+
+	sort.Slice(pools, func(i, j int) bool {
+		return pools[i].Name < pools[j].Name
+	})
+
+	return pools
+}
+
+// Release returns a used address to the pool of the generator it came from.
+// Returns ErrAddressNotInPool if no generator has the address.
+func (m *AddrManager) Release(addr string) error {
+	m.RLock()
+	defer m.RUnlock()
+
+	for _, g := range m.generators {
+		r, ok := g.(AddrReleaser)
+		if !ok {
+			continue
+		}
+
+		if err := r.Release(addr); err != ErrAddressNotInPool {
+			return err
+		}
+	}
+
+	return ErrAddressNotInPool
+}
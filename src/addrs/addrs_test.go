@@ -1,6 +1,7 @@
 package addrs
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -19,7 +20,7 @@ func TestNewBtcAddrs(t *testing.T) {
 	}
 
 	log, _ := testutil.NewLogger(t)
-	btca, err := NewAddrs(log, db, addresses, "test_bucket")
+	btca, err := NewAddrs(log, db, nil, addresses, "test_bucket")
 	require.NoError(t, err)
 
 	addrMap := make(map[string]struct{}, len(btca.addresses))
@@ -45,7 +46,7 @@ func TestNewAddress(t *testing.T) {
 	}
 
 	log, _ := testutil.NewLogger(t)
-	btca, err := NewAddrs(log, db, addresses, "test_bucket")
+	btca, err := NewAddrs(log, db, nil, addresses, "test_bucket")
 	require.NoError(t, err)
 
 	addr, err := btca.NewAddress()
@@ -66,7 +67,7 @@ func TestNewAddress(t *testing.T) {
 	require.True(t, used)
 
 	log, _ = testutil.NewLogger(t)
-	btca1, err := NewAddrs(log, db, addresses, "test_bucket")
+	btca1, err := NewAddrs(log, db, nil, addresses, "test_bucket")
 	require.NoError(t, err)
 
 	for _, a := range btca1.addresses {
@@ -86,3 +87,156 @@ func TestNewAddress(t *testing.T) {
 	require.Error(t, err)
 	require.Equal(t, ErrDepositAddressEmpty, err)
 }
+
+func TestRelease(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	addresses := []string{
+		"14JwrdSxYXPxSi6crLKVwR4k2dbjfVZ3xj",
+		"1JNonvXRyZvZ4ZJ9PE8voyo67UQN1TpoGy",
+	}
+
+	log, _ := testutil.NewLogger(t)
+	btca, err := NewAddrs(log, db, nil, addresses, "test_bucket")
+	require.NoError(t, err)
+
+	require.Equal(t, ErrAddressNotInPool, btca.Release("1JrzSx8a9FVHHCkUFLB2CHULpbz4dTz5Ap"))
+
+	addr, err := btca.NewAddress()
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), btca.Remaining())
+
+	require.NoError(t, btca.Release(addr))
+	require.Equal(t, uint64(2), btca.Remaining())
+
+	used, err := btca.used.IsUsed(addr)
+	require.NoError(t, err)
+	require.False(t, used)
+
+	// Releasing an address that is in the pool already does nothing
+	require.NoError(t, btca.Release(addr))
+	require.Equal(t, uint64(2), btca.Remaining())
+
+	// The released address is given out again, after the other addresses
+	addr2, err := btca.NewAddress()
+	require.NoError(t, err)
+	require.NotEqual(t, addr, addr2)
+
+	addr3, err := btca.NewAddress()
+	require.NoError(t, err)
+	require.Equal(t, addr, addr3)
+
+	// Released addresses are in the pool after a restart too
+	require.NoError(t, btca.Release(addr))
+
+	btca1, err := NewAddrs(log, db, nil, addresses, "test_bucket")
+	require.NoError(t, err)
+	require.Equal(t, []string{addr}, btca1.addresses)
+}
+
+func TestAddrManager(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	log, _ := testutil.NewLogger(t)
+
+	btca, err := NewAddrs(log, db, nil, []string{"14JwrdSxYXPxSi6crLKVwR4k2dbjfVZ3xj"}, "test_btc_bucket")
+	require.NoError(t, err)
+	ltca, err := NewAddrs(log, db, nil, []string{"Lf8ZayicoAH1K9oS3jyWafuLYpMPxqeotT"}, "test_ltc_bucket")
+	require.NoError(t, err)
+
+	m := NewAddrManager()
+	require.NoError(t, m.PushGenerator(btca, "BTC"))
+	require.NoError(t, m.PushGenerator(ltca, "LTC"))
+	require.Error(t, m.PushGenerator(ltca, "LTC"))
+
+	addr, err := m.NewAddress("LTC")
+	require.NoError(t, err)
+	require.Equal(t, "Lf8ZayicoAH1K9oS3jyWafuLYpMPxqeotT", addr)
+
+	_, err = m.NewAddress("LTC")
+	require.Equal(t, ErrDepositAddressEmpty, err)
+
+	addr, err = m.NewAddress("BTC")
+	require.NoError(t, err)
+	require.Equal(t, "14JwrdSxYXPxSi6crLKVwR4k2dbjfVZ3xj", addr)
+
+	_, err = m.NewAddress("ETH")
+	require.Equal(t, ErrCoinTypeNotRegistered, err)
+
+	require.NoError(t, m.Release("Lf8ZayicoAH1K9oS3jyWafuLYpMPxqeotT"))
+	require.Equal(t, uint64(1), ltca.Remaining())
+	require.Equal(t, uint64(0), btca.Remaining())
+	require.Equal(t, map[string]uint64{"BTC": 0, "LTC": 1}, m.Remaining())
+
+	require.Equal(t, ErrAddressNotInPool, m.Release("1JNonvXRyZvZ4ZJ9PE8voyo67UQN1TpoGy"))
+}
+
+func TestAdd(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	log, _ := testutil.NewLogger(t)
+
+	file := `{"btc_addresses": ["14JwrdSxYXPxSi6crLKVwR4k2dbjfVZ3xj"]}`
+	btca, err := NewBTCAddrs(log, db, nil, strings.NewReader(file))
+	require.NoError(t, err)
+
+	addr, err := btca.NewAddress()
+	require.NoError(t, err)
+	require.Equal(t, "14JwrdSxYXPxSi6crLKVwR4k2dbjfVZ3xj", addr)
+
+	// Invalid addresses are rejected
+	_, err = btca.Add([]string{"1JNonvXRyZvZ4ZJ9PE8voyo67UQN1TpoGy", "bad"})
+	require.Error(t, err)
+	_, err = btca.Add(nil)
+	require.Error(t, err)
+
+	// Addresses in the pool and addresses given out are rejected
+	_, err = btca.Add([]string{"1JNonvXRyZvZ4ZJ9PE8voyo67UQN1TpoGy", "14JwrdSxYXPxSi6crLKVwR4k2dbjfVZ3xj"})
+	require.Equal(t, DuplicateAddressErr{Address: "14JwrdSxYXPxSi6crLKVwR4k2dbjfVZ3xj"}, err)
+
+	used, err := NewStore(db, nil, btcBucketKey)
+	require.NoError(t, err)
+	require.NoError(t, used.Put("1JrzSx8a9FVHHCkUFLB2CHULpbz4dTz5Ap"))
+	_, err = btca.Add([]string{"1JrzSx8a9FVHHCkUFLB2CHULpbz4dTz5Ap"})
+	require.Equal(t, DuplicateAddressErr{Address: "1JrzSx8a9FVHHCkUFLB2CHULpbz4dTz5Ap"}, err)
+
+	// Bech32 addresses are normalized like the addresses of the file
+	remaining, err := btca.Add([]string{"1JNonvXRyZvZ4ZJ9PE8voyo67UQN1TpoGy", "BC1QW508D6QEJXTDG4Y5R3ZARVARY0C5XW7KV8F3T4"})
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), remaining)
+
+	_, err = btca.Add([]string{"bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4"})
+	require.Equal(t, DuplicateAddressErr{Address: "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4"}, err)
+
+	addr, err = btca.NewAddress()
+	require.NoError(t, err)
+	require.Equal(t, "1JNonvXRyZvZ4ZJ9PE8voyo67UQN1TpoGy", addr)
+
+	// The added addresses are loaded again with the address file
+	btca, err = NewBTCAddrs(log, db, nil, strings.NewReader(file))
+	require.NoError(t, err)
+	require.Equal(t, []string{"bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4"}, btca.addresses)
+	require.NoError(t, btca.Release("1JNonvXRyZvZ4ZJ9PE8voyo67UQN1TpoGy"))
+
+	// Pools that are not of an address file can't take addresses
+	pool, err := NewBTCPoolAddrs(log, db, nil, []string{"1Kar4VK9HLkcQ99iWbs4LuCGEyDdTab5PC"})
+	require.NoError(t, err)
+	_, err = pool.Add([]string{"1Mv16pwUZYUrMWLTe2DDZzXHGAyHdKA5oz"})
+	require.Equal(t, ErrAddNotSupported, err)
+
+	m := NewAddrManager()
+	require.NoError(t, m.PushGenerator(btca, "BTC"))
+	require.NoError(t, m.PushGenerator(pool, "LTC"))
+
+	_, err = m.AddAddresses("ETH", []string{"0x5a0b54d5dc17e0aadc383d2db43b0a0d3e029c4c"})
+	require.Equal(t, ErrCoinTypeNotRegistered, err)
+	_, err = m.AddAddresses("LTC", []string{"Lf8ZayicoAH1K9oS3jyWafuLYpMPxqeotT"})
+	require.Equal(t, ErrAddNotSupported, err)
+
+	remaining, err = m.AddAddresses("BTC", []string{"1Mv16pwUZYUrMWLTe2DDZzXHGAyHdKA5oz"})
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), remaining)
+}
@@ -5,25 +5,73 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"strings"
 
 	"github.com/boltdb/bolt"
+	"github.com/btcsuite/btcutil/base58"
 	"github.com/sirupsen/logrus"
 
-	"github.com/skycoin/skycoin/src/cipher"
+	"github.com/skycoin/teller/src/util/dbcrypt"
+
+	"github.com/skycoin/teller/src/util/bech32util"
 )
 
-const btcBucketKey = "used_btc_address"
+const (
+	btcBucketKey = "used_btc_address"
+
+	// BTCSegWitHRP is the human readable part of mainnet bech32 bitcoin addresses
+	BTCSegWitHRP = "bc"
+)
+
+// btcAddressVersions are the base58check version bytes of mainnet bitcoin addresses.
+// P2SH addresses include P2SH-wrapped segwit (P2SH-P2WPKH) addresses.
+var btcAddressVersions = map[byte]struct{}{
+	0x00: {}, // 1..., P2PKH
+	0x05: {}, // 3..., P2SH
+}
 
 // NewBTCAddrs returns an Addrs loaded with BTC addresses
-func NewBTCAddrs(log logrus.FieldLogger, db *bolt.DB, addrsReader io.Reader) (*Addrs, error) {
-	loader, err := loadBTCAddresses(addrsReader)
+func NewBTCAddrs(log logrus.FieldLogger, db *bolt.DB, c *dbcrypt.Cipher, addrsReader io.Reader) (*Addrs, error) {
+	loader, err := LoadBTCAddresses(addrsReader)
+	if err != nil {
+		return nil, err
+	}
+	return newFileAddrs(log, db, c, loader, btcBucketKey, prepareBTCAddresses)
+}
+
+// NewBTCPoolAddrs returns an Addrs of another pool of BTC addresses, e.g. of a campaign. It shares the used
+// addresses of the BTC pool, so an address that was given out by one pool is not given out by another.
+func NewBTCPoolAddrs(log logrus.FieldLogger, db *bolt.DB, c *dbcrypt.Cipher, addresses []string) (*Addrs, error) {
+	addrs, err := prepareBTCAddresses(addresses)
 	if err != nil {
 		return nil, err
 	}
-	return NewAddrs(log, db, loader, btcBucketKey)
+
+	return NewAddrs(log, db, c, addrs, btcBucketKey)
+}
+
+// NewBTCUsedStore returns the Store of the addresses given out by the BTC pools, e.g. to mark the
+// addresses of a rebuilt db as used
+func NewBTCUsedStore(db *bolt.DB, c *dbcrypt.Cipher) (*Store, error) {
+	return NewStore(db, c, btcBucketKey)
+}
+
+// prepareBTCAddresses returns normalized copies of BTC addresses, after verifying them
+func prepareBTCAddresses(addresses []string) ([]string, error) {
+	addrs := make([]string, len(addresses))
+	for i, a := range addresses {
+		addrs[i] = NormalizeBTCAddress(a)
+	}
+
+	if err := verifyBTCAddresses(addrs); err != nil {
+		return nil, err
+	}
+
+	return addrs, nil
 }
 
-func loadBTCAddresses(addrsReader io.Reader) ([]string, error) {
+// LoadBTCAddresses loads and verifies the BTC deposit addresses of an addresses file
+func LoadBTCAddresses(addrsReader io.Reader) ([]string, error) {
 	var addrs struct {
 		Addresses []string `json:"btc_addresses"`
 	}
@@ -32,6 +80,10 @@ func loadBTCAddresses(addrsReader io.Reader) ([]string, error) {
 		return nil, fmt.Errorf("Decode loaded address json failed: %v", err)
 	}
 
+	for i, a := range addrs.Addresses {
+		addrs.Addresses[i] = NormalizeBTCAddress(a)
+	}
+
 	if err := verifyBTCAddresses(addrs.Addresses); err != nil {
 		return nil, err
 	}
@@ -51,7 +103,7 @@ func verifyBTCAddresses(addrs []string) error {
 			return fmt.Errorf("Duplicate deposit address `%s`", addr)
 		}
 
-		if _, err := cipher.BitcoinDecodeBase58Address(addr); err != nil {
+		if err := VerifyBTCAddress(addr); err != nil {
 			return fmt.Errorf("Invalid deposit address `%s`: %v", addr, err)
 		}
 
@@ -60,3 +112,42 @@ func verifyBTCAddresses(addrs []string) error {
 
 	return nil
 }
+
+// IsBTCSegWitAddress returns true if addr looks like a bech32 bitcoin address, without verifying it
+func IsBTCSegWitAddress(addr string) bool {
+	return strings.HasPrefix(strings.ToLower(addr), BTCSegWitHRP+"1")
+}
+
+// NormalizeBTCAddress lowercases bech32 addresses, which are case insensitive
+// but always reported in lowercase by nodes and indexers. Base58 addresses are returned unchanged.
+func NormalizeBTCAddress(addr string) string {
+	if IsBTCSegWitAddress(addr) {
+		return strings.ToLower(addr)
+	}
+	return addr
+}
+
+// VerifyBTCAddress checks that addr is a mainnet P2PKH or P2SH base58 bitcoin address,
+// or a P2WPKH or P2WSH bech32 (bc1...) address
+func VerifyBTCAddress(addr string) error {
+	if IsBTCSegWitAddress(addr) {
+		_, err := bech32util.DecodeSegWitAddress(BTCSegWitHRP, addr)
+		return err
+	}
+
+	// version + 20 byte hash + 4 byte checksum
+	if len(base58.Decode(addr)) != 1+20+4 {
+		return errors.New("Invalid address length")
+	}
+
+	_, version, err := base58.CheckDecode(addr)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := btcAddressVersions[version]; !ok {
+		return errors.New("Invalid version")
+	}
+
+	return nil
+}
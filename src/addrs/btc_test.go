@@ -26,7 +26,7 @@ func TestNewBTCAddrsAllValid(t *testing.T) {
     ]
 }`
 
-	btcAddrMgr, err := NewBTCAddrs(log, db, bytes.NewReader([]byte(addressesJson)))
+	btcAddrMgr, err := NewBTCAddrs(log, db, nil, bytes.NewReader([]byte(addressesJson)))
 
 	require.Nil(t, err)
 	require.NotNil(t, btcAddrMgr)
@@ -49,7 +49,7 @@ func TestNewBtcAddrsContainsInvalid(t *testing.T) {
 
 	expectedErr := errors.New("Invalid deposit address `bad`: Invalid address length")
 
-	btcAddrMgr, err := NewBTCAddrs(log, db, bytes.NewReader([]byte(addressesJson)))
+	btcAddrMgr, err := NewBTCAddrs(log, db, nil, bytes.NewReader([]byte(addressesJson)))
 
 	require.Error(t, err)
 	require.Equal(t, expectedErr, err)
@@ -73,7 +73,7 @@ func TestNewBtcAddrsContainsDuplicated(t *testing.T) {
 
 	expectedErr := errors.New("Duplicate deposit address `14JwrdSxYXPxSi6crLKVwR4k2dbjfVZ3xj`")
 
-	btcAddrMgr, err := NewBTCAddrs(log, db, bytes.NewReader([]byte(addressesJson)))
+	btcAddrMgr, err := NewBTCAddrs(log, db, nil, bytes.NewReader([]byte(addressesJson)))
 
 	require.Error(t, err)
 	require.Equal(t, expectedErr, err)
@@ -92,7 +92,7 @@ func TestNewBTCAddrsContainsNull(t *testing.T) {
 
 	expectedErr := errors.New("No BTC addresses")
 
-	btcAddrMgr, err := NewBTCAddrs(log, db, bytes.NewReader([]byte(addressesJson)))
+	btcAddrMgr, err := NewBTCAddrs(log, db, nil, bytes.NewReader([]byte(addressesJson)))
 
 	require.Error(t, err)
 	require.Equal(t, expectedErr, err)
@@ -109,9 +109,159 @@ func TestNewBTCAddrsBadFormat(t *testing.T) {
 
 	expectedErr := errors.New("Decode loaded address json failed: EOF")
 
-	btcAddrMgr, err := NewBTCAddrs(log, db, bytes.NewReader([]byte(addressesJson)))
+	btcAddrMgr, err := NewBTCAddrs(log, db, nil, bytes.NewReader([]byte(addressesJson)))
 
 	require.Error(t, err)
 	require.Equal(t, expectedErr, err)
 	require.Nil(t, btcAddrMgr)
 }
+
+func TestNewBTCAddrsSegWit(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	log, _ := testutil.NewLogger(t)
+
+	// Uppercase bech32 addresses are loaded in lowercase, which is how nodes report them
+	addressesJson := `{
+    "btc_addresses": [
+        "3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy",
+        "BC1QW508D6QEJXTDG4Y5R3ZARVARY0C5XW7KV8F3T4",
+        "bc1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3qccfmv3"
+    ]
+}`
+
+	btcAddrMgr, err := NewBTCAddrs(log, db, nil, bytes.NewReader([]byte(addressesJson)))
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), btcAddrMgr.Remaining())
+
+	addrs := make(map[string]bool)
+	for i := 0; i < 3; i++ {
+		addr, err := btcAddrMgr.NewAddress()
+		require.NoError(t, err)
+		addrs[addr] = true
+	}
+
+	require.Equal(t, map[string]bool{
+		"3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy":                             true,
+		"bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4":                     true,
+		"bc1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3qccfmv3": true,
+	}, addrs)
+
+	// The same bech32 address in different cases is a duplicate
+	addressesJson = `{
+    "btc_addresses": [
+        "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4",
+        "BC1QW508D6QEJXTDG4Y5R3ZARVARY0C5XW7KV8F3T4"
+    ]
+}`
+
+	_, err = NewBTCAddrs(log, db, nil, bytes.NewReader([]byte(addressesJson)))
+	require.Equal(t, errors.New("Duplicate deposit address `bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4`"), err)
+}
+
+func TestVerifyBTCAddress(t *testing.T) {
+	tt := []struct {
+		name string
+		addr string
+		err  error
+	}{
+		{
+			"p2pkh",
+			"1PZ63K3G4gZP6A6E2TTbBwxT5bFQGL2TLB",
+			nil,
+		},
+		{
+			"p2sh",
+			"3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy",
+			nil,
+		},
+		{
+			"p2wpkh",
+			"bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4",
+			nil,
+		},
+		{
+			"p2wsh",
+			"bc1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3qccfmv3",
+			nil,
+		},
+		{
+			"bad",
+			"bad",
+			errors.New("Invalid address length"),
+		},
+		{
+			"litecoin address",
+			"LdDxRJUshHmWxuuieubRTnKzzLpt4qwkPN",
+			errors.New("Invalid version"),
+		},
+		{
+			"bad checksum",
+			"1PZ63K3G4gZP6A6E2TTbBwxT5bFQGL2TLC",
+			errors.New("checksum error"),
+		},
+		{
+			"testnet bech32",
+			"tb1qw508d6qejxtdg4y5r3zarvary0c5xw7kxpjzsx",
+			errors.New("Invalid address length"),
+		},
+		{
+			"bad bech32 checksum",
+			"bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t5",
+			errors.New("Invalid bech32 checksum"),
+		},
+		{
+			"mixed case bech32",
+			"bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kV8F3T4",
+			errors.New("Mixed case bech32 string"),
+		},
+		{
+			"witness version 1",
+			"bc1pw508d6qejxtdg4y5r3zarvary0c5xw7kw508d6qejxtdg4y5r3zarvary0c5xw7k7grplx",
+			errors.New("Unsupported witness version 1"),
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.err, VerifyBTCAddress(tc.addr))
+		})
+	}
+}
+
+func TestNewBTCPoolAddrsSharesUsed(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	log, _ := testutil.NewLogger(t)
+
+	addressesJson := `{
+    "btc_addresses": [
+        "1PZ63K3G4gZP6A6E2TTbBwxT5bFQGL2TLB",
+        "14FG8vQnmK6B7YbLSr6uC5wfGY78JFNCYg"
+    ]
+}`
+
+	btcAddrMgr, err := NewBTCAddrs(log, db, nil, bytes.NewReader([]byte(addressesJson)))
+	require.NoError(t, err)
+
+	addr, err := btcAddrMgr.NewAddress()
+	require.NoError(t, err)
+	require.Equal(t, "1PZ63K3G4gZP6A6E2TTbBwxT5bFQGL2TLB", addr)
+
+	// The address used by the BTC pool is not in the other pool
+	pool, err := NewBTCPoolAddrs(log, db, nil, []string{
+		"1PZ63K3G4gZP6A6E2TTbBwxT5bFQGL2TLB",
+		"1Mv16pwUZYUrMWLTe2DDZzXHGAyHdKA5oz",
+	})
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), pool.Remaining())
+
+	addr, err = pool.NewAddress()
+	require.NoError(t, err)
+	require.Equal(t, "1Mv16pwUZYUrMWLTe2DDZzXHGAyHdKA5oz", addr)
+
+	_, err = NewBTCPoolAddrs(log, db, nil, []string{"bad"})
+	require.Error(t, err)
+}
@@ -0,0 +1,202 @@
+package addrs
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Pool is a deposit address pool checked by ConflictChecker
+type Pool struct {
+	// Name of the pool in conflict reports, e.g. "BTC" or "campaign spring BTC"
+	Name  string
+	Addrs *Addrs
+}
+
+// PoolLister lists deposit address pools
+type PoolLister interface {
+	Pools() []Pool
+}
+
+// BindingGetter returns the bound deposit addresses, with the skycoin addresses they are bound to
+type BindingGetter interface {
+	GetBoundAddresses() (map[string]string, error)
+}
+
+// AddressConflict is a deposit address that is in more than one pool, or that is bound to a skycoin address
+// but was not given out, so that it would be bound again
+type AddressConflict struct {
+	Address string
+	// Pools the address is in
+	Pools []string
+	// SkyAddress the address is bound to, empty if it is not bound
+	SkyAddress string
+}
+
+// AddressConflictErr is returned by ConflictChecker with the conflicts it found
+type AddressConflictErr struct {
+	Conflicts []AddressConflict
+}
+
+func (e AddressConflictErr) Error() string {
+	lines := make([]string, len(e.Conflicts))
+	for i, c := range e.Conflicts {
+		switch {
+		case c.SkyAddress != "" && len(c.Pools) == 0:
+			lines[i] = fmt.Sprintf("%s is bound to %s", c.Address, c.SkyAddress)
+		case c.SkyAddress != "":
+			lines[i] = fmt.Sprintf("%s is in %s and bound to %s, but was not given out", c.Address, strings.Join(c.Pools, ", "), c.SkyAddress)
+		default:
+			lines[i] = fmt.Sprintf("%s is in %s", c.Address, strings.Join(c.Pools, ", "))
+		}
+	}
+
+	return fmt.Sprintf("%d deposit address conflicts: %s", len(e.Conflicts), strings.Join(lines, "; "))
+}
+
+// ConflictChecker checks that each deposit address is in one pool only, across coin types,
+// and that no address that can still be given out is bound already.
+// Addresses are compared case insensitively, since bech32 and ethereum addresses are.
+type ConflictChecker struct {
+	bindings BindingGetter
+	pools    []PoolLister
+}
+
+// NewConflictChecker creates a ConflictChecker of the pools of pools
+func NewConflictChecker(bindings BindingGetter, pools ...PoolLister) *ConflictChecker {
+	return &ConflictChecker{
+		bindings: bindings,
+		pools:    pools,
+	}
+}
+
+// Check checks all addresses of the pools. Returns an AddressConflictErr with all conflicts found.
+func (c *ConflictChecker) Check() error {
+	bound, err := c.boundAddresses()
+	if err != nil {
+		return err
+	}
+
+	inPools, order := c.poolAddresses()
+
+	var conflicts []AddressConflict
+	for _, key := range order {
+		p := inPools[key]
+
+		skyAddr := bound[key]
+		if skyAddr != "" {
+			used, err := p.isUsed()
+			if err != nil {
+				return err
+			}
+
+			// Addresses that were given out are expected to be bound
+			if used {
+				skyAddr = ""
+			}
+		}
+
+		if len(p.pools) > 1 || skyAddr != "" {
+			conflicts = append(conflicts, AddressConflict{
+				Address:    p.address,
+				Pools:      p.pools,
+				SkyAddress: skyAddr,
+			})
+		}
+	}
+
+	if len(conflicts) > 0 {
+		return AddressConflictErr{Conflicts: conflicts}
+	}
+
+	return nil
+}
+
+// CheckNew checks addresses that are about to be added to a pool: they must not be in a pool already,
+// or be bound. Returns an AddressConflictErr with all conflicts found.
+func (c *ConflictChecker) CheckNew(addresses []string) error {
+	bound, err := c.boundAddresses()
+	if err != nil {
+		return err
+	}
+
+	inPools, _ := c.poolAddresses()
+
+	var conflicts []AddressConflict
+	for _, addr := range addresses {
+		key := strings.ToLower(addr)
+
+		var pools []string
+		if p, ok := inPools[key]; ok {
+			pools = p.pools
+		}
+
+		if len(pools) > 0 || bound[key] != "" {
+			conflicts = append(conflicts, AddressConflict{
+				Address:    addr,
+				Pools:      pools,
+				SkyAddress: bound[key],
+			})
+		}
+	}
+
+	if len(conflicts) > 0 {
+		return AddressConflictErr{Conflicts: conflicts}
+	}
+
+	return nil
+}
+
+// boundAddresses returns the bound skycoin addresses by lowercased deposit address
+func (c *ConflictChecker) boundAddresses() (map[string]string, error) {
+	bindings, err := c.bindings.GetBoundAddresses()
+	if err != nil {
+		return nil, err
+	}
+
+	bound := make(map[string]string, len(bindings))
+	for addr, skyAddr := range bindings {
+		bound[strings.ToLower(addr)] = skyAddr
+	}
+
+	return bound, nil
+}
+
+// pooledAddress is an address and the pools it is in
+type pooledAddress struct {
+	address string
+	pools   []string
+	addrs   *Addrs // first pool the address is in
+}
+
+func (p *pooledAddress) isUsed() (bool, error) {
+	return p.addrs.used.IsUsed(p.address)
+}
+
+// poolAddresses returns the addresses of all pools by lowercased address, and the lowercased addresses in order
+func (c *ConflictChecker) poolAddresses() (map[string]*pooledAddress, []string) {
+	inPools := make(map[string]*pooledAddress)
+	var order []string
+
+	for _, l := range c.pools {
+		for _, pool := range l.Pools() {
+			for _, addr := range pool.Addrs.all() {
+				key := strings.ToLower(addr)
+				p, ok := inPools[key]
+				if !ok {
+					p = &pooledAddress{
+						address: addr,
+						addrs:   pool.Addrs,
+					}
+					inPools[key] = p
+					order = append(order, key)
+				}
+
+				p.pools = append(p.pools, pool.Name)
+			}
+		}
+	}
+
+	sort.Strings(order)
+	return inPools, order
+}
@@ -0,0 +1,102 @@
+package addrs
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+type fakeBindings map[string]string
+
+func (b fakeBindings) GetBoundAddresses() (map[string]string, error) {
+	if b == nil {
+		return nil, errors.New("bindings failed")
+	}
+	return b, nil
+}
+
+type fakePools []Pool
+
+func (p fakePools) Pools() []Pool {
+	return p
+}
+
+func TestConflictChecker(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	log, _ := testutil.NewLogger(t)
+
+	btca, err := NewBTCAddrs(log, db, nil, strings.NewReader(`{"btc_addresses": [
+		"14JwrdSxYXPxSi6crLKVwR4k2dbjfVZ3xj",
+		"1JNonvXRyZvZ4ZJ9PE8voyo67UQN1TpoGy",
+		"bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4"
+	]}`))
+	require.NoError(t, err)
+
+	etha, err := NewETHAddrs(log, db, nil, strings.NewReader(`{"eth_addresses": ["0x5a0b54d5dc17e0aadc383d2db43b0a0d3e029c4c"]}`))
+	require.NoError(t, err)
+
+	m := NewAddrManager()
+	require.NoError(t, m.PushGenerator(btca, "BTC"))
+	require.NoError(t, m.PushGenerator(etha, "SKYT"))
+	require.NoError(t, m.PushGenerator(etha, "USDT"))
+
+	require.Equal(t, []Pool{
+		{Name: "BTC", Addrs: btca},
+		{Name: "SKYT/USDT", Addrs: etha},
+	}, m.Pools())
+
+	// An address that was given out is bound
+	addr, err := btca.NewAddress()
+	require.NoError(t, err)
+	bindings := fakeBindings{addr: "sky1"}
+
+	c := NewConflictChecker(bindings, m)
+	require.NoError(t, c.Check())
+
+	// An address in another pool, compared case insensitively
+	campaign, err := NewBTCPoolAddrs(log, db, nil, []string{"1JrzSx8a9FVHHCkUFLB2CHULpbz4dTz5Ap", "BC1QW508D6QEJXTDG4Y5R3ZARVARY0C5XW7KV8F3T4"})
+	require.NoError(t, err)
+
+	// A bound address that was not given out
+	bindings["1JNonvXRyZvZ4ZJ9PE8voyo67UQN1TpoGy"] = "sky2"
+
+	c = NewConflictChecker(bindings, m, fakePools{{Name: "campaign spring BTC", Addrs: campaign}})
+	err = c.Check()
+	require.Equal(t, AddressConflictErr{
+		Conflicts: []AddressConflict{
+			{Address: "1JNonvXRyZvZ4ZJ9PE8voyo67UQN1TpoGy", Pools: []string{"BTC"}, SkyAddress: "sky2"},
+			{Address: "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4", Pools: []string{"BTC", "campaign spring BTC"}},
+		},
+	}, err)
+	require.Contains(t, err.Error(), "1JNonvXRyZvZ4ZJ9PE8voyo67UQN1TpoGy is in BTC and bound to sky2, but was not given out")
+	require.Contains(t, err.Error(), "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4 is in BTC, campaign spring BTC")
+
+	require.NoError(t, c.CheckNew([]string{"1PZ63K3G4gZP6A6E2TTbBwxT5bFQGL2TLB"}))
+
+	bindings["1PZ63K3G4gZP6A6E2TTbBwxT5bFQGL2TLB"] = "sky3"
+	err = c.CheckNew([]string{"14FG8vQnmK6B7YbLSr6uC5wfGY78JFNCYg", "1PZ63K3G4gZP6A6E2TTbBwxT5bFQGL2TLB", "0x5A0B54D5DC17E0AADC383D2DB43B0A0D3E029C4C"})
+	require.Equal(t, AddressConflictErr{
+		Conflicts: []AddressConflict{
+			{Address: "1PZ63K3G4gZP6A6E2TTbBwxT5bFQGL2TLB", SkyAddress: "sky3"},
+			{Address: "0x5A0B54D5DC17E0AADC383D2DB43B0A0D3E029C4C", Pools: []string{"SKYT/USDT"}},
+		},
+	}, err)
+
+	// The address manager checks added addresses
+	m.SetConflictChecker(c)
+	_, err = m.AddAddresses("BTC", []string{"1JrzSx8a9FVHHCkUFLB2CHULpbz4dTz5Ap"})
+	require.Equal(t, AddressConflictErr{
+		Conflicts: []AddressConflict{
+			{Address: "1JrzSx8a9FVHHCkUFLB2CHULpbz4dTz5Ap", Pools: []string{"campaign spring BTC"}},
+		},
+	}, err)
+
+	c = NewConflictChecker(fakeBindings(nil), m)
+	require.Error(t, c.Check())
+}
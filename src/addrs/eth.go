@@ -0,0 +1,114 @@
+package addrs
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/boltdb/bolt"
+	"github.com/sirupsen/logrus"
+
+	"github.com/skycoin/teller/src/util/dbcrypt"
+)
+
+const ethBucketKey = "used_eth_address"
+
+// NewETHAddrs returns an Addrs loaded with ethereum addresses, for ERC20 token deposits.
+// The addresses are lowercased, since ethereum addresses are case insensitive.
+func NewETHAddrs(log logrus.FieldLogger, db *bolt.DB, c *dbcrypt.Cipher, addrsReader io.Reader) (*Addrs, error) {
+	loader, err := LoadETHAddresses(addrsReader)
+	if err != nil {
+		return nil, err
+	}
+	return newFileAddrs(log, db, c, loader, ethBucketKey, prepareETHAddresses)
+}
+
+// NewETHPoolAddrs returns an Addrs of another pool of ETH addresses, e.g. of a campaign. It shares the used
+// addresses of the ETH pool, so an address that was given out by one pool is not given out by another.
+func NewETHPoolAddrs(log logrus.FieldLogger, db *bolt.DB, c *dbcrypt.Cipher, addresses []string) (*Addrs, error) {
+	addrs, err := prepareETHAddresses(addresses)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewAddrs(log, db, c, addrs, ethBucketKey)
+}
+
+// prepareETHAddresses returns lowercased copies of ETH addresses, after verifying them
+func prepareETHAddresses(addresses []string) ([]string, error) {
+	addrs := make([]string, len(addresses))
+	for i, a := range addresses {
+		addrs[i] = strings.ToLower(a)
+	}
+
+	if err := verifyETHAddresses(addrs); err != nil {
+		return nil, err
+	}
+
+	return addrs, nil
+}
+
+// LoadETHAddresses loads and verifies the ETH deposit addresses of an addresses file
+func LoadETHAddresses(addrsReader io.Reader) ([]string, error) {
+	var addrs struct {
+		Addresses []string `json:"eth_addresses"`
+	}
+
+	if err := json.NewDecoder(addrsReader).Decode(&addrs); err != nil {
+		return nil, fmt.Errorf("Decode loaded address json failed: %v", err)
+	}
+
+	for i, a := range addrs.Addresses {
+		addrs.Addresses[i] = strings.ToLower(a)
+	}
+
+	if err := verifyETHAddresses(addrs.Addresses); err != nil {
+		return nil, err
+	}
+
+	return addrs.Addresses, nil
+}
+
+func verifyETHAddresses(addrs []string) error {
+	if len(addrs) == 0 {
+		return errors.New("No ETH addresses")
+	}
+
+	addrMap := make(map[string]struct{}, len(addrs))
+
+	for _, addr := range addrs {
+		if _, ok := addrMap[addr]; ok {
+			return fmt.Errorf("Duplicate deposit address `%s`", addr)
+		}
+
+		if err := VerifyETHAddress(addr); err != nil {
+			return fmt.Errorf("Invalid deposit address `%s`: %v", addr, err)
+		}
+
+		addrMap[addr] = struct{}{}
+	}
+
+	return nil
+}
+
+// VerifyETHAddress checks that addr is a 0x prefixed hex ethereum address.
+// The EIP-55 mixed case checksum is not verified.
+func VerifyETHAddress(addr string) error {
+	if !strings.HasPrefix(addr, "0x") {
+		return errors.New("Missing 0x prefix")
+	}
+
+	b, err := hex.DecodeString(addr[2:])
+	if err != nil {
+		return errors.New("Invalid hex")
+	}
+
+	if len(b) != 20 {
+		return errors.New("Invalid address length")
+	}
+
+	return nil
+}
@@ -0,0 +1,78 @@
+package addrs
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+func TestNewETHAddrs(t *testing.T) {
+	tt := []struct {
+		name    string
+		addrs   string
+		err     error
+		addrsOK []string
+	}{
+		{
+			"valid",
+			`"0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed", "0xfb6916095ca1df60bb79ce92ce3ea74c37c5d359"`,
+			nil,
+			[]string{"0x5aaeb6053f3e94c9b9a09f33669435e7ef1beaed", "0xfb6916095ca1df60bb79ce92ce3ea74c37c5d359"},
+		},
+		{
+			"duplicate in different case",
+			`"0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed", "0x5aaeb6053f3e94c9b9a09f33669435e7ef1beaed"`,
+			errors.New("Duplicate deposit address `0x5aaeb6053f3e94c9b9a09f33669435e7ef1beaed`"),
+			nil,
+		},
+		{
+			"missing prefix",
+			`"5aaeb6053f3e94c9b9a09f33669435e7ef1beaed"`,
+			errors.New("Invalid deposit address `5aaeb6053f3e94c9b9a09f33669435e7ef1beaed`: Missing 0x prefix"),
+			nil,
+		},
+		{
+			"bad length",
+			`"0x5aaeb6053f3e94c9b9a09f33669435e7ef1bea"`,
+			errors.New("Invalid deposit address `0x5aaeb6053f3e94c9b9a09f33669435e7ef1bea`: Invalid address length"),
+			nil,
+		},
+		{
+			"bad hex",
+			`"0x5aaeb6053f3e94c9b9a09f33669435e7ef1beazz"`,
+			errors.New("Invalid deposit address `0x5aaeb6053f3e94c9b9a09f33669435e7ef1beazz`: Invalid hex"),
+			nil,
+		},
+		{
+			"empty",
+			``,
+			errors.New("No ETH addresses"),
+			nil,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			db, shutdown := testutil.PrepareDB(t)
+			defer shutdown()
+
+			log, _ := testutil.NewLogger(t)
+
+			addressesJSON := `{"eth_addresses": [` + tc.addrs + `]}`
+
+			ethAddrMgr, err := NewETHAddrs(log, db, nil, bytes.NewReader([]byte(addressesJSON)))
+			if tc.err != nil {
+				require.Equal(t, tc.err, err)
+				require.Nil(t, ethAddrMgr)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tc.addrsOK, ethAddrMgr.addresses)
+		})
+	}
+}
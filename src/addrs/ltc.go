@@ -0,0 +1,119 @@
+package addrs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/boltdb/bolt"
+	"github.com/btcsuite/btcutil/base58"
+	"github.com/sirupsen/logrus"
+
+	"github.com/skycoin/teller/src/util/dbcrypt"
+)
+
+const ltcBucketKey = "used_ltc_address"
+
+// ltcAddressVersions are the base58check version bytes of litecoin addresses:
+// P2PKH, P2SH and the legacy P2SH version shared with bitcoin, for mainnet and testnet
+var ltcAddressVersions = map[byte]struct{}{
+	0x30: {}, // L...
+	0x32: {}, // M...
+	0x05: {}, // 3...
+	0x6f: {}, // m... or n..., testnet
+	0x3a: {}, // Q..., testnet
+	0xc4: {}, // 2..., testnet
+}
+
+// NewLTCAddrs returns an Addrs loaded with LTC addresses
+func NewLTCAddrs(log logrus.FieldLogger, db *bolt.DB, c *dbcrypt.Cipher, addrsReader io.Reader) (*Addrs, error) {
+	loader, err := LoadLTCAddresses(addrsReader)
+	if err != nil {
+		return nil, err
+	}
+	return newFileAddrs(log, db, c, loader, ltcBucketKey, prepareLTCAddresses)
+}
+
+// NewLTCPoolAddrs returns an Addrs of another pool of LTC addresses, e.g. of a campaign. It shares the used
+// addresses of the LTC pool, so an address that was given out by one pool is not given out by another.
+func NewLTCPoolAddrs(log logrus.FieldLogger, db *bolt.DB, c *dbcrypt.Cipher, addresses []string) (*Addrs, error) {
+	if err := verifyLTCAddresses(addresses); err != nil {
+		return nil, err
+	}
+
+	return NewAddrs(log, db, c, addresses, ltcBucketKey)
+}
+
+// NewLTCUsedStore returns the Store of the addresses given out by the LTC pools, e.g. to mark the
+// addresses of a rebuilt db as used
+func NewLTCUsedStore(db *bolt.DB, c *dbcrypt.Cipher) (*Store, error) {
+	return NewStore(db, c, ltcBucketKey)
+}
+
+// prepareLTCAddresses returns a copy of LTC addresses, after verifying them
+func prepareLTCAddresses(addresses []string) ([]string, error) {
+	if err := verifyLTCAddresses(addresses); err != nil {
+		return nil, err
+	}
+
+	return append([]string(nil), addresses...), nil
+}
+
+// LoadLTCAddresses loads and verifies the LTC deposit addresses of an addresses file
+func LoadLTCAddresses(addrsReader io.Reader) ([]string, error) {
+	var addrs struct {
+		Addresses []string `json:"ltc_addresses"`
+	}
+
+	if err := json.NewDecoder(addrsReader).Decode(&addrs); err != nil {
+		return nil, fmt.Errorf("Decode loaded address json failed: %v", err)
+	}
+
+	if err := verifyLTCAddresses(addrs.Addresses); err != nil {
+		return nil, err
+	}
+
+	return addrs.Addresses, nil
+}
+
+func verifyLTCAddresses(addrs []string) error {
+	if len(addrs) == 0 {
+		return errors.New("No LTC addresses")
+	}
+
+	addrMap := make(map[string]struct{}, len(addrs))
+
+	for _, addr := range addrs {
+		if _, ok := addrMap[addr]; ok {
+			return fmt.Errorf("Duplicate deposit address `%s`", addr)
+		}
+
+		if err := VerifyLTCAddress(addr); err != nil {
+			return fmt.Errorf("Invalid deposit address `%s`: %v", addr, err)
+		}
+
+		addrMap[addr] = struct{}{}
+	}
+
+	return nil
+}
+
+// VerifyLTCAddress checks that addr is a base58 litecoin address.
+// Bech32 (ltc1...) addresses are not supported.
+func VerifyLTCAddress(addr string) error {
+	b, version, err := base58.CheckDecode(addr)
+	if err != nil {
+		return err
+	}
+
+	if len(b) != 20 {
+		return errors.New("Invalid address length")
+	}
+
+	if _, ok := ltcAddressVersions[version]; !ok {
+		return errors.New("Invalid version")
+	}
+
+	return nil
+}
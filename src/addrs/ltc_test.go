@@ -0,0 +1,98 @@
+package addrs
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+func TestNewLTCAddrsAllValid(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	log, _ := testutil.NewLogger(t)
+
+	addressesJson := `{
+    "ltc_addresses": [
+        "Lf8ZayicoAH1K9oS3jyWafuLYpMPxqeotT",
+        "LTG2aKsMfaRdMWx3pSrBBuBUTWqXRC99eG",
+        "M8nmihxeJkP9BYM1HPvwNdeBNMmdAQXPAR",
+        "miYajQZn3RRt6NdF2Q3D3Q6yjBq9Ju1v6a"
+    ]
+}`
+
+	ltcAddrMgr, err := NewLTCAddrs(log, db, nil, bytes.NewReader([]byte(addressesJson)))
+
+	require.Nil(t, err)
+	require.NotNil(t, ltcAddrMgr)
+	require.Equal(t, uint64(4), ltcAddrMgr.Remaining())
+}
+
+func TestNewLTCAddrsContainsInvalid(t *testing.T) {
+	tt := []struct {
+		name string
+		addr string
+		err  error
+	}{
+		{
+			"bad",
+			"bad",
+			errors.New("Invalid deposit address `bad`: invalid format: version and/or checksum bytes missing"),
+		},
+		{
+			"bitcoin address",
+			"1PZ63K3G4gZP6A6E2TTbBwxT5bFQGL2TLB",
+			errors.New("Invalid deposit address `1PZ63K3G4gZP6A6E2TTbBwxT5bFQGL2TLB`: Invalid version"),
+		},
+		{
+			"bad checksum",
+			"Lf8ZayicoAH1K9oS3jyWafuLYpMPxqeotU",
+			errors.New("Invalid deposit address `Lf8ZayicoAH1K9oS3jyWafuLYpMPxqeotU`: checksum error"),
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			db, shutdown := testutil.PrepareDB(t)
+			defer shutdown()
+
+			log, _ := testutil.NewLogger(t)
+
+			addressesJson := `{
+    "ltc_addresses": [
+        "LdDxRJUshHmWxuuieubRTnKzzLpt4qwkPN",
+        "` + tc.addr + `"
+    ]
+}`
+
+			ltcAddrMgr, err := NewLTCAddrs(log, db, nil, bytes.NewReader([]byte(addressesJson)))
+
+			require.Error(t, err)
+			require.Equal(t, tc.err, err)
+			require.Nil(t, ltcAddrMgr)
+		})
+	}
+}
+
+func TestNewLTCAddrsContainsNull(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	log, _ := testutil.NewLogger(t)
+
+	addressesJson := `{
+      "ltc_addresses": []
+}`
+
+	expectedErr := errors.New("No LTC addresses")
+
+	ltcAddrMgr, err := NewLTCAddrs(log, db, nil, bytes.NewReader([]byte(addressesJson)))
+
+	require.Error(t, err)
+	require.Equal(t, expectedErr, err)
+	require.Nil(t, ltcAddrMgr)
+}
@@ -0,0 +1,343 @@
+package addrs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/sirupsen/logrus"
+
+	"github.com/skycoin/teller/src/util/dbcrypt"
+)
+
+const (
+	defaultRemoteTimeout   = time.Second * 10
+	defaultRemoteBatchSize = 20
+)
+
+// remoteCoin is how the addresses of a coin type are requested from the address service and checked
+type remoteCoin struct {
+	coinType       string
+	usedBucketKey  string
+	givenBucketKey string
+	normalize      func(string) string
+	verify         func(string) error
+}
+
+var (
+	remoteBTC = remoteCoin{
+		coinType:       "BTC",
+		usedBucketKey:  btcBucketKey,
+		givenBucketKey: "remote_btc_address",
+		normalize:      NormalizeBTCAddress,
+		verify:         VerifyBTCAddress,
+	}
+
+	remoteLTC = remoteCoin{
+		coinType:       "LTC",
+		usedBucketKey:  ltcBucketKey,
+		givenBucketKey: "remote_ltc_address",
+		normalize: func(addr string) string {
+			return addr
+		},
+		verify: VerifyLTCAddress,
+	}
+
+	remoteETH = remoteCoin{
+		coinType:       "ETH",
+		usedBucketKey:  ethBucketKey,
+		givenBucketKey: "remote_eth_address",
+		normalize:      strings.ToLower,
+		verify:         VerifyETHAddress,
+	}
+)
+
+// remoteRequest is the request body of the address service
+type remoteRequest struct {
+	CoinType string `json:"coin_type"`
+	Count    int    `json:"count"`
+}
+
+// remoteResponse is the response of the address service
+type remoteResponse struct {
+	Addresses []string `json:"addresses"`
+	Remaining uint64   `json:"remaining"`
+}
+
+// RemoteClient requests new deposit addresses from a remote address service, e.g. a service in front of an HSM.
+//
+// Addresses are requested with POST <url>, with the API key as a bearer token:
+//
+//	{"coin_type": "BTC", "count": 20}
+//
+// and the service responds with 200, the new addresses, and optionally the number of addresses it can still give out:
+//
+//	{"addresses": ["1...", "bc1..."], "remaining": 1000}
+type RemoteClient struct {
+	url    string
+	apiKey string
+	client *http.Client
+}
+
+// NewRemoteClient creates a RemoteClient of the address service at serviceURL. apiKey is optional.
+// Requests time out after timeout, or 10s if it is 0.
+func NewRemoteClient(serviceURL, apiKey string, timeout time.Duration) (*RemoteClient, error) {
+	u, err := url.Parse(serviceURL)
+	if err != nil {
+		return nil, errors.New("invalid address service url")
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, errors.New("address service url must be an http or https URL")
+	}
+
+	if timeout == 0 {
+		timeout = defaultRemoteTimeout
+	}
+
+	return &RemoteClient{
+		url:    serviceURL,
+		apiKey: apiKey,
+		client: &http.Client{
+			Timeout: timeout,
+		},
+	}, nil
+}
+
+// Fetch requests count new addresses of a coin type. It returns the addresses,
+// and the number of addresses the service can still give out, 0 if the service does not report it.
+func (c *RemoteClient) Fetch(ctx context.Context, coinType string, count int) ([]string, uint64, error) {
+	body, err := json.Marshal(remoteRequest{
+		CoinType: coinType,
+		Count:    count,
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, 0, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+
+	rsp, err := c.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("address service request failed: %s", rsp.Status)
+	}
+
+	var ar remoteResponse
+	if err := json.NewDecoder(rsp.Body).Decode(&ar); err != nil {
+		return nil, 0, fmt.Errorf("decode address service response failed: %v", err)
+	}
+
+	return ar.Addresses, ar.Remaining, nil
+}
+
+// RemoteAddrs is an AddressProvider that gives out addresses of a remote address service.
+// Addresses are fetched in batches and cached in memory until they are given out. Addresses that were already
+// given out, by the service or by an address pool of the same coin type, are skipped.
+type RemoteAddrs struct {
+	sync.Mutex
+	log       logrus.FieldLogger
+	client    *RemoteClient
+	coin      remoteCoin
+	batchSize int
+	used      *Store   // used addresses of the coin type, shared with its address pools
+	given     *Store   // addresses given out by RemoteAddrs, that can be released
+	cache     []string // fetched addresses that were not given out yet
+	remaining uint64   // number of addresses the service can still give out, as of the last fetch
+}
+
+// NewBTCRemoteAddrs returns a RemoteAddrs of BTC addresses, which fetches batchSize addresses at a time,
+// or 20 if it is 0. It shares the used addresses of the BTC pool.
+func NewBTCRemoteAddrs(log logrus.FieldLogger, db *bolt.DB, c *dbcrypt.Cipher, client *RemoteClient, batchSize int) (*RemoteAddrs, error) {
+	return newRemoteAddrs(log, db, c, client, remoteBTC, batchSize)
+}
+
+// NewLTCRemoteAddrs returns a RemoteAddrs of LTC addresses, like NewBTCRemoteAddrs
+func NewLTCRemoteAddrs(log logrus.FieldLogger, db *bolt.DB, c *dbcrypt.Cipher, client *RemoteClient, batchSize int) (*RemoteAddrs, error) {
+	return newRemoteAddrs(log, db, c, client, remoteLTC, batchSize)
+}
+
+// NewETHRemoteAddrs returns a RemoteAddrs of ethereum addresses, for ERC20 token deposits, like NewBTCRemoteAddrs.
+// The addresses are requested with the coin type "ETH" for all tokens.
+func NewETHRemoteAddrs(log logrus.FieldLogger, db *bolt.DB, c *dbcrypt.Cipher, client *RemoteClient, batchSize int) (*RemoteAddrs, error) {
+	return newRemoteAddrs(log, db, c, client, remoteETH, batchSize)
+}
+
+func newRemoteAddrs(log logrus.FieldLogger, db *bolt.DB, c *dbcrypt.Cipher, client *RemoteClient, coin remoteCoin, batchSize int) (*RemoteAddrs, error) {
+	if batchSize < 0 {
+		return nil, errors.New("batch size can't be negative")
+	}
+
+	if batchSize == 0 {
+		batchSize = defaultRemoteBatchSize
+	}
+
+	used, err := NewStore(db, c, coin.usedBucketKey)
+	if err != nil {
+		return nil, err
+	}
+
+	given, err := NewStore(db, c, coin.givenBucketKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RemoteAddrs{
+		log: log.WithFields(logrus.Fields{
+			"prefix":   "addrs",
+			"coinType": coin.coinType,
+		}),
+		client:    client,
+		coin:      coin,
+		batchSize: batchSize,
+		used:      used,
+		given:     given,
+	}, nil
+}
+
+// NewAddress returns a new deposit address, fetching a batch of addresses from the service if none are cached
+func (a *RemoteAddrs) NewAddress() (string, error) {
+	a.Lock()
+	defer a.Unlock()
+
+	fetched := false
+	for {
+		if len(a.cache) == 0 {
+			// Fetch once, so that a service that only returns used addresses does not loop forever
+			if fetched {
+				return "", ErrDepositAddressEmpty
+			}
+
+			if err := a.fetch(); err != nil {
+				return "", err
+			}
+			fetched = true
+
+			if len(a.cache) == 0 {
+				return "", ErrDepositAddressEmpty
+			}
+		}
+
+		addr := a.cache[0]
+		a.cache = a.cache[1:]
+
+		if used, err := a.used.IsUsed(addr); err != nil {
+			return "", err
+		} else if used {
+			a.log.WithField("addr", addr).Warning("Address service returned an address that was already given out, skipped")
+			continue
+		}
+
+		if err := a.used.Put(addr); err != nil {
+			return "", fmt.Errorf("Put address in used pool failed: %v", err)
+		}
+
+		if err := a.given.Put(addr); err != nil {
+			return "", fmt.Errorf("Put address in given pool failed: %v", err)
+		}
+
+		return addr, nil
+	}
+}
+
+// fetch requests a batch of addresses from the service and adds them to the cache.
+// The whole batch is rejected if it has an invalid address, e.g. of the wrong network.
+func (a *RemoteAddrs) fetch() error {
+	addrs, remaining, err := a.client.Fetch(context.Background(), a.coin.coinType, a.batchSize)
+	if err != nil {
+		a.log.WithError(err).Error("Fetch addresses from the address service failed")
+		return err
+	}
+
+	cached := make(map[string]struct{}, len(a.cache))
+	for _, addr := range a.cache {
+		cached[addr] = struct{}{}
+	}
+
+	batch := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		addr = a.coin.normalize(addr)
+		if err := a.coin.verify(addr); err != nil {
+			return fmt.Errorf("Address service returned an invalid deposit address `%s`: %v", addr, err)
+		}
+
+		if _, ok := cached[addr]; ok {
+			continue
+		}
+		cached[addr] = struct{}{}
+
+		batch = append(batch, addr)
+	}
+
+	a.cache = append(a.cache, batch...)
+	a.remaining = remaining
+
+	a.log.WithFields(logrus.Fields{
+		"fetched":   len(batch),
+		"remaining": remaining,
+	}).Info("Fetched addresses from the address service")
+
+	return nil
+}
+
+// Release takes back an address given out by RemoteAddrs, e.g. when its binding expired unused,
+// and gives it out again before fetching new addresses.
+// Returns ErrAddressNotInPool if the address was not given out by RemoteAddrs.
+func (a *RemoteAddrs) Release(addr string) error {
+	a.Lock()
+	defer a.Unlock()
+
+	if given, err := a.given.IsUsed(addr); err != nil {
+		return err
+	} else if !given {
+		return ErrAddressNotInPool
+	}
+
+	if err := a.used.Delete(addr); err != nil {
+		return fmt.Errorf("Delete address from used pool failed: %v", err)
+	}
+
+	if err := a.given.Delete(addr); err != nil {
+		return fmt.Errorf("Delete address from given pool failed: %v", err)
+	}
+
+	for _, x := range a.cache {
+		if x == addr {
+			return nil
+		}
+	}
+
+	a.cache = append([]string{addr}, a.cache...)
+	a.log.WithField("addr", addr).Info("Released address to the pool")
+	return nil
+}
+
+// Remaining returns the number of cached addresses, plus the number of addresses the service
+// reported it can still give out in its last response
+func (a *RemoteAddrs) Remaining() uint64 {
+	a.Lock()
+	defer a.Unlock()
+
+	return uint64(len(a.cache)) + a.remaining
+}
@@ -0,0 +1,155 @@
+package addrs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+func TestRemoteClientFetch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPost, r.Method)
+		require.Equal(t, "Bearer key", r.Header.Get("Authorization"))
+
+		var req remoteRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		require.Equal(t, 2, req.Count)
+
+		switch req.CoinType {
+		case "BTC":
+			fmt.Fprint(w, `{"addresses": ["14JwrdSxYXPxSi6crLKVwR4k2dbjfVZ3xj", "1JNonvXRyZvZ4ZJ9PE8voyo67UQN1TpoGy"], "remaining": 10}`)
+		case "LTC":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			fmt.Fprint(w, `not json`)
+		}
+	}))
+	defer srv.Close()
+
+	_, err := NewRemoteClient("ftp://example.com", "", 0)
+	require.Error(t, err)
+
+	c, err := NewRemoteClient(srv.URL, "key", 0)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+
+	addrs, remaining, err := c.Fetch(ctx, "BTC", 2)
+	require.NoError(t, err)
+	require.Equal(t, []string{"14JwrdSxYXPxSi6crLKVwR4k2dbjfVZ3xj", "1JNonvXRyZvZ4ZJ9PE8voyo67UQN1TpoGy"}, addrs)
+	require.Equal(t, uint64(10), remaining)
+
+	_, _, err = c.Fetch(ctx, "LTC", 2)
+	require.Error(t, err)
+
+	_, _, err = c.Fetch(ctx, "ETH", 2)
+	require.Error(t, err)
+}
+
+func TestRemoteAddrs(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	batches := [][]string{
+		{
+			"14JwrdSxYXPxSi6crLKVwR4k2dbjfVZ3xj",
+			"1JNonvXRyZvZ4ZJ9PE8voyo67UQN1TpoGy",
+			"1JNonvXRyZvZ4ZJ9PE8voyo67UQN1TpoGy",
+		},
+		{
+			"1JrzSx8a9FVHHCkUFLB2CHULpbz4dTz5Ap",
+		},
+		{
+			"1JrzSx8a9FVHHCkUFLB2CHULpbz4dTz5Ap",
+		},
+		{
+			"not an address",
+		},
+	}
+
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req remoteRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		require.Equal(t, "BTC", req.CoinType)
+		require.Equal(t, 3, req.Count)
+
+		require.NoError(t, json.NewEncoder(w).Encode(remoteResponse{
+			Addresses: batches[requests],
+			Remaining: uint64(100 - requests),
+		}))
+		requests++
+	}))
+	defer srv.Close()
+
+	c, err := NewRemoteClient(srv.URL, "", 0)
+	require.NoError(t, err)
+
+	log, _ := testutil.NewLogger(t)
+	a, err := NewBTCRemoteAddrs(log, db, nil, c, 3)
+	require.NoError(t, err)
+
+	require.Equal(t, uint64(0), a.Remaining())
+
+	// The first batch is fetched and cached, without the duplicate
+	addr, err := a.NewAddress()
+	require.NoError(t, err)
+	require.Equal(t, "14JwrdSxYXPxSi6crLKVwR4k2dbjfVZ3xj", addr)
+	require.Equal(t, 1, requests)
+	require.Equal(t, uint64(101), a.Remaining())
+
+	addr, err = a.NewAddress()
+	require.NoError(t, err)
+	require.Equal(t, "1JNonvXRyZvZ4ZJ9PE8voyo67UQN1TpoGy", addr)
+	require.Equal(t, 1, requests)
+
+	// The addresses are marked as used in the BTC pool, so the pool doesn't give them out
+	pool, err := NewBTCPoolAddrs(log, db, nil, []string{"1JNonvXRyZvZ4ZJ9PE8voyo67UQN1TpoGy"})
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), pool.Remaining())
+
+	// An address given out by a pool is skipped
+	pool, err = NewBTCPoolAddrs(log, db, nil, []string{"1JrzSx8a9FVHHCkUFLB2CHULpbz4dTz5Ap"})
+	require.NoError(t, err)
+	_, err = pool.NewAddress()
+	require.NoError(t, err)
+
+	_, err = a.NewAddress()
+	require.Equal(t, ErrDepositAddressEmpty, err)
+	require.Equal(t, 2, requests)
+
+	// Released addresses are given out again before fetching new ones
+	require.Equal(t, ErrAddressNotInPool, a.Release("1JrzSx8a9FVHHCkUFLB2CHULpbz4dTz5Ap"))
+	require.NoError(t, a.Release("14JwrdSxYXPxSi6crLKVwR4k2dbjfVZ3xj"))
+
+	addr, err = a.NewAddress()
+	require.NoError(t, err)
+	require.Equal(t, "14JwrdSxYXPxSi6crLKVwR4k2dbjfVZ3xj", addr)
+	require.Equal(t, 2, requests)
+
+	// A batch that is all used addresses leaves the pool empty
+	_, err = a.NewAddress()
+	require.Equal(t, ErrDepositAddressEmpty, err)
+	require.Equal(t, 3, requests)
+
+	// A batch with an invalid address is rejected
+	_, err = a.NewAddress()
+	require.Error(t, err)
+	require.NotEqual(t, ErrDepositAddressEmpty, err)
+	require.Equal(t, 4, requests)
+
+	// The address manager releases addresses of remote providers
+	m := NewAddrManager()
+	require.NoError(t, m.PushGenerator(a, "BTC"))
+	require.NoError(t, m.Release("1JNonvXRyZvZ4ZJ9PE8voyo67UQN1TpoGy"))
+	addr, err = m.NewAddress("BTC")
+	require.NoError(t, err)
+	require.Equal(t, "1JNonvXRyZvZ4ZJ9PE8voyo67UQN1TpoGy", addr)
+}
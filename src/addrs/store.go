@@ -5,31 +5,40 @@ import (
 
 	"github.com/boltdb/bolt"
 
+	"github.com/skycoin/teller/src/util/dbcrypt"
 	"github.com/skycoin/teller/src/util/dbutil"
 )
 
-// Store saves used addresses in a bucket
+// Store saves used addresses in a bucket.
+// If c is not nil, the addresses are stored as their hashes, so that the bucket doesn't list them.
 type Store struct {
 	db        *bolt.DB
+	c         *dbcrypt.Cipher
 	BucketKey []byte
 }
 
-// NewStore creates a Store for a bucket key
-func NewStore(db *bolt.DB, key string) (*Store, error) {
+// NewStore creates a Store for a bucket key. The addresses stored before encryption was enabled are hashed.
+func NewStore(db *bolt.DB, c *dbcrypt.Cipher, key string) (*Store, error) {
 	if db == nil {
 		return nil, errors.New("db is nil")
 	}
 
 	// creates usedAddressBkt if not exist
 	if err := db.Update(func(tx *bolt.Tx) error {
-		_, err := tx.CreateBucketIfNotExists([]byte(key))
-		return err
+		if _, err := tx.CreateBucketIfNotExists([]byte(key)); err != nil {
+			return err
+		}
+
+		return c.MigrateTx(tx, []byte(key), func(k, v []byte) ([]byte, []byte, error) {
+			return []byte(c.Hash(string(k))), v, nil
+		})
 	}); err != nil {
 		return nil, err
 	}
 
 	return &Store{
 		db:        db,
+		c:         c,
 		BucketKey: []byte(key),
 	}, nil
 }
@@ -37,7 +46,14 @@ func NewStore(db *bolt.DB, key string) (*Store, error) {
 // Put sets an address in the bucket, marking it as used
 func (s *Store) Put(addr string) error {
 	return s.db.Update(func(tx *bolt.Tx) error {
-		return tx.Bucket(s.BucketKey).Put([]byte(addr), []byte(""))
+		return tx.Bucket(s.BucketKey).Put([]byte(s.c.Hash(addr)), []byte(""))
+	})
+}
+
+// Delete removes an address from the bucket, marking it as unused
+func (s *Store) Delete(addr string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(s.BucketKey).Delete([]byte(s.c.Hash(addr)))
 	})
 }
 
@@ -46,7 +62,7 @@ func (s *Store) IsUsed(addr string) (bool, error) {
 	exists := false
 	if err := s.db.View(func(tx *bolt.Tx) error {
 		var err error
-		exists, err = dbutil.BucketHasKey(tx, s.BucketKey, addr)
+		exists, err = dbutil.BucketHasKey(tx, s.BucketKey, s.c.Hash(addr))
 		return err
 	}); err != nil {
 		return false, err
@@ -6,6 +6,7 @@ import (
 	"github.com/boltdb/bolt"
 	"github.com/stretchr/testify/require"
 
+	"github.com/skycoin/teller/src/util/dbcrypt"
 	"github.com/skycoin/teller/src/util/dbutil"
 	"github.com/skycoin/teller/src/util/testutil"
 )
@@ -14,7 +15,7 @@ func TestNewStore(t *testing.T) {
 	db, shutdown := testutil.PrepareDB(t)
 	defer shutdown()
 
-	s, err := NewStore(db, "test_bucket")
+	s, err := NewStore(db, nil, "test_bucket")
 	require.NoError(t, err)
 
 	err = db.View(func(tx *bolt.Tx) error {
@@ -29,7 +30,7 @@ func TestStorePut(t *testing.T) {
 	db, shutdown := testutil.PrepareDB(t)
 	defer shutdown()
 
-	s, err := NewStore(db, "test_bucket")
+	s, err := NewStore(db, nil, "test_bucket")
 	require.NoError(t, err)
 
 	require.Nil(t, s.Put("a1"))
@@ -56,7 +57,7 @@ func TestStoreGet(t *testing.T) {
 	db, shutdown := testutil.PrepareDB(t)
 	defer shutdown()
 
-	s, err := NewStore(db, "test_bucket")
+	s, err := NewStore(db, nil, "test_bucket")
 	require.NoError(t, err)
 
 	err = db.Update(func(tx *bolt.Tx) error {
@@ -84,3 +85,41 @@ func TestStoreGet(t *testing.T) {
 	require.NoError(t, err)
 	require.False(t, used)
 }
+
+func TestStoreEncrypted(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	// An address used before encryption was enabled
+	s, err := NewStore(db, nil, "test_bucket")
+	require.NoError(t, err)
+	require.NoError(t, s.Put("a1"))
+
+	c, err := dbcrypt.Open(db, "secret")
+	require.NoError(t, err)
+
+	s, err = NewStore(db, c, "test_bucket")
+	require.NoError(t, err)
+	require.NoError(t, s.Put("a2"))
+
+	for _, a := range []string{"a1", "a2"} {
+		used, err := s.IsUsed(a)
+		require.NoError(t, err)
+		require.True(t, used)
+	}
+
+	// The bucket doesn't list the addresses
+	err = db.View(func(tx *bolt.Tx) error {
+		return dbutil.ForEach(tx, s.BucketKey, func(k, v []byte) error {
+			require.NotEqual(t, "a1", string(k))
+			require.NotEqual(t, "a2", string(k))
+			return nil
+		})
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, s.Delete("a1"))
+	used, err := s.IsUsed("a1")
+	require.NoError(t, err)
+	require.False(t, used)
+}
@@ -0,0 +1,414 @@
+// Package alert notifies operators of critical events, e.g. failed sends or a low hot wallet
+// balance, through sinks such as email, Slack or Telegram.
+package alert
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// EventSendFailed is alerted when skycoins could not be sent for a deposit
+	EventSendFailed = "send_failed"
+	// EventScannerBehind is alerted when a scanner falls behind the blockchain
+	EventScannerBehind = "scanner_behind"
+	// EventWalletBalanceLow is alerted when the hot wallet balance falls below the low balance
+	EventWalletBalanceLow = "wallet_balance_low"
+	// EventAddressPoolLow is alerted when the deposit address pool is nearly empty
+	EventAddressPoolLow = "address_pool_low"
+	// EventHTTPErrors is alerted when the API responds with repeated 5xx errors
+	EventHTTPErrors = "http_errors"
+	// EventLargeDeposit is alerted when a deposit is unusually large
+	EventLargeDeposit = "large_deposit"
+	// EventRepeatedDeposits is alerted when unusually many deposits are credited to the same skycoin address
+	EventRepeatedDeposits = "repeated_deposits"
+	// EventBindSpike is alerted when the bind rate spikes
+	EventBindSpike = "bind_spike"
+	// EventDoubleSpend is alerted when the transaction of a deposit is double spent
+	EventDoubleSpend = "double_spend"
+
+	defaultCooldown    = time.Minute * 30
+	defaultCheckPeriod = time.Minute
+	alertBufferSize    = 100
+)
+
+// Events lists all events
+var Events = []string{
+	EventSendFailed,
+	EventScannerBehind,
+	EventWalletBalanceLow,
+	EventAddressPoolLow,
+	EventHTTPErrors,
+	EventLargeDeposit,
+	EventRepeatedDeposits,
+	EventBindSpike,
+	EventDoubleSpend,
+}
+
+// Severity is the severity of an alert. Sinks only receive alerts at or above their minimum severity.
+type Severity int
+
+const (
+	// SeverityOff disables alerts of an event
+	SeverityOff Severity = iota
+	// SeverityInfo is for events that need no action
+	SeverityInfo
+	// SeverityWarning is for events that need action soon
+	SeverityWarning
+	// SeverityCritical is for events that need action now
+	SeverityCritical
+)
+
+// DefaultSeverities are the severities of events that are not configured
+var DefaultSeverities = map[string]Severity{
+	EventSendFailed:       SeverityCritical,
+	EventScannerBehind:    SeverityWarning,
+	EventWalletBalanceLow: SeverityCritical,
+	EventAddressPoolLow:   SeverityWarning,
+	EventHTTPErrors:       SeverityWarning,
+	EventLargeDeposit:     SeverityWarning,
+	EventRepeatedDeposits: SeverityWarning,
+	EventBindSpike:        SeverityWarning,
+	EventDoubleSpend:      SeverityCritical,
+}
+
+// String returns the name of the severity
+func (s Severity) String() string {
+	switch s {
+	case SeverityOff:
+		return "off"
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	case SeverityCritical:
+		return "critical"
+	default:
+		return fmt.Sprintf("Severity(%d)", int(s))
+	}
+}
+
+// ParseSeverity parses "off", "info", "warning" or "critical"
+func ParseSeverity(s string) (Severity, error) {
+	switch strings.ToLower(s) {
+	case "off":
+		return SeverityOff, nil
+	case "info":
+		return SeverityInfo, nil
+	case "warning":
+		return SeverityWarning, nil
+	case "critical":
+		return SeverityCritical, nil
+	default:
+		return SeverityOff, fmt.Errorf("invalid severity %q", s)
+	}
+}
+
+// Alert is a notification of an event
+type Alert struct {
+	Event    string
+	Severity Severity
+	Message  string
+	Time     time.Time
+
+	// subject and text formatted by the Template of the sink, the default format if empty
+	subject string
+	text    string
+}
+
+// Subject returns a one line summary of the alert
+func (a Alert) Subject() string {
+	if a.subject != "" {
+		return a.subject
+	}
+	return fmt.Sprintf("[%s] teller %s", strings.ToUpper(a.Severity.String()), a.Event)
+}
+
+// Text returns the alert formatted for a chat message or email body
+func (a Alert) Text() string {
+	if a.text != "" {
+		return a.text
+	}
+	return fmt.Sprintf("%s\n%s\n%s", a.Subject(), a.Message, a.Time.UTC().Format(time.RFC3339))
+}
+
+// Sink delivers alerts, e.g. by email. Sink types are registered with RegisterSink.
+type Sink interface {
+	Name() string
+	Send(Alert) error
+}
+
+// SinkOptions configures how a sink receives alerts
+type SinkOptions struct {
+	// Only alerts of at least this severity are sent
+	MinSeverity Severity
+	// Formats the alerts, the default format if nil
+	Template *Template
+}
+
+// Route sends the alerts of events to sinks
+type Route struct {
+	// Events routed, all events if empty
+	Events []string
+	// Names of the sinks
+	Sinks []string
+}
+
+// Config configures the Notifier
+type Config struct {
+	// An event is alerted at most once per Cooldown
+	Cooldown time.Duration
+	// How often the checks are run
+	CheckPeriod time.Duration
+	// Severity of each event, events missing from it have their DefaultSeverities
+	Severities map[string]Severity
+}
+
+type sink struct {
+	Sink
+	name string
+	SinkOptions
+}
+
+type check struct {
+	event string
+	f     func() string
+}
+
+// Notifier sends alerts of events to its sinks, in the background.
+// Repeats of an event within the cooldown are dropped, so that a recurring failure
+// doesn't flood the sinks.
+type Notifier struct {
+	log      logrus.FieldLogger
+	cfg      Config
+	sinks    []sink
+	routes   []Route
+	checks   []check
+	alerts   chan Alert
+	lastSent map[string]time.Time
+	lock     sync.Mutex
+	quit     chan struct{}
+	done     chan struct{}
+}
+
+// NewNotifier creates a Notifier
+func NewNotifier(log logrus.FieldLogger, cfg Config) *Notifier {
+	if cfg.Cooldown == 0 {
+		cfg.Cooldown = defaultCooldown
+	}
+
+	if cfg.CheckPeriod == 0 {
+		cfg.CheckPeriod = defaultCheckPeriod
+	}
+
+	return &Notifier{
+		log:      log.WithField("prefix", "alert"),
+		cfg:      cfg,
+		alerts:   make(chan Alert, alertBufferSize),
+		lastSent: make(map[string]time.Time),
+		quit:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// AddSink adds a sink named s.Name() receiving the alerts at or above minSeverity. Must be called before Run.
+func (n *Notifier) AddSink(s Sink, minSeverity Severity) {
+	n.AddNamedSink(s.Name(), s, SinkOptions{
+		MinSeverity: minSeverity,
+	})
+}
+
+// AddNamedSink adds a sink that routes refer to by name. Must be called before Run.
+func (n *Notifier) AddNamedSink(name string, s Sink, opts SinkOptions) {
+	n.sinks = append(n.sinks, sink{
+		Sink:        s,
+		name:        name,
+		SinkOptions: opts,
+	})
+}
+
+// AddRoute adds a route of events to sinks. Without routes, every alert is sent to every sink.
+// With routes, an alert is sent to the sinks of the routes of its event only. Must be called before Run.
+func (n *Notifier) AddRoute(r Route) {
+	n.routes = append(n.routes, r)
+}
+
+// AddCheck adds a check of event run every CheckPeriod. If f returns a message, event is alerted with it.
+// Must be called before Run.
+func (n *Notifier) AddCheck(event string, f func() string) {
+	n.checks = append(n.checks, check{
+		event: event,
+		f:     f,
+	})
+}
+
+// Severity returns the severity of event
+func (n *Notifier) Severity(event string) Severity {
+	if s, ok := n.cfg.Severities[event]; ok {
+		return s
+	}
+	return DefaultSeverities[event]
+}
+
+// Notify queues an alert of event, unless the event is off or was alerted within the cooldown.
+// It doesn't block; if the queue is full, the alert is dropped.
+func (n *Notifier) Notify(event, message string) {
+	n.NotifyKey(event, "", message)
+}
+
+// NotifyKey queues an alert of event like Notify, but the cooldown applies to each key of the event separately,
+// e.g. so that each large deposit is alerted
+func (n *Notifier) NotifyKey(event, key, message string) {
+	severity := n.Severity(event)
+	if severity == SeverityOff {
+		return
+	}
+
+	now := time.Now()
+	cooldownKey := event
+	if key != "" {
+		cooldownKey = event + ":" + key
+	}
+
+	n.lock.Lock()
+	if key != "" {
+		// Forget the keys whose cooldown is over, so that lastSent doesn't grow with each key
+		for k, t := range n.lastSent {
+			if now.Sub(t) >= n.cfg.Cooldown {
+				delete(n.lastSent, k)
+			}
+		}
+	}
+
+	if t, ok := n.lastSent[cooldownKey]; ok && now.Sub(t) < n.cfg.Cooldown {
+		n.lock.Unlock()
+		return
+	}
+	n.lastSent[cooldownKey] = now
+	n.lock.Unlock()
+
+	a := Alert{
+		Event:    event,
+		Severity: severity,
+		Message:  message,
+		Time:     now,
+	}
+
+	select {
+	case n.alerts <- a:
+	default:
+		n.log.WithField("alert", a).Error("Alert queue is full, dropping alert")
+	}
+}
+
+// Run sends queued alerts, and runs the checks every CheckPeriod, until Shutdown is called
+func (n *Notifier) Run() error {
+	log := n.log.WithField("config", n.cfg)
+	log.Info("Start alert notifier")
+	defer log.Info("Alert notifier closed")
+	defer close(n.done)
+
+	ticker := time.NewTicker(n.cfg.CheckPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-n.quit:
+			return nil
+		case a := <-n.alerts:
+			n.send(a)
+		case <-ticker.C:
+			n.runChecks()
+		}
+	}
+}
+
+// Shutdown stops the Notifier. Alerts still queued are not sent.
+func (n *Notifier) Shutdown() {
+	close(n.quit)
+	<-n.done
+}
+
+func (n *Notifier) runChecks() {
+	for _, c := range n.checks {
+		if msg := c.f(); msg != "" {
+			n.Notify(c.event, msg)
+		}
+	}
+}
+
+// routedSinks returns the names of the sinks that the alerts of event are routed to, nil if there are no routes
+func (n *Notifier) routedSinks(event string) map[string]struct{} {
+	if len(n.routes) == 0 {
+		return nil
+	}
+
+	names := make(map[string]struct{})
+	for _, r := range n.routes {
+		if !routeMatches(r, event) {
+			continue
+		}
+
+		for _, name := range r.Sinks {
+			names[name] = struct{}{}
+		}
+	}
+
+	return names
+}
+
+func routeMatches(r Route, event string) bool {
+	if len(r.Events) == 0 {
+		return true
+	}
+
+	for _, e := range r.Events {
+		if e == event {
+			return true
+		}
+	}
+
+	return false
+}
+
+// send delivers an alert to each sink it is routed to that accepts its severity. Failures are logged, not retried.
+func (n *Notifier) send(a Alert) {
+	routed := n.routedSinks(a.Event)
+
+	for _, s := range n.sinks {
+		if routed != nil {
+			if _, ok := routed[s.name]; !ok {
+				continue
+			}
+		}
+
+		if a.Severity < s.MinSeverity {
+			continue
+		}
+
+		log := n.log.WithFields(logrus.Fields{
+			"sink":  s.name,
+			"event": a.Event,
+		})
+
+		msg := a
+		if s.Template != nil {
+			var err error
+			msg, err = s.Template.Apply(a)
+			if err != nil {
+				log.WithError(err).Error("Formatting alert failed, sending it in the default format")
+			}
+		}
+
+		if err := s.Send(msg); err != nil {
+			log.WithError(err).Error("Sending alert failed")
+			continue
+		}
+
+		log.Debug("Sent alert")
+	}
+}
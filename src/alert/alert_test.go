@@ -0,0 +1,344 @@
+package alert
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+type dummySink struct {
+	sync.Mutex
+	name   string
+	err    error
+	alerts []Alert
+}
+
+func (s *dummySink) Name() string {
+	return s.name
+}
+
+func (s *dummySink) Send(a Alert) error {
+	s.Lock()
+	defer s.Unlock()
+	s.alerts = append(s.alerts, a)
+	return s.err
+}
+
+func (s *dummySink) received() []Alert {
+	s.Lock()
+	defer s.Unlock()
+	return append([]Alert(nil), s.alerts...)
+}
+
+// waitAlerts waits for the sink to receive n alerts
+func waitAlerts(t *testing.T, s *dummySink, n int) []Alert {
+	for i := 0; i < 100; i++ {
+		if alerts := s.received(); len(alerts) >= n {
+			return alerts
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	t.Fatalf("sink %s did not receive %d alerts", s.name, n)
+	return nil
+}
+
+func TestParseSeverity(t *testing.T) {
+	for _, s := range []Severity{SeverityOff, SeverityInfo, SeverityWarning, SeverityCritical} {
+		p, err := ParseSeverity(s.String())
+		require.NoError(t, err)
+		require.Equal(t, s, p)
+	}
+
+	p, err := ParseSeverity("CRITICAL")
+	require.NoError(t, err)
+	require.Equal(t, SeverityCritical, p)
+
+	_, err = ParseSeverity("fatal")
+	require.Error(t, err)
+
+	for _, e := range Events {
+		_, ok := DefaultSeverities[e]
+		require.True(t, ok, e)
+	}
+}
+
+func TestNotifier(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+
+	n := NewNotifier(log, Config{
+		Cooldown: time.Hour,
+		Severities: map[string]Severity{
+			EventHTTPErrors:    SeverityInfo,
+			EventScannerBehind: SeverityOff,
+		},
+	})
+
+	all := &dummySink{name: "all"}
+	critical := &dummySink{
+		name: "critical",
+		err:  errors.New("sink is down"),
+	}
+	n.AddSink(all, SeverityInfo)
+	n.AddSink(critical, SeverityCritical)
+
+	go n.Run() // nolint: errcheck
+	defer n.Shutdown()
+
+	require.Equal(t, SeverityInfo, n.Severity(EventHTTPErrors))
+	require.Equal(t, SeverityCritical, n.Severity(EventSendFailed))
+
+	n.Notify(EventHTTPErrors, "5 errors")
+	n.Notify(EventSendFailed, "deposit failed")
+
+	// Repeats within the cooldown and events that are off are dropped
+	n.Notify(EventSendFailed, "deposit failed again")
+	n.Notify(EventScannerBehind, "behind")
+
+	alerts := waitAlerts(t, all, 2)
+	require.Len(t, alerts, 2)
+	require.Equal(t, EventHTTPErrors, alerts[0].Event)
+	require.Equal(t, SeverityInfo, alerts[0].Severity)
+	require.Equal(t, "5 errors", alerts[0].Message)
+	require.Equal(t, EventSendFailed, alerts[1].Event)
+	require.Equal(t, SeverityCritical, alerts[1].Severity)
+	require.Equal(t, "[CRITICAL] teller send_failed", alerts[1].Subject())
+
+	// A failing sink doesn't stop the others, and only gets alerts at its minimum severity
+	alerts = waitAlerts(t, critical, 1)
+	require.Len(t, alerts, 1)
+	require.Equal(t, EventSendFailed, alerts[0].Event)
+
+	time.Sleep(time.Millisecond * 50)
+	require.Len(t, all.received(), 2)
+	require.Len(t, critical.received(), 1)
+}
+
+func TestNotifierCheck(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+
+	n := NewNotifier(log, Config{
+		Cooldown:    time.Millisecond * 50,
+		CheckPeriod: time.Millisecond * 10,
+	})
+
+	s := &dummySink{name: "sink"}
+	n.AddSink(s, SeverityInfo)
+
+	var lock sync.Mutex
+	remaining := 5
+	n.AddCheck(EventAddressPoolLow, func() string {
+		lock.Lock()
+		defer lock.Unlock()
+		if remaining < 10 {
+			return "5 addresses left"
+		}
+		return ""
+	})
+
+	go n.Run() // nolint: errcheck
+	defer n.Shutdown()
+
+	// The check keeps failing, so it is alerted again after the cooldown
+	alerts := waitAlerts(t, s, 2)
+	require.Equal(t, EventAddressPoolLow, alerts[0].Event)
+	require.Equal(t, SeverityWarning, alerts[0].Severity)
+	require.Equal(t, "5 addresses left", alerts[0].Message)
+	require.True(t, alerts[1].Time.Sub(alerts[0].Time) >= time.Millisecond*50)
+
+	lock.Lock()
+	remaining = 100
+	lock.Unlock()
+
+	time.Sleep(time.Millisecond * 100)
+	count := len(s.received())
+	time.Sleep(time.Millisecond * 100)
+	require.Equal(t, count, len(s.received()))
+}
+
+func TestHTTPErrorCounter(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+
+	n := NewNotifier(log, Config{
+		Cooldown: time.Millisecond,
+	})
+
+	s := &dummySink{name: "sink"}
+	n.AddSink(s, SeverityInfo)
+
+	go n.Run() // nolint: errcheck
+	defer n.Shutdown()
+
+	c := NewHTTPErrorCounter(n, 3, time.Minute)
+
+	status := http.StatusOK
+	h := c.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+
+	serve := func(code int) {
+		status = code
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/status", nil))
+		require.Equal(t, code, rr.Code)
+	}
+
+	serve(http.StatusInternalServerError)
+	serve(http.StatusBadRequest)
+	serve(http.StatusOK)
+	serve(http.StatusBadGateway)
+
+	time.Sleep(time.Millisecond * 50)
+	require.Empty(t, s.received())
+
+	serve(http.StatusServiceUnavailable)
+
+	alerts := waitAlerts(t, s, 1)
+	require.Equal(t, EventHTTPErrors, alerts[0].Event)
+	require.Equal(t, "API responded with 3 server errors within 1m0s", alerts[0].Message)
+
+	// Errors outside of the window are not counted
+	now := time.Now()
+	c.add(now.Add(-time.Minute * 2))
+	c.add(now.Add(-time.Minute))
+	c.add(now)
+	c.add(now)
+
+	time.Sleep(time.Millisecond * 50)
+	require.Len(t, s.received(), 1)
+
+	c.add(now)
+	alerts = waitAlerts(t, s, 2)
+	require.Equal(t, "API responded with 3 server errors within 1m0s", alerts[1].Message)
+}
+
+func TestNotifierRoutes(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+
+	n := NewNotifier(log, Config{
+		Cooldown: time.Hour,
+	})
+
+	oncall := &dummySink{name: "smtp"}
+	chat := &dummySink{name: "slack"}
+	audit := &dummySink{name: "webhook"}
+	unrouted := &dummySink{name: "log"}
+
+	tmpl, err := NewTemplate("{{.Severity}}: {{.Event}}", "{{.Message}} ({{.Subject}})")
+	require.NoError(t, err)
+
+	n.AddNamedSink("oncall", oncall, SinkOptions{
+		MinSeverity: SeverityInfo,
+		Template:    tmpl,
+	})
+	n.AddNamedSink("chat", chat, SinkOptions{
+		MinSeverity: SeverityCritical,
+	})
+	n.AddNamedSink("audit", audit, SinkOptions{
+		MinSeverity: SeverityInfo,
+	})
+	n.AddNamedSink("unrouted", unrouted, SinkOptions{
+		MinSeverity: SeverityInfo,
+	})
+
+	n.AddRoute(Route{
+		Events: []string{EventSendFailed, EventDoubleSpend},
+		Sinks:  []string{"oncall", "chat"},
+	})
+	n.AddRoute(Route{
+		Events: []string{EventHTTPErrors},
+		Sinks:  []string{"chat"},
+	})
+	// A route without events matches every event, and a sink routed twice gets the alert once
+	n.AddRoute(Route{
+		Sinks: []string{"audit", "oncall"},
+	})
+
+	go n.Run() // nolint: errcheck
+	defer n.Shutdown()
+
+	n.Notify(EventSendFailed, "deposit failed")
+	n.Notify(EventHTTPErrors, "5 errors")
+
+	alerts := waitAlerts(t, audit, 2)
+	require.Equal(t, EventSendFailed, alerts[0].Event)
+	require.Equal(t, EventHTTPErrors, alerts[1].Event)
+
+	// Only the sink with a template gets formatted alerts
+	require.Equal(t, "[CRITICAL] teller send_failed", alerts[0].Subject())
+
+	alerts = waitAlerts(t, oncall, 2)
+	require.Equal(t, "critical: send_failed", alerts[0].Subject())
+	require.Equal(t, "deposit failed ([CRITICAL] teller send_failed)", alerts[0].Text())
+	require.Equal(t, "deposit failed", alerts[0].Message)
+
+	// The http_errors warning is routed to chat, but is below its minimum severity
+	alerts = waitAlerts(t, chat, 1)
+	require.Equal(t, EventSendFailed, alerts[0].Event)
+
+	time.Sleep(time.Millisecond * 50)
+	require.Len(t, chat.received(), 1)
+	require.Len(t, oncall.received(), 2)
+	require.Empty(t, unrouted.received())
+}
+
+func TestTemplate(t *testing.T) {
+	_, err := NewTemplate("{{.Event", "")
+	require.Error(t, err)
+
+	// Unknown fields are found when the template is created
+	_, err = NewTemplate("", "{{.Amount}}")
+	require.Error(t, err)
+
+	tmpl, err := NewTemplate("", `{{.Event}} at {{.Time.Format "15:04"}}: {{.Message}}`)
+	require.NoError(t, err)
+
+	a := Alert{
+		Event:    EventLargeDeposit,
+		Severity: SeverityWarning,
+		Message:  "Deposit of 10 BTC",
+		Time:     time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+
+	formatted, err := tmpl.Apply(a)
+	require.NoError(t, err)
+	require.Equal(t, "[WARNING] teller large_deposit", formatted.Subject())
+	require.Equal(t, "large_deposit at 03:04: Deposit of 10 BTC", formatted.Text())
+
+	// The alert itself is not changed
+	require.Equal(t, "[WARNING] teller large_deposit\nDeposit of 10 BTC\n2018-01-02T03:04:05Z", a.Text())
+}
+
+func TestRegistry(t *testing.T) {
+	require.Equal(t, []string{SinkTypeLog, SinkTypeSlack, SinkTypeSMTP, SinkTypeTelegram, SinkTypeWebhook}, SinkTypes())
+
+	s, err := NewSink(SinkTypeWebhook, SinkConfig{
+		URL: "https://example.com/alerts",
+	})
+	require.NoError(t, err)
+	require.Equal(t, SinkTypeWebhook, s.Name())
+
+	_, err = NewSink(SinkTypeWebhook, SinkConfig{})
+	require.Error(t, err)
+
+	_, err = NewSink("pager", SinkConfig{})
+	require.Error(t, err)
+
+	// The config error of a factory is returned as is, a nil sink is not returned as a non-nil interface
+	s, err = NewSink(SinkTypeSlack, SinkConfig{})
+	require.Error(t, err)
+	require.Nil(t, s)
+
+	require.Panics(t, func() {
+		RegisterSink(SinkTypeLog, func(SinkConfig) (Sink, error) {
+			return nil, nil
+		})
+	})
+}
@@ -0,0 +1,158 @@
+package alert
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/skycoin/teller/src/util/qrutil"
+)
+
+// AnomalyConfig configures the rules of the AnomalyDetector. A rule is disabled by its zero value.
+type AnomalyConfig struct {
+	// Deposits of at least LargeDeposit are alerted. Deposit values of all coin types have 8 decimal places.
+	LargeDeposit int64
+	// More than RepeatedDeposits deposits credited to the same skycoin address within RepeatedDepositsWindow are alerted
+	RepeatedDeposits       int
+	RepeatedDepositsWindow time.Duration
+	// More than BindSpikeFactor times the average number of binds per BindSpikeWindow during the preceding
+	// BindSpikeBaseline, and at least BindSpikeMin binds, within BindSpikeWindow are alerted
+	BindSpikeFactor   float64
+	BindSpikeMin      int
+	BindSpikeWindow   time.Duration
+	BindSpikeBaseline time.Duration
+}
+
+// AnomalyDetector is a rules engine that alerts unusual deposits and binds: large deposits,
+// many deposits credited to the same skycoin address, and spikes of the bind rate.
+// It is told of the binds and deposits by the exchange.
+type AnomalyDetector struct {
+	notifier *Notifier
+	cfg      AnomalyConfig
+	binds    []time.Time
+	// Times of the recent deposits of each skycoin address
+	deposits map[string][]time.Time
+	// Deposits already observed, so that a deposit received again is not counted twice
+	seen      map[string]time.Time
+	lastSweep time.Time
+	lock      sync.Mutex
+}
+
+// seenTTL is how long observed deposit IDs are remembered
+const seenTTL = time.Hour * 24
+
+// NewAnomalyDetector creates an AnomalyDetector
+func NewAnomalyDetector(n *Notifier, cfg AnomalyConfig) *AnomalyDetector {
+	return &AnomalyDetector{
+		notifier: n,
+		cfg:      cfg,
+		deposits: make(map[string][]time.Time),
+		seen:     make(map[string]time.Time),
+	}
+}
+
+// ObserveBind is called when a deposit address is bound
+func (d *AnomalyDetector) ObserveBind(coinType string) {
+	d.addBind(time.Now())
+}
+
+// ObserveDeposit is called when a deposit is received
+func (d *AnomalyDetector) ObserveDeposit(depositID, coinType, skyAddr string, value int64) {
+	d.addDeposit(time.Now(), depositID, coinType, skyAddr, value)
+}
+
+// addBind records a bind at t, and alerts EventBindSpike if the binds within the window spike
+func (d *AnomalyDetector) addBind(t time.Time) {
+	if d.cfg.BindSpikeFactor <= 0 {
+		return
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	windowStart := t.Add(-d.cfg.BindSpikeWindow)
+	baselineStart := windowStart.Add(-d.cfg.BindSpikeBaseline)
+
+	// Drop the binds that fell out of the baseline
+	i := 0
+	for i < len(d.binds) && !d.binds[i].After(baselineStart) {
+		i++
+	}
+	d.binds = append(d.binds[i:], t)
+
+	recent := 0
+	for _, b := range d.binds {
+		if b.After(windowStart) {
+			recent++
+		}
+	}
+
+	if recent < d.cfg.BindSpikeMin {
+		return
+	}
+
+	baseline := len(d.binds) - recent
+	average := float64(baseline) * float64(d.cfg.BindSpikeWindow) / float64(d.cfg.BindSpikeBaseline)
+	if float64(recent) <= d.cfg.BindSpikeFactor*average {
+		return
+	}
+
+	d.notifier.Notify(EventBindSpike, fmt.Sprintf("%d addresses were bound within %s, the average of the last %s is %.1f",
+		recent, d.cfg.BindSpikeWindow, d.cfg.BindSpikeBaseline, average))
+}
+
+// addDeposit records a deposit received at t, and alerts EventLargeDeposit and EventRepeatedDeposits
+func (d *AnomalyDetector) addDeposit(t time.Time, depositID, coinType, skyAddr string, value int64) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.sweep(t)
+
+	if _, ok := d.seen[depositID]; ok {
+		return
+	}
+	d.seen[depositID] = t
+
+	if d.cfg.LargeDeposit > 0 && value >= d.cfg.LargeDeposit {
+		d.notifier.NotifyKey(EventLargeDeposit, depositID, fmt.Sprintf("Deposit %s of %s %s to %s is at least %s",
+			depositID, qrutil.FormatAmount(value), coinType, skyAddr, qrutil.FormatAmount(d.cfg.LargeDeposit)))
+	}
+
+	if d.cfg.RepeatedDeposits <= 0 {
+		return
+	}
+
+	windowStart := t.Add(-d.cfg.RepeatedDepositsWindow)
+	times := d.deposits[skyAddr]
+	i := 0
+	for i < len(times) && !times[i].After(windowStart) {
+		i++
+	}
+	times = append(times[i:], t)
+	d.deposits[skyAddr] = times
+
+	if len(times) > d.cfg.RepeatedDeposits {
+		d.notifier.NotifyKey(EventRepeatedDeposits, skyAddr, fmt.Sprintf("%d deposits were credited to %s within %s, the last is %s of %s %s",
+			len(times), skyAddr, d.cfg.RepeatedDepositsWindow, depositID, qrutil.FormatAmount(value), coinType))
+	}
+}
+
+// sweep forgets the deposits that can't be counted anymore, at most once per minute
+func (d *AnomalyDetector) sweep(t time.Time) {
+	if t.Sub(d.lastSweep) < time.Minute {
+		return
+	}
+	d.lastSweep = t
+
+	for id, seenAt := range d.seen {
+		if t.Sub(seenAt) >= seenTTL {
+			delete(d.seen, id)
+		}
+	}
+
+	for skyAddr, times := range d.deposits {
+		if t.Sub(times[len(times)-1]) >= d.cfg.RepeatedDepositsWindow {
+			delete(d.deposits, skyAddr)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package alert
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+func TestAnomalyDetectorDeposits(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+
+	n := NewNotifier(log, Config{
+		Cooldown: time.Hour,
+	})
+
+	s := &dummySink{name: "sink"}
+	n.AddSink(s, SeverityInfo)
+
+	go n.Run() // nolint: errcheck
+	defer n.Shutdown()
+
+	d := NewAnomalyDetector(n, AnomalyConfig{
+		LargeDeposit:           1e8,
+		RepeatedDeposits:       2,
+		RepeatedDepositsWindow: time.Hour,
+	})
+
+	now := time.Now()
+	d.addDeposit(now, "tx1:0", "BTC", "s1", 99999999)
+	d.addDeposit(now, "tx2:0", "BTC", "s2", 1e8)
+
+	alerts := waitAlerts(t, s, 1)
+	require.Equal(t, EventLargeDeposit, alerts[0].Event)
+	require.Equal(t, "Deposit tx2:0 of 1 BTC to s2 is at least 1", alerts[0].Message)
+
+	// Each large deposit is alerted, but a deposit received again is not
+	d.addDeposit(now, "tx2:0", "BTC", "s2", 1e8)
+	d.addDeposit(now, "tx3:0", "LTC", "s3", 25e7)
+
+	alerts = waitAlerts(t, s, 2)
+	require.Equal(t, "Deposit tx3:0 of 2.5 LTC to s3 is at least 1", alerts[1].Message)
+
+	time.Sleep(time.Millisecond * 50)
+	require.Len(t, s.received(), 2)
+
+	// Deposits credited to s1 outside of the window are not counted
+	d.addDeposit(now.Add(time.Hour), "tx4:0", "BTC", "s1", 1000)
+	d.addDeposit(now.Add(time.Hour+time.Minute), "tx5:0", "BTC", "s1", 1000)
+
+	time.Sleep(time.Millisecond * 50)
+	require.Len(t, s.received(), 2)
+
+	d.addDeposit(now.Add(time.Hour+time.Minute*2), "tx6:0", "LTC", "s1", 2000)
+
+	alerts = waitAlerts(t, s, 3)
+	require.Equal(t, EventRepeatedDeposits, alerts[2].Event)
+	require.Equal(t, "3 deposits were credited to s1 within 1h0m0s, the last is tx6:0 of 0.00002 LTC", alerts[2].Message)
+
+	// The sweep forgets the deposits outside of the window
+	d.addDeposit(now.Add(time.Hour*3), "tx7:0", "BTC", "s4", 1000)
+	require.Equal(t, map[string][]time.Time{
+		"s4": {now.Add(time.Hour * 3)},
+	}, d.deposits)
+}
+
+func TestAnomalyDetectorBindSpike(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+
+	n := NewNotifier(log, Config{
+		Cooldown: time.Millisecond,
+	})
+
+	s := &dummySink{name: "sink"}
+	n.AddSink(s, SeverityInfo)
+
+	go n.Run() // nolint: errcheck
+	defer n.Shutdown()
+
+	d := NewAnomalyDetector(n, AnomalyConfig{
+		BindSpikeFactor:   3,
+		BindSpikeMin:      4,
+		BindSpikeWindow:   time.Minute * 10,
+		BindSpikeBaseline: time.Hour,
+	})
+
+	// 12 binds in the hour before are 2 per 10 minutes
+	start := time.Now().Add(-time.Hour * 2)
+	for i := 0; i < 12; i++ {
+		d.addBind(start.Add(time.Minute * 5 * time.Duration(i)))
+	}
+
+	// 6 binds in 10 minutes are not more than 3 times the average
+	now := start.Add(time.Hour + time.Minute*5)
+	for i := 0; i < 6; i++ {
+		d.addBind(now.Add(time.Second * time.Duration(i)))
+	}
+
+	time.Sleep(time.Millisecond * 50)
+	require.Empty(t, s.received())
+
+	d.addBind(now.Add(time.Minute))
+
+	alerts := waitAlerts(t, s, 1)
+	require.Equal(t, EventBindSpike, alerts[0].Event)
+	require.Equal(t, "7 addresses were bound within 10m0s, the average of the last 1h0m0s is 2.0", alerts[0].Message)
+
+	// Binds that fell out of the baseline are dropped
+	d.addBind(now.Add(time.Hour * 3))
+	require.Len(t, d.binds, 1)
+}
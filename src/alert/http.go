@@ -0,0 +1,75 @@
+package alert
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// HTTPErrorCounter counts the 5xx responses of HTTP handlers, and alerts EventHTTPErrors
+// when there are at least threshold of them within window
+type HTTPErrorCounter struct {
+	notifier  *Notifier
+	threshold int
+	window    time.Duration
+	errors    []time.Time
+	lock      sync.Mutex
+}
+
+// NewHTTPErrorCounter creates an HTTPErrorCounter
+func NewHTTPErrorCounter(n *Notifier, threshold int, window time.Duration) *HTTPErrorCounter {
+	return &HTTPErrorCounter{
+		notifier:  n,
+		threshold: threshold,
+		window:    window,
+	}
+}
+
+// Handler wraps h, counting its 5xx responses
+func (c *HTTPErrorCounter) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sw := &statusResponseWriter{
+			ResponseWriter: w,
+			statusCode:     http.StatusOK,
+		}
+
+		h.ServeHTTP(sw, r)
+
+		if sw.statusCode >= 500 {
+			c.add(time.Now())
+		}
+	})
+}
+
+// add records an error at t, and alerts once the threshold is reached.
+// The errors are then forgotten, so that the next alert needs as many new errors.
+func (c *HTTPErrorCounter) add(t time.Time) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	// Drop the errors that fell out of the window
+	i := 0
+	for i < len(c.errors) && t.Sub(c.errors[i]) >= c.window {
+		i++
+	}
+	c.errors = append(c.errors[i:], t)
+
+	if len(c.errors) < c.threshold {
+		return
+	}
+
+	c.notifier.Notify(EventHTTPErrors, fmt.Sprintf("API responded with %d server errors within %s", len(c.errors), c.window))
+	c.errors = nil
+}
+
+// Captures the response status of a http handler
+type statusResponseWriter struct {
+	http.ResponseWriter
+	statusCode int
+}
+
+func (w *statusResponseWriter) WriteHeader(code int) {
+	w.statusCode = code
+	w.ResponseWriter.WriteHeader(code)
+}
@@ -0,0 +1,124 @@
+package alert
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Sink types of the built-in sinks
+const (
+	SinkTypeLog      = "log"
+	SinkTypeWebhook  = "webhook"
+	SinkTypeSMTP     = "smtp"
+	SinkTypeSlack    = "slack"
+	SinkTypeTelegram = "telegram"
+)
+
+// SinkConfig configures a sink created by NewSink. Each sink type uses the fields it needs,
+// a sink type registered by a plugin can use any of them.
+type SinkConfig struct {
+	// URL of a webhook or of a Slack incoming webhook
+	URL string
+	// Secret that webhook requests are signed with
+	Secret string
+	// SMTP server, sender and recipients of email
+	SMTP SMTPConfig
+	// Telegram bot and chat
+	BotToken string
+	ChatID   string
+	// Logger of the log sink, the standard logger if nil
+	Log logrus.FieldLogger
+}
+
+// SinkFactory creates a sink from its config. It must not connect to anything, it is also called to validate the config.
+type SinkFactory func(SinkConfig) (Sink, error)
+
+var (
+	sinkFactories     = make(map[string]SinkFactory)
+	sinkFactoriesLock sync.RWMutex
+)
+
+func init() {
+	RegisterSink(SinkTypeLog, func(c SinkConfig) (Sink, error) {
+		return NewLogSink(c.Log), nil
+	})
+
+	RegisterSink(SinkTypeWebhook, func(c SinkConfig) (Sink, error) {
+		s, err := NewWebhookSink(c.URL, c.Secret)
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	})
+
+	RegisterSink(SinkTypeSMTP, func(c SinkConfig) (Sink, error) {
+		s, err := NewSMTPSink(c.SMTP)
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	})
+
+	RegisterSink(SinkTypeSlack, func(c SinkConfig) (Sink, error) {
+		s, err := NewSlackSink(c.URL)
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	})
+
+	RegisterSink(SinkTypeTelegram, func(c SinkConfig) (Sink, error) {
+		s, err := NewTelegramSink(c.BotToken, c.ChatID)
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	})
+}
+
+// RegisterSink registers the factory of a sink type, so that sinks of the type can be configured
+// in alerts.sinks. Plugins call it from an init function. It panics if the type is already registered.
+func RegisterSink(typ string, f SinkFactory) {
+	sinkFactoriesLock.Lock()
+	defer sinkFactoriesLock.Unlock()
+
+	if typ == "" || f == nil {
+		panic("alert.RegisterSink: type and factory must be set")
+	}
+
+	if _, ok := sinkFactories[typ]; ok {
+		panic(fmt.Sprintf("alert.RegisterSink: sink type %q registered twice", typ))
+	}
+
+	sinkFactories[typ] = f
+}
+
+// NewSink creates a sink of a registered type
+func NewSink(typ string, cfg SinkConfig) (Sink, error) {
+	sinkFactoriesLock.RLock()
+	f, ok := sinkFactories[typ]
+	sinkFactoriesLock.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown sink type %q", typ)
+	}
+
+	return f(cfg)
+}
+
+// SinkTypes returns the registered sink types, sorted
+func SinkTypes() []string {
+	sinkFactoriesLock.RLock()
+	defer sinkFactoriesLock.RUnlock()
+
+	types := make([]string, 0, len(sinkFactories))
+	for t := range sinkFactories {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+
+	return types
+}
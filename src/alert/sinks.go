@@ -0,0 +1,356 @@
+package alert
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/skycoin/teller/src/outbox"
+)
+
+const (
+	sinkTimeout = time.Second * 10
+
+	telegramAPIURL = "https://api.telegram.org"
+)
+
+// SMTPConfig configures an SMTPSink
+type SMTPConfig struct {
+	Addr     string // host:port of the SMTP server
+	Username string // PLAIN auth is used if set
+	Password string
+	From     string
+	To       []string
+}
+
+// SMTPSink emails alerts
+type SMTPSink struct {
+	cfg      SMTPConfig
+	auth     smtp.Auth
+	sendMail func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+// NewSMTPSink creates an SMTPSink
+func NewSMTPSink(cfg SMTPConfig) (*SMTPSink, error) {
+	host, _, err := net.SplitHostPort(cfg.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("smtp addr invalid: %v", err)
+	}
+
+	if cfg.From == "" {
+		return nil, errors.New("smtp from is empty")
+	}
+
+	if len(cfg.To) == 0 {
+		return nil, errors.New("smtp to is empty")
+	}
+
+	var auth smtp.Auth
+	if cfg.Username != "" {
+		auth = smtp.PlainAuth("", cfg.Username, cfg.Password, host)
+	}
+
+	return &SMTPSink{
+		cfg:      cfg,
+		auth:     auth,
+		sendMail: smtp.SendMail,
+	}, nil
+}
+
+// Name returns "smtp"
+func (s *SMTPSink) Name() string {
+	return "smtp"
+}
+
+// Send emails the alert to the recipients
+func (s *SMTPSink) Send(a Alert) error {
+	return s.email(s.cfg.To, a.Subject(), a.Text(), nil, a.Time)
+}
+
+// Email emails a plain text message to the recipients
+func (s *SMTPSink) Email(subject, body string) error {
+	return s.email(s.cfg.To, subject, body, nil, time.Now())
+}
+
+// EmailTo emails a plain text message to another recipient than those of the sink, e.g. a user,
+// with extra header fields
+func (s *SMTPSink) EmailTo(to, subject, body string, header map[string]string) error {
+	return s.email([]string{to}, subject, body, header, time.Now())
+}
+
+func (s *SMTPSink) email(to []string, subject, body string, header map[string]string, t time.Time) error {
+	// Header values can come from templates, a line break would start another header field
+	oneLine := strings.NewReplacer("\r", " ", "\n", " ")
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", s.cfg.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", oneLine.Replace(subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", t.Format(time.RFC1123Z))
+
+	keys := make([]string, 0, len(header))
+	for k := range header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(&msg, "%s: %s\r\n", k, oneLine.Replace(header[k]))
+	}
+
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(strings.Replace(body, "\n", "\r\n", -1))
+	msg.WriteString("\r\n")
+
+	return s.sendMail(s.cfg.Addr, s.auth, s.cfg.From, to, msg.Bytes())
+}
+
+// SlackSink posts alerts to a Slack incoming webhook
+type SlackSink struct {
+	url    string
+	client *http.Client
+}
+
+// NewSlackSink creates a SlackSink
+func NewSlackSink(webhookURL string) (*SlackSink, error) {
+	if webhookURL == "" {
+		return nil, errors.New("slack webhook url is empty")
+	}
+
+	return &SlackSink{
+		url: webhookURL,
+		client: &http.Client{
+			Timeout: sinkTimeout,
+		},
+	}, nil
+}
+
+// Name returns "slack"
+func (s *SlackSink) Name() string {
+	return "slack"
+}
+
+// Send posts the alert to the webhook
+func (s *SlackSink) Send(a Alert) error {
+	return postJSON(s.client, s.url, struct {
+		Text string `json:"text"`
+	}{
+		Text: a.Text(),
+	})
+}
+
+// TelegramSink sends alerts to a Telegram chat through a bot
+type TelegramSink struct {
+	apiURL string
+	token  string
+	chatID string
+	client *http.Client
+}
+
+// NewTelegramSink creates a TelegramSink. The bot must be a member of the chat.
+func NewTelegramSink(botToken, chatID string) (*TelegramSink, error) {
+	if botToken == "" {
+		return nil, errors.New("telegram bot token is empty")
+	}
+
+	if chatID == "" {
+		return nil, errors.New("telegram chat id is empty")
+	}
+
+	return &TelegramSink{
+		apiURL: telegramAPIURL,
+		token:  botToken,
+		chatID: chatID,
+		client: &http.Client{
+			Timeout: sinkTimeout,
+		},
+	}, nil
+}
+
+// Name returns "telegram"
+func (s *TelegramSink) Name() string {
+	return "telegram"
+}
+
+// Send sends the alert to the chat
+func (s *TelegramSink) Send(a Alert) error {
+	return postJSON(s.client, fmt.Sprintf("%s/bot%s/sendMessage", s.apiURL, s.token), struct {
+		ChatID string `json:"chat_id"`
+		Text   string `json:"text"`
+	}{
+		ChatID: s.chatID,
+		Text:   a.Text(),
+	})
+}
+
+// LogSink writes alerts to the log, at the level of their severity
+type LogSink struct {
+	log logrus.FieldLogger
+}
+
+// NewLogSink creates a LogSink. If log is nil, the standard logger is used.
+func NewLogSink(log logrus.FieldLogger) *LogSink {
+	if log == nil {
+		log = logrus.StandardLogger()
+	}
+
+	return &LogSink{
+		log: log.WithField("prefix", "alert.log"),
+	}
+}
+
+// Name returns "log"
+func (s *LogSink) Name() string {
+	return SinkTypeLog
+}
+
+// Send logs the alert
+func (s *LogSink) Send(a Alert) error {
+	log := s.log.WithFields(logrus.Fields{
+		"event":    a.Event,
+		"severity": a.Severity.String(),
+		"subject":  a.Subject(),
+	})
+
+	switch a.Severity {
+	case SeverityCritical:
+		log.Error(a.Text())
+	case SeverityWarning:
+		log.Warn(a.Text())
+	default:
+		log.Info(a.Text())
+	}
+
+	return nil
+}
+
+// webhookAlert is the body of the requests of the WebhookSink
+type webhookAlert struct {
+	Event    string `json:"event"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+	Time     int64  `json:"time"`
+	Subject  string `json:"subject"`
+	Text     string `json:"text"`
+}
+
+// WebhookSink POSTs alerts as JSON to a URL. If it has a secret, requests are signed
+// like those of the deposit status webhook.
+type WebhookSink struct {
+	url    string
+	secret string
+	client *http.Client
+}
+
+// NewWebhookSink creates a WebhookSink
+func NewWebhookSink(webhookURL, secret string) (*WebhookSink, error) {
+	if webhookURL == "" {
+		return nil, errors.New("webhook url is empty")
+	}
+
+	// The URL can contain a secret, so it is left out of the errors
+	u, err := url.Parse(webhookURL)
+	if err != nil {
+		return nil, errors.New("webhook url invalid")
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, errors.New("webhook url must be an http or https URL")
+	}
+
+	return &WebhookSink{
+		url:    webhookURL,
+		secret: secret,
+		client: &http.Client{
+			Timeout: sinkTimeout,
+		},
+	}, nil
+}
+
+// Name returns "webhook"
+func (s *WebhookSink) Name() string {
+	return SinkTypeWebhook
+}
+
+// Send POSTs the alert to the webhook
+func (s *WebhookSink) Send(a Alert) error {
+	body, err := json.Marshal(webhookAlert{
+		Event:    a.Event,
+		Severity: a.Severity.String(),
+		Message:  a.Message,
+		Time:     a.Time.UTC().Unix(),
+		Subject:  a.Subject(),
+		Text:     a.Text(),
+	})
+	if err != nil {
+		return err
+	}
+
+	header := make(http.Header)
+	header.Set(outbox.EventTopicHeader, "alert."+a.Event)
+	if s.secret != "" {
+		header.Set(outbox.SignatureHeader, outbox.Sign(s.secret, body))
+	}
+
+	return post(s.client, s.url, body, header)
+}
+
+// postJSON POSTs v as JSON to target. Any response status other than 2xx is a failure.
+func postJSON(client *http.Client, target string, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return post(client, target, body, nil)
+}
+
+// post POSTs a JSON body to target, with the extra header. Any response status other than 2xx is a failure.
+func post(client *http.Client, target string, body []byte, header http.Header) error {
+	req, err := http.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		// The URL contains a secret, the webhook path or the bot token, so it is left out of the error
+		if uerr, ok := err.(*url.Error); ok {
+			return uerr.Err
+		}
+		return errors.New("invalid request")
+	}
+
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	rsp, err := client.Do(req)
+	if err != nil {
+		// The URL contains a secret, the webhook path or the bot token, so it is left out of the error
+		if uerr, ok := err.(*url.Error); ok {
+			return uerr.Err
+		}
+		return err
+	}
+	defer rsp.Body.Close()
+
+	// Drain the body so that the connection can be reused
+	if _, err := io.Copy(ioutil.Discard, io.LimitReader(rsp.Body, 1<<16)); err != nil {
+		return err
+	}
+
+	if rsp.StatusCode < 200 || rsp.StatusCode > 299 {
+		return fmt.Errorf("responded with status %d", rsp.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,239 @@
+package alert
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/outbox"
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+var testAlert = Alert{
+	Event:    EventWalletBalanceLow,
+	Severity: SeverityCritical,
+	Message:  "Hot wallet balance is 10 SKY",
+	Time:     time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC),
+}
+
+func TestSMTPSink(t *testing.T) {
+	_, err := NewSMTPSink(SMTPConfig{
+		Addr: "smtp.example.com",
+		From: "teller@example.com",
+		To:   []string{"ops@example.com"},
+	})
+	require.Error(t, err)
+
+	_, err = NewSMTPSink(SMTPConfig{
+		Addr: "smtp.example.com:587",
+		To:   []string{"ops@example.com"},
+	})
+	require.Error(t, err)
+
+	_, err = NewSMTPSink(SMTPConfig{
+		Addr: "smtp.example.com:587",
+		From: "teller@example.com",
+	})
+	require.Error(t, err)
+
+	s, err := NewSMTPSink(SMTPConfig{
+		Addr:     "smtp.example.com:587",
+		Username: "user",
+		Password: "pass",
+		From:     "teller@example.com",
+		To:       []string{"ops@example.com", "dev@example.com"},
+	})
+	require.NoError(t, err)
+	require.NotNil(t, s.auth)
+
+	var sentAddr, sentFrom string
+	var sentTo []string
+	var sentMsg []byte
+	s.sendMail = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		sentAddr = addr
+		sentFrom = from
+		sentTo = to
+		sentMsg = msg
+		return nil
+	}
+
+	require.NoError(t, s.Send(testAlert))
+	require.Equal(t, "smtp.example.com:587", sentAddr)
+	require.Equal(t, "teller@example.com", sentFrom)
+	require.Equal(t, []string{"ops@example.com", "dev@example.com"}, sentTo)
+
+	msg := string(sentMsg)
+	require.True(t, strings.Contains(msg, "To: ops@example.com, dev@example.com\r\n"), msg)
+	require.True(t, strings.Contains(msg, "Subject: [CRITICAL] teller wallet_balance_low\r\n"), msg)
+	require.True(t, strings.Contains(msg, "\r\n\r\n[CRITICAL] teller wallet_balance_low\r\nHot wallet balance is 10 SKY\r\n2018-01-02T03:04:05Z\r\n"), msg)
+
+	require.NoError(t, s.Email("teller reconciliation report 2018-01-02", "Sent: 1 SKY\ndeposit_id\n"))
+	msg = string(sentMsg)
+	require.True(t, strings.Contains(msg, "Subject: teller reconciliation report 2018-01-02\r\n"), msg)
+	require.True(t, strings.HasSuffix(msg, "\r\n\r\nSent: 1 SKY\r\ndeposit_id\r\n\r\n"), msg)
+
+	// EmailTo emails another recipient, with the extra header fields on one line each
+	require.NoError(t, s.EmailTo("user@example.com", "Deposit\r\nBcc: x@example.com", "Done\n", map[string]string{
+		"List-Unsubscribe": "<https://teller.example.com/unsubscribe>",
+	}))
+	require.Equal(t, []string{"user@example.com"}, sentTo)
+	msg = string(sentMsg)
+	require.True(t, strings.Contains(msg, "To: user@example.com\r\n"), msg)
+	require.True(t, strings.Contains(msg, "Subject: Deposit  Bcc: x@example.com\r\n"), msg)
+	require.True(t, strings.Contains(msg, "List-Unsubscribe: <https://teller.example.com/unsubscribe>\r\n"), msg)
+	require.True(t, strings.HasSuffix(msg, "\r\n\r\nDone\r\n\r\n"), msg)
+
+	// Without a username, no auth is used
+	s, err = NewSMTPSink(SMTPConfig{
+		Addr: "localhost:25",
+		From: "teller@example.com",
+		To:   []string{"ops@example.com"},
+	})
+	require.NoError(t, err)
+	require.Nil(t, s.auth)
+}
+
+func TestSlackSink(t *testing.T) {
+	status := http.StatusOK
+	var received map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPost, r.Method)
+		require.Equal(t, "/services/T0/B0/secret", r.URL.Path)
+		require.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	_, err := NewSlackSink("")
+	require.Error(t, err)
+
+	s, err := NewSlackSink(srv.URL + "/services/T0/B0/secret")
+	require.NoError(t, err)
+
+	require.NoError(t, s.Send(testAlert))
+	require.Equal(t, map[string]string{
+		"text": "[CRITICAL] teller wallet_balance_low\nHot wallet balance is 10 SKY\n2018-01-02T03:04:05Z",
+	}, received)
+
+	status = http.StatusInternalServerError
+	err = s.Send(testAlert)
+	require.Error(t, err)
+	require.Equal(t, "responded with status 500", err.Error())
+}
+
+func TestTelegramSink(t *testing.T) {
+	status := http.StatusOK
+	var received map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPost, r.Method)
+		require.Equal(t, "/bot123:token/sendMessage", r.URL.Path)
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	_, err := NewTelegramSink("", "-100")
+	require.Error(t, err)
+
+	_, err = NewTelegramSink("123:token", "")
+	require.Error(t, err)
+
+	s, err := NewTelegramSink("123:token", "-100")
+	require.NoError(t, err)
+	s.apiURL = srv.URL
+
+	require.NoError(t, s.Send(testAlert))
+	require.Equal(t, map[string]string{
+		"chat_id": "-100",
+		"text":    "[CRITICAL] teller wallet_balance_low\nHot wallet balance is 10 SKY\n2018-01-02T03:04:05Z",
+	}, received)
+
+	status = http.StatusForbidden
+	require.Error(t, s.Send(testAlert))
+
+	// Connection errors don't leak the bot token
+	srv.Close()
+	err = s.Send(testAlert)
+	require.Error(t, err)
+	require.False(t, strings.Contains(err.Error(), "token"), err.Error())
+}
+
+func TestLogSink(t *testing.T) {
+	log, hook := testutil.NewLogger(t)
+
+	s := NewLogSink(log)
+	require.NoError(t, s.Send(testAlert))
+
+	entry := hook.LastEntry()
+	require.NotNil(t, entry)
+	require.Equal(t, logrus.ErrorLevel, entry.Level)
+	require.Equal(t, testAlert.Text(), entry.Message)
+	require.Equal(t, EventWalletBalanceLow, entry.Data["event"])
+
+	a := testAlert
+	a.Severity = SeverityInfo
+	require.NoError(t, s.Send(a))
+	require.Equal(t, logrus.InfoLevel, hook.LastEntry().Level)
+}
+
+func TestWebhookSink(t *testing.T) {
+	status := http.StatusOK
+	var received webhookAlert
+	var header http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPost, r.Method)
+
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(body, &received))
+
+		header = r.Header
+		if r.Header.Get(outbox.SignatureHeader) != "" {
+			require.Equal(t, outbox.Sign("secret", body), r.Header.Get(outbox.SignatureHeader))
+		}
+
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	for _, u := range []string{"", "ftp://example.com", "://"} {
+		_, err := NewWebhookSink(u, "")
+		require.Error(t, err, u)
+	}
+
+	s, err := NewWebhookSink(srv.URL, "secret")
+	require.NoError(t, err)
+
+	require.NoError(t, s.Send(testAlert))
+	require.Equal(t, webhookAlert{
+		Event:    EventWalletBalanceLow,
+		Severity: "critical",
+		Message:  "Hot wallet balance is 10 SKY",
+		Time:     testAlert.Time.Unix(),
+		Subject:  "[CRITICAL] teller wallet_balance_low",
+		Text:     testAlert.Text(),
+	}, received)
+	require.Equal(t, "application/json", header.Get("Content-Type"))
+	require.Equal(t, "alert.wallet_balance_low", header.Get(outbox.EventTopicHeader))
+	require.NotEmpty(t, header.Get(outbox.SignatureHeader))
+
+	status = http.StatusBadGateway
+	require.Error(t, s.Send(testAlert))
+
+	// Without a secret, requests are not signed
+	s, err = NewWebhookSink(srv.URL, "")
+	require.NoError(t, err)
+
+	status = http.StatusNoContent
+	require.NoError(t, s.Send(testAlert))
+	require.Empty(t, header.Get(outbox.SignatureHeader))
+}
@@ -0,0 +1,89 @@
+package alert
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+	"time"
+)
+
+// TemplateData is the data that message templates are executed with
+type TemplateData struct {
+	Event    string
+	Severity string
+	Message  string
+	Time     time.Time
+	// Subject and Text of the default format
+	Subject string
+	Text    string
+}
+
+// Template formats the subject and the text of alerts with text/template, e.g.
+// "{{.Severity}}: {{.Message}} at {{.Time.Format \"15:04\"}}"
+type Template struct {
+	subject *template.Template
+	text    *template.Template
+}
+
+// NewTemplate parses the templates of the subject and of the text. Either can be empty to keep the default format.
+func NewTemplate(subject, text string) (*Template, error) {
+	var t Template
+
+	if subject != "" {
+		var err error
+		t.subject, err = template.New("subject").Option("missingkey=error").Parse(subject)
+		if err != nil {
+			return nil, fmt.Errorf("subject template invalid: %v", err)
+		}
+	}
+
+	if text != "" {
+		var err error
+		t.text, err = template.New("text").Option("missingkey=error").Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("text template invalid: %v", err)
+		}
+	}
+
+	// Unknown fields only fail when the template is executed
+	if _, err := t.Apply(Alert{
+		Event:    EventSendFailed,
+		Severity: SeverityCritical,
+		Message:  "test",
+		Time:     time.Now(),
+	}); err != nil {
+		return nil, fmt.Errorf("template invalid: %v", err)
+	}
+
+	return &t, nil
+}
+
+// Apply returns the alert with its subject and text formatted by the templates
+func (t *Template) Apply(a Alert) (Alert, error) {
+	data := TemplateData{
+		Event:    a.Event,
+		Severity: a.Severity.String(),
+		Message:  a.Message,
+		Time:     a.Time.UTC(),
+		Subject:  a.Subject(),
+		Text:     a.Text(),
+	}
+
+	if t.subject != nil {
+		var b bytes.Buffer
+		if err := t.subject.Execute(&b, data); err != nil {
+			return a, err
+		}
+		a.subject = b.String()
+	}
+
+	if t.text != nil {
+		var b bytes.Buffer
+		if err := t.text.Execute(&b, data); err != nil {
+			return a, err
+		}
+		a.text = b.String()
+	}
+
+	return a, nil
+}
@@ -0,0 +1,317 @@
+// Package apikey manages the API keys of trusted integrators. Integrators sign their API requests
+// with the secret of their key, and signed requests are exempt from the public rate limits.
+package apikey
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/skycoin/teller/src/util/dbcrypt"
+	"github.com/skycoin/teller/src/util/dbutil"
+)
+
+// API keys with their secrets, key ID as key. The secrets are needed to verify signatures,
+// so they are stored as they are, or encrypted if encryption is enabled.
+var apiKeysBkt = []byte("api_keys")
+
+// Headers of a signed request
+const (
+	KeyHeader       = "X-API-Key"
+	TimestampHeader = "X-API-Timestamp"
+	SignatureHeader = "X-API-Signature"
+)
+
+var (
+	// ErrInvalidKey is returned if a key does not exist
+	ErrInvalidKey = errors.New("Invalid API key")
+	// ErrKeyRevoked is returned if a key has been revoked
+	ErrKeyRevoked = errors.New("API key revoked")
+	// ErrInvalidSignature is returned if the signature of a request doesn't match
+	ErrInvalidSignature = errors.New("Invalid request signature")
+	// ErrInvalidTimestamp is returned if the timestamp of a request is invalid or too far from the current time
+	ErrInvalidTimestamp = errors.New("Invalid request timestamp")
+	// ErrKeyNotFound is returned when revoking a key ID that does not exist
+	ErrKeyNotFound = errors.New("API key not found")
+	// ErrMissingName is returned by Create if the key has no name
+	ErrMissingName = errors.New("Missing name")
+)
+
+// Key is an API key of an integrator. The secret is only returned by Create.
+type Key struct {
+	ID string `json:"id"`
+	// Who the key was issued to
+	Name string `json:"name"`
+	// Maximum number of deposit addresses a skycoin address can bind with signed requests, 0 for no limit
+	MaxBoundAddresses int   `json:"max_bound_addrs"`
+	CreatedAt         int64 `json:"created_at"`
+	RevokedAt         int64 `json:"revoked_at,omitempty"`
+}
+
+// storedKey is a Key with its secret, as it is stored in the db.
+// The secret is hex encoded ciphertext if encryption is enabled.
+type storedKey struct {
+	Key
+	Secret string `json:"secret"`
+}
+
+// Config configures a Store
+type Config struct {
+	// Maximum difference between the timestamp of a signed request and the current time
+	MaxClockSkew time.Duration
+	// MaxBoundAddresses of keys created without one
+	DefaultMaxBoundAddresses int
+	// Cipher encrypts the secrets of the keys, nil to store them as they are
+	Cipher *dbcrypt.Cipher
+}
+
+// Store creates, revokes and verifies API keys
+type Store struct {
+	db  *bolt.DB
+	cfg Config
+	now func() time.Time
+}
+
+// NewStore creates a Store
+func NewStore(db *bolt.DB, cfg Config) (*Store, error) {
+	if db == nil {
+		return nil, errors.New("new apikey Store failed, db is nil")
+	}
+
+	if err := db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(apiKeysBkt); err != nil {
+			return dbutil.NewCreateBucketFailedErr(apiKeysBkt, err)
+		}
+
+		return cfg.Cipher.MigrateTx(tx, apiKeysBkt, func(k, v []byte) ([]byte, []byte, error) {
+			var sk storedKey
+			if err := json.Unmarshal(v, &sk); err != nil {
+				return nil, nil, fmt.Errorf("decode API key failed: %v", err)
+			}
+
+			secret, err := encryptSecret(cfg.Cipher, sk.Secret)
+			if err != nil {
+				return nil, nil, err
+			}
+			sk.Secret = secret
+
+			v, err = json.Marshal(sk)
+			return k, v, err
+		})
+	}); err != nil {
+		return nil, err
+	}
+
+	return &Store{
+		db:  db,
+		cfg: cfg,
+		now: time.Now,
+	}, nil
+}
+
+// encryptSecret returns the secret as it is stored in the db
+func encryptSecret(c *dbcrypt.Cipher, secret string) (string, error) {
+	if c == nil {
+		return secret, nil
+	}
+
+	b, err := c.Encrypt([]byte(secret))
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// decryptSecret returns the secret of a key stored in the db
+func decryptSecret(c *dbcrypt.Cipher, secret string) (string, error) {
+	if c == nil {
+		return secret, nil
+	}
+
+	b, err := hex.DecodeString(secret)
+	if err != nil {
+		return "", dbcrypt.ErrDecrypt
+	}
+
+	b, err = c.Decrypt(b)
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Create creates a key issued to name. If maxBound is negative, the key gets the default MaxBoundAddresses.
+// It returns the secret, which can't be recovered later, and the key.
+func (s *Store) Create(name string, maxBound int) (string, Key, error) {
+	if name == "" {
+		return "", Key{}, ErrMissingName
+	}
+
+	if maxBound < 0 {
+		maxBound = s.cfg.DefaultMaxBoundAddresses
+	}
+
+	id, err := randomHex(16)
+	if err != nil {
+		return "", Key{}, err
+	}
+
+	secret, err := randomHex(32)
+	if err != nil {
+		return "", Key{}, err
+	}
+
+	stored, err := encryptSecret(s.cfg.Cipher, secret)
+	if err != nil {
+		return "", Key{}, err
+	}
+
+	k := storedKey{
+		Key: Key{
+			ID:                id,
+			Name:              name,
+			MaxBoundAddresses: maxBound,
+			CreatedAt:         s.now().UTC().Unix(),
+		},
+		Secret: stored,
+	}
+
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		return dbutil.PutBucketValue(tx, apiKeysBkt, k.ID, k)
+	}); err != nil {
+		return "", Key{}, err
+	}
+
+	return secret, k.Key, nil
+}
+
+// Revoke revokes the key with id. Returns ErrKeyNotFound if there is no such key.
+// Revoking a revoked key is a no-op.
+func (s *Store) Revoke(id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		var k storedKey
+		if err := dbutil.GetBucketObject(tx, apiKeysBkt, id, &k); err != nil {
+			switch err.(type) {
+			case dbutil.ObjectNotExistErr:
+				return ErrKeyNotFound
+			default:
+				return err
+			}
+		}
+
+		if k.RevokedAt != 0 {
+			return nil
+		}
+
+		k.RevokedAt = s.now().UTC().Unix()
+		return dbutil.PutBucketValue(tx, apiKeysBkt, id, k)
+	})
+}
+
+// Keys returns all keys, including revoked ones, without their secrets, ordered by creation time
+func (s *Store) Keys() ([]Key, error) {
+	var ks []Key
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		return dbutil.ForEach(tx, apiKeysBkt, func(k, v []byte) error {
+			var sk storedKey
+			if err := json.Unmarshal(v, &sk); err != nil {
+				return fmt.Errorf("decode API key failed: %v", err)
+			}
+
+			ks = append(ks, sk.Key)
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(ks, func(i, j int) bool {
+		return ks[i].CreatedAt < ks[j].CreatedAt
+	})
+
+	return ks, nil
+}
+
+// Sign returns the signature of a request with secret: the hex HMAC-SHA256 of the timestamp,
+// method, request URI and body of the request, separated by newlines. timestamp is the unix time
+// of the request in seconds, and uri is its path and query, e.g. /api/v1/status?skyaddr=...
+func Sign(secret, timestamp, method, uri string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%s\n%s\n%s\n", timestamp, method, uri)
+	mac.Write(body) // nolint: errcheck
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks that a request was signed with the secret of the key with id, see Sign, and that the key
+// is not revoked. Returns ErrInvalidKey, ErrInvalidSignature, ErrInvalidTimestamp or ErrKeyRevoked
+// if the request is not verified.
+func (s *Store) Verify(id, timestamp, signature, method, uri string, body []byte) (Key, error) {
+	var k storedKey
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		return dbutil.GetBucketObject(tx, apiKeysBkt, id, &k)
+	}); err != nil {
+		switch err.(type) {
+		case dbutil.ObjectNotExistErr:
+			return Key{}, ErrInvalidKey
+		default:
+			return Key{}, err
+		}
+	}
+
+	sig, err := hex.DecodeString(signature)
+	if err != nil {
+		return Key{}, ErrInvalidSignature
+	}
+
+	secret, err := decryptSecret(s.cfg.Cipher, k.Secret)
+	if err != nil {
+		return Key{}, err
+	}
+
+	expected, err := hex.DecodeString(Sign(secret, timestamp, method, uri, body))
+	if err != nil {
+		return Key{}, err
+	}
+
+	if !hmac.Equal(sig, expected) {
+		return Key{}, ErrInvalidSignature
+	}
+
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return Key{}, ErrInvalidTimestamp
+	}
+
+	skew := s.now().Sub(time.Unix(ts, 0))
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > s.cfg.MaxClockSkew {
+		return Key{}, ErrInvalidTimestamp
+	}
+
+	if k.RevokedAt != 0 {
+		return Key{}, ErrKeyRevoked
+	}
+
+	return k.Key, nil
+}
@@ -0,0 +1,166 @@
+package apikey
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/util/dbcrypt"
+	"github.com/skycoin/teller/src/util/dbutil"
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+func TestStore(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	s, err := NewStore(db, Config{
+		MaxClockSkew:             time.Minute,
+		DefaultMaxBoundAddresses: 100,
+	})
+	require.NoError(t, err)
+
+	now := time.Unix(1500000000, 0)
+	s.now = func() time.Time {
+		return now
+	}
+
+	_, _, err = s.Create("", -1)
+	require.Equal(t, ErrMissingName, err)
+
+	secret, k, err := s.Create("exchange", -1)
+	require.NoError(t, err)
+	require.Len(t, secret, 64)
+	require.Len(t, k.ID, 32)
+	require.Equal(t, Key{
+		ID:                k.ID,
+		Name:              "exchange",
+		MaxBoundAddresses: 100,
+		CreatedAt:         now.Unix(),
+	}, k)
+
+	_, k2, err := s.Create("wallet", 0)
+	require.NoError(t, err)
+	require.Equal(t, 0, k2.MaxBoundAddresses)
+
+	ts := fmt.Sprint(now.Unix())
+	uri := "/api/v1/status?skyaddr=abc"
+	body := []byte(`{"skyaddr":"abc"}`)
+	sig := Sign(secret, ts, http.MethodPost, uri, body)
+
+	verified, err := s.Verify(k.ID, ts, sig, http.MethodPost, uri, body)
+	require.NoError(t, err)
+	require.Equal(t, k, verified)
+
+	for _, tc := range []struct {
+		name      string
+		id        string
+		timestamp string
+		signature string
+		method    string
+		uri       string
+		body      []byte
+		err       error
+	}{
+		{"unknown key", "abc", ts, sig, http.MethodPost, uri, body, ErrInvalidKey},
+		{"other key", k2.ID, ts, sig, http.MethodPost, uri, body, ErrInvalidSignature},
+		{"not hex", k.ID, ts, "xyz", http.MethodPost, uri, body, ErrInvalidSignature},
+		{"other method", k.ID, ts, sig, http.MethodGet, uri, body, ErrInvalidSignature},
+		{"other uri", k.ID, ts, sig, http.MethodPost, "/api/v1/status?skyaddr=abd", body, ErrInvalidSignature},
+		{"other body", k.ID, ts, sig, http.MethodPost, uri, []byte(`{}`), ErrInvalidSignature},
+		{"other timestamp", k.ID, fmt.Sprint(now.Unix() + 1), sig, http.MethodPost, uri, body, ErrInvalidSignature},
+		{"invalid timestamp", k.ID, "x", Sign(secret, "x", http.MethodPost, uri, body), http.MethodPost, uri, body, ErrInvalidTimestamp},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := s.Verify(tc.id, tc.timestamp, tc.signature, tc.method, tc.uri, tc.body)
+			require.Equal(t, tc.err, err)
+		})
+	}
+
+	// Timestamps are allowed within the clock skew, either way
+	for _, d := range []time.Duration{-time.Minute, time.Minute} {
+		ts := fmt.Sprint(now.Add(d).Unix())
+		_, err = s.Verify(k.ID, ts, Sign(secret, ts, http.MethodGet, uri, nil), http.MethodGet, uri, nil)
+		require.NoError(t, err)
+	}
+
+	for _, d := range []time.Duration{-time.Minute - time.Second, time.Minute + time.Second} {
+		ts := fmt.Sprint(now.Add(d).Unix())
+		_, err = s.Verify(k.ID, ts, Sign(secret, ts, http.MethodGet, uri, nil), http.MethodGet, uri, nil)
+		require.Equal(t, ErrInvalidTimestamp, err)
+	}
+
+	require.Equal(t, ErrKeyNotFound, s.Revoke("abc"))
+	require.NoError(t, s.Revoke(k.ID))
+	require.NoError(t, s.Revoke(k.ID))
+
+	_, err = s.Verify(k.ID, ts, sig, http.MethodPost, uri, body)
+	require.Equal(t, ErrKeyRevoked, err)
+
+	ks, err := s.Keys()
+	require.NoError(t, err)
+	require.Len(t, ks, 2)
+	for _, key := range ks {
+		if key.ID == k.ID {
+			require.Equal(t, now.Unix(), key.RevokedAt)
+		} else {
+			require.Equal(t, k2, key)
+		}
+	}
+}
+
+func TestStoreEncrypted(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	// A key created before encryption was enabled
+	s, err := NewStore(db, Config{
+		MaxClockSkew: time.Minute,
+	})
+	require.NoError(t, err)
+
+	secret, k, err := s.Create("exchange", 0)
+	require.NoError(t, err)
+
+	c, err := dbcrypt.Open(db, "passphrase")
+	require.NoError(t, err)
+
+	s, err = NewStore(db, Config{
+		MaxClockSkew: time.Minute,
+		Cipher:       c,
+	})
+	require.NoError(t, err)
+
+	secret2, k2, err := s.Create("wallet", 0)
+	require.NoError(t, err)
+
+	// The secrets are not stored as they are
+	require.NoError(t, db.View(func(tx *bolt.Tx) error {
+		for id, secret := range map[string]string{
+			k.ID:  secret,
+			k2.ID: secret2,
+		} {
+			var sk storedKey
+			if err := dbutil.GetBucketObject(tx, apiKeysBkt, id, &sk); err != nil {
+				return err
+			}
+			require.NotEqual(t, secret, sk.Secret)
+		}
+		return nil
+	}))
+
+	ts := fmt.Sprint(time.Now().Unix())
+	uri := "/api/v1/status"
+
+	verified, err := s.Verify(k.ID, ts, Sign(secret, ts, http.MethodGet, uri, nil), http.MethodGet, uri, nil)
+	require.NoError(t, err)
+	require.Equal(t, k, verified)
+
+	verified, err = s.Verify(k2.ID, ts, Sign(secret2, ts, http.MethodGet, uri, nil), http.MethodGet, uri, nil)
+	require.NoError(t, err)
+	require.Equal(t, k2, verified)
+}
@@ -0,0 +1,133 @@
+package archive
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/skycoin/teller/src/exchange"
+)
+
+const checkPeriod = time.Hour
+
+// DepositArchiver removes processed deposits from the db, and remembers the archives they were written to
+type DepositArchiver interface {
+	ArchiveDeposits(before time.Time, archive string, write func([]exchange.ArchivedDeposit) error) ([]exchange.ArchivedDeposit, error)
+	GetDepositArchive(depositID string) (string, error)
+}
+
+// Config configures the Archiver
+type Config struct {
+	// Deposits processed more than Retention ago are archived
+	Retention time.Duration
+	// How often to archive the deposits that passed the retention period
+	CheckPeriod time.Duration
+}
+
+// Archiver writes the deposits processed more than cfg.Retention ago to a new archive of the Store,
+// and removes them from the db
+type Archiver struct {
+	log      logrus.FieldLogger
+	cfg      Config
+	deposits DepositArchiver
+	store    *Store
+	now      func() time.Time
+	lock     sync.Mutex // serializes archiving
+	quit     chan struct{}
+	done     chan struct{}
+}
+
+// NewArchiver creates an Archiver
+func NewArchiver(log logrus.FieldLogger, deposits DepositArchiver, store *Store, cfg Config) *Archiver {
+	if cfg.CheckPeriod == 0 {
+		cfg.CheckPeriod = checkPeriod
+	}
+
+	return &Archiver{
+		log:      log.WithField("prefix", "archive.archiver"),
+		cfg:      cfg,
+		deposits: deposits,
+		store:    store,
+		now:      time.Now,
+		quit:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Run archives the deposits that passed the retention period, checking every CheckPeriod until Shutdown is called
+func (a *Archiver) Run() error {
+	log := a.log.WithField("config", a.cfg)
+	log.Info("Start archiver")
+	defer log.Info("Archiver closed")
+	defer close(a.done)
+
+	for {
+		if _, err := a.Archive(); err != nil {
+			log.WithError(err).Error("Archiver.Archive failed")
+		}
+
+		select {
+		case <-a.quit:
+			return nil
+		case <-time.After(a.cfg.CheckPeriod):
+		}
+	}
+}
+
+// Shutdown stops the Archiver
+func (a *Archiver) Shutdown() {
+	close(a.quit)
+	<-a.done
+}
+
+// Archive writes the deposits processed more than cfg.Retention ago to a new archive, and removes them from the db.
+// Returns the name of the archive, or the empty string if no deposit passed the retention period.
+func (a *Archiver) Archive() (string, error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	now := a.now()
+	name := Name(now)
+
+	ads, err := a.deposits.ArchiveDeposits(now.Add(-a.cfg.Retention), name, func(ads []exchange.ArchivedDeposit) error {
+		return a.store.Write(name, ads)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if len(ads) == 0 {
+		return "", nil
+	}
+
+	a.log.WithFields(logrus.Fields{
+		"archive":  name,
+		"deposits": len(ads),
+	}).Info("Archived deposits")
+
+	return name, nil
+}
+
+// GetDeposit returns an archived deposit, from the archive the db says it was written to
+func (a *Archiver) GetDeposit(depositID string) (Deposit, error) {
+	name, err := a.deposits.GetDepositArchive(depositID)
+	if err != nil {
+		if err == exchange.ErrDepositNotFound {
+			return Deposit{}, ErrNotFound
+		}
+		return Deposit{}, err
+	}
+
+	return a.store.Find(name, depositID)
+}
+
+// GetSkyAddressDeposits returns the archived deposits of a skycoin address, oldest archive first
+func (a *Archiver) GetSkyAddressDeposits(skyAddr string) ([]Deposit, error) {
+	return a.store.FindSkyAddress(skyAddr)
+}
+
+// Archives returns the names of the archives, oldest first
+func (a *Archiver) Archives() ([]string, error) {
+	return a.store.Names()
+}
@@ -0,0 +1,95 @@
+package archive
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/exchange"
+	"github.com/skycoin/teller/src/scanner"
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+func TestArchiver(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	log, _ := testutil.NewLogger(t)
+	es, err := exchange.NewStore(log, db, nil)
+	require.NoError(t, err)
+
+	require.NoError(t, es.BindAddress("skyaddr1", "btcaddr1", "", "", "", 0, 0))
+
+	for _, dv := range []scanner.Deposit{
+		{CoinType: scanner.CoinTypeBTC, Address: "btcaddr1", Value: 1e6, Height: 20, Tx: "btx1", N: 0},
+		{CoinType: scanner.CoinTypeBTC, Address: "btcaddr1", Value: 2e6, Height: 21, Tx: "btx2", N: 0},
+	} {
+		_, err := es.GetOrCreateDepositInfo(dv, "500", 1)
+		require.NoError(t, err)
+	}
+
+	_, err = es.UpdateDepositInfo("btx1:0", func(di exchange.DepositInfo) exchange.DepositInfo {
+		di.Status = exchange.StatusDone
+		di.Txid = "skytx1"
+		di.SkySent = 5e6
+		return di
+	})
+	require.NoError(t, err)
+
+	store, shutdown2 := prepareStore(t)
+	defer shutdown2()
+
+	a := NewArchiver(log, es, store, Config{
+		Retention: time.Hour * 24,
+	})
+
+	now := time.Now()
+	a.now = func() time.Time {
+		return now
+	}
+
+	// The deposit was processed less than a day ago
+	name, err := a.Archive()
+	require.NoError(t, err)
+	require.Empty(t, name)
+
+	names, err := a.Archives()
+	require.NoError(t, err)
+	require.Empty(t, names)
+
+	now = now.Add(time.Hour * 25)
+
+	name, err = a.Archive()
+	require.NoError(t, err)
+	require.Equal(t, Name(now), name)
+
+	names, err = a.Archives()
+	require.NoError(t, err)
+	require.Equal(t, []string{name}, names)
+
+	d, err := a.GetDeposit("btx1:0")
+	require.NoError(t, err)
+	require.Equal(t, name, d.Archive)
+	require.Equal(t, "skytx1", d.DepositInfo.Txid)
+	require.Len(t, d.Events, 2)
+
+	// The unprocessed deposit stays in the db
+	_, err = a.GetDeposit("btx2:0")
+	require.Equal(t, ErrNotFound, err)
+
+	dis, err := es.GetDepositInfoOfSkyAddress("skyaddr1")
+	require.NoError(t, err)
+	require.Len(t, dis, 1)
+	require.Equal(t, "btx2:0", dis[0].DepositID)
+
+	ds, err := a.GetSkyAddressDeposits("skyaddr1")
+	require.NoError(t, err)
+	require.Len(t, ds, 1)
+	require.Equal(t, "btx1:0", ds[0].DepositInfo.DepositID)
+
+	// Nothing left to archive
+	name, err = a.Archive()
+	require.NoError(t, err)
+	require.Empty(t, name)
+}
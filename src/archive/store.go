@@ -0,0 +1,244 @@
+// Package archive moves the deposits processed more than a retention period ago out of the db,
+// into compressed archive files, and reads them back
+package archive
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/skycoin/teller/src/exchange"
+)
+
+const (
+	namePrefix = "deposits-"
+	nameSuffix = ".json.gz"
+	// TimeFormat is the format of the UTC time in the archive names
+	TimeFormat = "20060102T150405Z"
+)
+
+var (
+	// ErrNotFound is returned if a deposit or an archive is not found
+	ErrNotFound = errors.New("Archived deposit not found")
+	// ErrInvalidName is returned for an archive name that is not deposits-<time>.json.gz
+	ErrInvalidName = errors.New("Invalid archive name")
+	// ErrArchiveExists is returned when writing an archive that already exists
+	ErrArchiveExists = errors.New("Archive already exists")
+)
+
+// Deposit is an archived deposit with the name of its archive
+type Deposit struct {
+	Archive string `json:"archive"`
+	exchange.ArchivedDeposit
+}
+
+// Name returns the name of an archive written at t
+func Name(t time.Time) string {
+	return namePrefix + t.UTC().Format(TimeFormat) + nameSuffix
+}
+
+// validName returns true if name was returned by Name, so it can't name a file outside the directory
+func validName(name string) bool {
+	if !strings.HasPrefix(name, namePrefix) || !strings.HasSuffix(name, nameSuffix) {
+		return false
+	}
+
+	_, err := time.Parse(TimeFormat, strings.TrimSuffix(strings.TrimPrefix(name, namePrefix), nameSuffix))
+	return err == nil
+}
+
+// Store saves archives in a directory, as gzipped files of one JSON exchange.ArchivedDeposit per line
+type Store struct {
+	dir string
+}
+
+// NewStore creates a Store, creating dir if it does not exist
+func NewStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	return &Store{
+		dir: dir,
+	}, nil
+}
+
+// Write writes an archive through a temporary file, so that a partially written archive is never read
+func (s *Store) Write(name string, ads []exchange.ArchivedDeposit) error {
+	if !validName(name) {
+		return ErrInvalidName
+	}
+
+	path := filepath.Join(s.dir, name)
+	if _, err := os.Stat(path); err == nil {
+		return ErrArchiveExists
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	if err := writeDeposits(f, ads); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+
+	// The archive must be on disk before the deposits are removed from the db
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+func writeDeposits(w io.Writer, ads []exchange.ArchivedDeposit) error {
+	zw := gzip.NewWriter(w)
+	enc := json.NewEncoder(zw)
+
+	for _, ad := range ads {
+		if err := enc.Encode(ad); err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+// Read returns the deposits of an archive, in the order they were written
+func (s *Store) Read(name string) ([]exchange.ArchivedDeposit, error) {
+	var ads []exchange.ArchivedDeposit
+	if err := s.forEach(name, func(ad exchange.ArchivedDeposit) bool {
+		ads = append(ads, ad)
+		return true
+	}); err != nil {
+		return nil, err
+	}
+
+	return ads, nil
+}
+
+// forEach calls f with each deposit of an archive, until f returns false
+func (s *Store) forEach(name string, f func(exchange.ArchivedDeposit) bool) error {
+	if !validName(name) {
+		return ErrInvalidName
+	}
+
+	file, err := os.Open(filepath.Join(s.dir, name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ErrNotFound
+		}
+		return err
+	}
+	defer file.Close()
+
+	zr, err := gzip.NewReader(bufio.NewReader(file))
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	dec := json.NewDecoder(zr)
+	for {
+		var ad exchange.ArchivedDeposit
+		if err := dec.Decode(&ad); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		if !f(ad) {
+			return nil
+		}
+	}
+}
+
+// Find returns a deposit of an archive
+func (s *Store) Find(name, depositID string) (Deposit, error) {
+	var d *Deposit
+	if err := s.forEach(name, func(ad exchange.ArchivedDeposit) bool {
+		if ad.DepositInfo.DepositID != depositID {
+			return true
+		}
+
+		d = &Deposit{
+			Archive:         name,
+			ArchivedDeposit: ad,
+		}
+		return false
+	}); err != nil {
+		return Deposit{}, err
+	}
+
+	if d == nil {
+		return Deposit{}, ErrNotFound
+	}
+
+	return *d, nil
+}
+
+// FindSkyAddress returns the deposits of a skycoin address in every archive, oldest archive first.
+// It reads every archive.
+func (s *Store) FindSkyAddress(skyAddr string) ([]Deposit, error) {
+	names, err := s.Names()
+	if err != nil {
+		return nil, err
+	}
+
+	ds := []Deposit{}
+	for _, name := range names {
+		if err := s.forEach(name, func(ad exchange.ArchivedDeposit) bool {
+			if ad.DepositInfo.SkyAddress == skyAddr {
+				ds = append(ds, Deposit{
+					Archive:         name,
+					ArchivedDeposit: ad,
+				})
+			}
+			return true
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	return ds, nil
+}
+
+// Names returns the names of the archives, oldest first
+func (s *Store) Names() ([]string, error) {
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, f := range files {
+		if validName(f.Name()) {
+			names = append(names, f.Name())
+		}
+	}
+
+	sort.Strings(names)
+
+	return names, nil
+}
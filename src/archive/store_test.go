@@ -0,0 +1,107 @@
+package archive
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/exchange"
+)
+
+func prepareStore(t *testing.T) (*Store, func()) {
+	dir, err := ioutil.TempDir("", "teller-archive")
+	require.NoError(t, err)
+
+	s, err := NewStore(filepath.Join(dir, "archives"))
+	require.NoError(t, err)
+
+	return s, func() {
+		os.RemoveAll(dir)
+	}
+}
+
+func testArchivedDeposit(depositID, skyAddr string) exchange.ArchivedDeposit {
+	di := exchange.DepositInfo{
+		DepositID:  depositID,
+		SkyAddress: skyAddr,
+		Status:     exchange.StatusDone,
+	}
+
+	return exchange.ArchivedDeposit{
+		DepositInfo: di,
+		Events: []exchange.DepositEvent{
+			{Seq: 1, Type: exchange.EventDepositInfo, DepositInfo: &di},
+		},
+	}
+}
+
+func TestStore(t *testing.T) {
+	s, shutdown := prepareStore(t)
+	defer shutdown()
+
+	names, err := s.Names()
+	require.NoError(t, err)
+	require.Empty(t, names)
+
+	t1 := time.Date(2018, 3, 4, 10, 0, 0, 0, time.UTC)
+	name1 := Name(t1)
+	require.Equal(t, "deposits-20180304T100000Z.json.gz", name1)
+
+	require.NoError(t, s.Write(name1, []exchange.ArchivedDeposit{
+		testArchivedDeposit("tx1:0", "skyaddr1"),
+		testArchivedDeposit("tx2:0", "skyaddr2"),
+	}))
+
+	// Archives are never overwritten
+	require.Equal(t, ErrArchiveExists, s.Write(name1, nil))
+
+	name2 := Name(t1.Add(time.Hour))
+	require.NoError(t, s.Write(name2, []exchange.ArchivedDeposit{
+		testArchivedDeposit("tx3:0", "skyaddr1"),
+	}))
+
+	names, err = s.Names()
+	require.NoError(t, err)
+	require.Equal(t, []string{name1, name2}, names)
+
+	ads, err := s.Read(name1)
+	require.NoError(t, err)
+	require.Len(t, ads, 2)
+	require.Equal(t, "tx1:0", ads[0].DepositInfo.DepositID)
+	require.Len(t, ads[0].Events, 1)
+	require.Equal(t, "tx1:0", ads[0].Events[0].DepositInfo.DepositID)
+
+	d, err := s.Find(name1, "tx2:0")
+	require.NoError(t, err)
+	require.Equal(t, name1, d.Archive)
+	require.Equal(t, "skyaddr2", d.DepositInfo.SkyAddress)
+
+	_, err = s.Find(name1, "tx3:0")
+	require.Equal(t, ErrNotFound, err)
+
+	_, err = s.Find(Name(t1.Add(time.Minute)), "tx1:0")
+	require.Equal(t, ErrNotFound, err)
+
+	ds, err := s.FindSkyAddress("skyaddr1")
+	require.NoError(t, err)
+	require.Len(t, ds, 2)
+	require.Equal(t, "tx1:0", ds[0].DepositInfo.DepositID)
+	require.Equal(t, name1, ds[0].Archive)
+	require.Equal(t, "tx3:0", ds[1].DepositInfo.DepositID)
+	require.Equal(t, name2, ds[1].Archive)
+
+	ds, err = s.FindSkyAddress("skyaddr9")
+	require.NoError(t, err)
+	require.Empty(t, ds)
+
+	// Names can't point outside the directory
+	for _, name := range []string{"../deposits-20180304T100000Z.json.gz", "x.json.gz", ""} {
+		_, err = s.Read(name)
+		require.Equal(t, ErrInvalidName, err, name)
+		require.Equal(t, ErrInvalidName, s.Write(name, nil), name)
+	}
+}
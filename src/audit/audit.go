@@ -0,0 +1,395 @@
+// Package audit writes the deposit ledger as a snapshot that auditors can verify was not altered:
+// canonical files of the deposits and the skycoin sends, a manifest of their SHA-256 hashes,
+// and an optional signature of the manifest with the secret key of the operator's skycoin address
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/skycoin/skycoin/src/cipher"
+
+	"github.com/skycoin/teller/src/report"
+)
+
+const (
+	// Version of the snapshot format, in the manifest
+	Version = 1
+
+	// DepositsFile has one report.LedgerEntry per line, ordered by seq
+	DepositsFile = "deposits.jsonl"
+	// SendsFile has one Send per line, ordered by the seq of their first deposit
+	SendsFile = "sends.jsonl"
+	// ManifestFile is the Manifest
+	ManifestFile = "manifest.json"
+	// SignatureFile is the hex signature of the SHA-256 hash of the manifest file
+	SignatureFile = "manifest.sig"
+)
+
+var (
+	// ErrSnapshotExists is returned when writing a snapshot to a directory that already exists
+	ErrSnapshotExists = errors.New("Snapshot directory already exists")
+	// ErrInvalidSignature is returned if the manifest is not signed by the expected skycoin address
+	ErrInvalidSignature = errors.New("Invalid manifest signature")
+	// ErrNotSigned is returned if a snapshot that must be signed is not
+	ErrNotSigned = errors.New("Snapshot is not signed")
+	// ErrUnsupportedVersion is returned for a manifest of another version of the snapshot format
+	ErrUnsupportedVersion = errors.New("Unsupported snapshot version")
+)
+
+// Send is a skycoin transaction that paid deposits out, several of them if the sends were batched
+type Send struct {
+	Txid string `json:"txid"`
+	// Total SKY sent to the deposits, in droplets
+	SkySent    uint64   `json:"sky_sent"`
+	DepositIDs []string `json:"deposit_ids"`
+}
+
+// File is a file of the snapshot
+type File struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Manifest describes a snapshot. The same ledger always gives the same manifest.
+type Manifest struct {
+	Version  int `json:"version"`
+	Deposits int `json:"deposits"`
+	Sends    int `json:"sends"`
+	// Total SKY sent, in droplets
+	SkySent uint64 `json:"sky_sent"`
+	Files   []File `json:"files"`
+}
+
+// Sends returns the skycoin sends of the deposits of a ledger that were sent, ordered by the seq of their first deposit
+func Sends(ledger []report.LedgerEntry) []Send {
+	var sends []Send
+	index := make(map[string]int)
+
+	// The ledger is ordered by seq, and so are the deposits of each send
+	for _, e := range ledger {
+		if e.Txid == "" {
+			continue
+		}
+
+		i, ok := index[e.Txid]
+		if !ok {
+			i = len(sends)
+			index[e.Txid] = i
+			sends = append(sends, Send{
+				Txid:       e.Txid,
+				DepositIDs: []string{},
+			})
+		}
+
+		sends[i].SkySent += e.SkySent
+		sends[i].DepositIDs = append(sends[i].DepositIDs, e.DepositID)
+	}
+
+	return sends
+}
+
+// Write writes a snapshot of ledger, which must be ordered by seq, to dir, which must not exist.
+// The files are written to a temporary directory that is renamed to dir, so a snapshot is never partially written.
+func Write(dir string, ledger []report.LedgerEntry) (*Manifest, error) {
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		return nil, ErrSnapshotExists
+	}
+
+	tmp := dir + ".tmp"
+	if err := os.RemoveAll(tmp); err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(tmp, 0700); err != nil {
+		return nil, err
+	}
+
+	m, err := write(tmp, ledger)
+	if err != nil {
+		os.RemoveAll(tmp)
+		return nil, err
+	}
+
+	if err := os.Rename(tmp, dir); err != nil {
+		os.RemoveAll(tmp)
+		return nil, err
+	}
+
+	return m, nil
+}
+
+func write(dir string, ledger []report.LedgerEntry) (*Manifest, error) {
+	sends := Sends(ledger)
+
+	m := &Manifest{
+		Version:  Version,
+		Deposits: len(ledger),
+		Sends:    len(sends),
+		Files:    []File{},
+	}
+
+	for _, s := range sends {
+		m.SkySent += s.SkySent
+	}
+
+	deposits := make([]interface{}, len(ledger))
+	for i, e := range ledger {
+		deposits[i] = e
+	}
+
+	sendLines := make([]interface{}, len(sends))
+	for i, s := range sends {
+		sendLines[i] = s
+	}
+
+	for _, f := range []struct {
+		name  string
+		lines []interface{}
+	}{
+		{DepositsFile, deposits},
+		{SendsFile, sendLines},
+	} {
+		file, err := writeLines(filepath.Join(dir, f.name), f.lines)
+		if err != nil {
+			return nil, err
+		}
+		file.Name = f.name
+		m.Files = append(m.Files, file)
+	}
+
+	b, err := marshalManifest(*m)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writeFile(filepath.Join(dir, ManifestFile), b); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// writeLines writes one JSON value per line to a new file at path, and returns its size and hash
+func writeLines(path string, lines []interface{}) (File, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return File{}, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	cw := &countWriter{w: io.MultiWriter(f, h)}
+	bw := bufio.NewWriter(cw)
+
+	for _, l := range lines {
+		b, err := json.Marshal(l)
+		if err != nil {
+			return File{}, err
+		}
+
+		if _, err := bw.Write(append(b, '\n')); err != nil {
+			return File{}, err
+		}
+	}
+
+	if err := bw.Flush(); err != nil {
+		return File{}, err
+	}
+
+	if err := f.Sync(); err != nil {
+		return File{}, err
+	}
+
+	if err := f.Close(); err != nil {
+		return File{}, err
+	}
+
+	return File{
+		Size:   cw.n,
+		SHA256: hex.EncodeToString(h.Sum(nil)),
+	}, nil
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func writeFile(path string, b []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+func marshalManifest(m Manifest) ([]byte, error) {
+	b, err := json.MarshalIndent(m, "", "    ")
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+// Sign signs the manifest of the snapshot in dir with seckey, and returns the skycoin address of seckey,
+// which auditors verify the signature with
+func Sign(dir string, seckey cipher.SecKey) (string, error) {
+	b, err := ioutil.ReadFile(filepath.Join(dir, ManifestFile))
+	if err != nil {
+		return "", err
+	}
+
+	sig := cipher.SignHash(cipher.SumSHA256(b), seckey)
+
+	if err := writeFile(filepath.Join(dir, SignatureFile), []byte(sig.Hex()+"\n")); err != nil {
+		return "", err
+	}
+
+	return cipher.AddressFromSecKey(seckey).String(), nil
+}
+
+// Verified is a verified snapshot
+type Verified struct {
+	Manifest Manifest
+	// Skycoin address that signed the manifest, empty if the snapshot is not signed
+	Signer string
+}
+
+// Verify checks that the files of the snapshot in dir match its manifest. If signer is set, the manifest must
+// be signed by the skycoin address signer, the operator's address. Otherwise the signature is only checked
+// if there is one: any signature recovers some address, so Verified.Signer must then be checked by the caller.
+func Verify(dir, signer string) (*Verified, error) {
+	b, err := ioutil.ReadFile(filepath.Join(dir, ManifestFile))
+	if err != nil {
+		return nil, err
+	}
+
+	var m Manifest
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("Invalid manifest: %v", err)
+	}
+
+	if m.Version != Version {
+		return nil, ErrUnsupportedVersion
+	}
+
+	// The files are always the deposits and the sends, with one line per deposit and per send
+	lines := map[string]int{
+		DepositsFile: m.Deposits,
+		SendsFile:    m.Sends,
+	}
+	if len(m.Files) != len(lines) {
+		return nil, errors.New("Invalid manifest: wrong number of files")
+	}
+
+	for _, f := range m.Files {
+		n, ok := lines[f.Name]
+		if !ok {
+			return nil, fmt.Errorf("Invalid manifest: unknown file %q", f.Name)
+		}
+		delete(lines, f.Name)
+
+		if err := verifyFile(filepath.Join(dir, f.Name), f, n); err != nil {
+			return nil, err
+		}
+	}
+
+	v := &Verified{
+		Manifest: m,
+	}
+
+	sig, err := ioutil.ReadFile(filepath.Join(dir, SignatureFile))
+	if os.IsNotExist(err) {
+		if signer != "" {
+			return nil, ErrNotSigned
+		}
+		return v, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	s, err := cipher.SigFromHex(string(bytes.TrimSpace(sig)))
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+
+	pubkey, err := cipher.PubKeyFromSig(s, cipher.SumSHA256(b))
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+
+	addr := cipher.AddressFromPubKey(pubkey)
+	if err := cipher.ChkSig(addr, cipher.SumSHA256(b), s); err != nil {
+		return nil, ErrInvalidSignature
+	}
+
+	if signer != "" && addr.String() != signer {
+		return nil, ErrInvalidSignature
+	}
+
+	v.Signer = addr.String()
+	return v, nil
+}
+
+// verifyFile checks the size, the hash and the number of lines of a file of the snapshot
+func verifyFile(path string, want File, lines int) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	lc := &lineCounter{}
+	n, err := io.Copy(io.MultiWriter(h, lc), f)
+	if err != nil {
+		return err
+	}
+
+	if n != want.Size || hex.EncodeToString(h.Sum(nil)) != want.SHA256 {
+		return fmt.Errorf("%s does not match the manifest, it was altered", want.Name)
+	}
+
+	if lc.n != lines {
+		return fmt.Errorf("%s has %d lines, the manifest counts %d", want.Name, lc.n, lines)
+	}
+
+	return nil
+}
+
+type lineCounter struct {
+	n int
+}
+
+func (c *lineCounter) Write(p []byte) (int, error) {
+	c.n += bytes.Count(p, []byte{'\n'})
+	return len(p), nil
+}
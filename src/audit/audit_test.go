@@ -0,0 +1,144 @@
+package audit
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/skycoin/skycoin/src/cipher"
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/report"
+)
+
+func testLedger() []report.LedgerEntry {
+	return []report.LedgerEntry{
+		{
+			Seq:       1,
+			DepositID: "btc1:0",
+			SkySent:   100e6,
+			Txid:      "sky1",
+			Status:    "done",
+		},
+		{
+			Seq:       2,
+			DepositID: "btc2:0",
+			Status:    "waiting_send",
+		},
+		{
+			Seq:       3,
+			DepositID: "btc3:1",
+			SkySent:   200e6,
+			Txid:      "sky2",
+			Status:    "done",
+		},
+		{
+			Seq:       4,
+			DepositID: "btc4:0",
+			SkySent:   50e6,
+			Txid:      "sky1",
+			Status:    "done",
+		},
+	}
+}
+
+func TestSends(t *testing.T) {
+	require.Equal(t, []Send{
+		{
+			Txid:       "sky1",
+			SkySent:    150e6,
+			DepositIDs: []string{"btc1:0", "btc4:0"},
+		},
+		{
+			Txid:       "sky2",
+			SkySent:    200e6,
+			DepositIDs: []string{"btc3:1"},
+		},
+	}, Sends(testLedger()))
+}
+
+func TestWriteVerify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "teller-audit")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	snapshot := filepath.Join(dir, "snapshot")
+	m, err := Write(snapshot, testLedger())
+	require.NoError(t, err)
+	require.Equal(t, 4, m.Deposits)
+	require.Equal(t, 2, m.Sends)
+	require.Equal(t, uint64(350e6), m.SkySent)
+	require.Len(t, m.Files, 2)
+
+	_, err = Write(snapshot, testLedger())
+	require.Equal(t, ErrSnapshotExists, err)
+
+	// The same ledger gives the same files
+	again := filepath.Join(dir, "again")
+	_, err = Write(again, testLedger())
+	require.NoError(t, err)
+	for _, name := range []string{DepositsFile, SendsFile, ManifestFile} {
+		a, err := ioutil.ReadFile(filepath.Join(snapshot, name))
+		require.NoError(t, err)
+		b, err := ioutil.ReadFile(filepath.Join(again, name))
+		require.NoError(t, err)
+		require.Equal(t, a, b, name)
+	}
+
+	v, err := Verify(snapshot, "")
+	require.NoError(t, err)
+	require.Equal(t, *m, v.Manifest)
+	require.Empty(t, v.Signer)
+
+	pubkey, seckey := cipher.GenerateKeyPair()
+	addr := cipher.AddressFromPubKey(pubkey).String()
+
+	_, err = Verify(snapshot, addr)
+	require.Equal(t, ErrNotSigned, err)
+
+	signer, err := Sign(snapshot, seckey)
+	require.NoError(t, err)
+	require.Equal(t, addr, signer)
+
+	v, err = Verify(snapshot, "")
+	require.NoError(t, err)
+	require.Equal(t, addr, v.Signer)
+
+	v, err = Verify(snapshot, addr)
+	require.NoError(t, err)
+	require.Equal(t, addr, v.Signer)
+
+	otherPubkey, _ := cipher.GenerateKeyPair()
+	_, err = Verify(snapshot, cipher.AddressFromPubKey(otherPubkey).String())
+	require.Equal(t, ErrInvalidSignature, err)
+
+	// A deposit is altered
+	path := filepath.Join(snapshot, DepositsFile)
+	b, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	altered := append([]byte{}, b...)
+	altered[len(altered)-3] ^= 1
+	require.NoError(t, ioutil.WriteFile(path, altered, 0600))
+
+	_, err = Verify(snapshot, addr)
+	require.Error(t, err)
+
+	require.NoError(t, ioutil.WriteFile(path, b, 0600))
+
+	// The manifest is altered, so the signature doesn't match it
+	manifestPath := filepath.Join(snapshot, ManifestFile)
+	mb, err := ioutil.ReadFile(manifestPath)
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(manifestPath, append(mb, '\n'), 0600))
+
+	_, err = Verify(snapshot, addr)
+	require.Equal(t, ErrInvalidSignature, err)
+
+	require.NoError(t, ioutil.WriteFile(manifestPath, mb, 0600))
+
+	// A malformed signature
+	require.NoError(t, ioutil.WriteFile(filepath.Join(snapshot, SignatureFile), []byte("00\n"), 0600))
+	_, err = Verify(snapshot, "")
+	require.Equal(t, ErrInvalidSignature, err)
+}
@@ -0,0 +1,426 @@
+// Package backup takes encrypted snapshots of the db on a schedule, keeps the latest ones in a directory
+// and optionally uploads them to an S3-compatible bucket, and restores them
+package backup
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	namePrefix = "snapshot-"
+	nameSuffix = ".db.gz.enc"
+	// TimeFormat is the format of the UTC time in the snapshot names
+	TimeFormat = "20060102T150405Z"
+	// Prefix of the keys of the deposit archives in the bucket, after the configured prefix
+	archivesPrefix = "archives/"
+	// Suffix of the encrypted deposit archives in the bucket
+	encSuffix = ".enc"
+)
+
+var (
+	// ErrNoSnapshot is returned by Restore if there is no snapshot
+	ErrNoSnapshot = errors.New("No backup snapshot found")
+	// ErrInvalidName is returned for a snapshot name that is not snapshot-<time>.db.gz.enc
+	ErrInvalidName = errors.New("Invalid snapshot name")
+)
+
+// Name returns the name of a snapshot taken at t
+func Name(t time.Time) string {
+	return namePrefix + t.UTC().Format(TimeFormat) + nameSuffix
+}
+
+// validName returns true if name was returned by Name, so it can't name a file outside the directory
+func validName(name string) bool {
+	if !strings.HasPrefix(name, namePrefix) || !strings.HasSuffix(name, nameSuffix) {
+		return false
+	}
+
+	_, err := time.Parse(TimeFormat, strings.TrimSuffix(strings.TrimPrefix(name, namePrefix), nameSuffix))
+	return err == nil
+}
+
+// Config configures the Backuper
+type Config struct {
+	// Directory the snapshots are saved in
+	Dir string
+	// How often a snapshot is taken
+	Interval time.Duration
+	// Number of snapshots kept in Dir, the oldest are deleted
+	Keep int
+	// Passphrase the snapshots and uploaded archives are encrypted with
+	Passphrase string
+	// Prefix of the keys of the bucket
+	S3Prefix string
+	// Number of snapshots kept in the bucket, the oldest are deleted
+	S3Keep int
+	// Directory of the deposit archives, which are uploaded to the bucket since they are not in the db.
+	// Empty if deposits are not archived.
+	ArchiveDir string
+}
+
+// Backuper takes an encrypted snapshot of the db every cfg.Interval, and uploads it to the bucket if s3 is set
+type Backuper struct {
+	log  logrus.FieldLogger
+	cfg  Config
+	db   *bolt.DB
+	s3   *S3
+	now  func() time.Time
+	lock sync.Mutex // serializes backups
+	quit chan struct{}
+	done chan struct{}
+}
+
+// NewBackuper creates a Backuper. s3 is nil if the snapshots are only kept in cfg.Dir.
+func NewBackuper(log logrus.FieldLogger, db *bolt.DB, s3 *S3, cfg Config) (*Backuper, error) {
+	if cfg.Passphrase == "" {
+		return nil, ErrEmptyPassphrase
+	}
+
+	if err := os.MkdirAll(cfg.Dir, 0700); err != nil {
+		return nil, err
+	}
+
+	return &Backuper{
+		log:  log.WithField("prefix", "backup"),
+		cfg:  cfg,
+		db:   db,
+		s3:   s3,
+		now:  time.Now,
+		quit: make(chan struct{}),
+		done: make(chan struct{}),
+	}, nil
+}
+
+// Run takes a snapshot every cfg.Interval until Shutdown is called.
+// The first snapshot is taken cfg.Interval after the latest one in cfg.Dir, so that restarts don't delay it.
+func (b *Backuper) Run() error {
+	log := b.log.WithFields(logrus.Fields{
+		"dir":      b.cfg.Dir,
+		"interval": b.cfg.Interval,
+		"s3":       b.s3 != nil,
+	})
+	log.Info("Start backuper")
+	defer log.Info("Backuper closed")
+	defer close(b.done)
+
+	wait, err := b.untilNextBackup()
+	if err != nil {
+		log.WithError(err).Error("Backuper.untilNextBackup failed")
+		wait = b.cfg.Interval
+	}
+
+	for {
+		select {
+		case <-b.quit:
+			return nil
+		case <-time.After(wait):
+		}
+
+		if _, err := b.Backup(); err != nil {
+			log.WithError(err).Error("Backuper.Backup failed")
+		}
+
+		wait = b.cfg.Interval
+	}
+}
+
+// untilNextBackup returns how long until cfg.Interval passed since the latest snapshot in cfg.Dir
+func (b *Backuper) untilNextBackup() (time.Duration, error) {
+	names, err := localSnapshots(b.cfg.Dir)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(names) == 0 {
+		return 0, nil
+	}
+
+	latest := names[len(names)-1]
+	t, err := time.Parse(TimeFormat, strings.TrimSuffix(strings.TrimPrefix(latest, namePrefix), nameSuffix))
+	if err != nil {
+		return 0, err
+	}
+
+	wait := t.Add(b.cfg.Interval).Sub(b.now())
+	if wait < 0 {
+		wait = 0
+	}
+
+	return wait, nil
+}
+
+// Shutdown stops the Backuper
+func (b *Backuper) Shutdown() {
+	close(b.quit)
+	<-b.done
+}
+
+// Backup takes a snapshot of the db, deletes the snapshots beyond cfg.Keep, and uploads the snapshot and the
+// deposit archives missing from the bucket. Returns the name of the snapshot.
+func (b *Backuper) Backup() (string, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	name := Name(b.now())
+	path := filepath.Join(b.cfg.Dir, name)
+
+	log := b.log.WithField("snapshot", name)
+
+	if err := writeEncrypted(path, b.cfg.Passphrase, func(w io.Writer) error {
+		zw := gzip.NewWriter(w)
+
+		// A read transaction copies a consistent db while teller keeps writing to it
+		if err := b.db.View(func(tx *bolt.Tx) error {
+			_, err := tx.WriteTo(zw)
+			return err
+		}); err != nil {
+			return err
+		}
+
+		return zw.Close()
+	}); err != nil {
+		return "", err
+	}
+
+	log.Info("Took db snapshot")
+
+	if err := b.prune(); err != nil {
+		return "", err
+	}
+
+	if b.s3 == nil {
+		return name, nil
+	}
+
+	if err := b.upload(b.cfg.S3Prefix+name, path); err != nil {
+		return "", err
+	}
+
+	log.Info("Uploaded db snapshot")
+
+	if err := b.pruneS3(); err != nil {
+		return "", err
+	}
+
+	if b.cfg.ArchiveDir != "" {
+		if err := b.uploadArchives(); err != nil {
+			return "", err
+		}
+	}
+
+	return name, nil
+}
+
+// Snapshots returns the names of the snapshots in cfg.Dir, oldest first
+func (b *Backuper) Snapshots() ([]string, error) {
+	return localSnapshots(b.cfg.Dir)
+}
+
+// prune deletes the oldest snapshots of cfg.Dir beyond cfg.Keep
+func (b *Backuper) prune() error {
+	names, err := localSnapshots(b.cfg.Dir)
+	if err != nil {
+		return err
+	}
+
+	for len(names) > b.cfg.Keep {
+		if err := os.Remove(filepath.Join(b.cfg.Dir, names[0])); err != nil {
+			return err
+		}
+		b.log.WithField("snapshot", names[0]).Info("Deleted old db snapshot")
+		names = names[1:]
+	}
+
+	return nil
+}
+
+// pruneS3 deletes the oldest snapshots of the bucket beyond cfg.S3Keep
+func (b *Backuper) pruneS3() error {
+	names, err := s3Snapshots(b.s3, b.cfg.S3Prefix)
+	if err != nil {
+		return err
+	}
+
+	for len(names) > b.cfg.S3Keep {
+		if err := b.s3.Delete(b.cfg.S3Prefix + names[0]); err != nil {
+			return err
+		}
+		b.log.WithField("snapshot", names[0]).Info("Deleted old db snapshot from the bucket")
+		names = names[1:]
+	}
+
+	return nil
+}
+
+func (b *Backuper) upload(key, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	return b.s3.Put(key, f, fi.Size())
+}
+
+// uploadArchives encrypts and uploads the deposit archives that are not in the bucket.
+// Archives are never changed once written, so they are uploaded once and never deleted.
+func (b *Backuper) uploadArchives() error {
+	keys, err := b.s3.List(b.cfg.S3Prefix + archivesPrefix)
+	if err != nil {
+		return err
+	}
+
+	uploaded := make(map[string]struct{}, len(keys))
+	for _, k := range keys {
+		uploaded[k] = struct{}{}
+	}
+
+	files, err := ioutil.ReadDir(b.cfg.ArchiveDir)
+	if err != nil {
+		return err
+	}
+
+	for _, fi := range files {
+		// Archives are written to a temporary file first, which is skipped
+		if fi.IsDir() || !strings.HasSuffix(fi.Name(), ".json.gz") {
+			continue
+		}
+
+		key := b.cfg.S3Prefix + archivesPrefix + fi.Name() + encSuffix
+		if _, ok := uploaded[key]; ok {
+			continue
+		}
+
+		if err := b.uploadArchive(key, filepath.Join(b.cfg.ArchiveDir, fi.Name())); err != nil {
+			return err
+		}
+
+		b.log.WithField("archive", fi.Name()).Info("Uploaded deposit archive")
+	}
+
+	return nil
+}
+
+func (b *Backuper) uploadArchive(key, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	tmp := filepath.Join(b.cfg.Dir, filepath.Base(path)+encSuffix+".tmp")
+	defer os.Remove(tmp)
+
+	if err := writeEncrypted(tmp, b.cfg.Passphrase, func(w io.Writer) error {
+		_, err := io.Copy(w, f)
+		return err
+	}); err != nil {
+		return err
+	}
+
+	return b.upload(key, tmp)
+}
+
+// writeEncrypted encrypts what write writes into a new file at path, through a temporary file
+// so that a partially written file is never read
+func writeEncrypted(path, passphrase string, write func(io.Writer) error) error {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	if err := func() error {
+		bw := bufio.NewWriter(f)
+
+		ew, err := NewEncryptWriter(bw, passphrase)
+		if err != nil {
+			return err
+		}
+
+		if err := write(ew); err != nil {
+			return err
+		}
+
+		if err := ew.Close(); err != nil {
+			return err
+		}
+
+		if err := bw.Flush(); err != nil {
+			return err
+		}
+
+		return f.Sync()
+	}(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// localSnapshots returns the names of the snapshots in dir, oldest first
+func localSnapshots(dir string) ([]string, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []string{}, nil
+		}
+		return nil, err
+	}
+
+	names := []string{}
+	for _, f := range files {
+		if validName(f.Name()) {
+			names = append(names, f.Name())
+		}
+	}
+
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// s3Snapshots returns the names of the snapshots in the bucket under prefix, oldest first
+func s3Snapshots(s3 *S3, prefix string) ([]string, error) {
+	keys, err := s3.List(prefix + namePrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, k := range keys {
+		name := strings.TrimPrefix(k, prefix)
+		if validName(name) {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	return names, nil
+}
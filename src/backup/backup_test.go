@@ -0,0 +1,147 @@
+package backup
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+func TestBackupRestore(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	require.NoError(t, db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte("deposits"))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("tx1:0"), []byte("done"))
+	}))
+
+	dir, err := ioutil.TempDir("", "teller-backup")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	archiveDir := filepath.Join(dir, "archives")
+	require.NoError(t, os.Mkdir(archiveDir, 0700))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(archiveDir, "deposits-20180304T100000Z.json.gz"), []byte("archive"), 0600))
+	// Partially written archives are not uploaded
+	require.NoError(t, ioutil.WriteFile(filepath.Join(archiveDir, "deposits-20180305T100000Z.json.gz.tmp"), []byte("tmp"), 0600))
+
+	fake, srv := newFakeS3()
+	defer srv.Close()
+	s3 := newTestS3(t, srv.URL)
+
+	log, _ := testutil.NewLogger(t)
+	b, err := NewBackuper(log, db, s3, Config{
+		Dir:        filepath.Join(dir, "backups"),
+		Interval:   time.Hour,
+		Keep:       2,
+		Passphrase: "pass",
+		S3Prefix:   "teller/",
+		S3Keep:     3,
+		ArchiveDir: archiveDir,
+	})
+	require.NoError(t, err)
+
+	now := time.Date(2018, 3, 4, 10, 0, 0, 0, time.UTC)
+	b.now = func() time.Time {
+		return now
+	}
+
+	wait, err := b.untilNextBackup()
+	require.NoError(t, err)
+	require.Equal(t, time.Duration(0), wait)
+
+	var names []string
+	for i := 0; i < 4; i++ {
+		name, err := b.Backup()
+		require.NoError(t, err)
+		require.Equal(t, Name(now), name)
+		names = append(names, name)
+		now = now.Add(time.Hour)
+	}
+
+	wait, err = b.untilNextBackup()
+	require.NoError(t, err)
+	require.Equal(t, time.Duration(0), wait)
+
+	now = now.Add(-time.Minute * 20)
+	wait, err = b.untilNextBackup()
+	require.NoError(t, err)
+	require.Equal(t, time.Minute*20, wait)
+
+	// The oldest snapshots are deleted beyond Keep and S3Keep
+	local, err := b.Snapshots()
+	require.NoError(t, err)
+	require.Equal(t, names[2:], local)
+
+	require.Equal(t, []string{
+		"teller/archives/deposits-20180304T100000Z.json.gz.enc",
+		"teller/" + names[1],
+		"teller/" + names[2],
+		"teller/" + names[3],
+	}, fake.keys())
+
+	// The snapshot is the db, encrypted
+	require.NotContains(t, string(fake.objects["teller/"+names[3]]), "tx1:0")
+
+	// The latest snapshot is restored from the bucket with the archives
+	restoredArchiveDir := filepath.Join(dir, "restored-archives")
+	cfg := RestoreConfig{
+		Dir:        filepath.Join(dir, "none"),
+		Passphrase: "pass",
+		S3:         s3,
+		S3Prefix:   "teller/",
+		ArchiveDir: restoredArchiveDir,
+	}
+
+	outPath := filepath.Join(dir, "restored.db")
+	restored, err := Restore(cfg, "", outPath)
+	require.NoError(t, err)
+	require.Equal(t, names[3], restored.Snapshot)
+	require.Equal(t, []string{"deposits-20180304T100000Z.json.gz"}, restored.Archives)
+
+	rdb, err := bolt.Open(outPath, 0600, nil)
+	require.NoError(t, err)
+	require.NoError(t, rdb.View(func(tx *bolt.Tx) error {
+		require.Equal(t, []byte("done"), tx.Bucket([]byte("deposits")).Get([]byte("tx1:0")))
+		return nil
+	}))
+	require.NoError(t, rdb.Close())
+
+	archive, err := ioutil.ReadFile(filepath.Join(restoredArchiveDir, "deposits-20180304T100000Z.json.gz"))
+	require.NoError(t, err)
+	require.Equal(t, "archive", string(archive))
+
+	// The output is never overwritten
+	_, err = Restore(cfg, "", outPath)
+	require.Error(t, err)
+
+	// A snapshot is restored from the local snapshots by name, without the archives of the bucket
+	cfg.S3 = nil
+	cfg.Dir = b.cfg.Dir
+	restored, err = Restore(cfg, names[2], outPath+"2")
+	require.NoError(t, err)
+	require.Equal(t, names[2], restored.Snapshot)
+	require.Empty(t, restored.Archives)
+
+	_, err = Restore(cfg, names[0], outPath+"3")
+	require.Equal(t, ErrNoSnapshot, err)
+
+	_, err = Restore(cfg, "../restored.db", outPath+"3")
+	require.Equal(t, ErrInvalidName, err)
+
+	cfg.Passphrase = "wrong"
+	_, err = Restore(cfg, "", outPath+"3")
+	require.Equal(t, ErrDecrypt, err)
+	_, err = os.Stat(outPath + "3.tmp")
+	require.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,226 @@
+package backup
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// Encrypted files are a header, magic, version and the salt of the key derivation, followed by chunks of
+// at most chunkSize plaintext bytes. Each chunk is the length of its ciphertext and the AES-256-GCM ciphertext.
+// The nonce of a chunk is its index, and its additional data marks the last chunk,
+// so that chunks can't be reordered, dropped or appended without failing decryption.
+const (
+	magic         = "TELLERBK"
+	version       = 1
+	saltLen       = 16
+	kdfIterations = 200000
+	chunkSize     = 64 * 1024
+)
+
+var (
+	// ErrDecrypt is returned if a file can't be decrypted, because of a wrong passphrase or because it was tampered with
+	ErrDecrypt = errors.New("Decrypt backup failed, wrong passphrase or corrupted backup")
+	// ErrNotEncrypted is returned if a file is not an encrypted backup
+	ErrNotEncrypted = errors.New("Not an encrypted backup")
+	// ErrEmptyPassphrase is returned if the passphrase is empty
+	ErrEmptyPassphrase = errors.New("Empty backup passphrase")
+
+	lastChunk  = []byte{1}
+	otherChunk = []byte{0}
+)
+
+func newAEAD(passphrase string, salt []byte) (cipher.AEAD, error) {
+	if passphrase == "" {
+		return nil, ErrEmptyPassphrase
+	}
+
+	key := pbkdf2.Key([]byte(passphrase), salt, kdfIterations, 32, sha256.New)
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func chunkNonce(aead cipher.AEAD, i uint64) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce[len(nonce)-8:], i)
+	return nonce
+}
+
+type encryptWriter struct {
+	w    io.Writer
+	aead cipher.AEAD
+	buf  []byte
+	i    uint64
+}
+
+// NewEncryptWriter returns a writer that encrypts what is written to it into w, with a key derived from passphrase.
+// It must be closed to write the last chunk, without which the file can't be decrypted. It does not close w.
+func NewEncryptWriter(w io.Writer, passphrase string) (io.WriteCloser, error) {
+	salt := make([]byte, saltLen)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+
+	aead, err := newAEAD(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	header := append([]byte(magic), version)
+	header = append(header, salt...)
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+
+	return &encryptWriter{
+		w:    w,
+		aead: aead,
+		buf:  make([]byte, 0, chunkSize),
+	}, nil
+}
+
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	n := 0
+	for len(p) != 0 {
+		if len(e.buf) == chunkSize {
+			if err := e.writeChunk(otherChunk); err != nil {
+				return n, err
+			}
+		}
+
+		m := copy(e.buf[len(e.buf):chunkSize], p)
+		e.buf = e.buf[:len(e.buf)+m]
+		p = p[m:]
+		n += m
+	}
+
+	return n, nil
+}
+
+func (e *encryptWriter) writeChunk(ad []byte) error {
+	ct := e.aead.Seal(nil, chunkNonce(e.aead, e.i), e.buf, ad)
+
+	var size [4]byte
+	binary.BigEndian.PutUint32(size[:], uint32(len(ct)))
+	if _, err := e.w.Write(size[:]); err != nil {
+		return err
+	}
+
+	if _, err := e.w.Write(ct); err != nil {
+		return err
+	}
+
+	e.i++
+	e.buf = e.buf[:0]
+	return nil
+}
+
+// Close writes the last chunk
+func (e *encryptWriter) Close() error {
+	return e.writeChunk(lastChunk)
+}
+
+type decryptReader struct {
+	r    io.Reader
+	aead cipher.AEAD
+	buf  []byte
+	i    uint64
+	last bool
+}
+
+// NewDecryptReader returns a reader of the plaintext of a file written by an encrypt writer.
+// Reads return ErrDecrypt if the file was tampered with or truncated.
+func NewDecryptReader(r io.Reader, passphrase string) (io.Reader, error) {
+	header := make([]byte, len(magic)+1+saltLen)
+	if _, err := io.ReadFull(r, header); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, ErrNotEncrypted
+		}
+		return nil, err
+	}
+
+	if !bytes.Equal(header[:len(magic)], []byte(magic)) || header[len(magic)] != version {
+		return nil, ErrNotEncrypted
+	}
+
+	aead, err := newAEAD(passphrase, header[len(magic)+1:])
+	if err != nil {
+		return nil, err
+	}
+
+	return &decryptReader{
+		r:    r,
+		aead: aead,
+	}, nil
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.buf) == 0 {
+		if d.last {
+			// Nothing may follow the last chunk
+			var b [1]byte
+			if n, _ := d.r.Read(b[:]); n != 0 {
+				return 0, ErrDecrypt
+			}
+			return 0, io.EOF
+		}
+
+		if err := d.readChunk(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, d.buf)
+	d.buf = d.buf[n:]
+	return n, nil
+}
+
+func (d *decryptReader) readChunk() error {
+	var size [4]byte
+	if _, err := io.ReadFull(d.r, size[:]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			// Truncated before the last chunk
+			return ErrDecrypt
+		}
+		return err
+	}
+
+	n := binary.BigEndian.Uint32(size[:])
+	if n > chunkSize+uint32(d.aead.Overhead()) {
+		return ErrDecrypt
+	}
+
+	ct := make([]byte, n)
+	if _, err := io.ReadFull(d.r, ct); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return ErrDecrypt
+		}
+		return err
+	}
+
+	nonce := chunkNonce(d.aead, d.i)
+	pt, err := d.aead.Open(nil, nonce, ct, otherChunk)
+	if err != nil {
+		pt, err = d.aead.Open(nil, nonce, ct, lastChunk)
+		if err != nil {
+			return ErrDecrypt
+		}
+		d.last = true
+	}
+
+	d.i++
+	d.buf = pt
+	return nil
+}
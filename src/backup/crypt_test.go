@@ -0,0 +1,83 @@
+package backup
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func encrypt(t *testing.T, plaintext []byte, passphrase string) []byte {
+	var buf bytes.Buffer
+	w, err := NewEncryptWriter(&buf, passphrase)
+	require.NoError(t, err)
+
+	// Written in pieces that don't line up with the chunks
+	for p := plaintext; len(p) != 0; {
+		n := 1000
+		if n > len(p) {
+			n = len(p)
+		}
+		_, err := w.Write(p[:n])
+		require.NoError(t, err)
+		p = p[n:]
+	}
+
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func decrypt(ciphertext []byte, passphrase string) ([]byte, error) {
+	r, err := NewDecryptReader(bytes.NewReader(ciphertext), passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(r)
+}
+
+func TestEncrypt(t *testing.T) {
+	for _, size := range []int{0, 1, chunkSize, chunkSize + 1, 3*chunkSize + 100} {
+		plaintext := make([]byte, size)
+		_, err := io.ReadFull(rand.Reader, plaintext)
+		require.NoError(t, err)
+
+		ciphertext := encrypt(t, plaintext, "pass")
+
+		b, err := decrypt(ciphertext, "pass")
+		require.NoError(t, err, size)
+		require.Equal(t, plaintext, append([]byte{}, b...), size)
+
+		_, err = decrypt(ciphertext, "wrong")
+		require.Equal(t, ErrDecrypt, err, size)
+
+		// Truncated at a chunk boundary or within a chunk
+		_, err = decrypt(ciphertext[:len(ciphertext)-1], "pass")
+		require.Equal(t, ErrDecrypt, err, size)
+
+		if size > chunkSize {
+			headerLen := len(magic) + 1 + saltLen
+			firstChunk := headerLen + 4 + chunkSize + 16
+			_, err = decrypt(ciphertext[:firstChunk], "pass")
+			require.Equal(t, ErrDecrypt, err, size)
+		}
+
+		// Appended to
+		_, err = decrypt(append(ciphertext, 0), "pass")
+		require.Equal(t, ErrDecrypt, err, size)
+
+		// Tampered with
+		tampered := append([]byte{}, ciphertext...)
+		tampered[len(tampered)-1] ^= 1
+		_, err = decrypt(tampered, "pass")
+		require.Equal(t, ErrDecrypt, err, size)
+	}
+
+	_, err := decrypt([]byte("not a backup"), "pass")
+	require.Equal(t, ErrNotEncrypted, err)
+
+	_, err = NewEncryptWriter(ioutil.Discard, "")
+	require.Equal(t, ErrEmptyPassphrase, err)
+}
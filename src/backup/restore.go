@@ -0,0 +1,229 @@
+package backup
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// RestoreConfig configures Restore
+type RestoreConfig struct {
+	// Directory of the local snapshots, read if S3 is nil
+	Dir        string
+	Passphrase string
+	// Bucket the snapshots and the deposit archives are fetched from, nil to read the local snapshots
+	S3       *S3
+	S3Prefix string
+	// Directory the deposit archives missing from it are fetched to from the bucket. Empty to not fetch them.
+	ArchiveDir string
+}
+
+// Restored describes a restore
+type Restored struct {
+	Snapshot string
+	// Names of the deposit archives fetched from the bucket
+	Archives []string
+}
+
+// Restore decrypts a snapshot into a new db at outPath and verifies the db, and fetches the deposit archives
+// missing from cfg.ArchiveDir. name is the name of the snapshot, the latest one if empty.
+// The snapshot is fetched from the bucket if cfg.S3 is set, otherwise it is read from cfg.Dir.
+func Restore(cfg RestoreConfig, name, outPath string) (*Restored, error) {
+	if _, err := os.Stat(outPath); !os.IsNotExist(err) {
+		return nil, fmt.Errorf("%s already exists", outPath)
+	}
+
+	if name == "" {
+		var names []string
+		var err error
+		if cfg.S3 != nil {
+			names, err = s3Snapshots(cfg.S3, cfg.S3Prefix)
+		} else {
+			names, err = localSnapshots(cfg.Dir)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if len(names) == 0 {
+			return nil, ErrNoSnapshot
+		}
+
+		name = names[len(names)-1]
+	} else if !validName(name) {
+		return nil, ErrInvalidName
+	}
+
+	var r io.ReadCloser
+	var err error
+	if cfg.S3 != nil {
+		r, err = cfg.S3.Get(cfg.S3Prefix + name)
+		if err == ErrObjectNotFound {
+			err = ErrNoSnapshot
+		}
+	} else {
+		r, err = os.Open(filepath.Join(cfg.Dir, name))
+		if os.IsNotExist(err) {
+			err = ErrNoSnapshot
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	if err := restoreDB(r, cfg.Passphrase, outPath); err != nil {
+		return nil, err
+	}
+
+	restored := &Restored{
+		Snapshot: name,
+		Archives: []string{},
+	}
+
+	if cfg.S3 != nil && cfg.ArchiveDir != "" {
+		restored.Archives, err = fetchArchives(cfg)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return restored, nil
+}
+
+// restoreDB decrypts and decompresses a snapshot into a temporary file, checks the db, and renames it to outPath
+func restoreDB(r io.Reader, passphrase, outPath string) error {
+	tmp := outPath + ".tmp"
+	if err := writeDecrypted(r, passphrase, tmp, func(w io.Writer, r io.Reader) error {
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return err
+		}
+
+		if _, err := io.Copy(w, zr); err != nil {
+			return err
+		}
+
+		return zr.Close()
+	}); err != nil {
+		return err
+	}
+
+	if err := checkDB(tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return os.Rename(tmp, outPath)
+}
+
+// checkDB opens the db at path read-only and checks the consistency of its pages
+func checkDB(path string) error {
+	db, err := bolt.Open(path, 0600, &bolt.Options{
+		Timeout:  1 * time.Second,
+		ReadOnly: true,
+	})
+	if err != nil {
+		return fmt.Errorf("Open restored db failed: %v", err)
+	}
+	defer db.Close()
+
+	return db.View(func(tx *bolt.Tx) error {
+		for err := range tx.Check() {
+			return fmt.Errorf("Restored db is corrupted: %v", err)
+		}
+		return nil
+	})
+}
+
+// fetchArchives decrypts the deposit archives of the bucket that are missing from cfg.ArchiveDir into it
+func fetchArchives(cfg RestoreConfig) ([]string, error) {
+	if err := os.MkdirAll(cfg.ArchiveDir, 0700); err != nil {
+		return nil, err
+	}
+
+	prefix := cfg.S3Prefix + archivesPrefix
+	keys, err := cfg.S3.List(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	fetched := []string{}
+	for _, k := range keys {
+		name := strings.TrimSuffix(strings.TrimPrefix(k, prefix), encSuffix)
+		if name == "" || strings.ContainsAny(name, `/\`) || !strings.HasSuffix(k, encSuffix) {
+			continue
+		}
+
+		path := filepath.Join(cfg.ArchiveDir, name)
+		if _, err := os.Stat(path); err == nil {
+			continue
+		}
+
+		if err := fetchArchive(cfg, k, path); err != nil {
+			return nil, err
+		}
+
+		fetched = append(fetched, name)
+	}
+
+	return fetched, nil
+}
+
+func fetchArchive(cfg RestoreConfig, key, path string) error {
+	r, err := cfg.S3.Get(key)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	tmp := path + ".tmp"
+	if err := writeDecrypted(r, cfg.Passphrase, tmp, func(w io.Writer, r io.Reader) error {
+		_, err := io.Copy(w, r)
+		return err
+	}); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// writeDecrypted decrypts r and writes what write reads from it to a new file at path
+func writeDecrypted(r io.Reader, passphrase, path string, write func(io.Writer, io.Reader) error) error {
+	dr, err := NewDecryptReader(bufio.NewReader(r), passphrase)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	if err := func() error {
+		bw := bufio.NewWriter(f)
+
+		if err := write(bw, dr); err != nil {
+			return err
+		}
+
+		if err := bw.Flush(); err != nil {
+			return err
+		}
+
+		return f.Sync()
+	}(); err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,334 @@
+package backup
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	s3Timeout = time.Minute * 10
+	// Payload hash of the requests whose body is not signed, e.g. uploads streamed from a file
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+	// Hash of an empty payload
+	emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	amzDateFormat    = "20060102T150405Z"
+)
+
+// ErrObjectNotFound is returned if an object is not in the bucket
+var ErrObjectNotFound = errors.New("Object not found in the bucket")
+
+// S3Config configures an S3 client
+type S3Config struct {
+	// URL of the S3 API, e.g. https://s3.amazonaws.com, or of an S3-compatible service
+	Endpoint        string
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+}
+
+// S3 is a client of the objects of a bucket of an S3-compatible service.
+// It addresses the bucket in the path, which every S3-compatible service supports,
+// and signs the requests with AWS Signature Version 4.
+type S3 struct {
+	cfg      S3Config
+	endpoint *url.URL
+	client   *http.Client
+	now      func() time.Time
+}
+
+// NewS3 creates an S3 client
+func NewS3(cfg S3Config) (*S3, error) {
+	u, err := url.Parse(cfg.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("s3 endpoint invalid: %v", err)
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return nil, errors.New("s3 endpoint must be an http or https URL")
+	}
+
+	if cfg.Bucket == "" {
+		return nil, errors.New("s3 bucket is empty")
+	}
+
+	return &S3{
+		cfg:      cfg,
+		endpoint: u,
+		client: &http.Client{
+			Timeout: s3Timeout,
+		},
+		now: time.Now,
+	}, nil
+}
+
+// S3Error is an error response of the S3 API
+type S3Error struct {
+	StatusCode int
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+}
+
+func (e S3Error) Error() string {
+	return fmt.Sprintf("s3 request failed with status %d: %s %s", e.StatusCode, e.Code, e.Message)
+}
+
+// isNotFound returns true if err is a 404 response, e.g. of a missing key
+func isNotFound(err error) bool {
+	s3Err, ok := err.(S3Error)
+	return ok && s3Err.StatusCode == http.StatusNotFound
+}
+
+func (s *S3) objectURL(key string, query url.Values) *url.URL {
+	u := *s.endpoint
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + s.cfg.Bucket
+	if key != "" {
+		u.Path += "/" + key
+	}
+	u.RawPath = ""
+	u.RawQuery = query.Encode()
+	return &u
+}
+
+func (s *S3) do(method string, u *url.URL, body io.Reader, size int64) (*http.Response, error) {
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	payloadHash := emptyPayloadHash
+	if body != nil {
+		req.ContentLength = size
+		payloadHash = unsignedPayload
+	}
+
+	signRequest(req, s.cfg, payloadHash, s.now())
+
+	rsp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if rsp.StatusCode >= 200 && rsp.StatusCode < 300 {
+		return rsp, nil
+	}
+
+	defer rsp.Body.Close()
+
+	s3Err := S3Error{}
+	b, _ := ioutil.ReadAll(io.LimitReader(rsp.Body, 64*1024))
+	xml.Unmarshal(b, &s3Err) // nolint: errcheck
+	s3Err.StatusCode = rsp.StatusCode
+	return nil, s3Err
+}
+
+// Put uploads size bytes of r to key
+func (s *S3) Put(key string, r io.Reader, size int64) error {
+	rsp, err := s.do(http.MethodPut, s.objectURL(key, nil), r, size)
+	if err != nil {
+		return err
+	}
+	return rsp.Body.Close()
+}
+
+// Get returns the content of key, which must be closed. Returns ErrObjectNotFound if there is no such key.
+func (s *S3) Get(key string) (io.ReadCloser, error) {
+	rsp, err := s.do(http.MethodGet, s.objectURL(key, nil), nil, 0)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, ErrObjectNotFound
+		}
+		return nil, err
+	}
+	return rsp.Body, nil
+}
+
+// Delete deletes key
+func (s *S3) Delete(key string) error {
+	rsp, err := s.do(http.MethodDelete, s.objectURL(key, nil), nil, 0)
+	if err != nil {
+		if isNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	return rsp.Body.Close()
+}
+
+type listBucketResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// List returns the keys that start with prefix, sorted
+func (s *S3) List(prefix string) ([]string, error) {
+	keys := []string{}
+	token := ""
+	for {
+		query := url.Values{}
+		query.Set("list-type", "2")
+		query.Set("prefix", prefix)
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		rsp, err := s.do(http.MethodGet, s.objectURL("", query), nil, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		var res listBucketResult
+		err = xml.NewDecoder(rsp.Body).Decode(&res)
+		rsp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, c := range res.Contents {
+			keys = append(keys, c.Key)
+		}
+
+		if !res.IsTruncated || res.NextContinuationToken == "" {
+			break
+		}
+		token = res.NextContinuationToken
+	}
+
+	sort.Strings(keys)
+
+	return keys, nil
+}
+
+// signRequest adds the AWS Signature Version 4 authorization headers to req
+func signRequest(req *http.Request, cfg S3Config, payloadHash string, t time.Time) {
+	t = t.UTC()
+	amzDate := t.Format(amzDateFormat)
+	date := t.Format("20060102")
+
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+
+	host := req.URL.Host
+	if req.Host != "" {
+		host = req.Host
+	}
+
+	headers := map[string]string{
+		"host": host,
+	}
+	for k := range req.Header {
+		lk := strings.ToLower(k)
+		if lk == "host" || lk == "content-type" || strings.HasPrefix(lk, "x-amz-") || lk == "range" {
+			headers[lk] = strings.TrimSpace(req.Header.Get(k))
+		}
+	}
+
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders bytes.Buffer
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		uriEncode(req.URL.EscapedPath(), false),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + cfg.Region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hexSHA256([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+cfg.SecretAccessKey), date)
+	key = hmacSHA256(key, cfg.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		cfg.AccessKeyID, scope, signedHeaders, signature))
+}
+
+// canonicalQuery returns the query sorted by key, with the keys and values URI-encoded
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, k := range keys {
+		vs := query[k]
+		sort.Strings(vs)
+		for _, v := range vs {
+			parts = append(parts, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+
+	return strings.Join(parts, "&")
+}
+
+// uriEncode encodes every byte of s except the unreserved characters, and "/" unless encodeSlash.
+// The escaped path of a URL is unescaped first, so that it is not encoded twice.
+func uriEncode(s string, encodeSlash bool) string {
+	if !encodeSlash {
+		if u, err := url.PathUnescape(s); err == nil {
+			s = u
+		}
+	}
+
+	var b bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z', c >= '0' && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data)) // nolint: errcheck
+	return h.Sum(nil)
+}
+
+func hexSHA256(b []byte) string {
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
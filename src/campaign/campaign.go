@@ -0,0 +1,492 @@
+// Package campaign manages the token sale campaigns run from one teller. A campaign has its own
+// deposit address pools, exchange rates, SKY cap and enabled flag. Deposit addresses are bound for
+// a campaign, and their deposits are partitioned by it.
+package campaign
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/sirupsen/logrus"
+
+	"github.com/skycoin/skycoin/src/util/droplet"
+
+	"github.com/skycoin/teller/src/addrs"
+	"github.com/skycoin/teller/src/exchange"
+	"github.com/skycoin/teller/src/scanner"
+	"github.com/skycoin/teller/src/util/dbcrypt"
+	"github.com/skycoin/teller/src/util/dbutil"
+)
+
+var (
+	// Campaigns, campaign ID as key
+	campaignsBkt = []byte("campaigns")
+
+	// Deposit addresses of the campaign pools, "<campaign ID>/<coin type>" as key, address array as value,
+	// encrypted if encryption is enabled. The addresses given out are in the used address buckets of the addrs package.
+	campaignAddrsBkt = []byte("campaign_addrs")
+)
+
+var idRe = regexp.MustCompile("^[a-z0-9_-]{1,64}$")
+
+var (
+	// ErrNotFound is returned if a campaign does not exist
+	ErrNotFound = errors.New("Campaign not found")
+	// ErrExists is returned by Create if a campaign with the ID exists
+	ErrExists = errors.New("Campaign already exists")
+	// ErrInvalidID is returned if a campaign ID is not 1 to 64 lowercase letters, digits, - or _
+	ErrInvalidID = errors.New("Invalid campaign ID, must be 1 to 64 lowercase letters, digits, - or _")
+	// ErrMissingName is returned if a campaign has no name
+	ErrMissingName = errors.New("Missing campaign name")
+	// ErrInvalidRate is returned if a rate of a campaign is invalid
+	ErrInvalidRate = errors.New("Invalid campaign rate")
+	// ErrInvalidMaxSky is returned if the SKY cap of a campaign is invalid
+	ErrInvalidMaxSky = errors.New("Invalid campaign max_sky")
+	// ErrDisabled is returned when binding for a disabled campaign
+	ErrDisabled = errors.New("Campaign is disabled")
+	// ErrCapReached is returned when binding for a campaign that has sold its maximum SKY
+	ErrCapReached = errors.New("Campaign has sold its maximum SKY")
+	// ErrAddressInPool is returned when adding an address that is already in the pool of a campaign
+	ErrAddressInPool = errors.New("Deposit address is already in a campaign pool")
+)
+
+// Campaign is a token sale with its own deposit addresses, rates and cap
+type Campaign struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+	// SKY rates of coin types, decimal strings. Coin types without a rate are converted at the default rates.
+	Rates map[string]string `json:"rates,omitempty"`
+	// Maximum SKY sold by the deposits of the campaign, decimal string. Empty for no cap.
+	MaxSky    string `json:"max_sky,omitempty"`
+	CreatedAt int64  `json:"created_at"`
+	UpdatedAt int64  `json:"updated_at"`
+}
+
+// Validate returns an error if the campaign is invalid. coinTypes are the accepted coin types.
+func (c Campaign) Validate(coinTypes []string) error {
+	if !idRe.MatchString(c.ID) {
+		return ErrInvalidID
+	}
+
+	if c.Name == "" {
+		return ErrMissingName
+	}
+
+	for coinType, rate := range c.Rates {
+		if !hasCoinType(coinTypes, coinType) {
+			return scanner.ErrUnsupportedCoinType
+		}
+
+		if _, err := exchange.ParseRate(rate); err != nil {
+			return ErrInvalidRate
+		}
+	}
+
+	if c.MaxSky != "" {
+		if _, err := droplet.FromString(c.MaxSky); err != nil {
+			return ErrInvalidMaxSky
+		}
+	}
+
+	return nil
+}
+
+// MaxDroplets returns the SKY cap of the campaign in droplets, 0 if it has no cap
+func (c Campaign) MaxDroplets() (uint64, error) {
+	if c.MaxSky == "" {
+		return 0, nil
+	}
+	return droplet.FromString(c.MaxSky)
+}
+
+func hasCoinType(coinTypes []string, coinType string) bool {
+	for _, ct := range coinTypes {
+		if ct == coinType {
+			return true
+		}
+	}
+	return false
+}
+
+// Manager stores the campaigns and gives out the deposit addresses of their pools
+type Manager struct {
+	log       logrus.FieldLogger
+	db        *bolt.DB
+	c         *dbcrypt.Cipher
+	coinTypes []string
+	lock      sync.RWMutex                       // guards pools, and serializes the changes of campaigns
+	pools     map[string]map[string]*addrs.Addrs // address pools by campaign ID and coin type
+	checker   *addrs.ConflictChecker
+	now       func() time.Time
+}
+
+// NewManager creates a Manager, and loads the address pools of the campaigns.
+// coinTypes are the accepted coin types, e.g. BTC, LTC and the ERC20 token symbols.
+// c encrypts the address pools, nil to store them as they are.
+func NewManager(log logrus.FieldLogger, db *bolt.DB, c *dbcrypt.Cipher, coinTypes []string) (*Manager, error) {
+	if db == nil {
+		return nil, errors.New("new campaign Manager failed, db is nil")
+	}
+
+	if err := db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(campaignsBkt); err != nil {
+			return dbutil.NewCreateBucketFailedErr(campaignsBkt, err)
+		}
+
+		if _, err := tx.CreateBucketIfNotExists(campaignAddrsBkt); err != nil {
+			return dbutil.NewCreateBucketFailedErr(campaignAddrsBkt, err)
+		}
+
+		return c.MigrateTx(tx, campaignAddrsBkt, func(k, v []byte) ([]byte, []byte, error) {
+			v, err := c.Encrypt(v)
+			return k, v, err
+		})
+	}); err != nil {
+		return nil, err
+	}
+
+	m := &Manager{
+		log:       log.WithField("prefix", "campaign"),
+		db:        db,
+		c:         c,
+		coinTypes: coinTypes,
+		pools:     make(map[string]map[string]*addrs.Addrs),
+		now:       time.Now,
+	}
+
+	pools, err := m.poolAddresses()
+	if err != nil {
+		return nil, err
+	}
+
+	for key, addresses := range pools {
+		id, coinType := splitPoolKey(key)
+		if err := m.loadPool(id, coinType, addresses); err != nil {
+			return nil, fmt.Errorf("Load address pool %s failed: %v", key, err)
+		}
+	}
+
+	return m, nil
+}
+
+func poolKey(id, coinType string) string {
+	return id + "/" + coinType
+}
+
+func splitPoolKey(key string) (string, string) {
+	i := strings.Index(key, "/")
+	return key[:i], key[i+1:]
+}
+
+// poolAddresses returns the addresses of all pools, by pool key
+func (m *Manager) poolAddresses() (map[string][]string, error) {
+	pools := make(map[string][]string)
+	err := m.db.View(func(tx *bolt.Tx) error {
+		return dbutil.ForEach(tx, campaignAddrsBkt, func(k, v []byte) error {
+			v, err := m.c.Decrypt(v)
+			if err != nil {
+				return fmt.Errorf("decrypt campaign addresses failed: %v", err)
+			}
+
+			var addresses []string
+			if err := json.Unmarshal(v, &addresses); err != nil {
+				return fmt.Errorf("decode campaign addresses failed: %v", err)
+			}
+
+			pools[string(k)] = addresses
+			return nil
+		})
+	})
+	return pools, err
+}
+
+// loadPool creates the address pool of a coin type of a campaign. Must be called with the lock held.
+func (m *Manager) loadPool(id, coinType string, addresses []string) error {
+	var pool *addrs.Addrs
+	var err error
+	switch coinType {
+	case scanner.CoinTypeBTC:
+		pool, err = addrs.NewBTCPoolAddrs(m.log, m.db, m.c, addresses)
+	case scanner.CoinTypeLTC:
+		pool, err = addrs.NewLTCPoolAddrs(m.log, m.db, m.c, addresses)
+	default:
+		// ERC20 tokens are deposited to ethereum addresses
+		pool, err = addrs.NewETHPoolAddrs(m.log, m.db, m.c, addresses)
+	}
+	if err != nil {
+		return err
+	}
+
+	if m.pools[id] == nil {
+		m.pools[id] = make(map[string]*addrs.Addrs)
+	}
+	m.pools[id][coinType] = pool
+
+	return nil
+}
+
+// Create creates a campaign
+func (m *Manager) Create(c Campaign) (Campaign, error) {
+	if err := c.Validate(m.coinTypes); err != nil {
+		return Campaign{}, err
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	now := m.now().UTC().Unix()
+	c.CreatedAt = now
+	c.UpdatedAt = now
+
+	if err := m.db.Update(func(tx *bolt.Tx) error {
+		if exists, err := dbutil.BucketHasKey(tx, campaignsBkt, c.ID); err != nil {
+			return err
+		} else if exists {
+			return ErrExists
+		}
+
+		return dbutil.PutBucketValue(tx, campaignsBkt, c.ID, c)
+	}); err != nil {
+		return Campaign{}, err
+	}
+
+	return c, nil
+}
+
+// Update changes the name, enabled flag, rates and SKY cap of a campaign to those of c
+func (m *Manager) Update(c Campaign) (Campaign, error) {
+	if err := c.Validate(m.coinTypes); err != nil {
+		return Campaign{}, err
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	var updated Campaign
+	if err := m.db.Update(func(tx *bolt.Tx) error {
+		if err := getCampaignTx(tx, c.ID, &updated); err != nil {
+			return err
+		}
+
+		updated.Name = c.Name
+		updated.Enabled = c.Enabled
+		updated.Rates = c.Rates
+		updated.MaxSky = c.MaxSky
+		updated.UpdatedAt = m.now().UTC().Unix()
+
+		return dbutil.PutBucketValue(tx, campaignsBkt, c.ID, updated)
+	}); err != nil {
+		return Campaign{}, err
+	}
+
+	return updated, nil
+}
+
+func getCampaignTx(tx *bolt.Tx, id string, c *Campaign) error {
+	if err := dbutil.GetBucketObject(tx, campaignsBkt, id, c); err != nil {
+		switch err.(type) {
+		case dbutil.ObjectNotExistErr:
+			return ErrNotFound
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Get returns a campaign. Returns ErrNotFound if it does not exist.
+func (m *Manager) Get(id string) (Campaign, error) {
+	var c Campaign
+	err := m.db.View(func(tx *bolt.Tx) error {
+		return getCampaignTx(tx, id, &c)
+	})
+	return c, err
+}
+
+// Campaigns returns all campaigns, ordered by creation time
+func (m *Manager) Campaigns() ([]Campaign, error) {
+	var cs []Campaign
+	if err := m.db.View(func(tx *bolt.Tx) error {
+		return dbutil.ForEach(tx, campaignsBkt, func(k, v []byte) error {
+			var c Campaign
+			if err := json.Unmarshal(v, &c); err != nil {
+				return fmt.Errorf("decode campaign failed: %v", err)
+			}
+
+			cs = append(cs, c)
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(cs, func(i, j int) bool {
+		return cs[i].CreatedAt < cs[j].CreatedAt
+	})
+
+	return cs, nil
+}
+
+// Rate returns the SKY rate of a coin type in a campaign, or the empty string if the campaign has no rate
+// of its own for it. Implements exchange.CampaignRater.
+func (m *Manager) Rate(id, coinType string) (string, error) {
+	c, err := m.Get(id)
+	if err != nil {
+		return "", err
+	}
+	return c.Rates[coinType], nil
+}
+
+// AddAddresses adds deposit addresses of a coin type to the pool of a campaign.
+// Addresses that are in the pool of a campaign already are rejected with ErrAddressInPool.
+// If a ConflictChecker is set, addresses that are in any other pool or bound already are rejected
+// with an addrs.AddressConflictErr.
+// Returns the number of addresses remaining in the pool.
+func (m *Manager) AddAddresses(id, coinType string, addresses []string) (uint64, error) {
+	if !hasCoinType(m.coinTypes, coinType) {
+		return 0, scanner.ErrUnsupportedCoinType
+	}
+
+	// The checker lists the pools of the campaigns, so it is called without the lock held
+	m.lock.RLock()
+	checker := m.checker
+	m.lock.RUnlock()
+
+	if checker != nil {
+		if err := checker.CheckNew(addresses); err != nil {
+			return 0, err
+		}
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if _, err := m.Get(id); err != nil {
+		return 0, err
+	}
+
+	pools, err := m.poolAddresses()
+	if err != nil {
+		return 0, err
+	}
+
+	inPool := make(map[string]struct{})
+	for _, addresses := range pools {
+		for _, a := range addresses {
+			inPool[strings.ToLower(a)] = struct{}{}
+		}
+	}
+
+	for _, a := range addresses {
+		if _, ok := inPool[strings.ToLower(a)]; ok {
+			return 0, ErrAddressInPool
+		}
+	}
+
+	key := poolKey(id, coinType)
+	all := append(pools[key], addresses...)
+
+	// The pool verifies the addresses before they are saved
+	if err := m.loadPool(id, coinType, all); err != nil {
+		return 0, err
+	}
+
+	v, err := json.Marshal(all)
+	if err != nil {
+		return 0, err
+	}
+
+	v, err = m.c.Encrypt(v)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := m.db.Update(func(tx *bolt.Tx) error {
+		return dbutil.PutBucketValue(tx, campaignAddrsBkt, key, v)
+	}); err != nil {
+		return 0, err
+	}
+
+	return m.pools[id][coinType].Remaining(), nil
+}
+
+// SetConflictChecker sets the ConflictChecker that AddAddresses checks the addresses with,
+// against the pools of other coin types and the bound addresses
+func (m *Manager) SetConflictChecker(c *addrs.ConflictChecker) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.checker = c
+}
+
+// Pools returns the address pools of the campaigns. Implements addrs.PoolLister.
+func (m *Manager) Pools() []addrs.Pool {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	var pools []addrs.Pool
+	for id, coinTypes := range m.pools {
+		for coinType, pool := range coinTypes {
+			pools = append(pools, addrs.Pool{
+				Name:  fmt.Sprintf("campaign %s %s", id, coinType),
+				Addrs: pool,
+			})
+		}
+	}
+
+	sort.Slice(pools, func(i, j int) bool {
+		return pools[i].Name < pools[j].Name
+	})
+
+	return pools
+}
+
+// NewAddress returns a new deposit address of a coin type from the pool of a campaign.
+// Returns addrs.ErrDepositAddressEmpty if the campaign has no addresses of the coin type left.
+func (m *Manager) NewAddress(id, coinType string) (string, error) {
+	m.lock.RLock()
+	pool := m.pools[id][coinType]
+	m.lock.RUnlock()
+
+	if pool == nil {
+		return "", addrs.ErrDepositAddressEmpty
+	}
+
+	return pool.NewAddress()
+}
+
+// Release returns a used deposit address to the pool of a campaign that it came from.
+// Returns addrs.ErrAddressNotInPool if no pool of the campaign has the address.
+func (m *Manager) Release(id, addr string) error {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	for _, pool := range m.pools[id] {
+		if err := pool.Release(addr); err != addrs.ErrAddressNotInPool {
+			return err
+		}
+	}
+
+	return addrs.ErrAddressNotInPool
+}
+
+// Remaining returns the number of deposit addresses left in the pools of a campaign, by coin type
+func (m *Manager) Remaining(id string) map[string]uint64 {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	remaining := make(map[string]uint64, len(m.pools[id]))
+	for coinType, pool := range m.pools[id] {
+		remaining[coinType] = pool.Remaining()
+	}
+
+	return remaining
+}
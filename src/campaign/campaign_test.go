@@ -0,0 +1,255 @@
+package campaign
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/addrs"
+	"github.com/skycoin/teller/src/scanner"
+	"github.com/skycoin/teller/src/util/dbcrypt"
+	"github.com/skycoin/teller/src/util/dbutil"
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+var testCoinTypes = []string{scanner.CoinTypeBTC, scanner.CoinTypeLTC}
+
+func TestManager(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	log, _ := testutil.NewLogger(t)
+
+	m, err := NewManager(log, db, nil, testCoinTypes)
+	require.NoError(t, err)
+
+	m.now = func() time.Time {
+		return time.Unix(1500000000, 0)
+	}
+
+	c, err := m.Create(Campaign{
+		ID:      "spring-sale",
+		Name:    "Spring sale",
+		Enabled: true,
+		Rates: map[string]string{
+			scanner.CoinTypeBTC: "600",
+		},
+		MaxSky: "1000",
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(1500000000), c.CreatedAt)
+
+	_, err = m.Create(Campaign{ID: "spring-sale", Name: "Again"})
+	require.Equal(t, ErrExists, err)
+
+	_, err = m.Create(Campaign{ID: "Bad ID", Name: "Bad"})
+	require.Equal(t, ErrInvalidID, err)
+
+	_, err = m.Create(Campaign{ID: "noname"})
+	require.Equal(t, ErrMissingName, err)
+
+	_, err = m.Create(Campaign{ID: "badrate", Name: "Bad rate", Rates: map[string]string{scanner.CoinTypeBTC: "x"}})
+	require.Equal(t, ErrInvalidRate, err)
+
+	_, err = m.Create(Campaign{ID: "badcoin", Name: "Bad coin", Rates: map[string]string{"DOGE": "1"}})
+	require.Equal(t, scanner.ErrUnsupportedCoinType, err)
+
+	_, err = m.Create(Campaign{ID: "badcap", Name: "Bad cap", MaxSky: "-1"})
+	require.Equal(t, ErrInvalidMaxSky, err)
+
+	rate, err := m.Rate("spring-sale", scanner.CoinTypeBTC)
+	require.NoError(t, err)
+	require.Equal(t, "600", rate)
+
+	rate, err = m.Rate("spring-sale", scanner.CoinTypeLTC)
+	require.NoError(t, err)
+	require.Equal(t, "", rate)
+
+	_, err = m.Rate("missing", scanner.CoinTypeBTC)
+	require.Equal(t, ErrNotFound, err)
+
+	max, err := c.MaxDroplets()
+	require.NoError(t, err)
+	require.Equal(t, uint64(1000e6), max)
+
+	// Update
+	c.Enabled = false
+	c.Name = "Spring"
+	c.Rates = nil
+	c.MaxSky = ""
+	c.CreatedAt = 0
+	updated, err := m.Update(c)
+	require.NoError(t, err)
+	require.False(t, updated.Enabled)
+	require.Equal(t, "Spring", updated.Name)
+	require.Empty(t, updated.Rates)
+	require.Equal(t, int64(1500000000), updated.CreatedAt)
+
+	_, err = m.Update(Campaign{ID: "missing", Name: "Missing"})
+	require.Equal(t, ErrNotFound, err)
+
+	cs, err := m.Campaigns()
+	require.NoError(t, err)
+	require.Equal(t, []Campaign{updated}, cs)
+}
+
+func TestManagerAddresses(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	log, _ := testutil.NewLogger(t)
+
+	m, err := NewManager(log, db, nil, testCoinTypes)
+	require.NoError(t, err)
+
+	_, err = m.Create(Campaign{ID: "a", Name: "A"})
+	require.NoError(t, err)
+	_, err = m.Create(Campaign{ID: "b", Name: "B"})
+	require.NoError(t, err)
+
+	_, err = m.NewAddress("a", scanner.CoinTypeBTC)
+	require.Equal(t, addrs.ErrDepositAddressEmpty, err)
+
+	_, err = m.AddAddresses("missing", scanner.CoinTypeBTC, []string{"1PZ63K3G4gZP6A6E2TTbBwxT5bFQGL2TLB"})
+	require.Equal(t, ErrNotFound, err)
+
+	_, err = m.AddAddresses("a", "DOGE", []string{"1PZ63K3G4gZP6A6E2TTbBwxT5bFQGL2TLB"})
+	require.Equal(t, scanner.ErrUnsupportedCoinType, err)
+
+	_, err = m.AddAddresses("a", scanner.CoinTypeBTC, []string{"bad"})
+	require.Error(t, err)
+
+	n, err := m.AddAddresses("a", scanner.CoinTypeBTC, []string{
+		"1PZ63K3G4gZP6A6E2TTbBwxT5bFQGL2TLB",
+		"14FG8vQnmK6B7YbLSr6uC5wfGY78JFNCYg",
+	})
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), n)
+
+	// An address can only be in one pool
+	_, err = m.AddAddresses("b", scanner.CoinTypeBTC, []string{"14FG8vQnmK6B7YbLSr6uC5wfGY78JFNCYg"})
+	require.Equal(t, ErrAddressInPool, err)
+
+	addr, err := m.NewAddress("a", scanner.CoinTypeBTC)
+	require.NoError(t, err)
+	require.Equal(t, "1PZ63K3G4gZP6A6E2TTbBwxT5bFQGL2TLB", addr)
+
+	require.Equal(t, map[string]uint64{scanner.CoinTypeBTC: 1}, m.Remaining("a"))
+	require.Equal(t, map[string]uint64{}, m.Remaining("b"))
+
+	// The pools are loaded again without the used addresses
+	m, err = NewManager(log, db, nil, testCoinTypes)
+	require.NoError(t, err)
+	require.Equal(t, map[string]uint64{scanner.CoinTypeBTC: 1}, m.Remaining("a"))
+
+	addr, err = m.NewAddress("a", scanner.CoinTypeBTC)
+	require.NoError(t, err)
+	require.Equal(t, "14FG8vQnmK6B7YbLSr6uC5wfGY78JFNCYg", addr)
+
+	_, err = m.NewAddress("a", scanner.CoinTypeBTC)
+	require.Equal(t, addrs.ErrDepositAddressEmpty, err)
+
+	// Released addresses go back to the pool they came from
+	require.Equal(t, addrs.ErrAddressNotInPool, m.Release("b", addr))
+	require.NoError(t, m.Release("a", addr))
+	require.Equal(t, map[string]uint64{scanner.CoinTypeBTC: 1}, m.Remaining("a"))
+
+	addr2, err := m.NewAddress("a", scanner.CoinTypeBTC)
+	require.NoError(t, err)
+	require.Equal(t, addr, addr2)
+}
+
+type fakeBindings map[string]string
+
+func (b fakeBindings) GetBoundAddresses() (map[string]string, error) {
+	return b, nil
+}
+
+func TestManagerConflictChecker(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	log, _ := testutil.NewLogger(t)
+
+	m, err := NewManager(log, db, nil, testCoinTypes)
+	require.NoError(t, err)
+
+	_, err = m.Create(Campaign{ID: "a", Name: "A"})
+	require.NoError(t, err)
+
+	_, err = m.AddAddresses("a", scanner.CoinTypeBTC, []string{"1PZ63K3G4gZP6A6E2TTbBwxT5bFQGL2TLB"})
+	require.NoError(t, err)
+
+	pools := m.Pools()
+	require.Len(t, pools, 1)
+	require.Equal(t, "campaign a BTC", pools[0].Name)
+
+	m.SetConflictChecker(addrs.NewConflictChecker(fakeBindings{"14FG8vQnmK6B7YbLSr6uC5wfGY78JFNCYg": "sky1"}, m))
+
+	// Bound addresses and addresses in a pool are rejected
+	_, err = m.AddAddresses("a", scanner.CoinTypeBTC, []string{"14FG8vQnmK6B7YbLSr6uC5wfGY78JFNCYg", "1PZ63K3G4gZP6A6E2TTbBwxT5bFQGL2TLB"})
+	require.Equal(t, addrs.AddressConflictErr{
+		Conflicts: []addrs.AddressConflict{
+			{Address: "14FG8vQnmK6B7YbLSr6uC5wfGY78JFNCYg", SkyAddress: "sky1"},
+			{Address: "1PZ63K3G4gZP6A6E2TTbBwxT5bFQGL2TLB", Pools: []string{"campaign a BTC"}},
+		},
+	}, err)
+
+	n, err := m.AddAddresses("a", scanner.CoinTypeBTC, []string{"1JNonvXRyZvZ4ZJ9PE8voyo67UQN1TpoGy"})
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), n)
+}
+
+func TestManagerEncrypted(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	log, _ := testutil.NewLogger(t)
+
+	// A pool saved before encryption was enabled
+	m, err := NewManager(log, db, nil, testCoinTypes)
+	require.NoError(t, err)
+
+	_, err = m.Create(Campaign{ID: "a", Name: "A"})
+	require.NoError(t, err)
+
+	_, err = m.AddAddresses("a", scanner.CoinTypeBTC, []string{
+		"1PZ63K3G4gZP6A6E2TTbBwxT5bFQGL2TLB",
+		"14FG8vQnmK6B7YbLSr6uC5wfGY78JFNCYg",
+	})
+	require.NoError(t, err)
+
+	addr, err := m.NewAddress("a", scanner.CoinTypeBTC)
+	require.NoError(t, err)
+	require.Equal(t, "1PZ63K3G4gZP6A6E2TTbBwxT5bFQGL2TLB", addr)
+
+	c, err := dbcrypt.Open(db, "secret")
+	require.NoError(t, err)
+
+	m, err = NewManager(log, db, c, testCoinTypes)
+	require.NoError(t, err)
+	require.Equal(t, map[string]uint64{scanner.CoinTypeBTC: 1}, m.Remaining("a"))
+
+	_, err = m.AddAddresses("a", scanner.CoinTypeBTC, []string{"1JNonvXRyZvZ4ZJ9PE8voyo67UQN1TpoGy"})
+	require.NoError(t, err)
+
+	// The pools are not stored as they are
+	err = db.View(func(tx *bolt.Tx) error {
+		return dbutil.ForEach(tx, campaignAddrsBkt, func(k, v []byte) error {
+			require.False(t, strings.Contains(string(v), "14FG8vQnmK6B7YbLSr6uC5wfGY78JFNCYg"))
+			return nil
+		})
+	})
+	require.NoError(t, err)
+
+	m, err = NewManager(log, db, c, testCoinTypes)
+	require.NoError(t, err)
+	require.Equal(t, map[string]uint64{scanner.CoinTypeBTC: 2}, m.Remaining("a"))
+
+	addr, err = m.NewAddress("a", scanner.CoinTypeBTC)
+	require.NoError(t, err)
+	require.Equal(t, "14FG8vQnmK6B7YbLSr6uC5wfGY78JFNCYg", addr)
+}
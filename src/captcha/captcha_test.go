@@ -0,0 +1,52 @@
+package captcha
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerify(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPost, r.Method)
+		require.Equal(t, "secret", r.FormValue("secret"))
+
+		switch r.FormValue("response") {
+		case "good":
+			require.Equal(t, "1.2.3.4", r.FormValue("remoteip"))
+			fmt.Fprint(w, `{"success": true}`)
+		case "badsecret":
+			fmt.Fprint(w, `{"success": false, "error-codes": ["invalid-input-secret"]}`)
+		case "unavailable":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			fmt.Fprint(w, `{"success": false, "error-codes": ["invalid-input-response"]}`)
+		}
+	}))
+	defer srv.Close()
+
+	_, err := NewVerifier("foo", "secret")
+	require.Error(t, err)
+
+	_, err = NewVerifier(ProviderRecaptcha, "")
+	require.Error(t, err)
+
+	v, err := NewVerifier(ProviderHCaptcha, "secret")
+	require.NoError(t, err)
+	v.verifyURL = srv.URL
+
+	require.NoError(t, v.Verify("good", "1.2.3.4"))
+	require.Equal(t, ErrInvalidToken, v.Verify("bad", ""))
+	require.Equal(t, ErrInvalidToken, v.Verify("", ""))
+
+	err = v.Verify("badsecret", "")
+	require.Error(t, err)
+	require.NotEqual(t, ErrInvalidToken, err)
+
+	err = v.Verify("unavailable", "")
+	require.Error(t, err)
+	require.NotEqual(t, ErrInvalidToken, err)
+}
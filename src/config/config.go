@@ -5,15 +5,31 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/shopspring/decimal"
 	"github.com/spf13/viper"
 
+	"github.com/skycoin/skycoin/src/util/droplet"
 	"github.com/skycoin/skycoin/src/visor"
 	"github.com/skycoin/skycoin/src/wallet"
+
+	"github.com/skycoin/teller/src/addrs"
+	"github.com/skycoin/teller/src/alert"
+	"github.com/skycoin/teller/src/captcha"
+	"github.com/skycoin/teller/src/ipfilter"
+	"github.com/skycoin/teller/src/notify"
+	"github.com/skycoin/teller/src/rbac"
+	"github.com/skycoin/teller/src/screening"
+	"github.com/skycoin/teller/src/sentry"
+	"github.com/skycoin/teller/src/util/listenutil"
 	"github.com/skycoin/teller/src/util/mathutil"
+	"github.com/skycoin/teller/src/util/qrutil"
 )
 
 const (
@@ -33,31 +49,154 @@ type Config struct {
 
 	// Path of BTC addresses JSON file
 	BtcAddresses string `mapstructure:"btc_addresses"`
+	// Path of LTC addresses JSON file
+	LtcAddresses string `mapstructure:"ltc_addresses"`
+	// Path of ETH addresses JSON file, for ERC20 token deposits
+	EthAddresses string `mapstructure:"eth_addresses"`
+
+	AddressProvider AddressProvider `mapstructure:"address_provider"`
+
+	Encryption Encryption `mapstructure:"encryption"`
+
+	Logging Logging `mapstructure:"logging"`
 
 	Teller Teller `mapstructure:"teller"`
 
 	SkyRPC SkyRPC `mapstructure:"sky_rpc"`
 	BtcRPC BtcRPC `mapstructure:"btc_rpc"`
+	LtcRPC LtcRPC `mapstructure:"ltc_rpc"`
+	EthRPC EthRPC `mapstructure:"eth_rpc"`
 
 	BtcScanner   BtcScanner   `mapstructure:"btc_scanner"`
+	LtcScanner   LtcScanner   `mapstructure:"ltc_scanner"`
+	ERC20Scanner ERC20Scanner `mapstructure:"erc20_scanner"`
 	SkyExchanger SkyExchanger `mapstructure:"sky_exchanger"`
+	SkySigner    SkySigner    `mapstructure:"sky_signer"`
+
+	WalletTopUp   WalletTopUp   `mapstructure:"wallet_topup"`
+	WalletBalance WalletBalance `mapstructure:"wallet_balance"`
 
 	Web Web `mapstructure:"web"`
 
+	Tor Tor `mapstructure:"tor"`
+
+	Redis Redis `mapstructure:"redis"`
+
+	HA HA `mapstructure:"ha"`
+
+	Captcha Captcha `mapstructure:"captcha"`
+
+	Pricing Pricing `mapstructure:"pricing"`
+
+	Outbox Outbox `mapstructure:"outbox"`
+
+	Stream Stream `mapstructure:"stream"`
+
+	Settlement Settlement `mapstructure:"settlement"`
+
+	SupportTokens SupportTokens `mapstructure:"support_tokens"`
+
+	StatusChallenge StatusChallenge `mapstructure:"status_challenge"`
+
+	BindSignature BindSignature `mapstructure:"bind_signature"`
+
+	Campaigns Campaigns `mapstructure:"campaigns"`
+
+	Quotes Quotes `mapstructure:"quotes"`
+
+	PromoCodes PromoCodes `mapstructure:"promo_codes"`
+
+	KYC KYC `mapstructure:"kyc"`
+
+	Screening Screening `mapstructure:"screening"`
+
+	APIKeys APIKeys `mapstructure:"api_keys"`
+
+	Alerts Alerts `mapstructure:"alerts"`
+
+	Reports Reports `mapstructure:"reports"`
+
+	Notifications Notifications `mapstructure:"notifications"`
+
+	Archive Archive `mapstructure:"archive"`
+
+	Backup Backup `mapstructure:"backup"`
+
+	Sentry Sentry `mapstructure:"sentry"`
+
+	Tracing Tracing `mapstructure:"tracing"`
+
+	Secrets Secrets `mapstructure:"secrets"`
+
 	AdminPanel AdminPanel `mapstructure:"admin_panel"`
 
+	AdminDashboard AdminDashboard `mapstructure:"admin_dashboard"`
+
+	Upgrade ProcessUpgrade `mapstructure:"upgrade"`
+
 	Dummy Dummy `mapstructure:"dummy"`
 }
 
+// Log formats
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+
+	// LogScrubHash replaces the addresses and IPs in the logs with a keyed hash
+	LogScrubHash = "hash"
+	// LogScrubTruncate keeps the first characters of the addresses and IPs in the logs
+	LogScrubTruncate = "truncate"
+)
+
+// Logging config for the log format, the rotation of the log files and the audit log
+type Logging struct {
+	// Format of the logs, "text" or "json"
+	Format string `mapstructure:"format"`
+	// The log files are rotated before they grow larger than this, 0 for no limit
+	MaxSizeMB int `mapstructure:"max_size_mb"`
+	// The log files are rotated once they have been written to for this long, 0 for no limit
+	MaxAge time.Duration `mapstructure:"max_age"`
+	// Number of rotated files kept of each log file, 0 keeps all of them
+	MaxBackups int `mapstructure:"max_backups"`
+	// Path of the audit log of binds, admin actions and sends, in JSON. Empty to not write it.
+	AuditFile string `mapstructure:"audit_file"`
+	// Hash or truncate the skycoin, deposit and IP addresses of the log fields, except in the audit log
+	ScrubPII bool `mapstructure:"scrub_pii"`
+	// How the addresses are scrubbed, "hash" or "truncate"
+	ScrubMode string `mapstructure:"scrub_mode"`
+	// Key of the hash of the "hash" mode, so that the same address always has the same hash
+	ScrubSecret string `mapstructure:"scrub_secret"`
+}
+
 // Teller config for teller
 type Teller struct {
 	// Max number of btc addresses a skycoin address can bind
 	MaxBoundBtcAddresses int `mapstructure:"max_bound_btc_addrs"`
+	// Max SKY a skycoin address can buy in its lifetime, empty for no limit. Deposits beyond it are held for review.
+	MaxSkyPerAddress string `mapstructure:"max_sky_per_addr"`
+	// Bound addresses that receive no deposit within BindTTL are unbound and returned to the pool, 0 to keep them bound
+	BindTTL time.Duration `mapstructure:"bind_ttl"`
+	// Return bound addresses to the pool once their deposits were processed and RecycleCoolDown passed
+	RecycleAddresses bool          `mapstructure:"recycle_addresses"`
+	RecycleCoolDown  time.Duration `mapstructure:"recycle_cooldown"`
+	// Leave the deposits ignored as dust out of the status responses
+	HideDust bool `mapstructure:"hide_dust"`
 }
 
 // SkyRPC config for Skycoin daemon node RPC
 type SkyRPC struct {
 	Address string `mapstructure:"address"`
+	// Nodes to fail over to if the node above is down or not synced, in order of preference
+	FallbackAddresses []string `mapstructure:"fallback_addresses"`
+	// How often the nodes are health checked
+	HealthCheckPeriod time.Duration `mapstructure:"health_check_period"`
+	// Maximum wait before a failed node is tried again
+	MaxBackoff time.Duration `mapstructure:"max_backoff"`
+}
+
+// Addresses returns the addresses of all skycoin nodes, in order of preference
+func (c SkyRPC) Addresses() []string {
+	return append([]string{c.Address}, c.FallbackAddresses...)
 }
 
 // BtcRPC config for btcrpc
@@ -66,30 +205,204 @@ type BtcRPC struct {
 	User   string `mapstructure:"user"`
 	Pass   string `mapstructure:"pass"`
 	Cert   string `mapstructure:"cert"`
+	// How often the nodes are health checked, if there are fallback nodes
+	HealthCheckPeriod time.Duration `mapstructure:"health_check_period"`
+	// Nodes to fail over to if the node above fails, in order of preference
+	FallbackNodes []BtcRPCNode `mapstructure:"fallback_nodes"`
+}
+
+// BtcRPCNode config for a fallback btcd node
+type BtcRPCNode struct {
+	Server string `mapstructure:"server"`
+	User   string `mapstructure:"user"`
+	Pass   string `mapstructure:"pass"`
+	Cert   string `mapstructure:"cert"`
+}
+
+// LtcRPC config for litecoind or ltcd RPC, connected over HTTP
+type LtcRPC struct {
+	Server string `mapstructure:"server"`
+	User   string `mapstructure:"user"`
+	Pass   string `mapstructure:"pass"`
+}
+
+// EthRPC config for an ethereum node JSON-RPC endpoint
+type EthRPC struct {
+	// URL of the RPC endpoint, e.g. http://127.0.0.1:8545
+	URL string `mapstructure:"url"`
 }
 
 // BtcScanner config for BTC scanner
 type BtcScanner struct {
+	// Where to scan for deposits: "btcd", "electrum" or "blockbook"
+	Backend string `mapstructure:"backend"`
+	// How often to try to scan for blocks, or poll the deposit addresses with the electrum and blockbook backends
+	ScanPeriod            time.Duration `mapstructure:"scan_period"`
+	InitialScanHeight     int64         `mapstructure:"initial_scan_height"`
+	ConfirmationsRequired int64         `mapstructure:"confirmations_required"`
+	// Node's zmqpubhashblock address. New blocks are scanned when published, and
+	// scan_period polling is only used while the ZMQ socket is down. btcd backend only
+	ZMQAddress string `mapstructure:"zmq_address"`
+	// Number of blocks fetched concurrently while catching up, e.g. during the initial sync. btcd backend only
+	ScanConcurrency int `mapstructure:"scan_concurrency"`
+	// Electrum server host:port, required for the electrum backend
+	ElectrumServer string `mapstructure:"electrum_server"`
+	// Connect to the Electrum server with TLS
+	ElectrumTLS bool `mapstructure:"electrum_tls"`
+	// PEM certificate of the Electrum server, if it is self-signed
+	ElectrumCert string `mapstructure:"electrum_cert"`
+	// Blockbook server URL, required for the blockbook backend
+	BlockbookURL string `mapstructure:"blockbook_url"`
+	// Number of workers polling the deposit addresses in parallel, each with its own connection to
+	// the server and a fixed hash range of the addresses. electrum and blockbook backends only
+	ScanShards int `mapstructure:"scan_shards"`
+	// Deposits below this value are recorded as ignored_dust and never sent, empty to accept any deposit
+	DustThreshold string `mapstructure:"dust_threshold"`
+	// More confirmations required for larger deposits
+	ConfirmationTiers []ConfirmationTier `mapstructure:"confirmation_tiers"`
+}
+
+// ConfirmationTier config for the confirmations required by the deposits of a scanner from a value on
+type ConfirmationTier struct {
+	// Minimum deposit value, in coins or tokens, as a decimal string with at most 8 decimal places
+	MinValue string `mapstructure:"min_value"`
+	// Confirmations required before skycoins are sent for the deposits. Tiers with no more confirmations
+	// than the confirmations_required of the scanner have no effect
+	Confirmations int64 `mapstructure:"confirmations"`
+}
+
+const (
+	// BtcScannerBackendBtcd scans the blocks of a btcd node
+	BtcScannerBackendBtcd = "btcd"
+	// BtcScannerBackendElectrum polls the deposit addresses on an Electrum server
+	BtcScannerBackendElectrum = "electrum"
+	// BtcScannerBackendBlockbook polls the deposit addresses on a Blockbook server
+	BtcScannerBackendBlockbook = "blockbook"
+)
+
+// LtcScanner config for LTC scanner
+type LtcScanner struct {
+	// Accept LTC deposits
+	Enabled bool `mapstructure:"enabled"`
+	// How often to try to scan for blocks
+	ScanPeriod            time.Duration `mapstructure:"scan_period"`
+	InitialScanHeight     int64         `mapstructure:"initial_scan_height"`
+	ConfirmationsRequired int64         `mapstructure:"confirmations_required"`
+	// Node's zmqpubhashblock address. New blocks are scanned when published, and
+	// scan_period polling is only used while the ZMQ socket is down
+	ZMQAddress string `mapstructure:"zmq_address"`
+	// Number of blocks fetched concurrently while catching up, e.g. during the initial sync
+	ScanConcurrency int `mapstructure:"scan_concurrency"`
+	// Deposits below this value are recorded as ignored_dust and never sent, empty to accept any deposit
+	DustThreshold string `mapstructure:"dust_threshold"`
+	// More confirmations required for larger deposits
+	ConfirmationTiers []ConfirmationTier `mapstructure:"confirmation_tiers"`
+}
+
+// ERC20Scanner config for ERC20 token scanner
+type ERC20Scanner struct {
+	// Accept ERC20 token deposits
+	Enabled bool `mapstructure:"enabled"`
 	// How often to try to scan for blocks
 	ScanPeriod            time.Duration `mapstructure:"scan_period"`
 	InitialScanHeight     int64         `mapstructure:"initial_scan_height"`
 	ConfirmationsRequired int64         `mapstructure:"confirmations_required"`
+	// Deposits below this value, in units of their token, are recorded as ignored_dust and never sent,
+	// empty to accept any deposit
+	DustThreshold string `mapstructure:"dust_threshold"`
+	// More confirmations required for larger deposits, with the values in units of the token of the deposit
+	ConfirmationTiers []ConfirmationTier `mapstructure:"confirmation_tiers"`
+	// Accepted tokens
+	Tokens []ERC20Token `mapstructure:"tokens"`
+}
+
+// ERC20Token config for an accepted ERC20 token
+type ERC20Token struct {
+	// Symbol of the token, used as its coin type
+	Symbol string `mapstructure:"symbol"`
+	// Token contract address
+	Contract string `mapstructure:"contract"`
+	// Number of decimal places of the token
+	Decimals int `mapstructure:"decimals"`
+	// SKY/token exchange rate. Can be an int, float or rational fraction string
+	SkyExchangeRate string `mapstructure:"sky_exchange_rate"`
+}
+
+// Token returns the accepted token with symbol, if any
+func (c ERC20Scanner) Token(symbol string) (ERC20Token, bool) {
+	for _, t := range c.Tokens {
+		if t.Symbol == symbol {
+			return t, true
+		}
+	}
+
+	return ERC20Token{}, false
 }
 
 // SkyExchanger config for skycoin sender
 type SkyExchanger struct {
 	// SKY/BTC exchange rate. Can be an int, float or rational fraction string
 	SkyBtcExchangeRate string `mapstructure:"sky_btc_exchange_rate"`
+	// SKY/LTC exchange rate, required if ltc_scanner.enabled
+	SkyLtcExchangeRate string `mapstructure:"sky_ltc_exchange_rate"`
 	// Number of decimal places to truncate SKY to
 	MaxDecimals int `mapstructure:"max_decimals"`
 	// How long to wait before rechecking transaction confirmations
 	TxConfirmationCheckWait time.Duration `mapstructure:"tx_confirmation_check_wait"`
 	// Path of hot Skycoin wallet file on disk
 	Wallet string `mapstructure:"wallet"`
+	// Deposits received within BatchWindow of each other are sent in one transaction, 0 to send them one by one
+	BatchWindow time.Duration `mapstructure:"batch_window"`
+	// Maximum number of deposits sent in one transaction
+	BatchMaxSize int `mapstructure:"batch_max_size"`
+	// Percentage of the SKY bought that is kept as a fee. Can be an int or float string
+	FeePercent string `mapstructure:"fee_percent"`
+	// Fixed fee kept from each deposit, in droplets
+	FeeFixedDroplets uint64 `mapstructure:"fee_fixed_droplets"`
+	// Maximum time to wait on shutdown for the deposits being sent to be saved, 0 for no limit
+	DrainTimeout time.Duration `mapstructure:"drain_timeout"`
+	// Deposits with fewer confirmations are checked for double spends before skycoins are sent for them, 0 to not check
+	DoubleSpendConfirmations int64 `mapstructure:"double_spend_confirmations"`
+	// How often the held and sent deposits with fewer than DoubleSpendConfirmations confirmations are checked
+	// for double spends, 0 to only check deposits before they are sent
+	DoubleSpendCheckPeriod time.Duration `mapstructure:"double_spend_check_period"`
+}
+
+// SkySigner config for signing transactions with a remote signer, instead of the local hot wallet
+type SkySigner struct {
+	Enabled bool `mapstructure:"enabled"`
+	// HTTPS URL of the teller-signer service
+	URL string `mapstructure:"url"`
+	// Client certificate and key that teller authenticates to the signer with
+	Cert string `mapstructure:"cert"`
+	Key  string `mapstructure:"key"`
+	// CA certificate that the signer's certificate is verified with
+	CA string `mapstructure:"ca"`
+}
+
+// WalletTopUp config for detecting incoming SKY transfers to the hot wallet
+type WalletTopUp struct {
+	Enabled bool `mapstructure:"enabled"`
+	// How often to check the hot wallet for new outputs
+	CheckPeriod time.Duration `mapstructure:"check_period"`
+	// Balance in SKY at or above which paused payouts are resumed after a top-up
+	ResumeBalance string `mapstructure:"resume_balance"`
+}
+
+// WalletBalance config for monitoring the hot wallet balance
+type WalletBalance struct {
+	Enabled bool `mapstructure:"enabled"`
+	// How often to check the hot wallet balance
+	CheckPeriod time.Duration `mapstructure:"check_period"`
+	// Balance in SKY below which an alert is raised
+	LowBalance string `mapstructure:"low_balance"`
+	// Pause deposits while the balance is below low_balance
+	PauseDeposits bool `mapstructure:"pause_deposits"`
 }
 
 // Web config for the teller HTTP interface
 type Web struct {
+	// host:port, unix:PATH for a unix socket, or systemd[:NAME] for a socket passed by systemd socket activation
 	HTTPAddr         string        `mapstructure:"http_addr"`
 	HTTPSAddr        string        `mapstructure:"https_addr"`
 	StaticDir        string        `mapstructure:"static_dir"`
@@ -98,8 +411,35 @@ type Web struct {
 	TLSKey           string        `mapstructure:"tls_key"`
 	ThrottleMax      int64         `mapstructure:"throttle_max"` // Maximum number of requests per duration
 	ThrottleDuration time.Duration `mapstructure:"throttle_duration"`
-	BehindProxy      bool          `mapstructure:"behind_proxy"`
-	APIEnabled       bool          `mapstructure:"api_enabled"`
+	// Maximum number of skycoin addresses in a batch status request
+	StatusBatchMax int `mapstructure:"status_batch_max"`
+	// Maximum number of requests per skycoin address per duration, 0 disables it
+	AddrThrottleBurst    int64         `mapstructure:"addr_throttle_burst"`
+	AddrThrottleDuration time.Duration `mapstructure:"addr_throttle_duration"`
+	BehindProxy          bool          `mapstructure:"behind_proxy"`
+	APIEnabled           bool          `mapstructure:"api_enabled"`
+	// IPs or CIDR ranges of the proxies in front of teller. If set, X-Forwarded-For is only honored
+	// for requests from them, and client IPs are read from it skipping the trusted proxies.
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
+	// Read the PROXY protocol header of the connections from TrustedProxies
+	ProxyProtocol bool `mapstructure:"proxy_protocol"`
+	// Octal permissions of the unix sockets of HTTPAddr and HTTPSAddr, e.g. "0660"
+	UnixSocketMode string `mapstructure:"unix_socket_mode"`
+	// Maximum number of concurrent requests per IP, 0 disables it
+	MaxConnsPerIP int `mapstructure:"max_conns_per_ip"`
+	// Maximum static file bandwidth per IP in bytes per second, 0 disables it
+	StaticBandwidthPerIP int64 `mapstructure:"static_bandwidth_per_ip"`
+	// Where rate limit state is kept, "local" or "redis".
+	// Use "redis" when running multiple teller instances behind a load balancer.
+	RateLimitBackend string `mapstructure:"ratelimit_backend"`
+	// Serve 503 responses to the API requests, except /api/config. Can be changed at runtime with the admin API.
+	Maintenance bool `mapstructure:"maintenance"`
+	// Retry-After of the responses in maintenance mode
+	MaintenanceRetryAfter time.Duration `mapstructure:"maintenance_retry_after"`
+	// IPs or CIDR ranges allowed to make requests, all IPs are allowed if empty
+	IPAllowlist []string `mapstructure:"ip_allowlist"`
+	// IPs or CIDR ranges denied, even if they are in IPAllowlist
+	IPDenylist []string `mapstructure:"ip_denylist"`
 }
 
 // Validate validates Web config
@@ -108,6 +448,22 @@ func (c Web) Validate() error {
 		return errors.New("at least one of web.http_addr, web.https_addr must be set")
 	}
 
+	if c.HTTPAddr != "" {
+		if err := listenutil.ValidateAddr(c.HTTPAddr); err != nil {
+			return fmt.Errorf("web.http_addr is invalid: %v", err)
+		}
+	}
+
+	if c.HTTPSAddr != "" {
+		if err := listenutil.ValidateAddr(c.HTTPSAddr); err != nil {
+			return fmt.Errorf("web.https_addr is invalid: %v", err)
+		}
+	}
+
+	if _, err := c.SocketMode(); err != nil {
+		return err
+	}
+
 	if c.HTTPSAddr != "" && c.AutoTLSHost == "" && (c.TLSCert == "" || c.TLSKey == "") {
 		return errors.New("when using web.https_addr, either web.auto_tls_host or both web.tls_cert and web.tls_key must be set")
 	}
@@ -124,200 +480,2451 @@ func (c Web) Validate() error {
 		return errors.New("web.auto_tls_host or web.tls_key or web.tls_cert is set but web.https_addr is not enabled")
 	}
 
-	return nil
-}
-
-// AdminPanel config for the admin panel AdminPanel
-type AdminPanel struct {
-	Host string `mapstructure:"host"`
-}
-
-// Dummy config for the fake sender and scanner
-type Dummy struct {
-	Scanner  bool   `mapstructure:"scanner"`
-	Sender   bool   `mapstructure:"sender"`
-	HTTPAddr string `mapstructure:"http_addr"`
-}
-
-// Redacted returns a copy of the config with sensitive information redacted
-func (c Config) Redacted() Config {
-	if c.BtcRPC.User != "" {
-		c.BtcRPC.User = "<redacted>"
+	if c.StatusBatchMax <= 0 {
+		return errors.New("web.status_batch_max must be greater than zero")
 	}
 
-	if c.BtcRPC.Pass != "" {
-		c.BtcRPC.Pass = "<redacted>"
+	// A batch counts as a request per address, so a larger batch could never be allowed
+	if int64(c.StatusBatchMax) > c.ThrottleMax {
+		return errors.New("web.status_batch_max can't be greater than web.throttle_max")
 	}
 
-	return c
-}
+	if c.AddrThrottleBurst < 0 {
+		return errors.New("web.addr_throttle_burst can't be negative")
+	}
 
-// Validate validates the config
-func (c Config) Validate() error {
-	var errs []string
-	oops := func(err string) {
-		errs = append(errs, err)
+	if c.AddrThrottleBurst > 0 && c.AddrThrottleDuration <= 0 {
+		return errors.New("web.addr_throttle_duration must be greater than zero when web.addr_throttle_burst is set")
 	}
 
-	if c.LogFilename == "" {
-		oops("logfile missing")
+	if c.MaxConnsPerIP < 0 {
+		return errors.New("web.max_conns_per_ip can't be negative")
 	}
 
-	if c.BtcAddresses == "" {
-		oops("btc_addresses missing")
+	if c.StaticBandwidthPerIP < 0 {
+		return errors.New("web.static_bandwidth_per_ip can't be negative")
 	}
 
-	// TODO -- check btc_addresses file
+	switch c.RateLimitBackend {
+	case RateLimitBackendLocal, RateLimitBackendRedis:
+	default:
+		return fmt.Errorf("web.ratelimit_backend must be %q or %q", RateLimitBackendLocal, RateLimitBackendRedis)
+	}
 
-	if !c.Dummy.Sender {
-		if c.SkyRPC.Address == "" {
-			oops("sky_rpc.address missing")
-		}
+	if c.MaintenanceRetryAfter < time.Second {
+		return errors.New("web.maintenance_retry_after must be at least 1s")
+	}
 
-		// test if skycoin node rpc service is reachable
-		conn, err := net.Dial("tcp", c.SkyRPC.Address)
-		if err != nil {
-			oops(fmt.Sprintf("sky_rpc.address connect failed: %v", err))
-		} else {
-			conn.Close()
+	for i, s := range c.TrustedProxies {
+		if _, err := ipfilter.ParseCIDR(s); err != nil {
+			return fmt.Errorf("web.trusted_proxies[%d] %q is not an IP or CIDR range", i, s)
 		}
 	}
 
-	if !c.Dummy.Scanner {
-		if c.BtcRPC.Server == "" {
-			oops("btc_rpc.server missing")
-		}
+	// Otherwise any client could spoof its IP with a PROXY header
+	if c.ProxyProtocol && len(c.TrustedProxies) == 0 {
+		return errors.New("web.trusted_proxies must be set when web.proxy_protocol is enabled")
+	}
 
-		if c.BtcRPC.User == "" {
-			oops("btc_rpc.user missing")
-		}
-		if c.BtcRPC.Pass == "" {
-			oops("btc_rpc.pass missing")
-		}
-		if c.BtcRPC.Cert == "" {
-			oops("btc_rpc.cert missing")
+	for i, s := range c.IPAllowlist {
+		if _, err := ipfilter.ParseCIDR(s); err != nil {
+			return fmt.Errorf("web.ip_allowlist[%d] %q is not an IP or CIDR range", i, s)
 		}
+	}
 
-		if _, err := os.Stat(c.BtcRPC.Cert); os.IsNotExist(err) {
-			oops("btc_rpc.cert file does not exist")
+	for i, s := range c.IPDenylist {
+		if _, err := ipfilter.ParseCIDR(s); err != nil {
+			return fmt.Errorf("web.ip_denylist[%d] %q is not an IP or CIDR range", i, s)
 		}
 	}
 
-	if c.BtcScanner.ConfirmationsRequired < 0 {
-		oops("btc_scanner.confirmations_required must be >= 0")
-	}
-	if c.BtcScanner.InitialScanHeight < 0 {
-		oops("btc_scanner.initial_scan_height must be >= 0")
-	}
+	return nil
+}
 
-	if _, err := mathutil.DecimalFromString(c.SkyExchanger.SkyBtcExchangeRate); err != nil {
-		oops(fmt.Sprintf("sky_exchanger.sky_btc_exchange_rate invalid: %v", err))
+// SocketMode returns the permissions of the unix sockets, parsed from UnixSocketMode
+func (c Web) SocketMode() (os.FileMode, error) {
+	mode, err := strconv.ParseUint(c.UnixSocketMode, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, fmt.Errorf("web.unix_socket_mode %q must be octal permissions, e.g. \"0660\"", c.UnixSocketMode)
 	}
+	return os.FileMode(mode), nil
+}
 
-	if !c.Dummy.Sender {
-		if c.SkyExchanger.Wallet == "" {
-			oops("sky_exchanger.wallet missing")
-		}
+// Tor config for publishing web.http_addr as a Tor v3 hidden service, through the control port of a local Tor
+type Tor struct {
+	Enabled bool `mapstructure:"enabled"`
+	// host:port of the Tor control port
+	ControlAddr string `mapstructure:"control_addr"`
+	// Password of the control port, if Tor is configured with HashedControlPassword.
+	// If empty, no authentication or the authentication cookie is used.
+	ControlPassword string `mapstructure:"control_password"`
+	// File the private key of the hidden service is saved in, relative to the data directory unless absolute
+	KeyFile string `mapstructure:"key_file"`
+	// Port of the onion address
+	VirtualPort int `mapstructure:"virtual_port"`
+	// Address connections to the onion address are forwarded to, host:port or unix:PATH. Defaults to web.http_addr.
+	Target string `mapstructure:"target"`
+	// How long to wait before connecting to the control port again after it failed or closed
+	RetryDelay time.Duration `mapstructure:"retry_delay"`
+}
 
-		if _, err := os.Stat(c.SkyExchanger.Wallet); os.IsNotExist(err) {
-			oops(fmt.Sprintf("sky_exchanger.wallet file %s does not exist", c.SkyExchanger.Wallet))
-		}
+// TorTarget returns the address the hidden service forwards connections to: tor.target if it is set,
+// otherwise web.http_addr, with an unspecified host replaced by 127.0.0.1.
+// It returns the empty string if tor.target is not set and web.http_addr is not set or is a systemd socket.
+func (c Config) TorTarget() string {
+	if c.Tor.Target != "" {
+		return c.Tor.Target
+	}
 
-		w, err := wallet.Load(c.SkyExchanger.Wallet)
-		if err != nil {
-			oops(fmt.Sprintf("sky_exchanger.wallet file %s failed to load: %v", c.SkyExchanger.Wallet, err))
-		} else if err := w.Validate(); err != nil {
-			oops(fmt.Sprintf("sky_exchanger.wallet file %s is invalid: %v", c.SkyExchanger.Wallet, err))
-		}
+	addr := c.Web.HTTPAddr
+	if addr == "" {
+		return ""
 	}
 
-	if c.SkyExchanger.MaxDecimals < 0 {
-		oops("sky_exchanger.max_decimals can't be negative")
+	if _, ok := listenutil.UnixSocketPath(addr); ok {
+		return addr
 	}
 
-	if uint64(c.SkyExchanger.MaxDecimals) > visor.MaxDropletPrecision {
-		oops(fmt.Sprintf("sky_exchanger.max_decimals is larger than visor.MaxDropletPrecision=%d", visor.MaxDropletPrecision))
+	if _, ok := listenutil.SystemdSocketName(addr); ok {
+		return ""
 	}
 
-	if err := c.Web.Validate(); err != nil {
-		oops(err.Error())
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return ""
 	}
 
-	if len(errs) == 0 {
-		return nil
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
 	}
 
-	return errors.New(strings.Join(errs, "\n"))
+	return net.JoinHostPort(host, port)
 }
 
-func setDefaults() {
-	// Top-level args
-	viper.SetDefault("profile", false)
-	viper.SetDefault("debug", true)
-	viper.SetDefault("logfile", "./teller.log")
-	viper.SetDefault("dbfile", "teller.db")
+const (
+	// RateLimitBackendLocal keeps rate limit state in this teller instance
+	RateLimitBackendLocal = "local"
+	// RateLimitBackendRedis keeps rate limit state in redis, shared by all teller instances
+	RateLimitBackendRedis = "redis"
+)
 
-	// Teller
-	viper.SetDefault("teller.max_bound_btc_addrs", 5)
+// Redis config for the redis server shared by multiple teller instances
+type Redis struct {
+	Addr     string `mapstructure:"addr"`
+	Password string `mapstructure:"password"`
+	DB       int    `mapstructure:"db"`
+}
 
-	// SkyRPC
-	viper.SetDefault("sky_rpc.address", "127.0.0.1:6430")
+// HA config for active/standby high availability. Teller instances elect a leader with a lock in redis.
+// Only the leader opens the db and runs, standbys wait to take over.
+type HA struct {
+	Enabled bool `mapstructure:"enabled"`
+	// ID of this instance, the value of the lock while it is the leader. Defaults to the hostname and pid
+	InstanceID string `mapstructure:"instance_id"`
+	// Redis key of the lock
+	LockKey string `mapstructure:"lock_key"`
+	// The lock expires if the leader doesn't renew it within lock_ttl, then a standby takes over
+	LockTTL time.Duration `mapstructure:"lock_ttl"`
+	// How often a standby tries to take the lock
+	RetryPeriod time.Duration `mapstructure:"retry_period"`
+}
 
-	// BtcRPC
-	viper.SetDefault("btc_rpc.server", "127.0.0.1:8334")
+// Captcha config for captcha verification of bind requests
+type Captcha struct {
+	Enabled bool `mapstructure:"enabled"`
+	// "recaptcha" or "hcaptcha"
+	Provider string `mapstructure:"provider"`
+	// Public site key, given to the frontend by /api/config
+	SiteKey string `mapstructure:"site_key"`
+	// Secret key, used to verify tokens with the provider
+	Secret string `mapstructure:"secret"`
+}
 
-	// BtcScanner
-	viper.SetDefault("btc_scanner.scan_period", time.Second*20)
-	viper.SetDefault("btc_scanner.initial_scan_height", int64(492478))
-	viper.SetDefault("btc_scanner.confirmations_required", int64(1))
+// Pricing config for regional pricing. The region of a client is derived from its country
+type Pricing struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Request header with the client's country code, set by a trusted reverse proxy or CDN, e.g. CF-IPCountry
+	GeoIPHeader string `mapstructure:"geoip_header"`
+	// Path of a CSV file of network,country rows, used to look up the client IP if geoip_header is not set
+	GeoIPFile string `mapstructure:"geoip_file"`
+	// Pricing regions. Clients in no region get the default pricing
+	Regions []PricingRegion `mapstructure:"regions"`
+}
 
-	// SkyExchanger
-	viper.SetDefault("sky_exchanger.tx_confirmation_check_wait", time.Second*5)
-	viper.SetDefault("sky_exchanger.max_decimals", 3)
+// PricingRegion config for a pricing region
+type PricingRegion struct {
+	Name string `mapstructure:"name"`
+	// ISO 3166-1 alpha-2 country codes of the region
+	Countries []string `mapstructure:"countries"`
+	// Extra SKY given, as a percentage of the exchange rate
+	BonusPercent string `mapstructure:"bonus_percent"`
+	// Minimum SKY a deposit must buy. Smaller deposits are not sent any SKY
+	MinSky string `mapstructure:"min_sky"`
+}
 
-	// Web
-	viper.SetDefault("web.http_addr", "127.0.0.1:7071")
-	viper.SetDefault("web.static_dir", "./web/build")
-	viper.SetDefault("web.throttle_max", int64(60))
-	viper.SetDefault("web.throttle_duration", time.Minute)
-	viper.SetDefault("web.api_enabled", true)
+// Outbox config for relaying deposit status changes to a webhook
+type Outbox struct {
+	Enabled bool `mapstructure:"enabled"`
+	// URL that deposit status change events are POSTed to
+	WebhookURL string `mapstructure:"webhook_url"`
+	// Secret used to sign webhook requests with HMAC-SHA256. Requests are not signed if empty
+	WebhookSecret string `mapstructure:"webhook_secret"`
+	// How often to check the outbox for new events
+	DispatchPeriod time.Duration `mapstructure:"dispatch_period"`
+	// Maximum wait before retrying a failed webhook request
+	MaxBackoff time.Duration `mapstructure:"max_backoff"`
+}
 
-	// AdminPanel
-	viper.SetDefault("admin_panel.host", "127.0.0.1:7711")
+// Stream backends
+const (
+	StreamBackendNATS  = "nats"
+	StreamBackendKafka = "kafka"
+)
 
-	// DummySender
-	viper.SetDefault("dummy.http_addr", "127.0.0.1:4121")
-	viper.SetDefault("dummy.scanner", false)
-	viper.SetDefault("dummy.sender", false)
+// Stream config for publishing deposit lifecycle events to NATS or Kafka
+type Stream struct {
+	Enabled bool `mapstructure:"enabled"`
+	// "nats" or "kafka"
+	Backend string `mapstructure:"backend"`
+	// NATS server URL, nats://host:port or tls://host:port, or URL of the Kafka REST proxy
+	URL string `mapstructure:"url"`
+	// NATS subject or Kafka topic that the events are published to
+	Topic string `mapstructure:"topic"`
+	// NATS user, or Kafka REST proxy basic auth user
+	User     string `mapstructure:"user"`
+	Password string `mapstructure:"password"`
+	// NATS auth token
+	Token string `mapstructure:"token"`
+	// How often to check the outbox for new events
+	DispatchPeriod time.Duration `mapstructure:"dispatch_period"`
+	// Maximum wait before retrying a failed publish
+	MaxBackoff time.Duration `mapstructure:"max_backoff"`
 }
 
-// Load loads the configuration from "./$configName.*" where "*" is a
-// JSON, toml or yaml file (toml preferred).
-func Load(configName, appDir string) (Config, error) {
-	if strings.HasSuffix(configName, ".toml") {
-		configName = configName[:len(configName)-len(".toml")]
-	}
+// Settlement config for notifying a partner settlement system of payouts
+type Settlement struct {
+	Enabled bool `mapstructure:"enabled"`
+	// URL that settlements are POSTed to. The partner must acknowledge each one in the response
+	WebhookURL string `mapstructure:"webhook_url"`
+	// Secret used to sign webhook requests with HMAC-SHA256. Requests are not signed if empty
+	WebhookSecret string `mapstructure:"webhook_secret"`
+	// How often to check for settlements to notify
+	CheckPeriod time.Duration `mapstructure:"check_period"`
+	// Wait before notifying an unacknowledged settlement again
+	RetryPeriod time.Duration `mapstructure:"retry_period"`
+}
+
+// SupportTokens config for time-limited support access tokens
+type SupportTokens struct {
+	// Serve /api/support/status, and the support token admin API on the admin panel
+	Enabled bool `mapstructure:"enabled"`
+	// TTL of tokens minted without a ttl
+	DefaultTTL time.Duration `mapstructure:"default_ttl"`
+	// Maximum TTL of a token
+	MaxTTL time.Duration `mapstructure:"max_ttl"`
+}
 
-	viper.SetConfigName(configName)
-	viper.SetConfigType("toml")
-	viper.AddConfigPath(appDir)
-	viper.AddConfigPath(".")
+// StatusChallenge config for requiring status requests to prove the ownership of their skycoin address,
+// by signing a nonce of /api/status/challenge with the secret key of the address
+type StatusChallenge struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Lifetime of a nonce, a signed nonce can be used until it expires
+	TTL time.Duration `mapstructure:"ttl"`
+	// HMAC key of the nonces. Set the same secret on teller instances behind a load balancer,
+	// if empty a random secret is created at startup.
+	Secret string `mapstructure:"secret"`
+}
 
-	setDefaults()
+// BindSignature config for requiring bind requests to be signed with the secret key of their skycoin address,
+// so that deposit addresses can't be bound to someone else's skycoin address
+type BindSignature struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Maximum difference between the timestamp of a signed bind request and the current time
+	MaxClockSkew time.Duration `mapstructure:"max_clock_skew"`
+}
 
-	cfg := Config{}
+// Campaigns config for campaigns, which have their own deposit address pools, rates and SKY caps.
+// Campaigns are created and filled with addresses on the admin panel.
+type Campaigns struct {
+	Enabled bool `mapstructure:"enabled"`
+}
 
-	if err := viper.ReadInConfig(); err != nil {
-		return cfg, err
+// Quotes config for fixed-price quotes of /api/quote, for OTC desks that need price certainty.
+// Deposits to an address bound with a quote get its rate until it expires.
+type Quotes struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Quotes expire after TTL
+	TTL time.Duration `mapstructure:"ttl"`
+	// Deposit amount range the quoted rate applies to, in coins. Empty for no limit.
+	MinAmount string `mapstructure:"min_amount"`
+	MaxAmount string `mapstructure:"max_amount"`
+}
+
+// PromoCodes config for promo and referral codes, which give the deposits to the addresses bound with them a bonus.
+// Codes are created and updated on the admin panel.
+type PromoCodes struct {
+	Enabled bool `mapstructure:"enabled"`
+}
+
+// AddressProvider config for fetching deposit addresses from a remote address service, e.g. a service in front
+// of an HSM, instead of reading them from the address files
+type AddressProvider struct {
+	Enabled bool `mapstructure:"enabled"`
+	// URL of the address service, see addrs.RemoteClient
+	URL string `mapstructure:"url"`
+	// Bearer token of the requests to the address service
+	APIKey  string        `mapstructure:"api_key"`
+	Timeout time.Duration `mapstructure:"timeout"`
+	// Number of addresses fetched at a time and cached until they are given out
+	BatchSize int `mapstructure:"batch_size"`
+}
+
+// Encryption config for encrypting the deposit address pools and the API key secrets in the db
+type Encryption struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Passphrase the encryption key is derived from. If empty, it is prompted for at startup
+	Passphrase string `mapstructure:"passphrase"`
+}
+
+// KYC config for checking the skycoin addresses of deposits with a KYC service.
+// Deposits of addresses whose owners did not pass KYC are held as pending_kyc until they pass it,
+// or until they are released on the admin panel.
+type KYC struct {
+	Enabled bool `mapstructure:"enabled"`
+	// URL of the KYC service, see kyc.Client
+	URL string `mapstructure:"url"`
+	// Bearer token of the requests to the KYC service
+	APIKey  string        `mapstructure:"api_key"`
+	Timeout time.Duration `mapstructure:"timeout"`
+	// Deposits buying at least Threshold SKY are checked. Empty to check every deposit.
+	Threshold string `mapstructure:"threshold"`
+	// Also require the owner of the skycoin address of /api/bind requests to pass KYC
+	AtBind bool `mapstructure:"at_bind"`
+	// Interval the addresses of held deposits are checked again at, 0 to only release them on the admin panel
+	RecheckInterval time.Duration `mapstructure:"recheck_interval"`
+}
+
+// Screening config for screening new deposits for AML risk. Flagged deposits are held for review
+// until they are approved or rejected on the admin panel.
+type Screening struct {
+	Enabled bool `mapstructure:"enabled"`
+	// "rules" to screen with the local rules, or "api" to screen with the risk API at URL
+	Provider string `mapstructure:"provider"`
+	// rules: deposits of at least MaxValue coins are flagged. Empty for no limit.
+	MaxValue string `mapstructure:"max_value"`
+	// api: URL of the risk API, see screening.Client
+	URL string `mapstructure:"url"`
+	// api: bearer token of the requests to the risk API
+	APIKey  string        `mapstructure:"api_key"`
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+// APIKeys config for the API keys of trusted integrators, who sign their API requests
+type APIKeys struct {
+	// Verify signed API requests, and serve the API key admin API on the admin panel
+	Enabled bool `mapstructure:"enabled"`
+	// Maximum difference between the timestamp of a signed request and the current time
+	MaxClockSkew time.Duration `mapstructure:"max_clock_skew"`
+	// Maximum number of deposit addresses per skycoin address for signed bind requests of keys
+	// created without max_bound_addrs, 0 for no limit
+	MaxBoundBtcAddresses int `mapstructure:"max_bound_btc_addrs"`
+}
+
+// Alerts config for alerting operators of critical events by email, Slack, Telegram or the sinks of the registry
+type Alerts struct {
+	Enabled bool `mapstructure:"enabled"`
+	// An event is alerted at most once per cooldown
+	Cooldown time.Duration `mapstructure:"cooldown"`
+	// How often the scanners and the deposit address pool are checked
+	CheckPeriod time.Duration `mapstructure:"check_period"`
+	// Alert when a scanner is more than this many confirmed blocks behind
+	ScannerBehindBlocks int64 `mapstructure:"scanner_behind_blocks"`
+	// Alert when fewer than this many BTC deposit addresses are left
+	AddressPoolLow uint64 `mapstructure:"address_pool_low"`
+	// Alert when the API responds with this many 5xx errors within http_errors_window
+	HTTPErrors       int           `mapstructure:"http_errors"`
+	HTTPErrorsWindow time.Duration `mapstructure:"http_errors_window"`
+	// Alert deposits of at least this many coins, of any coin type. Empty to disable.
+	LargeDeposit string `mapstructure:"large_deposit"`
+	// Alert when more than this many deposits are credited to the same skycoin address within
+	// repeated_deposits_window. 0 to disable.
+	RepeatedDeposits       int           `mapstructure:"repeated_deposits"`
+	RepeatedDepositsWindow time.Duration `mapstructure:"repeated_deposits_window"`
+	// Alert when more than bind_spike_factor times the average number of binds per bind_spike_window
+	// of the preceding bind_spike_baseline, and at least bind_spike_min binds, are made within bind_spike_window.
+	// 0 to disable.
+	BindSpikeFactor   float64       `mapstructure:"bind_spike_factor"`
+	BindSpikeMin      int           `mapstructure:"bind_spike_min"`
+	BindSpikeWindow   time.Duration `mapstructure:"bind_spike_window"`
+	BindSpikeBaseline time.Duration `mapstructure:"bind_spike_baseline"`
+
+	Severity AlertSeverity `mapstructure:"severity"`
+
+	SMTP     AlertSMTP     `mapstructure:"smtp"`
+	Slack    AlertSlack    `mapstructure:"slack"`
+	Telegram AlertTelegram `mapstructure:"telegram"`
+
+	// Sinks of any registered sink type, next to the smtp, slack and telegram sinks above
+	Sinks []AlertSink `mapstructure:"sinks"`
+	// Routes of events to sinks. Without routes, every sink receives every event
+	Routes []AlertRoute `mapstructure:"routes"`
+}
+
+// AlertSink config for a sink of the alert sink registry
+type AlertSink struct {
+	// Name of the sink in routes
+	Name string `mapstructure:"name"`
+	// "log", "webhook", "smtp", "slack", "telegram", or a sink type registered by a plugin
+	Type string `mapstructure:"type"`
+	// Only alerts of at least this severity are sent, all alerts if empty
+	MinSeverity string `mapstructure:"min_severity"`
+	// text/template of the subject and of the text of the alerts. The default format if empty
+	SubjectTemplate string `mapstructure:"subject_template"`
+	Template        string `mapstructure:"template"`
+	// URL of a webhook or of a Slack incoming webhook
+	URL string `mapstructure:"url"`
+	// Secret that webhook requests are signed with HMAC-SHA256. Requests are not signed if empty
+	Secret string `mapstructure:"secret"`
+	// SMTP server host:port, PLAIN auth if username is set, sender and recipients
+	Addr     string   `mapstructure:"addr"`
+	Username string   `mapstructure:"username"`
+	Password string   `mapstructure:"password"`
+	From     string   `mapstructure:"from"`
+	To       []string `mapstructure:"to"`
+	// Telegram bot and chat
+	BotToken string `mapstructure:"bot_token"`
+	ChatID   string `mapstructure:"chat_id"`
+}
+
+// SinkConfig returns the alert.SinkConfig of the sink
+func (c AlertSink) SinkConfig() alert.SinkConfig {
+	return alert.SinkConfig{
+		URL:    c.URL,
+		Secret: c.Secret,
+		SMTP: alert.SMTPConfig{
+			Addr:     c.Addr,
+			Username: c.Username,
+			Password: c.Password,
+			From:     c.From,
+			To:       c.To,
+		},
+		BotToken: c.BotToken,
+		ChatID:   c.ChatID,
 	}
+}
 
-	if err := viper.Unmarshal(&cfg); err != nil {
-		return cfg, err
+// Options returns the alert.SinkOptions of the sink
+func (c AlertSink) Options() (alert.SinkOptions, error) {
+	opts := alert.SinkOptions{
+		MinSeverity: alert.SeverityInfo,
 	}
 
-	if err := cfg.Validate(); err != nil {
-		return cfg, err
+	if c.MinSeverity != "" {
+		s, err := alert.ParseSeverity(c.MinSeverity)
+		if err != nil {
+			return alert.SinkOptions{}, fmt.Errorf("min_severity invalid: %v", err)
+		}
+		if s == alert.SeverityOff {
+			return alert.SinkOptions{}, errors.New("min_severity can't be off, remove the sink instead")
+		}
+		opts.MinSeverity = s
 	}
 
-	return cfg, nil
+	if c.SubjectTemplate != "" || c.Template != "" {
+		t, err := alert.NewTemplate(c.SubjectTemplate, c.Template)
+		if err != nil {
+			return alert.SinkOptions{}, err
+		}
+		opts.Template = t
+	}
+
+	return opts, nil
+}
+
+// AlertRoute config for routing events to sinks
+type AlertRoute struct {
+	// Events routed, all events if empty
+	Events []string `mapstructure:"events"`
+	// Names of the sinks: the name of an alerts.sinks entry, or smtp, slack or telegram for the sinks above
+	Sinks []string `mapstructure:"sinks"`
+}
+
+// AlertSeverity config for the severity of each alerted event, "off", "info", "warning" or "critical"
+type AlertSeverity struct {
+	SendFailed       string `mapstructure:"send_failed"`
+	ScannerBehind    string `mapstructure:"scanner_behind"`
+	WalletBalanceLow string `mapstructure:"wallet_balance_low"`
+	AddressPoolLow   string `mapstructure:"address_pool_low"`
+	HTTPErrors       string `mapstructure:"http_errors"`
+	LargeDeposit     string `mapstructure:"large_deposit"`
+	RepeatedDeposits string `mapstructure:"repeated_deposits"`
+	BindSpike        string `mapstructure:"bind_spike"`
+	DoubleSpend      string `mapstructure:"double_spend"`
+}
+
+// Severities returns the severity of each event, keyed by the alert event name
+func (c AlertSeverity) Severities() (map[string]alert.Severity, error) {
+	events := map[string]string{
+		alert.EventSendFailed:       c.SendFailed,
+		alert.EventScannerBehind:    c.ScannerBehind,
+		alert.EventWalletBalanceLow: c.WalletBalanceLow,
+		alert.EventAddressPoolLow:   c.AddressPoolLow,
+		alert.EventHTTPErrors:       c.HTTPErrors,
+		alert.EventLargeDeposit:     c.LargeDeposit,
+		alert.EventRepeatedDeposits: c.RepeatedDeposits,
+		alert.EventBindSpike:        c.BindSpike,
+		alert.EventDoubleSpend:      c.DoubleSpend,
+	}
+
+	severities := make(map[string]alert.Severity, len(events))
+	for event, v := range events {
+		s, err := alert.ParseSeverity(v)
+		if err != nil {
+			return nil, fmt.Errorf("alerts.severity.%s invalid: %v", event, err)
+		}
+		severities[event] = s
+	}
+
+	return severities, nil
+}
+
+// AlertSMTP config for emailing alerts
+type AlertSMTP struct {
+	Enabled bool `mapstructure:"enabled"`
+	// host:port of the SMTP server
+	Addr string `mapstructure:"addr"`
+	// PLAIN auth is used if set
+	Username string   `mapstructure:"username"`
+	Password string   `mapstructure:"password"`
+	From     string   `mapstructure:"from"`
+	To       []string `mapstructure:"to"`
+	// Only alerts of at least this severity are emailed
+	MinSeverity string `mapstructure:"min_severity"`
+}
+
+// AlertSlack config for posting alerts to a Slack incoming webhook
+type AlertSlack struct {
+	Enabled    bool   `mapstructure:"enabled"`
+	WebhookURL string `mapstructure:"webhook_url"`
+	// Only alerts of at least this severity are posted
+	MinSeverity string `mapstructure:"min_severity"`
+}
+
+// AlertTelegram config for sending alerts to a Telegram chat through a bot
+type AlertTelegram struct {
+	Enabled  bool   `mapstructure:"enabled"`
+	BotToken string `mapstructure:"bot_token"`
+	ChatID   string `mapstructure:"chat_id"`
+	// Only alerts of at least this severity are sent
+	MinSeverity string `mapstructure:"min_severity"`
+}
+
+// Reports config for the daily reconciliation reports
+type Reports struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Directory the reports are saved in, relative to the data directory unless absolute
+	Dir string `mapstructure:"dir"`
+	// How often to check whether the previous day's report is due
+	CheckPeriod time.Duration `mapstructure:"check_period"`
+	// Email the daily reports to alerts.smtp.to
+	Email bool `mapstructure:"email"`
+}
+
+// Notifications config for emailing users when their deposits are done or fail
+type Notifications struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Secret that the email addresses are encrypted and hashed with. Can't be changed once emails are stored
+	Secret string `mapstructure:"secret"`
+	// URL of the teller API that the unsubscribe links point to, e.g. https://teller.example.com
+	BaseURL string `mapstructure:"base_url"`
+	// Sender of the notifications, alerts.smtp.from if empty
+	From string `mapstructure:"from"`
+	// text/template of the subject and of the text of the notifications, the defaults if empty
+	SubjectTemplate string `mapstructure:"subject_template"`
+	Template        string `mapstructure:"template"`
+	// How often to check the outbox for new notifications
+	DispatchPeriod time.Duration `mapstructure:"dispatch_period"`
+	// Maximum wait before retrying a failed email
+	MaxBackoff time.Duration `mapstructure:"max_backoff"`
+}
+
+// Archive config for moving the processed deposits out of the db, into archive files
+type Archive struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Deposits processed more than RetentionDays ago are archived
+	RetentionDays int `mapstructure:"retention_days"`
+	// Directory the archives are saved in, relative to the data directory unless absolute
+	Dir string `mapstructure:"dir"`
+	// How often to archive the deposits that passed the retention period
+	CheckPeriod time.Duration `mapstructure:"check_period"`
+}
+
+// Retention returns the retention period of the deposits
+func (c Archive) Retention() time.Duration {
+	return time.Duration(c.RetentionDays) * time.Hour * 24
+}
+
+// Backup config for taking encrypted snapshots of the db, optionally uploaded to an S3-compatible bucket
+type Backup struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Directory the snapshots are saved in, relative to the data directory unless absolute
+	Dir string `mapstructure:"dir"`
+	// How often a snapshot is taken
+	Interval time.Duration `mapstructure:"interval"`
+	// Number of snapshots kept in dir, the oldest are deleted
+	Keep int `mapstructure:"keep"`
+	// Passphrase the snapshots are encrypted with
+	Passphrase string `mapstructure:"passphrase"`
+
+	S3 BackupS3 `mapstructure:"s3"`
+}
+
+// BackupS3 config for uploading the snapshots and the deposit archives to a bucket of an S3-compatible service
+type BackupS3 struct {
+	Enabled bool `mapstructure:"enabled"`
+	// URL of the S3 API, e.g. https://s3.amazonaws.com, or of an S3-compatible service
+	Endpoint string `mapstructure:"endpoint"`
+	Region   string `mapstructure:"region"`
+	Bucket   string `mapstructure:"bucket"`
+	// Prefix of the keys of the objects, e.g. teller/
+	Prefix          string `mapstructure:"prefix"`
+	AccessKeyID     string `mapstructure:"access_key_id"`
+	SecretAccessKey string `mapstructure:"secret_access_key"`
+	// Number of snapshots kept in the bucket, the oldest are deleted
+	Keep int `mapstructure:"keep"`
+}
+
+// Sentry config for reporting errors to Sentry
+type Sentry struct {
+	Enabled bool `mapstructure:"enabled"`
+	// DSN of the Sentry project, https://<key>@<host>/<project id>
+	DSN string `mapstructure:"dsn"`
+	// Environment of the reported errors, e.g. "production"
+	Environment string `mapstructure:"environment"`
+}
+
+// Tracing config for tracing API requests and deposits with OpenTelemetry
+type Tracing struct {
+	Enabled bool `mapstructure:"enabled"`
+	// OTLP/HTTP traces endpoint of the collector, e.g. http://127.0.0.1:4318/v1/traces
+	OTLPEndpoint string `mapstructure:"otlp_endpoint"`
+	// service.name of the spans
+	ServiceName string `mapstructure:"service_name"`
+	// Ratio of the traces that are sampled, between 0 and 1
+	SampleRatio float64 `mapstructure:"sample_ratio"`
+}
+
+// Secrets config for fetching secrets from a secrets manager at startup, instead of the config file
+type Secrets struct {
+	// Secrets manager, empty to not use one, or "vault"
+	Provider string `mapstructure:"provider"`
+	// How often the credentials of the secrets manager are renewed
+	RenewPeriod time.Duration `mapstructure:"renew_period"`
+	Vault       SecretsVault  `mapstructure:"vault"`
+}
+
+// SecretsVault config for fetching secrets from a KV version 2 secret of HashiCorp Vault
+type SecretsVault struct {
+	// Address of the Vault server, e.g. https://127.0.0.1:8200
+	Addr string `mapstructure:"addr"`
+	// Token that authenticates to Vault
+	Token string `mapstructure:"token"`
+	// File the token is read from before each request, instead of token
+	TokenFile string `mapstructure:"token_file"`
+	// CA certificate that the Vault server certificate is verified with, if not a system CA
+	CACert string `mapstructure:"ca_cert"`
+	// Mount path of the KV version 2 secrets engine
+	Mount string `mapstructure:"mount"`
+	// Path of the secret in the secrets engine
+	Path string `mapstructure:"path"`
+}
+
+// AdminPanel config for the admin panel AdminPanel
+type AdminPanel struct {
+	Host string `mapstructure:"host"`
+	// TLS certificate and key of the admin API. It is served over plain HTTP if unset
+	TLSCert string `mapstructure:"tls_cert"`
+	TLSKey  string `mapstructure:"tls_key"`
+	// CA certificate that client certificates are verified with, for principals with a client_cert_cn
+	ClientCA string `mapstructure:"client_ca"`
+	// Principals allowed to use the admin API, with their roles.
+	// If there are none, the admin API is open to anyone who can connect to host
+	Principals []AdminPrincipal `mapstructure:"principals"`
+}
+
+// AdminPrincipal config for a user or system allowed to use the admin API
+type AdminPrincipal struct {
+	Name string `mapstructure:"name"`
+	// "viewer", "operator" or "admin"
+	Role string `mapstructure:"role"`
+	// Bearer token the principal authenticates with
+	Token string `mapstructure:"token"`
+	// Common name of a client certificate, signed by admin_panel.client_ca, that the principal authenticates with
+	ClientCertCN string `mapstructure:"client_cert_cn"`
+}
+
+// AdminDashboard config for the web admin dashboard, served on its own listener behind HTTP basic auth
+type AdminDashboard struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Host    string `mapstructure:"host"`
+	// Credentials of the HTTP basic auth
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+}
+
+// ProcessUpgrade config for zero-downtime upgrades, where a new teller process started on SIGUSR2
+// takes over the listening sockets of the running one
+type ProcessUpgrade struct {
+	// How long to wait for the new process to be ready, and for the new process to wait
+	// for the old one to finish its in-flight work and release the db
+	Timeout time.Duration `mapstructure:"timeout"`
+	// File the pid of the running teller process is written to, e.g. for the PIDFile of a systemd service.
+	// Relative to the data directory unless absolute.
+	PIDFile string `mapstructure:"pid_file"`
+}
+
+// Dummy config for the fake sender and scanner
+type Dummy struct {
+	Scanner  bool   `mapstructure:"scanner"`
+	Sender   bool   `mapstructure:"sender"`
+	HTTPAddr string `mapstructure:"http_addr"`
+}
+
+// Redacted returns a copy of the config with sensitive information redacted
+func (c Config) Redacted() Config {
+	if c.BtcRPC.User != "" {
+		c.BtcRPC.User = "<redacted>"
+	}
+
+	if c.BtcRPC.Pass != "" {
+		c.BtcRPC.Pass = "<redacted>"
+	}
+
+	if len(c.AdminPanel.Principals) != 0 {
+		principals := make([]AdminPrincipal, len(c.AdminPanel.Principals))
+		for i, p := range c.AdminPanel.Principals {
+			if p.Token != "" {
+				p.Token = "<redacted>"
+			}
+			principals[i] = p
+		}
+		c.AdminPanel.Principals = principals
+	}
+
+	if len(c.BtcRPC.FallbackNodes) != 0 {
+		nodes := make([]BtcRPCNode, len(c.BtcRPC.FallbackNodes))
+		for i, n := range c.BtcRPC.FallbackNodes {
+			if n.User != "" {
+				n.User = "<redacted>"
+			}
+			if n.Pass != "" {
+				n.Pass = "<redacted>"
+			}
+			nodes[i] = n
+		}
+		c.BtcRPC.FallbackNodes = nodes
+	}
+
+	if c.LtcRPC.User != "" {
+		c.LtcRPC.User = "<redacted>"
+	}
+
+	if c.LtcRPC.Pass != "" {
+		c.LtcRPC.Pass = "<redacted>"
+	}
+
+	if c.Logging.ScrubSecret != "" {
+		c.Logging.ScrubSecret = "<redacted>"
+	}
+
+	if c.Redis.Password != "" {
+		c.Redis.Password = "<redacted>"
+	}
+
+	if c.Captcha.Secret != "" {
+		c.Captcha.Secret = "<redacted>"
+	}
+
+	if c.Outbox.WebhookSecret != "" {
+		c.Outbox.WebhookSecret = "<redacted>"
+	}
+
+	if c.Stream.Password != "" {
+		c.Stream.Password = "<redacted>"
+	}
+
+	if c.Stream.Token != "" {
+		c.Stream.Token = "<redacted>"
+	}
+
+	if c.Settlement.WebhookSecret != "" {
+		c.Settlement.WebhookSecret = "<redacted>"
+	}
+
+	if c.Alerts.SMTP.Password != "" {
+		c.Alerts.SMTP.Password = "<redacted>"
+	}
+
+	if c.Notifications.Secret != "" {
+		c.Notifications.Secret = "<redacted>"
+	}
+
+	if c.AddressProvider.APIKey != "" {
+		c.AddressProvider.APIKey = "<redacted>"
+	}
+
+	if c.Encryption.Passphrase != "" {
+		c.Encryption.Passphrase = "<redacted>"
+	}
+
+	if c.KYC.APIKey != "" {
+		c.KYC.APIKey = "<redacted>"
+	}
+
+	if c.Screening.APIKey != "" {
+		c.Screening.APIKey = "<redacted>"
+	}
+
+	// The webhook URL path is the secret of a Slack incoming webhook
+	if c.Alerts.Slack.WebhookURL != "" {
+		c.Alerts.Slack.WebhookURL = "<redacted>"
+	}
+
+	if c.Alerts.Telegram.BotToken != "" {
+		c.Alerts.Telegram.BotToken = "<redacted>"
+	}
+
+	if len(c.Alerts.Sinks) != 0 {
+		sinks := make([]AlertSink, len(c.Alerts.Sinks))
+		for i, s := range c.Alerts.Sinks {
+			// The URL can hold a secret, e.g. of a Slack incoming webhook
+			if s.URL != "" {
+				s.URL = "<redacted>"
+			}
+			if s.Secret != "" {
+				s.Secret = "<redacted>"
+			}
+			if s.Password != "" {
+				s.Password = "<redacted>"
+			}
+			if s.BotToken != "" {
+				s.BotToken = "<redacted>"
+			}
+			sinks[i] = s
+		}
+		c.Alerts.Sinks = sinks
+	}
+
+	if c.Secrets.Vault.Token != "" {
+		c.Secrets.Vault.Token = "<redacted>"
+	}
+
+	if c.Backup.Passphrase != "" {
+		c.Backup.Passphrase = "<redacted>"
+	}
+
+	if c.Backup.S3.SecretAccessKey != "" {
+		c.Backup.S3.SecretAccessKey = "<redacted>"
+	}
+
+	// The DSN includes the key of the Sentry project
+	if c.Sentry.DSN != "" {
+		c.Sentry.DSN = "<redacted>"
+	}
+
+	if c.StatusChallenge.Secret != "" {
+		c.StatusChallenge.Secret = "<redacted>"
+	}
+
+	if c.Tor.ControlPassword != "" {
+		c.Tor.ControlPassword = "<redacted>"
+	}
+
+	if c.AdminDashboard.Password != "" {
+		c.AdminDashboard.Password = "<redacted>"
+	}
+
+	return c
+}
+
+// Validate validates the config
+func (c Config) Validate() error {
+	var errs []string
+	oops := func(err string) {
+		errs = append(errs, err)
+	}
+
+	if c.LogFilename == "" {
+		oops("logfile missing")
+	}
+
+	switch c.Logging.Format {
+	case LogFormatText, LogFormatJSON:
+	default:
+		oops(fmt.Sprintf("logging.format must be %q or %q", LogFormatText, LogFormatJSON))
+	}
+
+	if c.Logging.MaxSizeMB < 0 {
+		oops("logging.max_size_mb can't be negative")
+	}
+
+	if c.Logging.MaxAge < 0 {
+		oops("logging.max_age can't be negative")
+	}
+
+	if c.Logging.MaxBackups < 0 {
+		oops("logging.max_backups can't be negative")
+	}
+
+	if c.Logging.AuditFile != "" && c.Logging.AuditFile == c.LogFilename {
+		oops("logging.audit_file can't be the logfile")
+	}
+
+	if c.Logging.ScrubPII {
+		switch c.Logging.ScrubMode {
+		case LogScrubHash:
+			if c.Logging.ScrubSecret == "" {
+				oops(`logging.scrub_secret missing, required if logging.scrub_mode is "hash"`)
+			}
+		case LogScrubTruncate:
+		default:
+			oops(fmt.Sprintf("logging.scrub_mode must be %q or %q", LogScrubHash, LogScrubTruncate))
+		}
+	}
+
+	if c.AddressProvider.Enabled {
+		if c.AddressProvider.URL == "" {
+			oops("address_provider.url missing")
+		} else if u, err := url.Parse(c.AddressProvider.URL); err != nil {
+			oops(fmt.Sprintf("address_provider.url invalid: %v", err))
+		} else if u.Scheme != "http" && u.Scheme != "https" {
+			oops("address_provider.url must be an http or https URL")
+		}
+
+		if c.AddressProvider.Timeout < 0 {
+			oops("address_provider.timeout can't be negative")
+		}
+
+		if c.AddressProvider.BatchSize < 1 {
+			oops("address_provider.batch_size must be at least 1")
+		}
+	} else if c.BtcAddresses == "" {
+		oops("btc_addresses missing")
+	}
+
+	// TODO -- check btc_addresses file
+
+	if c.Teller.MaxSkyPerAddress != "" {
+		if _, err := droplet.FromString(c.Teller.MaxSkyPerAddress); err != nil {
+			oops(fmt.Sprintf("teller.max_sky_per_addr invalid: %v", err))
+		}
+	}
+
+	if c.Teller.BindTTL < 0 {
+		oops("teller.bind_ttl can't be negative")
+	}
+
+	if c.Teller.RecycleAddresses && c.Teller.RecycleCoolDown <= 0 {
+		oops("teller.recycle_cooldown must be positive if teller.recycle_addresses is set")
+	}
+
+	if !c.Dummy.Sender {
+		if c.SkyRPC.Address == "" {
+			oops("sky_rpc.address missing")
+		}
+
+		addrs := map[string]struct{}{
+			c.SkyRPC.Address: {},
+		}
+		for i, a := range c.SkyRPC.FallbackAddresses {
+			if a == "" {
+				oops(fmt.Sprintf("sky_rpc.fallback_addresses[%d] is empty", i))
+			} else if _, ok := addrs[a]; ok {
+				oops(fmt.Sprintf("sky_rpc.fallback_addresses[%d] %s is duplicated", i, a))
+			}
+			addrs[a] = struct{}{}
+		}
+
+		if c.SkyRPC.HealthCheckPeriod < time.Second {
+			oops("sky_rpc.health_check_period must be at least 1s")
+		}
+		if c.SkyRPC.MaxBackoff < time.Second {
+			oops("sky_rpc.max_backoff must be at least 1s")
+		}
+
+		// test if a skycoin node rpc service is reachable.
+		// With fallback nodes, teller can start while some of them are down.
+		var dialErr error
+		for _, a := range c.SkyRPC.Addresses() {
+			conn, err := net.Dial("tcp", a)
+			if err != nil {
+				dialErr = err
+				continue
+			}
+			conn.Close()
+			dialErr = nil
+			break
+		}
+		if dialErr != nil {
+			if len(c.SkyRPC.FallbackAddresses) == 0 {
+				oops(fmt.Sprintf("sky_rpc.address connect failed: %v", dialErr))
+			} else {
+				oops(fmt.Sprintf("sky_rpc.address and sky_rpc.fallback_addresses connect failed: %v", dialErr))
+			}
+		}
+	}
+
+	if !c.Dummy.Scanner && c.BtcScanner.Backend == BtcScannerBackendBtcd {
+		if c.BtcRPC.Server == "" {
+			oops("btc_rpc.server missing")
+		}
+
+		if c.BtcRPC.User == "" {
+			oops("btc_rpc.user missing")
+		}
+		if c.BtcRPC.Pass == "" {
+			oops("btc_rpc.pass missing")
+		}
+		if c.BtcRPC.Cert == "" {
+			oops("btc_rpc.cert missing")
+		}
+
+		if _, err := os.Stat(c.BtcRPC.Cert); os.IsNotExist(err) {
+			oops("btc_rpc.cert file does not exist")
+		}
+
+		if len(c.BtcRPC.FallbackNodes) != 0 && c.BtcRPC.HealthCheckPeriod < time.Second {
+			oops("btc_rpc.health_check_period must be at least 1s")
+		}
+
+		servers := map[string]struct{}{
+			c.BtcRPC.Server: {},
+		}
+		for i, n := range c.BtcRPC.FallbackNodes {
+			if n.Server == "" {
+				oops(fmt.Sprintf("btc_rpc.fallback_nodes[%d].server missing", i))
+			} else if _, ok := servers[n.Server]; ok {
+				oops(fmt.Sprintf("btc_rpc.fallback_nodes[%d].server %s is duplicated", i, n.Server))
+			}
+			servers[n.Server] = struct{}{}
+
+			if n.User == "" {
+				oops(fmt.Sprintf("btc_rpc.fallback_nodes[%d].user missing", i))
+			}
+			if n.Pass == "" {
+				oops(fmt.Sprintf("btc_rpc.fallback_nodes[%d].pass missing", i))
+			}
+			if n.Cert == "" {
+				oops(fmt.Sprintf("btc_rpc.fallback_nodes[%d].cert missing", i))
+			} else if _, err := os.Stat(n.Cert); os.IsNotExist(err) {
+				oops(fmt.Sprintf("btc_rpc.fallback_nodes[%d].cert file does not exist", i))
+			}
+		}
+	}
+
+	if c.BtcScanner.ConfirmationsRequired < 0 {
+		oops("btc_scanner.confirmations_required must be >= 0")
+	}
+	if err := validateDustThreshold("btc_scanner", c.BtcScanner.DustThreshold); err != nil {
+		oops(err.Error())
+	}
+	if err := validateConfirmationTiers("btc_scanner", c.BtcScanner.ConfirmationTiers); err != nil {
+		oops(err.Error())
+	}
+	if c.BtcScanner.InitialScanHeight < 0 {
+		oops("btc_scanner.initial_scan_height must be >= 0")
+	}
+	if err := validateZMQAddress(c.BtcScanner.ZMQAddress); err != nil {
+		oops(fmt.Sprintf("btc_scanner.zmq_address invalid: %v", err))
+	}
+	if c.BtcScanner.ScanConcurrency < 1 {
+		oops("btc_scanner.scan_concurrency must be >= 1")
+	}
+	if c.BtcScanner.ScanShards < 1 {
+		oops("btc_scanner.scan_shards must be >= 1")
+	}
+
+	switch c.BtcScanner.Backend {
+	case BtcScannerBackendBtcd:
+	case BtcScannerBackendElectrum:
+		if c.BtcScanner.ElectrumServer == "" {
+			oops("btc_scanner.electrum_server missing")
+		} else if _, _, err := net.SplitHostPort(c.BtcScanner.ElectrumServer); err != nil {
+			oops(fmt.Sprintf("btc_scanner.electrum_server invalid: %v", err))
+		}
+
+		if c.BtcScanner.ElectrumCert != "" {
+			if !c.BtcScanner.ElectrumTLS {
+				oops("btc_scanner.electrum_cert requires btc_scanner.electrum_tls")
+			}
+			if _, err := os.Stat(c.BtcScanner.ElectrumCert); os.IsNotExist(err) {
+				oops("btc_scanner.electrum_cert file does not exist")
+			}
+		}
+	case BtcScannerBackendBlockbook:
+		if c.BtcScanner.BlockbookURL == "" {
+			oops("btc_scanner.blockbook_url missing")
+		} else if u, err := url.Parse(c.BtcScanner.BlockbookURL); err != nil {
+			oops(fmt.Sprintf("btc_scanner.blockbook_url invalid: %v", err))
+		} else if u.Scheme != "http" && u.Scheme != "https" {
+			oops("btc_scanner.blockbook_url must be an http or https URL")
+		}
+	default:
+		oops(fmt.Sprintf("btc_scanner.backend must be %q, %q or %q", BtcScannerBackendBtcd, BtcScannerBackendElectrum, BtcScannerBackendBlockbook))
+	}
+
+	if c.BtcScanner.Backend != BtcScannerBackendBtcd && c.BtcScanner.ZMQAddress != "" {
+		oops("btc_scanner.zmq_address can only be used with the btcd backend")
+	}
+
+	if c.BtcScanner.Backend == BtcScannerBackendBtcd && c.BtcScanner.ScanShards > 1 {
+		oops("btc_scanner.scan_shards can only be used with the electrum and blockbook backends")
+	}
+
+	if _, err := mathutil.DecimalFromString(c.SkyExchanger.SkyBtcExchangeRate); err != nil {
+		oops(fmt.Sprintf("sky_exchanger.sky_btc_exchange_rate invalid: %v", err))
+	}
+
+	if c.LtcScanner.Enabled {
+		if c.LtcAddresses == "" && !c.AddressProvider.Enabled {
+			oops("ltc_addresses missing")
+		}
+
+		if !c.Dummy.Scanner {
+			if c.LtcRPC.Server == "" {
+				oops("ltc_rpc.server missing")
+			}
+			if c.LtcRPC.User == "" {
+				oops("ltc_rpc.user missing")
+			}
+			if c.LtcRPC.Pass == "" {
+				oops("ltc_rpc.pass missing")
+			}
+		}
+
+		if c.LtcScanner.ConfirmationsRequired < 0 {
+			oops("ltc_scanner.confirmations_required must be >= 0")
+		}
+		if err := validateDustThreshold("ltc_scanner", c.LtcScanner.DustThreshold); err != nil {
+			oops(err.Error())
+		}
+		if err := validateConfirmationTiers("ltc_scanner", c.LtcScanner.ConfirmationTiers); err != nil {
+			oops(err.Error())
+		}
+		if c.LtcScanner.InitialScanHeight < 0 {
+			oops("ltc_scanner.initial_scan_height must be >= 0")
+		}
+		if err := validateZMQAddress(c.LtcScanner.ZMQAddress); err != nil {
+			oops(fmt.Sprintf("ltc_scanner.zmq_address invalid: %v", err))
+		}
+		if c.LtcScanner.ScanConcurrency < 1 {
+			oops("ltc_scanner.scan_concurrency must be >= 1")
+		}
+
+		if _, err := mathutil.DecimalFromString(c.SkyExchanger.SkyLtcExchangeRate); err != nil {
+			oops(fmt.Sprintf("sky_exchanger.sky_ltc_exchange_rate invalid: %v", err))
+		}
+	}
+
+	if c.ERC20Scanner.Enabled {
+		if c.EthAddresses == "" && !c.AddressProvider.Enabled {
+			oops("eth_addresses missing")
+		}
+
+		if !c.Dummy.Scanner && c.EthRPC.URL == "" {
+			oops("eth_rpc.url missing")
+		}
+
+		if c.ERC20Scanner.ConfirmationsRequired < 0 {
+			oops("erc20_scanner.confirmations_required must be >= 0")
+		}
+		if err := validateDustThreshold("erc20_scanner", c.ERC20Scanner.DustThreshold); err != nil {
+			oops(err.Error())
+		}
+		if err := validateConfirmationTiers("erc20_scanner", c.ERC20Scanner.ConfirmationTiers); err != nil {
+			oops(err.Error())
+		}
+		if c.ERC20Scanner.InitialScanHeight < 0 {
+			oops("erc20_scanner.initial_scan_height must be >= 0")
+		}
+
+		if len(c.ERC20Scanner.Tokens) == 0 {
+			oops("erc20_scanner.tokens missing")
+		}
+
+		symbols := make(map[string]struct{}, len(c.ERC20Scanner.Tokens))
+		contracts := make(map[string]struct{}, len(c.ERC20Scanner.Tokens))
+		for i, t := range c.ERC20Scanner.Tokens {
+			switch t.Symbol {
+			case "":
+				oops(fmt.Sprintf("erc20_scanner.tokens[%d].symbol missing", i))
+			case "BTC", "LTC", "SKY":
+				oops(fmt.Sprintf("erc20_scanner.tokens[%d].symbol can't be %s", i, t.Symbol))
+			}
+			if _, ok := symbols[t.Symbol]; ok {
+				oops(fmt.Sprintf("erc20_scanner.tokens[%d].symbol %s is duplicated", i, t.Symbol))
+			}
+			symbols[t.Symbol] = struct{}{}
+
+			if err := addrs.VerifyETHAddress(strings.ToLower(t.Contract)); err != nil {
+				oops(fmt.Sprintf("erc20_scanner.tokens[%d].contract invalid: %v", i, err))
+			}
+			if _, ok := contracts[strings.ToLower(t.Contract)]; ok {
+				oops(fmt.Sprintf("erc20_scanner.tokens[%d].contract %s is duplicated", i, t.Contract))
+			}
+			contracts[strings.ToLower(t.Contract)] = struct{}{}
+
+			if t.Decimals < 0 {
+				oops(fmt.Sprintf("erc20_scanner.tokens[%d].decimals must be >= 0", i))
+			}
+
+			if _, err := mathutil.DecimalFromString(t.SkyExchangeRate); err != nil {
+				oops(fmt.Sprintf("erc20_scanner.tokens[%d].sky_exchange_rate invalid: %v", i, err))
+			}
+		}
+	}
+
+	if !c.Dummy.Sender && c.SkySigner.Enabled {
+		if c.SkySigner.URL == "" {
+			oops("sky_signer.url missing")
+		} else if u, err := url.Parse(c.SkySigner.URL); err != nil {
+			oops(fmt.Sprintf("sky_signer.url invalid: %v", err))
+		} else if u.Scheme != "https" {
+			oops("sky_signer.url must be an https URL")
+		}
+
+		for _, f := range []struct {
+			key, path string
+		}{
+			{"sky_signer.cert", c.SkySigner.Cert},
+			{"sky_signer.key", c.SkySigner.Key},
+			{"sky_signer.ca", c.SkySigner.CA},
+		} {
+			if f.path == "" {
+				oops(fmt.Sprintf("%s missing", f.key))
+			} else if _, err := os.Stat(f.path); os.IsNotExist(err) {
+				oops(fmt.Sprintf("%s file %s does not exist", f.key, f.path))
+			}
+		}
+	} else if !c.Dummy.Sender {
+		if c.SkyExchanger.Wallet == "" {
+			oops("sky_exchanger.wallet missing")
+		}
+
+		if _, err := os.Stat(c.SkyExchanger.Wallet); os.IsNotExist(err) {
+			oops(fmt.Sprintf("sky_exchanger.wallet file %s does not exist", c.SkyExchanger.Wallet))
+		}
+
+		w, err := wallet.Load(c.SkyExchanger.Wallet)
+		if err != nil {
+			oops(fmt.Sprintf("sky_exchanger.wallet file %s failed to load: %v", c.SkyExchanger.Wallet, err))
+		} else if err := w.Validate(); err != nil {
+			oops(fmt.Sprintf("sky_exchanger.wallet file %s is invalid: %v", c.SkyExchanger.Wallet, err))
+		}
+	}
+
+	if c.SkyExchanger.MaxDecimals < 0 {
+		oops("sky_exchanger.max_decimals can't be negative")
+	}
+
+	if uint64(c.SkyExchanger.MaxDecimals) > visor.MaxDropletPrecision {
+		oops(fmt.Sprintf("sky_exchanger.max_decimals is larger than visor.MaxDropletPrecision=%d", visor.MaxDropletPrecision))
+	}
+
+	if c.SkyExchanger.BatchWindow < 0 {
+		oops("sky_exchanger.batch_window can't be negative")
+	}
+
+	if c.SkyExchanger.BatchMaxSize < 1 {
+		oops("sky_exchanger.batch_max_size must be at least 1")
+	}
+
+	if c.SkyExchanger.DrainTimeout < 0 {
+		oops("sky_exchanger.drain_timeout can't be negative")
+	}
+
+	if c.SkyExchanger.DoubleSpendConfirmations < 0 {
+		oops("sky_exchanger.double_spend_confirmations can't be negative")
+	}
+
+	if c.SkyExchanger.DoubleSpendCheckPeriod < 0 {
+		oops("sky_exchanger.double_spend_check_period can't be negative")
+	}
+
+	if c.SkyExchanger.FeePercent != "" {
+		if fee, err := mathutil.DecimalFromString(c.SkyExchanger.FeePercent); err != nil {
+			oops(fmt.Sprintf("sky_exchanger.fee_percent invalid: %v", err))
+		} else if fee.Sign() < 0 {
+			oops("sky_exchanger.fee_percent can't be negative")
+		} else if fee.GreaterThanOrEqual(decimal.New(100, 0)) {
+			oops("sky_exchanger.fee_percent must be less than 100")
+		}
+	}
+
+	if c.WalletTopUp.Enabled {
+		if c.WalletTopUp.CheckPeriod < 0 {
+			oops("wallet_topup.check_period can't be negative")
+		}
+
+		if _, err := droplet.FromString(c.WalletTopUp.ResumeBalance); err != nil {
+			oops(fmt.Sprintf("wallet_topup.resume_balance invalid: %v", err))
+		}
+	}
+
+	if c.WalletBalance.Enabled {
+		if c.WalletBalance.CheckPeriod < 0 {
+			oops("wallet_balance.check_period can't be negative")
+		}
+
+		if _, err := droplet.FromString(c.WalletBalance.LowBalance); err != nil {
+			oops(fmt.Sprintf("wallet_balance.low_balance invalid: %v", err))
+		}
+	}
+
+	// A top-up resuming payouts below low_balance would be paused again by the next balance check
+	if c.WalletTopUp.Enabled && c.WalletBalance.Enabled && c.WalletBalance.PauseDeposits {
+		resume, err := droplet.FromString(c.WalletTopUp.ResumeBalance)
+		low, err2 := droplet.FromString(c.WalletBalance.LowBalance)
+		if err == nil && err2 == nil && resume < low {
+			oops("wallet_topup.resume_balance must be at least wallet_balance.low_balance")
+		}
+	}
+
+	if err := c.Web.Validate(); err != nil {
+		oops(err.Error())
+	}
+
+	if c.Web.RateLimitBackend == RateLimitBackendRedis && c.Redis.Addr == "" {
+		oops("redis.addr missing, required by web.ratelimit_backend")
+	}
+
+	if c.Tor.Enabled {
+		if c.Tor.ControlAddr == "" {
+			oops("tor.control_addr missing")
+		} else if _, _, err := net.SplitHostPort(c.Tor.ControlAddr); err != nil {
+			oops(fmt.Sprintf("tor.control_addr invalid: %v", err))
+		}
+
+		if c.Tor.KeyFile == "" {
+			oops("tor.key_file missing")
+		}
+
+		if c.Tor.VirtualPort < 1 || c.Tor.VirtualPort > 65535 {
+			oops("tor.virtual_port must be between 1 and 65535")
+		}
+
+		if c.TorTarget() == "" {
+			oops("tor.target missing, required if web.http_addr is not set or is a systemd socket")
+		}
+
+		if c.Tor.RetryDelay <= 0 {
+			oops("tor.retry_delay must be greater than zero")
+		}
+	}
+
+	if c.Redis.DB < 0 {
+		oops("redis.db can't be negative")
+	}
+
+	if c.HA.Enabled {
+		if c.Redis.Addr == "" {
+			oops("redis.addr missing, required by ha.enabled")
+		}
+
+		if c.HA.LockKey == "" {
+			oops("ha.lock_key missing")
+		}
+
+		if c.HA.LockTTL < time.Second {
+			oops("ha.lock_ttl must be at least 1s")
+		}
+
+		if c.HA.RetryPeriod <= 0 {
+			oops("ha.retry_period must be positive")
+		}
+	}
+
+	if c.Captcha.Enabled {
+		switch c.Captcha.Provider {
+		case captcha.ProviderRecaptcha, captcha.ProviderHCaptcha:
+		default:
+			oops(fmt.Sprintf("captcha.provider must be %q or %q", captcha.ProviderRecaptcha, captcha.ProviderHCaptcha))
+		}
+
+		if c.Captcha.SiteKey == "" {
+			oops("captcha.site_key missing")
+		}
+
+		if c.Captcha.Secret == "" {
+			oops("captcha.secret missing")
+		}
+	}
+
+	if c.Pricing.Enabled {
+		if (c.Pricing.GeoIPHeader == "") == (c.Pricing.GeoIPFile == "") {
+			oops("pricing.geoip_header or pricing.geoip_file must be set, but not both")
+		}
+
+		if len(c.Pricing.Regions) == 0 {
+			oops("pricing.regions missing")
+		}
+
+		names := make(map[string]struct{}, len(c.Pricing.Regions))
+		countries := make(map[string]string)
+		for i, r := range c.Pricing.Regions {
+			if r.Name == "" {
+				oops(fmt.Sprintf("pricing.regions[%d].name missing", i))
+			}
+			if _, ok := names[r.Name]; ok {
+				oops(fmt.Sprintf("pricing.regions[%d].name %s is duplicated", i, r.Name))
+			}
+			names[r.Name] = struct{}{}
+
+			if len(r.Countries) == 0 {
+				oops(fmt.Sprintf("pricing.regions[%d].countries missing", i))
+			}
+			for _, country := range r.Countries {
+				country = strings.ToUpper(country)
+				if len(country) != 2 {
+					oops(fmt.Sprintf("pricing.regions[%d].countries: %q is not an ISO 3166-1 alpha-2 code", i, country))
+				}
+				if other, ok := countries[country]; ok {
+					oops(fmt.Sprintf("pricing.regions[%d].countries: %s is also in region %s", i, country, other))
+				}
+				countries[country] = r.Name
+			}
+
+			if r.BonusPercent != "" {
+				if bonus, err := mathutil.DecimalFromString(r.BonusPercent); err != nil {
+					oops(fmt.Sprintf("pricing.regions[%d].bonus_percent invalid: %v", i, err))
+				} else if bonus.Sign() < 0 {
+					oops(fmt.Sprintf("pricing.regions[%d].bonus_percent can't be negative", i))
+				}
+			}
+
+			if r.MinSky != "" {
+				if _, err := droplet.FromString(r.MinSky); err != nil {
+					oops(fmt.Sprintf("pricing.regions[%d].min_sky invalid: %v", i, err))
+				}
+			}
+		}
+	}
+
+	if c.Outbox.Enabled {
+		if c.Outbox.WebhookURL == "" {
+			oops("outbox.webhook_url missing")
+		} else if u, err := url.Parse(c.Outbox.WebhookURL); err != nil {
+			oops(fmt.Sprintf("outbox.webhook_url invalid: %v", err))
+		} else if u.Scheme != "http" && u.Scheme != "https" {
+			oops("outbox.webhook_url must be an http or https URL")
+		}
+
+		if c.Outbox.DispatchPeriod < 0 {
+			oops("outbox.dispatch_period can't be negative")
+		}
+
+		if c.Outbox.MaxBackoff < 0 {
+			oops("outbox.max_backoff can't be negative")
+		}
+	}
+
+	if c.Stream.Enabled {
+		if c.Stream.URL == "" {
+			oops("stream.url missing")
+		} else if u, err := url.Parse(c.Stream.URL); err != nil {
+			oops(fmt.Sprintf("stream.url invalid: %v", err))
+		} else {
+			switch c.Stream.Backend {
+			case StreamBackendNATS:
+				if u.Scheme != "nats" && u.Scheme != "tls" {
+					oops("stream.url must be a nats:// or tls:// URL for the nats backend")
+				}
+				if c.Stream.User != "" && c.Stream.Token != "" {
+					oops("stream.user and stream.token can't both be set")
+				}
+			case StreamBackendKafka:
+				if u.Scheme != "http" && u.Scheme != "https" {
+					oops("stream.url must be the http or https URL of a Kafka REST proxy for the kafka backend")
+				}
+				if c.Stream.Token != "" {
+					oops("stream.token is only used by the nats backend")
+				}
+			}
+		}
+
+		switch c.Stream.Backend {
+		case StreamBackendNATS, StreamBackendKafka:
+		default:
+			oops(fmt.Sprintf("stream.backend must be %q or %q", StreamBackendNATS, StreamBackendKafka))
+		}
+
+		if c.Stream.Topic == "" {
+			oops("stream.topic missing")
+		} else if strings.ContainsAny(c.Stream.Topic, " \t\r\n") {
+			oops("stream.topic can't have whitespace")
+		}
+
+		if c.Stream.DispatchPeriod < 0 {
+			oops("stream.dispatch_period can't be negative")
+		}
+
+		if c.Stream.MaxBackoff < 0 {
+			oops("stream.max_backoff can't be negative")
+		}
+	}
+
+	if c.Settlement.Enabled {
+		if c.Settlement.WebhookURL == "" {
+			oops("settlement.webhook_url missing")
+		} else if u, err := url.Parse(c.Settlement.WebhookURL); err != nil {
+			oops(fmt.Sprintf("settlement.webhook_url invalid: %v", err))
+		} else if u.Scheme != "http" && u.Scheme != "https" {
+			oops("settlement.webhook_url must be an http or https URL")
+		}
+
+		if c.Settlement.CheckPeriod < 0 {
+			oops("settlement.check_period can't be negative")
+		}
+
+		if c.Settlement.RetryPeriod < 0 {
+			oops("settlement.retry_period can't be negative")
+		}
+	}
+
+	if c.SupportTokens.Enabled {
+		if c.SupportTokens.DefaultTTL < time.Second {
+			oops("support_tokens.default_ttl must be at least 1s")
+		}
+
+		if c.SupportTokens.MaxTTL < c.SupportTokens.DefaultTTL {
+			oops("support_tokens.max_ttl can't be less than support_tokens.default_ttl")
+		}
+	}
+
+	if c.StatusChallenge.Enabled && c.StatusChallenge.TTL < time.Second {
+		oops("status_challenge.ttl must be at least 1s")
+	}
+
+	if c.BindSignature.Enabled && c.BindSignature.MaxClockSkew < time.Second {
+		oops("bind_signature.max_clock_skew must be at least 1s")
+	}
+
+	if c.Quotes.Enabled {
+		if c.Quotes.TTL < time.Second {
+			oops("quotes.ttl must be at least 1s")
+		}
+
+		var minAmount, maxAmount int64
+		if c.Quotes.MinAmount != "" {
+			var err error
+			if minAmount, err = qrutil.ParseAmount(c.Quotes.MinAmount); err != nil {
+				oops("quotes.min_amount must be a positive amount with at most 8 decimal places")
+			}
+		}
+		if c.Quotes.MaxAmount != "" {
+			var err error
+			if maxAmount, err = qrutil.ParseAmount(c.Quotes.MaxAmount); err != nil {
+				oops("quotes.max_amount must be a positive amount with at most 8 decimal places")
+			}
+		}
+		if minAmount > 0 && maxAmount > 0 && minAmount > maxAmount {
+			oops("quotes.min_amount must not be greater than quotes.max_amount")
+		}
+	}
+
+	if c.KYC.Enabled {
+		if c.KYC.URL == "" {
+			oops("kyc.url missing")
+		} else if u, err := url.Parse(c.KYC.URL); err != nil {
+			oops(fmt.Sprintf("kyc.url invalid: %v", err))
+		} else if u.Scheme != "http" && u.Scheme != "https" {
+			oops("kyc.url must be an http or https URL")
+		}
+
+		if c.KYC.Timeout < 0 {
+			oops("kyc.timeout can't be negative")
+		}
+
+		if c.KYC.Threshold != "" {
+			if _, err := droplet.FromString(c.KYC.Threshold); err != nil {
+				oops(fmt.Sprintf("kyc.threshold invalid: %v", err))
+			}
+		}
+
+		if c.KYC.RecheckInterval < 0 {
+			oops("kyc.recheck_interval can't be negative")
+		}
+	}
+
+	if c.Screening.Enabled {
+		switch c.Screening.Provider {
+		case screening.ProviderRules:
+			if c.Screening.MaxValue != "" {
+				if _, err := qrutil.ParseAmount(c.Screening.MaxValue); err != nil {
+					oops("screening.max_value must be a positive amount with at most 8 decimal places")
+				}
+			}
+		case screening.ProviderAPI:
+			if c.Screening.URL == "" {
+				oops("screening.url missing")
+			} else if u, err := url.Parse(c.Screening.URL); err != nil {
+				oops(fmt.Sprintf("screening.url invalid: %v", err))
+			} else if u.Scheme != "http" && u.Scheme != "https" {
+				oops("screening.url must be an http or https URL")
+			}
+		default:
+			oops(fmt.Sprintf("screening.provider must be %q or %q", screening.ProviderRules, screening.ProviderAPI))
+		}
+
+		if c.Screening.Timeout < 0 {
+			oops("screening.timeout can't be negative")
+		}
+	}
+
+	if c.APIKeys.Enabled {
+		if c.APIKeys.MaxClockSkew < time.Second {
+			oops("api_keys.max_clock_skew must be at least 1s")
+		}
+
+		if c.APIKeys.MaxBoundBtcAddresses < 0 {
+			oops("api_keys.max_bound_btc_addrs can't be negative")
+		}
+	}
+
+	if c.Alerts.Enabled {
+		if c.Alerts.Cooldown < 0 {
+			oops("alerts.cooldown can't be negative")
+		}
+
+		if c.Alerts.CheckPeriod < 0 {
+			oops("alerts.check_period can't be negative")
+		}
+
+		if c.Alerts.ScannerBehindBlocks < 1 {
+			oops("alerts.scanner_behind_blocks must be at least 1")
+		}
+
+		if c.Alerts.HTTPErrors < 1 {
+			oops("alerts.http_errors must be at least 1")
+		}
+
+		if c.Alerts.HTTPErrorsWindow <= 0 {
+			oops("alerts.http_errors_window must be positive")
+		}
+
+		if c.Alerts.LargeDeposit != "" {
+			if _, err := qrutil.ParseAmount(c.Alerts.LargeDeposit); err != nil {
+				oops("alerts.large_deposit must be a positive amount with at most 8 decimal places")
+			}
+		}
+
+		if c.Alerts.RepeatedDeposits < 0 {
+			oops("alerts.repeated_deposits can't be negative")
+		}
+
+		if c.Alerts.RepeatedDeposits > 0 && c.Alerts.RepeatedDepositsWindow <= 0 {
+			oops("alerts.repeated_deposits_window must be positive")
+		}
+
+		if c.Alerts.BindSpikeFactor < 0 {
+			oops("alerts.bind_spike_factor can't be negative")
+		}
+
+		if c.Alerts.BindSpikeFactor > 0 {
+			if c.Alerts.BindSpikeMin < 1 {
+				oops("alerts.bind_spike_min must be at least 1")
+			}
+
+			if c.Alerts.BindSpikeWindow <= 0 {
+				oops("alerts.bind_spike_window must be positive")
+			}
+
+			if c.Alerts.BindSpikeBaseline < c.Alerts.BindSpikeWindow {
+				oops("alerts.bind_spike_baseline must be at least alerts.bind_spike_window")
+			}
+		}
+
+		if _, err := c.Alerts.Severity.Severities(); err != nil {
+			oops(err.Error())
+		}
+
+		validateMinSeverity := func(sink, s string) {
+			if sev, err := alert.ParseSeverity(s); err != nil {
+				oops(fmt.Sprintf("alerts.%s.min_severity invalid: %v", sink, err))
+			} else if sev == alert.SeverityOff {
+				oops(fmt.Sprintf("alerts.%s.min_severity can't be off, disable alerts.%s instead", sink, sink))
+			}
+		}
+
+		if c.Alerts.SMTP.Enabled {
+			if _, _, err := net.SplitHostPort(c.Alerts.SMTP.Addr); err != nil {
+				oops(fmt.Sprintf("alerts.smtp.addr invalid: %v", err))
+			}
+
+			if c.Alerts.SMTP.From == "" {
+				oops("alerts.smtp.from missing")
+			}
+
+			if len(c.Alerts.SMTP.To) == 0 {
+				oops("alerts.smtp.to missing")
+			}
+
+			validateMinSeverity("smtp", c.Alerts.SMTP.MinSeverity)
+		}
+
+		if c.Alerts.Slack.Enabled {
+			if c.Alerts.Slack.WebhookURL == "" {
+				oops("alerts.slack.webhook_url missing")
+			} else if u, err := url.Parse(c.Alerts.Slack.WebhookURL); err != nil {
+				// The error includes the URL, which is a secret
+				oops("alerts.slack.webhook_url invalid")
+			} else if u.Scheme != "https" {
+				oops("alerts.slack.webhook_url must be an https URL")
+			}
+
+			validateMinSeverity("slack", c.Alerts.Slack.MinSeverity)
+		}
+
+		if c.Alerts.Telegram.Enabled {
+			if c.Alerts.Telegram.BotToken == "" {
+				oops("alerts.telegram.bot_token missing")
+			}
+
+			if c.Alerts.Telegram.ChatID == "" {
+				oops("alerts.telegram.chat_id missing")
+			}
+
+			validateMinSeverity("telegram", c.Alerts.Telegram.MinSeverity)
+		}
+
+		// The routes can name the sinks above
+		sinkNames := make(map[string]struct{})
+		if c.Alerts.SMTP.Enabled {
+			sinkNames["smtp"] = struct{}{}
+		}
+		if c.Alerts.Slack.Enabled {
+			sinkNames["slack"] = struct{}{}
+		}
+		if c.Alerts.Telegram.Enabled {
+			sinkNames["telegram"] = struct{}{}
+		}
+
+		for i, s := range c.Alerts.Sinks {
+			if s.Name == "" {
+				oops(fmt.Sprintf("alerts.sinks[%d].name missing", i))
+			} else if _, ok := sinkNames[s.Name]; ok {
+				oops(fmt.Sprintf("alerts.sinks[%d].name %q is used by another sink", i, s.Name))
+			}
+			sinkNames[s.Name] = struct{}{}
+
+			// The factory validates the config of the sink type, its errors don't include secrets
+			if _, err := alert.NewSink(s.Type, s.SinkConfig()); err != nil {
+				oops(fmt.Sprintf("alerts.sinks[%d] invalid: %v", i, err))
+			}
+
+			if _, err := s.Options(); err != nil {
+				oops(fmt.Sprintf("alerts.sinks[%d] invalid: %v", i, err))
+			}
+		}
+
+		knownEvents := make(map[string]struct{}, len(alert.Events))
+		for _, e := range alert.Events {
+			knownEvents[e] = struct{}{}
+		}
+
+		for i, r := range c.Alerts.Routes {
+			for _, e := range r.Events {
+				if _, ok := knownEvents[e]; !ok {
+					oops(fmt.Sprintf("alerts.routes[%d].events: unknown event %q", i, e))
+				}
+			}
+
+			if len(r.Sinks) == 0 {
+				oops(fmt.Sprintf("alerts.routes[%d].sinks missing", i))
+			}
+
+			for _, name := range r.Sinks {
+				if _, ok := sinkNames[name]; !ok {
+					oops(fmt.Sprintf("alerts.routes[%d].sinks: unknown or disabled sink %q", i, name))
+				}
+			}
+		}
+	}
+
+	if c.Reports.Enabled {
+		if c.Reports.Dir == "" {
+			oops("reports.dir missing")
+		}
+
+		if c.Reports.CheckPeriod <= 0 {
+			oops("reports.check_period must be positive")
+		}
+
+		if c.Reports.Email && !(c.Alerts.Enabled && c.Alerts.SMTP.Enabled) {
+			oops("reports.email requires alerts.enabled and alerts.smtp.enabled")
+		}
+	}
+
+	if c.Notifications.Enabled {
+		if !(c.Alerts.Enabled && c.Alerts.SMTP.Enabled) {
+			oops("notifications.enabled requires alerts.enabled and alerts.smtp.enabled")
+		}
+
+		if c.Notifications.Secret == "" {
+			oops("notifications.secret missing")
+		}
+
+		if c.Notifications.BaseURL == "" {
+			oops("notifications.base_url missing")
+		} else if u, err := url.Parse(c.Notifications.BaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			oops("notifications.base_url must be an http or https URL")
+		}
+
+		if _, err := notify.NewTemplate(c.Notifications.SubjectTemplate, c.Notifications.Template); err != nil {
+			oops(fmt.Sprintf("notifications: %v", err))
+		}
+
+		if c.Notifications.DispatchPeriod < 0 {
+			oops("notifications.dispatch_period can't be negative")
+		}
+
+		if c.Notifications.MaxBackoff < 0 {
+			oops("notifications.max_backoff can't be negative")
+		}
+	}
+
+	if c.Archive.Enabled {
+		if c.Archive.RetentionDays <= 0 {
+			oops("archive.retention_days must be positive")
+		}
+
+		if c.Archive.Dir == "" {
+			oops("archive.dir missing")
+		}
+
+		if c.Archive.CheckPeriod <= 0 {
+			oops("archive.check_period must be positive")
+		}
+
+		// The addresses are recycled by their deposits, which must not be archived first
+		if c.Teller.RecycleAddresses && c.Archive.Retention() <= c.Teller.RecycleCoolDown {
+			oops("archive.retention_days must be longer than teller.recycle_cooldown")
+		}
+	}
+
+	if c.Backup.Enabled {
+		if c.Backup.Dir == "" {
+			oops("backup.dir missing")
+		}
+
+		if c.Backup.Interval <= 0 {
+			oops("backup.interval must be positive")
+		}
+
+		if c.Backup.Keep < 1 {
+			oops("backup.keep must be at least 1")
+		}
+
+		if c.Backup.Passphrase == "" {
+			oops("backup.passphrase missing")
+		}
+
+		if c.Backup.S3.Enabled {
+			if c.Backup.S3.Endpoint == "" {
+				oops("backup.s3.endpoint missing")
+			} else if u, err := url.Parse(c.Backup.S3.Endpoint); err != nil {
+				oops(fmt.Sprintf("backup.s3.endpoint invalid: %v", err))
+			} else if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+				oops("backup.s3.endpoint must be an http or https URL")
+			}
+
+			if c.Backup.S3.Region == "" {
+				oops("backup.s3.region missing")
+			}
+
+			if c.Backup.S3.Bucket == "" {
+				oops("backup.s3.bucket missing")
+			}
+
+			if c.Backup.S3.AccessKeyID == "" {
+				oops("backup.s3.access_key_id missing")
+			}
+
+			if c.Backup.S3.SecretAccessKey == "" {
+				oops("backup.s3.secret_access_key missing")
+			}
+
+			if c.Backup.S3.Keep < 1 {
+				oops("backup.s3.keep must be at least 1")
+			}
+		}
+	} else if c.Backup.S3.Enabled {
+		oops("backup.s3.enabled requires backup.enabled")
+	}
+
+	if c.Sentry.Enabled {
+		if c.Sentry.DSN == "" {
+			oops("sentry.dsn missing")
+		} else if _, err := sentry.ParseDSN(c.Sentry.DSN); err != nil {
+			// The error doesn't include the DSN, which is a secret
+			oops(fmt.Sprintf("sentry.dsn invalid: %v", err))
+		}
+	}
+
+	if c.Tracing.Enabled {
+		if c.Tracing.OTLPEndpoint == "" {
+			oops("tracing.otlp_endpoint missing")
+		} else if u, err := url.Parse(c.Tracing.OTLPEndpoint); err != nil {
+			oops(fmt.Sprintf("tracing.otlp_endpoint invalid: %v", err))
+		} else if u.Scheme != "http" && u.Scheme != "https" {
+			oops("tracing.otlp_endpoint must be an http or https URL")
+		}
+
+		if c.Tracing.ServiceName == "" {
+			oops("tracing.service_name missing")
+		}
+
+		if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+			oops("tracing.sample_ratio must be between 0 and 1")
+		}
+	}
+
+	switch c.Secrets.Provider {
+	case "":
+	case SecretsProviderVault:
+		if c.Secrets.RenewPeriod <= 0 {
+			oops("secrets.renew_period must be positive")
+		}
+
+		if c.Secrets.Vault.Addr == "" {
+			oops("secrets.vault.addr missing")
+		} else if u, err := url.Parse(c.Secrets.Vault.Addr); err != nil {
+			oops(fmt.Sprintf("secrets.vault.addr invalid: %v", err))
+		} else if u.Scheme != "https" && u.Scheme != "http" {
+			oops("secrets.vault.addr must be an http or https URL")
+		}
+
+		if c.Secrets.Vault.Token == "" && c.Secrets.Vault.TokenFile == "" {
+			oops("secrets.vault.token or secrets.vault.token_file missing")
+		}
+
+		if c.Secrets.Vault.Mount == "" {
+			oops("secrets.vault.mount missing")
+		}
+
+		if c.Secrets.Vault.Path == "" {
+			oops("secrets.vault.path missing")
+		}
+	default:
+		oops(fmt.Sprintf("secrets.provider must be empty or %q", SecretsProviderVault))
+	}
+
+	if (c.AdminPanel.TLSCert == "") != (c.AdminPanel.TLSKey == "") {
+		oops("admin_panel.tls_cert and admin_panel.tls_key must be set or unset together")
+	}
+
+	if c.AdminPanel.ClientCA != "" && c.AdminPanel.TLSCert == "" {
+		oops("admin_panel.client_ca requires admin_panel.tls_cert and admin_panel.tls_key")
+	}
+
+	principalNames := make(map[string]struct{}, len(c.AdminPanel.Principals))
+	principalTokens := make(map[string]struct{}, len(c.AdminPanel.Principals))
+	principalCNs := make(map[string]struct{}, len(c.AdminPanel.Principals))
+	for i, p := range c.AdminPanel.Principals {
+		if p.Name == "" {
+			oops(fmt.Sprintf("admin_panel.principals[%d].name missing", i))
+		} else if _, ok := principalNames[p.Name]; ok {
+			oops(fmt.Sprintf("admin_panel.principals[%d].name %s is duplicated", i, p.Name))
+		}
+		principalNames[p.Name] = struct{}{}
+
+		if _, err := rbac.ParseRole(p.Role); err != nil {
+			oops(fmt.Sprintf("admin_panel.principals[%d].role invalid: %v", i, err))
+		}
+
+		if p.Token == "" && p.ClientCertCN == "" {
+			oops(fmt.Sprintf("admin_panel.principals[%d] needs a token or a client_cert_cn", i))
+		}
+
+		if p.Token != "" {
+			if _, ok := principalTokens[p.Token]; ok {
+				oops(fmt.Sprintf("admin_panel.principals[%d].token is duplicated", i))
+			}
+			principalTokens[p.Token] = struct{}{}
+		}
+
+		if p.ClientCertCN != "" {
+			if c.AdminPanel.ClientCA == "" {
+				oops(fmt.Sprintf("admin_panel.principals[%d].client_cert_cn requires admin_panel.client_ca", i))
+			}
+			if _, ok := principalCNs[p.ClientCertCN]; ok {
+				oops(fmt.Sprintf("admin_panel.principals[%d].client_cert_cn %s is duplicated", i, p.ClientCertCN))
+			}
+			principalCNs[p.ClientCertCN] = struct{}{}
+		}
+	}
+
+	if c.AdminDashboard.Enabled {
+		if c.AdminDashboard.Host == "" {
+			oops("admin_dashboard.host missing")
+		} else if err := listenutil.ValidateAddr(c.AdminDashboard.Host); err != nil {
+			oops(fmt.Sprintf("admin_dashboard.host invalid: %v", err))
+		} else if c.AdminDashboard.Host == c.AdminPanel.Host {
+			oops("admin_dashboard.host must not be admin_panel.host")
+		}
+
+		if c.AdminDashboard.Username == "" {
+			oops("admin_dashboard.username missing")
+		}
+
+		if c.AdminDashboard.Password == "" {
+			oops("admin_dashboard.password missing")
+		}
+	}
+
+	if c.Upgrade.Timeout <= 0 {
+		oops("upgrade.timeout must be positive")
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return errors.New(strings.Join(errs, "\n"))
+}
+
+// validateDustThreshold checks the dust_threshold of the scanner section. Empty is valid.
+func validateDustThreshold(section, threshold string) error {
+	if threshold == "" {
+		return nil
+	}
+
+	if _, err := qrutil.ParseAmount(threshold); err != nil {
+		return fmt.Errorf("%s.dust_threshold must be a positive amount with at most 8 decimal places", section)
+	}
+
+	return nil
+}
+
+// validateConfirmationTiers checks the confirmation_tiers of the scanner section
+func validateConfirmationTiers(section string, tiers []ConfirmationTier) error {
+	for i, t := range tiers {
+		if _, err := qrutil.ParseAmount(t.MinValue); err != nil {
+			return fmt.Errorf("%s.confirmation_tiers[%d].min_value must be a positive amount with at most 8 decimal places", section, i)
+		}
+		if t.Confirmations < 0 {
+			return fmt.Errorf("%s.confirmation_tiers[%d].confirmations must be >= 0", section, i)
+		}
+	}
+
+	return nil
+}
+
+// validateZMQAddress checks a ZMQ tcp endpoint, e.g. "tcp://127.0.0.1:28332". Empty is valid.
+func validateZMQAddress(addr string) error {
+	if addr == "" {
+		return nil
+	}
+
+	if strings.Contains(addr, "://") {
+		if !strings.HasPrefix(addr, "tcp://") {
+			return errors.New("only tcp:// endpoints are supported")
+		}
+		addr = strings.TrimPrefix(addr, "tcp://")
+	}
+
+	_, _, err := net.SplitHostPort(addr)
+	return err
+}
+
+func setDefaults(v *viper.Viper) {
+	// Top-level args
+	v.SetDefault("profile", false)
+	v.SetDefault("debug", true)
+	v.SetDefault("logfile", "./teller.log")
+
+	// Logging
+	v.SetDefault("logging.format", LogFormatText)
+	v.SetDefault("logging.max_size_mb", 0)
+	v.SetDefault("logging.max_age", time.Duration(0))
+	v.SetDefault("logging.max_backups", 0)
+	v.SetDefault("logging.audit_file", "")
+	v.SetDefault("logging.scrub_pii", false)
+	v.SetDefault("logging.scrub_mode", LogScrubHash)
+	v.SetDefault("logging.scrub_secret", "")
+	v.SetDefault("dbfile", "teller.db")
+
+	// Teller
+	v.SetDefault("teller.max_bound_btc_addrs", 5)
+	v.SetDefault("teller.max_sky_per_addr", "")
+	v.SetDefault("teller.bind_ttl", time.Duration(0))
+	v.SetDefault("teller.recycle_addresses", false)
+	v.SetDefault("teller.recycle_cooldown", time.Hour*24*7)
+	v.SetDefault("teller.hide_dust", false)
+
+	// SkyRPC
+	v.SetDefault("sky_rpc.address", "127.0.0.1:6430")
+	v.SetDefault("sky_rpc.fallback_addresses", []string{})
+	v.SetDefault("sky_rpc.health_check_period", time.Second*30)
+	v.SetDefault("sky_rpc.max_backoff", time.Minute*5)
+
+	// BtcRPC
+	v.SetDefault("btc_rpc.server", "127.0.0.1:8334")
+	v.SetDefault("btc_rpc.health_check_period", time.Second*30)
+
+	// BtcScanner
+	v.SetDefault("btc_scanner.backend", BtcScannerBackendBtcd)
+	v.SetDefault("btc_scanner.scan_period", time.Second*20)
+	v.SetDefault("btc_scanner.initial_scan_height", int64(492478))
+	v.SetDefault("btc_scanner.confirmations_required", int64(1))
+	v.SetDefault("btc_scanner.scan_concurrency", 4)
+	v.SetDefault("btc_scanner.scan_shards", 1)
+	v.SetDefault("btc_scanner.dust_threshold", "")
+
+	// LtcRPC
+	v.SetDefault("ltc_rpc.server", "127.0.0.1:9332")
+
+	// LtcScanner
+	v.SetDefault("ltc_scanner.enabled", false)
+	v.SetDefault("ltc_scanner.scan_period", time.Second*20)
+	v.SetDefault("ltc_scanner.initial_scan_height", int64(1341000))
+	v.SetDefault("ltc_scanner.confirmations_required", int64(4))
+	v.SetDefault("ltc_scanner.scan_concurrency", 4)
+	v.SetDefault("ltc_scanner.dust_threshold", "")
+
+	// EthRPC
+	v.SetDefault("eth_rpc.url", "http://127.0.0.1:8545")
+
+	// ERC20Scanner
+	v.SetDefault("erc20_scanner.enabled", false)
+	v.SetDefault("erc20_scanner.scan_period", time.Second*15)
+	v.SetDefault("erc20_scanner.initial_scan_height", int64(5000000))
+	v.SetDefault("erc20_scanner.confirmations_required", int64(12))
+	v.SetDefault("erc20_scanner.dust_threshold", "")
+
+	// SkyExchanger
+	v.SetDefault("sky_exchanger.tx_confirmation_check_wait", time.Second*5)
+	v.SetDefault("sky_exchanger.max_decimals", 3)
+	v.SetDefault("sky_exchanger.batch_window", time.Duration(0))
+	v.SetDefault("sky_exchanger.batch_max_size", 20)
+	v.SetDefault("sky_exchanger.fee_fixed_droplets", uint64(0))
+	v.SetDefault("sky_exchanger.drain_timeout", time.Second*30)
+	v.SetDefault("sky_exchanger.double_spend_confirmations", int64(6))
+	v.SetDefault("sky_exchanger.double_spend_check_period", time.Minute*5)
+
+	// WalletTopUp
+	v.SetDefault("wallet_topup.enabled", false)
+	v.SetDefault("wallet_topup.check_period", time.Minute)
+	v.SetDefault("wallet_topup.resume_balance", "0")
+
+	// SkySigner
+	v.SetDefault("sky_signer.enabled", false)
+
+	// WalletBalance
+	v.SetDefault("wallet_balance.enabled", false)
+	v.SetDefault("wallet_balance.check_period", time.Minute)
+	v.SetDefault("wallet_balance.low_balance", "0")
+	v.SetDefault("wallet_balance.pause_deposits", false)
+
+	// Web
+	v.SetDefault("web.http_addr", "127.0.0.1:7071")
+	v.SetDefault("web.static_dir", "./web/build")
+	v.SetDefault("web.throttle_max", int64(60))
+	v.SetDefault("web.throttle_duration", time.Minute)
+	v.SetDefault("web.status_batch_max", 20)
+	v.SetDefault("web.addr_throttle_burst", int64(30))
+	v.SetDefault("web.addr_throttle_duration", time.Hour)
+	v.SetDefault("web.api_enabled", true)
+	v.SetDefault("web.ratelimit_backend", RateLimitBackendLocal)
+	v.SetDefault("web.max_conns_per_ip", 20)
+	v.SetDefault("web.static_bandwidth_per_ip", int64(0))
+	v.SetDefault("web.maintenance", false)
+	v.SetDefault("web.maintenance_retry_after", 5*time.Minute)
+	v.SetDefault("web.trusted_proxies", []string{})
+	v.SetDefault("web.proxy_protocol", false)
+	v.SetDefault("web.unix_socket_mode", "0660")
+	v.SetDefault("web.ip_allowlist", []string{})
+	v.SetDefault("web.ip_denylist", []string{})
+
+	// Tor
+	v.SetDefault("tor.enabled", false)
+	v.SetDefault("tor.control_addr", "127.0.0.1:9051")
+	v.SetDefault("tor.control_password", "")
+	v.SetDefault("tor.key_file", "tor_onion.key")
+	v.SetDefault("tor.virtual_port", 80)
+	v.SetDefault("tor.target", "")
+	v.SetDefault("tor.retry_delay", 10*time.Second)
+
+	// Redis
+	v.SetDefault("redis.db", 0)
+
+	// HA
+	v.SetDefault("ha.enabled", false)
+	v.SetDefault("ha.instance_id", "")
+	v.SetDefault("ha.lock_key", "teller:leader")
+	v.SetDefault("ha.lock_ttl", 15*time.Second)
+	v.SetDefault("ha.retry_period", 5*time.Second)
+
+	// Captcha
+	v.SetDefault("captcha.enabled", false)
+	v.SetDefault("captcha.provider", captcha.ProviderRecaptcha)
+
+	// Pricing
+	v.SetDefault("pricing.enabled", false)
+
+	// Outbox
+	v.SetDefault("outbox.enabled", false)
+	v.SetDefault("outbox.dispatch_period", time.Second*5)
+	v.SetDefault("outbox.max_backoff", time.Minute*5)
+
+	// Stream
+	v.SetDefault("stream.enabled", false)
+	v.SetDefault("stream.backend", StreamBackendNATS)
+	v.SetDefault("stream.topic", "teller.deposits")
+	v.SetDefault("stream.dispatch_period", time.Second*5)
+	v.SetDefault("stream.max_backoff", time.Minute*5)
+
+	// Settlement
+	v.SetDefault("settlement.enabled", false)
+	v.SetDefault("settlement.check_period", time.Second*10)
+	v.SetDefault("settlement.retry_period", time.Minute*15)
+
+	// SupportTokens
+	v.SetDefault("support_tokens.enabled", false)
+	v.SetDefault("support_tokens.default_ttl", time.Hour)
+	v.SetDefault("support_tokens.max_ttl", time.Hour*72)
+
+	// StatusChallenge
+	v.SetDefault("status_challenge.enabled", false)
+	v.SetDefault("status_challenge.ttl", time.Minute*5)
+	v.SetDefault("status_challenge.secret", "")
+
+	// BindSignature
+	v.SetDefault("bind_signature.enabled", false)
+	v.SetDefault("bind_signature.max_clock_skew", time.Minute*5)
+
+	// Campaigns
+	v.SetDefault("campaigns.enabled", false)
+
+	// Quotes
+	v.SetDefault("quotes.enabled", false)
+	v.SetDefault("quotes.ttl", time.Minute*15)
+	v.SetDefault("quotes.min_amount", "")
+	v.SetDefault("quotes.max_amount", "")
+
+	// PromoCodes
+	v.SetDefault("promo_codes.enabled", false)
+
+	// AddressProvider
+	v.SetDefault("address_provider.enabled", false)
+	v.SetDefault("address_provider.url", "")
+	v.SetDefault("address_provider.api_key", "")
+	v.SetDefault("address_provider.timeout", time.Second*10)
+	v.SetDefault("address_provider.batch_size", 20)
+
+	// Encryption
+	v.SetDefault("encryption.enabled", false)
+	v.SetDefault("encryption.passphrase", "")
+
+	// KYC
+	v.SetDefault("kyc.enabled", false)
+	v.SetDefault("kyc.url", "")
+	v.SetDefault("kyc.api_key", "")
+	v.SetDefault("kyc.timeout", time.Second*10)
+	v.SetDefault("kyc.threshold", "")
+	v.SetDefault("kyc.at_bind", false)
+	v.SetDefault("kyc.recheck_interval", time.Minute*10)
+
+	// Screening
+	v.SetDefault("screening.enabled", false)
+	v.SetDefault("screening.provider", screening.ProviderRules)
+	v.SetDefault("screening.max_value", "")
+	v.SetDefault("screening.url", "")
+	v.SetDefault("screening.api_key", "")
+	v.SetDefault("screening.timeout", time.Second*10)
+
+	// APIKeys
+	v.SetDefault("api_keys.enabled", false)
+	v.SetDefault("api_keys.max_clock_skew", time.Minute*5)
+	v.SetDefault("api_keys.max_bound_btc_addrs", 100)
+
+	// Alerts
+	v.SetDefault("alerts.enabled", false)
+	v.SetDefault("alerts.cooldown", time.Minute*30)
+	v.SetDefault("alerts.check_period", time.Minute)
+	v.SetDefault("alerts.scanner_behind_blocks", int64(6))
+	v.SetDefault("alerts.address_pool_low", uint64(100))
+	v.SetDefault("alerts.http_errors", 20)
+	v.SetDefault("alerts.http_errors_window", time.Minute*5)
+	v.SetDefault("alerts.large_deposit", "")
+	v.SetDefault("alerts.repeated_deposits", 0)
+	v.SetDefault("alerts.repeated_deposits_window", time.Hour*24)
+	v.SetDefault("alerts.bind_spike_factor", 0.0)
+	v.SetDefault("alerts.bind_spike_min", 20)
+	v.SetDefault("alerts.bind_spike_window", time.Minute*10)
+	v.SetDefault("alerts.bind_spike_baseline", time.Hour*24)
+	v.SetDefault("alerts.severity.send_failed", "critical")
+	v.SetDefault("alerts.severity.scanner_behind", "warning")
+	v.SetDefault("alerts.severity.wallet_balance_low", "critical")
+	v.SetDefault("alerts.severity.address_pool_low", "warning")
+	v.SetDefault("alerts.severity.http_errors", "warning")
+	v.SetDefault("alerts.severity.large_deposit", "warning")
+	v.SetDefault("alerts.severity.repeated_deposits", "warning")
+	v.SetDefault("alerts.severity.bind_spike", "warning")
+	v.SetDefault("alerts.severity.double_spend", "critical")
+	v.SetDefault("alerts.smtp.enabled", false)
+	v.SetDefault("alerts.smtp.to", []string{})
+	v.SetDefault("alerts.smtp.min_severity", "warning")
+	v.SetDefault("alerts.slack.enabled", false)
+	v.SetDefault("alerts.slack.min_severity", "warning")
+	v.SetDefault("alerts.telegram.enabled", false)
+	v.SetDefault("alerts.telegram.min_severity", "warning")
+
+	// Reports
+	v.SetDefault("reports.enabled", false)
+	v.SetDefault("reports.dir", "reports")
+	v.SetDefault("reports.check_period", time.Minute*10)
+	v.SetDefault("reports.email", false)
+
+	// Notifications
+	v.SetDefault("notifications.enabled", false)
+	v.SetDefault("notifications.dispatch_period", time.Second*5)
+	v.SetDefault("notifications.max_backoff", time.Minute*5)
+
+	// Archive
+	v.SetDefault("archive.enabled", false)
+	v.SetDefault("archive.retention_days", 90)
+	v.SetDefault("archive.dir", "archives")
+	v.SetDefault("archive.check_period", time.Hour)
+
+	// Backup
+	v.SetDefault("backup.enabled", false)
+	v.SetDefault("backup.dir", "backups")
+	v.SetDefault("backup.interval", time.Hour*24)
+	v.SetDefault("backup.keep", 7)
+	v.SetDefault("backup.passphrase", "")
+	v.SetDefault("backup.s3.enabled", false)
+	v.SetDefault("backup.s3.endpoint", "https://s3.amazonaws.com")
+	v.SetDefault("backup.s3.region", "us-east-1")
+	v.SetDefault("backup.s3.bucket", "")
+	v.SetDefault("backup.s3.prefix", "teller/")
+	v.SetDefault("backup.s3.access_key_id", "")
+	v.SetDefault("backup.s3.secret_access_key", "")
+	v.SetDefault("backup.s3.keep", 30)
+
+	// Sentry
+	v.SetDefault("sentry.enabled", false)
+	v.SetDefault("sentry.dsn", "")
+	v.SetDefault("sentry.environment", "")
+
+	// Tracing
+	v.SetDefault("tracing.enabled", false)
+	v.SetDefault("tracing.otlp_endpoint", "http://127.0.0.1:4318/v1/traces")
+	v.SetDefault("tracing.service_name", "teller")
+	v.SetDefault("tracing.sample_ratio", 1.0)
+
+	// Secrets
+	v.SetDefault("secrets.provider", "")
+	v.SetDefault("secrets.renew_period", time.Hour)
+	v.SetDefault("secrets.vault.mount", "secret")
+	v.SetDefault("secrets.vault.path", "teller")
+
+	// AdminPanel
+	v.SetDefault("admin_panel.host", "127.0.0.1:7711")
+	v.SetDefault("admin_panel.tls_cert", "")
+	v.SetDefault("admin_panel.tls_key", "")
+	v.SetDefault("admin_panel.client_ca", "")
+
+	// AdminDashboard
+	v.SetDefault("admin_dashboard.enabled", false)
+	v.SetDefault("admin_dashboard.host", "127.0.0.1:7712")
+	v.SetDefault("admin_dashboard.username", "admin")
+	v.SetDefault("admin_dashboard.password", "")
+
+	// Upgrade
+	v.SetDefault("upgrade.timeout", time.Minute)
+	v.SetDefault("upgrade.pid_file", "")
+
+	// DummySender
+	v.SetDefault("dummy.http_addr", "127.0.0.1:4121")
+	v.SetDefault("dummy.scanner", false)
+	v.SetDefault("dummy.sender", false)
+}
+
+// Load loads the configuration from "./$configName.*" where "*" is a
+// JSON, toml or yaml file (toml preferred), and validates it.
+func Load(configName, appDir string) (Config, error) {
+	cfg, err := Read(configName, appDir)
+	if err != nil {
+		return cfg, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return cfg, err
+	}
+
+	return cfg, nil
+}
+
+// Read loads the configuration like Load, without validating it
+func Read(configName, appDir string) (Config, error) {
+	setConfigPaths(viper.GetViper(), configName, appDir)
+
+	setDefaults(viper.GetViper())
+
+	cfg := Config{}
+
+	if err := viper.ReadInConfig(); err != nil {
+		return cfg, err
+	}
+
+	// Environment variables take precedence over the config file
+	if err := setEnvOverrides(viper.GetViper(), os.LookupEnv); err != nil {
+		return cfg, err
+	}
+
+	if err := viper.Unmarshal(&cfg); err != nil {
+		return cfg, err
+	}
+
+	// Secrets take precedence over the config file and environment variables
+	if cfg.Secrets.Provider != "" {
+		provider, err := cfg.Secrets.NewProvider()
+		if err != nil {
+			return cfg, err
+		}
+
+		if err := setSecrets(viper.GetViper(), provider, filepath.Join(appDir, secretsDir)); err != nil {
+			return cfg, err
+		}
+
+		if err := viper.Unmarshal(&cfg); err != nil {
+			return cfg, err
+		}
+	}
+
+	return cfg, nil
+}
+
+// FindFile returns the path of the config file that Load would load
+func FindFile(configName, appDir string) (string, error) {
+	v := viper.New()
+	setConfigPaths(v, configName, appDir)
+
+	if err := v.ReadInConfig(); err != nil {
+		return "", err
+	}
+
+	return v.ConfigFileUsed(), nil
+}
+
+func setConfigPaths(v *viper.Viper, configName, appDir string) {
+	if strings.HasSuffix(configName, ".toml") {
+		configName = configName[:len(configName)-len(".toml")]
+	}
+
+	v.SetConfigName(configName)
+	v.SetConfigType("toml")
+	v.AddConfigPath(appDir)
+	v.AddConfigPath(".")
 }
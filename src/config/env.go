@@ -0,0 +1,84 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// EnvPrefix is the prefix of the environment variables that override config keys
+const EnvPrefix = "TELLER_"
+
+// EnvName returns the environment variable that overrides a config key,
+// e.g. TELLER_BTC_RPC_PASS for btc_rpc.pass
+func EnvName(key string) string {
+	return EnvPrefix + strings.ToUpper(strings.Replace(key, ".", "_", -1))
+}
+
+// setEnvOverrides overrides the config keys of v that have an environment variable set, looked up with lookupEnv.
+// Array values are comma separated. Arrays of tables, e.g. erc20_scanner.tokens, can't be overridden.
+func setEnvOverrides(v *viper.Viper, lookupEnv func(string) (string, bool)) error {
+	keys, _ := schemaKeys()
+
+	names := make([]string, 0, len(keys))
+	for k := range keys {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	for _, k := range names {
+		env := EnvName(k)
+		s, ok := lookupEnv(env)
+		if !ok {
+			continue
+		}
+
+		value, err := parseEnvValue(keys[k], s)
+		if err != nil {
+			return fmt.Errorf("%s invalid: %v", env, err)
+		}
+
+		v.Set(k, value)
+	}
+
+	return nil
+}
+
+// parseEnvValue parses the value of an environment variable as type t
+func parseEnvValue(t reflect.Type, s string) (interface{}, error) {
+	if t == reflect.TypeOf(time.Duration(0)) {
+		return time.ParseDuration(s)
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return strconv.ParseBool(s)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.ParseInt(s, 10, t.Bits())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.ParseUint(s, 10, t.Bits())
+	case reflect.Float32, reflect.Float64:
+		return strconv.ParseFloat(s, t.Bits())
+	case reflect.Slice:
+		values := []interface{}{}
+		if strings.TrimSpace(s) == "" {
+			return values, nil
+		}
+
+		for _, e := range strings.Split(s, ",") {
+			v, err := parseEnvValue(t.Elem(), strings.TrimSpace(e))
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+		}
+		return values, nil
+	default:
+		return s, nil
+	}
+}
@@ -0,0 +1,92 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvName(t *testing.T) {
+	require.Equal(t, "TELLER_BTC_RPC_PASS", EnvName("btc_rpc.pass"))
+	require.Equal(t, "TELLER_DEBUG", EnvName("debug"))
+	require.Equal(t, "TELLER_ALERTS_SMTP_PASSWORD", EnvName("alerts.smtp.password"))
+
+	// Each key has its own environment variable, and every type can be parsed
+	keys, _ := schemaKeys()
+	seen := make(map[string]string)
+	for k, typ := range keys {
+		env := EnvName(k)
+		other, dup := seen[env]
+		require.False(t, dup, "%s and %s have the same environment variable %s", k, other, env)
+		seen[env] = k
+
+		if typ.Kind() == reflect.Struct || typ.Kind() == reflect.Map {
+			t.Fatalf("%s can't be set by %s", k, env)
+		}
+	}
+}
+
+func TestSetEnvOverrides(t *testing.T) {
+	v := viper.New()
+	setDefaults(v)
+	v.SetConfigType("toml")
+	require.NoError(t, v.ReadConfig(strings.NewReader(`
+[btc_rpc]
+server = "127.0.0.1:8334"
+pass = "from file"
+
+[alerts]
+enabled = false
+`)))
+
+	env := map[string]string{
+		"TELLER_BTC_RPC_PASS":               "from env",
+		"TELLER_ALERTS_ENABLED":             "true",
+		"TELLER_ALERTS_COOLDOWN":            "1h",
+		"TELLER_ALERTS_ADDRESS_POOL_LOW":    "5",
+		"TELLER_TELLER_MAX_BOUND_BTC_ADDRS": "3",
+		"TELLER_ALERTS_SMTP_TO":             "ops@example.com, dev@example.com",
+		"TELLER_SKY_RPC_FALLBACK_ADDRESSES": "",
+		"TELLER_UNKNOWN_KEY":                "ignored",
+	}
+	lookupEnv := func(k string) (string, bool) {
+		s, ok := env[k]
+		return s, ok
+	}
+
+	require.NoError(t, setEnvOverrides(v, lookupEnv))
+
+	var cfg Config
+	require.NoError(t, v.Unmarshal(&cfg))
+
+	require.Equal(t, "from env", cfg.BtcRPC.Pass)
+	require.Equal(t, "127.0.0.1:8334", cfg.BtcRPC.Server)
+	require.True(t, cfg.Alerts.Enabled)
+	require.Equal(t, time.Hour, cfg.Alerts.Cooldown)
+	require.Equal(t, uint64(5), cfg.Alerts.AddressPoolLow)
+	require.Equal(t, 3, cfg.Teller.MaxBoundBtcAddresses)
+	require.Equal(t, []string{"ops@example.com", "dev@example.com"}, cfg.Alerts.SMTP.To)
+	require.Empty(t, cfg.SkyRPC.FallbackAddresses)
+
+	// Defaults that are not overridden are kept
+	require.Equal(t, time.Minute, cfg.Alerts.CheckPeriod)
+
+	for k, s := range map[string]string{
+		"TELLER_ALERTS_ENABLED":          "maybe",
+		"TELLER_ALERTS_COOLDOWN":         "1 hour",
+		"TELLER_ALERTS_ADDRESS_POOL_LOW": "-1",
+	} {
+		err := setEnvOverrides(viper.New(), func(name string) (string, bool) {
+			if name == k {
+				return s, true
+			}
+			return "", false
+		})
+		require.Error(t, err)
+		require.True(t, strings.HasPrefix(err.Error(), k+" invalid: "), err.Error())
+	}
+}
@@ -0,0 +1,343 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	toml "github.com/pelletier/go-toml"
+	"github.com/spf13/viper"
+)
+
+// configValues are the values written to a generated config file
+type configValues struct {
+	// Keys written uncommented
+	values map[string]interface{}
+	// Keys written uncommented with a zero value and marked REQUIRED
+	required map[string]struct{}
+	// Entries of each array of tables, e.g. "erc20_scanner.tokens"
+	tables map[string][]map[string]interface{}
+	// "key = value" lines of keys that are not in the schema
+	unknown []string
+}
+
+// Init writes a config file for preset to w. Keys the preset does not set are written
+// commented out, with their defaults. Keys without a usable default are marked REQUIRED.
+func Init(w io.Writer, presetName string) error {
+	p, ok := presets[presetName]
+	if !ok {
+		return fmt.Errorf("unknown preset %q, must be one of %s", presetName, strings.Join(Presets, ", "))
+	}
+
+	cv := configValues{
+		values:   p.values,
+		required: make(map[string]struct{}, len(p.required)),
+	}
+	for _, k := range p.required {
+		cv.required[k] = struct{}{}
+	}
+
+	return writeConfig(w, fmt.Sprintf("teller config init --preset %s", presetName), cv)
+}
+
+// Upgrade writes the config file at path to w in the current schema, with the documentation
+// and defaults of every key. Keys set in the file are kept, and keys that are not in the schema
+// are written commented out at the end. It returns the keys that are not in the schema.
+func Upgrade(w io.Writer, path string) ([]string, error) {
+	tree, err := toml.LoadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, tables := schemaKeys()
+
+	cv := configValues{
+		values: make(map[string]interface{}),
+		tables: make(map[string][]map[string]interface{}),
+	}
+
+	var unknownKeys []string
+	var walk func(t *toml.Tree, prefix string)
+	walk = func(t *toml.Tree, prefix string) {
+		names := t.Keys()
+		sort.Strings(names)
+
+		for _, name := range names {
+			k := prefix + name
+			switch v := t.GetPath([]string{name}).(type) {
+			case *toml.Tree:
+				walk(v, k+".")
+			case []*toml.Tree:
+				if _, ok := tables[k]; ok {
+					for i, e := range v {
+						entry := make(map[string]interface{})
+						for _, ek := range e.Keys() {
+							ev := e.GetPath([]string{ek})
+							if _, ok := tableField(tables[k], ek); ok {
+								entry[ek] = ev
+							} else {
+								uk := fmt.Sprintf("%s[%d].%s", k, i, ek)
+								unknownKeys = append(unknownKeys, uk)
+								cv.unknown = append(cv.unknown, fmt.Sprintf("%s = %s", uk, tomlValue(ev)))
+							}
+						}
+						cv.tables[k] = append(cv.tables[k], entry)
+					}
+				} else {
+					unknownKeys = append(unknownKeys, k)
+					cv.unknown = append(cv.unknown, fmt.Sprintf("%s = <%d tables>", k, len(v)))
+				}
+			default:
+				if _, ok := keys[k]; ok {
+					cv.values[k] = v
+				} else {
+					unknownKeys = append(unknownKeys, k)
+					cv.unknown = append(cv.unknown, fmt.Sprintf("%s = %s", k, tomlValue(v)))
+				}
+			}
+		}
+	}
+	walk(tree, "")
+
+	if err := writeConfig(w, "teller config upgrade", cv); err != nil {
+		return nil, err
+	}
+
+	return unknownKeys, nil
+}
+
+func writeConfig(w io.Writer, generatedBy string, cv configValues) error {
+	defaults := viper.New()
+	setDefaults(defaults)
+
+	keys, tables := schemaKeys()
+
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintln(bw, "# Teller configuration")
+	fmt.Fprintf(bw, "# Generated by \"%s\"\n", generatedBy)
+	fmt.Fprintln(bw, "# Defaults are shown, commented out")
+	fmt.Fprintln(bw, "# Values marked REQUIRED must be filled in")
+
+	for _, s := range schema {
+		fmt.Fprintln(bw)
+
+		prefix := ""
+		if s.Name != "" {
+			writeComment(bw, s.Comment)
+			fmt.Fprintf(bw, "[%s]\n", s.Name)
+			prefix = s.Name + "."
+		}
+
+		for _, k := range s.Keys {
+			key := prefix + k.Name
+
+			comment := k.Comment
+			v, ok := cv.values[key]
+			if !ok {
+				if _, required := cv.required[key]; required {
+					v = reflect.Zero(keys[key]).Interface()
+					ok = true
+					comment = joinComment("REQUIRED", comment)
+				} else if defaults.IsSet(key) {
+					v = defaults.Get(key)
+				} else {
+					v = reflect.Zero(keys[key]).Interface()
+				}
+			}
+
+			writeKey(bw, !ok, k.Name, v, comment)
+		}
+
+		for _, t := range s.Tables {
+			key := prefix + t.Name
+			entries := cv.tables[key]
+
+			fmt.Fprintln(bw)
+			writeComment(bw, t.Comment)
+
+			if len(entries) == 0 {
+				// Write one commented out example entry
+				fmt.Fprintf(bw, "# [[%s]]\n", key)
+				for _, k := range t.Keys {
+					f, _ := tableField(tables[key], k.Name)
+					v := reflect.Zero(f.Type).Interface()
+					writeKey(bw, true, k.Name, v, k.Comment)
+				}
+				continue
+			}
+
+			for i, e := range entries {
+				if i > 0 {
+					fmt.Fprintln(bw)
+				}
+				fmt.Fprintf(bw, "[[%s]]\n", key)
+				for _, k := range t.Keys {
+					if v, ok := e[k.Name]; ok {
+						writeKey(bw, false, k.Name, v, k.Comment)
+					}
+				}
+			}
+		}
+	}
+
+	if len(cv.unknown) != 0 {
+		fmt.Fprintln(bw)
+		fmt.Fprintln(bw, "# Keys that are not used by this version of teller, kept for reference")
+		for _, u := range cv.unknown {
+			fmt.Fprintf(bw, "# %s\n", u)
+		}
+	}
+
+	return bw.Flush()
+}
+
+func writeComment(w io.Writer, comment string) {
+	if comment == "" {
+		return
+	}
+
+	for _, line := range strings.Split(comment, "\n") {
+		fmt.Fprintf(w, "# %s\n", line)
+	}
+}
+
+func writeKey(w io.Writer, commented bool, name string, v interface{}, comment string) {
+	line := fmt.Sprintf("%s = %s", name, tomlValue(v))
+	if commented {
+		line = "# " + line
+	}
+	if comment != "" {
+		line += "  # " + comment
+	}
+	fmt.Fprintln(w, line)
+}
+
+func joinComment(a, b string) string {
+	if b == "" {
+		return a
+	}
+	return a + ": " + b
+}
+
+// tomlValue formats v as a TOML value
+func tomlValue(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return tomlString(v)
+	case bool:
+		return strconv.FormatBool(v)
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case time.Duration:
+		return tomlString(formatDuration(v))
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case []string:
+		s := make([]interface{}, len(v))
+		for i, e := range v {
+			s[i] = e
+		}
+		return tomlValue(s)
+	case []interface{}:
+		s := make([]string, len(v))
+		for i, e := range v {
+			s[i] = tomlValue(e)
+		}
+		return "[" + strings.Join(s, ", ") + "]"
+	default:
+		return tomlString(fmt.Sprint(v))
+	}
+}
+
+// tomlString quotes s as a TOML basic string
+func tomlString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if unicode.IsControl(r) {
+				fmt.Fprintf(&b, `\u%04X`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// formatDuration formats d like time.Duration.String, without trailing zero units, e.g. "1m" instead of "1m0s"
+func formatDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = s[:len(s)-2]
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = s[:len(s)-2]
+	}
+	return s
+}
+
+// schemaKeys returns the type of every config key, and the element type of every array of tables,
+// from the mapstructure tags of Config
+func schemaKeys() (map[string]reflect.Type, map[string]reflect.Type) {
+	keys := make(map[string]reflect.Type)
+	tables := make(map[string]reflect.Type)
+
+	var walk func(t reflect.Type, prefix string)
+	walk = func(t reflect.Type, prefix string) {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name := f.Tag.Get("mapstructure")
+			if name == "" {
+				continue
+			}
+
+			switch {
+			case f.Type.Kind() == reflect.Struct:
+				walk(f.Type, prefix+name+".")
+			case f.Type.Kind() == reflect.Slice && f.Type.Elem().Kind() == reflect.Struct:
+				tables[prefix+name] = f.Type.Elem()
+			default:
+				keys[prefix+name] = f.Type
+			}
+		}
+	}
+	walk(reflect.TypeOf(Config{}), "")
+
+	return keys, tables
+}
+
+// tableField returns the field of struct type t with the mapstructure tag name
+func tableField(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		if f := t.Field(i); f.Tag.Get("mapstructure") == name {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
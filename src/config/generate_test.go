@@ -0,0 +1,207 @@
+package config
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	toml "github.com/pelletier/go-toml"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchema(t *testing.T) {
+	keys, tables := schemaKeys()
+
+	seen := make(map[string]struct{})
+	for _, s := range schema {
+		prefix := ""
+		if s.Name != "" {
+			prefix = s.Name + "."
+		}
+
+		for _, k := range s.Keys {
+			key := prefix + k.Name
+			_, ok := keys[key]
+			require.True(t, ok, "%s is not in Config", key)
+			_, dup := seen[key]
+			require.False(t, dup, "%s is duplicated", key)
+			seen[key] = struct{}{}
+		}
+
+		for _, tbl := range s.Tables {
+			key := prefix + tbl.Name
+			_, ok := tables[key]
+			require.True(t, ok, "%s is not in Config", key)
+			seen[key] = struct{}{}
+
+			for _, k := range tbl.Keys {
+				_, ok := tableField(tables[key], k.Name)
+				require.True(t, ok, "%s.%s is not in Config", key, k.Name)
+			}
+		}
+	}
+
+	for k := range keys {
+		_, ok := seen[k]
+		require.True(t, ok, "%s is missing from the schema", k)
+	}
+	for k := range tables {
+		_, ok := seen[k]
+		require.True(t, ok, "%s is missing from the schema", k)
+	}
+
+	for name, p := range presets {
+		for k := range p.values {
+			_, ok := keys[k]
+			require.True(t, ok, "preset %s: %s is not in Config", name, k)
+		}
+		for _, k := range p.required {
+			_, ok := keys[k]
+			require.True(t, ok, "preset %s: %s is not in Config", name, k)
+		}
+	}
+}
+
+func TestInit(t *testing.T) {
+	for _, preset := range Presets {
+		t.Run(preset, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := Init(&buf, preset)
+			require.NoError(t, err)
+
+			tree, err := toml.LoadBytes(buf.Bytes())
+			require.NoError(t, err)
+
+			for k, v := range presets[preset].values {
+				require.Equal(t, tomlValue(v), tomlValue(tree.Get(k)), k)
+			}
+			for _, k := range presets[preset].required {
+				require.True(t, tree.Has(k), k)
+			}
+		})
+	}
+
+	var buf bytes.Buffer
+	err := Init(&buf, "foo")
+	require.Error(t, err)
+}
+
+func TestInitConfigTomlUpToDate(t *testing.T) {
+	var buf bytes.Buffer
+	err := Init(&buf, PresetDev)
+	require.NoError(t, err)
+
+	b, err := ioutil.ReadFile("../../config.toml")
+	require.NoError(t, err)
+
+	require.Equal(t, buf.String(), string(b), `config.toml is out of date, regenerate it with "teller config init --preset dev"`)
+}
+
+func TestUpgrade(t *testing.T) {
+	old := `
+debug = false
+btc_addresses = "btc_addresses.json"
+removed_key = "foo"
+
+[btc_rpc]
+user = "user"
+pass = "pass"
+cert = "rpc.cert"
+
+[btc_scanner]
+scan_period = "30s"
+confirmations_required = 2
+
+[erc20_scanner]
+enabled = true
+
+[[erc20_scanner.tokens]]
+symbol = "FOO"
+contract = "0x0000000000000000000000000000000000000001"
+decimals = 18
+sky_exchange_rate = "0.5"
+color = "red"
+
+[[erc20_scanner.tokens]]
+symbol = "BAR"
+contract = "0x0000000000000000000000000000000000000002"
+decimals = 6
+sky_exchange_rate = "1/3"
+
+[sky_exchanger]
+sky_btc_exchange_rate = "500"
+wallet = "hot.wlt"
+
+[web]
+http_addr = "127.0.0.1:7071"
+tls_cert = "C:\\certs\\cert.pem"
+
+[pricing]
+enabled = true
+geoip_header = "CF-IPCountry"
+
+[[pricing.regions]]
+name = "eu"
+countries = ["DE", "FR"]
+bonus_percent = "5"
+
+[old_section]
+enabled = true
+`
+
+	dir, err := ioutil.TempDir("", "teller-config")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.toml")
+	err = ioutil.WriteFile(path, []byte(old), 0600)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	unknown, err := Upgrade(&buf, path)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"erc20_scanner.tokens[0].color",
+		"old_section.enabled",
+		"removed_key",
+	}, unknown)
+	require.Contains(t, buf.String(), "# removed_key = \"foo\"\n")
+
+	// The upgraded config loads to the same Config as the old one
+	load := func(b []byte) Config {
+		v := viper.New()
+		setDefaults(v)
+		v.SetConfigType("toml")
+		require.NoError(t, v.ReadConfig(bytes.NewReader(b)))
+
+		var cfg Config
+		require.NoError(t, v.Unmarshal(&cfg))
+		return cfg
+	}
+
+	oldCfg := load([]byte(old))
+	newCfg := load(buf.Bytes())
+	require.Equal(t, oldCfg, newCfg)
+
+	require.Equal(t, time.Second*30, newCfg.BtcScanner.ScanPeriod)
+	require.Len(t, newCfg.ERC20Scanner.Tokens, 2)
+	require.Equal(t, `C:\certs\cert.pem`, newCfg.Web.TLSCert)
+
+	// Upgrading again changes nothing, except that the commented out unknown keys are dropped
+	err = ioutil.WriteFile(path, buf.Bytes(), 0600)
+	require.NoError(t, err)
+
+	var buf2 bytes.Buffer
+	unknown, err = Upgrade(&buf2, path)
+	require.NoError(t, err)
+	require.Empty(t, unknown)
+
+	i := strings.Index(buf.String(), "\n# Keys that are not used")
+	require.True(t, i > 0)
+	require.Equal(t, buf.String()[:i], buf2.String())
+}
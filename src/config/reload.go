@@ -0,0 +1,124 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// Change is a config key whose value changed
+type Change struct {
+	Key string
+	Old interface{}
+	New interface{}
+}
+
+// Reload returns cfg with the settings of newCfg that can be changed while teller is running:
+//   - teller.max_bound_btc_addrs and teller.bind_ttl
+//   - sky_exchanger.sky_btc_exchange_rate and sky_exchanger.sky_ltc_exchange_rate
+//   - erc20_scanner.tokens[].sky_exchange_rate, of the tokens that cfg accepts
+//   - web.throttle_max, web.throttle_duration, web.addr_throttle_burst and web.addr_throttle_duration
+//   - web.maintenance and web.maintenance_retry_after
+//   - web.ip_allowlist and web.ip_denylist
+//
+// It also returns the changes of those settings, and the changes of the other settings of newCfg,
+// which only apply after a restart.
+func Reload(cfg, newCfg Config) (reloaded Config, applied, ignored []Change) {
+	c := cfg
+
+	c.Teller.MaxBoundBtcAddresses = newCfg.Teller.MaxBoundBtcAddresses
+	c.Teller.BindTTL = newCfg.Teller.BindTTL
+
+	c.SkyExchanger.SkyBtcExchangeRate = newCfg.SkyExchanger.SkyBtcExchangeRate
+	c.SkyExchanger.SkyLtcExchangeRate = newCfg.SkyExchanger.SkyLtcExchangeRate
+
+	// Token rates are matched by symbol, adding or removing a token needs a restart
+	c.ERC20Scanner.Tokens = make([]ERC20Token, len(cfg.ERC20Scanner.Tokens))
+	for i, t := range cfg.ERC20Scanner.Tokens {
+		if nt, ok := newCfg.ERC20Scanner.Token(t.Symbol); ok {
+			t.SkyExchangeRate = nt.SkyExchangeRate
+		}
+		c.ERC20Scanner.Tokens[i] = t
+	}
+
+	c.Web.ThrottleMax = newCfg.Web.ThrottleMax
+	c.Web.ThrottleDuration = newCfg.Web.ThrottleDuration
+	c.Web.AddrThrottleBurst = newCfg.Web.AddrThrottleBurst
+	c.Web.AddrThrottleDuration = newCfg.Web.AddrThrottleDuration
+	c.Web.Maintenance = newCfg.Web.Maintenance
+	c.Web.MaintenanceRetryAfter = newCfg.Web.MaintenanceRetryAfter
+	c.Web.IPAllowlist = newCfg.Web.IPAllowlist
+	c.Web.IPDenylist = newCfg.Web.IPDenylist
+
+	return c, Diff(cfg, c), Diff(c, newCfg)
+}
+
+// Diff returns the keys whose values differ between a and b, sorted by key.
+// Entries of arrays of tables are keyed by index, e.g. erc20_scanner.tokens[0].symbol.
+// The values are redacted like Redacted, a key that is missing from a or b has a nil value.
+func Diff(a, b Config) []Change {
+	av := keyValues(a)
+	bv := keyValues(b)
+	ar := keyValues(a.Redacted())
+	br := keyValues(b.Redacted())
+
+	keys := make(map[string]struct{}, len(av))
+	for k := range av {
+		keys[k] = struct{}{}
+	}
+	for k := range bv {
+		keys[k] = struct{}{}
+	}
+
+	names := make([]string, 0, len(keys))
+	for k := range keys {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var changes []Change
+	for _, k := range names {
+		if reflect.DeepEqual(av[k], bv[k]) {
+			continue
+		}
+
+		changes = append(changes, Change{
+			Key: k,
+			Old: ar[k],
+			New: br[k],
+		})
+	}
+
+	return changes
+}
+
+// keyValues returns the value of every config key of c, from the mapstructure tags of Config
+func keyValues(c Config) map[string]interface{} {
+	values := make(map[string]interface{})
+
+	var walk func(v reflect.Value, prefix string)
+	walk = func(v reflect.Value, prefix string) {
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name := f.Tag.Get("mapstructure")
+			if name == "" {
+				continue
+			}
+
+			switch {
+			case f.Type.Kind() == reflect.Struct:
+				walk(v.Field(i), prefix+name+".")
+			case f.Type.Kind() == reflect.Slice && f.Type.Elem().Kind() == reflect.Struct:
+				for j := 0; j < v.Field(i).Len(); j++ {
+					walk(v.Field(i).Index(j), fmt.Sprintf("%s%s[%d].", prefix, name, j))
+				}
+			default:
+				values[prefix+name] = v.Field(i).Interface()
+			}
+		}
+	}
+	walk(reflect.ValueOf(c), "")
+
+	return values
+}
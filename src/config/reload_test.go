@@ -0,0 +1,113 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReload(t *testing.T) {
+	cfg := Config{
+		Teller: Teller{
+			MaxBoundBtcAddresses: 5,
+		},
+		BtcRPC: BtcRPC{
+			Pass: "old pass",
+		},
+		ERC20Scanner: ERC20Scanner{
+			Tokens: []ERC20Token{
+				{Symbol: "TKN", SkyExchangeRate: "2"},
+				{Symbol: "OLD", SkyExchangeRate: "3"},
+			},
+		},
+		SkyExchanger: SkyExchanger{
+			SkyBtcExchangeRate: "500",
+			MaxDecimals:        3,
+		},
+		Web: Web{
+			ThrottleMax:      60,
+			ThrottleDuration: time.Minute,
+		},
+	}
+
+	newCfg := cfg
+	newCfg.Teller.MaxBoundBtcAddresses = 2
+	newCfg.Teller.BindTTL = time.Hour
+	newCfg.BtcRPC.Pass = "new pass"
+	newCfg.ERC20Scanner.Tokens = []ERC20Token{
+		{Symbol: "TKN", SkyExchangeRate: "2.5"},
+		{Symbol: "NEW", SkyExchangeRate: "4"},
+	}
+	newCfg.SkyExchanger.SkyBtcExchangeRate = "600"
+	newCfg.SkyExchanger.MaxDecimals = 2
+	newCfg.Web.ThrottleDuration = time.Hour
+	newCfg.Web.Maintenance = true
+	newCfg.Web.IPDenylist = []string{"10.0.0.0/8"}
+
+	reloaded, applied, ignored := Reload(cfg, newCfg)
+
+	require.Equal(t, 2, reloaded.Teller.MaxBoundBtcAddresses)
+	require.Equal(t, time.Hour, reloaded.Teller.BindTTL)
+	require.Equal(t, "600", reloaded.SkyExchanger.SkyBtcExchangeRate)
+	require.Equal(t, time.Hour, reloaded.Web.ThrottleDuration)
+	require.True(t, reloaded.Web.Maintenance)
+	require.Equal(t, []string{"10.0.0.0/8"}, reloaded.Web.IPDenylist)
+	require.Equal(t, []ERC20Token{
+		{Symbol: "TKN", SkyExchangeRate: "2.5"},
+		{Symbol: "OLD", SkyExchangeRate: "3"},
+	}, reloaded.ERC20Scanner.Tokens)
+
+	// Settings that need a restart are not changed
+	require.Equal(t, "old pass", reloaded.BtcRPC.Pass)
+	require.Equal(t, 3, reloaded.SkyExchanger.MaxDecimals)
+
+	// cfg is not modified
+	require.Equal(t, "2", cfg.ERC20Scanner.Tokens[0].SkyExchangeRate)
+
+	require.Equal(t, []Change{
+		{Key: "erc20_scanner.tokens[0].sky_exchange_rate", Old: "2", New: "2.5"},
+		{Key: "sky_exchanger.sky_btc_exchange_rate", Old: "500", New: "600"},
+		{Key: "teller.bind_ttl", Old: time.Duration(0), New: time.Hour},
+		{Key: "teller.max_bound_btc_addrs", Old: 5, New: 2},
+		{Key: "web.ip_denylist", Old: []string(nil), New: []string{"10.0.0.0/8"}},
+		{Key: "web.maintenance", Old: false, New: true},
+		{Key: "web.throttle_duration", Old: time.Minute, New: time.Hour},
+	}, applied)
+
+	require.Equal(t, []Change{
+		{Key: "btc_rpc.pass", Old: "<redacted>", New: "<redacted>"},
+		{Key: "erc20_scanner.tokens[1].sky_exchange_rate", Old: "3", New: "4"},
+		{Key: "erc20_scanner.tokens[1].symbol", Old: "OLD", New: "NEW"},
+		{Key: "sky_exchanger.max_decimals", Old: 3, New: 2},
+	}, ignored)
+
+	// Nothing changed
+	_, applied, ignored = Reload(reloaded, reloaded)
+	require.Empty(t, applied)
+	require.Empty(t, ignored)
+}
+
+func TestDiff(t *testing.T) {
+	a := Config{
+		Pricing: Pricing{
+			Regions: []PricingRegion{
+				{Name: "a", Countries: []string{"US"}},
+			},
+		},
+	}
+
+	b := a
+	b.Pricing.Regions = []PricingRegion{
+		{Name: "a", Countries: []string{"US", "CA"}},
+		{Name: "b"},
+	}
+
+	require.Equal(t, []Change{
+		{Key: "pricing.regions[0].countries", Old: []string{"US"}, New: []string{"US", "CA"}},
+		{Key: "pricing.regions[1].bonus_percent", Old: nil, New: ""},
+		{Key: "pricing.regions[1].countries", Old: nil, New: []string(nil)},
+		{Key: "pricing.regions[1].min_sky", Old: nil, New: ""},
+		{Key: "pricing.regions[1].name", Old: nil, New: "b"},
+	}, Diff(a, b))
+}
@@ -0,0 +1,768 @@
+package config
+
+// schemaSection documents a section of the config file
+type schemaSection struct {
+	// Name of the section, empty for the top-level keys
+	Name string
+	// Comment written above the section
+	Comment string
+	Keys    []schemaKey
+	// Arrays of tables in the section, written after its keys
+	Tables []schemaTable
+}
+
+// schemaKey documents a config key
+type schemaKey struct {
+	Name    string
+	Comment string
+}
+
+// schemaTable documents an array of tables, e.g. [[erc20_scanner.tokens]]
+type schemaTable struct {
+	Name    string
+	Comment string
+	Keys    []schemaKey
+}
+
+// schema lists every config key in the order they are written by Init and Upgrade.
+// Add new keys here when adding them to Config, TestSchema checks that they match.
+var schema = []schemaSection{
+	{
+		Keys: []schemaKey{
+			{"debug", "Enable debug logging"},
+			{"profile", "Run with the gops profiler"},
+			{"logfile", "Can be an absolute path or relative to the working directory"},
+			{"dbfile", "Saved inside the data directory, do not include a path"},
+			{"btc_addresses", "Path of the BTC deposit addresses file, not used if address_provider.enabled"},
+			{"ltc_addresses", "Path of the LTC deposit addresses file, REQUIRED if ltc_scanner.enabled, unless address_provider.enabled"},
+			{"eth_addresses", "Path of the ETH deposit addresses file, REQUIRED if erc20_scanner.enabled, unless address_provider.enabled"},
+		},
+	},
+	{
+		Name:    "address_provider",
+		Comment: "Fetch deposit addresses from a remote address service, e.g. in front of an HSM, instead of the address files",
+		Keys: []schemaKey{
+			{"enabled", ""},
+			{"url", "Address service, called with POST <url> {\"coin_type\": \"BTC\", \"count\": <batch_size>}"},
+			{"api_key", "Bearer token of the requests to the address service"},
+			{"timeout", ""},
+			{"batch_size", "Number of addresses fetched at a time and cached until they are given out"},
+		},
+	},
+	{
+		Name:    "encryption",
+		Comment: "Encrypt the deposit address pools, the deposits and the API key secrets in the db. Can't be disabled once enabled",
+		Keys: []schemaKey{
+			{"enabled", ""},
+			{"passphrase", "Passphrase of the encryption key, prompted for at startup if empty. Better set from the secrets manager"},
+		},
+	},
+	{
+		Name:    "logging",
+		Comment: "Log format and rotation of the log files, and the audit log of binds, admin actions and sends",
+		Keys: []schemaKey{
+			{"format", `"text" or "json"`},
+			{"max_size_mb", "Rotate the log files before they grow larger than this, 0 for no limit"},
+			{"max_age", "Rotate the log files once they have been written to for this long, 0 for no limit"},
+			{"max_backups", "Number of rotated files kept of each log file, 0 keeps all of them"},
+			{"audit_file", "Path of the JSON audit log, relative to the working directory. Empty to not write it"},
+			{"scrub_pii", "Hash or truncate the skycoin, deposit and IP addresses of the log fields, except in the audit log"},
+			{"scrub_mode", `"hash" replaces them with a keyed hash, "truncate" keeps their first characters`},
+			{"scrub_secret", `REQUIRED if scrub_pii and scrub_mode is "hash". "teller scrub-hash ADDRESS" prints the hash of an address`},
+		},
+	},
+	{
+		Name: "teller",
+		Keys: []schemaKey{
+			{"max_bound_btc_addrs", "0 means unlimited"},
+			{"max_sky_per_addr", "Max SKY a skycoin address can buy in its lifetime, deposits beyond it are held for review. Empty for no limit"},
+			{"bind_ttl", "Bound addresses that receive no deposit within bind_ttl are unbound and returned to the pool. 0 keeps them bound"},
+			{"recycle_addresses", "Return bound addresses to the pool once their deposits were processed and recycle_cooldown passed"},
+			{"recycle_cooldown", "Time since the last change of the deposits of an address before it is recycled"},
+			{"hide_dust", "Leave the deposits ignored as dust out of the status responses"},
+		},
+	},
+	{
+		Name: "sky_rpc",
+		Keys: []schemaKey{
+			{"address", ""},
+			{"fallback_addresses", `Nodes to fail over to, in order of preference, e.g. ["10.0.0.2:6430"]`},
+			{"health_check_period", "How often the nodes are checked for being up and synced"},
+			{"max_backoff", "Maximum wait before a node that is down is tried again"},
+		},
+	},
+	{
+		Name:    "btc_rpc",
+		Comment: "Only used by the btcd btc_scanner backend",
+		Keys: []schemaKey{
+			{"server", ""},
+			{"user", ""},
+			{"pass", ""},
+			{"cert", "btcd RPC certificate file"},
+			{"health_check_period", "How often the nodes are health checked and their block hashes cross-checked, if there are fallback nodes"},
+		},
+		Tables: []schemaTable{
+			{
+				Name:    "fallback_nodes",
+				Comment: "btcd nodes to fail over to, in order of preference. The node above is preferred while it is healthy",
+				Keys: []schemaKey{
+					{"server", ""},
+					{"user", ""},
+					{"pass", ""},
+					{"cert", "btcd RPC certificate file"},
+				},
+			},
+		},
+	},
+	{
+		Name: "btc_scanner",
+		Keys: []schemaKey{
+			{"backend", `"btcd", "electrum" or "blockbook". btc_rpc is only required for "btcd"`},
+			{"scan_period", ""},
+			{"initial_scan_height", ""},
+			{"confirmations_required", ""},
+			{"zmq_address", `bitcoind zmqpubhashblock address, e.g. "tcp://127.0.0.1:28332", to scan new blocks immediately`},
+			{"scan_concurrency", "Number of blocks fetched concurrently while catching up with the chain"},
+			{"electrum_server", `"host:port", REQUIRED if backend is "electrum"`},
+			{"electrum_tls", ""},
+			{"electrum_cert", "PEM certificate file, for a self-signed electrum server"},
+			{"blockbook_url", `e.g. "https://btc1.trezor.io", REQUIRED if backend is "blockbook"`},
+			{"scan_shards", `Number of workers polling the deposit addresses in parallel, "electrum" and "blockbook" only`},
+			{"dust_threshold", `Deposits below this BTC value are ignored as dust, e.g. "0.00001". Empty to accept any deposit`},
+		},
+		Tables: []schemaTable{
+			{
+				Name:    "confirmation_tiers",
+				Comment: "More confirmations for larger deposits. A deposit needs the most confirmations of the tiers its value reaches",
+				Keys: []schemaKey{
+					{"min_value", `Minimum deposit value in BTC as a string, e.g. "1.5"`},
+					{"confirmations", "Confirmations required before skycoins are sent, more than confirmations_required"},
+				},
+			},
+		},
+	},
+	{
+		Name: "ltc_rpc",
+		Keys: []schemaKey{
+			{"server", ""},
+			{"user", "REQUIRED if ltc_scanner.enabled"},
+			{"pass", "REQUIRED if ltc_scanner.enabled"},
+		},
+	},
+	{
+		Name: "ltc_scanner",
+		Keys: []schemaKey{
+			{"enabled", "Accept LTC deposits"},
+			{"scan_period", ""},
+			{"initial_scan_height", ""},
+			{"confirmations_required", ""},
+			{"zmq_address", `litecoind zmqpubhashblock address, e.g. "tcp://127.0.0.1:28333", to scan new blocks immediately`},
+			{"scan_concurrency", "Number of blocks fetched concurrently while catching up with the chain"},
+			{"dust_threshold", `Deposits below this LTC value are ignored as dust, e.g. "0.001". Empty to accept any deposit`},
+		},
+		Tables: []schemaTable{
+			{
+				Name:    "confirmation_tiers",
+				Comment: "More confirmations for larger deposits. A deposit needs the most confirmations of the tiers its value reaches",
+				Keys: []schemaKey{
+					{"min_value", `Minimum deposit value in LTC as a string, e.g. "100"`},
+					{"confirmations", "Confirmations required before skycoins are sent, more than confirmations_required"},
+				},
+			},
+		},
+	},
+	{
+		Name: "eth_rpc",
+		Keys: []schemaKey{
+			{"url", ""},
+		},
+	},
+	{
+		Name: "erc20_scanner",
+		Keys: []schemaKey{
+			{"enabled", "Accept ERC20 token deposits"},
+			{"scan_period", ""},
+			{"initial_scan_height", ""},
+			{"confirmations_required", ""},
+			{"dust_threshold", "Deposits below this value in units of their token are ignored as dust. Empty to accept any deposit"},
+		},
+		Tables: []schemaTable{
+			{
+				Name:    "confirmation_tiers",
+				Comment: "More confirmations for larger deposits. A deposit needs the most confirmations of the tiers its value reaches",
+				Keys: []schemaKey{
+					{"min_value", `Minimum deposit value in units of its token as a string, e.g. "1000"`},
+					{"confirmations", "Confirmations required before skycoins are sent, more than confirmations_required"},
+				},
+			},
+			{
+				Name:    "tokens",
+				Comment: "Accepted tokens, at least one is REQUIRED if erc20_scanner.enabled",
+				Keys: []schemaKey{
+					{"symbol", "Token symbol, used as the coin type"},
+					{"contract", "Token contract address"},
+					{"decimals", "Number of decimal places of the token, e.g. 18"},
+					{"sky_exchange_rate", "SKY/token exchange rate as a string, can be an int, float or a rational fraction"},
+				},
+			},
+		},
+	},
+	{
+		Name: "sky_exchanger",
+		Keys: []schemaKey{
+			{"sky_btc_exchange_rate", "SKY/BTC exchange rate as a string, can be an int, float or a rational fraction"},
+			{"sky_ltc_exchange_rate", "SKY/LTC exchange rate, REQUIRED if ltc_scanner.enabled"},
+			{"wallet", "Path of the hot wallet file, not used if sky_signer.enabled"},
+			{"max_decimals", "Number of decimal places to truncate SKY to"},
+			{"tx_confirmation_check_wait", ""},
+			{"batch_window", "Send the deposits received within this window in one transaction, 0 to send them one by one"},
+			{"batch_max_size", "Maximum number of deposits sent in one transaction"},
+			{"fee_percent", "Percentage of the SKY bought that is kept as a fee, e.g. \"1.5\". Empty for no fee"},
+			{"fee_fixed_droplets", "Fixed fee kept from each deposit, in droplets (1 SKY = 1000000 droplets)"},
+			{"drain_timeout", "Maximum time to wait on shutdown for the deposits being sent to be saved, 0 for no limit"},
+			{"double_spend_confirmations", "BTC and LTC deposits with fewer confirmations are checked for double spends before sending, 0 to not check"},
+			{"double_spend_check_period", "How often held and sent deposits with fewer than double_spend_confirmations are checked, 0 to only check before sending"},
+		},
+	},
+	{
+		Name:    "sky_signer",
+		Comment: "Sign transactions with a remote teller-signer, instead of sky_exchanger.wallet",
+		Keys: []schemaKey{
+			{"enabled", ""},
+			{"url", "HTTPS URL of the signer, REQUIRED if sky_signer.enabled"},
+			{"cert", "Client certificate file that teller authenticates to the signer with"},
+			{"key", "Client key file"},
+			{"ca", "CA certificate file that the signer's certificate is verified with"},
+		},
+	},
+	{
+		Name: "wallet_topup",
+		Keys: []schemaKey{
+			{"enabled", "Detect incoming SKY transfers to the hot wallet"},
+			{"check_period", ""},
+			{"resume_balance", "Balance in SKY at or above which paused payouts are resumed after a top-up"},
+		},
+	},
+	{
+		Name: "wallet_balance",
+		Keys: []schemaKey{
+			{"enabled", "Monitor the hot wallet balance, served by the /api/balance admin API"},
+			{"check_period", ""},
+			{"low_balance", "Balance in SKY below which an alert is raised"},
+			{"pause_deposits", "Pause deposits while the balance is below low_balance"},
+		},
+	},
+	{
+		Name: "web",
+		Keys: []schemaKey{
+			{"behind_proxy", "This must be set to true when behind a proxy for ratelimiting to work"},
+			{"trusted_proxies", `IPs or CIDR ranges of the proxies, e.g. ["10.0.0.0/8"]. If set, X-Forwarded-For is only honored for requests from them`},
+			{"proxy_protocol", "Read PROXY protocol v1 and v2 headers from trusted_proxies, e.g. from HAProxy or AWS ELB"},
+			{"unix_socket_mode", "Permissions of the unix sockets of http_addr and https_addr"},
+			{"api_enabled", ""},
+			{"http_addr", `host:port, "unix:PATH" for a unix socket, or "systemd:NAME" for a systemd activated socket`},
+			{"https_addr", "Serve on HTTPS, same formats as http_addr"},
+			{"auto_tls_host", "Hostname to use for automatic TLS certs. Used when tls_cert, tls_key unset"},
+			{"tls_cert", ""},
+			{"tls_key", ""},
+			{"static_dir", ""},
+			{"throttle_max", ""},
+			{"throttle_duration", ""},
+			{"status_batch_max", "Maximum number of skycoin addresses in a /api/status/batch request, at most throttle_max"},
+			{"addr_throttle_burst", "Maximum number of requests per skycoin address per addr_throttle_duration, 0 disables it"},
+			{"addr_throttle_duration", ""},
+			{"max_conns_per_ip", "Maximum concurrent requests per IP, 0 disables it"},
+			{"static_bandwidth_per_ip", "Maximum static file bandwidth per IP in bytes per second, 0 disables it"},
+			{"ratelimit_backend", `Set to "redis" to share rate limits between multiple teller instances`},
+			{"maintenance", "Serve 503 responses to API requests, except /api/config. Can be toggled with the admin API"},
+			{"maintenance_retry_after", "Retry-After of the responses in maintenance mode"},
+			{"ip_allowlist", `IPs or CIDR ranges allowed to make requests, e.g. ["10.0.0.0/8"]. All IPs are allowed if empty`},
+			{"ip_denylist", "IPs or CIDR ranges denied, even if they are in ip_allowlist"},
+		},
+	},
+	{
+		Name:    "tor",
+		Comment: "Publish web.http_addr as a Tor v3 hidden service, through the control port of a local Tor.\nThe onion address is kept across restarts of teller and Tor, it is logged when the hidden service is published",
+		Keys: []schemaKey{
+			{"enabled", ""},
+			{"control_addr", "host:port of the Tor control port"},
+			{"control_password", "Password of the control port if Tor uses HashedControlPassword, otherwise cookie or no authentication is used"},
+			{"key_file", "Private key of the hidden service, created if it doesn't exist. Relative to the data directory unless absolute"},
+			{"virtual_port", "Port of the onion address"},
+			{"target", `host:port or "unix:PATH" connections are forwarded to, defaults to web.http_addr`},
+			{"retry_delay", "How long to wait before connecting to the control port again after it failed or closed"},
+		},
+	},
+	{
+		Name: "redis",
+		Keys: []schemaKey{
+			{"addr", `REQUIRED if web.ratelimit_backend is "redis" or ha.enabled`},
+			{"password", ""},
+			{"db", ""},
+		},
+	},
+	{
+		Name:    "ha",
+		Comment: "Active/standby high availability: instances elect a leader with a lock in redis. Only the leader opens the db,\nscans deposits, sends skycoin and serves the API. Standbys take over when the lock is released or expires",
+		Keys: []schemaKey{
+			{"enabled", ""},
+			{"instance_id", "ID of this instance, defaults to the hostname and pid"},
+			{"lock_key", "Redis key of the leader lock"},
+			{"lock_ttl", "The lock expires if the leader doesn't renew it within lock_ttl"},
+			{"retry_period", "How often a standby tries to take the lock"},
+		},
+	},
+	{
+		Name: "pricing",
+		Keys: []schemaKey{
+			{"enabled", "Use regional pricing, with the region of a client derived from its country"},
+			{"geoip_header", `Header with the client's country code, set by a trusted proxy or CDN, e.g. "CF-IPCountry"`},
+			{"geoip_file", "CSV file of network,country rows to look up client IPs in, if geoip_header is not set"},
+		},
+		Tables: []schemaTable{
+			{
+				Name:    "regions",
+				Comment: "Pricing regions, at least one is REQUIRED if pricing.enabled. Clients in no region get the default pricing",
+				Keys: []schemaKey{
+					{"name", ""},
+					{"countries", `ISO 3166-1 alpha-2 country codes, e.g. ["DE", "FR"]`},
+					{"bonus_percent", "Extra SKY given, as a percentage of the exchange rate"},
+					{"min_sky", "Minimum SKY a deposit must buy. Smaller deposits are not sent any SKY"},
+				},
+			},
+		},
+	},
+	{
+		Name: "outbox",
+		Keys: []schemaKey{
+			{"enabled", "POST deposit status changes to outbox.webhook_url"},
+			{"webhook_url", "REQUIRED if outbox.enabled"},
+			{"webhook_secret", "Signs webhook requests with HMAC-SHA256, if set"},
+			{"dispatch_period", ""},
+			{"max_backoff", ""},
+		},
+	},
+	{
+		Name: "stream",
+		Keys: []schemaKey{
+			{"enabled", "Publish deposit lifecycle events to NATS or Kafka"},
+			{"backend", `"nats" or "kafka"`},
+			{"url", "REQUIRED if stream.enabled. nats:// or tls:// URL of the NATS server, or URL of the Kafka REST proxy"},
+			{"topic", "NATS subject or Kafka topic"},
+			{"user", "NATS user, or Kafka REST proxy basic auth user"},
+			{"password", ""},
+			{"token", "NATS auth token"},
+			{"dispatch_period", ""},
+			{"max_backoff", ""},
+		},
+	},
+	{
+		Name: "settlement",
+		Keys: []schemaKey{
+			{"enabled", "POST payouts to settlement.webhook_url until the partner acknowledges them"},
+			{"webhook_url", "REQUIRED if settlement.enabled"},
+			{"webhook_secret", "Signs webhook requests with HMAC-SHA256, if set"},
+			{"check_period", ""},
+			{"retry_period", "Wait before notifying an unacknowledged settlement again"},
+		},
+	},
+	{
+		Name: "support_tokens",
+		Keys: []schemaKey{
+			{"enabled", "Serve /api/support/status for support tokens minted on the admin panel"},
+			{"default_ttl", "Lifetime of tokens minted without a ttl"},
+			{"max_ttl", ""},
+		},
+	},
+	{
+		Name:    "status_challenge",
+		Comment: "Require /api/status requests to prove the ownership of the skycoin address, by signing a nonce of\n/api/status/challenge with its secret key. Batch status requests must be signed with an API key.",
+		Keys: []schemaKey{
+			{"enabled", ""},
+			{"ttl", "Lifetime of a nonce, a signed nonce can be used until it expires"},
+			{"secret", "HMAC key of the nonces, set the same secret on instances behind a load balancer. Random at startup if empty"},
+		},
+	},
+	{
+		Name:    "bind_signature",
+		Comment: "Require /api/bind requests to be signed with the secret key of the skycoin address, so that deposit\naddresses can't be bound to someone else's address. Requests signed with an API key don't need it.",
+		Keys: []schemaKey{
+			{"enabled", ""},
+			{"max_clock_skew", "Maximum difference between the timestamp of a signed bind request and the current time"},
+		},
+	},
+	{
+		Name:    "campaigns",
+		Comment: "Campaigns with their own deposit address pools, rates and SKY caps, managed on the admin panel.\n/api/bind requests choose a campaign with the campaign arg.",
+		Keys: []schemaKey{
+			{"enabled", ""},
+		},
+	},
+	{
+		Name:    "quotes",
+		Comment: "Fixed-price quotes of /api/quote. Deposits to an address bound with a quote_id get the quoted rate,\nif they arrive before the quote expires and are within its amount range.",
+		Keys: []schemaKey{
+			{"enabled", ""},
+			{"ttl", "Quotes expire after ttl"},
+			{"min_amount", "Minimum deposit amount the quoted rate applies to, in coins. Empty for no limit"},
+			{"max_amount", "Maximum deposit amount the quoted rate applies to, in coins. Empty for no limit"},
+		},
+	},
+	{
+		Name:    "promo_codes",
+		Comment: "Promo and referral codes, managed on the admin panel. Deposits to an address bound with a promo_code\nget the bonus of the code, while it is enabled and has not expired.",
+		Keys: []schemaKey{
+			{"enabled", ""},
+		},
+	},
+	{
+		Name:    "kyc",
+		Comment: "Check the skycoin addresses of deposits with a KYC service. Deposits of addresses whose owners did not\npass KYC are held as pending_kyc, until they pass it or are released on the admin panel.",
+		Keys: []schemaKey{
+			{"enabled", ""},
+			{"url", "KYC service, called with GET <url>?skyaddr=<skyaddr>&token=<kyc_token>"},
+			{"api_key", "Bearer token of the requests to the KYC service"},
+			{"timeout", ""},
+			{"threshold", "Deposits buying at least threshold SKY are checked. Empty to check every deposit"},
+			{"at_bind", "Also require the owner of the skycoin address of /api/bind requests to pass KYC"},
+			{"recheck_interval", "Interval the addresses of held deposits are checked again at, 0 to only release them on the admin panel"},
+		},
+	},
+	{
+		Name:    "screening",
+		Comment: "Screen new deposits for AML risk, with local rules or an external risk API. Flagged deposits are held\nas held_for_review, until they are approved or rejected on the admin panel.",
+		Keys: []schemaKey{
+			{"enabled", ""},
+			{"provider", "\"rules\" or \"api\""},
+			{"max_value", "rules: deposits of at least max_value coins are flagged. Empty for no limit"},
+			{"url", "api: risk API, deposits are POSTed to it as JSON"},
+			{"api_key", "api: bearer token of the requests to the risk API"},
+			{"timeout", ""},
+		},
+	},
+	{
+		Name:    "api_keys",
+		Comment: "API keys of trusted integrators, created on the admin panel. Signed requests skip the rate limits.",
+		Keys: []schemaKey{
+			{"enabled", ""},
+			{"max_clock_skew", "Maximum difference between the timestamp of a signed request and the current time"},
+			{"max_bound_btc_addrs", "max_bound_btc_addrs of signed bind requests, for keys created without max_bound_addrs. 0 for no limit"},
+		},
+	},
+	{
+		Name:    "alerts",
+		Comment: "Alerts of critical events, sent to the sinks enabled below and to alerts.sinks",
+		Keys: []schemaKey{
+			{"enabled", ""},
+			{"cooldown", "An event is alerted at most once per cooldown"},
+			{"check_period", "How often the scanners and the deposit address pool are checked"},
+			{"scanner_behind_blocks", "Alert when a scanner is more than this many confirmed blocks behind"},
+			{"address_pool_low", "Alert when fewer than this many BTC deposit addresses are left"},
+			{"http_errors", "Alert when the API responds with this many 5xx errors within http_errors_window"},
+			{"http_errors_window", ""},
+			{"large_deposit", "Alert deposits of at least this many coins, of any coin type. Empty to disable."},
+			{"repeated_deposits", "Alert when more than this many deposits are credited to the same skycoin address within repeated_deposits_window. 0 to disable."},
+			{"repeated_deposits_window", ""},
+			{"bind_spike_factor", "Alert when more than this factor times the average bind rate of bind_spike_baseline, and at least bind_spike_min addresses, are bound within bind_spike_window. 0 to disable."},
+			{"bind_spike_min", ""},
+			{"bind_spike_window", ""},
+			{"bind_spike_baseline", ""},
+		},
+		Tables: []schemaTable{
+			{
+				Name:    "sinks",
+				Comment: "Sinks of any registered sink type, next to alerts.smtp, alerts.slack and alerts.telegram",
+				Keys: []schemaKey{
+					{"name", "Name of the sink in alerts.routes"},
+					{"type", `"log", "webhook", "smtp", "slack", "telegram", or a sink type registered by a plugin`},
+					{"min_severity", "Only alerts of at least this severity are sent, all alerts if empty"},
+					{"subject_template", `text/template of the subject, e.g. "{{.Severity}} {{.Event}}". The default format if empty`},
+					{"template", "text/template of the text, with .Event, .Severity, .Message, .Time, .Subject and .Text"},
+					{"url", "URL of the webhook or of the Slack incoming webhook"},
+					{"secret", "Signs webhook requests with HMAC-SHA256, if set"},
+					{"addr", "host:port of the SMTP server"},
+					{"username", "SMTP PLAIN auth is used if set"},
+					{"password", ""},
+					{"from", ""},
+					{"to", `e.g. ["ops@example.com"]`},
+					{"bot_token", "Telegram bot token"},
+					{"chat_id", "Telegram chat, the bot must be a member of the chat"},
+				},
+			},
+			{
+				Name:    "routes",
+				Comment: "Routes of events to sinks. Without routes, every sink receives every event",
+				Keys: []schemaKey{
+					{"events", `e.g. ["send_failed", "double_spend"], all events if empty`},
+					{"sinks", `Names of alerts.sinks entries, or "smtp", "slack" or "telegram", e.g. ["oncall"]`},
+				},
+			},
+		},
+	},
+	{
+		Name:    "alerts.severity",
+		Comment: `Severity of each event, "off", "info", "warning" or "critical"`,
+		Keys: []schemaKey{
+			{"send_failed", ""},
+			{"scanner_behind", ""},
+			{"wallet_balance_low", "Requires wallet_balance.enabled"},
+			{"address_pool_low", ""},
+			{"http_errors", ""},
+			{"large_deposit", ""},
+			{"repeated_deposits", ""},
+			{"bind_spike", ""},
+			{"double_spend", ""},
+		},
+	},
+	{
+		Name: "alerts.smtp",
+		Keys: []schemaKey{
+			{"enabled", "Email alerts"},
+			{"addr", "host:port of the SMTP server, REQUIRED if alerts.smtp.enabled"},
+			{"username", "PLAIN auth is used if set"},
+			{"password", ""},
+			{"from", "REQUIRED if alerts.smtp.enabled"},
+			{"to", `REQUIRED if alerts.smtp.enabled, e.g. ["ops@example.com"]`},
+			{"min_severity", "Only alerts of at least this severity are sent"},
+		},
+	},
+	{
+		Name: "alerts.slack",
+		Keys: []schemaKey{
+			{"enabled", "Post alerts to a Slack incoming webhook"},
+			{"webhook_url", "REQUIRED if alerts.slack.enabled"},
+			{"min_severity", "Only alerts of at least this severity are sent"},
+		},
+	},
+	{
+		Name: "alerts.telegram",
+		Keys: []schemaKey{
+			{"enabled", "Send alerts to a Telegram chat through a bot"},
+			{"bot_token", "REQUIRED if alerts.telegram.enabled"},
+			{"chat_id", "REQUIRED if alerts.telegram.enabled, the bot must be a member of the chat"},
+			{"min_severity", "Only alerts of at least this severity are sent"},
+		},
+	},
+	{
+		Name:    "reports",
+		Comment: "Daily reconciliation reports of the deposits received and the skycoins sent",
+		Keys: []schemaKey{
+			{"enabled", ""},
+			{"dir", "Directory the reports are saved in, relative to the data directory unless absolute"},
+			{"check_period", "How often to check whether the previous day's report is due"},
+			{"email", "Email the daily reports to alerts.smtp.to, requires alerts.smtp.enabled"},
+		},
+	},
+	{
+		Name:    "notifications",
+		Comment: "Email users who left an email address in /api/bind when their deposits are done or fail, requires alerts.smtp.enabled",
+		Keys: []schemaKey{
+			{"enabled", ""},
+			{"secret", "REQUIRED if notifications.enabled. Encrypts and hashes the email addresses, can't be changed once emails are stored"},
+			{"base_url", "REQUIRED if notifications.enabled. URL of the teller API that the unsubscribe links point to, e.g. https://teller.example.com"},
+			{"from", "Sender of the notifications, alerts.smtp.from if empty"},
+			{"subject_template", "text/template of the subject, the default if empty"},
+			{"template", "text/template of the text, the default if empty"},
+			{"dispatch_period", ""},
+			{"max_backoff", ""},
+		},
+	},
+	{
+		Name:    "archive",
+		Comment: "Move the deposits processed more than retention_days ago out of the db, into compressed archive files",
+		Keys: []schemaKey{
+			{"enabled", ""},
+			{"retention_days", "Must be longer than teller.recycle_cooldown if teller.recycle_addresses"},
+			{"dir", "Directory the archives are saved in, relative to the data directory unless absolute"},
+			{"check_period", "How often to archive the deposits that passed the retention period"},
+		},
+	},
+	{
+		Name:    "backup",
+		Comment: "Take encrypted snapshots of the db, restored with the restore command",
+		Keys: []schemaKey{
+			{"enabled", ""},
+			{"dir", "Directory the snapshots are saved in, relative to the data directory unless absolute"},
+			{"interval", "How often a snapshot is taken"},
+			{"keep", "Number of snapshots kept in dir, the oldest are deleted"},
+			{"passphrase", "REQUIRED if backup.enabled, the snapshots are encrypted with a key derived from it"},
+		},
+	},
+	{
+		Name: "backup.s3",
+		Keys: []schemaKey{
+			{"enabled", "Upload the snapshots and the deposit archives to a bucket of an S3-compatible service"},
+			{"endpoint", "URL of the S3 API, or of an S3-compatible service, e.g. MinIO"},
+			{"region", ""},
+			{"bucket", "REQUIRED if backup.s3.enabled"},
+			{"prefix", "Prefix of the keys of the objects"},
+			{"access_key_id", "REQUIRED if backup.s3.enabled"},
+			{"secret_access_key", "REQUIRED if backup.s3.enabled"},
+			{"keep", "Number of snapshots kept in the bucket, the oldest are deleted. Deposit archives are never deleted"},
+		},
+	},
+	{
+		Name:    "sentry",
+		Comment: "Report errors, failed sends and panics to Sentry, with the request ID and deposit ID they happened in",
+		Keys: []schemaKey{
+			{"enabled", ""},
+			{"dsn", "REQUIRED if sentry.enabled. DSN of the Sentry project, https://<key>@<host>/<project id>"},
+			{"environment", `Environment of the reported errors, e.g. "production"`},
+		},
+	},
+	{
+		Name:    "tracing",
+		Comment: "Trace API requests and deposits across the exchange and the skycoin RPC calls, exported with OTLP to e.g. Jaeger or Tempo",
+		Keys: []schemaKey{
+			{"enabled", ""},
+			{"otlp_endpoint", "OTLP/HTTP traces endpoint of the collector"},
+			{"service_name", "service.name of the spans"},
+			{"sample_ratio", "Ratio of the traces that are sampled, between 0 and 1"},
+		},
+	},
+	{
+		Name:    "secrets",
+		Comment: "Secrets fetched from a secrets manager at startup, taking precedence over the config file\nand environment variables. Each secret is named by the config key it sets, e.g. btc_rpc.pass.\nThe secrets of web.tls_cert, web.tls_key, sky_signer.cert and sky_signer.key are the file contents.",
+		Keys: []schemaKey{
+			{"provider", `Empty to not use a secrets manager, or "vault"`},
+			{"renew_period", "How often the credentials of the secrets manager are renewed"},
+		},
+	},
+	{
+		Name:    "secrets.vault",
+		Comment: "HashiCorp Vault, with the secrets in the fields of a KV version 2 secret",
+		Keys: []schemaKey{
+			{"addr", `REQUIRED if secrets.provider is "vault", e.g. "https://127.0.0.1:8200"`},
+			{"token", "Prefer token_file or the TELLER_SECRETS_VAULT_TOKEN environment variable"},
+			{"token_file", "File the token is read from before each request, e.g. written by a Vault agent"},
+			{"ca_cert", "CA certificate of the Vault server, if not signed by a system CA"},
+			{"mount", "Mount path of the KV version 2 secrets engine"},
+			{"path", "Path of the secret in the secrets engine"},
+		},
+	},
+	{
+		Name: "captcha",
+		Keys: []schemaKey{
+			{"enabled", "Require a captcha token for /api/bind"},
+			{"provider", `"recaptcha" or "hcaptcha"`},
+			{"site_key", ""},
+			{"secret", ""},
+		},
+	},
+	{
+		Name: "admin_panel",
+		Keys: []schemaKey{
+			{"host", ""},
+			{"tls_cert", "Serve the admin API over TLS, requires tls_key"},
+			{"tls_key", ""},
+			{"client_ca", "CA certificate that client certificates are verified with, requires tls_cert"},
+		},
+		Tables: []schemaTable{
+			{
+				Name:    "principals",
+				Comment: "Principals allowed to use the admin API. If there are none, the admin API is open to anyone who can connect to host",
+				Keys: []schemaKey{
+					{"name", "Name of the principal in the logs"},
+					{"role", `"viewer", "operator" or "admin"`},
+					{"token", `Authenticates with an "Authorization: Bearer <token>" header`},
+					{"client_cert_cn", "Authenticates with a client certificate of this common name, signed by client_ca"},
+				},
+			},
+		},
+	},
+	{
+		Name:    "admin_dashboard",
+		Comment: "Web admin dashboard, served on its own listener behind HTTP basic auth",
+		Keys: []schemaKey{
+			{"enabled", ""},
+			{"host", `host:port, "unix:PATH" or "systemd:NAME", must not be admin_panel.host`},
+			{"username", ""},
+			{"password", "Better set from the secrets manager"},
+		},
+	},
+	{
+		Name:    "upgrade",
+		Comment: "Zero-downtime upgrades: on SIGUSR2, teller starts a new process of its binary that takes over\nthe listening sockets, then finishes its in-flight work and exits",
+		Keys: []schemaKey{
+			{"timeout", "How long to wait for the new process to start, and for it to wait for the db"},
+			{"pid_file", "File the pid of the running process is written to, e.g. for PIDFile of systemd, relative to the data directory"},
+		},
+	},
+	{
+		Name:    "dummy",
+		Comment: "Fake sender and scanner with an admin interface for adding fake deposits,\nand viewing and confirming skycoin transactions",
+		Keys: []schemaKey{
+			{"sender", ""},
+			{"scanner", ""},
+			{"http_addr", ""},
+		},
+	},
+}
+
+const (
+	// PresetProduction is a config for a public teller serving HTTPS itself
+	PresetProduction = "production"
+	// PresetPassthrough is a config for a public teller behind a reverse proxy that terminates TLS
+	PresetPassthrough = "passthrough"
+	// PresetDev is a config for local development, with the dummy sender and scanner
+	PresetDev = "dev"
+)
+
+// Presets lists the presets accepted by Init
+var Presets = []string{PresetProduction, PresetPassthrough, PresetDev}
+
+// preset is a starting config for a deployment profile
+type preset struct {
+	// Values written uncommented
+	values map[string]interface{}
+	// Keys with no usable default, written uncommented and marked REQUIRED
+	required []string
+}
+
+// liveRequired are the keys that must be filled in for a teller that sends SKY for real deposits
+var liveRequired = []string{
+	"btc_addresses",
+	"btc_rpc.user",
+	"btc_rpc.pass",
+	"btc_rpc.cert",
+	"sky_exchanger.sky_btc_exchange_rate",
+	"sky_exchanger.wallet",
+	"captcha.site_key",
+	"captcha.secret",
+}
+
+var presets = map[string]preset{
+	PresetProduction: {
+		values: map[string]interface{}{
+			"debug":           false,
+			"web.http_addr":   ":80",
+			"web.https_addr":  ":443",
+			"captcha.enabled": true,
+			"dummy.sender":    false,
+			"dummy.scanner":   false,
+		},
+		required: append([]string{"web.auto_tls_host"}, liveRequired...),
+	},
+	PresetPassthrough: {
+		values: map[string]interface{}{
+			"debug":               false,
+			"web.behind_proxy":    true,
+			"web.trusted_proxies": []string{"127.0.0.1", "::1"},
+			"web.http_addr":       "127.0.0.1:7071",
+			"captcha.enabled":     true,
+			"dummy.sender":        false,
+			"dummy.scanner":       false,
+		},
+		required: liveRequired,
+	},
+	PresetDev: {
+		values: map[string]interface{}{
+			"debug":                               true,
+			"btc_addresses":                       "example_btc_addresses.json",
+			"sky_exchanger.sky_btc_exchange_rate": "500",
+			"sky_exchanger.wallet":                "example.wlt",
+			"dummy.sender":                        true,
+			"dummy.scanner":                       true,
+		},
+	},
+}
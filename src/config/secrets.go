@@ -0,0 +1,129 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+
+	"github.com/skycoin/teller/src/secrets"
+)
+
+// SecretsProviderVault fetches secrets from HashiCorp Vault
+const SecretsProviderVault = "vault"
+
+// secretsDir is the directory inside the data directory that secret files are written to
+const secretsDir = "secrets"
+
+// secretFileKeys are the config keys of files that can be secrets, e.g. TLS keys. Their secrets are
+// the file contents, which are written to the secrets directory, and the key is set to the file's path.
+var secretFileKeys = map[string]struct{}{
+	"web.tls_cert":    {},
+	"web.tls_key":     {},
+	"sky_signer.cert": {},
+	"sky_signer.key":  {},
+}
+
+// NewProvider creates the secrets provider
+func (c Secrets) NewProvider() (secrets.Provider, error) {
+	switch c.Provider {
+	case SecretsProviderVault:
+		var caCert []byte
+		if c.Vault.CACert != "" {
+			var err error
+			caCert, err = ioutil.ReadFile(c.Vault.CACert)
+			if err != nil {
+				return nil, fmt.Errorf("secrets.vault.ca_cert read failed: %v", err)
+			}
+		}
+
+		return secrets.NewVault(secrets.VaultConfig{
+			Addr:      c.Vault.Addr,
+			Token:     c.Vault.Token,
+			TokenFile: c.Vault.TokenFile,
+			CACert:    caCert,
+			Mount:     c.Vault.Mount,
+			Path:      c.Vault.Path,
+		})
+	default:
+		return nil, fmt.Errorf("secrets.provider must be empty or %q", SecretsProviderVault)
+	}
+}
+
+// setSecrets overrides the config keys of v with the secrets of provider, which are named by config key,
+// e.g. btc_rpc.pass. The secrets of secretFileKeys are written to files in dir.
+func setSecrets(v *viper.Viper, provider secrets.Provider, dir string) error {
+	values, err := provider.Secrets()
+	if err != nil {
+		return fmt.Errorf("Fetch secrets from %s failed: %v", provider.Name(), err)
+	}
+
+	keys, _ := schemaKeys()
+
+	names := make([]string, 0, len(values))
+	for k := range values {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	for _, k := range names {
+		t, ok := keys[k]
+		if !ok {
+			return fmt.Errorf("%s secret %s is not a config key", provider.Name(), k)
+		}
+
+		if _, ok := secretFileKeys[k]; ok {
+			path, err := writeSecretFile(dir, k, values[k])
+			if err != nil {
+				return fmt.Errorf("Write %s secret file failed: %v", k, err)
+			}
+			v.Set(k, path)
+			continue
+		}
+
+		value, err := parseEnvValue(t, values[k])
+		if err != nil {
+			return fmt.Errorf("%s secret %s invalid: %v", provider.Name(), k, err)
+		}
+
+		v.Set(k, value)
+	}
+
+	return nil
+}
+
+// writeSecretFile writes the secret of a file config key to dir, readable only by the owner, and returns its path
+func writeSecretFile(dir, key, secret string) (string, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(dir, strings.Replace(key, ".", "_", -1)+".pem")
+
+	f, err := ioutil.TempFile(dir, ".tmp-")
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := f.WriteString(secret); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+
+	if err := os.Rename(f.Name(), path); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+
+	return path, nil
+}
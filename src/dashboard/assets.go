@@ -0,0 +1,419 @@
+package dashboard
+
+// The dashboard is a single page that polls the admin API.
+// The assets are in the binary, so that the dashboard works wherever teller is deployed.
+
+const indexHTML = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Teller admin</title>
+<link rel="stylesheet" href="/dashboard.css">
+</head>
+<body>
+<header>
+  <h1>Teller admin</h1>
+  <span id="updated"></span>
+</header>
+
+<main>
+  <section>
+    <h2>Last 24 hours</h2>
+    <div class="cards" id="totals"></div>
+    <table id="series">
+      <thead>
+        <tr>
+          <th>Hour (UTC)</th><th>Binds</th><th>Detected</th><th>Sent</th><th>SKY sent</th>
+          <th>Pending confirmations</th><th>Avg latency</th><th>Errors</th>
+        </tr>
+      </thead>
+      <tbody></tbody>
+    </table>
+  </section>
+
+  <section>
+    <h2>All time</h2>
+    <div class="cards" id="alltime"></div>
+  </section>
+
+  <section>
+    <h2>Hot wallet</h2>
+    <div class="cards" id="balance"></div>
+  </section>
+
+  <section>
+    <h2>Deposit address pools</h2>
+    <div class="cards" id="pools"></div>
+  </section>
+
+  <section>
+    <h2>Errored deposits</h2>
+    <p id="reprocess-result"></p>
+    <table id="errored">
+      <thead>
+        <tr><th>Updated</th><th>Deposit ID</th><th>Coin</th><th>Skycoin address</th><th>Status</th><th>Error</th><th></th></tr>
+      </thead>
+      <tbody></tbody>
+    </table>
+  </section>
+
+  <section>
+    <h2>Recent deposits</h2>
+    <table id="recent">
+      <thead>
+        <tr><th>Updated</th><th>Deposit ID</th><th>Coin</th><th>Skycoin address</th><th>Status</th><th>Skycoin txid</th></tr>
+      </thead>
+      <tbody></tbody>
+    </table>
+  </section>
+</main>
+
+<script src="/dashboard.js"></script>
+</body>
+</html>
+`
+
+const dashboardCSS = `body {
+  margin: 0;
+  font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif;
+  font-size: 14px;
+  color: #1d2633;
+  background: #f4f6f9;
+}
+
+header {
+  display: flex;
+  align-items: baseline;
+  justify-content: space-between;
+  padding: 12px 24px;
+  color: #fff;
+  background: #0072ff;
+}
+
+header h1 {
+  margin: 0;
+  font-size: 20px;
+}
+
+main {
+  padding: 0 24px 24px;
+}
+
+h2 {
+  margin: 24px 0 12px;
+  font-size: 16px;
+}
+
+.cards {
+  display: flex;
+  flex-wrap: wrap;
+  gap: 12px;
+}
+
+.card {
+  min-width: 140px;
+  padding: 12px 16px;
+  background: #fff;
+  border-radius: 4px;
+  box-shadow: 0 1px 2px rgba(0, 0, 0, 0.1);
+}
+
+.card .label {
+  color: #6b7785;
+  font-size: 12px;
+}
+
+.card .value {
+  margin-top: 4px;
+  font-size: 20px;
+}
+
+.card.warn {
+  border-left: 4px solid #e0452b;
+}
+
+table {
+  width: 100%;
+  border-collapse: collapse;
+  background: #fff;
+}
+
+th, td {
+  padding: 6px 8px;
+  text-align: left;
+  border-bottom: 1px solid #e3e7ec;
+  white-space: nowrap;
+}
+
+td.wrap {
+  white-space: normal;
+}
+
+.mono {
+  font-family: Menlo, Consolas, monospace;
+  font-size: 12px;
+}
+
+.error {
+  color: #e0452b;
+}
+
+button {
+  padding: 4px 10px;
+  cursor: pointer;
+}
+`
+
+const dashboardJS = `(function () {
+  'use strict';
+
+  var refreshPeriod = 10000;
+  var recentCount = 20;
+
+  function get(path) {
+    return fetch(path, {credentials: 'same-origin'}).then(function (rsp) {
+      if (rsp.status === 404) {
+        return null;
+      }
+      if (!rsp.ok) {
+        throw new Error(path + ': ' + rsp.status + ' ' + rsp.statusText);
+      }
+      return rsp.json();
+    });
+  }
+
+  function post(path, form) {
+    return fetch(path, {
+      method: 'POST',
+      credentials: 'same-origin',
+      headers: {
+        'Content-Type': 'application/x-www-form-urlencoded',
+        'X-Requested-With': 'XMLHttpRequest'
+      },
+      body: new URLSearchParams(form).toString()
+    }).then(function (rsp) {
+      return rsp.text().then(function (text) {
+        if (!rsp.ok) {
+          throw new Error(text || rsp.statusText);
+        }
+        return text;
+      });
+    });
+  }
+
+  function el(tag, text, className) {
+    var e = document.createElement(tag);
+    if (text !== undefined && text !== null) {
+      e.textContent = text;
+    }
+    if (className) {
+      e.className = className;
+    }
+    return e;
+  }
+
+  function card(label, value, warn) {
+    var c = el('div', null, warn ? 'card warn' : 'card');
+    c.appendChild(el('div', label, 'label'));
+    c.appendChild(el('div', value, 'value'));
+    return c;
+  }
+
+  function replace(id, children) {
+    var e = document.getElementById(id);
+    while (e.firstChild) {
+      e.removeChild(e.firstChild);
+    }
+    children.forEach(function (c) {
+      e.appendChild(c);
+    });
+  }
+
+  function fill(id, rows) {
+    var body = document.getElementById(id).tBodies[0];
+    while (body.firstChild) {
+      body.removeChild(body.firstChild);
+    }
+    rows.forEach(function (r) {
+      body.appendChild(r);
+    });
+  }
+
+  function row(cells) {
+    var tr = el('tr');
+    cells.forEach(function (c) {
+      if (c instanceof Node) {
+        var td = el('td');
+        td.appendChild(c);
+        tr.appendChild(td);
+      } else {
+        tr.appendChild(el('td', c));
+      }
+    });
+    return tr;
+  }
+
+  function sky(droplets) {
+    return (droplets / 1e6).toFixed(6).replace(/\.?0+$/, '');
+  }
+
+  function btc(satoshis) {
+    return (satoshis / 1e8).toFixed(8).replace(/\.?0+$/, '');
+  }
+
+  function duration(seconds) {
+    if (!seconds) {
+      return '-';
+    }
+    if (seconds < 120) {
+      return Math.round(seconds) + 's';
+    }
+    if (seconds < 7200) {
+      return Math.round(seconds / 60) + 'm';
+    }
+    return (seconds / 3600).toFixed(1) + 'h';
+  }
+
+  function time(unix) {
+    if (!unix) {
+      return '-';
+    }
+    return new Date(unix * 1000).toISOString().replace('T', ' ').replace(/\.\d+Z$/, 'Z');
+  }
+
+  function renderSeries(s) {
+    var t = s.totals;
+    replace('totals', [
+      card('Binds', t.binds),
+      card('Deposits detected', t.deposits_detected),
+      card('Deposits sent', t.deposits_sent),
+      card('SKY sent', sky(t.sky_sent)),
+      card('Pending confirmations', t.pending_confirmations),
+      card('Avg send latency', duration(t.avg_send_latency)),
+      card('Processing time p50', duration(t.processing_time.p50)),
+      card('Processing time p95', duration(t.processing_time.p95)),
+      card('Processing time p99', duration(t.processing_time.p99)),
+      card('Errors', t.errors, t.errors > 0)
+    ]);
+
+    // Newest first
+    fill('series', s.series.slice().reverse().map(function (b) {
+      return row([
+        time(b.time), b.binds, b.deposits_detected, b.deposits_sent, sky(b.sky_sent),
+        b.pending_confirmations, duration(b.avg_send_latency), b.errors
+      ]);
+    }));
+  }
+
+  function renderStats(s) {
+    replace('alltime', [
+      card('BTC received', btc(s.total_btc_received)),
+      card('SKY sent', sky(s.total_sky_sent))
+    ]);
+  }
+
+  function renderBalance(b) {
+    if (!b) {
+      replace('balance', [el('p', 'Hot wallet balance monitoring is disabled')]);
+      return;
+    }
+
+    var cards = [
+      card('SKY', sky(b.coins), b.low),
+      card('Coin hours', b.hours),
+      card('Low balance', sky(b.low_balance)),
+      card('Checked', time(b.checked_at))
+    ];
+    if (b.paused) {
+      cards.push(card('Payouts', 'paused', true));
+    }
+    if (b.error) {
+      cards.push(card('Check error', b.error, true));
+    }
+    replace('balance', cards);
+  }
+
+  function renderPools(p) {
+    if (!p) {
+      replace('pools', [el('p', 'Not available')]);
+      return;
+    }
+
+    var coinTypes = Object.keys(p.remaining).sort();
+    replace('pools', coinTypes.map(function (ct) {
+      var n = p.remaining[ct];
+      return card(ct, n, n === 0);
+    }));
+  }
+
+  function reprocess(d) {
+    var reason = window.prompt('Reprocess ' + d.deposit_id + '?\nReason:');
+    if (reason === null) {
+      return;
+    }
+
+    post('/api/reprocess', {deposit_id: d.deposit_id, reason: reason}).then(function () {
+      document.getElementById('reprocess-result').textContent = 'Reprocessed ' + d.deposit_id;
+      refresh();
+    }).catch(function (err) {
+      document.getElementById('reprocess-result').textContent = 'Reprocess ' + d.deposit_id + ' failed: ' + err.message;
+    });
+  }
+
+  function renderDeposits(deposits) {
+    deposits.sort(function (a, b) {
+      return b.updated_at - a.updated_at;
+    });
+
+    var errored = deposits.filter(function (d) {
+      return d.error;
+    }).map(function (d) {
+      var button = el('button', 'Reprocess');
+      button.addEventListener('click', function () {
+        reprocess(d);
+      });
+
+      var tr = row([time(d.updated_at), el('span', d.deposit_id, 'mono'), d.coin_type,
+        el('span', d.skycoin_address, 'mono'), d.status, el('span', d.error, 'error'), button]);
+      tr.children[5].className = 'wrap';
+      return tr;
+    });
+    if (errored.length === 0) {
+      errored = [row(['None'])];
+    }
+
+    var recent = deposits.slice(0, recentCount).map(function (d) {
+      return row([time(d.updated_at), el('span', d.deposit_id, 'mono'), d.coin_type,
+        el('span', d.skycoin_address, 'mono'), d.status, el('span', d.txid || '-', 'mono')]);
+    });
+
+    fill('errored', errored);
+    fill('recent', recent);
+  }
+
+  function refresh() {
+    Promise.all([
+      get('/api/stats/series?interval=hour'),
+      get('/api/stats'),
+      get('/api/balance'),
+      get('/api/addresses'),
+      get('/api/deposit_status')
+    ]).then(function (r) {
+      if (r[0]) {
+        renderSeries(r[0]);
+      }
+      renderStats(r[1]);
+      renderBalance(r[2]);
+      renderPools(r[3]);
+      renderDeposits(r[4] || []);
+      document.getElementById('updated').textContent = 'Updated ' + time(Math.floor(Date.now() / 1000));
+    }).catch(function (err) {
+      document.getElementById('updated').textContent = 'Update failed: ' + err.message;
+    });
+  }
+
+  refresh();
+  window.setInterval(refresh, refreshPeriod);
+})();
+`
@@ -0,0 +1,233 @@
+// Package dashboard serves a web admin dashboard on top of the admin API
+package dashboard
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/skycoin/teller/src/rbac"
+	"github.com/skycoin/teller/src/util/httputil"
+	"github.com/skycoin/teller/src/util/listenutil"
+	"github.com/skycoin/teller/src/util/logger"
+)
+
+const (
+	shutdownTimeout = time.Second * 5
+
+	serverReadTimeout  = time.Second * 10
+	serverWriteTimeout = time.Second * 60
+	serverIdleTimeout  = time.Second * 120
+
+	realm = "teller admin"
+
+	// requestedWithHeader must be set on POST requests to the admin API. Browsers only send custom headers
+	// cross-origin after a CORS preflight, which the dashboard never allows, so forms of other sites
+	// can't make admin requests with the cached credentials.
+	requestedWithHeader = "X-Requested-With"
+)
+
+// apiRoutes are the admin API endpoints the dashboard serves, with the methods allowed.
+// The rest of the admin API is only served on the admin listener.
+var apiRoutes = map[string]string{
+	"/api/stats":          http.MethodGet,
+	"/api/stats/series":   http.MethodGet,
+	"/api/deposit_status": http.MethodGet,
+	"/api/addresses":      http.MethodGet,
+	"/api/balance":        http.MethodGet,
+	"/api/reprocess":      http.MethodPost,
+}
+
+// Config configures the Dashboard
+type Config struct {
+	Addr string
+	// Credentials of the HTTP basic auth
+	Username string
+	Password string
+}
+
+// Dashboard serves the web admin dashboard on its own listener, behind HTTP basic auth: live stats,
+// recent deposits, errored deposits that can be reprocessed, deposit address pool levels
+// and the hot wallet balance. The page is built on the admin API, which the dashboard serves a subset of.
+type Dashboard struct {
+	log  logrus.FieldLogger
+	cfg  Config
+	api  http.Handler
+	ln   *http.Server
+	quit chan struct{}
+}
+
+// New creates a Dashboard serving the admin API of api
+func New(log logrus.FieldLogger, cfg Config, api http.Handler) (*Dashboard, error) {
+	if cfg.Username == "" || cfg.Password == "" {
+		return nil, errors.New("dashboard username and password are required")
+	}
+
+	return &Dashboard{
+		log:  log.WithField("prefix", "teller.dashboard"),
+		cfg:  cfg,
+		api:  api,
+		quit: make(chan struct{}),
+	}, nil
+}
+
+// Run serves the dashboard
+func (d *Dashboard) Run() error {
+	log := d.log.WithField("addr", d.cfg.Addr)
+	log.Info("Start admin dashboard...")
+	defer log.Info("Admin dashboard closed")
+
+	d.ln = &http.Server{
+		Addr:         d.cfg.Addr,
+		Handler:      d.setupMux(),
+		ReadTimeout:  serverReadTimeout,
+		WriteTimeout: serverWriteTimeout,
+		IdleTimeout:  serverIdleTimeout,
+	}
+
+	ln, err := listenutil.Listen(d.cfg.Addr, 0600)
+	if err != nil {
+		return err
+	}
+
+	if err := d.ln.Serve(ln); err != nil {
+		select {
+		case <-d.quit:
+			return nil
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Shutdown stops the dashboard
+func (d *Dashboard) Shutdown() {
+	log := d.log.WithField("timeout", shutdownTimeout)
+	defer log.Info("Shutdown admin dashboard")
+
+	close(d.quit)
+	if d.ln != nil {
+		log.Info("Shutting down admin dashboard")
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := d.ln.Shutdown(ctx); err != nil {
+			log.WithError(err).Error("Admin dashboard shutdown failed")
+		}
+	}
+}
+
+func (d *Dashboard) setupMux() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.Handle("/", httputil.LogHandler(d.log, assetHandler("/", "text/html; charset=utf-8", indexHTML)))
+	mux.Handle("/dashboard.js", httputil.LogHandler(d.log, assetHandler("/dashboard.js", "application/javascript", dashboardJS)))
+	mux.Handle("/dashboard.css", httputil.LogHandler(d.log, assetHandler("/dashboard.css", "text/css", dashboardCSS)))
+
+	// The admin API logs its requests itself
+	for path, method := range apiRoutes {
+		mux.Handle(path, d.apiHandler(method))
+	}
+
+	return d.authHandler(securityHeaders(mux))
+}
+
+// assetHandler serves a file of the dashboard at path
+func assetHandler(path, contentType, content string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", http.MethodGet)
+			httputil.ErrResponse(w, http.StatusMethodNotAllowed)
+			return
+		}
+
+		// The mux routes unknown paths to "/"
+		if r.URL.Path != path {
+			httputil.ErrResponse(w, http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", contentType)
+		w.Write([]byte(content)) // nolint: errcheck
+	})
+}
+
+// apiHandler serves an admin API endpoint with method
+func (d *Dashboard) apiHandler(method string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			httputil.ErrResponse(w, http.StatusMethodNotAllowed)
+			return
+		}
+
+		user, _, _ := r.BasicAuth()
+
+		if method == http.MethodPost {
+			if r.Header.Get(requestedWithHeader) == "" {
+				httputil.ErrResponse(w, http.StatusForbidden, "missing "+requestedWithHeader+" header")
+				return
+			}
+
+			logger.Audit(d.log).WithFields(logrus.Fields{
+				"user":       user,
+				"remoteAddr": r.RemoteAddr,
+				"url":        r.URL.String(),
+			}).Info("Admin dashboard action")
+		}
+
+		// The admin API logs the actions with the principal. The dashboard's routes need no more than an operator.
+		r = r.WithContext(rbac.WithPrincipal(r.Context(), rbac.Principal{
+			Name: "dashboard:" + user,
+			Role: rbac.RoleOperator,
+		}))
+
+		w.Header().Set("Cache-Control", "no-store")
+		d.api.ServeHTTP(w, r)
+	})
+}
+
+// authHandler requires the HTTP basic auth credentials of the config
+func (d *Dashboard) authHandler(hd http.Handler) http.Handler {
+	// Hashes are compared so that the comparison time doesn't depend on the length of the credentials
+	username := sha256.Sum256([]byte(d.cfg.Username))
+	password := sha256.Sum256([]byte(d.cfg.Password))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if ok {
+			u := sha256.Sum256([]byte(user))
+			p := sha256.Sum256([]byte(pass))
+			userOK := subtle.ConstantTimeCompare(u[:], username[:]) == 1
+			passOK := subtle.ConstantTimeCompare(p[:], password[:]) == 1
+			if userOK && passOK {
+				hd.ServeHTTP(w, r)
+				return
+			}
+
+			d.log.WithFields(logrus.Fields{
+				"user":       user,
+				"remoteAddr": r.RemoteAddr,
+			}).Warning("Admin dashboard login failed")
+		}
+
+		w.Header().Set("WWW-Authenticate", `Basic realm="`+realm+`", charset="UTF-8"`)
+		httputil.ErrResponse(w, http.StatusUnauthorized)
+	})
+}
+
+// securityHeaders keeps the dashboard from being framed, and from loading anything but its own assets
+func securityHeaders(hd http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Security-Policy", "default-src 'self'; frame-ancestors 'none'")
+		w.Header().Set("X-Frame-Options", "DENY")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Referrer-Policy", "no-referrer")
+		hd.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,116 @@
+package dashboard
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+func TestDashboard(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+
+	_, err := New(log, Config{Username: "admin"}, http.NotFoundHandler())
+	require.Error(t, err)
+
+	var apiRequests []string
+	api := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apiRequests = append(apiRequests, r.Method+" "+r.URL.Path)
+		w.Write([]byte(`{}`)) // nolint: errcheck
+	})
+
+	d, err := New(log, Config{
+		Username: "admin",
+		Password: "secret",
+	}, api)
+	require.NoError(t, err)
+
+	srv := httptest.NewServer(d.setupMux())
+	defer srv.Close()
+
+	do := func(method, path, user, pass string, hdr http.Header) *http.Response {
+		var body *strings.Reader
+		if method == http.MethodPost {
+			body = strings.NewReader(url.Values{"deposit_id": {"tx:0"}}.Encode())
+		} else {
+			body = strings.NewReader("")
+		}
+
+		req, err := http.NewRequest(method, srv.URL+path, body)
+		require.NoError(t, err)
+		if user != "" {
+			req.SetBasicAuth(user, pass)
+		}
+		if method == http.MethodPost {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		for k, v := range hdr {
+			req.Header[k] = v
+		}
+
+		rsp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		rsp.Body.Close()
+		return rsp
+	}
+
+	// Everything requires the credentials
+	for _, path := range []string{"/", "/dashboard.js", "/api/stats", "/api/api_keys"} {
+		rsp := do(http.MethodGet, path, "", "", nil)
+		require.Equal(t, http.StatusUnauthorized, rsp.StatusCode, path)
+		require.Equal(t, `Basic realm="teller admin", charset="UTF-8"`, rsp.Header.Get("WWW-Authenticate"))
+
+		rsp = do(http.MethodGet, path, "admin", "wrong", nil)
+		require.Equal(t, http.StatusUnauthorized, rsp.StatusCode, path)
+
+		rsp = do(http.MethodGet, path, "wrong", "secret", nil)
+		require.Equal(t, http.StatusUnauthorized, rsp.StatusCode, path)
+	}
+	require.Empty(t, apiRequests)
+
+	for path, contentType := range map[string]string{
+		"/":              "text/html; charset=utf-8",
+		"/dashboard.js":  "application/javascript",
+		"/dashboard.css": "text/css",
+	} {
+		rsp := do(http.MethodGet, path, "admin", "secret", nil)
+		require.Equal(t, http.StatusOK, rsp.StatusCode, path)
+		require.Equal(t, contentType, rsp.Header.Get("Content-Type"))
+		require.Equal(t, "DENY", rsp.Header.Get("X-Frame-Options"))
+		require.NotEmpty(t, rsp.Header.Get("Content-Security-Policy"))
+	}
+
+	rsp := do(http.MethodGet, "/index.php", "admin", "secret", nil)
+	require.Equal(t, http.StatusNotFound, rsp.StatusCode)
+
+	// Only the admin API endpoints of the dashboard are served, with their methods
+	rsp = do(http.MethodGet, "/api/api_keys", "admin", "secret", nil)
+	require.Equal(t, http.StatusNotFound, rsp.StatusCode)
+
+	rsp = do(http.MethodPost, "/api/addresses", "admin", "secret", http.Header{"X-Requested-With": {"XMLHttpRequest"}})
+	require.Equal(t, http.StatusMethodNotAllowed, rsp.StatusCode)
+
+	rsp = do(http.MethodGet, "/api/reprocess", "admin", "secret", nil)
+	require.Equal(t, http.StatusMethodNotAllowed, rsp.StatusCode)
+
+	require.Empty(t, apiRequests)
+
+	// POST requests must be made by the page's scripts
+	rsp = do(http.MethodPost, "/api/reprocess", "admin", "secret", nil)
+	require.Equal(t, http.StatusForbidden, rsp.StatusCode)
+	require.Empty(t, apiRequests)
+
+	rsp = do(http.MethodPost, "/api/reprocess", "admin", "secret", http.Header{"X-Requested-With": {"XMLHttpRequest"}})
+	require.Equal(t, http.StatusOK, rsp.StatusCode)
+	require.Equal(t, "no-store", rsp.Header.Get("Cache-Control"))
+
+	rsp = do(http.MethodGet, "/api/stats/series", "admin", "secret", nil)
+	require.Equal(t, http.StatusOK, rsp.StatusCode)
+
+	require.Equal(t, []string{"POST /api/reprocess", "GET /api/stats/series"}, apiRequests)
+}
@@ -0,0 +1,299 @@
+package exchange
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/skycoin/teller/src/scanner"
+	"github.com/skycoin/teller/src/util/dbcrypt"
+	"github.com/skycoin/teller/src/util/dbutil"
+)
+
+var (
+	// archived deposits, deposit ID as key, name of the archive the deposit was written to as value.
+	// A deposit seen again by the scanner, e.g. by a rescan, is not created again, so it can't be paid twice.
+	archivedDepositsBkt = []byte("archived_deposits")
+
+	// totals of the archived deposits, which the deposit stats and purchase limits still count.
+	// "all", "campaign/<campaign>" or "sky/<skycoin address>" as key, archivedTotals as value
+	archivedTotalsBkt = []byte("archived_totals")
+
+	// ErrDepositArchived is returned when creating a deposit that was archived
+	ErrDepositArchived = errors.New("Deposit was archived")
+)
+
+const archivedTotalsAllKey = "all"
+
+// ArchivedDeposit is a deposit removed from the db by ArchiveDeposits, with the events that created and changed it
+type ArchivedDeposit struct {
+	DepositInfo DepositInfo    `json:"deposit_info"`
+	Events      []DepositEvent `json:"events"`
+}
+
+// archivedTotals sums the archived deposits of a key of archivedTotalsBkt
+type archivedTotals struct {
+	BTCReceived int64 `json:"btc_received"`
+	SKYSent     int64 `json:"sky_sent"`
+	// SKY bought by the deposits that were sent, in droplets, counted by the purchase limits
+	SkyPurchased uint64 `json:"sky_purchased"`
+}
+
+// archivable returns true if a deposit was processed, so that it will not change anymore
+func archivable(di DepositInfo) bool {
+	switch di.Status {
+	case StatusDone, StatusRejected, StatusInvalidated, StatusIgnoredDust:
+		return true
+	default:
+		return false
+	}
+}
+
+// ArchiveDeposits removes the deposits that were processed, as StatusDone, StatusRejected, StatusInvalidated
+// or StatusIgnoredDust, and last changed before before, with their events, and returns them ordered by seq.
+// The removed deposits are passed to write first, to be saved in the archive named archive; nothing is removed
+// if write fails. An archive event is appended to the event log for each deposit, so that RebuildState
+// still knows that it was archived.
+func (s *Store) ArchiveDeposits(before time.Time, archive string, write func([]ArchivedDeposit) error) ([]ArchivedDeposit, error) {
+	var ads []ArchivedDeposit
+
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		// The buckets can't be changed while iterating them
+		if err := s.c.ForEach(tx, depositInfoBkt, func(k, v []byte) error {
+			var di DepositInfo
+			if err := json.Unmarshal(v, &di); err != nil {
+				return err
+			}
+
+			if archivable(di) && di.UpdatedAt < before.Unix() {
+				ads = append(ads, ArchivedDeposit{
+					DepositInfo: di,
+				})
+			}
+
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		if len(ads) == 0 {
+			return nil
+		}
+
+		sort.Slice(ads, func(i, j int) bool {
+			return ads[i].DepositInfo.Seq < ads[j].DepositInfo.Seq
+		})
+
+		// The index keys of a deposit are ordered by seq
+		indexKeys := make([][]string, len(ads))
+		for i := range ads {
+			if err := dbutil.ForEachPrefix(tx, depositEventsIndexBkt, ads[i].DepositInfo.DepositID+"/", func(k, v []byte) error {
+				var ev DepositEvent
+				if err := s.c.GetBucketObject(tx, depositEventsBkt, string(v), &ev); err != nil {
+					return err
+				}
+
+				ads[i].Events = append(ads[i].Events, ev)
+				indexKeys[i] = append(indexKeys[i], string(k))
+				return nil
+			}); err != nil {
+				return err
+			}
+		}
+
+		if err := write(ads); err != nil {
+			return err
+		}
+
+		for i, ad := range ads {
+			for j, ev := range ad.Events {
+				if err := dbutil.DeleteBucketKey(tx, depositEventsBkt, strconv.FormatUint(ev.Seq, 10)); err != nil {
+					return err
+				}
+
+				if err := dbutil.DeleteBucketKey(tx, depositEventsIndexBkt, indexKeys[i][j]); err != nil {
+					return err
+				}
+			}
+
+			if err := archiveDepositTx(tx, s.c, ad.DepositInfo, archive); err != nil {
+				return err
+			}
+
+			if err := appendArchiveEventTx(tx, s.c, ad.DepositInfo, archive); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return ads, nil
+}
+
+// archiveDepositTx removes a deposit and its indexes, if it exists, and records that it was archived in archive.
+// The deposit does not exist when replaying the archive event of an event log whose deposit events were archived.
+// The buckets are decrypted and encrypted with c.
+func archiveDepositTx(tx *bolt.Tx, c *dbcrypt.Cipher, di DepositInfo, archive string) error {
+	if hasKey, err := dbutil.BucketHasKey(tx, archivedDepositsBkt, di.DepositID); err != nil {
+		return err
+	} else if hasKey {
+		return ErrDepositArchived
+	}
+
+	var prev DepositInfo
+	if err := c.GetBucketObject(tx, depositInfoBkt, di.DepositID, &prev); err != nil {
+		switch err.(type) {
+		case dbutil.ObjectNotExistErr:
+		default:
+			return err
+		}
+	} else {
+		if err := deleteIndexKeyTx(tx, skyDepositsIndexBkt, indexKey(c.Hash(prev.SkyAddress), prev.DepositID)); err != nil {
+			return err
+		}
+
+		if err := deleteIndexKeyTx(tx, statusDepositsIndexBkt, indexKey(prev.Status.String(), prev.DepositID)); err != nil {
+			return err
+		}
+
+		if err := dbutil.DeleteBucketKey(tx, depositInfoBkt, di.DepositID); err != nil {
+			return err
+		}
+	}
+
+	var txs []string
+	if err := c.GetBucketObject(tx, btcTxsBkt, di.DepositAddress, &txs); err != nil {
+		switch err.(type) {
+		case dbutil.ObjectNotExistErr:
+		default:
+			return err
+		}
+	}
+
+	var remaining []string
+	for _, id := range txs {
+		if id != di.DepositID {
+			remaining = append(remaining, id)
+		}
+	}
+
+	if len(remaining) == 0 {
+		if err := dbutil.DeleteBucketKey(tx, btcTxsBkt, di.DepositAddress); err != nil {
+			return err
+		}
+	} else if err := c.PutBucketValue(tx, btcTxsBkt, di.DepositAddress, remaining); err != nil {
+		return err
+	}
+
+	if err := dbutil.PutBucketValue(tx, archivedDepositsBkt, di.DepositID, archive); err != nil {
+		return err
+	}
+
+	keys := []string{
+		archivedTotalsAllKey,
+		indexKey("sky", di.SkyAddress),
+	}
+	if di.Campaign != "" {
+		keys = append(keys, indexKey("campaign", di.Campaign))
+	}
+
+	for _, k := range keys {
+		t, err := getArchivedTotalsTx(tx, k)
+		if err != nil {
+			return err
+		}
+
+		t.add(di)
+
+		if err := dbutil.PutBucketValue(tx, archivedTotalsBkt, k, t); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// add adds an archived deposit to the totals, counted like depositStats and Exchange.skyPurchased count it
+func (t *archivedTotals) add(di DepositInfo) {
+	if di.CoinType == scanner.CoinTypeBTC {
+		t.BTCReceived += di.DepositValue
+	}
+	t.SKYSent += int64(di.SkySent)
+
+	// Skipped deposits sent nothing. The SKY bought by deposits saved before SkyGross was recorded
+	// is not known without the rate config, their SKY sent is counted instead.
+	if di.Status == StatusDone && di.Txid != "" {
+		if di.SkyGross != 0 {
+			t.SkyPurchased += di.SkyGross
+		} else {
+			t.SkyPurchased += di.SkySent
+		}
+	}
+}
+
+func getArchivedTotalsTx(tx *bolt.Tx, key string) (archivedTotals, error) {
+	var t archivedTotals
+	if err := dbutil.GetBucketObject(tx, archivedTotalsBkt, key, &t); err != nil {
+		switch err.(type) {
+		case dbutil.ObjectNotExistErr:
+		default:
+			return archivedTotals{}, err
+		}
+	}
+
+	return t, nil
+}
+
+func (s *Store) getArchivedTotals(key string) (archivedTotals, error) {
+	var t archivedTotals
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		t, err = getArchivedTotalsTx(tx, key)
+		return err
+	}); err != nil {
+		return archivedTotals{}, err
+	}
+
+	return t, nil
+}
+
+// GetArchivedSkyPurchased returns the SKY bought by the archived deposits of a skycoin address that were sent, in droplets
+func (s *Store) GetArchivedSkyPurchased(skyAddr string) (uint64, error) {
+	t, err := s.getArchivedTotals(indexKey("sky", skyAddr))
+	if err != nil {
+		return 0, err
+	}
+
+	return t.SkyPurchased, nil
+}
+
+// GetDepositArchive returns the name of the archive a deposit was written to.
+// Returns ErrDepositNotFound if the deposit was not archived.
+func (s *Store) GetDepositArchive(depositID string) (string, error) {
+	var archive string
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		archive, err = dbutil.GetBucketString(tx, archivedDepositsBkt, depositID)
+		return err
+	}); err != nil {
+		switch err.(type) {
+		case dbutil.ObjectNotExistErr:
+			return "", ErrDepositNotFound
+		default:
+			return "", err
+		}
+	}
+
+	return archive, nil
+}
+
+func isArchivedTx(tx *bolt.Tx, depositID string) (bool, error) {
+	return dbutil.BucketHasKey(tx, archivedDepositsBkt, depositID)
+}
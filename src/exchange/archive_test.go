@@ -0,0 +1,120 @@
+package exchange
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/scanner"
+	"github.com/skycoin/teller/src/util/dbutil"
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+func TestStoreArchiveDeposits(t *testing.T) {
+	s, shutdown := newTestStore(t)
+	defer shutdown()
+
+	populateTestStore(t, s)
+
+	btcReceived, skySent, err := s.GetDepositStats()
+	require.NoError(t, err)
+
+	// Nothing is removed if the archive can't be written
+	writeErr := errors.New("disk full")
+	_, err = s.ArchiveDeposits(time.Now().Add(time.Hour), "archive-1", func([]ArchivedDeposit) error {
+		return writeErr
+	})
+	require.Equal(t, writeErr, err)
+
+	_, err = s.getDepositInfo("btx1:1")
+	require.NoError(t, err)
+
+	// Deposits processed after before are not archived
+	ads, err := s.ArchiveDeposits(time.Now().Add(-time.Hour), "archive-1", func([]ArchivedDeposit) error {
+		t.Fatal("nothing to write")
+		return nil
+	})
+	require.NoError(t, err)
+	require.Empty(t, ads)
+
+	// Only the processed deposit is archived, with its events
+	var written []ArchivedDeposit
+	ads, err = s.ArchiveDeposits(time.Now().Add(time.Hour), "archive-1", func(ads []ArchivedDeposit) error {
+		written = ads
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, written, ads)
+	require.Len(t, ads, 1)
+	require.Equal(t, "btx1:1", ads[0].DepositInfo.DepositID)
+	require.Equal(t, StatusDone, ads[0].DepositInfo.Status)
+	require.Len(t, ads[0].Events, 3)
+
+	_, err = s.getDepositInfo("btx1:1")
+	require.IsType(t, dbutil.ObjectNotExistErr{}, err)
+
+	_, _, err = s.GetDepositHistory("btx1:1")
+	require.Equal(t, ErrDepositNotFound, err)
+
+	archive, err := s.GetDepositArchive("btx1:1")
+	require.NoError(t, err)
+	require.Equal(t, "archive-1", archive)
+
+	_, err = s.GetDepositArchive("btx2:0")
+	require.Equal(t, ErrDepositNotFound, err)
+
+	// The other deposit of the address is still found
+	dis, err := s.GetDepositInfoOfSkyAddress("skyaddr1")
+	require.NoError(t, err)
+	require.Len(t, dis, 2)
+	for _, di := range dis {
+		require.NotEqual(t, "btx1:1", di.DepositID)
+	}
+
+	dis, err = s.QueryDepositInfos(DepositQuery{
+		Statuses: []Status{StatusDone},
+	})
+	require.NoError(t, err)
+	require.Empty(t, dis)
+
+	// The stats and purchases still count the archived deposit
+	btcReceived2, skySent2, err := s.GetDepositStats()
+	require.NoError(t, err)
+	require.Equal(t, btcReceived, btcReceived2)
+	require.Equal(t, skySent, skySent2)
+
+	purchased, err := s.GetArchivedSkyPurchased("skyaddr1")
+	require.NoError(t, err)
+	require.Equal(t, uint64(100e6), purchased)
+
+	// The deposit is not created again when the scanner sees it again
+	_, err = s.GetOrCreateDepositInfo(scanner.Deposit{
+		CoinType: scanner.CoinTypeBTC,
+		Address:  "btcaddr1",
+		Value:    1e6,
+		Height:   20,
+		Tx:       "btx1",
+		N:        1,
+	}, testSkyBtcRate, 1)
+	require.Equal(t, ErrDepositArchived, err)
+
+	// The archive event replaces the deposit's events in the log, the state can still be rebuilt
+	evs, err := s.GetDepositEvents()
+	require.NoError(t, err)
+	require.Len(t, evs, 6)
+	last := evs[len(evs)-1]
+	require.Equal(t, EventArchive, last.Type)
+	require.Equal(t, "archive-1", last.Reason)
+	require.Equal(t, "btx1:1", last.DepositInfo.DepositID)
+
+	db, shutdown2 := testutil.PrepareDB(t)
+	defer shutdown2()
+
+	require.NoError(t, RebuildState(db, nil, evs))
+
+	diffs, err := CompareState(s.db, db, nil)
+	require.NoError(t, err)
+	require.Empty(t, diffs)
+}
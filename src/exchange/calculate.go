@@ -60,3 +60,65 @@ func ParseRate(rate string) (decimal.Decimal, error) {
 
 	return r, nil
 }
+
+// Fee is the commission deducted from the SKY bought by a deposit
+type Fee struct {
+	// Percentage of the SKY bought. Decimal string, empty means 0
+	Percent string
+	// Fixed fee per deposit, in droplets
+	FixedDroplets uint64
+}
+
+// Validate returns an error if the fee is invalid
+func (f Fee) Validate() error {
+	p, err := f.percent()
+	if err != nil {
+		return err
+	}
+
+	if p.Sign() < 0 {
+		return errors.New("fee percent can't be negative")
+	}
+
+	if p.GreaterThanOrEqual(decimal.New(100, 0)) {
+		return errors.New("fee percent must be less than 100")
+	}
+
+	return nil
+}
+
+func (f Fee) percent() (decimal.Decimal, error) {
+	if f.Percent == "" {
+		return decimal.Zero, nil
+	}
+
+	return mathutil.DecimalFromString(f.Percent)
+}
+
+// Apply deducts the fee from gross droplets, and returns the droplets to send.
+// The net amount is truncated to maxDecimals, so the truncated remainder is added to the fee.
+// If the fee is larger than the gross amount, 0 is returned.
+func (f Fee) Apply(gross uint64, maxDecimals int) (uint64, error) {
+	if maxDecimals < 0 {
+		return 0, errors.New("maxDecimals can't be negative")
+	}
+
+	p, err := f.percent()
+	if err != nil {
+		return 0, err
+	}
+
+	g := decimal.New(int64(gross), 0)
+	fee := g.Mul(p).Div(decimal.New(100, 0))
+	fee = fee.Add(decimal.New(int64(f.FixedDroplets), 0))
+
+	if fee.GreaterThanOrEqual(g) {
+		return 0, nil
+	}
+
+	// Truncate the net amount in SKY, like CalculateBtcSkyValue
+	skyToDroplets := decimal.New(droplet.Multiplier, 0)
+	sky := g.Sub(fee).Div(skyToDroplets).Truncate(int32(maxDecimals))
+
+	return uint64(sky.Mul(skyToDroplets).IntPart()), nil
+}
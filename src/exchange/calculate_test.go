@@ -275,3 +275,93 @@ func TestCalculateSkyValue(t *testing.T) {
 		})
 	}
 }
+
+func TestFeeApply(t *testing.T) {
+	cases := []struct {
+		fee         Fee
+		gross       uint64
+		maxDecimals int
+		result      uint64
+		err         error
+	}{
+		{
+			fee:         Fee{},
+			gross:       100e6,
+			maxDecimals: 0,
+			result:      100e6,
+		},
+
+		{
+			fee:         Fee{Percent: "1.5"},
+			gross:       100e6,
+			maxDecimals: 3,
+			result:      985e5, // 98.5 SKY
+		},
+
+		{
+			// The truncated remainder goes to the fee
+			fee:         Fee{Percent: "1.5"},
+			gross:       100e6,
+			maxDecimals: 0,
+			result:      98e6,
+		},
+
+		{
+			fee:         Fee{FixedDroplets: 5e5},
+			gross:       100e6,
+			maxDecimals: 1,
+			result:      995e5, // 99.5 SKY
+		},
+
+		{
+			fee:         Fee{Percent: "10", FixedDroplets: 1e6},
+			gross:       20e6,
+			maxDecimals: 6,
+			result:      17e6,
+		},
+
+		{
+			fee:         Fee{Percent: "1/3"},
+			gross:       3e6,
+			maxDecimals: 6,
+			result:      2990000,
+		},
+
+		{
+			// The fee is larger than the gross amount
+			fee:         Fee{FixedDroplets: 2e6},
+			gross:       1e6,
+			maxDecimals: 0,
+			result:      0,
+		},
+
+		{
+			fee:         Fee{Percent: "x"},
+			gross:       1e6,
+			maxDecimals: 0,
+			err:         errors.New("can't convert x to decimal"),
+		},
+	}
+
+	for _, tc := range cases {
+		name := fmt.Sprintf("fee=%+v gross=%d maxDecimals=%d", tc.fee, tc.gross, tc.maxDecimals)
+		t.Run(name, func(t *testing.T) {
+			result, err := tc.fee.Apply(tc.gross, tc.maxDecimals)
+			if tc.err == nil {
+				require.NoError(t, err)
+				require.Equal(t, tc.result, result, "%d != %d", tc.result, result)
+			} else {
+				require.Error(t, err)
+				require.Equal(t, uint64(0), result, "%d != 0", result)
+			}
+		})
+	}
+}
+
+func TestFeeValidate(t *testing.T) {
+	require.NoError(t, Fee{}.Validate())
+	require.NoError(t, Fee{Percent: "2.5", FixedDroplets: 1e6}.Validate())
+	require.Error(t, Fee{Percent: "-1"}.Validate())
+	require.Error(t, Fee{Percent: "100"}.Validate())
+	require.Error(t, Fee{Percent: "abc"}.Validate())
+}
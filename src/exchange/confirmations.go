@@ -0,0 +1,97 @@
+package exchange
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// depositConfirmationsCheckPeriod is how often the deposits held for the confirmations of their tiers are checked
+const depositConfirmationsCheckPeriod = time.Second * 30
+
+// ConfirmationTier requires more confirmations for larger deposits
+type ConfirmationTier struct {
+	// Deposits of at least MinValue, in the smallest unit of the coin, e.g. satoshis.
+	// ERC20 token values are normalized to 8 decimals.
+	MinValue int64
+	// Confirmations the deposits need before skycoins are sent for them
+	Confirmations int64
+}
+
+// confirmationsRequired returns the confirmations a deposit of value needs before skycoins are sent for it:
+// the confirmations the scanner of its coin type requires, or the most of the confirmation tiers the value reaches
+func (s *Exchange) confirmationsRequired(coinType string, value int64) int64 {
+	n := s.cfg.ConfirmationsRequired[coinType]
+	for _, t := range s.cfg.ConfirmationTiers[coinType] {
+		if value >= t.MinValue && t.Confirmations > n {
+			n = t.Confirmations
+		}
+	}
+
+	return n
+}
+
+// waitsForConfirmations returns true if a deposit has fewer confirmations than its confirmation tier requires.
+// The scanner received the deposit with the confirmations it requires, and without a BestHeighter
+// the confirmations of a deposit are unknown, so such deposits never wait.
+func (s *Exchange) waitsForConfirmations(di DepositInfo) bool {
+	if di.ConfirmationsRequired <= s.cfg.ConfirmationsRequired[di.CoinType] {
+		return false
+	}
+
+	if _, ok := s.heighters[di.CoinType]; !ok {
+		return false
+	}
+
+	return s.confirmations(di) < di.ConfirmationsRequired
+}
+
+// waitForConfirmations sets a deposit to StatusWaitDepositConfirmations, until releaseConfirmedDeposits releases it
+func (s *Exchange) waitForConfirmations(di DepositInfo) (DepositInfo, error) {
+	updated, err := s.store.UpdateDepositInfo(di.DepositID, func(di DepositInfo) DepositInfo {
+		di.Status = StatusWaitDepositConfirmations
+		return di
+	})
+	if err != nil {
+		s.log.WithError(err).WithField("depositID", di.DepositID).Error("Update DepositInfo set StatusWaitDepositConfirmations failed")
+		return DepositInfo{}, err
+	}
+
+	return updated, nil
+}
+
+// releaseConfirmedDeposits sets the StatusWaitDepositConfirmations deposits that have the confirmations
+// of their tiers to StatusWaitSend, and queues them to be sent
+func (s *Exchange) releaseConfirmedDeposits() error {
+	dis, err := s.store.QueryDepositInfos(DepositQuery{
+		Statuses: []Status{StatusWaitDepositConfirmations},
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, di := range dis {
+		if s.waitsForConfirmations(di) {
+			continue
+		}
+
+		log := s.log.WithFields(logrus.Fields{
+			"depositID":             di.DepositID,
+			"confirmationsRequired": di.ConfirmationsRequired,
+		})
+
+		updated, err := s.store.UpdateDepositInfo(di.DepositID, func(di DepositInfo) DepositInfo {
+			di.Status = StatusWaitSend
+			return di
+		})
+		if err != nil {
+			log.WithError(err).Error("Update DepositInfo set StatusWaitSend failed")
+			continue
+		}
+
+		log.Info("Deposit has the confirmations of its confirmation tier, releasing it")
+		s.enqueue(updated)
+	}
+
+	return nil
+}
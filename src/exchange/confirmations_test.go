@@ -0,0 +1,113 @@
+package exchange
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/scanner"
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+func TestExchangeConfirmationTiers(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	log, _ := testutil.NewLogger(t)
+	store, err := NewStore(log, db, nil)
+	require.NoError(t, err)
+
+	e, err := NewExchange(log, store, newDummyScanner(), newDummySender(), Config{
+		Rate: "100",
+		ConfirmationsRequired: map[string]int64{
+			scanner.CoinTypeBTC: 1,
+		},
+		ConfirmationTiers: map[string][]ConfirmationTier{
+			scanner.CoinTypeBTC: {
+				{MinValue: 5e8, Confirmations: 6},
+				{MinValue: 1e8, Confirmations: 3},
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	e.SetBestHeighter(scanner.CoinTypeBTC, testBestHeighter(100))
+
+	require.NoError(t, store.BindAddress(testSkyAddr, "tieraddr", "", "", "", 0, 0))
+
+	save := func(tx string, value int64) DepositInfo {
+		di, err := e.saveIncomingDeposit(scanner.Deposit{
+			CoinType: scanner.CoinTypeBTC,
+			Address:  "tieraddr",
+			Value:    value,
+			Height:   99,
+			Tx:       tx,
+			N:        1,
+		})
+		require.NoError(t, err)
+		return di
+	}
+
+	// A deposit below the tiers only needs the confirmations of the scanner
+	small := save("smalltx", 1e6)
+	require.Equal(t, StatusWaitSend, small.Status)
+	require.Equal(t, int64(1), small.ConfirmationsRequired)
+
+	// Larger deposits need the most confirmations of the tiers they reach
+	medium := save("mediumtx", 2e8)
+	require.Equal(t, StatusWaitDepositConfirmations, medium.Status)
+	require.Equal(t, int64(3), medium.ConfirmationsRequired)
+	require.True(t, medium.held())
+
+	large := save("largetx", 5e8)
+	require.Equal(t, StatusWaitDepositConfirmations, large.Status)
+	require.Equal(t, int64(6), large.ConfirmationsRequired)
+
+	dss, err := e.GetDepositStatuses(testSkyAddr, false)
+	require.NoError(t, err)
+	require.Len(t, dss, 3)
+	for _, ds := range dss {
+		if ds.DepositTxid == "largetx" {
+			require.Equal(t, "waiting_deposit_confirmations", ds.Status)
+			require.Equal(t, int64(1), ds.Confirmations)
+			require.Equal(t, int64(6), ds.ConfirmationsRequired)
+		}
+	}
+
+	// Deposits are released once they have the confirmations of their tiers
+	e.SetBestHeighter(scanner.CoinTypeBTC, testBestHeighter(102))
+	require.NoError(t, e.releaseConfirmedDeposits())
+
+	di, err := store.getDepositInfo(medium.DepositID)
+	require.NoError(t, err)
+	require.Equal(t, StatusWaitSend, di.Status)
+	require.Equal(t, di, <-e.depositChan)
+
+	di, err = store.getDepositInfo(large.DepositID)
+	require.NoError(t, err)
+	require.Equal(t, StatusWaitDepositConfirmations, di.Status)
+	require.Empty(t, e.depositChan)
+
+	// A deposit released before it has the confirmations of its tier, e.g. from KYC, waits for them
+	di, err = store.UpdateDepositInfo(large.DepositID, func(di DepositInfo) DepositInfo {
+		di.Status = StatusWaitSend
+		return di
+	})
+	require.NoError(t, err)
+
+	di, ok := e.checkBeforeSend(log, di)
+	require.False(t, ok)
+	require.Equal(t, StatusWaitDepositConfirmations, di.Status)
+
+	e.SetBestHeighter(scanner.CoinTypeBTC, testBestHeighter(105))
+	require.NoError(t, e.releaseConfirmedDeposits())
+
+	di, err = store.getDepositInfo(large.DepositID)
+	require.NoError(t, err)
+	require.Equal(t, StatusWaitSend, di.Status)
+	require.Equal(t, di, <-e.depositChan)
+
+	di, ok = e.checkBeforeSend(log, di)
+	require.True(t, ok)
+	require.Equal(t, StatusWaitSend, di.Status)
+}
@@ -23,20 +23,53 @@ const (
 	StatusDone
 	// StatusUnknown fallback value
 	StatusUnknown
+	// StatusWaitKYC deposit received, but held until the owner of its skycoin address passes KYC.
+	// It is after StatusUnknown so that the values of the saved statuses don't change.
+	StatusWaitKYC
+	// StatusHeldForReview deposit received, but flagged by screening and held until an operator approves or rejects it
+	StatusHeldForReview
+	// StatusRejected deposit flagged by screening and rejected by an operator, nothing is sent
+	StatusRejected
+	// StatusInvalidated deposit transaction was double spent or replaced before skycoins were sent, nothing is sent
+	StatusInvalidated
+	// StatusWaitDepositConfirmations deposit received, but held until it has the confirmations
+	// its confirmation tier requires
+	StatusWaitDepositConfirmations
+	// StatusIgnoredDust deposit below the dust threshold of its coin type, recorded but never sent
+	StatusIgnoredDust
 )
 
 var statusString = []string{
-	StatusWaitDeposit: "waiting_deposit",
-	StatusWaitSend:    "waiting_send",
-	StatusWaitConfirm: "waiting_confirm",
-	StatusDone:        "done",
-	StatusUnknown:     "unknown",
+	StatusWaitDeposit:              "waiting_deposit",
+	StatusWaitSend:                 "waiting_send",
+	StatusWaitConfirm:              "waiting_confirm",
+	StatusDone:                     "done",
+	StatusUnknown:                  "unknown",
+	StatusWaitKYC:                  "pending_kyc",
+	StatusHeldForReview:            "held_for_review",
+	StatusRejected:                 "rejected",
+	StatusInvalidated:              "invalidated",
+	StatusWaitDepositConfirmations: "waiting_deposit_confirmations",
+	StatusIgnoredDust:              "ignored_dust",
 }
 
+// StatusPaused is reported by GetDepositStatuses instead of StatusWaitSend while payouts are paused.
+// It is not a Status, since it is never saved.
+const StatusPaused = "paused"
+
 func (s Status) String() string {
 	return statusString[s]
 }
 
+const (
+	// PaymentPaid the deposit has the value expected by the invoice of its address
+	PaymentPaid = "paid"
+	// PaymentUnderpaid the deposit has less than the value expected by the invoice of its address
+	PaymentUnderpaid = "underpaid"
+	// PaymentOverpaid the deposit has more than the value expected by the invoice of its address
+	PaymentOverpaid = "overpaid"
+)
+
 // NewStatusFromStr create status from string
 func NewStatusFromStr(st string) Status {
 	switch st {
@@ -48,6 +81,18 @@ func NewStatusFromStr(st string) Status {
 		return StatusWaitConfirm
 	case statusString[StatusDone]:
 		return StatusDone
+	case statusString[StatusWaitKYC]:
+		return StatusWaitKYC
+	case statusString[StatusHeldForReview]:
+		return StatusHeldForReview
+	case statusString[StatusRejected]:
+		return StatusRejected
+	case statusString[StatusInvalidated]:
+		return StatusInvalidated
+	case statusString[StatusWaitDepositConfirmations]:
+		return StatusWaitDepositConfirmations
+	case statusString[StatusIgnoredDust]:
+		return StatusIgnoredDust
 	default:
 		return StatusUnknown
 	}
@@ -62,11 +107,26 @@ type DepositInfo struct {
 	SkyAddress     string
 	DepositAddress string
 	DepositID      string
-	Txid           string
-	ConversionRate string // SKY per other coin, as a decimal string (allows integers, floats, fractions)
-	DepositValue   int64  // Deposit amount. Should be measured in the smallest unit possible (e.g. satoshis for BTC)
-	SkySent        uint64 // SKY sent, measured in droplets
-	Error          string // An error that occured during processing
+	// Transaction of the deposit, e.g. the BTC txid, and the index of the deposit in it,
+	// the vout for BTC and LTC or the log index for ERC20 tokens
+	DepositTx string
+	DepositN  uint32
+	// Height of the block that included DepositTx
+	DepositHeight int64
+	// Confirmations the deposit needs before skycoins are sent for it, per the config at the time: the confirmations
+	// the scanner required before it was received, or more if its value reaches a confirmation tier
+	ConfirmationsRequired int64
+	Txid                  string
+	ConversionRate        string // SKY per other coin, as a decimal string (allows integers, floats, fractions)
+	DepositValue          int64  // Deposit amount. Should be measured in the smallest unit possible (e.g. satoshis for BTC)
+	SkySent               uint64 // SKY sent, measured in droplets
+	SkyGross              uint64 // SKY bought before the fee was deducted, measured in droplets
+	SkyOutput             string // Hash of the transaction output that sent SkySent. Deposits sent in a batch share a Txid
+	Region                string // Pricing region of the deposit address, empty for the default pricing
+	Campaign              string // Campaign the deposit address was bound for, empty if none
+	PromoCode             string // Promo code the deposit address was bound with, empty if none
+	ExpectedValue         int64  // Value expected by the invoice of the deposit address, 0 if it was bound without an amount
+	Error                 string // An error that occured during processing
 	// The original Deposit is saved for the records, in case there is a mistake.
 	// Do not use this data directly.  All necessary data is copied to the top level
 	// of DepositInfo (e.g. DepositID, DepositAddress, DepositValue, CoinType).
@@ -78,6 +138,30 @@ type DepositStats struct {
 	TotalSKYSent     int64 `json:"total_sky_sent"`
 }
 
+// PaymentStatus compares the deposit value with the value expected by the invoice of the deposit address.
+// Returns PaymentPaid, PaymentUnderpaid or PaymentOverpaid, or an empty string if there is
+// no invoice or no deposit yet. Deposits are converted whether they match the invoice or not.
+func (di DepositInfo) PaymentStatus() string {
+	if di.ExpectedValue == 0 || di.Status == StatusWaitDeposit {
+		return ""
+	}
+
+	switch {
+	case di.DepositValue < di.ExpectedValue:
+		return PaymentUnderpaid
+	case di.DepositValue > di.ExpectedValue:
+		return PaymentOverpaid
+	default:
+		return PaymentPaid
+	}
+}
+
+// held returns true if the deposit waits for KYC, an operator's review or the confirmations
+// of its confirmation tier before it can be sent
+func (di DepositInfo) held() bool {
+	return di.Status == StatusWaitKYC || di.Status == StatusHeldForReview || di.Status == StatusWaitDepositConfirmations
+}
+
 // ValidateForStatus does a consistency check of the data based upon the Status value
 func (di DepositInfo) ValidateForStatus() error {
 
@@ -94,7 +178,7 @@ func (di DepositInfo) ValidateForStatus() error {
 		if di.DepositID == "" {
 			return errors.New("DepositID missing")
 		}
-		if di.CoinType == scanner.CoinTypeBTC && !isValidBtcTx(di.DepositID) {
+		if (di.CoinType == scanner.CoinTypeBTC || di.CoinType == scanner.CoinTypeLTC) && !isValidBtcTx(di.DepositID) {
 			return fmt.Errorf("Invalid DepositID value \"%s\"", di.DepositID)
 		}
 		if di.DepositValue == 0 {
@@ -109,7 +193,7 @@ func (di DepositInfo) ValidateForStatus() error {
 
 	switch di.Status {
 	case StatusDone:
-		if di.Error != ErrEmptySendAmount.Error() && di.Txid == "" {
+		if di.Error != ErrEmptySendAmount.Error() && di.Error != ErrBelowRegionMinimum.Error() && di.Txid == "" {
 			return errors.New("Txid missing")
 		}
 		// Don't check SkySent == 0, it is possible to have StatusDone with
@@ -127,7 +211,8 @@ func (di DepositInfo) ValidateForStatus() error {
 		}
 		return checkWaitSend()
 
-	case StatusWaitSend:
+	case StatusWaitSend, StatusWaitKYC, StatusHeldForReview, StatusRejected, StatusInvalidated, StatusWaitDepositConfirmations,
+		StatusIgnoredDust:
 		return checkWaitSend()
 
 	case StatusWaitDeposit, StatusUnknown:
@@ -0,0 +1,190 @@
+package exchange
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/skycoin/teller/src/alert"
+	"github.com/skycoin/teller/src/scanner"
+)
+
+// DepositChecker checks the transactions of deposits against the best chain, e.g. a scanner
+type DepositChecker interface {
+	CheckDeposit(d scanner.Deposit) (scanner.DepositCheck, error)
+}
+
+// errDepositNotInBestChain is the Error of a deposit held for review because its transaction left the best chain
+const errDepositNotInBestChain = "Deposit transaction is not in the best chain anymore, it may be double spent"
+
+// SetDepositChecker sets the DepositChecker of the blockchain of coinType, which its deposits with fewer than
+// cfg.DoubleSpendConfirmations confirmations are checked for double spends with. Must be called before Run.
+func (s *Exchange) SetDepositChecker(coinType string, c DepositChecker) {
+	s.checkers[coinType] = c
+}
+
+// checksDoubleSpends returns true if the deposits of coinType are checked for double spends
+func (s *Exchange) checksDoubleSpends(coinType string) bool {
+	_, ok := s.checkers[coinType]
+	return ok && s.cfg.DoubleSpendConfirmations > 0
+}
+
+// checkDoubleSpend checks a deposit with fewer than cfg.DoubleSpendConfirmations confirmations with the
+// DepositChecker of its coin type. A deposit whose inputs were spent by another transaction is set to
+// StatusInvalidated. A StatusWaitSend deposit whose transaction left the best chain is held for review,
+// since it may be mined again or double spent later, and released once it is mined again.
+// Returns the deposit, which is unchanged if it is not checked or nothing happened to it.
+func (s *Exchange) checkDoubleSpend(di DepositInfo) (DepositInfo, error) {
+	if !s.checksDoubleSpends(di.CoinType) || s.confirmations(di) >= s.cfg.DoubleSpendConfirmations {
+		return di, nil
+	}
+
+	log := s.log.WithFields(logrus.Fields{
+		"depositID": di.DepositID,
+		"status":    di.Status.String(),
+	})
+
+	check, err := s.checkers[di.CoinType].CheckDeposit(di.Deposit)
+	if err != nil {
+		log.WithError(err).Error("CheckDeposit failed")
+		return di, err
+	}
+
+	log = log.WithField("depositState", check.State.String())
+
+	switch check.State {
+	case scanner.DepositConfirmed:
+		if di.Status != StatusHeldForReview || di.Error != errDepositNotInBestChain {
+			return di, nil
+		}
+
+		// A deposit held because its transaction left the best chain is released once it is mined again
+		updated, err := s.store.UpdateDepositInfo(di.DepositID, func(di DepositInfo) DepositInfo {
+			di.Status = StatusWaitSend
+			di.Error = ""
+			di.DepositHeight = check.Height
+			return di
+		})
+		if err != nil {
+			log.WithError(err).Error("Update DepositInfo set StatusWaitSend failed")
+			return di, err
+		}
+
+		log.WithField("height", check.Height).Info("Deposit transaction is in the best chain again, releasing it")
+		s.enqueue(updated)
+
+		return updated, nil
+
+	case scanner.DepositConflicted:
+		log = log.WithField("conflictTx", check.ConflictTx)
+		reason := fmt.Sprintf("Deposit transaction was double spent by %s", check.ConflictTx)
+
+		switch di.Status {
+		case StatusWaitConfirm, StatusDone:
+			// Skycoins were sent for the deposit already, which can't be undone
+			if di.Error == reason {
+				return di, nil
+			}
+
+			log.Error("Deposit was double spent after skycoins were sent for it")
+			s.notify(alert.EventDoubleSpend, fmt.Sprintf("Deposit %s of %s to %s was double spent by %s after skycoins were sent for it in %s",
+				di.DepositID, di.CoinType, di.SkyAddress, check.ConflictTx, di.Txid))
+
+			return s.store.UpdateDepositInfo(di.DepositID, func(di DepositInfo) DepositInfo {
+				di.Error = reason
+				return di
+			})
+
+		case StatusWaitSend, StatusWaitKYC, StatusHeldForReview, StatusWaitDepositConfirmations:
+			updated, err := s.store.UpdateDepositInfo(di.DepositID, func(di DepositInfo) DepositInfo {
+				di.Status = StatusInvalidated
+				di.Error = reason
+				return di
+			})
+			if err != nil {
+				log.WithError(err).Error("Update DepositInfo set StatusInvalidated failed")
+				return di, err
+			}
+
+			log.Warn("Deposit was double spent, set to StatusInvalidated")
+			s.notify(alert.EventDoubleSpend, fmt.Sprintf("Deposit %s of %s to %s was double spent by %s and invalidated, no skycoins are sent",
+				di.DepositID, di.CoinType, di.SkyAddress, check.ConflictTx))
+
+			return updated, nil
+
+		default:
+			return di, nil
+		}
+
+	default:
+		if di.Status != StatusWaitSend {
+			log.Warn("Deposit transaction is not in the best chain")
+			return di, nil
+		}
+
+		log.Warn("Deposit transaction is not in the best chain, holding it for review")
+		return s.holdForReview(di, errDepositNotInBestChain)
+	}
+}
+
+// checkBeforeSend checks a StatusWaitSend deposit with checkSendable before skycoins are sent for it,
+// retrying while the check fails, e.g. while the node is unavailable. Returns the deposit, and false
+// if it can't be sent or the exchange quit.
+func (s *Exchange) checkBeforeSend(log logrus.FieldLogger, di DepositInfo) (DepositInfo, bool) {
+	for {
+		checked, err := s.checkSendable(di)
+		if err == nil {
+			return checked, checked.Status == StatusWaitSend
+		}
+
+		log.WithError(err).Error("checkSendable failed, retrying")
+		select {
+		case <-time.After(s.cfg.TxConfirmationCheckWait):
+		case <-s.quit:
+			return di, false
+		}
+	}
+}
+
+// checkSendable sets a deposit with fewer confirmations than its confirmation tier requires
+// to StatusWaitDepositConfirmations, and checks the others with checkDoubleSpend
+func (s *Exchange) checkSendable(di DepositInfo) (DepositInfo, error) {
+	if s.waitsForConfirmations(di) {
+		return s.waitForConfirmations(di)
+	}
+
+	return s.checkDoubleSpend(di)
+}
+
+// watchDoubleSpends checks the held and sent deposits with fewer than cfg.DoubleSpendConfirmations
+// confirmations for double spends. Held deposits that were double spent are invalidated,
+// and sent deposits that were double spent are alerted.
+func (s *Exchange) watchDoubleSpends() error {
+	dis, err := s.store.QueryDepositInfos(DepositQuery{
+		Statuses: []Status{StatusWaitKYC, StatusHeldForReview, StatusWaitDepositConfirmations, StatusWaitConfirm, StatusDone},
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, di := range dis {
+		select {
+		case <-s.quit:
+			return nil
+		default:
+		}
+
+		// Deposits skipped with nothing to send can't lose anything. Without a BestHeighter,
+		// the confirmations of a deposit are unknown and it would be checked forever.
+		if _, ok := s.heighters[di.CoinType]; !ok || (di.Status == StatusDone && di.Txid == "") {
+			continue
+		}
+
+		if _, err := s.checkDoubleSpend(di); err != nil {
+			s.log.WithError(err).WithField("depositID", di.DepositID).Error("checkDoubleSpend failed")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,170 @@
+package exchange
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/alert"
+	"github.com/skycoin/teller/src/scanner"
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+// dummyDepositChecker returns the checks of the deposits by txid, DepositConfirmed at their height by default
+type dummyDepositChecker struct {
+	sync.Mutex
+	checks  map[string]scanner.DepositCheck
+	checked []string
+}
+
+func (c *dummyDepositChecker) CheckDeposit(d scanner.Deposit) (scanner.DepositCheck, error) {
+	c.Lock()
+	defer c.Unlock()
+	c.checked = append(c.checked, d.Tx)
+
+	if check, ok := c.checks[d.Tx]; ok {
+		return check, nil
+	}
+
+	return scanner.DepositCheck{
+		State:  scanner.DepositConfirmed,
+		Height: d.Height,
+	}, nil
+}
+
+func (c *dummyDepositChecker) set(tx string, check scanner.DepositCheck) {
+	c.Lock()
+	defer c.Unlock()
+	c.checks[tx] = check
+}
+
+func (c *dummyDepositChecker) reset() []string {
+	c.Lock()
+	defer c.Unlock()
+	checked := c.checked
+	c.checked = nil
+	return checked
+}
+
+func TestExchangeDoubleSpend(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	log, _ := testutil.NewLogger(t)
+	store, err := NewStore(log, db, nil)
+	require.NoError(t, err)
+
+	e, err := NewExchange(log, store, newDummyScanner(), newDummySender(), Config{
+		Rate:                     "100",
+		DoubleSpendConfirmations: 6,
+	})
+	require.NoError(t, err)
+
+	checker := &dummyDepositChecker{checks: make(map[string]scanner.DepositCheck)}
+	e.SetDepositChecker(scanner.CoinTypeBTC, checker)
+	e.SetBestHeighter(scanner.CoinTypeBTC, testBestHeighter(102))
+
+	alerter := &dummyAlerter{}
+	e.SetAlerter(alerter)
+
+	require.NoError(t, store.BindAddress(testSkyAddr, "dsaddr", "", "", "", 0, 0))
+
+	save := func(tx string, height int64) DepositInfo {
+		di, err := e.saveIncomingDeposit(scanner.Deposit{
+			CoinType: scanner.CoinTypeBTC,
+			Address:  "dsaddr",
+			Value:    1e6,
+			Height:   height,
+			Tx:       tx,
+			N:        1,
+			Inputs:   []string{tx + "-in:0"},
+		})
+		require.NoError(t, err)
+		require.Equal(t, StatusWaitSend, di.Status)
+		return di
+	}
+
+	// A confirmed deposit is sent
+	di := save("oktx", 100)
+	checked, ok := e.checkBeforeSend(log, di)
+	require.True(t, ok)
+	require.Equal(t, di, checked)
+	require.Equal(t, []string{"oktx"}, checker.reset())
+
+	// A deposit with enough confirmations is not checked
+	di = save("oldtx", 90)
+	_, ok = e.checkBeforeSend(log, di)
+	require.True(t, ok)
+	require.Empty(t, checker.reset())
+
+	// A double spent deposit is invalidated
+	di = save("conflictedtx", 100)
+	checker.set("conflictedtx", scanner.DepositCheck{
+		State:      scanner.DepositConflicted,
+		ConflictTx: "replacementtx",
+	})
+	di, ok = e.checkBeforeSend(log, di)
+	require.False(t, ok)
+	require.Equal(t, StatusInvalidated, di.Status)
+	require.Equal(t, "Deposit transaction was double spent by replacementtx", di.Error)
+
+	events, messages := alerter.alerted()
+	require.Equal(t, []string{alert.EventDoubleSpend}, events)
+	require.Equal(t, []string{
+		fmt.Sprintf("Deposit %s of BTC to %s was double spent by replacementtx and invalidated, no skycoins are sent", di.DepositID, testSkyAddr),
+	}, messages)
+
+	// A deposit that left the best chain is held for review, and released once it is mined again
+	reorged := save("reorgedtx", 100)
+	checker.set("reorgedtx", scanner.DepositCheck{
+		State: scanner.DepositUnconfirmed,
+	})
+	di, ok = e.checkBeforeSend(log, reorged)
+	require.False(t, ok)
+	require.Equal(t, StatusHeldForReview, di.Status)
+	require.Equal(t, errDepositNotInBestChain, di.Error)
+
+	checker.set("reorgedtx", scanner.DepositCheck{
+		State:  scanner.DepositConfirmed,
+		Height: 101,
+	})
+	checker.reset()
+	require.NoError(t, e.watchDoubleSpends())
+	require.Equal(t, []string{"reorgedtx"}, checker.reset())
+
+	di, err = store.getDepositInfo(reorged.DepositID)
+	require.NoError(t, err)
+	require.Equal(t, StatusWaitSend, di.Status)
+	require.Empty(t, di.Error)
+	require.Equal(t, int64(101), di.DepositHeight)
+	require.Equal(t, di, <-e.depositChan)
+
+	// A deposit double spent after skycoins were sent for it is alerted once, and keeps its status
+	sent := save("senttx", 100)
+	_, err = store.UpdateDepositInfo(sent.DepositID, func(di DepositInfo) DepositInfo {
+		di.Status = StatusDone
+		di.Txid = "skytx"
+		di.SkySent = 1e8
+		return di
+	})
+	require.NoError(t, err)
+
+	checker.set("senttx", scanner.DepositCheck{
+		State:      scanner.DepositConflicted,
+		ConflictTx: "replacementtx2",
+	})
+	require.NoError(t, e.watchDoubleSpends())
+	require.NoError(t, e.watchDoubleSpends())
+
+	di, err = store.getDepositInfo(sent.DepositID)
+	require.NoError(t, err)
+	require.Equal(t, StatusDone, di.Status)
+	require.Equal(t, "Deposit transaction was double spent by replacementtx2", di.Error)
+
+	events, messages = alerter.alerted()
+	require.Equal(t, []string{alert.EventDoubleSpend, alert.EventDoubleSpend}, events)
+	require.Equal(t, fmt.Sprintf("Deposit %s of BTC to %s was double spent by replacementtx2 after skycoins were sent for it in skytx",
+		sent.DepositID, testSkyAddr), messages[1])
+}
@@ -0,0 +1,598 @@
+package exchange
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/skycoin/teller/src/util/dbcrypt"
+	"github.com/skycoin/teller/src/util/dbutil"
+)
+
+// append-only log of changes to the exchange state, event seq as key
+var depositEventsBkt = []byte("deposit_events")
+
+// index of the events of each deposit, "<deposit ID>/<zero padded event seq>" as key, event seq as value
+var depositEventsIndexBkt = []byte("deposit_events_index")
+
+// EventType is the type of a DepositEvent
+type EventType string
+
+const (
+	// EventBindAddress a BTC address was bound to a skycoin address
+	EventBindAddress EventType = "bind_address"
+	// EventUnbindAddress a BTC address was unbound, because its binding expired without a deposit,
+	// or because its deposits were processed and it was recycled. The Reason is "expired" or "recycled".
+	EventUnbindAddress EventType = "unbind_address"
+	// EventDepositInfo a DepositInfo was created or updated
+	EventDepositInfo EventType = "deposit_info"
+	// EventReprocess an operator reset a failed deposit to be sent again.
+	// The change itself is recorded by the preceding deposit_info event.
+	EventReprocess EventType = "reprocess"
+	// EventKYCRelease a deposit held for KYC was released to be sent, by an operator or because
+	// the owner passed KYC. The change itself is recorded by the preceding deposit_info event.
+	EventKYCRelease EventType = "kyc_release"
+	// EventReviewApprove an operator approved a deposit held for review, to be sent
+	EventReviewApprove EventType = "review_approve"
+	// EventReviewReject an operator rejected a deposit held for review, nothing is sent
+	EventReviewReject EventType = "review_reject"
+	// EventArchive a processed deposit was removed from the db, with its events, and written to an archive.
+	// The DepositInfo is its final state, the Reason is the name of the archive.
+	EventArchive EventType = "archive"
+)
+
+// DepositEvent records a change to the exchange state.
+// DepositInfo events hold the complete DepositInfo after the change,
+// so that the state can be rebuilt from the log alone.
+type DepositEvent struct {
+	Seq        uint64    `json:"seq"`
+	Time       int64     `json:"time"`
+	Type       EventType `json:"type"`
+	SkyAddress string    `json:"sky_address,omitempty"`
+	BtcAddress string    `json:"btc_address,omitempty"`
+	Region     string    `json:"region,omitempty"`
+	Campaign   string    `json:"campaign,omitempty"`
+	PromoCode  string    `json:"promo_code,omitempty"`
+	// Expected deposit value of an address bound with an invoice amount
+	ExpectedValue int64 `json:"expected_value,omitempty"`
+	// Unix time the binding expires at unless the address receives a deposit
+	ExpiresAt   int64        `json:"expires_at,omitempty"`
+	DepositInfo *DepositInfo `json:"deposit_info,omitempty"`
+	// Reason and RemoteAddr of a reprocess, KYC release or review request. Reason of an unbind_address event,
+	// archive of an archive event.
+	Reason     string `json:"reason,omitempty"`
+	RemoteAddr string `json:"remote_addr,omitempty"`
+}
+
+// appendEventTx appends an event to the event log, encrypted with c
+func appendEventTx(tx *bolt.Tx, c *dbcrypt.Cipher, ev DepositEvent) error {
+	seq, err := dbutil.NextSequence(tx, depositEventsBkt)
+	if err != nil {
+		return err
+	}
+
+	ev.Seq = seq
+	ev.Time = time.Now().UTC().Unix()
+
+	if err := c.PutBucketValue(tx, depositEventsBkt, strconv.FormatUint(seq, 10), ev); err != nil {
+		return err
+	}
+
+	return indexDepositEventTx(tx, ev)
+}
+
+// indexDepositEventTx adds an event that changed a deposit to the events index of the deposit.
+// Archive events are not indexed, the deposit and its other events were removed.
+func indexDepositEventTx(tx *bolt.Tx, ev DepositEvent) error {
+	if ev.DepositInfo == nil || ev.Type == EventArchive {
+		return nil
+	}
+
+	key := fmt.Sprintf("%s/%020d", ev.DepositInfo.DepositID, ev.Seq)
+	return dbutil.PutBucketValue(tx, depositEventsIndexBkt, key, strconv.FormatUint(ev.Seq, 10))
+}
+
+// buildDepositEventsIndexTx indexes the events of databases created before the index was added.
+// Indexing an event again changes nothing, so it is safe to apply to indexed databases.
+func buildDepositEventsIndexTx(tx *bolt.Tx) error {
+	return dbutil.ForEach(tx, depositEventsBkt, func(k, v []byte) error {
+		var ev DepositEvent
+		if err := json.Unmarshal(v, &ev); err != nil {
+			return err
+		}
+
+		return indexDepositEventTx(tx, ev)
+	})
+}
+
+func appendBindEventTx(tx *bolt.Tx, c *dbcrypt.Cipher, skyAddr, btcAddr, region, campaign, promoCode string, expectedValue, expiresAt int64) error {
+	return appendEventTx(tx, c, DepositEvent{
+		Type:          EventBindAddress,
+		SkyAddress:    skyAddr,
+		BtcAddress:    btcAddr,
+		Region:        region,
+		Campaign:      campaign,
+		PromoCode:     promoCode,
+		ExpectedValue: expectedValue,
+		ExpiresAt:     expiresAt,
+	})
+}
+
+const (
+	unbindReasonExpired  = "expired"
+	unbindReasonRecycled = "recycled"
+)
+
+func appendUnbindEventTx(tx *bolt.Tx, c *dbcrypt.Cipher, skyAddr, btcAddr, campaign, reason string) error {
+	return appendEventTx(tx, c, DepositEvent{
+		Type:       EventUnbindAddress,
+		SkyAddress: skyAddr,
+		BtcAddress: btcAddr,
+		Campaign:   campaign,
+		Reason:     reason,
+	})
+}
+
+func appendDepositInfoEventTx(tx *bolt.Tx, c *dbcrypt.Cipher, di DepositInfo) error {
+	return appendEventTx(tx, c, DepositEvent{
+		Type:        EventDepositInfo,
+		DepositInfo: &di,
+	})
+}
+
+func appendReprocessEventTx(tx *bolt.Tx, c *dbcrypt.Cipher, di DepositInfo, reason, remoteAddr string) error {
+	return appendEventTx(tx, c, DepositEvent{
+		Type:        EventReprocess,
+		DepositInfo: &di,
+		Reason:      reason,
+		RemoteAddr:  remoteAddr,
+	})
+}
+
+func appendKYCReleaseEventTx(tx *bolt.Tx, c *dbcrypt.Cipher, di DepositInfo, reason, remoteAddr string) error {
+	return appendEventTx(tx, c, DepositEvent{
+		Type:        EventKYCRelease,
+		DepositInfo: &di,
+		Reason:      reason,
+		RemoteAddr:  remoteAddr,
+	})
+}
+
+func appendReviewEventTx(tx *bolt.Tx, c *dbcrypt.Cipher, di DepositInfo, approve bool, reason, remoteAddr string) error {
+	t := EventReviewReject
+	if approve {
+		t = EventReviewApprove
+	}
+
+	return appendEventTx(tx, c, DepositEvent{
+		Type:        t,
+		DepositInfo: &di,
+		Reason:      reason,
+		RemoteAddr:  remoteAddr,
+	})
+}
+
+func appendArchiveEventTx(tx *bolt.Tx, c *dbcrypt.Cipher, di DepositInfo, archive string) error {
+	return appendEventTx(tx, c, DepositEvent{
+		Type:        EventArchive,
+		DepositInfo: &di,
+		Reason:      archive,
+	})
+}
+
+// seedEventsTx writes the existing state to an empty event log, for databases
+// created before the event log was added
+func seedEventsTx(tx *bolt.Tx) error {
+	if tx.Bucket(depositEventsBkt).Sequence() != 0 {
+		return nil
+	}
+
+	if err := dbutil.ForEach(tx, skyDepositSeqsIndexBkt, func(k, v []byte) error {
+		var btcAddrs []string
+		if err := json.Unmarshal(v, &btcAddrs); err != nil {
+			return err
+		}
+
+		for _, btcAddr := range btcAddrs {
+			region, err := getBindRegionTx(tx, btcAddr)
+			if err != nil {
+				return err
+			}
+
+			campaign, err := getBindCampaignTx(tx, btcAddr)
+			if err != nil {
+				return err
+			}
+
+			promoCode, err := getBindPromoCodeTx(tx, btcAddr)
+			if err != nil {
+				return err
+			}
+
+			expectedValue, err := getBindExpectedValueTx(tx, btcAddr)
+			if err != nil {
+				return err
+			}
+
+			expiresAt, err := getBindExpiryTx(tx, btcAddr)
+			if err != nil {
+				return err
+			}
+
+			if err := appendBindEventTx(tx, nil, string(k), btcAddr, region, campaign, promoCode, expectedValue, expiresAt); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	var dis []DepositInfo
+	if err := dbutil.ForEach(tx, depositInfoBkt, func(k, v []byte) error {
+		var di DepositInfo
+		if err := json.Unmarshal(v, &di); err != nil {
+			return err
+		}
+
+		dis = append(dis, di)
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	sort.Slice(dis, func(i, j int) bool {
+		return dis[i].Seq < dis[j].Seq
+	})
+
+	for _, di := range dis {
+		if err := appendDepositInfoEventTx(tx, nil, di); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetDepositEvents returns the event log, ordered by seq
+func (s *Store) GetDepositEvents() ([]DepositEvent, error) {
+	return LoadDepositEvents(s.db, s.c)
+}
+
+// GetDepositHistory returns a deposit and the events that created and changed it, ordered by seq.
+// Returns ErrDepositNotFound if the deposit does not exist.
+func (s *Store) GetDepositHistory(depositID string) (DepositInfo, []DepositEvent, error) {
+	var di DepositInfo
+	var evs []DepositEvent
+
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		di, err = s.getDepositInfoTx(tx, depositID)
+		if err != nil {
+			switch err.(type) {
+			case dbutil.ObjectNotExistErr:
+				return ErrDepositNotFound
+			default:
+				return err
+			}
+		}
+
+		// The index keys of a deposit are ordered by seq
+		return dbutil.ForEachPrefix(tx, depositEventsIndexBkt, depositID+"/", func(k, v []byte) error {
+			var ev DepositEvent
+			if err := s.c.GetBucketObject(tx, depositEventsBkt, string(v), &ev); err != nil {
+				return err
+			}
+
+			evs = append(evs, ev)
+			return nil
+		})
+	}); err != nil {
+		return DepositInfo{}, nil, err
+	}
+
+	return di, evs, nil
+}
+
+// LoadDepositEvents returns the event log of db, ordered by seq, decrypted with c if it is not nil.
+// Unlike NewStore, it does not write to db, so db can be opened read-only.
+func LoadDepositEvents(db *bolt.DB, c *dbcrypt.Cipher) ([]DepositEvent, error) {
+	var evs []DepositEvent
+
+	if err := db.View(func(tx *bolt.Tx) error {
+		return c.ForEach(tx, depositEventsBkt, func(k, v []byte) error {
+			var ev DepositEvent
+			if err := json.Unmarshal(v, &ev); err != nil {
+				return err
+			}
+
+			evs = append(evs, ev)
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(evs, func(i, j int) bool {
+		return evs[i].Seq < evs[j].Seq
+	})
+
+	return evs, nil
+}
+
+// RebuildState replays events into db, reconstructing the exchange state.
+// db must not contain any exchange state yet. The events are copied to db's event log too.
+// If c is not nil, the state is encrypted with it, and db must have its key, see dbcrypt.CopyKey.
+func RebuildState(db *bolt.DB, c *dbcrypt.Cipher, events []DepositEvent) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		for _, bkt := range stateBkts {
+			b := tx.Bucket(bkt)
+			if b == nil {
+				continue
+			}
+			if k, _ := b.Cursor().First(); k != nil {
+				return fmt.Errorf("bucket %s is not empty", bkt)
+			}
+		}
+
+		for _, bkt := range append(stateBkts, depositEventsBkt, depositEventsIndexBkt) {
+			if _, err := tx.CreateBucketIfNotExists(bkt); err != nil {
+				return dbutil.NewCreateBucketFailedErr(bkt, err)
+			}
+		}
+
+		var lastSeq uint64
+		var maxDepositSeq uint64
+		for _, ev := range events {
+			if ev.Seq <= lastSeq {
+				return fmt.Errorf("event %d is out of order", ev.Seq)
+			}
+			lastSeq = ev.Seq
+
+			if err := applyEventTx(tx, c, ev); err != nil {
+				return fmt.Errorf("apply event %d failed: %v", ev.Seq, err)
+			}
+
+			if (ev.Type == EventDepositInfo || ev.Type == EventArchive) && ev.DepositInfo.Seq > maxDepositSeq {
+				maxDepositSeq = ev.DepositInfo.Seq
+			}
+
+			if err := c.PutBucketValue(tx, depositEventsBkt, strconv.FormatUint(ev.Seq, 10), ev); err != nil {
+				return err
+			}
+
+			if err := indexDepositEventTx(tx, ev); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Bucket(depositEventsBkt).SetSequence(lastSeq); err != nil {
+			return err
+		}
+
+		return tx.Bucket(depositInfoBkt).SetSequence(maxDepositSeq)
+	})
+}
+
+func applyEventTx(tx *bolt.Tx, c *dbcrypt.Cipher, ev DepositEvent) error {
+	switch ev.Type {
+	case EventBindAddress:
+		if hasKey, err := dbutil.BucketHasKey(tx, bindAddressBkt, ev.BtcAddress); err != nil {
+			return err
+		} else if hasKey {
+			return ErrAddressAlreadyBound
+		}
+
+		var btcAddrs []string
+		if err := c.GetBucketObject(tx, skyDepositSeqsIndexBkt, ev.SkyAddress, &btcAddrs); err != nil {
+			switch err.(type) {
+			case dbutil.ObjectNotExistErr:
+			default:
+				return err
+			}
+		}
+
+		btcAddrs = append(btcAddrs, ev.BtcAddress)
+		if err := c.PutBucketValue(tx, skyDepositSeqsIndexBkt, ev.SkyAddress, btcAddrs); err != nil {
+			return err
+		}
+
+		if ev.Region != "" {
+			if err := dbutil.PutBucketValue(tx, bindRegionBkt, ev.BtcAddress, ev.Region); err != nil {
+				return err
+			}
+		}
+
+		if ev.Campaign != "" {
+			if err := dbutil.PutBucketValue(tx, bindCampaignBkt, ev.BtcAddress, ev.Campaign); err != nil {
+				return err
+			}
+		}
+
+		if ev.PromoCode != "" {
+			if err := dbutil.PutBucketValue(tx, bindPromoCodeBkt, ev.BtcAddress, ev.PromoCode); err != nil {
+				return err
+			}
+		}
+
+		if ev.ExpectedValue != 0 {
+			if err := dbutil.PutBucketValue(tx, bindExpectedValueBkt, ev.BtcAddress, ev.ExpectedValue); err != nil {
+				return err
+			}
+		}
+
+		if ev.ExpiresAt != 0 {
+			if err := dbutil.PutBucketValue(tx, bindExpiryBkt, ev.BtcAddress, ev.ExpiresAt); err != nil {
+				return err
+			}
+		}
+
+		return c.PutBucketValue(tx, bindAddressBkt, ev.BtcAddress, ev.SkyAddress)
+
+	case EventUnbindAddress:
+		return unbindAddressTx(tx, c, ev.SkyAddress, ev.BtcAddress)
+
+	case EventDepositInfo:
+		if ev.DepositInfo == nil {
+			return errors.New("deposit_info event has no DepositInfo")
+		}
+		di := *ev.DepositInfo
+
+		hasKey, err := dbutil.BucketHasKey(tx, depositInfoBkt, di.DepositID)
+		if err != nil {
+			return err
+		}
+
+		var prev *DepositInfo
+		if hasKey {
+			var prevDi DepositInfo
+			if err := c.GetBucketObject(tx, depositInfoBkt, di.DepositID, &prevDi); err != nil {
+				return err
+			}
+			prev = &prevDi
+		}
+
+		if err := indexDepositInfoTx(tx, c, prev, di); err != nil {
+			return err
+		}
+
+		// The first event of a DepositInfo adds it to the btc_txs index
+		if !hasKey {
+			var txs []string
+			if err := c.GetBucketObject(tx, btcTxsBkt, di.DepositAddress, &txs); err != nil {
+				switch err.(type) {
+				case dbutil.ObjectNotExistErr:
+				default:
+					return err
+				}
+			}
+
+			txs = append(txs, di.DepositID)
+			if err := c.PutBucketValue(tx, btcTxsBkt, di.DepositAddress, txs); err != nil {
+				return err
+			}
+
+			if err := dbutil.DeleteBucketKey(tx, bindExpiryBkt, di.DepositAddress); err != nil {
+				return err
+			}
+		}
+
+		return c.PutBucketValue(tx, depositInfoBkt, di.DepositID, di)
+
+	case EventArchive:
+		if ev.DepositInfo == nil {
+			return errors.New("archive event has no DepositInfo")
+		}
+
+		return archiveDepositTx(tx, c, *ev.DepositInfo, ev.Reason)
+
+	case EventReprocess, EventKYCRelease, EventReviewApprove, EventReviewReject:
+		// Audit only, the state change has its own deposit_info event
+		return nil
+
+	default:
+		return fmt.Errorf("unknown event type %q", ev.Type)
+	}
+}
+
+// stateBkts are the buckets that make up the exchange state rebuilt from the event log
+var stateBkts = [][]byte{
+	bindAddressBkt,
+	bindRegionBkt,
+	bindCampaignBkt,
+	bindPromoCodeBkt,
+	bindExpectedValueBkt,
+	bindExpiryBkt,
+	skyDepositSeqsIndexBkt,
+	btcTxsBkt,
+	depositInfoBkt,
+	skyDepositsIndexBkt,
+	statusDepositsIndexBkt,
+	archivedDepositsBkt,
+	archivedTotalsBkt,
+}
+
+func isEncryptedBkt(name []byte) bool {
+	for _, bkt := range encryptedBkts {
+		if bytes.Equal(bkt, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CompareState compares the exchange state of two databases, whose values are decrypted with c if it is not nil.
+// Returns a description of each difference found.
+func CompareState(a, b *bolt.DB, c *dbcrypt.Cipher) ([]string, error) {
+	var diffs []string
+
+	if err := a.View(func(atx *bolt.Tx) error {
+		return b.View(func(btx *bolt.Tx) error {
+			for _, bkt := range stateBkts {
+				ab := atx.Bucket(bkt)
+				bb := btx.Bucket(bkt)
+				if ab == nil || bb == nil {
+					if ab != bb {
+						diffs = append(diffs, fmt.Sprintf("bucket %s exists in only one database", bkt))
+					}
+					continue
+				}
+
+				// Encrypted values have random nonces, the same value is encrypted differently in each database
+				encrypted := isEncryptedBkt(bkt)
+
+				if err := ab.ForEach(func(k, v []byte) error {
+					bv := bb.Get(k)
+					if bv == nil {
+						diffs = append(diffs, fmt.Sprintf("%s[%s] is missing", bkt, k))
+						return nil
+					}
+
+					if encrypted {
+						var err error
+						if v, err = c.Decrypt(v); err != nil {
+							return err
+						}
+						if bv, err = c.Decrypt(bv); err != nil {
+							return err
+						}
+					}
+
+					if !bytes.Equal(v, bv) {
+						diffs = append(diffs, fmt.Sprintf("%s[%s] differs: %s != %s", bkt, k, v, bv))
+					}
+					return nil
+				}); err != nil {
+					return err
+				}
+
+				if err := bb.ForEach(func(k, v []byte) error {
+					if ab.Get(k) == nil {
+						diffs = append(diffs, fmt.Sprintf("%s[%s] is unexpected", bkt, k))
+					}
+					return nil
+				}); err != nil {
+					return err
+				}
+			}
+
+			if as, bs := atx.Bucket(depositInfoBkt), btx.Bucket(depositInfoBkt); as != nil && bs != nil && as.Sequence() != bs.Sequence() {
+				diffs = append(diffs, fmt.Sprintf("%s sequence differs: %d != %d", depositInfoBkt, as.Sequence(), bs.Sequence()))
+			}
+
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+
+	return diffs, nil
+}
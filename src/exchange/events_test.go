@@ -0,0 +1,191 @@
+package exchange
+
+import (
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/scanner"
+	"github.com/skycoin/teller/src/util/dbutil"
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+func populateTestStore(t *testing.T, s *Store) {
+	require.NoError(t, s.BindAddress("skyaddr1", "btcaddr1", "", "", "", 0, 0))
+	require.NoError(t, s.BindAddress("skyaddr1", "btcaddr2", "", "", "", 2e6, 0))
+	require.NoError(t, s.BindAddress("skyaddr2", "btcaddr3", "eu", "", "", 0, 0))
+
+	for _, dv := range []scanner.Deposit{
+		{CoinType: scanner.CoinTypeBTC, Address: "btcaddr1", Value: 1e6, Height: 20, Tx: "btx1", N: 1},
+		{CoinType: scanner.CoinTypeBTC, Address: "btcaddr1", Value: 2e6, Height: 21, Tx: "btx2", N: 0},
+		{CoinType: scanner.CoinTypeBTC, Address: "btcaddr3", Value: 3e6, Height: 22, Tx: "btx3", N: 2},
+	} {
+		_, err := s.GetOrCreateDepositInfo(dv, testSkyBtcRate, 1)
+		require.NoError(t, err)
+	}
+
+	_, err := s.UpdateDepositInfo("btx1:1", func(di DepositInfo) DepositInfo {
+		di.Status = StatusWaitConfirm
+		di.Txid = "skytx1"
+		di.SkySent = 100e6
+		return di
+	})
+	require.NoError(t, err)
+
+	_, err = s.UpdateDepositInfo("btx1:1", func(di DepositInfo) DepositInfo {
+		di.Status = StatusDone
+		return di
+	})
+	require.NoError(t, err)
+}
+
+func TestRebuildState(t *testing.T) {
+	s, shutdown := newTestStore(t)
+	defer shutdown()
+
+	populateTestStore(t, s)
+
+	evs, err := s.GetDepositEvents()
+	require.NoError(t, err)
+	require.Len(t, evs, 8)
+	for i, ev := range evs {
+		require.Equal(t, uint64(i+1), ev.Seq)
+	}
+	require.Equal(t, EventBindAddress, evs[0].Type)
+	require.Equal(t, EventDepositInfo, evs[7].Type)
+	require.Equal(t, StatusDone, evs[7].DepositInfo.Status)
+
+	db, shutdown2 := testutil.PrepareDB(t)
+	defer shutdown2()
+
+	require.NoError(t, RebuildState(db, nil, evs))
+
+	diffs, err := CompareState(s.db, db, nil)
+	require.NoError(t, err)
+	require.Empty(t, diffs)
+
+	// The rebuilt db can be used as a Store and continues the sequences
+	log, _ := testutil.NewLogger(t)
+	s2, err := NewStore(log, db, nil)
+	require.NoError(t, err)
+
+	di, err := s2.GetOrCreateDepositInfo(scanner.Deposit{
+		CoinType: scanner.CoinTypeBTC,
+		Address:  "btcaddr2",
+		Value:    1e6,
+		Height:   23,
+		Tx:       "btx4",
+		N:        0,
+	}, testSkyBtcRate, 1)
+	require.NoError(t, err)
+	require.Equal(t, uint64(4), di.Seq)
+	require.Equal(t, int64(2e6), di.ExpectedValue)
+	require.Equal(t, PaymentUnderpaid, di.PaymentStatus())
+
+	evs2, err := s2.GetDepositEvents()
+	require.NoError(t, err)
+	require.Len(t, evs2, 9)
+	require.Equal(t, uint64(9), evs2[8].Seq)
+
+	// The events of each deposit are indexed in the rebuilt db
+	_, devs, err := s2.GetDepositHistory("btx1:1")
+	require.NoError(t, err)
+	require.Len(t, devs, 3)
+
+	// Rebuilding into a db with existing state fails
+	require.Error(t, RebuildState(db, nil, evs))
+
+	// Differences are reported, including the deposit added above
+	err = db.Update(func(tx *bolt.Tx) error {
+		return dbutil.PutBucketValue(tx, bindAddressBkt, "btcaddr1", "skyaddr9")
+	})
+	require.NoError(t, err)
+
+	diffs, err = CompareState(s.db, db, nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"bind_address[btcaddr1] differs: skyaddr1 != skyaddr9",
+		"btc_txs[btcaddr2] is unexpected",
+		"deposit_info[btx4:0] is unexpected",
+		"sky_deposits_index[skyaddr1/btx4:0] is unexpected",
+		"status_deposits_index[waiting_send/btx4:0] is unexpected",
+		"deposit_info sequence differs: 3 != 4",
+	}, diffs)
+}
+
+func TestDepositEventsIndex(t *testing.T) {
+	s, shutdown := newTestStore(t)
+	defer shutdown()
+
+	populateTestStore(t, s)
+
+	_, _, err := s.GetDepositHistory("btx9:9")
+	require.Equal(t, ErrDepositNotFound, err)
+
+	di, evs, err := s.GetDepositHistory("btx1:1")
+	require.NoError(t, err)
+	require.Equal(t, StatusDone, di.Status)
+	require.Len(t, evs, 3)
+	for i, ev := range evs {
+		require.Equal(t, EventDepositInfo, ev.Type)
+		require.Equal(t, "btx1:1", ev.DepositInfo.DepositID)
+		if i > 0 {
+			require.True(t, ev.Seq > evs[i-1].Seq)
+		}
+	}
+
+	// The index of a db created before it existed is built from the event log
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		return tx.DeleteBucket(depositEventsIndexBkt)
+	})
+	require.NoError(t, err)
+	unversionSchema(t, s.db)
+
+	log, _ := testutil.NewLogger(t)
+	s2, err := NewStore(log, s.db, nil)
+	require.NoError(t, err)
+
+	_, evs2, err := s2.GetDepositHistory("btx1:1")
+	require.NoError(t, err)
+	require.Equal(t, evs, evs2)
+
+	_, evs2, err = s2.GetDepositHistory("btx2:0")
+	require.NoError(t, err)
+	require.Len(t, evs2, 1)
+}
+
+func TestSeedEvents(t *testing.T) {
+	s, shutdown := newTestStore(t)
+	defer shutdown()
+
+	populateTestStore(t, s)
+
+	// Simulate a database from before the event log existed
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket(depositEventsBkt); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucket(depositEventsBkt)
+		return err
+	})
+	require.NoError(t, err)
+	unversionSchema(t, s.db)
+
+	log, _ := testutil.NewLogger(t)
+	s, err = NewStore(log, s.db, nil)
+	require.NoError(t, err)
+
+	evs, err := s.GetDepositEvents()
+	require.NoError(t, err)
+	require.Len(t, evs, 6)
+
+	db, shutdown2 := testutil.PrepareDB(t)
+	defer shutdown2()
+
+	require.NoError(t, RebuildState(db, nil, evs))
+
+	diffs, err := CompareState(s.db, db, nil)
+	require.NoError(t, err)
+	require.Empty(t, diffs)
+}
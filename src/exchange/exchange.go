@@ -4,8 +4,10 @@
 package exchange
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
@@ -15,14 +17,19 @@ import (
 	"github.com/skycoin/skycoin/src/util/droplet"
 	"github.com/skycoin/skycoin/src/visor"
 
+	"github.com/skycoin/teller/src/alert"
+	"github.com/skycoin/teller/src/pricing"
 	"github.com/skycoin/teller/src/scanner"
 	"github.com/skycoin/teller/src/sender"
+	"github.com/skycoin/teller/src/tracing"
+	"github.com/skycoin/teller/src/util/logger"
 )
 
 const (
 	// SatoshisPerBTC is the number of satoshis per 1 BTC
 	SatoshisPerBTC          int64 = 1e8
 	txConfirmationCheckWait       = time.Second * 3
+	defaultBatchMaxSize           = 20
 )
 
 var (
@@ -37,6 +44,13 @@ var (
 	ErrDepositStatusInvalid = errors.New("Deposit status cannot be handled")
 	// ErrNoBoundAddress is returned if no skycoin address is bound to a deposit's address
 	ErrNoBoundAddress = errors.New("Deposit has no bound skycoin address")
+	// ErrBelowRegionMinimum is returned if the calculated skycoin amount to send is less than the minimum of the deposit's pricing region
+	ErrBelowRegionMinimum = errors.New("Skycoin send amount is below the pricing region minimum")
+	// ErrDepositQueued is returned when reprocessing a deposit that is waiting to be sent
+	ErrDepositQueued = errors.New("Deposit is already queued to be sent")
+	// ErrPurchaseLimitExceeded is recorded on the deposits held for review because their skycoin address
+	// would receive more than cfg.MaxSkyPerAddress
+	ErrPurchaseLimitExceeded = errors.New("Deposit exceeds the lifetime purchase limit of the skycoin address")
 )
 
 // DepositFilter filters deposits
@@ -44,30 +58,146 @@ type DepositFilter func(di DepositInfo) bool
 
 // Exchanger provides APIs to interact with the exchange service
 type Exchanger interface {
-	BindAddress(skyAddr, btcAddr string) error
-	GetDepositStatuses(skyAddr string) ([]DepositStatus, error)
-	GetDepositStatusDetail(flt DepositFilter) ([]DepositStatusDetail, error)
+	BindAddress(ctx context.Context, skyAddr, depositAddr, coinType, region, campaign, promoCode string, expectedValue, expiresAt int64) error
+	ExpireBindings() ([]Binding, error)
+	RecycleBindings(coolDown time.Duration) ([]Binding, error)
+	GetDepositStatuses(skyAddr string, history bool) ([]DepositStatus, error)
+	QueryDepositStatusDetail(q DepositQuery) ([]DepositStatusDetail, error)
+	GetDepositDetail(depositID string) (DepositDetail, error)
 	GetBindNum(skyAddr string) (int, error)
 	GetDepositStats() (*DepositStats, error)
+	GetCampaignDepositStats(campaign string) (*DepositStats, error)
+	RemainingSky(skyAddr string) (uint64, bool, error)
+	Paused() bool
+}
+
+// PauseState is an operator's pause of payouts. It is saved, so payouts stay paused after a restart
+type PauseState struct {
+	Paused   bool   `json:"paused"`
+	Reason   string `json:"reason,omitempty"`
+	PausedAt int64  `json:"paused_at,omitempty"`
+}
+
+// Pauser reports whether payouts are paused, e.g. for a low hot wallet balance
+type Pauser interface {
+	Paused() bool
+}
+
+// Alerter alerts operators of events, e.g. failed sends
+type Alerter interface {
+	Notify(event, message string)
+}
+
+// CampaignRater provides the exchange rates of campaigns
+type CampaignRater interface {
+	// Rate returns the SKY rate of a coin type in a campaign, or the empty string if the campaign has no rate of its own
+	Rate(campaign, coinType string) (string, error)
+}
+
+// QuoteRater provides the fixed rates of quotes
+type QuoteRater interface {
+	// Rate returns the quoted rate of a deposit to a deposit address, or the empty string if no quote applies to it
+	Rate(depositAddr, coinType string, value int64) (string, error)
+}
+
+// PromoRater applies the bonuses of promo codes
+type PromoRater interface {
+	// Rate applies the bonus of a promo code to rate, or returns rate if the code does not qualify for a bonus
+	Rate(code, rate string) (string, error)
+}
+
+// KYCChecker checks whether the owners of skycoin addresses passed KYC
+type KYCChecker interface {
+	// Verified returns true if the owner of a skycoin address passed KYC. token is an optional user token.
+	Verified(ctx context.Context, skyAddr, token string) (bool, error)
+}
+
+// Screener screens deposits for AML risk
+type Screener interface {
+	// Screen returns true and the reason if a deposit is flagged
+	Screen(ctx context.Context, d scanner.Deposit) (bool, string, error)
+}
+
+// AnomalyDetector is told of the binds and new deposits, to alert the unusual ones
+type AnomalyDetector interface {
+	ObserveBind(coinType string)
+	ObserveDeposit(depositID, coinType, skyAddr string, value int64)
+}
+
+// BestHeighter reports the best block height of a blockchain, e.g. a scanner. 0 if it is not known yet.
+type BestHeighter interface {
+	BestHeight() int64
 }
 
 // Exchange manages coin exchange between deposits and skycoin
 type Exchange struct {
 	log         logrus.FieldLogger
 	cfg         Config
-	scanner     scanner.Scanner // scanner provides APIs for interacting with the scan service
-	sender      sender.Sender   // sender provides APIs for sending skycoin
-	store       Storer          // deposit info storage
+	scanner     scanner.Scanner           // scanner provides APIs for interacting with the scan service
+	sender      sender.Sender             // sender provides APIs for sending skycoin
+	store       Storer                    // deposit info storage
+	pauser      Pauser                    // optional, payouts are paused while it is paused
+	alerter     Alerter                   // optional, alerted of failed sends
+	heighters   map[string]BestHeighter   // optional, best heights of the blockchains by coin type, for deposit confirmations
+	tracer      *tracing.Tracer           // optional, traces the state transitions of the deposits
+	campaigns   CampaignRater             // optional, deposits to the addresses of a campaign get its rates
+	quotes      QuoteRater                // optional, deposits to the addresses bound with a quote get the quoted rate
+	promoCodes  PromoRater                // optional, deposits to the addresses bound with a promo code get its bonus
+	kyc         KYCChecker                // optional, deposits of skycoin addresses that did not pass KYC are held
+	screener    Screener                  // optional, deposits flagged by screening are held for review
+	anomalies   AnomalyDetector           // optional, told of binds and new deposits to alert the unusual ones
+	checkers    map[string]DepositChecker // optional, check deposits for double spends by coin type
+	pauseState  PauseState                // payouts are paused by an operator while pauseState.Paused
+	pauseLock   sync.RWMutex
+	ratesLock   sync.RWMutex // guards the rates of cfg, which are changed by SetRates
 	quit        chan struct{}
 	done        chan struct{}
 	depositChan chan DepositInfo
+	queued      map[string]struct{} // IDs of the deposits in depositChan or being sent
+	sending     []string            // IDs of the deposits being sent by the send loop
+	queueLock   sync.Mutex
 }
 
 // Config exchange config struct
 type Config struct {
-	Rate                    string // SKY/BTC rate, decimal string
+	Rate                    string                    // SKY/BTC rate, decimal string
+	LtcRate                 string                    // SKY/LTC rate, decimal string. Empty if LTC deposits are not accepted
+	TokenRates              map[string]string         // SKY/token rates of ERC20 tokens, decimal strings, keyed by token symbol
+	Regions                 map[string]pricing.Region // Pricing regions, keyed by name
 	TxConfirmationCheckWait time.Duration
 	MaxDecimals             int
+	// Deposits received within BatchWindow of each other are sent in one transaction, 0 to send them one by one
+	BatchWindow time.Duration
+	// Maximum number of deposits sent in one transaction
+	BatchMaxSize int
+	// Fee deducted from the SKY bought by each deposit
+	Fee Fee
+	// Confirmations the scanner of each coin type requires, keyed by coin type. Saved with each deposit.
+	ConfirmationsRequired map[string]int64
+	// Confirmations required by the deposits of each coin type from a value on, keyed by coin type.
+	// Only used for the coin types with a BestHeighter.
+	ConfirmationTiers map[string][]ConfirmationTier
+	// Deposits of each coin type below its dust threshold are recorded as StatusIgnoredDust and never sent,
+	// keyed by coin type
+	DustThresholds map[string]int64
+	// Leave the StatusIgnoredDust deposits out of GetDepositStatuses
+	HideDust bool
+	// Maximum time Shutdown waits for the deposits being sent to reach a saved status, 0 for no limit
+	DrainTimeout time.Duration
+	// Deposits buying at least KYCThreshold droplets are held as StatusWaitKYC if the owner of their skycoin
+	// address did not pass KYC, 0 to check every deposit. Only used with a KYCChecker.
+	KYCThreshold uint64
+	// Interval the KYC of the skycoin addresses of held deposits is checked again at, 0 to only release them manually
+	KYCRecheckInterval time.Duration
+	// Maximum SKY a skycoin address can buy in its lifetime, in droplets, 0 for no limit.
+	// Deposits beyond it are held for review.
+	MaxSkyPerAddress uint64
+	// Deposits with fewer confirmations are checked for double spends before skycoins are sent for them,
+	// 0 to not check. Only used for the coin types with a DepositChecker.
+	DoubleSpendConfirmations int64
+	// Interval the held and sent deposits with fewer than DoubleSpendConfirmations confirmations are
+	// checked for double spends at, 0 to only check deposits before they are sent
+	DoubleSpendCheckInterval time.Duration
 }
 
 // Validate returns an error if the configuration is invalid
@@ -76,6 +206,24 @@ func (c Config) Validate() error {
 		return err
 	}
 
+	if c.LtcRate != "" {
+		if _, err := ParseRate(c.LtcRate); err != nil {
+			return fmt.Errorf("LtcRate invalid: %v", err)
+		}
+	}
+
+	for symbol, rate := range c.TokenRates {
+		if _, err := ParseRate(rate); err != nil {
+			return fmt.Errorf("TokenRates[%s] invalid: %v", symbol, err)
+		}
+	}
+
+	for name, r := range c.Regions {
+		if err := r.Validate(); err != nil {
+			return fmt.Errorf("Regions[%s] invalid: %v", name, err)
+		}
+	}
+
 	if c.MaxDecimals < 0 {
 		return errors.New("MaxDecimals can't be negative")
 	}
@@ -84,6 +232,57 @@ func (c Config) Validate() error {
 		return fmt.Errorf("MaxDecimals is larger than visor.MaxDropletPrecision=%d", visor.MaxDropletPrecision)
 	}
 
+	if c.BatchWindow < 0 {
+		return errors.New("BatchWindow can't be negative")
+	}
+
+	if c.BatchMaxSize < 0 {
+		return errors.New("BatchMaxSize can't be negative")
+	}
+
+	if c.DrainTimeout < 0 {
+		return errors.New("DrainTimeout can't be negative")
+	}
+
+	if c.KYCRecheckInterval < 0 {
+		return errors.New("KYCRecheckInterval can't be negative")
+	}
+
+	if c.DoubleSpendConfirmations < 0 {
+		return errors.New("DoubleSpendConfirmations can't be negative")
+	}
+
+	if c.DoubleSpendCheckInterval < 0 {
+		return errors.New("DoubleSpendCheckInterval can't be negative")
+	}
+
+	if err := c.Fee.Validate(); err != nil {
+		return fmt.Errorf("Fee invalid: %v", err)
+	}
+
+	for coinType, n := range c.ConfirmationsRequired {
+		if n < 0 {
+			return fmt.Errorf("ConfirmationsRequired[%s] can't be negative", coinType)
+		}
+	}
+
+	for coinType, n := range c.DustThresholds {
+		if n < 0 {
+			return fmt.Errorf("DustThresholds[%s] can't be negative", coinType)
+		}
+	}
+
+	for coinType, tiers := range c.ConfirmationTiers {
+		for i, t := range tiers {
+			if t.MinValue < 0 {
+				return fmt.Errorf("ConfirmationTiers[%s][%d].MinValue can't be negative", coinType, i)
+			}
+			if t.Confirmations < 0 {
+				return fmt.Errorf("ConfirmationTiers[%s][%d].Confirmations can't be negative", coinType, i)
+			}
+		}
+	}
+
 	return nil
 }
 
@@ -97,6 +296,10 @@ func NewExchange(log logrus.FieldLogger, store Storer, scanner scanner.Scanner,
 		cfg.TxConfirmationCheckWait = txConfirmationCheckWait
 	}
 
+	if cfg.BatchMaxSize == 0 {
+		cfg.BatchMaxSize = defaultBatchMaxSize
+	}
+
 	return &Exchange{
 		cfg:         cfg,
 		log:         log.WithField("prefix", "teller.exchange"),
@@ -106,9 +309,143 @@ func NewExchange(log logrus.FieldLogger, store Storer, scanner scanner.Scanner,
 		quit:        make(chan struct{}),
 		done:        make(chan struct{}, 1),
 		depositChan: make(chan DepositInfo, 100),
+		queued:      make(map[string]struct{}),
+		heighters:   make(map[string]BestHeighter),
+		checkers:    make(map[string]DepositChecker),
 	}, nil
 }
 
+// SetPauser sets the Pauser that pauses payouts
+func (s *Exchange) SetPauser(p Pauser) {
+	s.pauser = p
+}
+
+// SetAlerter sets the Alerter that failed sends are alerted to
+func (s *Exchange) SetAlerter(a Alerter) {
+	s.alerter = a
+}
+
+// SetTracer sets the Tracer that traces the state transitions of the deposits and their skycoin RPC calls.
+// Must be called before Run.
+func (s *Exchange) SetTracer(t *tracing.Tracer) {
+	s.tracer = t
+}
+
+// SetCampaigns sets the CampaignRater that provides the rates of the deposits to the addresses bound
+// for a campaign. Must be called before Run.
+func (s *Exchange) SetCampaigns(c CampaignRater) {
+	s.campaigns = c
+}
+
+// SetQuotes sets the QuoteRater that provides the rates of the deposits to the addresses bound
+// with a quote. Must be called before Run.
+func (s *Exchange) SetQuotes(q QuoteRater) {
+	s.quotes = q
+}
+
+// SetPromoCodes sets the PromoRater that applies the bonuses of the deposits to the addresses bound
+// with a promo code. Must be called before Run.
+func (s *Exchange) SetPromoCodes(p PromoRater) {
+	s.promoCodes = p
+}
+
+// SetKYC sets the KYCChecker that the skycoin addresses of the deposits are checked with.
+// Deposits of addresses that did not pass KYC are held as StatusWaitKYC. Must be called before Run.
+func (s *Exchange) SetKYC(k KYCChecker) {
+	s.kyc = k
+}
+
+// SetScreener sets the Screener that new deposits are screened with. Flagged deposits are held as
+// StatusHeldForReview until an operator approves or rejects them. Must be called before Run.
+func (s *Exchange) SetScreener(sc Screener) {
+	s.screener = sc
+}
+
+// SetAnomalyDetector sets the AnomalyDetector that binds and new deposits are observed by.
+// Must be called before Run.
+func (s *Exchange) SetAnomalyDetector(a AnomalyDetector) {
+	s.anomalies = a
+}
+
+// SetBestHeighter sets the BestHeighter of the blockchain of coinType, which the confirmations
+// of its deposits are counted from. Must be called before Run.
+func (s *Exchange) SetBestHeighter(coinType string, h BestHeighter) {
+	s.heighters[coinType] = h
+}
+
+// SetRates changes the SKY/BTC, SKY/LTC and ERC20 token rates of new deposits. Deposits that were
+// already received keep the rate they were received at. If a rate is invalid, no rate is changed.
+func (s *Exchange) SetRates(rate, ltcRate string, tokenRates map[string]string) error {
+	s.ratesLock.Lock()
+	defer s.ratesLock.Unlock()
+
+	cfg := s.cfg
+	cfg.Rate = rate
+	cfg.LtcRate = ltcRate
+	cfg.TokenRates = tokenRates
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	s.cfg.Rate = rate
+	s.cfg.LtcRate = ltcRate
+	s.cfg.TokenRates = tokenRates
+
+	return nil
+}
+
+// Paused returns true if payouts are paused by an operator or by the Pauser.
+// Deposits are still saved while paused, but no skycoins are sent until payouts are resumed.
+func (s *Exchange) Paused() bool {
+	return s.GetPauseState().Paused || (s.pauser != nil && s.pauser.Paused())
+}
+
+// Pause pauses payouts until Resume is called. A deposit or batch that is being sent is
+// finished, but no more skycoins are sent
+func (s *Exchange) Pause(reason string) error {
+	s.pauseLock.Lock()
+	defer s.pauseLock.Unlock()
+
+	ps := PauseState{
+		Paused:   true,
+		Reason:   reason,
+		PausedAt: time.Now().UTC().Unix(),
+	}
+
+	if err := s.store.SetPauseState(ps); err != nil {
+		return err
+	}
+
+	s.pauseState = ps
+
+	s.log.WithField("reason", reason).Warning("Payouts paused by operator")
+
+	return nil
+}
+
+// Resume resumes payouts paused by Pause. Payouts stay paused if the Pauser is paused
+func (s *Exchange) Resume() error {
+	s.pauseLock.Lock()
+	defer s.pauseLock.Unlock()
+
+	if err := s.store.SetPauseState(PauseState{}); err != nil {
+		return err
+	}
+
+	s.pauseState = PauseState{}
+
+	s.log.Info("Payouts resumed by operator")
+
+	return nil
+}
+
+// GetPauseState returns the operator's pause of payouts
+func (s *Exchange) GetPauseState() PauseState {
+	s.pauseLock.RLock()
+	defer s.pauseLock.RUnlock()
+	return s.pauseState
+}
+
 // Run starts the exchange process
 func (s *Exchange) Run() error {
 	log := s.log
@@ -118,6 +455,30 @@ func (s *Exchange) Run() error {
 		s.done <- struct{}{}
 	}()
 
+	// Restore an operator's pause from before a restart
+	ps, err := s.store.GetPauseState()
+	if err != nil {
+		err = fmt.Errorf("GetPauseState failed: %v", err)
+		log.WithError(err).Error(err)
+		return err
+	}
+
+	if ps.Paused {
+		log.WithField("pauseState", ps).Warning("Payouts are paused by operator")
+	}
+
+	s.pauseLock.Lock()
+	s.pauseState = ps
+	s.pauseLock.Unlock()
+
+	// Before loading the deposits to send, save the deposits of transactions that were broadcast
+	// before teller stopped, but not saved as StatusWaitConfirm
+	if err := s.reconcileSendIntents(); err != nil {
+		err = fmt.Errorf("reconcileSendIntents failed: %v", err)
+		log.WithError(err).Error(err)
+		return err
+	}
+
 	// Load StatusWaitSend deposits for processing later
 	waitSendDeposits, err := s.store.GetDepositInfoArray(func(di DepositInfo) bool {
 		return di.Status == StatusWaitSend
@@ -143,35 +504,48 @@ func (s *Exchange) Run() error {
 	var wg sync.WaitGroup
 
 	// This loop processes StatusWaitSend deposits.
-	// Only one deposit is processed at a time; it will not send more coins
+	// Only one deposit (or batch of deposits) is processed at a time; it will not send more coins
 	// until it receives confirmation of the previous send.
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
 
 		log := log.WithField("goroutine", "sendSky")
+		defer logger.LogPanic(log)
+		if s.cfg.BatchWindow > 0 {
+			s.runBatchSend(log)
+			return
+		}
+
 		for {
 			select {
 			case <-s.quit:
 				log.Info("exchange.Exchange send loop quit")
 				return
 			case d := <-s.depositChan:
-				log := log.WithField("depositInfo", d)
+				log := log.WithFields(logrus.Fields{
+					"depositInfo": d,
+					"depositID":   d.DepositID,
+				})
+				s.setSending(d)
 				if err := s.processWaitSendDeposit(d); err != nil {
 					log.WithError(err).Error("processWaitSendDeposit failed. This deposit will not be reprocessed until teller is restarted.")
+					s.recordSendError(d, err)
 				}
+				s.setSending()
+				s.dequeue(d)
 			}
 		}
 	}()
 
 	// Queue the saved StatusWaitConfirm deposits
 	for _, di := range waitConfirmDeposits {
-		s.depositChan <- di
+		s.enqueue(di)
 	}
 
 	// Queue the saved StatusWaitSend deposits
 	for _, di := range waitSendDeposits {
-		s.depositChan <- di
+		s.enqueue(di)
 	}
 
 	// This loop processes incoming deposits from the scanner and saves a
@@ -181,6 +555,7 @@ func (s *Exchange) Run() error {
 		defer wg.Done()
 
 		log := log.WithField("goroutine", "watchDeposits")
+		defer logger.LogPanic(log)
 		for {
 			select {
 			case <-s.quit:
@@ -199,37 +574,185 @@ func (s *Exchange) Run() error {
 				// The scanner will mark the deposit as "processed" if no error
 				// occurred.  Any unprocessed deposits held by the scanner
 				// will be resent to the exchange when teller is started.
-				if d, err := s.saveIncomingDeposit(dv.Deposit); err != nil {
+				if d, err := s.saveIncomingDeposit(dv.Deposit); err == ErrDepositArchived {
+					// A deposit seen again after it was processed and archived, e.g. by a rescan
+					log.WithField("depositID", dv.Deposit.ID()).Info("Deposit was archived, ignoring it")
+					dv.ErrC <- nil
+				} else if err != nil {
 					log.WithError(err).Error("saveIncomingDeposit failed. This deposit will not be reprocessed until teller is restarted.")
 					dv.ErrC <- err
 				} else {
 					dv.ErrC <- nil
-					s.depositChan <- d
+					if !d.held() && d.Status != StatusIgnoredDust {
+						s.enqueue(d)
+					}
 				}
 			}
 		}
 	}()
 
+	// This loop releases the deposits held until they have the confirmations of their confirmation tiers
+	if len(s.cfg.ConfirmationTiers) > 0 && len(s.heighters) > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			log := log.WithField("goroutine", "releaseConfirmedDeposits")
+			defer logger.LogPanic(log)
+
+			ticker := time.NewTicker(depositConfirmationsCheckPeriod)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-s.quit:
+					log.Info("exchange.Exchange release confirmed deposits loop quit")
+					return
+				case <-ticker.C:
+					if err := s.releaseConfirmedDeposits(); err != nil {
+						log.WithError(err).Error("releaseConfirmedDeposits failed")
+					}
+				}
+			}
+		}()
+	}
+
+	// This loop releases the deposits held for KYC once the owners of their skycoin addresses pass it
+	if s.kyc != nil && s.cfg.KYCRecheckInterval > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			log := log.WithField("goroutine", "recheckKYC")
+			defer logger.LogPanic(log)
+
+			ticker := time.NewTicker(s.cfg.KYCRecheckInterval)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-s.quit:
+					log.Info("exchange.Exchange recheck KYC loop quit")
+					return
+				case <-ticker.C:
+					if err := s.recheckKYC(); err != nil {
+						log.WithError(err).Error("recheckKYC failed")
+					}
+				}
+			}
+		}()
+	}
+
+	// This loop invalidates the held deposits that were double spent, and alerts the sent ones
+	if len(s.checkers) > 0 && s.cfg.DoubleSpendConfirmations > 0 && s.cfg.DoubleSpendCheckInterval > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			log := log.WithField("goroutine", "watchDoubleSpends")
+			defer logger.LogPanic(log)
+
+			ticker := time.NewTicker(s.cfg.DoubleSpendCheckInterval)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-s.quit:
+					log.Info("exchange.Exchange watch double spends loop quit")
+					return
+				case <-ticker.C:
+					if err := s.watchDoubleSpends(); err != nil {
+						log.WithError(err).Error("watchDoubleSpends failed")
+					}
+				}
+			}
+		}()
+	}
+
 	wg.Wait()
 
 	return nil
 }
 
-// Shutdown close the exchange service
+// Shutdown stops receiving deposits from the scanner, and waits for the deposits being sent to reach
+// a saved status: a broadcast transaction is saved as StatusWaitConfirm, and a deposit waiting for its
+// confirmation stops waiting. The wait is bounded by cfg.DrainTimeout. If it times out, e.g. while the
+// broadcast is retried because the skycoin node is unavailable, the broadcast is abandoned when the sender
+// is shut down, and the deposit stays StatusWaitSend to be sent after a restart.
 func (s *Exchange) Shutdown() {
 	close(s.quit)
-	s.log.Info("Waiting for Run() to finish")
-	<-s.done
-	s.log.Info("Shutdown complete")
+
+	log := s.log.WithField("sending", s.sendingIDs())
+	log.Info("Waiting for Run() to finish")
+
+	var timeout <-chan time.Time
+	if s.cfg.DrainTimeout > 0 {
+		timeout = time.After(s.cfg.DrainTimeout)
+	}
+
+	select {
+	case <-s.done:
+		s.log.Info("Shutdown complete")
+	case <-timeout:
+		s.log.WithFields(logrus.Fields{
+			"sending": s.sendingIDs(),
+			"timeout": s.cfg.DrainTimeout,
+		}).Error("Timed out waiting for the deposits being sent to be saved, they are sent after a restart")
+	}
 }
 
 // saveIncomingDeposit is called when receiving a deposit from the scanner
-func (s *Exchange) saveIncomingDeposit(dv scanner.Deposit) (DepositInfo, error) {
+func (s *Exchange) saveIncomingDeposit(dv scanner.Deposit) (di DepositInfo, err error) {
 	log := s.log.WithField("deposit", dv)
 
-	log.Info("Received bitcoin deposit")
+	_, span := s.tracer.StartDepositSpan(context.Background(), dv.ID(), "exchange.saveIncomingDeposit")
+	span.SetAttribute("deposit.coin_type", dv.CoinType)
+	span.SetAttribute("deposit.value", dv.Value)
+	span.SetAttribute("deposit.address", dv.Address)
+	defer func() {
+		span.SetError(err)
+		span.End()
+	}()
+
+	log.Info("Received deposit")
+
+	rate, err := s.rate(dv.CoinType)
+	if err != nil {
+		log.WithError(err).Error("No exchange rate for deposit")
+		return DepositInfo{}, err
+	}
+
+	quotedRate, err := s.quoteRate(dv)
+	if err != nil {
+		log.WithError(err).Error("quoteRate failed")
+		return DepositInfo{}, err
+	}
+
+	if quotedRate != "" {
+		// The quoted rate is final, it includes the bonus of the pricing region the quote was issued in
+		log.WithField("quotedRate", quotedRate).Info("Deposit has a quoted rate")
+		rate = quotedRate
+	} else {
+		rate, err = s.campaignRate(dv.Address, dv.CoinType, rate)
+		if err != nil {
+			log.WithError(err).Error("campaignRate failed")
+			return DepositInfo{}, err
+		}
+
+		rate, err = s.regionRate(dv.Address, rate)
+		if err != nil {
+			log.WithError(err).Error("regionRate failed")
+			return DepositInfo{}, err
+		}
+	}
+
+	rate, err = s.promoRate(dv.Address, rate)
+	if err != nil {
+		log.WithError(err).Error("promoRate failed")
+		return DepositInfo{}, err
+	}
 
-	di, err := s.store.GetOrCreateDepositInfo(dv, s.cfg.Rate)
+	di, err = s.store.GetOrCreateDepositInfo(dv, rate, s.confirmationsRequired(dv.CoinType, dv.Value))
 	if err != nil {
 		log.WithError(err).Error("GetOrCreateDepositInfo failed")
 		return DepositInfo{}, err
@@ -238,69 +761,986 @@ func (s *Exchange) saveIncomingDeposit(dv scanner.Deposit) (DepositInfo, error)
 	log = log.WithField("depositInfo", di)
 	log.Info("Saved DepositInfo")
 
-	return di, err
-}
+	// Dust is recorded, but not processed any further
+	if di.Status == StatusWaitSend && di.Txid == "" && di.DepositValue < s.cfg.DustThresholds[di.CoinType] {
+		di, err = s.store.UpdateDepositInfo(di.DepositID, func(di DepositInfo) DepositInfo {
+			di.Status = StatusIgnoredDust
+			return di
+		})
+		if err != nil {
+			log.WithError(err).Error("Update DepositInfo set StatusIgnoredDust failed")
+			return DepositInfo{}, err
+		}
 
-// processDeposit advances a single deposit through three states:
-// StatusWaitSend -> StatusWaitConfirm
-// StatusWaitConfirm -> StatusDone
-// StatusWaitDeposit is never saved to the database, so it does not transition
-func (s *Exchange) processWaitSendDeposit(di DepositInfo) error {
-	log := s.log.WithField("depositInfo", di)
-	log.Info("Processing StatusWaitSend deposit")
+		log.WithField("dustThreshold", s.cfg.DustThresholds[di.CoinType]).Info("Deposit is below the dust threshold, ignoring it")
+		return di, nil
+	}
 
-	for {
-		select {
-		case <-s.quit:
-			return nil
-		default:
-		}
+	if s.anomalies != nil {
+		s.anomalies.ObserveDeposit(di.DepositID, di.CoinType, di.SkyAddress, di.DepositValue)
+	}
 
-		log.Info("handleDepositInfoState")
+	if ps := di.PaymentStatus(); ps == PaymentUnderpaid || ps == PaymentOverpaid {
+		log.WithField("paymentStatus", ps).Warning("Deposit value does not match the invoice of the deposit address")
+	}
 
-		var err error
-		di, err = s.handleDepositInfoState(di)
-		log = log.WithField("depositInfo", di)
+	if flagged, reason := s.screen(dv, di); flagged {
+		log.WithField("reason", reason).Warning("Deposit flagged by screening, holding it for review")
+		return s.holdForReview(di, "Flagged by screening: "+reason)
+	}
 
-		switch err.(type) {
-		case sender.RPCError:
-			// Treat skycoin RPC/CLI errors as temporary.
-			// Some RPC/CLI errors are hypothetically permanent,
-			// but most likely it is an insufficient wallet balance or
-			// the skycoin node is unavailable.
-			// A permanent error suggests a bug in skycoin or teller so can be fixed.
-			log.WithError(err).Error("handleDepositInfoState failed")
-			select {
-			case <-time.After(s.cfg.TxConfirmationCheckWait):
-			case <-s.quit:
-				return nil
-			}
-		default:
-			switch err {
-			case nil:
-				break
-			case ErrNotConfirmed:
-				select {
-				case <-time.After(s.cfg.TxConfirmationCheckWait):
-				case <-s.quit:
-					return nil
-				}
-			default:
-				log.WithError(err).Error("handleDepositInfoState failed")
-				return err
-			}
+	if exceeded, err := s.exceedsPurchaseLimit(di); err != nil {
+		log.WithError(err).Error("exceedsPurchaseLimit failed")
+		return DepositInfo{}, err
+	} else if exceeded {
+		log.Warning("Deposit exceeds the lifetime purchase limit of its skycoin address, holding it for review")
+		return s.holdForReview(di, ErrPurchaseLimitExceeded.Error())
+	}
+
+	if hold, err := s.holdForKYC(di); err != nil {
+		log.WithError(err).Error("holdForKYC failed")
+		return DepositInfo{}, err
+	} else if hold {
+		di, err = s.store.UpdateDepositInfo(di.DepositID, func(di DepositInfo) DepositInfo {
+			di.Status = StatusWaitKYC
+			return di
+		})
+		if err != nil {
+			log.WithError(err).Error("Update DepositInfo set StatusWaitKYC failed")
+			return DepositInfo{}, err
 		}
 
-		if di.Status == StatusDone {
-			return nil
+		log.Warning("Deposit held until the owner of its skycoin address passes KYC")
+	}
+
+	if di.Status == StatusWaitSend && di.Txid == "" && s.waitsForConfirmations(di) {
+		di, err = s.waitForConfirmations(di)
+		if err != nil {
+			return DepositInfo{}, err
+		}
+
+		log.WithField("confirmationsRequired", di.ConfirmationsRequired).Info("Deposit held until it has the confirmations of its confirmation tier")
+	}
+
+	return di, nil
+}
+
+// holdForReview sets a deposit to StatusHeldForReview, recording why in its Error
+func (s *Exchange) holdForReview(di DepositInfo, reason string) (DepositInfo, error) {
+	updated, err := s.store.UpdateDepositInfo(di.DepositID, func(di DepositInfo) DepositInfo {
+		di.Status = StatusHeldForReview
+		di.Error = reason
+		return di
+	})
+	if err != nil {
+		s.log.WithError(err).WithField("depositID", di.DepositID).Error("Update DepositInfo set StatusHeldForReview failed")
+		return DepositInfo{}, err
+	}
+
+	return updated, nil
+}
+
+// exceedsPurchaseLimit returns true if a new deposit would make its skycoin address buy more than cfg.MaxSkyPerAddress
+func (s *Exchange) exceedsPurchaseLimit(di DepositInfo) (bool, error) {
+	if s.cfg.MaxSkyPerAddress == 0 || di.Status != StatusWaitSend || di.Txid != "" {
+		return false, nil
+	}
+
+	purchased, err := s.skyPurchased(di.SkyAddress, di.DepositID)
+	if err != nil {
+		return false, err
+	}
+
+	skyAmt, err := CalculateBtcSkyValue(di.DepositValue, di.ConversionRate, s.cfg.MaxDecimals)
+	if err != nil {
+		return false, err
+	}
+
+	return purchased+skyAmt > s.cfg.MaxSkyPerAddress, nil
+}
+
+// skyPurchased returns the SKY bought by the deposits of a skycoin address that were sent or are to be sent,
+// archived ones included, in droplets, except the deposit with ID excludeID
+func (s *Exchange) skyPurchased(skyAddr, excludeID string) (uint64, error) {
+	dis, err := s.store.GetDepositInfoOfSkyAddress(skyAddr)
+	if err != nil {
+		return 0, err
+	}
+
+	total, err := s.store.GetArchivedSkyPurchased(skyAddr)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, di := range dis {
+		if di.DepositID == excludeID {
+			continue
+		}
+
+		switch di.Status {
+		case StatusWaitSend, StatusWaitConfirm, StatusWaitKYC, StatusWaitDepositConfirmations:
+		case StatusDone:
+			// Skipped deposits sent nothing
+			if di.Txid == "" {
+				continue
+			}
+		default:
+			continue
+		}
+
+		skyAmt := di.SkyGross
+		if skyAmt == 0 {
+			skyAmt, err = CalculateBtcSkyValue(di.DepositValue, di.ConversionRate, s.cfg.MaxDecimals)
+			if err != nil {
+				return 0, err
+			}
+		}
+
+		total += skyAmt
+	}
+
+	return total, nil
+}
+
+// RemainingSky returns the SKY a skycoin address can still buy before it reaches cfg.MaxSkyPerAddress,
+// in droplets. Returns false if there is no limit.
+func (s *Exchange) RemainingSky(skyAddr string) (uint64, bool, error) {
+	if s.cfg.MaxSkyPerAddress == 0 {
+		return 0, false, nil
+	}
+
+	purchased, err := s.skyPurchased(skyAddr, "")
+	if err != nil {
+		return 0, false, err
+	}
+
+	if purchased >= s.cfg.MaxSkyPerAddress {
+		return 0, true, nil
+	}
+
+	return s.cfg.MaxSkyPerAddress - purchased, true, nil
+}
+
+// screen returns true and the reason if a new deposit is flagged by the Screener.
+// A deposit is also flagged if the Screener fails, so that an operator reviews it.
+func (s *Exchange) screen(dv scanner.Deposit, di DepositInfo) (bool, string) {
+	if s.screener == nil || di.Status != StatusWaitSend || di.Txid != "" {
+		return false, ""
+	}
+
+	flagged, reason, err := s.screener.Screen(context.Background(), dv)
+	if err != nil {
+		s.log.WithError(err).WithField("depositID", di.DepositID).Error("Screening failed, holding deposit for review")
+		return true, fmt.Sprintf("screening failed: %v", err)
+	}
+
+	return flagged, reason
+}
+
+// holdForKYC returns true if a new deposit must be held until the owner of its skycoin address passes KYC.
+// A deposit is also held if the KYC service fails, it can be released by an operator or by the KYC recheck.
+func (s *Exchange) holdForKYC(di DepositInfo) (bool, error) {
+	if s.kyc == nil || di.Status != StatusWaitSend || di.Txid != "" {
+		return false, nil
+	}
+
+	skyAmt, err := CalculateBtcSkyValue(di.DepositValue, di.ConversionRate, s.cfg.MaxDecimals)
+	if err != nil {
+		return false, err
+	}
+
+	if skyAmt < s.cfg.KYCThreshold {
+		return false, nil
+	}
+
+	verified, err := s.kyc.Verified(context.Background(), di.SkyAddress, "")
+	if err != nil {
+		s.log.WithError(err).WithField("skyAddr", di.SkyAddress).Error("KYC check failed, holding deposit")
+		return true, nil
+	}
+
+	return !verified, nil
+}
+
+// recheckKYC releases the deposits held for KYC whose skycoin addresses passed it since
+func (s *Exchange) recheckKYC() error {
+	dis, err := s.store.QueryDepositInfos(DepositQuery{
+		Statuses: []Status{StatusWaitKYC},
+	})
+	if err != nil {
+		return err
+	}
+
+	verified := make(map[string]bool)
+	for _, di := range dis {
+		log := s.log.WithFields(logrus.Fields{
+			"depositID": di.DepositID,
+			"skyAddr":   di.SkyAddress,
+		})
+
+		ok, checked := verified[di.SkyAddress]
+		if !checked {
+			ok, err = s.kyc.Verified(context.Background(), di.SkyAddress, "")
+			if err != nil {
+				log.WithError(err).Error("KYC check failed")
+				continue
+			}
+			verified[di.SkyAddress] = ok
+		}
+
+		if !ok {
+			continue
+		}
+
+		if _, err := s.ReleaseKYCDeposit(di.DepositID, "KYC verified", ""); err != nil {
+			log.WithError(err).Error("ReleaseKYCDeposit failed")
+		}
+	}
+
+	return nil
+}
+
+// rate returns the SKY exchange rate of a coin type
+func (s *Exchange) rate(coinType string) (string, error) {
+	s.ratesLock.RLock()
+	defer s.ratesLock.RUnlock()
+
+	switch coinType {
+	case scanner.CoinTypeBTC:
+		return s.cfg.Rate, nil
+	case scanner.CoinTypeLTC:
+		if s.cfg.LtcRate != "" {
+			return s.cfg.LtcRate, nil
+		}
+	default:
+		// ERC20 token amounts are normalized to 8 decimals by the scanner,
+		// so they convert the same way as BTC
+		if rate, ok := s.cfg.TokenRates[coinType]; ok {
+			return rate, nil
+		}
+	}
+
+	return "", scanner.ErrUnsupportedCoinType
+}
+
+// quoteRate returns the quoted rate of a deposit, or the empty string if no quote applies to it
+func (s *Exchange) quoteRate(dv scanner.Deposit) (string, error) {
+	if s.quotes == nil {
+		return "", nil
+	}
+
+	return s.quotes.Rate(dv.Address, dv.CoinType, dv.Value)
+}
+
+// campaignRate returns the rate of a coin type in the campaign of a deposit address, or rate if the address
+// was bound without a campaign or the campaign has no rate of its own for the coin type
+func (s *Exchange) campaignRate(depositAddr, coinType, rate string) (string, error) {
+	if s.campaigns == nil {
+		return rate, nil
+	}
+
+	campaign, err := s.store.GetBindCampaign(depositAddr)
+	if err != nil {
+		return "", err
+	}
+
+	if campaign == "" {
+		return rate, nil
+	}
+
+	campaignRate, err := s.campaigns.Rate(campaign, coinType)
+	if err != nil {
+		return "", err
+	}
+
+	if campaignRate == "" {
+		return rate, nil
+	}
+
+	return campaignRate, nil
+}
+
+// promoRate applies the bonus of the promo code of a deposit address to rate, or returns rate if the
+// address was bound without a promo code or the code does not qualify for a bonus anymore
+func (s *Exchange) promoRate(depositAddr, rate string) (string, error) {
+	if s.promoCodes == nil {
+		return rate, nil
+	}
+
+	code, err := s.store.GetBindPromoCode(depositAddr)
+	if err != nil {
+		return "", err
+	}
+
+	if code == "" {
+		return rate, nil
+	}
+
+	return s.promoCodes.Rate(code, rate)
+}
+
+// regionRate applies the bonus of the pricing region of a deposit address to rate.
+// If the address was bound in a region that is no longer configured, the default pricing applies.
+func (s *Exchange) regionRate(depositAddr, rate string) (string, error) {
+	name, err := s.store.GetBindRegion(depositAddr)
+	if err != nil {
+		return "", err
+	}
+
+	if name == "" {
+		return rate, nil
+	}
+
+	region, ok := s.cfg.Regions[name]
+	if !ok {
+		s.log.WithField("region", name).Warn("Pricing region of deposit address is not configured, using the default pricing")
+		return rate, nil
+	}
+
+	return region.Rate(rate)
+}
+
+// processDeposit advances a single deposit through three states:
+// StatusWaitSend -> StatusWaitConfirm
+// StatusWaitConfirm -> StatusDone
+// StatusWaitDeposit is never saved to the database, so it does not transition
+func (s *Exchange) processWaitSendDeposit(di DepositInfo) error {
+	log := s.log.WithField("depositInfo", di)
+	log.Info("Processing StatusWaitSend deposit")
+
+	for {
+		select {
+		case <-s.quit:
+			return nil
+		default:
+		}
+
+		// Deposits waiting to be sent wait while payouts are paused.
+		// Sent deposits still wait for confirmation.
+		if di.Status == StatusWaitSend && !s.waitUnpaused(log) {
+			return nil
+		}
+
+		// A deposit with few confirmations is checked for a double spend before skycoins are sent for it, and a deposit
+		// released before it has the confirmations of its tier, e.g. from KYC, waits for them.
+		// A deposit with a send intent was checked before its transaction was created.
+		if di.Status == StatusWaitSend && (s.checksDoubleSpends(di.CoinType) || s.waitsForConfirmations(di)) && !s.hasSendIntent(di) {
+			var ok bool
+			if di, ok = s.checkBeforeSend(log, di); !ok {
+				return nil
+			}
+		}
+
+		log.Info("handleDepositInfoState")
+
+		// Each state transition is a span in the trace of the deposit
+		ctx, span := s.tracer.StartDepositSpan(context.Background(), di.DepositID, "exchange.handleDepositInfoState")
+		span.SetAttribute("deposit.status", di.Status.String())
+
+		var err error
+		di, err = s.handleDepositInfoState(ctx, di)
+		log = log.WithField("depositInfo", di)
+
+		span.SetAttribute("deposit.new_status", di.Status.String())
+		if err != ErrNotConfirmed {
+			span.SetError(err)
+		}
+		span.End()
+
+		switch err.(type) {
+		case sender.RPCError:
+			// Treat skycoin RPC/CLI errors as temporary.
+			// Some RPC/CLI errors are hypothetically permanent,
+			// but most likely it is an insufficient wallet balance or
+			// the skycoin node is unavailable.
+			// A permanent error suggests a bug in skycoin or teller so can be fixed.
+			log.WithError(err).Error("handleDepositInfoState failed")
+			s.notify(alert.EventSendFailed, fmt.Sprintf("Skycoin RPC failed for deposit %s, retrying: %v", di.DepositID, err))
+			select {
+			case <-time.After(s.cfg.TxConfirmationCheckWait):
+			case <-s.quit:
+				return nil
+			}
+		default:
+			switch err {
+			case nil:
+				break
+			case ErrNotConfirmed:
+				select {
+				case <-time.After(s.cfg.TxConfirmationCheckWait):
+				case <-s.quit:
+					return nil
+				}
+			default:
+				if s.interrupted(err) {
+					log.WithError(err).Warn("Send interrupted by shutdown, the deposit is sent after a restart")
+					return nil
+				}
+
+				log.WithError(err).Error("handleDepositInfoState failed")
+				return err
+			}
+		}
+
+		if di.Status == StatusDone {
+			return nil
+		}
+	}
+}
+
+// waitUnpaused blocks while payouts are paused. Returns false if the exchange quit while waiting.
+func (s *Exchange) waitUnpaused(log logrus.FieldLogger) bool {
+	if !s.Paused() {
+		return true
+	}
+
+	log.Warning("Payouts are paused, waiting to send")
+
+	for s.Paused() {
+		select {
+		case <-time.After(s.cfg.TxConfirmationCheckWait):
+		case <-s.quit:
+			return false
+		}
+	}
+
+	log.Info("Payouts resumed")
+
+	return true
+}
+
+// runBatchSend processes deposits like the send loop, except that StatusWaitSend deposits received within
+// cfg.BatchWindow of the first one are collected, and sent in one transaction by processWaitSendBatch.
+// A batch sends to a skycoin address at most once, so other deposits to the same address wait for the next batch.
+func (s *Exchange) runBatchSend(log logrus.FieldLogger) {
+	// Deposits that were received while collecting a batch, but can't be added to it
+	var pending []DepositInfo
+
+	for {
+		var d DepositInfo
+		if len(pending) > 0 {
+			d, pending = pending[0], pending[1:]
+		} else {
+			select {
+			case <-s.quit:
+				log.Info("exchange.Exchange send loop quit")
+				return
+			case d = <-s.depositChan:
+			}
+		}
+
+		// A deposit with a send intent is sent alone, by the intent's transaction
+		if d.Status != StatusWaitSend || s.hasSendIntent(d) {
+			s.setSending(d)
+			if err := s.processWaitSendDeposit(d); err != nil {
+				log.WithFields(logrus.Fields{
+					"depositInfo": d,
+					"depositID":   d.DepositID,
+				}).WithError(err).Error("processWaitSendDeposit failed. This deposit will not be reprocessed until teller is restarted.")
+				s.recordSendError(d, err)
+			}
+			s.setSending()
+			s.dequeue(d)
+			continue
+		}
+
+		batch := []DepositInfo{d}
+
+		var rest []DepositInfo
+		for _, d := range pending {
+			if len(batch) < s.cfg.BatchMaxSize && canBatch(batch, d) && !s.hasSendIntent(d) {
+				batch = append(batch, d)
+			} else {
+				rest = append(rest, d)
+			}
+		}
+		pending = rest
+
+		timeout := time.After(s.cfg.BatchWindow)
+
+	collect:
+		for len(batch) < s.cfg.BatchMaxSize {
+			select {
+			case <-s.quit:
+				log.Info("exchange.Exchange send loop quit")
+				return
+			case d := <-s.depositChan:
+				if canBatch(batch, d) && !s.hasSendIntent(d) {
+					batch = append(batch, d)
+				} else {
+					pending = append(pending, d)
+				}
+			case <-timeout:
+				break collect
+			}
+		}
+
+		s.setSending(batch...)
+		if err := s.processWaitSendBatch(batch); err != nil {
+			log.WithField("batchSize", len(batch)).WithError(err).Error("processWaitSendBatch failed. These deposits will not be reprocessed until teller is restarted.")
+			for _, di := range batch {
+				s.recordSendError(di, err)
+			}
+		}
+
+		s.setSending()
+		for _, di := range batch {
+			s.dequeue(di)
+		}
+	}
+}
+
+// canBatch returns true if d can be sent in the same transaction as batch
+func canBatch(batch []DepositInfo, d DepositInfo) bool {
+	if d.Status != StatusWaitSend {
+		return false
+	}
+
+	for _, di := range batch {
+		if di.SkyAddress == d.SkyAddress {
+			return false
+		}
+	}
+
+	return true
+}
+
+// processWaitSendBatch sends the coins of StatusWaitSend deposits in one transaction,
+// then advances each deposit to StatusDone like processWaitSendDeposit.
+// Skycoin RPC errors are retried, like processWaitSendDeposit.
+func (s *Exchange) processWaitSendBatch(batch []DepositInfo) error {
+	log := s.log.WithField("batchSize", len(batch))
+	log.Info("Processing StatusWaitSend deposit batch")
+
+	for len(batch) > 0 && batch[0].Status == StatusWaitSend {
+		select {
+		case <-s.quit:
+			return nil
+		default:
+		}
+
+		if !s.waitUnpaused(log) {
+			return nil
+		}
+
+		// Deposits with few confirmations are checked for double spends before skycoins are sent for them,
+		// and deposits released before they have the confirmations of their tiers wait for them.
+		// A batch with a send intent was checked before its transaction was created.
+		if (len(s.checkers) > 0 || len(s.cfg.ConfirmationTiers) > 0) && !s.hasSendIntent(batch[0]) {
+			checked := make([]DepositInfo, 0, len(batch))
+			for _, di := range batch {
+				if di, ok := s.checkBeforeSend(log, di); ok {
+					checked = append(checked, di)
+				}
+			}
+
+			batch = checked
+			if len(batch) == 0 {
+				return nil
+			}
+		}
+
+		ctx, span := s.tracer.StartSpan(context.Background(), "exchange.sendBatch", tracing.KindInternal)
+		span.SetAttribute("batch.size", len(batch))
+		span.SetAttribute("deposit.ids", batchDepositIDs(batch))
+
+		var err error
+		batch, err = s.sendBatch(ctx, batch)
+
+		span.SetError(err)
+		span.End()
+
+		switch err.(type) {
+		case nil:
+		case sender.RPCError:
+			// Treat skycoin RPC/CLI errors as temporary, see processWaitSendDeposit
+			log.WithError(err).Error("sendBatch failed")
+			s.notify(alert.EventSendFailed, fmt.Sprintf("Skycoin RPC failed for a batch of %d deposits, retrying: %v", len(batch), err))
+			select {
+			case <-time.After(s.cfg.TxConfirmationCheckWait):
+			case <-s.quit:
+				return nil
+			}
+		default:
+			if s.interrupted(err) {
+				log.WithError(err).Warn("Send interrupted by shutdown, the deposits are sent after a restart")
+				return nil
+			}
+
+			log.WithError(err).Error("sendBatch failed")
+			return err
+		}
+	}
+
+	// The deposits share one transaction, so they are all confirmed by the first check that confirms it
+	for _, di := range batch {
+		if err := s.processWaitSendDeposit(di); err != nil {
+			log.WithFields(logrus.Fields{
+				"depositInfo": di,
+				"depositID":   di.DepositID,
+			}).WithError(err).Error("processWaitSendDeposit failed. This deposit will not be reprocessed until teller is restarted.")
+			s.recordSendError(di, err)
+		}
+	}
+
+	return nil
+}
+
+// sendBatch creates and broadcasts one transaction sending the coins of StatusWaitSend deposits.
+// Deposits with nothing to send are set to StatusDone, and invalid deposits are logged; both are dropped from the batch.
+// Returns the deposits remaining in the batch, which are StatusWaitConfirm if the transaction was broadcast.
+func (s *Exchange) sendBatch(ctx context.Context, batch []DepositInfo) ([]DepositInfo, error) {
+	log := s.log.WithField("batchSize", len(batch))
+
+	// A batch whose transaction was created before, e.g. if broadcasting it failed, is only sent by that transaction.
+	// runBatchSend does not batch other deposits with a deposit that has a send intent.
+	si, err := s.store.GetDepositSendIntent(batch[0].DepositID)
+	if err != nil {
+		log.WithError(err).Error("store.GetDepositSendIntent failed")
+		return batch, err
+	}
+
+	if si != nil {
+		log.WithField("txid", si.Txid).Warn("Batch has a send intent, reconciling it instead of creating a transaction")
+
+		dis, err := s.reconcileSendIntent(ctx, *si, true)
+		if err != nil {
+			log.WithError(err).Error("reconcileSendIntent failed")
+			return batch, err
+		}
+
+		return dis, nil
+	}
+
+	sends := make([]DepositInfo, 0, len(batch))
+	amounts := make([]sender.SendAmount, 0, len(batch))
+	gross := make(map[string]uint64, len(batch))
+	for _, di := range batch {
+		log := log.WithField("depositInfo", di)
+
+		if err := di.ValidateForStatus(); err != nil {
+			log.WithError(err).Error("DepositInfo is invalid. This deposit will not be reprocessed until teller is restarted.")
+			s.recordSendError(di, err)
+			continue
+		}
+
+		skyAmt, grossAmt, err := s.sendAmount(di)
+		switch err {
+		case nil:
+		case ErrEmptySendAmount, ErrBelowRegionMinimum:
+			if _, err := s.skipDeposit(di, err); err != nil {
+				return batch, err
+			}
+			continue
+		default:
+			log.WithError(err).Error("sendAmount failed. This deposit will not be reprocessed until teller is restarted.")
+			s.recordSendError(di, err)
+			continue
+		}
+
+		sends = append(sends, di)
+		gross[di.DepositID] = grossAmt
+		amounts = append(amounts, sender.SendAmount{
+			Addr:  di.SkyAddress,
+			Coins: skyAmt,
+		})
+	}
+
+	if len(sends) == 0 {
+		return nil, nil
+	}
+
+	log = log.WithField("sendCount", len(sends))
+	log.Info("Creating skycoin batch transaction")
+
+	_, span := tracing.StartSpan(ctx, "sender.CreateBatchTransaction", tracing.KindClient)
+	span.SetAttribute("batch.size", len(amounts))
+	tx, err := s.sender.CreateBatchTransaction(amounts)
+	span.SetError(err)
+	span.End()
+	if err != nil {
+		log.WithError(err).Error("sender.CreateBatchTransaction failed")
+		return sends, err
+	}
+
+	log = log.WithField("transactionOutput", tx.Out)
+
+	deposits := make([]SendIntentDeposit, len(sends))
+	for i, di := range sends {
+		if err := verifyCreatedTransaction(tx, di, amounts[i].Coins); err != nil {
+			log.WithError(err).Error("verifyCreatedTransaction failed")
+			return sends, err
+		}
+
+		skySent, skyOutput := findOutput(tx, di.SkyAddress)
+		deposits[i] = SendIntentDeposit{
+			DepositID: di.DepositID,
+			SkySent:   skySent,
+			SkyGross:  gross[di.DepositID],
+			SkyOutput: skyOutput,
+		}
+	}
+
+	// Save the send intent before broadcasting, like handleDepositInfoState
+	intent := newSendIntent(tx, deposits)
+	if err := s.store.AddSendIntent(intent); err != nil {
+		log.WithError(err).Error("store.AddSendIntent failed")
+		return sends, err
+	}
+
+	dis, err := s.sendIntent(ctx, intent, sends, true)
+	if err != nil {
+		log.WithError(err).Error("sendIntent failed")
+		return sends, err
+	}
+
+	log.WithField("txid", tx.TxIDHex()).Info("Deposit batch set to StatusWaitConfirm")
+
+	return dis, nil
+}
+
+// batchDepositIDs returns the comma separated IDs of the deposits of a batch
+func batchDepositIDs(batch []DepositInfo) string {
+	ids := make([]string, len(batch))
+	for i, di := range batch {
+		ids[i] = di.DepositID
+	}
+	return strings.Join(ids, ",")
+}
+
+// enqueue queues a deposit for the send loop
+func (s *Exchange) enqueue(di DepositInfo) {
+	s.queueLock.Lock()
+	s.queued[di.DepositID] = struct{}{}
+	s.queueLock.Unlock()
+
+	s.depositChan <- di
+}
+
+// dequeue is called once the send loop is finished with a deposit
+func (s *Exchange) dequeue(di DepositInfo) {
+	s.queueLock.Lock()
+	defer s.queueLock.Unlock()
+	delete(s.queued, di.DepositID)
+}
+
+// setSending records the deposits being sent by the send loop, which Shutdown waits for
+func (s *Exchange) setSending(dis ...DepositInfo) {
+	s.queueLock.Lock()
+	defer s.queueLock.Unlock()
+
+	s.sending = s.sending[:0]
+	for _, di := range dis {
+		s.sending = append(s.sending, di.DepositID)
+	}
+}
+
+// sendingIDs returns the IDs of the deposits being sent by the send loop
+func (s *Exchange) sendingIDs() []string {
+	s.queueLock.Lock()
+	defer s.queueLock.Unlock()
+
+	return append([]string{}, s.sending...)
+}
+
+// interrupted returns true if err is from the sender being shut down after a shutdown of the exchange
+// timed out. The deposit's saved status is unchanged, so it is not a failure of the deposit.
+func (s *Exchange) interrupted(err error) bool {
+	if err != ErrNoResponse {
+		return false
+	}
+
+	select {
+	case <-s.quit:
+		return true
+	default:
+		return false
+	}
+}
+
+// recordSendError saves why an unsent deposit was dropped from the send loop in its Error,
+// so that it can be found and reprocessed
+func (s *Exchange) recordSendError(di DepositInfo, sendErr error) {
+	log := s.log.WithField("depositInfo", di)
+
+	s.notify(alert.EventSendFailed, fmt.Sprintf("Deposit %s failed and will not be retried until it is reprocessed: %v", di.DepositID, sendErr))
+
+	if _, err := s.store.UpdateDepositInfo(di.DepositID, func(di DepositInfo) DepositInfo {
+		if di.Status == StatusWaitSend && di.Txid == "" {
+			di.Error = sendErr.Error()
+		}
+		return di
+	}); err != nil {
+		log.WithError(err).Error("Update DepositInfo Error failed")
+	}
+}
+
+// notify alerts event to the Alerter, if there is one
+func (s *Exchange) notify(event, message string) {
+	if s.alerter != nil {
+		s.alerter.Notify(event, message)
+	}
+}
+
+// ReprocessDeposit resets a deposit that failed without sending skycoins to StatusWaitSend, and queues
+// it to be sent again. If rate is not empty, it replaces the deposit's conversion rate.
+// The reprocessing is recorded in the deposit event log, with the reason and origin of the request.
+func (s *Exchange) ReprocessDeposit(depositID, rate, reason, remoteAddr string) (DepositInfo, error) {
+	log := s.log.WithField("depositID", depositID)
+
+	if rate != "" {
+		if _, err := ParseRate(rate); err != nil {
+			return DepositInfo{}, err
+		}
+	}
+
+	s.queueLock.Lock()
+
+	if _, ok := s.queued[depositID]; ok {
+		s.queueLock.Unlock()
+		return DepositInfo{}, ErrDepositQueued
+	}
+
+	di, err := s.store.ReprocessDepositInfo(depositID, rate, reason, remoteAddr)
+	if err != nil {
+		s.queueLock.Unlock()
+		return DepositInfo{}, err
+	}
+
+	s.queued[depositID] = struct{}{}
+	s.queueLock.Unlock()
+
+	log.WithFields(logrus.Fields{
+		"depositInfo": di,
+		"reason":      reason,
+		"remoteAddr":  remoteAddr,
+	}).Warning("Deposit reprocessed by operator")
+
+	select {
+	case s.depositChan <- di:
+	case <-s.quit:
+	}
+
+	return di, nil
+}
+
+// ReleaseKYCDeposit releases a deposit held for KYC, and queues it to be sent.
+// The release is recorded in the deposit event log, with the reason and origin of the request.
+func (s *Exchange) ReleaseKYCDeposit(depositID, reason, remoteAddr string) (DepositInfo, error) {
+	di, err := s.release(depositID, func() (DepositInfo, error) {
+		return s.store.ReleaseKYCDepositInfo(depositID, reason, remoteAddr)
+	})
+	if err != nil {
+		return DepositInfo{}, err
+	}
+
+	s.log.WithFields(logrus.Fields{
+		"depositInfo": di,
+		"reason":      reason,
+		"remoteAddr":  remoteAddr,
+	}).Warning("Deposit released from KYC hold")
+
+	return di, nil
+}
+
+// ApproveDeposit approves a deposit held for review, and queues it to be sent.
+// The approval is recorded in the deposit event log, with the reason and origin of the request.
+func (s *Exchange) ApproveDeposit(depositID, reason, remoteAddr string) (DepositInfo, error) {
+	di, err := s.release(depositID, func() (DepositInfo, error) {
+		return s.store.ReviewDepositInfo(depositID, true, reason, remoteAddr)
+	})
+	if err != nil {
+		return DepositInfo{}, err
+	}
+
+	s.log.WithFields(logrus.Fields{
+		"depositInfo": di,
+		"reason":      reason,
+		"remoteAddr":  remoteAddr,
+	}).Warning("Deposit approved by operator")
+
+	return di, nil
+}
+
+// RejectDeposit rejects a deposit held for review, nothing is sent for it.
+// The rejection is recorded in the deposit event log, with the reason and origin of the request.
+func (s *Exchange) RejectDeposit(depositID, reason, remoteAddr string) (DepositInfo, error) {
+	di, err := s.store.ReviewDepositInfo(depositID, false, reason, remoteAddr)
+	if err != nil {
+		return DepositInfo{}, err
+	}
+
+	s.log.WithFields(logrus.Fields{
+		"depositInfo": di,
+		"reason":      reason,
+		"remoteAddr":  remoteAddr,
+	}).Warning("Deposit rejected by operator")
+
+	return di, nil
+}
+
+// release changes a held deposit to StatusWaitSend with update, and queues it to be sent
+func (s *Exchange) release(depositID string, update func() (DepositInfo, error)) (DepositInfo, error) {
+	s.queueLock.Lock()
+
+	if _, ok := s.queued[depositID]; ok {
+		s.queueLock.Unlock()
+		return DepositInfo{}, ErrDepositQueued
+	}
+
+	di, err := update()
+	if err != nil {
+		s.queueLock.Unlock()
+		return DepositInfo{}, err
+	}
+
+	s.queued[depositID] = struct{}{}
+	s.queueLock.Unlock()
+
+	select {
+	case s.depositChan <- di:
+	case <-s.quit:
+	}
+
+	return di, nil
+}
+
+// skipDeposit sets a deposit with nothing to send to StatusDone, recording why in its Error
+func (s *Exchange) skipDeposit(di DepositInfo, sendErr error) (DepositInfo, error) {
+	log := s.log.WithField("deposit", di)
+
+	log.WithError(sendErr).Info("Nothing to send, skipping to StatusDone")
+	di, err := s.store.UpdateDepositInfo(di.DepositID, func(di DepositInfo) DepositInfo {
+		di.Status = StatusDone
+		di.Error = sendErr.Error()
+		return di
+	})
+	if err != nil {
+		log.WithError(err).Error("Update DepositInfo set StatusDone failed")
+		return di, err
+	}
+
+	log.WithError(sendErr).Info("DepositInfo set to StatusDone")
+
+	return di, nil
+}
+
+// findOutput returns the coins and the output hash of the output to addr in tx
+func findOutput(tx *coin.Transaction, addr string) (uint64, string) {
+	for _, o := range tx.Out {
+		if o.Address.String() == addr {
+			return o.Coins, o.UxID(tx.Hash()).Hex()
 		}
 	}
 
-	return nil
+	return 0, ""
 }
 
-func (s *Exchange) handleDepositInfoState(di DepositInfo) (DepositInfo, error) {
-	log := s.log.WithField("deposit", di)
+func (s *Exchange) handleDepositInfoState(ctx context.Context, di DepositInfo) (DepositInfo, error) {
+	log := s.log.WithFields(logrus.Fields{
+		"deposit":   di,
+		"depositID": di.DepositID,
+	})
 
 	if err := di.ValidateForStatus(); err != nil {
 		log.WithError(err).Error("handleDepositInfoState's DepositInfo is invalid")
@@ -309,28 +1749,42 @@ func (s *Exchange) handleDepositInfoState(di DepositInfo) (DepositInfo, error) {
 
 	switch di.Status {
 	case StatusWaitSend:
-		// Prepare skycoin transaction
-		skyTx, err := s.createTransaction(di)
-
+		// A deposit with a send intent is only paid by the intent's transaction
+		si, err := s.store.GetDepositSendIntent(di.DepositID)
 		if err != nil {
-			log.WithError(err).Error("createTransaction failed")
+			log.WithError(err).Error("store.GetDepositSendIntent failed")
+			return di, err
+		}
 
-			// If the send amount is empty, skip to StatusDone.
-			if err == ErrEmptySendAmount {
-				log.Info("Send amount is 0, skipping to StatusDone")
-				di, err = s.store.UpdateDepositInfo(di.DepositID, func(di DepositInfo) DepositInfo {
-					di.Status = StatusDone
-					di.Error = ErrEmptySendAmount.Error()
-					return di
-				})
-				if err != nil {
-					log.WithError(err).Error("Update DepositInfo set StatusDone failed")
-					return di, err
+		if si != nil {
+			log.WithField("txid", si.Txid).Warn("Deposit has a send intent, reconciling it instead of creating a transaction")
+
+			dis, err := s.reconcileSendIntent(ctx, *si, true)
+			if err != nil {
+				log.WithError(err).Error("reconcileSendIntent failed")
+				return di, err
+			}
+
+			for _, d := range dis {
+				if d.DepositID == di.DepositID {
+					return d, nil
 				}
+			}
+
+			err = fmt.Errorf("Deposit not found in send intent %s", si.Txid)
+			log.WithError(err).Error(err)
+			return di, err
+		}
+
+		// Prepare skycoin transaction
+		skyTx, skyGross, err := s.createTransaction(ctx, di)
 
-				log.WithError(ErrEmptySendAmount).Info("DepositInfo set to StatusDone")
+		if err != nil {
+			log.WithError(err).Error("createTransaction failed")
 
-				return di, nil
+			// If the send amount is empty or below the region minimum, skip to StatusDone.
+			if err == ErrEmptySendAmount || err == ErrBelowRegionMinimum {
+				return s.skipDeposit(di, err)
 			}
 
 			return di, err
@@ -340,13 +1794,7 @@ func (s *Exchange) handleDepositInfoState(di DepositInfo) (DepositInfo, error) {
 		// The skyTx contains one output sent to the destination address,
 		// so this check is safe.
 		// It is verified earlier by verifyCreatedTransaction
-		var skySent uint64
-		for _, o := range skyTx.Out {
-			if o.Address.String() == di.SkyAddress {
-				skySent = o.Coins
-				break
-			}
-		}
+		skySent, skyOutput := findOutput(skyTx, di.SkyAddress)
 
 		if skySent == 0 {
 			err := errors.New("No output to destination address found in transaction")
@@ -354,45 +1802,42 @@ func (s *Exchange) handleDepositInfoState(di DepositInfo) (DepositInfo, error) {
 			return di, err
 		}
 
-		// Within a bolt.DB transaction, update the db then send the coins
-		// If the send fails, the data is rolled back
-		// If the db save fails, no coins had been sent
-		di, err = s.store.UpdateDepositInfoCallback(di.DepositID, func(di DepositInfo) DepositInfo {
-			di.Status = StatusWaitConfirm
-			di.Txid = skyTx.TxIDHex()
-			di.SkySent = skySent
-			return di
-		}, func(di DepositInfo) error {
-			// NOTE: broadcastTransaction retries indefinitely on error
-			// If the skycoin node is not reachable, this will block,
-			// which will also block the database since it's in a transaction
-			rsp, err := s.broadcastTransaction(skyTx)
-			if err != nil {
-				log.WithError(err).Error("broadcastTransaction failed")
-				return err
-			}
-
-			// Invariant assertion: do not return this as an error, since
-			// coins have been sent. This should never occur.
-			if rsp.Txid != skyTx.TxIDHex() {
-				log.Error("CRITICAL ERROR: BroadcastTxResponse.Txid != skyTx.TxIDHex()")
-			}
-
-			return nil
+		// Save the send intent before broadcasting, so that the deposit is never paid
+		// by another transaction if teller stops before the deposit is saved
+		intent := newSendIntent(skyTx, []SendIntentDeposit{
+			{
+				DepositID: di.DepositID,
+				SkySent:   skySent,
+				SkyGross:  skyGross,
+				SkyOutput: skyOutput,
+			},
 		})
 
+		if err := s.store.AddSendIntent(intent); err != nil {
+			log.WithError(err).Error("store.AddSendIntent failed")
+			return di, err
+		}
+
+		dis, err := s.sendIntent(ctx, intent, []DepositInfo{di}, true)
 		if err != nil {
-			log.WithError(err).Error("store.UpdateDepositInfoCallback failed")
+			log.WithError(err).Error("sendIntent failed")
 			return di, err
 		}
 
 		log.Info("DepositInfo set to StatusWaitConfirm")
 
-		return di, nil
+		return dis[0], nil
 
 	case StatusWaitConfirm:
 		// Wait for confirmation
+		_, span := tracing.StartSpan(ctx, "sender.IsTxConfirmed", tracing.KindClient)
+		span.SetAttribute("skycoin.txid", di.Txid)
 		rsp := s.sender.IsTxConfirmed(di.Txid)
+		if rsp != nil {
+			span.SetError(rsp.Err)
+			span.SetAttribute("skycoin.confirmed", rsp.Confirmed)
+		}
+		span.End()
 
 		if rsp == nil {
 			log.WithError(ErrNoResponse).Warn("Sender closed")
@@ -442,7 +1887,39 @@ func (s *Exchange) handleDepositInfoState(di DepositInfo) (DepositInfo, error) {
 	}
 }
 
-func (s *Exchange) createTransaction(di DepositInfo) (*coin.Transaction, error) {
+// createTransaction creates a transaction sending the coins of a deposit.
+// Returns the transaction and the gross droplets before the fee was deducted.
+func (s *Exchange) createTransaction(ctx context.Context, di DepositInfo) (*coin.Transaction, uint64, error) {
+	log := s.log.WithField("deposit", di)
+
+	skyAmt, grossAmt, err := s.sendAmount(di)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	_, span := tracing.StartSpan(ctx, "sender.CreateTransaction", tracing.KindClient)
+	span.SetAttribute("skycoin.droplets", skyAmt)
+	tx, err := s.sender.CreateTransaction(di.SkyAddress, skyAmt)
+	span.SetError(err)
+	span.End()
+	if err != nil {
+		log.WithError(err).Error("sender.CreateTransaction failed")
+		return nil, 0, err
+	}
+
+	log = log.WithField("transactionOutput", tx.Out)
+
+	if err := verifyCreatedTransaction(tx, di, skyAmt); err != nil {
+		log.WithError(err).Error("verifyCreatedTransaction failed")
+		return nil, 0, err
+	}
+
+	return tx, grossAmt, nil
+}
+
+// sendAmount returns the droplets to send for a deposit after the fee is deducted,
+// and the gross droplets before the fee
+func (s *Exchange) sendAmount(di DepositInfo) (uint64, uint64, error) {
 	log := s.log.WithField("deposit", di)
 
 	// This should never occur, the DepositInfo is saved with a SkyAddress
@@ -450,7 +1927,7 @@ func (s *Exchange) createTransaction(di DepositInfo) (*coin.Transaction, error)
 	if di.SkyAddress == "" {
 		err := ErrNoBoundAddress
 		log.WithError(err).Error(err)
-		return nil, err
+		return 0, 0, err
 	}
 
 	log = log.WithField("skyAddr", di.SkyAddress)
@@ -460,13 +1937,13 @@ func (s *Exchange) createTransaction(di DepositInfo) (*coin.Transaction, error)
 	skyAmt, err := CalculateBtcSkyValue(di.DepositValue, di.ConversionRate, s.cfg.MaxDecimals)
 	if err != nil {
 		log.WithError(err).Error("CalculateBtcSkyValue failed")
-		return nil, err
+		return 0, 0, err
 	}
 
 	skyAmtCoins, err := droplet.ToString(skyAmt)
 	if err != nil {
 		log.WithError(err).Error("droplet.ToString failed")
-		return nil, err
+		return 0, 0, err
 	}
 
 	log = log.WithField("sendAmtDroplets", skyAmt)
@@ -477,23 +1954,32 @@ func (s *Exchange) createTransaction(di DepositInfo) (*coin.Transaction, error)
 	if skyAmt == 0 {
 		err := ErrEmptySendAmount
 		log.WithError(err).Error(err)
-		return nil, err
+		return 0, 0, err
 	}
 
-	tx, err := s.sender.CreateTransaction(di.SkyAddress, skyAmt)
+	if di.Region != "" {
+		if region, ok := s.cfg.Regions[di.Region]; ok && skyAmt < region.MinSky {
+			err := ErrBelowRegionMinimum
+			log.WithError(err).WithField("minSky", region.MinSky).Error(err)
+			return 0, 0, err
+		}
+	}
+
+	netAmt, err := s.cfg.Fee.Apply(skyAmt, s.cfg.MaxDecimals)
 	if err != nil {
-		log.WithError(err).Error("sender.CreateTransaction failed")
-		return nil, err
+		log.WithError(err).Error("Fee.Apply failed")
+		return 0, 0, err
 	}
 
-	log = log.WithField("transactionOutput", tx.Out)
+	log = log.WithField("netAmtDroplets", netAmt)
 
-	if err := verifyCreatedTransaction(tx, di, skyAmt); err != nil {
-		log.WithError(err).Error("verifyCreatedTransaction failed")
-		return nil, err
+	if netAmt == 0 {
+		err := ErrEmptySendAmount
+		log.WithError(err).Error("Fee exceeds the send amount")
+		return 0, 0, err
 	}
 
-	return tx, nil
+	return netAmt, skyAmt, nil
 }
 
 func verifyCreatedTransaction(tx *coin.Transaction, di DepositInfo, skyAmt uint64) error {
@@ -523,12 +2009,18 @@ func verifyCreatedTransaction(tx *coin.Transaction, di DepositInfo, skyAmt uint6
 	return nil
 }
 
-func (s *Exchange) broadcastTransaction(tx *coin.Transaction) (*sender.BroadcastTxResponse, error) {
+func (s *Exchange) broadcastTransaction(ctx context.Context, tx *coin.Transaction) (*sender.BroadcastTxResponse, error) {
 	log := s.log.WithField("txid", tx.TxIDHex())
 
 	log.Info("Broadcasting skycoin transaction")
 
+	_, span := tracing.StartSpan(ctx, "sender.BroadcastTransaction", tracing.KindClient)
+	span.SetAttribute("skycoin.txid", tx.TxIDHex())
 	rsp := s.sender.BroadcastTransaction(tx)
+	if rsp != nil {
+		span.SetError(rsp.Err)
+	}
+	span.End()
 
 	log = log.WithField("sendRsp", rsp)
 
@@ -544,23 +2036,235 @@ func (s *Exchange) broadcastTransaction(tx *coin.Transaction) (*sender.Broadcast
 		return nil, err
 	}
 
-	log.Info("Sent skycoin")
+	logger.Audit(log).Info("Sent skycoin")
 
 	return rsp, nil
 }
 
-// BindAddress binds deposit btc address with skycoin address, and
-// add the btc address to scan service, when detect deposit coin
-// to the btc address, will send specific skycoin to the binded
-// skycoin address
-// TODO -- support multiple coin types
-func (s *Exchange) BindAddress(skyAddr, btcAddr string) error {
-	if err := s.store.BindAddress(skyAddr, btcAddr); err != nil {
+// sendIntent saves the deposits of a send intent as StatusWaitConfirm, then deletes the intent.
+// If broadcast is true, the intent's transaction is broadcast within the bolt.DB transaction saving the deposits:
+// if the broadcast fails, the deposits are rolled back and the intent is kept, so they are only sent by its transaction.
+func (s *Exchange) sendIntent(ctx context.Context, si SendIntent, dis []DepositInfo, broadcast bool) ([]DepositInfo, error) {
+	log := s.log.WithField("txid", si.Txid)
+
+	var tx *coin.Transaction
+	if broadcast {
+		var err error
+		tx, err = si.Transaction()
+		if err != nil {
+			log.WithError(err).Error("SendIntent.Transaction failed")
+			return nil, err
+		}
+	}
+
+	ids := make([]string, len(dis))
+	for i, di := range dis {
+		ids[i] = di.DepositID
+	}
+
+	// Within a bolt.DB transaction, update the db then send the coins
+	// If the send fails, the data is rolled back
+	// If the db save fails, the send intent is reconciled when the deposits are sent again
+	dis, err := s.store.UpdateDepositInfosCallback(ids, func(di DepositInfo) DepositInfo {
+		d, _ := si.deposit(di.DepositID)
+		di.Status = StatusWaitConfirm
+		di.Txid = si.Txid
+		di.Error = ""
+		di.SkySent = d.SkySent
+		di.SkyGross = d.SkyGross
+		di.SkyOutput = d.SkyOutput
+		return di
+	}, func([]DepositInfo) error {
+		if !broadcast {
+			return nil
+		}
+
+		// NOTE: broadcastTransaction retries indefinitely on error
+		// If the skycoin node is not reachable, this will block,
+		// which will also block the database since it's in a transaction
+		rsp, err := s.broadcastTransaction(ctx, tx)
+		if err != nil {
+			log.WithError(err).Error("broadcastTransaction failed")
+			return err
+		}
+
+		// Invariant assertion: do not return this as an error, since
+		// coins have been sent. This should never occur.
+		if rsp.Txid != si.Txid {
+			log.Error("CRITICAL ERROR: BroadcastTxResponse.Txid != SendIntent.Txid")
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		log.WithError(err).Error("store.UpdateDepositInfosCallback failed")
+		return nil, err
+	}
+
+	// The deposits are saved, a send intent left over is deleted by the next reconciliation
+	if err := s.store.DeleteSendIntent(si.Txid); err != nil {
+		log.WithError(err).Error("store.DeleteSendIntent failed")
+	}
+
+	return dis, nil
+}
+
+// reconcileSendIntent checks the skycoin node for the transaction of a send intent whose deposits
+// are still StatusWaitSend. If the node knows the transaction, it was broadcast, and the deposits are
+// saved as StatusWaitConfirm. Otherwise the transaction is broadcast again if rebroadcast is true;
+// it spends the same outputs, so the deposits can't be paid twice.
+// Returns the intent's deposits.
+func (s *Exchange) reconcileSendIntent(ctx context.Context, si SendIntent, rebroadcast bool) ([]DepositInfo, error) {
+	log := s.log.WithField("txid", si.Txid)
+
+	dis, err := s.store.GetDepositInfoArray(func(di DepositInfo) bool {
+		_, ok := si.deposit(di.DepositID)
+		return ok
+	})
+	if err != nil {
+		log.WithError(err).Error("store.GetDepositInfoArray failed")
+		return nil, err
+	}
+
+	var pending []DepositInfo
+	for _, di := range dis {
+		if di.Status == StatusWaitSend {
+			pending = append(pending, di)
+		}
+	}
+
+	if len(pending) == 0 {
+		log.Info("Send intent's deposits were saved, deleting it")
+		if err := s.store.DeleteSendIntent(si.Txid); err != nil {
+			log.WithError(err).Error("store.DeleteSendIntent failed")
+			return nil, err
+		}
+		return dis, nil
+	}
+
+	_, span := tracing.StartSpan(ctx, "sender.GetTransactionStatus", tracing.KindClient)
+	span.SetAttribute("skycoin.txid", si.Txid)
+	st, err := s.sender.GetTransactionStatus(si.Txid)
+	span.SetError(err)
+	span.End()
+	if err != nil {
+		log.WithError(err).Error("sender.GetTransactionStatus failed")
+		return nil, err
+	}
+
+	log = log.WithField("txStatus", st)
+
+	broadcast := st == sender.TxNotFound
+	if broadcast {
+		if !rebroadcast {
+			log.Warn("Send intent's transaction is not known by the skycoin node, it is broadcast when its deposits are sent")
+			return dis, nil
+		}
+
+		log.Warn("Send intent's transaction is not known by the skycoin node, broadcasting it again")
+	} else {
+		log.Warn("Send intent's transaction was broadcast, saving its deposits as StatusWaitConfirm")
+	}
+
+	sent, err := s.sendIntent(ctx, si, pending, broadcast)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, di := range dis {
+		for _, d := range sent {
+			if d.DepositID == di.DepositID {
+				dis[i] = d
+			}
+		}
+	}
+
+	return dis, nil
+}
+
+// reconcileSendIntents reconciles the saved send intents on startup, without broadcasting their transactions.
+// An intent that can't be reconciled, e.g. if the skycoin node is unavailable, is reconciled when its deposits are sent.
+func (s *Exchange) reconcileSendIntents() error {
+	sis, err := s.store.GetSendIntents()
+	if err != nil {
+		return err
+	}
+
+	for _, si := range sis {
+		if _, err := s.reconcileSendIntent(context.Background(), si, false); err != nil {
+			s.log.WithField("txid", si.Txid).WithError(err).Error("reconcileSendIntent failed, it is reconciled when its deposits are sent")
+		}
+	}
+
+	return nil
+}
+
+// hasSendIntent returns true if the deposit has a send intent.
+// If the send intent can't be read, it returns true, so that the error is handled when the deposit is sent alone.
+func (s *Exchange) hasSendIntent(di DepositInfo) bool {
+	si, err := s.store.GetDepositSendIntent(di.DepositID)
+	if err != nil {
+		s.log.WithField("depositInfo", di).WithError(err).Error("store.GetDepositSendIntent failed")
+		return true
+	}
+
+	return si != nil
+}
+
+// BindAddress binds deposit address with skycoin address, and
+// add the deposit address to scan service, when detect deposit coin
+// to the deposit address, will send specific skycoin to the binded
+// skycoin address. campaign is the ID of the campaign the address is bound for, empty if none.
+// promoCode is the promo code the address is bound with, empty if none.
+// expectedValue is the deposit value expected by an invoice, 0 if any value is expected.
+// expiresAt is the unix time the binding expires at unless the address receives a deposit,
+// 0 if it does not expire, see ExpireBindings.
+func (s *Exchange) BindAddress(ctx context.Context, skyAddr, depositAddr, coinType, region, campaign, promoCode string, expectedValue, expiresAt int64) error {
+	log := logger.WithRequestIDField(ctx, s.log).WithFields(logrus.Fields{
+		"skyAddr":       skyAddr,
+		"depositAddr":   depositAddr,
+		"coinType":      coinType,
+		"region":        region,
+		"campaign":      campaign,
+		"promoCode":     promoCode,
+		"expectedValue": expectedValue,
+		"expiresAt":     expiresAt,
+	})
+
+	_, span := tracing.StartSpan(ctx, "exchange.BindAddress", tracing.KindInternal)
+	span.SetAttribute("deposit.address", depositAddr)
+	span.SetAttribute("deposit.coin_type", coinType)
+	defer span.End()
+
+	if _, err := s.rate(coinType); err != nil {
+		log.WithError(err).Error("Coin type is not accepted")
+		span.SetError(err)
 		return err
 	}
 
-	// add btc address to scanner
-	return s.scanner.AddScanAddress(btcAddr)
+	if err := s.store.BindAddress(skyAddr, depositAddr, region, campaign, promoCode, expectedValue, expiresAt); err != nil {
+		log.WithError(err).Error("store.BindAddress failed")
+		span.SetError(err)
+		return err
+	}
+
+	// add deposit address to scanner. An address whose binding expired is scanned already.
+	if err := s.scanner.AddScanAddress(depositAddr, coinType); err != nil {
+		if _, ok := err.(scanner.DuplicateDepositAddressErr); !ok {
+			log.WithError(err).Error("scanner.AddScanAddress failed")
+			span.SetError(err)
+			return err
+		}
+	}
+
+	logger.Audit(log).Info("Bound address")
+
+	if s.anomalies != nil {
+		s.anomalies.ObserveBind(coinType)
+	}
+
+	return nil
 }
 
 // DepositStatus json struct for deposit status
@@ -569,6 +2273,22 @@ type DepositStatus struct {
 	UpdatedAt int64  `json:"updated_at"`
 	Status    string `json:"status"`
 	CoinType  string `json:"coin_type"`
+	// Transaction of the deposit and the index of the deposit in it
+	DepositTxid string `json:"deposit_txid,omitempty"`
+	DepositN    uint32 `json:"deposit_n"`
+	// Confirmations of the deposit at the best height of its blockchain, 0 if it is not known
+	Confirmations         int64 `json:"confirmations"`
+	ConfirmationsRequired int64 `json:"confirmations_required"`
+	// Value expected by the invoice of the deposit address and whether the deposit matched it,
+	// see DepositInfo.PaymentStatus. Omitted if the address was bound without an amount.
+	ExpectedValue int64  `json:"expected_value,omitempty"`
+	PaymentStatus string `json:"payment_status,omitempty"`
+	// Campaign the deposit address was bound for, omitted if none
+	Campaign string `json:"campaign,omitempty"`
+	// Promo code the deposit address was bound with, omitted if none
+	PromoCode string `json:"promo_code,omitempty"`
+	// Status changes of the deposit, oldest first. Only included if requested.
+	History []DepositStatusChange `json:"history,omitempty"`
 }
 
 // DepositStatusDetail deposit status detail info
@@ -580,27 +2300,113 @@ type DepositStatusDetail struct {
 	DepositAddress string `json:"deposit_address"`
 	CoinType       string `json:"coin_type"`
 	Txid           string `json:"txid"`
+	SkyOutput      string `json:"skycoin_output,omitempty"`
+	DepositID      string `json:"deposit_id,omitempty"`
+	ExpectedValue  int64  `json:"expected_value,omitempty"`
+	PaymentStatus  string `json:"payment_status,omitempty"`
+	Campaign       string `json:"campaign,omitempty"`
+	PromoCode      string `json:"promo_code,omitempty"`
+	Error          string `json:"error,omitempty"`
+}
+
+// NewDepositStatusDetail creates a DepositStatusDetail from a DepositInfo
+func NewDepositStatusDetail(di DepositInfo) DepositStatusDetail {
+	return DepositStatusDetail{
+		Seq:            di.Seq,
+		UpdatedAt:      di.UpdatedAt,
+		Status:         di.Status.String(),
+		SkyAddress:     di.SkyAddress,
+		DepositAddress: di.DepositAddress,
+		Txid:           di.Txid,
+		SkyOutput:      di.SkyOutput,
+		CoinType:       di.CoinType,
+		DepositID:      di.DepositID,
+		ExpectedValue:  di.ExpectedValue,
+		PaymentStatus:  di.PaymentStatus(),
+		Campaign:       di.Campaign,
+		PromoCode:      di.PromoCode,
+		Error:          di.Error,
+	}
 }
 
-// GetDepositStatuses returns deamon.DepositStatus array of given skycoin address
-func (s *Exchange) GetDepositStatuses(skyAddr string) ([]DepositStatus, error) {
+// GetDepositStatuses returns deamon.DepositStatus array of given skycoin address.
+// If history is true, the status changes of each deposit are included.
+// StatusIgnoredDust deposits are left out if cfg.HideDust is set.
+func (s *Exchange) GetDepositStatuses(skyAddr string, history bool) ([]DepositStatus, error) {
 	dis, err := s.store.GetDepositInfoOfSkyAddress(skyAddr)
 	if err != nil {
 		return []DepositStatus{}, err
 	}
 
+	paused := s.Paused()
+
 	dss := make([]DepositStatus, 0, len(dis))
 	for _, di := range dis {
-		dss = append(dss, DepositStatus{
-			Seq:       di.Seq,
-			UpdatedAt: di.UpdatedAt,
-			Status:    di.Status.String(),
-			CoinType:  di.CoinType,
-		})
+		if s.cfg.HideDust && di.Status == StatusIgnoredDust {
+			continue
+		}
+
+		status := di.Status.String()
+		if paused && di.Status == StatusWaitSend {
+			status = StatusPaused
+		}
+
+		// Deposits saved before DepositTx was added only have the transaction in di.Deposit,
+		// and were received with the current confirmations
+		if di.DepositTx == "" {
+			di.DepositTx = di.Deposit.Tx
+			di.DepositN = di.Deposit.N
+			di.DepositHeight = di.Deposit.Height
+			di.ConfirmationsRequired = s.cfg.ConfirmationsRequired[di.CoinType]
+		}
+
+		ds := DepositStatus{
+			Seq:                   di.Seq,
+			UpdatedAt:             di.UpdatedAt,
+			Status:                status,
+			CoinType:              di.CoinType,
+			DepositTxid:           di.DepositTx,
+			DepositN:              di.DepositN,
+			Confirmations:         s.confirmations(di),
+			ConfirmationsRequired: di.ConfirmationsRequired,
+			ExpectedValue:         di.ExpectedValue,
+			PaymentStatus:         di.PaymentStatus(),
+			Campaign:              di.Campaign,
+			PromoCode:             di.PromoCode,
+		}
+
+		// An address without a deposit yet has no history
+		if history && di.DepositID != "" {
+			_, evs, err := s.store.GetDepositHistory(di.DepositID)
+			if err != nil {
+				return []DepositStatus{}, err
+			}
+
+			ds.History = statusHistory(evs)
+		}
+
+		dss = append(dss, ds)
 	}
 	return dss, nil
 }
 
+// confirmations returns the confirmations of a deposit at the best height of its blockchain,
+// counted like the scanners count them: a block at the best height has 0 confirmations.
+// Returns 0 if the best height is not known.
+func (s *Exchange) confirmations(di DepositInfo) int64 {
+	h, ok := s.heighters[di.CoinType]
+	if !ok || di.DepositHeight <= 0 {
+		return 0
+	}
+
+	best := h.BestHeight()
+	if best < di.DepositHeight {
+		return 0
+	}
+
+	return best - di.DepositHeight
+}
+
 // GetDepositStatusDetail returns deposit status details
 func (s *Exchange) GetDepositStatusDetail(flt DepositFilter) ([]DepositStatusDetail, error) {
 	dis, err := s.store.GetDepositInfoArray(flt)
@@ -610,19 +2416,182 @@ func (s *Exchange) GetDepositStatusDetail(flt DepositFilter) ([]DepositStatusDet
 
 	dss := make([]DepositStatusDetail, 0, len(dis))
 	for _, di := range dis {
-		dss = append(dss, DepositStatusDetail{
-			Seq:            di.Seq,
-			UpdatedAt:      di.UpdatedAt,
-			Status:         di.Status.String(),
-			SkyAddress:     di.SkyAddress,
-			DepositAddress: di.DepositAddress,
-			Txid:           di.Txid,
-			CoinType:       di.CoinType,
-		})
+		dss = append(dss, NewDepositStatusDetail(di))
+	}
+	return dss, nil
+}
+
+// QueryDepositStatusDetail returns the status details of the deposits matching q, looked up with the store's indexes
+func (s *Exchange) QueryDepositStatusDetail(q DepositQuery) ([]DepositStatusDetail, error) {
+	dis, err := s.store.QueryDepositInfos(q)
+	if err != nil {
+		return nil, err
+	}
+
+	dss := make([]DepositStatusDetail, 0, len(dis))
+	for _, di := range dis {
+		dss = append(dss, NewDepositStatusDetail(di))
 	}
 	return dss, nil
 }
 
+// DepositDetail is a deposit with the rate it was converted at and its status history
+type DepositDetail struct {
+	DepositStatusDetail
+	DepositValue   int64  `json:"deposit_value"`
+	ConversionRate string `json:"conversion_rate"`
+	SkySent        uint64 `json:"sky_sent"`
+	SkyGross       uint64 `json:"sky_gross"`
+	// Status changes of the deposit, oldest first
+	History []DepositStatusChange `json:"history"`
+}
+
+// DepositStatusChange is a status change in the history of a DepositDetail
+type DepositStatusChange struct {
+	Status string `json:"status"`
+	// Unix time of the change
+	Time int64 `json:"time"`
+}
+
+// GetDepositDetail returns the deposit with depositID, which is "<txid>:<vout>" for BTC and LTC deposits.
+// Returns ErrDepositNotFound if the deposit does not exist.
+func (s *Exchange) GetDepositDetail(depositID string) (DepositDetail, error) {
+	di, evs, err := s.store.GetDepositHistory(depositID)
+	if err != nil {
+		return DepositDetail{}, err
+	}
+
+	dd := DepositDetail{
+		DepositStatusDetail: NewDepositStatusDetail(di),
+		DepositValue:        di.DepositValue,
+		ConversionRate:      di.ConversionRate,
+		SkySent:             di.SkySent,
+		SkyGross:            di.SkyGross,
+		History:             statusHistory(evs),
+	}
+
+	if s.Paused() && di.Status == StatusWaitSend {
+		dd.Status = StatusPaused
+	}
+
+	return dd, nil
+}
+
+// statusHistory returns the status changes recorded by the events of a deposit
+func statusHistory(evs []DepositEvent) []DepositStatusChange {
+	history := []DepositStatusChange{}
+
+	// A deposit is updated more often than its status changes, e.g. when its skycoin txid is set
+	for _, ev := range evs {
+		status := ev.DepositInfo.Status.String()
+		if n := len(history); n != 0 && history[n-1].Status == status {
+			continue
+		}
+
+		history = append(history, DepositStatusChange{
+			Status: status,
+			Time:   ev.Time,
+		})
+	}
+
+	return history
+}
+
+// DepositAuditEvent is an entry of the audit log of a deposit: a change of the deposit, or an operator action
+type DepositAuditEvent struct {
+	Seq uint64 `json:"seq"`
+	// Unix time of the event
+	Time int64     `json:"time"`
+	Type EventType `json:"type"`
+	// The deposit after the event
+	Status         string `json:"status"`
+	ConversionRate string `json:"conversion_rate"`
+	Txid           string `json:"txid,omitempty"`
+	SkySent        uint64 `json:"sky_sent,omitempty"`
+	Error          string `json:"error,omitempty"`
+	// Reason and remote address of an operator's reprocess request
+	Reason     string `json:"reason,omitempty"`
+	RemoteAddr string `json:"remote_addr,omitempty"`
+}
+
+// DepositAuditLog is a deposit with every change of it, for support and audits
+type DepositAuditLog struct {
+	Deposit DepositStatusDetail `json:"deposit"`
+	// Events of the deposit, oldest first
+	Events []DepositAuditEvent `json:"events"`
+}
+
+// GetDepositAuditLog returns the audit log of the deposit with depositID.
+// Returns ErrDepositNotFound if the deposit does not exist.
+func (s *Exchange) GetDepositAuditLog(depositID string) (DepositAuditLog, error) {
+	di, evs, err := s.store.GetDepositHistory(depositID)
+	if err != nil {
+		return DepositAuditLog{}, err
+	}
+
+	al := DepositAuditLog{
+		Deposit: NewDepositStatusDetail(di),
+		Events:  make([]DepositAuditEvent, 0, len(evs)),
+	}
+
+	for _, ev := range evs {
+		al.Events = append(al.Events, DepositAuditEvent{
+			Seq:            ev.Seq,
+			Time:           ev.Time,
+			Type:           ev.Type,
+			Status:         ev.DepositInfo.Status.String(),
+			ConversionRate: ev.DepositInfo.ConversionRate,
+			Txid:           ev.DepositInfo.Txid,
+			SkySent:        ev.DepositInfo.SkySent,
+			Error:          ev.DepositInfo.Error,
+			Reason:         ev.Reason,
+			RemoteAddr:     ev.RemoteAddr,
+		})
+	}
+
+	return al, nil
+}
+
+// ExpireBindings unbinds the deposit addresses whose bindings expired without receiving a deposit,
+// and returns the removed bindings, whose addresses can be returned to the address pools
+func (s *Exchange) ExpireBindings() ([]Binding, error) {
+	bs, err := s.store.ExpireBindings(time.Now())
+	if err != nil {
+		s.log.WithError(err).Error("store.ExpireBindings failed")
+		return nil, err
+	}
+
+	for _, b := range bs {
+		logger.Audit(s.log).WithFields(logrus.Fields{
+			"skyAddr":     b.SkyAddress,
+			"depositAddr": b.DepositAddress,
+			"campaign":    b.Campaign,
+		}).Info("Binding expired, unbound address")
+	}
+
+	return bs, nil
+}
+
+// RecycleBindings unbinds the deposit addresses whose deposits were all processed more than coolDown ago,
+// and returns the removed bindings, whose addresses can be returned to the address pools
+func (s *Exchange) RecycleBindings(coolDown time.Duration) ([]Binding, error) {
+	bs, err := s.store.RecycleBindings(time.Now().Add(-coolDown))
+	if err != nil {
+		s.log.WithError(err).Error("store.RecycleBindings failed")
+		return nil, err
+	}
+
+	for _, b := range bs {
+		logger.Audit(s.log).WithFields(logrus.Fields{
+			"skyAddr":     b.SkyAddress,
+			"depositAddr": b.DepositAddress,
+			"campaign":    b.Campaign,
+		}).Info("Deposits processed, recycled address")
+	}
+
+	return bs, nil
+}
+
 // GetBindNum returns the number of btc address the given sky address binded
 func (s *Exchange) GetBindNum(skyAddr string) (int, error) {
 	addrs, err := s.store.GetSkyBindBtcAddresses(skyAddr)
@@ -639,3 +2608,15 @@ func (s *Exchange) GetDepositStats() (stats *DepositStats, err error) {
 		TotalSKYSent:     tss,
 	}, nil
 }
+
+// GetCampaignDepositStats returns the deposit stats of the deposits of a campaign
+func (s *Exchange) GetCampaignDepositStats(campaign string) (*DepositStats, error) {
+	tbr, tss, err := s.store.GetCampaignDepositStats(campaign)
+	if err != nil {
+		return nil, err
+	}
+	return &DepositStats{
+		TotalBTCReceived: tbr,
+		TotalSKYSent:     tss,
+	}, nil
+}
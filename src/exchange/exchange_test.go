@@ -1,8 +1,11 @@
 package exchange
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"log"
+	"strconv"
 	"strings"
 	"sync"
 	"testing"
@@ -18,8 +21,11 @@ import (
 	"github.com/skycoin/skycoin/src/cipher"
 	"github.com/skycoin/skycoin/src/coin"
 
+	"github.com/skycoin/teller/src/alert"
+	"github.com/skycoin/teller/src/pricing"
 	"github.com/skycoin/teller/src/scanner"
 	"github.com/skycoin/teller/src/sender"
+	"github.com/skycoin/teller/src/util/logger"
 	"github.com/skycoin/teller/src/util/testutil"
 )
 
@@ -28,39 +34,58 @@ type dummySender struct {
 	createTransactionErr    error
 	broadcastTransactionErr error
 	confirmErr              error
+	txStatusErr             error
 	txidConfirmMap          map[string]bool
+	broadcasts              map[string]int
 	changeAddr              string
 	changeCoins             uint64
+	// If set, BroadcastTransaction blocks until it is closed and returns no response, like a sender that
+	// retries a broadcast until it is shut down
+	broadcastBlock chan struct{}
 }
 
 func newDummySender() *dummySender {
 	return &dummySender{
 		txidConfirmMap: make(map[string]bool),
+		broadcasts:     make(map[string]int),
 		changeAddr:     "nYTKxHm6SZWAMdDVx6U9BqxKMuCjmSLp93",
 		changeCoins:    111e6,
 	}
 }
 
 func (s *dummySender) CreateTransaction(destAddr string, coins uint64) (*coin.Transaction, error) {
+	return s.CreateBatchTransaction([]sender.SendAmount{
+		{
+			Addr:  destAddr,
+			Coins: coins,
+		},
+	})
+}
+
+func (s *dummySender) CreateBatchTransaction(amounts []sender.SendAmount) (*coin.Transaction, error) {
 	if s.createTransactionErr != nil {
 		return nil, s.createTransactionErr
 	}
 
-	addr := cipher.MustDecodeBase58Address(destAddr)
 	changeAddr := cipher.MustDecodeBase58Address(s.changeAddr)
 
-	return &coin.Transaction{
+	tx := &coin.Transaction{
 		Out: []coin.TransactionOutput{
 			{
 				Address: changeAddr,
 				Coins:   s.changeCoins,
 			},
-			{
-				Address: addr,
-				Coins:   coins,
-			},
 		},
-	}, nil
+	}
+
+	for _, amt := range amounts {
+		tx.Out = append(tx.Out, coin.TransactionOutput{
+			Address: cipher.MustDecodeBase58Address(amt.Addr),
+			Coins:   amt.Coins,
+		})
+	}
+
+	return tx, nil
 }
 
 func (s *dummySender) BroadcastTransaction(tx *coin.Transaction) *sender.BroadcastTxResponse {
@@ -69,6 +94,14 @@ func (s *dummySender) BroadcastTransaction(tx *coin.Transaction) *sender.Broadca
 		RspC: make(chan *sender.BroadcastTxResponse, 1),
 	}
 
+	if s.broadcastBlock != nil {
+		<-s.broadcastBlock
+		return nil
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
 	if s.broadcastTransactionErr != nil {
 		return &sender.BroadcastTxResponse{
 			Err: s.broadcastTransactionErr,
@@ -76,6 +109,8 @@ func (s *dummySender) BroadcastTransaction(tx *coin.Transaction) *sender.Broadca
 		}
 	}
 
+	s.broadcasts[tx.TxIDHex()]++
+
 	return &sender.BroadcastTxResponse{
 		Txid: tx.TxIDHex(),
 		Req:  req,
@@ -104,12 +139,41 @@ func (s *dummySender) IsTxConfirmed(txid string) *sender.ConfirmResponse {
 	}
 }
 
+func (s *dummySender) GetTransactionStatus(txid string) (sender.TxStatus, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	switch {
+	case s.txStatusErr != nil:
+		return sender.TxNotFound, s.txStatusErr
+	case s.txidConfirmMap[txid]:
+		return sender.TxConfirmed, nil
+	case s.broadcasts[txid] > 0:
+		return sender.TxUnconfirmed, nil
+	default:
+		return sender.TxNotFound, nil
+	}
+}
+
+func (s *dummySender) broadcastCount(txid string) int {
+	s.RLock()
+	defer s.RUnlock()
+
+	return s.broadcasts[txid]
+}
+
 func (s *dummySender) predictTxid(t *testing.T, destAddr string, coins uint64) string {
 	tx, err := s.CreateTransaction(destAddr, coins)
 	require.NoError(t, err)
 	return tx.TxIDHex()
 }
 
+func (s *dummySender) predictOutput(t *testing.T, destAddr string, coins uint64) string {
+	tx, err := s.CreateTransaction(destAddr, coins)
+	require.NoError(t, err)
+	return tx.Out[1].UxID(tx.Hash()).Hex()
+}
+
 func (s *dummySender) setTxConfirmed(txid string) {
 	s.Lock()
 	defer s.Unlock()
@@ -118,8 +182,9 @@ func (s *dummySender) setTxConfirmed(txid string) {
 }
 
 type dummyScanner struct {
-	dvC   chan scanner.DepositNote
-	addrs []string
+	dvC       chan scanner.DepositNote
+	addrs     []string
+	coinTypes []string
 }
 
 func newDummyScanner() *dummyScanner {
@@ -128,8 +193,15 @@ func newDummyScanner() *dummyScanner {
 	}
 }
 
-func (scan *dummyScanner) AddScanAddress(btcAddr string) error {
-	scan.addrs = append(scan.addrs, btcAddr)
+func (scan *dummyScanner) AddScanAddress(addr, coinType string) error {
+	for _, a := range scan.addrs {
+		if a == addr {
+			return scanner.NewDuplicateDepositAddressErr(addr)
+		}
+	}
+
+	scan.addrs = append(scan.addrs, addr)
+	scan.coinTypes = append(scan.coinTypes, coinType)
 	return nil
 }
 
@@ -159,11 +231,11 @@ const (
 )
 
 func newTestExchange(t *testing.T, log *logrus.Logger, db *bolt.DB) *Exchange {
-	store, err := NewStore(log, db)
+	store, err := NewStore(log, db, nil)
 	require.NoError(t, err)
 
 	e, err := NewExchange(log, store, newDummyScanner(), newDummySender(), Config{
-		Rate: testSkyBtcRate,
+		Rate:                    testSkyBtcRate,
 		TxConfirmationCheckWait: time.Millisecond * 100,
 	})
 	require.NoError(t, err)
@@ -199,10 +271,12 @@ func runExchange(t *testing.T) (*Exchange, func(), *logrus_test.Hook) {
 
 func runExchangeMockStore(t *testing.T) (*Exchange, func(), *logrus_test.Hook) {
 	store := &MockStore{}
+	store.On("GetPauseState").Return(PauseState{}, nil)
+	store.On("GetSendIntents").Return(nil, nil)
 	log, hook := testutil.NewLogger(t)
 
 	e, err := NewExchange(log, store, newDummyScanner(), newDummySender(), Config{
-		Rate: testSkyBtcRate,
+		Rate:                    testSkyBtcRate,
 		TxConfirmationCheckWait: time.Millisecond * 100,
 	})
 	require.NoError(t, err)
@@ -244,21 +318,23 @@ func TestExchangeRunSend(t *testing.T) {
 
 	skyAddr := testSkyAddr
 	btcAddr := "foo-btc-addr"
-	err := e.store.BindAddress(skyAddr, btcAddr)
+	err := e.store.BindAddress(skyAddr, btcAddr, "", "", "", 0, 0)
 	require.NoError(t, err)
 
 	var value int64 = 1e8
 	skySent, err := CalculateBtcSkyValue(value, testSkyBtcRate, testMaxDecimals)
 	require.NoError(t, err)
 	txid := e.sender.(*dummySender).predictTxid(t, skyAddr, skySent)
+	skyOutput := e.sender.(*dummySender).predictOutput(t, skyAddr, skySent)
 
 	dn := scanner.DepositNote{
 		Deposit: scanner.Deposit{
-			Address: btcAddr,
-			Value:   value,
-			Height:  20,
-			Tx:      "foo-tx",
-			N:       2,
+			CoinType: scanner.CoinTypeBTC,
+			Address:  btcAddr,
+			Value:    value,
+			Height:   20,
+			Tx:       "foo-tx",
+			N:        2,
 		},
 		ErrC: make(chan error, 1),
 	}
@@ -306,11 +382,17 @@ func TestExchangeRunSend(t *testing.T) {
 		Seq:            1,
 		UpdatedAt:      di.UpdatedAt,
 		Status:         StatusWaitConfirm,
+		CoinType:       scanner.CoinTypeBTC,
 		SkyAddress:     skyAddr,
 		DepositAddress: dn.Deposit.Address,
 		DepositID:      dn.Deposit.ID(),
+		DepositTx:      dn.Deposit.Tx,
+		DepositN:       dn.Deposit.N,
+		DepositHeight:  dn.Deposit.Height,
 		Txid:           txid,
 		SkySent:        100e6,
+		SkyGross:       100e6,
+		SkyOutput:      skyOutput,
 		ConversionRate: testSkyBtcRate,
 		DepositValue:   dn.Deposit.Value,
 		Deposit:        dn.Deposit,
@@ -353,11 +435,17 @@ func TestExchangeRunSend(t *testing.T) {
 		Seq:            1,
 		UpdatedAt:      di.UpdatedAt,
 		Status:         StatusDone,
+		CoinType:       scanner.CoinTypeBTC,
 		SkyAddress:     skyAddr,
 		DepositAddress: dn.Deposit.Address,
 		DepositID:      dn.Deposit.ID(),
+		DepositTx:      dn.Deposit.Tx,
+		DepositN:       dn.Deposit.N,
+		DepositHeight:  dn.Deposit.Height,
 		Txid:           txid,
 		SkySent:        100e6,
+		SkyGross:       100e6,
+		SkyOutput:      skyOutput,
 		ConversionRate: testSkyBtcRate,
 		DepositValue:   dn.Deposit.Value,
 		Deposit:        dn.Deposit,
@@ -378,7 +466,7 @@ func TestExchangeUpdateBroadcastTxFailure(t *testing.T) {
 
 	skyAddr := testSkyAddr
 	btcAddr := "foo-btc-addr"
-	err := e.store.BindAddress(skyAddr, btcAddr)
+	err := e.store.BindAddress(skyAddr, btcAddr, "", "", "", 0, 0)
 	require.NoError(t, err)
 
 	// Force sender to return a broadcast tx error so that the deposit stays at StatusWaitSend
@@ -386,11 +474,12 @@ func TestExchangeUpdateBroadcastTxFailure(t *testing.T) {
 
 	dn := scanner.DepositNote{
 		Deposit: scanner.Deposit{
-			Address: btcAddr,
-			Value:   1e8,
-			Height:  20,
-			Tx:      "foo-tx",
-			N:       2,
+			CoinType: scanner.CoinTypeBTC,
+			Address:  btcAddr,
+			Value:    1e8,
+			Height:   20,
+			Tx:       "foo-tx",
+			N:        2,
 		},
 		ErrC: make(chan error, 1),
 	}
@@ -409,9 +498,13 @@ func TestExchangeUpdateBroadcastTxFailure(t *testing.T) {
 	require.Equal(t, DepositInfo{
 		Seq:            1,
 		UpdatedAt:      di.UpdatedAt,
+		CoinType:       scanner.CoinTypeBTC,
 		SkyAddress:     skyAddr,
 		DepositAddress: btcAddr,
 		DepositID:      dn.Deposit.ID(),
+		DepositTx:      dn.Deposit.Tx,
+		DepositN:       dn.Deposit.N,
+		DepositHeight:  dn.Deposit.Height,
 		Status:         StatusWaitSend,
 		ConversionRate: testSkyBtcRate,
 		DepositValue:   dn.Deposit.Value,
@@ -430,7 +523,7 @@ func TestExchangeCreateTxFailure(t *testing.T) {
 
 	skyAddr := testSkyAddr
 	btcAddr := "foo-btc-addr"
-	err := e.store.BindAddress(skyAddr, btcAddr)
+	err := e.store.BindAddress(skyAddr, btcAddr, "", "", "", 0, 0)
 	require.NoError(t, err)
 
 	// Force sender to return a create tx error so that the deposit stays at StatusWaitSend
@@ -438,11 +531,12 @@ func TestExchangeCreateTxFailure(t *testing.T) {
 
 	dn := scanner.DepositNote{
 		Deposit: scanner.Deposit{
-			Address: btcAddr,
-			Value:   1e8,
-			Height:  20,
-			Tx:      "foo-tx",
-			N:       2,
+			CoinType: scanner.CoinTypeBTC,
+			Address:  btcAddr,
+			Value:    1e8,
+			Height:   20,
+			Tx:       "foo-tx",
+			N:        2,
 		},
 		ErrC: make(chan error, 1),
 	}
@@ -460,9 +554,13 @@ func TestExchangeCreateTxFailure(t *testing.T) {
 	require.Equal(t, DepositInfo{
 		Seq:            1,
 		UpdatedAt:      di.UpdatedAt,
+		CoinType:       scanner.CoinTypeBTC,
 		SkyAddress:     skyAddr,
 		DepositAddress: btcAddr,
 		DepositID:      dn.Deposit.ID(),
+		DepositTx:      dn.Deposit.Tx,
+		DepositN:       dn.Deposit.N,
+		DepositHeight:  dn.Deposit.Height,
 		Status:         StatusWaitSend,
 		ConversionRate: testSkyBtcRate,
 		DepositValue:   dn.Deposit.Value,
@@ -477,24 +575,26 @@ func TestExchangeTxConfirmFailure(t *testing.T) {
 
 	skyAddr := testSkyAddr
 	btcAddr := "foo-btc-addr"
-	err := e.store.BindAddress(skyAddr, btcAddr)
+	err := e.store.BindAddress(skyAddr, btcAddr, "", "", "", 0, 0)
 	require.NoError(t, err)
 
 	var value int64 = 1e8
 	skySent, err := CalculateBtcSkyValue(value, testSkyBtcRate, testMaxDecimals)
 	require.NoError(t, err)
 	txid := e.sender.(*dummySender).predictTxid(t, skyAddr, skySent)
+	skyOutput := e.sender.(*dummySender).predictOutput(t, skyAddr, skySent)
 
 	// Force sender to return a confirm error so that the deposit stays at StatusWaitConfirm
 	e.sender.(*dummySender).confirmErr = errors.New("fake confirm error")
 
 	dn := scanner.DepositNote{
 		Deposit: scanner.Deposit{
-			Address: btcAddr,
-			Value:   value,
-			Height:  20,
-			Tx:      "foo-tx",
-			N:       2,
+			CoinType: scanner.CoinTypeBTC,
+			Address:  btcAddr,
+			Value:    value,
+			Height:   20,
+			Tx:       "foo-tx",
+			N:        2,
 		},
 		ErrC: make(chan error, 1),
 	}
@@ -534,11 +634,17 @@ func TestExchangeTxConfirmFailure(t *testing.T) {
 	require.Equal(t, DepositInfo{
 		Seq:            1,
 		UpdatedAt:      di.UpdatedAt,
+		CoinType:       scanner.CoinTypeBTC,
 		SkyAddress:     skyAddr,
 		DepositAddress: btcAddr,
 		DepositID:      dn.Deposit.ID(),
+		DepositTx:      dn.Deposit.Tx,
+		DepositN:       dn.Deposit.N,
+		DepositHeight:  dn.Deposit.Height,
 		Txid:           txid,
 		SkySent:        100e6,
+		SkyGross:       100e6,
+		SkyOutput:      skyOutput,
 		DepositValue:   dn.Deposit.Value,
 		Status:         StatusWaitConfirm,
 		ConversionRate: testSkyBtcRate,
@@ -553,21 +659,23 @@ func TestExchangeQuitBeforeConfirm(t *testing.T) {
 
 	skyAddr := testSkyAddr
 	btcAddr := "foo-btc-addr"
-	err := e.store.BindAddress(skyAddr, btcAddr)
+	err := e.store.BindAddress(skyAddr, btcAddr, "", "", "", 0, 0)
 	require.NoError(t, err)
 
 	var value int64 = 1e8
 	skySent, err := CalculateBtcSkyValue(value, testSkyBtcRate, testMaxDecimals)
 	require.NoError(t, err)
 	txid := e.sender.(*dummySender).predictTxid(t, skyAddr, skySent)
+	skyOutput := e.sender.(*dummySender).predictOutput(t, skyAddr, skySent)
 
 	dn := scanner.DepositNote{
 		Deposit: scanner.Deposit{
-			Address: btcAddr,
-			Value:   value,
-			Height:  20,
-			Tx:      "foo-tx",
-			N:       2,
+			CoinType: scanner.CoinTypeBTC,
+			Address:  btcAddr,
+			Value:    value,
+			Height:   20,
+			Tx:       "foo-tx",
+			N:        2,
 		},
 		ErrC: make(chan error, 1),
 	}
@@ -584,11 +692,17 @@ func TestExchangeQuitBeforeConfirm(t *testing.T) {
 	expectedDeposit := DepositInfo{
 		Seq:            1,
 		Status:         StatusWaitConfirm,
+		CoinType:       scanner.CoinTypeBTC,
 		SkyAddress:     skyAddr,
 		DepositAddress: dn.Deposit.Address,
 		DepositID:      dn.Deposit.ID(),
+		DepositTx:      dn.Deposit.Tx,
+		DepositN:       dn.Deposit.N,
+		DepositHeight:  dn.Deposit.Height,
 		Txid:           txid,
 		SkySent:        100e6,
+		SkyGross:       100e6,
+		SkyOutput:      skyOutput,
 		DepositValue:   dn.Deposit.Value,
 		ConversionRate: testSkyBtcRate,
 		Deposit:        dn.Deposit,
@@ -646,16 +760,17 @@ func TestExchangeSendZeroCoins(t *testing.T) {
 
 	skyAddr := testSkyAddr
 	btcAddr := "foo-btc-addr"
-	err := e.store.BindAddress(skyAddr, btcAddr)
+	err := e.store.BindAddress(skyAddr, btcAddr, "", "", "", 0, 0)
 	require.NoError(t, err)
 
 	dn := scanner.DepositNote{
 		Deposit: scanner.Deposit{
-			Address: btcAddr,
-			Value:   1, // The amount is so low that no SKY can be sent
-			Height:  20,
-			Tx:      "foo-tx",
-			N:       2,
+			CoinType: scanner.CoinTypeBTC,
+			Address:  btcAddr,
+			Value:    1, // The amount is so low that no SKY can be sent
+			Height:   20,
+			Tx:       "foo-tx",
+			N:        2,
 		},
 		ErrC: make(chan error, 1),
 	}
@@ -672,9 +787,13 @@ func TestExchangeSendZeroCoins(t *testing.T) {
 	expectedDeposit := DepositInfo{
 		Seq:            1,
 		Status:         StatusDone,
+		CoinType:       scanner.CoinTypeBTC,
 		SkyAddress:     skyAddr,
 		DepositAddress: dn.Deposit.Address,
 		DepositID:      dn.Deposit.ID(),
+		DepositTx:      dn.Deposit.Tx,
+		DepositN:       dn.Deposit.N,
+		DepositHeight:  dn.Deposit.Height,
 		Txid:           "",
 		SkySent:        0,
 		ConversionRate: testSkyBtcRate,
@@ -807,6 +926,7 @@ func testExchangeRunProcessDepositBacklog(t *testing.T, dis []DepositInfo, confi
 			amt, err := CalculateBtcSkyValue(di.DepositValue, e.cfg.Rate, testMaxDecimals)
 			require.NoError(t, err)
 			expectedDis[i].SkySent = amt
+			expectedDis[i].SkyGross = amt
 		}
 
 		require.NotEmpty(t, confirmed[i].UpdatedAt)
@@ -841,11 +961,12 @@ func TestExchangeProcessUnconfirmedTx(t *testing.T) {
 			ConversionRate: testSkyBtcRate,
 			DepositValue:   depositValue,
 			Deposit: scanner.Deposit{
-				Address: "foo-btc-addr-1",
-				Value:   depositValue,
-				Height:  20,
-				Tx:      "foo-tx-1",
-				N:       1,
+				CoinType: scanner.CoinTypeBTC,
+				Address:  "foo-btc-addr-1",
+				Value:    depositValue,
+				Height:   20,
+				Tx:       "foo-tx-1",
+				N:        1,
 			},
 		},
 		{
@@ -859,11 +980,12 @@ func TestExchangeProcessUnconfirmedTx(t *testing.T) {
 			ConversionRate: testSkyBtcRate,
 			DepositValue:   depositValue,
 			Deposit: scanner.Deposit{
-				Address: "foo-btc-addr-2",
-				Value:   depositValue,
-				Height:  20,
-				Tx:      "foo-tx-2",
-				N:       2,
+				CoinType: scanner.CoinTypeBTC,
+				Address:  "foo-btc-addr-2",
+				Value:    depositValue,
+				Height:   20,
+				Tx:       "foo-tx-2",
+				N:        2,
 			},
 		},
 	}
@@ -883,6 +1005,8 @@ func TestExchangeProcessWaitSendDeposits(t *testing.T) {
 	require.NoError(t, err)
 	txid1 := s.predictTxid(t, testSkyAddr, skySent)
 	txid2 := s.predictTxid(t, testSkyAddr2, skySent)
+	skyOutput1 := s.predictOutput(t, testSkyAddr, skySent)
+	skyOutput2 := s.predictOutput(t, testSkyAddr2, skySent)
 
 	// Add StatusWaitSend deposits
 	// They should all be confirmed after shutdown
@@ -894,14 +1018,16 @@ func TestExchangeProcessWaitSendDeposits(t *testing.T) {
 			DepositAddress: "foo-btc-addr-1",
 			DepositID:      "foo-tx-1:1",
 			Txid:           txid1,
+			SkyOutput:      skyOutput1,
 			ConversionRate: testSkyBtcRate,
 			DepositValue:   depositValue,
 			Deposit: scanner.Deposit{
-				Address: "foo-btc-addr-1",
-				Value:   depositValue,
-				Height:  20,
-				Tx:      "foo-tx-1",
-				N:       1,
+				CoinType: scanner.CoinTypeBTC,
+				Address:  "foo-btc-addr-1",
+				Value:    depositValue,
+				Height:   20,
+				Tx:       "foo-tx-1",
+				N:        1,
 			},
 		},
 		{
@@ -911,20 +1037,22 @@ func TestExchangeProcessWaitSendDeposits(t *testing.T) {
 			DepositAddress: "foo-btc-addr-2",
 			DepositID:      "foo-tx-2:2",
 			Txid:           txid2,
+			SkyOutput:      skyOutput2,
 			ConversionRate: testSkyBtcRate,
 			DepositValue:   depositValue,
 			Deposit: scanner.Deposit{
-				Address: "foo-btc-addr-2",
-				Value:   depositValue,
-				Height:  20,
-				Tx:      "foo-tx-2",
-				N:       2,
+				CoinType: scanner.CoinTypeBTC,
+				Address:  "foo-btc-addr-2",
+				Value:    depositValue,
+				Height:   20,
+				Tx:       "foo-tx-2",
+				N:        2,
 			},
 		},
 	}
 
 	testExchangeRunProcessDepositBacklog(t, dis, func(e *Exchange, di DepositInfo) {
-		err := e.store.BindAddress(di.SkyAddress, di.DepositAddress)
+		err := e.store.BindAddress(di.SkyAddress, di.DepositAddress, "", "", "", 0, 0)
 		require.NoError(t, err)
 
 		skySent, err := CalculateBtcSkyValue(di.DepositValue, di.ConversionRate, testMaxDecimals)
@@ -945,11 +1073,12 @@ func TestExchangeSaveIncomingDepositCreateDepositFailed(t *testing.T) {
 
 	dn := scanner.DepositNote{
 		Deposit: scanner.Deposit{
-			Address: btcAddr,
-			Value:   1e8,
-			Height:  20,
-			Tx:      "foo-tx",
-			N:       2,
+			CoinType: scanner.CoinTypeBTC,
+			Address:  btcAddr,
+			Value:    1e8,
+			Height:   20,
+			Tx:       "foo-tx",
+			N:        2,
 		},
 		ErrC: make(chan error, 1),
 	}
@@ -962,9 +1091,11 @@ func TestExchangeSaveIncomingDepositCreateDepositFailed(t *testing.T) {
 		return true
 	})).Return(nil, nil).Twice()
 
+	e.store.(*MockStore).On("GetBindRegion", btcAddr).Return("", nil)
+
 	// Return error on GetOrCreateDepositInfo
 	createDepositErr := errors.New("GetOrCreateDepositInfo failed")
-	e.store.(*MockStore).On("GetOrCreateDepositInfo", dn.Deposit, testSkyBtcRate).Return(DepositInfo{}, createDepositErr)
+	e.store.(*MockStore).On("GetOrCreateDepositInfo", dn.Deposit, testSkyBtcRate, int64(0)).Return(DepositInfo{}, createDepositErr)
 
 	// First loop calls saveIncomingDeposit
 	// err is written to ErrC after this method finishes
@@ -995,11 +1126,12 @@ func TestExchangeProcessWaitSendDepositFailed(t *testing.T) {
 
 	dn := scanner.DepositNote{
 		Deposit: scanner.Deposit{
-			Address: btcAddr,
-			Value:   1e8,
-			Height:  20,
-			Tx:      "foo-tx",
-			N:       2,
+			CoinType: scanner.CoinTypeBTC,
+			Address:  btcAddr,
+			Value:    1e8,
+			Height:   20,
+			Tx:       "foo-tx",
+			N:        2,
 		},
 		ErrC: make(chan error, 1),
 	}
@@ -1014,6 +1146,7 @@ func TestExchangeProcessWaitSendDepositFailed(t *testing.T) {
 
 	// GetBindAddress returns a bound address
 	e.store.(*MockStore).On("GetBindAddress", btcAddr).Return(skyAddr, nil)
+	e.store.(*MockStore).On("GetBindRegion", btcAddr).Return("", nil)
 
 	// GetOrCreateDepositInfo returns a valid DepositInfo
 	di := DepositInfo{
@@ -1022,10 +1155,13 @@ func TestExchangeProcessWaitSendDepositFailed(t *testing.T) {
 		SkyAddress:     skyAddr,
 		DepositAddress: btcAddr,
 		DepositID:      dn.Deposit.ID(),
+		DepositTx:      dn.Deposit.Tx,
+		DepositN:       dn.Deposit.N,
+		DepositHeight:  dn.Deposit.Height,
 		ConversionRate: testSkyBtcRate,
 		Deposit:        dn.Deposit,
 	}
-	e.store.(*MockStore).On("GetOrCreateDepositInfo", dn.Deposit, testSkyBtcRate).Return(di, nil)
+	e.store.(*MockStore).On("GetOrCreateDepositInfo", dn.Deposit, testSkyBtcRate, int64(0)).Return(di, nil)
 
 	// UpdateDepositInfo fails
 	updateDepositInfoErr := errors.New("UpdateDepositInfo error")
@@ -1087,11 +1223,12 @@ func TestExchangeProcessWaitSendNoSkyAddrBound(t *testing.T) {
 
 	dn := scanner.DepositNote{
 		Deposit: scanner.Deposit{
-			Address: btcAddr,
-			Value:   1e8,
-			Height:  20,
-			Tx:      "foo-tx",
-			N:       2,
+			CoinType: scanner.CoinTypeBTC,
+			Address:  btcAddr,
+			Value:    1e8,
+			Height:   20,
+			Tx:       "foo-tx",
+			N:        2,
 		},
 		ErrC: make(chan error, 1),
 	}
@@ -1114,29 +1251,215 @@ func TestExchangeBindAddress(t *testing.T) {
 	db, shutdown := testutil.PrepareDB(t)
 	defer shutdown()
 
-	log, _ := testutil.NewLogger(t)
-	store, err := NewStore(log, db)
+	log, hook := testutil.NewLogger(t)
+	store, err := NewStore(log, db, nil)
 	require.NoError(t, err)
 	scanner := newDummyScanner()
 
 	s := &Exchange{
+		log:     log,
 		store:   store,
 		scanner: scanner,
 	}
 
 	require.Len(t, scanner.addrs, 0)
 
-	err = s.BindAddress("a", "b")
+	ctx := logger.WithRequestID(context.Background(), "req1")
+	err = s.BindAddress(ctx, "a", "b", "BTC", "", "", "", 0, 0)
 	require.NoError(t, err)
 
+	// The request ID is logged
+	require.Equal(t, "Bound address", hook.LastEntry().Message)
+	require.Equal(t, "req1", hook.LastEntry().Data["requestID"])
+
 	// Should be added to scanner
 	require.Len(t, scanner.addrs, 1)
 	require.Equal(t, "b", scanner.addrs[0])
+	require.Equal(t, "BTC", scanner.coinTypes[0])
 
 	// Should be in the store
 	skyAddr, err := s.store.GetBindAddress("b")
 	require.NoError(t, err)
 	require.Equal(t, "a", skyAddr)
+
+	// LTC is rejected without an LTC rate
+	err = s.BindAddress(ctx, "a", "c", "LTC", "", "", "", 0, 0)
+	require.Equal(t, "unsupported coin type", err.Error())
+	require.Len(t, scanner.addrs, 1)
+
+	s.cfg.LtcRate = "10"
+	err = s.BindAddress(ctx, "a", "c", "LTC", "", "", "", 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, []string{"b", "c"}, scanner.addrs)
+	require.Equal(t, []string{"BTC", "LTC"}, scanner.coinTypes)
+
+	// An address whose binding expired is bound again, it is scanned already
+	err = s.BindAddress(ctx, "a", "d", "BTC", "", "", "", 0, 1)
+	require.NoError(t, err)
+
+	bs, err := s.ExpireBindings()
+	require.NoError(t, err)
+	require.Equal(t, []Binding{{SkyAddress: "a", DepositAddress: "d"}}, bs)
+
+	err = s.BindAddress(ctx, "e", "d", "BTC", "", "", "", 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, []string{"b", "c", "d"}, scanner.addrs)
+
+	skyAddr, err = s.store.GetBindAddress("d")
+	require.NoError(t, err)
+	require.Equal(t, "e", skyAddr)
+}
+
+func TestExchangeSaveIncomingLTCDeposit(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	log, _ := testutil.NewLogger(t)
+	store, err := NewStore(log, db, nil)
+	require.NoError(t, err)
+
+	e, err := NewExchange(log, store, newDummyScanner(), newDummySender(), Config{
+		Rate:    testSkyBtcRate,
+		LtcRate: "5",
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, store.BindAddress(testSkyAddr, "ltcaddr", "", "", "", 0, 0))
+
+	di, err := e.saveIncomingDeposit(scanner.Deposit{
+		CoinType: "LTC",
+		Address:  "ltcaddr",
+		Value:    2e8,
+		Height:   20,
+		Tx:       "ltctx",
+		N:        1,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "5", di.ConversionRate)
+	require.Equal(t, "LTC", di.CoinType)
+
+	// A coin type without a rate is not saved
+	_, err = e.saveIncomingDeposit(scanner.Deposit{
+		CoinType: "ETH",
+		Address:  "ltcaddr",
+		Value:    2e8,
+		Height:   20,
+		Tx:       "ethtx",
+		N:        1,
+	})
+	require.Equal(t, "unsupported coin type", err.Error())
+}
+
+func TestExchangeSaveIncomingTokenDeposit(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	log, _ := testutil.NewLogger(t)
+	store, err := NewStore(log, db, nil)
+	require.NoError(t, err)
+
+	e, err := NewExchange(log, store, newDummyScanner(), newDummySender(), Config{
+		Rate: testSkyBtcRate,
+		TokenRates: map[string]string{
+			"TKN": "2.5",
+		},
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, store.BindAddress(testSkyAddr, "0xabc", "", "", "", 0, 0))
+
+	// 3 tokens, normalized to 8 decimals by the scanner
+	di, err := e.saveIncomingDeposit(scanner.Deposit{
+		CoinType: "TKN",
+		Address:  "0xabc",
+		Value:    3e8,
+		Height:   20,
+		Tx:       "0xtokentx",
+		N:        4,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "2.5", di.ConversionRate)
+	require.Equal(t, "TKN", di.CoinType)
+	require.Equal(t, "0xtokentx:4", di.DepositID)
+
+	skySent, err := CalculateBtcSkyValue(di.DepositValue, di.ConversionRate, 0)
+	require.NoError(t, err)
+	require.Equal(t, uint64(7e6), skySent)
+
+	// An unknown token is not saved
+	_, err = e.saveIncomingDeposit(scanner.Deposit{
+		CoinType: "OTHER",
+		Address:  "0xabc",
+		Value:    3e8,
+		Height:   20,
+		Tx:       "0xothertx",
+		N:        1,
+	})
+	require.Equal(t, scanner.ErrUnsupportedCoinType, err)
+
+	// Invalid rates are rejected
+	_, err = NewExchange(log, store, newDummyScanner(), newDummySender(), Config{
+		Rate: testSkyBtcRate,
+		TokenRates: map[string]string{
+			"TKN": "-1",
+		},
+	})
+	require.Error(t, err)
+}
+
+func TestExchangeSetRates(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	log, _ := testutil.NewLogger(t)
+	store, err := NewStore(log, db, nil)
+	require.NoError(t, err)
+
+	e, err := NewExchange(log, store, newDummyScanner(), newDummySender(), Config{
+		Rate: testSkyBtcRate,
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, store.BindAddress(testSkyAddr, "btcaddr", "", "", "", 0, 0))
+	require.NoError(t, store.BindAddress(testSkyAddr, "ltcaddr", "", "", "", 0, 0))
+
+	deposit := func(coinType, addr, tx string) (DepositInfo, error) {
+		return e.saveIncomingDeposit(scanner.Deposit{
+			CoinType: coinType,
+			Address:  addr,
+			Value:    1e8,
+			Height:   20,
+			Tx:       tx,
+			N:        0,
+		})
+	}
+
+	di, err := deposit("BTC", "btcaddr", "btctx1")
+	require.NoError(t, err)
+	require.Equal(t, testSkyBtcRate, di.ConversionRate)
+
+	// An invalid rate changes no rate
+	err = e.SetRates("200", "-1", nil)
+	require.Error(t, err)
+
+	di, err = deposit("BTC", "btcaddr", "btctx2")
+	require.NoError(t, err)
+	require.Equal(t, testSkyBtcRate, di.ConversionRate)
+
+	require.NoError(t, e.SetRates("200", "5", nil))
+
+	di, err = deposit("BTC", "btcaddr", "btctx3")
+	require.NoError(t, err)
+	require.Equal(t, "200", di.ConversionRate)
+
+	di, err = deposit("LTC", "ltcaddr", "ltctx1")
+	require.NoError(t, err)
+	require.Equal(t, "5", di.ConversionRate)
+
+	// A deposit that was already received keeps its rate
+	di, err = deposit("BTC", "btcaddr", "btctx1")
+	require.NoError(t, err)
+	require.Equal(t, testSkyBtcRate, di.ConversionRate)
 }
 
 func TestExchangeCreateTransaction(t *testing.T) {
@@ -1155,7 +1478,7 @@ func TestExchangeCreateTransaction(t *testing.T) {
 		ConversionRate: "100",
 	}
 
-	_, err = s.createTransaction(di)
+	_, _, err = s.createTransaction(context.Background(), di)
 	require.Equal(t, ErrNoBoundAddress, err)
 
 	// Create transaction with no coins sent, due to a very low DepositValue
@@ -1164,7 +1487,7 @@ func TestExchangeCreateTransaction(t *testing.T) {
 		DepositValue:   1,
 		ConversionRate: "100",
 	}
-	_, err = s.createTransaction(di)
+	_, _, err = s.createTransaction(context.Background(), di)
 	require.Equal(t, ErrEmptySendAmount, err)
 
 	// Create valid transaction
@@ -1177,7 +1500,7 @@ func TestExchangeCreateTransaction(t *testing.T) {
 	// that the DepositInfo's ConversionRate is used instead of Config.Rate
 	require.NotEqual(t, s.cfg.Rate, di.ConversionRate)
 
-	tx, err := s.createTransaction(di)
+	tx, _, err := s.createTransaction(context.Background(), di)
 	require.NoError(t, err)
 	// Should have one output for destination and one for change
 	require.Len(t, tx.Out, 2)
@@ -1194,34 +1517,1474 @@ func TestExchangeCreateTransaction(t *testing.T) {
 	require.Equal(t, uint64(100e6), txOut.Coins)
 }
 
-func TestExchangeGetDepositStatuses(t *testing.T) {
-	// TODO
+func TestExchangeCreateTransactionFee(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+	s, err := NewExchange(log, nil, nil, newDummySender(), Config{
+		Rate:        "100",
+		MaxDecimals: 3,
+		Fee: Fee{
+			Percent:       "1.5",
+			FixedDroplets: 1e6,
+		},
+	})
+	require.NoError(t, err)
+
+	di := DepositInfo{
+		SkyAddress:     "2GgFvqoyk9RjwVzj8tqfcXVXB4orBwoc9qv",
+		DepositValue:   1e8,
+		ConversionRate: "100",
+	}
+
+	// 100 SKY bought, minus 1.5 SKY commission and 1 SKY fixed fee
+	tx, gross, err := s.createTransaction(context.Background(), di)
+	require.NoError(t, err)
+	require.Equal(t, uint64(100e6), gross)
+
+	coins, _ := findOutput(tx, di.SkyAddress)
+	require.Equal(t, uint64(97.5e6), coins)
+
+	// The fee exceeds the SKY bought
+	di.DepositValue = 1e6
+	_, _, err = s.createTransaction(context.Background(), di)
+	require.Equal(t, ErrEmptySendAmount, err)
 }
 
-func TestExchangeGetDepositStatusDetail(t *testing.T) {
-	// TODO
+func TestExchangeRegionPricing(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	log, _ := testutil.NewLogger(t)
+	store, err := NewStore(log, db, nil)
+	require.NoError(t, err)
+
+	e, err := NewExchange(log, store, newDummyScanner(), newDummySender(), Config{
+		Rate: "100",
+		Regions: map[string]pricing.Region{
+			"eu": {
+				Name:         "eu",
+				Countries:    []string{"DE"},
+				BonusPercent: "10",
+				MinSky:       50e6,
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	require.NoError(t, e.BindAddress(ctx, testSkyAddr, "euaddr", scanner.CoinTypeBTC, "eu", "", "", 0, 0))
+	require.NoError(t, e.BindAddress(ctx, testSkyAddr, "otheraddr", scanner.CoinTypeBTC, "", "", "", 0, 0))
+	// A region that was removed from the config
+	require.NoError(t, e.BindAddress(ctx, testSkyAddr, "oldaddr", scanner.CoinTypeBTC, "asia", "", "", 0, 0))
+
+	region, err := store.GetBindRegion("euaddr")
+	require.NoError(t, err)
+	require.Equal(t, "eu", region)
+
+	// The region's bonus is applied to the rate
+	di, err := e.saveIncomingDeposit(scanner.Deposit{
+		CoinType: scanner.CoinTypeBTC,
+		Address:  "euaddr",
+		Value:    1e8,
+		Height:   20,
+		Tx:       "eutx",
+		N:        1,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "110", di.ConversionRate)
+	require.Equal(t, "eu", di.Region)
+
+	tx, _, err := e.createTransaction(context.Background(), di)
+	require.NoError(t, err)
+	var sent uint64
+	for _, o := range tx.Out {
+		if o.Address.String() == di.SkyAddress {
+			sent = o.Coins
+		}
+	}
+	require.Equal(t, uint64(110e6), sent)
+
+	// Deposits buying less than the region's minimum are not sent
+	di, err = e.saveIncomingDeposit(scanner.Deposit{
+		CoinType: scanner.CoinTypeBTC,
+		Address:  "euaddr",
+		Value:    4e7,
+		Height:   20,
+		Tx:       "eutx2",
+		N:        1,
+	})
+	require.NoError(t, err)
+	_, _, err = e.createTransaction(context.Background(), di)
+	require.Equal(t, ErrBelowRegionMinimum, err)
+
+	di, err = e.handleDepositInfoState(context.Background(), di)
+	require.NoError(t, err)
+	require.Equal(t, StatusDone, di.Status)
+	require.Equal(t, ErrBelowRegionMinimum.Error(), di.Error)
+	require.NoError(t, di.ValidateForStatus())
+
+	// Addresses without a region, or with a region no longer configured, get the default pricing
+	for _, addr := range []string{"otheraddr", "oldaddr"} {
+		di, err = e.saveIncomingDeposit(scanner.Deposit{
+			CoinType: scanner.CoinTypeBTC,
+			Address:  addr,
+			Value:    4e7,
+			Height:   20,
+			Tx:       addr + "tx",
+			N:        1,
+		})
+		require.NoError(t, err)
+		require.Equal(t, "100", di.ConversionRate)
+
+		_, _, err = e.createTransaction(context.Background(), di)
+		require.NoError(t, err)
+	}
 }
 
-func TestExchangeGetBindNum(t *testing.T) {
+type dummyCampaignRater map[string]map[string]string
+
+func (d dummyCampaignRater) Rate(campaign, coinType string) (string, error) {
+	rates, ok := d[campaign]
+	if !ok {
+		return "", errors.New("campaign not found")
+	}
+	return rates[coinType], nil
+}
+
+func TestExchangeCampaign(t *testing.T) {
 	db, shutdown := testutil.PrepareDB(t)
 	defer shutdown()
 
 	log, _ := testutil.NewLogger(t)
-	store, err := NewStore(log, db)
+	store, err := NewStore(log, db, nil)
 	require.NoError(t, err)
 
-	s := &Exchange{
-		store: store,
+	e, err := NewExchange(log, store, newDummyScanner(), newDummySender(), Config{
+		Rate:    "100",
+		LtcRate: "10",
+		Regions: map[string]pricing.Region{
+			"eu": {
+				Name:         "eu",
+				Countries:    []string{"DE"},
+				BonusPercent: "10",
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	e.SetCampaigns(dummyCampaignRater{
+		"sale": {scanner.CoinTypeBTC: "200"},
+	})
+
+	ctx := context.Background()
+	require.NoError(t, e.BindAddress(ctx, testSkyAddr, "saleaddr", scanner.CoinTypeBTC, "eu", "sale", "", 0, 0))
+	require.NoError(t, e.BindAddress(ctx, testSkyAddr, "saleltcaddr", scanner.CoinTypeLTC, "", "sale", "", 0, 0))
+	require.NoError(t, e.BindAddress(ctx, testSkyAddr, "otheraddr", scanner.CoinTypeBTC, "", "", "", 0, 0))
+	require.NoError(t, e.BindAddress(ctx, testSkyAddr, "goneaddr", scanner.CoinTypeBTC, "", "gone", "", 0, 0))
+
+	campaign, err := store.GetBindCampaign("saleaddr")
+	require.NoError(t, err)
+	require.Equal(t, "sale", campaign)
+
+	// The campaign's rate gets the region's bonus
+	di, err := e.saveIncomingDeposit(scanner.Deposit{
+		CoinType: scanner.CoinTypeBTC,
+		Address:  "saleaddr",
+		Value:    1e8,
+		Tx:       "saletx",
+		N:        1,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "220", di.ConversionRate)
+	require.Equal(t, "sale", di.Campaign)
+
+	// Coin types without a campaign rate get the default rate
+	di, err = e.saveIncomingDeposit(scanner.Deposit{
+		CoinType: scanner.CoinTypeLTC,
+		Address:  "saleltcaddr",
+		Value:    1e8,
+		Tx:       "saleltctx",
+		N:        1,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "10", di.ConversionRate)
+
+	di, err = e.saveIncomingDeposit(scanner.Deposit{
+		CoinType: scanner.CoinTypeBTC,
+		Address:  "otheraddr",
+		Value:    1e8,
+		Tx:       "othertx",
+		N:        1,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "100", di.ConversionRate)
+	require.Equal(t, "", di.Campaign)
+
+	// The deposit is not saved if the rate of its campaign can't be looked up
+	_, err = e.saveIncomingDeposit(scanner.Deposit{
+		CoinType: scanner.CoinTypeBTC,
+		Address:  "goneaddr",
+		Value:    1e8,
+		Tx:       "gonetx",
+		N:        1,
+	})
+	require.Error(t, err)
+
+	_, err = store.UpdateDepositInfo("saletx:1", func(di DepositInfo) DepositInfo {
+		di.SkySent = 220e6
+		return di
+	})
+	require.NoError(t, err)
+
+	stats, err := e.GetCampaignDepositStats("sale")
+	require.NoError(t, err)
+	require.Equal(t, &DepositStats{
+		TotalBTCReceived: 1e8,
+		TotalSKYSent:     220e6,
+	}, stats)
+
+	dis, err := store.QueryDepositInfos(DepositQuery{Campaign: "sale"})
+	require.NoError(t, err)
+	require.Len(t, dis, 2)
+}
+
+// dummyQuoteRater quotes the rates of deposit addresses, for deposit values up to max
+type dummyQuoteRater struct {
+	rates map[string]string
+	max   int64
+}
+
+func (d dummyQuoteRater) Rate(depositAddr, coinType string, value int64) (string, error) {
+	if value > d.max {
+		return "", nil
 	}
+	return d.rates[depositAddr], nil
+}
 
-	num, err := s.GetBindNum("a")
-	require.Equal(t, num, 0)
+func TestExchangeQuote(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	log, _ := testutil.NewLogger(t)
+	store, err := NewStore(log, db, nil)
 	require.NoError(t, err)
 
-	err = s.store.BindAddress("a", "b")
+	e, err := NewExchange(log, store, newDummyScanner(), newDummySender(), Config{
+		Rate: "100",
+		Regions: map[string]pricing.Region{
+			"eu": {
+				Name:         "eu",
+				Countries:    []string{"DE"},
+				BonusPercent: "10",
+			},
+		},
+	})
 	require.NoError(t, err)
 
-	num, err = s.GetBindNum("a")
+	e.SetQuotes(dummyQuoteRater{
+		rates: map[string]string{"quotedaddr": "150"},
+		max:   1e8,
+	})
+
+	ctx := context.Background()
+	require.NoError(t, e.BindAddress(ctx, testSkyAddr, "quotedaddr", scanner.CoinTypeBTC, "eu", "", "", 0, 0))
+
+	// The quoted rate is final, the region's bonus is not applied again
+	di, err := e.saveIncomingDeposit(scanner.Deposit{
+		CoinType: scanner.CoinTypeBTC,
+		Address:  "quotedaddr",
+		Value:    1e8,
+		Tx:       "quotedtx",
+		N:        1,
+	})
 	require.NoError(t, err)
-	require.Equal(t, num, 1)
+	require.Equal(t, "150", di.ConversionRate)
+
+	// Deposits the quote doesn't apply to get the default pricing
+	di, err = e.saveIncomingDeposit(scanner.Deposit{
+		CoinType: scanner.CoinTypeBTC,
+		Address:  "quotedaddr",
+		Value:    2e8,
+		Tx:       "bigtx",
+		N:        1,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "110", di.ConversionRate)
+}
+
+// dummyPromoRater applies the bonuses of promo codes, in percent
+type dummyPromoRater map[string]int64
+
+func (d dummyPromoRater) Rate(code, rate string) (string, error) {
+	bonus, ok := d[code]
+	if !ok {
+		return rate, nil
+	}
+
+	r, err := strconv.ParseInt(rate, 10, 64)
+	if err != nil {
+		return "", err
+	}
+
+	return strconv.FormatInt(r*(100+bonus)/100, 10), nil
+}
+
+func TestExchangePromoCode(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	log, _ := testutil.NewLogger(t)
+	store, err := NewStore(log, db, nil)
+	require.NoError(t, err)
+
+	e, err := NewExchange(log, store, newDummyScanner(), newDummySender(), Config{
+		Rate: "100",
+		Regions: map[string]pricing.Region{
+			"eu": {
+				Name:         "eu",
+				Countries:    []string{"DE"},
+				BonusPercent: "10",
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	e.SetPromoCodes(dummyPromoRater{"FRIEND": 10})
+
+	ctx := context.Background()
+	require.NoError(t, e.BindAddress(ctx, testSkyAddr, "promoaddr", scanner.CoinTypeBTC, "eu", "", "FRIEND", 0, 0))
+	require.NoError(t, e.BindAddress(ctx, testSkyAddr, "oldpromoaddr", scanner.CoinTypeBTC, "", "", "OLD", 0, 0))
+
+	code, err := store.GetBindPromoCode("promoaddr")
+	require.NoError(t, err)
+	require.Equal(t, "FRIEND", code)
+
+	// The code's bonus is applied on top of the region's
+	di, err := e.saveIncomingDeposit(scanner.Deposit{
+		CoinType: scanner.CoinTypeBTC,
+		Address:  "promoaddr",
+		Value:    1e8,
+		Tx:       "promotx",
+		N:        1,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "121", di.ConversionRate)
+	require.Equal(t, "FRIEND", di.PromoCode)
+
+	// Codes that don't qualify anymore get no bonus, but are recorded
+	di, err = e.saveIncomingDeposit(scanner.Deposit{
+		CoinType: scanner.CoinTypeBTC,
+		Address:  "oldpromoaddr",
+		Value:    1e8,
+		Tx:       "oldpromotx",
+		N:        1,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "100", di.ConversionRate)
+	require.Equal(t, "OLD", di.PromoCode)
+
+	dis, err := store.QueryDepositInfos(DepositQuery{PromoCode: "FRIEND"})
+	require.NoError(t, err)
+	require.Len(t, dis, 1)
+	require.Equal(t, "promotx:1", dis[0].DepositID)
+
+	dss, err := e.GetDepositStatuses(testSkyAddr, false)
+	require.NoError(t, err)
+	require.Len(t, dss, 2)
+	for _, ds := range dss {
+		require.NotEmpty(t, ds.PromoCode)
+	}
+}
+
+// dummyKYC passes the skycoin addresses set in it
+type dummyKYC struct {
+	sync.Mutex
+	verified map[string]bool
+	err      error
+}
+
+func (k *dummyKYC) Verified(ctx context.Context, skyAddr, token string) (bool, error) {
+	k.Lock()
+	defer k.Unlock()
+	return k.verified[skyAddr], k.err
+}
+
+func (k *dummyKYC) verify(skyAddr string) {
+	k.Lock()
+	defer k.Unlock()
+	k.verified[skyAddr] = true
+}
+
+func TestExchangeKYC(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	log, _ := testutil.NewLogger(t)
+	store, err := NewStore(log, db, nil)
+	require.NoError(t, err)
+
+	e, err := NewExchange(log, store, newDummyScanner(), newDummySender(), Config{
+		Rate:         "100",
+		KYCThreshold: 5e5,
+	})
+	require.NoError(t, err)
+
+	kyc := &dummyKYC{verified: map[string]bool{}}
+	e.SetKYC(kyc)
+
+	require.NoError(t, store.BindAddress(testSkyAddr, "kycaddr", "", "", "", 0, 0))
+	require.NoError(t, store.BindAddress(testSkyAddr2, "kycaddr2", "", "", "", 0, 0))
+
+	// Deposits buying less than the threshold are not checked
+	di, err := e.saveIncomingDeposit(scanner.Deposit{
+		CoinType: scanner.CoinTypeBTC,
+		Address:  "kycaddr",
+		Value:    1e5,
+		Tx:       "smalltx",
+		N:        1,
+	})
+	require.NoError(t, err)
+	require.Equal(t, StatusWaitSend, di.Status)
+
+	// Larger deposits are held until the owner of the skycoin address passes KYC
+	di, err = e.saveIncomingDeposit(scanner.Deposit{
+		CoinType: scanner.CoinTypeBTC,
+		Address:  "kycaddr",
+		Value:    1e6,
+		Tx:       "largetx",
+		N:        1,
+	})
+	require.NoError(t, err)
+	require.Equal(t, StatusWaitKYC, di.Status)
+
+	// Deposits are held if the KYC service fails
+	kyc.err = errors.New("KYC service unavailable")
+	di2, err := e.saveIncomingDeposit(scanner.Deposit{
+		CoinType: scanner.CoinTypeBTC,
+		Address:  "kycaddr2",
+		Value:    1e6,
+		Tx:       "failtx",
+		N:        1,
+	})
+	require.NoError(t, err)
+	require.Equal(t, StatusWaitKYC, di2.Status)
+	kyc.err = nil
+
+	dss, err := e.GetDepositStatuses(testSkyAddr, false)
+	require.NoError(t, err)
+	require.Len(t, dss, 2)
+
+	// Verified addresses are released by the recheck
+	kyc.verify(testSkyAddr)
+	require.NoError(t, e.recheckKYC())
+
+	di, err = store.getDepositInfo(di.DepositID)
+	require.NoError(t, err)
+	require.Equal(t, StatusWaitSend, di.Status)
+	require.Equal(t, di, <-e.depositChan)
+
+	di2, err = store.getDepositInfo(di2.DepositID)
+	require.NoError(t, err)
+	require.Equal(t, StatusWaitKYC, di2.Status)
+
+	_, err = e.ReleaseKYCDeposit(di.DepositID, "", "")
+	require.Equal(t, ErrDepositQueued, err)
+
+	// Held deposits can be released by an operator
+	di2, err = e.ReleaseKYCDeposit(di2.DepositID, "documents checked", "127.0.0.1:1234")
+	require.NoError(t, err)
+	require.Equal(t, StatusWaitSend, di2.Status)
+	require.Equal(t, di2, <-e.depositChan)
+
+	// Verified addresses are not held
+	di, err = e.saveIncomingDeposit(scanner.Deposit{
+		CoinType: scanner.CoinTypeBTC,
+		Address:  "kycaddr",
+		Value:    1e6,
+		Tx:       "verifiedtx",
+		N:        1,
+	})
+	require.NoError(t, err)
+	require.Equal(t, StatusWaitSend, di.Status)
+}
+
+// dummyScreener flags the deposits with a value of at least maxValue
+type dummyScreener struct {
+	maxValue int64
+	err      error
+}
+
+func (d dummyScreener) Screen(ctx context.Context, dv scanner.Deposit) (bool, string, error) {
+	if d.err != nil {
+		return false, "", d.err
+	}
+	return dv.Value >= d.maxValue, "too large", nil
+}
+
+func TestExchangeScreening(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	log, _ := testutil.NewLogger(t)
+	store, err := NewStore(log, db, nil)
+	require.NoError(t, err)
+
+	e, err := NewExchange(log, store, newDummyScanner(), newDummySender(), Config{
+		Rate: "100",
+	})
+	require.NoError(t, err)
+
+	e.SetScreener(dummyScreener{maxValue: 1e8})
+
+	require.NoError(t, store.BindAddress(testSkyAddr, "screenaddr", "", "", "", 0, 0))
+
+	di, err := e.saveIncomingDeposit(scanner.Deposit{
+		CoinType: scanner.CoinTypeBTC,
+		Address:  "screenaddr",
+		Value:    1e6,
+		Tx:       "cleantx",
+		N:        1,
+	})
+	require.NoError(t, err)
+	require.Equal(t, StatusWaitSend, di.Status)
+
+	// Flagged deposits are held for review
+	di, err = e.saveIncomingDeposit(scanner.Deposit{
+		CoinType: scanner.CoinTypeBTC,
+		Address:  "screenaddr",
+		Value:    1e8,
+		Tx:       "flaggedtx",
+		N:        1,
+	})
+	require.NoError(t, err)
+	require.Equal(t, StatusHeldForReview, di.Status)
+	require.Equal(t, "Flagged by screening: too large", di.Error)
+
+	// Deposits are held for review if screening fails
+	e.SetScreener(dummyScreener{err: errors.New("risk API unavailable")})
+	di2, err := e.saveIncomingDeposit(scanner.Deposit{
+		CoinType: scanner.CoinTypeBTC,
+		Address:  "screenaddr",
+		Value:    1e6,
+		Tx:       "failtx",
+		N:        1,
+	})
+	require.NoError(t, err)
+	require.Equal(t, StatusHeldForReview, di2.Status)
+
+	// Approved deposits are queued to be sent
+	di, err = e.ApproveDeposit(di.DepositID, "source checked", "")
+	require.NoError(t, err)
+	require.Equal(t, StatusWaitSend, di.Status)
+	require.Empty(t, di.Error)
+	require.Equal(t, di, <-e.depositChan)
+
+	_, err = e.ApproveDeposit(di.DepositID, "", "")
+	require.Equal(t, ErrDepositQueued, err)
+
+	_, err = e.RejectDeposit(di.DepositID, "", "")
+	require.Equal(t, ErrDepositNotHeldForReview, err)
+
+	// Rejected deposits are not sent
+	di2, err = e.RejectDeposit(di2.DepositID, "stolen funds", "")
+	require.NoError(t, err)
+	require.Equal(t, StatusRejected, di2.Status)
+	require.Empty(t, e.depositChan)
+
+	_, err = e.ApproveDeposit(di2.DepositID, "", "")
+	require.Equal(t, ErrDepositNotHeldForReview, err)
+}
+
+func TestExchangePurchaseLimit(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	log, _ := testutil.NewLogger(t)
+	store, err := NewStore(log, db, nil)
+	require.NoError(t, err)
+
+	e, err := NewExchange(log, store, newDummyScanner(), newDummySender(), Config{
+		Rate:             "100",
+		MaxSkyPerAddress: 3e6,
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, store.BindAddress(testSkyAddr, "limitaddr", "", "", "", 0, 0))
+
+	remaining, limited, err := e.RemainingSky(testSkyAddr)
+	require.NoError(t, err)
+	require.True(t, limited)
+	require.Equal(t, uint64(3e6), remaining)
+
+	// 2 SKY
+	di, err := e.saveIncomingDeposit(scanner.Deposit{
+		CoinType: scanner.CoinTypeBTC,
+		Address:  "limitaddr",
+		Value:    2e6,
+		Tx:       "firsttx",
+		N:        1,
+	})
+	require.NoError(t, err)
+	require.Equal(t, StatusWaitSend, di.Status)
+
+	remaining, _, err = e.RemainingSky(testSkyAddr)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1e6), remaining)
+
+	// 2 more SKY exceed the limit
+	di, err = e.saveIncomingDeposit(scanner.Deposit{
+		CoinType: scanner.CoinTypeBTC,
+		Address:  "limitaddr",
+		Value:    2e6,
+		Tx:       "secondtx",
+		N:        1,
+	})
+	require.NoError(t, err)
+	require.Equal(t, StatusHeldForReview, di.Status)
+	require.Equal(t, ErrPurchaseLimitExceeded.Error(), di.Error)
+
+	// Held deposits don't count
+	remaining, _, err = e.RemainingSky(testSkyAddr)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1e6), remaining)
+
+	// Up to the limit
+	di, err = e.saveIncomingDeposit(scanner.Deposit{
+		CoinType: scanner.CoinTypeBTC,
+		Address:  "limitaddr",
+		Value:    1e6,
+		Tx:       "thirdtx",
+		N:        1,
+	})
+	require.NoError(t, err)
+	require.Equal(t, StatusWaitSend, di.Status)
+
+	remaining, _, err = e.RemainingSky(testSkyAddr)
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), remaining)
+
+	// No limit
+	e.cfg.MaxSkyPerAddress = 0
+	_, limited, err = e.RemainingSky(testSkyAddr)
+	require.NoError(t, err)
+	require.False(t, limited)
+}
+
+type dummyPauser struct {
+	sync.Mutex
+	paused bool
+}
+
+func (p *dummyPauser) Paused() bool {
+	p.Lock()
+	defer p.Unlock()
+	return p.paused
+}
+
+func (p *dummyPauser) setPaused(paused bool) {
+	p.Lock()
+	defer p.Unlock()
+	p.paused = paused
+}
+
+func TestExchangePaused(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+	e, run, shutdown := setupExchange(t, log)
+	defer shutdown()
+	defer e.Shutdown()
+
+	require.False(t, e.Paused())
+
+	pauser := &dummyPauser{paused: true}
+	e.SetPauser(pauser)
+	require.True(t, e.Paused())
+
+	go run()
+
+	skyAddr := testSkyAddr
+	btcAddr := "foo-btc-addr"
+	err := e.store.BindAddress(skyAddr, btcAddr, "", "", "", 0, 0)
+	require.NoError(t, err)
+
+	dn := scanner.DepositNote{
+		Deposit: scanner.Deposit{
+			CoinType: scanner.CoinTypeBTC,
+			Address:  btcAddr,
+			Value:    1e8,
+			Height:   20,
+			Tx:       "foo-tx",
+			N:        2,
+		},
+		ErrC: make(chan error, 1),
+	}
+	e.scanner.(*dummyScanner).addDeposit(dn)
+
+	// The deposit is saved while paused, but not sent
+	require.NoError(t, <-dn.ErrC)
+
+	time.Sleep(dbCheckWaitTime)
+
+	di, err := e.store.(*Store).getDepositInfo(dn.Deposit.ID())
+	require.NoError(t, err)
+	require.Equal(t, StatusWaitSend, di.Status)
+
+	dss, err := e.GetDepositStatuses(skyAddr, false)
+	require.NoError(t, err)
+	require.Len(t, dss, 1)
+	require.Equal(t, StatusPaused, dss[0].Status)
+
+	// The deposit is sent once payouts are resumed
+	pauser.setPaused(false)
+
+	for i := 0; i < 30 && di.Status == StatusWaitSend; i++ {
+		time.Sleep(time.Millisecond * 100)
+		di, err = e.store.(*Store).getDepositInfo(dn.Deposit.ID())
+		require.NoError(t, err)
+	}
+	require.Equal(t, StatusWaitConfirm, di.Status)
+
+	dss, err = e.GetDepositStatuses(skyAddr, false)
+	require.NoError(t, err)
+	require.Equal(t, StatusWaitConfirm.String(), dss[0].Status)
+}
+
+func TestExchangePauseResume(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+	e, run, shutdown := setupExchange(t, log)
+	defer shutdown()
+	defer e.Shutdown()
+
+	// An operator's pause from before a restart is restored by Run
+	require.NoError(t, e.store.SetPauseState(PauseState{
+		Paused:   true,
+		Reason:   "incident",
+		PausedAt: 1501137828,
+	}))
+	require.False(t, e.Paused())
+
+	go run()
+
+	for i := 0; i < 30 && !e.Paused(); i++ {
+		time.Sleep(time.Millisecond * 10)
+	}
+	require.True(t, e.Paused())
+	require.Equal(t, "incident", e.GetPauseState().Reason)
+
+	skyAddr := testSkyAddr
+	btcAddr := "foo-btc-addr"
+	err := e.store.BindAddress(skyAddr, btcAddr, "", "", "", 0, 0)
+	require.NoError(t, err)
+
+	dn := scanner.DepositNote{
+		Deposit: scanner.Deposit{
+			CoinType: scanner.CoinTypeBTC,
+			Address:  btcAddr,
+			Value:    1e8,
+			Height:   20,
+			Tx:       "foo-tx",
+			N:        2,
+		},
+		ErrC: make(chan error, 1),
+	}
+	e.scanner.(*dummyScanner).addDeposit(dn)
+
+	// The deposit is saved while paused, but not sent
+	require.NoError(t, <-dn.ErrC)
+
+	time.Sleep(dbCheckWaitTime)
+
+	di, err := e.store.(*Store).getDepositInfo(dn.Deposit.ID())
+	require.NoError(t, err)
+	require.Equal(t, StatusWaitSend, di.Status)
+
+	// The deposit is sent once payouts are resumed, and the resume is saved
+	require.NoError(t, e.Resume())
+	require.False(t, e.Paused())
+
+	ps, err := e.store.GetPauseState()
+	require.NoError(t, err)
+	require.Equal(t, PauseState{}, ps)
+
+	for i := 0; i < 30 && di.Status == StatusWaitSend; i++ {
+		time.Sleep(time.Millisecond * 100)
+		di, err = e.store.(*Store).getDepositInfo(dn.Deposit.ID())
+		require.NoError(t, err)
+	}
+	require.Equal(t, StatusWaitConfirm, di.Status)
+
+	// Pause is saved
+	require.NoError(t, e.Pause("maintenance"))
+	require.True(t, e.Paused())
+
+	ps, err = e.store.GetPauseState()
+	require.NoError(t, err)
+	require.True(t, ps.Paused)
+	require.Equal(t, "maintenance", ps.Reason)
+	require.NotEmpty(t, ps.PausedAt)
+	require.Equal(t, ps, e.GetPauseState())
+}
+
+func TestExchangeReprocessDeposit(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+	e, run, shutdown := setupExchange(t, log)
+	defer shutdown()
+	defer e.Shutdown()
+
+	go run()
+
+	skyAddr := testSkyAddr
+	btcAddr := "foo-btc-addr"
+	err := e.store.BindAddress(skyAddr, btcAddr, "", "", "", 0, 0)
+	require.NoError(t, err)
+
+	// The deposit is too small to send anything at the configured rate
+	dn := scanner.DepositNote{
+		Deposit: scanner.Deposit{
+			CoinType: scanner.CoinTypeBTC,
+			Address:  btcAddr,
+			Value:    1,
+			Height:   20,
+			Tx:       "foo-tx",
+			N:        2,
+		},
+		ErrC: make(chan error, 1),
+	}
+	e.scanner.(*dummyScanner).addDeposit(dn)
+	require.NoError(t, <-dn.ErrC)
+
+	var di DepositInfo
+	for i := 0; i < 30 && di.Status != StatusDone; i++ {
+		time.Sleep(time.Millisecond * 100)
+		di, err = e.store.(*Store).getDepositInfo(dn.Deposit.ID())
+		require.NoError(t, err)
+	}
+	require.Equal(t, StatusDone, di.Status)
+	require.Equal(t, ErrEmptySendAmount.Error(), di.Error)
+
+	_, err = e.ReprocessDeposit(di.DepositID, "bad", "", "")
+	require.Error(t, err)
+
+	// A reprocessed deposit can't be reprocessed again while it is queued
+	require.NoError(t, e.Pause(""))
+
+	di, err = e.ReprocessDeposit(di.DepositID, "100000000", "rate fixed", "")
+	require.NoError(t, err)
+	require.Equal(t, StatusWaitSend, di.Status)
+
+	_, err = e.ReprocessDeposit(di.DepositID, "", "", "")
+	require.Equal(t, ErrDepositQueued, err)
+
+	// The deposit is sent with the new rate
+	require.NoError(t, e.Resume())
+
+	for i := 0; i < 30 && di.Status == StatusWaitSend; i++ {
+		time.Sleep(time.Millisecond * 100)
+		di, err = e.store.(*Store).getDepositInfo(dn.Deposit.ID())
+		require.NoError(t, err)
+	}
+	require.Equal(t, StatusWaitConfirm, di.Status)
+	require.Equal(t, uint64(1e6), di.SkySent)
+}
+
+type dummyAlerter struct {
+	sync.Mutex
+	events   []string
+	messages []string
+}
+
+func (a *dummyAlerter) Notify(event, message string) {
+	a.Lock()
+	defer a.Unlock()
+	a.events = append(a.events, event)
+	a.messages = append(a.messages, message)
+}
+
+func (a *dummyAlerter) alerted() ([]string, []string) {
+	a.Lock()
+	defer a.Unlock()
+	return append([]string(nil), a.events...), append([]string(nil), a.messages...)
+}
+
+func TestExchangeSendFailedAlert(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+	e, run, shutdown := setupExchange(t, log)
+	defer shutdown()
+	defer e.Shutdown()
+
+	alerter := &dummyAlerter{}
+	e.SetAlerter(alerter)
+
+	go run()
+
+	skyAddr := testSkyAddr
+	btcAddr := "foo-btc-addr"
+	err := e.store.BindAddress(skyAddr, btcAddr, "", "", "", 0, 0)
+	require.NoError(t, err)
+
+	e.sender.(*dummySender).createTransactionErr = errors.New("fake create transaction error")
+
+	dn := scanner.DepositNote{
+		Deposit: scanner.Deposit{
+			CoinType: scanner.CoinTypeBTC,
+			Address:  btcAddr,
+			Value:    1e8,
+			Height:   20,
+			Tx:       "foo-tx",
+			N:        2,
+		},
+		ErrC: make(chan error, 1),
+	}
+	e.scanner.(*dummyScanner).addDeposit(dn)
+	require.NoError(t, <-dn.ErrC)
+
+	var events, messages []string
+	for i := 0; i < 30 && len(events) == 0; i++ {
+		time.Sleep(time.Millisecond * 100)
+		events, messages = alerter.alerted()
+	}
+
+	require.Equal(t, []string{alert.EventSendFailed}, events)
+	require.Equal(t, []string{
+		fmt.Sprintf("Deposit %s failed and will not be retried until it is reprocessed: fake create transaction error", dn.Deposit.ID()),
+	}, messages)
+}
+
+type dummyAnomalyDetector struct {
+	sync.Mutex
+	binds    []string
+	deposits []string
+}
+
+func (d *dummyAnomalyDetector) ObserveBind(coinType string) {
+	d.Lock()
+	defer d.Unlock()
+	d.binds = append(d.binds, coinType)
+}
+
+func (d *dummyAnomalyDetector) ObserveDeposit(depositID, coinType, skyAddr string, value int64) {
+	d.Lock()
+	defer d.Unlock()
+	d.deposits = append(d.deposits, fmt.Sprintf("%s %s %s %d", depositID, coinType, skyAddr, value))
+}
+
+func (d *dummyAnomalyDetector) observed() ([]string, []string) {
+	d.Lock()
+	defer d.Unlock()
+	return append([]string(nil), d.binds...), append([]string(nil), d.deposits...)
+}
+
+func TestExchangeAnomalyDetector(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+	e, run, shutdown := setupExchange(t, log)
+	defer shutdown()
+	defer e.Shutdown()
+
+	anomalies := &dummyAnomalyDetector{}
+	e.SetAnomalyDetector(anomalies)
+
+	go run()
+
+	skyAddr := testSkyAddr
+	btcAddr := "foo-btc-addr"
+	err := e.BindAddress(context.Background(), skyAddr, btcAddr, scanner.CoinTypeBTC, "", "", "", 0, 0)
+	require.NoError(t, err)
+
+	dn := scanner.DepositNote{
+		Deposit: scanner.Deposit{
+			CoinType: scanner.CoinTypeBTC,
+			Address:  btcAddr,
+			Value:    1e8,
+			Height:   20,
+			Tx:       "foo-tx",
+			N:        2,
+		},
+		ErrC: make(chan error, 1),
+	}
+	e.scanner.(*dummyScanner).addDeposit(dn)
+	require.NoError(t, <-dn.ErrC)
+
+	binds, deposits := anomalies.observed()
+	require.Equal(t, []string{scanner.CoinTypeBTC}, binds)
+	require.Equal(t, []string{
+		fmt.Sprintf("%s %s %s %d", dn.Deposit.ID(), scanner.CoinTypeBTC, skyAddr, int64(1e8)),
+	}, deposits)
+}
+
+func TestExchangeBatchSend(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+	db, shutdownDB := testutil.PrepareDB(t)
+	defer shutdownDB()
+
+	store, err := NewStore(log, db, nil)
+	require.NoError(t, err)
+
+	e, err := NewExchange(log, store, newDummyScanner(), newDummySender(), Config{
+		Rate:                    testSkyBtcRate,
+		TxConfirmationCheckWait: time.Millisecond * 100,
+		BatchWindow:             time.Millisecond * 300,
+	})
+	require.NoError(t, err)
+	require.Equal(t, defaultBatchMaxSize, e.cfg.BatchMaxSize)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		require.NoError(t, e.Run())
+	}()
+	defer func() {
+		e.Shutdown()
+		<-done
+	}()
+
+	// Two deposits to testSkyAddr, and one to testSkyAddr2
+	deposits := []struct {
+		skyAddr string
+		btcAddr string
+	}{
+		{testSkyAddr, "foo-btc-addr-1"},
+		{testSkyAddr, "foo-btc-addr-2"},
+		{testSkyAddr2, "foo-btc-addr-3"},
+	}
+
+	ids := make([]string, len(deposits))
+	for i, d := range deposits {
+		require.NoError(t, e.store.BindAddress(d.skyAddr, d.btcAddr, "", "", "", 0, 0))
+
+		dn := scanner.DepositNote{
+			Deposit: scanner.Deposit{
+				CoinType: scanner.CoinTypeBTC,
+				Address:  d.btcAddr,
+				Value:    1e8,
+				Height:   20,
+				Tx:       "foo-tx",
+				N:        uint32(i),
+			},
+			ErrC: make(chan error, 1),
+		}
+		e.scanner.(*dummyScanner).addDeposit(dn)
+		require.NoError(t, <-dn.ErrC)
+
+		ids[i] = dn.Deposit.ID()
+	}
+
+	getDepositInfos := func() []DepositInfo {
+		dis := make([]DepositInfo, len(ids))
+		for i, id := range ids {
+			di, err := e.store.(*Store).getDepositInfo(id)
+			require.NoError(t, err)
+			dis[i] = di
+		}
+		return dis
+	}
+
+	dis := getDepositInfos()
+	for i := 0; i < 30 && (dis[0].Status == StatusWaitSend || dis[2].Status == StatusWaitSend); i++ {
+		time.Sleep(time.Millisecond * 100)
+		dis = getDepositInfos()
+	}
+
+	// The deposits to different addresses are sent by one transaction, with an output each
+	require.Equal(t, StatusWaitConfirm, dis[0].Status)
+	require.Equal(t, StatusWaitConfirm, dis[2].Status)
+	require.NotEmpty(t, dis[0].Txid)
+	require.Equal(t, dis[0].Txid, dis[2].Txid)
+	require.Equal(t, uint64(100e6), dis[0].SkySent)
+	require.Equal(t, uint64(100e6), dis[2].SkySent)
+	require.NotEmpty(t, dis[0].SkyOutput)
+	require.NotEmpty(t, dis[2].SkyOutput)
+	require.NotEqual(t, dis[0].SkyOutput, dis[2].SkyOutput)
+
+	// The second deposit to testSkyAddr waits for the next batch
+	require.Equal(t, StatusWaitSend, dis[1].Status)
+
+	details, err := e.GetDepositStatusDetail(func(di DepositInfo) bool {
+		return di.DepositID == ids[2]
+	})
+	require.NoError(t, err)
+	require.Len(t, details, 1)
+	require.Equal(t, dis[2].Txid, details[0].Txid)
+	require.Equal(t, dis[2].SkyOutput, details[0].SkyOutput)
+
+	// Once the batch is confirmed, the next batch is sent
+	e.sender.(*dummySender).setTxConfirmed(dis[0].Txid)
+
+	for i := 0; i < 30 && dis[1].Status != StatusWaitConfirm; i++ {
+		time.Sleep(time.Millisecond * 100)
+		dis = getDepositInfos()
+	}
+
+	require.Equal(t, StatusDone, dis[0].Status)
+	require.Equal(t, StatusDone, dis[2].Status)
+	require.Equal(t, StatusWaitConfirm, dis[1].Status)
+	require.NotEqual(t, dis[0].Txid, dis[1].Txid)
+	require.Equal(t, uint64(100e6), dis[1].SkySent)
+}
+
+type testBestHeighter int64
+
+func (h testBestHeighter) BestHeight() int64 {
+	return int64(h)
+}
+
+func TestExchangeGetDepositStatuses(t *testing.T) {
+	store, shutdown := newTestStore(t)
+	defer shutdown()
+
+	populateTestStore(t, store)
+
+	// A deposit saved before the deposit transaction was copied out of DepositInfo.Deposit
+	require.NoError(t, store.BindAddress("skyaddr1", "btcaddr4", "", "", "", 0, 0))
+	_, err := store.addDepositInfo(DepositInfo{
+		Status:         StatusWaitSend,
+		CoinType:       scanner.CoinTypeBTC,
+		SkyAddress:     "skyaddr1",
+		DepositAddress: "btcaddr4",
+		DepositID:      "btx4:3",
+		DepositValue:   1e6,
+		ConversionRate: testSkyBtcRate,
+		Deposit: scanner.Deposit{
+			CoinType: scanner.CoinTypeBTC,
+			Address:  "btcaddr4",
+			Value:    1e6,
+			Height:   18,
+			Tx:       "btx4",
+			N:        3,
+		},
+	})
+	require.NoError(t, err)
+
+	log, _ := testutil.NewLogger(t)
+	s := &Exchange{
+		log:   log,
+		store: store,
+		cfg: Config{
+			ConfirmationsRequired: map[string]int64{
+				scanner.CoinTypeBTC: 2,
+			},
+		},
+		heighters: make(map[string]BestHeighter),
+	}
+
+	// Confirmations are 0 while the best height is not known
+	dss, err := s.GetDepositStatuses("skyaddr1", false)
+	require.NoError(t, err)
+	require.Len(t, dss, 4)
+	for _, ds := range dss {
+		require.Equal(t, int64(0), ds.Confirmations)
+	}
+
+	s.SetBestHeighter(scanner.CoinTypeBTC, testBestHeighter(25))
+
+	dss, err = s.GetDepositStatuses("skyaddr1", false)
+	require.NoError(t, err)
+	require.Equal(t, []DepositStatus{
+		{
+			Seq:                   dss[0].Seq,
+			UpdatedAt:             dss[0].UpdatedAt,
+			Status:                StatusDone.String(),
+			CoinType:              scanner.CoinTypeBTC,
+			DepositTxid:           "btx1",
+			DepositN:              1,
+			Confirmations:         5,
+			ConfirmationsRequired: 1,
+		},
+		{
+			Seq:                   dss[1].Seq,
+			UpdatedAt:             dss[1].UpdatedAt,
+			Status:                StatusWaitSend.String(),
+			CoinType:              scanner.CoinTypeBTC,
+			DepositTxid:           "btx2",
+			DepositN:              0,
+			Confirmations:         4,
+			ConfirmationsRequired: 1,
+		},
+		{
+			// btcaddr2 has no deposit yet
+			Seq:           dss[2].Seq,
+			UpdatedAt:     dss[2].UpdatedAt,
+			Status:        StatusWaitDeposit.String(),
+			ExpectedValue: 2e6,
+		},
+		{
+			Seq:                   dss[3].Seq,
+			UpdatedAt:             dss[3].UpdatedAt,
+			Status:                StatusWaitSend.String(),
+			CoinType:              scanner.CoinTypeBTC,
+			DepositTxid:           "btx4",
+			DepositN:              3,
+			Confirmations:         7,
+			ConfirmationsRequired: 2,
+		},
+	}, dss)
+
+	// The status history is only included if requested
+	dss, err = s.GetDepositStatuses("skyaddr1", true)
+	require.NoError(t, err)
+	require.Len(t, dss, 4)
+
+	var statuses []string
+	for _, c := range dss[0].History {
+		statuses = append(statuses, c.Status)
+	}
+	require.Equal(t, []string{
+		StatusWaitSend.String(),
+		StatusWaitConfirm.String(),
+		StatusDone.String(),
+	}, statuses)
+	require.Empty(t, dss[2].History)
+}
+
+func TestExchangeGetDepositStatusDetail(t *testing.T) {
+	// TODO
+}
+
+func TestExchangeGetDepositDetail(t *testing.T) {
+	store, shutdown := newTestStore(t)
+	defer shutdown()
+
+	populateTestStore(t, store)
+
+	log, _ := testutil.NewLogger(t)
+	s := &Exchange{
+		log:   log,
+		store: store,
+	}
+
+	_, err := s.GetDepositDetail("btx9:9")
+	require.Equal(t, ErrDepositNotFound, err)
+
+	dd, err := s.GetDepositDetail("btx1:1")
+	require.NoError(t, err)
+	require.Equal(t, "skyaddr1", dd.SkyAddress)
+	require.Equal(t, "btcaddr1", dd.DepositAddress)
+	require.Equal(t, "btx1:1", dd.DepositID)
+	require.Equal(t, StatusDone.String(), dd.Status)
+	require.Equal(t, "skytx1", dd.Txid)
+	require.Equal(t, int64(1e6), dd.DepositValue)
+	require.Equal(t, testSkyBtcRate, dd.ConversionRate)
+	require.Equal(t, uint64(100e6), dd.SkySent)
+
+	var statuses []string
+	for _, c := range dd.History {
+		require.NotZero(t, c.Time)
+		statuses = append(statuses, c.Status)
+	}
+	require.Equal(t, []string{
+		StatusWaitSend.String(),
+		StatusWaitConfirm.String(),
+		StatusDone.String(),
+	}, statuses)
+
+	// Updates that don't change the status are left out of the history
+	_, err = store.UpdateDepositInfo("btx2:0", func(di DepositInfo) DepositInfo {
+		di.Error = "send failed"
+		return di
+	})
+	require.NoError(t, err)
+
+	dd, err = s.GetDepositDetail("btx2:0")
+	require.NoError(t, err)
+	require.Len(t, dd.History, 1)
+	require.Equal(t, StatusWaitSend.String(), dd.History[0].Status)
+	require.Equal(t, "send failed", dd.Error)
+
+	// Waiting deposits are reported as paused while payouts are paused
+	require.NoError(t, s.Pause("maintenance"))
+
+	dd, err = s.GetDepositDetail("btx2:0")
+	require.NoError(t, err)
+	require.Equal(t, StatusPaused, dd.Status)
+}
+
+func TestExchangeGetDepositAuditLog(t *testing.T) {
+	store, shutdown := newTestStore(t)
+	defer shutdown()
+
+	populateTestStore(t, store)
+
+	log, _ := testutil.NewLogger(t)
+	s := &Exchange{
+		log:   log,
+		store: store,
+	}
+
+	_, err := s.GetDepositAuditLog("btx9:9")
+	require.Equal(t, ErrDepositNotFound, err)
+
+	_, err = store.UpdateDepositInfo("btx2:0", func(di DepositInfo) DepositInfo {
+		di.Status = StatusDone
+		di.Error = ErrEmptySendAmount.Error()
+		return di
+	})
+	require.NoError(t, err)
+
+	_, err = store.ReprocessDepositInfo("btx2:0", "200", "rate was wrong", "127.0.0.1")
+	require.NoError(t, err)
+
+	al, err := s.GetDepositAuditLog("btx2:0")
+	require.NoError(t, err)
+	require.Equal(t, "btx2:0", al.Deposit.DepositID)
+	require.Equal(t, StatusWaitSend.String(), al.Deposit.Status)
+	require.Len(t, al.Events, 4)
+
+	for _, ev := range al.Events {
+		require.NotZero(t, ev.Seq)
+		require.NotZero(t, ev.Time)
+	}
+
+	require.Equal(t, EventDepositInfo, al.Events[0].Type)
+	require.Equal(t, StatusWaitSend.String(), al.Events[0].Status)
+	require.Equal(t, testSkyBtcRate, al.Events[0].ConversionRate)
+	require.Empty(t, al.Events[0].Error)
+
+	require.Equal(t, EventDepositInfo, al.Events[1].Type)
+	require.Equal(t, StatusDone.String(), al.Events[1].Status)
+	require.Equal(t, ErrEmptySendAmount.Error(), al.Events[1].Error)
+
+	// Reprocessing records the updated deposit and the operator's request
+	require.Equal(t, EventDepositInfo, al.Events[2].Type)
+	require.Equal(t, StatusWaitSend.String(), al.Events[2].Status)
+	require.Equal(t, "200", al.Events[2].ConversionRate)
+	require.Empty(t, al.Events[2].Error)
+	require.Empty(t, al.Events[2].Reason)
+
+	require.Equal(t, EventReprocess, al.Events[3].Type)
+	require.Equal(t, StatusWaitSend.String(), al.Events[3].Status)
+	require.Equal(t, "rate was wrong", al.Events[3].Reason)
+	require.Equal(t, "127.0.0.1", al.Events[3].RemoteAddr)
+}
+
+func TestExchangeGetBindNum(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	log, _ := testutil.NewLogger(t)
+	store, err := NewStore(log, db, nil)
+	require.NoError(t, err)
+
+	s := &Exchange{
+		store: store,
+	}
+
+	num, err := s.GetBindNum("a")
+	require.Equal(t, num, 0)
+	require.NoError(t, err)
+
+	err = s.store.BindAddress("a", "b", "", "", "", 0, 0)
+	require.NoError(t, err)
+
+	num, err = s.GetBindNum("a")
+	require.NoError(t, err)
+	require.Equal(t, num, 1)
+}
+
+func TestExchangeShutdownDrainTimeout(t *testing.T) {
+	// Test that Shutdown stops waiting for a broadcast that doesn't finish after the drain timeout,
+	// and that the deposit stays StatusWaitSend without an error once the sender is shut down
+	log, hook := testutil.NewLogger(t)
+	e, run, shutdown := setupExchange(t, log)
+	e.cfg.DrainTimeout = time.Millisecond * 100
+	block := make(chan struct{})
+	e.sender.(*dummySender).broadcastBlock = block
+	go run()
+	defer shutdown()
+
+	btcAddr := "foo-btc-addr"
+	err := e.store.BindAddress(testSkyAddr, btcAddr, "", "", "", 0, 0)
+	require.NoError(t, err)
+
+	dn := scanner.DepositNote{
+		Deposit: scanner.Deposit{
+			CoinType: scanner.CoinTypeBTC,
+			Address:  btcAddr,
+			Value:    1e8,
+			Height:   20,
+			Tx:       "foo-tx",
+			N:        2,
+		},
+		ErrC: make(chan error, 1),
+	}
+	e.scanner.(*dummyScanner).addDeposit(dn)
+	require.NoError(t, <-dn.ErrC)
+
+	for i := 0; i < 30 && len(e.sendingIDs()) == 0; i++ {
+		time.Sleep(time.Millisecond * 10)
+	}
+	require.Equal(t, []string{dn.Deposit.ID()}, e.sendingIDs())
+
+	e.Shutdown()
+	require.Equal(t, "Timed out waiting for the deposits being sent to be saved, they are sent after a restart", hook.LastEntry().Message)
+	require.Equal(t, []string{dn.Deposit.ID()}, hook.LastEntry().Data["sending"])
+
+	// Shutting down the sender abandons the broadcast
+	close(block)
+	for i := 0; i < 30 && len(e.sendingIDs()) != 0; i++ {
+		time.Sleep(time.Millisecond * 10)
+	}
+	require.Empty(t, e.sendingIDs())
+
+	di, err := e.store.(*Store).getDepositInfo(dn.Deposit.ID())
+	require.NoError(t, err)
+	require.Equal(t, StatusWaitSend, di.Status)
+	require.Empty(t, di.Txid)
+	require.Empty(t, di.Error)
+
+	for _, e := range hook.AllEntries() {
+		require.NotEqual(t, "processWaitSendDeposit failed. This deposit will not be reprocessed until teller is restarted.", e.Message)
+	}
+}
+
+func TestExchangeDustDeposits(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	log, _ := testutil.NewLogger(t)
+	store, err := NewStore(log, db, nil)
+	require.NoError(t, err)
+
+	cfg := Config{
+		Rate: "100",
+		DustThresholds: map[string]int64{
+			scanner.CoinTypeBTC: 1000,
+		},
+	}
+
+	e, err := NewExchange(log, store, newDummyScanner(), newDummySender(), cfg)
+	require.NoError(t, err)
+
+	require.NoError(t, store.BindAddress(testSkyAddr, "dustaddr", "", "", "", 0, 0))
+
+	save := func(tx string, value int64) DepositInfo {
+		di, err := e.saveIncomingDeposit(scanner.Deposit{
+			CoinType: scanner.CoinTypeBTC,
+			Address:  "dustaddr",
+			Value:    value,
+			Height:   100,
+			Tx:       tx,
+			N:        1,
+		})
+		require.NoError(t, err)
+		return di
+	}
+
+	// Deposits below the dust threshold are recorded, but not sent
+	dust := save("dusttx", 999)
+	require.Equal(t, StatusIgnoredDust, dust.Status)
+
+	di := save("oktx", 1000)
+	require.Equal(t, StatusWaitSend, di.Status)
+
+	dss, err := e.GetDepositStatuses(testSkyAddr, false)
+	require.NoError(t, err)
+	require.Len(t, dss, 2)
+
+	// Dust is left out of the status responses with HideDust
+	cfg.HideDust = true
+	e, err = NewExchange(log, store, newDummyScanner(), newDummySender(), cfg)
+	require.NoError(t, err)
+
+	dss, err = e.GetDepositStatuses(testSkyAddr, false)
+	require.NoError(t, err)
+	require.Len(t, dss, 1)
+	require.Equal(t, "oktx", dss[0].DepositTxid)
+	require.Equal(t, "waiting_send", dss[0].Status)
 }
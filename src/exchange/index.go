@@ -0,0 +1,178 @@
+package exchange
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/skycoin/teller/src/util/dbcrypt"
+	"github.com/skycoin/teller/src/util/dbutil"
+)
+
+var (
+	// index of the deposits of each skycoin address, "<skycoin address>/<deposit ID>" as key, deposit ID as value.
+	// The skycoin address is hashed if encryption is enabled.
+	skyDepositsIndexBkt = []byte("sky_deposits_index")
+
+	// index of the deposits in each status, "<status>/<deposit ID>" as key, deposit ID as value
+	statusDepositsIndexBkt = []byte("status_deposits_index")
+)
+
+// DepositQuery selects deposits with the indexes of the store, instead of reading every deposit.
+// A deposit matches if it matches every field that is set.
+type DepositQuery struct {
+	// Skycoin address the deposits are bound to
+	SkyAddress string
+	// Statuses of the deposits, any of them
+	Statuses []Status
+	// Campaign the deposit addresses were bound for
+	Campaign string
+	// Promo code the deposit addresses were bound with
+	PromoCode string
+}
+
+// Match reports whether di matches the query
+func (q DepositQuery) Match(di DepositInfo) bool {
+	if q.SkyAddress != "" && di.SkyAddress != q.SkyAddress {
+		return false
+	}
+
+	if q.Campaign != "" && di.Campaign != q.Campaign {
+		return false
+	}
+
+	if q.PromoCode != "" && di.PromoCode != q.PromoCode {
+		return false
+	}
+
+	if len(q.Statuses) == 0 {
+		return true
+	}
+
+	for _, st := range q.Statuses {
+		if di.Status == st {
+			return true
+		}
+	}
+
+	return false
+}
+
+func indexKey(prefix, depositID string) string {
+	return prefix + "/" + depositID
+}
+
+// indexDepositInfoTx updates the indexes for di, which was prev before the change, or is new if prev is nil.
+// The skycoin addresses are hashed with c.
+func indexDepositInfoTx(tx *bolt.Tx, c *dbcrypt.Cipher, prev *DepositInfo, di DepositInfo) error {
+	if prev != nil && prev.SkyAddress != di.SkyAddress {
+		if err := deleteIndexKeyTx(tx, skyDepositsIndexBkt, indexKey(c.Hash(prev.SkyAddress), prev.DepositID)); err != nil {
+			return err
+		}
+	}
+
+	if prev == nil || prev.SkyAddress != di.SkyAddress {
+		if err := dbutil.PutBucketValue(tx, skyDepositsIndexBkt, indexKey(c.Hash(di.SkyAddress), di.DepositID), di.DepositID); err != nil {
+			return err
+		}
+	}
+
+	if prev != nil && prev.Status != di.Status {
+		if err := deleteIndexKeyTx(tx, statusDepositsIndexBkt, indexKey(prev.Status.String(), prev.DepositID)); err != nil {
+			return err
+		}
+	}
+
+	if prev == nil || prev.Status != di.Status {
+		if err := dbutil.PutBucketValue(tx, statusDepositsIndexBkt, indexKey(di.Status.String(), di.DepositID), di.DepositID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func deleteIndexKeyTx(tx *bolt.Tx, bktName []byte, key string) error {
+	bkt := tx.Bucket(bktName)
+	if bkt == nil {
+		return dbutil.NewBucketNotExistErr(bktName)
+	}
+
+	return bkt.Delete([]byte(key))
+}
+
+// buildIndexesTx indexes the deposits of databases created before the indexes were added.
+// Indexing a deposit again changes nothing, so it is safe to apply to indexed databases.
+func buildIndexesTx(tx *bolt.Tx) error {
+	return dbutil.ForEach(tx, depositInfoBkt, func(k, v []byte) error {
+		var di DepositInfo
+		if err := json.Unmarshal(v, &di); err != nil {
+			return err
+		}
+
+		return indexDepositInfoTx(tx, nil, nil, di)
+	})
+}
+
+// indexedDepositIDsTx returns the deposit IDs of the index with prefix
+func indexedDepositIDsTx(tx *bolt.Tx, bktName []byte, prefix string) ([]string, error) {
+	var ids []string
+	if err := dbutil.ForEachPrefix(tx, bktName, prefix+"/", func(k, v []byte) error {
+		ids = append(ids, string(v))
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// QueryDepositInfos returns the deposits matching q, ordered by deposit ID like GetDepositInfoArray.
+// Deposits are looked up by the skycoin address index if q.SkyAddress is set, otherwise by the status index.
+func (s *Store) QueryDepositInfos(q DepositQuery) ([]DepositInfo, error) {
+	if q.SkyAddress == "" && len(q.Statuses) == 0 {
+		return s.GetDepositInfoArray(q.Match)
+	}
+
+	var dis []DepositInfo
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		var ids []string
+		if q.SkyAddress != "" {
+			var err error
+			ids, err = indexedDepositIDsTx(tx, skyDepositsIndexBkt, s.c.Hash(q.SkyAddress))
+			if err != nil {
+				return err
+			}
+		} else {
+			for _, st := range q.Statuses {
+				stIDs, err := indexedDepositIDsTx(tx, statusDepositsIndexBkt, st.String())
+				if err != nil {
+					return err
+				}
+				ids = append(ids, stIDs...)
+			}
+		}
+
+		for _, id := range ids {
+			di, err := s.getDepositInfoTx(tx, id)
+			if err != nil {
+				return err
+			}
+
+			if q.Match(di) {
+				dis = append(dis, di)
+			}
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(dis, func(i, j int) bool {
+		return dis[i].DepositID < dis[j].DepositID
+	})
+
+	return dis, nil
+}
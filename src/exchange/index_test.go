@@ -0,0 +1,145 @@
+package exchange
+
+import (
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+func depositIDs(dis []DepositInfo) []string {
+	var ids []string
+	for _, di := range dis {
+		ids = append(ids, di.DepositID)
+	}
+	return ids
+}
+
+func TestStoreQueryDepositInfos(t *testing.T) {
+	s, shutdown := newTestStore(t)
+	defer shutdown()
+
+	for _, di := range []DepositInfo{
+		{
+			DepositID:      "t3:0",
+			DepositAddress: "b1",
+			SkyAddress:     "s1",
+			DepositValue:   1e6,
+			ConversionRate: testSkyBtcRate,
+			Status:         StatusWaitSend,
+		},
+		{
+			DepositID:      "t1:0",
+			DepositAddress: "b1",
+			SkyAddress:     "s1",
+			DepositValue:   1e6,
+			ConversionRate: testSkyBtcRate,
+			Status:         StatusWaitSend,
+		},
+		{
+			DepositID:      "t2:0",
+			DepositAddress: "b2",
+			SkyAddress:     "s12",
+			DepositValue:   1e6,
+			ConversionRate: testSkyBtcRate,
+			Status:         StatusWaitSend,
+		},
+	} {
+		_, err := s.addDepositInfo(di)
+		require.NoError(t, err)
+	}
+
+	_, err := s.UpdateDepositInfo("t3:0", func(di DepositInfo) DepositInfo {
+		di.Status = StatusWaitConfirm
+		di.Txid = "sky-txid"
+		return di
+	})
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		name string
+		q    DepositQuery
+		ids  []string
+	}{
+		{
+			name: "all",
+			ids:  []string{"t1:0", "t2:0", "t3:0"},
+		},
+		{
+			name: "skycoin address",
+			q:    DepositQuery{SkyAddress: "s1"},
+			ids:  []string{"t1:0", "t3:0"},
+		},
+		{
+			name: "status",
+			q:    DepositQuery{Statuses: []Status{StatusWaitSend}},
+			ids:  []string{"t1:0", "t2:0"},
+		},
+		{
+			name: "statuses",
+			q:    DepositQuery{Statuses: []Status{StatusWaitConfirm, StatusWaitSend}},
+			ids:  []string{"t1:0", "t2:0", "t3:0"},
+		},
+		{
+			name: "skycoin address and status",
+			q:    DepositQuery{SkyAddress: "s1", Statuses: []Status{StatusWaitConfirm}},
+			ids:  []string{"t3:0"},
+		},
+		{
+			name: "no match",
+			q:    DepositQuery{Statuses: []Status{StatusDone}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dis, err := s.QueryDepositInfos(tc.q)
+			require.NoError(t, err)
+			require.Equal(t, tc.ids, depositIDs(dis))
+
+			for _, di := range dis {
+				require.True(t, tc.q.Match(di))
+			}
+		})
+	}
+
+	// The old status is removed from the index
+	err = s.db.View(func(tx *bolt.Tx) error {
+		ids, err := indexedDepositIDsTx(tx, statusDepositsIndexBkt, StatusWaitSend.String())
+		require.NoError(t, err)
+		require.Equal(t, []string{"t1:0", "t2:0"}, ids)
+		return nil
+	})
+	require.NoError(t, err)
+}
+
+func TestNewStoreBuildIndexes(t *testing.T) {
+	s, shutdown := newTestStore(t)
+	defer shutdown()
+
+	populateTestStore(t, s)
+
+	want, err := s.QueryDepositInfos(DepositQuery{SkyAddress: "skyaddr1"})
+	require.NoError(t, err)
+	require.NotEmpty(t, want)
+
+	// A db created before the indexes were added
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		require.NoError(t, tx.DeleteBucket(skyDepositsIndexBkt))
+		return tx.DeleteBucket(statusDepositsIndexBkt)
+	})
+	require.NoError(t, err)
+	unversionSchema(t, s.db)
+
+	log, _ := testutil.NewLogger(t)
+	s2, err := NewStore(log, s.db, nil)
+	require.NoError(t, err)
+
+	dis, err := s2.QueryDepositInfos(DepositQuery{SkyAddress: "skyaddr1"})
+	require.NoError(t, err)
+	require.Equal(t, want, dis)
+
+	dis, err = s2.QueryDepositInfos(DepositQuery{Statuses: []Status{StatusDone}})
+	require.NoError(t, err)
+	require.NotEmpty(t, dis)
+}
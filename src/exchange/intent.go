@@ -0,0 +1,178 @@
+package exchange
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/skycoin/skycoin/src/coin"
+
+	"github.com/skycoin/teller/src/util/dbutil"
+)
+
+var (
+	// send intents, written before their transaction is broadcast, txid as key
+	sendIntentsBkt = []byte("send_intents")
+
+	// send intent of each deposit, deposit ID ("<txid>:<n>" of the deposit) as key, txid of the intent as value
+	depositIntentsBkt = []byte("deposit_intents")
+)
+
+// ErrDepositHasSendIntent is returned when adding a send intent for a deposit that already has one
+var ErrDepositHasSendIntent = errors.New("Deposit already has a send intent")
+
+// SendIntentDeposit is a deposit paid by the transaction of a SendIntent
+type SendIntentDeposit struct {
+	DepositID string `json:"deposit_id"`
+	SkySent   uint64 `json:"sky_sent"`
+	SkyGross  uint64 `json:"sky_gross"`
+	SkyOutput string `json:"sky_output"`
+}
+
+// SendIntent records a skycoin transaction before it is broadcast. The deposit ID is the idempotency
+// key of a send: while a deposit has a send intent, it is only ever paid by the intent's transaction,
+// even if teller stops between broadcasting it and saving the deposit as StatusWaitConfirm.
+// The intent is deleted once its deposits are saved as StatusWaitConfirm.
+type SendIntent struct {
+	Txid      string              `json:"txid"`
+	Tx        string              `json:"tx"` // hex encoded serialized transaction
+	Deposits  []SendIntentDeposit `json:"deposits"`
+	CreatedAt int64               `json:"created_at"`
+}
+
+func newSendIntent(tx *coin.Transaction, deposits []SendIntentDeposit) SendIntent {
+	return SendIntent{
+		Txid:      tx.TxIDHex(),
+		Tx:        hex.EncodeToString(tx.Serialize()),
+		Deposits:  deposits,
+		CreatedAt: time.Now().UTC().Unix(),
+	}
+}
+
+// Transaction decodes the transaction of the intent
+func (si SendIntent) Transaction() (*coin.Transaction, error) {
+	b, err := hex.DecodeString(si.Tx)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := coin.TransactionDeserialize(b)
+	if err != nil {
+		return nil, err
+	}
+
+	if tx.TxIDHex() != si.Txid {
+		return nil, fmt.Errorf("Send intent transaction %s does not match its txid %s", tx.TxIDHex(), si.Txid)
+	}
+
+	return &tx, nil
+}
+
+// DepositIDs returns the IDs of the deposits paid by the intent
+func (si SendIntent) DepositIDs() []string {
+	ids := make([]string, len(si.Deposits))
+	for i, d := range si.Deposits {
+		ids[i] = d.DepositID
+	}
+	return ids
+}
+
+// deposit returns the SendIntentDeposit of a deposit
+func (si SendIntent) deposit(depositID string) (SendIntentDeposit, bool) {
+	for _, d := range si.Deposits {
+		if d.DepositID == depositID {
+			return d, true
+		}
+	}
+	return SendIntentDeposit{}, false
+}
+
+// AddSendIntent saves a send intent, before its transaction is broadcast.
+// Returns ErrDepositHasSendIntent if one of its deposits already has a send intent.
+func (s *Store) AddSendIntent(si SendIntent) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if hasKey, err := dbutil.BucketHasKey(tx, sendIntentsBkt, si.Txid); err != nil {
+			return err
+		} else if hasKey {
+			return fmt.Errorf("Send intent %s already exists", si.Txid)
+		}
+
+		for _, d := range si.Deposits {
+			if hasKey, err := dbutil.BucketHasKey(tx, depositIntentsBkt, d.DepositID); err != nil {
+				return err
+			} else if hasKey {
+				return ErrDepositHasSendIntent
+			}
+
+			if err := dbutil.PutBucketValue(tx, depositIntentsBkt, d.DepositID, si.Txid); err != nil {
+				return err
+			}
+		}
+
+		return dbutil.PutBucketValue(tx, sendIntentsBkt, si.Txid, si)
+	})
+}
+
+// GetSendIntents returns the saved send intents, ordered by txid
+func (s *Store) GetSendIntents() ([]SendIntent, error) {
+	var sis []SendIntent
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		return dbutil.ForEach(tx, sendIntentsBkt, func(k, v []byte) error {
+			var si SendIntent
+			if err := json.Unmarshal(v, &si); err != nil {
+				return err
+			}
+
+			sis = append(sis, si)
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+
+	return sis, nil
+}
+
+// GetDepositSendIntent returns the send intent of a deposit, or nil if it has none
+func (s *Store) GetDepositSendIntent(depositID string) (*SendIntent, error) {
+	var si *SendIntent
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		txid, err := dbutil.GetBucketString(tx, depositIntentsBkt, depositID)
+		switch err.(type) {
+		case nil:
+		case dbutil.ObjectNotExistErr:
+			return nil
+		default:
+			return err
+		}
+
+		si = &SendIntent{}
+		return dbutil.GetBucketObject(tx, sendIntentsBkt, txid, si)
+	}); err != nil {
+		return nil, err
+	}
+
+	return si, nil
+}
+
+// DeleteSendIntent deletes a send intent and the keys of its deposits
+func (s *Store) DeleteSendIntent(txid string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		var si SendIntent
+		if err := dbutil.GetBucketObject(tx, sendIntentsBkt, txid, &si); err != nil {
+			return err
+		}
+
+		for _, d := range si.Deposits {
+			if err := deleteIndexKeyTx(tx, depositIntentsBkt, d.DepositID); err != nil {
+				return err
+			}
+		}
+
+		return deleteIndexKeyTx(tx, sendIntentsBkt, txid)
+	})
+}
@@ -0,0 +1,163 @@
+package exchange
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/scanner"
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+func TestStoreSendIntents(t *testing.T) {
+	s, shutdown := newTestStore(t)
+	defer shutdown()
+
+	tx, err := newDummySender().CreateTransaction(testSkyAddr, 10e6)
+	require.NoError(t, err)
+
+	si := newSendIntent(tx, []SendIntentDeposit{
+		{DepositID: "btx1:1", SkySent: 10e6, SkyGross: 10e6},
+		{DepositID: "btx2:1", SkySent: 10e6, SkyGross: 10e6},
+	})
+	require.Equal(t, tx.TxIDHex(), si.Txid)
+
+	decoded, err := si.Transaction()
+	require.NoError(t, err)
+	require.Equal(t, tx.TxIDHex(), decoded.TxIDHex())
+
+	got, err := s.GetDepositSendIntent("btx1:1")
+	require.NoError(t, err)
+	require.Nil(t, got)
+
+	err = s.AddSendIntent(si)
+	require.NoError(t, err)
+
+	got, err = s.GetDepositSendIntent("btx2:1")
+	require.NoError(t, err)
+	require.Equal(t, &si, got)
+
+	// A deposit is only paid by one send intent
+	tx2, err := newDummySender().CreateTransaction(testSkyAddr2, 10e6)
+	require.NoError(t, err)
+	err = s.AddSendIntent(newSendIntent(tx2, []SendIntentDeposit{
+		{DepositID: "btx3:1"},
+		{DepositID: "btx1:1"},
+	}))
+	require.Equal(t, ErrDepositHasSendIntent, err)
+
+	got, err = s.GetDepositSendIntent("btx3:1")
+	require.NoError(t, err)
+	require.Nil(t, got)
+
+	sis, err := s.GetSendIntents()
+	require.NoError(t, err)
+	require.Equal(t, []SendIntent{si}, sis)
+
+	err = s.DeleteSendIntent(si.Txid)
+	require.NoError(t, err)
+
+	sis, err = s.GetSendIntents()
+	require.NoError(t, err)
+	require.Empty(t, sis)
+
+	got, err = s.GetDepositSendIntent("btx1:1")
+	require.NoError(t, err)
+	require.Nil(t, got)
+}
+
+func TestExchangeReconcileSendIntents(t *testing.T) {
+	// Tests that deposits with a send intent left by a stop before they were saved as StatusWaitConfirm
+	// are only paid by the intent's transaction, whether or not it was broadcast
+	log, _ := testutil.NewLogger(t)
+	db, shutdownDB := testutil.PrepareDB(t)
+	defer shutdownDB()
+
+	e := newTestExchange(t, log, db)
+	store := e.store.(*Store)
+	sdr := e.sender.(*dummySender)
+
+	newDeposit := func(skyAddr, btcAddr, tx string) DepositInfo {
+		err := store.BindAddress(skyAddr, btcAddr, "", "", "", 0, 0)
+		require.NoError(t, err)
+
+		di, err := store.addDepositInfo(DepositInfo{
+			Status:         StatusWaitSend,
+			CoinType:       scanner.CoinTypeBTC,
+			SkyAddress:     skyAddr,
+			DepositAddress: btcAddr,
+			DepositID:      tx + ":1",
+			DepositTx:      tx,
+			DepositN:       1,
+			ConversionRate: testSkyBtcRate,
+			DepositValue:   1e8,
+		})
+		require.NoError(t, err)
+		return di
+	}
+
+	// The transactions of the intents send less than the deposits would be sent now,
+	// so that a new transaction would have a different txid
+	newIntent := func(di DepositInfo) SendIntent {
+		tx, err := sdr.CreateTransaction(di.SkyAddress, 50e6)
+		require.NoError(t, err)
+
+		skySent, skyOutput := findOutput(tx, di.SkyAddress)
+		si := newSendIntent(tx, []SendIntentDeposit{
+			{
+				DepositID: di.DepositID,
+				SkySent:   skySent,
+				SkyGross:  skySent,
+				SkyOutput: skyOutput,
+			},
+		})
+
+		err = store.AddSendIntent(si)
+		require.NoError(t, err)
+		return si
+	}
+
+	// The first intent's transaction was broadcast before the stop, the second one's was not
+	broadcast := newIntent(newDeposit(testSkyAddr, "btc-addr-1", "btc-tx-1"))
+	notBroadcast := newIntent(newDeposit(testSkyAddr2, "btc-addr-2", "btc-tx-2"))
+
+	tx, err := broadcast.Transaction()
+	require.NoError(t, err)
+	require.NoError(t, sdr.BroadcastTransaction(tx).Err)
+	sdr.setTxConfirmed(broadcast.Txid)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		require.NoError(t, e.Run())
+	}()
+
+	for i := 0; i < 50 && sdr.broadcastCount(notBroadcast.Txid) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.Equal(t, 1, sdr.broadcastCount(notBroadcast.Txid))
+	sdr.setTxConfirmed(notBroadcast.Txid)
+
+	for _, si := range []SendIntent{broadcast, notBroadcast} {
+		var di DepositInfo
+		for i := 0; i < 50 && di.Status != StatusDone; i++ {
+			time.Sleep(10 * time.Millisecond)
+			di, err = store.getDepositInfo(si.Deposits[0].DepositID)
+			require.NoError(t, err)
+		}
+
+		require.Equal(t, StatusDone, di.Status)
+		require.Equal(t, si.Txid, di.Txid)
+		require.Equal(t, si.Deposits[0].SkySent, di.SkySent)
+		require.Equal(t, si.Deposits[0].SkyOutput, di.SkyOutput)
+		require.Equal(t, 1, sdr.broadcastCount(si.Txid))
+	}
+
+	sis, err := store.GetSendIntents()
+	require.NoError(t, err)
+	require.Empty(t, sis)
+
+	e.Shutdown()
+	<-done
+}
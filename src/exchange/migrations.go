@@ -0,0 +1,31 @@
+package exchange
+
+import (
+	"github.com/skycoin/teller/src/util/migrate"
+)
+
+// SchemaName is the name of the exchange store in the schema version bucket
+const SchemaName = "exchange"
+
+// Migrations upgrade the exchange buckets of dbs created by earlier versions of teller, in order.
+// NewStore applies the pending ones. The first ones were applied whenever their buckets were created,
+// before the schema was versioned, so they are safe to apply again.
+// New migrations are appended, existing ones must never change. NewStore encrypts the buckets after applying them,
+// so these ones only read values stored before encryption was enabled; later ones must decrypt the values.
+var Migrations = []migrate.Migration{
+	{
+		Version:     1,
+		Description: "Index the events of each deposit",
+		Migrate:     buildDepositEventsIndexTx,
+	},
+	{
+		Version:     2,
+		Description: "Index the deposits by skycoin address and by status",
+		Migrate:     buildIndexesTx,
+	},
+	{
+		Version:     3,
+		Description: "Seed the event log with the existing bindings and deposits",
+		Migrate:     seedEventsTx,
+	},
+}
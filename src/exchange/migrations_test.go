@@ -0,0 +1,59 @@
+package exchange
+
+import (
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/util/migrate"
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+// unversionSchema simulates a database from before the schema was versioned
+func unversionSchema(t *testing.T, db *bolt.DB) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		return tx.DeleteBucket([]byte("schema_version"))
+	})
+	require.NoError(t, err)
+}
+
+func TestMigrations(t *testing.T) {
+	require.NoError(t, migrate.Validate(Migrations))
+
+	s, shutdown := newTestStore(t)
+	defer shutdown()
+
+	// A new store is created at the latest version
+	v, err := migrate.Version(s.db, SchemaName)
+	require.NoError(t, err)
+	require.Equal(t, len(Migrations), v)
+
+	pending, err := migrate.Pending(s.db, SchemaName, Migrations)
+	require.NoError(t, err)
+	require.Empty(t, pending)
+
+	populateTestStore(t, s)
+
+	evs, err := s.GetDepositEvents()
+	require.NoError(t, err)
+
+	// The migrations of an unversioned store are applied again without changing it
+	unversionSchema(t, s.db)
+
+	pending, err = migrate.Pending(s.db, SchemaName, Migrations)
+	require.NoError(t, err)
+	require.Len(t, pending, len(Migrations))
+
+	log, _ := testutil.NewLogger(t)
+	s2, err := NewStore(log, s.db, nil)
+	require.NoError(t, err)
+
+	evs2, err := s2.GetDepositEvents()
+	require.NoError(t, err)
+	require.Equal(t, evs, evs2)
+
+	v, err = migrate.Version(s.db, SchemaName)
+	require.NoError(t, err)
+	require.Equal(t, len(Migrations), v)
+}
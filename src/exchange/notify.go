@@ -0,0 +1,58 @@
+package exchange
+
+import (
+	"github.com/boltdb/bolt"
+
+	"github.com/skycoin/teller/src/notify"
+)
+
+// EnableNotifications makes the store add a notify.Event to the notify.Queue outbox whenever a deposit
+// is done or errored, in the same transaction as the change, so that its user can be emailed
+func (s *Store) EnableNotifications() {
+	s.notifications = true
+}
+
+// NotifyEvents returns the events of a deposit changing from prev to di that its user is notified of.
+// prev is nil if the deposit was created.
+func NotifyEvents(prev *DepositInfo, di DepositInfo) []notify.EventType {
+	var types []notify.EventType
+
+	if di.Status == StatusDone && (prev == nil || prev.Status != StatusDone) {
+		types = append(types, notify.EventDone)
+	}
+
+	for _, t := range LifecycleEvents(prev, di) {
+		if t == LifecycleErrored {
+			types = append(types, notify.EventErrored)
+		}
+	}
+
+	return types
+}
+
+// putNotifyEventsTx adds the events of a deposit changing from prev to di that its user is notified of
+// to the notify.Queue outbox, if notifications are enabled
+func (s *Store) putNotifyEventsTx(tx *bolt.Tx, prev *DepositInfo, di DepositInfo) error {
+	if !s.notifications {
+		return nil
+	}
+
+	for _, t := range NotifyEvents(prev, di) {
+		if err := notify.PutEventTx(tx, notify.Event{
+			Type:           t,
+			Time:           di.UpdatedAt,
+			CoinType:       di.CoinType,
+			SkyAddress:     di.SkyAddress,
+			DepositAddress: di.DepositAddress,
+			DepositID:      di.DepositID,
+			DepositValue:   di.DepositValue,
+			SkySent:        di.SkySent,
+			Txid:           di.Txid,
+			Error:          di.Error,
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,118 @@
+package exchange
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/notify"
+	"github.com/skycoin/teller/src/outbox"
+	"github.com/skycoin/teller/src/scanner"
+)
+
+func TestNotifyEvents(t *testing.T) {
+	cases := []struct {
+		name   string
+		prev   *DepositInfo
+		di     DepositInfo
+		events []notify.EventType
+	}{
+		{
+			name: "created",
+			di:   DepositInfo{Status: StatusWaitSend},
+		},
+		{
+			name: "sent",
+			prev: &DepositInfo{Status: StatusWaitSend},
+			di:   DepositInfo{Status: StatusWaitConfirm, Txid: "skytx1"},
+		},
+		{
+			name:   "send confirmed",
+			prev:   &DepositInfo{Status: StatusWaitConfirm, Txid: "skytx1"},
+			di:     DepositInfo{Status: StatusDone, Txid: "skytx1"},
+			events: []notify.EventType{notify.EventDone},
+		},
+		{
+			name: "done updated",
+			prev: &DepositInfo{Status: StatusDone, Txid: "skytx1"},
+			di:   DepositInfo{Status: StatusDone, Txid: "skytx1"},
+		},
+		{
+			name:   "send failed",
+			prev:   &DepositInfo{Status: StatusWaitSend},
+			di:     DepositInfo{Status: StatusWaitSend, Error: "send failed"},
+			events: []notify.EventType{notify.EventErrored},
+		},
+		{
+			name: "held for review",
+			prev: &DepositInfo{Status: StatusWaitSend},
+			di:   DepositInfo{Status: StatusHeldForReview, Error: "flagged"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.events, NotifyEvents(tc.prev, tc.di))
+		})
+	}
+}
+
+func TestStoreNotifications(t *testing.T) {
+	s, shutdown := newTestStore(t)
+	defer shutdown()
+
+	notifyStore, err := outbox.NewQueueStore(s.db, notify.Queue)
+	require.NoError(t, err)
+
+	add := func(id string) {
+		_, err := s.addDepositInfo(DepositInfo{
+			DepositID:      id,
+			CoinType:       scanner.CoinTypeBTC,
+			SkyAddress:     "skyaddr1",
+			DepositAddress: "btcaddr1",
+			DepositValue:   2e6,
+			ConversionRate: testSkyBtcRate,
+			Status:         StatusWaitSend,
+		})
+		require.NoError(t, err)
+	}
+
+	done := func(id string) {
+		_, err := s.UpdateDepositInfo(id, func(di DepositInfo) DepositInfo {
+			di.Status = StatusDone
+			di.Txid = "skytx1"
+			di.SkySent = 1e6
+			return di
+		})
+		require.NoError(t, err)
+	}
+
+	// Nothing is emitted until notifications are enabled
+	add("btx1:0")
+	done("btx1:0")
+
+	n, err := notifyStore.Len()
+	require.NoError(t, err)
+	require.Equal(t, 0, n)
+
+	s.EnableNotifications()
+
+	add("btx2:0")
+	done("btx2:0")
+
+	msgs, err := notifyStore.Pending(0)
+	require.NoError(t, err)
+	require.Len(t, msgs, 1)
+	require.Equal(t, notify.TopicDeposit, msgs[0].Topic)
+
+	var e notify.Event
+	require.NoError(t, json.Unmarshal(msgs[0].Payload, &e))
+	require.Equal(t, notify.EventDone, e.Type)
+	require.Equal(t, "btx2:0", e.DepositID)
+	require.Equal(t, "btcaddr1", e.DepositAddress)
+	require.Equal(t, "skyaddr1", e.SkyAddress)
+	require.Equal(t, "skytx1", e.Txid)
+	require.Equal(t, uint64(1e6), e.SkySent)
+	require.NotZero(t, e.Time)
+}
@@ -0,0 +1,61 @@
+package exchange
+
+import (
+	"github.com/boltdb/bolt"
+
+	"github.com/skycoin/teller/src/outbox"
+)
+
+// TopicDepositStatus is the outbox topic of deposit status changes
+const TopicDepositStatus = "deposit.status"
+
+// DepositStatusMessage is the outbox payload of a deposit status change
+type DepositStatusMessage struct {
+	Seq            uint64 `json:"seq"`
+	UpdatedAt      int64  `json:"updated_at"`
+	Status         string `json:"status"`
+	CoinType       string `json:"coin_type"`
+	SkyAddress     string `json:"skycoin_address"`
+	DepositAddress string `json:"deposit_address"`
+	DepositID      string `json:"deposit_id"`
+	DepositValue   int64  `json:"deposit_value"`
+	SkySent        uint64 `json:"sky_sent"`
+	SkyGross       uint64 `json:"sky_gross"`
+	Txid           string `json:"txid"`
+	SkyOutput      string `json:"skycoin_output,omitempty"`
+	ExpectedValue  int64  `json:"expected_value,omitempty"`
+	PaymentStatus  string `json:"payment_status,omitempty"`
+	Error          string `json:"error,omitempty"`
+}
+
+// EnableOutbox makes the store add a TopicDepositStatus outbox message whenever a
+// deposit is created or changes status, in the same transaction as the change
+func (s *Store) EnableOutbox() {
+	s.outbox = true
+}
+
+// putDepositStatusMessageTx adds a deposit status change to the outbox, if it is enabled
+func (s *Store) putDepositStatusMessageTx(tx *bolt.Tx, di DepositInfo) error {
+	if !s.outbox {
+		return nil
+	}
+
+	_, err := outbox.PutTx(tx, TopicDepositStatus, DepositStatusMessage{
+		Seq:            di.Seq,
+		UpdatedAt:      di.UpdatedAt,
+		Status:         di.Status.String(),
+		CoinType:       di.CoinType,
+		SkyAddress:     di.SkyAddress,
+		DepositAddress: di.DepositAddress,
+		DepositID:      di.DepositID,
+		DepositValue:   di.DepositValue,
+		SkySent:        di.SkySent,
+		SkyGross:       di.SkyGross,
+		Txid:           di.Txid,
+		SkyOutput:      di.SkyOutput,
+		ExpectedValue:  di.ExpectedValue,
+		PaymentStatus:  di.PaymentStatus(),
+		Error:          di.Error,
+	})
+	return err
+}
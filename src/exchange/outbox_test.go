@@ -0,0 +1,101 @@
+package exchange
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/outbox"
+)
+
+func TestStoreOutbox(t *testing.T) {
+	s, shutdown := newTestStore(t)
+	defer shutdown()
+
+	// Nothing is emitted until the outbox is enabled
+	_, err := s.addDepositInfo(DepositInfo{
+		DepositID:      "btx1:1",
+		SkyAddress:     "skyaddr1",
+		DepositAddress: "btcaddr1",
+		DepositValue:   1e6,
+		ConversionRate: testSkyBtcRate,
+		Status:         StatusWaitSend,
+	})
+	require.NoError(t, err)
+
+	outboxStore, err := outbox.NewStore(s.db)
+	require.NoError(t, err)
+
+	n, err := outboxStore.Len()
+	require.NoError(t, err)
+	require.Equal(t, 0, n)
+
+	s.EnableOutbox()
+
+	// A new deposit is emitted
+	_, err = s.addDepositInfo(DepositInfo{
+		DepositID:      "btx2:1",
+		SkyAddress:     "skyaddr1",
+		DepositAddress: "btcaddr2",
+		DepositValue:   2e6,
+		ConversionRate: testSkyBtcRate,
+		Status:         StatusWaitSend,
+	})
+	require.NoError(t, err)
+
+	// A status change is emitted
+	_, err = s.UpdateDepositInfo("btx2:1", func(di DepositInfo) DepositInfo {
+		di.Status = StatusWaitConfirm
+		di.Txid = "skytx1"
+		di.SkySent = 1e6
+		return di
+	})
+	require.NoError(t, err)
+
+	// An update that does not change the status is not emitted
+	_, err = s.UpdateDepositInfo("btx2:1", func(di DepositInfo) DepositInfo {
+		di.Error = "temporary"
+		return di
+	})
+	require.NoError(t, err)
+
+	// A status change rolled back by the callback is not emitted
+	callbackErr := errors.New("callback failed")
+	_, err = s.UpdateDepositInfoCallback("btx2:1", func(di DepositInfo) DepositInfo {
+		di.Status = StatusDone
+		return di
+	}, func(di DepositInfo) error {
+		return callbackErr
+	})
+	require.Equal(t, callbackErr, err)
+
+	msgs, err := outboxStore.Pending(0)
+	require.NoError(t, err)
+	require.Len(t, msgs, 2)
+
+	var statuses []DepositStatusMessage
+	for _, msg := range msgs {
+		require.Equal(t, TopicDepositStatus, msg.Topic)
+
+		var sm DepositStatusMessage
+		require.NoError(t, json.Unmarshal(msg.Payload, &sm))
+		statuses = append(statuses, sm)
+	}
+
+	require.Equal(t, uint64(1), msgs[0].ID)
+	require.Equal(t, "btx2:1", statuses[0].DepositID)
+	require.Equal(t, StatusWaitSend.String(), statuses[0].Status)
+	require.Equal(t, int64(2e6), statuses[0].DepositValue)
+	require.Empty(t, statuses[0].Txid)
+
+	require.Equal(t, uint64(2), msgs[1].ID)
+	require.Equal(t, StatusWaitConfirm.String(), statuses[1].Status)
+	require.Equal(t, "skytx1", statuses[1].Txid)
+	require.Equal(t, uint64(1e6), statuses[1].SkySent)
+
+	di, err := s.getDepositInfo("btx2:1")
+	require.NoError(t, err)
+	require.Equal(t, StatusWaitConfirm, di.Status)
+}
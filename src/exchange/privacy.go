@@ -0,0 +1,82 @@
+package exchange
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/boltdb/bolt"
+)
+
+// isSkyAddressEvent returns true if an event records a binding or a deposit of skyAddr
+func isSkyAddressEvent(ev DepositEvent, skyAddr string) bool {
+	if ev.SkyAddress == skyAddr {
+		return true
+	}
+
+	return ev.DepositInfo != nil && ev.DepositInfo.SkyAddress == skyAddr
+}
+
+// GetSkyAddressEvents returns the events of the bindings and the deposits of a skycoin address, ordered by seq
+func (s *Store) GetSkyAddressEvents(skyAddr string) ([]DepositEvent, error) {
+	var evs []DepositEvent
+
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		return s.c.ForEach(tx, depositEventsBkt, func(k, v []byte) error {
+			var ev DepositEvent
+			if err := json.Unmarshal(v, &ev); err != nil {
+				return err
+			}
+
+			if isSkyAddressEvent(ev, skyAddr) {
+				evs = append(evs, ev)
+			}
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(evs, func(i, j int) bool {
+		return evs[i].Seq < evs[j].Seq
+	})
+
+	return evs, nil
+}
+
+// EraseSkyAddressRemoteAddrs erases the remote addresses of the operator requests on the deposits of a skycoin
+// address from the event log, and returns the number of events changed. It is the only change ever made to
+// an event of the log: the events with a remote address are audit only, replaying the log does not read them.
+func (s *Store) EraseSkyAddressRemoteAddrs(skyAddr string) (int, error) {
+	var n int
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		// The bucket can't be written while iterating it
+		evs := make(map[string]DepositEvent)
+		if err := s.c.ForEach(tx, depositEventsBkt, func(k, v []byte) error {
+			var ev DepositEvent
+			if err := json.Unmarshal(v, &ev); err != nil {
+				return err
+			}
+
+			if ev.RemoteAddr != "" && isSkyAddressEvent(ev, skyAddr) {
+				evs[string(k)] = ev
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		for k, ev := range evs {
+			ev.RemoteAddr = ""
+			if err := s.c.PutBucketValue(tx, depositEventsBkt, k, ev); err != nil {
+				return err
+			}
+		}
+
+		n = len(evs)
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
@@ -0,0 +1,76 @@
+package exchange
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+func TestStoreSkyAddressEvents(t *testing.T) {
+	s, shutdown := newTestStore(t)
+	defer shutdown()
+
+	populateTestStore(t, s)
+
+	evs, err := s.GetSkyAddressEvents("skyaddr1")
+	require.NoError(t, err)
+	require.Len(t, evs, 6)
+	for i, ev := range evs {
+		require.True(t, i == 0 || evs[i-1].Seq < ev.Seq)
+		require.True(t, isSkyAddressEvent(ev, "skyaddr1"))
+	}
+
+	evs, err = s.GetSkyAddressEvents("skyaddr2")
+	require.NoError(t, err)
+	require.Len(t, evs, 2)
+
+	evs, err = s.GetSkyAddressEvents("skyaddr3")
+	require.NoError(t, err)
+	require.Empty(t, evs)
+
+	_, err = s.UpdateDepositInfo("btx3:2", func(di DepositInfo) DepositInfo {
+		di.Status = StatusDone
+		di.Error = ErrEmptySendAmount.Error()
+		return di
+	})
+	require.NoError(t, err)
+
+	_, err = s.ReprocessDepositInfo("btx3:2", "", "empty send", "127.0.0.1:1234")
+	require.NoError(t, err)
+
+	// Only the events of the skycoin address with a remote address are erased
+	n, err := s.EraseSkyAddressRemoteAddrs("skyaddr1")
+	require.NoError(t, err)
+	require.Equal(t, 0, n)
+
+	n, err = s.EraseSkyAddressRemoteAddrs("skyaddr2")
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+
+	evs, err = s.GetSkyAddressEvents("skyaddr2")
+	require.NoError(t, err)
+	require.Len(t, evs, 5)
+	ev := evs[len(evs)-1]
+	require.Equal(t, EventReprocess, ev.Type)
+	require.Equal(t, "empty send", ev.Reason)
+	require.Empty(t, ev.RemoteAddr)
+
+	n, err = s.EraseSkyAddressRemoteAddrs("skyaddr2")
+	require.NoError(t, err)
+	require.Equal(t, 0, n)
+
+	// The state can still be rebuilt from the log
+	evs, err = s.GetDepositEvents()
+	require.NoError(t, err)
+
+	db, shutdown2 := testutil.PrepareDB(t)
+	defer shutdown2()
+
+	require.NoError(t, RebuildState(db, nil, evs))
+
+	diffs, err := CompareState(s.db, db, nil)
+	require.NoError(t, err)
+	require.Empty(t, diffs)
+}
@@ -0,0 +1,31 @@
+package exchange
+
+import (
+	"github.com/boltdb/bolt"
+
+	"github.com/skycoin/teller/src/settlement"
+)
+
+// EnableSettlements makes the store add a settlement whenever a deposit is done with SKY sent,
+// in the same transaction as the change
+func (s *Store) EnableSettlements() {
+	s.settlements = true
+}
+
+// putSettlementTx adds a settlement for a deposit that is done with SKY sent, if settlements are enabled
+func (s *Store) putSettlementTx(tx *bolt.Tx, di DepositInfo) error {
+	if !s.settlements || di.Status != StatusDone || di.SkySent == 0 {
+		return nil
+	}
+
+	return settlement.PutTx(tx, settlement.Settlement{
+		ID:             di.DepositID,
+		CoinType:       di.CoinType,
+		SkyAddress:     di.SkyAddress,
+		DepositAddress: di.DepositAddress,
+		DepositValue:   di.DepositValue,
+		SkySent:        di.SkySent,
+		Txid:           di.Txid,
+		SettledAt:      di.UpdatedAt,
+	})
+}
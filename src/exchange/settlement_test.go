@@ -0,0 +1,100 @@
+package exchange
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/settlement"
+)
+
+func TestStoreSettlements(t *testing.T) {
+	s, shutdown := newTestStore(t)
+	defer shutdown()
+
+	s.EnableSettlements()
+
+	settlementStore, err := settlement.NewStore(s.db)
+	require.NoError(t, err)
+
+	all := func(settlement.Settlement) bool { return true }
+
+	_, err = s.addDepositInfo(DepositInfo{
+		DepositID:      "btx1:1",
+		SkyAddress:     "skyaddr1",
+		DepositAddress: "btcaddr1",
+		DepositValue:   1e6,
+		ConversionRate: testSkyBtcRate,
+		Status:         StatusWaitSend,
+	})
+	require.NoError(t, err)
+
+	_, err = s.UpdateDepositInfo("btx1:1", func(di DepositInfo) DepositInfo {
+		di.Status = StatusWaitConfirm
+		di.Txid = "skytx1"
+		di.SkySent = 5e8
+		return di
+	})
+	require.NoError(t, err)
+
+	// Nothing is settled until the deposit is done
+	ss, err := settlementStore.Settlements(all)
+	require.NoError(t, err)
+	require.Empty(t, ss)
+
+	// A status change rolled back by the callback is not settled
+	callbackErr := errors.New("callback failed")
+	_, err = s.UpdateDepositInfoCallback("btx1:1", func(di DepositInfo) DepositInfo {
+		di.Status = StatusDone
+		return di
+	}, func(di DepositInfo) error {
+		return callbackErr
+	})
+	require.Equal(t, callbackErr, err)
+
+	ss, err = settlementStore.Settlements(all)
+	require.NoError(t, err)
+	require.Empty(t, ss)
+
+	di, err := s.UpdateDepositInfo("btx1:1", func(di DepositInfo) DepositInfo {
+		di.Status = StatusDone
+		return di
+	})
+	require.NoError(t, err)
+
+	ss, err = settlementStore.Settlements(all)
+	require.NoError(t, err)
+	require.Equal(t, []settlement.Settlement{
+		{
+			ID:             "btx1:1",
+			SkyAddress:     "skyaddr1",
+			DepositAddress: "btcaddr1",
+			DepositValue:   1e6,
+			SkySent:        5e8,
+			Txid:           "skytx1",
+			SettledAt:      di.UpdatedAt,
+		},
+	}, ss)
+
+	// A deposit that is done without sending SKY is not settled
+	_, err = s.addDepositInfo(DepositInfo{
+		DepositID:      "btx2:1",
+		SkyAddress:     "skyaddr1",
+		DepositAddress: "btcaddr2",
+		DepositValue:   1,
+		ConversionRate: testSkyBtcRate,
+		Status:         StatusWaitSend,
+	})
+	require.NoError(t, err)
+
+	_, err = s.UpdateDepositInfo("btx2:1", func(di DepositInfo) DepositInfo {
+		di.Status = StatusDone
+		return di
+	})
+	require.NoError(t, err)
+
+	ss, err = settlementStore.Settlements(all)
+	require.NoError(t, err)
+	require.Len(t, ss, 1)
+}
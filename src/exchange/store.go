@@ -1,6 +1,7 @@
 package exchange
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -11,7 +12,9 @@ import (
 	"github.com/sirupsen/logrus"
 
 	"github.com/skycoin/teller/src/scanner"
+	"github.com/skycoin/teller/src/util/dbcrypt"
 	"github.com/skycoin/teller/src/util/dbutil"
+	"github.com/skycoin/teller/src/util/migrate"
 )
 
 var (
@@ -21,40 +24,107 @@ var (
 	// deposit status bucket
 	depositInfoBkt = []byte("deposit_info")
 
-	// bind address bucket
+	// bind address bucket, deposit address as key, skycoin address as value
 	bindAddressBkt = []byte("bind_address")
 
+	// pricing region of bound deposit addresses, deposit address as key
+	bindRegionBkt = []byte("bind_region")
+
+	// campaign of bound deposit addresses, deposit address as key
+	bindCampaignBkt = []byte("bind_campaign")
+
+	// promo code of bound deposit addresses, deposit address as key
+	bindPromoCodeBkt = []byte("bind_promo_code")
+
+	// expected deposit value of addresses bound with an invoice amount, deposit address as key
+	bindExpectedValueBkt = []byte("bind_expected_value")
+
+	// expiry time of bindings that expire unless their address receives a deposit, deposit address as key
+	bindExpiryBkt = []byte("bind_expiry")
+
+	// deposit IDs of each deposit address, deposit address as key
 	btcTxsBkt = []byte("btc_txs")
 
 	// index bucket for skycoin address and deposit seqs, skycoin address as key
 	// deposit info seq array as value
 	skyDepositSeqsIndexBkt = []byte("sky_deposit_seqs_index")
 
+	// exchangeMetaBkt key of the operator's PauseState
+	pauseStateKey = "pause_state"
+
 	// ErrAddressAlreadyBound is returned if an address has already been bound to a SKY address
 	ErrAddressAlreadyBound = errors.New("Address already bound to a SKY address")
+
+	// ErrDepositNotFound is returned if a deposit does not exist
+	ErrDepositNotFound = errors.New("Deposit not found")
+
+	// ErrDepositNotReprocessable is returned when reprocessing a deposit that has sent skycoins or has not failed
+	ErrDepositNotReprocessable = errors.New("Only deposits that failed without sending skycoins can be reprocessed")
+
+	// ErrDepositNotPendingKYC is returned when releasing a deposit that is not held for KYC
+	ErrDepositNotPendingKYC = errors.New("Deposit is not pending KYC")
+
+	// ErrDepositNotHeldForReview is returned when approving or rejecting a deposit that is not held for review
+	ErrDepositNotHeldForReview = errors.New("Deposit is not held for review")
 )
 
 // Storer interface for exchange storage
 type Storer interface {
 	GetBindAddress(btcAddr string) (string, error)
-	BindAddress(skyAddr, btcAddr string) error
-	GetOrCreateDepositInfo(scanner.Deposit, string) (DepositInfo, error)
+	GetBindRegion(btcAddr string) (string, error)
+	GetBindCampaign(btcAddr string) (string, error)
+	GetBindPromoCode(btcAddr string) (string, error)
+	BindAddress(skyAddr, btcAddr, region, campaign, promoCode string, expectedValue, expiresAt int64) error
+	ExpireBindings(now time.Time) ([]Binding, error)
+	RecycleBindings(before time.Time) ([]Binding, error)
+	GetOrCreateDepositInfo(scanner.Deposit, string, int64) (DepositInfo, error)
 	GetDepositInfoArray(DepositFilter) ([]DepositInfo, error)
 	GetDepositInfoOfSkyAddress(string) ([]DepositInfo, error)
+	QueryDepositInfos(DepositQuery) ([]DepositInfo, error)
 	UpdateDepositInfo(string, func(DepositInfo) DepositInfo) (DepositInfo, error)
 	UpdateDepositInfoCallback(string, func(DepositInfo) DepositInfo, func(DepositInfo) error) (DepositInfo, error)
+	UpdateDepositInfosCallback([]string, func(DepositInfo) DepositInfo, func([]DepositInfo) error) ([]DepositInfo, error)
 	GetSkyBindBtcAddresses(string) ([]string, error)
 	GetDepositStats() (int64, int64, error)
+	GetCampaignDepositStats(campaign string) (int64, int64, error)
+	GetArchivedSkyPurchased(skyAddr string) (uint64, error)
+	GetPauseState() (PauseState, error)
+	SetPauseState(PauseState) error
+	ReprocessDepositInfo(depositID, rate, reason, remoteAddr string) (DepositInfo, error)
+	ReleaseKYCDepositInfo(depositID, reason, remoteAddr string) (DepositInfo, error)
+	ReviewDepositInfo(depositID string, approve bool, reason, remoteAddr string) (DepositInfo, error)
+	GetDepositHistory(depositID string) (DepositInfo, []DepositEvent, error)
+	AddSendIntent(SendIntent) error
+	GetSendIntents() ([]SendIntent, error)
+	GetDepositSendIntent(depositID string) (*SendIntent, error)
+	DeleteSendIntent(txid string) error
+}
+
+// encryptedBkts are the buckets whose values are encrypted if encryption is enabled,
+// since they link the deposit addresses to the skycoin addresses they are bound to
+var encryptedBkts = [][]byte{
+	bindAddressBkt,
+	skyDepositSeqsIndexBkt,
+	btcTxsBkt,
+	depositInfoBkt,
+	depositEventsBkt,
 }
 
 // Store storage for exchange
 type Store struct {
 	db  *bolt.DB
 	log logrus.FieldLogger
+	// c encrypts the values of encryptedBkts and hashes the skycoin addresses of skyDepositsIndexBkt,
+	// nil if encryption is disabled
+	c             *dbcrypt.Cipher
+	outbox        bool
+	stream        bool
+	settlements   bool
+	notifications bool
 }
 
-// NewStore creates a Store instance
-func NewStore(log logrus.FieldLogger, db *bolt.DB) (*Store, error) {
+// NewStore creates a Store instance. If c is not nil, the values stored before encryption was enabled are encrypted.
+func NewStore(log logrus.FieldLogger, db *bolt.DB, c *dbcrypt.Cipher) (*Store, error) {
 	if db == nil {
 		return nil, errors.New("new exchange Store failed, db is nil")
 	}
@@ -75,6 +145,26 @@ func NewStore(log logrus.FieldLogger, db *bolt.DB) (*Store, error) {
 			return dbutil.NewCreateBucketFailedErr(bindAddressBkt, err)
 		}
 
+		if _, err := tx.CreateBucketIfNotExists(bindRegionBkt); err != nil {
+			return dbutil.NewCreateBucketFailedErr(bindRegionBkt, err)
+		}
+
+		if _, err := tx.CreateBucketIfNotExists(bindCampaignBkt); err != nil {
+			return dbutil.NewCreateBucketFailedErr(bindCampaignBkt, err)
+		}
+
+		if _, err := tx.CreateBucketIfNotExists(bindPromoCodeBkt); err != nil {
+			return dbutil.NewCreateBucketFailedErr(bindPromoCodeBkt, err)
+		}
+
+		if _, err := tx.CreateBucketIfNotExists(bindExpectedValueBkt); err != nil {
+			return dbutil.NewCreateBucketFailedErr(bindExpectedValueBkt, err)
+		}
+
+		if _, err := tx.CreateBucketIfNotExists(bindExpiryBkt); err != nil {
+			return dbutil.NewCreateBucketFailedErr(bindExpiryBkt, err)
+		}
+
 		if _, err := tx.CreateBucketIfNotExists(skyDepositSeqsIndexBkt); err != nil {
 			return dbutil.NewCreateBucketFailedErr(skyDepositSeqsIndexBkt, err)
 		}
@@ -83,18 +173,108 @@ func NewStore(log logrus.FieldLogger, db *bolt.DB) (*Store, error) {
 			return dbutil.NewCreateBucketFailedErr(btcTxsBkt, err)
 		}
 
+		if _, err := tx.CreateBucketIfNotExists(depositEventsBkt); err != nil {
+			return dbutil.NewCreateBucketFailedErr(depositEventsBkt, err)
+		}
+
+		if _, err := tx.CreateBucketIfNotExists(depositEventsIndexBkt); err != nil {
+			return dbutil.NewCreateBucketFailedErr(depositEventsIndexBkt, err)
+		}
+
+		if _, err := tx.CreateBucketIfNotExists(sendIntentsBkt); err != nil {
+			return dbutil.NewCreateBucketFailedErr(sendIntentsBkt, err)
+		}
+
+		if _, err := tx.CreateBucketIfNotExists(depositIntentsBkt); err != nil {
+			return dbutil.NewCreateBucketFailedErr(depositIntentsBkt, err)
+		}
+
+		if _, err := tx.CreateBucketIfNotExists(skyDepositsIndexBkt); err != nil {
+			return dbutil.NewCreateBucketFailedErr(skyDepositsIndexBkt, err)
+		}
+
+		if _, err := tx.CreateBucketIfNotExists(statusDepositsIndexBkt); err != nil {
+			return dbutil.NewCreateBucketFailedErr(statusDepositsIndexBkt, err)
+		}
+
+		if _, err := tx.CreateBucketIfNotExists(archivedDepositsBkt); err != nil {
+			return dbutil.NewCreateBucketFailedErr(archivedDepositsBkt, err)
+		}
+
+		if _, err := tx.CreateBucketIfNotExists(archivedTotalsBkt); err != nil {
+			return dbutil.NewCreateBucketFailedErr(archivedTotalsBkt, err)
+		}
+
 		return nil
 	}); err != nil {
 		return nil, err
 	}
 
+	log = log.WithField("prefix", "exchange.Store")
+
+	// upgrade the buckets of dbs created by earlier versions of teller
+	if _, err := migrate.Run(log, db, SchemaName, Migrations); err != nil {
+		return nil, err
+	}
+
+	// The migrations read the values, so the buckets are encrypted after them
+	if err := db.Update(func(tx *bolt.Tx) error {
+		return encryptBucketsTx(tx, c)
+	}); err != nil {
+		return nil, err
+	}
+
 	return &Store{
 		db:  db,
-		log: log.WithField("prefix", "exchange.Store"),
+		log: log,
+		c:   c,
 	}, nil
 
 }
 
+// encryptBucketsTx encrypts the values of encryptedBkts and hashes the skycoin addresses of skyDepositsIndexBkt,
+// if they were stored before encryption was enabled
+func encryptBucketsTx(tx *bolt.Tx, c *dbcrypt.Cipher) error {
+	for _, bkt := range encryptedBkts {
+		if err := c.MigrateTx(tx, bkt, func(k, v []byte) ([]byte, []byte, error) {
+			v, err := c.Encrypt(v)
+			return k, v, err
+		}); err != nil {
+			return err
+		}
+	}
+
+	return c.MigrateTx(tx, skyDepositsIndexBkt, func(k, v []byte) ([]byte, []byte, error) {
+		i := bytes.IndexByte(k, '/')
+		if i == -1 {
+			return nil, nil, fmt.Errorf("invalid index key %q", k)
+		}
+
+		return []byte(indexKey(c.Hash(string(k[:i])), string(k[i+1:]))), v, nil
+	})
+}
+
+// StateCipher returns c if the buckets of db were encrypted with it, or nil if they are stored as they are,
+// because encryption is disabled or because teller was not started since it was enabled. The values of a db
+// opened read-only, by LoadDepositEvents, LoadDepositInfos, LoadBoundAddresses and CompareState, are read with it.
+func StateCipher(db *bolt.DB, c *dbcrypt.Cipher) (*dbcrypt.Cipher, error) {
+	var migrated bool
+	if err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		// The buckets are encrypted in the same transaction
+		migrated, err = c.IsMigrated(tx, depositInfoBkt)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	if !migrated {
+		return nil, nil
+	}
+
+	return c, nil
+}
+
 // GetBindAddress returns bound skycoin address of given bitcoin address.
 // If no skycoin address is found, returns empty string and nil error.
 func (s *Store) GetBindAddress(btcAddr string) (string, error) {
@@ -110,7 +290,7 @@ func (s *Store) GetBindAddress(btcAddr string) (string, error) {
 // getBindAddressTx returns bound skycoin address of given bitcoin address.
 // If no skycoin address is found, returns empty string and nil error.
 func (s *Store) getBindAddressTx(tx *bolt.Tx, btcAddr string) (string, error) {
-	skyAddr, err := dbutil.GetBucketString(tx, bindAddressBkt, btcAddr)
+	skyAddr, err := s.c.GetBucketString(tx, bindAddressBkt, btcAddr)
 
 	switch err.(type) {
 	case nil:
@@ -122,10 +302,125 @@ func (s *Store) getBindAddressTx(tx *bolt.Tx, btcAddr string) (string, error) {
 	}
 }
 
-// BindAddress binds a skycoin address to a BTC address
-func (s *Store) BindAddress(skyAddr, btcAddr string) error {
+// GetBindRegion returns the pricing region of a bound deposit address.
+// Returns an empty string if the address was bound without a region.
+func (s *Store) GetBindRegion(btcAddr string) (string, error) {
+	var region string
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		region, err = getBindRegionTx(tx, btcAddr)
+		return err
+	})
+	return region, err
+}
+
+func getBindRegionTx(tx *bolt.Tx, btcAddr string) (string, error) {
+	region, err := dbutil.GetBucketString(tx, bindRegionBkt, btcAddr)
+
+	switch err.(type) {
+	case nil:
+		return region, nil
+	case dbutil.ObjectNotExistErr:
+		return "", nil
+	default:
+		return "", err
+	}
+}
+
+// GetBindCampaign returns the campaign of a bound deposit address.
+// Returns an empty string if the address was bound without a campaign.
+func (s *Store) GetBindCampaign(btcAddr string) (string, error) {
+	var campaign string
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		campaign, err = getBindCampaignTx(tx, btcAddr)
+		return err
+	})
+	return campaign, err
+}
+
+func getBindCampaignTx(tx *bolt.Tx, btcAddr string) (string, error) {
+	campaign, err := dbutil.GetBucketString(tx, bindCampaignBkt, btcAddr)
+
+	switch err.(type) {
+	case nil:
+		return campaign, nil
+	case dbutil.ObjectNotExistErr:
+		return "", nil
+	default:
+		return "", err
+	}
+}
+
+// GetBindPromoCode returns the promo code of a bound deposit address.
+// Returns an empty string if the address was bound without a promo code.
+func (s *Store) GetBindPromoCode(btcAddr string) (string, error) {
+	var code string
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		code, err = getBindPromoCodeTx(tx, btcAddr)
+		return err
+	})
+	return code, err
+}
+
+func getBindPromoCodeTx(tx *bolt.Tx, btcAddr string) (string, error) {
+	code, err := dbutil.GetBucketString(tx, bindPromoCodeBkt, btcAddr)
+
+	switch err.(type) {
+	case nil:
+		return code, nil
+	case dbutil.ObjectNotExistErr:
+		return "", nil
+	default:
+		return "", err
+	}
+}
+
+func getBindExpectedValueTx(tx *bolt.Tx, btcAddr string) (int64, error) {
+	var v int64
+	err := dbutil.GetBucketObject(tx, bindExpectedValueBkt, btcAddr, &v)
+
+	switch err.(type) {
+	case nil:
+		return v, nil
+	case dbutil.ObjectNotExistErr:
+		return 0, nil
+	default:
+		return 0, err
+	}
+}
+
+func getBindExpiryTx(tx *bolt.Tx, btcAddr string) (int64, error) {
+	var v int64
+	err := dbutil.GetBucketObject(tx, bindExpiryBkt, btcAddr, &v)
+
+	switch err.(type) {
+	case nil:
+		return v, nil
+	case dbutil.ObjectNotExistErr:
+		return 0, nil
+	default:
+		return 0, err
+	}
+}
+
+// BindAddress binds a skycoin address to a BTC address.
+// region is the pricing region of the client, empty for the default pricing.
+// campaign is the ID of the campaign the address was bound for, empty if none.
+// promoCode is the promo code the address was bound with, empty if none.
+// expectedValue is the value that deposits to the address are expected to have, e.g. the amount
+// of an invoice, in satoshis or the smallest unit of the coin. 0 if any value is expected.
+// expiresAt is the unix time the binding expires at unless the address receives a deposit,
+// see ExpireBindings. 0 if it does not expire.
+func (s *Store) BindAddress(skyAddr, btcAddr, region, campaign, promoCode string, expectedValue, expiresAt int64) error {
 	log := s.log.WithField("skyAddr", skyAddr)
 	log = log.WithField("btcAddr", btcAddr)
+	log = log.WithField("region", region)
+	log = log.WithField("campaign", campaign)
+	log = log.WithField("promoCode", promoCode)
+	log = log.WithField("expectedValue", expectedValue)
+	log = log.WithField("expiresAt", expiresAt)
 	return s.db.Update(func(tx *bolt.Tx) error {
 		existingSkyAddr, err := s.getBindAddressTx(tx, btcAddr)
 		if err != nil {
@@ -140,7 +435,7 @@ func (s *Store) BindAddress(skyAddr, btcAddr string) error {
 
 		// update index of skycoin address and the deposit seq
 		var addrs []string
-		if err := dbutil.GetBucketObject(tx, skyDepositSeqsIndexBkt, skyAddr, &addrs); err != nil {
+		if err := s.c.GetBucketObject(tx, skyDepositSeqsIndexBkt, skyAddr, &addrs); err != nil {
 			switch err.(type) {
 			case dbutil.ObjectNotExistErr:
 			default:
@@ -149,17 +444,236 @@ func (s *Store) BindAddress(skyAddr, btcAddr string) error {
 		}
 
 		addrs = append(addrs, btcAddr)
-		if err := dbutil.PutBucketValue(tx, skyDepositSeqsIndexBkt, skyAddr, addrs); err != nil {
+		if err := s.c.PutBucketValue(tx, skyDepositSeqsIndexBkt, skyAddr, addrs); err != nil {
+			return err
+		}
+
+		if err := s.c.PutBucketValue(tx, bindAddressBkt, btcAddr, skyAddr); err != nil {
 			return err
 		}
 
-		return dbutil.PutBucketValue(tx, bindAddressBkt, btcAddr, skyAddr)
+		if region != "" {
+			if err := dbutil.PutBucketValue(tx, bindRegionBkt, btcAddr, region); err != nil {
+				return err
+			}
+		}
+
+		if campaign != "" {
+			if err := dbutil.PutBucketValue(tx, bindCampaignBkt, btcAddr, campaign); err != nil {
+				return err
+			}
+		}
+
+		if promoCode != "" {
+			if err := dbutil.PutBucketValue(tx, bindPromoCodeBkt, btcAddr, promoCode); err != nil {
+				return err
+			}
+		}
+
+		if expectedValue != 0 {
+			if err := dbutil.PutBucketValue(tx, bindExpectedValueBkt, btcAddr, expectedValue); err != nil {
+				return err
+			}
+		}
+
+		if expiresAt != 0 {
+			if err := dbutil.PutBucketValue(tx, bindExpiryBkt, btcAddr, expiresAt); err != nil {
+				return err
+			}
+		}
+
+		if err := appendBindEventTx(tx, s.c, skyAddr, btcAddr, region, campaign, promoCode, expectedValue, expiresAt); err != nil {
+			return err
+		}
+
+		return s.putBoundEventTx(tx, skyAddr, btcAddr, region, campaign, promoCode, expectedValue, expiresAt)
 	})
 }
 
+// Binding is a deposit address bound to a skycoin address
+type Binding struct {
+	SkyAddress     string
+	DepositAddress string
+	// Campaign the address was bound for, empty if none
+	Campaign string
+}
+
+// ExpireBindings unbinds the deposit addresses whose bindings expired before now without receiving
+// a deposit, and returns the bindings that were removed. Deposits to the addresses are not converted
+// once they are unbound, until they are bound again.
+func (s *Store) ExpireBindings(now time.Time) ([]Binding, error) {
+	var expired []Binding
+
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		// The bucket can't be changed while iterating it
+		var btcAddrs []string
+		if err := dbutil.ForEach(tx, bindExpiryBkt, func(k, v []byte) error {
+			var expiresAt int64
+			if err := json.Unmarshal(v, &expiresAt); err != nil {
+				return err
+			}
+
+			if expiresAt <= now.Unix() {
+				btcAddrs = append(btcAddrs, string(k))
+			}
+
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		// The expiry of a binding is removed when its first deposit is saved, in the same transaction,
+		// so these bindings have no deposits. The address may have deposits of earlier bindings if it was recycled.
+		for _, btcAddr := range btcAddrs {
+			b, err := s.unbindTx(tx, btcAddr, unbindReasonExpired)
+			if err != nil {
+				return err
+			}
+
+			expired = append(expired, b)
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return expired, nil
+}
+
+// RecycleBindings unbinds the deposit addresses whose deposits were all processed, as StatusDone, StatusRejected,
+// StatusInvalidated or StatusIgnoredDust, and last changed before before, and returns the bindings that were removed.
+// The addresses can be bound again, a deposit to them is converted for the skycoin address they are bound to at the time.
+func (s *Store) RecycleBindings(before time.Time) ([]Binding, error) {
+	var recycled []Binding
+
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		// The bucket can't be changed while iterating it
+		var btcAddrs []string
+		if err := s.c.ForEach(tx, btcTxsBkt, func(k, v []byte) error {
+			var depositIDs []string
+			if err := json.Unmarshal(v, &depositIDs); err != nil {
+				return err
+			}
+
+			if bound, err := dbutil.BucketHasKey(tx, bindAddressBkt, string(k)); err != nil {
+				return err
+			} else if !bound {
+				return nil
+			}
+
+			for _, id := range depositIDs {
+				di, err := s.getDepositInfoTx(tx, id)
+				if err != nil {
+					return err
+				}
+
+				switch di.Status {
+				case StatusDone, StatusRejected, StatusInvalidated, StatusIgnoredDust:
+				default:
+					return nil
+				}
+
+				if di.UpdatedAt >= before.Unix() {
+					return nil
+				}
+			}
+
+			btcAddrs = append(btcAddrs, string(k))
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		for _, btcAddr := range btcAddrs {
+			b, err := s.unbindTx(tx, btcAddr, unbindReasonRecycled)
+			if err != nil {
+				return err
+			}
+
+			recycled = append(recycled, b)
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return recycled, nil
+}
+
+// unbindTx removes the binding of a deposit address and records it in the event log with the reason
+func (s *Store) unbindTx(tx *bolt.Tx, btcAddr, reason string) (Binding, error) {
+	skyAddr, err := s.getBindAddressTx(tx, btcAddr)
+	if err != nil {
+		return Binding{}, err
+	}
+
+	campaign, err := getBindCampaignTx(tx, btcAddr)
+	if err != nil {
+		return Binding{}, err
+	}
+
+	if err := unbindAddressTx(tx, s.c, skyAddr, btcAddr); err != nil {
+		return Binding{}, err
+	}
+
+	if err := appendUnbindEventTx(tx, s.c, skyAddr, btcAddr, campaign, reason); err != nil {
+		return Binding{}, err
+	}
+
+	return Binding{
+		SkyAddress:     skyAddr,
+		DepositAddress: btcAddr,
+		Campaign:       campaign,
+	}, nil
+}
+
+// unbindAddressTx removes the binding of a deposit address to a skycoin address
+func unbindAddressTx(tx *bolt.Tx, c *dbcrypt.Cipher, skyAddr, btcAddr string) error {
+	var btcAddrs []string
+	if err := c.GetBucketObject(tx, skyDepositSeqsIndexBkt, skyAddr, &btcAddrs); err != nil {
+		switch err.(type) {
+		case dbutil.ObjectNotExistErr:
+		default:
+			return err
+		}
+	}
+
+	var remaining []string
+	for _, a := range btcAddrs {
+		if a != btcAddr {
+			remaining = append(remaining, a)
+		}
+	}
+
+	if len(remaining) == 0 {
+		if err := dbutil.DeleteBucketKey(tx, skyDepositSeqsIndexBkt, skyAddr); err != nil {
+			return err
+		}
+	} else if err := c.PutBucketValue(tx, skyDepositSeqsIndexBkt, skyAddr, remaining); err != nil {
+		return err
+	}
+
+	for _, bkt := range [][]byte{
+		bindAddressBkt,
+		bindRegionBkt,
+		bindCampaignBkt,
+		bindPromoCodeBkt,
+		bindExpectedValueBkt,
+		bindExpiryBkt,
+	} {
+		if err := dbutil.DeleteBucketKey(tx, bkt, btcAddr); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // GetOrCreateDepositInfo creates a DepositInfo unless one exists with the DepositInfo.DepositID key,
-// in which case it returns the existing DepositInfo.
-func (s *Store) GetOrCreateDepositInfo(dv scanner.Deposit, rate string) (DepositInfo, error) {
+// in which case it returns the existing DepositInfo. Returns ErrDepositArchived if the deposit was archived.
+func (s *Store) GetOrCreateDepositInfo(dv scanner.Deposit, rate string, confirmationsRequired int64) (DepositInfo, error) {
 	log := s.log.WithField("deposit", dv)
 	log = log.WithField("rate", rate)
 
@@ -173,6 +687,13 @@ func (s *Store) GetOrCreateDepositInfo(dv scanner.Deposit, rate string) (Deposit
 			return nil
 
 		case dbutil.ObjectNotExistErr:
+			if archived, err := isArchivedTx(tx, dv.ID()); err != nil {
+				return err
+			} else if archived {
+				log.Info("DepositInfo was archived, not inserting it again")
+				return ErrDepositArchived
+			}
+
 			log.Info("DepositInfo not found in DB, inserting")
 			skyAddr, err := s.getBindAddressTx(tx, dv.Address)
 			if err != nil {
@@ -189,15 +710,52 @@ func (s *Store) GetOrCreateDepositInfo(dv scanner.Deposit, rate string) (Deposit
 
 			log = log.WithField("skyAddr", skyAddr)
 
+			region, err := getBindRegionTx(tx, dv.Address)
+			if err != nil {
+				err = fmt.Errorf("getBindRegionTx failed: %v", err)
+				log.WithError(err).Error(err)
+				return err
+			}
+
+			campaign, err := getBindCampaignTx(tx, dv.Address)
+			if err != nil {
+				err = fmt.Errorf("getBindCampaignTx failed: %v", err)
+				log.WithError(err).Error(err)
+				return err
+			}
+
+			promoCode, err := getBindPromoCodeTx(tx, dv.Address)
+			if err != nil {
+				err = fmt.Errorf("getBindPromoCodeTx failed: %v", err)
+				log.WithError(err).Error(err)
+				return err
+			}
+
+			expectedValue, err := getBindExpectedValueTx(tx, dv.Address)
+			if err != nil {
+				err = fmt.Errorf("getBindExpectedValueTx failed: %v", err)
+				log.WithError(err).Error(err)
+				return err
+			}
+
 			di := DepositInfo{
 				CoinType:       dv.CoinType,
 				SkyAddress:     skyAddr,
 				DepositAddress: dv.Address,
 				DepositID:      dv.ID(),
+				DepositTx:      dv.Tx,
+				DepositN:       dv.N,
+				DepositHeight:  dv.Height,
 				Status:         StatusWaitSend,
 				DepositValue:   dv.Value,
+				// Save the confirmations required at the time this deposit was noticed
+				ConfirmationsRequired: confirmationsRequired,
 				// Save the rate at the time this deposit was noticed
 				ConversionRate: rate,
+				Region:         region,
+				Campaign:       campaign,
+				PromoCode:      promoCode,
+				ExpectedValue:  expectedValue,
 				Deposit:        dv,
 			}
 
@@ -266,13 +824,17 @@ func (s *Store) addDepositInfoTx(tx *bolt.Tx, di DepositInfo) (DepositInfo, erro
 		return di, err
 	}
 
-	if err := dbutil.PutBucketValue(tx, depositInfoBkt, updatedDi.DepositID, updatedDi); err != nil {
+	if err := s.c.PutBucketValue(tx, depositInfoBkt, updatedDi.DepositID, updatedDi); err != nil {
+		return di, err
+	}
+
+	if err := indexDepositInfoTx(tx, s.c, nil, updatedDi); err != nil {
 		return di, err
 	}
 
 	// update btc_txids bucket
 	var txs []string
-	if err := dbutil.GetBucketObject(tx, btcTxsBkt, updatedDi.DepositAddress, &txs); err != nil {
+	if err := s.c.GetBucketObject(tx, btcTxsBkt, updatedDi.DepositAddress, &txs); err != nil {
 		switch err.(type) {
 		case dbutil.ObjectNotExistErr:
 		default:
@@ -281,7 +843,32 @@ func (s *Store) addDepositInfoTx(tx *bolt.Tx, di DepositInfo) (DepositInfo, erro
 	}
 
 	txs = append(txs, updatedDi.DepositID)
-	if err := dbutil.PutBucketValue(tx, btcTxsBkt, updatedDi.DepositAddress, txs); err != nil {
+	if err := s.c.PutBucketValue(tx, btcTxsBkt, updatedDi.DepositAddress, txs); err != nil {
+		return di, err
+	}
+
+	// A binding that received a deposit does not expire
+	if err := dbutil.DeleteBucketKey(tx, bindExpiryBkt, updatedDi.DepositAddress); err != nil {
+		return di, err
+	}
+
+	if err := appendDepositInfoEventTx(tx, s.c, updatedDi); err != nil {
+		return di, err
+	}
+
+	if err := s.putDepositStatusMessageTx(tx, updatedDi); err != nil {
+		return di, err
+	}
+
+	if err := s.putLifecycleEventsTx(tx, nil, updatedDi); err != nil {
+		return di, err
+	}
+
+	if err := s.putNotifyEventsTx(tx, nil, updatedDi); err != nil {
+		return di, err
+	}
+
+	if err := s.putSettlementTx(tx, updatedDi); err != nil {
 		return di, err
 	}
 
@@ -305,7 +892,7 @@ func (s *Store) getDepositInfo(btcTx string) (DepositInfo, error) {
 func (s *Store) getDepositInfoTx(tx *bolt.Tx, btcTx string) (DepositInfo, error) {
 	var dpi DepositInfo
 
-	if err := dbutil.GetBucketObject(tx, depositInfoBkt, btcTx, &dpi); err != nil {
+	if err := s.c.GetBucketObject(tx, depositInfoBkt, btcTx, &dpi); err != nil {
 		return DepositInfo{}, err
 	}
 
@@ -317,7 +904,7 @@ func (s *Store) GetDepositInfoArray(flt DepositFilter) ([]DepositInfo, error) {
 	var dpis []DepositInfo
 
 	if err := s.db.View(func(tx *bolt.Tx) error {
-		return dbutil.ForEach(tx, depositInfoBkt, func(k, v []byte) error {
+		return s.c.ForEach(tx, depositInfoBkt, func(k, v []byte) error {
 			var dpi DepositInfo
 			if err := json.Unmarshal(v, &dpi); err != nil {
 				return err
@@ -342,6 +929,8 @@ func (s *Store) GetDepositInfoOfSkyAddress(skyAddr string) ([]DepositInfo, error
 	var dpis []DepositInfo
 
 	if err := s.db.View(func(tx *bolt.Tx) error {
+		seen := make(map[string]struct{})
+
 		// TODO: DB queries in a loop, may need restructuring for performance
 		btcAddrs, err := s.getSkyBindBtcAddressesTx(tx, skyAddr)
 		if err != nil {
@@ -350,7 +939,7 @@ func (s *Store) GetDepositInfoOfSkyAddress(skyAddr string) ([]DepositInfo, error
 
 		for _, btcAddr := range btcAddrs {
 			var txns []string
-			if err := dbutil.GetBucketObject(tx, btcTxsBkt, btcAddr, &txns); err != nil {
+			if err := s.c.GetBucketObject(tx, btcTxsBkt, btcAddr, &txns); err != nil {
 				switch err.(type) {
 				case dbutil.ObjectNotExistErr:
 				default:
@@ -358,26 +947,71 @@ func (s *Store) GetDepositInfoOfSkyAddress(skyAddr string) ([]DepositInfo, error
 				}
 			}
 
+			// A recycled address can have deposits of the skycoin addresses it was bound to before
+			var n int
+			for _, txn := range txns {
+				var dpi DepositInfo
+				if err := s.c.GetBucketObject(tx, depositInfoBkt, txn, &dpi); err != nil {
+					return err
+				}
+
+				if dpi.SkyAddress != skyAddr {
+					continue
+				}
+
+				seen[dpi.DepositID] = struct{}{}
+				dpis = append(dpis, dpi)
+				n++
+			}
+
 			// If this db has no DepositInfo records yet, it means the scanner
 			// has not sent a deposit to the exchange, so the status is
 			// StatusWaitDeposit.
-			if len(txns) == 0 {
+			if n == 0 {
+				expectedValue, err := getBindExpectedValueTx(tx, btcAddr)
+				if err != nil {
+					return err
+				}
+
+				campaign, err := getBindCampaignTx(tx, btcAddr)
+				if err != nil {
+					return err
+				}
+
+				promoCode, err := getBindPromoCodeTx(tx, btcAddr)
+				if err != nil {
+					return err
+				}
+
 				dpis = append(dpis, DepositInfo{
 					Status:         StatusWaitDeposit,
 					DepositAddress: btcAddr,
 					SkyAddress:     skyAddr,
+					Campaign:       campaign,
+					PromoCode:      promoCode,
+					ExpectedValue:  expectedValue,
 					UpdatedAt:      time.Now().UTC().Unix(),
 				})
 			}
+		}
 
-			for _, txn := range txns {
-				var dpi DepositInfo
-				if err := dbutil.GetBucketObject(tx, depositInfoBkt, txn, &dpi); err != nil {
-					return err
-				}
+		// Deposits to addresses that were recycled are no longer bound to the skycoin address
+		ids, err := indexedDepositIDsTx(tx, skyDepositsIndexBkt, s.c.Hash(skyAddr))
+		if err != nil {
+			return err
+		}
 
-				dpis = append(dpis, dpi)
+		for _, id := range ids {
+			if _, ok := seen[id]; ok {
+				continue
+			}
+
+			dpi, err := s.getDepositInfoTx(tx, id)
+			if err != nil {
+				return err
 			}
+
+			dpis = append(dpis, dpi)
 		}
 
 		return nil
@@ -409,31 +1043,213 @@ func (s *Store) UpdateDepositInfo(btcTx string, update func(DepositInfo) Deposit
 // inside of the transaction.  If the callback returns an error, the DepositInfo update
 // is rolled back.
 func (s *Store) UpdateDepositInfoCallback(btcTx string, update func(DepositInfo) DepositInfo, callback func(DepositInfo) error) (DepositInfo, error) {
+	var dpi DepositInfo
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		var err error
+		dpi, err = s.updateDepositInfoTx(tx, btcTx, update)
+		if err != nil {
+			return err
+		}
+
+		return callback(dpi)
+
+	}); err != nil {
+		return DepositInfo{}, err
+	}
+
+	return dpi, nil
+}
+
+// UpdateDepositInfosCallback updates multiple deposit infos in a single transaction, e.g. the deposits
+// sent by one batch transaction. After updating all of them, it calls callback inside of the transaction.
+// If the callback returns an error, all of the updates are rolled back.
+func (s *Store) UpdateDepositInfosCallback(btcTxs []string, update func(DepositInfo) DepositInfo, callback func([]DepositInfo) error) ([]DepositInfo, error) {
+	dis := make([]DepositInfo, len(btcTxs))
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		for i, btcTx := range btcTxs {
+			var err error
+			dis[i], err = s.updateDepositInfoTx(tx, btcTx, update)
+			if err != nil {
+				return err
+			}
+		}
+
+		return callback(dis)
+
+	}); err != nil {
+		return nil, err
+	}
+
+	return dis, nil
+}
+
+func (s *Store) updateDepositInfoTx(tx *bolt.Tx, btcTx string, update func(DepositInfo) DepositInfo) (DepositInfo, error) {
 	log := s.log.WithField("btcTx", btcTx)
 
+	var dpi DepositInfo
+	if err := s.c.GetBucketObject(tx, depositInfoBkt, btcTx, &dpi); err != nil {
+		return DepositInfo{}, err
+	}
+
+	log = log.WithField("depositInfo", dpi)
+
+	if dpi.DepositID != btcTx {
+		log.Error("DepositInfo.DepositID does not match btcTx")
+		err := fmt.Errorf("DepositInfo %+v saved under different key %s", dpi, btcTx)
+		return DepositInfo{}, err
+	}
+
+	prev := dpi
+	dpi = update(dpi)
+	dpi.UpdatedAt = time.Now().UTC().Unix()
+
+	if err := s.c.PutBucketValue(tx, depositInfoBkt, btcTx, dpi); err != nil {
+		return DepositInfo{}, err
+	}
+
+	if err := indexDepositInfoTx(tx, s.c, &prev, dpi); err != nil {
+		return DepositInfo{}, err
+	}
+
+	if err := appendDepositInfoEventTx(tx, s.c, dpi); err != nil {
+		return DepositInfo{}, err
+	}
+
+	if err := s.putLifecycleEventsTx(tx, &prev, dpi); err != nil {
+		return DepositInfo{}, err
+	}
+
+	if err := s.putNotifyEventsTx(tx, &prev, dpi); err != nil {
+		return DepositInfo{}, err
+	}
+
+	if dpi.Status != prev.Status {
+		if err := s.putDepositStatusMessageTx(tx, dpi); err != nil {
+			return DepositInfo{}, err
+		}
+
+		if err := s.putSettlementTx(tx, dpi); err != nil {
+			return DepositInfo{}, err
+		}
+	}
+
+	return dpi, nil
+}
+
+// ReprocessDepositInfo resets a deposit that failed without sending skycoins to StatusWaitSend,
+// clearing its Error. If rate is not empty, it replaces the ConversionRate.
+// A reprocess event is appended to the event log, recording the reason and origin of the request.
+func (s *Store) ReprocessDepositInfo(depositID, rate, reason, remoteAddr string) (DepositInfo, error) {
 	var dpi DepositInfo
 	if err := s.db.Update(func(tx *bolt.Tx) error {
-		if err := dbutil.GetBucketObject(tx, depositInfoBkt, btcTx, &dpi); err != nil {
-			return err
+		di, err := s.getDepositInfoTx(tx, depositID)
+		if err != nil {
+			switch err.(type) {
+			case dbutil.ObjectNotExistErr:
+				return ErrDepositNotFound
+			default:
+				return err
+			}
 		}
 
-		log = log.WithField("depositInfo", dpi)
+		// A deposit with a Txid may have sent skycoins, even if it failed later
+		if di.Txid != "" || di.Error == "" {
+			return ErrDepositNotReprocessable
+		}
 
-		if dpi.DepositID != btcTx {
-			log.Error("DepositInfo.DepositID does not match btcTx")
-			err := fmt.Errorf("DepositInfo %+v saved under different key %s", dpi, btcTx)
+		if di.Status != StatusWaitSend && di.Status != StatusDone {
+			return ErrDepositNotReprocessable
+		}
+
+		dpi, err = s.updateDepositInfoTx(tx, depositID, func(di DepositInfo) DepositInfo {
+			di.Status = StatusWaitSend
+			di.Error = ""
+			if rate != "" {
+				di.ConversionRate = rate
+			}
+			return di
+		})
+		if err != nil {
 			return err
 		}
 
-		dpi = update(dpi)
-		dpi.UpdatedAt = time.Now().UTC().Unix()
+		return appendReprocessEventTx(tx, s.c, dpi, reason, remoteAddr)
+	}); err != nil {
+		return DepositInfo{}, err
+	}
+
+	return dpi, nil
+}
+
+// ReleaseKYCDepositInfo sets a deposit held for KYC to StatusWaitSend.
+// A kyc_release event is appended to the event log, recording the reason and origin of the release.
+func (s *Store) ReleaseKYCDepositInfo(depositID, reason, remoteAddr string) (DepositInfo, error) {
+	var dpi DepositInfo
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		di, err := s.getDepositInfoTx(tx, depositID)
+		if err != nil {
+			switch err.(type) {
+			case dbutil.ObjectNotExistErr:
+				return ErrDepositNotFound
+			default:
+				return err
+			}
+		}
+
+		if di.Status != StatusWaitKYC {
+			return ErrDepositNotPendingKYC
+		}
 
-		if err := dbutil.PutBucketValue(tx, depositInfoBkt, btcTx, dpi); err != nil {
+		dpi, err = s.updateDepositInfoTx(tx, depositID, func(di DepositInfo) DepositInfo {
+			di.Status = StatusWaitSend
+			return di
+		})
+		if err != nil {
 			return err
 		}
 
-		return callback(dpi)
+		return appendKYCReleaseEventTx(tx, s.c, dpi, reason, remoteAddr)
+	}); err != nil {
+		return DepositInfo{}, err
+	}
+
+	return dpi, nil
+}
+
+// ReviewDepositInfo approves or rejects a deposit held for review. An approved deposit is set to
+// StatusWaitSend and its Error is cleared, a rejected deposit is set to StatusRejected.
+// A review_approve or review_reject event is appended to the event log, recording the reason and origin of the review.
+func (s *Store) ReviewDepositInfo(depositID string, approve bool, reason, remoteAddr string) (DepositInfo, error) {
+	var dpi DepositInfo
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		di, err := s.getDepositInfoTx(tx, depositID)
+		if err != nil {
+			switch err.(type) {
+			case dbutil.ObjectNotExistErr:
+				return ErrDepositNotFound
+			default:
+				return err
+			}
+		}
 
+		if di.Status != StatusHeldForReview {
+			return ErrDepositNotHeldForReview
+		}
+
+		dpi, err = s.updateDepositInfoTx(tx, depositID, func(di DepositInfo) DepositInfo {
+			if approve {
+				di.Status = StatusWaitSend
+				di.Error = ""
+			} else {
+				di.Status = StatusRejected
+			}
+			return di
+		})
+		if err != nil {
+			return err
+		}
+
+		return appendReviewEventTx(tx, s.c, dpi, approve, reason, remoteAddr)
 	}); err != nil {
 		return DepositInfo{}, err
 	}
@@ -441,6 +1257,45 @@ func (s *Store) UpdateDepositInfoCallback(btcTx string, update func(DepositInfo)
 	return dpi, nil
 }
 
+// GetBoundAddresses returns all bound deposit addresses, with the skycoin addresses they are bound to.
+// Implements addrs.BindingGetter.
+func (s *Store) GetBoundAddresses() (map[string]string, error) {
+	bound := make(map[string]string)
+
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		return s.c.ForEach(tx, bindAddressBkt, func(k, v []byte) error {
+			bound[string(k)] = string(v)
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+
+	return bound, nil
+}
+
+// LoadDepositInfos returns every DepositInfo of db, decrypted with c if it is not nil.
+// Unlike NewStore, it does not write to db, so db can be opened read-only.
+func LoadDepositInfos(db *bolt.DB, c *dbcrypt.Cipher) ([]DepositInfo, error) {
+	s := &Store{
+		db: db,
+		c:  c,
+	}
+	return s.GetDepositInfoArray(func(DepositInfo) bool {
+		return true
+	})
+}
+
+// LoadBoundAddresses returns all bound deposit addresses of db, with the skycoin addresses they are bound to,
+// decrypted with c if it is not nil. Unlike NewStore, it does not write to db, so db can be opened read-only.
+func LoadBoundAddresses(db *bolt.DB, c *dbcrypt.Cipher) (map[string]string, error) {
+	s := &Store{
+		db: db,
+		c:  c,
+	}
+	return s.GetBoundAddresses()
+}
+
 // GetSkyBindBtcAddresses returns the btc addresses of the given sky address bound
 func (s *Store) GetSkyBindBtcAddresses(skyAddr string) ([]string, error) {
 	var addrs []string
@@ -459,7 +1314,7 @@ func (s *Store) GetSkyBindBtcAddresses(skyAddr string) ([]string, error) {
 // getSkyBindBtcAddressesTx returns the btc addresses of the given sky address bound
 func (s *Store) getSkyBindBtcAddressesTx(tx *bolt.Tx, skyAddr string) ([]string, error) {
 	var addrs []string
-	if err := dbutil.GetBucketObject(tx, skyDepositSeqsIndexBkt, skyAddr, &addrs); err != nil {
+	if err := s.c.GetBucketObject(tx, skyDepositSeqsIndexBkt, skyAddr, &addrs); err != nil {
 		switch err.(type) {
 		case dbutil.ObjectNotExistErr:
 			err = nil
@@ -475,17 +1330,44 @@ func (s *Store) getSkyBindBtcAddressesTx(tx *bolt.Tx, skyAddr string) ([]string,
 	return addrs, nil
 }
 
+// GetDepositStats returns the total BTC received and SKY sent by the deposits, archived ones included
 func (s *Store) GetDepositStats() (int64, int64, error) {
+	return s.depositStats(func(DepositInfo) bool {
+		return true
+	}, archivedTotalsAllKey)
+}
+
+// GetCampaignDepositStats returns the total BTC received and SKY sent by the deposits of a campaign, archived ones included
+func (s *Store) GetCampaignDepositStats(campaign string) (int64, int64, error) {
+	return s.depositStats(func(di DepositInfo) bool {
+		return di.Campaign == campaign
+	}, indexKey("campaign", campaign))
+}
+
+// depositStats sums the deposits matching flt and the archived deposits of archivedTotalsKey
+func (s *Store) depositStats(flt DepositFilter, archivedTotalsKey string) (int64, int64, error) {
 	var totalBTCReceived int64
 	var totalSKYSent int64
 
 	if err := s.db.View(func(tx *bolt.Tx) error {
-		return dbutil.ForEach(tx, depositInfoBkt, func(k, v []byte) error {
+		t, err := getArchivedTotalsTx(tx, archivedTotalsKey)
+		if err != nil {
+			return err
+		}
+
+		totalBTCReceived = t.BTCReceived
+		totalSKYSent = t.SKYSent
+
+		return s.c.ForEach(tx, depositInfoBkt, func(k, v []byte) error {
 			var dpi DepositInfo
 			if err := json.Unmarshal(v, &dpi); err != nil {
 				return err
 			}
 
+			if !flt(dpi) {
+				return nil
+			}
+
 			if dpi.CoinType == scanner.CoinTypeBTC {
 				totalBTCReceived += dpi.DepositValue
 			}
@@ -499,3 +1381,25 @@ func (s *Store) GetDepositStats() (int64, int64, error) {
 
 	return totalBTCReceived, totalSKYSent, nil
 }
+
+// GetPauseState returns the saved PauseState, which is not paused if it was never saved
+func (s *Store) GetPauseState() (PauseState, error) {
+	var ps PauseState
+	err := s.db.View(func(tx *bolt.Tx) error {
+		err := dbutil.GetBucketObject(tx, exchangeMetaBkt, pauseStateKey, &ps)
+		switch err.(type) {
+		case nil, dbutil.ObjectNotExistErr:
+			return nil
+		default:
+			return err
+		}
+	})
+	return ps, err
+}
+
+// SetPauseState saves the PauseState
+func (s *Store) SetPauseState(ps PauseState) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return dbutil.PutBucketValue(tx, exchangeMetaBkt, pauseStateKey, ps)
+	})
+}
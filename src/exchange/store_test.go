@@ -1,13 +1,16 @@
 package exchange
 
 import (
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/boltdb/bolt"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 
 	"github.com/skycoin/teller/src/scanner"
+	"github.com/skycoin/teller/src/util/dbcrypt"
 	"github.com/skycoin/teller/src/util/dbutil"
 	"github.com/skycoin/teller/src/util/testutil"
 )
@@ -21,13 +24,50 @@ func (m *MockStore) GetBindAddress(btcAddr string) (string, error) {
 	return args.String(0), args.Error(1)
 }
 
-func (m *MockStore) BindAddress(skyAddr, btcAddr string) error {
-	args := m.Called(skyAddr, btcAddr)
+func (m *MockStore) GetBindRegion(btcAddr string) (string, error) {
+	args := m.Called(btcAddr)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockStore) GetBindCampaign(btcAddr string) (string, error) {
+	args := m.Called(btcAddr)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockStore) GetBindPromoCode(btcAddr string) (string, error) {
+	args := m.Called(btcAddr)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockStore) BindAddress(skyAddr, btcAddr, region, campaign, promoCode string, expectedValue, expiresAt int64) error {
+	args := m.Called(skyAddr, btcAddr, region, campaign, promoCode, expectedValue, expiresAt)
 	return args.Error(0)
 }
 
-func (m *MockStore) GetOrCreateDepositInfo(dv scanner.Deposit, rate string) (DepositInfo, error) {
-	args := m.Called(dv, rate)
+func (m *MockStore) ExpireBindings(now time.Time) ([]Binding, error) {
+	args := m.Called(now)
+
+	bs := args.Get(0)
+	if bs == nil {
+		return nil, args.Error(1)
+	}
+
+	return bs.([]Binding), args.Error(1)
+}
+
+func (m *MockStore) RecycleBindings(before time.Time) ([]Binding, error) {
+	args := m.Called(before)
+
+	bs := args.Get(0)
+	if bs == nil {
+		return nil, args.Error(1)
+	}
+
+	return bs.([]Binding), args.Error(1)
+}
+
+func (m *MockStore) GetOrCreateDepositInfo(dv scanner.Deposit, rate string, confirmationsRequired int64) (DepositInfo, error) {
+	args := m.Called(dv, rate, confirmationsRequired)
 	return args.Get(0).(DepositInfo), args.Error(1)
 }
 
@@ -53,6 +93,17 @@ func (m *MockStore) GetDepositInfoOfSkyAddress(skyAddr string) ([]DepositInfo, e
 	return dis.([]DepositInfo), args.Error(1)
 }
 
+func (m *MockStore) QueryDepositInfos(q DepositQuery) ([]DepositInfo, error) {
+	args := m.Called(q)
+
+	dis := args.Get(0)
+	if dis == nil {
+		return nil, args.Error(1)
+	}
+
+	return dis.([]DepositInfo), args.Error(1)
+}
+
 func (m *MockStore) UpdateDepositInfo(btcTx string, f func(DepositInfo) DepositInfo) (DepositInfo, error) {
 	args := m.Called(btcTx, f)
 	return args.Get(0).(DepositInfo), args.Error(1)
@@ -63,6 +114,17 @@ func (m *MockStore) UpdateDepositInfoCallback(btcTx string, f func(DepositInfo)
 	return args.Get(0).(DepositInfo), args.Error(1)
 }
 
+func (m *MockStore) UpdateDepositInfosCallback(btcTxs []string, f func(DepositInfo) DepositInfo, callback func([]DepositInfo) error) ([]DepositInfo, error) {
+	args := m.Called(btcTxs, f, callback)
+
+	dis := args.Get(0)
+	if dis == nil {
+		return nil, args.Error(1)
+	}
+
+	return dis.([]DepositInfo), args.Error(1)
+}
+
 func (m *MockStore) GetSkyBindBtcAddresses(skyAddr string) ([]string, error) {
 	args := m.Called(skyAddr)
 
@@ -79,11 +141,89 @@ func (m *MockStore) GetDepositStats() (int64, int64, error) {
 	return args.Get(0).(int64), args.Get(1).(int64), args.Error(2)
 }
 
+func (m *MockStore) GetCampaignDepositStats(campaign string) (int64, int64, error) {
+	args := m.Called(campaign)
+	return args.Get(0).(int64), args.Get(1).(int64), args.Error(2)
+}
+
+func (m *MockStore) GetArchivedSkyPurchased(skyAddr string) (uint64, error) {
+	args := m.Called(skyAddr)
+	return args.Get(0).(uint64), args.Error(1)
+}
+
+func (m *MockStore) GetPauseState() (PauseState, error) {
+	args := m.Called()
+	return args.Get(0).(PauseState), args.Error(1)
+}
+
+func (m *MockStore) SetPauseState(ps PauseState) error {
+	args := m.Called(ps)
+	return args.Error(0)
+}
+
+func (m *MockStore) ReprocessDepositInfo(depositID, rate, reason, remoteAddr string) (DepositInfo, error) {
+	args := m.Called(depositID, rate, reason, remoteAddr)
+	return args.Get(0).(DepositInfo), args.Error(1)
+}
+
+func (m *MockStore) ReleaseKYCDepositInfo(depositID, reason, remoteAddr string) (DepositInfo, error) {
+	args := m.Called(depositID, reason, remoteAddr)
+	return args.Get(0).(DepositInfo), args.Error(1)
+}
+
+func (m *MockStore) ReviewDepositInfo(depositID string, approve bool, reason, remoteAddr string) (DepositInfo, error) {
+	args := m.Called(depositID, approve, reason, remoteAddr)
+	return args.Get(0).(DepositInfo), args.Error(1)
+}
+
+func (m *MockStore) GetDepositHistory(depositID string) (DepositInfo, []DepositEvent, error) {
+	args := m.Called(depositID)
+
+	evs := args.Get(1)
+	if evs == nil {
+		return args.Get(0).(DepositInfo), nil, args.Error(2)
+	}
+
+	return args.Get(0).(DepositInfo), evs.([]DepositEvent), args.Error(2)
+}
+
+func (m *MockStore) AddSendIntent(si SendIntent) error {
+	args := m.Called(si)
+	return args.Error(0)
+}
+
+func (m *MockStore) GetSendIntents() ([]SendIntent, error) {
+	args := m.Called()
+
+	sis := args.Get(0)
+	if sis == nil {
+		return nil, args.Error(1)
+	}
+
+	return sis.([]SendIntent), args.Error(1)
+}
+
+func (m *MockStore) GetDepositSendIntent(depositID string) (*SendIntent, error) {
+	args := m.Called(depositID)
+
+	si := args.Get(0)
+	if si == nil {
+		return nil, args.Error(1)
+	}
+
+	return si.(*SendIntent), args.Error(1)
+}
+
+func (m *MockStore) DeleteSendIntent(txid string) error {
+	args := m.Called(txid)
+	return args.Error(0)
+}
+
 func newTestStore(t *testing.T) (*Store, func()) {
 	db, shutdown := testutil.PrepareDB(t)
 
 	log, _ := testutil.NewLogger(t)
-	s, err := NewStore(log, db)
+	s, err := NewStore(log, db, nil)
 	require.NoError(t, err)
 
 	return s, shutdown
@@ -178,7 +318,7 @@ func TestStoreBindAddress(t *testing.T) {
 	s, shutdown := newTestStore(t)
 	defer shutdown()
 
-	err := s.BindAddress("sa1", "ba1")
+	err := s.BindAddress("sa1", "ba1", "", "", "", 0, 0)
 	require.NoError(t, err)
 
 	// check bucket
@@ -197,36 +337,231 @@ func TestStoreBindAddress(t *testing.T) {
 	require.NoError(t, err)
 
 	// A sky address can have multiple addresses bound to it
-	err = s.BindAddress("sa1", "ba2")
+	err = s.BindAddress("sa1", "ba2", "", "", "", 0, 0)
+	require.NoError(t, err)
+
+	bound, err := s.GetBoundAddresses()
 	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		"ba1": "sa1",
+		"ba2": "sa1",
+	}, bound)
 }
 
 func TestStoreBindAddressTwiceFails(t *testing.T) {
 	s, shutdown := newTestStore(t)
 	defer shutdown()
 
-	err := s.BindAddress("a", "b")
+	err := s.BindAddress("a", "b", "", "", "", 0, 0)
 	require.NoError(t, err)
 
-	err = s.BindAddress("a", "b")
+	err = s.BindAddress("a", "b", "", "", "", 0, 0)
 	require.Error(t, err)
 	require.Equal(t, ErrAddressAlreadyBound, err)
 
-	err = s.BindAddress("c", "b")
+	err = s.BindAddress("c", "b", "", "", "", 0, 0)
 	require.Error(t, err)
 	require.Equal(t, ErrAddressAlreadyBound, err)
 }
 
+func TestStoreExpireBindings(t *testing.T) {
+	s, shutdown := newTestStore(t)
+	defer shutdown()
+
+	require.NoError(t, s.BindAddress("skyaddr1", "btcaddr1", "eu", "sale", "FRIEND", 1e6, 100))
+	require.NoError(t, s.BindAddress("skyaddr1", "btcaddr2", "", "", "", 0, 100))
+	require.NoError(t, s.BindAddress("skyaddr1", "btcaddr3", "", "", "", 0, 200))
+	require.NoError(t, s.BindAddress("skyaddr2", "btcaddr4", "", "", "", 0, 0))
+
+	// A binding that received a deposit does not expire
+	_, err := s.GetOrCreateDepositInfo(scanner.Deposit{
+		CoinType: scanner.CoinTypeBTC,
+		Address:  "btcaddr2",
+		Value:    1e6,
+		Tx:       "btx1",
+	}, testSkyBtcRate, 1)
+	require.NoError(t, err)
+
+	bs, err := s.ExpireBindings(time.Unix(99, 0))
+	require.NoError(t, err)
+	require.Empty(t, bs)
+
+	bs, err = s.ExpireBindings(time.Unix(100, 0))
+	require.NoError(t, err)
+	require.Equal(t, []Binding{
+		{SkyAddress: "skyaddr1", DepositAddress: "btcaddr1", Campaign: "sale"},
+	}, bs)
+
+	skyAddr, err := s.GetBindAddress("btcaddr1")
+	require.NoError(t, err)
+	require.Empty(t, skyAddr)
+
+	campaign, err := s.GetBindCampaign("btcaddr1")
+	require.NoError(t, err)
+	require.Empty(t, campaign)
+
+	addrs, err := s.GetSkyBindBtcAddresses("skyaddr1")
+	require.NoError(t, err)
+	require.Equal(t, []string{"btcaddr2", "btcaddr3"}, addrs)
+
+	// Deposits to unbound addresses are not saved
+	_, err = s.GetOrCreateDepositInfo(scanner.Deposit{
+		CoinType: scanner.CoinTypeBTC,
+		Address:  "btcaddr1",
+		Value:    1e6,
+		Tx:       "btx2",
+	}, testSkyBtcRate, 1)
+	require.Equal(t, ErrNoBoundAddress, err)
+
+	bs, err = s.ExpireBindings(time.Unix(1000, 0))
+	require.NoError(t, err)
+	require.Equal(t, []Binding{
+		{SkyAddress: "skyaddr1", DepositAddress: "btcaddr3"},
+	}, bs)
+
+	bs, err = s.ExpireBindings(time.Unix(1000, 0))
+	require.NoError(t, err)
+	require.Empty(t, bs)
+
+	addrs, err = s.GetSkyBindBtcAddresses("skyaddr1")
+	require.NoError(t, err)
+	require.Equal(t, []string{"btcaddr2"}, addrs)
+
+	// Unbound addresses can be bound again, to any skycoin address
+	require.NoError(t, s.BindAddress("skyaddr2", "btcaddr1", "", "", "", 0, 0))
+
+	addrs, err = s.GetSkyBindBtcAddresses("skyaddr2")
+	require.NoError(t, err)
+	require.Equal(t, []string{"btcaddr4", "btcaddr1"}, addrs)
+
+	// The unbinding is recorded in the event log, and the state can still be rebuilt
+	evs, err := s.GetDepositEvents()
+	require.NoError(t, err)
+
+	var unbound []string
+	for _, ev := range evs {
+		if ev.Type == EventUnbindAddress {
+			unbound = append(unbound, ev.BtcAddress)
+		}
+	}
+	require.Equal(t, []string{"btcaddr1", "btcaddr3"}, unbound)
+
+	db, shutdown2 := testutil.PrepareDB(t)
+	defer shutdown2()
+
+	require.NoError(t, RebuildState(db, nil, evs))
+
+	diffs, err := CompareState(s.db, db, nil)
+	require.NoError(t, err)
+	require.Empty(t, diffs)
+}
+
+func TestStoreRecycleBindings(t *testing.T) {
+	s, shutdown := newTestStore(t)
+	defer shutdown()
+
+	populateTestStore(t, s)
+
+	// btcaddr1 has a done and a waiting deposit, btcaddr2 has no deposits, btcaddr3 has a waiting deposit
+	bs, err := s.RecycleBindings(time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	require.Empty(t, bs)
+
+	_, err = s.UpdateDepositInfo("btx2:0", func(di DepositInfo) DepositInfo {
+		di.Status = StatusRejected
+		return di
+	})
+	require.NoError(t, err)
+
+	// The deposits must have been processed before the cool-down
+	bs, err = s.RecycleBindings(time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	require.Empty(t, bs)
+
+	bs, err = s.RecycleBindings(time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, []Binding{
+		{SkyAddress: "skyaddr1", DepositAddress: "btcaddr1"},
+	}, bs)
+
+	skyAddr, err := s.GetBindAddress("btcaddr1")
+	require.NoError(t, err)
+	require.Empty(t, skyAddr)
+
+	// The deposits keep their skycoin address
+	dis, err := s.GetDepositInfoOfSkyAddress("skyaddr1")
+	require.NoError(t, err)
+	statuses := make(map[string]Status)
+	for _, di := range dis {
+		statuses[di.DepositAddress+"/"+di.DepositID] = di.Status
+	}
+	require.Equal(t, map[string]Status{
+		"btcaddr1/btx1:1": StatusDone,
+		"btcaddr1/btx2:0": StatusRejected,
+		"btcaddr2/":       StatusWaitDeposit,
+	}, statuses)
+
+	// A recycled address is bound again, and its new deposits are converted for the new skycoin address
+	require.NoError(t, s.BindAddress("skyaddr2", "btcaddr1", "", "", "", 0, 0))
+
+	// The new skycoin address doesn't see the deposits of the previous binding
+	dis, err = s.GetDepositInfoOfSkyAddress("skyaddr2")
+	require.NoError(t, err)
+	statuses = make(map[string]Status)
+	for _, di := range dis {
+		statuses[di.DepositAddress+"/"+di.DepositID] = di.Status
+	}
+	require.Equal(t, map[string]Status{
+		"btcaddr1/":       StatusWaitDeposit,
+		"btcaddr3/btx3:2": StatusWaitSend,
+	}, statuses)
+
+	di, err := s.GetOrCreateDepositInfo(scanner.Deposit{
+		CoinType: scanner.CoinTypeBTC,
+		Address:  "btcaddr1",
+		Value:    1e6,
+		Tx:       "btx4",
+	}, testSkyBtcRate, 1)
+	require.NoError(t, err)
+	require.Equal(t, "skyaddr2", di.SkyAddress)
+
+	bs, err = s.RecycleBindings(time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	require.Empty(t, bs)
+
+	evs, err := s.GetDepositEvents()
+	require.NoError(t, err)
+
+	var unbinds []DepositEvent
+	for _, ev := range evs {
+		if ev.Type == EventUnbindAddress {
+			unbinds = append(unbinds, ev)
+		}
+	}
+	require.Len(t, unbinds, 1)
+	require.Equal(t, "btcaddr1", unbinds[0].BtcAddress)
+	require.Equal(t, "recycled", unbinds[0].Reason)
+
+	db, shutdown2 := testutil.PrepareDB(t)
+	defer shutdown2()
+
+	require.NoError(t, RebuildState(db, nil, evs))
+
+	diffs, err := CompareState(s.db, db, nil)
+	require.NoError(t, err)
+	require.Empty(t, diffs)
+}
+
 func TestStoreGetBindAddress(t *testing.T) {
 	s, shutdown := newTestStore(t)
 	defer shutdown()
 
 	// init the bind address bucket
-	err := s.BindAddress("skyaddr1", "btcaddr1")
+	err := s.BindAddress("skyaddr1", "btcaddr1", "", "", "", 0, 0)
 	require.NoError(t, err)
-	err = s.BindAddress("skyaddr2", "btcaddr2")
+	err = s.BindAddress("skyaddr2", "btcaddr2", "", "", "", 0, 0)
 	require.NoError(t, err)
-	err = s.BindAddress("skyaddr2", "btcaddr3")
+	err = s.BindAddress("skyaddr2", "btcaddr3", "", "", "", 0, 0)
 	require.NoError(t, err)
 
 	var testCases = []struct {
@@ -381,11 +716,76 @@ func TestStoreUpdateDepositInfo(t *testing.T) {
 	// TODO: test no exist deposit info
 }
 
+func TestStoreUpdateDepositInfosCallback(t *testing.T) {
+	s, shutdown := newTestStore(t)
+	defer shutdown()
+
+	for _, id := range []string{"btx1:1", "btx2:1"} {
+		_, err := s.addDepositInfo(DepositInfo{
+			DepositID:      id,
+			SkyAddress:     "skyaddr1",
+			DepositAddress: "btcaddr1",
+			DepositValue:   1e6,
+			ConversionRate: testSkyBtcRate,
+			Status:         StatusWaitSend,
+		})
+		require.NoError(t, err)
+	}
+
+	ids := []string{"btx1:1", "btx2:1"}
+	setWaitConfirm := func(di DepositInfo) DepositInfo {
+		di.Status = StatusWaitConfirm
+		di.Txid = "121212"
+		return di
+	}
+
+	// A callback error rolls back all of the updates
+	_, err := s.UpdateDepositInfosCallback(ids, setWaitConfirm, func(dis []DepositInfo) error {
+		require.Len(t, dis, 2)
+		return errors.New("broadcast failed")
+	})
+	require.Error(t, err)
+
+	for _, id := range ids {
+		di, err := s.getDepositInfo(id)
+		require.NoError(t, err)
+		require.Equal(t, StatusWaitSend, di.Status)
+	}
+
+	dis, err := s.UpdateDepositInfosCallback(ids, setWaitConfirm, func(dis []DepositInfo) error {
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, dis, 2)
+
+	for i, id := range ids {
+		require.Equal(t, id, dis[i].DepositID)
+
+		di, err := s.getDepositInfo(id)
+		require.NoError(t, err)
+		require.Equal(t, StatusWaitConfirm, di.Status)
+		require.Equal(t, "121212", di.Txid)
+	}
+
+	// Unknown deposits fail the whole update
+	_, err = s.UpdateDepositInfosCallback([]string{"btx1:1", "btx3:1"}, func(di DepositInfo) DepositInfo {
+		di.Status = StatusDone
+		return di
+	}, func(dis []DepositInfo) error {
+		return nil
+	})
+	require.Error(t, err)
+
+	di, err := s.getDepositInfo("btx1:1")
+	require.NoError(t, err)
+	require.Equal(t, StatusWaitConfirm, di.Status)
+}
+
 func TestStoreGetDepositInfoOfSkyAddress(t *testing.T) {
 	s, shutdown := newTestStore(t)
 	defer shutdown()
 
-	err := s.BindAddress("skyaddr1", "btcaddr1")
+	err := s.BindAddress("skyaddr1", "btcaddr1", "", "", "", 0, 0)
 	require.NoError(t, err)
 
 	dpis, err := s.GetDepositInfoOfSkyAddress("skyaddr1")
@@ -393,7 +793,7 @@ func TestStoreGetDepositInfoOfSkyAddress(t *testing.T) {
 	require.Len(t, dpis, 1)
 	require.Equal(t, dpis[0].DepositAddress, "btcaddr1")
 
-	err = s.BindAddress("skyaddr1", "btcaddr2")
+	err = s.BindAddress("skyaddr1", "btcaddr2", "", "", "", 0, 0)
 	require.NoError(t, err)
 
 	dpis, err = s.GetDepositInfoOfSkyAddress("skyaddr1")
@@ -415,9 +815,9 @@ func TestStoreGetDepositInfoOfSkyAddress(t *testing.T) {
 	require.Equal(t, di3.Seq, uint64(1))
 	require.NoError(t, err)
 
-	err = s.BindAddress("skyaddr3", "btcaddr3")
+	err = s.BindAddress("skyaddr3", "btcaddr3", "", "", "", 0, 0)
 	require.NoError(t, err)
-	err = s.BindAddress("skyaddr3", "btcaddr4")
+	err = s.BindAddress("skyaddr3", "btcaddr4", "", "", "", 0, 0)
 	require.NoError(t, err)
 
 	di4 := DepositInfo{
@@ -497,6 +897,29 @@ func TestStoreGetDepositInfoArray(t *testing.T) {
 	require.Equal(t, dpis[1].SkyAddress, ds1[0].SkyAddress)
 }
 
+func TestDepositInfoPaymentStatus(t *testing.T) {
+	for _, tc := range []struct {
+		status        Status
+		expectedValue int64
+		value         int64
+		paymentStatus string
+	}{
+		{StatusWaitDeposit, 0, 0, ""},
+		{StatusWaitDeposit, 1e6, 0, ""},
+		{StatusWaitSend, 0, 1e6, ""},
+		{StatusWaitSend, 1e6, 1e6, PaymentPaid},
+		{StatusWaitConfirm, 1e6, 1e6 - 1, PaymentUnderpaid},
+		{StatusDone, 1e6, 1e6 + 1, PaymentOverpaid},
+	} {
+		di := DepositInfo{
+			Status:        tc.status,
+			ExpectedValue: tc.expectedValue,
+			DepositValue:  tc.value,
+		}
+		require.Equal(t, tc.paymentStatus, di.PaymentStatus())
+	}
+}
+
 func TestStoreIsValidBtcTx(t *testing.T) {
 	cases := []struct {
 		name  string
@@ -589,7 +1012,7 @@ func TestStoreGetOrCreateDepositInfoAlreadyExists(t *testing.T) {
 
 	differentRate := "112233"
 	require.NotEqual(t, differentRate, di.ConversionRate)
-	existsDi, err := s.GetOrCreateDepositInfo(dv, differentRate)
+	existsDi, err := s.GetOrCreateDepositInfo(dv, differentRate, 1)
 
 	// di.Deposit won't be changed
 	require.Equal(t, di, existsDi)
@@ -604,7 +1027,7 @@ func TestStoreGetOrCreateDepositInfoNoBoundSkyAddr(t *testing.T) {
 	}
 
 	rate := "100"
-	_, err := s.GetOrCreateDepositInfo(dv, rate)
+	_, err := s.GetOrCreateDepositInfo(dv, rate, 1)
 	require.Error(t, err)
 	require.Equal(t, err, ErrNoBoundAddress)
 }
@@ -619,7 +1042,7 @@ func TestStoreGetSkyBindBtcAddresses(t *testing.T) {
 	require.Nil(t, addrs)
 
 	btcAddr1 := "btcaddr1"
-	err = s.BindAddress(skyAddr, btcAddr1)
+	err = s.BindAddress(skyAddr, btcAddr1, "", "", "", 0, 0)
 	require.NoError(t, err)
 
 	addrs, err = s.GetSkyBindBtcAddresses(skyAddr)
@@ -628,7 +1051,7 @@ func TestStoreGetSkyBindBtcAddresses(t *testing.T) {
 	require.Equal(t, addrs[0], btcAddr1)
 
 	btcAddr2 := "btcaddr2"
-	err = s.BindAddress(skyAddr, btcAddr2)
+	err = s.BindAddress(skyAddr, btcAddr2, "", "", "", 0, 0)
 	require.NoError(t, err)
 
 	addrs, err = s.GetSkyBindBtcAddresses(skyAddr)
@@ -637,3 +1060,271 @@ func TestStoreGetSkyBindBtcAddresses(t *testing.T) {
 	require.Equal(t, addrs[0], btcAddr1)
 	require.Equal(t, addrs[1], btcAddr2)
 }
+
+func TestStorePauseState(t *testing.T) {
+	s, shutdown := newTestStore(t)
+	defer shutdown()
+
+	ps, err := s.GetPauseState()
+	require.NoError(t, err)
+	require.Equal(t, PauseState{}, ps)
+
+	paused := PauseState{
+		Paused:   true,
+		Reason:   "incident",
+		PausedAt: 1501137828,
+	}
+	require.NoError(t, s.SetPauseState(paused))
+
+	ps, err = s.GetPauseState()
+	require.NoError(t, err)
+	require.Equal(t, paused, ps)
+
+	require.NoError(t, s.SetPauseState(PauseState{}))
+
+	ps, err = s.GetPauseState()
+	require.NoError(t, err)
+	require.Equal(t, PauseState{}, ps)
+}
+
+func TestStoreReleaseKYCDepositInfo(t *testing.T) {
+	s, shutdown := newTestStore(t)
+	defer shutdown()
+
+	populateTestStore(t, s)
+
+	_, err := s.ReleaseKYCDepositInfo("btx9:9", "", "")
+	require.Equal(t, ErrDepositNotFound, err)
+
+	_, err = s.ReleaseKYCDepositInfo("btx2:0", "", "")
+	require.Equal(t, ErrDepositNotPendingKYC, err)
+
+	_, err = s.UpdateDepositInfo("btx2:0", func(di DepositInfo) DepositInfo {
+		di.Status = StatusWaitKYC
+		return di
+	})
+	require.NoError(t, err)
+
+	dis, err := s.QueryDepositInfos(DepositQuery{Statuses: []Status{StatusWaitKYC}})
+	require.NoError(t, err)
+	require.Len(t, dis, 1)
+
+	di, err := s.ReleaseKYCDepositInfo("btx2:0", "documents checked", "127.0.0.1:1234")
+	require.NoError(t, err)
+	require.Equal(t, StatusWaitSend, di.Status)
+
+	dis, err = s.QueryDepositInfos(DepositQuery{Statuses: []Status{StatusWaitKYC}})
+	require.NoError(t, err)
+	require.Empty(t, dis)
+
+	// The release is recorded in the event log, and the state can still be rebuilt
+	evs, err := s.GetDepositEvents()
+	require.NoError(t, err)
+	ev := evs[len(evs)-1]
+	require.Equal(t, EventKYCRelease, ev.Type)
+	require.Equal(t, "documents checked", ev.Reason)
+	require.Equal(t, "127.0.0.1:1234", ev.RemoteAddr)
+	require.Equal(t, di, *ev.DepositInfo)
+
+	db, shutdown2 := testutil.PrepareDB(t)
+	defer shutdown2()
+
+	require.NoError(t, RebuildState(db, nil, evs))
+
+	diffs, err := CompareState(s.db, db, nil)
+	require.NoError(t, err)
+	require.Empty(t, diffs)
+}
+
+func TestStoreReviewDepositInfo(t *testing.T) {
+	s, shutdown := newTestStore(t)
+	defer shutdown()
+
+	populateTestStore(t, s)
+
+	_, err := s.ReviewDepositInfo("btx9:9", true, "", "")
+	require.Equal(t, ErrDepositNotFound, err)
+
+	_, err = s.ReviewDepositInfo("btx2:0", true, "", "")
+	require.Equal(t, ErrDepositNotHeldForReview, err)
+
+	for _, id := range []string{"btx1:1", "btx2:0"} {
+		_, err = s.UpdateDepositInfo(id, func(di DepositInfo) DepositInfo {
+			di.Status = StatusHeldForReview
+			di.Error = "Flagged by screening: too large"
+			return di
+		})
+		require.NoError(t, err)
+	}
+
+	di, err := s.ReviewDepositInfo("btx1:1", true, "source checked", "127.0.0.1:1234")
+	require.NoError(t, err)
+	require.Equal(t, StatusWaitSend, di.Status)
+	require.Empty(t, di.Error)
+
+	di, err = s.ReviewDepositInfo("btx2:0", false, "stolen funds", "127.0.0.1:1234")
+	require.NoError(t, err)
+	require.Equal(t, StatusRejected, di.Status)
+	require.Equal(t, "Flagged by screening: too large", di.Error)
+
+	// The reviews are recorded in the event log, and the state can still be rebuilt
+	evs, err := s.GetDepositEvents()
+	require.NoError(t, err)
+	require.Equal(t, EventReviewApprove, evs[len(evs)-3].Type)
+	ev := evs[len(evs)-1]
+	require.Equal(t, EventReviewReject, ev.Type)
+	require.Equal(t, "stolen funds", ev.Reason)
+	require.Equal(t, di, *ev.DepositInfo)
+
+	db, shutdown2 := testutil.PrepareDB(t)
+	defer shutdown2()
+
+	require.NoError(t, RebuildState(db, nil, evs))
+
+	diffs, err := CompareState(s.db, db, nil)
+	require.NoError(t, err)
+	require.Empty(t, diffs)
+}
+
+func TestStoreReprocessDepositInfo(t *testing.T) {
+	s, shutdown := newTestStore(t)
+	defer shutdown()
+
+	populateTestStore(t, s)
+
+	_, err := s.ReprocessDepositInfo("btx9:9", "", "", "")
+	require.Equal(t, ErrDepositNotFound, err)
+
+	// Deposits that sent skycoins or did not fail can't be reprocessed
+	_, err = s.ReprocessDepositInfo("btx1:1", "", "", "")
+	require.Equal(t, ErrDepositNotReprocessable, err)
+	_, err = s.ReprocessDepositInfo("btx2:0", "", "", "")
+	require.Equal(t, ErrDepositNotReprocessable, err)
+
+	_, err = s.UpdateDepositInfo("btx2:0", func(di DepositInfo) DepositInfo {
+		di.Status = StatusDone
+		di.Error = ErrEmptySendAmount.Error()
+		return di
+	})
+	require.NoError(t, err)
+
+	di, err := s.ReprocessDepositInfo("btx2:0", "1000", "rate fixed", "127.0.0.1:1234")
+	require.NoError(t, err)
+	require.Equal(t, StatusWaitSend, di.Status)
+	require.Empty(t, di.Error)
+	require.Equal(t, "1000", di.ConversionRate)
+
+	saved, err := s.getDepositInfo("btx2:0")
+	require.NoError(t, err)
+	require.Equal(t, di, saved)
+
+	// The reprocessing is recorded in the event log, and the state can still be rebuilt
+	evs, err := s.GetDepositEvents()
+	require.NoError(t, err)
+	ev := evs[len(evs)-1]
+	require.Equal(t, EventReprocess, ev.Type)
+	require.Equal(t, "rate fixed", ev.Reason)
+	require.Equal(t, "127.0.0.1:1234", ev.RemoteAddr)
+	require.Equal(t, di, *ev.DepositInfo)
+
+	db, shutdown2 := testutil.PrepareDB(t)
+	defer shutdown2()
+
+	require.NoError(t, RebuildState(db, nil, evs))
+
+	diffs, err := CompareState(s.db, db, nil)
+	require.NoError(t, err)
+	require.Empty(t, diffs)
+}
+
+func TestStoreEncryption(t *testing.T) {
+	s, shutdown := newTestStore(t)
+	defer shutdown()
+
+	populateTestStore(t, s)
+	evs, err := s.GetDepositEvents()
+	require.NoError(t, err)
+
+	c, err := dbcrypt.Open(s.db, "passphrase")
+	require.NoError(t, err)
+
+	// The state stored before encryption was enabled is read as it is
+	sc, err := StateCipher(s.db, c)
+	require.NoError(t, err)
+	require.Nil(t, sc)
+
+	log, _ := testutil.NewLogger(t)
+	s, err = NewStore(log, s.db, c)
+	require.NoError(t, err)
+
+	sc, err = StateCipher(s.db, c)
+	require.NoError(t, err)
+	require.Equal(t, c, sc)
+
+	// The stored values don't link the deposit addresses to the skycoin addresses
+	err = s.db.View(func(tx *bolt.Tx) error {
+		for _, bkt := range encryptedBkts {
+			if err := dbutil.ForEach(tx, bkt, func(k, v []byte) error {
+				require.NotContains(t, string(v), "skyaddr")
+				require.NotContains(t, string(v), "btcaddr")
+				return nil
+			}); err != nil {
+				return err
+			}
+		}
+
+		return dbutil.ForEach(tx, skyDepositsIndexBkt, func(k, v []byte) error {
+			require.NotContains(t, string(k), "skyaddr")
+			return nil
+		})
+	})
+	require.NoError(t, err)
+
+	// Opening the store again doesn't encrypt the values twice
+	s, err = NewStore(log, s.db, c)
+	require.NoError(t, err)
+
+	skyAddr, err := s.GetBindAddress("btcaddr3")
+	require.NoError(t, err)
+	require.Equal(t, "skyaddr2", skyAddr)
+
+	btcAddrs, err := s.GetSkyBindBtcAddresses("skyaddr1")
+	require.NoError(t, err)
+	require.Equal(t, []string{"btcaddr1", "btcaddr2"}, btcAddrs)
+
+	// The deposits and the binding waiting for a deposit
+	dis, err := s.GetDepositInfoOfSkyAddress("skyaddr1")
+	require.NoError(t, err)
+	require.Len(t, dis, 3)
+
+	dis, err = s.QueryDepositInfos(DepositQuery{SkyAddress: "skyaddr2"})
+	require.NoError(t, err)
+	require.Len(t, dis, 1)
+	require.Equal(t, "btx3:2", dis[0].DepositID)
+
+	evs2, err := LoadDepositEvents(s.db, c)
+	require.NoError(t, err)
+	require.Equal(t, evs, evs2)
+
+	// New values are encrypted too
+	require.NoError(t, s.BindAddress("skyaddr3", "btcaddr4", "", "", "", 0, 0))
+	err = s.db.View(func(tx *bolt.Tx) error {
+		v, err := dbutil.GetBucketString(tx, bindAddressBkt, "btcaddr4")
+		require.NotEqual(t, "skyaddr3", v)
+		return err
+	})
+	require.NoError(t, err)
+
+	// The state is rebuilt into a db with the same key
+	db, shutdown2 := testutil.PrepareDB(t)
+	defer shutdown2()
+
+	evs, err = LoadDepositEvents(s.db, c)
+	require.NoError(t, err)
+	require.NoError(t, dbcrypt.CopyKey(s.db, db))
+	require.NoError(t, RebuildState(db, c, evs))
+
+	diffs, err := CompareState(s.db, db, c)
+	require.NoError(t, err)
+	require.Empty(t, diffs)
+}
@@ -0,0 +1,152 @@
+package exchange
+
+import (
+	"time"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/skycoin/teller/src/outbox"
+)
+
+const (
+	// StreamQueue is the outbox queue of the deposit lifecycle events published to the event stream
+	StreamQueue = "outbox_stream"
+
+	// TopicDepositLifecycle is the outbox topic of deposit lifecycle events
+	TopicDepositLifecycle = "deposit.lifecycle"
+
+	// LifecycleSchemaVersion is the version of the DepositLifecycleEvent schema. Fields are only added
+	// within a version, a change that breaks consumers is a new version.
+	LifecycleSchemaVersion = 1
+)
+
+// LifecycleEventType is the type of a DepositLifecycleEvent
+type LifecycleEventType string
+
+const (
+	// LifecycleBound a deposit address was bound to a skycoin address
+	LifecycleBound LifecycleEventType = "bound"
+	// LifecycleDetected a deposit to a bound address was recorded
+	LifecycleDetected LifecycleEventType = "detected"
+	// LifecycleConfirmed a deposit has the confirmations it requires, and can be sent
+	LifecycleConfirmed LifecycleEventType = "confirmed"
+	// LifecycleSent skycoins were sent for a deposit. The send may still be unconfirmed.
+	LifecycleSent LifecycleEventType = "sent"
+	// LifecycleErrored a deposit failed, with the reason in Error
+	LifecycleErrored LifecycleEventType = "errored"
+)
+
+// DepositLifecycleEvent is the outbox payload of a deposit lifecycle event
+type DepositLifecycleEvent struct {
+	SchemaVersion  int                `json:"schema_version"`
+	Type           LifecycleEventType `json:"type"`
+	Time           int64              `json:"time"`
+	SkyAddress     string             `json:"skycoin_address"`
+	DepositAddress string             `json:"deposit_address"`
+	// Region, Campaign, PromoCode, ExpectedValue and ExpiresAt are set for bound events
+	Region        string `json:"region,omitempty"`
+	Campaign      string `json:"campaign,omitempty"`
+	PromoCode     string `json:"promo_code,omitempty"`
+	ExpectedValue int64  `json:"expected_value,omitempty"`
+	ExpiresAt     int64  `json:"expires_at,omitempty"`
+	// The other fields are set for the events of a deposit
+	DepositID    string `json:"deposit_id,omitempty"`
+	CoinType     string `json:"coin_type,omitempty"`
+	DepositValue int64  `json:"deposit_value,omitempty"`
+	Status       string `json:"status,omitempty"`
+	SkySent      uint64 `json:"sky_sent,omitempty"`
+	Txid         string `json:"txid,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// EnableStream makes the store add the deposit lifecycle events to the StreamQueue outbox,
+// in the same transaction as the change
+func (s *Store) EnableStream() {
+	s.stream = true
+}
+
+// LifecycleEvents returns the lifecycle events of a deposit changing from prev to di, in order.
+// prev is nil if the deposit was created.
+func LifecycleEvents(prev *DepositInfo, di DepositInfo) []LifecycleEventType {
+	var types []LifecycleEventType
+
+	if prev == nil {
+		types = append(types, LifecycleDetected)
+	}
+
+	// A deposit is confirmed when it can be sent, held or not. Deposits with enough confirmations
+	// are recorded confirmed, the others once they reach the confirmations of their tier.
+	if isConfirmedStatus(di.Status) && (prev == nil || prev.Status == StatusWaitDepositConfirmations) {
+		types = append(types, LifecycleConfirmed)
+	}
+
+	if di.Txid != "" && (prev == nil || prev.Txid == "") {
+		types = append(types, LifecycleSent)
+	}
+
+	// The Error of a deposit held for review is the reason of the hold, not a failure
+	if di.Error != "" && di.Status != StatusHeldForReview && (prev == nil || prev.Error != di.Error) {
+		types = append(types, LifecycleErrored)
+	}
+
+	return types
+}
+
+func isConfirmedStatus(s Status) bool {
+	switch s {
+	case StatusWaitSend, StatusWaitKYC, StatusHeldForReview:
+		return true
+	default:
+		return false
+	}
+}
+
+// putLifecycleEventsTx adds the lifecycle events of a deposit changing from prev to di
+// to the StreamQueue outbox, if the stream is enabled
+func (s *Store) putLifecycleEventsTx(tx *bolt.Tx, prev *DepositInfo, di DepositInfo) error {
+	if !s.stream {
+		return nil
+	}
+
+	for _, t := range LifecycleEvents(prev, di) {
+		if _, err := outbox.PutQueueTx(tx, StreamQueue, TopicDepositLifecycle, DepositLifecycleEvent{
+			SchemaVersion:  LifecycleSchemaVersion,
+			Type:           t,
+			Time:           di.UpdatedAt,
+			SkyAddress:     di.SkyAddress,
+			DepositAddress: di.DepositAddress,
+			DepositID:      di.DepositID,
+			CoinType:       di.CoinType,
+			DepositValue:   di.DepositValue,
+			Status:         di.Status.String(),
+			SkySent:        di.SkySent,
+			Txid:           di.Txid,
+			Error:          di.Error,
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// putBoundEventTx adds the bound lifecycle event of a binding to the StreamQueue outbox, if the stream is enabled
+func (s *Store) putBoundEventTx(tx *bolt.Tx, skyAddr, btcAddr, region, campaign, promoCode string, expectedValue, expiresAt int64) error {
+	if !s.stream {
+		return nil
+	}
+
+	_, err := outbox.PutQueueTx(tx, StreamQueue, TopicDepositLifecycle, DepositLifecycleEvent{
+		SchemaVersion:  LifecycleSchemaVersion,
+		Type:           LifecycleBound,
+		Time:           time.Now().UTC().Unix(),
+		SkyAddress:     skyAddr,
+		DepositAddress: btcAddr,
+		Region:         region,
+		Campaign:       campaign,
+		PromoCode:      promoCode,
+		ExpectedValue:  expectedValue,
+		ExpiresAt:      expiresAt,
+	})
+	return err
+}
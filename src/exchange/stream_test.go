@@ -0,0 +1,168 @@
+package exchange
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/outbox"
+	"github.com/skycoin/teller/src/scanner"
+)
+
+func TestLifecycleEvents(t *testing.T) {
+	cases := []struct {
+		name   string
+		prev   *DepositInfo
+		di     DepositInfo
+		events []LifecycleEventType
+	}{
+		{
+			name:   "created confirmed",
+			di:     DepositInfo{Status: StatusWaitSend},
+			events: []LifecycleEventType{LifecycleDetected, LifecycleConfirmed},
+		},
+		{
+			name:   "created waiting for confirmations",
+			di:     DepositInfo{Status: StatusWaitDepositConfirmations},
+			events: []LifecycleEventType{LifecycleDetected},
+		},
+		{
+			name:   "created as dust",
+			di:     DepositInfo{Status: StatusIgnoredDust},
+			events: []LifecycleEventType{LifecycleDetected},
+		},
+		{
+			name:   "confirmed and held for kyc",
+			prev:   &DepositInfo{Status: StatusWaitDepositConfirmations},
+			di:     DepositInfo{Status: StatusWaitKYC},
+			events: []LifecycleEventType{LifecycleConfirmed},
+		},
+		{
+			name: "released from kyc",
+			prev: &DepositInfo{Status: StatusWaitKYC},
+			di:   DepositInfo{Status: StatusWaitSend},
+		},
+		{
+			name:   "sent",
+			prev:   &DepositInfo{Status: StatusWaitSend},
+			di:     DepositInfo{Status: StatusWaitConfirm, Txid: "skytx1"},
+			events: []LifecycleEventType{LifecycleSent},
+		},
+		{
+			name: "send confirmed",
+			prev: &DepositInfo{Status: StatusWaitConfirm, Txid: "skytx1"},
+			di:   DepositInfo{Status: StatusDone, Txid: "skytx1"},
+		},
+		{
+			name:   "send failed",
+			prev:   &DepositInfo{Status: StatusWaitSend},
+			di:     DepositInfo{Status: StatusWaitSend, Error: "send failed"},
+			events: []LifecycleEventType{LifecycleErrored},
+		},
+		{
+			name: "same error",
+			prev: &DepositInfo{Status: StatusWaitSend, Error: "send failed"},
+			di:   DepositInfo{Status: StatusWaitSend, Error: "send failed"},
+		},
+		{
+			name: "held for review",
+			prev: &DepositInfo{Status: StatusWaitSend},
+			di:   DepositInfo{Status: StatusHeldForReview, Error: "flagged"},
+		},
+		{
+			name:   "invalidated",
+			prev:   &DepositInfo{Status: StatusWaitDepositConfirmations},
+			di:     DepositInfo{Status: StatusInvalidated, Error: "double spent"},
+			events: []LifecycleEventType{LifecycleErrored},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.events, LifecycleEvents(tc.prev, tc.di))
+		})
+	}
+}
+
+func TestStoreStream(t *testing.T) {
+	s, shutdown := newTestStore(t)
+	defer shutdown()
+
+	// Nothing is emitted until the stream is enabled
+	require.NoError(t, s.BindAddress("skyaddr1", "btcaddr1", "", "", "", 0, 0))
+
+	streamStore, err := outbox.NewQueueStore(s.db, StreamQueue)
+	require.NoError(t, err)
+
+	n, err := streamStore.Len()
+	require.NoError(t, err)
+	require.Equal(t, 0, n)
+
+	s.EnableStream()
+
+	require.NoError(t, s.BindAddress("skyaddr1", "btcaddr2", "eu", "", "", 2e6, 0))
+
+	_, err = s.addDepositInfo(DepositInfo{
+		DepositID:      "btx2:1",
+		CoinType:       scanner.CoinTypeBTC,
+		SkyAddress:     "skyaddr1",
+		DepositAddress: "btcaddr2",
+		DepositValue:   2e6,
+		ConversionRate: testSkyBtcRate,
+		Status:         StatusWaitSend,
+	})
+	require.NoError(t, err)
+
+	_, err = s.UpdateDepositInfo("btx2:1", func(di DepositInfo) DepositInfo {
+		di.Status = StatusWaitConfirm
+		di.Txid = "skytx1"
+		di.SkySent = 1e6
+		return di
+	})
+	require.NoError(t, err)
+
+	msgs, err := streamStore.Pending(0)
+	require.NoError(t, err)
+
+	var events []DepositLifecycleEvent
+	for _, msg := range msgs {
+		require.Equal(t, TopicDepositLifecycle, msg.Topic)
+
+		var ev DepositLifecycleEvent
+		require.NoError(t, json.Unmarshal(msg.Payload, &ev))
+		require.Equal(t, LifecycleSchemaVersion, ev.SchemaVersion)
+		require.NotEmpty(t, ev.Time)
+		events = append(events, ev)
+	}
+
+	require.Len(t, events, 4)
+
+	require.Equal(t, LifecycleBound, events[0].Type)
+	require.Equal(t, "skyaddr1", events[0].SkyAddress)
+	require.Equal(t, "btcaddr2", events[0].DepositAddress)
+	require.Equal(t, "eu", events[0].Region)
+	require.Equal(t, int64(2e6), events[0].ExpectedValue)
+	require.Empty(t, events[0].DepositID)
+
+	require.Equal(t, LifecycleDetected, events[1].Type)
+	require.Equal(t, "btx2:1", events[1].DepositID)
+	require.Equal(t, scanner.CoinTypeBTC, events[1].CoinType)
+	require.Equal(t, int64(2e6), events[1].DepositValue)
+	require.Equal(t, StatusWaitSend.String(), events[1].Status)
+
+	require.Equal(t, LifecycleConfirmed, events[2].Type)
+
+	require.Equal(t, LifecycleSent, events[3].Type)
+	require.Equal(t, "skytx1", events[3].Txid)
+	require.Equal(t, uint64(1e6), events[3].SkySent)
+	require.Equal(t, StatusWaitConfirm.String(), events[3].Status)
+
+	// The stream has its own queue, the deposit status webhook outbox is not enabled
+	outboxStore, err := outbox.NewStore(s.db)
+	require.NoError(t, err)
+
+	n, err = outboxStore.Len()
+	require.NoError(t, err)
+	require.Equal(t, 0, n)
+}
@@ -0,0 +1,239 @@
+// Package ipfilter blocks clients by IP, with CIDR allow and deny lists and temporary bans
+package ipfilter
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrBanNotFound is returned when removing a ban that does not exist
+	ErrBanNotFound = errors.New("Ban not found")
+	// ErrInvalidDuration is returned when adding a ban without a positive duration
+	ErrInvalidDuration = errors.New("Ban duration must be positive")
+)
+
+// Ban is a temporary ban of an IP or CIDR range
+type Ban struct {
+	CIDR      string `json:"cidr"`
+	Reason    string `json:"reason,omitempty"`
+	CreatedAt int64  `json:"created_at"`
+	ExpiresAt int64  `json:"expires_at"`
+
+	ipNet *net.IPNet
+}
+
+// Filter decides which client IPs are blocked. An IP is blocked if it is in the deny list or banned,
+// or if the allow list is not empty and the IP is not in it. The deny list and bans take precedence
+// over the allow list.
+type Filter struct {
+	sync.RWMutex
+	allow List
+	deny  List
+	bans  map[string]Ban // by CIDR
+	now   func() time.Time
+}
+
+// NewFilter creates a Filter with allow and deny lists of IPs or CIDR ranges
+func NewFilter(allow, deny []string) (*Filter, error) {
+	f := &Filter{
+		bans: make(map[string]Ban),
+		now:  time.Now,
+	}
+
+	if err := f.SetLists(allow, deny); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// ParseCIDR parses an IP or CIDR range. An IP is a range of one address.
+func ParseCIDR(s string) (*net.IPNet, error) {
+	s = strings.TrimSpace(s)
+
+	if strings.Contains(s, "/") {
+		_, n, err := net.ParseCIDR(s)
+		return n, err
+	}
+
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP address %q", s)
+	}
+
+	bits := 8 * net.IPv6len
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+		bits = 8 * net.IPv4len
+	}
+
+	return &net.IPNet{
+		IP:   ip,
+		Mask: net.CIDRMask(bits, bits),
+	}, nil
+}
+
+// List is a list of IP ranges
+type List []*net.IPNet
+
+// ParseList parses a list of IPs or CIDR ranges
+func ParseList(list []string) (List, error) {
+	nets := make(List, 0, len(list))
+	for _, s := range list {
+		n, err := ParseCIDR(s)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// Contains returns true if ip is in one of the ranges of the list
+func (l List) Contains(ip net.IP) bool {
+	for _, n := range l {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseIP parses a client IP, which can be an IPv6 address in brackets, e.g. [::1]. Returns nil if it is invalid.
+func ParseIP(s string) net.IP {
+	return net.ParseIP(strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(s), "["), "]"))
+}
+
+// SetLists replaces the allow and deny lists. Bans are kept.
+func (f *Filter) SetLists(allow, deny []string) error {
+	allowNets, err := ParseList(allow)
+	if err != nil {
+		return err
+	}
+
+	denyNets, err := ParseList(deny)
+	if err != nil {
+		return err
+	}
+
+	f.Lock()
+	defer f.Unlock()
+	f.allow = allowNets
+	f.deny = denyNets
+
+	return nil
+}
+
+// Blocked returns true if requests from ip are blocked. An IP that can't be parsed is blocked
+// only if the allow list is not empty.
+func (f *Filter) Blocked(ip string) bool {
+	addr := ParseIP(ip)
+
+	f.RLock()
+	defer f.RUnlock()
+
+	if addr == nil {
+		return len(f.allow) != 0
+	}
+
+	if f.deny.Contains(addr) {
+		return true
+	}
+
+	now := f.now().UTC().Unix()
+	for _, b := range f.bans {
+		if now < b.ExpiresAt && b.ipNet.Contains(addr) {
+			return true
+		}
+	}
+
+	return len(f.allow) != 0 && !f.allow.Contains(addr)
+}
+
+// Ban bans an IP or CIDR range for d. Banning a banned range replaces its ban.
+func (f *Filter) Ban(cidr string, d time.Duration, reason string) (Ban, error) {
+	n, err := ParseCIDR(cidr)
+	if err != nil {
+		return Ban{}, err
+	}
+
+	if d <= 0 {
+		return Ban{}, ErrInvalidDuration
+	}
+
+	f.Lock()
+	defer f.Unlock()
+
+	f.purge()
+
+	now := f.now().UTC()
+	b := Ban{
+		CIDR:      n.String(),
+		Reason:    reason,
+		CreatedAt: now.Unix(),
+		ExpiresAt: now.Add(d).Unix(),
+		ipNet:     n,
+	}
+	f.bans[b.CIDR] = b
+
+	return b, nil
+}
+
+// Unban removes the ban of an IP or CIDR range. Returns ErrBanNotFound if it is not banned.
+func (f *Filter) Unban(cidr string) error {
+	n, err := ParseCIDR(cidr)
+	if err != nil {
+		return err
+	}
+
+	f.Lock()
+	defer f.Unlock()
+
+	f.purge()
+
+	if _, ok := f.bans[n.String()]; !ok {
+		return ErrBanNotFound
+	}
+
+	delete(f.bans, n.String())
+
+	return nil
+}
+
+// Bans returns the bans that have not expired, ordered by expiry
+func (f *Filter) Bans() []Ban {
+	f.Lock()
+	defer f.Unlock()
+
+	f.purge()
+
+	bans := make([]Ban, 0, len(f.bans))
+	for _, b := range f.bans {
+		bans = append(bans, b)
+	}
+
+	sort.Slice(bans, func(i, j int) bool {
+		if bans[i].ExpiresAt == bans[j].ExpiresAt {
+			return bans[i].CIDR < bans[j].CIDR
+		}
+		return bans[i].ExpiresAt < bans[j].ExpiresAt
+	})
+
+	return bans
+}
+
+// purge removes the expired bans. Must be called with the lock held.
+func (f *Filter) purge() {
+	now := f.now().UTC().Unix()
+	for k, b := range f.bans {
+		if now >= b.ExpiresAt {
+			delete(f.bans, k)
+		}
+	}
+}
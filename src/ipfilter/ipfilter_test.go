@@ -0,0 +1,109 @@
+package ipfilter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilterLists(t *testing.T) {
+	_, err := NewFilter([]string{"10.0.0.0/33"}, nil)
+	require.Error(t, err)
+
+	_, err = NewFilter(nil, []string{"1.2.3"})
+	require.Error(t, err)
+
+	f, err := NewFilter(nil, nil)
+	require.NoError(t, err)
+
+	// Nothing is blocked by default
+	for _, ip := range []string{"1.2.3.4", "::1", "[::1]", ""} {
+		require.False(t, f.Blocked(ip), ip)
+	}
+
+	require.NoError(t, f.SetLists(nil, []string{"1.2.3.4", "10.0.0.0/8", "2001:db8::/32"}))
+
+	for _, tc := range []struct {
+		ip      string
+		blocked bool
+	}{
+		{"1.2.3.4", true},
+		{"1.2.3.5", false},
+		{"10.1.2.3", true},
+		{"11.0.0.1", false},
+		{"2001:db8::1", true},
+		{"[2001:db8::1]", true},
+		{"2001:db9::1", false},
+		{"::ffff:10.0.0.1", true},
+		{"", false},
+	} {
+		require.Equal(t, tc.blocked, f.Blocked(tc.ip), tc.ip)
+	}
+
+	// The allow list only allows its IPs, the deny list takes precedence
+	require.NoError(t, f.SetLists([]string{"10.0.0.0/8", "192.168.1.1"}, []string{"10.0.0.5"}))
+
+	for _, tc := range []struct {
+		ip      string
+		blocked bool
+	}{
+		{"10.1.2.3", false},
+		{"10.0.0.5", true},
+		{"192.168.1.1", false},
+		{"192.168.1.2", true},
+		{"1.2.3.4", true},
+		{"", true},
+	} {
+		require.Equal(t, tc.blocked, f.Blocked(tc.ip), tc.ip)
+	}
+}
+
+func TestFilterBans(t *testing.T) {
+	f, err := NewFilter([]string{"1.2.0.0/16"}, nil)
+	require.NoError(t, err)
+
+	now := time.Unix(1500000000, 0)
+	f.now = func() time.Time {
+		return now
+	}
+
+	_, err = f.Ban("1.2.3", time.Hour, "")
+	require.Error(t, err)
+
+	_, err = f.Ban("1.2.3.4", 0, "")
+	require.Equal(t, ErrInvalidDuration, err)
+
+	b, err := f.Ban("1.2.3.4", time.Hour, "scraping")
+	require.NoError(t, err)
+	require.Equal(t, "1.2.3.4/32", b.CIDR)
+	require.Equal(t, now.Unix()+3600, b.ExpiresAt)
+
+	_, err = f.Ban("1.2.4.0/24", time.Minute, "")
+	require.NoError(t, err)
+
+	// Bans take precedence over the allow list
+	require.True(t, f.Blocked("1.2.3.4"))
+	require.True(t, f.Blocked("1.2.4.200"))
+	require.False(t, f.Blocked("1.2.3.5"))
+
+	bans := f.Bans()
+	require.Len(t, bans, 2)
+	require.Equal(t, "1.2.4.0/24", bans[0].CIDR)
+	require.Equal(t, "1.2.3.4/32", bans[1].CIDR)
+	require.Equal(t, "scraping", bans[1].Reason)
+
+	// Expired bans are lifted
+	now = now.Add(time.Minute)
+	require.False(t, f.Blocked("1.2.4.200"))
+	require.Len(t, f.Bans(), 1)
+
+	// Lists can be replaced without lifting bans
+	require.NoError(t, f.SetLists(nil, nil))
+	require.True(t, f.Blocked("1.2.3.4"))
+
+	require.Equal(t, ErrBanNotFound, f.Unban("1.2.4.0/24"))
+	require.NoError(t, f.Unban("1.2.3.4"))
+	require.False(t, f.Blocked("1.2.3.4"))
+	require.Empty(t, f.Bans())
+}
@@ -0,0 +1,106 @@
+// Package kyc checks whether the owners of skycoin addresses passed KYC with an external KYC service
+package kyc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const defaultTimeout = time.Second * 10
+
+// ErrNotVerified is returned when the owner of a skycoin address has not passed KYC
+var ErrNotVerified = errors.New("KYC verification required")
+
+// Provider checks the KYC status of skycoin addresses
+type Provider interface {
+	// Verified returns true if the owner of a skycoin address passed KYC. token is an optional user token
+	// that links the address to a user of the KYC service, e.g. the kyc_token of a bind request.
+	Verified(ctx context.Context, skyAddr, token string) (bool, error)
+}
+
+// verifyResponse is the response of the KYC service
+type verifyResponse struct {
+	Verified bool `json:"verified"`
+}
+
+// Client is a Provider that asks a KYC service over HTTP.
+//
+// The service is called with GET <url>?skyaddr=<skyaddr>&token=<token>, with the API key as a bearer token,
+// and responds with 200 and {"verified": true} or {"verified": false}.
+type Client struct {
+	url    string
+	apiKey string
+	client *http.Client
+}
+
+// NewClient creates a Client of the KYC service at serviceURL. apiKey is optional.
+// Requests time out after timeout, or 10s if it is 0.
+func NewClient(serviceURL, apiKey string, timeout time.Duration) (*Client, error) {
+	u, err := url.Parse(serviceURL)
+	if err != nil {
+		return nil, errors.New("invalid KYC service url")
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, errors.New("KYC service url must be an http or https URL")
+	}
+
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+
+	return &Client{
+		url:    serviceURL,
+		apiKey: apiKey,
+		client: &http.Client{
+			Timeout: timeout,
+		},
+	}, nil
+}
+
+// Verified asks the KYC service whether the owner of a skycoin address passed KYC
+func (c *Client) Verified(ctx context.Context, skyAddr, token string) (bool, error) {
+	u, err := url.Parse(c.url)
+	if err != nil {
+		return false, err
+	}
+
+	q := u.Query()
+	q.Set("skyaddr", skyAddr)
+	if token != "" {
+		q.Set("token", token)
+	}
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return false, err
+	}
+	req = req.WithContext(ctx)
+
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+
+	rsp, err := c.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("KYC request failed: %s", rsp.Status)
+	}
+
+	var vr verifyResponse
+	if err := json.NewDecoder(rsp.Body).Decode(&vr); err != nil {
+		return false, fmt.Errorf("decode KYC response failed: %v", err)
+	}
+
+	return vr.Verified, nil
+}
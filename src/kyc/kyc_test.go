@@ -0,0 +1,66 @@
+package kyc
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientVerified(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodGet, r.Method)
+		require.Equal(t, "Bearer key", r.Header.Get("Authorization"))
+		require.Equal(t, "1", r.URL.Query().Get("v"))
+
+		switch r.URL.Query().Get("skyaddr") {
+		case "verified":
+			fmt.Fprint(w, `{"verified": true}`)
+		case "token":
+			fmt.Fprintf(w, `{"verified": %v}`, r.URL.Query().Get("token") == "usertoken")
+		case "unavailable":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case "garbage":
+			fmt.Fprint(w, `not json`)
+		default:
+			fmt.Fprint(w, `{"verified": false}`)
+		}
+	}))
+	defer srv.Close()
+
+	_, err := NewClient("ftp://example.com", "", 0)
+	require.Error(t, err)
+
+	_, err = NewClient("://", "", 0)
+	require.Error(t, err)
+
+	c, err := NewClient(srv.URL+"/kyc?v=1", "key", 0)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+
+	ok, err := c.Verified(ctx, "verified", "")
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	ok, err = c.Verified(ctx, "unverified", "")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	ok, err = c.Verified(ctx, "token", "usertoken")
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	ok, err = c.Verified(ctx, "token", "")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	_, err = c.Verified(ctx, "unavailable", "")
+	require.Error(t, err)
+
+	_, err = c.Verified(ctx, "garbage", "")
+	require.Error(t, err)
+}
@@ -0,0 +1,217 @@
+// Package leader elects a leader among teller instances with a lock in redis,
+// so that only one instance uses the db, scans deposits and sends skycoin
+package leader
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/skycoin/teller/src/util/redisutil"
+)
+
+const (
+	defaultLockTTL     = time.Second * 15
+	defaultRetryPeriod = time.Second * 5
+)
+
+// ErrLeadershipLost is returned by Run if the lock expired or was taken by another instance
+var ErrLeadershipLost = errors.New("Leadership lost, the lock expired or is held by another instance")
+
+// renewScript extends the lock if this instance holds it.
+// KEYS[1] lock key, ARGV[1] instance ID, ARGV[2] TTL in ms
+const renewScript = `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`
+
+// releaseScript deletes the lock if this instance holds it.
+// KEYS[1] lock key, ARGV[1] instance ID
+const releaseScript = `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`
+
+// Config configures the Elector
+type Config struct {
+	Key         string        // redis key of the lock
+	ID          string        // ID of this instance, the value of the lock while it is the leader
+	TTL         time.Duration // the lock expires if it is not renewed within the TTL. It is renewed every TTL/3
+	RetryPeriod time.Duration // how often a standby tries to take the lock
+}
+
+// Elector campaigns for the leader lock until it takes it, then keeps renewing it.
+// Instances that don't hold the lock are standbys.
+type Elector struct {
+	log     logrus.FieldLogger
+	cfg     Config
+	client  *redisutil.Client
+	elected chan struct{}
+	leader  bool
+	quit    chan struct{}
+	done    chan struct{}
+	sync.RWMutex
+}
+
+// NewElector creates an Elector
+func NewElector(log logrus.FieldLogger, client *redisutil.Client, cfg Config) (*Elector, error) {
+	if client == nil {
+		return nil, errors.New("new leader Elector failed: client is nil")
+	}
+
+	if cfg.Key == "" {
+		return nil, errors.New("new leader Elector failed: lock key is empty")
+	}
+
+	if cfg.ID == "" {
+		return nil, errors.New("new leader Elector failed: instance ID is empty")
+	}
+
+	if cfg.TTL == 0 {
+		cfg.TTL = defaultLockTTL
+	}
+
+	if cfg.RetryPeriod == 0 {
+		cfg.RetryPeriod = defaultRetryPeriod
+	}
+
+	if cfg.TTL < 3*time.Millisecond {
+		return nil, errors.New("new leader Elector failed: lock TTL must be at least 3ms")
+	}
+
+	return &Elector{
+		log: log.WithFields(logrus.Fields{
+			"prefix": "leader.elector",
+			"id":     cfg.ID,
+		}),
+		cfg:     cfg,
+		client:  client,
+		elected: make(chan struct{}),
+		quit:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}, nil
+}
+
+// Run campaigns for the lock until this instance is elected, then renews it.
+// Returns ErrLeadershipLost if the lock can't be renewed before it expires.
+// The lock is released on Shutdown.
+func (e *Elector) Run() error {
+	log := e.log.WithField("config", e.cfg)
+	log.Info("Start leader elector")
+	defer log.Info("Leader elector closed")
+	defer close(e.done)
+
+	for {
+		ok, err := e.acquire()
+		if err != nil {
+			log.WithError(err).Error("Elector.acquire failed")
+		} else if ok {
+			break
+		}
+
+		select {
+		case <-e.quit:
+			return nil
+		case <-time.After(e.cfg.RetryPeriod):
+		}
+	}
+
+	e.setLeader(true)
+	close(e.elected)
+
+	log.Info("Elected leader")
+
+	renewed := time.Now()
+	for {
+		select {
+		case <-e.quit:
+			e.setLeader(false)
+
+			if err := e.release(); err != nil {
+				log.WithError(err).Error("Elector.release failed, the lock expires after its TTL")
+			}
+			return nil
+		case <-time.After(e.cfg.TTL / 3):
+		}
+
+		ok, err := e.renew()
+		switch {
+		case err != nil:
+			log.WithError(err).Error("Elector.renew failed")
+			if time.Since(renewed) < e.cfg.TTL {
+				continue
+			}
+		case ok:
+			renewed = time.Now()
+			continue
+		}
+
+		e.setLeader(false)
+
+		log.Error("Leadership lost")
+		return ErrLeadershipLost
+	}
+}
+
+// Shutdown stops the Elector, releasing the lock if this instance is the leader
+func (e *Elector) Shutdown() {
+	close(e.quit)
+	<-e.done
+}
+
+// Elected is closed when this instance is elected leader
+func (e *Elector) Elected() <-chan struct{} {
+	return e.elected
+}
+
+// IsLeader reports whether this instance holds the lock
+func (e *Elector) IsLeader() bool {
+	e.RLock()
+	defer e.RUnlock()
+	return e.leader
+}
+
+func (e *Elector) setLeader(leader bool) {
+	e.Lock()
+	defer e.Unlock()
+	e.leader = leader
+}
+
+func (e *Elector) ttlMs() int64 {
+	return int64(e.cfg.TTL / time.Millisecond)
+}
+
+// acquire takes the lock if no instance holds it
+func (e *Elector) acquire() (bool, error) {
+	_, err := redisutil.String(e.client.Do("SET", e.cfg.Key, e.cfg.ID, "NX", "PX", e.ttlMs()))
+	switch err {
+	case nil:
+		return true, nil
+	case redisutil.ErrNil:
+		return false, nil
+	default:
+		return false, err
+	}
+}
+
+// renew extends the lock, returns false if this instance doesn't hold it
+func (e *Elector) renew() (bool, error) {
+	n, err := redisutil.Int64(e.client.Do("EVAL", renewScript, 1, e.cfg.Key, e.cfg.ID, e.ttlMs()))
+	if err != nil {
+		return false, err
+	}
+
+	return n == 1, nil
+}
+
+// release deletes the lock if this instance holds it, so that a standby can take over without waiting for it to expire
+func (e *Elector) release() error {
+	_, err := redisutil.Int64(e.client.Do("EVAL", releaseScript, 1, e.cfg.Key, e.cfg.ID))
+	return err
+}
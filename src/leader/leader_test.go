@@ -0,0 +1,159 @@
+package leader
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/util/redisutil"
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+// fakeRedis is a redis server with the commands of the Elector. Keys don't expire.
+type fakeRedis struct {
+	keys map[string]string
+	sync.Mutex
+}
+
+func newFakeRedis(t *testing.T) (*fakeRedis, string, func()) {
+	f := &fakeRedis{
+		keys: make(map[string]string),
+	}
+
+	addr, shutdown := testutil.NewFakeRedis(t, f.reply)
+	return f, addr, shutdown
+}
+
+func (f *fakeRedis) set(key, value string) {
+	f.Lock()
+	defer f.Unlock()
+	f.keys[key] = value
+}
+
+func (f *fakeRedis) get(key string) string {
+	f.Lock()
+	defer f.Unlock()
+	return f.keys[key]
+}
+
+func (f *fakeRedis) reply(args []string) string {
+	f.Lock()
+	defer f.Unlock()
+
+	switch {
+	case args[0] == "SET" && len(args) == 6 && args[3] == "NX" && args[4] == "PX":
+		if _, ok := f.keys[args[1]]; ok {
+			return "$-1\r\n"
+		}
+		f.keys[args[1]] = args[2]
+		return "+OK\r\n"
+	case args[0] == "EVAL" && len(args) >= 5 && args[2] == "1":
+		if f.keys[args[3]] != args[4] {
+			return ":0\r\n"
+		}
+		switch args[1] {
+		case renewScript:
+			return ":1\r\n"
+		case releaseScript:
+			delete(f.keys, args[3])
+			return ":1\r\n"
+		}
+	}
+
+	return fmt.Sprintf("-ERR unexpected command %q\r\n", args[0])
+}
+
+func newTestElector(t *testing.T, addr, id string) (*Elector, chan error) {
+	log, _ := testutil.NewLogger(t)
+	client := redisutil.NewClient(redisutil.Config{
+		Addr: addr,
+	})
+
+	e, err := NewElector(log, client, Config{
+		Key:         "teller:leader",
+		ID:          id,
+		TTL:         60 * time.Millisecond,
+		RetryPeriod: 10 * time.Millisecond,
+	})
+	require.NoError(t, err)
+
+	errC := make(chan error, 1)
+	go func() {
+		errC <- e.Run()
+	}()
+
+	return e, errC
+}
+
+func isClosed(c <-chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestElectorFailover(t *testing.T) {
+	f, addr, shutdown := newFakeRedis(t)
+	defer shutdown()
+
+	e1, errC1 := newTestElector(t, addr, "a")
+	for i := 0; i < 30 && !isClosed(e1.Elected()); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.True(t, isClosed(e1.Elected()))
+	require.True(t, e1.IsLeader())
+	require.Equal(t, "a", f.get("teller:leader"))
+
+	// The second instance is a standby while the first holds the lock
+	e2, errC2 := newTestElector(t, addr, "b")
+	time.Sleep(100 * time.Millisecond)
+	require.False(t, isClosed(e2.Elected()))
+	require.False(t, e2.IsLeader())
+
+	// The lock is renewed, and released on shutdown, so the standby takes over
+	e1.Shutdown()
+	require.NoError(t, <-errC1)
+	require.False(t, e1.IsLeader())
+
+	for i := 0; i < 30 && !isClosed(e2.Elected()); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.True(t, e2.IsLeader())
+	require.Equal(t, "b", f.get("teller:leader"))
+
+	// Leadership is lost if another instance took the lock
+	f.set("teller:leader", "c")
+	select {
+	case err := <-errC2:
+		require.Equal(t, ErrLeadershipLost, err)
+	case <-time.After(time.Second):
+		t.Fatal("Elector.Run did not return")
+	}
+	require.False(t, e2.IsLeader())
+	require.Equal(t, "c", f.get("teller:leader"))
+}
+
+func TestElectorRedisDown(t *testing.T) {
+	_, addr, shutdown := newFakeRedis(t)
+
+	e, errC := newTestElector(t, addr, "a")
+	for i := 0; i < 30 && !isClosed(e.Elected()); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.True(t, e.IsLeader())
+
+	// The lock can't be renewed, leadership is lost once it would have expired
+	shutdown()
+	select {
+	case err := <-errC:
+		require.Equal(t, ErrLeadershipLost, err)
+	case <-time.After(time.Second):
+		t.Fatal("Elector.Run did not return")
+	}
+	require.False(t, e.IsLeader())
+}
@@ -0,0 +1,510 @@
+// Package loadtest drives a mix of bind, status and config requests against a teller
+// instance, and reports the latency percentiles and error rates of each request kind.
+// It is used by cmd/teller-loadtest to validate capacity and rate limit settings.
+package loadtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/skycoin/skycoin/src/cipher"
+)
+
+// Kind is the kind of a request
+type Kind string
+
+const (
+	// KindBind is a POST /api/bind request with a new skycoin address
+	KindBind Kind = "bind"
+	// KindStatus is a GET /api/status request of a bound skycoin address
+	KindStatus Kind = "status"
+	// KindConfig is a GET /api/config request
+	KindConfig Kind = "config"
+)
+
+// Kinds lists the request kinds, in report order
+var Kinds = []Kind{KindBind, KindStatus, KindConfig}
+
+// Percentiles are the latency percentiles in a KindReport
+var Percentiles = []float64{50, 90, 95, 99}
+
+// Mix is the relative weight of each request kind
+type Mix map[Kind]int
+
+// ParseMix parses a mix like "bind=1,status=8,config=1". Kinds that are not listed have weight 0.
+func ParseMix(s string) (Mix, error) {
+	m := make(Mix)
+	for _, p := range strings.Split(s, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+
+		kv := strings.SplitN(p, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid mix entry %q, must be kind=weight", p)
+		}
+
+		k := Kind(strings.TrimSpace(kv[0]))
+		if !validKind(k) {
+			return nil, fmt.Errorf("unknown request kind %q", k)
+		}
+
+		w, err := strconv.Atoi(strings.TrimSpace(kv[1]))
+		if err != nil || w < 0 {
+			return nil, fmt.Errorf("invalid weight of %s: %q", k, kv[1])
+		}
+
+		m[k] = w
+	}
+
+	if m.total() == 0 {
+		return nil, errors.New("mix has no request kind with a weight above 0")
+	}
+
+	return m, nil
+}
+
+func (m Mix) total() int {
+	n := 0
+	for _, w := range m {
+		n += w
+	}
+	return n
+}
+
+// pick returns a kind at random, by weight
+func (m Mix) pick(r *rand.Rand) Kind {
+	n := r.Intn(m.total())
+	for _, k := range Kinds {
+		if n < m[k] {
+			return k
+		}
+		n -= m[k]
+	}
+	panic("Mix.pick: weights changed")
+}
+
+func validKind(k Kind) bool {
+	for _, kk := range Kinds {
+		if kk == k {
+			return true
+		}
+	}
+	return false
+}
+
+// Config configures a load test
+type Config struct {
+	// Base URL of the teller instance, e.g. http://127.0.0.1:7071
+	Target string
+	// How long to send requests for. Ignored if Requests is set
+	Duration time.Duration
+	// Total number of requests to send. If 0, requests are sent for Duration
+	Requests int
+	// Number of concurrent clients
+	Concurrency int
+	// Maximum requests per second of all clients. If 0, each client sends its next request
+	// as soon as the previous one is answered
+	Rate float64
+	// Relative weight of each request kind
+	Mix Mix
+	// Coin type of bind requests
+	CoinType string
+	// Timeout of each request
+	Timeout time.Duration
+}
+
+// Validate validates the config
+func (c Config) Validate() error {
+	u, err := url.Parse(c.Target)
+	if err != nil {
+		return fmt.Errorf("invalid target: %v", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errors.New("target must be an http or https URL")
+	}
+
+	if c.Requests < 0 {
+		return errors.New("requests must be >= 0")
+	}
+	if c.Requests == 0 && c.Duration <= 0 {
+		return errors.New("duration must be > 0 if requests is not set")
+	}
+	if c.Concurrency < 1 {
+		return errors.New("concurrency must be >= 1")
+	}
+	if c.Rate < 0 {
+		return errors.New("rate must be >= 0")
+	}
+	if c.Timeout <= 0 {
+		return errors.New("timeout must be > 0")
+	}
+	if c.Mix.total() == 0 {
+		return errors.New("mix has no request kind with a weight above 0")
+	}
+	if c.Mix[KindBind] > 0 && c.CoinType == "" {
+		return errors.New("coin type is required for bind requests")
+	}
+
+	return nil
+}
+
+// KindReport is the result of the requests of one kind
+type KindReport struct {
+	Kind     Kind `json:"kind"`
+	Requests int  `json:"requests"`
+	// Requests that failed, with a transport error or a non-2xx status, including Throttled
+	Errors int `json:"errors"`
+	// Requests answered with 429 Too Many Requests by the rate limiter
+	Throttled int `json:"throttled"`
+	// Number of responses by HTTP status code, 0 for transport errors
+	StatusCodes map[int]int `json:"status_codes"`
+	// Latency percentiles by Percentiles, and the maximum latency, of all requests
+	Latencies map[string]time.Duration `json:"latencies"`
+	Max       time.Duration            `json:"max"`
+}
+
+// ErrorRate returns the share of requests that failed, from 0 to 1
+func (r KindReport) ErrorRate() float64 {
+	if r.Requests == 0 {
+		return 0
+	}
+	return float64(r.Errors) / float64(r.Requests)
+}
+
+// Report is the result of a load test
+type Report struct {
+	Elapsed  time.Duration `json:"elapsed"`
+	Requests int           `json:"requests"`
+	Errors   int           `json:"errors"`
+	Kinds    []KindReport  `json:"kinds"`
+}
+
+// Throughput returns the requests per second
+func (r Report) Throughput() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Requests) / r.Elapsed.Seconds()
+}
+
+// Print prints the report as a table
+func (r Report) Print(w io.Writer) {
+	fmt.Fprintf(w, "%d requests in %s, %.1f req/s, %d errors\n\n", r.Requests, r.Elapsed.Round(time.Millisecond), r.Throughput(), r.Errors)
+
+	fmt.Fprintf(w, "%-8s %9s %8s %10s", "kind", "requests", "errors", "throttled")
+	for _, p := range Percentiles {
+		fmt.Fprintf(w, " %9s", percentileName(p))
+	}
+	fmt.Fprintf(w, " %9s  %s\n", "max", "status codes")
+
+	for _, k := range r.Kinds {
+		fmt.Fprintf(w, "%-8s %9d %7.2f%% %10d", k.Kind, k.Requests, k.ErrorRate()*100, k.Throttled)
+		for _, p := range Percentiles {
+			fmt.Fprintf(w, " %9s", formatLatency(k.Latencies[percentileName(p)]))
+		}
+
+		codes := make([]int, 0, len(k.StatusCodes))
+		for c := range k.StatusCodes {
+			codes = append(codes, c)
+		}
+		sort.Ints(codes)
+
+		var cs []string
+		for _, c := range codes {
+			name := strconv.Itoa(c)
+			if c == 0 {
+				name = "failed"
+			}
+			cs = append(cs, fmt.Sprintf("%s:%d", name, k.StatusCodes[c]))
+		}
+
+		fmt.Fprintf(w, " %9s  %s\n", formatLatency(k.Max), strings.Join(cs, " "))
+	}
+}
+
+func percentileName(p float64) string {
+	return "p" + strconv.FormatFloat(p, 'f', -1, 64)
+}
+
+func formatLatency(d time.Duration) string {
+	return d.Round(time.Microsecond * 100).String()
+}
+
+// percentile returns the p-th percentile of sorted latencies, by the nearest-rank method
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	i := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+
+	return sorted[i]
+}
+
+// result is the outcome of one request
+type result struct {
+	kind       Kind
+	statusCode int
+	latency    time.Duration
+	err        error
+}
+
+// Runner runs a load test
+type Runner struct {
+	cfg    Config
+	client *http.Client
+
+	// skycoin addresses that were bound, used by status requests
+	sync.Mutex
+	bound []string
+}
+
+// NewRunner creates a Runner
+func NewRunner(cfg Config) (*Runner, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	cfg.Target = strings.TrimSuffix(cfg.Target, "/")
+
+	return &Runner{
+		cfg: cfg,
+		client: &http.Client{
+			Timeout: cfg.Timeout,
+			Transport: &http.Transport{
+				MaxIdleConnsPerHost: cfg.Concurrency,
+			},
+		},
+	}, nil
+}
+
+// Run sends the requests and returns the report. It stops early if quit is closed.
+func (r *Runner) Run(quit <-chan struct{}) Report {
+	start := time.Now()
+
+	var deadline <-chan time.Time
+	if r.cfg.Requests == 0 {
+		t := time.NewTimer(r.cfg.Duration)
+		defer t.Stop()
+		deadline = t.C
+	}
+
+	stop := make(chan struct{})
+	go func() {
+		select {
+		case <-quit:
+		case <-deadline:
+		case <-stop:
+			return
+		}
+		close(stop)
+	}()
+
+	// With a rate, each request waits for a tick
+	var ticks <-chan time.Time
+	if r.cfg.Rate > 0 {
+		t := time.NewTicker(time.Duration(float64(time.Second) / r.cfg.Rate))
+		defer t.Stop()
+		ticks = t.C
+	}
+
+	results := make(chan result, r.cfg.Concurrency)
+	var sent int64
+
+	var wg sync.WaitGroup
+	for i := 0; i < r.cfg.Concurrency; i++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			rnd := rand.New(rand.NewSource(seed))
+
+			for {
+				if r.cfg.Requests > 0 && atomic.AddInt64(&sent, 1) > int64(r.cfg.Requests) {
+					return
+				}
+
+				if ticks != nil {
+					select {
+					case <-stop:
+						return
+					case <-ticks:
+					}
+				}
+
+				select {
+				case <-stop:
+					return
+				default:
+				}
+
+				results <- r.do(r.cfg.Mix.pick(rnd))
+			}
+		}(time.Now().UnixNano() + int64(i))
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	latencies := make(map[Kind][]time.Duration)
+	reports := make(map[Kind]*KindReport)
+	for res := range results {
+		kr := reports[res.kind]
+		if kr == nil {
+			kr = &KindReport{
+				Kind:        res.kind,
+				StatusCodes: make(map[int]int),
+			}
+			reports[res.kind] = kr
+		}
+
+		kr.Requests++
+		kr.StatusCodes[res.statusCode]++
+		if res.err != nil {
+			kr.Errors++
+		}
+		if res.statusCode == http.StatusTooManyRequests {
+			kr.Throttled++
+		}
+
+		latencies[res.kind] = append(latencies[res.kind], res.latency)
+	}
+
+	select {
+	case <-stop:
+	default:
+		close(stop)
+	}
+
+	rep := Report{
+		Elapsed: time.Since(start),
+	}
+
+	for _, k := range Kinds {
+		kr := reports[k]
+		if kr == nil {
+			continue
+		}
+
+		ls := latencies[k]
+		sort.Slice(ls, func(i, j int) bool {
+			return ls[i] < ls[j]
+		})
+
+		kr.Latencies = make(map[string]time.Duration, len(Percentiles))
+		for _, p := range Percentiles {
+			kr.Latencies[percentileName(p)] = percentile(ls, p)
+		}
+		kr.Max = ls[len(ls)-1]
+
+		rep.Requests += kr.Requests
+		rep.Errors += kr.Errors
+		rep.Kinds = append(rep.Kinds, *kr)
+	}
+
+	return rep
+}
+
+// do sends a request of kind k
+func (r *Runner) do(k Kind) result {
+	var req *http.Request
+	var skyAddr string
+	var err error
+
+	switch k {
+	case KindBind:
+		skyAddr = newSkyAddress()
+		var body []byte
+		body, err = json.Marshal(struct {
+			SkyAddr  string `json:"skyaddr"`
+			CoinType string `json:"coin_type"`
+		}{
+			SkyAddr:  skyAddr,
+			CoinType: r.cfg.CoinType,
+		})
+		if err == nil {
+			req, err = http.NewRequest(http.MethodPost, r.cfg.Target+"/api/bind", bytes.NewReader(body))
+		}
+		if err == nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+	case KindStatus:
+		req, err = http.NewRequest(http.MethodGet, r.cfg.Target+"/api/status?skyaddr="+url.QueryEscape(r.statusAddress()), nil)
+	case KindConfig:
+		req, err = http.NewRequest(http.MethodGet, r.cfg.Target+"/api/config", nil)
+	}
+
+	res := result{
+		kind: k,
+	}
+
+	if err != nil {
+		res.err = err
+		return res
+	}
+
+	start := time.Now()
+	rsp, err := r.client.Do(req)
+	if err != nil {
+		res.latency = time.Since(start)
+		res.err = err
+		return res
+	}
+
+	// Read the whole body, so that the latency includes the response and the connection is reused
+	_, err = io.Copy(ioutil.Discard, rsp.Body)
+	rsp.Body.Close()
+	res.latency = time.Since(start)
+	res.statusCode = rsp.StatusCode
+
+	switch {
+	case err != nil:
+		res.err = err
+	case rsp.StatusCode < 200 || rsp.StatusCode > 299:
+		res.err = fmt.Errorf("%s responded with status %d", k, rsp.StatusCode)
+	case k == KindBind:
+		r.Lock()
+		r.bound = append(r.bound, skyAddr)
+		r.Unlock()
+	}
+
+	return res
+}
+
+// statusAddress returns a bound skycoin address, or a new one if none was bound yet
+func (r *Runner) statusAddress() string {
+	r.Lock()
+	defer r.Unlock()
+
+	if len(r.bound) == 0 {
+		return newSkyAddress()
+	}
+
+	return r.bound[rand.Intn(len(r.bound))]
+}
+
+// newSkyAddress returns a valid skycoin address of a new key pair
+func newSkyAddress() string {
+	pub, _ := cipher.GenerateKeyPair()
+	return cipher.AddressFromPubKey(pub).String()
+}
@@ -0,0 +1,177 @@
+package loadtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/skycoin/src/cipher"
+)
+
+func TestParseMix(t *testing.T) {
+	m, err := ParseMix("bind=1, status=8,config=0")
+	require.NoError(t, err)
+	require.Equal(t, Mix{KindBind: 1, KindStatus: 8, KindConfig: 0}, m)
+
+	for _, s := range []string{"", "bind", "foo=1", "bind=-1", "bind=x", "bind=0"} {
+		_, err := ParseMix(s)
+		require.Error(t, err, s)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	require.Equal(t, time.Duration(0), percentile(nil, 50))
+
+	var ls []time.Duration
+	for i := 1; i <= 100; i++ {
+		ls = append(ls, time.Duration(i))
+	}
+
+	require.Equal(t, time.Duration(50), percentile(ls, 50))
+	require.Equal(t, time.Duration(99), percentile(ls, 99))
+	require.Equal(t, time.Duration(100), percentile(ls, 100))
+	require.Equal(t, time.Duration(1), percentile(ls[:1], 99))
+}
+
+func TestRunner(t *testing.T) {
+	var mu sync.Mutex
+	bound := make(map[string]bool)
+	var binds, statusUnbound int
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/bind", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			SkyAddr  string `json:"skyaddr"`
+			CoinType string `json:"coin_type"`
+		}
+		require.Equal(t, http.MethodPost, r.Method)
+		require.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		require.Equal(t, "BTC", req.CoinType)
+
+		_, err := cipher.DecodeBase58Address(req.SkyAddr)
+		require.NoError(t, err)
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		// Every other bind is rate limited
+		binds++
+		if binds%2 == 0 {
+			http.Error(w, "rate limited", http.StatusTooManyRequests)
+			return
+		}
+
+		bound[req.SkyAddr] = true
+		w.Write([]byte(`{"deposit_address":"1FeDtFhARLxjKUPPkQqEBL78tisenc9znS","coin_type":"BTC"}`)) // nolint: errcheck
+	})
+	mux.HandleFunc("/api/status", func(w http.ResponseWriter, r *http.Request) {
+		addr := r.URL.Query().Get("skyaddr")
+		_, err := cipher.DecodeBase58Address(addr)
+		require.NoError(t, err)
+
+		mu.Lock()
+		if !bound[addr] {
+			statusUnbound++
+		}
+		mu.Unlock()
+
+		w.Write([]byte(`{"statuses":[]}`)) // nolint: errcheck
+	})
+	mux.HandleFunc("/api/config", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	})
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	_, err := NewRunner(Config{
+		Target:      srv.URL,
+		Requests:    10,
+		Concurrency: 1,
+		Mix:         Mix{KindBind: 1},
+		Timeout:     time.Second,
+	})
+	require.Error(t, err)
+
+	r, err := NewRunner(Config{
+		Target:      srv.URL + "/",
+		Requests:    200,
+		Concurrency: 4,
+		Mix:         Mix{KindBind: 1, KindStatus: 2, KindConfig: 1},
+		CoinType:    "BTC",
+		Timeout:     time.Second,
+	})
+	require.NoError(t, err)
+
+	rep := r.Run(nil)
+	require.Equal(t, 200, rep.Requests)
+
+	kinds := make(map[Kind]KindReport)
+	for _, k := range rep.Kinds {
+		kinds[k.Kind] = k
+	}
+	require.Len(t, kinds, 3)
+
+	bind := kinds[KindBind]
+	require.True(t, bind.Requests > 0)
+	require.True(t, bind.Throttled > 0)
+	require.Equal(t, bind.Throttled, bind.Errors)
+	require.Equal(t, bind.Throttled, bind.StatusCodes[http.StatusTooManyRequests])
+	require.Equal(t, bind.Requests-bind.Throttled, bind.StatusCodes[http.StatusOK])
+
+	status := kinds[KindStatus]
+	require.Equal(t, 0, status.Errors)
+	require.Equal(t, status.Requests, status.StatusCodes[http.StatusOK])
+
+	cfg := kinds[KindConfig]
+	require.Equal(t, cfg.Requests, cfg.Errors)
+	require.Equal(t, 1.0, cfg.ErrorRate())
+
+	require.Equal(t, bind.Errors+cfg.Errors, rep.Errors)
+	require.Equal(t, 200, bind.Requests+status.Requests+cfg.Requests)
+
+	for _, k := range rep.Kinds {
+		require.Len(t, k.Latencies, len(Percentiles))
+		require.True(t, k.Latencies["p50"] <= k.Latencies["p99"])
+		require.True(t, k.Latencies["p99"] <= k.Max)
+	}
+
+	// Status requests look up bound addresses once there are some
+	mu.Lock()
+	require.True(t, statusUnbound < status.Requests)
+	mu.Unlock()
+
+	var b bytes.Buffer
+	rep.Print(&b)
+	require.Contains(t, b.String(), "200 requests")
+	require.Contains(t, b.String(), "429:")
+
+	// Runs for the duration if no request count is set, at most at the rate
+	r, err = NewRunner(Config{
+		Target:      srv.URL,
+		Duration:    time.Millisecond * 500,
+		Concurrency: 2,
+		Rate:        20,
+		Mix:         Mix{KindStatus: 1},
+		Timeout:     time.Second,
+	})
+	require.NoError(t, err)
+
+	rep = r.Run(nil)
+	require.True(t, rep.Requests > 0)
+	require.True(t, rep.Requests <= 11, rep.Requests)
+	require.True(t, rep.Elapsed >= time.Millisecond*500)
+
+	// Stops when quit is closed
+	quit := make(chan struct{})
+	close(quit)
+	rep = r.Run(quit)
+	require.True(t, rep.Elapsed < time.Millisecond*500)
+}
@@ -0,0 +1,110 @@
+package monitor
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/skycoin/teller/src/rbac"
+	"github.com/skycoin/teller/src/util/httputil"
+	"github.com/skycoin/teller/src/util/logger"
+)
+
+const authRealm = "teller admin"
+
+// requiredRoles are the requests that need another role than the default, keyed by "<method> <path>".
+// GET requests need rbac.RoleViewer by default, and other requests rbac.RoleOperator.
+var requiredRoles = map[string]rbac.Role{
+	// Exports include the addresses of all deposits
+	"GET /api/export": rbac.RoleOperator,
+
+	"POST /api/addresses":             rbac.RoleAdmin,
+	"GET /api/support_tokens":         rbac.RoleAdmin,
+	"POST /api/support_tokens":        rbac.RoleAdmin,
+	"POST /api/support_tokens/revoke": rbac.RoleAdmin,
+	"GET /api/support_tokens/audit":   rbac.RoleAdmin,
+	"GET /api/api_keys":               rbac.RoleAdmin,
+	"POST /api/api_keys":              rbac.RoleAdmin,
+	"POST /api/api_keys/revoke":       rbac.RoleAdmin,
+	"POST /api/campaigns":             rbac.RoleAdmin,
+	"POST /api/campaigns/update":      rbac.RoleAdmin,
+	"POST /api/campaigns/addresses":   rbac.RoleAdmin,
+	"POST /api/promo_codes":           rbac.RoleAdmin,
+	"POST /api/promo_codes/update":    rbac.RoleAdmin,
+
+	// Exports include the email addresses, erasures can't be undone
+	"GET /api/privacy/export": rbac.RoleAdmin,
+	"POST /api/privacy/erase": rbac.RoleAdmin,
+}
+
+// requiredRole returns the role a request needs
+func requiredRole(method, urlPath string) rbac.Role {
+	if method == http.MethodHead {
+		method = http.MethodGet
+	}
+
+	if r, ok := requiredRoles[method+" "+path.Clean(urlPath)]; ok {
+		return r
+	}
+
+	if method == http.MethodGet {
+		return rbac.RoleViewer
+	}
+	return rbac.RoleOperator
+}
+
+// authHandler authenticates the principal of each request with cfg.Auth, and authorizes the request
+// with the role of the principal, which is put in the request context. All requests are allowed if cfg.Auth is nil.
+func (m *Monitor) authHandler(hd http.Handler) http.Handler {
+	if m.cfg.Auth == nil {
+		return hd
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log := m.log.WithFields(logrus.Fields{
+			"method":     r.Method,
+			"remoteAddr": r.RemoteAddr,
+			"url":        r.URL.String(),
+		})
+
+		p, err := m.cfg.Auth.Authenticate(r)
+		if err != nil {
+			log.WithError(err).Warning("Admin API authentication failed")
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+authRealm+`"`)
+			httputil.ErrResponse(w, http.StatusUnauthorized)
+			return
+		}
+
+		role := requiredRole(r.Method, r.URL.Path)
+		if p.Role < role {
+			log.WithFields(logrus.Fields{
+				"principal":    p.Name,
+				"role":         p.Role.String(),
+				"requiredRole": role.String(),
+			}).Warning("Admin API request forbidden")
+			httputil.ErrResponse(w, http.StatusForbidden, fmt.Sprintf("%s role required", role))
+			return
+		}
+
+		hd.ServeHTTP(w, r.WithContext(rbac.WithPrincipal(r.Context(), p)))
+	})
+}
+
+// principalLogHandler adds the principal of the request, if it has one, to the request logger,
+// so that the admin actions are logged with the principal that made them
+func principalLogHandler(hd http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if p, ok := rbac.PrincipalFromContext(ctx); ok {
+			log := logger.FromContext(ctx).WithFields(logrus.Fields{
+				"principal": p.Name,
+				"role":      p.Role.String(),
+			})
+			r = r.WithContext(logger.WithContext(ctx, log))
+		}
+
+		hd.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,88 @@
+package monitor
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/rbac"
+	"github.com/skycoin/teller/src/util/logger"
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+func TestRequiredRole(t *testing.T) {
+	require.Equal(t, rbac.RoleViewer, requiredRole(http.MethodGet, "/api/deposit_status"))
+	require.Equal(t, rbac.RoleViewer, requiredRole(http.MethodHead, "/api/stats"))
+	require.Equal(t, rbac.RoleOperator, requiredRole(http.MethodPost, "/api/reprocess"))
+	require.Equal(t, rbac.RoleOperator, requiredRole(http.MethodGet, "/api/export"))
+	require.Equal(t, rbac.RoleViewer, requiredRole(http.MethodGet, "/api/addresses"))
+	require.Equal(t, rbac.RoleAdmin, requiredRole(http.MethodPost, "/api/addresses"))
+	require.Equal(t, rbac.RoleAdmin, requiredRole(http.MethodPost, "/api/campaigns/../addresses"))
+	require.Equal(t, rbac.RoleAdmin, requiredRole(http.MethodGet, "/api/api_keys"))
+	require.Equal(t, rbac.RoleAdmin, requiredRole(http.MethodGet, "/api/privacy/export"))
+	require.Equal(t, rbac.RoleAdmin, requiredRole(http.MethodPost, "/api/privacy/erase"))
+}
+
+func TestAuth(t *testing.T) {
+	auth, err := rbac.NewAuthenticator([]rbac.Principal{
+		{Name: "alice", Role: rbac.RoleViewer, Token: "viewer-token"},
+		{Name: "bob", Role: rbac.RoleOperator, Token: "operator-token"},
+		{Name: "carol", Role: rbac.RoleAdmin, Token: "admin-token"},
+	})
+	require.NoError(t, err)
+
+	log, hook := testutil.NewLogger(t)
+	m := New(log, Config{Auth: auth}, &dummyBtcAddrMgr{}, &dummyDepositStatusGetter{}, &dummyScanAddrs{})
+	m.Pauser = &dummyPauser{}
+
+	srv := httptest.NewServer(m.authHandler(m.setupMux()))
+	defer srv.Close()
+
+	do := func(method, path, token string) int {
+		var body io.Reader
+		if method == http.MethodPost {
+			body = strings.NewReader(url.Values{"reason": {"incident"}}.Encode())
+		}
+
+		req, err := http.NewRequest(method, srv.URL+path, body)
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		rsp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		rsp.Body.Close()
+		return rsp.StatusCode
+	}
+
+	require.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/api/pause", ""))
+	require.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/api/pause", "wrong-token"))
+
+	require.Equal(t, http.StatusOK, do(http.MethodGet, "/api/pause", "viewer-token"))
+	require.Equal(t, http.StatusForbidden, do(http.MethodPost, "/api/pause", "viewer-token"))
+	require.Equal(t, http.StatusForbidden, do(http.MethodGet, "/api/api_keys", "operator-token"))
+
+	hook.Reset()
+	require.Equal(t, http.StatusOK, do(http.MethodPost, "/api/pause", "operator-token"))
+
+	// The action is logged with the principal
+	var audited bool
+	for _, e := range hook.AllEntries() {
+		if _, ok := e.Data[logger.AuditField]; ok {
+			audited = true
+			require.Equal(t, "bob", e.Data["principal"])
+			require.Equal(t, "operator", e.Data["role"])
+		}
+	}
+	require.True(t, audited)
+
+	// The admin API keys are not served, but admins are allowed to request them
+	require.Equal(t, http.StatusNotFound, do(http.MethodGet, "/api/api_keys", "admin-token"))
+}
@@ -4,14 +4,35 @@ package monitor
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
+	"unicode"
 
 	"github.com/sirupsen/logrus"
 
+	"github.com/skycoin/teller/src/addrs"
+	"github.com/skycoin/teller/src/apikey"
+	"github.com/skycoin/teller/src/archive"
+	"github.com/skycoin/teller/src/campaign"
 	"github.com/skycoin/teller/src/exchange"
+	"github.com/skycoin/teller/src/ipfilter"
+	"github.com/skycoin/teller/src/privacy"
+	"github.com/skycoin/teller/src/promo"
+	"github.com/skycoin/teller/src/rbac"
+	"github.com/skycoin/teller/src/report"
+	"github.com/skycoin/teller/src/scanner"
+	"github.com/skycoin/teller/src/sender"
+	"github.com/skycoin/teller/src/settlement"
+	"github.com/skycoin/teller/src/support"
+	"github.com/skycoin/teller/src/teller"
+	"github.com/skycoin/teller/src/util/compact"
 	"github.com/skycoin/teller/src/util/httputil"
+	"github.com/skycoin/teller/src/util/listenutil"
 	"github.com/skycoin/teller/src/util/logger"
 )
 
@@ -24,6 +45,10 @@ const (
 	serverReadTimeout  = time.Second * 10
 	serverWriteTimeout = time.Second * 60
 	serverIdleTimeout  = time.Second * 120
+
+	// Number of intervals of /api/stats/series by default, and the limit
+	defaultStatsSeriesLength = 24
+	maxStatsSeriesLength     = 1000
 )
 
 // AddrManager interface provides apis to access resource of btc address
@@ -31,10 +56,17 @@ type AddrManager interface {
 	Remaining() uint64 // returns the rest number of btc address in the pool
 }
 
+// AddressAdder adds deposit addresses to the pool of a coin type at runtime, and reports the pool levels
+type AddressAdder interface {
+	AddAddresses(coinType string, addresses []string) (uint64, error)
+	Remaining() map[string]uint64
+}
+
 // DepositStatusGetter  interface provides api to access exchange resource
 type DepositStatusGetter interface {
-	GetDepositStatusDetail(flt exchange.DepositFilter) ([]exchange.DepositStatusDetail, error)
+	QueryDepositStatusDetail(q exchange.DepositQuery) ([]exchange.DepositStatusDetail, error)
 	GetDepositStats() (*exchange.DepositStats, error)
+	GetCampaignDepositStats(campaign string) (*exchange.DepositStats, error)
 }
 
 // ScanAddressGetter get scanning address interface
@@ -42,9 +74,149 @@ type ScanAddressGetter interface {
 	GetScanAddresses() ([]string, error)
 }
 
+// TopUpGetter provides the hot wallet top-up ledger
+type TopUpGetter interface {
+	GetTopUps() ([]sender.TopUp, error)
+}
+
+// BalanceGetter provides the last checked hot wallet balance
+type BalanceGetter interface {
+	Status() sender.BalanceStatus
+}
+
+// SettlementReporter provides partner settlements and their acknowledgement
+type SettlementReporter interface {
+	Settlements(flt settlement.Filter) ([]settlement.Settlement, error)
+	Ack(id string) error
+}
+
+// SupportTokenManager mints, revokes and audits support access tokens
+type SupportTokenManager interface {
+	Mint(skyAddr string, scopes []string, ttl time.Duration, issuedTo string, o support.Origin) (string, support.Token, error)
+	Revoke(id uint64, o support.Origin) error
+	Tokens() ([]support.Token, error)
+	Audit(tokenID uint64) ([]support.AuditEvent, error)
+}
+
+// APIKeyManager creates and revokes the API keys of integrators
+type APIKeyManager interface {
+	Create(name string, maxBound int) (string, apikey.Key, error)
+	Revoke(id string) error
+	Keys() ([]apikey.Key, error)
+}
+
+// IPBanner bans IPs from the public API
+type IPBanner interface {
+	Ban(cidr string, d time.Duration, reason string) (ipfilter.Ban, error)
+	Unban(cidr string) error
+	Bans() []ipfilter.Ban
+}
+
+// Rescanner rescans block ranges with the scanner of a coin type
+type Rescanner interface {
+	Rescan(coinType string, from, to int64) error
+	RescanStatus(coinType string) (*scanner.RescanStatus, error)
+}
+
+// PauseController pauses and resumes payouts
+type PauseController interface {
+	Pause(reason string) error
+	Resume() error
+	GetPauseState() exchange.PauseState
+}
+
+// MaintenanceController toggles maintenance mode of the public API
+type MaintenanceController interface {
+	SetMaintenance(enabled bool, message string) teller.MaintenanceState
+	GetMaintenanceState() teller.MaintenanceState
+}
+
+// LogLevelSetter changes the log level at runtime
+type LogLevelSetter interface {
+	GetLevel() logrus.Level
+	SetLevel(level logrus.Level) error
+}
+
+// DepositReprocessor resets failed deposits to be sent again
+type DepositReprocessor interface {
+	ReprocessDeposit(depositID, rate, reason, remoteAddr string) (exchange.DepositInfo, error)
+}
+
+// KYCReleaser releases deposits held for KYC
+type KYCReleaser interface {
+	ReleaseKYCDeposit(depositID, reason, remoteAddr string) (exchange.DepositInfo, error)
+}
+
+// DepositReviewer approves or rejects deposits held for review
+type DepositReviewer interface {
+	ApproveDeposit(depositID, reason, remoteAddr string) (exchange.DepositInfo, error)
+	RejectDeposit(depositID, reason, remoteAddr string) (exchange.DepositInfo, error)
+}
+
+// DepositAuditor provides the audit log of a deposit
+type DepositAuditor interface {
+	GetDepositAuditLog(depositID string) (exchange.DepositAuditLog, error)
+}
+
+// ReportManager generates and retrieves daily reconciliation reports
+type ReportManager interface {
+	Dates() ([]string, error)
+	Get(date, format string) ([]byte, error)
+	Generate(date time.Time) (report.Report, error)
+}
+
+// ArchiveReader reads the deposits archived out of the db
+type ArchiveReader interface {
+	Archives() ([]string, error)
+	GetDeposit(depositID string) (archive.Deposit, error)
+	GetSkyAddressDeposits(skyAddr string) ([]archive.Deposit, error)
+}
+
+// DBCompactor compacts the db into a file that is swapped in at the next start
+type DBCompactor interface {
+	Compact() (compact.Result, error)
+	Pending() (*compact.Result, error)
+}
+
+// DepositEventGetter provides the deposit event log
+type DepositEventGetter interface {
+	GetDepositEvents() ([]exchange.DepositEvent, error)
+}
+
+// CampaignManager creates and updates campaigns, and fills their address pools
+type CampaignManager interface {
+	Create(c campaign.Campaign) (campaign.Campaign, error)
+	Update(c campaign.Campaign) (campaign.Campaign, error)
+	Get(id string) (campaign.Campaign, error)
+	Campaigns() ([]campaign.Campaign, error)
+	AddAddresses(id, coinType string, addresses []string) (uint64, error)
+	Remaining(id string) map[string]uint64
+}
+
+// PromoCodeManager creates and updates promo codes
+type PromoCodeManager interface {
+	Create(c promo.Code) (promo.Code, error)
+	Update(c promo.Code) (promo.Code, error)
+	Get(code string) (promo.Code, error)
+	Codes() ([]promo.Code, error)
+}
+
+// PrivacyManager exports and erases the personal data of skycoin addresses
+type PrivacyManager interface {
+	Export(skyAddr string) (privacy.Export, error)
+	Erase(skyAddr string) (privacy.Erasure, error)
+}
+
 // Config configuration info for monitor service
 type Config struct {
 	Addr string
+	// Auth authenticates the principals of the admin API, whose roles authorize their requests.
+	// If nil, the admin API is open to anyone who can connect to Addr.
+	Auth *rbac.Authenticator
+	// TLS config of the admin listener, e.g. to verify client certificates. Plain HTTP is served if nil.
+	TLS *tls.Config
+	// ReadOnly refuses all requests but GET and HEAD requests, for teller started with a copy of the db
+	ReadOnly bool
 }
 
 // Monitor monitor service struct
@@ -53,9 +225,53 @@ type Monitor struct {
 	AddrManager
 	DepositStatusGetter
 	ScanAddressGetter
-	cfg  Config
-	ln   *http.Server
-	quit chan struct{}
+	// Addresses is optional, /api/addresses is not served if it is nil
+	Addresses AddressAdder
+	// TopUpGetter is optional, /api/topups is not served if it is nil
+	TopUpGetter TopUpGetter
+	// BalanceGetter is optional, /api/balance is not served if it is nil
+	BalanceGetter BalanceGetter
+	// Settlements is optional, /api/settlements is not served if it is nil
+	Settlements SettlementReporter
+	// SupportTokens is optional, /api/support_tokens is not served if it is nil
+	SupportTokens SupportTokenManager
+	// APIKeys is optional, /api/api_keys is not served if it is nil
+	APIKeys APIKeyManager
+	// IPBans is optional, /api/bans is not served if it is nil
+	IPBans IPBanner
+	// Rescanner is optional, /api/rescan is not served if it is nil
+	Rescanner Rescanner
+	// Pauser is optional, /api/pause and /api/resume are not served if it is nil
+	Pauser PauseController
+	// Maintenance is optional, /api/maintenance is not served if it is nil
+	Maintenance MaintenanceController
+	// LogLevel is optional, /api/log_level is not served if it is nil
+	LogLevel LogLevelSetter
+	// Reprocessor is optional, /api/reprocess is not served if it is nil
+	Reprocessor DepositReprocessor
+	// KYC is optional, /api/kyc/release is not served if it is nil
+	KYC KYCReleaser
+	// Reviewer is optional, /api/review/approve and /api/review/reject are not served if it is nil
+	Reviewer DepositReviewer
+	// Auditor is optional, /api/deposit_history is not served if it is nil
+	Auditor DepositAuditor
+	// Reports is optional, /api/reports is not served if it is nil
+	Reports ReportManager
+	// Archive is optional, /api/archives is not served if it is nil
+	Archive ArchiveReader
+	// Compactor is optional, /api/compact is not served if it is nil
+	Compactor DBCompactor
+	// Events is optional, /api/export and /api/stats/series are not served if it is nil
+	Events DepositEventGetter
+	// Campaigns is optional, /api/campaigns is not served if it is nil
+	Campaigns CampaignManager
+	// PromoCodes is optional, /api/promo_codes is not served if it is nil
+	PromoCodes PromoCodeManager
+	// Privacy is optional, /api/privacy/export and /api/privacy/erase are not served if it is nil
+	Privacy PrivacyManager
+	cfg     Config
+	ln      *http.Server
+	quit    chan struct{}
 }
 
 // New creates monitor service
@@ -80,13 +296,23 @@ func (m *Monitor) Run() error {
 
 	m.ln = &http.Server{
 		Addr:         m.cfg.Addr,
-		Handler:      mux,
+		Handler:      m.authHandler(mux),
 		ReadTimeout:  serverReadTimeout,
 		WriteTimeout: serverWriteTimeout,
 		IdleTimeout:  serverIdleTimeout,
 	}
 
-	if err := m.ln.ListenAndServe(); err != nil {
+	// The admin listener is passed to the new process of a zero-downtime upgrade
+	ln, err := listenutil.Listen(m.cfg.Addr, 0600)
+	if err != nil {
+		return err
+	}
+
+	if m.cfg.TLS != nil {
+		ln = tls.NewListener(ln, m.cfg.TLS)
+	}
+
+	if err := m.ln.Serve(ln); err != nil {
 		select {
 		case <-m.quit:
 			return nil
@@ -97,15 +323,146 @@ func (m *Monitor) Run() error {
 	return nil
 }
 
+// Handler returns the handler of the admin API, e.g. for the admin dashboard to serve it on another listener.
+// Requests are not authorized with cfg.Auth, the caller authenticates them and may put an rbac.Principal
+// in the request context for the logs.
+func (m *Monitor) Handler() http.Handler {
+	return m.setupMux()
+}
+
 func (m *Monitor) setupMux() *http.ServeMux {
 	mux := http.NewServeMux()
 
-	mux.Handle("/api/address", httputil.LogHandler(m.log, m.addressHandler()))
-	mux.Handle("/api/deposit_status", httputil.LogHandler(m.log, m.depositStatus()))
-	mux.Handle("/api/stats", httputil.LogHandler(m.log, m.statsHandler()))
+	handle := func(path string, hd http.Handler) {
+		mux.Handle(path, httputil.LogHandler(m.log, principalLogHandler(m.readOnlyHandler(hd))))
+	}
+
+	handle("/api/address", m.addressHandler())
+	handle("/api/deposit_status", m.depositStatus())
+	handle("/api/stats", m.statsHandler())
+
+	if m.Addresses != nil {
+		handle("/api/addresses", m.addressesHandler())
+	}
+
+	if m.TopUpGetter != nil {
+		handle("/api/topups", m.topUpsHandler())
+	}
+
+	if m.BalanceGetter != nil {
+		handle("/api/balance", m.balanceHandler())
+	}
+
+	if m.Settlements != nil {
+		handle("/api/settlements", m.settlementsHandler())
+		handle("/api/settlements/ack", m.ackSettlementHandler())
+	}
+
+	if m.SupportTokens != nil {
+		handle("/api/support_tokens", m.supportTokensHandler())
+		handle("/api/support_tokens/revoke", m.revokeSupportTokenHandler())
+		handle("/api/support_tokens/audit", m.supportAuditHandler())
+	}
+
+	if m.APIKeys != nil {
+		handle("/api/api_keys", m.apiKeysHandler())
+		handle("/api/api_keys/revoke", m.revokeAPIKeyHandler())
+	}
+
+	if m.IPBans != nil {
+		handle("/api/bans", m.bansHandler())
+		handle("/api/bans/remove", m.removeBanHandler())
+	}
+
+	if m.Rescanner != nil {
+		handle("/api/rescan", m.rescanHandler())
+	}
+
+	if m.Pauser != nil {
+		handle("/api/pause", m.pauseHandler())
+		handle("/api/resume", m.resumeHandler())
+	}
+
+	if m.Maintenance != nil {
+		handle("/api/maintenance", m.maintenanceHandler())
+	}
+
+	if m.LogLevel != nil {
+		handle("/api/log_level", m.logLevelHandler())
+	}
+
+	if m.Reprocessor != nil {
+		handle("/api/reprocess", m.reprocessHandler())
+	}
+
+	if m.KYC != nil {
+		handle("/api/kyc/release", m.kycReleaseHandler())
+	}
+
+	if m.Reviewer != nil {
+		handle("/api/review/approve", m.reviewHandler(true))
+		handle("/api/review/reject", m.reviewHandler(false))
+	}
+
+	if m.Auditor != nil {
+		handle("/api/deposit_history", m.depositHistoryHandler())
+	}
+
+	if m.Reports != nil {
+		handle("/api/reports", m.reportsHandler())
+		handle("/api/reports/get", m.reportHandler())
+		handle("/api/reports/generate", m.generateReportHandler())
+	}
+
+	if m.Archive != nil {
+		handle("/api/archives", m.archivesHandler())
+		handle("/api/archives/deposits", m.archivedDepositsHandler())
+	}
+
+	if m.Compactor != nil {
+		handle("/api/compact", m.compactHandler())
+	}
+
+	if m.Events != nil {
+		handle("/api/export", m.exportHandler())
+		handle("/api/stats/series", m.statsSeriesHandler())
+	}
+
+	if m.Campaigns != nil {
+		handle("/api/campaigns", m.campaignsHandler())
+		handle("/api/campaigns/update", m.updateCampaignHandler())
+		handle("/api/campaigns/addresses", m.campaignAddressesHandler())
+	}
+
+	if m.PromoCodes != nil {
+		handle("/api/promo_codes", m.promoCodesHandler())
+		handle("/api/promo_codes/update", m.updatePromoCodeHandler())
+	}
+
+	if m.Privacy != nil {
+		handle("/api/privacy/export", m.privacyExportHandler())
+		handle("/api/privacy/erase", m.privacyEraseHandler())
+	}
+
 	return mux
 }
 
+// readOnlyHandler responds to the requests that can change anything with a 503 error if cfg.ReadOnly is set
+func (m *Monitor) readOnlyHandler(hd http.Handler) http.Handler {
+	if !m.cfg.ReadOnly {
+		return hd
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			httputil.ErrResponse(w, http.StatusServiceUnavailable, "teller is read-only")
+			return
+		}
+
+		hd.ServeHTTP(w, r)
+	})
+}
+
 // Shutdown close the monitor service
 func (m *Monitor) Shutdown() {
 	log := m.log.WithField("timeout", shutdownTimeout)
@@ -160,11 +517,92 @@ func (m *Monitor) addressHandler() http.HandlerFunc {
 	}
 }
 
+// addressesHandler returns the deposit addresses left in the pool of each coin type,
+// or adds deposit addresses to the pool of a coin type
+// Method: GET, POST
+// URI: /api/addresses
+// Args (POST):
+//   - coin_type # optional, BTC, LTC or the symbol of an ERC20 token. Defaults to BTC
+//   - addresses # deposit addresses, separated by commas or whitespace
+func (m *Monitor) addressesHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := logger.FromContext(ctx)
+
+		switch r.Method {
+		case http.MethodGet:
+			if err := httputil.JSONResponse(w, struct {
+				Remaining map[string]uint64 `json:"remaining"`
+			}{
+				Remaining: m.Addresses.Remaining(),
+			}); err != nil {
+				log.WithError(err).Error("Write json response failed")
+			}
+			return
+		case http.MethodPost:
+		default:
+			w.Header().Set("Allow", strings.Join([]string{http.MethodGet, http.MethodPost}, ", "))
+			httputil.ErrResponse(w, http.StatusMethodNotAllowed)
+			return
+		}
+
+		coinType := r.FormValue("coin_type")
+		if coinType == "" {
+			coinType = scanner.CoinTypeBTC
+		}
+
+		addresses := strings.FieldsFunc(r.FormValue("addresses"), func(c rune) bool {
+			return c == ',' || unicode.IsSpace(c)
+		})
+		if len(addresses) == 0 {
+			httputil.ErrResponse(w, http.StatusBadRequest, "missing addresses")
+			return
+		}
+
+		remaining, err := m.Addresses.AddAddresses(coinType, addresses)
+		if err != nil {
+			switch err.(type) {
+			case addrs.DuplicateAddressErr, addrs.AddressConflictErr:
+				httputil.ErrResponse(w, http.StatusConflict, err.Error())
+				return
+			}
+
+			switch err {
+			case addrs.ErrCoinTypeNotRegistered:
+				httputil.ErrResponse(w, http.StatusNotFound, err.Error())
+				return
+			}
+
+			// Invalid addresses, or a pool that can't take addresses
+			httputil.ErrResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		logger.Audit(log).WithFields(logrus.Fields{
+			"coinType":  coinType,
+			"added":     len(addresses),
+			"remaining": remaining,
+		}).Info("Added deposit addresses")
+
+		if err := httputil.JSONResponse(w, struct {
+			Added     int    `json:"added"`
+			Remaining uint64 `json:"remaining"`
+		}{
+			Added:     len(addresses),
+			Remaining: remaining,
+		}); err != nil {
+			log.WithError(err).Error("Write json response failed")
+		}
+	}
+}
+
 // depositStatus returns all deposit status
 // Method: GET
 // URI: /api/deposit_status
 // Args:
-//     - status # available value("waiting_deposit", "waiting_send", "waiting_confirm", "done")
+//   - status # available value("waiting_deposit", "waiting_send", "waiting_confirm", "done")
+//   - campaign # optional, only returns the deposits of this campaign ID
+//   - promo_code # optional, only returns the deposits of the addresses bound with this promo code
 func (m *Monitor) depositStatus() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
@@ -176,14 +614,18 @@ func (m *Monitor) depositStatus() http.HandlerFunc {
 			return
 		}
 
+		campaignID := r.FormValue("campaign")
+		promoCode := promo.Normalize(r.FormValue("promo_code"))
+
 		status := r.FormValue("status")
 		if status == "" {
 			// returns all status
-			dpis, err := m.GetDepositStatusDetail(func(dpi exchange.DepositInfo) bool {
-				return true
+			dpis, err := m.QueryDepositStatusDetail(exchange.DepositQuery{
+				Campaign:  campaignID,
+				PromoCode: promoCode,
 			})
 			if err != nil {
-				log.WithError(err).Error("GetDepositStatusDetail failed")
+				log.WithError(err).Error("QueryDepositStatusDetail failed")
 				httputil.ErrResponse(w, http.StatusInternalServerError)
 				return
 			}
@@ -199,11 +641,13 @@ func (m *Monitor) depositStatus() http.HandlerFunc {
 			log.WithField("depositStatus", status).Error("Unknown status")
 			return
 		default:
-			dpis, err := m.GetDepositStatusDetail(func(dpi exchange.DepositInfo) bool {
-				return dpi.Status == st
+			dpis, err := m.QueryDepositStatusDetail(exchange.DepositQuery{
+				Statuses:  []exchange.Status{st},
+				Campaign:  campaignID,
+				PromoCode: promoCode,
 			})
 			if err != nil {
-				log.WithError(err).Error("GetDepositStatusDetail failed")
+				log.WithError(err).Error("QueryDepositStatusDetail failed")
 				httputil.ErrResponse(w, http.StatusInternalServerError)
 				return
 			}
@@ -216,6 +660,8 @@ func (m *Monitor) depositStatus() http.HandlerFunc {
 // stats returns all deposit stats, including total BTC received and total SKY sent.
 // Method: GET
 // URI: /api/stats
+// Args:
+//   - campaign # optional, only counts the deposits of this campaign ID
 func (m *Monitor) statsHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
@@ -227,7 +673,13 @@ func (m *Monitor) statsHandler() http.HandlerFunc {
 			return
 		}
 
-		ts, err := m.GetDepositStats()
+		var ts *exchange.DepositStats
+		var err error
+		if campaignID := r.FormValue("campaign"); campaignID != "" {
+			ts, err = m.GetCampaignDepositStats(campaignID)
+		} else {
+			ts, err = m.GetDepositStats()
+		}
 		if err != nil {
 			log.WithError(err).Error("GetDepositStats failed")
 			httputil.ErrResponse(w, http.StatusInternalServerError)
@@ -240,3 +692,1939 @@ func (m *Monitor) statsHandler() http.HandlerFunc {
 		}
 	}
 }
+
+// topUpsHandler returns the hot wallet top-up ledger
+// Method: GET
+// URI: /api/topups
+func (m *Monitor) topUpsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := logger.FromContext(ctx)
+
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			httputil.ErrResponse(w, http.StatusMethodNotAllowed)
+			return
+		}
+
+		topUps, err := m.TopUpGetter.GetTopUps()
+		if err != nil {
+			log.WithError(err).Error("GetTopUps failed")
+			httputil.ErrResponse(w, http.StatusInternalServerError)
+			return
+		}
+
+		if topUps == nil {
+			topUps = []sender.TopUp{}
+		}
+
+		if err := httputil.JSONResponse(w, topUps); err != nil {
+			log.WithError(err).Error("Write json response failed")
+			return
+		}
+	}
+}
+
+// balanceHandler returns the last checked hot wallet balance
+// Method: GET
+// URI: /api/balance
+func (m *Monitor) balanceHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := logger.FromContext(ctx)
+
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			httputil.ErrResponse(w, http.StatusMethodNotAllowed)
+			return
+		}
+
+		if err := httputil.JSONResponse(w, m.BalanceGetter.Status()); err != nil {
+			log.WithError(err).Error("Write json response failed")
+			return
+		}
+	}
+}
+
+// settlementsHandler returns partner settlements, oldest first
+// Method: GET
+// URI: /api/settlements
+// Args:
+//   - status # optional, "unacked" or "acked"
+func (m *Monitor) settlementsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := logger.FromContext(ctx)
+
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			httputil.ErrResponse(w, http.StatusMethodNotAllowed)
+			return
+		}
+
+		var flt settlement.Filter
+		switch status := r.FormValue("status"); status {
+		case "":
+			flt = func(settlement.Settlement) bool { return true }
+		case "unacked":
+			flt = func(s settlement.Settlement) bool { return !s.Acked() }
+		case "acked":
+			flt = func(s settlement.Settlement) bool { return s.Acked() }
+		default:
+			httputil.ErrResponse(w, http.StatusBadRequest, fmt.Sprintf("unknown status %v", status))
+			return
+		}
+
+		ss, err := m.Settlements.Settlements(flt)
+		if err != nil {
+			log.WithError(err).Error("Settlements.Settlements failed")
+			httputil.ErrResponse(w, http.StatusInternalServerError)
+			return
+		}
+
+		if ss == nil {
+			ss = []settlement.Settlement{}
+		}
+
+		if err := httputil.JSONResponse(w, ss); err != nil {
+			log.WithError(err).Error("Write json response failed")
+		}
+	}
+}
+
+// ackSettlementHandler acknowledges a settlement on behalf of the partner, e.g. after
+// it was reconciled by other means, so that it is not notified again
+// Method: POST
+// URI: /api/settlements/ack
+// Args:
+//   - id # the settlement ID
+func (m *Monitor) ackSettlementHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := logger.FromContext(ctx)
+
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			httputil.ErrResponse(w, http.StatusMethodNotAllowed)
+			return
+		}
+
+		id := r.FormValue("id")
+		if id == "" {
+			httputil.ErrResponse(w, http.StatusBadRequest, "missing id")
+			return
+		}
+
+		if err := m.Settlements.Ack(id); err != nil {
+			if err == settlement.ErrNotFound {
+				httputil.ErrResponse(w, http.StatusNotFound, err.Error())
+				return
+			}
+
+			log.WithError(err).Error("Settlements.Ack failed")
+			httputil.ErrResponse(w, http.StatusInternalServerError)
+			return
+		}
+
+		logger.Audit(log).WithField("settlementID", id).Info("Acknowledged settlement")
+
+		if err := httputil.JSONResponse(w, struct{}{}); err != nil {
+			log.WithError(err).Error("Write json response failed")
+		}
+	}
+}
+
+// mintSupportTokenResponse is the response of minting a support token
+type mintSupportTokenResponse struct {
+	Token     string        `json:"token"`
+	TokenInfo support.Token `json:"token_info"`
+}
+
+// supportTokensHandler lists support tokens, or mints a support token.
+// The minted token string is only returned once, it can't be recovered later.
+// Method: GET, POST
+// URI: /api/support_tokens
+// Args (POST):
+//   - skyaddr # the only skycoin address the token can look up
+//   - issued_to # who the token is handed to, e.g. a ticket number
+//   - scopes # optional, comma separated, defaults to "status"
+//   - ttl # optional, e.g. "2h", defaults to support_tokens.default_ttl
+func (m *Monitor) supportTokensHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := logger.FromContext(ctx)
+
+		switch r.Method {
+		case http.MethodGet:
+			ts, err := m.SupportTokens.Tokens()
+			if err != nil {
+				log.WithError(err).Error("SupportTokens.Tokens failed")
+				httputil.ErrResponse(w, http.StatusInternalServerError)
+				return
+			}
+
+			if ts == nil {
+				ts = []support.Token{}
+			}
+
+			if err := httputil.JSONResponse(w, ts); err != nil {
+				log.WithError(err).Error("Write json response failed")
+			}
+
+		case http.MethodPost:
+			scopes := []string{support.ScopeStatus}
+			if v := r.FormValue("scopes"); v != "" {
+				scopes = strings.Split(v, ",")
+			}
+
+			var ttl time.Duration
+			if v := r.FormValue("ttl"); v != "" {
+				var err error
+				ttl, err = time.ParseDuration(v)
+				if err != nil {
+					httputil.ErrResponse(w, http.StatusBadRequest, fmt.Sprintf("invalid ttl: %v", err))
+					return
+				}
+			}
+
+			token, t, err := m.SupportTokens.Mint(r.FormValue("skyaddr"), scopes, ttl, r.FormValue("issued_to"), support.Origin{
+				RemoteAddr: r.RemoteAddr,
+			})
+			if err != nil {
+				if _, ok := err.(support.MintError); ok {
+					httputil.ErrResponse(w, http.StatusBadRequest, err.Error())
+					return
+				}
+
+				log.WithError(err).Error("SupportTokens.Mint failed")
+				httputil.ErrResponse(w, http.StatusInternalServerError)
+				return
+			}
+
+			logger.Audit(log).WithField("supportToken", t).Info("Minted support token")
+
+			if err := httputil.JSONResponse(w, mintSupportTokenResponse{
+				Token:     token,
+				TokenInfo: t,
+			}); err != nil {
+				log.WithError(err).Error("Write json response failed")
+			}
+
+		default:
+			w.Header().Set("Allow", strings.Join([]string{http.MethodGet, http.MethodPost}, ", "))
+			httputil.ErrResponse(w, http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// revokeSupportTokenHandler revokes a support token
+// Method: POST
+// URI: /api/support_tokens/revoke
+// Args:
+//   - id # the token ID
+func (m *Monitor) revokeSupportTokenHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := logger.FromContext(ctx)
+
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			httputil.ErrResponse(w, http.StatusMethodNotAllowed)
+			return
+		}
+
+		id, err := strconv.ParseUint(r.FormValue("id"), 10, 64)
+		if err != nil {
+			httputil.ErrResponse(w, http.StatusBadRequest, "invalid id")
+			return
+		}
+
+		if err := m.SupportTokens.Revoke(id, support.Origin{
+			RemoteAddr: r.RemoteAddr,
+		}); err != nil {
+			if err == support.ErrTokenNotFound {
+				httputil.ErrResponse(w, http.StatusNotFound, err.Error())
+				return
+			}
+
+			log.WithError(err).Error("SupportTokens.Revoke failed")
+			httputil.ErrResponse(w, http.StatusInternalServerError)
+			return
+		}
+
+		logger.Audit(log).WithField("supportTokenID", id).Info("Revoked support token")
+
+		if err := httputil.JSONResponse(w, struct{}{}); err != nil {
+			log.WithError(err).Error("Write json response failed")
+		}
+	}
+}
+
+// createAPIKeyResponse is the response of creating an API key
+type createAPIKeyResponse struct {
+	Secret string     `json:"secret"`
+	Key    apikey.Key `json:"key"`
+}
+
+// apiKeysHandler lists the API keys of integrators, or creates one.
+// The secret of the created key is only returned once, it can't be recovered later.
+// Method: GET, POST
+// URI: /api/api_keys
+// Args (POST):
+//   - name # who the key is issued to
+//   - max_bound_addrs # optional, defaults to api_keys.max_bound_btc_addrs
+func (m *Monitor) apiKeysHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := logger.FromContext(ctx)
+
+		switch r.Method {
+		case http.MethodGet:
+			ks, err := m.APIKeys.Keys()
+			if err != nil {
+				log.WithError(err).Error("APIKeys.Keys failed")
+				httputil.ErrResponse(w, http.StatusInternalServerError)
+				return
+			}
+
+			if ks == nil {
+				ks = []apikey.Key{}
+			}
+
+			if err := httputil.JSONResponse(w, ks); err != nil {
+				log.WithError(err).Error("Write json response failed")
+			}
+
+		case http.MethodPost:
+			maxBound := -1
+			if v := r.FormValue("max_bound_addrs"); v != "" {
+				var err error
+				maxBound, err = strconv.Atoi(v)
+				if err != nil || maxBound < 0 {
+					httputil.ErrResponse(w, http.StatusBadRequest, "invalid max_bound_addrs")
+					return
+				}
+			}
+
+			secret, k, err := m.APIKeys.Create(r.FormValue("name"), maxBound)
+			if err != nil {
+				if err == apikey.ErrMissingName {
+					httputil.ErrResponse(w, http.StatusBadRequest, err.Error())
+					return
+				}
+
+				log.WithError(err).Error("APIKeys.Create failed")
+				httputil.ErrResponse(w, http.StatusInternalServerError)
+				return
+			}
+
+			logger.Audit(log).WithField("apiKey", k).Info("Created API key")
+
+			if err := httputil.JSONResponse(w, createAPIKeyResponse{
+				Secret: secret,
+				Key:    k,
+			}); err != nil {
+				log.WithError(err).Error("Write json response failed")
+			}
+
+		default:
+			w.Header().Set("Allow", strings.Join([]string{http.MethodGet, http.MethodPost}, ", "))
+			httputil.ErrResponse(w, http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// revokeAPIKeyHandler revokes an API key
+// Method: POST
+// URI: /api/api_keys/revoke
+// Args:
+//   - id # the key ID
+func (m *Monitor) revokeAPIKeyHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := logger.FromContext(ctx)
+
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			httputil.ErrResponse(w, http.StatusMethodNotAllowed)
+			return
+		}
+
+		id := r.FormValue("id")
+		if err := m.APIKeys.Revoke(id); err != nil {
+			if err == apikey.ErrKeyNotFound {
+				httputil.ErrResponse(w, http.StatusNotFound, err.Error())
+				return
+			}
+
+			log.WithError(err).Error("APIKeys.Revoke failed")
+			httputil.ErrResponse(w, http.StatusInternalServerError)
+			return
+		}
+
+		logger.Audit(log).WithField("apiKeyID", id).Info("Revoked API key")
+
+		if err := httputil.JSONResponse(w, struct{}{}); err != nil {
+			log.WithError(err).Error("Write json response failed")
+		}
+	}
+}
+
+// bansHandler lists the IP bans of the public API, or bans an IP or CIDR range.
+// Bans are kept in memory, they are lifted when they expire or teller restarts.
+// Method: GET, POST
+// URI: /api/bans
+// Args (POST):
+//   - ip # IP or CIDR range, e.g. 1.2.3.4 or 1.2.3.0/24
+//   - duration # how long the ban lasts, e.g. 24h
+//   - reason # optional, why the IP is banned
+func (m *Monitor) bansHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := logger.FromContext(ctx)
+
+		switch r.Method {
+		case http.MethodGet:
+			if err := httputil.JSONResponse(w, m.IPBans.Bans()); err != nil {
+				log.WithError(err).Error("Write json response failed")
+			}
+
+		case http.MethodPost:
+			ip := r.FormValue("ip")
+			if ip == "" {
+				httputil.ErrResponse(w, http.StatusBadRequest, "missing ip")
+				return
+			}
+
+			d, err := time.ParseDuration(r.FormValue("duration"))
+			if err != nil {
+				httputil.ErrResponse(w, http.StatusBadRequest, "invalid duration")
+				return
+			}
+
+			b, err := m.IPBans.Ban(ip, d, r.FormValue("reason"))
+			if err != nil {
+				httputil.ErrResponse(w, http.StatusBadRequest, err.Error())
+				return
+			}
+
+			logger.Audit(log).WithField("ban", b).Warning("Banned IP")
+
+			if err := httputil.JSONResponse(w, b); err != nil {
+				log.WithError(err).Error("Write json response failed")
+			}
+
+		default:
+			w.Header().Set("Allow", strings.Join([]string{http.MethodGet, http.MethodPost}, ", "))
+			httputil.ErrResponse(w, http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// removeBanHandler lifts an IP ban
+// Method: POST
+// URI: /api/bans/remove
+// Args:
+//   - ip # the banned IP or CIDR range
+func (m *Monitor) removeBanHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := logger.FromContext(ctx)
+
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			httputil.ErrResponse(w, http.StatusMethodNotAllowed)
+			return
+		}
+
+		ip := r.FormValue("ip")
+		if err := m.IPBans.Unban(ip); err != nil {
+			if err == ipfilter.ErrBanNotFound {
+				httputil.ErrResponse(w, http.StatusNotFound, err.Error())
+				return
+			}
+
+			httputil.ErrResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		logger.Audit(log).WithField("ip", ip).Info("Removed IP ban")
+
+		if err := httputil.JSONResponse(w, struct{}{}); err != nil {
+			log.WithError(err).Error("Write json response failed")
+		}
+	}
+}
+
+// supportAuditHandler returns the support token audit log, oldest first
+// Method: GET
+// URI: /api/support_tokens/audit
+// Args:
+//   - id # optional, only returns the events of this token ID
+func (m *Monitor) supportAuditHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := logger.FromContext(ctx)
+
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			httputil.ErrResponse(w, http.StatusMethodNotAllowed)
+			return
+		}
+
+		var id uint64
+		if v := r.FormValue("id"); v != "" {
+			var err error
+			id, err = strconv.ParseUint(v, 10, 64)
+			if err != nil || id == 0 {
+				httputil.ErrResponse(w, http.StatusBadRequest, "invalid id")
+				return
+			}
+		}
+
+		evs, err := m.SupportTokens.Audit(id)
+		if err != nil {
+			log.WithError(err).Error("SupportTokens.Audit failed")
+			httputil.ErrResponse(w, http.StatusInternalServerError)
+			return
+		}
+
+		if evs == nil {
+			evs = []support.AuditEvent{}
+		}
+
+		if err := httputil.JSONResponse(w, evs); err != nil {
+			log.WithError(err).Error("Write json response failed")
+		}
+	}
+}
+
+// rescanHandler starts a rescan of a block range for deposits to the current scan addresses,
+// or returns the progress of the last rescan. Deposits that were already found are not sent again.
+// Method: GET, POST
+// URI: /api/rescan
+// Args:
+//   - coin_type # the coin type of the scanner, e.g. BTC
+//   - from # (POST) first block height to rescan
+//   - to # (POST) last block height to rescan
+func (m *Monitor) rescanHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := logger.FromContext(ctx)
+
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			w.Header().Set("Allow", strings.Join([]string{http.MethodGet, http.MethodPost}, ", "))
+			httputil.ErrResponse(w, http.StatusMethodNotAllowed)
+			return
+		}
+
+		coinType := r.FormValue("coin_type")
+		if coinType == "" {
+			httputil.ErrResponse(w, http.StatusBadRequest, "missing coin_type")
+			return
+		}
+
+		log = log.WithField("coinType", coinType)
+
+		if r.Method == http.MethodPost {
+			from, err := strconv.ParseInt(r.FormValue("from"), 10, 64)
+			if err != nil {
+				httputil.ErrResponse(w, http.StatusBadRequest, "invalid from")
+				return
+			}
+
+			to, err := strconv.ParseInt(r.FormValue("to"), 10, 64)
+			if err != nil {
+				httputil.ErrResponse(w, http.StatusBadRequest, "invalid to")
+				return
+			}
+
+			if err := m.Rescanner.Rescan(coinType, from, to); err != nil {
+				switch err.(type) {
+				case scanner.InvalidRescanRangeErr:
+					httputil.ErrResponse(w, http.StatusBadRequest, err.Error())
+					return
+				}
+
+				switch err {
+				case scanner.ErrUnsupportedCoinType, scanner.ErrRescanNotSupported:
+					httputil.ErrResponse(w, http.StatusBadRequest, err.Error())
+				case scanner.ErrRescanInProgress:
+					httputil.ErrResponse(w, http.StatusConflict, err.Error())
+				default:
+					log.WithError(err).Error("Rescanner.Rescan failed")
+					httputil.ErrResponse(w, http.StatusInternalServerError)
+				}
+				return
+			}
+
+			logger.Audit(log).WithFields(logrus.Fields{
+				"from": from,
+				"to":   to,
+			}).Info("Started rescan")
+		}
+
+		st, err := m.Rescanner.RescanStatus(coinType)
+		if err != nil {
+			switch err {
+			case scanner.ErrUnsupportedCoinType, scanner.ErrRescanNotSupported:
+				httputil.ErrResponse(w, http.StatusBadRequest, err.Error())
+			default:
+				log.WithError(err).Error("Rescanner.RescanStatus failed")
+				httputil.ErrResponse(w, http.StatusInternalServerError)
+			}
+			return
+		}
+
+		if st == nil {
+			httputil.ErrResponse(w, http.StatusNotFound, "no rescan since teller started")
+			return
+		}
+
+		if err := httputil.JSONResponse(w, st); err != nil {
+			log.WithError(err).Error("Write json response failed")
+		}
+	}
+}
+
+// pauseHandler pauses payouts, or returns the operator's pause of payouts.
+// Deposits are still scanned and saved while paused, but no skycoins are sent until /api/resume.
+// Method: GET, POST
+// URI: /api/pause
+// Args:
+//   - reason # (POST) optional, why payouts are paused
+func (m *Monitor) pauseHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := logger.FromContext(ctx)
+
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			w.Header().Set("Allow", strings.Join([]string{http.MethodGet, http.MethodPost}, ", "))
+			httputil.ErrResponse(w, http.StatusMethodNotAllowed)
+			return
+		}
+
+		if r.Method == http.MethodPost {
+			reason := r.FormValue("reason")
+			if err := m.Pauser.Pause(reason); err != nil {
+				log.WithError(err).Error("Pauser.Pause failed")
+				httputil.ErrResponse(w, http.StatusInternalServerError)
+				return
+			}
+
+			logger.Audit(log).WithField("reason", reason).Info("Paused payouts")
+		}
+
+		if err := httputil.JSONResponse(w, m.Pauser.GetPauseState()); err != nil {
+			log.WithError(err).Error("Write json response failed")
+		}
+	}
+}
+
+// resumeHandler resumes payouts paused by /api/pause
+// Method: POST
+// URI: /api/resume
+func (m *Monitor) resumeHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := logger.FromContext(ctx)
+
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			httputil.ErrResponse(w, http.StatusMethodNotAllowed)
+			return
+		}
+
+		if err := m.Pauser.Resume(); err != nil {
+			log.WithError(err).Error("Pauser.Resume failed")
+			httputil.ErrResponse(w, http.StatusInternalServerError)
+			return
+		}
+
+		logger.Audit(log).Info("Resumed payouts")
+
+		if err := httputil.JSONResponse(w, m.Pauser.GetPauseState()); err != nil {
+			log.WithError(err).Error("Write json response failed")
+		}
+	}
+}
+
+// maintenanceHandler enables or disables maintenance mode of the public API, or returns it.
+// In maintenance mode, public API requests get a 503 response, except /api/config.
+// Method: GET, POST
+// URI: /api/maintenance
+// Args:
+//   - enabled # (POST) required, true or false
+//   - message # (POST) optional, error message of the responses
+func (m *Monitor) maintenanceHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := logger.FromContext(ctx)
+
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			w.Header().Set("Allow", strings.Join([]string{http.MethodGet, http.MethodPost}, ", "))
+			httputil.ErrResponse(w, http.StatusMethodNotAllowed)
+			return
+		}
+
+		if r.Method == http.MethodGet {
+			if err := httputil.JSONResponse(w, m.Maintenance.GetMaintenanceState()); err != nil {
+				log.WithError(err).Error("Write json response failed")
+			}
+			return
+		}
+
+		enabled, err := strconv.ParseBool(r.FormValue("enabled"))
+		if err != nil {
+			httputil.ErrResponse(w, http.StatusBadRequest, "Invalid enabled")
+			return
+		}
+
+		ms := m.Maintenance.SetMaintenance(enabled, r.FormValue("message"))
+
+		logger.Audit(log).WithField("maintenance", ms).Info("Set maintenance mode")
+
+		if err := httputil.JSONResponse(w, ms); err != nil {
+			log.WithError(err).Error("Write json response failed")
+		}
+	}
+}
+
+// LogLevelResponse is the response of /api/log_level
+type LogLevelResponse struct {
+	Level string `json:"level"`
+}
+
+// logLevelHandler sets the log level, or returns it. The level is not saved, after a restart it is set by debug.
+// Method: GET, POST
+// URI: /api/log_level
+// Args:
+//   - level # (POST) required, debug, info or warn
+func (m *Monitor) logLevelHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := logger.FromContext(ctx)
+
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			w.Header().Set("Allow", strings.Join([]string{http.MethodGet, http.MethodPost}, ", "))
+			httputil.ErrResponse(w, http.StatusMethodNotAllowed)
+			return
+		}
+
+		if r.Method == http.MethodPost {
+			level, err := logrus.ParseLevel(r.FormValue("level"))
+			if err != nil {
+				httputil.ErrResponse(w, http.StatusBadRequest, "Invalid level")
+				return
+			}
+
+			if err := m.LogLevel.SetLevel(level); err != nil {
+				httputil.ErrResponse(w, http.StatusBadRequest, err.Error())
+				return
+			}
+
+			// Logged at warning level, so that it is logged with any level
+			logger.Audit(log).WithField("level", level.String()).Warn("Set log level")
+		}
+
+		if err := httputil.JSONResponse(w, LogLevelResponse{
+			Level: m.LogLevel.GetLevel().String(),
+		}); err != nil {
+			log.WithError(err).Error("Write json response failed")
+		}
+	}
+}
+
+// reprocessHandler resets a deposit that failed without sending skycoins to waiting_send,
+// and queues it to be sent again. The request is recorded in the deposit event log.
+// Method: POST
+// URI: /api/reprocess
+// Args:
+//   - deposit_id # the deposit ID, txid:n
+//   - rate # optional, replaces the deposit's conversion rate
+//   - reason # optional, why the deposit is reprocessed
+func (m *Monitor) reprocessHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := logger.FromContext(ctx)
+
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			httputil.ErrResponse(w, http.StatusMethodNotAllowed)
+			return
+		}
+
+		depositID := r.FormValue("deposit_id")
+		if depositID == "" {
+			httputil.ErrResponse(w, http.StatusBadRequest, "missing deposit_id")
+			return
+		}
+
+		rate := r.FormValue("rate")
+		if rate != "" {
+			if _, err := exchange.ParseRate(rate); err != nil {
+				httputil.ErrResponse(w, http.StatusBadRequest, fmt.Sprintf("invalid rate: %v", err))
+				return
+			}
+		}
+
+		log = log.WithField("depositID", depositID)
+
+		di, err := m.Reprocessor.ReprocessDeposit(depositID, rate, r.FormValue("reason"), r.RemoteAddr)
+		if err != nil {
+			switch err {
+			case exchange.ErrDepositNotFound:
+				httputil.ErrResponse(w, http.StatusNotFound, err.Error())
+			case exchange.ErrDepositNotReprocessable, exchange.ErrDepositQueued:
+				httputil.ErrResponse(w, http.StatusConflict, err.Error())
+			default:
+				log.WithError(err).Error("Reprocessor.ReprocessDeposit failed")
+				httputil.ErrResponse(w, http.StatusInternalServerError)
+			}
+			return
+		}
+
+		logger.Audit(log).Info("Reprocessed deposit")
+
+		if err := httputil.JSONResponse(w, exchange.NewDepositStatusDetail(di)); err != nil {
+			log.WithError(err).Error("Write json response failed")
+		}
+	}
+}
+
+// kycReleaseHandler releases a deposit held for KYC to waiting_send, and queues it to be sent.
+// The request is recorded in the deposit event log.
+// Method: POST
+// URI: /api/kyc/release
+// Args:
+//   - deposit_id # the deposit ID, txid:n
+//   - reason # optional, why the deposit is released
+func (m *Monitor) kycReleaseHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := logger.FromContext(ctx)
+
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			httputil.ErrResponse(w, http.StatusMethodNotAllowed)
+			return
+		}
+
+		depositID := r.FormValue("deposit_id")
+		if depositID == "" {
+			httputil.ErrResponse(w, http.StatusBadRequest, "missing deposit_id")
+			return
+		}
+
+		log = log.WithField("depositID", depositID)
+
+		di, err := m.KYC.ReleaseKYCDeposit(depositID, r.FormValue("reason"), r.RemoteAddr)
+		if err != nil {
+			switch err {
+			case exchange.ErrDepositNotFound:
+				httputil.ErrResponse(w, http.StatusNotFound, err.Error())
+			case exchange.ErrDepositNotPendingKYC, exchange.ErrDepositQueued:
+				httputil.ErrResponse(w, http.StatusConflict, err.Error())
+			default:
+				log.WithError(err).Error("KYC.ReleaseKYCDeposit failed")
+				httputil.ErrResponse(w, http.StatusInternalServerError)
+			}
+			return
+		}
+
+		logger.Audit(log).Info("Released deposit held for KYC")
+
+		if err := httputil.JSONResponse(w, exchange.NewDepositStatusDetail(di)); err != nil {
+			log.WithError(err).Error("Write json response failed")
+		}
+	}
+}
+
+// reviewHandler approves or rejects a deposit held for review. An approved deposit is set to waiting_send
+// and queued to be sent, a rejected deposit is set to rejected. The request is recorded in the deposit event log.
+// Method: POST
+// URI: /api/review/approve, /api/review/reject
+// Args:
+//   - deposit_id # the deposit ID, txid:n
+//   - reason # optional, why the deposit is approved or rejected
+func (m *Monitor) reviewHandler(approve bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := logger.FromContext(ctx)
+
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			httputil.ErrResponse(w, http.StatusMethodNotAllowed)
+			return
+		}
+
+		depositID := r.FormValue("deposit_id")
+		if depositID == "" {
+			httputil.ErrResponse(w, http.StatusBadRequest, "missing deposit_id")
+			return
+		}
+
+		log = log.WithFields(logrus.Fields{
+			"depositID": depositID,
+			"approve":   approve,
+		})
+
+		review := m.Reviewer.RejectDeposit
+		if approve {
+			review = m.Reviewer.ApproveDeposit
+		}
+
+		di, err := review(depositID, r.FormValue("reason"), r.RemoteAddr)
+		if err != nil {
+			switch err {
+			case exchange.ErrDepositNotFound:
+				httputil.ErrResponse(w, http.StatusNotFound, err.Error())
+			case exchange.ErrDepositNotHeldForReview, exchange.ErrDepositQueued:
+				httputil.ErrResponse(w, http.StatusConflict, err.Error())
+			default:
+				log.WithError(err).Error("Reviewer review failed")
+				httputil.ErrResponse(w, http.StatusInternalServerError)
+			}
+			return
+		}
+
+		if approve {
+			logger.Audit(log).Info("Approved deposit held for review")
+		} else {
+			logger.Audit(log).Info("Rejected deposit held for review")
+		}
+
+		if err := httputil.JSONResponse(w, exchange.NewDepositStatusDetail(di)); err != nil {
+			log.WithError(err).Error("Write json response failed")
+		}
+	}
+}
+
+// depositHistoryHandler returns the audit log of a deposit: every change of its status, rate, txid
+// and error, and the operator's reprocess requests
+// Method: GET
+// URI: /api/deposit_history
+// Args:
+//   - deposit_id # the deposit ID, txid:n
+func (m *Monitor) depositHistoryHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := logger.FromContext(ctx)
+
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			httputil.ErrResponse(w, http.StatusMethodNotAllowed)
+			return
+		}
+
+		depositID := r.URL.Query().Get("deposit_id")
+		if depositID == "" {
+			httputil.ErrResponse(w, http.StatusBadRequest, "missing deposit_id")
+			return
+		}
+
+		log = log.WithField("depositID", depositID)
+
+		al, err := m.Auditor.GetDepositAuditLog(depositID)
+		if err != nil {
+			switch err {
+			case exchange.ErrDepositNotFound:
+				httputil.ErrResponse(w, http.StatusNotFound, err.Error())
+			default:
+				log.WithError(err).Error("Auditor.GetDepositAuditLog failed")
+				httputil.ErrResponse(w, http.StatusInternalServerError)
+			}
+			return
+		}
+
+		if err := httputil.JSONResponse(w, al); err != nil {
+			log.WithError(err).Error("Write json response failed")
+		}
+	}
+}
+
+// reportsHandler returns the dates of the saved daily reports, oldest first
+// Method: GET
+// URI: /api/reports
+func (m *Monitor) reportsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := logger.FromContext(ctx)
+
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			httputil.ErrResponse(w, http.StatusMethodNotAllowed)
+			return
+		}
+
+		dates, err := m.Reports.Dates()
+		if err != nil {
+			log.WithError(err).Error("Reports.Dates failed")
+			httputil.ErrResponse(w, http.StatusInternalServerError)
+			return
+		}
+
+		if err := httputil.JSONResponse(w, dates); err != nil {
+			log.WithError(err).Error("Write json response failed")
+		}
+	}
+}
+
+// reportHandler returns a saved daily report
+// Method: GET
+// URI: /api/reports/get
+// Args:
+//   - date # the UTC day of the report, YYYY-MM-DD
+//   - format # optional, json (default) or csv
+func (m *Monitor) reportHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := logger.FromContext(ctx)
+
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			httputil.ErrResponse(w, http.StatusMethodNotAllowed)
+			return
+		}
+
+		date := r.FormValue("date")
+		if date == "" {
+			httputil.ErrResponse(w, http.StatusBadRequest, "missing date")
+			return
+		}
+
+		format := r.FormValue("format")
+		if format == "" {
+			format = report.FormatJSON
+		}
+
+		b, err := m.Reports.Get(date, format)
+		if err != nil {
+			switch err {
+			case report.ErrInvalidDate, report.ErrInvalidFormat:
+				httputil.ErrResponse(w, http.StatusBadRequest, err.Error())
+			case report.ErrNotFound:
+				httputil.ErrResponse(w, http.StatusNotFound, err.Error())
+			default:
+				log.WithError(err).Error("Reports.Get failed")
+				httputil.ErrResponse(w, http.StatusInternalServerError)
+			}
+			return
+		}
+
+		switch format {
+		case report.FormatCSV:
+			w.Header().Set("Content-Type", "text/csv")
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=teller-report-%s.csv", date))
+		default:
+			w.Header().Set("Content-Type", "application/json")
+		}
+
+		if _, err := w.Write(b); err != nil {
+			log.WithError(err).Error("Write response failed")
+		}
+	}
+}
+
+// generateReportHandler generates and saves the daily report of a day, replacing a previous report of the day.
+// The report of the current day only covers the day up to now.
+// Method: POST
+// URI: /api/reports/generate
+// Args:
+//   - date # the UTC day of the report, YYYY-MM-DD
+func (m *Monitor) generateReportHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := logger.FromContext(ctx)
+
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			httputil.ErrResponse(w, http.StatusMethodNotAllowed)
+			return
+		}
+
+		date, err := report.ParseDate(r.FormValue("date"))
+		if err != nil {
+			httputil.ErrResponse(w, http.StatusBadRequest, report.ErrInvalidDate.Error())
+			return
+		}
+
+		rpt, err := m.Reports.Generate(date)
+		if err != nil {
+			switch err {
+			case report.ErrFutureDate:
+				httputil.ErrResponse(w, http.StatusBadRequest, err.Error())
+			default:
+				log.WithError(err).Error("Reports.Generate failed")
+				httputil.ErrResponse(w, http.StatusInternalServerError)
+			}
+			return
+		}
+
+		logger.Audit(log).WithField("date", rpt.Date).Info("Generated report")
+
+		if err := httputil.JSONResponse(w, rpt); err != nil {
+			log.WithError(err).Error("Write json response failed")
+		}
+	}
+}
+
+// archivesHandler returns the names of the archives of the deposits removed from the db, oldest first
+// Method: GET
+// URI: /api/archives
+func (m *Monitor) archivesHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := logger.FromContext(ctx)
+
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			httputil.ErrResponse(w, http.StatusMethodNotAllowed)
+			return
+		}
+
+		names, err := m.Archive.Archives()
+		if err != nil {
+			log.WithError(err).Error("Archive.Archives failed")
+			httputil.ErrResponse(w, http.StatusInternalServerError)
+			return
+		}
+
+		if err := httputil.JSONResponse(w, names); err != nil {
+			log.WithError(err).Error("Write json response failed")
+		}
+	}
+}
+
+// archivedDepositsHandler returns archived deposits with their events, by deposit ID or by skycoin address.
+// A deposit is read from the archive the db says it was written to, the deposits of a skycoin address
+// are searched for in every archive.
+// Method: GET
+// URI: /api/archives/deposits
+// Args:
+//   - deposit_id # the deposit ID, txid:n, or
+//   - skyaddr # the skycoin address of the deposits
+func (m *Monitor) archivedDepositsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := logger.FromContext(ctx)
+
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			httputil.ErrResponse(w, http.StatusMethodNotAllowed)
+			return
+		}
+
+		depositID := r.FormValue("deposit_id")
+		skyAddr := r.FormValue("skyaddr")
+
+		var ds []archive.Deposit
+		switch {
+		case depositID != "" && skyAddr != "":
+			httputil.ErrResponse(w, http.StatusBadRequest, "deposit_id and skyaddr are exclusive")
+			return
+
+		case depositID != "":
+			log = log.WithField("depositID", depositID)
+
+			d, err := m.Archive.GetDeposit(depositID)
+			if err != nil {
+				switch err {
+				case archive.ErrNotFound:
+					httputil.ErrResponse(w, http.StatusNotFound, err.Error())
+				default:
+					log.WithError(err).Error("Archive.GetDeposit failed")
+					httputil.ErrResponse(w, http.StatusInternalServerError)
+				}
+				return
+			}
+
+			ds = []archive.Deposit{d}
+
+		case skyAddr != "":
+			log = log.WithField("skyAddr", skyAddr)
+
+			var err error
+			ds, err = m.Archive.GetSkyAddressDeposits(skyAddr)
+			if err != nil {
+				log.WithError(err).Error("Archive.GetSkyAddressDeposits failed")
+				httputil.ErrResponse(w, http.StatusInternalServerError)
+				return
+			}
+
+		default:
+			httputil.ErrResponse(w, http.StatusBadRequest, "missing deposit_id or skyaddr")
+			return
+		}
+
+		if err := httputil.JSONResponse(w, ds); err != nil {
+			log.WithError(err).Error("Write json response failed")
+		}
+	}
+}
+
+// compactHandler compacts the db into a new file, without stopping teller.
+// Bolt never shrinks the db file, the compacted file is swapped in at the next start of teller,
+// before anything writes to the db. GET returns the compaction waiting to be swapped in, null if there is none.
+// Method: GET, POST
+// URI: /api/compact
+func (m *Monitor) compactHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := logger.FromContext(ctx)
+
+		switch r.Method {
+		case http.MethodGet:
+			res, err := m.Compactor.Pending()
+			if err != nil {
+				log.WithError(err).Error("Compactor.Pending failed")
+				httputil.ErrResponse(w, http.StatusInternalServerError)
+				return
+			}
+
+			if err := httputil.JSONResponse(w, res); err != nil {
+				log.WithError(err).Error("Write json response failed")
+			}
+
+		case http.MethodPost:
+			res, err := m.Compactor.Compact()
+			if err != nil {
+				switch err {
+				case compact.ErrCompactionInProgress:
+					httputil.ErrResponse(w, http.StatusConflict, err.Error())
+				default:
+					log.WithError(err).Error("Compactor.Compact failed")
+					httputil.ErrResponse(w, http.StatusInternalServerError)
+				}
+				return
+			}
+
+			logger.Audit(log).WithFields(logrus.Fields{
+				"dbSize":        res.DBSize,
+				"compactedSize": res.CompactedSize,
+			}).Info("Compacted db")
+
+			if err := httputil.JSONResponse(w, res); err != nil {
+				log.WithError(err).Error("Write json response failed")
+			}
+
+		default:
+			w.Header().Set("Allow", strings.Join([]string{http.MethodGet, http.MethodPost}, ", "))
+			httputil.ErrResponse(w, http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// exportHandler streams every deposit in its current state, ordered by seq
+// Method: GET
+// URI: /api/export
+// Args:
+//   - format # optional, json (default) or csv
+func (m *Monitor) exportHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := logger.FromContext(ctx)
+
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			httputil.ErrResponse(w, http.StatusMethodNotAllowed)
+			return
+		}
+
+		format := r.FormValue("format")
+		switch format {
+		case "", report.FormatJSON:
+			format = report.FormatJSON
+		case report.FormatCSV:
+		default:
+			httputil.ErrResponse(w, http.StatusBadRequest, report.ErrInvalidFormat.Error())
+			return
+		}
+
+		events, err := m.Events.GetDepositEvents()
+		if err != nil {
+			log.WithError(err).Error("Events.GetDepositEvents failed")
+			httputil.ErrResponse(w, http.StatusInternalServerError)
+			return
+		}
+
+		ledger := report.Ledger(events)
+
+		switch format {
+		case report.FormatCSV:
+			w.Header().Set("Content-Type", "text/csv")
+		default:
+			w.Header().Set("Content-Type", "application/json")
+		}
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=teller-deposits.%s", format))
+
+		// The status is already sent, so a failure can only be logged
+		if err := report.WriteLedger(w, ledger, format); err != nil {
+			log.WithError(err).Error("report.WriteLedger failed")
+			return
+		}
+
+		logger.Audit(log).WithField("deposits", len(ledger)).Info("Exported deposits")
+	}
+}
+
+// statsSeriesHandler returns the totals and time series of the deposit pipeline over a time range, for dashboards
+// Method: GET
+// URI: /api/stats/series
+// Args:
+//   - interval # optional, hour (default) or day
+//   - from # optional, unix time of the start of the range, aligned down to the interval. Defaults to 24 intervals before to
+//   - to # optional, unix time of the end of the range, aligned up to the interval. Defaults to now
+func (m *Monitor) statsSeriesHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := logger.FromContext(ctx)
+
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			httputil.ErrResponse(w, http.StatusMethodNotAllowed)
+			return
+		}
+
+		interval := r.FormValue("interval")
+		if interval == "" {
+			interval = report.IntervalHour
+		}
+
+		d, err := report.ParseInterval(interval)
+		if err != nil {
+			httputil.ErrResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		to := time.Now()
+		if v := r.FormValue("to"); v != "" {
+			t, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				httputil.ErrResponse(w, http.StatusBadRequest, "invalid to")
+				return
+			}
+			to = time.Unix(t, 0)
+		}
+
+		from := to.Add(-d * defaultStatsSeriesLength)
+		if v := r.FormValue("from"); v != "" {
+			t, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				httputil.ErrResponse(w, http.StatusBadRequest, "invalid from")
+				return
+			}
+			from = time.Unix(t, 0)
+		}
+
+		if from.After(to) {
+			httputil.ErrResponse(w, http.StatusBadRequest, "from is after to")
+			return
+		}
+
+		if to.Sub(from)/d >= maxStatsSeriesLength {
+			httputil.ErrResponse(w, http.StatusBadRequest, fmt.Sprintf("range is too long, must be less than %d intervals", maxStatsSeriesLength))
+			return
+		}
+
+		events, err := m.Events.GetDepositEvents()
+		if err != nil {
+			log.WithError(err).Error("Events.GetDepositEvents failed")
+			httputil.ErrResponse(w, http.StatusInternalServerError)
+			return
+		}
+
+		if err := httputil.JSONResponse(w, report.GenerateStats(events, from, to, d)); err != nil {
+			log.WithError(err).Error("Write json response failed")
+		}
+	}
+}
+
+// CampaignStatus is a campaign with the deposit addresses left in its pools and its deposit stats
+type CampaignStatus struct {
+	campaign.Campaign
+	// Deposit addresses left in the pools of the campaign, by coin type
+	RemainingAddresses map[string]uint64      `json:"remaining_addresses"`
+	Stats              *exchange.DepositStats `json:"stats"`
+}
+
+func (m *Monitor) campaignStatus(c campaign.Campaign) (CampaignStatus, error) {
+	stats, err := m.GetCampaignDepositStats(c.ID)
+	if err != nil {
+		return CampaignStatus{}, err
+	}
+
+	return CampaignStatus{
+		Campaign:           c,
+		RemainingAddresses: m.Campaigns.Remaining(c.ID),
+		Stats:              stats,
+	}, nil
+}
+
+// parseCampaignRates parses campaign rates of the form "BTC:500,LTC:20"
+func parseCampaignRates(v string) (map[string]string, error) {
+	rates := make(map[string]string)
+	for _, r := range strings.Split(v, ",") {
+		r = strings.TrimSpace(r)
+		if r == "" {
+			continue
+		}
+
+		pts := strings.SplitN(r, ":", 2)
+		if len(pts) != 2 || pts[0] == "" || pts[1] == "" {
+			return nil, fmt.Errorf("invalid rate %q, must be <coin type>:<rate>", r)
+		}
+
+		rates[strings.TrimSpace(pts[0])] = strings.TrimSpace(pts[1])
+	}
+
+	return rates, nil
+}
+
+// campaignErrResponse writes the error response of a failed campaign change
+func campaignErrResponse(w http.ResponseWriter, log logrus.FieldLogger, err error) {
+	switch err {
+	case campaign.ErrNotFound:
+		httputil.ErrResponse(w, http.StatusNotFound, err.Error())
+	case campaign.ErrExists:
+		httputil.ErrResponse(w, http.StatusConflict, err.Error())
+	case campaign.ErrInvalidID,
+		campaign.ErrMissingName,
+		campaign.ErrInvalidRate,
+		campaign.ErrInvalidMaxSky,
+		scanner.ErrUnsupportedCoinType:
+		httputil.ErrResponse(w, http.StatusBadRequest, err.Error())
+	default:
+		log.WithError(err).Error("Campaign change failed")
+		httputil.ErrResponse(w, http.StatusInternalServerError)
+	}
+}
+
+// campaignsHandler lists the campaigns with their remaining addresses and deposit stats, or creates a campaign.
+// Campaigns are created without addresses, see /api/campaigns/addresses.
+// Method: GET, POST
+// URI: /api/campaigns
+// Args (GET):
+//   - id # optional, only returns this campaign
+//
+// Args (POST):
+//   - id # 1 to 64 lowercase letters, digits, - or _
+//   - name # display name of the campaign
+//   - enabled # optional, true or false, defaults to false
+//   - rates # optional, SKY per coin of the campaign, e.g. "BTC:500,LTC:20". Other coin types use the default rate.
+//   - max_sky # optional, maximum SKY sent for the campaign
+func (m *Monitor) campaignsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := logger.FromContext(ctx)
+
+		switch r.Method {
+		case http.MethodGet:
+			var cs []campaign.Campaign
+			if id := r.FormValue("id"); id != "" {
+				c, err := m.Campaigns.Get(id)
+				if err != nil {
+					if err == campaign.ErrNotFound {
+						httputil.ErrResponse(w, http.StatusNotFound, err.Error())
+						return
+					}
+
+					log.WithError(err).Error("Campaigns.Get failed")
+					httputil.ErrResponse(w, http.StatusInternalServerError)
+					return
+				}
+				cs = []campaign.Campaign{c}
+			} else {
+				var err error
+				cs, err = m.Campaigns.Campaigns()
+				if err != nil {
+					log.WithError(err).Error("Campaigns.Campaigns failed")
+					httputil.ErrResponse(w, http.StatusInternalServerError)
+					return
+				}
+			}
+
+			statuses := make([]CampaignStatus, 0, len(cs))
+			for _, c := range cs {
+				st, err := m.campaignStatus(c)
+				if err != nil {
+					log.WithError(err).Error("GetCampaignDepositStats failed")
+					httputil.ErrResponse(w, http.StatusInternalServerError)
+					return
+				}
+				statuses = append(statuses, st)
+			}
+
+			if err := httputil.JSONResponse(w, statuses); err != nil {
+				log.WithError(err).Error("Write json response failed")
+			}
+
+		case http.MethodPost:
+			c := campaign.Campaign{
+				ID:     r.FormValue("id"),
+				Name:   r.FormValue("name"),
+				MaxSky: r.FormValue("max_sky"),
+			}
+
+			if v := r.FormValue("enabled"); v != "" {
+				enabled, err := strconv.ParseBool(v)
+				if err != nil {
+					httputil.ErrResponse(w, http.StatusBadRequest, "Invalid enabled")
+					return
+				}
+				c.Enabled = enabled
+			}
+
+			rates, err := parseCampaignRates(r.FormValue("rates"))
+			if err != nil {
+				httputil.ErrResponse(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			c.Rates = rates
+
+			c, err = m.Campaigns.Create(c)
+			if err != nil {
+				campaignErrResponse(w, log, err)
+				return
+			}
+
+			logger.Audit(log).WithField("campaign", c).Info("Created campaign")
+
+			st, err := m.campaignStatus(c)
+			if err != nil {
+				log.WithError(err).Error("GetCampaignDepositStats failed")
+				httputil.ErrResponse(w, http.StatusInternalServerError)
+				return
+			}
+
+			if err := httputil.JSONResponse(w, st); err != nil {
+				log.WithError(err).Error("Write json response failed")
+			}
+
+		default:
+			w.Header().Set("Allow", strings.Join([]string{http.MethodGet, http.MethodPost}, ", "))
+			httputil.ErrResponse(w, http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// updateCampaignHandler updates a campaign. Only the given args are changed.
+// Method: POST
+// URI: /api/campaigns/update
+// Args:
+//   - id # the campaign ID
+//   - name # optional, display name of the campaign
+//   - enabled # optional, true or false
+//   - rates # optional, e.g. "BTC:500,LTC:20", replaces all rates. Empty to use the default rates.
+//   - max_sky # optional, maximum SKY sent for the campaign. Empty to remove the cap.
+func (m *Monitor) updateCampaignHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := logger.FromContext(ctx)
+
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			httputil.ErrResponse(w, http.StatusMethodNotAllowed)
+			return
+		}
+
+		if err := r.ParseForm(); err != nil {
+			httputil.ErrResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		c, err := m.Campaigns.Get(r.FormValue("id"))
+		if err != nil {
+			campaignErrResponse(w, log, err)
+			return
+		}
+
+		if _, ok := r.Form["name"]; ok {
+			c.Name = r.FormValue("name")
+		}
+
+		if _, ok := r.Form["enabled"]; ok {
+			enabled, err := strconv.ParseBool(r.FormValue("enabled"))
+			if err != nil {
+				httputil.ErrResponse(w, http.StatusBadRequest, "Invalid enabled")
+				return
+			}
+			c.Enabled = enabled
+		}
+
+		if _, ok := r.Form["rates"]; ok {
+			rates, err := parseCampaignRates(r.FormValue("rates"))
+			if err != nil {
+				httputil.ErrResponse(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			c.Rates = rates
+		}
+
+		if _, ok := r.Form["max_sky"]; ok {
+			c.MaxSky = r.FormValue("max_sky")
+		}
+
+		c, err = m.Campaigns.Update(c)
+		if err != nil {
+			campaignErrResponse(w, log, err)
+			return
+		}
+
+		logger.Audit(log).WithField("campaign", c).Info("Updated campaign")
+
+		st, err := m.campaignStatus(c)
+		if err != nil {
+			log.WithError(err).Error("GetCampaignDepositStats failed")
+			httputil.ErrResponse(w, http.StatusInternalServerError)
+			return
+		}
+
+		if err := httputil.JSONResponse(w, st); err != nil {
+			log.WithError(err).Error("Write json response failed")
+		}
+	}
+}
+
+// campaignAddressesHandler adds deposit addresses to the pool of a campaign.
+// Returns the number of addresses of the coin type left in the pool.
+// Method: POST
+// URI: /api/campaigns/addresses
+// Args:
+//   - id # the campaign ID
+//   - coin_type # "BTC", "LTC" or the symbol of an ERC20 token
+//   - addresses # deposit addresses separated by commas or whitespace
+func (m *Monitor) campaignAddressesHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := logger.FromContext(ctx)
+
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			httputil.ErrResponse(w, http.StatusMethodNotAllowed)
+			return
+		}
+
+		id := r.FormValue("id")
+		coinType := r.FormValue("coin_type")
+
+		addresses := strings.FieldsFunc(r.FormValue("addresses"), func(c rune) bool {
+			return c == ',' || unicode.IsSpace(c)
+		})
+		if len(addresses) == 0 {
+			httputil.ErrResponse(w, http.StatusBadRequest, "missing addresses")
+			return
+		}
+
+		remaining, err := m.Campaigns.AddAddresses(id, coinType, addresses)
+		if err != nil {
+			if err == campaign.ErrNotFound {
+				httputil.ErrResponse(w, http.StatusNotFound, err.Error())
+				return
+			}
+
+			// Invalid or duplicate addresses
+			httputil.ErrResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		logger.Audit(log).WithFields(logrus.Fields{
+			"campaignID": id,
+			"coinType":   coinType,
+			"added":      len(addresses),
+			"remaining":  remaining,
+		}).Info("Added campaign deposit addresses")
+
+		if err := httputil.JSONResponse(w, struct {
+			Remaining uint64 `json:"remaining"`
+		}{
+			Remaining: remaining,
+		}); err != nil {
+			log.WithError(err).Error("Write json response failed")
+		}
+	}
+}
+
+// promoCodeErrResponse writes the error response of a failed promo code change
+func promoCodeErrResponse(w http.ResponseWriter, log logrus.FieldLogger, err error) {
+	switch err {
+	case promo.ErrNotFound:
+		httputil.ErrResponse(w, http.StatusNotFound, err.Error())
+	case promo.ErrExists:
+		httputil.ErrResponse(w, http.StatusConflict, err.Error())
+	case promo.ErrInvalidCode,
+		promo.ErrInvalidBonus,
+		promo.ErrInvalidMaxUses:
+		httputil.ErrResponse(w, http.StatusBadRequest, err.Error())
+	default:
+		log.WithError(err).Error("Promo code change failed")
+		httputil.ErrResponse(w, http.StatusInternalServerError)
+	}
+}
+
+// parsePromoCodeForm sets the fields of c that are in the form of r
+func parsePromoCodeForm(r *http.Request, c *promo.Code) error {
+	if _, ok := r.Form["bonus_percent"]; ok {
+		c.BonusPercent = r.FormValue("bonus_percent")
+	}
+
+	if _, ok := r.Form["enabled"]; ok {
+		enabled, err := strconv.ParseBool(r.FormValue("enabled"))
+		if err != nil {
+			return errors.New("Invalid enabled")
+		}
+		c.Enabled = enabled
+	}
+
+	if v := r.FormValue("max_uses"); v != "" {
+		maxUses, err := strconv.Atoi(v)
+		if err != nil {
+			return errors.New("Invalid max_uses")
+		}
+		c.MaxUses = maxUses
+	}
+
+	if v := r.FormValue("expires_at"); v != "" {
+		expiresAt, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || expiresAt < 0 {
+			return errors.New("Invalid expires_at")
+		}
+		c.ExpiresAt = expiresAt
+	}
+
+	if _, ok := r.Form["note"]; ok {
+		c.Note = r.FormValue("note")
+	}
+
+	return nil
+}
+
+// promoCodesHandler lists the promo codes, or creates a promo code.
+// The deposits of the addresses bound with a code are listed by /api/deposit_status?promo_code=.
+// Method: GET, POST
+// URI: /api/promo_codes
+// Args (GET):
+//   - code # optional, only returns this code
+//
+// Args (POST):
+//   - code # 1 to 32 letters, digits, - or _, case insensitive
+//   - bonus_percent # bonus added to the rate of the deposits, e.g. "5" for 5%
+//   - enabled # optional, true or false, defaults to false
+//   - max_uses # optional, maximum number of deposit addresses bound with the code, 0 for no limit
+//   - expires_at # optional, unix time the code expires at, 0 if it does not expire
+//   - note # optional, e.g. the referrer the code is for
+func (m *Monitor) promoCodesHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := logger.FromContext(ctx)
+
+		switch r.Method {
+		case http.MethodGet:
+			var cs []promo.Code
+			if code := r.FormValue("code"); code != "" {
+				c, err := m.PromoCodes.Get(code)
+				if err != nil {
+					if err == promo.ErrNotFound {
+						httputil.ErrResponse(w, http.StatusNotFound, err.Error())
+						return
+					}
+
+					log.WithError(err).Error("PromoCodes.Get failed")
+					httputil.ErrResponse(w, http.StatusInternalServerError)
+					return
+				}
+				cs = []promo.Code{c}
+			} else {
+				var err error
+				cs, err = m.PromoCodes.Codes()
+				if err != nil {
+					log.WithError(err).Error("PromoCodes.Codes failed")
+					httputil.ErrResponse(w, http.StatusInternalServerError)
+					return
+				}
+			}
+
+			if cs == nil {
+				cs = []promo.Code{}
+			}
+
+			if err := httputil.JSONResponse(w, cs); err != nil {
+				log.WithError(err).Error("Write json response failed")
+			}
+
+		case http.MethodPost:
+			if err := r.ParseForm(); err != nil {
+				httputil.ErrResponse(w, http.StatusBadRequest, err.Error())
+				return
+			}
+
+			c := promo.Code{
+				Code: r.FormValue("code"),
+			}
+
+			if err := parsePromoCodeForm(r, &c); err != nil {
+				httputil.ErrResponse(w, http.StatusBadRequest, err.Error())
+				return
+			}
+
+			c, err := m.PromoCodes.Create(c)
+			if err != nil {
+				promoCodeErrResponse(w, log, err)
+				return
+			}
+
+			logger.Audit(log).WithField("promoCode", c).Info("Created promo code")
+
+			if err := httputil.JSONResponse(w, c); err != nil {
+				log.WithError(err).Error("Write json response failed")
+			}
+
+		default:
+			w.Header().Set("Allow", strings.Join([]string{http.MethodGet, http.MethodPost}, ", "))
+			httputil.ErrResponse(w, http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// updatePromoCodeHandler updates a promo code. Only the given args are changed.
+// The addresses bound with a code get no bonus for their deposits while it is disabled or expired.
+// Method: POST
+// URI: /api/promo_codes/update
+// Args:
+//   - code # the promo code
+//   - bonus_percent # optional, bonus added to the rate of the deposits
+//   - enabled # optional, true or false
+//   - max_uses # optional, 0 for no limit
+//   - expires_at # optional, unix time the code expires at, 0 if it does not expire
+//   - note # optional
+func (m *Monitor) updatePromoCodeHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := logger.FromContext(ctx)
+
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			httputil.ErrResponse(w, http.StatusMethodNotAllowed)
+			return
+		}
+
+		if err := r.ParseForm(); err != nil {
+			httputil.ErrResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		c, err := m.PromoCodes.Get(r.FormValue("code"))
+		if err != nil {
+			promoCodeErrResponse(w, log, err)
+			return
+		}
+
+		if err := parsePromoCodeForm(r, &c); err != nil {
+			httputil.ErrResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		c, err = m.PromoCodes.Update(c)
+		if err != nil {
+			promoCodeErrResponse(w, log, err)
+			return
+		}
+
+		logger.Audit(log).WithField("promoCode", c).Info("Updated promo code")
+
+		if err := httputil.JSONResponse(w, c); err != nil {
+			log.WithError(err).Error("Write json response failed")
+		}
+	}
+}
+
+// privacyExportHandler returns all that is kept about a skycoin address, for a data protection request:
+// its bindings, deposits, events, archived deposits, settlements, notification email addresses and support tokens
+// Method: GET
+// URI: /api/privacy/export
+// Args:
+//   - skyaddr # the skycoin address
+func (m *Monitor) privacyExportHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := logger.FromContext(ctx)
+
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			httputil.ErrResponse(w, http.StatusMethodNotAllowed)
+			return
+		}
+
+		skyAddr := r.FormValue("skyaddr")
+		if skyAddr == "" {
+			httputil.ErrResponse(w, http.StatusBadRequest, "missing skyaddr")
+			return
+		}
+
+		log = log.WithField("skyAddr", skyAddr)
+
+		e, err := m.Privacy.Export(skyAddr)
+		if err != nil {
+			switch err {
+			case privacy.ErrInvalidSkyAddress:
+				httputil.ErrResponse(w, http.StatusBadRequest, err.Error())
+			default:
+				log.WithError(err).Error("Privacy.Export failed")
+				httputil.ErrResponse(w, http.StatusInternalServerError)
+			}
+			return
+		}
+
+		logger.Audit(log).Info("Exported personal data")
+
+		if err := httputil.JSONResponse(w, e); err != nil {
+			log.WithError(err).Error("Write json response failed")
+		}
+	}
+}
+
+// privacyEraseHandler erases the personal data of a skycoin address, for a data protection request:
+// the email addresses notified of its deposits, and the remote addresses in the audit logs of its deposits
+// and support tokens. The bindings, deposits and sends are kept.
+// Method: POST
+// URI: /api/privacy/erase
+// Args:
+//   - skyaddr # the skycoin address
+func (m *Monitor) privacyEraseHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := logger.FromContext(ctx)
+
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			httputil.ErrResponse(w, http.StatusMethodNotAllowed)
+			return
+		}
+
+		skyAddr := r.FormValue("skyaddr")
+		if skyAddr == "" {
+			httputil.ErrResponse(w, http.StatusBadRequest, "missing skyaddr")
+			return
+		}
+
+		log = log.WithField("skyAddr", skyAddr)
+
+		e, err := m.Privacy.Erase(skyAddr)
+		if err != nil {
+			switch err {
+			case privacy.ErrInvalidSkyAddress:
+				httputil.ErrResponse(w, http.StatusBadRequest, err.Error())
+			default:
+				log.WithError(err).Error("Privacy.Erase failed")
+				httputil.ErrResponse(w, http.StatusInternalServerError)
+			}
+			return
+		}
+
+		logger.Audit(log).WithField("erasure", e).Info("Erased personal data")
+
+		if err := httputil.JSONResponse(w, e); err != nil {
+			log.WithError(err).Error("Write json response failed")
+		}
+	}
+}
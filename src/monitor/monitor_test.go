@@ -1,16 +1,38 @@
 package monitor
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/boltdb/bolt"
+	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/require"
 
+	"github.com/skycoin/teller/src/addrs"
+	"github.com/skycoin/teller/src/apikey"
+	"github.com/skycoin/teller/src/archive"
+	"github.com/skycoin/teller/src/campaign"
 	"github.com/skycoin/teller/src/exchange"
+	"github.com/skycoin/teller/src/ipfilter"
+	"github.com/skycoin/teller/src/privacy"
+	"github.com/skycoin/teller/src/promo"
+	"github.com/skycoin/teller/src/report"
 	"github.com/skycoin/teller/src/scanner"
+	"github.com/skycoin/teller/src/settlement"
+	"github.com/skycoin/teller/src/support"
+	"github.com/skycoin/teller/src/teller"
+	"github.com/skycoin/teller/src/util/compact"
+	"github.com/skycoin/teller/src/util/logger"
 	"github.com/skycoin/teller/src/util/testutil"
 )
 
@@ -26,10 +48,10 @@ type dummyDepositStatusGetter struct {
 	dpis []exchange.DepositInfo
 }
 
-func (dps dummyDepositStatusGetter) GetDepositStatusDetail(flt exchange.DepositFilter) ([]exchange.DepositStatusDetail, error) {
+func (dps dummyDepositStatusGetter) QueryDepositStatusDetail(q exchange.DepositQuery) ([]exchange.DepositStatusDetail, error) {
 	var ds []exchange.DepositStatusDetail
 	for _, dpi := range dps.dpis {
-		if flt(dpi) {
+		if q.Match(dpi) {
 			ds = append(ds, exchange.DepositStatusDetail{
 				Seq:            dpi.Seq,
 				DepositAddress: dpi.DepositAddress,
@@ -38,6 +60,8 @@ func (dps dummyDepositStatusGetter) GetDepositStatusDetail(flt exchange.DepositF
 				UpdatedAt:      dpi.UpdatedAt,
 				Txid:           dpi.Txid,
 				CoinType:       dpi.CoinType,
+				Campaign:       dpi.Campaign,
+				PromoCode:      dpi.PromoCode,
 			})
 		}
 	}
@@ -45,9 +69,24 @@ func (dps dummyDepositStatusGetter) GetDepositStatusDetail(flt exchange.DepositF
 }
 
 func (dps dummyDepositStatusGetter) GetDepositStats() (*exchange.DepositStats, error) {
+	return dps.depositStats(func(dpi exchange.DepositInfo) bool {
+		return true
+	})
+}
+
+func (dps dummyDepositStatusGetter) GetCampaignDepositStats(campaign string) (*exchange.DepositStats, error) {
+	return dps.depositStats(func(dpi exchange.DepositInfo) bool {
+		return dpi.Campaign == campaign
+	})
+}
+
+func (dps dummyDepositStatusGetter) depositStats(flt func(exchange.DepositInfo) bool) (*exchange.DepositStats, error) {
 	var totalBTCReceived int64
 	var totalSKYSent int64
 	for _, dpi := range dps.dpis {
+		if !flt(dpi) {
+			continue
+		}
 		if dpi.CoinType == scanner.CoinTypeBTC {
 			totalBTCReceived += dpi.DepositValue
 		}
@@ -99,7 +138,7 @@ func TestRunMonitor(t *testing.T) {
 	dummyDps := dummyDepositStatusGetter{dpis: dpis}
 
 	cfg := Config{
-		"localhost:7908",
+		Addr: "localhost:7908",
 	}
 
 	log, _ := testutil.NewLogger(t)
@@ -185,3 +224,1556 @@ func TestRunMonitor(t *testing.T) {
 		return
 	}
 }
+
+func TestSupportTokens(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	store, err := support.NewStore(db, support.Config{
+		DefaultTTL: time.Hour,
+		MaxTTL:     time.Hour * 24,
+	})
+	require.NoError(t, err)
+
+	log, _ := testutil.NewLogger(t)
+	m := New(log, Config{}, &dummyBtcAddrMgr{}, &dummyDepositStatusGetter{}, &dummyScanAddrs{})
+	m.SupportTokens = store
+
+	srv := httptest.NewServer(m.setupMux())
+	defer srv.Close()
+
+	mint := func(form url.Values) *http.Response {
+		rsp, err := http.PostForm(srv.URL+"/api/support_tokens", form)
+		require.NoError(t, err)
+		return rsp
+	}
+
+	skyAddr := "2Wbi4wvxC4fkTYMsS2f6HaFfW4pafDjXcQW"
+
+	rsp := mint(url.Values{"skyaddr": {skyAddr}, "issued_to": {"ticket 1"}, "ttl": {"48h"}})
+	rsp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, rsp.StatusCode)
+
+	rsp = mint(url.Values{"skyaddr": {skyAddr}, "issued_to": {"ticket 1"}, "ttl": {"2h"}})
+	require.Equal(t, http.StatusOK, rsp.StatusCode)
+	var minted mintSupportTokenResponse
+	require.NoError(t, json.NewDecoder(rsp.Body).Decode(&minted))
+	rsp.Body.Close()
+	require.NotEmpty(t, minted.Token)
+	require.Equal(t, uint64(1), minted.TokenInfo.ID)
+	require.Equal(t, []string{support.ScopeStatus}, minted.TokenInfo.Scopes)
+	require.Equal(t, int64(7200), minted.TokenInfo.ExpiresAt-minted.TokenInfo.CreatedAt)
+
+	_, err = store.Authorize(minted.Token, support.ScopeStatus, support.Origin{})
+	require.NoError(t, err)
+
+	rsp, err = http.PostForm(srv.URL+"/api/support_tokens/revoke", url.Values{"id": {"2"}})
+	require.NoError(t, err)
+	rsp.Body.Close()
+	require.Equal(t, http.StatusNotFound, rsp.StatusCode)
+
+	rsp, err = http.PostForm(srv.URL+"/api/support_tokens/revoke", url.Values{"id": {"1"}})
+	require.NoError(t, err)
+	rsp.Body.Close()
+	require.Equal(t, http.StatusOK, rsp.StatusCode)
+
+	rsp, err = http.Get(srv.URL + "/api/support_tokens")
+	require.NoError(t, err)
+	var ts []support.Token
+	require.NoError(t, json.NewDecoder(rsp.Body).Decode(&ts))
+	rsp.Body.Close()
+	require.Len(t, ts, 1)
+	require.NotEmpty(t, ts[0].RevokedAt)
+	require.Equal(t, uint64(1), ts[0].Uses)
+
+	rsp, err = http.Get(srv.URL + "/api/support_tokens/audit?id=1")
+	require.NoError(t, err)
+	var evs []support.AuditEvent
+	require.NoError(t, json.NewDecoder(rsp.Body).Decode(&evs))
+	rsp.Body.Close()
+	require.Len(t, evs, 3)
+	require.Equal(t, support.AuditMint, evs[0].Action)
+	require.NotEmpty(t, evs[0].RemoteAddr)
+	require.Equal(t, support.AuditUse, evs[1].Action)
+	require.Equal(t, support.AuditRevoke, evs[2].Action)
+}
+
+func TestAPIKeys(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	store, err := apikey.NewStore(db, apikey.Config{
+		MaxClockSkew:             time.Minute,
+		DefaultMaxBoundAddresses: 100,
+	})
+	require.NoError(t, err)
+
+	log, _ := testutil.NewLogger(t)
+	m := New(log, Config{}, &dummyBtcAddrMgr{}, &dummyDepositStatusGetter{}, &dummyScanAddrs{})
+	m.APIKeys = store
+
+	srv := httptest.NewServer(m.setupMux())
+	defer srv.Close()
+
+	create := func(form url.Values) *http.Response {
+		rsp, err := http.PostForm(srv.URL+"/api/api_keys", form)
+		require.NoError(t, err)
+		return rsp
+	}
+
+	for _, form := range []url.Values{
+		{},
+		{"name": {"exchange"}, "max_bound_addrs": {"-1"}},
+		{"name": {"exchange"}, "max_bound_addrs": {"x"}},
+	} {
+		rsp := create(form)
+		rsp.Body.Close()
+		require.Equal(t, http.StatusBadRequest, rsp.StatusCode)
+	}
+
+	rsp := create(url.Values{"name": {"exchange"}, "max_bound_addrs": {"1000"}})
+	require.Equal(t, http.StatusOK, rsp.StatusCode)
+	var created createAPIKeyResponse
+	require.NoError(t, json.NewDecoder(rsp.Body).Decode(&created))
+	rsp.Body.Close()
+	require.NotEmpty(t, created.Secret)
+	require.Equal(t, "exchange", created.Key.Name)
+	require.Equal(t, 1000, created.Key.MaxBoundAddresses)
+
+	rsp = create(url.Values{"name": {"wallet"}})
+	require.Equal(t, http.StatusOK, rsp.StatusCode)
+	var created2 createAPIKeyResponse
+	require.NoError(t, json.NewDecoder(rsp.Body).Decode(&created2))
+	rsp.Body.Close()
+	require.Equal(t, 100, created2.Key.MaxBoundAddresses)
+
+	ts := fmt.Sprint(time.Now().Unix())
+	_, err = store.Verify(created.Key.ID, ts, apikey.Sign(created.Secret, ts, http.MethodGet, "/", nil), http.MethodGet, "/", nil)
+	require.NoError(t, err)
+
+	rsp, err = http.PostForm(srv.URL+"/api/api_keys/revoke", url.Values{"id": {"x"}})
+	require.NoError(t, err)
+	rsp.Body.Close()
+	require.Equal(t, http.StatusNotFound, rsp.StatusCode)
+
+	rsp, err = http.PostForm(srv.URL+"/api/api_keys/revoke", url.Values{"id": {created.Key.ID}})
+	require.NoError(t, err)
+	rsp.Body.Close()
+	require.Equal(t, http.StatusOK, rsp.StatusCode)
+
+	rsp, err = http.Get(srv.URL + "/api/api_keys")
+	require.NoError(t, err)
+	body, err := ioutil.ReadAll(rsp.Body)
+	require.NoError(t, err)
+	rsp.Body.Close()
+	// Secrets are not listed
+	require.NotContains(t, string(body), created.Secret)
+
+	var ks []apikey.Key
+	require.NoError(t, json.Unmarshal(body, &ks))
+	require.Len(t, ks, 2)
+	for _, k := range ks {
+		require.Equal(t, k.ID == created.Key.ID, k.RevokedAt != 0)
+	}
+}
+
+func TestBans(t *testing.T) {
+	f, err := ipfilter.NewFilter(nil, nil)
+	require.NoError(t, err)
+
+	log, _ := testutil.NewLogger(t)
+	m := New(log, Config{}, &dummyBtcAddrMgr{}, &dummyDepositStatusGetter{}, &dummyScanAddrs{})
+	m.IPBans = f
+
+	srv := httptest.NewServer(m.setupMux())
+	defer srv.Close()
+
+	for _, form := range []url.Values{
+		{"duration": {"1h"}},
+		{"ip": {"1.2.3"}, "duration": {"1h"}},
+		{"ip": {"1.2.3.4"}},
+		{"ip": {"1.2.3.4"}, "duration": {"-1h"}},
+	} {
+		rsp, err := http.PostForm(srv.URL+"/api/bans", form)
+		require.NoError(t, err)
+		rsp.Body.Close()
+		require.Equal(t, http.StatusBadRequest, rsp.StatusCode)
+	}
+
+	rsp, err := http.PostForm(srv.URL+"/api/bans", url.Values{"ip": {"1.2.3.0/24"}, "duration": {"1h"}, "reason": {"scraping"}})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, rsp.StatusCode)
+	var b ipfilter.Ban
+	require.NoError(t, json.NewDecoder(rsp.Body).Decode(&b))
+	rsp.Body.Close()
+	require.Equal(t, "1.2.3.0/24", b.CIDR)
+	require.Equal(t, "scraping", b.Reason)
+	require.Equal(t, b.CreatedAt+3600, b.ExpiresAt)
+	require.True(t, f.Blocked("1.2.3.4"))
+
+	rsp, err = http.Get(srv.URL + "/api/bans")
+	require.NoError(t, err)
+	var bans []ipfilter.Ban
+	require.NoError(t, json.NewDecoder(rsp.Body).Decode(&bans))
+	rsp.Body.Close()
+	require.Equal(t, []ipfilter.Ban{b}, bans)
+
+	rsp, err = http.PostForm(srv.URL+"/api/bans/remove", url.Values{"ip": {"1.2.3.4"}})
+	require.NoError(t, err)
+	rsp.Body.Close()
+	require.Equal(t, http.StatusNotFound, rsp.StatusCode)
+
+	rsp, err = http.PostForm(srv.URL+"/api/bans/remove", url.Values{"ip": {"1.2.3.0/24"}})
+	require.NoError(t, err)
+	rsp.Body.Close()
+	require.Equal(t, http.StatusOK, rsp.StatusCode)
+	require.False(t, f.Blocked("1.2.3.4"))
+	require.Empty(t, f.Bans())
+}
+
+func TestSettlements(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	store, err := settlement.NewStore(db)
+	require.NoError(t, err)
+
+	require.NoError(t, db.Update(func(tx *bolt.Tx) error {
+		if err := settlement.PutTx(tx, settlement.Settlement{ID: "tx1:0", SettledAt: 1}); err != nil {
+			return err
+		}
+		return settlement.PutTx(tx, settlement.Settlement{ID: "tx2:0", SettledAt: 2})
+	}))
+	require.NoError(t, store.RecordAttempt("tx1:0", errors.New("no ack")))
+	require.NoError(t, store.RecordAttempt("tx2:0", nil))
+
+	log, _ := testutil.NewLogger(t)
+	m := New(log, Config{}, &dummyBtcAddrMgr{}, &dummyDepositStatusGetter{}, &dummyScanAddrs{})
+	m.Settlements = store
+
+	srv := httptest.NewServer(m.setupMux())
+	defer srv.Close()
+
+	get := func(status string) []settlement.Settlement {
+		rsp, err := http.Get(srv.URL + "/api/settlements?status=" + status)
+		require.NoError(t, err)
+		defer rsp.Body.Close()
+		require.Equal(t, http.StatusOK, rsp.StatusCode)
+
+		var ss []settlement.Settlement
+		require.NoError(t, json.NewDecoder(rsp.Body).Decode(&ss))
+		return ss
+	}
+
+	require.Len(t, get(""), 2)
+
+	ss := get("unacked")
+	require.Len(t, ss, 1)
+	require.Equal(t, "tx1:0", ss[0].ID)
+	require.Equal(t, "no ack", ss[0].LastError)
+
+	rsp, err := http.Get(srv.URL + "/api/settlements?status=foo")
+	require.NoError(t, err)
+	rsp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, rsp.StatusCode)
+
+	rsp, err = http.PostForm(srv.URL+"/api/settlements/ack", url.Values{"id": {"tx3:0"}})
+	require.NoError(t, err)
+	rsp.Body.Close()
+	require.Equal(t, http.StatusNotFound, rsp.StatusCode)
+
+	rsp, err = http.PostForm(srv.URL+"/api/settlements/ack", url.Values{"id": {"tx1:0"}})
+	require.NoError(t, err)
+	rsp.Body.Close()
+	require.Equal(t, http.StatusOK, rsp.StatusCode)
+
+	require.Empty(t, get("unacked"))
+
+	ss = get("acked")
+	require.Len(t, ss, 2)
+	require.Equal(t, settlement.AckedByAdmin, ss[0].AckedBy)
+	require.Equal(t, settlement.AckedByPartner, ss[1].AckedBy)
+}
+
+type dummyRescanner struct {
+	status *scanner.RescanStatus
+}
+
+func (d *dummyRescanner) Rescan(coinType string, from, to int64) error {
+	switch coinType {
+	case scanner.CoinTypeBTC:
+	case scanner.CoinTypeLTC:
+		return scanner.ErrRescanNotSupported
+	default:
+		return scanner.ErrUnsupportedCoinType
+	}
+
+	if d.status != nil && d.status.FinishedAt == 0 {
+		return scanner.ErrRescanInProgress
+	}
+
+	d.status = &scanner.RescanStatus{
+		From:      from,
+		To:        to,
+		Height:    from - 1,
+		StartedAt: 1,
+	}
+	return nil
+}
+
+func (d *dummyRescanner) RescanStatus(coinType string) (*scanner.RescanStatus, error) {
+	if coinType != scanner.CoinTypeBTC {
+		return nil, scanner.ErrUnsupportedCoinType
+	}
+	return d.status, nil
+}
+
+func TestRescan(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+	m := New(log, Config{}, &dummyBtcAddrMgr{}, &dummyDepositStatusGetter{}, &dummyScanAddrs{})
+	m.Rescanner = &dummyRescanner{}
+
+	srv := httptest.NewServer(m.setupMux())
+	defer srv.Close()
+
+	rsp, err := http.Get(srv.URL + "/api/rescan?coin_type=BTC")
+	require.NoError(t, err)
+	rsp.Body.Close()
+	require.Equal(t, http.StatusNotFound, rsp.StatusCode)
+
+	for _, tc := range []struct {
+		args url.Values
+		code int
+	}{
+		{url.Values{"from": {"1"}, "to": {"2"}}, http.StatusBadRequest},
+		{url.Values{"coin_type": {"BTC"}, "from": {"x"}, "to": {"2"}}, http.StatusBadRequest},
+		{url.Values{"coin_type": {"BTC"}, "from": {"1"}}, http.StatusBadRequest},
+		{url.Values{"coin_type": {"LTC"}, "from": {"1"}, "to": {"2"}}, http.StatusBadRequest},
+		{url.Values{"coin_type": {"ETH"}, "from": {"1"}, "to": {"2"}}, http.StatusBadRequest},
+		{url.Values{"coin_type": {"BTC"}, "from": {"100"}, "to": {"200"}}, http.StatusOK},
+		{url.Values{"coin_type": {"BTC"}, "from": {"100"}, "to": {"200"}}, http.StatusConflict},
+	} {
+		rsp, err := http.PostForm(srv.URL+"/api/rescan", tc.args)
+		require.NoError(t, err)
+		rsp.Body.Close()
+		require.Equal(t, tc.code, rsp.StatusCode, tc.args)
+	}
+
+	rsp, err = http.Get(srv.URL + "/api/rescan?coin_type=BTC")
+	require.NoError(t, err)
+	defer rsp.Body.Close()
+	require.Equal(t, http.StatusOK, rsp.StatusCode)
+
+	var st scanner.RescanStatus
+	require.NoError(t, json.NewDecoder(rsp.Body).Decode(&st))
+	require.Equal(t, scanner.RescanStatus{
+		From:      100,
+		To:        200,
+		Height:    99,
+		StartedAt: 1,
+	}, st)
+}
+
+type dummyPauser struct {
+	state exchange.PauseState
+}
+
+func (d *dummyPauser) Pause(reason string) error {
+	d.state = exchange.PauseState{
+		Paused:   true,
+		Reason:   reason,
+		PausedAt: 1,
+	}
+	return nil
+}
+
+func (d *dummyPauser) Resume() error {
+	d.state = exchange.PauseState{}
+	return nil
+}
+
+func (d *dummyPauser) GetPauseState() exchange.PauseState {
+	return d.state
+}
+
+func TestPauseResume(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+	m := New(log, Config{}, &dummyBtcAddrMgr{}, &dummyDepositStatusGetter{}, &dummyScanAddrs{})
+	m.Pauser = &dummyPauser{}
+
+	srv := httptest.NewServer(m.setupMux())
+	defer srv.Close()
+
+	decode := func(rsp *http.Response) exchange.PauseState {
+		defer rsp.Body.Close()
+		require.Equal(t, http.StatusOK, rsp.StatusCode)
+
+		var ps exchange.PauseState
+		require.NoError(t, json.NewDecoder(rsp.Body).Decode(&ps))
+		return ps
+	}
+
+	rsp, err := http.Get(srv.URL + "/api/pause")
+	require.NoError(t, err)
+	require.Equal(t, exchange.PauseState{}, decode(rsp))
+
+	rsp, err = http.PostForm(srv.URL+"/api/pause", url.Values{"reason": {"incident"}})
+	require.NoError(t, err)
+	require.Equal(t, exchange.PauseState{
+		Paused:   true,
+		Reason:   "incident",
+		PausedAt: 1,
+	}, decode(rsp))
+
+	rsp, err = http.Get(srv.URL + "/api/resume")
+	require.NoError(t, err)
+	rsp.Body.Close()
+	require.Equal(t, http.StatusMethodNotAllowed, rsp.StatusCode)
+
+	rsp, err = http.PostForm(srv.URL+"/api/resume", nil)
+	require.NoError(t, err)
+	require.Equal(t, exchange.PauseState{}, decode(rsp))
+}
+
+func TestReadOnly(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+	m := New(log, Config{ReadOnly: true}, &dummyBtcAddrMgr{}, &dummyDepositStatusGetter{}, &dummyScanAddrs{})
+	pauser := &dummyPauser{}
+	m.Pauser = pauser
+
+	srv := httptest.NewServer(m.setupMux())
+	defer srv.Close()
+
+	rsp, err := http.Get(srv.URL + "/api/pause")
+	require.NoError(t, err)
+	rsp.Body.Close()
+	require.Equal(t, http.StatusOK, rsp.StatusCode)
+
+	rsp, err = http.PostForm(srv.URL+"/api/pause", url.Values{"reason": {"incident"}})
+	require.NoError(t, err)
+	rsp.Body.Close()
+	require.Equal(t, http.StatusServiceUnavailable, rsp.StatusCode)
+
+	require.False(t, pauser.GetPauseState().Paused)
+}
+
+type dummyMaintenance struct {
+	state teller.MaintenanceState
+}
+
+func (d *dummyMaintenance) SetMaintenance(enabled bool, message string) teller.MaintenanceState {
+	d.state = teller.MaintenanceState{
+		Enabled: enabled,
+		Message: message,
+	}
+	return d.state
+}
+
+func (d *dummyMaintenance) GetMaintenanceState() teller.MaintenanceState {
+	return d.state
+}
+
+func TestMaintenance(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+	m := New(log, Config{}, &dummyBtcAddrMgr{}, &dummyDepositStatusGetter{}, &dummyScanAddrs{})
+	m.Maintenance = &dummyMaintenance{}
+
+	srv := httptest.NewServer(m.setupMux())
+	defer srv.Close()
+
+	decode := func(rsp *http.Response) teller.MaintenanceState {
+		defer rsp.Body.Close()
+		require.Equal(t, http.StatusOK, rsp.StatusCode)
+
+		var ms teller.MaintenanceState
+		require.NoError(t, json.NewDecoder(rsp.Body).Decode(&ms))
+		return ms
+	}
+
+	rsp, err := http.Get(srv.URL + "/api/maintenance")
+	require.NoError(t, err)
+	require.Equal(t, teller.MaintenanceState{}, decode(rsp))
+
+	rsp, err = http.PostForm(srv.URL+"/api/maintenance", url.Values{"enabled": {"x"}})
+	require.NoError(t, err)
+	rsp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, rsp.StatusCode)
+
+	rsp, err = http.PostForm(srv.URL+"/api/maintenance", url.Values{"enabled": {"true"}, "message": {"Upgrading"}})
+	require.NoError(t, err)
+	require.Equal(t, teller.MaintenanceState{
+		Enabled: true,
+		Message: "Upgrading",
+	}, decode(rsp))
+
+	rsp, err = http.Get(srv.URL + "/api/maintenance")
+	require.NoError(t, err)
+	require.True(t, decode(rsp).Enabled)
+
+	rsp, err = http.PostForm(srv.URL+"/api/maintenance", url.Values{"enabled": {"false"}})
+	require.NoError(t, err)
+	require.Equal(t, teller.MaintenanceState{}, decode(rsp))
+}
+
+func TestLogLevel(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+	m := New(log, Config{}, &dummyBtcAddrMgr{}, &dummyDepositStatusGetter{}, &dummyScanAddrs{})
+
+	rus := logrus.New()
+	rus.Level = logrus.InfoLevel
+	m.LogLevel = logger.NewLevelSetter(rus)
+
+	srv := httptest.NewServer(m.setupMux())
+	defer srv.Close()
+
+	decode := func(rsp *http.Response) LogLevelResponse {
+		defer rsp.Body.Close()
+		require.Equal(t, http.StatusOK, rsp.StatusCode)
+
+		var lr LogLevelResponse
+		require.NoError(t, json.NewDecoder(rsp.Body).Decode(&lr))
+		return lr
+	}
+
+	rsp, err := http.Get(srv.URL + "/api/log_level")
+	require.NoError(t, err)
+	require.Equal(t, LogLevelResponse{Level: "info"}, decode(rsp))
+
+	rsp, err = http.PostForm(srv.URL+"/api/log_level", url.Values{"level": {"verbose"}})
+	require.NoError(t, err)
+	rsp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, rsp.StatusCode)
+
+	rsp, err = http.PostForm(srv.URL+"/api/log_level", url.Values{"level": {"error"}})
+	require.NoError(t, err)
+	rsp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, rsp.StatusCode)
+	require.Equal(t, logrus.InfoLevel, rus.Level)
+
+	rsp, err = http.PostForm(srv.URL+"/api/log_level", url.Values{"level": {"debug"}})
+	require.NoError(t, err)
+	require.Equal(t, LogLevelResponse{Level: "debug"}, decode(rsp))
+	require.Equal(t, logrus.DebugLevel, rus.Level)
+
+	rsp, err = http.PostForm(srv.URL+"/api/log_level", url.Values{"level": {"warn"}})
+	require.NoError(t, err)
+	require.Equal(t, LogLevelResponse{Level: "warning"}, decode(rsp))
+
+	rsp, err = http.Get(srv.URL + "/api/log_level")
+	require.NoError(t, err)
+	require.Equal(t, LogLevelResponse{Level: "warning"}, decode(rsp))
+}
+
+type dummyReprocessor struct {
+	dis map[string]exchange.DepositInfo
+}
+
+func (d *dummyReprocessor) ReprocessDeposit(depositID, rate, reason, remoteAddr string) (exchange.DepositInfo, error) {
+	di, ok := d.dis[depositID]
+	if !ok {
+		return exchange.DepositInfo{}, exchange.ErrDepositNotFound
+	}
+
+	if di.Txid != "" || di.Error == "" {
+		return exchange.DepositInfo{}, exchange.ErrDepositNotReprocessable
+	}
+
+	di.Status = exchange.StatusWaitSend
+	di.Error = ""
+	if rate != "" {
+		di.ConversionRate = rate
+	}
+	d.dis[depositID] = di
+
+	return di, nil
+}
+
+func TestReprocess(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+	m := New(log, Config{}, &dummyBtcAddrMgr{}, &dummyDepositStatusGetter{}, &dummyScanAddrs{})
+	m.Reprocessor = &dummyReprocessor{
+		dis: map[string]exchange.DepositInfo{
+			"tx1:0": {DepositID: "tx1:0", Status: exchange.StatusDone, Error: "Skycoin send amount is 0", ConversionRate: "100"},
+			"tx2:0": {DepositID: "tx2:0", Status: exchange.StatusDone, Txid: "skytx"},
+		},
+	}
+
+	srv := httptest.NewServer(m.setupMux())
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		args url.Values
+		code int
+	}{
+		{url.Values{}, http.StatusBadRequest},
+		{url.Values{"deposit_id": {"tx1:0"}, "rate": {"-1"}}, http.StatusBadRequest},
+		{url.Values{"deposit_id": {"tx3:0"}}, http.StatusNotFound},
+		{url.Values{"deposit_id": {"tx2:0"}}, http.StatusConflict},
+	} {
+		rsp, err := http.PostForm(srv.URL+"/api/reprocess", tc.args)
+		require.NoError(t, err)
+		rsp.Body.Close()
+		require.Equal(t, tc.code, rsp.StatusCode, tc.args)
+	}
+
+	rsp, err := http.PostForm(srv.URL+"/api/reprocess", url.Values{"deposit_id": {"tx1:0"}, "rate": {"200"}})
+	require.NoError(t, err)
+	defer rsp.Body.Close()
+	require.Equal(t, http.StatusOK, rsp.StatusCode)
+
+	var ds exchange.DepositStatusDetail
+	require.NoError(t, json.NewDecoder(rsp.Body).Decode(&ds))
+	require.Equal(t, exchange.StatusWaitSend.String(), ds.Status)
+	require.Equal(t, "tx1:0", ds.DepositID)
+	require.Empty(t, ds.Error)
+}
+
+type dummyKYCReleaser struct {
+	dis map[string]exchange.DepositInfo
+}
+
+func (d *dummyKYCReleaser) ReleaseKYCDeposit(depositID, reason, remoteAddr string) (exchange.DepositInfo, error) {
+	di, ok := d.dis[depositID]
+	if !ok {
+		return exchange.DepositInfo{}, exchange.ErrDepositNotFound
+	}
+
+	if di.Status != exchange.StatusWaitKYC {
+		return exchange.DepositInfo{}, exchange.ErrDepositNotPendingKYC
+	}
+
+	di.Status = exchange.StatusWaitSend
+	d.dis[depositID] = di
+
+	return di, nil
+}
+
+func TestKYCRelease(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+	m := New(log, Config{}, &dummyBtcAddrMgr{}, &dummyDepositStatusGetter{}, &dummyScanAddrs{})
+	m.KYC = &dummyKYCReleaser{
+		dis: map[string]exchange.DepositInfo{
+			"tx1:0": {DepositID: "tx1:0", Status: exchange.StatusWaitKYC},
+			"tx2:0": {DepositID: "tx2:0", Status: exchange.StatusDone, Txid: "skytx"},
+		},
+	}
+
+	srv := httptest.NewServer(m.setupMux())
+	defer srv.Close()
+
+	rsp, err := http.Get(srv.URL + "/api/kyc/release?deposit_id=tx1:0")
+	require.NoError(t, err)
+	rsp.Body.Close()
+	require.Equal(t, http.StatusMethodNotAllowed, rsp.StatusCode)
+
+	for _, tc := range []struct {
+		args url.Values
+		code int
+	}{
+		{url.Values{}, http.StatusBadRequest},
+		{url.Values{"deposit_id": {"tx3:0"}}, http.StatusNotFound},
+		{url.Values{"deposit_id": {"tx2:0"}}, http.StatusConflict},
+	} {
+		rsp, err := http.PostForm(srv.URL+"/api/kyc/release", tc.args)
+		require.NoError(t, err)
+		rsp.Body.Close()
+		require.Equal(t, tc.code, rsp.StatusCode, tc.args)
+	}
+
+	rsp, err = http.PostForm(srv.URL+"/api/kyc/release", url.Values{"deposit_id": {"tx1:0"}, "reason": {"documents checked"}})
+	require.NoError(t, err)
+	defer rsp.Body.Close()
+	require.Equal(t, http.StatusOK, rsp.StatusCode)
+
+	var ds exchange.DepositStatusDetail
+	require.NoError(t, json.NewDecoder(rsp.Body).Decode(&ds))
+	require.Equal(t, exchange.StatusWaitSend.String(), ds.Status)
+	require.Equal(t, "tx1:0", ds.DepositID)
+}
+
+type dummyReviewer struct {
+	dis map[string]exchange.DepositInfo
+}
+
+func (d *dummyReviewer) review(depositID string, st exchange.Status) (exchange.DepositInfo, error) {
+	di, ok := d.dis[depositID]
+	if !ok {
+		return exchange.DepositInfo{}, exchange.ErrDepositNotFound
+	}
+
+	if di.Status != exchange.StatusHeldForReview {
+		return exchange.DepositInfo{}, exchange.ErrDepositNotHeldForReview
+	}
+
+	di.Status = st
+	d.dis[depositID] = di
+
+	return di, nil
+}
+
+func (d *dummyReviewer) ApproveDeposit(depositID, reason, remoteAddr string) (exchange.DepositInfo, error) {
+	return d.review(depositID, exchange.StatusWaitSend)
+}
+
+func (d *dummyReviewer) RejectDeposit(depositID, reason, remoteAddr string) (exchange.DepositInfo, error) {
+	return d.review(depositID, exchange.StatusRejected)
+}
+
+func TestReview(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+	m := New(log, Config{}, &dummyBtcAddrMgr{}, &dummyDepositStatusGetter{}, &dummyScanAddrs{})
+	m.Reviewer = &dummyReviewer{
+		dis: map[string]exchange.DepositInfo{
+			"tx1:0": {DepositID: "tx1:0", Status: exchange.StatusHeldForReview},
+			"tx2:0": {DepositID: "tx2:0", Status: exchange.StatusHeldForReview},
+			"tx3:0": {DepositID: "tx3:0", Status: exchange.StatusDone, Txid: "skytx"},
+		},
+	}
+
+	srv := httptest.NewServer(m.setupMux())
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		uri  string
+		args url.Values
+		code int
+	}{
+		{"/api/review/approve", url.Values{}, http.StatusBadRequest},
+		{"/api/review/approve", url.Values{"deposit_id": {"tx4:0"}}, http.StatusNotFound},
+		{"/api/review/reject", url.Values{"deposit_id": {"tx3:0"}}, http.StatusConflict},
+	} {
+		rsp, err := http.PostForm(srv.URL+tc.uri, tc.args)
+		require.NoError(t, err)
+		rsp.Body.Close()
+		require.Equal(t, tc.code, rsp.StatusCode, tc.args)
+	}
+
+	for _, tc := range []struct {
+		uri       string
+		depositID string
+		status    exchange.Status
+	}{
+		{"/api/review/approve", "tx1:0", exchange.StatusWaitSend},
+		{"/api/review/reject", "tx2:0", exchange.StatusRejected},
+	} {
+		rsp, err := http.PostForm(srv.URL+tc.uri, url.Values{"deposit_id": {tc.depositID}, "reason": {"checked"}})
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, rsp.StatusCode)
+
+		var ds exchange.DepositStatusDetail
+		require.NoError(t, json.NewDecoder(rsp.Body).Decode(&ds))
+		rsp.Body.Close()
+		require.Equal(t, tc.status.String(), ds.Status)
+		require.Equal(t, tc.depositID, ds.DepositID)
+	}
+}
+
+type dummyAuditor struct {
+	logs map[string]exchange.DepositAuditLog
+}
+
+func (d *dummyAuditor) GetDepositAuditLog(depositID string) (exchange.DepositAuditLog, error) {
+	al, ok := d.logs[depositID]
+	if !ok {
+		return exchange.DepositAuditLog{}, exchange.ErrDepositNotFound
+	}
+	return al, nil
+}
+
+func TestDepositHistory(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+	m := New(log, Config{}, &dummyBtcAddrMgr{}, &dummyDepositStatusGetter{}, &dummyScanAddrs{})
+	al := exchange.DepositAuditLog{
+		Deposit: exchange.DepositStatusDetail{DepositID: "tx1:0", Status: exchange.StatusDone.String(), Txid: "skytx"},
+		Events: []exchange.DepositAuditEvent{
+			{Seq: 1, Time: 1000, Type: exchange.EventDepositInfo, Status: exchange.StatusWaitSend.String()},
+			{Seq: 2, Time: 1010, Type: exchange.EventDepositInfo, Status: exchange.StatusDone.String(), Txid: "skytx"},
+		},
+	}
+	m.Auditor = &dummyAuditor{
+		logs: map[string]exchange.DepositAuditLog{
+			"tx1:0": al,
+		},
+	}
+
+	srv := httptest.NewServer(m.setupMux())
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		query string
+		code  int
+	}{
+		{"", http.StatusBadRequest},
+		{"?deposit_id=tx2:0", http.StatusNotFound},
+	} {
+		rsp, err := http.Get(srv.URL + "/api/deposit_history" + tc.query)
+		require.NoError(t, err)
+		rsp.Body.Close()
+		require.Equal(t, tc.code, rsp.StatusCode, tc.query)
+	}
+
+	rsp, err := http.PostForm(srv.URL+"/api/deposit_history", url.Values{"deposit_id": {"tx1:0"}})
+	require.NoError(t, err)
+	rsp.Body.Close()
+	require.Equal(t, http.StatusMethodNotAllowed, rsp.StatusCode)
+
+	rsp, err = http.Get(srv.URL + "/api/deposit_history?deposit_id=tx1:0")
+	require.NoError(t, err)
+	defer rsp.Body.Close()
+	require.Equal(t, http.StatusOK, rsp.StatusCode)
+
+	var got exchange.DepositAuditLog
+	require.NoError(t, json.NewDecoder(rsp.Body).Decode(&got))
+	require.Equal(t, al, got)
+}
+
+type dummyReports struct {
+	reports map[string]report.Report
+}
+
+func (d *dummyReports) Dates() ([]string, error) {
+	dates := []string{}
+	for date := range d.reports {
+		dates = append(dates, date)
+	}
+	return dates, nil
+}
+
+func (d *dummyReports) Get(date, format string) ([]byte, error) {
+	if _, err := report.ParseDate(date); err != nil {
+		return nil, report.ErrInvalidDate
+	}
+
+	r, ok := d.reports[date]
+	if !ok {
+		return nil, report.ErrNotFound
+	}
+
+	switch format {
+	case report.FormatJSON:
+		return json.Marshal(r)
+	case report.FormatCSV:
+		var b bytes.Buffer
+		err := r.WriteCSV(&b)
+		return b.Bytes(), err
+	default:
+		return nil, report.ErrInvalidFormat
+	}
+}
+
+func (d *dummyReports) Generate(date time.Time) (report.Report, error) {
+	if date.After(time.Now()) {
+		return report.Report{}, report.ErrFutureDate
+	}
+
+	r := report.Generate(nil, date)
+	d.reports[r.Date] = r
+	return r, nil
+}
+
+func TestReports(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+	m := New(log, Config{}, &dummyBtcAddrMgr{}, &dummyDepositStatusGetter{}, &dummyScanAddrs{})
+	m.Reports = &dummyReports{
+		reports: map[string]report.Report{},
+	}
+
+	srv := httptest.NewServer(m.setupMux())
+	defer srv.Close()
+
+	rsp, err := http.Get(srv.URL + "/api/reports/generate?date=2018-03-04")
+	require.NoError(t, err)
+	rsp.Body.Close()
+	require.Equal(t, http.StatusMethodNotAllowed, rsp.StatusCode)
+
+	for _, date := range []string{"", "2018-3-4", "2999-01-01"} {
+		rsp, err = http.PostForm(srv.URL+"/api/reports/generate", url.Values{"date": {date}})
+		require.NoError(t, err)
+		rsp.Body.Close()
+		require.Equal(t, http.StatusBadRequest, rsp.StatusCode, date)
+	}
+
+	rsp, err = http.PostForm(srv.URL+"/api/reports/generate", url.Values{"date": {"2018-03-04"}})
+	require.NoError(t, err)
+	var r report.Report
+	require.NoError(t, json.NewDecoder(rsp.Body).Decode(&r))
+	rsp.Body.Close()
+	require.Equal(t, http.StatusOK, rsp.StatusCode)
+	require.Equal(t, "2018-03-04", r.Date)
+
+	rsp, err = http.Get(srv.URL + "/api/reports")
+	require.NoError(t, err)
+	var dates []string
+	require.NoError(t, json.NewDecoder(rsp.Body).Decode(&dates))
+	rsp.Body.Close()
+	require.Equal(t, []string{"2018-03-04"}, dates)
+
+	for _, tc := range []struct {
+		query string
+		code  int
+	}{
+		{"", http.StatusBadRequest},
+		{"?date=../x", http.StatusBadRequest},
+		{"?date=2018-03-04&format=xml", http.StatusBadRequest},
+		{"?date=2018-03-05", http.StatusNotFound},
+	} {
+		rsp, err = http.Get(srv.URL + "/api/reports/get" + tc.query)
+		require.NoError(t, err)
+		rsp.Body.Close()
+		require.Equal(t, tc.code, rsp.StatusCode, tc.query)
+	}
+
+	rsp, err = http.Get(srv.URL + "/api/reports/get?date=2018-03-04")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, rsp.StatusCode)
+	require.Equal(t, "application/json", rsp.Header.Get("Content-Type"))
+	var r2 report.Report
+	require.NoError(t, json.NewDecoder(rsp.Body).Decode(&r2))
+	rsp.Body.Close()
+	require.Equal(t, r, r2)
+
+	rsp, err = http.Get(srv.URL + "/api/reports/get?date=2018-03-04&format=csv")
+	require.NoError(t, err)
+	defer rsp.Body.Close()
+	require.Equal(t, http.StatusOK, rsp.StatusCode)
+	require.Equal(t, "text/csv", rsp.Header.Get("Content-Type"))
+	b, err := ioutil.ReadAll(rsp.Body)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(string(b), "deposit_id,coin_type,"), string(b))
+}
+
+type dummyArchive struct {
+	deposits []archive.Deposit
+}
+
+func (d dummyArchive) Archives() ([]string, error) {
+	return []string{"deposits-20180304T100000Z.json.gz"}, nil
+}
+
+func (d dummyArchive) GetDeposit(depositID string) (archive.Deposit, error) {
+	for _, ad := range d.deposits {
+		if ad.DepositInfo.DepositID == depositID {
+			return ad, nil
+		}
+	}
+	return archive.Deposit{}, archive.ErrNotFound
+}
+
+func (d dummyArchive) GetSkyAddressDeposits(skyAddr string) ([]archive.Deposit, error) {
+	ds := []archive.Deposit{}
+	for _, ad := range d.deposits {
+		if ad.DepositInfo.SkyAddress == skyAddr {
+			ds = append(ds, ad)
+		}
+	}
+	return ds, nil
+}
+
+func TestArchives(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+	m := New(log, Config{}, &dummyBtcAddrMgr{}, &dummyDepositStatusGetter{}, &dummyScanAddrs{})
+
+	name := "deposits-20180304T100000Z.json.gz"
+	m.Archive = dummyArchive{
+		deposits: []archive.Deposit{
+			{
+				Archive: name,
+				ArchivedDeposit: exchange.ArchivedDeposit{
+					DepositInfo: exchange.DepositInfo{DepositID: "tx1:0", SkyAddress: "skyaddr1", Status: exchange.StatusDone},
+				},
+			},
+			{
+				Archive: name,
+				ArchivedDeposit: exchange.ArchivedDeposit{
+					DepositInfo: exchange.DepositInfo{DepositID: "tx2:0", SkyAddress: "skyaddr1", Status: exchange.StatusRejected},
+				},
+			},
+		},
+	}
+
+	srv := httptest.NewServer(m.setupMux())
+	defer srv.Close()
+
+	rsp, err := http.Get(srv.URL + "/api/archives")
+	require.NoError(t, err)
+	var names []string
+	require.NoError(t, json.NewDecoder(rsp.Body).Decode(&names))
+	rsp.Body.Close()
+	require.Equal(t, []string{name}, names)
+
+	for _, tc := range []struct {
+		query string
+		code  int
+	}{
+		{"", http.StatusBadRequest},
+		{"?deposit_id=tx1:0&skyaddr=skyaddr1", http.StatusBadRequest},
+		{"?deposit_id=tx3:0", http.StatusNotFound},
+	} {
+		rsp, err = http.Get(srv.URL + "/api/archives/deposits" + tc.query)
+		require.NoError(t, err)
+		rsp.Body.Close()
+		require.Equal(t, tc.code, rsp.StatusCode, tc.query)
+	}
+
+	rsp, err = http.Get(srv.URL + "/api/archives/deposits?deposit_id=tx2:0")
+	require.NoError(t, err)
+	var ds []archive.Deposit
+	require.NoError(t, json.NewDecoder(rsp.Body).Decode(&ds))
+	rsp.Body.Close()
+	require.Equal(t, http.StatusOK, rsp.StatusCode)
+	require.Len(t, ds, 1)
+	require.Equal(t, name, ds[0].Archive)
+	require.Equal(t, exchange.StatusRejected, ds[0].DepositInfo.Status)
+
+	rsp, err = http.Get(srv.URL + "/api/archives/deposits?skyaddr=skyaddr1")
+	require.NoError(t, err)
+	ds = nil
+	require.NoError(t, json.NewDecoder(rsp.Body).Decode(&ds))
+	rsp.Body.Close()
+	require.Len(t, ds, 2)
+}
+
+func TestCompact(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+	m := New(log, Config{}, &dummyBtcAddrMgr{}, &dummyDepositStatusGetter{}, &dummyScanAddrs{})
+
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+	defer os.Remove(compact.PendingPath(db.Path()))
+	defer os.Remove(db.Path() + ".compact.json")
+
+	m.Compactor = compact.NewCompactor(log, db)
+
+	srv := httptest.NewServer(m.setupMux())
+	defer srv.Close()
+
+	// Nothing is waiting to be swapped in
+	rsp, err := http.Get(srv.URL + "/api/compact")
+	require.NoError(t, err)
+	var pending *compact.Result
+	require.NoError(t, json.NewDecoder(rsp.Body).Decode(&pending))
+	rsp.Body.Close()
+	require.Nil(t, pending)
+
+	rsp, err = http.Post(srv.URL+"/api/compact", "", nil)
+	require.NoError(t, err)
+	var res compact.Result
+	require.NoError(t, json.NewDecoder(rsp.Body).Decode(&res))
+	rsp.Body.Close()
+	require.Equal(t, http.StatusOK, rsp.StatusCode)
+	require.NotZero(t, res.CompactedSize)
+
+	rsp, err = http.Get(srv.URL + "/api/compact")
+	require.NoError(t, err)
+	require.NoError(t, json.NewDecoder(rsp.Body).Decode(&pending))
+	rsp.Body.Close()
+	require.NotNil(t, pending)
+	require.Equal(t, res.TxID, pending.TxID)
+}
+
+type dummyEvents struct {
+	events []exchange.DepositEvent
+}
+
+func (d dummyEvents) GetDepositEvents() ([]exchange.DepositEvent, error) {
+	return d.events, nil
+}
+
+func TestExport(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+	m := New(log, Config{}, &dummyBtcAddrMgr{}, &dummyDepositStatusGetter{}, &dummyScanAddrs{})
+
+	di := exchange.DepositInfo{
+		Seq:            1,
+		DepositID:      "tx1:0",
+		CoinType:       "BTC",
+		SkyAddress:     "s1",
+		DepositAddress: "b1",
+		DepositValue:   100000,
+		ConversionRate: "500",
+		Status:         exchange.StatusWaitSend,
+	}
+	sent := di
+	sent.Status = exchange.StatusDone
+	sent.Txid = "skytx1"
+	sent.SkySent = 500e6
+	m.Events = dummyEvents{
+		events: []exchange.DepositEvent{
+			{Seq: 1, Time: 100, Type: exchange.EventDepositInfo, DepositInfo: &di},
+			{Seq: 2, Time: 200, Type: exchange.EventDepositInfo, DepositInfo: &sent},
+		},
+	}
+
+	srv := httptest.NewServer(m.setupMux())
+	defer srv.Close()
+
+	rsp, err := http.Get(srv.URL + "/api/export?format=xml")
+	require.NoError(t, err)
+	rsp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, rsp.StatusCode)
+
+	rsp, err = http.Get(srv.URL + "/api/export")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, rsp.StatusCode)
+	require.Equal(t, "application/json", rsp.Header.Get("Content-Type"))
+	var ledger []report.LedgerEntry
+	require.NoError(t, json.NewDecoder(rsp.Body).Decode(&ledger))
+	rsp.Body.Close()
+	require.Len(t, ledger, 1)
+	require.Equal(t, "tx1", ledger[0].DepositTxid)
+	require.Equal(t, "skytx1", ledger[0].Txid)
+	require.Equal(t, uint64(500e6), ledger[0].SkySent)
+	require.Equal(t, int64(100), ledger[0].ReceivedAt)
+	require.Equal(t, int64(200), ledger[0].SentAt)
+
+	rsp, err = http.Get(srv.URL + "/api/export?format=csv")
+	require.NoError(t, err)
+	defer rsp.Body.Close()
+	require.Equal(t, http.StatusOK, rsp.StatusCode)
+	require.Equal(t, "text/csv", rsp.Header.Get("Content-Type"))
+	b, err := ioutil.ReadAll(rsp.Body)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(string(b), "seq,deposit_id,"), string(b))
+	require.True(t, strings.Contains(string(b), "\n1,tx1:0,BTC,b1,s1,tx1,100000,500,500.000000,"), string(b))
+}
+
+func TestCampaigns(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	log, _ := testutil.NewLogger(t)
+
+	mgr, err := campaign.NewManager(log, db, nil, []string{scanner.CoinTypeBTC, scanner.CoinTypeLTC})
+	require.NoError(t, err)
+
+	m := New(log, Config{}, &dummyBtcAddrMgr{}, &dummyDepositStatusGetter{
+		dpis: []exchange.DepositInfo{
+			{Seq: 1, CoinType: scanner.CoinTypeBTC, DepositValue: 100000, SkySent: 600e6, Campaign: "spring"},
+			{Seq: 2, CoinType: scanner.CoinTypeBTC, DepositValue: 200000, SkySent: 1000e6},
+		},
+	}, &dummyScanAddrs{})
+	m.Campaigns = mgr
+
+	srv := httptest.NewServer(m.setupMux())
+	defer srv.Close()
+
+	post := func(path string, form url.Values) *http.Response {
+		rsp, err := http.PostForm(srv.URL+path, form)
+		require.NoError(t, err)
+		return rsp
+	}
+
+	for _, form := range []url.Values{
+		{"name": {"Spring"}},
+		{"id": {"spring"}},
+		{"id": {"spring"}, "name": {"Spring"}, "enabled": {"x"}},
+		{"id": {"spring"}, "name": {"Spring"}, "rates": {"BTC"}},
+		{"id": {"spring"}, "name": {"Spring"}, "rates": {"DOGE:1"}},
+		{"id": {"spring"}, "name": {"Spring"}, "max_sky": {"x"}},
+	} {
+		rsp := post("/api/campaigns", form)
+		rsp.Body.Close()
+		require.Equal(t, http.StatusBadRequest, rsp.StatusCode, form)
+	}
+
+	rsp := post("/api/campaigns", url.Values{
+		"id":      {"spring"},
+		"name":    {"Spring"},
+		"enabled": {"true"},
+		"rates":   {"BTC:600, LTC:30"},
+		"max_sky": {"1000"},
+	})
+	require.Equal(t, http.StatusOK, rsp.StatusCode)
+	var st CampaignStatus
+	require.NoError(t, json.NewDecoder(rsp.Body).Decode(&st))
+	rsp.Body.Close()
+	require.True(t, st.Enabled)
+	require.Equal(t, map[string]string{"BTC": "600", "LTC": "30"}, st.Rates)
+	require.Equal(t, "1000", st.MaxSky)
+	require.Equal(t, int64(600e6), st.Stats.TotalSKYSent)
+
+	rsp = post("/api/campaigns", url.Values{"id": {"spring"}, "name": {"Again"}})
+	rsp.Body.Close()
+	require.Equal(t, http.StatusConflict, rsp.StatusCode)
+
+	// Only the given args are updated
+	rsp = post("/api/campaigns/update", url.Values{"id": {"spring"}, "enabled": {"false"}, "max_sky": {""}})
+	require.Equal(t, http.StatusOK, rsp.StatusCode)
+	st = CampaignStatus{}
+	require.NoError(t, json.NewDecoder(rsp.Body).Decode(&st))
+	rsp.Body.Close()
+	require.False(t, st.Enabled)
+	require.Equal(t, "Spring", st.Name)
+	require.Equal(t, map[string]string{"BTC": "600", "LTC": "30"}, st.Rates)
+	require.Equal(t, "", st.MaxSky)
+
+	rsp = post("/api/campaigns/update", url.Values{"id": {"missing"}, "name": {"Missing"}})
+	rsp.Body.Close()
+	require.Equal(t, http.StatusNotFound, rsp.StatusCode)
+
+	rsp = post("/api/campaigns/addresses", url.Values{"id": {"spring"}, "coin_type": {"BTC"}})
+	rsp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, rsp.StatusCode)
+
+	rsp = post("/api/campaigns/addresses", url.Values{"id": {"missing"}, "coin_type": {"BTC"}, "addresses": {"1PZ63K3G4gZP6A6E2TTbBwxT5bFQGL2TLB"}})
+	rsp.Body.Close()
+	require.Equal(t, http.StatusNotFound, rsp.StatusCode)
+
+	rsp = post("/api/campaigns/addresses", url.Values{"id": {"spring"}, "coin_type": {"BTC"}, "addresses": {"bad"}})
+	rsp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, rsp.StatusCode)
+
+	rsp = post("/api/campaigns/addresses", url.Values{
+		"id":        {"spring"},
+		"coin_type": {"BTC"},
+		"addresses": {"1PZ63K3G4gZP6A6E2TTbBwxT5bFQGL2TLB,\n14FG8vQnmK6B7YbLSr6uC5wfGY78JFNCYg"},
+	})
+	require.Equal(t, http.StatusOK, rsp.StatusCode)
+	var added struct {
+		Remaining uint64 `json:"remaining"`
+	}
+	require.NoError(t, json.NewDecoder(rsp.Body).Decode(&added))
+	rsp.Body.Close()
+	require.Equal(t, uint64(2), added.Remaining)
+
+	rsp, err = http.Get(srv.URL + "/api/campaigns")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, rsp.StatusCode)
+	var sts []CampaignStatus
+	require.NoError(t, json.NewDecoder(rsp.Body).Decode(&sts))
+	rsp.Body.Close()
+	require.Len(t, sts, 1)
+	require.Equal(t, map[string]uint64{"BTC": 2}, sts[0].RemainingAddresses)
+
+	rsp, err = http.Get(srv.URL + "/api/campaigns?id=missing")
+	require.NoError(t, err)
+	rsp.Body.Close()
+	require.Equal(t, http.StatusNotFound, rsp.StatusCode)
+
+	rsp, err = http.Get(srv.URL + "/api/stats?campaign=spring")
+	require.NoError(t, err)
+	var stats exchange.DepositStats
+	require.NoError(t, json.NewDecoder(rsp.Body).Decode(&stats))
+	rsp.Body.Close()
+	require.Equal(t, int64(100000), stats.TotalBTCReceived)
+	require.Equal(t, int64(600e6), stats.TotalSKYSent)
+}
+
+func TestAddAddresses(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	log, _ := testutil.NewLogger(t)
+
+	btca, err := addrs.NewBTCAddrs(log, db, nil, strings.NewReader(`{"btc_addresses": ["1PZ63K3G4gZP6A6E2TTbBwxT5bFQGL2TLB"]}`))
+	require.NoError(t, err)
+
+	addrManager := addrs.NewAddrManager()
+	require.NoError(t, addrManager.PushGenerator(btca, scanner.CoinTypeBTC))
+
+	m := New(log, Config{}, btca, &dummyDepositStatusGetter{}, &dummyScanAddrs{})
+	m.Addresses = addrManager
+
+	srv := httptest.NewServer(m.setupMux())
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		form   url.Values
+		status int
+	}{
+		{url.Values{}, http.StatusBadRequest},
+		{url.Values{"addresses": {"bad"}}, http.StatusBadRequest},
+		{url.Values{"coin_type": {"LTC"}, "addresses": {"14FG8vQnmK6B7YbLSr6uC5wfGY78JFNCYg"}}, http.StatusNotFound},
+		{url.Values{"addresses": {"14FG8vQnmK6B7YbLSr6uC5wfGY78JFNCYg 1PZ63K3G4gZP6A6E2TTbBwxT5bFQGL2TLB"}}, http.StatusConflict},
+	} {
+		rsp, err := http.PostForm(srv.URL+"/api/addresses", tc.form)
+		require.NoError(t, err)
+		rsp.Body.Close()
+		require.Equal(t, tc.status, rsp.StatusCode, tc.form)
+	}
+
+	rsp, err := http.PostForm(srv.URL+"/api/addresses", url.Values{
+		"coin_type": {"BTC"},
+		"addresses": {"14FG8vQnmK6B7YbLSr6uC5wfGY78JFNCYg,\n1JNonvXRyZvZ4ZJ9PE8voyo67UQN1TpoGy"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, rsp.StatusCode)
+	var added struct {
+		Added     int    `json:"added"`
+		Remaining uint64 `json:"remaining"`
+	}
+	require.NoError(t, json.NewDecoder(rsp.Body).Decode(&added))
+	rsp.Body.Close()
+	require.Equal(t, 2, added.Added)
+	require.Equal(t, uint64(3), added.Remaining)
+
+	rsp, err = http.Get(srv.URL + "/api/addresses")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, rsp.StatusCode)
+	var levels struct {
+		Remaining map[string]uint64 `json:"remaining"`
+	}
+	require.NoError(t, json.NewDecoder(rsp.Body).Decode(&levels))
+	rsp.Body.Close()
+	require.Equal(t, map[string]uint64{scanner.CoinTypeBTC: 3}, levels.Remaining)
+}
+
+func TestPromoCodes(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	log, _ := testutil.NewLogger(t)
+
+	mgr, err := promo.NewManager(db)
+	require.NoError(t, err)
+
+	m := New(log, Config{}, &dummyBtcAddrMgr{}, &dummyDepositStatusGetter{
+		dpis: []exchange.DepositInfo{
+			{Seq: 1, CoinType: scanner.CoinTypeBTC, Status: exchange.StatusDone, PromoCode: "FRIEND"},
+			{Seq: 2, CoinType: scanner.CoinTypeBTC, Status: exchange.StatusDone},
+		},
+	}, &dummyScanAddrs{})
+	m.PromoCodes = mgr
+
+	srv := httptest.NewServer(m.setupMux())
+	defer srv.Close()
+
+	post := func(path string, form url.Values) *http.Response {
+		rsp, err := http.PostForm(srv.URL+path, form)
+		require.NoError(t, err)
+		return rsp
+	}
+
+	for _, form := range []url.Values{
+		{"bonus_percent": {"5"}},
+		{"code": {"bad code"}, "bonus_percent": {"5"}},
+		{"code": {"friend"}},
+		{"code": {"friend"}, "bonus_percent": {"-1"}},
+		{"code": {"friend"}, "bonus_percent": {"5"}, "enabled": {"x"}},
+		{"code": {"friend"}, "bonus_percent": {"5"}, "max_uses": {"x"}},
+		{"code": {"friend"}, "bonus_percent": {"5"}, "max_uses": {"-1"}},
+		{"code": {"friend"}, "bonus_percent": {"5"}, "expires_at": {"x"}},
+	} {
+		rsp := post("/api/promo_codes", form)
+		rsp.Body.Close()
+		require.Equal(t, http.StatusBadRequest, rsp.StatusCode, form)
+	}
+
+	rsp := post("/api/promo_codes", url.Values{
+		"code":          {"friend"},
+		"bonus_percent": {"5"},
+		"enabled":       {"true"},
+		"max_uses":      {"100"},
+		"note":          {"alice"},
+	})
+	require.Equal(t, http.StatusOK, rsp.StatusCode)
+	var c promo.Code
+	require.NoError(t, json.NewDecoder(rsp.Body).Decode(&c))
+	rsp.Body.Close()
+	require.Equal(t, "FRIEND", c.Code)
+	require.Equal(t, "5", c.BonusPercent)
+	require.True(t, c.Enabled)
+	require.Equal(t, 100, c.MaxUses)
+	require.Equal(t, "alice", c.Note)
+
+	rsp = post("/api/promo_codes", url.Values{"code": {"FRIEND"}, "bonus_percent": {"1"}})
+	rsp.Body.Close()
+	require.Equal(t, http.StatusConflict, rsp.StatusCode)
+
+	// Only the given args are updated
+	rsp = post("/api/promo_codes/update", url.Values{"code": {"friend"}, "enabled": {"false"}, "expires_at": {"1600000000"}})
+	require.Equal(t, http.StatusOK, rsp.StatusCode)
+	c = promo.Code{}
+	require.NoError(t, json.NewDecoder(rsp.Body).Decode(&c))
+	rsp.Body.Close()
+	require.False(t, c.Enabled)
+	require.Equal(t, "5", c.BonusPercent)
+	require.Equal(t, 100, c.MaxUses)
+	require.Equal(t, int64(1600000000), c.ExpiresAt)
+	require.Equal(t, "alice", c.Note)
+
+	rsp = post("/api/promo_codes/update", url.Values{"code": {"friend"}, "bonus_percent": {"0"}})
+	rsp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, rsp.StatusCode)
+
+	rsp = post("/api/promo_codes/update", url.Values{"code": {"missing"}, "enabled": {"true"}})
+	rsp.Body.Close()
+	require.Equal(t, http.StatusNotFound, rsp.StatusCode)
+
+	rsp, err = http.Get(srv.URL + "/api/promo_codes")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, rsp.StatusCode)
+	var cs []promo.Code
+	require.NoError(t, json.NewDecoder(rsp.Body).Decode(&cs))
+	rsp.Body.Close()
+	require.Len(t, cs, 1)
+	require.Equal(t, "FRIEND", cs[0].Code)
+
+	rsp, err = http.Get(srv.URL + "/api/promo_codes?code=missing")
+	require.NoError(t, err)
+	rsp.Body.Close()
+	require.Equal(t, http.StatusNotFound, rsp.StatusCode)
+
+	rsp, err = http.Get(srv.URL + "/api/deposit_status?promo_code=friend")
+	require.NoError(t, err)
+	var dss []exchange.DepositStatusDetail
+	require.NoError(t, json.NewDecoder(rsp.Body).Decode(&dss))
+	rsp.Body.Close()
+	require.Len(t, dss, 1)
+	require.Equal(t, uint64(1), dss[0].Seq)
+	require.Equal(t, "FRIEND", dss[0].PromoCode)
+}
+
+func TestStatsSeries(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+	m := New(log, Config{}, &dummyBtcAddrMgr{}, &dummyDepositStatusGetter{}, &dummyScanAddrs{})
+
+	di := exchange.DepositInfo{
+		Seq:            1,
+		DepositID:      "tx1:0",
+		CoinType:       "BTC",
+		SkyAddress:     "s1",
+		DepositAddress: "b1",
+		DepositValue:   100000,
+		Status:         exchange.StatusWaitSend,
+	}
+	sent := di
+	sent.Status = exchange.StatusWaitConfirm
+	sent.Txid = "skytx1"
+	sent.SkySent = 500e6
+	m.Events = dummyEvents{
+		events: []exchange.DepositEvent{
+			{Seq: 1, Time: 3600, Type: exchange.EventBindAddress, SkyAddress: "s1", BtcAddress: "b1"},
+			{Seq: 2, Time: 3700, Type: exchange.EventDepositInfo, DepositInfo: &di},
+			{Seq: 3, Time: 7300, Type: exchange.EventDepositInfo, DepositInfo: &sent},
+		},
+	}
+
+	srv := httptest.NewServer(m.setupMux())
+	defer srv.Close()
+
+	for _, q := range []string{
+		"interval=week",
+		"from=x",
+		"to=x",
+		"from=7200&to=3600",
+		"from=0&to=3600000",
+	} {
+		rsp, err := http.Get(srv.URL + "/api/stats/series?" + q)
+		require.NoError(t, err)
+		rsp.Body.Close()
+		require.Equal(t, http.StatusBadRequest, rsp.StatusCode, q)
+	}
+
+	rsp, err := http.Get(srv.URL + "/api/stats/series?from=3600&to=10000")
+	require.NoError(t, err)
+	defer rsp.Body.Close()
+	require.Equal(t, http.StatusOK, rsp.StatusCode)
+
+	var s report.Stats
+	require.NoError(t, json.NewDecoder(rsp.Body).Decode(&s))
+	require.Equal(t, "hour", s.Interval)
+	require.Equal(t, int64(3600), s.From)
+	require.Equal(t, int64(10800), s.To)
+	require.Equal(t, []report.StatsBucket{
+		{Time: 3600, Binds: 1, DepositsDetected: 1},
+		{Time: 7200, DepositsSent: 1, SkySent: 500e6, PendingConfirmations: 1, AvgSendLatency: 3600},
+	}, s.Series)
+	require.Equal(t, 1, s.Totals.DepositsSent)
+	require.Equal(t, 1, s.Totals.PendingConfirmations)
+}
+
+type dummyPrivacy struct {
+	erased map[string]bool
+}
+
+func (d *dummyPrivacy) Export(skyAddr string) (privacy.Export, error) {
+	if skyAddr == "bad" {
+		return privacy.Export{}, privacy.ErrInvalidSkyAddress
+	}
+
+	e := privacy.Export{
+		SkyAddress:       skyAddr,
+		DepositAddresses: []string{"b1"},
+	}
+	if !d.erased[skyAddr] {
+		e.Notifications = []privacy.Notification{{DepositAddress: "b1", Email: "user@example.com"}}
+	}
+	return e, nil
+}
+
+func (d *dummyPrivacy) Erase(skyAddr string) (privacy.Erasure, error) {
+	if skyAddr == "bad" {
+		return privacy.Erasure{}, privacy.ErrInvalidSkyAddress
+	}
+
+	e := privacy.Erasure{SkyAddress: skyAddr}
+	if !d.erased[skyAddr] {
+		e.Notifications = 1
+	}
+	d.erased[skyAddr] = true
+	return e, nil
+}
+
+func TestPrivacy(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+	m := New(log, Config{}, &dummyBtcAddrMgr{}, &dummyDepositStatusGetter{}, &dummyScanAddrs{})
+	m.Privacy = &dummyPrivacy{erased: make(map[string]bool)}
+
+	srv := httptest.NewServer(m.setupMux())
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		query string
+		code  int
+	}{
+		{"", http.StatusBadRequest},
+		{"?skyaddr=bad", http.StatusBadRequest},
+	} {
+		rsp, err := http.Get(srv.URL + "/api/privacy/export" + tc.query)
+		require.NoError(t, err)
+		rsp.Body.Close()
+		require.Equal(t, tc.code, rsp.StatusCode, tc.query)
+
+		rsp, err = http.PostForm(srv.URL+"/api/privacy/erase"+tc.query, nil)
+		require.NoError(t, err)
+		rsp.Body.Close()
+		require.Equal(t, tc.code, rsp.StatusCode, tc.query)
+	}
+
+	rsp, err := http.Post(srv.URL+"/api/privacy/export?skyaddr=s1", "", nil)
+	require.NoError(t, err)
+	rsp.Body.Close()
+	require.Equal(t, http.StatusMethodNotAllowed, rsp.StatusCode)
+
+	rsp, err = http.Get(srv.URL + "/api/privacy/erase?skyaddr=s1")
+	require.NoError(t, err)
+	rsp.Body.Close()
+	require.Equal(t, http.StatusMethodNotAllowed, rsp.StatusCode)
+
+	rsp, err = http.Get(srv.URL + "/api/privacy/export?skyaddr=s1")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, rsp.StatusCode)
+	var e privacy.Export
+	require.NoError(t, json.NewDecoder(rsp.Body).Decode(&e))
+	rsp.Body.Close()
+	require.Equal(t, "s1", e.SkyAddress)
+	require.Len(t, e.Notifications, 1)
+
+	for _, n := range []int{1, 0} {
+		rsp, err = http.PostForm(srv.URL+"/api/privacy/erase", url.Values{"skyaddr": {"s1"}})
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, rsp.StatusCode)
+		var er privacy.Erasure
+		require.NoError(t, json.NewDecoder(rsp.Body).Decode(&er))
+		rsp.Body.Close()
+		require.Equal(t, privacy.Erasure{SkyAddress: "s1", Notifications: n}, er)
+	}
+
+	rsp, err = http.Get(srv.URL + "/api/privacy/export?skyaddr=s1")
+	require.NoError(t, err)
+	e = privacy.Export{}
+	require.NoError(t, json.NewDecoder(rsp.Body).Decode(&e))
+	rsp.Body.Close()
+	require.Empty(t, e.Notifications)
+}
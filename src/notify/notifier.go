@@ -0,0 +1,243 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/skycoin/skycoin/src/util/droplet"
+
+	"github.com/skycoin/teller/src/outbox"
+)
+
+// UnsubscribePath is the API path of the unsubscribe links
+const UnsubscribePath = "/api/notifications/unsubscribe"
+
+const (
+	// DefaultSubjectTemplate is the default template of the subject of the notifications
+	DefaultSubjectTemplate = `{{if eq .Type "done"}}Your {{.CoinType}} deposit is complete{{else}}Your {{.CoinType}} deposit could not be processed{{end}}`
+
+	// DefaultTemplate is the default template of the text of the notifications
+	DefaultTemplate = `{{if eq .Type "done"}}{{.SkySent}} SKY were sent to {{.SkyAddress}} for your {{.CoinType}} deposit to {{.DepositAddress}}.
+
+Skycoin transaction: {{.Txid}}
+{{else}}Your {{.CoinType}} deposit to {{.DepositAddress}} could not be processed.
+Please contact support with the deposit ID below.
+{{end}}
+Deposit ID: {{.DepositID}}
+
+You receive this email because this address was entered when the deposit address was requested.
+To stop these emails and delete your email address, visit {{.UnsubscribeURL}}
+`
+)
+
+// TemplateData is the data that the notification templates are executed with
+type TemplateData struct {
+	Type           string
+	Time           time.Time
+	CoinType       string
+	SkyAddress     string
+	DepositAddress string
+	DepositID      string
+	// DepositValue is in the smallest unit of the coin, e.g. satoshis
+	DepositValue int64
+	// SkySent is in SKY, e.g. "1.5"
+	SkySent        string
+	Txid           string
+	Error          string
+	UnsubscribeURL string
+}
+
+// Template formats the subject and the text of the notifications with text/template
+type Template struct {
+	subject *template.Template
+	text    *template.Template
+}
+
+// NewTemplate parses the templates of the subject and of the text. Empty templates are the defaults.
+func NewTemplate(subject, text string) (*Template, error) {
+	if subject == "" {
+		subject = DefaultSubjectTemplate
+	}
+
+	if text == "" {
+		text = DefaultTemplate
+	}
+
+	var t Template
+	var err error
+	t.subject, err = template.New("subject").Option("missingkey=error").Parse(subject)
+	if err != nil {
+		return nil, fmt.Errorf("subject template invalid: %v", err)
+	}
+
+	t.text, err = template.New("text").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("text template invalid: %v", err)
+	}
+
+	// Unknown fields only fail when the template is executed
+	if _, _, err := t.Execute(TemplateData{
+		Type:     string(EventDone),
+		Time:     time.Now().UTC(),
+		CoinType: "BTC",
+		SkySent:  "1",
+	}); err != nil {
+		return nil, fmt.Errorf("template invalid: %v", err)
+	}
+
+	return &t, nil
+}
+
+// Execute returns the subject and the text of a notification
+func (t *Template) Execute(data TemplateData) (string, string, error) {
+	var subject, text bytes.Buffer
+	if err := t.subject.Execute(&subject, data); err != nil {
+		return "", "", err
+	}
+
+	if err := t.text.Execute(&text, data); err != nil {
+		return "", "", err
+	}
+
+	return strings.TrimSpace(subject.String()), text.String(), nil
+}
+
+// Mailer emails a user
+type Mailer interface {
+	EmailTo(to, subject, body string, header map[string]string) error
+}
+
+// Config configures the Notifier
+type Config struct {
+	// BaseURL is the URL of the teller API that the unsubscribe links point to, e.g. https://teller.example.com
+	BaseURL string
+	// Template of the notifications, the default template if nil
+	Template *Template
+}
+
+// Notifier emails the users subscribed to the deposit addresses of the events of the Queue outbox.
+// It is the Relay of the Dispatcher of the Queue.
+type Notifier struct {
+	log    logrus.FieldLogger
+	store  *Store
+	mailer Mailer
+	cfg    Config
+}
+
+// NewNotifier creates a Notifier
+func NewNotifier(log logrus.FieldLogger, store *Store, mailer Mailer, cfg Config) (*Notifier, error) {
+	u, err := url.Parse(cfg.BaseURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, errors.New("notifications base url must be an http or https URL")
+	}
+
+	if cfg.Template == nil {
+		cfg.Template, err = NewTemplate("", "")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &Notifier{
+		log:    log.WithField("prefix", "notify"),
+		store:  store,
+		mailer: mailer,
+		cfg:    cfg,
+	}, nil
+}
+
+// UnsubscribeURL returns the unsubscribe link of an email hash
+func (n *Notifier) UnsubscribeURL(emailHash string) string {
+	q := url.Values{}
+	q.Set("email", emailHash)
+	q.Set("token", n.store.UnsubscribeToken(emailHash))
+	return strings.TrimSuffix(n.cfg.BaseURL, "/") + UnsubscribePath + "?" + q.Encode()
+}
+
+// Relay emails the event of the message to the email address subscribed to its deposit address, if any.
+// Messages that can never be emailed, e.g. because the mail server rejected the address, are dropped.
+func (n *Notifier) Relay(msg outbox.Message) error {
+	log := n.log.WithField("msgID", msg.ID)
+
+	if msg.Topic != TopicDeposit {
+		log.WithField("topic", msg.Topic).Warn("Unknown notification topic, dropping message")
+		return nil
+	}
+
+	var e Event
+	if err := json.Unmarshal(msg.Payload, &e); err != nil {
+		log.WithError(err).Error("Decode notification event failed, dropping message")
+		return nil
+	}
+
+	log = log.WithFields(logrus.Fields{
+		"type":      e.Type,
+		"depositID": e.DepositID,
+	})
+
+	sub, err := n.store.Get(e.DepositAddress)
+	if err == ErrNotSubscribed {
+		return nil
+	} else if err != nil {
+		log.WithError(err).Error("store.Get failed")
+		return err
+	}
+
+	log = log.WithField("emailHash", sub.EmailHash)
+
+	skySent, err := droplet.ToString(e.SkySent)
+	if err != nil {
+		log.WithError(err).Error("droplet.ToString failed, dropping message")
+		return nil
+	}
+
+	unsubscribeURL := n.UnsubscribeURL(sub.EmailHash)
+
+	subject, text, err := n.cfg.Template.Execute(TemplateData{
+		Type:           string(e.Type),
+		Time:           time.Unix(e.Time, 0).UTC(),
+		CoinType:       e.CoinType,
+		SkyAddress:     e.SkyAddress,
+		DepositAddress: e.DepositAddress,
+		DepositID:      e.DepositID,
+		DepositValue:   e.DepositValue,
+		SkySent:        skySent,
+		Txid:           e.Txid,
+		Error:          e.Error,
+		UnsubscribeURL: unsubscribeURL,
+	})
+	if err != nil {
+		log.WithError(err).Error("Execute notification template failed, dropping message")
+		return nil
+	}
+
+	// One-click unsubscribe, RFC 8058: mail clients POST to the link
+	header := map[string]string{
+		"List-Unsubscribe":      "<" + unsubscribeURL + ">",
+		"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+	}
+
+	if err := n.mailer.EmailTo(sub.Email, subject, text, header); err != nil {
+		// A permanent failure, e.g. an unknown mailbox, fails the same way when retried
+		if e, ok := err.(*textproto.Error); ok && e.Code >= 500 {
+			log.WithError(err).Warn("Mail server rejected the notification, dropping message")
+			return nil
+		}
+
+		log.WithError(err).Error("mailer.EmailTo failed")
+		return err
+	}
+
+	log.Info("Notified user")
+
+	return nil
+}
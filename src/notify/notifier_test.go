@@ -0,0 +1,182 @@
+package notify
+
+import (
+	"encoding/json"
+	"errors"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/outbox"
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+type email struct {
+	to, subject, body string
+	header            map[string]string
+}
+
+type dummyMailer struct {
+	sent []email
+	err  error
+}
+
+func (m *dummyMailer) EmailTo(to, subject, body string, header map[string]string) error {
+	if m.err != nil {
+		return m.err
+	}
+
+	m.sent = append(m.sent, email{
+		to:      to,
+		subject: subject,
+		body:    body,
+		header:  header,
+	})
+	return nil
+}
+
+func eventMessage(t *testing.T, e Event) outbox.Message {
+	b, err := json.Marshal(e)
+	require.NoError(t, err)
+
+	return outbox.Message{
+		ID:      1,
+		Topic:   TopicDeposit,
+		Payload: b,
+	}
+}
+
+func TestTemplate(t *testing.T) {
+	_, err := NewTemplate("{{.Type", "")
+	require.Error(t, err)
+
+	_, err = NewTemplate("", "{{.Unknown}}")
+	require.Error(t, err)
+
+	tmpl, err := NewTemplate("Deposit {{.DepositID}} {{.Type}}\n", "{{.SkySent}} SKY, {{.Time.Format \"2006-01-02\"}}")
+	require.NoError(t, err)
+
+	subject, text, err := tmpl.Execute(TemplateData{
+		Type:      "done",
+		DepositID: "txid:0",
+		SkySent:   "1.5",
+	})
+	require.NoError(t, err)
+	require.Equal(t, "Deposit txid:0 done", subject)
+	require.Equal(t, "1.5 SKY, 0001-01-01", text)
+}
+
+func TestNotifierRelay(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	s := newTestStore(t, db)
+	m := &dummyMailer{}
+	log, _ := testutil.NewLogger(t)
+
+	_, err := NewNotifier(log, s, m, Config{
+		BaseURL: "teller.example.com",
+	})
+	require.Error(t, err)
+
+	n, err := NewNotifier(log, s, m, Config{
+		BaseURL: "https://teller.example.com/",
+	})
+	require.NoError(t, err)
+
+	done := Event{
+		Type:           EventDone,
+		Time:           1500000000,
+		CoinType:       "BTC",
+		SkyAddress:     "skyaddr1",
+		DepositAddress: "btcaddr1",
+		DepositID:      "txid:0",
+		DepositValue:   1e6,
+		SkySent:        1500000,
+		Txid:           "skytx1",
+	}
+
+	// Events of deposit addresses without a subscription are dropped
+	require.NoError(t, n.Relay(eventMessage(t, done)))
+	require.Empty(t, m.sent)
+
+	require.NoError(t, s.Subscribe("btcaddr1", "user@example.com"))
+
+	require.NoError(t, n.Relay(eventMessage(t, done)))
+	require.Len(t, m.sent, 1)
+
+	sent := m.sent[0]
+	require.Equal(t, "user@example.com", sent.to)
+	require.Equal(t, "Your BTC deposit is complete", sent.subject)
+	require.True(t, strings.HasPrefix(sent.body, "1.500000 SKY were sent to skyaddr1 for your BTC deposit to btcaddr1.\n"), sent.body)
+	require.Contains(t, sent.body, "Skycoin transaction: skytx1\n")
+	require.Contains(t, sent.body, "Deposit ID: txid:0\n")
+
+	unsubscribeURL := n.UnsubscribeURL(s.EmailHash("user@example.com"))
+	require.Contains(t, sent.body, unsubscribeURL)
+	require.Equal(t, "<"+unsubscribeURL+">", sent.header["List-Unsubscribe"])
+	require.Equal(t, "List-Unsubscribe=One-Click", sent.header["List-Unsubscribe-Post"])
+
+	// The unsubscribe link unsubscribes the email address
+	u, err := url.Parse(unsubscribeURL)
+	require.NoError(t, err)
+	require.Equal(t, "teller.example.com", u.Host)
+	require.Equal(t, UnsubscribePath, u.Path)
+	deleted, err := s.Unsubscribe(u.Query().Get("email"), u.Query().Get("token"))
+	require.NoError(t, err)
+	require.Equal(t, 1, deleted)
+
+	require.NoError(t, s.Subscribe("btcaddr1", "user@example.com"))
+
+	// The error of a failed deposit is not in the default template
+	require.NoError(t, n.Relay(eventMessage(t, Event{
+		Type:           EventErrored,
+		CoinType:       "LTC",
+		DepositAddress: "btcaddr1",
+		DepositID:      "txid:1",
+		Error:          "internal error details",
+	})))
+	require.Len(t, m.sent, 2)
+	require.Equal(t, "Your LTC deposit could not be processed", m.sent[1].subject)
+	require.Contains(t, m.sent[1].body, "Deposit ID: txid:1\n")
+	require.NotContains(t, m.sent[1].body, "internal error details")
+
+	// Temporary failures are retried, permanent ones dropped
+	m.err = errors.New("connection refused")
+	require.Error(t, n.Relay(eventMessage(t, done)))
+
+	m.err = &textproto.Error{Code: 451, Msg: "try again later"}
+	require.Error(t, n.Relay(eventMessage(t, done)))
+
+	m.err = &textproto.Error{Code: 550, Msg: "no such user"}
+	require.NoError(t, n.Relay(eventMessage(t, done)))
+
+	// Other topics are dropped
+	m.err = nil
+	msg := eventMessage(t, done)
+	msg.Topic = "other"
+	require.NoError(t, n.Relay(msg))
+	require.Len(t, m.sent, 2)
+
+	// A custom template
+	tmpl, err := NewTemplate("{{.Type}}", "{{.DepositValue}} {{.Error}}")
+	require.NoError(t, err)
+	n, err = NewNotifier(log, s, m, Config{
+		BaseURL:  "https://teller.example.com",
+		Template: tmpl,
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, n.Relay(eventMessage(t, Event{
+		Type:           EventErrored,
+		DepositAddress: "btcaddr1",
+		DepositValue:   1000,
+		Error:          "invalidated",
+	})))
+	require.Len(t, m.sent, 3)
+	require.Equal(t, "errored", m.sent[2].subject)
+	require.Equal(t, "1000 invalidated", m.sent[2].body)
+}
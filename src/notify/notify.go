@@ -0,0 +1,270 @@
+// Package notify emails users when their deposits are done or fail, if they left an email address
+// when binding the deposit address. Email addresses are only stored encrypted, next to a keyed hash
+// of the address that unsubscribe links and deletion requests find them by.
+package notify
+
+import (
+	"crypto/hmac"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/skycoin/teller/src/outbox"
+	"github.com/skycoin/teller/src/util/dbcrypt"
+	"github.com/skycoin/teller/src/util/dbutil"
+)
+
+const (
+	// Queue is the outbox queue of the deposit events that users are notified of
+	Queue = "outbox_notify"
+	// TopicDeposit is the outbox topic of the deposit events that users are notified of
+	TopicDeposit = "deposit.notification"
+
+	// KeyName is the name of the encryption key of the email addresses, see dbcrypt.OpenKey
+	KeyName = "notify"
+
+	// maxEmailLen is the maximum length of an email address, RFC 5321
+	maxEmailLen = 254
+)
+
+// subscriptions of deposit addresses, hash of the deposit address as key
+var subscriptionsBkt = []byte("notify_subscriptions")
+
+var (
+	// ErrNotSubscribed is returned if no email address is subscribed to a deposit address
+	ErrNotSubscribed = errors.New("No email address is subscribed to the deposit address")
+	// ErrInvalidEmail is returned if an email address is invalid
+	ErrInvalidEmail = errors.New("Invalid email address")
+	// ErrInvalidToken is returned if an unsubscribe token doesn't match its email hash
+	ErrInvalidToken = errors.New("Invalid unsubscribe token")
+)
+
+// EventType is the type of an Event
+type EventType string
+
+const (
+	// EventDone skycoins were sent for a deposit, and the send is confirmed
+	EventDone EventType = "done"
+	// EventErrored a deposit failed
+	EventErrored EventType = "errored"
+)
+
+// Event is the outbox payload of a deposit event that the user is notified of
+type Event struct {
+	Type           EventType `json:"type"`
+	Time           int64     `json:"time"`
+	CoinType       string    `json:"coin_type"`
+	SkyAddress     string    `json:"skycoin_address"`
+	DepositAddress string    `json:"deposit_address"`
+	DepositID      string    `json:"deposit_id"`
+	DepositValue   int64     `json:"deposit_value"`
+	SkySent        uint64    `json:"sky_sent"`
+	Txid           string    `json:"txid,omitempty"`
+	Error          string    `json:"error,omitempty"`
+}
+
+// PutEventTx adds an event to the Queue outbox, inside of tx. Events of deposit addresses without a subscription
+// are dropped when they are relayed, so that the subscriptions are not read in the transactions of deposits.
+func PutEventTx(tx *bolt.Tx, e Event) error {
+	_, err := outbox.PutQueueTx(tx, Queue, TopicDeposit, e)
+	return err
+}
+
+// ValidateEmail returns ErrInvalidEmail unless email is a plain email address, without a display name
+func ValidateEmail(email string) error {
+	if len(email) > maxEmailLen {
+		return ErrInvalidEmail
+	}
+
+	a, err := mail.ParseAddress(email)
+	if err != nil || a.Name != "" || a.Address != email {
+		return ErrInvalidEmail
+	}
+
+	return nil
+}
+
+// Subscription is the email address notified of the deposits to a deposit address
+type Subscription struct {
+	DepositAddress string
+	Email          string
+	EmailHash      string
+	CreatedAt      int64
+}
+
+// storedSubscription is a Subscription as it is stored, with the email address encrypted
+type storedSubscription struct {
+	EmailHash string `json:"email_hash"`
+	Email     []byte `json:"email"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// Store keeps the subscriptions of deposit addresses
+type Store struct {
+	db *bolt.DB
+	c  *dbcrypt.Cipher
+}
+
+// NewStore creates a Store, encrypting the email addresses with c
+func NewStore(db *bolt.DB, c *dbcrypt.Cipher) (*Store, error) {
+	if db == nil {
+		return nil, errors.New("new notify Store failed, db is nil")
+	}
+
+	// A nil Cipher would store the email addresses as they are
+	if c == nil {
+		return nil, errors.New("new notify Store failed, cipher is nil")
+	}
+
+	if err := db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(subscriptionsBkt); err != nil {
+			return dbutil.NewCreateBucketFailedErr(subscriptionsBkt, err)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return &Store{
+		db: db,
+		c:  c,
+	}, nil
+}
+
+// EmailHash returns the keyed hash of an email address. Addresses are compared case-insensitively.
+func (s *Store) EmailHash(email string) string {
+	return s.c.Hash("email/" + strings.ToLower(email))
+}
+
+// UnsubscribeToken returns the token of the unsubscribe links of an email hash, which proves
+// that the link was sent to the email address
+func (s *Store) UnsubscribeToken(emailHash string) string {
+	return s.c.Hash("unsubscribe/" + emailHash)
+}
+
+func (s *Store) key(depositAddr string) string {
+	return s.c.Hash("deposit_address/" + depositAddr)
+}
+
+// Subscribe subscribes an email address to the deposits of a deposit address,
+// replacing the email address subscribed to it before
+func (s *Store) Subscribe(depositAddr, email string) error {
+	if err := ValidateEmail(email); err != nil {
+		return err
+	}
+
+	encrypted, err := s.c.Encrypt([]byte(email))
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return dbutil.PutBucketValue(tx, subscriptionsBkt, s.key(depositAddr), storedSubscription{
+			EmailHash: s.EmailHash(email),
+			Email:     encrypted,
+			CreatedAt: time.Now().UTC().Unix(),
+		})
+	})
+}
+
+// Get returns the subscription of a deposit address, ErrNotSubscribed if it has none
+func (s *Store) Get(depositAddr string) (Subscription, error) {
+	var ss storedSubscription
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		return dbutil.GetBucketObject(tx, subscriptionsBkt, s.key(depositAddr), &ss)
+	}); err != nil {
+		switch err.(type) {
+		case dbutil.ObjectNotExistErr:
+			return Subscription{}, ErrNotSubscribed
+		default:
+			return Subscription{}, err
+		}
+	}
+
+	email, err := s.c.Decrypt(ss.Email)
+	if err != nil {
+		return Subscription{}, fmt.Errorf("decrypt email of subscription failed: %v", err)
+	}
+
+	return Subscription{
+		DepositAddress: depositAddr,
+		Email:          string(email),
+		EmailHash:      ss.EmailHash,
+		CreatedAt:      ss.CreatedAt,
+	}, nil
+}
+
+// Subscribed returns true if a deposit address has a subscription. Unlike Get, it doesn't decrypt the email address.
+func (s *Store) Subscribed(depositAddr string) (bool, error) {
+	var ok bool
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		ok, err = dbutil.BucketHasKey(tx, subscriptionsBkt, s.key(depositAddr))
+		return err
+	}); err != nil {
+		return false, err
+	}
+
+	return ok, nil
+}
+
+// Delete deletes the subscription of a deposit address, if it has one
+func (s *Store) Delete(depositAddr string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return dbutil.DeleteBucketKey(tx, subscriptionsBkt, s.key(depositAddr))
+	})
+}
+
+// Unsubscribe deletes the subscriptions of the email address of emailHash, if token is its UnsubscribeToken.
+// It returns the number of subscriptions deleted.
+func (s *Store) Unsubscribe(emailHash, token string) (int, error) {
+	if !hmac.Equal([]byte(token), []byte(s.UnsubscribeToken(emailHash))) {
+		return 0, ErrInvalidToken
+	}
+
+	return s.deleteEmailHash(emailHash)
+}
+
+// DeleteEmail deletes the subscriptions of an email address, and returns their number
+func (s *Store) DeleteEmail(email string) (int, error) {
+	return s.deleteEmailHash(s.EmailHash(email))
+}
+
+func (s *Store) deleteEmailHash(emailHash string) (int, error) {
+	var n int
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		// Keys can't be deleted while iterating the bucket
+		var keys []string
+		if err := dbutil.ForEach(tx, subscriptionsBkt, func(k, v []byte) error {
+			var ss storedSubscription
+			if err := json.Unmarshal(v, &ss); err != nil {
+				return fmt.Errorf("decode subscription %s failed: %v", k, err)
+			}
+
+			if ss.EmailHash == emailHash {
+				keys = append(keys, string(k))
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		for _, k := range keys {
+			if err := dbutil.DeleteBucketKey(tx, subscriptionsBkt, k); err != nil {
+				return err
+			}
+		}
+
+		n = len(keys)
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
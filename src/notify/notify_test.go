@@ -0,0 +1,164 @@
+package notify
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/outbox"
+	"github.com/skycoin/teller/src/util/dbcrypt"
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+func newTestStore(t *testing.T, db *bolt.DB) *Store {
+	c, err := dbcrypt.OpenKey(db, KeyName, "secret")
+	require.NoError(t, err)
+
+	s, err := NewStore(db, c)
+	require.NoError(t, err)
+	return s
+}
+
+func TestValidateEmail(t *testing.T) {
+	for _, email := range []string{
+		"user@example.com",
+		"first.last+tag@mail.example.com",
+	} {
+		require.NoError(t, ValidateEmail(email), email)
+	}
+
+	for _, email := range []string{
+		"",
+		"user",
+		"user@",
+		"User <user@example.com>",
+		" user@example.com",
+		"user@example.com\r\nBcc: x@example.com",
+		"a@" + string(make([]byte, 300)),
+	} {
+		require.Equal(t, ErrInvalidEmail, ValidateEmail(email), email)
+	}
+}
+
+func TestStore(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	_, err := NewStore(db, nil)
+	require.Error(t, err)
+
+	s := newTestStore(t, db)
+
+	_, err = s.Get("addr1")
+	require.Equal(t, ErrNotSubscribed, err)
+
+	require.Equal(t, ErrInvalidEmail, s.Subscribe("addr1", "not an email"))
+
+	require.NoError(t, s.Subscribe("addr1", "User@example.com"))
+	require.NoError(t, s.Subscribe("addr2", "user@example.com"))
+	require.NoError(t, s.Subscribe("addr3", "other@example.com"))
+
+	sub, err := s.Get("addr1")
+	require.NoError(t, err)
+	require.Equal(t, "addr1", sub.DepositAddress)
+	require.Equal(t, "User@example.com", sub.Email)
+	require.Equal(t, s.EmailHash("user@example.com"), sub.EmailHash)
+	require.NotZero(t, sub.CreatedAt)
+
+	// Neither the email address nor the deposit address are stored
+	require.NoError(t, db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(subscriptionsBkt).ForEach(func(k, v []byte) error {
+			require.NotContains(t, string(k), "addr")
+			require.NotContains(t, string(v), "example.com")
+			return nil
+		})
+	}))
+
+	// Another key can't decrypt the email addresses, and hashes them differently
+	c2, err := dbcrypt.OpenKey(db, "other", "secret")
+	require.NoError(t, err)
+	s2, err := NewStore(db, c2)
+	require.NoError(t, err)
+	require.NotEqual(t, s.EmailHash("user@example.com"), s2.EmailHash("user@example.com"))
+	_, err = s2.Get("addr1")
+	require.Equal(t, ErrNotSubscribed, err)
+
+	// Subscribing again replaces the email address
+	require.NoError(t, s.Subscribe("addr3", "third@example.com"))
+	sub, err = s.Get("addr3")
+	require.NoError(t, err)
+	require.Equal(t, "third@example.com", sub.Email)
+
+	// Unsubscribing deletes all subscriptions of the email address
+	h := s.EmailHash("user@example.com")
+	_, err = s.Unsubscribe(h, "")
+	require.Equal(t, ErrInvalidToken, err)
+	_, err = s.Unsubscribe(h, s.UnsubscribeToken(s.EmailHash("third@example.com")))
+	require.Equal(t, ErrInvalidToken, err)
+
+	n, err := s.Unsubscribe(h, s.UnsubscribeToken(h))
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+
+	_, err = s.Get("addr1")
+	require.Equal(t, ErrNotSubscribed, err)
+	_, err = s.Get("addr2")
+	require.Equal(t, ErrNotSubscribed, err)
+
+	n, err = s.Unsubscribe(h, s.UnsubscribeToken(h))
+	require.NoError(t, err)
+	require.Equal(t, 0, n)
+
+	n, err = s.DeleteEmail("THIRD@example.com")
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+
+	require.NoError(t, s.Subscribe("addr4", "user@example.com"))
+	ok, err := s.Subscribed("addr4")
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	require.NoError(t, s.Delete("addr4"))
+	require.NoError(t, s.Delete("addr4"))
+	_, err = s.Get("addr4")
+	require.Equal(t, ErrNotSubscribed, err)
+
+	ok, err = s.Subscribed("addr4")
+	require.NoError(t, err)
+	require.False(t, ok)
+}
+
+func TestPutEventTx(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	e := Event{
+		Type:           EventDone,
+		Time:           1500000000,
+		CoinType:       "BTC",
+		SkyAddress:     "skyaddr1",
+		DepositAddress: "btcaddr1",
+		DepositID:      "txid:0",
+		DepositValue:   1e6,
+		SkySent:        2e6,
+		Txid:           "skytx1",
+	}
+
+	require.NoError(t, db.Update(func(tx *bolt.Tx) error {
+		return PutEventTx(tx, e)
+	}))
+
+	store, err := outbox.NewQueueStore(db, Queue)
+	require.NoError(t, err)
+
+	msgs, err := store.Pending(10)
+	require.NoError(t, err)
+	require.Len(t, msgs, 1)
+	require.Equal(t, TopicDeposit, msgs[0].Topic)
+
+	var got Event
+	require.NoError(t, json.Unmarshal(msgs[0].Payload, &got))
+	require.Equal(t, e, got)
+}
@@ -0,0 +1,136 @@
+package outbox
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	dispatchPeriod     = time.Second * 5
+	maxDispatchBackoff = time.Minute * 5
+	dispatchBatchSize  = 100
+)
+
+// Relay delivers a message to its consumers, e.g. a webhook or a message bus.
+// Messages may be relayed more than once, consumers can use Message.ID to detect duplicates.
+type Relay interface {
+	Relay(Message) error
+}
+
+// DispatcherConfig configures the Dispatcher
+type DispatcherConfig struct {
+	Period     time.Duration // how often to check the outbox for new messages
+	MaxBackoff time.Duration // maximum wait before retrying a failed message
+}
+
+// Dispatcher relays outbox messages in order, removing each once it is delivered.
+// If a message fails, it is retried with an exponential backoff, and the messages
+// after it wait, so that consumers see messages in the order they were emitted.
+type Dispatcher struct {
+	log   logrus.FieldLogger
+	cfg   DispatcherConfig
+	store *Store
+	relay Relay
+	quit  chan struct{}
+	done  chan struct{}
+}
+
+// NewDispatcher creates a Dispatcher
+func NewDispatcher(log logrus.FieldLogger, store *Store, relay Relay, cfg DispatcherConfig) *Dispatcher {
+	if cfg.Period == 0 {
+		cfg.Period = dispatchPeriod
+	}
+
+	if cfg.MaxBackoff == 0 {
+		cfg.MaxBackoff = maxDispatchBackoff
+	}
+
+	return &Dispatcher{
+		log:   log.WithField("prefix", "outbox.dispatcher"),
+		cfg:   cfg,
+		store: store,
+		relay: relay,
+		quit:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+}
+
+// Run starts the Dispatcher
+func (d *Dispatcher) Run() error {
+	log := d.log.WithField("config", d.cfg)
+	log.Info("Start outbox dispatcher")
+	defer log.Info("Outbox dispatcher closed")
+	defer close(d.done)
+
+	backoff := d.cfg.Period
+	for {
+		wait := d.cfg.Period
+		if _, err := d.Dispatch(); err != nil {
+			// Back off while relaying keeps failing
+			wait = backoff
+			log.WithError(err).WithField("retryIn", wait).Error("Dispatcher.Dispatch failed")
+
+			backoff *= 2
+			if backoff > d.cfg.MaxBackoff {
+				backoff = d.cfg.MaxBackoff
+			}
+		} else {
+			backoff = d.cfg.Period
+		}
+
+		select {
+		case <-d.quit:
+			return nil
+		case <-time.After(wait):
+		}
+	}
+}
+
+// Shutdown stops the Dispatcher
+func (d *Dispatcher) Shutdown() {
+	close(d.quit)
+	<-d.done
+}
+
+// Dispatch relays pending messages in order until the outbox is empty or a message
+// fails. Returns the number of messages relayed.
+func (d *Dispatcher) Dispatch() (int, error) {
+	var n int
+	for {
+		msgs, err := d.store.Pending(dispatchBatchSize)
+		if err != nil {
+			return n, err
+		}
+
+		if len(msgs) == 0 {
+			return n, nil
+		}
+
+		for _, msg := range msgs {
+			select {
+			case <-d.quit:
+				return n, nil
+			default:
+			}
+
+			log := d.log.WithFields(logrus.Fields{
+				"msgID": msg.ID,
+				"topic": msg.Topic,
+			})
+
+			if err := d.relay.Relay(msg); err != nil {
+				log.WithError(err).Error("Relay message failed")
+				return n, err
+			}
+
+			if err := d.store.Delete(msg.ID); err != nil {
+				log.WithError(err).Error("Delete relayed message failed")
+				return n, err
+			}
+
+			log.Debug("Relayed message")
+			n++
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package outbox
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+type dummyRelay struct {
+	sync.Mutex
+	relayed []uint64
+	failID  uint64
+}
+
+func (r *dummyRelay) Relay(msg Message) error {
+	r.Lock()
+	defer r.Unlock()
+
+	if msg.ID == r.failID {
+		return errors.New("relay failed")
+	}
+
+	r.relayed = append(r.relayed, msg.ID)
+	return nil
+}
+
+func (r *dummyRelay) setFailID(id uint64) {
+	r.Lock()
+	defer r.Unlock()
+	r.failID = id
+}
+
+func (r *dummyRelay) getRelayed() []uint64 {
+	r.Lock()
+	defer r.Unlock()
+	return append([]uint64(nil), r.relayed...)
+}
+
+func setupDispatcher(t *testing.T) (*Dispatcher, *Store, *dummyRelay, func()) {
+	db, shutdown := testutil.PrepareDB(t)
+
+	s, err := NewStore(db)
+	require.NoError(t, err)
+
+	log, _ := testutil.NewLogger(t)
+	relay := &dummyRelay{}
+	d := NewDispatcher(log, s, relay, DispatcherConfig{
+		Period:     time.Millisecond * 10,
+		MaxBackoff: time.Millisecond * 40,
+	})
+
+	return d, s, relay, shutdown
+}
+
+func TestDispatcherDispatch(t *testing.T) {
+	d, s, relay, shutdown := setupDispatcher(t)
+	defer shutdown()
+
+	for i := 0; i < dispatchBatchSize+5; i++ {
+		_, err := s.Put("test", i)
+		require.NoError(t, err)
+	}
+
+	// A failed message stops dispatching, so that later messages are not
+	// relayed before it
+	relay.setFailID(3)
+	n, err := d.Dispatch()
+	require.Error(t, err)
+	require.Equal(t, 2, n)
+	require.Equal(t, []uint64{1, 2}, relay.getRelayed())
+
+	pending, err := s.Pending(1)
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), pending[0].ID)
+
+	// Once the relay recovers, the rest are relayed in order, across batches
+	relay.setFailID(0)
+	n, err = d.Dispatch()
+	require.NoError(t, err)
+	require.Equal(t, dispatchBatchSize+3, n)
+
+	relayed := relay.getRelayed()
+	require.Len(t, relayed, dispatchBatchSize+5)
+	for i, id := range relayed {
+		require.Equal(t, uint64(i+1), id)
+	}
+
+	l, err := s.Len()
+	require.NoError(t, err)
+	require.Equal(t, 0, l)
+
+	// Nothing to do
+	n, err = d.Dispatch()
+	require.NoError(t, err)
+	require.Equal(t, 0, n)
+}
+
+func TestDispatcherRun(t *testing.T) {
+	d, s, relay, shutdown := setupDispatcher(t)
+	defer shutdown()
+
+	relay.setFailID(1)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		require.NoError(t, d.Run())
+	}()
+
+	_, err := s.Put("test", "a")
+	require.NoError(t, err)
+	_, err = s.Put("test", "b")
+	require.NoError(t, err)
+
+	// The failing message is retried until it is relayed
+	time.Sleep(time.Millisecond * 100)
+	require.Empty(t, relay.getRelayed())
+
+	relay.setFailID(0)
+
+	for i := 0; i < 500 && len(relay.getRelayed()) < 2; i++ {
+		time.Sleep(time.Millisecond * 10)
+	}
+	require.Equal(t, []uint64{1, 2}, relay.getRelayed())
+
+	d.Shutdown()
+	<-done
+}
@@ -0,0 +1,157 @@
+package outbox
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	kafkaContentType = "application/vnd.kafka.json.v2+json"
+	kafkaAccept      = "application/vnd.kafka.v2+json"
+	kafkaTimeout     = time.Second * 10
+)
+
+type kafkaRecord struct {
+	Key   string  `json:"key"`
+	Value Message `json:"value"`
+}
+
+type kafkaProduceRequest struct {
+	Records []kafkaRecord `json:"records"`
+}
+
+type kafkaOffset struct {
+	Partition int     `json:"partition"`
+	Offset    int64   `json:"offset"`
+	ErrorCode *int    `json:"error_code"`
+	Error     *string `json:"error"`
+}
+
+type kafkaProduceResponse struct {
+	Offsets []kafkaOffset `json:"offsets"`
+}
+
+type kafkaErrorResponse struct {
+	ErrorCode int    `json:"error_code"`
+	Message   string `json:"message"`
+}
+
+// KafkaConfig configures the KafkaRelay
+type KafkaConfig struct {
+	// URL of the Kafka REST proxy
+	ProxyURL string
+	Topic    string
+	// User and Password authenticate with the proxy with basic auth if set
+	User     string
+	Password string
+}
+
+// KafkaRelay publishes messages as JSON records to a Kafka topic, through a Kafka REST proxy
+// speaking the Confluent REST Proxy API v2. Records are keyed with the message topic, so that
+// the messages of a topic are in one partition, in order.
+type KafkaRelay struct {
+	cfg    KafkaConfig
+	url    string
+	client *http.Client
+}
+
+// NewKafkaRelay creates a KafkaRelay
+func NewKafkaRelay(cfg KafkaConfig) (*KafkaRelay, error) {
+	u, err := url.Parse(cfg.ProxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("kafka rest proxy url invalid: %v", err)
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, errors.New("kafka rest proxy url must be an http or https URL")
+	}
+
+	if cfg.Topic == "" {
+		return nil, errors.New("kafka topic is empty")
+	}
+
+	return &KafkaRelay{
+		cfg: cfg,
+		url: strings.TrimSuffix(cfg.ProxyURL, "/") + "/topics/" + url.PathEscape(cfg.Topic),
+		client: &http.Client{
+			Timeout: kafkaTimeout,
+		},
+	}, nil
+}
+
+// Relay produces the message to the topic
+func (k *KafkaRelay) Relay(msg Message) error {
+	body, err := json.Marshal(kafkaProduceRequest{
+		Records: []kafkaRecord{
+			{
+				Key:   msg.Topic,
+				Value: msg,
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, k.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", kafkaContentType)
+	req.Header.Set("Accept", kafkaAccept)
+	if k.cfg.User != "" {
+		req.SetBasicAuth(k.cfg.User, k.cfg.Password)
+	}
+
+	rsp, err := k.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+
+	b, err := ioutil.ReadAll(io.LimitReader(rsp.Body, 1<<16))
+	if err != nil {
+		return err
+	}
+
+	if rsp.StatusCode < 200 || rsp.StatusCode > 299 {
+		var e kafkaErrorResponse
+		if err := json.Unmarshal(b, &e); err == nil && e.Message != "" {
+			return fmt.Errorf("kafka rest proxy responded with status %d: %s (error code %d)", rsp.StatusCode, e.Message, e.ErrorCode)
+		}
+		return fmt.Errorf("kafka rest proxy responded with status %d", rsp.StatusCode)
+	}
+
+	// The proxy responds with 200 even if producing a record failed, with the error in its offset
+	var pr kafkaProduceResponse
+	if err := json.Unmarshal(b, &pr); err != nil {
+		return fmt.Errorf("kafka rest proxy response invalid: %v", err)
+	}
+
+	if len(pr.Offsets) != 1 {
+		return fmt.Errorf("kafka rest proxy returned %d offsets for 1 record", len(pr.Offsets))
+	}
+
+	if o := pr.Offsets[0]; o.ErrorCode != nil || o.Error != nil {
+		var msg string
+		if o.Error != nil {
+			msg = *o.Error
+		}
+		var code int
+		if o.ErrorCode != nil {
+			code = *o.ErrorCode
+		}
+		return fmt.Errorf("kafka produce failed: %s (error code %d)", msg, code)
+	}
+
+	return nil
+}
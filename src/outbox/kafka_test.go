@@ -0,0 +1,105 @@
+package outbox
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKafkaRelay(t *testing.T) {
+	var status int
+	var response string
+	var received kafkaProduceRequest
+	var path, user, pass string
+	var header http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPost, r.Method)
+
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(body, &received))
+
+		path = r.URL.Path
+		header = r.Header
+		user, pass, _ = r.BasicAuth()
+
+		w.WriteHeader(status)
+		w.Write([]byte(response)) // nolint: errcheck
+	}))
+	defer srv.Close()
+
+	msg := Message{
+		ID:        7,
+		Topic:     "deposit.lifecycle",
+		CreatedAt: 1500000000,
+		Payload:   json.RawMessage(`{"type":"bound"}`),
+	}
+
+	r, err := NewKafkaRelay(KafkaConfig{
+		ProxyURL: srv.URL + "/",
+		Topic:    "teller.deposits",
+	})
+	require.NoError(t, err)
+
+	status = http.StatusOK
+	response = `{"key_schema_id":null,"value_schema_id":null,"offsets":[{"partition":0,"offset":12,"error_code":null,"error":null}]}`
+	require.NoError(t, r.Relay(msg))
+	require.Equal(t, "/topics/teller.deposits", path)
+	require.Equal(t, kafkaContentType, header.Get("Content-Type"))
+	require.Equal(t, kafkaProduceRequest{
+		Records: []kafkaRecord{
+			{
+				Key:   "deposit.lifecycle",
+				Value: msg,
+			},
+		},
+	}, received)
+	require.Empty(t, user)
+
+	// A record that failed to be produced fails the message
+	response = `{"offsets":[{"partition":null,"offset":null,"error_code":50002,"error":"Kafka error: leader not available"}]}`
+	err = r.Relay(msg)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "leader not available")
+
+	// Non-2xx responses fail
+	status = http.StatusNotFound
+	response = `{"error_code":40401,"message":"Topic teller.deposits not found."}`
+	err = r.Relay(msg)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "not found")
+
+	status = http.StatusBadGateway
+	response = ""
+	require.Error(t, r.Relay(msg))
+
+	// The user is sent with basic auth
+	r, err = NewKafkaRelay(KafkaConfig{
+		ProxyURL: srv.URL,
+		Topic:    "teller.deposits",
+		User:     "user",
+		Password: "pass",
+	})
+	require.NoError(t, err)
+
+	status = http.StatusOK
+	response = `{"offsets":[{"partition":0,"offset":13}]}`
+	require.NoError(t, r.Relay(msg))
+	require.Equal(t, "user", user)
+	require.Equal(t, "pass", pass)
+
+	_, err = NewKafkaRelay(KafkaConfig{
+		ProxyURL: "kafka://localhost:9092",
+		Topic:    "teller.deposits",
+	})
+	require.Error(t, err)
+
+	_, err = NewKafkaRelay(KafkaConfig{
+		ProxyURL: srv.URL,
+	})
+	require.Error(t, err)
+}
@@ -0,0 +1,232 @@
+package outbox
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	natsDefaultPort = "4222"
+	natsTimeout     = time.Second * 10
+)
+
+// natsConnectOptions is the payload of the NATS CONNECT message
+type natsConnectOptions struct {
+	Verbose   bool   `json:"verbose"`
+	Pedantic  bool   `json:"pedantic"`
+	Name      string `json:"name"`
+	Lang      string `json:"lang"`
+	Version   string `json:"version"`
+	User      string `json:"user,omitempty"`
+	Pass      string `json:"pass,omitempty"`
+	AuthToken string `json:"auth_token,omitempty"`
+}
+
+// NATSConfig configures the NATSRelay
+type NATSConfig struct {
+	// URL of the server, nats://host[:port], or tls:// to connect with TLS
+	URL     string
+	Subject string
+	// User and Password, or Token, authenticate with the server if set
+	User     string
+	Password string
+	Token    string
+}
+
+// NATSRelay publishes messages as JSON to a NATS subject. The connection is kept open between
+// messages, and reopened after a failure. A message is relayed once the server answered the PING
+// that follows it, which it does only after processing the PUB, so a message written to a broken
+// connection is retried. Not safe for concurrent use, a Dispatcher relays one message at a time.
+type NATSRelay struct {
+	cfg  NATSConfig
+	url  *url.URL
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// NewNATSRelay creates a NATSRelay
+func NewNATSRelay(cfg NATSConfig) (*NATSRelay, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("nats url invalid: %v", err)
+	}
+
+	if u.Scheme != "nats" && u.Scheme != "tls" {
+		return nil, errors.New("nats url must be a nats:// or tls:// URL")
+	}
+
+	if u.Hostname() == "" {
+		return nil, errors.New("nats url has no host")
+	}
+
+	if cfg.Subject == "" || strings.ContainsAny(cfg.Subject, " \t\r\n") {
+		return nil, errors.New("nats subject must be set and have no whitespace")
+	}
+
+	return &NATSRelay{
+		cfg: cfg,
+		url: u,
+	}, nil
+}
+
+// Relay publishes the message to the subject
+func (n *NATSRelay) Relay(msg Message) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	if n.conn == nil {
+		if err := n.connect(); err != nil {
+			return err
+		}
+	}
+
+	if err := n.publish(body); err != nil {
+		n.Close() // nolint: errcheck
+		return err
+	}
+
+	return nil
+}
+
+// Close closes the connection to the server, if it is open
+func (n *NATSRelay) Close() error {
+	if n.conn == nil {
+		return nil
+	}
+
+	err := n.conn.Close()
+	n.conn = nil
+	n.r = nil
+	return err
+}
+
+func (n *NATSRelay) connect() error {
+	port := n.url.Port()
+	if port == "" {
+		port = natsDefaultPort
+	}
+
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(n.url.Hostname(), port), natsTimeout)
+	if err != nil {
+		return err
+	}
+
+	if err := conn.SetDeadline(time.Now().Add(natsTimeout)); err != nil {
+		conn.Close()
+		return err
+	}
+
+	// The server greets with INFO, in plain text even if the connection is upgraded to TLS
+	r := bufio.NewReader(conn)
+	line, err := natsReadLine(r)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	if !strings.HasPrefix(line, "INFO ") {
+		conn.Close()
+		return fmt.Errorf("nats: expected INFO from the server, got %q", line)
+	}
+
+	if n.url.Scheme == "tls" {
+		tlsConn := tls.Client(conn, &tls.Config{
+			ServerName: n.url.Hostname(),
+		})
+		if err := tlsConn.Handshake(); err != nil {
+			conn.Close()
+			return err
+		}
+
+		conn = tlsConn
+		r = bufio.NewReader(conn)
+	}
+
+	opts := natsConnectOptions{
+		Name:      "teller",
+		Lang:      "go",
+		Version:   "1",
+		User:      n.cfg.User,
+		Pass:      n.cfg.Password,
+		AuthToken: n.cfg.Token,
+	}
+
+	b, err := json.Marshal(opts)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	n.conn = conn
+	n.r = r
+
+	// The server answers the PING with PONG once it accepted the CONNECT, or with -ERR
+	if _, err := fmt.Fprintf(conn, "CONNECT %s\r\nPING\r\n", b); err != nil {
+		n.Close() // nolint: errcheck
+		return err
+	}
+
+	if err := n.waitPong(); err != nil {
+		n.Close() // nolint: errcheck
+		return err
+	}
+
+	return nil
+}
+
+func (n *NATSRelay) publish(body []byte) error {
+	if err := n.conn.SetDeadline(time.Now().Add(natsTimeout)); err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(n.conn)
+	fmt.Fprintf(w, "PUB %s %d\r\n", n.cfg.Subject, len(body)) // nolint: errcheck
+	w.Write(body)                                             // nolint: errcheck
+	w.WriteString("\r\nPING\r\n")                             // nolint: errcheck
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	return n.waitPong()
+}
+
+// waitPong reads until the server answers PING, answering its own PINGs meanwhile
+func (n *NATSRelay) waitPong() error {
+	for {
+		line, err := natsReadLine(n.r)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			if _, err := n.conn.Write([]byte("PONG\r\n")); err != nil {
+				return err
+			}
+		case line == "+OK", strings.HasPrefix(line, "INFO "):
+		case strings.HasPrefix(line, "-ERR"):
+			return fmt.Errorf("nats: %s", strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		default:
+			return fmt.Errorf("nats: unexpected message from the server %q", line)
+		}
+	}
+}
+
+func natsReadLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
@@ -0,0 +1,200 @@
+package outbox
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeNATSServer accepts NATS connections and records the CONNECT options and the published messages.
+// A PUB is answered with -ERR if its subject is "fail".
+type fakeNATSServer struct {
+	ln       net.Listener
+	connects chan natsConnectOptions
+	pubs     chan Message
+}
+
+func newFakeNATSServer(t *testing.T) *fakeNATSServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	s := &fakeNATSServer{
+		ln:       ln,
+		connects: make(chan natsConnectOptions, 10),
+		pubs:     make(chan Message, 10),
+	}
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+
+	return s
+}
+
+func (s *fakeNATSServer) url() string {
+	return "nats://" + s.ln.Addr().String()
+}
+
+func (s *fakeNATSServer) serve(conn net.Conn) {
+	defer conn.Close()
+
+	fmt.Fprint(conn, "INFO {\"server_id\":\"test\"}\r\n")
+
+	r := bufio.NewReader(conn)
+	for {
+		line, err := natsReadLine(r)
+		if err != nil {
+			return
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "CONNECT":
+			var opts natsConnectOptions
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "CONNECT ")), &opts); err != nil {
+				return
+			}
+			s.connects <- opts
+
+		case "PUB":
+			n, err := strconv.Atoi(fields[2])
+			if err != nil {
+				return
+			}
+
+			payload := make([]byte, n+2)
+			if _, err := io.ReadFull(r, payload); err != nil {
+				return
+			}
+
+			if fields[1] == "fail" {
+				fmt.Fprint(conn, "-ERR 'Permissions Violation for Publish to fail'\r\n")
+				continue
+			}
+
+			var msg Message
+			if err := json.Unmarshal(payload[:n], &msg); err != nil {
+				return
+			}
+			s.pubs <- msg
+
+		case "PING":
+			// Test that the relay answers the server's PINGs while it waits for its PONG
+			fmt.Fprint(conn, "PING\r\n+OK\r\n")
+			if line, err := natsReadLine(r); err != nil || line != "PONG" {
+				return
+			}
+			fmt.Fprint(conn, "PONG\r\n")
+		}
+	}
+}
+
+func TestNATSRelay(t *testing.T) {
+	s := newFakeNATSServer(t)
+	defer s.ln.Close()
+
+	msg := Message{
+		ID:        7,
+		Topic:     "deposit.lifecycle",
+		CreatedAt: 1500000000,
+		Payload:   json.RawMessage(`{"type":"bound"}`),
+	}
+
+	r, err := NewNATSRelay(NATSConfig{
+		URL:      s.url(),
+		Subject:  "teller.deposits",
+		User:     "user",
+		Password: "pass",
+	})
+	require.NoError(t, err)
+	defer r.Close()
+
+	require.NoError(t, r.Relay(msg))
+	require.Equal(t, natsConnectOptions{
+		Name:    "teller",
+		Lang:    "go",
+		Version: "1",
+		User:    "user",
+		Pass:    "pass",
+	}, <-s.connects)
+	require.Equal(t, msg, <-s.pubs)
+
+	// The connection is reused
+	msg.ID = 8
+	require.NoError(t, r.Relay(msg))
+	require.Equal(t, msg, <-s.pubs)
+	require.Len(t, s.connects, 0)
+
+	// The connection is reopened after it broke
+	r.conn.Close()
+	msg.ID = 9
+	require.Error(t, r.Relay(msg))
+	require.NoError(t, r.Relay(msg))
+	require.Equal(t, msg, <-s.pubs)
+	require.Len(t, s.connects, 1)
+	<-s.connects
+
+	r, err = NewNATSRelay(NATSConfig{
+		URL:     s.url(),
+		Subject: "fail",
+		Token:   "token",
+	})
+	require.NoError(t, err)
+	defer r.Close()
+
+	// -ERR fails the message
+	err = r.Relay(msg)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Permissions Violation")
+
+	opts := <-s.connects
+	require.Equal(t, "token", opts.AuthToken)
+	require.Empty(t, opts.User)
+}
+
+func TestNewNATSRelay(t *testing.T) {
+	for _, cfg := range []NATSConfig{
+		{URL: "http://localhost:4222", Subject: "teller"},
+		{URL: "nats://", Subject: "teller"},
+		{URL: "nats://localhost"},
+		{URL: "nats://localhost", Subject: "teller deposits"},
+	} {
+		_, err := NewNATSRelay(cfg)
+		require.Error(t, err, "%+v", cfg)
+	}
+
+	r, err := NewNATSRelay(NATSConfig{
+		URL:     "tls://localhost",
+		Subject: "teller.deposits",
+	})
+	require.NoError(t, err)
+	require.Equal(t, "tls", r.url.Scheme)
+
+	// Nothing listens, connecting fails
+	s := newFakeNATSServer(t)
+	s.ln.Close()
+
+	r, err = NewNATSRelay(NATSConfig{
+		URL:     s.url(),
+		Subject: "teller.deposits",
+	})
+	require.NoError(t, err)
+	require.Error(t, r.Relay(Message{}))
+}
@@ -0,0 +1,176 @@
+// Package outbox implements a transactional outbox. Messages are saved in the same
+// db transaction as the state change that emits them, and are relayed afterwards by a
+// Dispatcher, so that no message is lost, and none is sent for a rolled back change.
+package outbox
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/skycoin/teller/src/util/dbutil"
+)
+
+// DefaultQueue is the bucket of the messages relayed to the deposit status webhook.
+// Each queue is a bucket of the messages waiting to be relayed, zero-padded message ID as key.
+// Other consumers have their own queue, relayed by their own Dispatcher, so that a consumer
+// that is down doesn't hold up the others.
+const DefaultQueue = "outbox"
+
+// Message is an event waiting to be relayed
+type Message struct {
+	ID        uint64          `json:"id"`
+	Topic     string          `json:"topic"`
+	CreatedAt int64           `json:"created_at"`
+	Payload   json.RawMessage `json:"payload"`
+}
+
+// msgKey returns the bucket key of a message ID. Keys are zero-padded so that
+// bolt iterates them in ID order.
+func msgKey(id uint64) string {
+	return fmt.Sprintf("%020d", id)
+}
+
+// PutTx adds a message to the outbox, inside of tx. The message is relayed only
+// if tx is committed.
+func PutTx(tx *bolt.Tx, topic string, payload interface{}) (Message, error) {
+	return PutQueueTx(tx, DefaultQueue, topic, payload)
+}
+
+// PutQueueTx adds a message to the outbox queue, inside of tx
+func PutQueueTx(tx *bolt.Tx, queue, topic string, payload interface{}) (Message, error) {
+	bkt := []byte(queue)
+	if _, err := tx.CreateBucketIfNotExists(bkt); err != nil {
+		return Message{}, dbutil.NewCreateBucketFailedErr(bkt, err)
+	}
+
+	v, err := json.Marshal(payload)
+	if err != nil {
+		return Message{}, fmt.Errorf("encode outbox payload failed: %v", err)
+	}
+
+	id, err := dbutil.NextSequence(tx, bkt)
+	if err != nil {
+		return Message{}, err
+	}
+
+	msg := Message{
+		ID:        id,
+		Topic:     topic,
+		CreatedAt: time.Now().UTC().Unix(),
+		Payload:   v,
+	}
+
+	if err := dbutil.PutBucketValue(tx, bkt, msgKey(id), msg); err != nil {
+		return Message{}, err
+	}
+
+	return msg, nil
+}
+
+// Store reads and removes the messages of an outbox queue
+type Store struct {
+	db  *bolt.DB
+	bkt []byte
+}
+
+// NewStore creates a Store of the DefaultQueue
+func NewStore(db *bolt.DB) (*Store, error) {
+	return NewQueueStore(db, DefaultQueue)
+}
+
+// NewQueueStore creates a Store of an outbox queue
+func NewQueueStore(db *bolt.DB, queue string) (*Store, error) {
+	if db == nil {
+		return nil, errors.New("new outbox Store failed, db is nil")
+	}
+
+	if queue == "" {
+		return nil, errors.New("new outbox Store failed, queue is empty")
+	}
+
+	bkt := []byte(queue)
+	if err := db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(bkt); err != nil {
+			return dbutil.NewCreateBucketFailedErr(bkt, err)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return &Store{
+		db:  db,
+		bkt: bkt,
+	}, nil
+}
+
+// Put adds a message to the outbox queue in its own transaction
+func (s *Store) Put(topic string, payload interface{}) (Message, error) {
+	var msg Message
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		var err error
+		msg, err = PutQueueTx(tx, string(s.bkt), topic, payload)
+		return err
+	})
+	return msg, err
+}
+
+// Pending returns up to n messages waiting to be relayed, oldest first.
+// If n is 0, all messages are returned.
+func (s *Store) Pending(n int) ([]Message, error) {
+	var msgs []Message
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket(s.bkt)
+		if bkt == nil {
+			return dbutil.NewBucketNotExistErr(s.bkt)
+		}
+
+		c := bkt.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			var msg Message
+			if err := json.Unmarshal(v, &msg); err != nil {
+				return fmt.Errorf("decode outbox message %s failed: %v", k, err)
+			}
+
+			msgs = append(msgs, msg)
+
+			if n > 0 && len(msgs) == n {
+				break
+			}
+		}
+
+		return nil
+	})
+	return msgs, err
+}
+
+// Delete removes a relayed message from the outbox
+func (s *Store) Delete(id uint64) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket(s.bkt)
+		if bkt == nil {
+			return dbutil.NewBucketNotExistErr(s.bkt)
+		}
+
+		return bkt.Delete([]byte(msgKey(id)))
+	})
+}
+
+// Len returns the number of messages waiting to be relayed
+func (s *Store) Len() (int, error) {
+	var n int
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket(s.bkt)
+		if bkt == nil {
+			return dbutil.NewBucketNotExistErr(s.bkt)
+		}
+
+		n = bkt.Stats().KeyN
+		return nil
+	})
+	return n, err
+}
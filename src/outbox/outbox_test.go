@@ -0,0 +1,138 @@
+package outbox
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+func TestStore(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	s, err := NewStore(db)
+	require.NoError(t, err)
+
+	// Messages are returned in ID order, past the point where
+	// unpadded keys would sort differently
+	for i := 0; i < 12; i++ {
+		msg, err := s.Put("test", map[string]int{"n": i})
+		require.NoError(t, err)
+		require.Equal(t, uint64(i+1), msg.ID)
+		require.NotEmpty(t, msg.CreatedAt)
+	}
+
+	msgs, err := s.Pending(0)
+	require.NoError(t, err)
+	require.Len(t, msgs, 12)
+	for i, msg := range msgs {
+		require.Equal(t, uint64(i+1), msg.ID)
+		require.Equal(t, "test", msg.Topic)
+
+		var v map[string]int
+		require.NoError(t, json.Unmarshal(msg.Payload, &v))
+		require.Equal(t, i, v["n"])
+	}
+
+	msgs, err = s.Pending(5)
+	require.NoError(t, err)
+	require.Len(t, msgs, 5)
+	require.Equal(t, uint64(5), msgs[4].ID)
+
+	require.NoError(t, s.Delete(1))
+	require.NoError(t, s.Delete(2))
+
+	n, err := s.Len()
+	require.NoError(t, err)
+	require.Equal(t, 10, n)
+
+	msgs, err = s.Pending(1)
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), msgs[0].ID)
+}
+
+func TestPutTxRollback(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	s, err := NewStore(db)
+	require.NoError(t, err)
+
+	rollbackErr := errors.New("state change failed")
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := PutTx(tx, "test", "rolled back"); err != nil {
+			return err
+		}
+		return rollbackErr
+	})
+	require.Equal(t, rollbackErr, err)
+
+	n, err := s.Len()
+	require.NoError(t, err)
+	require.Equal(t, 0, n)
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := PutTx(tx, "test", "committed")
+		return err
+	})
+	require.NoError(t, err)
+
+	msgs, err := s.Pending(0)
+	require.NoError(t, err)
+	require.Len(t, msgs, 1)
+	require.Equal(t, `"committed"`, string(msgs[0].Payload))
+}
+
+func TestQueueStore(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	s, err := NewStore(db)
+	require.NoError(t, err)
+
+	q, err := NewQueueStore(db, "outbox_test")
+	require.NoError(t, err)
+
+	_, err = NewQueueStore(db, "")
+	require.Error(t, err)
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := PutTx(tx, "test", "default"); err != nil {
+			return err
+		}
+		_, err := PutQueueTx(tx, "outbox_test", "test", "queue")
+		return err
+	})
+	require.NoError(t, err)
+
+	_, err = q.Put("test", "queue put")
+	require.NoError(t, err)
+
+	// Each queue has its own messages and IDs
+	msgs, err := s.Pending(0)
+	require.NoError(t, err)
+	require.Len(t, msgs, 1)
+	require.Equal(t, `"default"`, string(msgs[0].Payload))
+
+	msgs, err = q.Pending(0)
+	require.NoError(t, err)
+	require.Len(t, msgs, 2)
+	require.Equal(t, uint64(1), msgs[0].ID)
+	require.Equal(t, `"queue"`, string(msgs[0].Payload))
+	require.Equal(t, uint64(2), msgs[1].ID)
+
+	require.NoError(t, q.Delete(1))
+
+	n, err := s.Len()
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+
+	n, err = q.Len()
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+}
@@ -0,0 +1,95 @@
+package outbox
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// EventIDHeader is the webhook request header with the message ID
+	EventIDHeader = "X-Teller-Event-Id"
+	// EventTopicHeader is the webhook request header with the message topic
+	EventTopicHeader = "X-Teller-Event-Topic"
+	// SignatureHeader is the webhook request header with the hex HMAC-SHA256
+	// of the request body, keyed with the webhook secret, as "sha256=<hex>"
+	SignatureHeader = "X-Teller-Signature"
+
+	webhookTimeout = time.Second * 10
+)
+
+// WebhookRelay relays messages by POSTing them as JSON to a URL.
+// Any response status other than 2xx is a failure, and the message is retried.
+type WebhookRelay struct {
+	url    string
+	secret string
+	client *http.Client
+}
+
+// NewWebhookRelay creates a WebhookRelay. If secret is set, requests are signed with it.
+func NewWebhookRelay(url, secret string) (*WebhookRelay, error) {
+	if url == "" {
+		return nil, errors.New("webhook url is empty")
+	}
+
+	return &WebhookRelay{
+		url:    url,
+		secret: secret,
+		client: &http.Client{
+			Timeout: webhookTimeout,
+		},
+	}, nil
+}
+
+// Relay POSTs the message to the webhook URL
+func (w *WebhookRelay) Relay(msg Message) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventIDHeader, strconv.FormatUint(msg.ID, 10))
+	req.Header.Set(EventTopicHeader, msg.Topic)
+	if w.secret != "" {
+		req.Header.Set(SignatureHeader, Sign(w.secret, body))
+	}
+
+	rsp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+
+	// Drain the body so that the connection can be reused
+	if _, err := io.Copy(ioutil.Discard, io.LimitReader(rsp.Body, 1<<16)); err != nil {
+		return err
+	}
+
+	if rsp.StatusCode < 200 || rsp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded with status %d", rsp.StatusCode)
+	}
+
+	return nil
+}
+
+// Sign returns the SignatureHeader value of a webhook request body
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body) // nolint: errcheck
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,70 @@
+package outbox
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookRelay(t *testing.T) {
+	var status int
+	var received Message
+	var header http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPost, r.Method)
+
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(body, &received))
+
+		header = r.Header
+		if r.Header.Get(SignatureHeader) != "" {
+			require.Equal(t, Sign("secret", body), r.Header.Get(SignatureHeader))
+		}
+
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	msg := Message{
+		ID:        7,
+		Topic:     "deposit.status",
+		CreatedAt: 1500000000,
+		Payload:   json.RawMessage(`{"seq":1}`),
+	}
+
+	r, err := NewWebhookRelay(srv.URL, "secret")
+	require.NoError(t, err)
+
+	status = http.StatusOK
+	require.NoError(t, r.Relay(msg))
+	require.Equal(t, msg, received)
+	require.Equal(t, "7", header.Get(EventIDHeader))
+	require.Equal(t, "deposit.status", header.Get(EventTopicHeader))
+	require.Equal(t, "application/json", header.Get("Content-Type"))
+	require.NotEmpty(t, header.Get(SignatureHeader))
+
+	// Non-2xx responses fail
+	status = http.StatusInternalServerError
+	require.Error(t, r.Relay(msg))
+
+	// Without a secret, requests are not signed
+	r, err = NewWebhookRelay(srv.URL, "")
+	require.NoError(t, err)
+
+	status = http.StatusNoContent
+	require.NoError(t, r.Relay(msg))
+	require.Empty(t, header.Get(SignatureHeader))
+
+	_, err = NewWebhookRelay("", "")
+	require.Error(t, err)
+}
+
+func TestSign(t *testing.T) {
+	// echo -n '{"id":1}' | openssl dgst -sha256 -hmac secret
+	require.Equal(t, "sha256=03def589620c813f198fd03d7967e292b163ef0435ebf43071ce0e9519763cb7", Sign("secret", []byte(`{"id":1}`)))
+}
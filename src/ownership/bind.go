@@ -0,0 +1,58 @@
+package ownership
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/skycoin/skycoin/src/cipher"
+)
+
+// ErrInvalidTimestamp is returned if the timestamp of a signed bind is more than the maximum clock skew off
+var ErrInvalidTimestamp = errors.New("Invalid timestamp")
+
+// BindVerifier verifies bind requests signed with the secret key of their skycoin address,
+// so that only the owner of a skycoin address can bind deposit addresses to it
+type BindVerifier struct {
+	maxClockSkew time.Duration
+	now          func() time.Time
+}
+
+// NewBindVerifier creates a BindVerifier, which accepts signatures with a timestamp at most maxClockSkew off
+func NewBindVerifier(maxClockSkew time.Duration) *BindVerifier {
+	return &BindVerifier{
+		maxClockSkew: maxClockSkew,
+		now:          time.Now,
+	}
+}
+
+// BindMessage returns the message of a bind request that is signed: "teller bind", the unix time of the
+// request in seconds, the skycoin address, the coin type and the amount, separated by newlines
+func BindMessage(timestamp int64, skyAddr, coinType, amount string) string {
+	return fmt.Sprintf("teller bind\n%d\n%s\n%s\n%s", timestamp, skyAddr, coinType, amount)
+}
+
+// SignBind returns the hex signature of a bind request, made with the secret key of its skycoin address
+func SignBind(timestamp int64, skyAddr, coinType, amount string, seckey cipher.SecKey) string {
+	return cipher.SignHash(cipher.SumSHA256([]byte(BindMessage(timestamp, skyAddr, coinType, amount))), seckey).Hex()
+}
+
+// Verify verifies that sig is a hex signature of the SHA256 of the BindMessage of a bind request,
+// made with the secret key of skyAddr, and that timestamp is at most the maximum clock skew off.
+// Returns ErrInvalidSignature or ErrInvalidTimestamp if the request is not verified.
+func (v *BindVerifier) Verify(timestamp int64, skyAddr, coinType, amount, sig string) error {
+	msg := BindMessage(timestamp, skyAddr, coinType, amount)
+	if err := verifySignature(skyAddr, cipher.SumSHA256([]byte(msg)), sig); err != nil {
+		return err
+	}
+
+	skew := v.now().Sub(time.Unix(timestamp, 0))
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > v.maxClockSkew {
+		return ErrInvalidTimestamp
+	}
+
+	return nil
+}
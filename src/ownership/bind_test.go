@@ -0,0 +1,44 @@
+package ownership
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/skycoin/src/cipher"
+)
+
+func TestBindVerifier(t *testing.T) {
+	pub, sec := cipher.GenerateKeyPair()
+	skyAddr := cipher.AddressFromPubKey(pub).String()
+
+	_, otherSec := cipher.GenerateKeyPair()
+
+	v := NewBindVerifier(time.Minute)
+
+	now := time.Unix(1500000000, 0)
+	v.now = func() time.Time {
+		return now
+	}
+
+	ts := now.Unix()
+	sig := SignBind(ts, skyAddr, "BTC", "0.01", sec)
+	require.NoError(t, v.Verify(ts, skyAddr, "BTC", "0.01", sig))
+
+	// The signature covers every field
+	require.Equal(t, ErrInvalidSignature, v.Verify(ts, skyAddr, "LTC", "0.01", sig))
+	require.Equal(t, ErrInvalidSignature, v.Verify(ts, skyAddr, "BTC", "", sig))
+	require.Equal(t, ErrInvalidSignature, v.Verify(ts+1, skyAddr, "BTC", "0.01", sig))
+
+	// Signed by another key
+	require.Equal(t, ErrInvalidSignature, v.Verify(ts, skyAddr, "BTC", "0.01", SignBind(ts, skyAddr, "BTC", "0.01", otherSec)))
+	require.Equal(t, ErrInvalidSignature, v.Verify(ts, skyAddr, "BTC", "0.01", "zz"))
+	require.Equal(t, ErrInvalidSignature, v.Verify(ts, "bad", "BTC", "0.01", sig))
+
+	// Timestamps beyond the clock skew
+	for _, d := range []time.Duration{time.Minute + time.Second, -time.Minute - time.Second} {
+		ts := now.Add(d).Unix()
+		require.Equal(t, ErrInvalidTimestamp, v.Verify(ts, skyAddr, "BTC", "0.01", SignBind(ts, skyAddr, "BTC", "0.01", sec)))
+	}
+}
@@ -0,0 +1,141 @@
+// Package ownership issues challenges to prove the ownership of a skycoin address, by signing a
+// server-issued nonce with the secret key of the address, and verifies binds signed with it.
+//
+// Nonces are not stored: a nonce carries its expiry and an HMAC over the skycoin address it was issued for,
+// so that any teller instance with the same secret can verify it. A signed nonce can be used until it expires,
+// e.g. to poll the deposit status.
+package ownership
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/skycoin/skycoin/src/cipher"
+)
+
+const nonceRandomLen = 16
+
+var (
+	// ErrInvalidNonce is returned if a nonce was not issued by the Challenger, or for another skycoin address
+	ErrInvalidNonce = errors.New("Invalid nonce")
+	// ErrNonceExpired is returned if a nonce has expired
+	ErrNonceExpired = errors.New("Nonce expired")
+	// ErrInvalidSignature is returned if a signature is not a signature of the nonce by the skycoin address
+	ErrInvalidSignature = errors.New("Invalid signature")
+)
+
+// Challenge is a nonce to be signed with the secret key of a skycoin address
+type Challenge struct {
+	Nonce string `json:"nonce"`
+	// SHA256 of the nonce, which is signed
+	Hash      string `json:"hash"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+// Challenger issues and verifies ownership challenges
+type Challenger struct {
+	secret []byte
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+// NewChallenger creates a Challenger. secret is the HMAC key of the nonces, a random key is used if it is empty.
+// Nonces expire after ttl.
+func NewChallenger(secret []byte, ttl time.Duration) (*Challenger, error) {
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Challenger{
+		secret: secret,
+		ttl:    ttl,
+		now:    time.Now,
+	}, nil
+}
+
+// Issue returns a new challenge for skyAddr
+func (c *Challenger) Issue(skyAddr string) (Challenge, error) {
+	b := make([]byte, nonceRandomLen)
+	if _, err := rand.Read(b); err != nil {
+		return Challenge{}, err
+	}
+
+	expiresAt := c.now().Add(c.ttl).Unix()
+	random := hex.EncodeToString(b)
+	nonce := fmt.Sprintf("%d.%s.%s", expiresAt, random, c.mac(skyAddr, expiresAt, random))
+
+	return Challenge{
+		Nonce:     nonce,
+		Hash:      Hash(nonce).Hex(),
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+// Verify verifies that nonce was issued for skyAddr and has not expired, and that sig is a hex signature
+// of the hash of the nonce made with the secret key of skyAddr
+func (c *Challenger) Verify(skyAddr, nonce, sig string) error {
+	parts := strings.Split(nonce, ".")
+	if len(parts) != 3 {
+		return ErrInvalidNonce
+	}
+
+	expiresAt, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return ErrInvalidNonce
+	}
+
+	if !hmac.Equal([]byte(parts[2]), []byte(c.mac(skyAddr, expiresAt, parts[1]))) {
+		return ErrInvalidNonce
+	}
+
+	if c.now().Unix() >= expiresAt {
+		return ErrNonceExpired
+	}
+
+	return verifySignature(skyAddr, Hash(nonce), sig)
+}
+
+func (c *Challenger) mac(skyAddr string, expiresAt int64, random string) string {
+	m := hmac.New(sha256.New, c.secret)
+	fmt.Fprintf(m, "%s\n%d\n%s", skyAddr, expiresAt, random)
+	return hex.EncodeToString(m.Sum(nil))
+}
+
+// verifySignature verifies that sig is a hex signature of hash made with the secret key of skyAddr
+func verifySignature(skyAddr string, hash cipher.SHA256, sig string) error {
+	addr, err := cipher.DecodeBase58Address(skyAddr)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	s, err := cipher.SigFromHex(sig)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	if err := cipher.ChkSig(addr, hash, s); err != nil {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+// Hash returns the hash of a nonce, which is signed with the secret key of the skycoin address
+func Hash(nonce string) cipher.SHA256 {
+	return cipher.SumSHA256([]byte(nonce))
+}
+
+// Sign returns the hex signature of a nonce, made with the secret key of a skycoin address
+func Sign(nonce string, seckey cipher.SecKey) string {
+	return cipher.SignHash(Hash(nonce), seckey).Hex()
+}
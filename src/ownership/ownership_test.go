@@ -0,0 +1,61 @@
+package ownership
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/skycoin/src/cipher"
+)
+
+func TestChallenger(t *testing.T) {
+	pub, sec := cipher.GenerateKeyPair()
+	skyAddr := cipher.AddressFromPubKey(pub).String()
+
+	_, otherSec := cipher.GenerateKeyPair()
+
+	c, err := NewChallenger([]byte("secret"), time.Minute)
+	require.NoError(t, err)
+
+	now := time.Unix(1500000000, 0)
+	c.now = func() time.Time {
+		return now
+	}
+
+	ch, err := c.Issue(skyAddr)
+	require.NoError(t, err)
+	require.Equal(t, now.Add(time.Minute).Unix(), ch.ExpiresAt)
+	require.Equal(t, Hash(ch.Nonce).Hex(), ch.Hash)
+
+	sig := Sign(ch.Nonce, sec)
+	require.NoError(t, c.Verify(skyAddr, ch.Nonce, sig))
+
+	// A signed nonce can be used again until it expires
+	require.NoError(t, c.Verify(skyAddr, ch.Nonce, sig))
+
+	// Signed by another key
+	require.Equal(t, ErrInvalidSignature, c.Verify(skyAddr, ch.Nonce, Sign(ch.Nonce, otherSec)))
+	require.Equal(t, ErrInvalidSignature, c.Verify(skyAddr, ch.Nonce, "abcd"))
+
+	// Issued for another address
+	otherPub, _ := cipher.GenerateKeyPair()
+	otherAddr := cipher.AddressFromPubKey(otherPub).String()
+	require.Equal(t, ErrInvalidNonce, c.Verify(otherAddr, ch.Nonce, sig))
+
+	// Tampered expiry
+	parts := strings.Split(ch.Nonce, ".")
+	tampered := "1600000000." + parts[1] + "." + parts[2]
+	require.Equal(t, ErrInvalidNonce, c.Verify(skyAddr, tampered, Sign(tampered, sec)))
+	require.Equal(t, ErrInvalidNonce, c.Verify(skyAddr, "bad", sig))
+
+	// Issued by a Challenger with another secret
+	c2, err := NewChallenger(nil, time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, ErrInvalidNonce, c2.Verify(skyAddr, ch.Nonce, sig))
+
+	// Expired
+	now = now.Add(time.Minute)
+	require.Equal(t, ErrNonceExpired, c.Verify(skyAddr, ch.Nonce, sig))
+}
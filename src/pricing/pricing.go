@@ -0,0 +1,238 @@
+// Package pricing looks up the pricing region of API clients, for sales with
+// region-specific bonuses or minimums
+package pricing
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/skycoin/teller/src/util/mathutil"
+)
+
+// Region is a group of countries with their own pricing
+type Region struct {
+	Name string
+	// ISO 3166-1 alpha-2 country codes
+	Countries []string
+	// Extra SKY given, as a percentage of the exchange rate. Decimal string, empty means 0
+	BonusPercent string
+	// Minimum SKY a deposit must buy, in droplets. 0 means no minimum
+	MinSky uint64
+}
+
+// Validate returns an error if the region is invalid
+func (r Region) Validate() error {
+	if r.Name == "" {
+		return errors.New("Region name missing")
+	}
+
+	if len(r.Countries) == 0 {
+		return fmt.Errorf("Region %s has no countries", r.Name)
+	}
+
+	for _, c := range r.Countries {
+		if len(c) != 2 {
+			return fmt.Errorf("Region %s country %q is not an ISO 3166-1 alpha-2 code", r.Name, c)
+		}
+	}
+
+	if _, err := r.bonus(); err != nil {
+		return fmt.Errorf("Region %s bonus percent invalid: %v", r.Name, err)
+	}
+
+	return nil
+}
+
+func (r Region) bonus() (decimal.Decimal, error) {
+	if r.BonusPercent == "" {
+		return decimal.Zero, nil
+	}
+
+	b, err := mathutil.DecimalFromString(r.BonusPercent)
+	if err != nil {
+		return decimal.Decimal{}, err
+	}
+
+	if b.Sign() < 0 {
+		return decimal.Decimal{}, errors.New("bonus percent can't be negative")
+	}
+
+	return b, nil
+}
+
+// Rate returns an exchange rate increased by the region's bonus
+func (r Region) Rate(rate string) (string, error) {
+	b, err := r.bonus()
+	if err != nil {
+		return "", err
+	}
+
+	if b.Sign() == 0 {
+		return rate, nil
+	}
+
+	d, err := mathutil.DecimalFromString(rate)
+	if err != nil {
+		return "", err
+	}
+
+	hundred := decimal.New(100, 0)
+	return d.Mul(hundred.Add(b)).DivRound(hundred, 8).String(), nil
+}
+
+// Locator looks up the country of the client of a request
+type Locator interface {
+	// Country returns the uppercase ISO 3166-1 alpha-2 country code of the client, or "" if unknown.
+	// remoteIP is the client IP of the request.
+	Country(r *http.Request, remoteIP string) string
+}
+
+// HeaderLocator reads the country from a request header set by a trusted reverse proxy or CDN,
+// such as Cloudflare's CF-IPCountry. The header must not be settable by clients.
+type HeaderLocator string
+
+// Country implements Locator
+func (h HeaderLocator) Country(r *http.Request, remoteIP string) string {
+	c := strings.ToUpper(strings.TrimSpace(r.Header.Get(string(h))))
+	if len(c) != 2 {
+		return ""
+	}
+	return c
+}
+
+type network struct {
+	ipNet   *net.IPNet
+	country string
+}
+
+// NetworkLocator looks up the client IP in a table of networks and their countries
+type NetworkLocator struct {
+	// Most specific networks first
+	networks []network
+}
+
+// NewNetworkLocator reads a CSV table of network,country rows, e.g. "1.0.0.0/24,AU"
+func NewNetworkLocator(table io.Reader) (*NetworkLocator, error) {
+	rd := csv.NewReader(table)
+	rd.FieldsPerRecord = 2
+	rd.Comment = '#'
+
+	var networks []network
+	for {
+		row, err := rd.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		_, ipNet, err := net.ParseCIDR(strings.TrimSpace(row[0]))
+		if err != nil {
+			return nil, err
+		}
+
+		country := strings.ToUpper(strings.TrimSpace(row[1]))
+		if len(country) != 2 {
+			return nil, fmt.Errorf("Invalid country %q of network %s", row[1], row[0])
+		}
+
+		networks = append(networks, network{
+			ipNet:   ipNet,
+			country: country,
+		})
+	}
+
+	if len(networks) == 0 {
+		return nil, errors.New("No networks")
+	}
+
+	sort.SliceStable(networks, func(i, j int) bool {
+		a, _ := networks[i].ipNet.Mask.Size()
+		b, _ := networks[j].ipNet.Mask.Size()
+		return a > b
+	})
+
+	return &NetworkLocator{
+		networks: networks,
+	}, nil
+}
+
+// Country implements Locator
+func (l *NetworkLocator) Country(r *http.Request, remoteIP string) string {
+	ip := net.ParseIP(remoteIP)
+	if ip == nil {
+		return ""
+	}
+
+	for _, n := range l.networks {
+		if n.ipNet.Contains(ip) {
+			return n.country
+		}
+	}
+
+	return ""
+}
+
+// Pricer finds the pricing region of API clients
+type Pricer struct {
+	locator   Locator
+	regions   []Region
+	byCountry map[string]Region
+}
+
+// NewPricer creates a Pricer. A country can only be in one region.
+func NewPricer(locator Locator, regions []Region) (*Pricer, error) {
+	names := make(map[string]struct{}, len(regions))
+	byCountry := make(map[string]Region)
+
+	for _, r := range regions {
+		if err := r.Validate(); err != nil {
+			return nil, err
+		}
+
+		if _, ok := names[r.Name]; ok {
+			return nil, fmt.Errorf("Duplicate region %s", r.Name)
+		}
+		names[r.Name] = struct{}{}
+
+		for _, c := range r.Countries {
+			c = strings.ToUpper(c)
+			if other, ok := byCountry[c]; ok {
+				return nil, fmt.Errorf("Country %s is in regions %s and %s", c, other.Name, r.Name)
+			}
+			byCountry[c] = r
+		}
+	}
+
+	return &Pricer{
+		locator:   locator,
+		regions:   regions,
+		byCountry: byCountry,
+	}, nil
+}
+
+// Region returns the pricing region of the client of a request, with client IP remoteIP.
+// Returns false if the client is not in any region, and gets the default pricing.
+func (p *Pricer) Region(r *http.Request, remoteIP string) (Region, bool) {
+	c := p.locator.Country(r, remoteIP)
+	if c == "" {
+		return Region{}, false
+	}
+
+	region, ok := p.byCountry[c]
+	return region, ok
+}
+
+// Regions returns the pricing regions
+func (p *Pricer) Regions() []Region {
+	return p.regions
+}
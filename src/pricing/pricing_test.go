@@ -0,0 +1,144 @@
+package pricing
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegionRate(t *testing.T) {
+	tt := []struct {
+		name  string
+		bonus string
+		rate  string
+		out   string
+		err   error
+	}{
+		{"no bonus", "", "500", "500", nil},
+		{"zero bonus", "0", "1/3", "1/3", nil},
+		{"10 percent", "10", "500", "550", nil},
+		{"fraction rate", "5", "1/4", "0.2625", nil},
+		{"fractional bonus", "2.5", "100", "102.5", nil},
+		{"negative bonus", "-5", "100", "", errors.New("bonus percent can't be negative")},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			r := Region{
+				Name:         "a",
+				BonusPercent: tc.bonus,
+			}
+
+			rate, err := r.Rate(tc.rate)
+			require.Equal(t, tc.err, err)
+			require.Equal(t, tc.out, rate)
+		})
+	}
+}
+
+func TestHeaderLocator(t *testing.T) {
+	l := HeaderLocator("CF-IPCountry")
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	require.Equal(t, "", l.Country(r, ""))
+
+	r.Header.Set("CF-IPCountry", "de")
+	require.Equal(t, "DE", l.Country(r, ""))
+
+	// Cloudflare's unknown and Tor values
+	r.Header.Set("CF-IPCountry", "XX")
+	require.Equal(t, "XX", l.Country(r, ""))
+	r.Header.Set("CF-IPCountry", "T1")
+	require.Equal(t, "T1", l.Country(r, ""))
+
+	r.Header.Set("CF-IPCountry", "invalid")
+	require.Equal(t, "", l.Country(r, ""))
+}
+
+func TestNetworkLocator(t *testing.T) {
+	table := `# network,country
+10.0.0.0/8,us
+10.1.0.0/16,CA
+2001:db8::/32,JP
+`
+
+	l, err := NewNetworkLocator(strings.NewReader(table))
+	require.NoError(t, err)
+
+	for ip, country := range map[string]string{
+		"10.2.3.4":    "US",
+		"10.1.3.4":    "CA",
+		"2001:db8::1": "JP",
+		"192.168.1.1": "",
+		"invalid":     "",
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		require.Equal(t, country, l.Country(r, ip), ip)
+	}
+
+	_, err = NewNetworkLocator(strings.NewReader("10.0.0.0/33,US\n"))
+	require.Error(t, err)
+
+	_, err = NewNetworkLocator(strings.NewReader("10.0.0.0/8,USA\n"))
+	require.Error(t, err)
+
+	_, err = NewNetworkLocator(strings.NewReader(""))
+	require.Equal(t, errors.New("No networks"), err)
+}
+
+func TestPricer(t *testing.T) {
+	regions := []Region{
+		{
+			Name:         "eu",
+			Countries:    []string{"DE", "fr"},
+			BonusPercent: "10",
+		},
+		{
+			Name:      "asia",
+			Countries: []string{"JP"},
+			MinSky:    10e6,
+		},
+	}
+
+	p, err := NewPricer(HeaderLocator("CF-IPCountry"), regions)
+	require.NoError(t, err)
+	require.Equal(t, regions, p.Regions())
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	_, ok := p.Region(r, "")
+	require.False(t, ok)
+
+	r.Header.Set("CF-IPCountry", "FR")
+	region, ok := p.Region(r, "")
+	require.True(t, ok)
+	require.Equal(t, "eu", region.Name)
+
+	r.Header.Set("CF-IPCountry", "JP")
+	region, ok = p.Region(r, "")
+	require.True(t, ok)
+	require.Equal(t, uint64(10e6), region.MinSky)
+
+	r.Header.Set("CF-IPCountry", "US")
+	_, ok = p.Region(r, "")
+	require.False(t, ok)
+
+	// A country can't be in two regions
+	_, err = NewPricer(HeaderLocator("CF-IPCountry"), append(regions, Region{
+		Name:      "other",
+		Countries: []string{"de"},
+	}))
+	require.Equal(t, errors.New("Country DE is in regions eu and other"), err)
+
+	_, err = NewPricer(HeaderLocator("CF-IPCountry"), append(regions, Region{
+		Name:      "eu",
+		Countries: []string{"IT"},
+	}))
+	require.Equal(t, errors.New("Duplicate region eu"), err)
+
+	_, err = NewPricer(HeaderLocator("CF-IPCountry"), []Region{{Name: "x"}})
+	require.Equal(t, errors.New("Region x has no countries"), err)
+}
@@ -0,0 +1,271 @@
+// Package privacy exports and erases the personal data kept about a skycoin address, for data protection requests.
+// Erasure keeps the financial ledger, the bindings, deposits and sends of the address, and erases the personal
+// metadata around it: the email addresses notified of its deposits, and the remote addresses in the audit logs.
+package privacy
+
+import (
+	"errors"
+	"time"
+
+	"github.com/skycoin/skycoin/src/cipher"
+
+	"github.com/skycoin/teller/src/archive"
+	"github.com/skycoin/teller/src/exchange"
+	"github.com/skycoin/teller/src/notify"
+	"github.com/skycoin/teller/src/settlement"
+	"github.com/skycoin/teller/src/support"
+)
+
+// ErrInvalidSkyAddress is returned for a skycoin address that can't be decoded
+var ErrInvalidSkyAddress = errors.New("Invalid skycoin address")
+
+// Ledger is the exchange store of the bindings and the deposits
+type Ledger interface {
+	GetSkyBindBtcAddresses(skyAddr string) ([]string, error)
+	QueryDepositInfos(q exchange.DepositQuery) ([]exchange.DepositInfo, error)
+	GetSkyAddressEvents(skyAddr string) ([]exchange.DepositEvent, error)
+	EraseSkyAddressRemoteAddrs(skyAddr string) (int, error)
+}
+
+// ArchiveReader reads the deposits archived out of the db
+type ArchiveReader interface {
+	GetSkyAddressDeposits(skyAddr string) ([]archive.Deposit, error)
+}
+
+// SettlementReader reads the settlements of the payouts
+type SettlementReader interface {
+	Settlements(flt settlement.Filter) ([]settlement.Settlement, error)
+}
+
+// SupportTokens keeps the support tokens and their audit log
+type SupportTokens interface {
+	Tokens() ([]support.Token, error)
+	Audit(tokenID uint64) ([]support.AuditEvent, error)
+	EraseSkyAddressRemoteAddrs(skyAddr string) (int, error)
+}
+
+// Subscriptions keeps the email addresses notified of the deposits to the deposit addresses
+type Subscriptions interface {
+	Get(depositAddr string) (notify.Subscription, error)
+	Subscribed(depositAddr string) (bool, error)
+	Delete(depositAddr string) error
+}
+
+// Notification is an email address notified of the deposits to a deposit address
+type Notification struct {
+	DepositAddress string `json:"deposit_address"`
+	Email          string `json:"email"`
+	CreatedAt      int64  `json:"created_at"`
+}
+
+// Export is all that is kept about a skycoin address
+type Export struct {
+	SkyAddress string `json:"skycoin_address"`
+	ExportedAt int64  `json:"exported_at"`
+	// Deposit addresses bound to the skycoin address
+	DepositAddresses []string               `json:"deposit_addresses"`
+	Deposits         []exchange.DepositInfo `json:"deposits"`
+	// Events of the bindings and the deposits, including the bindings that expired or were recycled
+	Events           []exchange.DepositEvent `json:"events"`
+	ArchivedDeposits []archive.Deposit       `json:"archived_deposits"`
+	Settlements      []settlement.Settlement `json:"settlements"`
+	Notifications    []Notification          `json:"notifications"`
+	SupportTokens    []support.Token         `json:"support_tokens"`
+	SupportAudit     []support.AuditEvent    `json:"support_audit"`
+}
+
+// Erasure is the personal data erased of a skycoin address
+type Erasure struct {
+	SkyAddress string `json:"skycoin_address"`
+	// Number of email addresses deleted from the deposit addresses
+	Notifications int `json:"notifications"`
+	// Number of deposit events whose remote address was erased
+	DepositEvents int `json:"deposit_events"`
+	// Number of support audit events whose remote address was erased
+	SupportAuditEvents int `json:"support_audit_events"`
+}
+
+// Manager exports and erases the personal data of skycoin addresses
+type Manager struct {
+	ledger Ledger
+	// Archive is optional, archived deposits are not exported if it is nil
+	Archive ArchiveReader
+	// Settlements is optional, settlements are not exported if it is nil
+	Settlements SettlementReader
+	// SupportTokens is optional, support tokens are not exported or erased if it is nil
+	SupportTokens SupportTokens
+	// Subscriptions is optional, email addresses are not exported or erased if it is nil
+	Subscriptions Subscriptions
+	now           func() time.Time
+}
+
+// New creates a Manager
+func New(ledger Ledger) *Manager {
+	return &Manager{
+		ledger: ledger,
+		now:    time.Now,
+	}
+}
+
+func validSkyAddress(skyAddr string) error {
+	if _, err := cipher.DecodeBase58Address(skyAddr); err != nil {
+		return ErrInvalidSkyAddress
+	}
+	return nil
+}
+
+// Export returns all that is kept about a skycoin address
+func (m *Manager) Export(skyAddr string) (Export, error) {
+	if err := validSkyAddress(skyAddr); err != nil {
+		return Export{}, err
+	}
+
+	e := Export{
+		SkyAddress:       skyAddr,
+		ExportedAt:       m.now().UTC().Unix(),
+		DepositAddresses: []string{},
+		Deposits:         []exchange.DepositInfo{},
+		Events:           []exchange.DepositEvent{},
+		ArchivedDeposits: []archive.Deposit{},
+		Settlements:      []settlement.Settlement{},
+		Notifications:    []Notification{},
+		SupportTokens:    []support.Token{},
+		SupportAudit:     []support.AuditEvent{},
+	}
+
+	addrs, err := m.ledger.GetSkyBindBtcAddresses(skyAddr)
+	if err != nil {
+		return Export{}, err
+	}
+	e.DepositAddresses = append(e.DepositAddresses, addrs...)
+
+	// The index of the skycoin address has the deposits to the addresses that were recycled too
+	dis, err := m.ledger.QueryDepositInfos(exchange.DepositQuery{
+		SkyAddress: skyAddr,
+	})
+	if err != nil {
+		return Export{}, err
+	}
+	e.Deposits = append(e.Deposits, dis...)
+
+	evs, err := m.ledger.GetSkyAddressEvents(skyAddr)
+	if err != nil {
+		return Export{}, err
+	}
+	e.Events = append(e.Events, evs...)
+
+	if m.Archive != nil {
+		ds, err := m.Archive.GetSkyAddressDeposits(skyAddr)
+		if err != nil {
+			return Export{}, err
+		}
+		e.ArchivedDeposits = append(e.ArchivedDeposits, ds...)
+	}
+
+	if m.Settlements != nil {
+		ss, err := m.Settlements.Settlements(func(s settlement.Settlement) bool {
+			return s.SkyAddress == skyAddr
+		})
+		if err != nil {
+			return Export{}, err
+		}
+		e.Settlements = append(e.Settlements, ss...)
+	}
+
+	// Subscriptions are deleted when their deposit address is unbound,
+	// so only the bound deposit addresses can have one of the skycoin address
+	if m.Subscriptions != nil {
+		for _, a := range addrs {
+			sub, err := m.Subscriptions.Get(a)
+			if err == notify.ErrNotSubscribed {
+				continue
+			} else if err != nil {
+				return Export{}, err
+			}
+
+			e.Notifications = append(e.Notifications, Notification{
+				DepositAddress: sub.DepositAddress,
+				Email:          sub.Email,
+				CreatedAt:      sub.CreatedAt,
+			})
+		}
+	}
+
+	if m.SupportTokens != nil {
+		ts, err := m.SupportTokens.Tokens()
+		if err != nil {
+			return Export{}, err
+		}
+
+		for _, t := range ts {
+			if t.SkyAddress == skyAddr {
+				e.SupportTokens = append(e.SupportTokens, t)
+			}
+		}
+
+		aevs, err := m.SupportTokens.Audit(0)
+		if err != nil {
+			return Export{}, err
+		}
+
+		for _, ev := range aevs {
+			if ev.SkyAddress == skyAddr {
+				e.SupportAudit = append(e.SupportAudit, ev)
+			}
+		}
+	}
+
+	return e, nil
+}
+
+// Erase deletes the email addresses notified of the deposits of a skycoin address, and erases the remote
+// addresses from the audit events of its deposits and support tokens. The bindings, deposits and sends are kept.
+// Archives are not rewritten. Erasing again changes nothing, so a failed erasure can be retried.
+func (m *Manager) Erase(skyAddr string) (Erasure, error) {
+	if err := validSkyAddress(skyAddr); err != nil {
+		return Erasure{}, err
+	}
+
+	e := Erasure{
+		SkyAddress: skyAddr,
+	}
+
+	if m.Subscriptions != nil {
+		addrs, err := m.ledger.GetSkyBindBtcAddresses(skyAddr)
+		if err != nil {
+			return Erasure{}, err
+		}
+
+		for _, a := range addrs {
+			ok, err := m.Subscriptions.Subscribed(a)
+			if err != nil {
+				return Erasure{}, err
+			}
+
+			if !ok {
+				continue
+			}
+
+			if err := m.Subscriptions.Delete(a); err != nil {
+				return Erasure{}, err
+			}
+			e.Notifications++
+		}
+	}
+
+	n, err := m.ledger.EraseSkyAddressRemoteAddrs(skyAddr)
+	if err != nil {
+		return Erasure{}, err
+	}
+	e.DepositEvents = n
+
+	if m.SupportTokens != nil {
+		n, err := m.SupportTokens.EraseSkyAddressRemoteAddrs(skyAddr)
+		if err != nil {
+			return Erasure{}, err
+		}
+		e.SupportAuditEvents = n
+	}
+
+	return e, nil
+}
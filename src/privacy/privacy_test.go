@@ -0,0 +1,149 @@
+package privacy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/exchange"
+	"github.com/skycoin/teller/src/notify"
+	"github.com/skycoin/teller/src/scanner"
+	"github.com/skycoin/teller/src/support"
+	"github.com/skycoin/teller/src/util/dbcrypt"
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+const (
+	testSkyAddr  = "2Wbi4wvxC4fkTYMsS2f6HaFfW4pafDjXcQW"
+	testSkyAddr2 = "2GgFvqoyk9RjwVzj8tqfcXVXB4orBwoc9qv"
+)
+
+func TestManager(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	log, _ := testutil.NewLogger(t)
+
+	ledger, err := exchange.NewStore(log, db, nil)
+	require.NoError(t, err)
+
+	c, err := dbcrypt.OpenKey(db, notify.KeyName, "secret")
+	require.NoError(t, err)
+	subs, err := notify.NewStore(db, c)
+	require.NoError(t, err)
+
+	tokens, err := support.NewStore(db, support.Config{
+		DefaultTTL: time.Hour,
+		MaxTTL:     time.Hour,
+	})
+	require.NoError(t, err)
+
+	m := New(ledger)
+	m.Subscriptions = subs
+	m.SupportTokens = tokens
+	m.now = func() time.Time {
+		return time.Unix(1500000000, 0)
+	}
+
+	require.NoError(t, ledger.BindAddress(testSkyAddr, "btcaddr1", "", "", "", 0, 0))
+	require.NoError(t, ledger.BindAddress(testSkyAddr, "btcaddr2", "", "", "", 0, 0))
+	require.NoError(t, ledger.BindAddress(testSkyAddr2, "btcaddr3", "", "", "", 0, 0))
+	require.NoError(t, subs.Subscribe("btcaddr1", "user@example.com"))
+	require.NoError(t, subs.Subscribe("btcaddr3", "other@example.com"))
+
+	_, err = ledger.GetOrCreateDepositInfo(scanner.Deposit{
+		CoinType: scanner.CoinTypeBTC,
+		Address:  "btcaddr1",
+		Value:    1e6,
+		Height:   20,
+		Tx:       "btx1",
+		N:        0,
+	}, "100", 1)
+	require.NoError(t, err)
+
+	_, err = ledger.UpdateDepositInfo("btx1:0", func(di exchange.DepositInfo) exchange.DepositInfo {
+		di.Status = exchange.StatusDone
+		di.Error = exchange.ErrEmptySendAmount.Error()
+		return di
+	})
+	require.NoError(t, err)
+
+	_, err = ledger.ReprocessDepositInfo("btx1:0", "", "retry", "10.0.0.1:1234")
+	require.NoError(t, err)
+
+	token, _, err := tokens.Mint(testSkyAddr, []string{support.ScopeStatus}, 0, "ticket 1", support.Origin{RemoteAddr: "10.0.0.1:1234"})
+	require.NoError(t, err)
+	_, err = tokens.Authorize(token, support.ScopeStatus, support.Origin{RemoteAddr: "1.2.3.4"})
+	require.NoError(t, err)
+	_, _, err = tokens.Mint(testSkyAddr2, []string{support.ScopeStatus}, 0, "ticket 2", support.Origin{RemoteAddr: "10.0.0.1:1234"})
+	require.NoError(t, err)
+
+	_, err = m.Export("bad")
+	require.Equal(t, ErrInvalidSkyAddress, err)
+	_, err = m.Erase("bad")
+	require.Equal(t, ErrInvalidSkyAddress, err)
+
+	e, err := m.Export(testSkyAddr)
+	require.NoError(t, err)
+	require.Equal(t, testSkyAddr, e.SkyAddress)
+	require.Equal(t, int64(1500000000), e.ExportedAt)
+	require.Equal(t, []string{"btcaddr1", "btcaddr2"}, e.DepositAddresses)
+	require.Len(t, e.Deposits, 1)
+	require.Equal(t, "btx1:0", e.Deposits[0].DepositID)
+	// 2 bindings, the deposit created, failed and reset, and the reprocess request
+	require.Len(t, e.Events, 6)
+	require.Equal(t, "10.0.0.1:1234", e.Events[5].RemoteAddr)
+	require.Empty(t, e.ArchivedDeposits)
+	require.Empty(t, e.Settlements)
+	require.Equal(t, []Notification{{
+		DepositAddress: "btcaddr1",
+		Email:          "user@example.com",
+		CreatedAt:      e.Notifications[0].CreatedAt,
+	}}, e.Notifications)
+	require.Len(t, e.SupportTokens, 1)
+	require.Equal(t, "ticket 1", e.SupportTokens[0].IssuedTo)
+	require.Len(t, e.SupportAudit, 2)
+	require.Equal(t, "1.2.3.4", e.SupportAudit[1].RemoteAddr)
+
+	er, err := m.Erase(testSkyAddr)
+	require.NoError(t, err)
+	require.Equal(t, Erasure{
+		SkyAddress:         testSkyAddr,
+		Notifications:      1,
+		DepositEvents:      1,
+		SupportAuditEvents: 2,
+	}, er)
+
+	// The ledger is kept, the personal data is gone
+	e2, err := m.Export(testSkyAddr)
+	require.NoError(t, err)
+	require.Equal(t, e.DepositAddresses, e2.DepositAddresses)
+	require.Equal(t, e.Deposits, e2.Deposits)
+	require.Len(t, e2.Events, len(e.Events))
+	for _, ev := range e2.Events {
+		require.Empty(t, ev.RemoteAddr)
+	}
+	require.Empty(t, e2.Notifications)
+	require.Equal(t, e.SupportTokens, e2.SupportTokens)
+	require.Len(t, e2.SupportAudit, 2)
+	for _, ev := range e2.SupportAudit {
+		require.Empty(t, ev.RemoteAddr)
+	}
+
+	// Other skycoin addresses are untouched
+	sub, err := subs.Get("btcaddr3")
+	require.NoError(t, err)
+	require.Equal(t, "other@example.com", sub.Email)
+
+	e3, err := m.Export(testSkyAddr2)
+	require.NoError(t, err)
+	require.Len(t, e3.Notifications, 1)
+	require.Len(t, e3.SupportAudit, 1)
+	require.Equal(t, "10.0.0.1:1234", e3.SupportAudit[0].RemoteAddr)
+
+	// Erasing again changes nothing
+	er, err = m.Erase(testSkyAddr)
+	require.NoError(t, err)
+	require.Equal(t, Erasure{SkyAddress: testSkyAddr}, er)
+}
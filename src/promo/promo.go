@@ -0,0 +1,312 @@
+// Package promo manages the promo and referral codes that deposit addresses can be bound with.
+//
+// The deposits to an address bound with a code get the bonus of the code on top of their rate,
+// as long as the code is enabled and has not expired when the deposit is received.
+package promo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/shopspring/decimal"
+
+	"github.com/skycoin/teller/src/util/dbutil"
+	"github.com/skycoin/teller/src/util/mathutil"
+)
+
+// Promo codes, normalized code as key
+var codesBkt = []byte("promo_codes")
+
+var codeRe = regexp.MustCompile("^[A-Z0-9_-]{1,32}$")
+
+var (
+	// ErrNotFound is returned if a code does not exist
+	ErrNotFound = errors.New("Promo code not found")
+	// ErrExists is returned by Create if the code exists
+	ErrExists = errors.New("Promo code already exists")
+	// ErrInvalidCode is returned if a code is not 1 to 32 letters, digits, - or _
+	ErrInvalidCode = errors.New("Invalid promo code, must be 1 to 32 letters, digits, - or _")
+	// ErrInvalidBonus is returned if the bonus of a code is not a positive percentage
+	ErrInvalidBonus = errors.New("Invalid promo code bonus_percent")
+	// ErrInvalidMaxUses is returned if the maximum uses of a code is negative
+	ErrInvalidMaxUses = errors.New("Invalid promo code max_uses")
+	// ErrDisabled is returned when binding with a disabled code
+	ErrDisabled = errors.New("Promo code is disabled")
+	// ErrExpired is returned when binding with an expired code
+	ErrExpired = errors.New("Promo code expired")
+	// ErrMaxUses is returned when binding with a code that was used its maximum number of times
+	ErrMaxUses = errors.New("Promo code was used the maximum number of times")
+)
+
+// Code is a promo or referral code
+type Code struct {
+	// Codes are case insensitive, and saved in uppercase
+	Code string `json:"code"`
+	// Bonus added to the rate of the deposits, e.g. "5" for 5%
+	BonusPercent string `json:"bonus_percent"`
+	Enabled      bool   `json:"enabled"`
+	// Maximum number of deposit addresses that can be bound with the code, 0 for no limit
+	MaxUses int `json:"max_uses"`
+	// Number of deposit addresses bound with the code
+	Uses int `json:"uses"`
+	// Unix time the code expires at, 0 if it does not expire
+	ExpiresAt int64 `json:"expires_at,omitempty"`
+	// Who the code is for, e.g. the referrer
+	Note      string `json:"note,omitempty"`
+	CreatedAt int64  `json:"created_at"`
+	UpdatedAt int64  `json:"updated_at"`
+}
+
+// Normalize returns a code in the form it is saved in
+func Normalize(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// Validate returns an error if the code is invalid
+func (c Code) Validate() error {
+	if !codeRe.MatchString(c.Code) {
+		return ErrInvalidCode
+	}
+
+	b, err := mathutil.DecimalFromString(c.BonusPercent)
+	if err != nil || b.Sign() <= 0 {
+		return ErrInvalidBonus
+	}
+
+	if c.MaxUses < 0 {
+		return ErrInvalidMaxUses
+	}
+
+	return nil
+}
+
+// Rate applies the bonus of the code to rate
+func (c Code) Rate(rate string) (string, error) {
+	b, err := mathutil.DecimalFromString(c.BonusPercent)
+	if err != nil {
+		return "", err
+	}
+
+	d, err := mathutil.DecimalFromString(rate)
+	if err != nil {
+		return "", err
+	}
+
+	hundred := decimal.New(100, 0)
+	return d.Mul(hundred.Add(b)).DivRound(hundred, 8).String(), nil
+}
+
+func (c Code) expired(now time.Time) bool {
+	return c.ExpiresAt != 0 && now.Unix() >= c.ExpiresAt
+}
+
+// usable returns an error if an address can't be bound with the code
+func (c Code) usable(now time.Time) error {
+	switch {
+	case !c.Enabled:
+		return ErrDisabled
+	case c.expired(now):
+		return ErrExpired
+	case c.MaxUses != 0 && c.Uses >= c.MaxUses:
+		return ErrMaxUses
+	default:
+		return nil
+	}
+}
+
+// Manager stores the promo codes
+type Manager struct {
+	db   *bolt.DB
+	lock sync.Mutex // serializes the changes of codes, so that uses are counted exactly
+	now  func() time.Time
+}
+
+// NewManager creates a Manager
+func NewManager(db *bolt.DB) (*Manager, error) {
+	if db == nil {
+		return nil, errors.New("new promo Manager failed, db is nil")
+	}
+
+	if err := db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(codesBkt); err != nil {
+			return dbutil.NewCreateBucketFailedErr(codesBkt, err)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return &Manager{
+		db:  db,
+		now: time.Now,
+	}, nil
+}
+
+// Create creates a code
+func (m *Manager) Create(c Code) (Code, error) {
+	c.Code = Normalize(c.Code)
+	c.Uses = 0
+
+	if err := c.Validate(); err != nil {
+		return Code{}, err
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	now := m.now().UTC().Unix()
+	c.CreatedAt = now
+	c.UpdatedAt = now
+
+	if err := m.db.Update(func(tx *bolt.Tx) error {
+		if exists, err := dbutil.BucketHasKey(tx, codesBkt, c.Code); err != nil {
+			return err
+		} else if exists {
+			return ErrExists
+		}
+
+		return dbutil.PutBucketValue(tx, codesBkt, c.Code, c)
+	}); err != nil {
+		return Code{}, err
+	}
+
+	return c, nil
+}
+
+// Update changes the bonus, enabled flag, maximum uses, expiry and note of a code to those of c
+func (m *Manager) Update(c Code) (Code, error) {
+	c.Code = Normalize(c.Code)
+
+	if err := c.Validate(); err != nil {
+		return Code{}, err
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	var updated Code
+	if err := m.db.Update(func(tx *bolt.Tx) error {
+		if err := getCodeTx(tx, c.Code, &updated); err != nil {
+			return err
+		}
+
+		updated.BonusPercent = c.BonusPercent
+		updated.Enabled = c.Enabled
+		updated.MaxUses = c.MaxUses
+		updated.ExpiresAt = c.ExpiresAt
+		updated.Note = c.Note
+		updated.UpdatedAt = m.now().UTC().Unix()
+
+		return dbutil.PutBucketValue(tx, codesBkt, updated.Code, updated)
+	}); err != nil {
+		return Code{}, err
+	}
+
+	return updated, nil
+}
+
+func getCodeTx(tx *bolt.Tx, code string, c *Code) error {
+	if err := dbutil.GetBucketObject(tx, codesBkt, code, c); err != nil {
+		switch err.(type) {
+		case dbutil.ObjectNotExistErr:
+			return ErrNotFound
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Get returns a code. Returns ErrNotFound if it does not exist.
+func (m *Manager) Get(code string) (Code, error) {
+	var c Code
+	err := m.db.View(func(tx *bolt.Tx) error {
+		return getCodeTx(tx, Normalize(code), &c)
+	})
+	return c, err
+}
+
+// Codes returns all codes, ordered by creation time
+func (m *Manager) Codes() ([]Code, error) {
+	var cs []Code
+	if err := m.db.View(func(tx *bolt.Tx) error {
+		return dbutil.ForEach(tx, codesBkt, func(k, v []byte) error {
+			var c Code
+			if err := json.Unmarshal(v, &c); err != nil {
+				return fmt.Errorf("decode promo code failed: %v", err)
+			}
+
+			cs = append(cs, c)
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(cs, func(i, j int) bool {
+		return cs[i].CreatedAt < cs[j].CreatedAt
+	})
+
+	return cs, nil
+}
+
+// Verify checks that an address can be bound with a code, before one is taken from a pool.
+// Returns ErrNotFound, ErrDisabled, ErrExpired or ErrMaxUses if it can't.
+func (m *Manager) Verify(code string) error {
+	c, err := m.Get(code)
+	if err != nil {
+		return err
+	}
+	return c.usable(m.now())
+}
+
+// Use counts a use of a code by a bound address, and returns the normalized code.
+// Returns the same errors as Verify.
+func (m *Manager) Use(code string) (string, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	var c Code
+	if err := m.db.Update(func(tx *bolt.Tx) error {
+		if err := getCodeTx(tx, Normalize(code), &c); err != nil {
+			return err
+		}
+
+		if err := c.usable(m.now()); err != nil {
+			return err
+		}
+
+		c.Uses++
+		return dbutil.PutBucketValue(tx, codesBkt, c.Code, c)
+	}); err != nil {
+		return "", err
+	}
+
+	return c.Code, nil
+}
+
+// Rate applies the bonus of a code to the rate of a deposit. The rate is unchanged if the code
+// was removed, is disabled or has expired. Implements exchange.PromoRater.
+func (m *Manager) Rate(code, rate string) (string, error) {
+	c, err := m.Get(code)
+	switch err {
+	case nil:
+	case ErrNotFound:
+		return rate, nil
+	default:
+		return "", err
+	}
+
+	if !c.Enabled || c.expired(m.now()) {
+		return rate, nil
+	}
+
+	return c.Rate(rate)
+}
@@ -0,0 +1,142 @@
+package promo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+func TestManager(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	m, err := NewManager(db)
+	require.NoError(t, err)
+
+	now := time.Unix(1500000000, 0)
+	m.now = func() time.Time {
+		return now
+	}
+
+	c, err := m.Create(Code{
+		Code:         " friend ",
+		BonusPercent: "5",
+		Enabled:      true,
+		MaxUses:      2,
+		Uses:         10,
+		Note:         "alice",
+	})
+	require.NoError(t, err)
+	require.Equal(t, Code{
+		Code:         "FRIEND",
+		BonusPercent: "5",
+		Enabled:      true,
+		MaxUses:      2,
+		Note:         "alice",
+		CreatedAt:    now.Unix(),
+		UpdatedAt:    now.Unix(),
+	}, c)
+
+	_, err = m.Create(Code{Code: "Friend", BonusPercent: "1"})
+	require.Equal(t, ErrExists, err)
+
+	_, err = m.Create(Code{Code: "no spaces", BonusPercent: "1"})
+	require.Equal(t, ErrInvalidCode, err)
+
+	_, err = m.Create(Code{Code: "ZERO", BonusPercent: "0"})
+	require.Equal(t, ErrInvalidBonus, err)
+
+	_, err = m.Create(Code{Code: "NEG", BonusPercent: "1", MaxUses: -1})
+	require.Equal(t, ErrInvalidMaxUses, err)
+
+	got, err := m.Get("friend")
+	require.NoError(t, err)
+	require.Equal(t, c, got)
+
+	_, err = m.Get("missing")
+	require.Equal(t, ErrNotFound, err)
+
+	rate, err := m.Rate("FRIEND", "100")
+	require.NoError(t, err)
+	require.Equal(t, "105", rate)
+
+	// Removed codes get no bonus
+	rate, err = m.Rate("MISSING", "100")
+	require.NoError(t, err)
+	require.Equal(t, "100", rate)
+
+	require.Equal(t, ErrNotFound, m.Verify("missing"))
+	require.NoError(t, m.Verify("friend"))
+
+	code, err := m.Use("friend")
+	require.NoError(t, err)
+	require.Equal(t, "FRIEND", code)
+	_, err = m.Use("FRIEND")
+	require.NoError(t, err)
+
+	// The code was used its maximum number of times, but the addresses bound with it keep the bonus
+	require.Equal(t, ErrMaxUses, m.Verify("FRIEND"))
+	_, err = m.Use("FRIEND")
+	require.Equal(t, ErrMaxUses, err)
+
+	rate, err = m.Rate("FRIEND", "100")
+	require.NoError(t, err)
+	require.Equal(t, "105", rate)
+
+	got, err = m.Get("FRIEND")
+	require.NoError(t, err)
+	require.Equal(t, 2, got.Uses)
+
+	now = now.Add(time.Hour)
+	c, err = m.Update(Code{
+		Code:         "friend",
+		BonusPercent: "2.5",
+		MaxUses:      0,
+		ExpiresAt:    now.Add(time.Hour).Unix(),
+	})
+	require.NoError(t, err)
+	require.Equal(t, "2.5", c.BonusPercent)
+	require.Equal(t, 2, c.Uses)
+	require.Equal(t, "", c.Note)
+	require.Equal(t, now.Unix(), c.UpdatedAt)
+	require.NotEqual(t, c.CreatedAt, c.UpdatedAt)
+
+	_, err = m.Update(Code{Code: "MISSING", BonusPercent: "1"})
+	require.Equal(t, ErrNotFound, err)
+
+	// Disabled codes can't be used and get no bonus
+	require.Equal(t, ErrDisabled, m.Verify("FRIEND"))
+	rate, err = m.Rate("FRIEND", "100")
+	require.NoError(t, err)
+	require.Equal(t, "100", rate)
+
+	c.Enabled = true
+	_, err = m.Update(c)
+	require.NoError(t, err)
+
+	require.NoError(t, m.Verify("FRIEND"))
+	rate, err = m.Rate("FRIEND", "100")
+	require.NoError(t, err)
+	require.Equal(t, "102.5", rate)
+
+	// Expired codes can't be used and get no bonus
+	now = now.Add(time.Hour)
+	require.Equal(t, ErrExpired, m.Verify("FRIEND"))
+	_, err = m.Use("FRIEND")
+	require.Equal(t, ErrExpired, err)
+	rate, err = m.Rate("FRIEND", "100")
+	require.NoError(t, err)
+	require.Equal(t, "100", rate)
+
+	_, err = m.Create(Code{Code: "SECOND", BonusPercent: "1"})
+	require.NoError(t, err)
+
+	cs, err := m.Codes()
+	require.NoError(t, err)
+	require.Len(t, cs, 2)
+	require.Equal(t, "FRIEND", cs[0].Code)
+	require.Equal(t, "SECOND", cs[1].Code)
+}
@@ -0,0 +1,234 @@
+// Package quote issues fixed-price quotes, for OTC desks that need price certainty.
+//
+// A quote locks the exchange rate of a coin type until it expires. It is used by binding a deposit address
+// with it, and deposits to that address are converted at the quoted rate if they arrive before the quote
+// expires and their value is within the amount range of the quote. Other deposits get the default pricing.
+package quote
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/skycoin/teller/src/util/dbutil"
+)
+
+const idLen = 16
+
+var (
+	// Quotes, quote ID as key
+	quotesBkt = []byte("quotes")
+
+	// Quote ID of deposit addresses bound with a quote, deposit address as key
+	quoteAddrsBkt = []byte("quote_addrs")
+)
+
+var (
+	// ErrNotFound is returned if a quote does not exist
+	ErrNotFound = errors.New("Quote not found")
+	// ErrExpired is returned when binding with an expired quote
+	ErrExpired = errors.New("Quote expired")
+	// ErrUsed is returned when binding with a quote that a deposit address was bound with already
+	ErrUsed = errors.New("Quote was already used")
+	// ErrCoinTypeMismatch is returned when binding a deposit address of another coin type than the quote's
+	ErrCoinTypeMismatch = errors.New("Quote is for another coin type")
+)
+
+// Quote is a fixed exchange rate of a coin type, for the deposits to one deposit address
+type Quote struct {
+	ID       string `json:"id"`
+	CoinType string `json:"coin_type"`
+	// Exchange rate, in the format of the exchange rates of the config.
+	// The bonus of the pricing region of the client is included.
+	Rate string `json:"rate"`
+	// Deposit value range the rate applies to, in satoshis (8 decimals). 0 for no limit.
+	MinAmount int64 `json:"min_amount"`
+	MaxAmount int64 `json:"max_amount"`
+	CreatedAt int64 `json:"created_at"`
+	ExpiresAt int64 `json:"expires_at"`
+	// Deposit address bound with the quote, empty until it is used
+	DepositAddress string `json:"deposit_address,omitempty"`
+}
+
+// InRange returns true if a deposit value is within the amount range of the quote
+func (q Quote) InRange(value int64) bool {
+	if q.MinAmount > 0 && value < q.MinAmount {
+		return false
+	}
+	if q.MaxAmount > 0 && value > q.MaxAmount {
+		return false
+	}
+	return true
+}
+
+// Config configures the quotes issued by a Manager
+type Config struct {
+	// Quotes expire after TTL
+	TTL time.Duration
+	// Deposit value range of the quotes in satoshis (8 decimals), 0 for no limit
+	MinAmount int64
+	MaxAmount int64
+}
+
+// Manager issues and stores quotes
+type Manager struct {
+	db   *bolt.DB
+	cfg  Config
+	lock sync.Mutex // serializes binds, so that a quote is only used once
+	now  func() time.Time
+}
+
+// NewManager creates a Manager
+func NewManager(db *bolt.DB, cfg Config) (*Manager, error) {
+	if db == nil {
+		return nil, errors.New("new quote Manager failed, db is nil")
+	}
+
+	if err := db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(quotesBkt); err != nil {
+			return dbutil.NewCreateBucketFailedErr(quotesBkt, err)
+		}
+
+		if _, err := tx.CreateBucketIfNotExists(quoteAddrsBkt); err != nil {
+			return dbutil.NewCreateBucketFailedErr(quoteAddrsBkt, err)
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return &Manager{
+		db:  db,
+		cfg: cfg,
+		now: time.Now,
+	}, nil
+}
+
+// Issue issues a quote of rate for a coin type
+func (m *Manager) Issue(coinType, rate string) (Quote, error) {
+	b := make([]byte, idLen)
+	if _, err := rand.Read(b); err != nil {
+		return Quote{}, err
+	}
+
+	now := m.now().UTC()
+	q := Quote{
+		ID:        hex.EncodeToString(b),
+		CoinType:  coinType,
+		Rate:      rate,
+		MinAmount: m.cfg.MinAmount,
+		MaxAmount: m.cfg.MaxAmount,
+		CreatedAt: now.Unix(),
+		ExpiresAt: now.Add(m.cfg.TTL).Unix(),
+	}
+
+	if err := m.db.Update(func(tx *bolt.Tx) error {
+		return dbutil.PutBucketValue(tx, quotesBkt, q.ID, q)
+	}); err != nil {
+		return Quote{}, err
+	}
+
+	return q, nil
+}
+
+func getQuoteTx(tx *bolt.Tx, id string, q *Quote) error {
+	if err := dbutil.GetBucketObject(tx, quotesBkt, id, q); err != nil {
+		switch err.(type) {
+		case dbutil.ObjectNotExistErr:
+			return ErrNotFound
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Get returns a quote. Returns ErrNotFound if it does not exist.
+func (m *Manager) Get(id string) (Quote, error) {
+	var q Quote
+	err := m.db.View(func(tx *bolt.Tx) error {
+		return getQuoteTx(tx, id, &q)
+	})
+	return q, err
+}
+
+// usable returns an error if a deposit address of coinType can't be bound with q
+func (m *Manager) usable(q Quote, coinType string) error {
+	switch {
+	case q.DepositAddress != "":
+		return ErrUsed
+	case q.CoinType != coinType:
+		return ErrCoinTypeMismatch
+	case m.now().Unix() >= q.ExpiresAt:
+		return ErrExpired
+	default:
+		return nil
+	}
+}
+
+// Verify checks that a deposit address of coinType can be bound with a quote, before one is taken from a pool.
+// Returns ErrNotFound, ErrUsed, ErrCoinTypeMismatch or ErrExpired if it can't.
+func (m *Manager) Verify(id, coinType string) error {
+	q, err := m.Get(id)
+	if err != nil {
+		return err
+	}
+	return m.usable(q, coinType)
+}
+
+// Bind uses a quote for a deposit address of coinType. A quote can only be used once.
+// Returns the same errors as Verify.
+func (m *Manager) Bind(id, coinType, depositAddr string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return m.db.Update(func(tx *bolt.Tx) error {
+		var q Quote
+		if err := getQuoteTx(tx, id, &q); err != nil {
+			return err
+		}
+
+		if err := m.usable(q, coinType); err != nil {
+			return err
+		}
+
+		q.DepositAddress = depositAddr
+		if err := dbutil.PutBucketValue(tx, quotesBkt, q.ID, q); err != nil {
+			return err
+		}
+
+		return dbutil.PutBucketValue(tx, quoteAddrsBkt, depositAddr, q.ID)
+	})
+}
+
+// Rate returns the quoted rate of a deposit to a deposit address, or the empty string if the address was not
+// bound with a quote, the quote has expired or the value is not within its range. Implements exchange.QuoteRater.
+func (m *Manager) Rate(depositAddr, coinType string, value int64) (string, error) {
+	var q Quote
+	if err := m.db.View(func(tx *bolt.Tx) error {
+		id, err := dbutil.GetBucketString(tx, quoteAddrsBkt, depositAddr)
+		if err != nil {
+			switch err.(type) {
+			case dbutil.ObjectNotExistErr:
+				return nil
+			default:
+				return err
+			}
+		}
+
+		return getQuoteTx(tx, id, &q)
+	}); err != nil {
+		return "", err
+	}
+
+	if q.ID == "" || q.CoinType != coinType || m.now().Unix() >= q.ExpiresAt || !q.InRange(value) {
+		return "", nil
+	}
+
+	return q.Rate, nil
+}
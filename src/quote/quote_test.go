@@ -0,0 +1,100 @@
+package quote
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/scanner"
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+func TestManager(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	m, err := NewManager(db, Config{
+		TTL:       time.Minute * 15,
+		MinAmount: 1e7,
+		MaxAmount: 1e9,
+	})
+	require.NoError(t, err)
+
+	now := time.Unix(1500000000, 0)
+	m.now = func() time.Time {
+		return now
+	}
+
+	q, err := m.Issue(scanner.CoinTypeBTC, "600")
+	require.NoError(t, err)
+	require.Len(t, q.ID, idLen*2)
+	require.Equal(t, "600", q.Rate)
+	require.Equal(t, int64(1e7), q.MinAmount)
+	require.Equal(t, int64(1e9), q.MaxAmount)
+	require.Equal(t, now.Unix(), q.CreatedAt)
+	require.Equal(t, now.Add(time.Minute*15).Unix(), q.ExpiresAt)
+
+	got, err := m.Get(q.ID)
+	require.NoError(t, err)
+	require.Equal(t, q, got)
+
+	_, err = m.Get("missing")
+	require.Equal(t, ErrNotFound, err)
+
+	require.NoError(t, m.Verify(q.ID, scanner.CoinTypeBTC))
+	require.Equal(t, ErrCoinTypeMismatch, m.Verify(q.ID, scanner.CoinTypeLTC))
+	require.Equal(t, ErrNotFound, m.Verify("missing", scanner.CoinTypeBTC))
+
+	// Not bound yet
+	rate, err := m.Rate("addr1", scanner.CoinTypeBTC, 1e8)
+	require.NoError(t, err)
+	require.Equal(t, "", rate)
+
+	require.Equal(t, ErrCoinTypeMismatch, m.Bind(q.ID, scanner.CoinTypeLTC, "addr1"))
+	require.NoError(t, m.Bind(q.ID, scanner.CoinTypeBTC, "addr1"))
+
+	// A quote is used once
+	require.Equal(t, ErrUsed, m.Bind(q.ID, scanner.CoinTypeBTC, "addr2"))
+	require.Equal(t, ErrUsed, m.Verify(q.ID, scanner.CoinTypeBTC))
+
+	rate, err = m.Rate("addr1", scanner.CoinTypeBTC, 1e8)
+	require.NoError(t, err)
+	require.Equal(t, "600", rate)
+
+	// Out of range
+	rate, err = m.Rate("addr1", scanner.CoinTypeBTC, 1e6)
+	require.NoError(t, err)
+	require.Equal(t, "", rate)
+
+	rate, err = m.Rate("addr1", scanner.CoinTypeBTC, 2e9)
+	require.NoError(t, err)
+	require.Equal(t, "", rate)
+
+	// Expired
+	q2, err := m.Issue(scanner.CoinTypeBTC, "600")
+	require.NoError(t, err)
+
+	now = now.Add(time.Minute * 15)
+
+	rate, err = m.Rate("addr1", scanner.CoinTypeBTC, 1e8)
+	require.NoError(t, err)
+	require.Equal(t, "", rate)
+
+	require.Equal(t, ErrExpired, m.Verify(q2.ID, scanner.CoinTypeBTC))
+	require.Equal(t, ErrExpired, m.Bind(q2.ID, scanner.CoinTypeBTC, "addr2"))
+}
+
+func TestQuoteInRange(t *testing.T) {
+	q := Quote{}
+	require.True(t, q.InRange(1))
+
+	q.MinAmount = 10
+	require.False(t, q.InRange(9))
+	require.True(t, q.InRange(10))
+	require.True(t, q.InRange(1e10))
+
+	q.MaxAmount = 20
+	require.True(t, q.InRange(20))
+	require.False(t, q.InRange(21))
+}
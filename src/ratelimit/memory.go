@@ -0,0 +1,67 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps token buckets in memory, for limits that don't need to survive restarts
+// or be shared between instances
+type MemoryStore struct {
+	buckets   map[string]memoryBucket
+	lastSweep time.Time
+	// If dirty is not nil, the keys of the buckets taken from or swept since the BoltStore last saved them
+	dirty map[string]struct{}
+	sync.Mutex
+}
+
+type memoryBucket struct {
+	Bucket
+	window time.Duration
+}
+
+// NewMemoryStore creates a MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: make(map[string]memoryBucket),
+	}
+}
+
+// Take consumes n tokens from the bucket for key
+func (s *MemoryStore) Take(key string, n, burst int64, window time.Duration, now time.Time) (bool, time.Duration, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.sweep(now)
+
+	b, allowed, wait := Take(s.buckets[key].Bucket, n, burst, window, now)
+	s.buckets[key] = memoryBucket{
+		Bucket: b,
+		window: window,
+	}
+
+	if s.dirty != nil {
+		s.dirty[key] = struct{}{}
+	}
+
+	return allowed, wait, nil
+}
+
+// sweep removes the buckets that have refilled completely, which are the same as a new bucket,
+// so that the buckets of clients that stopped making requests don't accumulate.
+// It runs at most once a minute.
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+
+	for k, b := range s.buckets {
+		if now.UnixNano()-b.UpdatedAt >= int64(b.window) {
+			delete(s.buckets, k)
+			if s.dirty != nil {
+				s.dirty[k] = struct{}{}
+			}
+		}
+	}
+}
@@ -0,0 +1,97 @@
+// Package ratelimit provides a token bucket rate limiter with pluggable
+// storage, so that limits can survive restarts and be shared between instances
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Bucket is the state of a token bucket for a single key
+type Bucket struct {
+	Tokens    float64 `json:"tokens"`
+	UpdatedAt int64   `json:"updated_at"` // unix nanoseconds
+}
+
+// Store persists token buckets. Take must consume the tokens atomically.
+type Store interface {
+	// Take consumes n tokens from the bucket for key. If fewer than n tokens are available,
+	// none are consumed, and it returns false and the time until n tokens are available.
+	Take(key string, n, burst int64, window time.Duration, now time.Time) (bool, time.Duration, error)
+}
+
+// Limiter limits requests per key with a token bucket.
+// A bucket holds up to Burst tokens and refills completely over Window.
+type Limiter struct {
+	store  Store
+	prefix string
+	burst  int64
+	window time.Duration
+}
+
+// NewLimiter creates a Limiter. The prefix namespaces the keys in the store,
+// so that multiple limiters can share a store.
+func NewLimiter(store Store, prefix string, burst int64, window time.Duration) (*Limiter, error) {
+	if store == nil {
+		return nil, errors.New("ratelimit store is nil")
+	}
+
+	if burst <= 0 {
+		return nil, errors.New("burst must be greater than zero")
+	}
+
+	if window <= 0 {
+		return nil, errors.New("window must be greater than zero")
+	}
+
+	return &Limiter{
+		store:  store,
+		prefix: prefix,
+		burst:  burst,
+		window: window,
+	}, nil
+}
+
+// Allow consumes a token for key. If the limit is reached, it returns false
+// and the duration after which a retry is allowed.
+func (l *Limiter) Allow(key string) (bool, time.Duration, error) {
+	return l.AllowN(key, 1)
+}
+
+// AllowN consumes n tokens for key, for a request that counts as n requests.
+// n can't be greater than the burst, since the bucket never holds more tokens.
+func (l *Limiter) AllowN(key string, n int64) (bool, time.Duration, error) {
+	if n <= 0 || n > l.burst {
+		return false, 0, fmt.Errorf("n must be between 1 and the burst %d", l.burst)
+	}
+
+	return l.store.Take(l.prefix+key, n, l.burst, l.window, time.Now())
+}
+
+// Take applies a token bucket refill and a take of n tokens to b, returning the updated
+// bucket. It is used by Store implementations.
+func Take(b Bucket, n, burst int64, window time.Duration, now time.Time) (Bucket, bool, time.Duration) {
+	capacity := float64(burst)
+	ratePerNano := capacity / float64(window)
+
+	if b.UpdatedAt == 0 {
+		b.Tokens = capacity
+	} else if elapsed := now.UnixNano() - b.UpdatedAt; elapsed > 0 {
+		b.Tokens += float64(elapsed) * ratePerNano
+		if b.Tokens > capacity {
+			b.Tokens = capacity
+		}
+	}
+
+	b.UpdatedAt = now.UnixNano()
+
+	if b.Tokens < float64(n) {
+		wait := time.Duration((float64(n) - b.Tokens) / ratePerNano)
+		return b, false, wait
+	}
+
+	b.Tokens -= float64(n)
+
+	return b, true, 0
+}
@@ -0,0 +1,210 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/util/dbutil"
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+func TestTake(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	window := time.Minute
+
+	var b Bucket
+	var ok bool
+	var wait time.Duration
+
+	// A new bucket starts full
+	for i := 0; i < 3; i++ {
+		b, ok, wait = Take(b, 1, 3, window, now)
+		require.True(t, ok)
+		require.Equal(t, time.Duration(0), wait)
+	}
+
+	b, ok, wait = Take(b, 1, 3, window, now)
+	require.False(t, ok)
+	require.Equal(t, 20*time.Second, wait)
+
+	// One token refills every window/burst
+	b, ok, _ = Take(b, 1, 3, window, now.Add(20*time.Second))
+	require.True(t, ok)
+
+	b, ok, _ = Take(b, 1, 3, window, now.Add(20*time.Second))
+	require.False(t, ok)
+
+	// Tokens don't accumulate beyond the burst
+	b, _, _ = Take(b, 1, 3, window, now.Add(time.Hour))
+	require.Equal(t, float64(2), b.Tokens)
+}
+
+func TestBoltStoreLimiter(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	log, _ := testutil.NewLogger(t)
+
+	store, err := NewBoltStore(log, db)
+	require.NoError(t, err)
+
+	l, err := NewLimiter(store, "skyaddr:", 2, time.Hour)
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		ok, _, err := l.Allow("a")
+		require.NoError(t, err)
+		require.True(t, ok)
+	}
+
+	ok, wait, err := l.Allow("a")
+	require.NoError(t, err)
+	require.False(t, ok)
+	require.True(t, wait > 0)
+
+	// Other keys are limited separately
+	ok, _, err = l.Allow("b")
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	// The state is persisted once saved, a new limiter on the same store is still limited
+	require.NoError(t, store.Save())
+	store2, err := NewBoltStore(log, db)
+	require.NoError(t, err)
+	l2, err := NewLimiter(store2, "skyaddr:", 2, time.Hour)
+	require.NoError(t, err)
+
+	ok, _, err = l2.Allow("a")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	// Limiters with a different prefix don't share buckets
+	l3, err := NewLimiter(store, "other:", 2, time.Hour)
+	require.NoError(t, err)
+	ok, _, err = l3.Allow("a")
+	require.NoError(t, err)
+	require.True(t, ok)
+}
+
+func TestTakeN(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	window := time.Minute
+
+	var b Bucket
+	var ok bool
+	var wait time.Duration
+
+	b, ok, _ = Take(b, 2, 3, window, now)
+	require.True(t, ok)
+	require.Equal(t, float64(1), b.Tokens)
+
+	// No tokens are taken if there are not enough
+	b, ok, wait = Take(b, 2, 3, window, now)
+	require.False(t, ok)
+	require.Equal(t, 20*time.Second, wait)
+	require.Equal(t, float64(1), b.Tokens)
+
+	b, ok, _ = Take(b, 1, 3, window, now)
+	require.True(t, ok)
+	require.Equal(t, float64(0), b.Tokens)
+}
+
+func TestMemoryStoreLimiter(t *testing.T) {
+	store := NewMemoryStore()
+
+	l, err := NewLimiter(store, "ip:", 5, time.Hour)
+	require.NoError(t, err)
+
+	ok, _, err := l.AllowN("a", 3)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	ok, wait, err := l.AllowN("a", 3)
+	require.NoError(t, err)
+	require.False(t, ok)
+	require.True(t, wait > 0)
+
+	ok, _, err = l.Allow("a")
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	// More tokens than the burst can never be taken
+	_, _, err = l.AllowN("b", 6)
+	require.Error(t, err)
+	_, _, err = l.AllowN("b", 0)
+	require.Error(t, err)
+
+	// Buckets that refilled completely are removed
+	now := time.Now().Add(2 * time.Hour)
+	ok, _, err = store.Take("ip:b", 1, 5, time.Hour, now)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Len(t, store.buckets, 1)
+	require.Contains(t, store.buckets, "ip:b")
+}
+
+func TestBoltStoreExpiry(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	log, _ := testutil.NewLogger(t)
+
+	store, err := NewBoltStore(log, db)
+	require.NoError(t, err)
+
+	countSaved := func() int {
+		var n int
+		require.NoError(t, db.View(func(tx *bolt.Tx) error {
+			return dbutil.ForEach(tx, ratelimitBkt, func(k, v []byte) error {
+				n++
+				return nil
+			})
+		}))
+		return n
+	}
+
+	// Taking tokens doesn't write to the db until the buckets are saved
+	now := time.Now()
+	_, _, err = store.Take("skyaddr:a", 1, 2, time.Hour, now)
+	require.NoError(t, err)
+	_, _, err = store.Take("skyaddr:b", 1, 2, time.Hour, now.Add(-2*time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, 0, countSaved())
+
+	require.NoError(t, store.Save())
+	require.Equal(t, 2, countSaved())
+
+	// The buckets that refilled are not loaded, and are deleted from the db
+	store2, err := NewBoltStore(log, db)
+	require.NoError(t, err)
+	require.Len(t, store2.mem.buckets, 1)
+	require.Contains(t, store2.mem.buckets, "skyaddr:a")
+	require.Equal(t, time.Hour, store2.mem.buckets["skyaddr:a"].window)
+	require.Equal(t, 1, countSaved())
+
+	// The buckets swept from memory are deleted from the db when saved
+	store2.mem.buckets["skyaddr:a"] = memoryBucket{
+		Bucket: Bucket{
+			Tokens:    1,
+			UpdatedAt: now.Add(-2 * time.Hour).UnixNano(),
+		},
+		window: time.Hour,
+	}
+	require.NoError(t, store2.Save())
+	require.Empty(t, store2.mem.buckets)
+	require.Equal(t, 0, countSaved())
+
+	// Run saves the buckets when shut down
+	_, _, err = store2.Take("skyaddr:c", 1, 2, time.Hour, time.Now())
+	require.NoError(t, err)
+	errC := make(chan error, 1)
+	go func() {
+		errC <- store2.Run()
+	}()
+	store2.Shutdown()
+	require.NoError(t, <-errC)
+	require.Equal(t, 1, countSaved())
+}
@@ -0,0 +1,95 @@
+package ratelimit
+
+import (
+	"errors"
+	"time"
+
+	"github.com/skycoin/teller/src/util/redisutil"
+)
+
+// tokenBucketScript implements Take atomically inside Redis.
+// Times are in milliseconds, since Lua numbers are doubles.
+// KEYS[1] bucket key
+// ARGV[1] burst, ARGV[2] window in ms, ARGV[3] now in ms, ARGV[4] tokens to take
+// Returns {allowed (0 or 1), wait in ms}
+const tokenBucketScript = `
+local capacity = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local n = tonumber(ARGV[4])
+local rate = capacity / window
+
+local b = redis.call("HMGET", KEYS[1], "tokens", "updated_at")
+local tokens = tonumber(b[1])
+local updated = tonumber(b[2])
+
+if tokens == nil or updated == nil then
+	tokens = capacity
+elseif now > updated then
+	tokens = math.min(capacity, tokens + (now - updated) * rate)
+end
+
+local allowed = 0
+local wait = 0
+if tokens >= n then
+	tokens = tokens - n
+	allowed = 1
+else
+	wait = math.ceil((n - tokens) / rate)
+end
+
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "updated_at", tostring(now))
+redis.call("PEXPIRE", KEYS[1], window * 2)
+
+return {allowed, wait}
+`
+
+// RedisStore saves token buckets in Redis, so that limits are shared
+// between teller instances
+type RedisStore struct {
+	client *redisutil.Client
+	prefix string
+}
+
+// NewRedisStore creates a RedisStore. Keys are prefixed with prefix.
+func NewRedisStore(client *redisutil.Client, prefix string) (*RedisStore, error) {
+	if client == nil {
+		return nil, errors.New("new ratelimit RedisStore failed: client is nil")
+	}
+
+	return &RedisStore{
+		client: client,
+		prefix: prefix,
+	}, nil
+}
+
+// Take consumes n tokens from the bucket for key
+func (s *RedisStore) Take(key string, n, burst int64, window time.Duration, now time.Time) (bool, time.Duration, error) {
+	windowMs := int64(window / time.Millisecond)
+	if windowMs <= 0 {
+		return false, 0, errors.New("window must be at least 1ms")
+	}
+
+	nowMs := now.UnixNano() / int64(time.Millisecond)
+
+	vs, err := redisutil.Values(s.client.Do("EVAL", tokenBucketScript, 1, s.prefix+key, burst, windowMs, nowMs, n))
+	if err != nil {
+		return false, 0, err
+	}
+
+	if len(vs) != 2 {
+		return false, 0, errors.New("unexpected token bucket script reply")
+	}
+
+	allowed, err := redisutil.Int64(vs[0], nil)
+	if err != nil {
+		return false, 0, err
+	}
+
+	waitMs, err := redisutil.Int64(vs[1], nil)
+	if err != nil {
+		return false, 0, err
+	}
+
+	return allowed == 1, time.Duration(waitMs) * time.Millisecond, nil
+}
@@ -0,0 +1,188 @@
+package ratelimit
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/util/redisutil"
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+// testRedisAddrEnv names the env var with the address of a redis server to run the token bucket script on.
+// The tests with the fake redis server don't run the script, the ones that do are skipped if it is not set.
+const testRedisAddrEnv = "TELLER_TEST_REDIS_ADDR"
+
+// fakeRedis is a redis server that runs the token bucket script with Take,
+// keeping the buckets of all its clients in memory
+type fakeRedis struct {
+	buckets map[string]Bucket
+	keys    []string
+	sync.Mutex
+}
+
+func newFakeRedis(t *testing.T) (*fakeRedis, string, func()) {
+	f := &fakeRedis{
+		buckets: make(map[string]Bucket),
+	}
+
+	addr, shutdown := testutil.NewFakeRedis(t, f.reply)
+	return f, addr, shutdown
+}
+
+func (f *fakeRedis) reply(args []string) string {
+	if args[0] != "EVAL" || len(args) != 8 || args[1] != tokenBucketScript || args[2] != "1" {
+		return fmt.Sprintf("-ERR unexpected command %q\r\n", args[0])
+	}
+
+	var vs [4]int64
+	for i := range vs {
+		v, err := strconv.ParseInt(args[4+i], 10, 64)
+		if err != nil {
+			return "-ERR invalid argument\r\n"
+		}
+		vs[i] = v
+	}
+	burst, window, now, n := vs[0], time.Duration(vs[1])*time.Millisecond, time.Unix(0, vs[2]*int64(time.Millisecond)), vs[3]
+
+	f.Lock()
+	defer f.Unlock()
+
+	key := args[3]
+	f.keys = append(f.keys, key)
+
+	b, ok, wait := Take(f.buckets[key], n, burst, window, now)
+	f.buckets[key] = b
+
+	allowed := 0
+	if ok {
+		allowed = 1
+	}
+
+	return fmt.Sprintf("*2\r\n:%d\r\n:%d\r\n", allowed, int64(wait/time.Millisecond))
+}
+
+func TestRedisStoreLimiter(t *testing.T) {
+	f, addr, shutdown := newFakeRedis(t)
+	defer shutdown()
+
+	newLimiter := func() *Limiter {
+		client := redisutil.NewClient(redisutil.Config{
+			Addr: addr,
+		})
+		store, err := NewRedisStore(client, "teller:ratelimit:")
+		require.NoError(t, err)
+
+		l, err := NewLimiter(store, "ip:", 3, time.Hour)
+		require.NoError(t, err)
+		return l
+	}
+
+	// Two teller instances share the limit
+	l1 := newLimiter()
+	l2 := newLimiter()
+
+	ok, _, err := l1.AllowN("a", 2)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	ok, _, err = l2.Allow("a")
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	ok, wait, err := l1.Allow("a")
+	require.NoError(t, err)
+	require.False(t, ok)
+	require.True(t, wait > 0 && wait <= 20*time.Minute)
+
+	// Other keys are limited separately
+	ok, _, err = l2.Allow("b")
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	require.Equal(t, []string{
+		"teller:ratelimit:ip:a",
+		"teller:ratelimit:ip:a",
+		"teller:ratelimit:ip:a",
+		"teller:ratelimit:ip:b",
+	}, f.keys)
+
+	// Errors of the redis server are returned
+	shutdown()
+	_, _, err = newLimiter().Allow("a")
+	require.Error(t, err)
+}
+
+func newTestRedisClient(t *testing.T) *redisutil.Client {
+	addr := os.Getenv(testRedisAddrEnv)
+	if addr == "" {
+		t.Skipf("%s is not set", testRedisAddrEnv)
+	}
+
+	client := redisutil.NewClient(redisutil.Config{
+		Addr: addr,
+	})
+
+	_, err := client.Do("PING")
+	require.NoError(t, err)
+
+	return client
+}
+
+func TestRedisStoreScript(t *testing.T) {
+	client := newTestRedisClient(t)
+	defer client.Close()
+
+	prefix := fmt.Sprintf("teller:test:ratelimit:%d:", time.Now().UnixNano())
+	store, err := NewRedisStore(client, prefix)
+	require.NoError(t, err)
+	defer client.Do("DEL", prefix+"a") // nolint: errcheck
+
+	start := time.Unix(1500000000, 0)
+	burst := int64(3)
+	window := time.Minute
+
+	// The script takes the same tokens as Take at the same times
+	cases := []struct {
+		name string
+		n    int64
+		at   time.Duration
+	}{
+		{"new bucket is full", 2, 0},
+		{"last token", 1, 0},
+		{"empty", 1, 0},
+		{"partly refilled", 1, 5 * time.Second},
+		{"refilled a token", 1, 20 * time.Second},
+		{"clock went back", 1, 10 * time.Second},
+		{"refilled up to the burst", 3, 10 * time.Minute},
+		{"more than the burst", 4, 10 * time.Minute},
+		{"wait in ms", 1, 10*time.Minute + 333*time.Millisecond},
+	}
+
+	var b Bucket
+	for _, tc := range cases {
+		now := start.Add(tc.at)
+
+		var ok bool
+		var wait time.Duration
+		b, ok, wait = Take(b, tc.n, burst, window, now)
+
+		gotOK, gotWait, err := store.Take("a", tc.n, burst, window, now)
+		require.NoError(t, err, tc.name)
+		require.Equal(t, ok, gotOK, tc.name)
+
+		// The script computes in ms and rounds the wait up
+		require.Equal(t, time.Duration(0), gotWait%time.Millisecond, tc.name)
+		require.InDelta(t, float64(wait), float64(gotWait), float64(2*time.Millisecond), tc.name)
+	}
+
+	// The bucket expires after it has refilled
+	pttl, err := redisutil.Int64(client.Do("PTTL", prefix+"a"))
+	require.NoError(t, err)
+	require.True(t, pttl > int64(window/time.Millisecond) && pttl <= int64(2*window/time.Millisecond), "pttl=%d", pttl)
+}
@@ -0,0 +1,179 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/sirupsen/logrus"
+
+	"github.com/skycoin/teller/src/util/dbutil"
+)
+
+// rate limit token buckets, limiter key as key
+var ratelimitBkt = []byte("ratelimit")
+
+// boltSavePeriod is how often the BoltStore saves the buckets taken from to the db
+const boltSavePeriod = 10 * time.Second
+
+// boltBucket is a Bucket as saved in the db
+type boltBucket struct {
+	Bucket
+	// ExpiresAt is when the bucket has refilled completely and is the same as a new bucket, in unix nanoseconds
+	ExpiresAt int64 `json:"expires_at"`
+}
+
+// BoltStore keeps token buckets in memory, and saves them in a bolt.DB every few seconds, so that limits survive
+// restarts without a db write transaction per request. The buckets that have refilled completely are deleted
+// from the db, so that the buckets of the many keys of a client, e.g. generated skycoin addresses,
+// don't accumulate. Up to boltSavePeriod of tokens taken are lost if teller crashes.
+type BoltStore struct {
+	log  logrus.FieldLogger
+	db   *bolt.DB
+	mem  *MemoryStore
+	quit chan struct{}
+	done chan struct{}
+}
+
+// NewBoltStore creates a BoltStore, loading the buckets saved in the db that have not refilled yet
+func NewBoltStore(log logrus.FieldLogger, db *bolt.DB) (*BoltStore, error) {
+	if db == nil {
+		return nil, errors.New("new ratelimit BoltStore failed: db is nil")
+	}
+
+	mem := NewMemoryStore()
+	mem.dirty = make(map[string]struct{})
+
+	now := time.Now().UnixNano()
+
+	if err := db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(ratelimitBkt); err != nil {
+			return dbutil.NewCreateBucketFailedErr(ratelimitBkt, err)
+		}
+
+		// The bucket can't be written while iterating it
+		var expired []string
+		if err := dbutil.ForEach(tx, ratelimitBkt, func(k, v []byte) error {
+			var b boltBucket
+			if err := json.Unmarshal(v, &b); err != nil {
+				return err
+			}
+
+			// Buckets saved without an expiry, by older versions, are dropped too
+			if b.ExpiresAt <= now {
+				expired = append(expired, string(k))
+				return nil
+			}
+
+			mem.buckets[string(k)] = memoryBucket{
+				Bucket: b.Bucket,
+				window: time.Duration(b.ExpiresAt - b.UpdatedAt),
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		for _, k := range expired {
+			if err := dbutil.DeleteBucketKey(tx, ratelimitBkt, k); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return &BoltStore{
+		log:  log.WithField("prefix", "ratelimit.BoltStore"),
+		db:   db,
+		mem:  mem,
+		quit: make(chan struct{}),
+		done: make(chan struct{}),
+	}, nil
+}
+
+// Take consumes n tokens from the bucket for key
+func (s *BoltStore) Take(key string, n, burst int64, window time.Duration, now time.Time) (bool, time.Duration, error) {
+	return s.mem.Take(key, n, burst, window, now)
+}
+
+// Run saves the buckets every boltSavePeriod, until Shutdown
+func (s *BoltStore) Run() error {
+	log := s.log
+	log.Info("Start rate limit store")
+	defer log.Info("Rate limit store closed")
+	defer close(s.done)
+
+	for {
+		select {
+		case <-s.quit:
+			if err := s.Save(); err != nil {
+				log.WithError(err).Error("BoltStore.Save failed")
+			}
+			return nil
+		case <-time.After(boltSavePeriod):
+			if err := s.Save(); err != nil {
+				log.WithError(err).Error("BoltStore.Save failed")
+			}
+		}
+	}
+}
+
+// Shutdown saves the buckets and stops Run
+func (s *BoltStore) Shutdown() {
+	close(s.quit)
+	<-s.done
+}
+
+// Save writes the buckets taken from since the last Save to the db, and deletes the buckets swept from memory
+func (s *BoltStore) Save() error {
+	s.mem.Lock()
+	s.mem.sweep(time.Now())
+	dirty := s.mem.dirty
+	s.mem.dirty = make(map[string]struct{})
+
+	save := make(map[string]boltBucket, len(dirty))
+	for k := range dirty {
+		if b, ok := s.mem.buckets[k]; ok {
+			save[k] = boltBucket{
+				Bucket:    b.Bucket,
+				ExpiresAt: b.UpdatedAt + int64(b.window),
+			}
+		}
+	}
+	s.mem.Unlock()
+
+	if len(dirty) == 0 {
+		return nil
+	}
+
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		for k := range dirty {
+			b, ok := save[k]
+			if !ok {
+				if err := dbutil.DeleteBucketKey(tx, ratelimitBkt, k); err != nil {
+					return err
+				}
+				continue
+			}
+
+			if err := dbutil.PutBucketValue(tx, ratelimitBkt, k, b); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		// Save them again next time
+		s.mem.Lock()
+		for k := range dirty {
+			s.mem.dirty[k] = struct{}{}
+		}
+		s.mem.Unlock()
+		return err
+	}
+
+	return nil
+}
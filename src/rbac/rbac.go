@@ -0,0 +1,168 @@
+// Package rbac authenticates the principals of the admin API and the roles they have.
+// A principal is authenticated by a bearer token or by the common name of a verified client certificate.
+package rbac
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Role is the role of a principal. Each role can do all that the lower roles can.
+type Role int
+
+const (
+	// RoleViewer can read deposits and stats
+	RoleViewer Role = iota + 1
+	// RoleOperator can also reprocess deposits, pause payouts and make other operational changes
+	RoleOperator
+	// RoleAdmin can also change rates, manage deposit addresses and manage credentials
+	RoleAdmin
+)
+
+var roleNames = map[Role]string{
+	RoleViewer:   "viewer",
+	RoleOperator: "operator",
+	RoleAdmin:    "admin",
+}
+
+func (r Role) String() string {
+	if s, ok := roleNames[r]; ok {
+		return s
+	}
+	return fmt.Sprintf("Role(%d)", int(r))
+}
+
+// ParseRole parses a role name, "viewer", "operator" or "admin"
+func ParseRole(s string) (Role, error) {
+	for r, name := range roleNames {
+		if s == name {
+			return r, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid role %q, must be viewer, operator or admin", s)
+}
+
+// Principal is a user or a system allowed to use the admin API
+type Principal struct {
+	// Name of the principal in the logs
+	Name string
+	Role Role
+	// Token authenticates the principal with an "Authorization: Bearer <token>" header. Empty if it has none.
+	Token string
+	// ClientCertCN authenticates the principal with a verified client certificate of this common name.
+	// Empty if it has none.
+	ClientCertCN string
+}
+
+// ErrUnauthenticated is returned by Authenticator.Authenticate if a request has no valid credentials
+var ErrUnauthenticated = errors.New("Missing or invalid credentials")
+
+// Authenticator authenticates the principals of requests
+type Authenticator struct {
+	principals []Principal
+	// sha256 of the tokens of the principals, so that the comparison time doesn't depend on their length
+	tokens [][sha256.Size]byte
+}
+
+// NewAuthenticator creates an Authenticator of principals. Names, tokens and client certificate
+// common names must be unique, and each principal must have a token or a client certificate common name.
+func NewAuthenticator(principals []Principal) (*Authenticator, error) {
+	names := make(map[string]struct{}, len(principals))
+	tokens := make(map[string]struct{}, len(principals))
+	cns := make(map[string]struct{}, len(principals))
+
+	a := &Authenticator{
+		principals: principals,
+		tokens:     make([][sha256.Size]byte, len(principals)),
+	}
+
+	for i, p := range principals {
+		if p.Name == "" {
+			return nil, fmt.Errorf("principal %d has no name", i)
+		}
+		if _, ok := names[p.Name]; ok {
+			return nil, fmt.Errorf("principal %s is duplicated", p.Name)
+		}
+		names[p.Name] = struct{}{}
+
+		if _, ok := roleNames[p.Role]; !ok {
+			return nil, fmt.Errorf("principal %s has an invalid role", p.Name)
+		}
+
+		if p.Token == "" && p.ClientCertCN == "" {
+			return nil, fmt.Errorf("principal %s has no token or client certificate common name", p.Name)
+		}
+
+		if p.Token != "" {
+			if _, ok := tokens[p.Token]; ok {
+				return nil, fmt.Errorf("token of principal %s is duplicated", p.Name)
+			}
+			tokens[p.Token] = struct{}{}
+			a.tokens[i] = sha256.Sum256([]byte(p.Token))
+		}
+
+		if p.ClientCertCN != "" {
+			if _, ok := cns[p.ClientCertCN]; ok {
+				return nil, fmt.Errorf("client certificate common name of principal %s is duplicated", p.Name)
+			}
+			cns[p.ClientCertCN] = struct{}{}
+		}
+	}
+
+	return a, nil
+}
+
+// Authenticate returns the principal of a request. A bearer token takes precedence over a client certificate.
+// Client certificates must have been verified by the TLS config of the server.
+// Returns ErrUnauthenticated if the request has no valid credentials.
+func (a *Authenticator) Authenticate(r *http.Request) (Principal, error) {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		const prefix = "Bearer "
+		if !strings.HasPrefix(auth, prefix) {
+			return Principal{}, ErrUnauthenticated
+		}
+
+		// Every token is compared, so that the time doesn't tell which one matched
+		h := sha256.Sum256([]byte(strings.TrimPrefix(auth, prefix)))
+		match := -1
+		for i, p := range a.principals {
+			if p.Token != "" && subtle.ConstantTimeCompare(h[:], a.tokens[i][:]) == 1 {
+				match = i
+			}
+		}
+
+		if match < 0 {
+			return Principal{}, ErrUnauthenticated
+		}
+		return a.principals[match], nil
+	}
+
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		cn := r.TLS.VerifiedChains[0][0].Subject.CommonName
+		for _, p := range a.principals {
+			if p.ClientCertCN != "" && p.ClientCertCN == cn {
+				return p, nil
+			}
+		}
+	}
+
+	return Principal{}, ErrUnauthenticated
+}
+
+type principalCtxKey struct{}
+
+// WithPrincipal puts the principal of a request into a context
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalCtxKey{}, p)
+}
+
+// PrincipalFromContext returns the principal of a context, and false if it has none
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalCtxKey{}).(Principal)
+	return p, ok
+}
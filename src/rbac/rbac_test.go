@@ -0,0 +1,97 @@
+package rbac
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRole(t *testing.T) {
+	for _, r := range []Role{RoleViewer, RoleOperator, RoleAdmin} {
+		parsed, err := ParseRole(r.String())
+		require.NoError(t, err)
+		require.Equal(t, r, parsed)
+	}
+
+	_, err := ParseRole("root")
+	require.Error(t, err)
+
+	require.True(t, RoleViewer < RoleOperator && RoleOperator < RoleAdmin)
+}
+
+func TestNewAuthenticator(t *testing.T) {
+	for _, principals := range [][]Principal{
+		{{Role: RoleViewer, Token: "a"}},
+		{{Name: "a", Role: RoleViewer, Token: "a"}, {Name: "a", Role: RoleViewer, Token: "b"}},
+		{{Name: "a", Role: Role(0), Token: "a"}},
+		{{Name: "a", Role: RoleViewer}},
+		{{Name: "a", Role: RoleViewer, Token: "a"}, {Name: "b", Role: RoleViewer, Token: "a"}},
+		{{Name: "a", Role: RoleViewer, ClientCertCN: "a"}, {Name: "b", Role: RoleViewer, ClientCertCN: "a"}},
+	} {
+		_, err := NewAuthenticator(principals)
+		require.Error(t, err)
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	alice := Principal{Name: "alice", Role: RoleViewer, Token: "alice-token"}
+	bob := Principal{Name: "bob", Role: RoleAdmin, Token: "bob-token", ClientCertCN: "bob.example.com"}
+	ops := Principal{Name: "ops", Role: RoleOperator, ClientCertCN: "ops.example.com"}
+
+	a, err := NewAuthenticator([]Principal{alice, bob, ops})
+	require.NoError(t, err)
+
+	withCert := func(cn string) *tls.ConnectionState {
+		return &tls.ConnectionState{
+			VerifiedChains: [][]*x509.Certificate{
+				{{Subject: pkix.Name{CommonName: cn}}},
+			},
+		}
+	}
+
+	for _, tc := range []struct {
+		name      string
+		auth      string
+		tls       *tls.ConnectionState
+		principal Principal
+		err       error
+	}{
+		{name: "no credentials", err: ErrUnauthenticated},
+		{name: "token", auth: "Bearer alice-token", principal: alice},
+		{name: "other token", auth: "Bearer bob-token", principal: bob},
+		{name: "wrong token", auth: "Bearer carol-token", err: ErrUnauthenticated},
+		{name: "not bearer", auth: "Basic YWxpY2U6YWxpY2UtdG9rZW4=", err: ErrUnauthenticated},
+		{name: "client cert", tls: withCert("ops.example.com"), principal: ops},
+		{name: "unknown client cert", tls: withCert("eve.example.com"), err: ErrUnauthenticated},
+		{name: "unverified client cert", tls: &tls.ConnectionState{}, err: ErrUnauthenticated},
+		{name: "token over client cert", auth: "Bearer alice-token", tls: withCert("ops.example.com"), principal: alice},
+		{name: "wrong token with client cert", auth: "Bearer carol-token", tls: withCert("ops.example.com"), err: ErrUnauthenticated},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/api/stats", nil)
+			if tc.auth != "" {
+				r.Header.Set("Authorization", tc.auth)
+			}
+			r.TLS = tc.tls
+
+			p, err := a.Authenticate(r)
+			require.Equal(t, tc.err, err)
+			require.Equal(t, tc.principal, p)
+		})
+	}
+}
+
+func TestPrincipalContext(t *testing.T) {
+	_, ok := PrincipalFromContext(context.Background())
+	require.False(t, ok)
+
+	p := Principal{Name: "alice", Role: RoleViewer}
+	got, ok := PrincipalFromContext(WithPrincipal(context.Background(), p))
+	require.True(t, ok)
+	require.Equal(t, p, got)
+}
@@ -0,0 +1,149 @@
+package recovery
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/sirupsen/logrus"
+	"github.com/skycoin/skycoin/src/api/webrpc"
+	"github.com/skycoin/skycoin/src/cipher"
+	"github.com/skycoin/skycoin/src/util/droplet"
+
+	"github.com/skycoin/teller/src/scanner"
+)
+
+// scanLogInterval is how many blocks are scanned between progress logs
+const scanLogInterval = 1000
+
+// ErrQuit is returned if the scan was stopped
+var ErrQuit = errors.New("Recovery stopped")
+
+// SkyClient gets the history of the hot wallet from a skycoin node, e.g. a webrpc.Client
+type SkyClient interface {
+	GetAddressUxOuts(addrs []string) ([]webrpc.AddrUxoutResult, error)
+	GetTransactionByID(txid string) (*webrpc.TxnResult, error)
+}
+
+// ScanChain returns the deposits to addrs in the blocks from to to of a BTC or LTC node.
+// Returns ErrQuit if quit is closed before the scan is done.
+func ScanChain(log logrus.FieldLogger, client scanner.BtcRPCClient, coinType string, addrs []string, from, to int64, quit <-chan struct{}) ([]Deposit, error) {
+	var scanBlock func(*btcjson.GetBlockVerboseResult, []string) ([]scanner.Deposit, error)
+	switch coinType {
+	case scanner.CoinTypeBTC:
+		scanBlock = scanner.ScanBTCBlock
+	case scanner.CoinTypeLTC:
+		scanBlock = scanner.ScanLTCBlock
+	default:
+		return nil, scanner.ErrUnsupportedCoinType
+	}
+
+	log = log.WithFields(logrus.Fields{
+		"coinType": coinType,
+		"from":     from,
+		"to":       to,
+	})
+	log.Info("Scanning chain for deposits to the pool addresses")
+
+	var deposits []Deposit
+	for h := from; h <= to; h++ {
+		select {
+		case <-quit:
+			return nil, ErrQuit
+		default:
+		}
+
+		hash, err := client.GetBlockHash(h)
+		if err != nil {
+			return nil, fmt.Errorf("GetBlockHash %d failed: %v", h, err)
+		}
+
+		block, err := client.GetBlockVerboseTx(hash)
+		if err != nil {
+			return nil, fmt.Errorf("GetBlockVerboseTx %d failed: %v", h, err)
+		}
+
+		dvs, err := scanBlock(block, addrs)
+		if err != nil {
+			return nil, fmt.Errorf("Scan block %d failed: %v", h, err)
+		}
+
+		for _, dv := range dvs {
+			deposits = append(deposits, Deposit{
+				Deposit: dv,
+				Time:    block.Time,
+			})
+		}
+
+		if (h-from+1)%scanLogInterval == 0 {
+			log.WithFields(logrus.Fields{
+				"height":   h,
+				"deposits": len(deposits),
+			}).Info("Scanning chain")
+		}
+	}
+
+	log.WithField("deposits", len(deposits)).Info("Scanned chain")
+
+	return deposits, nil
+}
+
+// FindPayouts returns the outputs to other addresses of the transactions that spent the outputs of the hot wallet
+func FindPayouts(c SkyClient, walletAddrs []string) ([]Payout, error) {
+	wallet := make(map[string]struct{}, len(walletAddrs))
+	for _, a := range walletAddrs {
+		wallet[a] = struct{}{}
+	}
+
+	res, err := c.GetAddressUxOuts(walletAddrs)
+	if err != nil {
+		return nil, fmt.Errorf("GetAddressUxOuts failed: %v", err)
+	}
+
+	unspent := cipher.SHA256{}.Hex()
+	seen := make(map[string]struct{})
+
+	var payouts []Payout
+	for _, r := range res {
+		for _, ux := range r.UxOuts {
+			if ux.SpentTxID == "" || ux.SpentTxID == unspent {
+				continue
+			}
+
+			if _, ok := seen[ux.SpentTxID]; ok {
+				continue
+			}
+			seen[ux.SpentTxID] = struct{}{}
+
+			txn, err := c.GetTransactionByID(ux.SpentTxID)
+			if err != nil {
+				return nil, fmt.Errorf("GetTransactionByID %s failed: %v", ux.SpentTxID, err)
+			}
+
+			if txn == nil || txn.Transaction == nil {
+				return nil, fmt.Errorf("Transaction %s not found", ux.SpentTxID)
+			}
+
+			for _, o := range txn.Transaction.Transaction.Out {
+				if _, ok := wallet[o.Address]; ok {
+					continue
+				}
+
+				amt, err := droplet.FromString(o.Coins)
+				if err != nil {
+					return nil, fmt.Errorf("Invalid coins %q of output %s: %v", o.Coins, o.Hash, err)
+				}
+
+				payouts = append(payouts, Payout{
+					Txid:     ux.SpentTxID,
+					Output:   o.Hash,
+					Address:  o.Address,
+					Droplets: amt,
+					Time:     int64(txn.Transaction.Time),
+				})
+			}
+		}
+	}
+
+	return payouts, nil
+}
@@ -0,0 +1,79 @@
+package recovery
+
+import (
+	"github.com/skycoin/teller/src/exchange"
+)
+
+// UnsentDeposit is a deposit with the confirmations its scanner requires, that skycoins were not sent for
+type UnsentDeposit struct {
+	Deposit     Deposit
+	DepositInfo exchange.DepositInfo
+}
+
+// Reconciliation is the result of comparing the deposits and payouts found on the chains with a deposit db
+type Reconciliation struct {
+	// Deposits found on the chains that the db has no DepositInfo for
+	MissingDeposits []Deposit
+	// Deposits found on the chains whose DepositInfo was not sent
+	UnsentDeposits []UnsentDeposit
+	// Payouts of the hot wallet that no DepositInfo was sent by
+	UnmatchedPayouts []Payout
+}
+
+// Len returns the number of discrepancies found
+func (r Reconciliation) Len() int {
+	return len(r.MissingDeposits) + len(r.UnsentDeposits) + len(r.UnmatchedPayouts)
+}
+
+// Reconcile compares the deposits and payouts found on the chains with the DepositInfos of a db.
+// Deposits that were rejected or ignored as dust are not expected to be sent.
+// A payout is matched by the SkyOutput of a DepositInfo, or by its Txid and SkyAddress for DepositInfos
+// saved before SkyOutput was recorded.
+func Reconcile(deposits []Deposit, payouts []Payout, dis []exchange.DepositInfo) Reconciliation {
+	byID := make(map[string]exchange.DepositInfo, len(dis))
+	outputs := make(map[string]struct{}, len(dis))
+	sends := make(map[[2]string]struct{}, len(dis))
+	for _, di := range dis {
+		byID[di.DepositID] = di
+
+		if di.Txid == "" {
+			continue
+		}
+
+		if di.SkyOutput != "" {
+			outputs[di.SkyOutput] = struct{}{}
+		} else {
+			sends[[2]string{di.Txid, di.SkyAddress}] = struct{}{}
+		}
+	}
+
+	var r Reconciliation
+	for _, d := range sortDeposits(deposits) {
+		di, ok := byID[d.ID()]
+		if !ok {
+			r.MissingDeposits = append(r.MissingDeposits, d)
+			continue
+		}
+
+		switch di.Status {
+		case exchange.StatusWaitConfirm, exchange.StatusDone, exchange.StatusRejected, exchange.StatusIgnoredDust:
+		default:
+			r.UnsentDeposits = append(r.UnsentDeposits, UnsentDeposit{
+				Deposit:     d,
+				DepositInfo: di,
+			})
+		}
+	}
+
+	for _, p := range sortPayouts(payouts) {
+		if _, ok := outputs[p.Output]; ok {
+			continue
+		}
+		if _, ok := sends[[2]string{p.Txid, p.Address}]; ok {
+			continue
+		}
+		r.UnmatchedPayouts = append(r.UnmatchedPayouts, p)
+	}
+
+	return r
+}
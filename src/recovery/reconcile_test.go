@@ -0,0 +1,58 @@
+package recovery
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/exchange"
+	"github.com/skycoin/teller/src/scanner"
+)
+
+func TestReconcile(t *testing.T) {
+	deposits := []Deposit{
+		testDeposit(scanner.CoinTypeBTC, "addr-a", "tx-sent", 1e6, 100000),
+		testDeposit(scanner.CoinTypeBTC, "addr-a", "tx-batched", 1e6, 100100),
+		testDeposit(scanner.CoinTypeBTC, "addr-b", "tx-unsent", 1e6, 100200),
+		testDeposit(scanner.CoinTypeBTC, "addr-b", "tx-dust", 1e2, 100300),
+		testDeposit(scanner.CoinTypeBTC, "addr-c", "tx-missing", 2e6, 100400),
+		testDeposit(scanner.CoinTypeLTC, "addr-l", "tx-held", 1e6, 100000),
+	}
+
+	dis := []exchange.DepositInfo{
+		// Saved before SkyOutput was recorded
+		{DepositID: "tx-sent:0", Status: exchange.StatusDone, SkyAddress: "sky-addr-1", Txid: "sky-1"},
+		{DepositID: "tx-batched:0", Status: exchange.StatusWaitConfirm, SkyAddress: "sky-addr-1", Txid: "sky-2", SkyOutput: "out-2"},
+		{DepositID: "tx-unsent:0", Status: exchange.StatusWaitSend, SkyAddress: "sky-addr-2"},
+		{DepositID: "tx-dust:0", Status: exchange.StatusIgnoredDust, SkyAddress: "sky-addr-2"},
+		{DepositID: "tx-held:0", Status: exchange.StatusHeldForReview, SkyAddress: "sky-addr-3"},
+	}
+
+	payouts := []Payout{
+		{Txid: "sky-1", Output: "out-1", Address: "sky-addr-1", Droplets: 5e6, Time: 100050},
+		{Txid: "sky-2", Output: "out-2", Address: "sky-addr-1", Droplets: 5e6, Time: 100150},
+		// Another output of the batch, to a deposit the db doesn't know
+		{Txid: "sky-2", Output: "out-3", Address: "sky-addr-4", Droplets: 5e6, Time: 100150},
+		// Same transaction as a sent deposit, to another address
+		{Txid: "sky-1", Output: "out-4", Address: "sky-addr-5", Droplets: 5e6, Time: 100050},
+	}
+
+	r := Reconcile(deposits, payouts, dis)
+	require.Equal(t, 5, r.Len())
+
+	require.Len(t, r.MissingDeposits, 1)
+	require.Equal(t, "tx-missing", r.MissingDeposits[0].Tx)
+
+	require.Len(t, r.UnsentDeposits, 2)
+	require.Equal(t, "tx-held", r.UnsentDeposits[0].Deposit.Tx)
+	require.Equal(t, exchange.StatusHeldForReview, r.UnsentDeposits[0].DepositInfo.Status)
+	require.Equal(t, "tx-unsent", r.UnsentDeposits[1].Deposit.Tx)
+
+	require.Len(t, r.UnmatchedPayouts, 2)
+	require.Equal(t, "out-4", r.UnmatchedPayouts[0].Output)
+	require.Equal(t, "out-3", r.UnmatchedPayouts[1].Output)
+
+	// No discrepancies once the db has every deposit and payout
+	r = Reconcile(deposits[:2], payouts[:2], dis)
+	require.Equal(t, 0, r.Len())
+}
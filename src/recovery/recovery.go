@@ -0,0 +1,233 @@
+// Package recovery replays the deposits to the pool addresses from their blockchains, and the skycoin transactions
+// sent from the hot wallet. It rebuilds a best-effort deposit db from them after the db was lost,
+// by matching deposits with payouts by amount, or reconciles them with an existing db.
+package recovery
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/skycoin/skycoin/src/util/droplet"
+
+	"github.com/skycoin/teller/src/exchange"
+	"github.com/skycoin/teller/src/scanner"
+)
+
+// recoveredAmbiguous is the Error of a recovered deposit that other payouts could have paid
+const recoveredAmbiguous = "Recovered by matching amounts, other payouts of the same amount could have paid it"
+
+// blockTimeTolerance is how far ahead of the actual time a block timestamp can be
+const blockTimeTolerance = time.Hour * 2
+
+// Deposit is a deposit to a pool address found on its blockchain
+type Deposit struct {
+	scanner.Deposit
+	// Time of the block of the deposit, unix
+	Time int64
+}
+
+// Payout is an output of a skycoin transaction sent from the hot wallet to another address
+type Payout struct {
+	Txid string
+	// Hash of the output
+	Output   string
+	Address  string
+	Droplets uint64
+	// Time of the block of the transaction, unix
+	Time int64
+}
+
+// Config configures how deposits are matched with payouts
+type Config struct {
+	// SKY rates of the coin types, decimal strings, keyed by coin type
+	Rates       map[string]string
+	MaxDecimals int
+	Fee         exchange.Fee
+	// Maximum time between a deposit and its payout, 0 for no limit
+	MaxDelay time.Duration
+}
+
+// Match is a deposit matched with the payout that paid it
+type Match struct {
+	Deposit Deposit
+	Payout  Payout
+	// Rate the payout was matched at
+	Rate string
+	// SKY bought by the deposit before the fee was deducted, in droplets
+	SkyGross uint64
+	// Ambiguous is true if other payouts of the same amount could have paid the deposit
+	Ambiguous bool
+}
+
+// UnmatchedDeposit is a deposit no payout was found for. It may not have been paid,
+// or it was paid at another rate, e.g. the rate of a campaign or the rate before a change.
+type UnmatchedDeposit struct {
+	Deposit Deposit
+	// SKY the deposit buys at the configured rate, in droplets
+	Expected uint64
+	Reason   string
+}
+
+// Report is the result of matching deposits with payouts
+type Report struct {
+	Matches           []Match
+	UnmatchedDeposits []UnmatchedDeposit
+	// Payouts not matched with any deposit
+	UnmatchedPayouts []Payout
+}
+
+// MatchDeposits matches each deposit, oldest first, with the earliest unmatched payout of the SKY it buys at the
+// configured rate, sent after it. Once a deposit address is matched with a skycoin address, the later deposits
+// to it are only matched with payouts to that skycoin address, like the binding of the address.
+func MatchDeposits(cfg Config, deposits []Deposit, payouts []Payout) (Report, error) {
+	deposits = sortDeposits(deposits)
+	payouts = sortPayouts(payouts)
+
+	var r Report
+	matched := make([]bool, len(payouts))
+	bindings := make(map[string]string)
+
+	for _, d := range deposits {
+		rate, ok := cfg.Rates[d.CoinType]
+		if !ok {
+			r.UnmatchedDeposits = append(r.UnmatchedDeposits, UnmatchedDeposit{
+				Deposit: d,
+				Reason:  fmt.Sprintf("No SKY rate for %s", d.CoinType),
+			})
+			continue
+		}
+
+		gross, err := exchange.CalculateBtcSkyValue(d.Value, rate, cfg.MaxDecimals)
+		if err != nil {
+			return Report{}, err
+		}
+
+		expected, err := cfg.Fee.Apply(gross, cfg.MaxDecimals)
+		if err != nil {
+			return Report{}, err
+		}
+
+		if expected == 0 {
+			r.UnmatchedDeposits = append(r.UnmatchedDeposits, UnmatchedDeposit{
+				Deposit: d,
+				Reason:  "Buys no SKY at the configured rate",
+			})
+			continue
+		}
+
+		earliest := d.Time - int64(blockTimeTolerance/time.Second)
+		skyAddr, bound := bindings[d.Address]
+
+		var candidates []int
+		for i, p := range payouts {
+			if matched[i] || p.Droplets != expected || p.Time < earliest {
+				continue
+			}
+			if cfg.MaxDelay > 0 && p.Time > d.Time+int64(cfg.MaxDelay/time.Second) {
+				continue
+			}
+			if bound && p.Address != skyAddr {
+				continue
+			}
+			candidates = append(candidates, i)
+		}
+
+		if len(candidates) == 0 {
+			amt, err := droplet.ToString(expected)
+			if err != nil {
+				return Report{}, err
+			}
+
+			r.UnmatchedDeposits = append(r.UnmatchedDeposits, UnmatchedDeposit{
+				Deposit:  d,
+				Expected: expected,
+				Reason:   fmt.Sprintf("No payout of %s SKY found", amt),
+			})
+			continue
+		}
+
+		p := payouts[candidates[0]]
+		matched[candidates[0]] = true
+		bindings[d.Address] = p.Address
+
+		r.Matches = append(r.Matches, Match{
+			Deposit:   d,
+			Payout:    p,
+			Rate:      rate,
+			SkyGross:  gross,
+			Ambiguous: len(candidates) > 1,
+		})
+	}
+
+	for i, p := range payouts {
+		if !matched[i] {
+			r.UnmatchedPayouts = append(r.UnmatchedPayouts, p)
+		}
+	}
+
+	return r, nil
+}
+
+// sortDeposits returns a copy of deposits, oldest first
+func sortDeposits(deposits []Deposit) []Deposit {
+	deposits = append([]Deposit(nil), deposits...)
+	sort.Slice(deposits, func(i, j int) bool {
+		if deposits[i].Time != deposits[j].Time {
+			return deposits[i].Time < deposits[j].Time
+		}
+		return deposits[i].ID() < deposits[j].ID()
+	})
+	return deposits
+}
+
+// sortPayouts returns a copy of payouts, oldest first
+func sortPayouts(payouts []Payout) []Payout {
+	payouts = append([]Payout(nil), payouts...)
+	sort.Slice(payouts, func(i, j int) bool {
+		if payouts[i].Time != payouts[j].Time {
+			return payouts[i].Time < payouts[j].Time
+		}
+		return payouts[i].Output < payouts[j].Output
+	})
+	return payouts
+}
+
+// Write saves the matched deposits of a report to store as StatusDone deposits, binding their deposit addresses
+// to the skycoin addresses they were paid to. The Error of the ambiguous matches says so.
+// confirmationsRequired are the confirmations the scanner of each coin type requires.
+func Write(store *exchange.Store, r Report, confirmationsRequired map[string]int64) error {
+	for _, m := range r.Matches {
+		skyAddr, err := store.GetBindAddress(m.Deposit.Address)
+		if err != nil {
+			return err
+		}
+
+		if skyAddr == "" {
+			if err := store.BindAddress(m.Payout.Address, m.Deposit.Address, "", "", "", 0, 0); err != nil {
+				return fmt.Errorf("BindAddress %s failed: %v", m.Deposit.Address, err)
+			}
+		}
+
+		di, err := store.GetOrCreateDepositInfo(m.Deposit.Deposit, m.Rate, confirmationsRequired[m.Deposit.CoinType])
+		if err != nil {
+			return fmt.Errorf("GetOrCreateDepositInfo %s failed: %v", m.Deposit.ID(), err)
+		}
+
+		if _, err := store.UpdateDepositInfo(di.DepositID, func(di exchange.DepositInfo) exchange.DepositInfo {
+			di.Status = exchange.StatusDone
+			di.Txid = m.Payout.Txid
+			di.SkySent = m.Payout.Droplets
+			di.SkyGross = m.SkyGross
+			di.SkyOutput = m.Payout.Output
+			if m.Ambiguous {
+				di.Error = recoveredAmbiguous
+			}
+			return di
+		}); err != nil {
+			return fmt.Errorf("UpdateDepositInfo %s failed: %v", di.DepositID, err)
+		}
+	}
+
+	return nil
+}
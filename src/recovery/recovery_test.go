@@ -0,0 +1,240 @@
+package recovery
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/skycoin/skycoin/src/api/webrpc"
+	"github.com/skycoin/skycoin/src/cipher"
+	"github.com/skycoin/skycoin/src/visor"
+	"github.com/skycoin/skycoin/src/visor/historydb"
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/exchange"
+	"github.com/skycoin/teller/src/scanner"
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+func testDeposit(coinType, addr, tx string, value, t int64) Deposit {
+	return Deposit{
+		Deposit: scanner.Deposit{
+			CoinType: coinType,
+			Address:  addr,
+			Value:    value,
+			Height:   10,
+			Tx:       tx,
+			N:        0,
+		},
+		Time: t,
+	}
+}
+
+func TestMatchDeposits(t *testing.T) {
+	cfg := Config{
+		Rates: map[string]string{
+			scanner.CoinTypeBTC: "500",
+		},
+		MaxDecimals: 3,
+		MaxDelay:    time.Hour * 24,
+	}
+
+	deposits := []Deposit{
+		// Given in any order, matched oldest first
+		testDeposit(scanner.CoinTypeBTC, "addr-b", "tx-b", 2e6, 120000),
+		testDeposit(scanner.CoinTypeBTC, "addr-a", "tx-a1", 1e6, 100000),
+		testDeposit(scanner.CoinTypeBTC, "addr-a", "tx-a2", 1e6, 100500),
+		testDeposit(scanner.CoinTypeBTC, "addr-c", "tx-c", 3e6, 200000),
+		testDeposit(scanner.CoinTypeLTC, "addr-l", "tx-l", 1e6, 100000),
+	}
+
+	payouts := []Payout{
+		{Txid: "sky-1", Output: "out-1", Address: "sky-addr-1", Droplets: 5e6, Time: 100100},
+		{Txid: "sky-2", Output: "out-2", Address: "sky-addr-2", Droplets: 5e6, Time: 100600},
+		// Sent long before the deposit of the same amount
+		{Txid: "sky-3", Output: "out-3", Address: "sky-addr-3", Droplets: 10e6, Time: 100000},
+		{Txid: "sky-4", Output: "out-4", Address: "sky-addr-3", Droplets: 10e6, Time: 120050},
+		// Sent after the max delay
+		{Txid: "sky-5", Output: "out-5", Address: "sky-addr-5", Droplets: 15e6, Time: 200000 + 86401},
+	}
+
+	r, err := MatchDeposits(cfg, deposits, payouts)
+	require.NoError(t, err)
+
+	require.Len(t, r.Matches, 2)
+
+	// Either payout of 5 SKY could have paid the first deposit to addr-a
+	require.Equal(t, "tx-a1", r.Matches[0].Deposit.Tx)
+	require.Equal(t, "sky-1", r.Matches[0].Payout.Txid)
+	require.Equal(t, "500", r.Matches[0].Rate)
+	require.Equal(t, uint64(5e6), r.Matches[0].SkyGross)
+	require.True(t, r.Matches[0].Ambiguous)
+
+	require.Equal(t, "tx-b", r.Matches[1].Deposit.Tx)
+	require.Equal(t, "sky-4", r.Matches[1].Payout.Txid)
+	require.False(t, r.Matches[1].Ambiguous)
+
+	require.Len(t, r.UnmatchedDeposits, 3)
+
+	require.Equal(t, "tx-l", r.UnmatchedDeposits[0].Deposit.Tx)
+	require.Equal(t, "No SKY rate for LTC", r.UnmatchedDeposits[0].Reason)
+
+	// addr-a is bound to sky-addr-1, so the payout to sky-addr-2 can't have paid its second deposit
+	require.Equal(t, "tx-a2", r.UnmatchedDeposits[1].Deposit.Tx)
+	require.Equal(t, uint64(5e6), r.UnmatchedDeposits[1].Expected)
+	require.Equal(t, "No payout of 5.000000 SKY found", r.UnmatchedDeposits[1].Reason)
+
+	require.Equal(t, "tx-c", r.UnmatchedDeposits[2].Deposit.Tx)
+	require.Equal(t, uint64(15e6), r.UnmatchedDeposits[2].Expected)
+
+	require.Len(t, r.UnmatchedPayouts, 3)
+	require.Equal(t, "sky-3", r.UnmatchedPayouts[0].Txid)
+	require.Equal(t, "sky-2", r.UnmatchedPayouts[1].Txid)
+	require.Equal(t, "sky-5", r.UnmatchedPayouts[2].Txid)
+
+	// The fee is deducted from the SKY a deposit buys
+	cfg.Fee = exchange.Fee{
+		FixedDroplets: 1e6,
+	}
+	r, err = MatchDeposits(cfg, deposits[3:4], []Payout{
+		{Txid: "sky-6", Output: "out-6", Address: "sky-addr-6", Droplets: 14e6, Time: 200100},
+	})
+	require.NoError(t, err)
+	require.Len(t, r.Matches, 1)
+	require.Equal(t, uint64(15e6), r.Matches[0].SkyGross)
+	require.Equal(t, uint64(14e6), r.Matches[0].Payout.Droplets)
+}
+
+func TestWrite(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	log, _ := testutil.NewLogger(t)
+	store, err := exchange.NewStore(log, db, nil)
+	require.NoError(t, err)
+
+	r := Report{
+		Matches: []Match{
+			{
+				Deposit:   testDeposit(scanner.CoinTypeBTC, "addr-a", "tx-a1", 1e6, 100000),
+				Payout:    Payout{Txid: "sky-1", Output: "out-1", Address: "sky-addr-1", Droplets: 5e6, Time: 100100},
+				Rate:      "500",
+				SkyGross:  5e6,
+				Ambiguous: true,
+			},
+			{
+				Deposit:  testDeposit(scanner.CoinTypeBTC, "addr-a", "tx-a2", 1e6, 100500),
+				Payout:   Payout{Txid: "sky-2", Output: "out-2", Address: "sky-addr-1", Droplets: 5e6, Time: 100600},
+				Rate:     "500",
+				SkyGross: 5e6,
+			},
+		},
+	}
+
+	require.NoError(t, Write(store, r, map[string]int64{
+		scanner.CoinTypeBTC: 1,
+	}))
+
+	skyAddr, err := store.GetBindAddress("addr-a")
+	require.NoError(t, err)
+	require.Equal(t, "sky-addr-1", skyAddr)
+
+	dis, err := store.GetDepositInfoOfSkyAddress("sky-addr-1")
+	require.NoError(t, err)
+	require.Len(t, dis, 2)
+
+	for _, di := range dis {
+		require.Equal(t, exchange.StatusDone, di.Status)
+		require.Equal(t, uint64(5e6), di.SkySent)
+		require.Equal(t, uint64(5e6), di.SkyGross)
+		require.Equal(t, "500", di.ConversionRate)
+		require.Equal(t, int64(1), di.ConfirmationsRequired)
+
+		switch di.DepositID {
+		case "tx-a1:0":
+			require.Equal(t, "sky-1", di.Txid)
+			require.Equal(t, "out-1", di.SkyOutput)
+			require.Equal(t, recoveredAmbiguous, di.Error)
+		case "tx-a2:0":
+			require.Equal(t, "sky-2", di.Txid)
+			require.Empty(t, di.Error)
+		default:
+			t.Fatalf("unexpected deposit %s", di.DepositID)
+		}
+	}
+}
+
+type fakeSkyClient struct {
+	uxouts []webrpc.AddrUxoutResult
+	txns   map[string]*webrpc.TxnResult
+}
+
+func (c fakeSkyClient) GetAddressUxOuts(addrs []string) ([]webrpc.AddrUxoutResult, error) {
+	return c.uxouts, nil
+}
+
+func (c fakeSkyClient) GetTransactionByID(txid string) (*webrpc.TxnResult, error) {
+	txn, ok := c.txns[txid]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return txn, nil
+}
+
+func TestFindPayouts(t *testing.T) {
+	txn := func(t uint64, outs ...visor.ReadableTransactionOutput) *webrpc.TxnResult {
+		return &webrpc.TxnResult{
+			Transaction: &visor.TransactionResult{
+				Time: t,
+				Transaction: visor.ReadableTransaction{
+					Out: outs,
+				},
+			},
+		}
+	}
+
+	c := fakeSkyClient{
+		uxouts: []webrpc.AddrUxoutResult{
+			{
+				Address: "wallet-1",
+				UxOuts: []*historydb.UxOutJSON{
+					{Uxid: "ux-1", SpentTxID: "sky-1"},
+					// Unspent
+					{Uxid: "ux-2", SpentTxID: cipher.SHA256{}.Hex()},
+				},
+			},
+			{
+				Address: "wallet-2",
+				UxOuts: []*historydb.UxOutJSON{
+					// Spent by the same transaction as ux-1
+					{Uxid: "ux-3", SpentTxID: "sky-1"},
+					{Uxid: "ux-4", SpentTxID: "sky-2"},
+				},
+			},
+		},
+		txns: map[string]*webrpc.TxnResult{
+			"sky-1": txn(1000,
+				visor.ReadableTransactionOutput{Hash: "out-1", Address: "user-1", Coins: "5.000000"},
+				visor.ReadableTransactionOutput{Hash: "out-2", Address: "user-2", Coins: "10.5"},
+				// Change
+				visor.ReadableTransactionOutput{Hash: "out-3", Address: "wallet-1", Coins: "100"},
+			),
+			"sky-2": txn(2000,
+				visor.ReadableTransactionOutput{Hash: "out-4", Address: "user-1", Coins: "1"},
+			),
+		},
+	}
+
+	payouts, err := FindPayouts(c, []string{"wallet-1", "wallet-2"})
+	require.NoError(t, err)
+	require.Equal(t, []Payout{
+		{Txid: "sky-1", Output: "out-1", Address: "user-1", Droplets: 5e6, Time: 1000},
+		{Txid: "sky-1", Output: "out-2", Address: "user-2", Droplets: 10.5e6, Time: 1000},
+		{Txid: "sky-2", Output: "out-4", Address: "user-1", Droplets: 1e6, Time: 2000},
+	}, payouts)
+
+	// A spending transaction that can't be found fails
+	delete(c.txns, "sky-2")
+	_, err = FindPayouts(c, []string{"wallet-1", "wallet-2"})
+	require.Error(t, err)
+}
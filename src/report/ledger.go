@@ -0,0 +1,207 @@
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/skycoin/skycoin/src/util/droplet"
+
+	"github.com/skycoin/teller/src/exchange"
+)
+
+// LedgerEntry is a deposit of the ledger, in its current state
+type LedgerEntry struct {
+	Seq            uint64 `json:"seq"`
+	DepositID      string `json:"deposit_id"`
+	CoinType       string `json:"coin_type"`
+	DepositAddress string `json:"deposit_address"`
+	SkyAddress     string `json:"sky_address"`
+	// Transaction of the deposit, e.g. the BTC txid
+	DepositTxid string `json:"deposit_txid"`
+	// Measured in the smallest unit of the coin, e.g. satoshis for BTC
+	DepositValue   int64  `json:"deposit_value"`
+	ConversionRate string `json:"conversion_rate"`
+	// SKY sent and bought before the fee was deducted, in droplets
+	SkySent  uint64 `json:"sky_sent"`
+	SkyGross uint64 `json:"sky_gross"`
+	// Skycoin transaction that sent SkySent
+	Txid       string `json:"txid"`
+	Status     string `json:"status"`
+	Error      string `json:"error"`
+	ReceivedAt int64  `json:"received_at"`
+	SentAt     int64  `json:"sent_at"`
+	UpdatedAt  int64  `json:"updated_at"`
+	// Promo code the deposit address was bound with, empty if none
+	PromoCode string `json:"promo_code"`
+}
+
+// Ledger returns every deposit of the deposit event log, in its latest state, ordered by seq
+func Ledger(events []exchange.DepositEvent) []LedgerEntry {
+	entries := make(map[string]*LedgerEntry)
+
+	for _, ev := range events {
+		// Archived deposits are read from the archives, their events were removed
+		if ev.DepositInfo == nil || ev.Type == exchange.EventArchive {
+			continue
+		}
+
+		di := *ev.DepositInfo
+
+		e, ok := entries[di.DepositID]
+		if !ok {
+			e = &LedgerEntry{
+				ReceivedAt: ev.Time,
+			}
+			entries[di.DepositID] = e
+		}
+
+		if e.Txid == "" && di.Txid != "" {
+			e.SentAt = ev.Time
+		}
+
+		e.Seq = di.Seq
+		e.DepositID = di.DepositID
+		e.CoinType = di.CoinType
+		e.DepositAddress = di.DepositAddress
+		e.SkyAddress = di.SkyAddress
+		e.DepositTxid = depositTxid(di.DepositID)
+		e.DepositValue = di.DepositValue
+		e.ConversionRate = di.ConversionRate
+		e.SkySent = di.SkySent
+		e.SkyGross = di.SkyGross
+		e.Txid = di.Txid
+		e.Status = di.Status.String()
+		e.Error = di.Error
+		e.UpdatedAt = di.UpdatedAt
+		e.PromoCode = di.PromoCode
+	}
+
+	ledger := make([]LedgerEntry, 0, len(entries))
+	for _, e := range entries {
+		ledger = append(ledger, *e)
+	}
+
+	sort.Slice(ledger, func(i, j int) bool {
+		return ledger[i].Seq < ledger[j].Seq
+	})
+
+	return ledger
+}
+
+// depositTxid returns the transaction of a deposit ID, "txid:n"
+func depositTxid(depositID string) string {
+	if i := strings.LastIndex(depositID, ":"); i >= 0 {
+		return depositID[:i]
+	}
+	return depositID
+}
+
+var ledgerCSVHeader = []string{
+	"seq",
+	"deposit_id",
+	"coin_type",
+	"deposit_address",
+	"sky_address",
+	"deposit_txid",
+	"deposit_value",
+	"conversion_rate",
+	"sky_sent",
+	"sky_gross",
+	"txid",
+	"status",
+	"error",
+	"received_at",
+	"sent_at",
+	"updated_at",
+	"promo_code",
+}
+
+// WriteLedger writes the ledger in format, FormatJSON or FormatCSV, one entry at a time.
+// In CSV, times are RFC3339, and sky_sent and sky_gross are in SKY.
+func WriteLedger(w io.Writer, ledger []LedgerEntry, format string) error {
+	switch format {
+	case FormatJSON:
+		return writeLedgerJSON(w, ledger)
+	case FormatCSV:
+		return writeLedgerCSV(w, ledger)
+	default:
+		return ErrInvalidFormat
+	}
+}
+
+func writeLedgerJSON(w io.Writer, ledger []LedgerEntry) error {
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+
+	for i, e := range ledger {
+		sep := ",\n"
+		if i == 0 {
+			sep = "\n"
+		}
+		if _, err := io.WriteString(w, sep); err != nil {
+			return err
+		}
+
+		v, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+
+		if _, err := w.Write(v); err != nil {
+			return err
+		}
+	}
+
+	_, err := io.WriteString(w, "\n]\n")
+	return err
+}
+
+func writeLedgerCSV(w io.Writer, ledger []LedgerEntry) error {
+	cw := csv.NewWriter(w)
+
+	if err := cw.Write(ledgerCSVHeader); err != nil {
+		return err
+	}
+
+	for _, e := range ledger {
+		skySent, err := droplet.ToString(e.SkySent)
+		if err != nil {
+			return err
+		}
+
+		skyGross, err := droplet.ToString(e.SkyGross)
+		if err != nil {
+			return err
+		}
+
+		if err := cw.Write([]string{
+			strconv.FormatUint(e.Seq, 10),
+			e.DepositID,
+			e.CoinType,
+			e.DepositAddress,
+			e.SkyAddress,
+			e.DepositTxid,
+			strconv.FormatInt(e.DepositValue, 10),
+			e.ConversionRate,
+			skySent,
+			skyGross,
+			e.Txid,
+			e.Status,
+			e.Error,
+			formatTime(e.ReceivedAt),
+			formatTime(e.SentAt),
+			formatTime(e.UpdatedAt),
+			e.PromoCode,
+		}); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
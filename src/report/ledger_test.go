@@ -0,0 +1,89 @@
+package report
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/exchange"
+)
+
+func TestLedger(t *testing.T) {
+	ledger := Ledger(testEvents())
+	require.Len(t, ledger, 4)
+
+	for i, id := range []string{"tx1:0", "tx2:0", "tx3:0", "tx4:0"} {
+		require.Equal(t, uint64(i+1), ledger[i].Seq)
+		require.Equal(t, id, ledger[i].DepositID)
+	}
+
+	require.Equal(t, LedgerEntry{
+		Seq:            2,
+		DepositID:      "tx2:0",
+		CoinType:       "BTC",
+		DepositAddress: "b2",
+		SkyAddress:     "s2",
+		DepositTxid:    "tx2",
+		DepositValue:   200000,
+		ConversionRate: "600",
+		SkySent:        1200e6,
+		Txid:           "skytx2",
+		Status:         exchange.StatusDone.String(),
+		ReceivedAt:     testDay.Add(time.Hour * 2).Unix(),
+		SentAt:         testDay.Add(time.Hour * 4).Unix(),
+	}, ledger[1])
+
+	require.Equal(t, "Skycoin send amount is 0", ledger[2].Error)
+	require.Equal(t, int64(0), ledger[2].SentAt)
+
+	require.Empty(t, Ledger(nil))
+}
+
+func TestWriteLedger(t *testing.T) {
+	ledger := Ledger(testEvents())
+
+	var b bytes.Buffer
+	require.NoError(t, WriteLedger(&b, ledger, FormatJSON))
+
+	var entries []LedgerEntry
+	require.NoError(t, json.Unmarshal(b.Bytes(), &entries))
+	require.Equal(t, ledger, entries)
+
+	b.Reset()
+	require.NoError(t, WriteLedger(&b, nil, FormatJSON))
+	require.NoError(t, json.Unmarshal(b.Bytes(), &entries))
+	require.Empty(t, entries)
+
+	b.Reset()
+	require.NoError(t, WriteLedger(&b, ledger, FormatCSV))
+
+	rows, err := csv.NewReader(&b).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rows, 5)
+	require.Equal(t, ledgerCSVHeader, rows[0])
+	require.Equal(t, []string{
+		"1",
+		"tx1:0",
+		"BTC",
+		"b1",
+		"s1",
+		"tx1",
+		"100000",
+		"500",
+		"500.000000",
+		"0.000000",
+		"skytx1",
+		"done",
+		"",
+		"2018-03-03T23:00:00Z",
+		"2018-03-04T01:00:00Z",
+		"",
+		"FRIEND",
+	}, rows[1])
+
+	require.Equal(t, ErrInvalidFormat, WriteLedger(&b, ledger, "xml"))
+}
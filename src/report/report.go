@@ -0,0 +1,355 @@
+// Package report generates daily reconciliation reports of the deposits received and the skycoins sent,
+// and exports the deposit ledger, from the exchange's deposit event log
+package report
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/skycoin/skycoin/src/util/droplet"
+
+	"github.com/skycoin/teller/src/exchange"
+)
+
+// DateFormat is the format of report dates
+const DateFormat = "2006-01-02"
+
+// Report summarizes the deposits of a UTC day
+type Report struct {
+	// UTC day of the report, in DateFormat
+	Date string `json:"date"`
+	// Unix time range of the report, [From, To)
+	From        int64 `json:"from"`
+	To          int64 `json:"to"`
+	GeneratedAt int64 `json:"generated_at"`
+	// Deposits received during the day, per coin type
+	Received []CoinTotal `json:"received"`
+	// Deposits sent during the day, and the SKY sent for them, in droplets
+	DepositsSent int    `json:"deposits_sent"`
+	SkySent      uint64 `json:"sky_sent"`
+	// Deposits sent during the day, per coin type and conversion rate
+	Rates []RateTotal `json:"rates"`
+	// Statuses of the report's deposits at the end of the day
+	Statuses map[string]int `json:"statuses"`
+	// Errors recorded during the day
+	Errors []DepositError `json:"errors"`
+	// Deposits received, sent or failed during the day
+	Deposits []Deposit `json:"deposits"`
+}
+
+// CoinTotal is the total of deposits of a coin type
+type CoinTotal struct {
+	CoinType string `json:"coin_type"`
+	Deposits int    `json:"deposits"`
+	// Measured in the smallest unit of the coin, e.g. satoshis for BTC
+	Value int64 `json:"value"`
+}
+
+// RateTotal is the total of deposits sent at a conversion rate
+type RateTotal struct {
+	CoinType     string `json:"coin_type"`
+	Rate         string `json:"rate"`
+	Deposits     int    `json:"deposits"`
+	DepositValue int64  `json:"deposit_value"`
+	SkySent      uint64 `json:"sky_sent"`
+}
+
+// DepositError is an error recorded for a deposit
+type DepositError struct {
+	DepositID string `json:"deposit_id"`
+	Time      int64  `json:"time"`
+	Status    string `json:"status"`
+	Error     string `json:"error"`
+}
+
+// Deposit is the state of a deposit at the end of the day
+type Deposit struct {
+	DepositID      string `json:"deposit_id"`
+	CoinType       string `json:"coin_type"`
+	DepositAddress string `json:"deposit_address"`
+	SkyAddress     string `json:"sky_address"`
+	DepositValue   int64  `json:"deposit_value"`
+	ReceivedAt     int64  `json:"received_at"`
+	Status         string `json:"status"`
+	ConversionRate string `json:"conversion_rate"`
+	SkySent        uint64 `json:"sky_sent"`
+	Txid           string `json:"txid,omitempty"`
+	SentAt         int64  `json:"sent_at,omitempty"`
+	Error          string `json:"error,omitempty"`
+}
+
+// depositState tracks a deposit through the event log
+type depositState struct {
+	di         exchange.DepositInfo
+	receivedAt int64
+	sentAt     int64
+}
+
+// Generate builds the report of the UTC day of date from the deposit event log, which must be in log order
+func Generate(events []exchange.DepositEvent, date time.Time) Report {
+	from := Day(date)
+	to := from.AddDate(0, 0, 1)
+
+	r := Report{
+		Date:        from.Format(DateFormat),
+		From:        from.Unix(),
+		To:          to.Unix(),
+		GeneratedAt: time.Now().UTC().Unix(),
+		Received:    []CoinTotal{},
+		Rates:       []RateTotal{},
+		Statuses:    make(map[string]int),
+		Errors:      []DepositError{},
+		Deposits:    []Deposit{},
+	}
+
+	states := make(map[string]*depositState)
+	var touched []string
+	isTouched := make(map[string]bool)
+	received := make(map[string]*CoinTotal)
+	rates := make(map[[2]string]*RateTotal)
+
+	touch := func(id string) {
+		if !isTouched[id] {
+			isTouched[id] = true
+			touched = append(touched, id)
+		}
+	}
+
+	for _, ev := range events {
+		if ev.Type != exchange.EventDepositInfo || ev.DepositInfo == nil {
+			continue
+		}
+
+		if ev.Time >= r.To {
+			break
+		}
+
+		di := *ev.DepositInfo
+		inDay := ev.Time >= r.From
+
+		st, ok := states[di.DepositID]
+		if !ok {
+			st = &depositState{
+				receivedAt: ev.Time,
+			}
+			states[di.DepositID] = st
+
+			if inDay {
+				touch(di.DepositID)
+
+				t := received[di.CoinType]
+				if t == nil {
+					t = &CoinTotal{
+						CoinType: di.CoinType,
+					}
+					received[di.CoinType] = t
+				}
+				t.Deposits++
+				t.Value += di.DepositValue
+			}
+		}
+
+		prev := st.di
+		st.di = di
+
+		if prev.Txid == "" && di.Txid != "" {
+			st.sentAt = ev.Time
+
+			if inDay {
+				touch(di.DepositID)
+
+				r.DepositsSent++
+				r.SkySent += di.SkySent
+
+				k := [2]string{di.CoinType, di.ConversionRate}
+				t := rates[k]
+				if t == nil {
+					t = &RateTotal{
+						CoinType: di.CoinType,
+						Rate:     di.ConversionRate,
+					}
+					rates[k] = t
+				}
+				t.Deposits++
+				t.DepositValue += di.DepositValue
+				t.SkySent += di.SkySent
+			}
+		}
+
+		if inDay && di.Error != "" && di.Error != prev.Error {
+			touch(di.DepositID)
+
+			r.Errors = append(r.Errors, DepositError{
+				DepositID: di.DepositID,
+				Time:      ev.Time,
+				Status:    di.Status.String(),
+				Error:     di.Error,
+			})
+		}
+	}
+
+	for _, t := range received {
+		r.Received = append(r.Received, *t)
+	}
+	sort.Slice(r.Received, func(i, j int) bool {
+		return r.Received[i].CoinType < r.Received[j].CoinType
+	})
+
+	for _, t := range rates {
+		r.Rates = append(r.Rates, *t)
+	}
+	sort.Slice(r.Rates, func(i, j int) bool {
+		if r.Rates[i].CoinType != r.Rates[j].CoinType {
+			return r.Rates[i].CoinType < r.Rates[j].CoinType
+		}
+		return r.Rates[i].Rate < r.Rates[j].Rate
+	})
+
+	for _, id := range touched {
+		st := states[id]
+		status := st.di.Status.String()
+		r.Statuses[status]++
+
+		r.Deposits = append(r.Deposits, Deposit{
+			DepositID:      st.di.DepositID,
+			CoinType:       st.di.CoinType,
+			DepositAddress: st.di.DepositAddress,
+			SkyAddress:     st.di.SkyAddress,
+			DepositValue:   st.di.DepositValue,
+			ReceivedAt:     st.receivedAt,
+			Status:         status,
+			ConversionRate: st.di.ConversionRate,
+			SkySent:        st.di.SkySent,
+			Txid:           st.di.Txid,
+			SentAt:         st.sentAt,
+			Error:          st.di.Error,
+		})
+	}
+
+	return r
+}
+
+// Day returns the start of the UTC day of t
+func Day(t time.Time) time.Time {
+	y, m, d := t.UTC().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// ParseDate parses a report date in DateFormat
+func ParseDate(date string) (time.Time, error) {
+	return time.ParseInLocation(DateFormat, date, time.UTC)
+}
+
+// formatTime formats a unix time as RFC3339, or returns "" for 0
+func formatTime(t int64) string {
+	if t == 0 {
+		return ""
+	}
+	return time.Unix(t, 0).UTC().Format(time.RFC3339)
+}
+
+var csvHeader = []string{
+	"deposit_id",
+	"coin_type",
+	"deposit_address",
+	"sky_address",
+	"deposit_value",
+	"received_at",
+	"status",
+	"conversion_rate",
+	"sky_sent",
+	"txid",
+	"sent_at",
+	"error",
+}
+
+// WriteCSV writes the deposits of the report as CSV, one row per deposit.
+// Times are RFC3339, and sky_sent is in SKY.
+func (r Report) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+
+	for _, d := range r.Deposits {
+		skySent, err := droplet.ToString(d.SkySent)
+		if err != nil {
+			return err
+		}
+
+		if err := cw.Write([]string{
+			d.DepositID,
+			d.CoinType,
+			d.DepositAddress,
+			d.SkyAddress,
+			strconv.FormatInt(d.DepositValue, 10),
+			formatTime(d.ReceivedAt),
+			d.Status,
+			d.ConversionRate,
+			skySent,
+			d.Txid,
+			formatTime(d.SentAt),
+			d.Error,
+		}); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// Summary returns a plain text summary of the report, e.g. for an email
+func (r Report) Summary() (string, error) {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "Teller reconciliation report for %s (UTC)\n\n", r.Date)
+
+	fmt.Fprintln(&b, "Received:")
+	if len(r.Received) == 0 {
+		fmt.Fprintln(&b, "  none")
+	}
+	for _, t := range r.Received {
+		fmt.Fprintf(&b, "  %s: %d deposits, %d\n", t.CoinType, t.Deposits, t.Value)
+	}
+
+	skySent, err := droplet.ToString(r.SkySent)
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprintf(&b, "\nSent: %s SKY for %d deposits\n", skySent, r.DepositsSent)
+
+	for _, t := range r.Rates {
+		sent, err := droplet.ToString(t.SkySent)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&b, "  %s at %s: %d deposits, %d, %s SKY\n", t.CoinType, t.Rate, t.Deposits, t.DepositValue, sent)
+	}
+
+	fmt.Fprintln(&b, "\nStatuses:")
+	statuses := make([]string, 0, len(r.Statuses))
+	for s := range r.Statuses {
+		statuses = append(statuses, s)
+	}
+	sort.Strings(statuses)
+	if len(statuses) == 0 {
+		fmt.Fprintln(&b, "  none")
+	}
+	for _, s := range statuses {
+		fmt.Fprintf(&b, "  %s: %d\n", s, r.Statuses[s])
+	}
+
+	fmt.Fprintf(&b, "\nErrors: %d\n", len(r.Errors))
+	for _, e := range r.Errors {
+		fmt.Fprintf(&b, "  %s %s: %s\n", time.Unix(e.Time, 0).UTC().Format(time.RFC3339), e.DepositID, e.Error)
+	}
+
+	return b.String(), nil
+}
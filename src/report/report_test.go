@@ -0,0 +1,230 @@
+package report
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/exchange"
+)
+
+var testDay = time.Date(2018, 3, 4, 0, 0, 0, 0, time.UTC)
+
+// testEvents is the event log of four deposits:
+// tx1:0 is received the day before and sent during the day,
+// tx2:0 is received and sent during the day, and confirmed the day after,
+// tx3:0 is received during the day and fails,
+// tx4:0 is received and sent the day after
+func testEvents() []exchange.DepositEvent {
+	at := func(d time.Duration) int64 {
+		return testDay.Add(d).Unix()
+	}
+
+	var evs []exchange.DepositEvent
+	add := func(t int64, di exchange.DepositInfo) {
+		evs = append(evs, exchange.DepositEvent{
+			Seq:         uint64(len(evs) + 1),
+			Time:        t,
+			Type:        exchange.EventDepositInfo,
+			DepositInfo: &di,
+		})
+	}
+
+	tx1 := exchange.DepositInfo{
+		Seq:            1,
+		DepositID:      "tx1:0",
+		CoinType:       "BTC",
+		DepositAddress: "b1",
+		SkyAddress:     "s1",
+		DepositValue:   100000,
+		ConversionRate: "500",
+		Status:         exchange.StatusWaitSend,
+		PromoCode:      "FRIEND",
+	}
+	add(at(-time.Hour), tx1)
+
+	evs = append(evs, exchange.DepositEvent{
+		Seq:        uint64(len(evs) + 1),
+		Time:       at(time.Minute),
+		Type:       exchange.EventBindAddress,
+		SkyAddress: "s2",
+		BtcAddress: "b2",
+	})
+
+	tx1.Status = exchange.StatusWaitConfirm
+	tx1.Txid = "skytx1"
+	tx1.SkySent = 500e6
+	add(at(time.Hour), tx1)
+
+	tx2 := exchange.DepositInfo{
+		Seq:            2,
+		DepositID:      "tx2:0",
+		CoinType:       "BTC",
+		DepositAddress: "b2",
+		SkyAddress:     "s2",
+		DepositValue:   200000,
+		ConversionRate: "600",
+		Status:         exchange.StatusWaitSend,
+	}
+	add(at(time.Hour*2), tx2)
+
+	tx3 := exchange.DepositInfo{
+		Seq:            3,
+		DepositID:      "tx3:0",
+		CoinType:       "LTC",
+		DepositAddress: "l3",
+		SkyAddress:     "s3",
+		DepositValue:   300000,
+		ConversionRate: "50",
+		Status:         exchange.StatusWaitSend,
+	}
+	add(at(time.Hour*3), tx3)
+
+	tx2.Status = exchange.StatusWaitConfirm
+	tx2.Txid = "skytx2"
+	tx2.SkySent = 1200e6
+	add(at(time.Hour*4), tx2)
+
+	tx1.Status = exchange.StatusDone
+	add(at(time.Hour*5), tx1)
+
+	tx3.Status = exchange.StatusDone
+	tx3.Error = "Skycoin send amount is 0"
+	add(at(time.Hour*6), tx3)
+
+	// The next day is not in the report
+	tx2.Status = exchange.StatusDone
+	add(at(time.Hour*25), tx2)
+
+	tx4 := tx2
+	tx4.Seq = 4
+	tx4.DepositID = "tx4:0"
+	add(at(time.Hour*26), tx4)
+
+	return evs
+}
+
+func TestGenerate(t *testing.T) {
+	r := Generate(testEvents(), testDay.Add(time.Hour*12))
+
+	require.Equal(t, "2018-03-04", r.Date)
+	require.Equal(t, testDay.Unix(), r.From)
+	require.Equal(t, testDay.AddDate(0, 0, 1).Unix(), r.To)
+
+	require.Equal(t, []CoinTotal{
+		{CoinType: "BTC", Deposits: 1, Value: 200000},
+		{CoinType: "LTC", Deposits: 1, Value: 300000},
+	}, r.Received)
+
+	require.Equal(t, 2, r.DepositsSent)
+	require.Equal(t, uint64(1700e6), r.SkySent)
+	require.Equal(t, []RateTotal{
+		{CoinType: "BTC", Rate: "500", Deposits: 1, DepositValue: 100000, SkySent: 500e6},
+		{CoinType: "BTC", Rate: "600", Deposits: 1, DepositValue: 200000, SkySent: 1200e6},
+	}, r.Rates)
+
+	require.Equal(t, map[string]int{
+		exchange.StatusDone.String():        2,
+		exchange.StatusWaitConfirm.String(): 1,
+	}, r.Statuses)
+
+	require.Equal(t, []DepositError{
+		{
+			DepositID: "tx3:0",
+			Time:      testDay.Add(time.Hour * 6).Unix(),
+			Status:    exchange.StatusDone.String(),
+			Error:     "Skycoin send amount is 0",
+		},
+	}, r.Errors)
+
+	require.Len(t, r.Deposits, 3)
+	require.Equal(t, Deposit{
+		DepositID:      "tx1:0",
+		CoinType:       "BTC",
+		DepositAddress: "b1",
+		SkyAddress:     "s1",
+		DepositValue:   100000,
+		ReceivedAt:     testDay.Add(-time.Hour).Unix(),
+		Status:         exchange.StatusDone.String(),
+		ConversionRate: "500",
+		SkySent:        500e6,
+		Txid:           "skytx1",
+		SentAt:         testDay.Add(time.Hour).Unix(),
+	}, r.Deposits[0])
+	require.Equal(t, "tx2:0", r.Deposits[1].DepositID)
+	require.Equal(t, exchange.StatusWaitConfirm.String(), r.Deposits[1].Status)
+	require.Equal(t, "tx3:0", r.Deposits[2].DepositID)
+	require.Equal(t, "Skycoin send amount is 0", r.Deposits[2].Error)
+
+	// A day without events
+	r = Generate(testEvents(), testDay.AddDate(0, 0, -2))
+	require.Equal(t, "2018-03-02", r.Date)
+	require.Empty(t, r.Received)
+	require.Empty(t, r.Deposits)
+	require.Equal(t, 0, r.DepositsSent)
+	require.NotNil(t, r.Rates)
+	require.NotNil(t, r.Errors)
+}
+
+func TestWriteCSV(t *testing.T) {
+	r := Generate(testEvents(), testDay)
+
+	var b bytes.Buffer
+	require.NoError(t, r.WriteCSV(&b))
+
+	rows, err := csv.NewReader(&b).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rows, 4)
+	require.Equal(t, csvHeader, rows[0])
+	require.Equal(t, []string{
+		"tx1:0",
+		"BTC",
+		"b1",
+		"s1",
+		"100000",
+		"2018-03-03T23:00:00Z",
+		"done",
+		"500",
+		"500.000000",
+		"skytx1",
+		"2018-03-04T01:00:00Z",
+		"",
+	}, rows[1])
+	require.Equal(t, "", rows[3][9])
+	require.Equal(t, "", rows[3][10])
+}
+
+func TestSummary(t *testing.T) {
+	s, err := Generate(testEvents(), testDay).Summary()
+	require.NoError(t, err)
+
+	for _, line := range []string{
+		"Teller reconciliation report for 2018-03-04 (UTC)",
+		"  BTC: 1 deposits, 200000",
+		"  LTC: 1 deposits, 300000",
+		"Sent: 1700.000000 SKY for 2 deposits",
+		"  BTC at 600: 1 deposits, 200000, 1200.000000 SKY",
+		"  done: 2",
+		"Errors: 1",
+		"  2018-03-04T06:00:00Z tx3:0: Skycoin send amount is 0",
+	} {
+		require.True(t, strings.Contains(s, line+"\n"), line)
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	d, err := ParseDate("2018-03-04")
+	require.NoError(t, err)
+	require.Equal(t, testDay, d)
+
+	for _, v := range []string{"", "2018-3-4", "../2018-03-04", "2018-03-04T00:00:00Z"} {
+		_, err := ParseDate(v)
+		require.Error(t, err, v)
+	}
+
+	require.Equal(t, testDay, Day(time.Date(2018, 3, 4, 23, 59, 59, 0, time.FixedZone("", -3600))).AddDate(0, 0, -1))
+}
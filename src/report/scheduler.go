@@ -0,0 +1,178 @@
+package report
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/skycoin/teller/src/exchange"
+)
+
+const checkPeriod = time.Minute * 10
+
+// ErrFutureDate is returned when generating the report of a day that has not started yet
+var ErrFutureDate = errors.New("Report date is in the future")
+
+// EventSource provides the deposit event log
+type EventSource interface {
+	GetDepositEvents() ([]exchange.DepositEvent, error)
+}
+
+// Mailer emails reports to the operators
+type Mailer interface {
+	Email(subject, body string) error
+}
+
+// SchedulerConfig configures the Scheduler
+type SchedulerConfig struct {
+	CheckPeriod time.Duration // how often to check whether the previous day's report is due
+}
+
+// Scheduler generates the report of the previous day once it is over, and saves it to the Store.
+// If there is a Mailer, the scheduled reports are emailed.
+type Scheduler struct {
+	log    logrus.FieldLogger
+	cfg    SchedulerConfig
+	events EventSource
+	store  *Store
+	mailer Mailer
+	now    func() time.Time
+	lock   sync.Mutex // serializes report generation
+	quit   chan struct{}
+	done   chan struct{}
+}
+
+// NewScheduler creates a Scheduler
+func NewScheduler(log logrus.FieldLogger, events EventSource, store *Store, cfg SchedulerConfig) *Scheduler {
+	if cfg.CheckPeriod == 0 {
+		cfg.CheckPeriod = checkPeriod
+	}
+
+	return &Scheduler{
+		log:    log.WithField("prefix", "report.scheduler"),
+		cfg:    cfg,
+		events: events,
+		store:  store,
+		now:    time.Now,
+		quit:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+// SetMailer sets the Mailer that scheduled reports are emailed with
+func (s *Scheduler) SetMailer(m Mailer) {
+	s.mailer = m
+}
+
+// Run generates the previous day's report when it is due, checking every CheckPeriod until Shutdown is called
+func (s *Scheduler) Run() error {
+	log := s.log.WithField("config", s.cfg)
+	log.Info("Start report scheduler")
+	defer log.Info("Report scheduler closed")
+	defer close(s.done)
+
+	for {
+		if err := s.GenerateDue(); err != nil {
+			log.WithError(err).Error("Scheduler.GenerateDue failed")
+		}
+
+		select {
+		case <-s.quit:
+			return nil
+		case <-time.After(s.cfg.CheckPeriod):
+		}
+	}
+}
+
+// Shutdown stops the Scheduler
+func (s *Scheduler) Shutdown() {
+	close(s.quit)
+	<-s.done
+}
+
+// GenerateDue generates and emails the previous day's report, if it has not been generated yet
+func (s *Scheduler) GenerateDue() error {
+	date := Day(s.now()).AddDate(0, 0, -1)
+
+	ok, err := s.store.Has(date.Format(DateFormat))
+	if err != nil || ok {
+		return err
+	}
+
+	r, err := s.Generate(date)
+	if err != nil {
+		return err
+	}
+
+	if s.mailer == nil {
+		return nil
+	}
+
+	return s.email(r)
+}
+
+// Generate generates and saves the report of the UTC day of date, replacing a previous report of the same day.
+// The report of the current day only covers the day up to now.
+func (s *Scheduler) Generate(date time.Time) (Report, error) {
+	if Day(date).After(s.now()) {
+		return Report{}, ErrFutureDate
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	events, err := s.events.GetDepositEvents()
+	if err != nil {
+		return Report{}, err
+	}
+
+	r := Generate(events, date)
+
+	if err := s.store.Save(r); err != nil {
+		return Report{}, err
+	}
+
+	s.log.WithFields(logrus.Fields{
+		"date":     r.Date,
+		"deposits": len(r.Deposits),
+		"errors":   len(r.Errors),
+	}).Info("Generated report")
+
+	return r, nil
+}
+
+// Dates returns the dates of the saved reports, oldest first
+func (s *Scheduler) Dates() ([]string, error) {
+	return s.store.Dates()
+}
+
+// Get returns the saved report of date, in format
+func (s *Scheduler) Get(date, format string) ([]byte, error) {
+	return s.store.Get(date, format)
+}
+
+// email sends the summary of the report, followed by its CSV
+func (s *Scheduler) email(r Report) error {
+	summary, err := r.Summary()
+	if err != nil {
+		return err
+	}
+
+	csv, err := s.store.Get(r.Date, FormatCSV)
+	if err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf("%s\nDeposits (CSV):\n\n%s", summary, csv)
+
+	if err := s.mailer.Email(fmt.Sprintf("teller reconciliation report %s", r.Date), body); err != nil {
+		return fmt.Errorf("Emailing report failed: %v", err)
+	}
+
+	s.log.WithField("date", r.Date).Info("Emailed report")
+
+	return nil
+}
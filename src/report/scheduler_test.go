@@ -0,0 +1,110 @@
+package report
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/exchange"
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+type dummyEventSource struct {
+	events []exchange.DepositEvent
+	err    error
+}
+
+func (s dummyEventSource) GetDepositEvents() ([]exchange.DepositEvent, error) {
+	return s.events, s.err
+}
+
+type dummyMailer struct {
+	sync.Mutex
+	subjects []string
+	bodies   []string
+}
+
+func (m *dummyMailer) Email(subject, body string) error {
+	m.Lock()
+	defer m.Unlock()
+	m.subjects = append(m.subjects, subject)
+	m.bodies = append(m.bodies, body)
+	return nil
+}
+
+func (m *dummyMailer) received() []string {
+	m.Lock()
+	defer m.Unlock()
+	return append([]string(nil), m.subjects...)
+}
+
+func TestSchedulerRun(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+	store, shutdown := prepareStore(t)
+	defer shutdown()
+
+	s := NewScheduler(log, dummyEventSource{events: testEvents()}, store, SchedulerConfig{
+		CheckPeriod: time.Millisecond * 10,
+	})
+	s.now = func() time.Time {
+		return testDay.Add(time.Hour * 25)
+	}
+
+	m := &dummyMailer{}
+	s.SetMailer(m)
+
+	go s.Run() // nolint: errcheck
+
+	// The previous day's report is generated and emailed once
+	for i := 0; i < 100 && len(m.received()) == 0; i++ {
+		time.Sleep(time.Millisecond * 10)
+	}
+	time.Sleep(time.Millisecond * 50)
+
+	s.Shutdown()
+
+	require.Equal(t, []string{"teller reconciliation report 2018-03-04"}, m.received())
+	require.True(t, strings.Contains(m.bodies[0], "Sent: 1700.000000 SKY for 2 deposits\n"))
+	require.True(t, strings.Contains(m.bodies[0], strings.Join(csvHeader, ",")+"\n"))
+
+	dates, err := s.Dates()
+	require.NoError(t, err)
+	require.Equal(t, []string{"2018-03-04"}, dates)
+}
+
+func TestSchedulerGenerate(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+	store, shutdown := prepareStore(t)
+	defer shutdown()
+
+	src := &dummyEventSource{events: testEvents()}
+	s := NewScheduler(log, src, store, SchedulerConfig{})
+	s.now = func() time.Time {
+		return testDay.Add(time.Hour * 3)
+	}
+
+	// The current day is reported up to now
+	r, err := s.Generate(testDay)
+	require.NoError(t, err)
+	require.Equal(t, "2018-03-04", r.Date)
+
+	_, err = s.Get("2018-03-04", FormatJSON)
+	require.NoError(t, err)
+
+	_, err = s.Generate(testDay.AddDate(0, 0, 1))
+	require.Equal(t, ErrFutureDate, err)
+
+	// Without a mailer, GenerateDue only saves the report
+	require.NoError(t, s.GenerateDue())
+	dates, err := s.Dates()
+	require.NoError(t, err)
+	require.Equal(t, []string{"2018-03-03", "2018-03-04"}, dates)
+
+	src.err = errors.New("db closed")
+	_, err = s.Generate(testDay)
+	require.Error(t, err)
+}
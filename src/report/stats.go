@@ -0,0 +1,248 @@
+package report
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/skycoin/teller/src/exchange"
+)
+
+const (
+	// IntervalHour buckets stats by UTC hour
+	IntervalHour = "hour"
+	// IntervalDay buckets stats by UTC day
+	IntervalDay = "day"
+)
+
+// ErrInvalidInterval is returned for an interval other than IntervalHour or IntervalDay
+var ErrInvalidInterval = errors.New("Invalid interval, must be hour or day")
+
+// ParseInterval returns the duration of IntervalHour or IntervalDay
+func ParseInterval(interval string) (time.Duration, error) {
+	switch interval {
+	case IntervalHour:
+		return time.Hour, nil
+	case IntervalDay:
+		return time.Hour * 24, nil
+	default:
+		return 0, ErrInvalidInterval
+	}
+}
+
+// Stats are the totals and time series of the deposit pipeline over a time range, e.g. for a dashboard
+type Stats struct {
+	Interval string `json:"interval"`
+	// Unix time range of the stats, [From, To), aligned to the interval
+	From int64 `json:"from"`
+	To   int64 `json:"to"`
+	// Totals of the time range. PendingConfirmations is at the end of the range.
+	Totals StatsBucket `json:"totals"`
+	// Stats of each interval of the time range, oldest first
+	Series []StatsBucket `json:"series"`
+}
+
+// StatsBucket are the stats of an interval
+type StatsBucket struct {
+	// Unix time the interval starts at
+	Time int64 `json:"time"`
+	// Deposit addresses bound
+	Binds int `json:"binds"`
+	// Deposits received from the scanners
+	DepositsDetected int `json:"deposits_detected"`
+	// Deposits the SKY was sent for, and the SKY sent, in droplets
+	DepositsSent int    `json:"deposits_sent"`
+	SkySent      uint64 `json:"sky_sent"`
+	// Deposits whose SKY send was waiting for confirmation at the end of the interval
+	PendingConfirmations int `json:"pending_confirmations"`
+	// Average seconds from receiving a deposit to sending its SKY, of the deposits sent during the interval
+	AvgSendLatency float64 `json:"avg_send_latency"`
+	// Errors recorded for deposits
+	Errors int `json:"errors"`
+	// Seconds from receiving a deposit, once it reached its confirmations, to the confirmation of its skycoin
+	// transaction, of the deposits whose skycoin transaction was confirmed during the interval
+	ProcessingTime LatencyPercentiles `json:"processing_time"`
+}
+
+// LatencyPercentiles are the nearest-rank percentiles of latencies, in seconds. All are 0 if Count is 0.
+type LatencyPercentiles struct {
+	Count int   `json:"count"`
+	P50   int64 `json:"p50"`
+	P95   int64 `json:"p95"`
+	P99   int64 `json:"p99"`
+}
+
+// newLatencyPercentiles returns the percentiles of latencies, which it sorts
+func newLatencyPercentiles(latencies []int64) LatencyPercentiles {
+	n := len(latencies)
+	if n == 0 {
+		return LatencyPercentiles{}
+	}
+
+	sort.Slice(latencies, func(i, j int) bool {
+		return latencies[i] < latencies[j]
+	})
+
+	rank := func(p int) int64 {
+		return latencies[(n*p+99)/100-1]
+	}
+
+	return LatencyPercentiles{
+		Count: n,
+		P50:   rank(50),
+		P95:   rank(95),
+		P99:   rank(99),
+	}
+}
+
+// GenerateStats builds the stats of [from, to) from the deposit event log, which must be in log order.
+// from is aligned down and to up to the UTC interval.
+func GenerateStats(events []exchange.DepositEvent, from, to time.Time, interval time.Duration) Stats {
+	from = from.UTC().Truncate(interval)
+	if aligned := to.UTC().Truncate(interval); aligned.Before(to) {
+		to = aligned.Add(interval)
+	}
+
+	n := int(to.Sub(from) / interval)
+	if n < 0 {
+		n = 0
+	}
+
+	s := Stats{
+		Interval: formatInterval(interval),
+		From:     from.Unix(),
+		To:       from.Add(interval * time.Duration(n)).Unix(),
+		Series:   make([]StatsBucket, n),
+	}
+
+	step := int64(interval / time.Second)
+	for i := range s.Series {
+		s.Series[i].Time = s.From + int64(i)*step
+	}
+
+	// index returns the bucket of a unix time, or -1 if it is out of range
+	index := func(t int64) int {
+		if t < s.From || t >= s.To {
+			return -1
+		}
+		return int((t - s.From) / step)
+	}
+
+	latencies := make([]int64, n)
+	processing := make([][]int64, n)
+	states := make(map[string]*depositState)
+	pending := 0
+	next := 0 // the first bucket whose end was not reached yet
+
+	for _, ev := range events {
+		// The pending confirmations of a bucket are the ones left when its end is reached
+		for next < n && ev.Time >= s.Series[next].Time+step {
+			s.Series[next].PendingConfirmations = pending
+			next++
+		}
+
+		if ev.Time >= s.To {
+			break
+		}
+
+		i := index(ev.Time)
+
+		switch ev.Type {
+		case exchange.EventBindAddress:
+			if i >= 0 {
+				s.Series[i].Binds++
+			}
+
+		case exchange.EventDepositInfo:
+			if ev.DepositInfo == nil {
+				continue
+			}
+			di := *ev.DepositInfo
+
+			st, ok := states[di.DepositID]
+			if !ok {
+				st = &depositState{
+					receivedAt: ev.Time,
+				}
+				states[di.DepositID] = st
+
+				if i >= 0 {
+					s.Series[i].DepositsDetected++
+				}
+			}
+
+			prev := st.di
+			st.di = di
+
+			if ok && prev.Status == exchange.StatusWaitConfirm {
+				pending--
+			}
+			if di.Status == exchange.StatusWaitConfirm {
+				pending++
+			}
+
+			if prev.Txid == "" && di.Txid != "" {
+				st.sentAt = ev.Time
+
+				if i >= 0 {
+					s.Series[i].DepositsSent++
+					s.Series[i].SkySent += di.SkySent
+					latencies[i] += st.sentAt - st.receivedAt
+				}
+			}
+
+			// Deposits first seen as done, e.g. before the event log, have no receive time
+			if ok && i >= 0 && prev.Status != exchange.StatusDone && di.Status == exchange.StatusDone && di.Txid != "" {
+				processing[i] = append(processing[i], ev.Time-st.receivedAt)
+			}
+
+			if i >= 0 && di.Error != "" && di.Error != prev.Error {
+				s.Series[i].Errors++
+			}
+		}
+	}
+
+	for ; next < n; next++ {
+		s.Series[next].PendingConfirmations = pending
+	}
+
+	var latency int64
+	var allProcessing []int64
+	s.Totals.Time = s.From
+	for i := range s.Series {
+		b := &s.Series[i]
+		if b.DepositsSent > 0 {
+			b.AvgSendLatency = float64(latencies[i]) / float64(b.DepositsSent)
+		}
+
+		s.Totals.Binds += b.Binds
+		s.Totals.DepositsDetected += b.DepositsDetected
+		s.Totals.DepositsSent += b.DepositsSent
+		s.Totals.SkySent += b.SkySent
+		s.Totals.PendingConfirmations = b.PendingConfirmations
+		s.Totals.Errors += b.Errors
+		latency += latencies[i]
+
+		allProcessing = append(allProcessing, processing[i]...)
+		b.ProcessingTime = newLatencyPercentiles(processing[i])
+	}
+
+	s.Totals.ProcessingTime = newLatencyPercentiles(allProcessing)
+
+	if s.Totals.DepositsSent > 0 {
+		s.Totals.AvgSendLatency = float64(latency) / float64(s.Totals.DepositsSent)
+	}
+
+	return s
+}
+
+func formatInterval(interval time.Duration) string {
+	switch interval {
+	case time.Hour:
+		return IntervalHour
+	case time.Hour * 24:
+		return IntervalDay
+	default:
+		return interval.String()
+	}
+}
@@ -0,0 +1,124 @@
+package report
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseInterval(t *testing.T) {
+	d, err := ParseInterval("hour")
+	require.NoError(t, err)
+	require.Equal(t, time.Hour, d)
+
+	d, err = ParseInterval("day")
+	require.NoError(t, err)
+	require.Equal(t, time.Hour*24, d)
+
+	_, err = ParseInterval("week")
+	require.Equal(t, ErrInvalidInterval, err)
+}
+
+func TestGenerateStats(t *testing.T) {
+	day := func(n int) int64 {
+		return testDay.AddDate(0, 0, n).Unix()
+	}
+
+	s := GenerateStats(testEvents(), testDay.Add(-time.Hour), testDay.Add(time.Hour*30), time.Hour*24)
+
+	require.Equal(t, "day", s.Interval)
+	require.Equal(t, day(-1), s.From)
+	require.Equal(t, day(2), s.To)
+
+	require.Equal(t, []StatsBucket{
+		{
+			Time:             day(-1),
+			DepositsDetected: 1,
+		},
+		{
+			Time:                 day(0),
+			Binds:                1,
+			DepositsDetected:     2,
+			DepositsSent:         2,
+			SkySent:              1700e6,
+			PendingConfirmations: 1,
+			AvgSendLatency:       7200,
+			Errors:               1,
+			ProcessingTime:       LatencyPercentiles{Count: 1, P50: 21600, P95: 21600, P99: 21600},
+		},
+		{
+			Time:             day(1),
+			DepositsDetected: 1,
+			DepositsSent:     1,
+			SkySent:          1200e6,
+			ProcessingTime:   LatencyPercentiles{Count: 1, P50: 82800, P95: 82800, P99: 82800},
+		},
+	}, s.Series)
+
+	require.Equal(t, StatsBucket{
+		Time:                 day(-1),
+		Binds:                1,
+		DepositsDetected:     4,
+		DepositsSent:         3,
+		SkySent:              2900e6,
+		PendingConfirmations: 0,
+		AvgSendLatency:       4800,
+		Errors:               1,
+		ProcessingTime:       LatencyPercentiles{Count: 2, P50: 21600, P95: 82800, P99: 82800},
+	}, s.Totals)
+}
+
+func TestGenerateStatsHourly(t *testing.T) {
+	hour := func(n int) int64 {
+		return testDay.Add(time.Hour * time.Duration(n)).Unix()
+	}
+
+	// The end of the range is aligned up to the hour
+	s := GenerateStats(testEvents(), testDay, testDay.Add(time.Hour*3+time.Minute*30), time.Hour)
+
+	require.Equal(t, "hour", s.Interval)
+	require.Equal(t, hour(0), s.From)
+	require.Equal(t, hour(4), s.To)
+
+	// tx1:0 was received before the range, but its send is counted
+	require.Equal(t, []StatsBucket{
+		{Time: hour(0), Binds: 1},
+		{Time: hour(1), DepositsSent: 1, SkySent: 500e6, PendingConfirmations: 1, AvgSendLatency: 7200},
+		{Time: hour(2), DepositsDetected: 1, PendingConfirmations: 1},
+		{Time: hour(3), DepositsDetected: 1, PendingConfirmations: 1},
+	}, s.Series)
+
+	require.Equal(t, 1, s.Totals.Binds)
+	require.Equal(t, 2, s.Totals.DepositsDetected)
+	require.Equal(t, 1, s.Totals.DepositsSent)
+	require.Equal(t, float64(7200), s.Totals.AvgSendLatency)
+
+	// An empty range has no buckets
+	s = GenerateStats(testEvents(), testDay, testDay, time.Hour)
+	require.Empty(t, s.Series)
+	require.Equal(t, StatsBucket{Time: hour(0)}, s.Totals)
+}
+
+func TestNewLatencyPercentiles(t *testing.T) {
+	require.Equal(t, LatencyPercentiles{}, newLatencyPercentiles(nil))
+
+	latencies := make([]int64, 200)
+	for i := range latencies {
+		latencies[i] = int64(200 - i)
+	}
+
+	require.Equal(t, LatencyPercentiles{
+		Count: 200,
+		P50:   100,
+		P95:   190,
+		P99:   198,
+	}, newLatencyPercentiles(latencies))
+
+	require.Equal(t, LatencyPercentiles{
+		Count: 3,
+		P50:   20,
+		P95:   30,
+		P99:   30,
+	}, newLatencyPercentiles([]int64{30, 10, 20}))
+}
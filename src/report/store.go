@@ -0,0 +1,142 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// FormatJSON is the format of the complete report
+	FormatJSON = "json"
+	// FormatCSV is the format of the report's deposits
+	FormatCSV = "csv"
+)
+
+var (
+	// ErrNotFound is returned if there is no report of a date
+	ErrNotFound = errors.New("Report not found")
+	// ErrInvalidDate is returned for a date not in DateFormat
+	ErrInvalidDate = errors.New("Invalid date, expected YYYY-MM-DD")
+	// ErrInvalidFormat is returned for a format other than FormatJSON or FormatCSV
+	ErrInvalidFormat = errors.New("Invalid format, expected json or csv")
+)
+
+// Store saves reports in a directory, as <date>.json and <date>.csv
+type Store struct {
+	dir string
+}
+
+// NewStore creates a Store, creating dir if it does not exist
+func NewStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	return &Store{
+		dir: dir,
+	}, nil
+}
+
+// Save writes the report, replacing a previous report of the same date
+func (s *Store) Save(r Report) error {
+	if _, err := ParseDate(r.Date); err != nil {
+		return ErrInvalidDate
+	}
+
+	v, err := json.MarshalIndent(r, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	var csv bytes.Buffer
+	if err := r.WriteCSV(&csv); err != nil {
+		return err
+	}
+
+	// The JSON report is written last, Has checks it to tell whether the report is complete
+	if err := s.writeFile(r.Date+"."+FormatCSV, csv.Bytes()); err != nil {
+		return err
+	}
+
+	return s.writeFile(r.Date+"."+FormatJSON, v)
+}
+
+// writeFile writes a file through a temporary file, so that a partially written report is never read
+func (s *Store) writeFile(name string, b []byte) error {
+	path := filepath.Join(s.dir, name)
+	tmp := path + ".tmp"
+
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// Has returns true if there is a report of date
+func (s *Store) Has(date string) (bool, error) {
+	if _, err := ParseDate(date); err != nil {
+		return false, ErrInvalidDate
+	}
+
+	_, err := os.Stat(filepath.Join(s.dir, date+"."+FormatJSON))
+	switch {
+	case err == nil:
+		return true, nil
+	case os.IsNotExist(err):
+		return false, nil
+	default:
+		return false, err
+	}
+}
+
+// Get returns the report of date, in format
+func (s *Store) Get(date, format string) ([]byte, error) {
+	if _, err := ParseDate(date); err != nil {
+		return nil, ErrInvalidDate
+	}
+
+	if format != FormatJSON && format != FormatCSV {
+		return nil, ErrInvalidFormat
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(s.dir, date+"."+format))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+
+	return b, err
+}
+
+// Dates returns the dates of the saved reports, oldest first
+func (s *Store) Dates() ([]string, error) {
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	dates := []string{}
+	for _, f := range files {
+		name := f.Name()
+		if !strings.HasSuffix(name, "."+FormatJSON) {
+			continue
+		}
+
+		date := strings.TrimSuffix(name, "."+FormatJSON)
+		if _, err := ParseDate(date); err != nil {
+			continue
+		}
+
+		dates = append(dates, date)
+	}
+
+	sort.Strings(dates)
+
+	return dates, nil
+}
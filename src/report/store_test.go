@@ -0,0 +1,72 @@
+package report
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func prepareStore(t *testing.T) (*Store, func()) {
+	dir, err := ioutil.TempDir("", "teller-report")
+	require.NoError(t, err)
+
+	s, err := NewStore(filepath.Join(dir, "reports"))
+	require.NoError(t, err)
+
+	return s, func() {
+		os.RemoveAll(dir)
+	}
+}
+
+func TestStore(t *testing.T) {
+	s, shutdown := prepareStore(t)
+	defer shutdown()
+
+	dates, err := s.Dates()
+	require.NoError(t, err)
+	require.Empty(t, dates)
+
+	ok, err := s.Has("2018-03-04")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	_, err = s.Get("2018-03-04", FormatJSON)
+	require.Equal(t, ErrNotFound, err)
+
+	r := Generate(testEvents(), testDay)
+	require.NoError(t, s.Save(r))
+	require.NoError(t, s.Save(Generate(testEvents(), testDay.AddDate(0, 0, -1))))
+
+	ok, err = s.Has("2018-03-04")
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	dates, err = s.Dates()
+	require.NoError(t, err)
+	require.Equal(t, []string{"2018-03-03", "2018-03-04"}, dates)
+
+	b, err := s.Get("2018-03-04", FormatJSON)
+	require.NoError(t, err)
+	var r2 Report
+	require.NoError(t, json.Unmarshal(b, &r2))
+	require.Equal(t, r, r2)
+
+	b, err = s.Get("2018-03-04", FormatCSV)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(string(b), strings.Join(csvHeader, ",")+"\n"))
+
+	_, err = s.Get("2018-03-04", "xml")
+	require.Equal(t, ErrInvalidFormat, err)
+
+	// Dates are validated, so that they can't be used to read other files
+	_, err = s.Get("../reports/2018-03-04", FormatJSON)
+	require.Equal(t, ErrInvalidDate, err)
+	_, err = s.Has("2018-03-04.json")
+	require.Equal(t, ErrInvalidDate, err)
+	require.Equal(t, ErrInvalidDate, s.Save(Report{Date: "../x"}))
+}
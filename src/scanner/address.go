@@ -0,0 +1,408 @@
+package scanner
+
+import (
+	"errors"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/skycoin/teller/src/util/logger"
+)
+
+// AddressBackend looks up the transactions of addresses in a blockchain indexer,
+// e.g. an Electrum server or a Blockbook API, instead of a full node
+type AddressBackend interface {
+	// BestHeight returns the height of the best block
+	BestHeight() (int64, error)
+	// AddressTxs returns the transactions paying to addr, including unconfirmed ones
+	AddressTxs(addr string) ([]AddressTx, error)
+	Shutdown()
+}
+
+// AddressTx is a transaction returned by an AddressBackend
+type AddressTx struct {
+	Txid    string
+	Height  int64 // block height, 0 or less if unconfirmed
+	Outputs []TxOutput
+}
+
+// TxOutput is a transaction output returned by an AddressBackend
+type TxOutput struct {
+	N       uint32
+	Address string
+	Value   int64 // in satoshis
+}
+
+// AddressStorer interface for AddressScanner meta info storage
+type AddressStorer interface {
+	GetScanAddresses() ([]string, error)
+	AddScanAddress(string) error
+	SetDepositProcessed(string) error
+	GetUnprocessedDeposits() ([]Deposit, error)
+	HasDeposit(string) (bool, error)
+	SaveDeposits([]Deposit) ([]Deposit, error)
+}
+
+// AddressScanner scans for BTC deposits by polling an AddressBackend for the
+// transactions of each scan address, instead of scanning every block of a full node.
+// It saves deposits in the same store as BTCScanner, so the backend can be switched.
+//
+// The scan addresses can be split into shards by AddressShard, each scanned in parallel by
+// its own worker and backend. The shards don't overlap, and the store skips deposits that
+// were already saved, so a deposit is only saved once.
+type AddressScanner struct {
+	bestHeight
+	log      logrus.FieldLogger
+	cfg      Config
+	backends []AddressBackend // backend of each shard
+	store    AddressStorer
+	// Deposit value channel, exposed by public API, intended for public consumption
+	depositC chan DepositNote
+	// Internal deposit value channel
+	scannedDeposits chan Deposit
+	quit            chan struct{}
+	done            chan struct{}
+}
+
+// NewAddressScanner creates an AddressScanner. store should be created with NewStore.
+func NewAddressScanner(log logrus.FieldLogger, store AddressStorer, backend AddressBackend, cfg Config) (*AddressScanner, error) {
+	return NewShardedAddressScanner(log, store, []AddressBackend{backend}, cfg)
+}
+
+// NewShardedAddressScanner creates an AddressScanner that splits the scan addresses into
+// one shard per backend. store should be created with NewStore.
+func NewShardedAddressScanner(log logrus.FieldLogger, store AddressStorer, backends []AddressBackend, cfg Config) (*AddressScanner, error) {
+	if len(backends) == 0 {
+		return nil, errors.New("No AddressBackend")
+	}
+
+	for _, b := range backends {
+		if b == nil {
+			return nil, errors.New("AddressBackend is nil")
+		}
+	}
+
+	if cfg.ScanPeriod == 0 {
+		cfg.ScanPeriod = blockScanPeriod
+	}
+
+	if cfg.DepositBufferSize == 0 {
+		cfg.DepositBufferSize = depositBufferSize
+	}
+
+	return &AddressScanner{
+		log:             log.WithField("prefix", "scanner.address"),
+		cfg:             cfg,
+		backends:        backends,
+		store:           store,
+		depositC:        make(chan DepositNote),
+		scannedDeposits: make(chan Deposit, cfg.DepositBufferSize),
+		quit:            make(chan struct{}),
+		done:            make(chan struct{}),
+	}, nil
+}
+
+// Run starts the scanner
+func (s *AddressScanner) Run() error {
+	log := s.log.WithField("config", s.cfg)
+	log.Info("Start BTC address scan service")
+	defer func() {
+		log.Info("BTC address scan service closed")
+		close(s.done)
+	}()
+
+	var wg sync.WaitGroup
+
+	// This loop sends each scanned deposit to depositC, which is processed by Exchange.
+	log.Info("Launching deposit pipe goroutine")
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer logger.LogPanic(log)
+		defer log.Info("Deposit pipe goroutine exited")
+		for {
+			select {
+			case <-s.quit:
+				return
+			case dv := <-s.scannedDeposits:
+				if err := s.processDeposit(dv); err != nil {
+					if err == errQuit {
+						return
+					}
+
+					msg := "processDeposit failed. This deposit will be reprocessed the next time the scanner is run."
+					s.log.WithField("deposit", dv).WithError(err).Error(msg)
+				}
+			}
+		}
+	}()
+
+	log.Info("Loading unprocessed deposits")
+	if err := s.loadUnprocessedDeposits(); err != nil && err != errQuit {
+		log.WithError(err).Error("loadUnprocessedDeposits failed")
+		close(s.quit)
+		wg.Wait()
+		return err
+	}
+
+	// These loops poll the transactions of the scan addresses of each shard every ScanPeriod
+	for i := range s.backends {
+		log.WithField("shard", i).Info("Launching scan goroutine")
+		wg.Add(1)
+		go func(shard int) {
+			defer wg.Done()
+			defer logger.LogPanic(log)
+			s.runShard(shard)
+		}(i)
+	}
+
+	wg.Wait()
+
+	return nil
+}
+
+// runShard polls the transactions of the scan addresses of shard every ScanPeriod, until the scanner quits
+func (s *AddressScanner) runShard(shard int) {
+	log := s.log.WithFields(logrus.Fields{
+		"shard":  shard,
+		"shards": len(s.backends),
+	})
+	defer log.Info("Scan goroutine exited")
+
+	deposits := 0
+	for {
+		n, err := s.scanShard(shard)
+		switch {
+		case err == errQuit:
+			return
+		case err != nil:
+			log.WithError(err).Error("Scan addresses failed")
+		case n > 0:
+			deposits += n
+			log.WithFields(logrus.Fields{
+				"scannedDeposits":      n,
+				"totalScannedDeposits": deposits,
+			}).Infof("Scanned %d deposits from addresses", n)
+		}
+
+		select {
+		case <-s.quit:
+			return
+		case <-time.After(s.cfg.ScanPeriod):
+		}
+	}
+}
+
+// AddressShard returns the shard of addr, out of shards. The 32-bit FNV-1a hash space of the
+// addresses is split into shards equal ranges, so the shard of an address is deterministic.
+func AddressShard(addr string, shards int) int {
+	h := fnv.New32a()
+	h.Write([]byte(addr)) // nolint: errcheck
+	return int(uint64(h.Sum32()) * uint64(shards) >> 32)
+}
+
+// scanShard saves the new deposits with enough confirmations to the scan addresses of shard,
+// and sends them to the deposit pipe. Returns the number of deposits found.
+func (s *AddressScanner) scanShard(shard int) (int, error) {
+	backend := s.backends[shard]
+
+	best, err := backend.BestHeight()
+	if err != nil {
+		s.log.WithError(err).Error("backend.BestHeight failed")
+		return 0, err
+	}
+
+	s.setBestHeight(best)
+
+	addrs, err := s.store.GetScanAddresses()
+	if err != nil {
+		s.log.WithError(err).Error("store.GetScanAddresses failed")
+		return 0, err
+	}
+
+	n := 0
+	for _, addr := range addrs {
+		if AddressShard(addr, len(s.backends)) != shard {
+			continue
+		}
+
+		select {
+		case <-s.quit:
+			return n, errQuit
+		default:
+		}
+
+		m, err := s.scanAddress(backend, addr, best)
+		n += m
+		if err != nil {
+			return n, err
+		}
+	}
+
+	return n, nil
+}
+
+// scanAddress saves the new deposits to addr with enough confirmations at best height,
+// and sends them to the deposit pipe
+func (s *AddressScanner) scanAddress(backend AddressBackend, addr string, best int64) (int, error) {
+	log := s.log.WithFields(logrus.Fields{
+		"address":    addr,
+		"bestHeight": best,
+	})
+
+	txs, err := backend.AddressTxs(addr)
+	if err != nil {
+		log.WithError(err).Error("backend.AddressTxs failed")
+		return 0, err
+	}
+
+	var dvs []Deposit
+	for _, tx := range txs {
+		// Same as BTCScanner, a block at best height has 0 confirmations
+		if tx.Height <= 0 || tx.Height < s.cfg.InitialScanHeight || tx.Height+s.cfg.ConfirmationsRequired > best {
+			continue
+		}
+
+		for _, out := range tx.Outputs {
+			if out.Address != addr {
+				continue
+			}
+
+			dv := Deposit{
+				CoinType: CoinTypeBTC,
+				Address:  addr,
+				Value:    out.Value,
+				Height:   tx.Height,
+				Tx:       tx.Txid,
+				N:        out.N,
+			}
+
+			// The backend returns the full history of the address on every scan
+			if has, err := s.store.HasDeposit(dv.ID()); err != nil {
+				log.WithError(err).Error("store.HasDeposit failed")
+				return 0, err
+			} else if has {
+				continue
+			}
+
+			dvs = append(dvs, dv)
+		}
+	}
+
+	if len(dvs) == 0 {
+		return 0, nil
+	}
+
+	saved, err := s.store.SaveDeposits(dvs)
+	if err != nil {
+		log.WithError(err).Error("store.SaveDeposits failed")
+		return 0, err
+	}
+
+	n := 0
+	for _, dv := range saved {
+		select {
+		case s.scannedDeposits <- dv:
+			n++
+		case <-s.quit:
+			return n, errQuit
+		}
+	}
+
+	return n, nil
+}
+
+// Shutdown shutdown the scanner
+func (s *AddressScanner) Shutdown() {
+	s.log.Info("Closing BTC address scanner")
+	close(s.quit)
+	for _, b := range s.backends {
+		b.Shutdown()
+	}
+	s.log.Info("Waiting for BTC address scanner to stop")
+	<-s.done
+	close(s.depositC)
+	s.log.Info("BTC address scanner stopped")
+}
+
+// loadUnprocessedDeposits loads unprocessed Deposits into the scannedDeposits
+// channel. This is called during initialization, to resume processing.
+func (s *AddressScanner) loadUnprocessedDeposits() error {
+	dvs, err := s.store.GetUnprocessedDeposits()
+	if err != nil {
+		s.log.WithError(err).Error("GetUnprocessedDeposits failed")
+		return err
+	}
+
+	s.log.WithField("depositsLen", len(dvs)).Info("Loaded unprocessed deposit values")
+
+	for _, dv := range dvs {
+		select {
+		case <-s.quit:
+			return errQuit
+		case s.scannedDeposits <- dv:
+		}
+	}
+
+	return nil
+}
+
+// processDeposit sends a deposit to depositC and marks it as processed if the exchange
+// reports no error. See BTCScanner.processDeposit.
+func (s *AddressScanner) processDeposit(dv Deposit) error {
+	log := s.log.WithField("deposit", dv)
+	log.Info("Sending deposit to depositC")
+
+	dn := NewDepositNote(dv)
+
+	select {
+	case <-s.quit:
+		return errQuit
+	case s.depositC <- dn:
+	}
+
+	select {
+	case <-s.quit:
+		return errQuit
+	case err, ok := <-dn.ErrC:
+		if !ok {
+			log.Warn("DepositNote.ErrC unexpectedly closed")
+			return nil
+		}
+
+		if err != nil {
+			log.WithError(err).Error("DepositNote.ErrC error")
+			return err
+		}
+
+		if err := s.store.SetDepositProcessed(dv.ID()); err != nil {
+			log.WithError(err).Error("SetDepositProcessed error")
+			return err
+		}
+
+		log.Info("Deposit is processed")
+	}
+
+	return nil
+}
+
+// AddScanAddress adds new scan address
+func (s *AddressScanner) AddScanAddress(addr, coinType string) error {
+	if coinType != CoinTypeBTC {
+		return ErrUnsupportedCoinType
+	}
+
+	return s.store.AddScanAddress(addr)
+}
+
+// GetScanAddresses returns the deposit addresses that need to scan
+func (s *AddressScanner) GetScanAddresses() ([]string, error) {
+	return s.store.GetScanAddresses()
+}
+
+// GetDeposit returns deposit value channel.
+func (s *AddressScanner) GetDeposit() <-chan DepositNote {
+	return s.depositC
+}
@@ -0,0 +1,282 @@
+package scanner
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+type dummyAddressBackend struct {
+	sync.Mutex
+	bestHeight int64
+	txs        map[string][]AddressTx
+	err        error
+	lookups    []string
+}
+
+func (b *dummyAddressBackend) BestHeight() (int64, error) {
+	b.Lock()
+	defer b.Unlock()
+	return b.bestHeight, b.err
+}
+
+func (b *dummyAddressBackend) AddressTxs(addr string) ([]AddressTx, error) {
+	b.Lock()
+	defer b.Unlock()
+	b.lookups = append(b.lookups, addr)
+	return b.txs[addr], b.err
+}
+
+func (b *dummyAddressBackend) Shutdown() {}
+
+func (b *dummyAddressBackend) setBestHeight(h int64) {
+	b.Lock()
+	defer b.Unlock()
+	b.bestHeight = h
+}
+
+func setupAddressScanner(t *testing.T) (*AddressScanner, *dummyAddressBackend, func()) {
+	db, shutdown := testutil.PrepareDB(t)
+
+	log, _ := testutil.NewLogger(t)
+
+	store, err := NewStore(log, db)
+	require.NoError(t, err)
+
+	backend := &dummyAddressBackend{
+		bestHeight: 100,
+		txs: map[string][]AddressTx{
+			"1LEkderht5M5yWj82M87bEd4XDBsczLkp9": {
+				{
+					Txid:   "tx1",
+					Height: 90,
+					Outputs: []TxOutput{
+						{N: 0, Address: "1N8G4JM8krsHLQZjC51R7ZgwDyihmgsQYA", Value: 1e8},
+						{N: 1, Address: "1LEkderht5M5yWj82M87bEd4XDBsczLkp9", Value: 2e8},
+					},
+				},
+				{
+					// Before the initial scan height
+					Txid:   "tx0",
+					Height: 40,
+					Outputs: []TxOutput{
+						{N: 0, Address: "1LEkderht5M5yWj82M87bEd4XDBsczLkp9", Value: 1e8},
+					},
+				},
+				{
+					// Not enough confirmations yet
+					Txid:   "tx2",
+					Height: 99,
+					Outputs: []TxOutput{
+						{N: 3, Address: "1LEkderht5M5yWj82M87bEd4XDBsczLkp9", Value: 3e8},
+					},
+				},
+				{
+					// Unconfirmed
+					Txid: "tx3",
+					Outputs: []TxOutput{
+						{N: 0, Address: "1LEkderht5M5yWj82M87bEd4XDBsczLkp9", Value: 4e8},
+					},
+				},
+			},
+		},
+	}
+
+	s, err := NewAddressScanner(log, store, backend, Config{
+		ScanPeriod:            time.Millisecond * 10,
+		InitialScanHeight:     50,
+		ConfirmationsRequired: 2,
+	})
+	require.NoError(t, err)
+
+	return s, backend, shutdown
+}
+
+func TestAddressScannerScan(t *testing.T) {
+	s, backend, shutdown := setupAddressScanner(t)
+	defer shutdown()
+
+	err := s.AddScanAddress("1LEkderht5M5yWj82M87bEd4XDBsczLkp9", CoinTypeLTC)
+	require.Equal(t, ErrUnsupportedCoinType, err)
+
+	err = s.AddScanAddress("1LEkderht5M5yWj82M87bEd4XDBsczLkp9", CoinTypeBTC)
+	require.NoError(t, err)
+
+	n, err := s.scanShard(0)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+
+	dv := <-s.scannedDeposits
+	require.Equal(t, Deposit{
+		CoinType: CoinTypeBTC,
+		Address:  "1LEkderht5M5yWj82M87bEd4XDBsczLkp9",
+		Value:    2e8,
+		Height:   90,
+		Tx:       "tx1",
+		N:        1,
+	}, dv)
+
+	// Saved deposits are not found again
+	n, err = s.scanShard(0)
+	require.NoError(t, err)
+	require.Equal(t, 0, n)
+
+	// tx2 gets enough confirmations
+	backend.setBestHeight(101)
+	n, err = s.scanShard(0)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+
+	dv = <-s.scannedDeposits
+	require.Equal(t, "tx2:3", dv.ID())
+
+	// Backend errors are returned
+	backend.err = errors.New("backend down")
+	_, err = s.scanShard(0)
+	require.Error(t, err)
+}
+
+func TestAddressScannerRun(t *testing.T) {
+	s, _, shutdown := setupAddressScanner(t)
+	defer shutdown()
+
+	err := s.AddScanAddress("1LEkderht5M5yWj82M87bEd4XDBsczLkp9", CoinTypeBTC)
+	require.NoError(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		require.NoError(t, s.Run())
+	}()
+
+	dn := <-s.GetDeposit()
+	require.Equal(t, "tx1:1", dn.ID())
+	dn.ErrC <- nil
+
+	// Wait for the deposit to be marked as processed
+	for i := 0; i < 100; i++ {
+		dvs, err := s.store.GetUnprocessedDeposits()
+		require.NoError(t, err)
+		if len(dvs) == 0 {
+			break
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	dvs, err := s.store.GetUnprocessedDeposits()
+	require.NoError(t, err)
+	require.Empty(t, dvs)
+
+	s.Shutdown()
+	<-done
+}
+
+func TestAddressShard(t *testing.T) {
+	addrs := []string{
+		"1LEkderht5M5yWj82M87bEd4XDBsczLkp9",
+		"1N8G4JM8krsHLQZjC51R7ZgwDyihmgsQYA",
+		"1LcEkgX8DCrQczLMVh9LDTRnkdVV2oun3A",
+		"16Lr3Zhjjb7KxeDxGPUrh3DMo29Lstif7j",
+		"1GH9ukgyetEJoWQFwUUeLcWQ8UgVgipLKb",
+		"1PZ63K3G4gZP6A6E2TTbBwxT5bFQGL2TLB",
+		"1FeDtFhARLxjKUPPkQqEBL78tisenc9znS",
+		"14FG8vQnmK6B7YbLSr6uC5wfGY78JFNCYg",
+	}
+
+	for _, a := range addrs {
+		require.Equal(t, 0, AddressShard(a, 1))
+
+		// Shards are deterministic and in range
+		sh := AddressShard(a, 4)
+		require.True(t, sh >= 0 && sh < 4)
+		require.Equal(t, sh, AddressShard(a, 4))
+	}
+}
+
+func TestAddressScannerShards(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	log, _ := testutil.NewLogger(t)
+
+	store, err := NewStore(log, db)
+	require.NoError(t, err)
+
+	addrs := []string{
+		"1LEkderht5M5yWj82M87bEd4XDBsczLkp9",
+		"1N8G4JM8krsHLQZjC51R7ZgwDyihmgsQYA",
+		"1LcEkgX8DCrQczLMVh9LDTRnkdVV2oun3A",
+		"16Lr3Zhjjb7KxeDxGPUrh3DMo29Lstif7j",
+		"1GH9ukgyetEJoWQFwUUeLcWQ8UgVgipLKb",
+		"1PZ63K3G4gZP6A6E2TTbBwxT5bFQGL2TLB",
+	}
+
+	// Every backend knows every transaction, each address receives one deposit
+	txs := make(map[string][]AddressTx, len(addrs))
+	for i, a := range addrs {
+		txs[a] = []AddressTx{
+			{
+				Txid:   fmt.Sprintf("tx%d", i),
+				Height: 90,
+				Outputs: []TxOutput{
+					{N: 0, Address: a, Value: 1e8},
+				},
+			},
+		}
+	}
+
+	backends := make([]*dummyAddressBackend, 3)
+	abs := make([]AddressBackend, len(backends))
+	for i := range backends {
+		backends[i] = &dummyAddressBackend{
+			bestHeight: 100,
+			txs:        txs,
+		}
+		abs[i] = backends[i]
+	}
+
+	_, err = NewShardedAddressScanner(log, store, nil, Config{})
+	require.Error(t, err)
+
+	s, err := NewShardedAddressScanner(log, store, abs, Config{
+		ScanPeriod:            time.Millisecond * 10,
+		DepositBufferSize:     len(addrs),
+		InitialScanHeight:     50,
+		ConfirmationsRequired: 2,
+	})
+	require.NoError(t, err)
+
+	for _, a := range addrs {
+		require.NoError(t, s.AddScanAddress(a, CoinTypeBTC))
+	}
+
+	// Each shard only looks up the addresses in its hash range, with its own backend
+	n := 0
+	shardsUsed := 0
+	for i := range backends {
+		m, err := s.scanShard(i)
+		require.NoError(t, err)
+		n += m
+		if m > 0 {
+			shardsUsed++
+		}
+
+		for _, a := range backends[i].lookups {
+			require.Equal(t, i, AddressShard(a, len(backends)))
+		}
+		require.Equal(t, m, len(backends[i].lookups))
+	}
+	require.Equal(t, len(addrs), n)
+	require.True(t, shardsUsed > 1)
+
+	// Every deposit was saved once
+	dvs, err := store.GetUnprocessedDeposits()
+	require.NoError(t, err)
+	require.Len(t, dvs, len(addrs))
+}
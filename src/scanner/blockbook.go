@@ -0,0 +1,143 @@
+package scanner
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// blockbookPageSize is the number of transactions requested per page of an address
+const blockbookPageSize = 1000
+
+// BlockbookClient is an AddressBackend using the Blockbook v2 API of Trezor
+type BlockbookClient struct {
+	url        string
+	httpClient *http.Client
+}
+
+// NewBlockbookClient creates a BlockbookClient for the Blockbook server at url, e.g. "https://btc1.trezor.io"
+func NewBlockbookClient(url string) *BlockbookClient {
+	return &BlockbookClient{
+		url: strings.TrimSuffix(url, "/"),
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+type blockbookStatus struct {
+	Blockbook struct {
+		BestHeight int64 `json:"bestHeight"`
+	} `json:"blockbook"`
+}
+
+type blockbookAddress struct {
+	Page       int           `json:"page"`
+	TotalPages int           `json:"totalPages"`
+	Txs        []blockbookTx `json:"txs"`
+}
+
+type blockbookTx struct {
+	Txid        string `json:"txid"`
+	BlockHeight int64  `json:"blockHeight"`
+	Vout        []struct {
+		Value     string   `json:"value"`
+		N         uint32   `json:"n"`
+		Addresses []string `json:"addresses"`
+		IsAddress *bool    `json:"isAddress"`
+	} `json:"vout"`
+}
+
+type blockbookError struct {
+	Error string `json:"error"`
+}
+
+func (c *BlockbookClient) get(path string, query url.Values, result interface{}) error {
+	u := c.url + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	rsp, err := c.httpClient.Get(u)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusOK {
+		var e blockbookError
+		if err := json.NewDecoder(rsp.Body).Decode(&e); err == nil && e.Error != "" {
+			return fmt.Errorf("%s: blockbook returned status %d: %s", path, rsp.StatusCode, e.Error)
+		}
+		return fmt.Errorf("%s: blockbook returned status %d", path, rsp.StatusCode)
+	}
+
+	if err := json.NewDecoder(rsp.Body).Decode(result); err != nil {
+		return fmt.Errorf("%s: decode blockbook response failed: %v", path, err)
+	}
+
+	return nil
+}
+
+// BestHeight returns the height of the best block indexed by Blockbook
+func (c *BlockbookClient) BestHeight() (int64, error) {
+	var status blockbookStatus
+	if err := c.get("/api/v2", nil, &status); err != nil {
+		return 0, err
+	}
+
+	return status.Blockbook.BestHeight, nil
+}
+
+// AddressTxs returns the transactions of addr
+func (c *BlockbookClient) AddressTxs(addr string) ([]AddressTx, error) {
+	var txs []AddressTx
+	for page := 1; ; page++ {
+		var rsp blockbookAddress
+		if err := c.get("/api/v2/address/"+url.PathEscape(addr), url.Values{
+			"details":  []string{"txs"},
+			"page":     []string{strconv.Itoa(page)},
+			"pageSize": []string{strconv.Itoa(blockbookPageSize)},
+		}, &rsp); err != nil {
+			return nil, err
+		}
+
+		for _, t := range rsp.Txs {
+			tx := AddressTx{
+				Txid:   t.Txid,
+				Height: t.BlockHeight,
+			}
+
+			for _, o := range t.Vout {
+				// Outputs without a standard address, e.g. OP_RETURN, can't be deposits
+				if len(o.Addresses) != 1 || (o.IsAddress != nil && !*o.IsAddress) {
+					continue
+				}
+
+				v, err := strconv.ParseInt(o.Value, 10, 64)
+				if err != nil {
+					return nil, fmt.Errorf("tx %s output %d: invalid value %q", t.Txid, o.N, o.Value)
+				}
+
+				tx.Outputs = append(tx.Outputs, TxOutput{
+					N:       o.N,
+					Address: o.Addresses[0],
+					Value:   v,
+				})
+			}
+
+			txs = append(txs, tx)
+		}
+
+		if page >= rsp.TotalPages {
+			return txs, nil
+		}
+	}
+}
+
+// Shutdown does nothing, BlockbookClient has no open connections to close
+func (c *BlockbookClient) Shutdown() {}
@@ -0,0 +1,74 @@
+package scanner
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlockbookClient(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v2":
+			w.Write([]byte(`{"blockbook":{"coin":"Bitcoin","bestHeight":537000},"backend":{"blocks":537000}}`)) // nolint: errcheck
+		case "/api/v2/address/1LEkderht5M5yWj82M87bEd4XDBsczLkp9":
+			require.Equal(t, "txs", r.URL.Query().Get("details"))
+			require.Equal(t, "1000", r.URL.Query().Get("pageSize"))
+
+			switch r.URL.Query().Get("page") {
+			case "1":
+				w.Write([]byte(`{"page":1,"totalPages":2,"txs":[
+					{"txid":"tx1","blockHeight":536990,"vout":[
+						{"value":"100000000","n":0,"addresses":["1LEkderht5M5yWj82M87bEd4XDBsczLkp9"]},
+						{"value":"0","n":1,"addresses":["OP_RETURN 74656c6c6572"],"isAddress":false},
+						{"value":"5000","n":2,"addresses":["1N8G4JM8krsHLQZjC51R7ZgwDyihmgsQYA"]}
+					]}
+				]}`)) // nolint: errcheck
+			case "2":
+				w.Write([]byte(`{"page":2,"totalPages":2,"txs":[
+					{"txid":"tx2","blockHeight":-1,"vout":[
+						{"value":"2000","n":0,"addresses":["1LEkderht5M5yWj82M87bEd4XDBsczLkp9"]}
+					]}
+				]}`)) // nolint: errcheck
+			default:
+				t.Fatalf("unexpected page %s", r.URL.Query().Get("page"))
+			}
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"Invalid address"}`)) // nolint: errcheck
+		}
+	}))
+	defer srv.Close()
+
+	c := NewBlockbookClient(srv.URL + "/")
+
+	h, err := c.BestHeight()
+	require.NoError(t, err)
+	require.Equal(t, int64(537000), h)
+
+	txs, err := c.AddressTxs("1LEkderht5M5yWj82M87bEd4XDBsczLkp9")
+	require.NoError(t, err)
+	require.Equal(t, []AddressTx{
+		{
+			Txid:   "tx1",
+			Height: 536990,
+			Outputs: []TxOutput{
+				{N: 0, Address: "1LEkderht5M5yWj82M87bEd4XDBsczLkp9", Value: 1e8},
+				{N: 2, Address: "1N8G4JM8krsHLQZjC51R7ZgwDyihmgsQYA", Value: 5000},
+			},
+		},
+		{
+			Txid:   "tx2",
+			Height: -1,
+			Outputs: []TxOutput{
+				{N: 0, Address: "1LEkderht5M5yWj82M87bEd4XDBsczLkp9", Value: 2000},
+			},
+		},
+	}, txs)
+
+	_, err = c.AddressTxs("bad")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Invalid address")
+}
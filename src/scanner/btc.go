@@ -9,12 +9,15 @@ package scanner
 import (
 	"errors"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/btcsuite/btcd/btcjson"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/rpcclient"
 	"github.com/sirupsen/logrus"
+
+	"github.com/skycoin/teller/src/util/logger"
 )
 
 var (
@@ -23,12 +26,26 @@ var (
 	// ErrBtcdTxindexDisabled is returned if RawTx is missing from GetBlockVerboseResult,
 	// which happens if txindex is not enabled in btcd.
 	ErrBtcdTxindexDisabled = errors.New("len(block.RawTx) == 0, make sure txindex is enabled in btcd")
+
+	// ErrUnsupportedCoinType is returned by AddScanAddress for a coin type the scanner does not scan
+	ErrUnsupportedCoinType = errors.New("unsupported coin type")
+
+	// errChainChanged is returned by scanBlocksConcurrently if a fetched block does not follow the previous one,
+	// which happens if there was a reorg while fetching
+	errChainChanged = errors.New("Block does not follow the previous block, the chain changed")
 )
 
 const (
 	checkHeadDepositPeriod = time.Second * 5
 	blockScanPeriod        = time.Second * 5
 	depositBufferSize      = 100
+
+	// maxRescanBlocks is the maximum number of blocks BTCScanner.Rescan rescans at once
+	maxRescanBlocks = 2016
+
+	// checkDepositLookback is the number of blocks below the height of a deposit that CheckDeposit searches,
+	// since after a reorg the deposit's transaction, or a transaction conflicting with it, can be in a lower block
+	checkDepositLookback = 6
 )
 
 // Config scanner config info
@@ -37,24 +54,52 @@ type Config struct {
 	DepositBufferSize     int           // size of GetDeposit() channel
 	InitialScanHeight     int64         // what blockchain height to begin scanning from
 	ConfirmationsRequired int64         // how many confirmations to wait for block
+	// ZMQ hashblock publisher of the node, e.g. "tcp://127.0.0.1:28332". If set, BTCScanner
+	// scans as soon as a new block is published, and polls every ScanPeriod only while the
+	// ZMQ socket is down. Not used by ERC20Scanner.
+	ZMQAddress string
+	// Number of blocks BTCScanner fetches concurrently while more than one confirmed block is
+	// waiting to be scanned, e.g. during the initial sync. Blocks are still scanned in height order.
+	// 0 or 1 fetches one block at a time.
+	ScanConcurrency int
 }
 
-// BTCScanner blockchain scanner to check if there're deposit coins
+// BTCScanner blockchain scanner to check if there're deposit coins.
+// It scans LTC too, through an RPC client that returns litecoin blocks in btcjson format.
 type BTCScanner struct {
+	// Number of confirmed blocks after the block being scanned, accessed atomically.
+	// First in the struct so that it is 64-bit aligned for atomic access on 32-bit platforms.
+	behind int64
+	bestHeight
 	log       logrus.FieldLogger
 	cfg       Config
+	coinType  string
 	btcClient BtcRPCClient
 	store     Storer
 	// Deposit value channel, exposed by public API, intended for public consumption
 	depositC chan DepositNote
 	// Internal deposit value channel
 	scannedDeposits chan Deposit
-	quit            chan struct{}
-	done            chan struct{}
+	// Signalled when the node publishes a new block
+	blockNotify chan struct{}
+	// 1 while subscribed to the node's ZMQ block notifications
+	zmqConnected int32
+	rescan       rescanner
+	quit         chan struct{}
+	done         chan struct{}
 }
 
 // NewBTCScanner creates scanner instance
 func NewBTCScanner(log logrus.FieldLogger, store Storer, btc BtcRPCClient, cfg Config) (*BTCScanner, error) {
+	return newScanner(log.WithField("prefix", "scanner.btc"), CoinTypeBTC, store, btc, cfg)
+}
+
+// NewLTCScanner creates a scanner for LTC deposits. store should be created with NewLTCStore.
+func NewLTCScanner(log logrus.FieldLogger, store Storer, ltc BtcRPCClient, cfg Config) (*BTCScanner, error) {
+	return newScanner(log.WithField("prefix", "scanner.ltc"), CoinTypeLTC, store, ltc, cfg)
+}
+
+func newScanner(log logrus.FieldLogger, coinType string, store Storer, client BtcRPCClient, cfg Config) (*BTCScanner, error) {
 	if cfg.ScanPeriod == 0 {
 		cfg.ScanPeriod = blockScanPeriod
 	}
@@ -63,24 +108,30 @@ func NewBTCScanner(log logrus.FieldLogger, store Storer, btc BtcRPCClient, cfg C
 		cfg.DepositBufferSize = depositBufferSize
 	}
 
+	if cfg.ScanConcurrency < 1 {
+		cfg.ScanConcurrency = 1
+	}
+
 	return &BTCScanner{
-		btcClient:       btc,
-		log:             log.WithField("prefix", "scanner.btc"),
+		btcClient:       client,
+		log:             log,
 		cfg:             cfg,
+		coinType:        coinType,
 		store:           store,
 		depositC:        make(chan DepositNote),
 		quit:            make(chan struct{}),
 		done:            make(chan struct{}),
 		scannedDeposits: make(chan Deposit, depositBufferSize),
+		blockNotify:     make(chan struct{}, 1),
 	}, nil
 }
 
 // Run starts the scanner
 func (s *BTCScanner) Run() error {
 	log := s.log.WithField("config", s.cfg)
-	log.Info("Start bitcoin blockchain scan service")
+	log.Infof("Start %s blockchain scan service", s.coinType)
 	defer func() {
-		log.Info("Bitcoin blockchain scan service closed")
+		log.Infof("%s blockchain scan service closed", s.coinType)
 		close(s.done)
 	}()
 
@@ -97,11 +148,11 @@ func (s *BTCScanner) Run() error {
 		return err
 	}
 
-	// Load the initial scan block
+	// Load the checkpoint block, or the initial scan block if there is no usable checkpoint
 	log.Info("Loading the initial scan block")
-	initialBlock, err := s.getBlockAtHeight(s.cfg.InitialScanHeight)
+	initialBlock, resumed, err := s.loadStartBlock()
 	if err != nil {
-		log.WithError(err).Error("getBlockAtHeight failed")
+		log.WithError(err).Error("loadStartBlock failed")
 
 		// If teller is shutdown while this call is in progress, the rpcclient
 		// returns ErrClientShutdown. This is an expected condition and not
@@ -121,25 +172,43 @@ func (s *BTCScanner) Run() error {
 	s.log.WithFields(logrus.Fields{
 		"initialHash":   initialBlock.Hash,
 		"initialHeight": initialBlock.Height,
+		"resumed":       resumed,
 	}).Info("Begin scanning blockchain")
 
-	// This loop scans for a new BTC block every ScanPeriod.
-	// When a new block is found, it compares the block against our scanning
+	if s.cfg.ZMQAddress != "" {
+		log.Info("Launching ZMQ block notification goroutine")
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer logger.LogPanic(log)
+			defer s.log.Info("ZMQ block notification goroutine exited")
+			s.runZMQ()
+		}()
+	}
+
+	// This loop scans for a new BTC block every ScanPeriod, or when the node
+	// publishes a new block if ZMQAddress is set. When a new block is found, it compares the block against our scanning
 	// deposit addresses. If a matching deposit is found, it saves it to the DB.
 	log.Info("Launching scan goroutine")
 	wg.Add(1)
 	go func(block *btcjson.GetBlockVerboseResult) {
 		defer wg.Done()
+		defer logger.LogPanic(log)
 		defer log.Info("Scan goroutine exited")
 
 		// Wait before retrying again
-		// Returns true if the scanner quit
-		wait := func() error {
-			select {
-			case <-s.quit:
-				return errQuit
-			case <-time.After(s.cfg.ScanPeriod):
-				return nil
+		// Returns errQuit if the scanner quit
+		wait := s.waitForBlockNotify
+
+		// The checkpoint block and its deposits were saved before the restart, continue after it
+		if resumed {
+			var err error
+			block, err = s.waitForNextBlock(block)
+			if err != nil {
+				if err != errQuit {
+					log.WithError(err).Error("s.waitForNextBlock failed")
+				}
+				return
 			}
 		}
 
@@ -169,6 +238,9 @@ func (s *BTCScanner) Run() error {
 
 			log = log.WithField("bestHeight", bestHeight)
 
+			s.setBestHeight(bestHeight)
+			s.setBehind(bestHeight - s.cfg.ConfirmationsRequired - block.Height)
+
 			// If not enough confirmations exist for this block, wait
 			if block.Height+s.cfg.ConfirmationsRequired > bestHeight {
 				log.Info("Not enough confirmations, waiting")
@@ -200,6 +272,21 @@ func (s *BTCScanner) Run() error {
 				"totalScannedDeposits": deposits,
 			}).Infof("Scanned %d deposits from block", n)
 
+			// Catch up with concurrent fetches if more than one confirmed block follows this one
+			if end := bestHeight - s.cfg.ConfirmationsRequired; s.cfg.ScanConcurrency > 1 && end > block.Height+1 {
+				var n int
+				block, n, err = s.scanBlocksConcurrently(block, end)
+				deposits += n
+				if err != nil {
+					if err == errQuit {
+						return
+					}
+
+					// Continue one block at a time from the last scanned block
+					log.WithError(err).Warning("scanBlocksConcurrently failed")
+				}
+			}
+
 			// Wait for the next block
 			block, err = s.waitForNextBlock(block)
 			if err != nil {
@@ -223,6 +310,7 @@ func (s *BTCScanner) Run() error {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
+		defer logger.LogPanic(log)
 		defer log.Info("Deposit pipe goroutine exited")
 		for {
 			select {
@@ -246,15 +334,28 @@ func (s *BTCScanner) Run() error {
 	return nil
 }
 
+// Behind returns the number of confirmed blocks after the block being scanned, as of the last check of the best height
+func (s *BTCScanner) Behind() int64 {
+	return atomic.LoadInt64(&s.behind)
+}
+
+func (s *BTCScanner) setBehind(n int64) {
+	if n < 0 {
+		n = 0
+	}
+	atomic.StoreInt64(&s.behind, n)
+}
+
 // Shutdown shutdown the scanner
 func (s *BTCScanner) Shutdown() {
-	s.log.Info("Closing BTC scanner")
+	s.log.Infof("Closing %s scanner", s.coinType)
 	close(s.quit)
 	close(s.depositC)
 	s.btcClient.Shutdown()
-	s.log.Info("Waiting for BTC scanner to stop")
+	s.log.Infof("Waiting for %s scanner to stop", s.coinType)
 	<-s.done
-	s.log.Info("BTC scanner stopped")
+	s.rescan.wait()
+	s.log.Infof("%s scanner stopped", s.coinType)
 }
 
 // loadUnprocessedDeposits loads unprocessed Deposits into the scannedDeposits
@@ -339,6 +440,11 @@ func (s *BTCScanner) scanBlock(block *btcjson.GetBlockVerboseResult) (int, error
 	log = log.WithField("scannedDeposits", len(dvs))
 	log.Infof("Counted %d deposits from block", len(dvs))
 
+	return s.sendDeposits(dvs)
+}
+
+// sendDeposits sends saved deposits to the deposit pipe
+func (s *BTCScanner) sendDeposits(dvs []Deposit) (int, error) {
 	n := 0
 	for _, dv := range dvs {
 		select {
@@ -352,11 +458,49 @@ func (s *BTCScanner) scanBlock(block *btcjson.GetBlockVerboseResult) (int, error
 	return n, nil
 }
 
+// loadStartBlock returns the block to start scanning from. If the store has a checkpoint at or
+// above the initial scan height, and the checkpoint block is still in the main chain, it returns the
+// checkpoint block and true, and the scan resumes after it. Otherwise it returns the block at the initial
+// scan height and false. Blocks scanned again do not emit their deposits twice, since saved deposits are skipped.
+func (s *BTCScanner) loadStartBlock() (*btcjson.GetBlockVerboseResult, bool, error) {
+	cp, err := s.store.GetCheckpoint()
+	if err != nil {
+		s.log.WithError(err).Error("store.GetCheckpoint failed")
+		return nil, false, err
+	}
+
+	if cp != nil && cp.Height >= s.cfg.InitialScanHeight {
+		log := s.log.WithFields(logrus.Fields{
+			"checkpointHeight": cp.Height,
+			"checkpointHash":   cp.Hash,
+		})
+
+		block, err := s.getBlockAtHeight(cp.Height)
+		if err != nil {
+			return nil, false, err
+		}
+
+		if block.Hash == cp.Hash {
+			log.Info("Resuming from the checkpoint")
+			return block, true, nil
+		}
+
+		log.WithField("mainChainHash", block.Hash).Warning("Checkpoint block is not in the main chain, scanning from the initial scan height")
+	}
+
+	block, err := s.getBlockAtHeight(s.cfg.InitialScanHeight)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return block, false, nil
+}
+
 // getBlockAtHeight returns that block at a specific height
 func (s *BTCScanner) getBlockAtHeight(height int64) (*btcjson.GetBlockVerboseResult, error) {
 	log := s.log.WithField("blockHeight", height)
 
-	hash, err := s.btcClient.GetBlockHash(s.cfg.InitialScanHeight)
+	hash, err := s.btcClient.GetBlockHash(height)
 	if err != nil {
 		log.WithError(err).Error("btcClient.GetBlockHash failed")
 		return nil, err
@@ -371,6 +515,123 @@ func (s *BTCScanner) getBlockAtHeight(height int64) (*btcjson.GetBlockVerboseRes
 	return block, nil
 }
 
+// fetchResult is a block fetched by a scanBlocksConcurrently worker
+type fetchResult struct {
+	block *btcjson.GetBlockVerboseResult
+	err   error
+}
+
+// fetchJob is a block height to fetch, and where to send the result
+type fetchJob struct {
+	height int64
+	result chan fetchResult
+}
+
+// scanBlocksConcurrently scans the blocks after prev up to height end. cfg.ScanConcurrency workers fetch
+// the blocks concurrently, and the blocks are scanned in height order. It returns the last scanned block,
+// which is prev if no block was scanned, and the number of deposits found. If a block can't be fetched or
+// scanned, the blocks before it are still scanned and the error is returned.
+func (s *BTCScanner) scanBlocksConcurrently(prev *btcjson.GetBlockVerboseResult, end int64) (*btcjson.GetBlockVerboseResult, int, error) {
+	log := s.log.WithFields(logrus.Fields{
+		"startHeight": prev.Height + 1,
+		"endHeight":   end,
+		"concurrency": s.cfg.ScanConcurrency,
+	})
+	log.Info("Scanning blocks concurrently")
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer close(stop)
+
+	jobs := make(chan fetchJob)
+	// Result channels in height order. The capacity limits how far the workers fetch ahead of the scanned block
+	results := make(chan chan fetchResult, s.cfg.ScanConcurrency*2)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer logger.LogPanic(log)
+		defer close(results)
+		defer close(jobs)
+
+		for h := prev.Height + 1; h <= end; h++ {
+			j := fetchJob{
+				height: h,
+				result: make(chan fetchResult, 1),
+			}
+
+			select {
+			case <-stop:
+				return
+			case results <- j.result:
+			}
+
+			select {
+			case <-stop:
+				return
+			case jobs <- j:
+			}
+		}
+	}()
+
+	for i := 0; i < s.cfg.ScanConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer logger.LogPanic(log)
+			for j := range jobs {
+				block, err := s.getBlockAtHeight(j.height)
+				j.result <- fetchResult{
+					block: block,
+					err:   err,
+				}
+			}
+		}()
+	}
+
+	last := prev
+	deposits := 0
+	for r := range results {
+		var res fetchResult
+		select {
+		case <-s.quit:
+			return last, deposits, errQuit
+		case res = <-r:
+		}
+
+		if res.err != nil {
+			return last, deposits, res.err
+		}
+
+		if res.block.PreviousHash != last.Hash {
+			log.WithFields(logrus.Fields{
+				"hash":         res.block.Hash,
+				"height":       res.block.Height,
+				"previousHash": res.block.PreviousHash,
+				"lastHash":     last.Hash,
+			}).Warning("Fetched block does not follow the last scanned block")
+			return last, deposits, errChainChanged
+		}
+
+		n, err := s.scanBlock(res.block)
+		deposits += n
+		if err != nil {
+			return last, deposits, err
+		}
+
+		last = res.block
+		s.setBehind(end - last.Height)
+	}
+
+	log.WithFields(logrus.Fields{
+		"scannedDeposits": deposits,
+		"lastHeight":      last.Height,
+	}).Infof("Scanned %d deposits from blocks", deposits)
+
+	return last, deposits, nil
+}
+
 // getNextBlock returns the next block from another block, return nil if next block does not exist
 func (s *BTCScanner) getNextBlock(block *btcjson.GetBlockVerboseResult) (*btcjson.GetBlockVerboseResult, error) {
 	if block.NextHash == "" {
@@ -410,12 +671,10 @@ func (s *BTCScanner) waitForNextBlock(block *btcjson.GetBlockVerboseResult) (*bt
 			}
 
 			if err != nil || block.NextHash == "" {
-				select {
-				case <-s.quit:
-					return nil, errQuit
-				case <-time.After(s.cfg.ScanPeriod):
-					continue
+				if err := s.waitForBlockNotify(); err != nil {
+					return nil, err
 				}
+				continue
 			}
 
 			break
@@ -431,12 +690,10 @@ func (s *BTCScanner) waitForNextBlock(block *btcjson.GetBlockVerboseResult) (*bt
 			log.Debug("No new block yet")
 		}
 		if err != nil || nextBlock == nil {
-			select {
-			case <-s.quit:
-				return nil, errQuit
-			case <-time.After(s.cfg.ScanPeriod):
-				continue
+			if err := s.waitForBlockNotify(); err != nil {
+				return nil, err
 			}
+			continue
 		}
 
 		log.WithFields(logrus.Fields{
@@ -448,8 +705,129 @@ func (s *BTCScanner) waitForNextBlock(block *btcjson.GetBlockVerboseResult) (*bt
 	}
 }
 
+// Rescan rescans the blocks from height from to height to in the background, for deposits to the current
+// scan addresses, e.g. after an address was added late. Deposits that were already saved are skipped, and
+// the checkpoint does not change. The blocks must have enough confirmations. Returns InvalidRescanRangeErr
+// for an invalid range, or ErrRescanInProgress if a rescan is running. The progress is in RescanStatus.
+func (s *BTCScanner) Rescan(from, to int64) error {
+	bestHeight, err := s.btcClient.GetBlockCount()
+	if err != nil {
+		s.log.WithError(err).Error("btcClient.GetBlockCount failed")
+		return err
+	}
+
+	if err := checkRescanRange(from, to, bestHeight-s.cfg.ConfirmationsRequired, maxRescanBlocks); err != nil {
+		return err
+	}
+
+	return s.rescan.start(s.log, s.quit, from, to, 1, func(height, _ int64) (int, error) {
+		block, err := s.getBlockAtHeight(height)
+		if err != nil {
+			return 0, err
+		}
+
+		dvs, err := s.store.RescanBlock(block)
+		if err != nil {
+			s.log.WithError(err).WithField("height", height).Error("store.RescanBlock failed")
+			return 0, err
+		}
+
+		return s.sendDeposits(dvs)
+	})
+}
+
+// RescanStatus returns the progress of the last rescan, or nil if there was no rescan since the scanner started
+func (s *BTCScanner) RescanStatus() *RescanStatus {
+	return s.rescan.getStatus()
+}
+
+// CheckDeposit checks whether the transaction of a deposit is still in the best chain and, if it is not, whether
+// a transaction of the best chain spends one of the deposit's inputs. The blocks from checkDepositLookback blocks
+// below the deposit's height up to the best block are searched, so it is meant for deposits with few confirmations.
+// Deposits saved without their inputs are never found conflicted.
+func (s *BTCScanner) CheckDeposit(d Deposit) (DepositCheck, error) {
+	log := s.log.WithField("deposit", d.ID())
+
+	best, err := s.btcClient.GetBlockCount()
+	if err != nil {
+		log.WithError(err).Error("btcClient.GetBlockCount failed")
+		return DepositCheck{}, err
+	}
+
+	// The block the deposit was found in is usually still in the best chain
+	if d.Height <= best {
+		block, err := s.getBlockAtHeight(d.Height)
+		if err != nil {
+			return DepositCheck{}, err
+		}
+
+		for _, tx := range block.RawTx {
+			if tx.Txid == d.Tx {
+				return DepositCheck{
+					State:  DepositConfirmed,
+					Height: d.Height,
+				}, nil
+			}
+		}
+	}
+
+	inputs := make(map[string]struct{}, len(d.Inputs))
+	for _, in := range d.Inputs {
+		inputs[in] = struct{}{}
+	}
+
+	from := d.Height - checkDepositLookback
+	if from < 0 {
+		from = 0
+	}
+
+	for height := from; height <= best; height++ {
+		select {
+		case <-s.quit:
+			return DepositCheck{}, errQuit
+		default:
+		}
+
+		block, err := s.getBlockAtHeight(height)
+		if err != nil {
+			return DepositCheck{}, err
+		}
+
+		for _, tx := range block.RawTx {
+			if tx.Txid == d.Tx {
+				return DepositCheck{
+					State:  DepositConfirmed,
+					Height: height,
+				}, nil
+			}
+
+			for _, in := range txInputs(tx) {
+				if _, ok := inputs[in]; ok {
+					log.WithFields(logrus.Fields{
+						"conflictTx": tx.Txid,
+						"input":      in,
+						"height":     height,
+					}).Warn("Deposit transaction was double spent")
+					return DepositCheck{
+						State:      DepositConflicted,
+						ConflictTx: tx.Txid,
+					}, nil
+				}
+			}
+		}
+	}
+
+	return DepositCheck{
+		State: DepositUnconfirmed,
+	}, nil
+}
+
 // AddScanAddress adds new scan address
-func (s *BTCScanner) AddScanAddress(addr string) error {
+func (s *BTCScanner) AddScanAddress(addr, coinType string) error {
+	if coinType != s.coinType {
+		return ErrUnsupportedCoinType
+	}
+
 	return s.store.AddScanAddress(addr)
 }
 
@@ -4,6 +4,9 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
+	"sort"
+	"sync"
 	"testing"
 	"time"
 
@@ -34,6 +37,7 @@ type scannedBlock struct {
 }
 
 type dummyBtcrpcclient struct {
+	sync.Mutex
 	db                           *bolt.DB
 	blockHashes                  map[int64]string
 	blockCount                   int64
@@ -45,6 +49,11 @@ type dummyBtcrpcclient struct {
 	// used for testScannerBlockNextHashAppears
 	blockNextHashMissingOnceAt int64
 	hasSetMissingHash          bool
+
+	// used for testScannerScanConcurrency
+	blockHashCallCount           int
+	blockPreviousHashWrongOnceAt int64
+	hasSetWrongPreviousHash      bool
 }
 
 func openDummyBtcDB(t *testing.T) *bolt.DB {
@@ -65,6 +74,9 @@ func (dbc *dummyBtcrpcclient) Shutdown() {
 }
 
 func (dbc *dummyBtcrpcclient) GetBlockVerboseTx(hash *chainhash.Hash) (*btcjson.GetBlockVerboseResult, error) {
+	dbc.Lock()
+	defer dbc.Unlock()
+
 	dbc.blockVerboseTxCallCount++
 	if dbc.blockVerboseTxCallCount == dbc.blockVerboseTxErrorCallCount {
 		return nil, dbc.blockVerboseTxError
@@ -95,6 +107,11 @@ func (dbc *dummyBtcrpcclient) GetBlockVerboseTx(hash *chainhash.Hash) (*btcjson.
 		block.NextHash = ""
 	}
 
+	if block.Height == dbc.blockPreviousHashWrongOnceAt && !dbc.hasSetWrongPreviousHash {
+		dbc.hasSetWrongPreviousHash = true
+		block.PreviousHash = "00000000000000000000000000000000000000000000000000000000000000ff"
+	}
+
 	if block.Height > dbc.blockCount {
 		panic("scanner should not be scanning blocks past the blockCount height")
 	}
@@ -108,6 +125,9 @@ func (dbc *dummyBtcrpcclient) GetBlockVerboseTx(hash *chainhash.Hash) (*btcjson.
 }
 
 func (dbc *dummyBtcrpcclient) GetBlockCount() (int64, error) {
+	dbc.Lock()
+	defer dbc.Unlock()
+
 	if dbc.blockCountError != nil {
 		// blockCountError is only returned once
 		err := dbc.blockCountError
@@ -119,6 +139,10 @@ func (dbc *dummyBtcrpcclient) GetBlockCount() (int64, error) {
 }
 
 func (dbc *dummyBtcrpcclient) GetBlockHash(height int64) (*chainhash.Hash, error) {
+	dbc.Lock()
+	defer dbc.Unlock()
+
+	dbc.blockHashCallCount++
 	hash := dbc.blockHashes[height]
 	if hash == "" {
 		return nil, errNoBlockHash
@@ -221,14 +245,14 @@ func testScannerRun(t *testing.T, scr *BTCScanner) {
 	var nDeposits int64
 
 	// This address has 0 deposits
-	err := scr.AddScanAddress("1LcEkgX8DCrQczLMVh9LDTRnkdVV2oun3A")
+	err := scr.AddScanAddress("1LcEkgX8DCrQczLMVh9LDTRnkdVV2oun3A", CoinTypeBTC)
 	require.NoError(t, err)
 	nDeposits = nDeposits + 0
 
 	// This address has:
 	// 1 deposit, in block 235206
 	// 1 deposit, in block 235207
-	err = scr.AddScanAddress("1N8G4JM8krsHLQZjC51R7ZgwDyihmgsQYA")
+	err = scr.AddScanAddress("1N8G4JM8krsHLQZjC51R7ZgwDyihmgsQYA", CoinTypeBTC)
 	require.NoError(t, err)
 	nDeposits = nDeposits + 2
 
@@ -237,7 +261,7 @@ func testScannerRun(t *testing.T, scr *BTCScanner) {
 	// 47 deposits in block 235206
 	// 22 deposits, in block 235207
 	// 26 deposits, in block 235214
-	err = scr.AddScanAddress("1LEkderht5M5yWj82M87bEd4XDBsczLkp9")
+	err = scr.AddScanAddress("1LEkderht5M5yWj82M87bEd4XDBsczLkp9", CoinTypeBTC)
 	require.NoError(t, err)
 	nDeposits = nDeposits + 126
 
@@ -246,6 +270,9 @@ func testScannerRun(t *testing.T, scr *BTCScanner) {
 	require.True(t, int64(scr.cfg.DepositBufferSize) < nDeposits)
 
 	testScannerRunProcessedLoop(t, scr, nDeposits)
+
+	// The scanner caught up to the last confirmed block
+	require.Equal(t, int64(0), scr.Behind())
 }
 
 func testScannerRunProcessDeposits(t *testing.T, btcDB *bolt.DB) {
@@ -296,7 +323,7 @@ func testScannerConfirmationsRequired(t *testing.T, btcDB *bolt.DB) {
 	// 26 deposits, in block 235214
 	// Only blocks 235205 and 235206 are processed, because blockCount is set
 	// to 235208 and the confirmations required is set to 2
-	err := scr.AddScanAddress("1LEkderht5M5yWj82M87bEd4XDBsczLkp9")
+	err := scr.AddScanAddress("1LEkderht5M5yWj82M87bEd4XDBsczLkp9", CoinTypeBTC)
 	require.NoError(t, err)
 	nDeposits = nDeposits + 78
 
@@ -333,6 +360,20 @@ func testScannerBlockNextHashAppears(t *testing.T, btcDB *bolt.DB) {
 	testScannerRun(t, scr)
 }
 
+func testScannerZMQUnavailable(t *testing.T, btcDB *bolt.DB) {
+	// Test that if the ZMQ socket can't be connected, the scanner falls back
+	// to polling every ScanPeriod and processes everything normally
+	scr, shutdown := setupScanner(t, btcDB)
+	defer shutdown()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	scr.cfg.ZMQAddress = "tcp://" + ln.Addr().String()
+	require.NoError(t, ln.Close())
+
+	testScannerRun(t, scr)
+}
+
 func testScannerDuplicateDepositScans(t *testing.T, btcDB *bolt.DB) {
 	// Test that rescanning the same blocks doesn't send extra deposits
 	db, shutdown := testutil.PrepareDB(t)
@@ -344,17 +385,120 @@ func testScannerDuplicateDepositScans(t *testing.T, btcDB *bolt.DB) {
 	// 1 deposit, in block 235206
 	// 1 deposit, in block 235207
 	scr := setupScannerWithDB(t, btcDB, db)
-	err := scr.AddScanAddress("1N8G4JM8krsHLQZjC51R7ZgwDyihmgsQYA")
+	err := scr.AddScanAddress("1N8G4JM8krsHLQZjC51R7ZgwDyihmgsQYA", CoinTypeBTC)
 	require.NoError(t, err)
 	nDeposits = nDeposits + 2
 
 	testScannerRunProcessedLoop(t, scr, nDeposits)
 
+	// Remove the checkpoint, so that the blocks are scanned again
+	err = db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(scanMetaBkt).Delete([]byte(checkpointKey))
+	})
+	require.NoError(t, err)
+
 	// Scanning again will have no new deposits
 	scr = setupScannerWithDB(t, btcDB, db)
 	testScannerRunProcessedLoop(t, scr, 0)
 }
 
+func testScannerResumeFromCheckpoint(t *testing.T, btcDB *bolt.DB) {
+	// Test that a restarted scanner resumes after the last scanned block
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	scr := setupScannerWithDB(t, btcDB, db)
+	err := scr.AddScanAddress("1N8G4JM8krsHLQZjC51R7ZgwDyihmgsQYA", CoinTypeBTC)
+	require.NoError(t, err)
+
+	testScannerRunProcessedLoop(t, scr, 2)
+
+	cp, err := scr.store.GetCheckpoint()
+	require.NoError(t, err)
+	require.Equal(t, &Checkpoint{
+		Height: 235214,
+		Hash:   "00000000000000ba2eebc4f7c8230c653aa0667c4687178923740510ed4f59bc",
+	}, cp)
+
+	scr = setupScannerWithDB(t, btcDB, db)
+	rpc := scr.btcClient.(*dummyBtcrpcclient)
+	rpc.setAllBlockHashes(t)
+
+	testScannerRunProcessedLoop(t, scr, 0)
+
+	// Only the checkpoint block was fetched by height, the blocks before it were not scanned again
+	rpc.Lock()
+	defer rpc.Unlock()
+	require.Equal(t, 1, rpc.blockHashCallCount)
+}
+
+func testScannerCheckpointNotInMainChain(t *testing.T, btcDB *bolt.DB) {
+	// Test that if the checkpoint block is no longer in the main chain,
+	// the scanner scans again from the initial scan height
+	scr, shutdown := setupScanner(t, btcDB)
+	defer shutdown()
+
+	scr.btcClient.(*dummyBtcrpcclient).setAllBlockHashes(t)
+
+	_, err := scr.store.(*BTCStore).SaveDepositsCheckpoint(nil, Checkpoint{
+		Height: 235210,
+		Hash:   "0000000000000000000000000000000000000000000000000000000000000001",
+	})
+	require.NoError(t, err)
+
+	err = scr.AddScanAddress("1N8G4JM8krsHLQZjC51R7ZgwDyihmgsQYA", CoinTypeBTC)
+	require.NoError(t, err)
+
+	testScannerRunProcessedLoop(t, scr, 2)
+}
+
+func testScannerRescan(t *testing.T, btcDB *bolt.DB) {
+	// Test that a rescan finds the deposits to an address added after its blocks were scanned
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	scr := setupScannerWithDB(t, btcDB, db)
+	testScannerRunProcessedLoop(t, scr, 0)
+
+	scr = setupScannerWithDB(t, btcDB, db)
+	scr.btcClient.(*dummyBtcrpcclient).setAllBlockHashes(t)
+
+	// This address has:
+	// 1 deposit, in block 235206
+	// 1 deposit, in block 235207
+	err := scr.AddScanAddress("1N8G4JM8krsHLQZjC51R7ZgwDyihmgsQYA", CoinTypeBTC)
+	require.NoError(t, err)
+
+	require.Nil(t, scr.RescanStatus())
+
+	_, ok := scr.Rescan(235210, 235215).(InvalidRescanRangeErr)
+	require.True(t, ok)
+	_, ok = scr.Rescan(235207, 235206).(InvalidRescanRangeErr)
+	require.True(t, ok)
+
+	rescanErrC := make(chan error, 1)
+	time.AfterFunc(time.Millisecond*100, func() {
+		rescanErrC <- scr.Rescan(235205, 235207)
+	})
+
+	testScannerRunProcessedLoop(t, scr, 2)
+	require.NoError(t, <-rescanErrC)
+
+	st := scr.RescanStatus()
+	require.NotNil(t, st)
+	require.Equal(t, int64(235205), st.From)
+	require.Equal(t, int64(235207), st.To)
+	require.Equal(t, int64(235207), st.Height)
+	require.Equal(t, 2, st.Deposits)
+	require.NotEqual(t, int64(0), st.FinishedAt)
+	require.Empty(t, st.Error)
+
+	// The checkpoint did not change
+	cp, err := scr.store.GetCheckpoint()
+	require.NoError(t, err)
+	require.Equal(t, int64(235214), cp.Height)
+}
+
 func testScannerLoadUnprocessedDeposits(t *testing.T, btcDB *bolt.DB) {
 	// Test that pending unprocessed deposits from the db are loaded when
 	// then scanner starts.
@@ -423,7 +567,7 @@ func testScannerProcessDepositError(t *testing.T, btcDB *bolt.DB) {
 	// 47 deposits in block 235206
 	// 22 deposits, in block 235207
 	// 26 deposits, in block 235214
-	err := scr.AddScanAddress("1LEkderht5M5yWj82M87bEd4XDBsczLkp9")
+	err := scr.AddScanAddress("1LEkderht5M5yWj82M87bEd4XDBsczLkp9", CoinTypeBTC)
 	require.NoError(t, err)
 	nDeposits = nDeposits + 126
 
@@ -497,6 +641,94 @@ func testScannerInitialGetBlockHashError(t *testing.T, btcDB *bolt.DB) {
 	require.Equal(t, errNoBlockHash, err)
 }
 
+// setAllBlockHashes sets the hashes of all blocks in btc.db, so that they can be fetched by height
+func (dbc *dummyBtcrpcclient) setAllBlockHashes(t *testing.T) {
+	err := dbc.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(dummyBlocksBktName).ForEach(func(k, v []byte) error {
+			var b btcjson.GetBlockVerboseResult
+			if err := json.Unmarshal(v, &b); err != nil {
+				return err
+			}
+
+			dbc.blockHashes[b.Height] = b.Hash
+			return nil
+		})
+	})
+	require.NoError(t, err)
+	require.Len(t, dbc.blockHashes, 10)
+}
+
+func testScannerScanConcurrency(t *testing.T, btcDB *bolt.DB) {
+	// Test that with cfg.ScanConcurrency, blocks are fetched by height concurrently,
+	// and deposits are still found in height order
+	scr, shutdown := setupScanner(t, btcDB)
+	defer shutdown()
+
+	scr.cfg.ScanConcurrency = 4
+	rpc := scr.btcClient.(*dummyBtcrpcclient)
+	rpc.setAllBlockHashes(t)
+
+	// This address has:
+	// 1 deposit, in block 235206
+	// 1 deposit, in block 235207
+	err := scr.AddScanAddress("1N8G4JM8krsHLQZjC51R7ZgwDyihmgsQYA", CoinTypeBTC)
+	require.NoError(t, err)
+
+	// This address has:
+	// 31 deposits in block 235205
+	// 47 deposits in block 235206
+	// 22 deposits, in block 235207
+	// 26 deposits, in block 235214
+	err = scr.AddScanAddress("1LEkderht5M5yWj82M87bEd4XDBsczLkp9", CoinTypeBTC)
+	require.NoError(t, err)
+
+	nDeposits := 128
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		err := scr.Run()
+		require.NoError(t, err)
+	}()
+
+	var heights []int64
+	for dv := range scr.GetDeposit() {
+		heights = append(heights, dv.Height)
+		dv.ErrC <- nil
+
+		if len(heights) == nDeposits {
+			break
+		}
+	}
+
+	scr.Shutdown()
+	<-done
+
+	require.Len(t, heights, nDeposits)
+	require.True(t, sort.SliceIsSorted(heights, func(i, j int) bool {
+		return heights[i] < heights[j]
+	}))
+
+	// The initial block and the 9 blocks after it were fetched by height
+	rpc.Lock()
+	defer rpc.Unlock()
+	require.Equal(t, 10, rpc.blockHashCallCount)
+}
+
+func testScannerScanConcurrencyChainChanged(t *testing.T, btcDB *bolt.DB) {
+	// Test that if a block fetched by height does not follow the previous block,
+	// the scanner continues serially and still finds all deposits
+	scr, shutdown := setupScanner(t, btcDB)
+	defer shutdown()
+
+	scr.cfg.ScanConcurrency = 4
+	rpc := scr.btcClient.(*dummyBtcrpcclient)
+	rpc.setAllBlockHashes(t)
+	rpc.blockPreviousHashWrongOnceAt = 235207
+
+	testScannerRun(t, scr)
+}
+
 func TestScanner(t *testing.T) {
 	btcDB := openDummyBtcDB(t)
 	if !parallel {
@@ -559,10 +791,223 @@ func TestScanner(t *testing.T) {
 		testScannerDuplicateDepositScans(t, btcDB)
 	})
 
+	t.Run("ResumeFromCheckpoint", func(t *testing.T) {
+		if parallel {
+			t.Parallel()
+		}
+		testScannerResumeFromCheckpoint(t, btcDB)
+	})
+
+	t.Run("CheckpointNotInMainChain", func(t *testing.T) {
+		if parallel {
+			t.Parallel()
+		}
+		testScannerCheckpointNotInMainChain(t, btcDB)
+	})
+
+	t.Run("Rescan", func(t *testing.T) {
+		if parallel {
+			t.Parallel()
+		}
+		testScannerRescan(t, btcDB)
+	})
+
 	t.Run("BlockNextHashAppears", func(t *testing.T) {
 		if parallel {
 			t.Parallel()
 		}
 		testScannerBlockNextHashAppears(t, btcDB)
 	})
+
+	t.Run("ZMQUnavailable", func(t *testing.T) {
+		if parallel {
+			t.Parallel()
+		}
+		testScannerZMQUnavailable(t, btcDB)
+	})
+
+	t.Run("ScanConcurrency", func(t *testing.T) {
+		if parallel {
+			t.Parallel()
+		}
+		testScannerScanConcurrency(t, btcDB)
+	})
+
+	t.Run("ScanConcurrencyChainChanged", func(t *testing.T) {
+		if parallel {
+			t.Parallel()
+		}
+		testScannerScanConcurrencyChainChanged(t, btcDB)
+	})
+}
+
+// dummyChain is a BtcRPCClient of a chain of blocks held in memory, indexed by height
+type dummyChain struct {
+	blocks []btcjson.GetBlockVerboseResult
+}
+
+func (c *dummyChain) hash(height int64) *chainhash.Hash {
+	h := chainhash.DoubleHashH([]byte(fmt.Sprintf("%d", height)))
+	return &h
+}
+
+func (c *dummyChain) GetBlockVerboseTx(hash *chainhash.Hash) (*btcjson.GetBlockVerboseResult, error) {
+	for i := range c.blocks {
+		if c.hash(int64(i)).IsEqual(hash) {
+			b := c.blocks[i]
+			b.Height = int64(i)
+			return &b, nil
+		}
+	}
+	return nil, fmt.Errorf("no block found with hash %s", hash)
+}
+
+func (c *dummyChain) GetBlockHash(height int64) (*chainhash.Hash, error) {
+	if height >= int64(len(c.blocks)) {
+		return nil, errNoBlockHash
+	}
+	return c.hash(height), nil
+}
+
+func (c *dummyChain) GetBlockCount() (int64, error) {
+	return int64(len(c.blocks)) - 1, nil
+}
+
+func (c *dummyChain) Shutdown() {}
+
+func TestBTCScannerCheckDeposit(t *testing.T) {
+	tx := func(txid string, inputs ...string) btcjson.TxRawResult {
+		r := btcjson.TxRawResult{Txid: txid}
+		for _, in := range inputs {
+			r.Vin = append(r.Vin, btcjson.Vin{Txid: in, Vout: 1})
+		}
+		return r
+	}
+
+	chain := func(txs map[int][]btcjson.TxRawResult) *dummyChain {
+		c := &dummyChain{
+			blocks: make([]btcjson.GetBlockVerboseResult, 20),
+		}
+		for h, t := range txs {
+			c.blocks[h].RawTx = t
+		}
+		return c
+	}
+
+	deposit := Deposit{
+		CoinType: CoinTypeBTC,
+		Address:  "14JwrdSxYXPxSi6crLKVwR4k2dbjfVZ3xj",
+		Value:    100000,
+		Height:   15,
+		Tx:       "deposit",
+		Inputs:   []string{"in1:1", "in2:1"},
+	}
+
+	cases := []struct {
+		name    string
+		chain   *dummyChain
+		deposit Deposit
+		check   DepositCheck
+	}{
+		{
+			name: "in its block",
+			chain: chain(map[int][]btcjson.TxRawResult{
+				15: {tx("other", "in3"), tx("deposit", "in1", "in2")},
+			}),
+			deposit: deposit,
+			check: DepositCheck{
+				State:  DepositConfirmed,
+				Height: 15,
+			},
+		},
+		{
+			name: "mined again in a lower block after a reorg",
+			chain: chain(map[int][]btcjson.TxRawResult{
+				12: {tx("deposit", "in1", "in2")},
+			}),
+			deposit: deposit,
+			check: DepositCheck{
+				State:  DepositConfirmed,
+				Height: 12,
+			},
+		},
+		{
+			name: "mined again in a higher block after a reorg",
+			chain: chain(map[int][]btcjson.TxRawResult{
+				17: {tx("deposit", "in1", "in2")},
+			}),
+			deposit: deposit,
+			check: DepositCheck{
+				State:  DepositConfirmed,
+				Height: 17,
+			},
+		},
+		{
+			name: "double spent",
+			chain: chain(map[int][]btcjson.TxRawResult{
+				14: {tx("other", "in3")},
+				16: {tx("replacement", "in4", "in2")},
+			}),
+			deposit: deposit,
+			check: DepositCheck{
+				State:      DepositConflicted,
+				ConflictTx: "replacement",
+			},
+		},
+		{
+			name: "not in the best chain",
+			chain: chain(map[int][]btcjson.TxRawResult{
+				15: {tx("other", "in3")},
+			}),
+			deposit: deposit,
+			check: DepositCheck{
+				State: DepositUnconfirmed,
+			},
+		},
+		{
+			name: "above the best block",
+			chain: chain(map[int][]btcjson.TxRawResult{
+				16: {tx("replacement", "in1")},
+			}),
+			deposit: Deposit{
+				Tx:     "deposit",
+				Height: 25,
+				Inputs: []string{"in1:1"},
+			},
+			check: DepositCheck{
+				State: DepositUnconfirmed,
+			},
+		},
+		{
+			name: "saved without inputs",
+			chain: chain(map[int][]btcjson.TxRawResult{
+				16: {tx("replacement", "in1", "in2")},
+			}),
+			deposit: Deposit{
+				Tx:     "deposit",
+				Height: 15,
+			},
+			check: DepositCheck{
+				State: DepositUnconfirmed,
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, shutdown := testutil.PrepareDB(t)
+			defer shutdown()
+
+			log, _ := testutil.NewLogger(t)
+			store, err := NewStore(log, db)
+			require.NoError(t, err)
+
+			scr, err := NewBTCScanner(log, store, tc.chain, Config{})
+			require.NoError(t, err)
+
+			check, err := scr.CheckDeposit(tc.deposit)
+			require.NoError(t, err)
+			require.Equal(t, tc.check, check)
+		})
+	}
 }
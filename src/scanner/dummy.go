@@ -1,15 +1,18 @@
 package scanner
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"math"
 	"net/http"
+	"os"
 	"strconv"
 	"sync"
 
 	"github.com/sirupsen/logrus"
 
-	"github.com/skycoin/skycoin/src/cipher"
-
+	"github.com/skycoin/teller/src/addrs"
 	"github.com/skycoin/teller/src/util/httputil"
 )
 
@@ -31,8 +34,12 @@ func NewDummyScanner(log logrus.FieldLogger) *DummyScanner {
 	}
 }
 
-// AddScanAddress adds an address
-func (s *DummyScanner) AddScanAddress(addr string) error {
+// AddScanAddress adds an address. Coin types other than BTC and LTC are taken as ERC20 tokens.
+func (s *DummyScanner) AddScanAddress(addr, coinType string) error {
+	if coinType == "" {
+		return ErrUnsupportedCoinType
+	}
+
 	s.Lock()
 	defer s.Unlock()
 
@@ -64,6 +71,104 @@ func (s *DummyScanner) GetDeposit() <-chan DepositNote {
 	return s.deposits
 }
 
+// FeedDeposits queues deposits in order, waiting while the deposits channel is full, until quit is closed
+func (s *DummyScanner) FeedDeposits(deposits []Deposit, quit <-chan struct{}) {
+	for i, d := range deposits {
+		select {
+		case s.deposits <- NewDepositNote(d):
+		case <-quit:
+			s.log.Warnf("Stopped feeding deposits, %d of %d fed", i, len(deposits))
+			return
+		}
+	}
+
+	s.log.Infof("Fed %d deposits", len(deposits))
+}
+
+// dummyDeposit is a deposit in a file read by ReadDummyDeposits. The fields are named like the
+// parameters of /dummy/scanner/deposit.
+type dummyDeposit struct {
+	Coin   string `json:"coin"`
+	Addr   string `json:"addr"`
+	Value  int64  `json:"value"`
+	Height int64  `json:"height"`
+	Tx     string `json:"tx"`
+	N      uint32 `json:"n"`
+}
+
+// ReadDummyDeposits reads a JSON array of deposits to feed to the DummyScanner
+func ReadDummyDeposits(path string) ([]Deposit, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var dds []dummyDeposit
+	if err := json.NewDecoder(f).Decode(&dds); err != nil {
+		return nil, fmt.Errorf("decode %s failed: %v", path, err)
+	}
+
+	deposits := make([]Deposit, 0, len(dds))
+	for i, dd := range dds {
+		if dd.Coin == "" {
+			dd.Coin = CoinTypeBTC
+		}
+
+		addr, err := verifyDummyAddress(dd.Coin, dd.Addr)
+		if err != nil {
+			return nil, fmt.Errorf("deposit %d: %v", i, err)
+		}
+
+		switch {
+		case dd.Value < 0:
+			err = errors.New("invalid value")
+		case dd.Height < 0:
+			err = errors.New("invalid height")
+		case dd.Tx == "":
+			err = errors.New("tx required")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("deposit %d: %v", i, err)
+		}
+
+		deposits = append(deposits, Deposit{
+			CoinType: dd.Coin,
+			Address:  addr,
+			Value:    dd.Value,
+			Height:   dd.Height,
+			Tx:       dd.Tx,
+			N:        dd.N,
+		})
+	}
+
+	return deposits, nil
+}
+
+// verifyDummyAddress verifies a deposit address of coinType, and returns it normalized
+func verifyDummyAddress(coinType, addr string) (string, error) {
+	if addr == "" {
+		return "", errors.New("addr required")
+	}
+
+	var err error
+	switch coinType {
+	case CoinTypeBTC:
+		addr = addrs.NormalizeBTCAddress(addr)
+		err = addrs.VerifyBTCAddress(addr)
+	case CoinTypeLTC:
+		err = addrs.VerifyLTCAddress(addr)
+	default:
+		// ERC20 token
+		err = addrs.VerifyETHAddress(addr)
+	}
+	if err != nil {
+		return "", errors.New("invalid addr")
+	}
+
+	return addr, nil
+}
+
 // HTTP Interface
 
 // BindHandlers binds dummy scanner HTTP handlers
@@ -77,14 +182,9 @@ func (s *DummyScanner) addDepositHandler(w http.ResponseWriter, r *http.Request)
 		coinType = CoinTypeBTC
 	}
 
-	addr := r.FormValue("addr")
-	if addr == "" {
-		httputil.ErrResponse(w, http.StatusBadRequest, "addr required")
-		return
-	}
-
-	if _, err := cipher.BitcoinDecodeBase58Address(addr); err != nil {
-		httputil.ErrResponse(w, http.StatusBadRequest, "invalid addr")
+	addr, err := verifyDummyAddress(coinType, r.FormValue("addr"))
+	if err != nil {
+		httputil.ErrResponse(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
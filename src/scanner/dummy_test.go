@@ -0,0 +1,106 @@
+package scanner
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+func writeTempFile(t *testing.T, data string) string {
+	f, err := ioutil.TempFile("", "dummy-deposits")
+	require.NoError(t, err)
+	_, err = f.WriteString(data)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	return f.Name()
+}
+
+func TestReadDummyDeposits(t *testing.T) {
+	path := writeTempFile(t, `[
+		{"addr": "1PZ63K3G4gZP6A6E2TTbBwxT5bFQGL2TLB", "value": 100000000, "height": 494713, "tx": "edb29a9b561a8d6a6118eb1f724c87f853bf471d7e4f0e9ccb9e1d340235687b"},
+		{"coin": "LTC", "addr": "LdDxRJUshHmWxuuieubRTnKzzLpt4qwkPN", "value": 5000, "height": 1341001, "tx": "tx2", "n": 1}
+	]`)
+	defer os.Remove(path)
+
+	deposits, err := ReadDummyDeposits(path)
+	require.NoError(t, err)
+	require.Equal(t, []Deposit{
+		{
+			CoinType: CoinTypeBTC,
+			Address:  "1PZ63K3G4gZP6A6E2TTbBwxT5bFQGL2TLB",
+			Value:    100000000,
+			Height:   494713,
+			Tx:       "edb29a9b561a8d6a6118eb1f724c87f853bf471d7e4f0e9ccb9e1d340235687b",
+		},
+		{
+			CoinType: CoinTypeLTC,
+			Address:  "LdDxRJUshHmWxuuieubRTnKzzLpt4qwkPN",
+			Value:    5000,
+			Height:   1341001,
+			Tx:       "tx2",
+			N:        1,
+		},
+	}, deposits)
+
+	for _, tc := range []struct {
+		data string
+		err  string
+	}{
+		{`[{"value": 1, "height": 1, "tx": "a"}]`, "deposit 0: addr required"},
+		{`[{"addr": "foo", "value": 1, "height": 1, "tx": "a"}]`, "deposit 0: invalid addr"},
+		{`[{"addr": "1PZ63K3G4gZP6A6E2TTbBwxT5bFQGL2TLB", "value": -1, "height": 1, "tx": "a"}]`, "deposit 0: invalid value"},
+		{`[{"addr": "1PZ63K3G4gZP6A6E2TTbBwxT5bFQGL2TLB", "value": 1, "height": 1}]`, "deposit 0: tx required"},
+	} {
+		path := writeTempFile(t, tc.data)
+		_, err := ReadDummyDeposits(path)
+		os.Remove(path)
+		require.EqualError(t, err, tc.err)
+	}
+}
+
+func TestDummyScannerFeedDeposits(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+	s := NewDummyScanner(log)
+
+	deposits := make([]Deposit, cap(s.deposits)+10)
+	for i := range deposits {
+		deposits[i] = Deposit{
+			CoinType: CoinTypeBTC,
+			Tx:       "tx",
+			N:        uint32(i),
+		}
+	}
+
+	quit := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.FeedDeposits(deposits, quit)
+	}()
+
+	// Deposits are fed in order, waiting for the channel to be read
+	for i := range deposits {
+		dn := <-s.GetDeposit()
+		require.Equal(t, uint32(i), dn.N)
+	}
+	<-done
+
+	// Feeding stops when quit is closed, once the channel is full
+	done = make(chan struct{})
+	go func() {
+		defer close(done)
+		s.FeedDeposits(deposits, quit)
+	}()
+
+	for len(s.deposits) < cap(s.deposits) {
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	close(quit)
+	<-done
+}
@@ -0,0 +1,362 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+
+	"github.com/skycoin/teller/src/addrs"
+	"github.com/skycoin/teller/src/util/bech32util"
+)
+
+const (
+	electrumTimeout = 30 * time.Second
+
+	// electrumProtocolVersion is the Electrum protocol version negotiated with server.version
+	electrumProtocolVersion = "1.4"
+)
+
+// ElectrumRPCError is an error returned by the Electrum server
+type ElectrumRPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e ElectrumRPCError) Error() string {
+	return fmt.Sprintf("electrum rpc error %d: %s", e.Code, e.Message)
+}
+
+// ElectrumClient is an AddressBackend using the Electrum protocol, for ElectrumX, Fulcrum or
+// electrs servers. It keeps one connection open, and reconnects after a failed call.
+type ElectrumClient struct {
+	addr      string
+	tlsConfig *tls.Config // nil for plain TCP
+
+	sync.Mutex
+	conn    net.Conn
+	r       *bufio.Reader
+	id      uint64
+	closed  bool
+	txCache map[string][]*wire.TxOut // outputs of confirmed transactions, by txid
+}
+
+// NewElectrumClient creates an ElectrumClient for the server at addr, "host:port".
+// If useTLS is set, the connection uses TLS. cert is the PEM certificate of the server,
+// for servers with a self-signed certificate. If cert is empty, the system roots are used.
+func NewElectrumClient(addr string, useTLS bool, cert []byte) (*ElectrumClient, error) {
+	c := &ElectrumClient{
+		addr:    addr,
+		txCache: make(map[string][]*wire.TxOut),
+	}
+
+	if useTLS {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+
+		c.tlsConfig = &tls.Config{
+			ServerName: host,
+		}
+
+		if len(cert) != 0 {
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(cert) {
+				return nil, errors.New("Invalid electrum server certificate")
+			}
+			c.tlsConfig.RootCAs = pool
+		}
+	}
+
+	return c, nil
+}
+
+type electrumRequest struct {
+	JSONRPC string        `json:"jsonrpc"`
+	ID      uint64        `json:"id"`
+	Method  string        `json:"method"`
+	Params  []interface{} `json:"params"`
+}
+
+type electrumResponse struct {
+	ID     *uint64           `json:"id"`
+	Result json.RawMessage   `json:"result"`
+	Error  *ElectrumRPCError `json:"error"`
+}
+
+// connect opens the connection and negotiates the protocol version. Must be called with the lock held.
+func (c *ElectrumClient) connect() error {
+	d := &net.Dialer{
+		Timeout:   electrumTimeout,
+		KeepAlive: electrumTimeout,
+	}
+
+	var conn net.Conn
+	var err error
+	if c.tlsConfig != nil {
+		conn, err = tls.DialWithDialer(d, "tcp", c.addr, c.tlsConfig)
+	} else {
+		conn, err = d.Dial("tcp", c.addr)
+	}
+	if err != nil {
+		return err
+	}
+
+	c.conn = conn
+	c.r = bufio.NewReader(conn)
+
+	var version []string
+	if err := c.roundTrip("server.version", []interface{}{"teller", electrumProtocolVersion}, &version); err != nil {
+		c.disconnect()
+		return err
+	}
+
+	return nil
+}
+
+// disconnect closes the connection. Must be called with the lock held.
+func (c *ElectrumClient) disconnect() {
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn = nil
+	}
+}
+
+func (c *ElectrumClient) call(method string, params []interface{}, result interface{}) error {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.closed {
+		return errors.New("electrum client is shut down")
+	}
+
+	if c.conn == nil {
+		if err := c.connect(); err != nil {
+			return err
+		}
+	}
+
+	err := c.roundTrip(method, params, result)
+	switch err.(type) {
+	case nil, ElectrumRPCError:
+	default:
+		// The connection state is unknown after an I/O or decoding error
+		c.disconnect()
+	}
+
+	return err
+}
+
+// roundTrip sends a request and waits for its response. Must be called with the lock held.
+func (c *ElectrumClient) roundTrip(method string, params []interface{}, result interface{}) error {
+	if params == nil {
+		params = []interface{}{}
+	}
+
+	c.id++
+	id := c.id
+
+	b, err := json.Marshal(electrumRequest{
+		JSONRPC: "2.0",
+		ID:      id,
+		Method:  method,
+		Params:  params,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := c.conn.SetDeadline(time.Now().Add(electrumTimeout)); err != nil {
+		return err
+	}
+
+	if _, err := c.conn.Write(append(b, '\n')); err != nil {
+		return err
+	}
+
+	for {
+		line, err := c.r.ReadBytes('\n')
+		if err != nil {
+			return err
+		}
+
+		var r electrumResponse
+		if err := json.Unmarshal(line, &r); err != nil {
+			return fmt.Errorf("%s: decode electrum response failed: %v", method, err)
+		}
+
+		// Skip subscription notifications, which have no id
+		if r.ID == nil || *r.ID != id {
+			continue
+		}
+
+		if r.Error != nil {
+			return *r.Error
+		}
+
+		if err := json.Unmarshal(r.Result, result); err != nil {
+			return fmt.Errorf("%s: decode electrum result failed: %v", method, err)
+		}
+
+		return nil
+	}
+}
+
+// BestHeight returns the height of the best block known to the Electrum server
+func (c *ElectrumClient) BestHeight() (int64, error) {
+	var header struct {
+		Height int64 `json:"height"`
+	}
+	if err := c.call("blockchain.headers.subscribe", nil, &header); err != nil {
+		return 0, err
+	}
+
+	return header.Height, nil
+}
+
+// AddressTxs returns the transactions of addr. The outputs only include the outputs to addr.
+// Unconfirmed transactions have no outputs, since they are not needed.
+func (c *ElectrumClient) AddressTxs(addr string) ([]AddressTx, error) {
+	script, err := btcPayToAddrScript(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	var history []struct {
+		TxHash string `json:"tx_hash"`
+		Height int64  `json:"height"`
+	}
+	if err := c.call("blockchain.scripthash.get_history", []interface{}{electrumScriptHash(script)}, &history); err != nil {
+		return nil, err
+	}
+
+	txs := make([]AddressTx, 0, len(history))
+	for _, h := range history {
+		tx := AddressTx{
+			Txid:   h.TxHash,
+			Height: h.Height,
+		}
+
+		if h.Height > 0 {
+			outs, err := c.txOutputs(h.TxHash)
+			if err != nil {
+				return nil, err
+			}
+
+			for n, out := range outs {
+				if bytes.Equal(out.PkScript, script) {
+					tx.Outputs = append(tx.Outputs, TxOutput{
+						N:       uint32(n),
+						Address: addr,
+						Value:   out.Value,
+					})
+				}
+			}
+		}
+
+		txs = append(txs, tx)
+	}
+
+	return txs, nil
+}
+
+// txOutputs returns the outputs of a confirmed transaction
+func (c *ElectrumClient) txOutputs(txid string) ([]*wire.TxOut, error) {
+	c.Lock()
+	outs, ok := c.txCache[txid]
+	c.Unlock()
+	if ok {
+		return outs, nil
+	}
+
+	var rawTx string
+	if err := c.call("blockchain.transaction.get", []interface{}{txid}, &rawTx); err != nil {
+		return nil, err
+	}
+
+	b, err := hex.DecodeString(rawTx)
+	if err != nil {
+		return nil, fmt.Errorf("tx %s: invalid hex: %v", txid, err)
+	}
+
+	var msgTx wire.MsgTx
+	if err := msgTx.Deserialize(bytes.NewReader(b)); err != nil {
+		return nil, fmt.Errorf("tx %s: deserialize failed: %v", txid, err)
+	}
+
+	if h := msgTx.TxHash(); h.String() != txid {
+		return nil, fmt.Errorf("tx %s: server returned tx %s", txid, h)
+	}
+
+	c.Lock()
+	c.txCache[txid] = msgTx.TxOut
+	c.Unlock()
+
+	return msgTx.TxOut, nil
+}
+
+// Shutdown closes the connection
+func (c *ElectrumClient) Shutdown() {
+	c.Lock()
+	defer c.Unlock()
+	c.closed = true
+	c.disconnect()
+}
+
+// btcPayToAddrScript returns the output script paying to a P2PKH, P2SH, P2WPKH or P2WSH bitcoin address
+func btcPayToAddrScript(addr string) ([]byte, error) {
+	// The vendored btcutil does not decode bech32 addresses
+	if addrs.IsBTCSegWitAddress(addr) {
+		program, err := bech32util.DecodeSegWitAddress(addrs.BTCSegWitHRP, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		// OP_0 <program>
+		script := []byte{0x00, byte(len(program))}
+		return append(script, program...), nil
+	}
+
+	a, err := btcutil.DecodeAddress(addr, &chaincfg.MainNetParams)
+	if err != nil {
+		return nil, err
+	}
+
+	switch a := a.(type) {
+	case *btcutil.AddressPubKeyHash:
+		// OP_DUP OP_HASH160 <hash> OP_EQUALVERIFY OP_CHECKSIG
+		script := []byte{0x76, 0xa9, 0x14}
+		script = append(script, a.ScriptAddress()...)
+		return append(script, 0x88, 0xac), nil
+	case *btcutil.AddressScriptHash:
+		// OP_HASH160 <hash> OP_EQUAL
+		script := []byte{0xa9, 0x14}
+		script = append(script, a.ScriptAddress()...)
+		return append(script, 0x87), nil
+	default:
+		return nil, fmt.Errorf("unsupported address type %T", a)
+	}
+}
+
+// electrumScriptHash returns the Electrum script hash of an output script,
+// the reversed sha256 of the script, hex encoded
+func electrumScriptHash(script []byte) string {
+	h := sha256.Sum256(script)
+	for i, j := 0, len(h)-1; i < j; i, j = i+1, j-1 {
+		h[i], h[j] = h[j], h[i]
+	}
+	return hex.EncodeToString(h[:])
+}
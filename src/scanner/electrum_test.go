@@ -0,0 +1,222 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeElectrumServer answers Electrum requests from a map of method to result
+type fakeElectrumServer struct {
+	ln net.Listener
+
+	sync.Mutex
+	results map[string]interface{}
+	calls   []string
+}
+
+func newFakeElectrumServer(t *testing.T, results map[string]interface{}) *fakeElectrumServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	s := &fakeElectrumServer{
+		ln:      ln,
+		results: results,
+	}
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+
+	return s
+}
+
+func (s *fakeElectrumServer) serve(conn net.Conn) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			return
+		}
+
+		var req electrumRequest
+		if err := json.Unmarshal(line, &req); err != nil {
+			return
+		}
+
+		key := req.Method
+		if len(req.Params) > 0 && req.Method != "server.version" {
+			key += " " + req.Params[0].(string)
+		}
+
+		s.Lock()
+		s.calls = append(s.calls, key)
+		result, ok := s.results[key]
+		s.Unlock()
+
+		rsp := map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      req.ID,
+		}
+		if ok {
+			rsp["result"] = result
+		} else {
+			rsp["error"] = ElectrumRPCError{Code: 1, Message: "unknown " + key}
+		}
+
+		// A subscription notification arrives before the response
+		notification := []byte(`{"jsonrpc":"2.0","method":"blockchain.headers.subscribe","params":[{"height":1,"hex":""}]}` + "\n")
+		b, err := json.Marshal(rsp)
+		if err != nil {
+			return
+		}
+
+		if _, err := conn.Write(append(notification, append(b, '\n')...)); err != nil {
+			return
+		}
+	}
+}
+
+func (s *fakeElectrumServer) getCalls() []string {
+	s.Lock()
+	defer s.Unlock()
+	return append([]string(nil), s.calls...)
+}
+
+func TestElectrumScriptHash(t *testing.T) {
+	// Example from the Electrum protocol documentation
+	script, err := btcPayToAddrScript("1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa")
+	require.NoError(t, err)
+	require.Equal(t, "76a91462e907b15cbf27d5425399ebf6f0fb50ebb88f1888ac", hex.EncodeToString(script))
+	require.Equal(t, "8b01df4e368ea28f8dc0423bcf7a4923e3a12d307c875e47a0cfbf90b5c39161", electrumScriptHash(script))
+
+	script, err = btcPayToAddrScript("3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy")
+	require.NoError(t, err)
+	require.Equal(t, "a914b472a266d0bd89c13706a4132ccfb16f7c3b9fcb87", hex.EncodeToString(script))
+
+	script, err = btcPayToAddrScript("bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4")
+	require.NoError(t, err)
+	require.Equal(t, "0014751e76e8199196d454941c45d1b3a323f1433bd6", hex.EncodeToString(script))
+
+	script, err = btcPayToAddrScript("bc1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3qccfmv3")
+	require.NoError(t, err)
+	require.Equal(t, "00201863143c14c5166804bd19203356da136c985678cd4d27a1b8c6329604903262", hex.EncodeToString(script))
+
+	_, err = btcPayToAddrScript("bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t5")
+	require.Error(t, err)
+
+	_, err = btcPayToAddrScript("bad")
+	require.Error(t, err)
+}
+
+func TestElectrumClient(t *testing.T) {
+	addr := "1LEkderht5M5yWj82M87bEd4XDBsczLkp9"
+	script, err := btcPayToAddrScript(addr)
+	require.NoError(t, err)
+
+	otherScript, err := btcPayToAddrScript("1N8G4JM8krsHLQZjC51R7ZgwDyihmgsQYA")
+	require.NoError(t, err)
+
+	tx := wire.NewMsgTx(1)
+	tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{}, nil, nil))
+	tx.AddTxOut(wire.NewTxOut(5000, otherScript))
+	tx.AddTxOut(wire.NewTxOut(1e8, script))
+	tx.AddTxOut(wire.NewTxOut(2e8, script))
+
+	var buf bytes.Buffer
+	require.NoError(t, tx.Serialize(&buf))
+	txid := tx.TxHash().String()
+
+	scriptHash := electrumScriptHash(script)
+
+	srv := newFakeElectrumServer(t, map[string]interface{}{
+		"server.version":               []string{"ElectrumX 1.8", "1.4"},
+		"blockchain.headers.subscribe": map[string]interface{}{"height": 537000, "hex": "00"},
+		"blockchain.scripthash.get_history " + scriptHash: []map[string]interface{}{
+			{"tx_hash": txid, "height": 536990},
+			{"tx_hash": "mempooltx", "height": 0, "fee": 1000},
+		},
+		"blockchain.transaction.get " + txid: hex.EncodeToString(buf.Bytes()),
+	})
+	defer srv.ln.Close()
+
+	c, err := NewElectrumClient(srv.ln.Addr().String(), false, nil)
+	require.NoError(t, err)
+	defer c.Shutdown()
+
+	h, err := c.BestHeight()
+	require.NoError(t, err)
+	require.Equal(t, int64(537000), h)
+
+	txs, err := c.AddressTxs(addr)
+	require.NoError(t, err)
+	require.Equal(t, []AddressTx{
+		{
+			Txid:   txid,
+			Height: 536990,
+			Outputs: []TxOutput{
+				{N: 1, Address: addr, Value: 1e8},
+				{N: 2, Address: addr, Value: 2e8},
+			},
+		},
+		{
+			Txid:   "mempooltx",
+			Height: 0,
+		},
+	}, txs)
+
+	// Confirmed transactions are cached
+	_, err = c.AddressTxs(addr)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"server.version",
+		"blockchain.headers.subscribe",
+		"blockchain.scripthash.get_history " + scriptHash,
+		"blockchain.transaction.get " + txid,
+		"blockchain.scripthash.get_history " + scriptHash,
+	}, srv.getCalls())
+
+	// Server errors are returned, and the connection is kept
+	_, err = c.AddressTxs("1N8G4JM8krsHLQZjC51R7ZgwDyihmgsQYA")
+	require.Error(t, err)
+	_, ok := err.(ElectrumRPCError)
+	require.True(t, ok)
+
+	h, err = c.BestHeight()
+	require.NoError(t, err)
+	require.Equal(t, int64(537000), h)
+	require.Equal(t, "server.version", srv.getCalls()[0])
+	require.Len(t, srv.getCalls(), 7)
+
+	// The client reconnects if the connection drops
+	c.Lock()
+	c.conn.Close()
+	c.Unlock()
+
+	_, err = c.BestHeight()
+	require.Error(t, err)
+
+	h, err = c.BestHeight()
+	require.NoError(t, err)
+	require.Equal(t, int64(537000), h)
+	require.Equal(t, "server.version", srv.getCalls()[7])
+
+	c.Shutdown()
+	_, err = c.BestHeight()
+	require.Error(t, err)
+}
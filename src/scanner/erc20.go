@@ -0,0 +1,525 @@
+package scanner
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/skycoin/teller/src/util/logger"
+)
+
+const (
+	// erc20ValueDecimals is the number of decimal places of the Value of ERC20 deposits,
+	// the same as BTC, so that the exchange rate is applied the same way
+	erc20ValueDecimals = 8
+
+	// maxLogBlockRange is the maximum number of blocks requested in one eth_getLogs call
+	maxLogBlockRange = 1000
+
+	// maxERC20RescanBlocks is the maximum number of blocks ERC20Scanner.Rescan rescans at once
+	maxERC20RescanBlocks = maxLogBlockRange * 100
+)
+
+// ERC20Token is a token contract scanned by ERC20Scanner
+type ERC20Token struct {
+	Symbol   string // coin type of the token deposits
+	Contract string // contract address, 0x prefixed hex
+	Decimals int    // decimal places of the token amount
+}
+
+// ERC20Storer interface for ERC20 scanner meta info storage
+type ERC20Storer interface {
+	GetScanAddresses() ([]string, error)
+	AddScanAddress(string) error
+	SetDepositProcessed(string) error
+	GetUnprocessedDeposits() ([]Deposit, error)
+	SaveDeposits([]Deposit) ([]Deposit, error)
+	SaveDepositsCheckpoint([]Deposit, Checkpoint) ([]Deposit, error)
+	GetCheckpoint() (*Checkpoint, error)
+}
+
+// ERC20Scanner scans the Transfer logs of ERC20 token contracts for transfers to deposit addresses.
+// All tokens share the scan addresses. The coin type of a deposit is the symbol of its token,
+// and its Value is the token amount in units of 1e-8 tokens.
+type ERC20Scanner struct {
+	bestHeight
+	log       logrus.FieldLogger
+	cfg       Config
+	ethClient EthRPCClient
+	store     ERC20Storer
+	tokens    map[string]ERC20Token // by lowercase contract address
+	contracts []string
+	// Deposit value channel, exposed by public API, intended for public consumption
+	depositC chan DepositNote
+	// Internal deposit value channel
+	scannedDeposits chan Deposit
+	rescan          rescanner
+	quit            chan struct{}
+	done            chan struct{}
+}
+
+// NewERC20Scanner creates an ERC20Scanner for the tokens
+func NewERC20Scanner(log logrus.FieldLogger, store ERC20Storer, eth EthRPCClient, tokens []ERC20Token, cfg Config) (*ERC20Scanner, error) {
+	if len(tokens) == 0 {
+		return nil, errors.New("No ERC20 tokens")
+	}
+
+	if cfg.ScanPeriod == 0 {
+		cfg.ScanPeriod = blockScanPeriod
+	}
+
+	if cfg.DepositBufferSize == 0 {
+		cfg.DepositBufferSize = depositBufferSize
+	}
+
+	tokenMap := make(map[string]ERC20Token, len(tokens))
+	var contracts []string
+	for _, t := range tokens {
+		contract := strings.ToLower(t.Contract)
+		if _, ok := tokenMap[contract]; ok {
+			return nil, fmt.Errorf("Duplicate ERC20 token contract %s", t.Contract)
+		}
+		if t.Decimals < 0 {
+			return nil, fmt.Errorf("ERC20 token %s decimals can't be negative", t.Symbol)
+		}
+
+		tokenMap[contract] = t
+		contracts = append(contracts, contract)
+	}
+
+	return &ERC20Scanner{
+		log:             log.WithField("prefix", "scanner.erc20"),
+		cfg:             cfg,
+		ethClient:       eth,
+		store:           store,
+		tokens:          tokenMap,
+		contracts:       contracts,
+		depositC:        make(chan DepositNote),
+		scannedDeposits: make(chan Deposit, cfg.DepositBufferSize),
+		quit:            make(chan struct{}),
+		done:            make(chan struct{}),
+	}, nil
+}
+
+// Run starts the scanner
+func (s *ERC20Scanner) Run() error {
+	log := s.log.WithField("config", s.cfg)
+	log.Info("Start ERC20 token scan service")
+	defer func() {
+		log.Info("ERC20 token scan service closed")
+		close(s.done)
+	}()
+
+	var wg sync.WaitGroup
+
+	// This loop sends each scanned deposit to depositC, which is processed by Exchange.
+	log.Info("Launching deposit pipe goroutine")
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer logger.LogPanic(log)
+		defer log.Info("Deposit pipe goroutine exited")
+		for {
+			select {
+			case <-s.quit:
+				return
+			case dv := <-s.scannedDeposits:
+				if err := s.processDeposit(dv); err != nil {
+					if err == errQuit {
+						return
+					}
+
+					msg := "processDeposit failed. This deposit will be reprocessed the next time the scanner is run."
+					s.log.WithField("deposit", dv).WithError(err).Error(msg)
+				}
+			}
+		}
+	}()
+
+	log.Info("Loading unprocessed deposits")
+	if err := s.loadUnprocessedDeposits(); err != nil && err != errQuit {
+		log.WithError(err).Error("loadUnprocessedDeposits failed")
+		close(s.quit)
+		wg.Wait()
+		return err
+	}
+
+	// Resume after the checkpoint, if it is at or above the initial scan height
+	height := s.cfg.InitialScanHeight
+	cp, err := s.store.GetCheckpoint()
+	if err != nil {
+		log.WithError(err).Error("store.GetCheckpoint failed")
+		close(s.quit)
+		wg.Wait()
+		return err
+	}
+	if cp != nil && cp.Height >= height {
+		height = cp.Height + 1
+		log.WithField("checkpointHeight", cp.Height).Info("Resuming from the checkpoint")
+	}
+
+	// This loop scans the blocks with enough confirmations every ScanPeriod
+	log.Info("Launching scan goroutine")
+	wg.Add(1)
+	go func(height int64) {
+		defer wg.Done()
+		defer logger.LogPanic(log)
+		defer log.Info("Scan goroutine exited")
+
+		deposits := 0
+		for {
+			last, n, err := s.scanNext(height)
+			switch {
+			case err == errQuit:
+				return
+			case err != nil:
+				log.WithError(err).WithField("height", height).Error("Scan blocks failed")
+			case last >= height:
+				deposits += n
+				log.WithFields(logrus.Fields{
+					"fromHeight":           height,
+					"toHeight":             last,
+					"scannedDeposits":      n,
+					"totalScannedDeposits": deposits,
+				}).Infof("Scanned %d deposits from blocks", n)
+
+				// Scan the next blocks right away, in case of a backlog
+				height = last + 1
+				continue
+			}
+
+			select {
+			case <-s.quit:
+				return
+			case <-time.After(s.cfg.ScanPeriod):
+			}
+		}
+	}(height)
+
+	wg.Wait()
+
+	return nil
+}
+
+// scanNext scans the blocks from height up to maxLogBlockRange blocks with enough confirmations.
+// Returns the last scanned height, which is height-1 if no block has enough confirmations yet,
+// and the number of deposits found.
+func (s *ERC20Scanner) scanNext(height int64) (int64, int, error) {
+	best, err := s.ethClient.BlockNumber()
+	if err != nil {
+		s.log.WithError(err).Error("ethClient.BlockNumber failed")
+		return 0, 0, err
+	}
+
+	s.setBestHeight(best)
+
+	to := best - s.cfg.ConfirmationsRequired
+	if to < height {
+		return height - 1, 0, nil
+	}
+
+	if to-height >= maxLogBlockRange {
+		to = height + maxLogBlockRange - 1
+	}
+
+	n, err := s.scanBlocks(height, to)
+	if err != nil {
+		return 0, n, err
+	}
+
+	return to, n, nil
+}
+
+// scanBlocks saves the deposits found in the Transfer logs of the blocks from height to toHeight,
+// with toHeight as the checkpoint, and sends them to the deposit pipe
+func (s *ERC20Scanner) scanBlocks(height, toHeight int64) (int, error) {
+	log := s.log.WithFields(logrus.Fields{
+		"fromHeight": height,
+		"toHeight":   toHeight,
+	})
+
+	dvs, err := s.getDeposits(height, toHeight)
+	if err != nil {
+		return 0, err
+	}
+
+	saved, err := s.store.SaveDepositsCheckpoint(dvs, Checkpoint{Height: toHeight})
+	if err != nil {
+		log.WithError(err).Error("store.SaveDepositsCheckpoint failed")
+		return 0, err
+	}
+
+	return s.sendDeposits(saved)
+}
+
+// rescanBlocks saves the deposits found in the Transfer logs of the blocks from height to toHeight
+// like scanBlocks, without changing the checkpoint
+func (s *ERC20Scanner) rescanBlocks(height, toHeight int64) (int, error) {
+	dvs, err := s.getDeposits(height, toHeight)
+	if err != nil {
+		return 0, err
+	}
+
+	saved, err := s.store.SaveDeposits(dvs)
+	if err != nil {
+		s.log.WithError(err).Error("store.SaveDeposits failed")
+		return 0, err
+	}
+
+	return s.sendDeposits(saved)
+}
+
+// getDeposits returns the deposits in the Transfer logs of the blocks from height to toHeight.
+// The deposits are not filtered by scan address.
+func (s *ERC20Scanner) getDeposits(height, toHeight int64) ([]Deposit, error) {
+	log := s.log.WithFields(logrus.Fields{
+		"fromHeight": height,
+		"toHeight":   toHeight,
+	})
+
+	logs, err := s.ethClient.GetTransferLogs(height, toHeight, s.contracts)
+	if err != nil {
+		log.WithError(err).Error("ethClient.GetTransferLogs failed")
+		return nil, err
+	}
+
+	var dvs []Deposit
+	for _, l := range logs {
+		dv, err := s.parseTransferLog(l)
+		if err != nil {
+			log.WithError(err).WithField("log", l).Error("Invalid Transfer log, skipping it")
+			continue
+		}
+
+		if dv != nil {
+			dvs = append(dvs, *dv)
+		}
+	}
+
+	return dvs, nil
+}
+
+// sendDeposits sends saved deposits to the deposit pipe
+func (s *ERC20Scanner) sendDeposits(dvs []Deposit) (int, error) {
+	n := 0
+	for _, dv := range dvs {
+		select {
+		case s.scannedDeposits <- dv:
+			n++
+		case <-s.quit:
+			return n, errQuit
+		}
+	}
+
+	return n, nil
+}
+
+// parseTransferLog converts a Transfer log to a Deposit to the recipient address.
+// Returns nil if the log does not transfer any token of a scanned contract.
+func (s *ERC20Scanner) parseTransferLog(l EthLog) (*Deposit, error) {
+	if l.Removed {
+		return nil, nil
+	}
+
+	token, ok := s.tokens[strings.ToLower(l.Address)]
+	if !ok {
+		return nil, nil
+	}
+
+	// Transfer(address indexed from, address indexed to, uint256 value).
+	// ERC721 Transfer logs have the same signature but 4 topics.
+	if len(l.Topics) != 3 || strings.ToLower(l.Topics[0]) != transferEventTopic {
+		return nil, nil
+	}
+
+	to := l.Topics[2]
+	if len(to) != 66 {
+		return nil, fmt.Errorf("invalid recipient topic %q", to)
+	}
+	to = "0x" + strings.ToLower(to[26:])
+
+	amount, ok := new(big.Int).SetString(strings.TrimPrefix(l.Data, "0x"), 16)
+	if !ok {
+		return nil, fmt.Errorf("invalid amount %q", l.Data)
+	}
+
+	value, err := TokenAmountToValue(amount, token.Decimals)
+	if err != nil {
+		return nil, err
+	}
+
+	// Amounts smaller than the precision of Value can't be exchanged
+	if value == 0 {
+		return nil, nil
+	}
+
+	height, err := parseHexInt64(l.BlockNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	logIndex, err := parseHexInt64(l.LogIndex)
+	if err != nil {
+		return nil, err
+	}
+	if logIndex < 0 || logIndex > int64(^uint32(0)) {
+		return nil, fmt.Errorf("invalid log index %d", logIndex)
+	}
+
+	return &Deposit{
+		CoinType: token.Symbol,
+		Address:  to,
+		Value:    value,
+		Height:   height,
+		Tx:       strings.ToLower(l.TransactionHash),
+		N:        uint32(logIndex),
+	}, nil
+}
+
+// TokenAmountToValue converts a token amount with decimals decimal places
+// to a Deposit Value, in units of 1e-8 tokens. Extra decimal places are truncated.
+func TokenAmountToValue(amount *big.Int, decimals int) (int64, error) {
+	if amount.Sign() < 0 {
+		return 0, errors.New("token amount is negative")
+	}
+
+	v := new(big.Int).Set(amount)
+	if decimals > erc20ValueDecimals {
+		v.Quo(v, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals-erc20ValueDecimals)), nil))
+	} else if decimals < erc20ValueDecimals {
+		v.Mul(v, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(erc20ValueDecimals-decimals)), nil))
+	}
+
+	if !v.IsInt64() {
+		return 0, fmt.Errorf("token amount %s is too large", amount)
+	}
+
+	return v.Int64(), nil
+}
+
+// Shutdown shutdown the scanner
+func (s *ERC20Scanner) Shutdown() {
+	s.log.Info("Closing ERC20 scanner")
+	close(s.quit)
+	s.log.Info("Waiting for ERC20 scanner to stop")
+	<-s.done
+	s.rescan.wait()
+	close(s.depositC)
+	s.log.Info("ERC20 scanner stopped")
+}
+
+// loadUnprocessedDeposits loads unprocessed Deposits into the scannedDeposits
+// channel. This is called during initialization, to resume processing.
+func (s *ERC20Scanner) loadUnprocessedDeposits() error {
+	dvs, err := s.store.GetUnprocessedDeposits()
+	if err != nil {
+		s.log.WithError(err).Error("GetUnprocessedDeposits failed")
+		return err
+	}
+
+	s.log.WithField("depositsLen", len(dvs)).Info("Loaded unprocessed deposit values")
+
+	for _, dv := range dvs {
+		select {
+		case <-s.quit:
+			return errQuit
+		case s.scannedDeposits <- dv:
+		}
+	}
+
+	return nil
+}
+
+// processDeposit sends a deposit to depositC and marks it as processed if the exchange
+// reports no error. See BTCScanner.processDeposit.
+func (s *ERC20Scanner) processDeposit(dv Deposit) error {
+	log := s.log.WithField("deposit", dv)
+	log.Info("Sending deposit to depositC")
+
+	dn := NewDepositNote(dv)
+
+	select {
+	case <-s.quit:
+		return errQuit
+	case s.depositC <- dn:
+	}
+
+	select {
+	case <-s.quit:
+		return errQuit
+	case err, ok := <-dn.ErrC:
+		if !ok {
+			log.Warn("DepositNote.ErrC unexpectedly closed")
+			return nil
+		}
+
+		if err != nil {
+			log.WithError(err).Error("DepositNote.ErrC error")
+			return err
+		}
+
+		if err := s.store.SetDepositProcessed(dv.ID()); err != nil {
+			log.WithError(err).Error("SetDepositProcessed error")
+			return err
+		}
+
+		log.Info("Deposit is processed")
+	}
+
+	return nil
+}
+
+// Rescan rescans the blocks from height from to height to in the background, for transfers of all
+// scanned tokens to the current scan addresses. Deposits that were already saved are skipped, and the
+// checkpoint does not change. The blocks must have enough confirmations. Returns InvalidRescanRangeErr
+// for an invalid range, or ErrRescanInProgress if a rescan is running. The progress is in RescanStatus.
+func (s *ERC20Scanner) Rescan(from, to int64) error {
+	best, err := s.ethClient.BlockNumber()
+	if err != nil {
+		s.log.WithError(err).Error("ethClient.BlockNumber failed")
+		return err
+	}
+
+	if err := checkRescanRange(from, to, best-s.cfg.ConfirmationsRequired, maxERC20RescanBlocks); err != nil {
+		return err
+	}
+
+	return s.rescan.start(s.log, s.quit, from, to, maxLogBlockRange, s.rescanBlocks)
+}
+
+// RescanStatus returns the progress of the last rescan, or nil if there was no rescan since the scanner started
+func (s *ERC20Scanner) RescanStatus() *RescanStatus {
+	return s.rescan.getStatus()
+}
+
+// AddScanAddress adds new scan address. coinType must be the symbol of a scanned token.
+func (s *ERC20Scanner) AddScanAddress(addr, coinType string) error {
+	found := false
+	for _, t := range s.tokens {
+		if t.Symbol == coinType {
+			found = true
+			break
+		}
+	}
+
+	if !found {
+		return ErrUnsupportedCoinType
+	}
+
+	return s.store.AddScanAddress(strings.ToLower(addr))
+}
+
+// GetScanAddresses returns the deposit addresses that need to scan
+func (s *ERC20Scanner) GetScanAddresses() ([]string, error) {
+	return s.store.GetScanAddresses()
+}
+
+// GetDeposit returns deposit value channel.
+func (s *ERC20Scanner) GetDeposit() <-chan DepositNote {
+	return s.depositC
+}
@@ -0,0 +1,361 @@
+package scanner
+
+import (
+	"errors"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/util/dbutil"
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+const (
+	testTokenContract = "0x0d8775f648430679a709e98d2b0cb6250d2887ef"
+	testTokenAddr     = "0x5aaeb6053f3e94c9b9a09f33669435e7ef1beaed"
+)
+
+type dummyEthClient struct {
+	sync.Mutex
+	blockNumber      int64
+	blockNumberError error
+	logs             []EthLog
+	logsCalls        [][2]int64
+}
+
+func (c *dummyEthClient) BlockNumber() (int64, error) {
+	c.Lock()
+	defer c.Unlock()
+	return c.blockNumber, c.blockNumberError
+}
+
+func (c *dummyEthClient) GetTransferLogs(from, to int64, contracts []string) ([]EthLog, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.logsCalls = append(c.logsCalls, [2]int64{from, to})
+
+	var logs []EthLog
+	for _, l := range c.logs {
+		n, err := parseHexInt64(l.BlockNumber)
+		if err != nil {
+			return nil, err
+		}
+		if n >= from && n <= to {
+			logs = append(logs, l)
+		}
+	}
+
+	return logs, nil
+}
+
+func transferLog(to string, amount string, height, logIndex int64, tx string) EthLog {
+	return EthLog{
+		Address: testTokenContract,
+		Topics: []string{
+			transferEventTopic,
+			"0x000000000000000000000000fb6916095ca1df60bb79ce92ce3ea74c37c5d359",
+			"0x000000000000000000000000" + to[2:],
+		},
+		Data:            amount,
+		BlockNumber:     formatHexInt64(height),
+		TransactionHash: tx,
+		LogIndex:        formatHexInt64(logIndex),
+	}
+}
+
+func setupERC20Scanner(t *testing.T, eth *dummyEthClient) (*ERC20Scanner, *bolt.DB, func()) {
+	db, shutdown := testutil.PrepareDB(t)
+
+	log, _ := testutil.NewLogger(t)
+
+	store, err := NewERC20Store(log, db)
+	require.NoError(t, err)
+
+	scr, err := NewERC20Scanner(log, store, eth, []ERC20Token{
+		{
+			Symbol:   "BAT",
+			Contract: "0x0D8775F648430679A709E98d2b0Cb6250d2887EF",
+			Decimals: 18,
+		},
+	}, Config{
+		ScanPeriod:            time.Millisecond * 10,
+		DepositBufferSize:     1,
+		InitialScanHeight:     100,
+		ConfirmationsRequired: 2,
+	})
+	require.NoError(t, err)
+
+	return scr, db, shutdown
+}
+
+func TestTokenAmountToValue(t *testing.T) {
+	tt := []struct {
+		name     string
+		amount   string
+		decimals int
+		value    int64
+		err      error
+	}{
+		{"18 decimals", "1500000000000000000", 18, 150000000, nil},
+		{"18 decimals truncated", "1", 18, 0, nil},
+		{"8 decimals", "123", 8, 123, nil},
+		{"2 decimals", "150", 2, 150000000, nil},
+		{"0 decimals", "3", 0, 300000000, nil},
+		{"too large", "100000000000000000000000000000", 18, 0, errors.New("token amount 100000000000000000000000000000 is too large")},
+		{"negative", "-1", 18, 0, errors.New("token amount is negative")},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			amount, ok := new(big.Int).SetString(tc.amount, 10)
+			require.True(t, ok)
+
+			value, err := TokenAmountToValue(amount, tc.decimals)
+			require.Equal(t, tc.err, err)
+			require.Equal(t, tc.value, value)
+		})
+	}
+}
+
+func TestERC20ScannerParseTransferLog(t *testing.T) {
+	scr, _, shutdown := setupERC20Scanner(t, &dummyEthClient{})
+	defer shutdown()
+
+	l := transferLog(testTokenAddr, "0x14d1120d7b160000", 105, 3, "0xAB")
+
+	dv, err := scr.parseTransferLog(l)
+	require.NoError(t, err)
+	require.Equal(t, &Deposit{
+		CoinType: "BAT",
+		Address:  testTokenAddr,
+		Value:    150000000,
+		Height:   105,
+		Tx:       "0xab",
+		N:        3,
+	}, dv)
+
+	// Removed logs are skipped
+	removed := l
+	removed.Removed = true
+	dv, err = scr.parseTransferLog(removed)
+	require.NoError(t, err)
+	require.Nil(t, dv)
+
+	// Other contracts are skipped
+	other := l
+	other.Address = "0xfb6916095ca1df60bb79ce92ce3ea74c37c5d359"
+	dv, err = scr.parseTransferLog(other)
+	require.NoError(t, err)
+	require.Nil(t, dv)
+
+	// ERC721 transfers have the token ID as a 4th topic
+	erc721 := l
+	erc721.Topics = append(append([]string{}, l.Topics...), "0x01")
+	dv, err = scr.parseTransferLog(erc721)
+	require.NoError(t, err)
+	require.Nil(t, dv)
+
+	// Dust is skipped
+	dust := l
+	dust.Data = "0x01"
+	dv, err = scr.parseTransferLog(dust)
+	require.NoError(t, err)
+	require.Nil(t, dv)
+
+	// Malformed logs are errors
+	bad := l
+	bad.Data = "0xzz"
+	_, err = scr.parseTransferLog(bad)
+	require.Error(t, err)
+
+	bad = l
+	bad.Topics = []string{transferEventTopic, l.Topics[1], "0x01"}
+	_, err = scr.parseTransferLog(bad)
+	require.Error(t, err)
+}
+
+func TestERC20ScannerRun(t *testing.T) {
+	eth := &dummyEthClient{
+		blockNumber: 110,
+		logs: []EthLog{
+			transferLog(testTokenAddr, "0x14d1120d7b160000", 101, 0, "0x01"),
+			// Not a deposit address
+			transferLog("0xfb6916095ca1df60bb79ce92ce3ea74c37c5d359", "0x14d1120d7b160000", 102, 0, "0x02"),
+			transferLog(testTokenAddr, "0x0de0b6b3a7640000", 104, 5, "0x03"),
+			// Not enough confirmations
+			transferLog(testTokenAddr, "0x0de0b6b3a7640000", 109, 1, "0x04"),
+		},
+	}
+
+	scr, db, shutdown := setupERC20Scanner(t, eth)
+	defer shutdown()
+
+	require.Equal(t, ErrUnsupportedCoinType, scr.AddScanAddress(testTokenAddr, CoinTypeBTC))
+	require.NoError(t, scr.AddScanAddress("0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed", "BAT"))
+
+	done := make(chan struct{})
+	var dvs []DepositNote
+	go func() {
+		defer close(done)
+		for dv := range scr.GetDeposit() {
+			dvs = append(dvs, dv)
+			dv.ErrC <- nil
+		}
+	}()
+
+	time.AfterFunc(minShutdownWait, scr.Shutdown)
+
+	err := scr.Run()
+	require.NoError(t, err)
+	<-done
+
+	require.Len(t, dvs, 2)
+	require.Equal(t, "0x01:0", dvs[0].ID())
+	require.Equal(t, int64(150000000), dvs[0].Value)
+	require.Equal(t, "0x03:5", dvs[1].ID())
+	require.Equal(t, int64(100000000), dvs[1].Value)
+
+	err = db.View(func(tx *bolt.Tx) error {
+		for _, dv := range dvs {
+			var d Deposit
+			require.NoError(t, dbutil.GetBucketObject(tx, erc20DepositBkt, dv.ID(), &d))
+			require.True(t, d.Processed)
+			require.Equal(t, "BAT", d.CoinType)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	// The first scan covers the blocks with enough confirmations
+	eth.Lock()
+	require.Equal(t, [2]int64{100, 108}, eth.logsCalls[0])
+	eth.logsCalls = nil
+	eth.blockNumber = 112
+	eth.Unlock()
+
+	cp, err := scr.store.GetCheckpoint()
+	require.NoError(t, err)
+	require.Equal(t, &Checkpoint{Height: 108}, cp)
+
+	// A restarted scanner resumes after the checkpoint
+	var tokens []ERC20Token
+	for _, tk := range scr.tokens {
+		tokens = append(tokens, tk)
+	}
+	log, _ := testutil.NewLogger(t)
+	scr, err = NewERC20Scanner(log, scr.store, eth, tokens, scr.cfg)
+	require.NoError(t, err)
+
+	done = make(chan struct{})
+	dvs = nil
+	go func() {
+		defer close(done)
+		for dv := range scr.GetDeposit() {
+			dvs = append(dvs, dv)
+			dv.ErrC <- nil
+		}
+	}()
+
+	time.AfterFunc(minShutdownWait, scr.Shutdown)
+	require.NoError(t, scr.Run())
+	<-done
+
+	// The deposit in block 109 now has enough confirmations
+	require.Len(t, dvs, 1)
+	require.Equal(t, "0x04:1", dvs[0].ID())
+
+	eth.Lock()
+	defer eth.Unlock()
+	require.Equal(t, [2]int64{109, 110}, eth.logsCalls[0])
+}
+
+func TestERC20ScannerRescan(t *testing.T) {
+	eth := &dummyEthClient{
+		blockNumber: 110,
+		logs: []EthLog{
+			transferLog(testTokenAddr, "0x14d1120d7b160000", 101, 0, "0x01"),
+			transferLog(testTokenAddr, "0x0de0b6b3a7640000", 104, 5, "0x03"),
+		},
+	}
+
+	scr, _, shutdown := setupERC20Scanner(t, eth)
+	defer shutdown()
+
+	// Scan the blocks before the address is added
+	time.AfterFunc(minShutdownWait, scr.Shutdown)
+	require.NoError(t, scr.Run())
+
+	var tokens []ERC20Token
+	for _, tk := range scr.tokens {
+		tokens = append(tokens, tk)
+	}
+	log, _ := testutil.NewLogger(t)
+	scr, err := NewERC20Scanner(log, scr.store, eth, tokens, scr.cfg)
+	require.NoError(t, err)
+
+	require.NoError(t, scr.AddScanAddress(testTokenAddr, "BAT"))
+
+	// Block 109 does not have enough confirmations
+	_, ok := scr.Rescan(100, 109).(InvalidRescanRangeErr)
+	require.True(t, ok)
+
+	done := make(chan struct{})
+	var dvs []DepositNote
+	go func() {
+		defer close(done)
+		for dv := range scr.GetDeposit() {
+			dvs = append(dvs, dv)
+			dv.ErrC <- nil
+		}
+	}()
+
+	rescanErrC := make(chan error, 1)
+	time.AfterFunc(time.Millisecond*100, func() {
+		rescanErrC <- scr.Rescan(100, 108)
+	})
+
+	time.AfterFunc(minShutdownWait, scr.Shutdown)
+	require.NoError(t, scr.Run())
+	<-done
+	require.NoError(t, <-rescanErrC)
+
+	require.Len(t, dvs, 2)
+	require.Equal(t, "0x01:0", dvs[0].ID())
+	require.Equal(t, "0x03:5", dvs[1].ID())
+
+	st := scr.RescanStatus()
+	require.NotNil(t, st)
+	require.Equal(t, int64(108), st.Height)
+	require.Equal(t, 2, st.Deposits)
+	require.Empty(t, st.Error)
+}
+
+func TestERC20ScannerScanNextRange(t *testing.T) {
+	eth := &dummyEthClient{
+		blockNumber: 5000,
+	}
+
+	scr, _, shutdown := setupERC20Scanner(t, eth)
+	defer shutdown()
+
+	// The range is capped to maxLogBlockRange
+	last, n, err := scr.scanNext(100)
+	require.NoError(t, err)
+	require.Equal(t, 0, n)
+	require.Equal(t, int64(100+maxLogBlockRange-1), last)
+
+	// No block has enough confirmations yet
+	last, n, err = scr.scanNext(4999)
+	require.NoError(t, err)
+	require.Equal(t, 0, n)
+	require.Equal(t, int64(4998), last)
+
+	eth.blockNumberError = errors.New("connection refused")
+	_, _, err = scr.scanNext(4999)
+	require.Equal(t, eth.blockNumberError, err)
+}
@@ -0,0 +1,147 @@
+package scanner
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// transferEventTopic is the keccak256 hash of the ERC20 event signature Transfer(address,address,uint256)
+const transferEventTopic = "0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"
+
+// EthRPCClient is the ethereum node RPC interface used by ERC20Scanner
+type EthRPCClient interface {
+	BlockNumber() (int64, error)
+	GetTransferLogs(fromBlock, toBlock int64, contracts []string) ([]EthLog, error)
+}
+
+// EthLog is a log entry returned by eth_getLogs
+type EthLog struct {
+	Address         string   `json:"address"`
+	Topics          []string `json:"topics"`
+	Data            string   `json:"data"`
+	BlockNumber     string   `json:"blockNumber"`
+	TransactionHash string   `json:"transactionHash"`
+	LogIndex        string   `json:"logIndex"`
+	Removed         bool     `json:"removed"`
+}
+
+// EthRPCError is an error returned by the ethereum node
+type EthRPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e EthRPCError) Error() string {
+	return fmt.Sprintf("eth rpc error %d: %s", e.Code, e.Message)
+}
+
+// EthClient is an EthRPCClient using JSON-RPC over HTTP, for geth, parity or similar nodes
+type EthClient struct {
+	url        string
+	httpClient *http.Client
+	id         uint64
+}
+
+// NewEthClient creates an EthClient for the node RPC endpoint at url
+func NewEthClient(url string) *EthClient {
+	return &EthClient{
+		url: url,
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+type ethRequest struct {
+	JSONRPC string        `json:"jsonrpc"`
+	ID      uint64        `json:"id"`
+	Method  string        `json:"method"`
+	Params  []interface{} `json:"params"`
+}
+
+type ethResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *EthRPCError    `json:"error"`
+}
+
+func (c *EthClient) call(method string, params []interface{}, result interface{}) error {
+	if params == nil {
+		params = []interface{}{}
+	}
+
+	b, err := json.Marshal(ethRequest{
+		JSONRPC: "2.0",
+		ID:      atomic.AddUint64(&c.id, 1),
+		Method:  method,
+		Params:  params,
+	})
+	if err != nil {
+		return err
+	}
+
+	rsp, err := c.httpClient.Post(c.url, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: eth rpc returned status %d", method, rsp.StatusCode)
+	}
+
+	var r ethResponse
+	if err := json.NewDecoder(rsp.Body).Decode(&r); err != nil {
+		return fmt.Errorf("%s: decode eth rpc response failed: %v", method, err)
+	}
+
+	if r.Error != nil {
+		return *r.Error
+	}
+
+	return json.Unmarshal(r.Result, result)
+}
+
+// BlockNumber returns the number of the most recent block
+func (c *EthClient) BlockNumber() (int64, error) {
+	var n string
+	if err := c.call("eth_blockNumber", nil, &n); err != nil {
+		return 0, err
+	}
+
+	return parseHexInt64(n)
+}
+
+// GetTransferLogs returns the Transfer logs of the contracts between fromBlock and toBlock, inclusive
+func (c *EthClient) GetTransferLogs(fromBlock, toBlock int64, contracts []string) ([]EthLog, error) {
+	var logs []EthLog
+	if err := c.call("eth_getLogs", []interface{}{
+		map[string]interface{}{
+			"fromBlock": formatHexInt64(fromBlock),
+			"toBlock":   formatHexInt64(toBlock),
+			"address":   contracts,
+			"topics":    []string{transferEventTopic},
+		},
+	}, &logs); err != nil {
+		return nil, err
+	}
+
+	return logs, nil
+}
+
+func parseHexInt64(s string) (int64, error) {
+	if !strings.HasPrefix(s, "0x") {
+		return 0, fmt.Errorf("invalid hex number %q", s)
+	}
+
+	return strconv.ParseInt(s[2:], 16, 64)
+}
+
+func formatHexInt64(n int64) string {
+	return "0x" + strconv.FormatInt(n, 16)
+}
@@ -0,0 +1,65 @@
+package scanner
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEthClient(t *testing.T) {
+	var reqs []ethRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ethRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		reqs = append(reqs, req)
+
+		switch req.Method {
+		case "eth_blockNumber":
+			w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x4b7"}`)) // nolint: errcheck
+		case "eth_getLogs":
+			w.Write([]byte(`{"jsonrpc":"2.0","id":2,"result":[{"address":"0xabc","topics":["0x1"],"data":"0x10","blockNumber":"0x10","transactionHash":"0xdef","logIndex":"0x2","removed":false}]}`)) // nolint: errcheck
+		default:
+			w.Write([]byte(`{"jsonrpc":"2.0","id":3,"error":{"code":-32601,"message":"method not found"}}`)) // nolint: errcheck
+		}
+	}))
+	defer srv.Close()
+
+	c := NewEthClient(srv.URL)
+
+	n, err := c.BlockNumber()
+	require.NoError(t, err)
+	require.Equal(t, int64(1207), n)
+
+	logs, err := c.GetTransferLogs(16, 32, []string{"0xabc"})
+	require.NoError(t, err)
+	require.Equal(t, []EthLog{
+		{
+			Address:         "0xabc",
+			Topics:          []string{"0x1"},
+			Data:            "0x10",
+			BlockNumber:     "0x10",
+			TransactionHash: "0xdef",
+			LogIndex:        "0x2",
+		},
+	}, logs)
+
+	require.Len(t, reqs, 2)
+	require.Equal(t, "2.0", reqs[1].JSONRPC)
+	require.Equal(t, []interface{}{
+		map[string]interface{}{
+			"fromBlock": "0x10",
+			"toBlock":   "0x20",
+			"address":   []interface{}{"0xabc"},
+			"topics":    []interface{}{transferEventTopic},
+		},
+	}, reqs[1].Params)
+
+	err = c.call("eth_unknown", nil, nil)
+	require.Equal(t, EthRPCError{
+		Code:    -32601,
+		Message: "method not found",
+	}, err)
+}
@@ -0,0 +1,416 @@
+package scanner
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/rpcclient"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	nodeHealthCheckPeriod = time.Second * 30
+
+	// crossCheckDepth is how many blocks below the lowest node height the block hashes of the nodes are compared.
+	// Comparing below the tip avoids flagging nodes that haven't received the latest block yet.
+	crossCheckDepth = 6
+
+	// maxNodeLag is how many blocks a node can be behind the best node before it is considered unhealthy
+	maxNodeLag = 6
+)
+
+// ErrNoHealthyNodes is returned by FailoverBtcRPCClient if no node can be called
+var ErrNoHealthyNodes = errors.New("No healthy BTC nodes")
+
+// FailoverNode is a node of a FailoverBtcRPCClient
+type FailoverNode struct {
+	// Name of the node in logs and statuses, e.g. its address
+	Name   string
+	Client BtcRPCClient
+}
+
+// NodeStatus is the health of a FailoverBtcRPCClient node
+type NodeStatus struct {
+	Name    string `json:"name"`
+	Active  bool   `json:"active"`
+	Healthy bool   `json:"healthy"`
+	// WrongChain is set if the node's block hash differed from the other nodes in the last health check
+	WrongChain bool   `json:"wrong_chain"`
+	Height     int64  `json:"height"`
+	Error      string `json:"error,omitempty"`
+	CheckedAt  int64  `json:"checked_at"`
+}
+
+type failoverNode struct {
+	FailoverNode
+	err        error
+	wrongChain bool
+	height     int64
+	checkedAt  time.Time
+}
+
+func (n *failoverNode) healthy() bool {
+	return n.err == nil && !n.wrongChain
+}
+
+// FailoverBtcRPCClient is a BtcRPCClient that calls one of several nodes, the active node.
+// Calls that fail with a connection error are retried on the other nodes, and the active node fails over
+// to the first healthy node. RPC errors returned by the node are not retried.
+// Run health checks the nodes periodically, and cross-checks their block hashes to exclude a node on a wrong chain.
+// The first node is preferred, and becomes active again once it is healthy.
+type FailoverBtcRPCClient struct {
+	sync.RWMutex
+	log         logrus.FieldLogger
+	nodes       []*failoverNode
+	active      int
+	checkPeriod time.Duration
+	quit        chan struct{}
+}
+
+// NewFailoverBtcRPCClient creates a FailoverBtcRPCClient. The nodes are preferred in order.
+// If checkPeriod is 0, the nodes are checked every 30 seconds.
+func NewFailoverBtcRPCClient(log logrus.FieldLogger, nodes []FailoverNode, checkPeriod time.Duration) (*FailoverBtcRPCClient, error) {
+	if len(nodes) == 0 {
+		return nil, errors.New("No BTC nodes")
+	}
+
+	if checkPeriod == 0 {
+		checkPeriod = nodeHealthCheckPeriod
+	}
+
+	fns := make([]*failoverNode, len(nodes))
+	for i, n := range nodes {
+		fns[i] = &failoverNode{
+			FailoverNode: n,
+		}
+	}
+
+	return &FailoverBtcRPCClient{
+		log:         log.WithField("prefix", "scanner.failover"),
+		nodes:       fns,
+		checkPeriod: checkPeriod,
+		quit:        make(chan struct{}),
+	}, nil
+}
+
+// Run health checks the nodes until Shutdown is called
+func (c *FailoverBtcRPCClient) Run() error {
+	c.log.WithField("nodes", len(c.nodes)).Info("Start BTC node health checks")
+	defer c.log.Info("BTC node health checks closed")
+
+	t := time.NewTicker(c.checkPeriod)
+	defer t.Stop()
+
+	for {
+		c.checkNodes()
+
+		select {
+		case <-c.quit:
+			return nil
+		case <-t.C:
+		}
+	}
+}
+
+// Shutdown stops the health checks and shuts down the node clients
+func (c *FailoverBtcRPCClient) Shutdown() {
+	close(c.quit)
+	for _, n := range c.nodes {
+		n.Client.Shutdown()
+	}
+}
+
+// GetBlockVerboseTx calls GetBlockVerboseTx on the active node, failing over on connection errors
+func (c *FailoverBtcRPCClient) GetBlockVerboseTx(hash *chainhash.Hash) (*btcjson.GetBlockVerboseResult, error) {
+	var block *btcjson.GetBlockVerboseResult
+	err := c.call(func(bc BtcRPCClient) error {
+		var err error
+		block, err = bc.GetBlockVerboseTx(hash)
+		return err
+	})
+	return block, err
+}
+
+// GetBlockHash calls GetBlockHash on the active node, failing over on connection errors
+func (c *FailoverBtcRPCClient) GetBlockHash(height int64) (*chainhash.Hash, error) {
+	var hash *chainhash.Hash
+	err := c.call(func(bc BtcRPCClient) error {
+		var err error
+		hash, err = bc.GetBlockHash(height)
+		return err
+	})
+	return hash, err
+}
+
+// GetBlockCount calls GetBlockCount on the active node, failing over on connection errors
+func (c *FailoverBtcRPCClient) GetBlockCount() (int64, error) {
+	var n int64
+	err := c.call(func(bc BtcRPCClient) error {
+		var err error
+		n, err = bc.GetBlockCount()
+		return err
+	})
+	return n, err
+}
+
+// NodeStatuses returns the health of the nodes, in order
+func (c *FailoverBtcRPCClient) NodeStatuses() []NodeStatus {
+	c.RLock()
+	defer c.RUnlock()
+
+	sts := make([]NodeStatus, len(c.nodes))
+	for i, n := range c.nodes {
+		sts[i] = NodeStatus{
+			Name:       n.Name,
+			Active:     i == c.active,
+			Healthy:    n.healthy(),
+			WrongChain: n.wrongChain,
+			Height:     n.height,
+		}
+		if n.err != nil {
+			sts[i].Error = n.err.Error()
+		}
+		if !n.checkedAt.IsZero() {
+			sts[i].CheckedAt = n.checkedAt.UTC().Unix()
+		}
+	}
+
+	return sts
+}
+
+// call calls f with the active node's client. If it fails with a connection error, the node is marked unhealthy
+// and f is retried with the other nodes, healthy nodes first. Nodes on a wrong chain are never called.
+func (c *FailoverBtcRPCClient) call(f func(BtcRPCClient) error) error {
+	tried := make(map[int]struct{}, len(c.nodes))
+	err := ErrNoHealthyNodes
+
+	for {
+		select {
+		case <-c.quit:
+			return rpcclient.ErrClientShutdown
+		default:
+		}
+
+		i, ok := c.nextNode(tried)
+		if !ok {
+			return err
+		}
+		tried[i] = struct{}{}
+
+		err = f(c.nodes[i].Client)
+		if !isFailoverError(err) {
+			return err
+		}
+
+		c.nodeFailed(i, err)
+	}
+}
+
+// nextNode returns the node to call after the nodes in tried: the active node, then the other healthy nodes,
+// then the nodes that failed, in order
+func (c *FailoverBtcRPCClient) nextNode(tried map[int]struct{}) (int, bool) {
+	c.RLock()
+	defer c.RUnlock()
+
+	if _, ok := tried[c.active]; !ok && !c.nodes[c.active].wrongChain {
+		return c.active, true
+	}
+
+	for _, healthy := range []bool{true, false} {
+		for i, n := range c.nodes {
+			if _, ok := tried[i]; ok || n.wrongChain || n.healthy() != healthy {
+				continue
+			}
+			return i, true
+		}
+	}
+
+	return 0, false
+}
+
+// nodeFailed marks node i unhealthy, and fails over if it is the active node
+func (c *FailoverBtcRPCClient) nodeFailed(i int, err error) {
+	c.Lock()
+	defer c.Unlock()
+
+	n := c.nodes[i]
+	if n.err == nil {
+		c.log.WithError(err).WithField("node", n.Name).Warning("BTC node call failed, marking it unhealthy")
+	}
+	n.err = err
+
+	if i == c.active {
+		c.failover()
+	}
+}
+
+// failover makes the first healthy node active. The active node stays unchanged if there is none.
+// Must be called with the lock held.
+func (c *FailoverBtcRPCClient) failover() {
+	for i, n := range c.nodes {
+		if !n.healthy() {
+			continue
+		}
+
+		if i != c.active {
+			c.log.WithFields(logrus.Fields{
+				"from": c.nodes[c.active].Name,
+				"to":   n.Name,
+			}).Warning("Switching active BTC node")
+			c.active = i
+		}
+		return
+	}
+
+	c.log.WithField("node", c.nodes[c.active].Name).Error("No healthy BTC node to switch to")
+}
+
+// nodeCheck is the result of a node health check
+type nodeCheck struct {
+	height int64
+	hash   string
+	err    error
+}
+
+// checkNodes checks the block count of every node, and compares their block hashes at a height they all have.
+// Nodes whose hash differs from most nodes are on a wrong chain. On a tie, the active node's chain wins.
+func (c *FailoverBtcRPCClient) checkNodes() {
+	checks := make([]nodeCheck, len(c.nodes))
+
+	c.eachNode(func(i int, n *failoverNode) {
+		checks[i].height, checks[i].err = n.Client.GetBlockCount()
+	})
+
+	var best int64
+	lowest := int64(-1)
+	for _, ch := range checks {
+		if ch.err != nil {
+			continue
+		}
+		if ch.height > best {
+			best = ch.height
+		}
+		if lowest == -1 || ch.height < lowest {
+			lowest = ch.height
+		}
+	}
+
+	for i := range checks {
+		if checks[i].err == nil && best-checks[i].height > maxNodeLag {
+			checks[i].err = fmt.Errorf("Node is %d blocks behind the best node", best-checks[i].height)
+		}
+	}
+
+	height := lowest - crossCheckDepth
+	if height < 0 {
+		height = 0
+	}
+
+	c.eachNode(func(i int, n *failoverNode) {
+		if checks[i].err != nil {
+			return
+		}
+		hash, err := n.Client.GetBlockHash(height)
+		if err != nil {
+			checks[i].err = err
+			return
+		}
+		checks[i].hash = hash.String()
+	})
+
+	c.Lock()
+	defer c.Unlock()
+
+	// Block hashes can only be cross-checked if at least 2 nodes responded.
+	// Otherwise nodes keep their wrong chain flag, so a node on a wrong chain isn't trusted once it is the only one left.
+	var responded int
+	for _, ch := range checks {
+		if ch.err == nil {
+			responded++
+		}
+	}
+	chainHash := c.chainHash(checks)
+
+	for i, n := range c.nodes {
+		ch := checks[i]
+		log := c.log.WithField("node", n.Name)
+
+		wasHealthy := n.healthy()
+		wasWrongChain := n.wrongChain
+		n.checkedAt = time.Now()
+		n.err = ch.err
+		if ch.err == nil {
+			n.height = ch.height
+			if responded > 1 {
+				n.wrongChain = ch.hash != chainHash
+			}
+		}
+
+		switch {
+		case n.wrongChain && !wasWrongChain:
+			log.WithFields(logrus.Fields{
+				"height":    height,
+				"hash":      ch.hash,
+				"chainHash": chainHash,
+			}).Error("BTC node block hash differs from the other nodes, the node is on a wrong chain")
+		case ch.err != nil && wasHealthy:
+			log.WithError(ch.err).Warning("BTC node health check failed")
+		case n.healthy() && !wasHealthy:
+			log.WithField("height", ch.height).Info("BTC node is healthy")
+		}
+	}
+
+	c.failover()
+}
+
+// chainHash returns the block hash of most nodes in checks, preferring the active node's hash on a tie.
+// Must be called with the lock held.
+func (c *FailoverBtcRPCClient) chainHash(checks []nodeCheck) string {
+	counts := make(map[string]int)
+	for _, ch := range checks {
+		if ch.err == nil {
+			counts[ch.hash]++
+		}
+	}
+
+	var hash string
+	if ch := checks[c.active]; ch.err == nil {
+		hash = ch.hash
+	}
+
+	// Nodes are iterated in order, so the first node's hash wins a tie if the active node has none
+	for _, ch := range checks {
+		if ch.err == nil && counts[ch.hash] > counts[hash] {
+			hash = ch.hash
+		}
+	}
+
+	return hash
+}
+
+// eachNode calls f for every node concurrently, and waits for the calls to return
+func (c *FailoverBtcRPCClient) eachNode(f func(i int, n *failoverNode)) {
+	var wg sync.WaitGroup
+	for i, n := range c.nodes {
+		wg.Add(1)
+		go func(i int, n *failoverNode) {
+			defer wg.Done()
+			f(i, n)
+		}(i, n)
+	}
+	wg.Wait()
+}
+
+// isFailoverError returns true if err is a connection error, that another node may not have.
+// Errors returned by the node itself and shutdown errors are not.
+func isFailoverError(err error) bool {
+	switch err.(type) {
+	case nil, *btcjson.RPCError:
+		return false
+	}
+	return err != rpcclient.ErrClientShutdown
+}
@@ -0,0 +1,300 @@
+package scanner
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/rpcclient"
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+// dummyNode is a BtcRPCClient of a node whose block hashes are derived from its chain name and the height
+type dummyNode struct {
+	sync.Mutex
+	chain    string
+	height   int64
+	err      error
+	calls    int
+	shutdown bool
+}
+
+func (n *dummyNode) set(f func(n *dummyNode)) {
+	n.Lock()
+	defer n.Unlock()
+	f(n)
+}
+
+func (n *dummyNode) getCalls() int {
+	n.Lock()
+	defer n.Unlock()
+	return n.calls
+}
+
+func (n *dummyNode) blockHash(height int64) *chainhash.Hash {
+	h := chainhash.DoubleHashH([]byte(fmt.Sprintf("%s:%d", n.chain, height)))
+	return &h
+}
+
+func (n *dummyNode) GetBlockVerboseTx(hash *chainhash.Hash) (*btcjson.GetBlockVerboseResult, error) {
+	n.Lock()
+	defer n.Unlock()
+	n.calls++
+	if n.err != nil {
+		return nil, n.err
+	}
+	return &btcjson.GetBlockVerboseResult{
+		Hash: hash.String(),
+	}, nil
+}
+
+func (n *dummyNode) GetBlockHash(height int64) (*chainhash.Hash, error) {
+	n.Lock()
+	defer n.Unlock()
+	n.calls++
+	if n.err != nil {
+		return nil, n.err
+	}
+	if height > n.height {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCOutOfRange,
+			Message: "Block number out of range",
+		}
+	}
+	return n.blockHash(height), nil
+}
+
+func (n *dummyNode) GetBlockCount() (int64, error) {
+	n.Lock()
+	defer n.Unlock()
+	n.calls++
+	if n.err != nil {
+		return 0, n.err
+	}
+	return n.height, nil
+}
+
+func (n *dummyNode) Shutdown() {
+	n.Lock()
+	defer n.Unlock()
+	n.shutdown = true
+}
+
+func newDummyNodes(t *testing.T, nodes ...*dummyNode) *FailoverBtcRPCClient {
+	log, _ := testutil.NewLogger(t)
+
+	fns := make([]FailoverNode, len(nodes))
+	for i, n := range nodes {
+		fns[i] = FailoverNode{
+			Name:   fmt.Sprintf("node%d", i),
+			Client: n,
+		}
+	}
+
+	c, err := NewFailoverBtcRPCClient(log, fns, 0)
+	require.NoError(t, err)
+	return c
+}
+
+func requireActiveNode(t *testing.T, c *FailoverBtcRPCClient, active int) {
+	for i, st := range c.NodeStatuses() {
+		require.Equal(t, i == active, st.Active, st.Name)
+	}
+}
+
+func TestFailoverBtcRPCClientFailover(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+	_, err := NewFailoverBtcRPCClient(log, nil, 0)
+	require.Error(t, err)
+
+	n0 := &dummyNode{chain: "main", height: 100}
+	n1 := &dummyNode{chain: "main", height: 100}
+	n2 := &dummyNode{chain: "main", height: 100}
+	c := newDummyNodes(t, n0, n1, n2)
+
+	// Calls go to the first node
+	h, err := c.GetBlockHash(50)
+	require.NoError(t, err)
+	require.Equal(t, n0.blockHash(50), h)
+	require.Equal(t, 1, n0.getCalls())
+	require.Equal(t, 0, n1.getCalls())
+
+	// RPC errors are returned without failing over
+	_, err = c.GetBlockHash(101)
+	require.IsType(t, &btcjson.RPCError{}, err)
+	require.Equal(t, 0, n1.getCalls())
+	requireActiveNode(t, c, 0)
+
+	// A connection error fails over to the next node
+	n0.set(func(n *dummyNode) {
+		n.err = errors.New("connection refused")
+	})
+
+	count, err := c.GetBlockCount()
+	require.NoError(t, err)
+	require.Equal(t, int64(100), count)
+	require.Equal(t, 1, n1.getCalls())
+	requireActiveNode(t, c, 1)
+
+	sts := c.NodeStatuses()
+	require.False(t, sts[0].Healthy)
+	require.Equal(t, "connection refused", sts[0].Error)
+	require.True(t, sts[1].Healthy)
+
+	// The active node is called directly
+	_, err = c.GetBlockVerboseTx(n0.blockHash(1))
+	require.NoError(t, err)
+	require.Equal(t, 3, n0.getCalls())
+	require.Equal(t, 2, n1.getCalls())
+
+	// If every node fails, the error of the last node tried is returned.
+	// Nodes that already failed are tried last.
+	for _, n := range []*dummyNode{n1, n2} {
+		n.set(func(n *dummyNode) {
+			n.err = errors.New("timeout")
+		})
+	}
+
+	_, err = c.GetBlockCount()
+	require.Equal(t, errors.New("connection refused"), err)
+	for _, st := range c.NodeStatuses() {
+		require.False(t, st.Healthy)
+	}
+
+	// Unhealthy nodes are still tried if no node is healthy
+	n2.set(func(n *dummyNode) {
+		n.err = nil
+	})
+
+	_, err = c.GetBlockCount()
+	require.NoError(t, err)
+	requireActiveNode(t, c, 2)
+
+	// The health check makes the first node active again once it recovers
+	n0.set(func(n *dummyNode) {
+		n.err = nil
+	})
+	c.checkNodes()
+	requireActiveNode(t, c, 0)
+
+	sts = c.NodeStatuses()
+	require.True(t, sts[0].Healthy)
+	require.False(t, sts[1].Healthy)
+	require.Equal(t, "timeout", sts[1].Error)
+	require.True(t, sts[2].Healthy)
+	require.Equal(t, int64(100), sts[2].Height)
+	require.NotZero(t, sts[2].CheckedAt)
+
+	// Calls stop after shutdown
+	c.Shutdown()
+	_, err = c.GetBlockCount()
+	require.Equal(t, rpcclient.ErrClientShutdown, err)
+	require.True(t, n0.shutdown)
+	require.True(t, n2.shutdown)
+}
+
+func TestFailoverBtcRPCClientCheckNodes(t *testing.T) {
+	n0 := &dummyNode{chain: "main", height: 100}
+	n1 := &dummyNode{chain: "main", height: 98}
+	n2 := &dummyNode{chain: "fork", height: 101}
+	c := newDummyNodes(t, n0, n1, n2)
+
+	c.checkNodes()
+
+	// The node on the minority chain is excluded
+	sts := c.NodeStatuses()
+	require.True(t, sts[0].Healthy)
+	require.True(t, sts[1].Healthy)
+	require.Equal(t, int64(98), sts[1].Height)
+	require.False(t, sts[2].Healthy)
+	require.True(t, sts[2].WrongChain)
+
+	// Nodes on a wrong chain are not called, even if the other nodes fail
+	n0.set(func(n *dummyNode) {
+		n.err = errors.New("connection refused")
+	})
+	n1.set(func(n *dummyNode) {
+		n.err = errors.New("connection refused")
+	})
+
+	calls := n2.getCalls()
+	_, err := c.GetBlockCount()
+	require.Equal(t, errors.New("connection refused"), err)
+	require.Equal(t, calls, n2.getCalls())
+
+	// Without another node to cross-check it with, the wrong chain node is still excluded
+	c.checkNodes()
+	require.True(t, c.NodeStatuses()[2].WrongChain)
+
+	calls = n2.getCalls()
+	_, err = c.GetBlockCount()
+	require.Equal(t, errors.New("connection refused"), err)
+	require.Equal(t, calls, n2.getCalls())
+
+	// A node that falls too far behind is unhealthy
+	n0.set(func(n *dummyNode) {
+		n.err = nil
+		n.chain = "main"
+		n.height = 100
+	})
+	n1.set(func(n *dummyNode) {
+		n.err = nil
+		n.height = 100 - maxNodeLag - 1
+	})
+	n2.set(func(n *dummyNode) {
+		n.chain = "main"
+	})
+
+	c.checkNodes()
+	sts = c.NodeStatuses()
+	require.True(t, sts[0].Healthy)
+	require.False(t, sts[1].Healthy)
+	require.Contains(t, sts[1].Error, "blocks behind the best node")
+	require.True(t, sts[2].Healthy)
+	require.False(t, sts[2].WrongChain)
+
+	// On a tie, the active node's chain wins
+	n1.set(func(n *dummyNode) {
+		n.height = 100
+		n.chain = "fork"
+	})
+	n2.set(func(n *dummyNode) {
+		n.err = errors.New("connection refused")
+	})
+
+	c.checkNodes()
+	sts = c.NodeStatuses()
+	require.True(t, sts[0].Healthy)
+	require.True(t, sts[0].Active)
+	require.True(t, sts[1].WrongChain)
+}
+
+func TestFailoverBtcRPCClientRun(t *testing.T) {
+	n0 := &dummyNode{chain: "main", height: 100}
+	n1 := &dummyNode{chain: "fork", height: 100}
+	n2 := &dummyNode{chain: "fork", height: 100}
+	c := newDummyNodes(t, n0, n1, n2)
+
+	done := make(chan error)
+	go func() {
+		done <- c.Run()
+	}()
+
+	// Run checks the nodes on start
+	for i := 0; i < 100 && !c.NodeStatuses()[0].WrongChain; i++ {
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	sts := c.NodeStatuses()
+	require.True(t, sts[0].WrongChain)
+	require.True(t, sts[1].Active)
+
+	c.Shutdown()
+	require.NoError(t, <-done)
+}
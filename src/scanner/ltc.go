@@ -0,0 +1,116 @@
+package scanner
+
+import (
+	"encoding/json"
+
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/rpcclient"
+)
+
+// LtcRPCClient is a BtcRPCClient for litecoind or ltcd.
+// It connects over HTTP POST, since litecoind has no websocket RPC.
+type LtcRPCClient struct {
+	*rpcclient.Client
+}
+
+// NewLtcRPCClient creates an LtcRPCClient
+func NewLtcRPCClient(host, user, pass string) (*LtcRPCClient, error) {
+	c, err := rpcclient.New(&rpcclient.ConnConfig{
+		Host:         host,
+		User:         user,
+		Pass:         pass,
+		HTTPPostMode: true,
+		DisableTLS:   true,
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LtcRPCClient{
+		Client: c,
+	}, nil
+}
+
+// GetBlockVerboseTx returns a block with its transactions in RawTx.
+// litecoind returns the transactions of `getblock <hash> 2` in "tx", so they are moved to RawTx.
+// ltcd does not accept verbosity 2 and is asked the btcd way instead.
+func (c *LtcRPCClient) GetBlockVerboseTx(hash *chainhash.Hash) (*btcjson.GetBlockVerboseResult, error) {
+	hashParam, err := json.Marshal(hash.String())
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.RawRequest("getblock", []json.RawMessage{hashParam, json.RawMessage("2")})
+	if err != nil {
+		if _, ok := err.(*btcjson.RPCError); ok {
+			return c.Client.GetBlockVerboseTx(hash)
+		}
+		return nil, err
+	}
+
+	return decodeLtcBlock(res)
+}
+
+// ltcBlockResult is the result of litecoind's `getblock <hash> 2`
+type ltcBlockResult struct {
+	btcjson.GetBlockVerboseResult
+	Tx []ltcTxResult `json:"tx"`
+}
+
+type ltcTxResult struct {
+	Txid string          `json:"txid"`
+	Hash string          `json:"hash"`
+	Vin  []btcjson.Vin   `json:"vin"`
+	Vout []ltcVoutResult `json:"vout"`
+}
+
+type ltcVoutResult struct {
+	Value        float64 `json:"value"`
+	N            uint32  `json:"n"`
+	ScriptPubKey struct {
+		Type string `json:"type"`
+		// Newer litecoind versions return a single address instead of addresses
+		Address   string   `json:"address"`
+		Addresses []string `json:"addresses"`
+	} `json:"scriptPubKey"`
+}
+
+func decodeLtcBlock(res json.RawMessage) (*btcjson.GetBlockVerboseResult, error) {
+	var b ltcBlockResult
+	if err := json.Unmarshal(res, &b); err != nil {
+		return nil, err
+	}
+
+	block := b.GetBlockVerboseResult
+	block.Tx = nil
+	block.RawTx = make([]btcjson.TxRawResult, len(b.Tx))
+
+	for i, tx := range b.Tx {
+		vouts := make([]btcjson.Vout, len(tx.Vout))
+		for j, v := range tx.Vout {
+			addrs := v.ScriptPubKey.Addresses
+			if len(addrs) == 0 && v.ScriptPubKey.Address != "" {
+				addrs = []string{v.ScriptPubKey.Address}
+			}
+
+			vouts[j] = btcjson.Vout{
+				Value: v.Value,
+				N:     v.N,
+				ScriptPubKey: btcjson.ScriptPubKeyResult{
+					Type:      v.ScriptPubKey.Type,
+					Addresses: addrs,
+				},
+			}
+		}
+
+		block.RawTx[i] = btcjson.TxRawResult{
+			Txid: tx.Txid,
+			Hash: tx.Hash,
+			Vin:  tx.Vin,
+			Vout: vouts,
+		}
+	}
+
+	return &block, nil
+}
@@ -0,0 +1,120 @@
+package scanner
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+// A litecoind `getblock <hash> 2` result, trimmed to the fields used
+var ltcBlockJSON = `{
+	"hash": "9c4e0d5ad5d5b1e4a3c1d9d3b3ea3fbd0a36c41c07d1b7b7b07db8b7a5e4e0a1",
+	"confirmations": 3,
+	"height": 1341005,
+	"previousblockhash": "4e0d5ad5d5b1e4a3c1d9d3b3ea3fbd0a36c41c07d1b7b7b07db8b7a5e4e0a19c",
+	"nextblockhash": "0d5ad5d5b1e4a3c1d9d3b3ea3fbd0a36c41c07d1b7b7b07db8b7a5e4e0a19c4e",
+	"tx": [
+		{
+			"txid": "f7e3a1a4a2f0b1d1c3e3b4c6e7e8f9a0b1c2d3e4f5a6b7c8d9e0f1a2b3c4d5e6",
+			"hash": "f7e3a1a4a2f0b1d1c3e3b4c6e7e8f9a0b1c2d3e4f5a6b7c8d9e0f1a2b3c4d5e6",
+			"vin": [
+				{
+					"txid": "a1b2c3d4e5f6a7b8c9d0e1f2a3b4c5d6e7f8a9b0c1d2e3f4a5b6c7d8e9f0a1b2",
+					"vout": 1
+				}
+			],
+			"vout": [
+				{
+					"value": 0.5,
+					"n": 0,
+					"scriptPubKey": {
+						"type": "pubkeyhash",
+						"addresses": ["Lf8ZayicoAH1K9oS3jyWafuLYpMPxqeotT"]
+					}
+				},
+				{
+					"value": 1.25,
+					"n": 1,
+					"scriptPubKey": {
+						"type": "scripthash",
+						"address": "M8nmihxeJkP9BYM1HPvwNdeBNMmdAQXPAR"
+					}
+				},
+				{
+					"value": 0,
+					"n": 2,
+					"scriptPubKey": {
+						"type": "nulldata"
+					}
+				}
+			]
+		}
+	]
+}`
+
+func TestDecodeLtcBlock(t *testing.T) {
+	block, err := decodeLtcBlock(json.RawMessage(ltcBlockJSON))
+	require.NoError(t, err)
+
+	require.Equal(t, int64(1341005), block.Height)
+	require.Equal(t, "0d5ad5d5b1e4a3c1d9d3b3ea3fbd0a36c41c07d1b7b7b07db8b7a5e4e0a19c4e", block.NextHash)
+	require.Empty(t, block.Tx)
+	require.Len(t, block.RawTx, 1)
+
+	tx := block.RawTx[0]
+	require.Equal(t, "f7e3a1a4a2f0b1d1c3e3b4c6e7e8f9a0b1c2d3e4f5a6b7c8d9e0f1a2b3c4d5e6", tx.Txid)
+	require.Len(t, tx.Vin, 1)
+	require.Equal(t, "a1b2c3d4e5f6a7b8c9d0e1f2a3b4c5d6e7f8a9b0c1d2e3f4a5b6c7d8e9f0a1b2", tx.Vin[0].Txid)
+	require.Equal(t, uint32(1), tx.Vin[0].Vout)
+	require.Len(t, tx.Vout, 3)
+	require.Equal(t, []string{"Lf8ZayicoAH1K9oS3jyWafuLYpMPxqeotT"}, tx.Vout[0].ScriptPubKey.Addresses)
+	require.Equal(t, []string{"M8nmihxeJkP9BYM1HPvwNdeBNMmdAQXPAR"}, tx.Vout[1].ScriptPubKey.Addresses)
+	require.Empty(t, tx.Vout[2].ScriptPubKey.Addresses)
+}
+
+func TestLTCStoreScanBlock(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	log, _ := testutil.NewLogger(t)
+
+	btcStore, err := NewStore(log, db)
+	require.NoError(t, err)
+	ltcStore, err := NewLTCStore(log, db)
+	require.NoError(t, err)
+
+	require.NoError(t, ltcStore.AddScanAddress("M8nmihxeJkP9BYM1HPvwNdeBNMmdAQXPAR"))
+
+	// Scan addresses are kept apart from BTC's
+	addrs, err := btcStore.GetScanAddresses()
+	require.NoError(t, err)
+	require.Empty(t, addrs)
+
+	block, err := decodeLtcBlock(json.RawMessage(ltcBlockJSON))
+	require.NoError(t, err)
+
+	dvs, err := ltcStore.ScanBlock(block)
+	require.NoError(t, err)
+	require.Equal(t, []Deposit{
+		{
+			CoinType: CoinTypeLTC,
+			Address:  "M8nmihxeJkP9BYM1HPvwNdeBNMmdAQXPAR",
+			Value:    125000000,
+			Height:   1341005,
+			Tx:       "f7e3a1a4a2f0b1d1c3e3b4c6e7e8f9a0b1c2d3e4f5a6b7c8d9e0f1a2b3c4d5e6",
+			N:        1,
+			Inputs:   []string{"a1b2c3d4e5f6a7b8c9d0e1f2a3b4c5d6e7f8a9b0c1d2e3f4a5b6c7d8e9f0a1b2:1"},
+		},
+	}, dvs)
+
+	dvs, err = ltcStore.GetUnprocessedDeposits()
+	require.NoError(t, err)
+	require.Len(t, dvs, 1)
+
+	dvs, err = btcStore.GetUnprocessedDeposits()
+	require.NoError(t, err)
+	require.Empty(t, dvs)
+}
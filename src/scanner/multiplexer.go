@@ -0,0 +1,195 @@
+package scanner
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/skycoin/teller/src/util/logger"
+)
+
+// Multiplexer combines the scanners of several coin types into one Scanner.
+// Scan addresses are routed to the scanner of their coin type, and the deposits
+// of all scanners are merged into one channel. A scanner can serve several coin types.
+type Multiplexer struct {
+	log        logrus.FieldLogger
+	scannerMap map[string]Scanner
+	scanners   []Scanner // unique scanners of scannerMap
+	outChan    chan DepositNote
+	quit       chan struct{}
+	done       chan struct{}
+	sync.RWMutex
+}
+
+// NewMultiplexer creates a Multiplexer
+func NewMultiplexer(log logrus.FieldLogger) *Multiplexer {
+	return &Multiplexer{
+		log:        log.WithField("prefix", "scanner.multiplexer"),
+		scannerMap: make(map[string]Scanner),
+		outChan:    make(chan DepositNote),
+		quit:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+}
+
+// AddScanner adds the scanner of a coin type. Must be called before Run.
+func (m *Multiplexer) AddScanner(scanner Scanner, coinType string) error {
+	if scanner == nil {
+		return fmt.Errorf("%s scanner is nil", coinType)
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	if _, ok := m.scannerMap[coinType]; ok {
+		return fmt.Errorf("%s scanner already exists", coinType)
+	}
+
+	m.scannerMap[coinType] = scanner
+
+	for _, scn := range m.scanners {
+		if scn == scanner {
+			return nil
+		}
+	}
+	m.scanners = append(m.scanners, scanner)
+
+	return nil
+}
+
+// GetScannerCount returns the number of coin types with a scanner
+func (m *Multiplexer) GetScannerCount() int {
+	m.RLock()
+	defer m.RUnlock()
+	return len(m.scannerMap)
+}
+
+// Run forwards the deposits of all scanners to GetDeposit, until Shutdown is called
+func (m *Multiplexer) Run() error {
+	m.log.Info("Start multiplex service")
+	defer func() {
+		m.log.Info("Multiplex service closed")
+		close(m.done)
+	}()
+
+	var wg sync.WaitGroup
+
+	m.RLock()
+	for i, scanner := range m.scanners {
+		wg.Add(1)
+		go func(i int, scanner Scanner) {
+			defer wg.Done()
+			log := m.log.WithField("scanner", i)
+			defer logger.LogPanic(log)
+			defer log.Info("Deposit forwarding goroutine exited")
+
+			for {
+				select {
+				case <-m.quit:
+					return
+				case dv, ok := <-scanner.GetDeposit():
+					if !ok {
+						log.Info("Scanner deposit channel closed")
+						return
+					}
+
+					select {
+					case <-m.quit:
+						return
+					case m.outChan <- dv:
+					}
+				}
+			}
+		}(i, scanner)
+	}
+	m.RUnlock()
+
+	wg.Wait()
+
+	return nil
+}
+
+// Shutdown stops the Multiplexer. The scanners are not shut down.
+func (m *Multiplexer) Shutdown() {
+	m.log.Info("Closing multiplexer")
+	close(m.quit)
+	m.log.Info("Waiting for multiplexer to stop")
+	<-m.done
+	m.log.Info("Multiplexer stopped")
+}
+
+// AddScanAddress adds a scan address to the scanner of coinType
+func (m *Multiplexer) AddScanAddress(addr, coinType string) error {
+	m.RLock()
+	defer m.RUnlock()
+
+	scanner, ok := m.scannerMap[coinType]
+	if !ok {
+		return ErrUnsupportedCoinType
+	}
+
+	return scanner.AddScanAddress(addr, coinType)
+}
+
+// GetScanAddresses returns the scan addresses of all scanners
+func (m *Multiplexer) GetScanAddresses() ([]string, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	var addrs []string
+	for _, scanner := range m.scanners {
+		a, err := scanner.GetScanAddresses()
+		if err != nil {
+			return nil, err
+		}
+		addrs = append(addrs, a...)
+	}
+
+	return addrs, nil
+}
+
+// GetDeposit returns the merged deposit channel of all scanners
+func (m *Multiplexer) GetDeposit() <-chan DepositNote {
+	return m.outChan
+}
+
+// Rescan rescans the blocks from height from to height to with the scanner of coinType.
+// A scanner serving several coin types rescans for all of them. Returns ErrUnsupportedCoinType
+// if there is no scanner of coinType, or ErrRescanNotSupported if it can't rescan blocks.
+func (m *Multiplexer) Rescan(coinType string, from, to int64) error {
+	rs, err := m.getRescanner(coinType)
+	if err != nil {
+		return err
+	}
+
+	return rs.Rescan(from, to)
+}
+
+// RescanStatus returns the progress of the last rescan of the scanner of coinType,
+// or nil if it has not rescanned
+func (m *Multiplexer) RescanStatus(coinType string) (*RescanStatus, error) {
+	rs, err := m.getRescanner(coinType)
+	if err != nil {
+		return nil, err
+	}
+
+	return rs.RescanStatus(), nil
+}
+
+func (m *Multiplexer) getRescanner(coinType string) (Rescanner, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	scanner, ok := m.scannerMap[coinType]
+	if !ok {
+		return nil, ErrUnsupportedCoinType
+	}
+
+	rs, ok := scanner.(Rescanner)
+	if !ok {
+		return nil, ErrRescanNotSupported
+	}
+
+	return rs, nil
+}
@@ -0,0 +1,108 @@
+package scanner
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+func TestMultiplexer(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+
+	btcScanner := NewDummyScanner(log)
+	ltcScanner := NewDummyScanner(log)
+
+	m := NewMultiplexer(log)
+	require.NoError(t, m.AddScanner(btcScanner, CoinTypeBTC))
+	require.NoError(t, m.AddScanner(ltcScanner, CoinTypeLTC))
+	require.Error(t, m.AddScanner(ltcScanner, CoinTypeLTC))
+	require.Equal(t, 2, m.GetScannerCount())
+
+	// Scan addresses are routed by coin type
+	require.NoError(t, m.AddScanAddress("1LcEkgX8DCrQczLMVh9LDTRnkdVV2oun3A", CoinTypeBTC))
+	require.NoError(t, m.AddScanAddress("Lf8ZayicoAH1K9oS3jyWafuLYpMPxqeotT", CoinTypeLTC))
+	require.Equal(t, ErrUnsupportedCoinType, m.AddScanAddress("0xabc", "ETH"))
+
+	// The dummy scanner can't rescan blocks
+	require.Equal(t, ErrRescanNotSupported, m.Rescan(CoinTypeBTC, 1, 2))
+	require.Equal(t, ErrUnsupportedCoinType, m.Rescan("ETH", 1, 2))
+
+	addrs, err := btcScanner.GetScanAddresses()
+	require.NoError(t, err)
+	require.Equal(t, []string{"1LcEkgX8DCrQczLMVh9LDTRnkdVV2oun3A"}, addrs)
+
+	addrs, err = ltcScanner.GetScanAddresses()
+	require.NoError(t, err)
+	require.Equal(t, []string{"Lf8ZayicoAH1K9oS3jyWafuLYpMPxqeotT"}, addrs)
+
+	addrs, err = m.GetScanAddresses()
+	require.NoError(t, err)
+	sort.Strings(addrs)
+	require.Equal(t, []string{"1LcEkgX8DCrQczLMVh9LDTRnkdVV2oun3A", "Lf8ZayicoAH1K9oS3jyWafuLYpMPxqeotT"}, addrs)
+
+	// Deposits of all scanners are merged
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		require.NoError(t, m.Run())
+	}()
+
+	btcScanner.deposits <- NewDepositNote(Deposit{CoinType: CoinTypeBTC, Tx: "a"})
+	ltcScanner.deposits <- NewDepositNote(Deposit{CoinType: CoinTypeLTC, Tx: "b"})
+
+	var coinTypes []string
+	for i := 0; i < 2; i++ {
+		select {
+		case dn := <-m.GetDeposit():
+			coinTypes = append(coinTypes, dn.CoinType)
+		case <-time.After(3 * time.Second):
+			t.Fatal("Waiting for deposit timed out")
+		}
+	}
+	sort.Strings(coinTypes)
+	require.Equal(t, []string{CoinTypeBTC, CoinTypeLTC}, coinTypes)
+
+	m.Shutdown()
+	<-done
+}
+
+func TestMultiplexerSharedScanner(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+
+	// One scanner serves several coin types, like the ERC20 scanner
+	tokenScanner := NewDummyScanner(log)
+
+	m := NewMultiplexer(log)
+	require.NoError(t, m.AddScanner(tokenScanner, "AAA"))
+	require.NoError(t, m.AddScanner(tokenScanner, "BBB"))
+	require.Equal(t, 2, m.GetScannerCount())
+
+	require.NoError(t, m.AddScanAddress("0x5aaeb6053f3e94c9b9a09f33669435e7ef1beaed", "AAA"))
+
+	// The addresses of a shared scanner are returned once
+	addrs, err := m.GetScanAddresses()
+	require.NoError(t, err)
+	require.Equal(t, []string{"0x5aaeb6053f3e94c9b9a09f33669435e7ef1beaed"}, addrs)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		require.NoError(t, m.Run())
+	}()
+
+	tokenScanner.deposits <- NewDepositNote(Deposit{CoinType: "BBB", Tx: "a"})
+
+	select {
+	case dn := <-m.GetDeposit():
+		require.Equal(t, "BBB", dn.CoinType)
+	case <-time.After(3 * time.Second):
+		t.Fatal("Waiting for deposit timed out")
+	}
+
+	m.Shutdown()
+	<-done
+}
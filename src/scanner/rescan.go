@@ -0,0 +1,172 @@
+package scanner
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/skycoin/teller/src/util/logger"
+)
+
+var (
+	// ErrRescanInProgress is returned by Rescan if the scanner is already rescanning
+	ErrRescanInProgress = errors.New("A rescan is already in progress")
+
+	// ErrRescanNotSupported is returned by Multiplexer.Rescan if the scanner of the coin type can't rescan blocks,
+	// e.g. the electrum and blockbook backends, which fetch the complete history of the scan addresses on every scan
+	ErrRescanNotSupported = errors.New("Scanner does not support rescanning blocks")
+)
+
+// InvalidRescanRangeErr is returned by Rescan if the block range can't be rescanned
+type InvalidRescanRangeErr struct {
+	msg string
+}
+
+func (e InvalidRescanRangeErr) Error() string {
+	return e.msg
+}
+
+// RescanStatus is the progress of a rescan. It is kept in memory only.
+type RescanStatus struct {
+	From int64 `json:"from"`
+	To   int64 `json:"to"`
+	// Last rescanned block height, From-1 until the first block is rescanned
+	Height int64 `json:"height"`
+	// Number of deposits found that had not been saved before
+	Deposits   int    `json:"deposits"`
+	StartedAt  int64  `json:"started_at"`
+	FinishedAt int64  `json:"finished_at,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Rescanner rescans a range of blocks for deposits to the current scan addresses
+type Rescanner interface {
+	Rescan(from, to int64) error
+	RescanStatus() *RescanStatus
+}
+
+// checkRescanRange checks that from and to are a valid range of at most max blocks, up to height last
+func checkRescanRange(from, to, last, max int64) error {
+	switch {
+	case from < 0:
+		return InvalidRescanRangeErr{"from must not be negative"}
+	case to < from:
+		return InvalidRescanRangeErr{"to must not be less than from"}
+	case to > last:
+		return InvalidRescanRangeErr{fmt.Sprintf("to must be at most %d, the last block with enough confirmations", last)}
+	case to-from+1 > max:
+		return InvalidRescanRangeErr{fmt.Sprintf("Can't rescan more than %d blocks at once", max)}
+	}
+	return nil
+}
+
+// rescanner runs the rescans of a scanner, one at a time
+type rescanner struct {
+	sync.Mutex
+	status *RescanStatus
+	wg     sync.WaitGroup
+}
+
+// start rescans the blocks from height from to height to in a goroutine, calling scan with ranges of
+// at most step blocks, in height order. The rescan stops early if quit is closed or scan fails.
+// Returns ErrRescanInProgress if a rescan is running.
+func (r *rescanner) start(log logrus.FieldLogger, quit <-chan struct{}, from, to, step int64, scan func(from, to int64) (int, error)) error {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.status != nil && r.status.FinishedAt == 0 {
+		return ErrRescanInProgress
+	}
+
+	r.status = &RescanStatus{
+		From:      from,
+		To:        to,
+		Height:    from - 1,
+		StartedAt: time.Now().UTC().Unix(),
+	}
+
+	log = log.WithFields(logrus.Fields{
+		"rescanFrom": from,
+		"rescanTo":   to,
+	})
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		defer logger.LogPanic(log)
+
+		log.Info("Rescanning blocks")
+
+		err := r.run(quit, from, to, step, scan)
+
+		r.Lock()
+		defer r.Unlock()
+
+		r.status.FinishedAt = time.Now().UTC().Unix()
+		log = log.WithField("rescanDeposits", r.status.Deposits)
+
+		switch err {
+		case nil:
+			log.Infof("Rescan found %d new deposits", r.status.Deposits)
+		case errQuit:
+			r.status.Error = err.Error()
+			log.Info("Rescan stopped by scanner shutdown")
+		default:
+			r.status.Error = err.Error()
+			log.WithError(err).WithField("height", r.status.Height+1).Error("Rescan failed")
+		}
+	}()
+
+	return nil
+}
+
+func (r *rescanner) run(quit <-chan struct{}, from, to, step int64, scan func(from, to int64) (int, error)) error {
+	for h := from; h <= to; h += step {
+		select {
+		case <-quit:
+			return errQuit
+		default:
+		}
+
+		end := h + step - 1
+		if end > to {
+			end = to
+		}
+
+		n, err := scan(h, end)
+
+		r.Lock()
+		r.status.Deposits += n
+		if err == nil {
+			r.status.Height = end
+		}
+		r.Unlock()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getStatus returns a copy of the status of the last rescan, or nil if the scanner has not rescanned
+func (r *rescanner) getStatus() *RescanStatus {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.status == nil {
+		return nil
+	}
+
+	st := *r.status
+	return &st
+}
+
+// wait waits for a running rescan to stop
+func (r *rescanner) wait() {
+	r.wg.Wait()
+}
@@ -2,6 +2,7 @@ package scanner
 
 import (
 	"fmt"
+	"sync/atomic"
 
 	"github.com/btcsuite/btcd/btcjson"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
@@ -9,7 +10,7 @@ import (
 
 // Scanner provids apis for interacting with a scan service
 type Scanner interface {
-	AddScanAddress(string) error
+	AddScanAddress(addr, coinType string) error
 	GetScanAddresses() ([]string, error)
 	GetDeposit() <-chan DepositNote
 }
@@ -36,18 +37,71 @@ func NewDepositNote(dv Deposit) DepositNote {
 	}
 }
 
+// bestHeight is the best block height a scanner saw at its last check, accessed atomically.
+// Scanners embed it first in their struct, so that it is 64-bit aligned for atomic access on 32-bit platforms.
+type bestHeight struct {
+	height int64
+}
+
+// BestHeight returns the best block height as of the last check, or 0 before the first check
+func (b *bestHeight) BestHeight() int64 {
+	return atomic.LoadInt64(&b.height)
+}
+
+func (b *bestHeight) setBestHeight(h int64) {
+	atomic.StoreInt64(&b.height, h)
+}
+
 // Deposit struct
 type Deposit struct {
 	CoinType  string // coin type
 	Address   string // deposit address
-	Value     int64  // deposit amount. For BTC, measured in satoshis.
+	Value     int64  // deposit amount. For BTC and LTC, measured in satoshis.
 	Height    int64  // the block height
 	Tx        string // the transaction id
-	N         uint32 // the index of vout in the tx [BTC]
+	N         uint32 // the index of vout in the tx [BTC, LTC]
 	Processed bool   // whether this was received by the exchange and saved
+	// Outpoints spent by the tx, "$txid:$vout" [BTC, LTC]. Another transaction spending one of them conflicts with the deposit.
+	Inputs []string
 }
 
 // ID returns $tx:$n formatted ID string
 func (d Deposit) ID() string {
 	return fmt.Sprintf("%s:%d", d.Tx, d.N)
 }
+
+// DepositState is the state of the transaction of a deposit in the best chain
+type DepositState int
+
+const (
+	// DepositConfirmed the transaction is in the best chain
+	DepositConfirmed DepositState = iota
+	// DepositUnconfirmed the transaction left the best chain, e.g. in a reorg, and no conflicting transaction was found.
+	// It may be mined again.
+	DepositUnconfirmed
+	// DepositConflicted a transaction of the best chain spends an input of the deposit's transaction,
+	// which was double spent or replaced, so the deposit can't be mined anymore
+	DepositConflicted
+)
+
+func (s DepositState) String() string {
+	switch s {
+	case DepositConfirmed:
+		return "confirmed"
+	case DepositUnconfirmed:
+		return "unconfirmed"
+	case DepositConflicted:
+		return "conflicted"
+	default:
+		return fmt.Sprintf("DepositState(%d)", int(s))
+	}
+}
+
+// DepositCheck is the result of checking a deposit against the best chain
+type DepositCheck struct {
+	State DepositState
+	// Height of the block that includes the deposit's transaction, if DepositConfirmed
+	Height int64
+	// Transaction that spends an input of the deposit's transaction, if DepositConflicted
+	ConflictTx string
+}
@@ -1,6 +1,7 @@
 package scanner
 
 import (
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -10,11 +11,17 @@ import (
 	"github.com/btcsuite/btcutil"
 	"github.com/sirupsen/logrus"
 
+	"github.com/skycoin/teller/src/addrs"
+	"github.com/skycoin/teller/src/util/bech32util"
 	"github.com/skycoin/teller/src/util/dbutil"
 )
 
-// CoinTypeBTC is BTC coin type
-const CoinTypeBTC = "BTC"
+const (
+	// CoinTypeBTC is BTC coin type
+	CoinTypeBTC = "BTC"
+	// CoinTypeLTC is LTC coin type
+	CoinTypeLTC = "LTC"
+)
 
 var (
 	// scan meta info bucket
@@ -23,13 +30,35 @@ var (
 	// deposit value bucket
 	depositBkt = []byte("deposit_value")
 
+	// LTC scan meta info bucket
+	ltcScanMetaBkt = []byte("ltc_scan_meta")
+
+	// LTC deposit value bucket
+	ltcDepositBkt = []byte("ltc_deposit_value")
+
+	// ERC20 scan meta info bucket
+	erc20ScanMetaBkt = []byte("erc20_scan_meta")
+
+	// ERC20 deposit value bucket
+	erc20DepositBkt = []byte("erc20_deposit_value")
+
 	// deposit address bucket
 	depositAddressesKey = "deposit_addresses"
 
 	// deposit values index list bucket
 	dvIndexListKey = "dv_index_list"
+
+	// last scanned block key, saved with the deposits of the block
+	checkpointKey = "checkpoint"
 )
 
+// Checkpoint is the last block whose deposits have all been saved.
+// Hash is empty for scanners that scan by height only.
+type Checkpoint struct {
+	Height int64  `json:"height"`
+	Hash   string `json:"hash,omitempty"`
+}
+
 // DepositsEmptyErr is returned if there are no deposit values
 type DepositsEmptyErr struct{}
 
@@ -68,34 +97,58 @@ type Storer interface {
 	SetDepositProcessed(string) error
 	GetUnprocessedDeposits() ([]Deposit, error)
 	ScanBlock(*btcjson.GetBlockVerboseResult) ([]Deposit, error)
+	RescanBlock(*btcjson.GetBlockVerboseResult) ([]Deposit, error)
+	GetCheckpoint() (*Checkpoint, error)
 }
 
-// BTCStore records scanner meta info for BTC deposits
+// BTCStore records scanner meta info for BTC deposits.
+// It also serves LTC, whose blocks are scanned the same way but kept in separate buckets.
 type BTCStore struct {
-	db  *bolt.DB
-	log logrus.FieldLogger
+	db          *bolt.DB
+	log         logrus.FieldLogger
+	coinType    string
+	scanMetaBkt []byte
+	depositBkt  []byte
 }
 
 // NewStore creates a scanner BTCStore
 func NewStore(log logrus.FieldLogger, db *bolt.DB) (*BTCStore, error) {
+	return newStore(log, db, CoinTypeBTC, scanMetaBkt, depositBkt)
+}
+
+// NewLTCStore creates a scanner BTCStore for LTC deposits
+func NewLTCStore(log logrus.FieldLogger, db *bolt.DB) (*BTCStore, error) {
+	return newStore(log, db, CoinTypeLTC, ltcScanMetaBkt, ltcDepositBkt)
+}
+
+// NewERC20Store creates a scanner BTCStore for ERC20 token deposits.
+// Its deposits are added with SaveDeposits, ScanBlock does not apply to ERC20.
+func NewERC20Store(log logrus.FieldLogger, db *bolt.DB) (*BTCStore, error) {
+	return newStore(log, db, "", erc20ScanMetaBkt, erc20DepositBkt)
+}
+
+func newStore(log logrus.FieldLogger, db *bolt.DB, coinType string, metaBkt, dvBkt []byte) (*BTCStore, error) {
 	if db == nil {
 		return nil, errors.New("new BTCStore failed: db is nil")
 	}
 
 	if err := db.Update(func(tx *bolt.Tx) error {
-		if _, err := tx.CreateBucketIfNotExists(scanMetaBkt); err != nil {
+		if _, err := tx.CreateBucketIfNotExists(metaBkt); err != nil {
 			return err
 		}
 
-		_, err := tx.CreateBucketIfNotExists(depositBkt)
+		_, err := tx.CreateBucketIfNotExists(dvBkt)
 		return err
 	}); err != nil {
 		return nil, err
 	}
 
 	return &BTCStore{
-		db:  db,
-		log: log,
+		db:          db,
+		log:         log,
+		coinType:    coinType,
+		scanMetaBkt: metaBkt,
+		depositBkt:  dvBkt,
 	}, nil
 }
 
@@ -118,7 +171,7 @@ func (s *BTCStore) GetScanAddresses() ([]string, error) {
 func (s *BTCStore) getScanAddressesTx(tx *bolt.Tx) ([]string, error) {
 	var addrs []string
 
-	if err := dbutil.GetBucketObject(tx, scanMetaBkt, depositAddressesKey, &addrs); err != nil {
+	if err := dbutil.GetBucketObject(tx, s.scanMetaBkt, depositAddressesKey, &addrs); err != nil {
 		switch err.(type) {
 		case dbutil.ObjectNotExistErr:
 			err = nil
@@ -150,7 +203,7 @@ func (s *BTCStore) AddScanAddress(addr string) error {
 
 		addrs = append(addrs, addr)
 
-		return dbutil.PutBucketValue(tx, scanMetaBkt, depositAddressesKey, addrs)
+		return dbutil.PutBucketValue(tx, s.scanMetaBkt, depositAddressesKey, addrs)
 	})
 }
 
@@ -158,7 +211,7 @@ func (s *BTCStore) AddScanAddress(addr string) error {
 func (s *BTCStore) SetDepositProcessed(dvKey string) error {
 	return s.db.Update(func(tx *bolt.Tx) error {
 		var dv Deposit
-		if err := dbutil.GetBucketObject(tx, depositBkt, dvKey, &dv); err != nil {
+		if err := dbutil.GetBucketObject(tx, s.depositBkt, dvKey, &dv); err != nil {
 			return err
 		}
 
@@ -168,16 +221,27 @@ func (s *BTCStore) SetDepositProcessed(dvKey string) error {
 
 		dv.Processed = true
 
-		return dbutil.PutBucketValue(tx, depositBkt, dv.ID(), dv)
+		return dbutil.PutBucketValue(tx, s.depositBkt, dv.ID(), dv)
 	})
 }
 
+// HasDeposit returns true if the Deposit with ID dvKey has been saved
+func (s *BTCStore) HasDeposit(dvKey string) (bool, error) {
+	var has bool
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		has, err = dbutil.BucketHasKey(tx, s.depositBkt, dvKey)
+		return err
+	})
+	return has, err
+}
+
 // GetUnprocessedDeposits returns all Deposits not marked as Processed
 func (s *BTCStore) GetUnprocessedDeposits() ([]Deposit, error) {
 	var dvs []Deposit
 
 	if err := s.db.View(func(tx *bolt.Tx) error {
-		return dbutil.ForEach(tx, depositBkt, func(k, v []byte) error {
+		return dbutil.ForEach(tx, s.depositBkt, func(k, v []byte) error {
 			var dv Deposit
 			if err := json.Unmarshal(v, &dv); err != nil {
 				return err
@@ -202,19 +266,96 @@ func (s *BTCStore) pushDepositTx(tx *bolt.Tx, dv Deposit) error {
 	key := dv.ID()
 
 	// Check if the deposit value already exists
-	if hasKey, err := dbutil.BucketHasKey(tx, depositBkt, key); err != nil {
+	if hasKey, err := dbutil.BucketHasKey(tx, s.depositBkt, key); err != nil {
 		return err
 	} else if hasKey {
 		return DepositExistsErr{}
 	}
 
 	// Save deposit value
-	return dbutil.PutBucketValue(tx, depositBkt, key, dv)
+	return dbutil.PutBucketValue(tx, s.depositBkt, key, dv)
 }
 
-// ScanBlock scans a btc block for deposits and adds them
-// If the deposit already exists, the result is omitted from the returned list
+// GetCheckpoint returns the last block whose deposits have all been saved, or nil if no block has been scanned
+func (s *BTCStore) GetCheckpoint() (*Checkpoint, error) {
+	var cp Checkpoint
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		return dbutil.GetBucketObject(tx, s.scanMetaBkt, checkpointKey, &cp)
+	}); err != nil {
+		switch err.(type) {
+		case dbutil.ObjectNotExistErr:
+			return nil, nil
+		default:
+			return nil, err
+		}
+	}
+
+	return &cp, nil
+}
+
+// ScanBlock scans a btc block for deposits and adds them, and saves the block as the checkpoint
+// in the same transaction. If the deposit already exists, the result is omitted from the returned list
 func (s *BTCStore) ScanBlock(block *btcjson.GetBlockVerboseResult) ([]Deposit, error) {
+	cp := &Checkpoint{
+		Height: block.Height,
+		Hash:   block.Hash,
+	}
+
+	return s.saveDeposits(cp, s.filterBlock(block))
+}
+
+// RescanBlock scans a btc block for deposits and adds them like ScanBlock, without changing the checkpoint
+func (s *BTCStore) RescanBlock(block *btcjson.GetBlockVerboseResult) ([]Deposit, error) {
+	return s.saveDeposits(nil, s.filterBlock(block))
+}
+
+// filterBlock returns a saveDeposits filter that scans the block for deposits to the scan addresses
+func (s *BTCStore) filterBlock(block *btcjson.GetBlockVerboseResult) func(addrs []string) ([]Deposit, error) {
+	return func(addrs []string) ([]Deposit, error) {
+		deposits, err := scanBlock(block, addrs, s.coinType)
+		if err != nil {
+			s.log.WithError(err).Error("scanBlock failed")
+			return nil, err
+		}
+		return deposits, nil
+	}
+}
+
+// SaveDeposits adds the deposits to scan addresses, ignoring the others.
+// If the deposit already exists, the result is omitted from the returned list
+func (s *BTCStore) SaveDeposits(deposits []Deposit) ([]Deposit, error) {
+	return s.saveDeposits(nil, filterScanAddresses(deposits))
+}
+
+// SaveDepositsCheckpoint adds the deposits to scan addresses like SaveDeposits, and saves cp
+// as the checkpoint in the same transaction
+func (s *BTCStore) SaveDepositsCheckpoint(deposits []Deposit, cp Checkpoint) ([]Deposit, error) {
+	return s.saveDeposits(&cp, filterScanAddresses(deposits))
+}
+
+// filterScanAddresses returns a saveDeposits filter that keeps the deposits to scan addresses
+func filterScanAddresses(deposits []Deposit) func(addrs []string) ([]Deposit, error) {
+	return func(addrs []string) ([]Deposit, error) {
+		addrMap := make(map[string]struct{}, len(addrs))
+		for _, a := range addrs {
+			addrMap[a] = struct{}{}
+		}
+
+		var dvs []Deposit
+		for _, dv := range deposits {
+			if _, ok := addrMap[dv.Address]; ok {
+				dvs = append(dvs, dv)
+			}
+		}
+
+		return dvs, nil
+	}
+}
+
+// saveDeposits adds the deposits returned by filter, which is called with the scan addresses.
+// If cp is not nil, it is saved as the checkpoint in the same transaction, so that the checkpoint
+// never gets ahead of the saved deposits.
+func (s *BTCStore) saveDeposits(cp *Checkpoint, filter func(addrs []string) ([]Deposit, error)) ([]Deposit, error) {
 	var dvs []Deposit
 
 	if err := s.db.Update(func(tx *bolt.Tx) error {
@@ -224,9 +365,8 @@ func (s *BTCStore) ScanBlock(block *btcjson.GetBlockVerboseResult) ([]Deposit, e
 			return err
 		}
 
-		deposits, err := ScanBTCBlock(block, addrs)
+		deposits, err := filter(addrs)
 		if err != nil {
-			s.log.WithError(err).Error("ScanBTCBlock failed")
 			return err
 		}
 
@@ -246,6 +386,10 @@ func (s *BTCStore) ScanBlock(block *btcjson.GetBlockVerboseResult) ([]Deposit, e
 			dvs = append(dvs, dv)
 		}
 
+		if cp != nil {
+			return dbutil.PutBucketValue(tx, s.scanMetaBkt, checkpointKey, cp)
+		}
+
 		return nil
 	}); err != nil {
 		return nil, err
@@ -256,6 +400,16 @@ func (s *BTCStore) ScanBlock(block *btcjson.GetBlockVerboseResult) ([]Deposit, e
 
 // ScanBTCBlock scan the given block and returns the next block hash or error
 func ScanBTCBlock(block *btcjson.GetBlockVerboseResult, depositAddrs []string) ([]Deposit, error) {
+	return scanBlock(block, depositAddrs, CoinTypeBTC)
+}
+
+// ScanLTCBlock returns the deposits to depositAddrs in a block of the litecoin chain
+func ScanLTCBlock(block *btcjson.GetBlockVerboseResult, depositAddrs []string) ([]Deposit, error) {
+	return scanBlock(block, depositAddrs, CoinTypeLTC)
+}
+
+// scanBlock returns the deposits to depositAddrs in a block of a bitcoin-like chain
+func scanBlock(block *btcjson.GetBlockVerboseResult, depositAddrs []string, coinType string) ([]Deposit, error) {
 	if len(block.RawTx) == 0 {
 		return nil, ErrBtcdTxindexDisabled
 	}
@@ -267,21 +421,27 @@ func ScanBTCBlock(block *btcjson.GetBlockVerboseResult, depositAddrs []string) (
 
 	var dv []Deposit
 	for _, tx := range block.RawTx {
+		var inputs []string
 		for _, v := range tx.Vout {
 			amt, err := btcutil.NewAmount(v.Value)
 			if err != nil {
 				return nil, err
 			}
 
-			for _, a := range v.ScriptPubKey.Addresses {
+			for _, a := range voutAddresses(v, coinType) {
 				if _, ok := addrMap[a]; ok {
+					if inputs == nil {
+						inputs = txInputs(tx)
+					}
+
 					dv = append(dv, Deposit{
-						CoinType: CoinTypeBTC,
+						CoinType: coinType,
 						Address:  a,
 						Value:    int64(amt),
 						Height:   block.Height,
 						Tx:       tx.Txid,
 						N:        v.N,
+						Inputs:   inputs,
 					})
 				}
 			}
@@ -290,3 +450,57 @@ func ScanBTCBlock(block *btcjson.GetBlockVerboseResult, depositAddrs []string) (
 
 	return dv, nil
 }
+
+// txInputs returns the outpoints a transaction spends, "$txid:$vout". A coinbase input spends none.
+func txInputs(tx btcjson.TxRawResult) []string {
+	var inputs []string
+	for _, in := range tx.Vin {
+		if in.IsCoinBase() {
+			continue
+		}
+		inputs = append(inputs, fmt.Sprintf("%s:%d", in.Txid, in.Vout))
+	}
+	return inputs
+}
+
+// voutAddresses returns the addresses of an output.
+// Bitcoin segwit outputs are matched by their lowercase bech32 address. Nodes that don't decode
+// witness output scripts return no addresses for them, so the address is derived from the script.
+func voutAddresses(v btcjson.Vout, coinType string) []string {
+	if coinType != CoinTypeBTC {
+		return v.ScriptPubKey.Addresses
+	}
+
+	if len(v.ScriptPubKey.Addresses) == 0 {
+		if a, ok := btcSegWitScriptAddress(v.ScriptPubKey.Hex); ok {
+			return []string{a}
+		}
+		return nil
+	}
+
+	as := make([]string, len(v.ScriptPubKey.Addresses))
+	for i, a := range v.ScriptPubKey.Addresses {
+		as[i] = addrs.NormalizeBTCAddress(a)
+	}
+	return as
+}
+
+// btcSegWitScriptAddress returns the bech32 address of a hex encoded P2WPKH or P2WSH output script
+func btcSegWitScriptAddress(script string) (string, bool) {
+	b, err := hex.DecodeString(script)
+	if err != nil {
+		return "", false
+	}
+
+	// OP_0 <20 or 32 byte program>
+	if len(b) < 2 || b[0] != 0x00 || int(b[1]) != len(b)-2 {
+		return "", false
+	}
+
+	a, err := bech32util.EncodeSegWitAddress(addrs.BTCSegWitHRP, b[2:])
+	if err != nil {
+		return "", false
+	}
+
+	return a, true
+}
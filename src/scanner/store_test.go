@@ -64,6 +64,30 @@ func (m *MockStore) ScanBlock(*btcjson.GetBlockVerboseResult) ([]Deposit, error)
 	return dvs.([]Deposit), args.Error(1)
 }
 
+func (m *MockStore) RescanBlock(*btcjson.GetBlockVerboseResult) ([]Deposit, error) {
+	args := m.Called()
+
+	dvs := args.Get(0)
+
+	if dvs == nil {
+		return nil, args.Error(1)
+	}
+
+	return dvs.([]Deposit), args.Error(1)
+}
+
+func (m *MockStore) GetCheckpoint() (*Checkpoint, error) {
+	args := m.Called()
+
+	cp := args.Get(0)
+
+	if cp == nil {
+		return nil, args.Error(1)
+	}
+
+	return cp.(*Checkpoint), args.Error(1)
+}
+
 func TestBtcTxN(t *testing.T) {
 	d := Deposit{
 		Tx: "foo",
@@ -429,5 +453,123 @@ func TestGetBktValue(t *testing.T) {
 }
 
 func TestScanBlock(t *testing.T) {
-	// TODO
+	block := &btcjson.GetBlockVerboseResult{
+		Height: 540000,
+		RawTx: []btcjson.TxRawResult{
+			{
+				Txid: "tx1",
+				Vin: []btcjson.Vin{
+					{Txid: "in1", Vout: 0},
+					{Txid: "in2", Vout: 3},
+				},
+				Vout: []btcjson.Vout{
+					{
+						Value: 0.1,
+						N:     0,
+						ScriptPubKey: btcjson.ScriptPubKeyResult{
+							Type:      "pubkeyhash",
+							Addresses: []string{"1LEkderht5M5yWj82M87bEd4XDBsczLkp9"},
+						},
+					},
+					{
+						Value: 0.2,
+						N:     1,
+						ScriptPubKey: btcjson.ScriptPubKeyResult{
+							Type:      "scripthash",
+							Addresses: []string{"3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy"},
+						},
+					},
+					{
+						Value: 0.3,
+						N:     2,
+						ScriptPubKey: btcjson.ScriptPubKeyResult{
+							Type:      "witness_v0_keyhash",
+							Addresses: []string{"BC1QW508D6QEJXTDG4Y5R3ZARVARY0C5XW7KV8F3T4"},
+						},
+					},
+				},
+			},
+			{
+				Txid: "tx2",
+				Vin: []btcjson.Vin{
+					{Coinbase: "03e03d08"},
+				},
+				Vout: []btcjson.Vout{
+					// A node that does not decode witness scripts returns no addresses
+					{
+						Value: 0.4,
+						N:     0,
+						ScriptPubKey: btcjson.ScriptPubKeyResult{
+							Type: "witness_v0_scripthash",
+							Hex:  "00201863143c14c5166804bd19203356da136c985678cd4d27a1b8c6329604903262",
+						},
+					},
+					{
+						Value: 0.5,
+						N:     1,
+						ScriptPubKey: btcjson.ScriptPubKeyResult{
+							Type: "nulldata",
+							Hex:  "6a0474657374",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	dvs, err := scanBlock(block, []string{
+		"1LEkderht5M5yWj82M87bEd4XDBsczLkp9",
+		"3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy",
+		"bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4",
+		"bc1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3qccfmv3",
+	}, CoinTypeBTC)
+	require.NoError(t, err)
+	require.Equal(t, []Deposit{
+		{
+			CoinType: CoinTypeBTC,
+			Address:  "1LEkderht5M5yWj82M87bEd4XDBsczLkp9",
+			Value:    10000000,
+			Height:   540000,
+			Tx:       "tx1",
+			N:        0,
+			Inputs:   []string{"in1:0", "in2:3"},
+		},
+		{
+			CoinType: CoinTypeBTC,
+			Address:  "3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy",
+			Value:    20000000,
+			Height:   540000,
+			Tx:       "tx1",
+			N:        1,
+			Inputs:   []string{"in1:0", "in2:3"},
+		},
+		{
+			CoinType: CoinTypeBTC,
+			Address:  "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4",
+			Value:    30000000,
+			Height:   540000,
+			Tx:       "tx1",
+			N:        2,
+			Inputs:   []string{"in1:0", "in2:3"},
+		},
+		{
+			CoinType: CoinTypeBTC,
+			Address:  "bc1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3qccfmv3",
+			Value:    40000000,
+			Height:   540000,
+			Tx:       "tx2",
+			N:        0,
+		},
+	}, dvs)
+
+	// Segwit addresses are only derived for BTC
+	dvs, err = scanBlock(block, []string{
+		"bc1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3qccfmv3",
+	}, CoinTypeLTC)
+	require.NoError(t, err)
+	require.Empty(t, dvs)
+
+	block.RawTx = nil
+	_, err = scanBlock(block, nil, CoinTypeBTC)
+	require.Equal(t, ErrBtcdTxindexDisabled, err)
 }
@@ -0,0 +1,118 @@
+package scanner
+
+import (
+	"encoding/hex"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/skycoin/teller/src/util/zmqutil"
+)
+
+const (
+	// zmqTopicHashBlock is the node's ZMQ topic of new block hashes.
+	// Deposits are only taken from confirmed blocks, so transaction topics are not needed.
+	zmqTopicHashBlock = "hashblock"
+
+	// zmqPollPeriod is how often to poll while subscribed to ZMQ block notifications,
+	// in case a notification is dropped
+	zmqPollPeriod = time.Minute
+)
+
+// runZMQ subscribes to the node's block notifications, resubscribing every
+// ScanPeriod while the ZMQ socket is down, until the scanner quits
+func (s *BTCScanner) runZMQ() {
+	log := s.log.WithField("zmqAddress", s.cfg.ZMQAddress)
+
+	for {
+		err := s.subscribeZMQ(log)
+		atomic.StoreInt32(&s.zmqConnected, 0)
+		if err == errQuit {
+			return
+		}
+
+		log.WithError(err).Warnf("ZMQ block notifications unavailable, polling for blocks every %s", s.cfg.ScanPeriod)
+
+		select {
+		case <-s.quit:
+			return
+		case <-time.After(s.cfg.ScanPeriod):
+		}
+	}
+}
+
+// subscribeZMQ signals blockNotify for each block published by the node,
+// until the ZMQ socket fails or the scanner quits
+func (s *BTCScanner) subscribeZMQ(log logrus.FieldLogger) error {
+	sub, err := zmqutil.Dial(s.cfg.ZMQAddress, 0, zmqTopicHashBlock)
+	if err != nil {
+		return err
+	}
+
+	// Close the socket on quit, to unblock Recv
+	closed := make(chan struct{})
+	defer close(closed)
+	go func() {
+		select {
+		case <-s.quit:
+		case <-closed:
+		}
+		sub.Close()
+	}()
+
+	atomic.StoreInt32(&s.zmqConnected, 1)
+	log.Info("Subscribed to ZMQ block notifications")
+
+	// Blocks may have been published while the socket was down
+	s.notifyBlock()
+
+	for {
+		msg, err := sub.Recv()
+		if err != nil {
+			select {
+			case <-s.quit:
+				return errQuit
+			default:
+				return err
+			}
+		}
+
+		if len(msg) < 2 || string(msg[0]) != zmqTopicHashBlock {
+			continue
+		}
+
+		log.WithField("hash", hex.EncodeToString(msg[1])).Debug("ZMQ block notification")
+		s.notifyBlock()
+	}
+}
+
+// notifyBlock wakes up the scan loop, if it is waiting
+func (s *BTCScanner) notifyBlock() {
+	select {
+	case s.blockNotify <- struct{}{}:
+	default:
+	}
+}
+
+// pollPeriod returns how long to wait for a block notification before polling
+func (s *BTCScanner) pollPeriod() time.Duration {
+	if atomic.LoadInt32(&s.zmqConnected) == 1 && s.cfg.ScanPeriod < zmqPollPeriod {
+		return zmqPollPeriod
+	}
+
+	return s.cfg.ScanPeriod
+}
+
+// waitForBlockNotify waits until the node publishes a block, or pollPeriod passes.
+// Returns errQuit if the scanner quit.
+func (s *BTCScanner) waitForBlockNotify() error {
+	select {
+	case <-s.quit:
+		return errQuit
+	case <-s.blockNotify:
+		return nil
+	case <-time.After(s.pollPeriod()):
+		return nil
+	}
+}
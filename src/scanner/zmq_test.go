@@ -0,0 +1,56 @@
+package scanner
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+func TestScannerWaitForBlockNotify(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	scr := setupScannerWithDB(t, nil, db)
+	scr.cfg.ScanPeriod = time.Millisecond * 10
+
+	// Without ZMQ, the scanner polls every ScanPeriod
+	require.Equal(t, scr.cfg.ScanPeriod, scr.pollPeriod())
+	require.NoError(t, scr.waitForBlockNotify())
+
+	// While subscribed, it polls rarely, and wakes up when notified
+	atomic.StoreInt32(&scr.zmqConnected, 1)
+	require.Equal(t, zmqPollPeriod, scr.pollPeriod())
+
+	// Notifications don't block, and at most one is pending
+	scr.notifyBlock()
+	scr.notifyBlock()
+
+	t0 := time.Now()
+	require.NoError(t, scr.waitForBlockNotify())
+	require.True(t, time.Since(t0) < time.Second)
+
+	done := make(chan error)
+	go func() {
+		done <- scr.waitForBlockNotify()
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("waitForBlockNotify returned without a notification")
+	case <-time.After(time.Millisecond * 50):
+	}
+
+	scr.notifyBlock()
+	require.NoError(t, <-done)
+
+	// Quitting stops the wait
+	go func() {
+		done <- scr.waitForBlockNotify()
+	}()
+	close(scr.quit)
+	require.Equal(t, errQuit, <-done)
+}
@@ -0,0 +1,144 @@
+// Package screening screens incoming deposits for AML risk, with local rules or an external risk API.
+// Flagged deposits are held for review by an operator instead of being sent.
+package screening
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/skycoin/teller/src/scanner"
+)
+
+const (
+	// ProviderRules screens deposits with the local Rules
+	ProviderRules = "rules"
+	// ProviderAPI screens deposits with an external risk API, see Client
+	ProviderAPI = "api"
+
+	defaultTimeout = time.Second * 10
+)
+
+// Screener screens deposits
+type Screener interface {
+	// Screen returns true and the reason if a deposit is flagged
+	Screen(ctx context.Context, d scanner.Deposit) (bool, string, error)
+}
+
+// Rules is a local rules engine
+type Rules struct {
+	// Deposits with a value of at least MaxValue are flagged, 0 for no limit.
+	// Deposit values of all coin types have 8 decimal places.
+	MaxValue int64
+}
+
+// Screen flags the deposits that break a rule
+func (r Rules) Screen(ctx context.Context, d scanner.Deposit) (bool, string, error) {
+	if r.MaxValue > 0 && d.Value >= r.MaxValue {
+		return true, fmt.Sprintf("value %d is at least the maximum value %d", d.Value, r.MaxValue), nil
+	}
+
+	return false, "", nil
+}
+
+// screenRequest is the request body of the risk API
+type screenRequest struct {
+	CoinType string `json:"coin_type"`
+	Address  string `json:"address"`
+	Txid     string `json:"txid"`
+	N        uint32 `json:"n"`
+	Value    int64  `json:"value"`
+	Height   int64  `json:"height"`
+}
+
+// screenResponse is the response of the risk API
+type screenResponse struct {
+	Flagged bool   `json:"flagged"`
+	Reason  string `json:"reason"`
+}
+
+// Client is a Screener that asks an external risk API over HTTP.
+//
+// The deposit is POSTed to the API as JSON, with the API key as a bearer token:
+//
+//	{"coin_type": "BTC", "address": "...", "txid": "...", "n": 0, "value": 100000000, "height": 500000}
+//
+// and the API responds with 200 and {"flagged": true, "reason": "..."} or {"flagged": false}.
+type Client struct {
+	url    string
+	apiKey string
+	client *http.Client
+}
+
+// NewClient creates a Client of the risk API at apiURL. apiKey is optional.
+// Requests time out after timeout, or 10s if it is 0.
+func NewClient(apiURL, apiKey string, timeout time.Duration) (*Client, error) {
+	u, err := url.Parse(apiURL)
+	if err != nil {
+		return nil, errors.New("invalid screening API url")
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, errors.New("screening API url must be an http or https URL")
+	}
+
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+
+	return &Client{
+		url:    apiURL,
+		apiKey: apiKey,
+		client: &http.Client{
+			Timeout: timeout,
+		},
+	}, nil
+}
+
+// Screen asks the risk API whether a deposit is flagged
+func (c *Client) Screen(ctx context.Context, d scanner.Deposit) (bool, string, error) {
+	body, err := json.Marshal(screenRequest{
+		CoinType: d.CoinType,
+		Address:  d.Address,
+		Txid:     d.Tx,
+		N:        d.N,
+		Value:    d.Value,
+		Height:   d.Height,
+	})
+	if err != nil {
+		return false, "", err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return false, "", err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+
+	rsp, err := c.client.Do(req)
+	if err != nil {
+		return false, "", err
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusOK {
+		return false, "", fmt.Errorf("screening request failed: %s", rsp.Status)
+	}
+
+	var sr screenResponse
+	if err := json.NewDecoder(rsp.Body).Decode(&sr); err != nil {
+		return false, "", fmt.Errorf("decode screening response failed: %v", err)
+	}
+
+	return sr.Flagged, sr.Reason, nil
+}
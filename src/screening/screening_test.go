@@ -0,0 +1,88 @@
+package screening
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/scanner"
+)
+
+func TestRules(t *testing.T) {
+	ctx := context.Background()
+
+	flagged, _, err := Rules{}.Screen(ctx, scanner.Deposit{Value: 1e12})
+	require.NoError(t, err)
+	require.False(t, flagged)
+
+	r := Rules{MaxValue: 1e8}
+
+	flagged, _, err = r.Screen(ctx, scanner.Deposit{Value: 1e8 - 1})
+	require.NoError(t, err)
+	require.False(t, flagged)
+
+	flagged, reason, err := r.Screen(ctx, scanner.Deposit{Value: 1e8})
+	require.NoError(t, err)
+	require.True(t, flagged)
+	require.NotEmpty(t, reason)
+}
+
+func TestClientScreen(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPost, r.Method)
+		require.Equal(t, "Bearer key", r.Header.Get("Authorization"))
+
+		var req screenRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		require.Equal(t, scanner.CoinTypeBTC, req.CoinType)
+
+		switch req.Txid {
+		case "flagged":
+			fmt.Fprint(w, `{"flagged": true, "reason": "mixer"}`)
+		case "unavailable":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case "garbage":
+			fmt.Fprint(w, `not json`)
+		default:
+			fmt.Fprint(w, `{"flagged": false}`)
+		}
+	}))
+	defer srv.Close()
+
+	_, err := NewClient("ftp://example.com", "", 0)
+	require.Error(t, err)
+
+	c, err := NewClient(srv.URL, "key", 0)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	d := scanner.Deposit{
+		CoinType: scanner.CoinTypeBTC,
+		Address:  "addr",
+		Value:    1e8,
+		Tx:       "clean",
+	}
+
+	flagged, _, err := c.Screen(ctx, d)
+	require.NoError(t, err)
+	require.False(t, flagged)
+
+	d.Tx = "flagged"
+	flagged, reason, err := c.Screen(ctx, d)
+	require.NoError(t, err)
+	require.True(t, flagged)
+	require.Equal(t, "mixer", reason)
+
+	d.Tx = "unavailable"
+	_, _, err = c.Screen(ctx, d)
+	require.Error(t, err)
+
+	d.Tx = "garbage"
+	_, _, err = c.Screen(ctx, d)
+	require.Error(t, err)
+}
@@ -0,0 +1,126 @@
+// Package secrets fetches teller's secrets, e.g. RPC credentials and TLS keys,
+// from a secrets manager instead of the config file
+package secrets
+
+import (
+	"sort"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Provider fetches secrets from a secrets manager
+type Provider interface {
+	Name() string
+	// Secrets returns the secrets, keyed by name
+	Secrets() (map[string]string, error)
+	// Renew renews the credentials that the provider authenticates with, before they expire
+	Renew() error
+}
+
+// RenewerConfig configures a Renewer
+type RenewerConfig struct {
+	// How often the credentials are renewed and the secrets are fetched
+	RenewPeriod time.Duration
+}
+
+// Renewer renews the credentials of a Provider periodically, so that teller can fetch secrets
+// again, e.g. when the config is reloaded. The secrets are fetched after each renewal, and the names of
+// changed secrets are logged, since they only apply after a restart.
+type Renewer struct {
+	log      logrus.FieldLogger
+	provider Provider
+	cfg      RenewerConfig
+	secrets  map[string]string
+	quit     chan struct{}
+	done     chan struct{}
+}
+
+// NewRenewer creates a Renewer
+func NewRenewer(log logrus.FieldLogger, provider Provider, cfg RenewerConfig) *Renewer {
+	return &Renewer{
+		log:      log.WithField("prefix", "secrets.renewer").WithField("provider", provider.Name()),
+		provider: provider,
+		cfg:      cfg,
+		quit:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Run renews the credentials every RenewPeriod until Shutdown is called.
+// A failed renewal is logged and retried at the next period.
+func (r *Renewer) Run() error {
+	log := r.log
+	log.WithField("config", r.cfg).Info("Start secrets renewer")
+	defer log.Info("Secrets renewer closed")
+	defer close(r.done)
+
+	secrets, err := r.provider.Secrets()
+	if err != nil {
+		log.WithError(err).Error("provider.Secrets failed")
+	} else {
+		r.secrets = secrets
+	}
+
+	ticker := time.NewTicker(r.cfg.RenewPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.quit:
+			return nil
+		case <-ticker.C:
+			r.renew()
+		}
+	}
+}
+
+// Shutdown stops the Renewer
+func (r *Renewer) Shutdown() {
+	close(r.quit)
+	<-r.done
+}
+
+func (r *Renewer) renew() {
+	log := r.log
+
+	if err := r.provider.Renew(); err != nil {
+		log.WithError(err).Error("provider.Renew failed")
+		return
+	}
+
+	log.Debug("Renewed secrets provider credentials")
+
+	secrets, err := r.provider.Secrets()
+	if err != nil {
+		log.WithError(err).Error("provider.Secrets failed")
+		return
+	}
+
+	if r.secrets != nil {
+		if changed := Changed(r.secrets, secrets); len(changed) != 0 {
+			log.WithField("secrets", changed).Warn("Secrets changed, restart teller to apply them")
+		}
+	}
+
+	r.secrets = secrets
+}
+
+// Changed returns the names of the secrets that were added, removed or changed between a and b, sorted
+func Changed(a, b map[string]string) []string {
+	var changed []string
+	for k, v := range a {
+		if bv, ok := b[k]; !ok || bv != v {
+			changed = append(changed, k)
+		}
+	}
+
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			changed = append(changed, k)
+		}
+	}
+
+	sort.Strings(changed)
+	return changed
+}
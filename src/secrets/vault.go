@@ -0,0 +1,184 @@
+package secrets
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const vaultTimeout = time.Second * 10
+
+// VaultConfig configures a Vault provider
+type VaultConfig struct {
+	// Address of the Vault server, e.g. https://127.0.0.1:8200
+	Addr string
+	// Token that authenticates to Vault. If TokenFile is set, the token is read from it
+	// before each request instead, e.g. so that a Vault agent can rotate it.
+	Token     string
+	TokenFile string
+	// PEM encoded CA certificate that the server certificate is verified with, if not a system CA
+	CACert []byte
+	// Mount path of the KV version 2 secrets engine, e.g. "secret"
+	Mount string
+	// Path of the secret in the secrets engine, e.g. "teller"
+	Path string
+}
+
+// Vault fetches secrets from a KV version 2 secret of a HashiCorp Vault server
+type Vault struct {
+	cfg    VaultConfig
+	client *http.Client
+}
+
+// NewVault creates a Vault provider
+func NewVault(cfg VaultConfig) (*Vault, error) {
+	if cfg.Addr == "" {
+		return nil, errors.New("vault addr is empty")
+	}
+
+	if _, err := url.Parse(cfg.Addr); err != nil {
+		return nil, fmt.Errorf("vault addr invalid: %v", err)
+	}
+
+	if cfg.Token == "" && cfg.TokenFile == "" {
+		return nil, errors.New("vault token and token file are empty")
+	}
+
+	if cfg.Mount == "" || cfg.Path == "" {
+		return nil, errors.New("vault mount and path must be set")
+	}
+
+	transport := &http.Transport{}
+	if len(cfg.CACert) != 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(cfg.CACert) {
+			return nil, errors.New("vault CA certificate is invalid")
+		}
+
+		transport.TLSClientConfig = &tls.Config{
+			RootCAs: pool,
+		}
+	}
+
+	cfg.Addr = strings.TrimSuffix(cfg.Addr, "/")
+	cfg.Mount = strings.Trim(cfg.Mount, "/")
+	cfg.Path = strings.Trim(cfg.Path, "/")
+
+	return &Vault{
+		cfg: cfg,
+		client: &http.Client{
+			Timeout:   vaultTimeout,
+			Transport: transport,
+		},
+	}, nil
+}
+
+// Name returns "vault"
+func (v *Vault) Name() string {
+	return "vault"
+}
+
+// Secrets returns the fields of the latest version of the secret.
+// Values that are not strings are formatted as JSON.
+func (v *Vault) Secrets() (map[string]string, error) {
+	var rsp struct {
+		Data struct {
+			Data map[string]interface{} `json:"data"`
+		} `json:"data"`
+	}
+
+	if err := v.do(http.MethodGet, fmt.Sprintf("/v1/%s/data/%s", v.cfg.Mount, v.cfg.Path), &rsp); err != nil {
+		return nil, err
+	}
+
+	if rsp.Data.Data == nil {
+		return nil, errors.New("vault secret has no data")
+	}
+
+	secrets := make(map[string]string, len(rsp.Data.Data))
+	for k, value := range rsp.Data.Data {
+		switch x := value.(type) {
+		case string:
+			secrets[k] = x
+		default:
+			b, err := json.Marshal(x)
+			if err != nil {
+				return nil, err
+			}
+			secrets[k] = string(b)
+		}
+	}
+
+	return secrets, nil
+}
+
+// Renew renews the token, so that it does not expire while teller is running
+func (v *Vault) Renew() error {
+	return v.do(http.MethodPost, "/v1/auth/token/renew-self", nil)
+}
+
+// do sends an authenticated request to path and decodes the JSON response into out, unless out is nil
+func (v *Vault) do(method, path string, out interface{}) error {
+	token, err := v.token()
+	if err != nil {
+		return err
+	}
+
+	var body io.Reader
+	if method == http.MethodPost {
+		body = bytes.NewReader([]byte("{}"))
+	}
+
+	req, err := http.NewRequest(method, v.cfg.Addr+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Vault-Token", token)
+
+	rsp, err := v.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode < 200 || rsp.StatusCode > 299 {
+		// Drain the body so that the connection can be reused
+		_, _ = io.Copy(ioutil.Discard, io.LimitReader(rsp.Body, 1<<16))
+		return fmt.Errorf("vault %s %s responded with status %d", method, path, rsp.StatusCode)
+	}
+
+	if out == nil {
+		_, err := io.Copy(ioutil.Discard, io.LimitReader(rsp.Body, 1<<16))
+		return err
+	}
+
+	return json.NewDecoder(rsp.Body).Decode(out)
+}
+
+// token returns the token, read from the token file if it is set
+func (v *Vault) token() (string, error) {
+	if v.cfg.TokenFile == "" {
+		return v.cfg.Token, nil
+	}
+
+	b, err := ioutil.ReadFile(v.cfg.TokenFile)
+	if err != nil {
+		return "", fmt.Errorf("read vault token file failed: %v", err)
+	}
+
+	token := strings.TrimSpace(string(b))
+	if token == "" {
+		return "", fmt.Errorf("vault token file %s is empty", v.cfg.TokenFile)
+	}
+
+	return token, nil
+}
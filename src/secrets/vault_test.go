@@ -0,0 +1,108 @@
+package secrets
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVault(t *testing.T) {
+	var tokens []string
+	var renewed int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokens = append(tokens, r.Header.Get("X-Vault-Token"))
+
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v1/kv/data/teller/prod":
+			fmt.Fprint(w, `{"data":{"data":{"btc_rpc.pass":"pass","teller.max_bound_btc_addrs":3},"metadata":{"version":2}}}`)
+		case r.Method == http.MethodPost && r.URL.Path == "/v1/auth/token/renew-self":
+			renewed++
+			fmt.Fprint(w, `{"auth":{"client_token":"t","lease_duration":3600,"renewable":true}}`)
+		default:
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"errors":["permission denied"]}`)
+		}
+	}))
+	defer srv.Close()
+
+	v, err := NewVault(VaultConfig{
+		Addr:  srv.URL + "/",
+		Token: "token1",
+		Mount: "/kv/",
+		Path:  "teller/prod",
+	})
+	require.NoError(t, err)
+	require.Equal(t, "vault", v.Name())
+
+	secrets, err := v.Secrets()
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		"btc_rpc.pass":               "pass",
+		"teller.max_bound_btc_addrs": "3",
+	}, secrets)
+
+	require.NoError(t, v.Renew())
+	require.Equal(t, 1, renewed)
+	require.Equal(t, []string{"token1", "token1"}, tokens)
+
+	// The token file is read before each request
+	f, err := ioutil.TempFile("", "vault-token")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.WriteString("token2\n")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	v, err = NewVault(VaultConfig{
+		Addr:      srv.URL,
+		TokenFile: f.Name(),
+		Mount:     "kv",
+		Path:      "teller/prod",
+	})
+	require.NoError(t, err)
+
+	_, err = v.Secrets()
+	require.NoError(t, err)
+	require.Equal(t, "token2", tokens[len(tokens)-1])
+
+	require.NoError(t, ioutil.WriteFile(f.Name(), []byte("token3"), 0600))
+	require.NoError(t, v.Renew())
+	require.Equal(t, "token3", tokens[len(tokens)-1])
+
+	// A secret that does not exist, or isn't readable by the token
+	v, err = NewVault(VaultConfig{
+		Addr:  srv.URL,
+		Token: "token1",
+		Mount: "kv",
+		Path:  "other",
+	})
+	require.NoError(t, err)
+
+	_, err = v.Secrets()
+	require.EqualError(t, err, "vault GET /v1/kv/data/other responded with status 403")
+
+	_, err = NewVault(VaultConfig{
+		Addr:  srv.URL,
+		Mount: "kv",
+		Path:  "teller",
+	})
+	require.Error(t, err)
+}
+
+func TestChanged(t *testing.T) {
+	require.Empty(t, Changed(map[string]string{"a": "1"}, map[string]string{"a": "1"}))
+	require.Equal(t, []string{"a", "b", "c"}, Changed(map[string]string{
+		"a": "1",
+		"b": "2",
+		"d": "4",
+	}, map[string]string{
+		"a": "2",
+		"c": "3",
+		"d": "4",
+	}))
+}
@@ -0,0 +1,251 @@
+package sender
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/skycoin/skycoin/src/util/droplet"
+
+	"github.com/skycoin/teller/src/alert"
+	"github.com/skycoin/teller/src/outbox"
+)
+
+const (
+	balanceCheckPeriod = time.Minute
+
+	// TopicWalletBalanceLow is the outbox topic of the hot wallet balance falling below the low balance
+	TopicWalletBalanceLow = "wallet.balance_low"
+	// TopicWalletBalanceRestored is the outbox topic of the hot wallet balance recovering to the low balance
+	TopicWalletBalanceRestored = "wallet.balance_restored"
+)
+
+// Outbox saves messages to be relayed, e.g. to a webhook
+type Outbox interface {
+	Put(topic string, payload interface{}) (outbox.Message, error)
+}
+
+// Alerter alerts operators of events, e.g. a low balance
+type Alerter interface {
+	Notify(event, message string)
+}
+
+// BalanceConfig configures the BalanceMonitor
+type BalanceConfig struct {
+	CheckPeriod time.Duration // how often to check the hot wallet balance
+	LowBalance  uint64        // balance in droplets below which the balance is low
+	Pause       bool          // pause payouts while the balance is low
+}
+
+// BalanceStatus is the last checked hot wallet balance
+type BalanceStatus struct {
+	Coins      uint64 `json:"coins"` // measured in droplets
+	Hours      uint64 `json:"hours"`
+	LowBalance uint64 `json:"low_balance"` // measured in droplets
+	Low        bool   `json:"low"`
+	Paused     bool   `json:"paused"`
+	// Unix time of the last successful check, 0 if the balance has not been checked yet
+	CheckedAt int64  `json:"checked_at"`
+	Error     string `json:"error,omitempty"`
+}
+
+// BalanceMonitor checks the hot wallet balance periodically, and alerts when it falls below the low balance.
+// If configured to pause, it pauses payouts while the balance is low, so that sends don't pile up in retry loops,
+// and resumes them once the balance is restored.
+// It implements Resumer, so that the TopUpWatcher can resume payouts as soon as a top-up is detected.
+type BalanceMonitor struct {
+	sync.RWMutex
+	log     logrus.FieldLogger
+	cfg     BalanceConfig
+	client  WalletClient
+	outbox  Outbox
+	alerter Alerter
+	status  BalanceStatus
+	quit    chan struct{}
+	done    chan struct{}
+}
+
+// NewBalanceMonitor creates a BalanceMonitor
+func NewBalanceMonitor(log logrus.FieldLogger, client WalletClient, cfg BalanceConfig) *BalanceMonitor {
+	if cfg.CheckPeriod == 0 {
+		cfg.CheckPeriod = balanceCheckPeriod
+	}
+
+	return &BalanceMonitor{
+		log:    log.WithField("prefix", "sender.balance"),
+		cfg:    cfg,
+		client: client,
+		status: BalanceStatus{
+			LowBalance: cfg.LowBalance,
+		},
+		quit: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+}
+
+// SetOutbox sets the Outbox that low balance alerts are saved to
+func (m *BalanceMonitor) SetOutbox(o Outbox) {
+	m.outbox = o
+}
+
+// SetAlerter sets the Alerter that is alerted when the balance falls below the low balance
+func (m *BalanceMonitor) SetAlerter(a Alerter) {
+	m.alerter = a
+}
+
+// Run checks the balance every CheckPeriod until Shutdown is called
+func (m *BalanceMonitor) Run() error {
+	log := m.log.WithField("config", m.cfg)
+	log.Info("Start hot wallet balance monitor")
+	defer log.Info("Hot wallet balance monitor closed")
+	defer close(m.done)
+
+	for {
+		if _, err := m.Check(); err != nil {
+			log.WithError(err).Error("BalanceMonitor.Check failed")
+		}
+
+		select {
+		case <-m.quit:
+			return nil
+		case <-time.After(m.cfg.CheckPeriod):
+		}
+	}
+}
+
+// Shutdown stops the BalanceMonitor
+func (m *BalanceMonitor) Shutdown() {
+	close(m.quit)
+	<-m.done
+}
+
+// Status returns the last checked balance
+func (m *BalanceMonitor) Status() BalanceStatus {
+	m.RLock()
+	defer m.RUnlock()
+	return m.status
+}
+
+// Paused returns true if payouts are paused for a low balance
+func (m *BalanceMonitor) Paused() bool {
+	m.RLock()
+	defer m.RUnlock()
+	return m.status.Paused
+}
+
+// Resume resumes paused payouts. If the balance is still low, they are paused again by the next check.
+func (m *BalanceMonitor) Resume(reason string) {
+	m.Lock()
+	defer m.Unlock()
+
+	if !m.status.Paused {
+		return
+	}
+
+	m.log.WithField("reason", reason).Info("Resuming payouts")
+	m.status.Paused = false
+}
+
+// Check gets the hot wallet balance, alerts if it fell below the low balance or recovered,
+// and pauses or resumes payouts accordingly
+func (m *BalanceMonitor) Check() (BalanceStatus, error) {
+	coins, hours, err := m.balance()
+
+	m.Lock()
+	defer m.Unlock()
+
+	if err != nil {
+		m.status.Error = err.Error()
+		return m.status, err
+	}
+
+	wasLow := m.status.Low
+
+	m.status.Coins = coins
+	m.status.Hours = hours
+	m.status.Low = coins < m.cfg.LowBalance
+	m.status.CheckedAt = time.Now().UTC().Unix()
+	m.status.Error = ""
+
+	log := m.log.WithFields(logrus.Fields{
+		"balance":    coins,
+		"lowBalance": m.cfg.LowBalance,
+	})
+
+	if m.cfg.Pause {
+		if m.status.Low && !m.status.Paused {
+			log.Warning("Pausing payouts until the hot wallet is topped up")
+		} else if !m.status.Low && m.status.Paused {
+			log.Info("Resuming payouts")
+		}
+		m.status.Paused = m.status.Low
+	}
+
+	switch {
+	case m.status.Low && !wasLow:
+		log.Error("Hot wallet balance is low, top up the hot wallet")
+		m.alert(TopicWalletBalanceLow)
+		m.notifyLow()
+	case !m.status.Low && wasLow:
+		log.Info("Hot wallet balance restored")
+		m.alert(TopicWalletBalanceRestored)
+	}
+
+	return m.status, nil
+}
+
+// balance returns the coins and hours of the hot wallet's confirmed outputs
+func (m *BalanceMonitor) balance() (uint64, uint64, error) {
+	addrs := m.client.WalletAddresses()
+	if len(addrs) == 0 {
+		return 0, 0, errors.New("Wallet has no addresses")
+	}
+
+	outs, err := m.client.GetUnspentOutputs(addrs)
+	if err != nil {
+		m.log.WithError(err).Error("GetUnspentOutputs failed")
+		return 0, 0, err
+	}
+
+	bal, err := outs.Outputs.HeadOutputs.Balance()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return bal.Coins, bal.Hours, nil
+}
+
+// alert saves the status to the outbox under topic, if there is an outbox. Must be called with the lock held.
+func (m *BalanceMonitor) alert(topic string) {
+	if m.outbox == nil {
+		return
+	}
+
+	if _, err := m.outbox.Put(topic, m.status); err != nil {
+		m.log.WithError(err).WithField("topic", topic).Error("Saving balance alert to the outbox failed")
+	}
+}
+
+// notifyLow alerts the Alerter of the low balance, if there is one. Must be called with the lock held.
+func (m *BalanceMonitor) notifyLow() {
+	if m.alerter == nil {
+		return
+	}
+
+	coins, err := droplet.ToString(m.status.Coins)
+	if err != nil {
+		m.log.WithError(err).Error("droplet.ToString failed")
+		return
+	}
+
+	lowBalance, err := droplet.ToString(m.status.LowBalance)
+	if err != nil {
+		m.log.WithError(err).Error("droplet.ToString failed")
+		return
+	}
+
+	m.alerter.Notify(alert.EventWalletBalanceLow, fmt.Sprintf("Hot wallet balance is %s SKY, below the low balance of %s SKY. Top up the hot wallet.", coins, lowBalance))
+}
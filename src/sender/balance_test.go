@@ -0,0 +1,174 @@
+package sender
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/skycoin/src/api/webrpc"
+	"github.com/skycoin/skycoin/src/visor"
+
+	"github.com/skycoin/teller/src/outbox"
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+type dummyOutbox struct {
+	msgs []outbox.Message
+}
+
+func (o *dummyOutbox) Put(topic string, payload interface{}) (outbox.Message, error) {
+	v, err := json.Marshal(payload)
+	if err != nil {
+		return outbox.Message{}, err
+	}
+
+	msg := outbox.Message{
+		ID:      uint64(len(o.msgs) + 1),
+		Topic:   topic,
+		Payload: v,
+	}
+	o.msgs = append(o.msgs, msg)
+	return msg, nil
+}
+
+type dummyAlerter struct {
+	events   []string
+	messages []string
+}
+
+func (a *dummyAlerter) Notify(event, message string) {
+	a.events = append(a.events, event)
+	a.messages = append(a.messages, message)
+}
+
+type failingWalletClient struct {
+	dummyWalletClient
+}
+
+func (c *failingWalletClient) GetUnspentOutputs(addrs []string) (*webrpc.OutputsResult, error) {
+	return nil, errors.New("connection refused")
+}
+
+func setWalletCoins(c *dummyWalletClient, coins string) {
+	c.outs = visor.ReadableOutputs{
+		{
+			Hash:              "out1",
+			SourceTransaction: "tx1",
+			Address:           c.addrs[0],
+			Coins:             coins,
+			Hours:             10,
+		},
+	}
+}
+
+func TestBalanceMonitorCheck(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+
+	client := &dummyWalletClient{
+		addrs: []string{"2do3K1YLMy3Aq6EcPMdncEurP5BfAUdFPJj"},
+	}
+	setWalletCoins(client, "100.000000")
+
+	ob := &dummyOutbox{}
+	al := &dummyAlerter{}
+	m := NewBalanceMonitor(log, client, BalanceConfig{
+		LowBalance: 50e6,
+		Pause:      true,
+	})
+	m.SetOutbox(ob)
+	m.SetAlerter(al)
+
+	require.Zero(t, m.Status().CheckedAt)
+
+	st, err := m.Check()
+	require.NoError(t, err)
+	require.Equal(t, uint64(100e6), st.Coins)
+	require.Equal(t, uint64(10), st.Hours)
+	require.Equal(t, uint64(50e6), st.LowBalance)
+	require.False(t, st.Low)
+	require.False(t, m.Paused())
+	require.NotZero(t, st.CheckedAt)
+	require.Empty(t, ob.msgs)
+	require.Empty(t, al.events)
+
+	// A low balance alerts once, and pauses payouts
+	setWalletCoins(client, "10.000000")
+
+	for i := 0; i < 2; i++ {
+		st, err = m.Check()
+		require.NoError(t, err)
+		require.True(t, st.Low)
+		require.True(t, m.Paused())
+	}
+
+	require.Len(t, ob.msgs, 1)
+	require.Equal(t, TopicWalletBalanceLow, ob.msgs[0].Topic)
+
+	var alert BalanceStatus
+	require.NoError(t, json.Unmarshal(ob.msgs[0].Payload, &alert))
+	require.Equal(t, st, alert)
+
+	require.Equal(t, []string{"wallet_balance_low"}, al.events)
+	require.Equal(t, []string{"Hot wallet balance is 10.000000 SKY, below the low balance of 50.000000 SKY. Top up the hot wallet."}, al.messages)
+
+	// A resume while the balance is still low only lasts until the next check
+	m.Resume("hot wallet topped up")
+	require.False(t, m.Paused())
+
+	_, err = m.Check()
+	require.NoError(t, err)
+	require.True(t, m.Paused())
+
+	// Restoring the balance alerts and resumes payouts
+	setWalletCoins(client, "50.000000")
+
+	st, err = m.Check()
+	require.NoError(t, err)
+	require.False(t, st.Low)
+	require.False(t, m.Paused())
+
+	require.Len(t, ob.msgs, 2)
+	require.Equal(t, TopicWalletBalanceRestored, ob.msgs[1].Topic)
+	require.Len(t, al.events, 1)
+}
+
+func TestBalanceMonitorNoPause(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+
+	client := &dummyWalletClient{
+		addrs: []string{"2do3K1YLMy3Aq6EcPMdncEurP5BfAUdFPJj"},
+	}
+	setWalletCoins(client, "10.000000")
+
+	m := NewBalanceMonitor(log, client, BalanceConfig{
+		LowBalance: 50e6,
+	})
+
+	// Without an outbox or pausing, a low balance is only logged and reported
+	st, err := m.Check()
+	require.NoError(t, err)
+	require.True(t, st.Low)
+	require.False(t, st.Paused)
+	require.False(t, m.Paused())
+}
+
+func TestBalanceMonitorCheckError(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+
+	client := &failingWalletClient{}
+	client.addrs = []string{"2do3K1YLMy3Aq6EcPMdncEurP5BfAUdFPJj"}
+
+	m := NewBalanceMonitor(log, client, BalanceConfig{
+		LowBalance: 50e6,
+		Pause:      true,
+	})
+
+	// A failed check keeps the last balance, and doesn't pause payouts
+	st, err := m.Check()
+	require.Error(t, err)
+	require.Equal(t, "connection refused", st.Error)
+	require.Zero(t, st.CheckedAt)
+	require.False(t, m.Paused())
+}
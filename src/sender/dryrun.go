@@ -0,0 +1,80 @@
+package sender
+
+import (
+	"github.com/sirupsen/logrus"
+
+	"github.com/skycoin/skycoin/src/coin"
+	"github.com/skycoin/skycoin/src/util/droplet"
+)
+
+// DryRunSender wraps a Sender to simulate SKY sendouts. Transactions are created and signed by
+// the wrapped Sender, so that the hot wallet balance and signer are exercised, but they are
+// logged instead of broadcast, and reported as confirmed so that deposits complete.
+type DryRunSender struct {
+	sender Sender
+	log    logrus.FieldLogger
+}
+
+// NewDryRunSender creates a DryRunSender
+func NewDryRunSender(log logrus.FieldLogger, sender Sender) *DryRunSender {
+	return &DryRunSender{
+		sender: sender,
+		log:    log.WithField("prefix", "sender.dryrun"),
+	}
+}
+
+// CreateTransaction creates a transaction with the wrapped Sender
+func (s *DryRunSender) CreateTransaction(addr string, coins uint64) (*coin.Transaction, error) {
+	return s.sender.CreateTransaction(addr, coins)
+}
+
+// CreateBatchTransaction creates a transaction with the wrapped Sender
+func (s *DryRunSender) CreateBatchTransaction(amounts []SendAmount) (*coin.Transaction, error) {
+	return s.sender.CreateBatchTransaction(amounts)
+}
+
+// BroadcastTransaction logs the outputs of the transaction, without broadcasting it
+func (s *DryRunSender) BroadcastTransaction(txn *coin.Transaction) *BroadcastTxResponse {
+	txid := txn.TxIDHex()
+	log := s.log.WithField("txid", txid)
+
+	for _, o := range txn.Out {
+		coins, err := droplet.ToString(o.Coins)
+		if err != nil {
+			log.WithError(err).Error("droplet.ToString failed")
+			coins = ""
+		}
+
+		log.WithFields(logrus.Fields{
+			"addr":     o.Address.String(),
+			"droplets": o.Coins,
+			"coins":    coins,
+		}).Info("Dry run, would send")
+	}
+
+	log.Info("Dry run, transaction not broadcast")
+
+	return &BroadcastTxResponse{
+		Txid: txid,
+		Req: BroadcastTxRequest{
+			Tx:   txn,
+			RspC: make(chan *BroadcastTxResponse, 1),
+		},
+	}
+}
+
+// IsTxConfirmed reports every transaction as confirmed, since a dry run's transactions are never broadcast
+func (s *DryRunSender) IsTxConfirmed(txid string) *ConfirmResponse {
+	return &ConfirmResponse{
+		Confirmed: true,
+		Req: ConfirmRequest{
+			Txid: txid,
+			RspC: make(chan *ConfirmResponse, 1),
+		},
+	}
+}
+
+// GetTransactionStatus reports every transaction as confirmed, like IsTxConfirmed
+func (s *DryRunSender) GetTransactionStatus(txid string) (TxStatus, error) {
+	return TxConfirmed, nil
+}
@@ -0,0 +1,51 @@
+package sender
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+func TestDryRunSender(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+
+	dummy := NewDummySender(log)
+	s := NewDryRunSender(log, dummy)
+
+	addr := "2VZu3rZozQ6nN37YSdj3EZJV7wSFVuLSm2X"
+	addr2 := "2do3K1YLMy3Aq6EcPMdncEurP5BfAUdFPJj"
+
+	// Transactions are created by the wrapped sender
+	txn, err := s.CreateBatchTransaction([]SendAmount{
+		{Addr: addr, Coins: 100},
+		{Addr: addr2, Coins: 200},
+	})
+	require.NoError(t, err)
+	require.Len(t, txn.Out, 2)
+	require.Equal(t, addr2, txn.Out[1].Address.String())
+
+	_, err = s.CreateTransaction("bad", 100)
+	require.Error(t, err)
+
+	// Transactions are not broadcast by the wrapped sender
+	bRsp := s.BroadcastTransaction(txn)
+	require.NoError(t, bRsp.Err)
+	require.Equal(t, txn.TxIDHex(), bRsp.Txid)
+	require.Empty(t, dummy.getBroadcastedTransactions())
+
+	// Broadcasting again succeeds too, e.g. after a restart
+	bRsp = s.BroadcastTransaction(txn)
+	require.NoError(t, bRsp.Err)
+
+	// Transactions are confirmed right away
+	cRsp := s.IsTxConfirmed(txn.TxIDHex())
+	require.NoError(t, cRsp.Err)
+	require.True(t, cRsp.Confirmed)
+	require.Equal(t, txn.TxIDHex(), cRsp.Req.Txid)
+
+	st, err := s.GetTransactionStatus(txn.TxIDHex())
+	require.NoError(t, err)
+	require.Equal(t, TxConfirmed, st)
+}
@@ -58,22 +58,38 @@ func NewDummySender(log logrus.FieldLogger) *DummySender {
 
 // CreateTransaction creates a fake skycoin transaction
 func (s *DummySender) CreateTransaction(addr string, coins uint64) (*coin.Transaction, error) {
-	c, err := droplet.ToString(coins)
-	if err != nil {
-		s.log.WithError(err).Error("droplet.ToString failed")
-		return nil, err
-	}
+	return s.CreateBatchTransaction([]SendAmount{
+		{
+			Addr:  addr,
+			Coins: coins,
+		},
+	})
+}
 
-	s.log.WithFields(logrus.Fields{
-		"addr":     addr,
-		"droplets": coins,
-		"coins":    c,
-	}).Info("CreateTransaction")
+// CreateBatchTransaction creates a fake skycoin transaction with an output for each send amount
+func (s *DummySender) CreateBatchTransaction(amounts []SendAmount) (*coin.Transaction, error) {
+	txn := &coin.Transaction{}
 
-	a, err := cipher.DecodeBase58Address(addr)
-	if err != nil {
-		s.log.WithError(err).Error("CreateTransaction called with invalid address")
-		return nil, err
+	for _, amt := range amounts {
+		c, err := droplet.ToString(amt.Coins)
+		if err != nil {
+			s.log.WithError(err).Error("droplet.ToString failed")
+			return nil, err
+		}
+
+		s.log.WithFields(logrus.Fields{
+			"addr":     amt.Addr,
+			"droplets": amt.Coins,
+			"coins":    c,
+		}).Info("CreateTransaction")
+
+		a, err := cipher.DecodeBase58Address(amt.Addr)
+		if err != nil {
+			s.log.WithError(err).Error("CreateTransaction called with invalid address")
+			return nil, err
+		}
+
+		txn.PushOutput(a, amt.Coins, 0)
 	}
 
 	randomInput, err := randSHA256()
@@ -82,9 +98,7 @@ func (s *DummySender) CreateTransaction(addr string, coins uint64) (*coin.Transa
 		return nil, err
 	}
 
-	txn := &coin.Transaction{}
 	txn.PushInput(randomInput)
-	txn.PushOutput(a, coins, 0)
 	txn.SignInputs([]cipher.SecKey{s.secKey})
 	return txn, nil
 }
@@ -103,7 +117,7 @@ func (s *DummySender) BroadcastTransaction(txn *coin.Transaction) *BroadcastTxRe
 
 	if _, ok := s.broadcastTxns[txn.TxIDHex()]; ok {
 		return &BroadcastTxResponse{
-			Err: fmt.Errorf("Transaction %s was already broadcast"),
+			Err: fmt.Errorf("Transaction %s was already broadcast", txn.TxIDHex()),
 			Req: req,
 		}
 	}
@@ -141,6 +155,25 @@ func (s *DummySender) IsTxConfirmed(txid string) *ConfirmResponse {
 	}
 }
 
+// GetTransactionStatus returns the status of a fake skycoin transaction
+func (s *DummySender) GetTransactionStatus(txid string) (TxStatus, error) {
+	s.log.WithField("txid", txid).Info("GetTransactionStatus")
+
+	s.RLock()
+	defer s.RUnlock()
+
+	txn := s.broadcastTxns[txid]
+
+	switch {
+	case txn == nil:
+		return TxNotFound, nil
+	case txn.Confirmed:
+		return TxConfirmed, nil
+	default:
+		return TxUnconfirmed, nil
+	}
+}
+
 // HTTP interface
 
 // BindHandlers binds admin API handlers to the mux
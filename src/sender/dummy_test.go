@@ -29,6 +29,18 @@ func TestDummySender(t *testing.T) {
 	require.NoError(t, err)
 	require.NotEqual(t, txn.TxIDHex(), txn2.TxIDHex())
 
+	// A batch txn has an output for each send amount
+	addr2 := "2do3K1YLMy3Aq6EcPMdncEurP5BfAUdFPJj"
+	txn3, err := s.CreateBatchTransaction([]SendAmount{
+		{Addr: addr, Coins: coins},
+		{Addr: addr2, Coins: 200},
+	})
+	require.NoError(t, err)
+	require.Len(t, txn3.Out, 2)
+	require.Equal(t, addr, txn3.Out[0].Address.String())
+	require.Equal(t, addr2, txn3.Out[1].Address.String())
+	require.Equal(t, uint64(200), txn3.Out[1].Coins)
+
 	bRsp := s.BroadcastTransaction(txn)
 	require.NotNil(t, bRsp)
 	require.NoError(t, bRsp.Err)
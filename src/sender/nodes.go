@@ -0,0 +1,332 @@
+package sender
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/skycoin/skycoin/src/api/webrpc"
+)
+
+const (
+	nodeCheckPeriod = time.Second * 30
+	nodeMinBackoff  = time.Second * 5
+	nodeMaxBackoff  = time.Minute * 5
+
+	// maxNodeLag is how many blocks a node can be behind the best node and still be considered synced
+	maxNodeLag = 5
+)
+
+// ErrNoHealthyNodes is returned by SkyNodes if every node is down or backing off
+var ErrNoHealthyNodes = errors.New("No healthy skycoin nodes")
+
+// NodesConfig configures SkyNodes
+type NodesConfig struct {
+	CheckPeriod time.Duration // how often to check the nodes
+	MaxBackoff  time.Duration // maximum wait before a failed node is tried again
+}
+
+// NodeStatus is the health of a skycoin node
+type NodeStatus struct {
+	Address  string `json:"address"`
+	Active   bool   `json:"active"`
+	Healthy  bool   `json:"healthy"`
+	Synced   bool   `json:"synced"`
+	BlockNum uint64 `json:"block_num"`
+	Error    string `json:"error,omitempty"`
+	// Unix time before which the failed node is not tried again
+	RetryAt int64 `json:"retry_at,omitempty"`
+}
+
+type skyNode struct {
+	addr     string
+	err      error
+	synced   bool
+	blockNum uint64
+	failures int
+	retryAt  time.Time
+}
+
+// newClient returns a client of the node. A client is created per call, since webrpc.Client is not safe for concurrent use.
+func (n *skyNode) newClient() *webrpc.Client {
+	return &webrpc.Client{
+		Addr: n.addr,
+	}
+}
+
+func (n *skyNode) usable() bool {
+	return n.err == nil && n.synced
+}
+
+// SkyNodes calls one of several skycoin nodes, the active node. The active node is the first node that is
+// healthy and synced, so the first node is preferred. A node is synced if it is at most 5 blocks behind
+// the node with the most blocks.
+// Calls that fail to reach a node are retried on the next usable node. A failed node is not called again until it
+// passes a health check after an exponential backoff, so a node that is down is retried less and less often.
+type SkyNodes struct {
+	sync.RWMutex
+	log    logrus.FieldLogger
+	cfg    NodesConfig
+	nodes  []*skyNode
+	active int
+	quit   chan struct{}
+	done   chan struct{}
+}
+
+// NewSkyNodes creates SkyNodes for the webrpc addresses of the nodes, in order of preference.
+// All nodes are assumed to be healthy and synced until the first check.
+func NewSkyNodes(log logrus.FieldLogger, addrs []string, cfg NodesConfig) (*SkyNodes, error) {
+	if len(addrs) == 0 {
+		return nil, errors.New("No skycoin node addresses")
+	}
+
+	if cfg.CheckPeriod == 0 {
+		cfg.CheckPeriod = nodeCheckPeriod
+	}
+
+	if cfg.MaxBackoff == 0 {
+		cfg.MaxBackoff = nodeMaxBackoff
+	}
+
+	nodes := make([]*skyNode, len(addrs))
+	for i, a := range addrs {
+		nodes[i] = &skyNode{
+			addr:   a,
+			synced: true,
+		}
+	}
+
+	return &SkyNodes{
+		log:   log.WithField("prefix", "sender.nodes"),
+		cfg:   cfg,
+		nodes: nodes,
+		quit:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}, nil
+}
+
+// Run checks the nodes every CheckPeriod until Shutdown is called
+func (s *SkyNodes) Run() error {
+	log := s.log.WithField("config", s.cfg)
+	log.Info("Start skycoin node health checks")
+	defer log.Info("Skycoin node health checks closed")
+	defer close(s.done)
+
+	for {
+		s.Check()
+
+		select {
+		case <-s.quit:
+			return nil
+		case <-time.After(s.cfg.CheckPeriod):
+		}
+	}
+}
+
+// Shutdown stops the health checks
+func (s *SkyNodes) Shutdown() {
+	close(s.quit)
+	<-s.done
+}
+
+// Check gets the status of every node that is not backing off, and makes the first usable node active
+func (s *SkyNodes) Check() {
+	now := time.Now()
+
+	s.RLock()
+	var check []*skyNode
+	for _, n := range s.nodes {
+		if n.err == nil || !now.Before(n.retryAt) {
+			check = append(check, n)
+		}
+	}
+	s.RUnlock()
+
+	statuses := make([]*webrpc.StatusResult, len(check))
+	errs := make([]error, len(check))
+
+	var wg sync.WaitGroup
+	for i, n := range check {
+		wg.Add(1)
+		go func(i int, n *skyNode) {
+			defer wg.Done()
+			statuses[i], errs[i] = n.newClient().GetStatus()
+			if errs[i] == nil && !statuses[i].Running {
+				errs[i] = errors.New("Node is not running")
+			}
+		}(i, n)
+	}
+	wg.Wait()
+
+	s.Lock()
+	defer s.Unlock()
+
+	for i, n := range check {
+		if errs[i] != nil {
+			s.nodeFailed(n, errs[i])
+			continue
+		}
+
+		if n.err != nil {
+			s.log.WithField("node", n.addr).Info("Skycoin node is healthy")
+		}
+		n.err = nil
+		n.failures = 0
+		n.blockNum = statuses[i].BlockNum
+	}
+
+	var best uint64
+	for _, n := range s.nodes {
+		if n.err == nil && n.blockNum > best {
+			best = n.blockNum
+		}
+	}
+
+	for _, n := range s.nodes {
+		if n.err != nil {
+			continue
+		}
+
+		synced := n.blockNum+maxNodeLag >= best
+		if n.synced && !synced {
+			s.log.WithFields(logrus.Fields{
+				"node":     n.addr,
+				"blockNum": n.blockNum,
+				"best":     best,
+			}).Warning("Skycoin node is not synced")
+		}
+		n.synced = synced
+	}
+
+	s.failover()
+}
+
+// Statuses returns the health of the nodes, in order
+func (s *SkyNodes) Statuses() []NodeStatus {
+	s.RLock()
+	defer s.RUnlock()
+
+	sts := make([]NodeStatus, len(s.nodes))
+	for i, n := range s.nodes {
+		sts[i] = NodeStatus{
+			Address:  n.addr,
+			Active:   i == s.active,
+			Healthy:  n.err == nil,
+			Synced:   n.synced,
+			BlockNum: n.blockNum,
+		}
+		if n.err != nil {
+			sts[i].Error = n.err.Error()
+			sts[i].RetryAt = n.retryAt.UTC().Unix()
+		}
+	}
+
+	return sts
+}
+
+// Call calls f with the client of the active node. If f fails to reach the node, the node is backed off
+// and f is called with the next usable node. Other errors are returned as is.
+func (s *SkyNodes) Call(f func(*webrpc.Client) error) error {
+	tried := make(map[*skyNode]struct{}, len(s.nodes))
+	err := ErrNoHealthyNodes
+
+	for {
+		n := s.nextNode(tried)
+		if n == nil {
+			return err
+		}
+		tried[n] = struct{}{}
+
+		err = f(n.newClient())
+		if !isNodeError(err) {
+			return err
+		}
+
+		s.Lock()
+		s.nodeFailed(n, err)
+		if n == s.nodes[s.active] {
+			s.failover()
+		}
+		s.Unlock()
+	}
+}
+
+// nextNode returns the active node if it is usable and not in tried, or else the first usable node not in tried
+func (s *SkyNodes) nextNode(tried map[*skyNode]struct{}) *skyNode {
+	s.RLock()
+	defer s.RUnlock()
+
+	if n := s.nodes[s.active]; n.usable() {
+		if _, ok := tried[n]; !ok {
+			return n
+		}
+	}
+
+	for _, n := range s.nodes {
+		if _, ok := tried[n]; !ok && n.usable() {
+			return n
+		}
+	}
+
+	return nil
+}
+
+// nodeFailed marks n as failed and backs it off. Must be called with the lock held.
+func (s *SkyNodes) nodeFailed(n *skyNode, err error) {
+	// A call can fail on a node after a concurrent call already backed it off
+	if n.err != nil && time.Now().Before(n.retryAt) {
+		return
+	}
+
+	n.failures++
+	backoff := nodeMinBackoff
+	for i := 1; i < n.failures && backoff < s.cfg.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > s.cfg.MaxBackoff {
+		backoff = s.cfg.MaxBackoff
+	}
+
+	n.err = err
+	n.retryAt = time.Now().Add(backoff)
+
+	s.log.WithError(err).WithFields(logrus.Fields{
+		"node":     n.addr,
+		"failures": n.failures,
+		"backoff":  backoff,
+	}).Warning("Skycoin node failed")
+}
+
+// failover makes the first usable node active. The active node stays unchanged if there is none.
+// Must be called with the lock held.
+func (s *SkyNodes) failover() {
+	for i, n := range s.nodes {
+		if !n.usable() {
+			continue
+		}
+
+		if i != s.active {
+			s.log.WithFields(logrus.Fields{
+				"from": s.nodes[s.active].addr,
+				"to":   n.addr,
+			}).Warning("Switching active skycoin node")
+			s.active = i
+		}
+		return
+	}
+
+	s.log.WithField("node", s.nodes[s.active].addr).Error("No healthy, synced skycoin node to switch to")
+}
+
+// isNodeError returns true if err means the node could not be reached, rather than the node returning an error
+func isNodeError(err error) bool {
+	switch err.(type) {
+	case *url.Error, net.Error:
+		return true
+	}
+	return false
+}
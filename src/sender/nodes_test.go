@@ -0,0 +1,283 @@
+package sender
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/skycoin/src/api/webrpc"
+
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+// dummySkyNode is a skycoin node webrpc server
+type dummySkyNode struct {
+	sync.Mutex
+	srv      *httptest.Server
+	down     bool
+	blockNum uint64
+	calls    map[string]int
+}
+
+func newDummySkyNode(blockNum uint64) *dummySkyNode {
+	n := &dummySkyNode{
+		blockNum: blockNum,
+		calls:    make(map[string]int),
+	}
+	n.srv = httptest.NewServer(http.HandlerFunc(n.handle))
+	return n
+}
+
+func (n *dummySkyNode) addr() string {
+	return strings.TrimPrefix(n.srv.URL, "http://")
+}
+
+func (n *dummySkyNode) set(f func(n *dummySkyNode)) {
+	n.Lock()
+	defer n.Unlock()
+	f(n)
+}
+
+func (n *dummySkyNode) getCalls(method string) int {
+	n.Lock()
+	defer n.Unlock()
+	return n.calls[method]
+}
+
+func (n *dummySkyNode) handle(w http.ResponseWriter, r *http.Request) {
+	var req webrpc.Request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	n.Lock()
+	n.calls[req.Method]++
+	down := n.down
+	blockNum := n.blockNum
+	n.Unlock()
+
+	// A node that is down drops the connection
+	if down {
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err == nil {
+			conn.Close()
+		}
+		return
+	}
+
+	rsp := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      req.ID,
+	}
+
+	switch req.Method {
+	case "get_status":
+		rsp["result"] = webrpc.StatusResult{
+			Running:  true,
+			BlockNum: blockNum,
+		}
+	case "get_transaction":
+		rsp["error"] = webrpc.RPCError{
+			Code:    -32600,
+			Message: "transaction doesn't exist",
+		}
+	default:
+		rsp["error"] = webrpc.RPCError{
+			Code:    -32601,
+			Message: "method not found",
+		}
+	}
+
+	json.NewEncoder(w).Encode(rsp) // nolint: errcheck
+}
+
+func getTransaction(s *SkyNodes) error {
+	return s.Call(func(c *webrpc.Client) error {
+		_, err := c.GetTransactionByID("abc")
+		return err
+	})
+}
+
+func TestSkyNodesFailover(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+
+	_, err := NewSkyNodes(log, nil, NodesConfig{})
+	require.Error(t, err)
+
+	n0 := newDummySkyNode(100)
+	defer n0.srv.Close()
+	n1 := newDummySkyNode(100)
+	defer n1.srv.Close()
+
+	s, err := NewSkyNodes(log, []string{n0.addr(), n1.addr()}, NodesConfig{})
+	require.NoError(t, err)
+
+	// Errors returned by the node are not retried
+	err = getTransaction(s)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "transaction doesn't exist")
+	require.Equal(t, 1, n0.getCalls("get_transaction"))
+	require.Equal(t, 0, n1.getCalls("get_transaction"))
+
+	// A node that can't be reached is backed off, and the call is retried on the next node
+	n0.set(func(n *dummySkyNode) {
+		n.down = true
+	})
+
+	err = getTransaction(s)
+	require.Contains(t, err.Error(), "transaction doesn't exist")
+	require.Equal(t, 2, n0.getCalls("get_transaction"))
+	require.Equal(t, 1, n1.getCalls("get_transaction"))
+
+	sts := s.Statuses()
+	require.False(t, sts[0].Healthy)
+	require.False(t, sts[0].Active)
+	require.NotEmpty(t, sts[0].Error)
+	require.True(t, sts[0].RetryAt > time.Now().Unix())
+	require.True(t, sts[1].Active)
+
+	// The failed node is not called while it is backing off
+	require.Error(t, getTransaction(s))
+	require.Equal(t, 2, n0.getCalls("get_transaction"))
+	require.Equal(t, 2, n1.getCalls("get_transaction"))
+
+	s.Check()
+	require.Equal(t, 0, n0.getCalls("get_status"))
+	require.Equal(t, 1, n1.getCalls("get_status"))
+
+	// A failed check after the backoff backs the node off for longer
+	s.Lock()
+	s.nodes[0].retryAt = time.Now()
+	s.Unlock()
+
+	s.Check()
+	require.Equal(t, 1, n0.getCalls("get_status"))
+
+	s.RLock()
+	require.Equal(t, 2, s.nodes[0].failures)
+	require.True(t, s.nodes[0].retryAt.After(time.Now().Add(nodeMinBackoff)))
+	s.RUnlock()
+
+	// The first node becomes active again once it passes a check
+	n0.set(func(n *dummySkyNode) {
+		n.down = false
+	})
+
+	s.Lock()
+	s.nodes[0].retryAt = time.Now()
+	s.Unlock()
+
+	s.Check()
+	sts = s.Statuses()
+	require.True(t, sts[0].Healthy)
+	require.True(t, sts[0].Active)
+	require.Empty(t, sts[0].Error)
+
+	require.Error(t, getTransaction(s))
+	require.Equal(t, 3, n0.getCalls("get_transaction"))
+
+	// If no node can be reached, calls fail until a node passes a check
+	n0.set(func(n *dummySkyNode) {
+		n.down = true
+	})
+	n1.set(func(n *dummySkyNode) {
+		n.down = true
+	})
+
+	err = getTransaction(s)
+	require.Error(t, err)
+	require.NotEqual(t, ErrNoHealthyNodes, err)
+
+	require.Equal(t, ErrNoHealthyNodes, getTransaction(s))
+}
+
+func TestSkyNodesSynced(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+
+	n0 := newDummySkyNode(100)
+	defer n0.srv.Close()
+	n1 := newDummySkyNode(100 + maxNodeLag + 1)
+	defer n1.srv.Close()
+
+	s, err := NewSkyNodes(log, []string{n0.addr(), n1.addr()}, NodesConfig{})
+	require.NoError(t, err)
+
+	// A node that is behind is not used
+	s.Check()
+	sts := s.Statuses()
+	require.True(t, sts[0].Healthy)
+	require.False(t, sts[0].Synced)
+	require.Equal(t, uint64(100), sts[0].BlockNum)
+	require.True(t, sts[1].Synced)
+	require.True(t, sts[1].Active)
+
+	require.Error(t, getTransaction(s))
+	require.Equal(t, 0, n0.getCalls("get_transaction"))
+	require.Equal(t, 1, n1.getCalls("get_transaction"))
+
+	// Once it catches up, it is preferred again
+	n0.set(func(n *dummySkyNode) {
+		n.blockNum = 100 + maxNodeLag
+	})
+
+	s.Check()
+	sts = s.Statuses()
+	require.True(t, sts[0].Synced)
+	require.True(t, sts[0].Active)
+}
+
+func TestSkyNodesBackoff(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+
+	s, err := NewSkyNodes(log, []string{"127.0.0.1:1"}, NodesConfig{
+		MaxBackoff: nodeMinBackoff * 3,
+	})
+	require.NoError(t, err)
+
+	n := s.nodes[0]
+	var backoffs []time.Duration
+	for i := 0; i < 4; i++ {
+		n.retryAt = time.Time{}
+		s.nodeFailed(n, ErrNoHealthyNodes)
+		backoffs = append(backoffs, time.Until(n.retryAt).Round(time.Second))
+	}
+
+	require.Equal(t, []time.Duration{
+		nodeMinBackoff,
+		nodeMinBackoff * 2,
+		nodeMinBackoff * 3,
+		nodeMinBackoff * 3,
+	}, backoffs)
+}
+
+func TestSkyNodesRun(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+
+	n0 := newDummySkyNode(100)
+	defer n0.srv.Close()
+
+	s, err := NewSkyNodes(log, []string{n0.addr()}, NodesConfig{
+		CheckPeriod: time.Millisecond * 10,
+	})
+	require.NoError(t, err)
+
+	done := make(chan error)
+	go func() {
+		done <- s.Run()
+	}()
+
+	for i := 0; i < 100 && n0.getCalls("get_status") < 2; i++ {
+		time.Sleep(time.Millisecond * 10)
+	}
+	require.True(t, n0.getCalls("get_status") >= 2)
+
+	s.Shutdown()
+	require.NoError(t, <-done)
+}
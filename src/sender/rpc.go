@@ -3,11 +3,11 @@ package sender
 import (
 	"errors"
 
-	"github.com/skycoin/skycoin/src/api/cli"
 	"github.com/skycoin/skycoin/src/api/webrpc"
 	"github.com/skycoin/skycoin/src/cipher"
 	"github.com/skycoin/skycoin/src/coin"
-	"github.com/skycoin/skycoin/src/wallet"
+
+	"github.com/skycoin/teller/src/signer"
 )
 
 // RPCError wraps errors from the skycoin CLI/RPC library
@@ -17,47 +17,65 @@ type RPCError struct {
 
 // RPC provides methods for sending coins
 type RPC struct {
-	walletFile string
-	changeAddr string
-	rpcClient  *webrpc.Client
+	signer signer.TxSigner
+	addrs  []string
+	nodes  *SkyNodes
 }
 
-// NewRPC creates RPC instance
-func NewRPC(wltFile, rpcAddr string) (*RPC, error) {
-	wlt, err := wallet.Load(wltFile)
+// NewRPC creates RPC instance. Transactions are signed by s, which is the local hot wallet or a remote signer.
+// Calls are made to the active node of nodes.
+func NewRPC(s signer.TxSigner, nodes *SkyNodes) (*RPC, error) {
+	addrs, err := s.Addresses()
 	if err != nil {
 		return nil, err
 	}
 
-	if len(wlt.Entries) == 0 {
+	if len(addrs) == 0 {
 		return nil, errors.New("Wallet is empty")
 	}
 
-	rpcClient := &webrpc.Client{
-		Addr: rpcAddr,
-	}
-
 	return &RPC{
-		walletFile: wltFile,
-		changeAddr: wlt.Entries[0].Address.String(),
-		rpcClient:  rpcClient,
+		signer: s,
+		addrs:  addrs,
+		nodes:  nodes,
 	}, nil
 }
 
-// CreateTransaction creates a raw Skycoin transaction offline, that can be broadcast later
+// CreateTransaction creates a signed Skycoin transaction that can be broadcast later.
+// The unspent outputs of the wallet are fetched from the node, and the signer spends them.
 func (c *RPC) CreateTransaction(recvAddr string, amount uint64) (*coin.Transaction, error) {
-	// TODO -- this can support sending to multiple receivers at once,
-	// which would be necessary if the exchange was busy
-	sendAmount := cli.SendAmount{
-		Addr:  recvAddr,
-		Coins: amount,
+	return c.CreateBatchTransaction([]SendAmount{
+		{
+			Addr:  recvAddr,
+			Coins: amount,
+		},
+	})
+}
+
+// CreateBatchTransaction creates a signed Skycoin transaction with an output for each send amount
+func (c *RPC) CreateBatchTransaction(amounts []SendAmount) (*coin.Transaction, error) {
+	if len(amounts) == 0 {
+		return nil, errors.New("No send amounts")
+	}
+
+	intents := make([]signer.Intent, len(amounts))
+	for i, amt := range amounts {
+		if err := validateSendAmount(amt); err != nil {
+			return nil, err
+		}
+
+		intents[i] = signer.Intent{
+			Address: amt.Addr,
+			Coins:   amt.Coins,
+		}
 	}
 
-	if err := validateSendAmount(sendAmount); err != nil {
+	outs, err := c.GetUnspentOutputs(c.addrs)
+	if err != nil {
 		return nil, err
 	}
 
-	txn, err := cli.CreateRawTxFromWallet(c.rpcClient, c.walletFile, c.changeAddr, []cli.SendAmount{sendAmount})
+	txn, err := c.signer.Sign(intents, outs.Outputs)
 	if err != nil {
 		return nil, RPCError{err}
 	}
@@ -67,7 +85,12 @@ func (c *RPC) CreateTransaction(recvAddr string, amount uint64) (*coin.Transacti
 
 // BroadcastTransaction broadcasts a transaction and returns its txid
 func (c *RPC) BroadcastTransaction(tx *coin.Transaction) (string, error) {
-	txid, err := c.rpcClient.InjectTransaction(tx)
+	var txid string
+	err := c.nodes.Call(func(rpcClient *webrpc.Client) error {
+		var err error
+		txid, err = rpcClient.InjectTransaction(tx)
+		return err
+	})
 	if err != nil {
 		return "", RPCError{err}
 	}
@@ -77,7 +100,12 @@ func (c *RPC) BroadcastTransaction(tx *coin.Transaction) (string, error) {
 
 // GetTransaction returns transaction by txid
 func (c *RPC) GetTransaction(txid string) (*webrpc.TxnResult, error) {
-	txn, err := c.rpcClient.GetTransactionByID(txid)
+	var txn *webrpc.TxnResult
+	err := c.nodes.Call(func(rpcClient *webrpc.Client) error {
+		var err error
+		txn, err = rpcClient.GetTransactionByID(txid)
+		return err
+	})
 	if err != nil {
 		return nil, RPCError{err}
 	}
@@ -85,7 +113,42 @@ func (c *RPC) GetTransaction(txid string) (*webrpc.TxnResult, error) {
 	return txn, nil
 }
 
-func validateSendAmount(amt cli.SendAmount) error {
+// GetAddressUxOuts returns the outputs owned by addresses, including the spent ones
+func (c *RPC) GetAddressUxOuts(addrs []string) ([]webrpc.AddrUxoutResult, error) {
+	var rs []webrpc.AddrUxoutResult
+	err := c.nodes.Call(func(rpcClient *webrpc.Client) error {
+		var err error
+		rs, err = rpcClient.GetAddressUxOuts(addrs)
+		return err
+	})
+	if err != nil {
+		return nil, RPCError{err}
+	}
+
+	return rs, nil
+}
+
+// WalletAddresses returns the addresses of the hot wallet
+func (c *RPC) WalletAddresses() []string {
+	return c.addrs
+}
+
+// GetUnspentOutputs returns the unspent outputs of addresses
+func (c *RPC) GetUnspentOutputs(addrs []string) (*webrpc.OutputsResult, error) {
+	var outs *webrpc.OutputsResult
+	err := c.nodes.Call(func(rpcClient *webrpc.Client) error {
+		var err error
+		outs, err = rpcClient.GetUnspentOutputs(addrs)
+		return err
+	})
+	if err != nil {
+		return nil, RPCError{err}
+	}
+
+	return outs, nil
+}
+
+func validateSendAmount(amt SendAmount) error {
 	// validate the recvAddr
 	if _, err := cipher.DecodeBase58Address(amt.Addr); err != nil {
 		return err
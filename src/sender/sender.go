@@ -2,7 +2,9 @@ package sender
 
 import (
 	"errors"
+	"strings"
 
+	"github.com/skycoin/skycoin/src/api/webrpc"
 	"github.com/skycoin/skycoin/src/coin"
 )
 
@@ -13,11 +15,44 @@ var (
 	ErrClosed = errors.New("Send service closed")
 )
 
+// SendAmount is an amount of skycoin to send to an address
+type SendAmount struct {
+	Addr  string
+	Coins uint64 // measured in droplets
+}
+
+// TxStatus is the status of a transaction on the skycoin node
+type TxStatus int
+
+const (
+	// TxNotFound the node does not know the transaction, it was never broadcast or was dropped
+	TxNotFound TxStatus = iota
+	// TxUnconfirmed the transaction is in the node's unconfirmed pool
+	TxUnconfirmed
+	// TxConfirmed the transaction is in a block
+	TxConfirmed
+)
+
+func (s TxStatus) String() string {
+	switch s {
+	case TxNotFound:
+		return "not_found"
+	case TxUnconfirmed:
+		return "unconfirmed"
+	case TxConfirmed:
+		return "confirmed"
+	default:
+		return "unknown"
+	}
+}
+
 // Sender provids apis for sending skycoin
 type Sender interface {
 	CreateTransaction(string, uint64) (*coin.Transaction, error)
+	CreateBatchTransaction([]SendAmount) (*coin.Transaction, error)
 	BroadcastTransaction(*coin.Transaction) *BroadcastTxResponse
 	IsTxConfirmed(string) *ConfirmResponse
+	GetTransactionStatus(string) (TxStatus, error)
 }
 
 // RetrySender provids helper function to send coins with Send service
@@ -38,6 +73,11 @@ func (s *RetrySender) CreateTransaction(recvAddr string, coins uint64) (*coin.Tr
 	return s.s.SkyClient.CreateTransaction(recvAddr, coins)
 }
 
+// CreateBatchTransaction creates a transaction offline, with an output for each send amount
+func (s *RetrySender) CreateBatchTransaction(amounts []SendAmount) (*coin.Transaction, error) {
+	return s.s.SkyClient.CreateBatchTransaction(amounts)
+}
+
 // BroadcastTransaction sends a transaction in a goroutine
 func (s *RetrySender) BroadcastTransaction(tx *coin.Transaction) *BroadcastTxResponse {
 	rspC := make(chan *BroadcastTxResponse, 1)
@@ -65,3 +105,31 @@ func (s *RetrySender) IsTxConfirmed(txid string) *ConfirmResponse {
 
 	return <-rspC
 }
+
+// GetTransactionStatus returns the status of a transaction on the skycoin node, without retrying.
+// Unlike IsTxConfirmed, a transaction the node does not know is not an error.
+func (s *RetrySender) GetTransactionStatus(txid string) (TxStatus, error) {
+	tx, err := s.s.SkyClient.GetTransaction(txid)
+	if err != nil {
+		if isTxNotFoundError(err) {
+			return TxNotFound, nil
+		}
+		return TxNotFound, err
+	}
+
+	if tx.Transaction.Status.Confirmed {
+		return TxConfirmed, nil
+	}
+
+	return TxUnconfirmed, nil
+}
+
+// isTxNotFoundError returns true if err is the error of the skycoin node's get_transaction for an unknown transaction
+func isTxNotFoundError(err error) bool {
+	if rpcErr, ok := err.(RPCError); ok {
+		err = rpcErr.error
+	}
+
+	rpcErr, ok := err.(*webrpc.RPCError)
+	return ok && strings.Contains(rpcErr.Message, "doesn't exist")
+}
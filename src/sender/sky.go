@@ -74,6 +74,7 @@ type SendService struct {
 // SkyClient defines a Skycoin RPC client interface for sending and confirming
 type SkyClient interface {
 	CreateTransaction(string, uint64) (*coin.Transaction, error)
+	CreateBatchTransaction([]SendAmount) (*coin.Transaction, error)
 	BroadcastTransaction(*coin.Transaction) (string, error)
 	GetTransaction(string) (*webrpc.TxnResult, error)
 }
@@ -8,7 +8,6 @@ import (
 
 	"github.com/stretchr/testify/require"
 
-	"github.com/skycoin/skycoin/src/api/cli"
 	"github.com/skycoin/skycoin/src/api/webrpc"
 	"github.com/skycoin/skycoin/src/cipher"
 	"github.com/skycoin/skycoin/src/coin"
@@ -42,6 +41,24 @@ func (ds *dummySkycli) CreateTransaction(destAddr string, coins uint64) (*coin.T
 	return ds.createTransaction(destAddr, coins)
 }
 
+func (ds *dummySkycli) CreateBatchTransaction(amounts []SendAmount) (*coin.Transaction, error) {
+	if ds.createTxErr != nil {
+		return nil, ds.createTxErr
+	}
+
+	tx := &coin.Transaction{}
+	for _, amt := range amounts {
+		addr, err := cipher.DecodeBase58Address(amt.Addr)
+		if err != nil {
+			return nil, err
+		}
+
+		tx.PushOutput(addr, amt.Coins, 0)
+	}
+
+	return tx, nil
+}
+
 func (ds *dummySkycli) createTransaction(destAddr string, coins uint64) (*coin.Transaction, error) {
 	addr, err := cipher.DecodeBase58Address(destAddr)
 	if err != nil {
@@ -173,12 +190,12 @@ func TestSenderBroadcastTransaction(t *testing.T) {
 func TestCreateTransactionVerify(t *testing.T) {
 	var testCases = []struct {
 		name       string
-		sendAmount cli.SendAmount
+		sendAmount SendAmount
 		err        bool
 	}{
 		{
 			"valid address",
-			cli.SendAmount{
+			SendAmount{
 				Addr:  "KNtZkX2mw1UFuemv6FmEQxxhWCTWTm2Thk",
 				Coins: 1,
 			},
@@ -186,7 +203,7 @@ func TestCreateTransactionVerify(t *testing.T) {
 		},
 		{
 			"invalid address",
-			cli.SendAmount{
+			SendAmount{
 				Addr:  "addr1",
 				Coins: 1,
 			},
@@ -194,7 +211,7 @@ func TestCreateTransactionVerify(t *testing.T) {
 		},
 		{
 			"invalid coin amount",
-			cli.SendAmount{
+			SendAmount{
 				Addr:  "KNtZkX2mw1UFuemv6FmEQxxhWCTWTm2Thk",
 				Coins: 0,
 			},
@@ -209,3 +226,33 @@ func TestCreateTransactionVerify(t *testing.T) {
 		})
 	}
 }
+
+func TestRetrySenderGetTransactionStatus(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+	dsc := newDummySkycli()
+	sdr := NewRetrySender(NewService(log, dsc))
+
+	st, err := sdr.GetTransactionStatus("txid")
+	require.NoError(t, err)
+	require.Equal(t, TxUnconfirmed, st)
+
+	dsc.changeConfirmStatus(true)
+	st, err = sdr.GetTransactionStatus("txid")
+	require.NoError(t, err)
+	require.Equal(t, TxConfirmed, st)
+
+	// The node's error for an unknown transaction is not an error
+	dsc.changeGetTxErr(RPCError{&webrpc.RPCError{
+		Code:    -32600,
+		Message: "transaction doesn't exist",
+	}})
+	st, err = sdr.GetTransactionStatus("txid")
+	require.NoError(t, err)
+	require.Equal(t, TxNotFound, st)
+
+	// Other errors are returned, without retrying
+	dsc.changeGetTxErr(RPCError{errors.New("connect to node failed")})
+	_, err = sdr.GetTransactionStatus("txid")
+	require.Error(t, err)
+	require.IsType(t, RPCError{}, err)
+}
@@ -0,0 +1,203 @@
+package sender
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/sirupsen/logrus"
+
+	"github.com/skycoin/teller/src/util/dbutil"
+)
+
+var (
+	// hot wallet outputs that have been observed, output hash as key
+	walletOutputsBkt = []byte("wallet_outputs")
+
+	// ledger of detected hot wallet top-ups, output hash as key
+	walletTopUpsBkt = []byte("wallet_topups")
+
+	// state of the top-up watcher
+	walletMetaBkt = []byte("wallet_meta")
+)
+
+// baselineKey is the key in walletMetaBkt of the time the baseline outputs were recorded.
+// The baseline is marked separately from the outputs, so that a wallet with no outputs has a baseline too.
+const baselineKey = "baseline"
+
+// TopUp records an incoming transfer of SKY to the hot wallet that was
+// not created by teller itself
+type TopUp struct {
+	Seq        uint64 `json:"seq"`
+	OutputHash string `json:"output_hash"`
+	Txid       string `json:"txid"`
+	Address    string `json:"address"`
+	Coins      uint64 `json:"coins"` // measured in droplets
+	Hours      uint64 `json:"hours"`
+	DetectedAt int64  `json:"detected_at"`
+}
+
+// Store records hot wallet outputs and top-ups
+type Store struct {
+	db  *bolt.DB
+	log logrus.FieldLogger
+}
+
+// NewStore creates a sender Store
+func NewStore(log logrus.FieldLogger, db *bolt.DB) (*Store, error) {
+	if db == nil {
+		return nil, errors.New("new sender Store failed: db is nil")
+	}
+
+	if err := db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(walletOutputsBkt); err != nil {
+			return dbutil.NewCreateBucketFailedErr(walletOutputsBkt, err)
+		}
+
+		if _, err := tx.CreateBucketIfNotExists(walletTopUpsBkt); err != nil {
+			return dbutil.NewCreateBucketFailedErr(walletTopUpsBkt, err)
+		}
+
+		if _, err := tx.CreateBucketIfNotExists(walletMetaBkt); err != nil {
+			return dbutil.NewCreateBucketFailedErr(walletMetaBkt, err)
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return &Store{
+		db:  db,
+		log: log.WithField("prefix", "sender.Store"),
+	}, nil
+}
+
+// HasBaseline returns true if the baseline outputs of the wallet have been recorded by SetBaseline
+func (s *Store) HasBaseline() (bool, error) {
+	var has bool
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		has, err = dbutil.BucketHasKey(tx, walletMetaBkt, baselineKey)
+		if err != nil || has {
+			return err
+		}
+
+		// dbs written before the baseline was marked only have the outputs
+		bkt := tx.Bucket(walletOutputsBkt)
+		if bkt == nil {
+			return dbutil.NewBucketNotExistErr(walletOutputsBkt)
+		}
+
+		k, _ := bkt.Cursor().First()
+		has = k != nil
+		return nil
+	})
+	return has, err
+}
+
+// SetBaseline marks the outputs held by the wallet when the top-up watcher first ran as seen,
+// and marks the baseline as recorded, even if there are no outputs
+func (s *Store) SetBaseline(hashes []string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		for _, h := range hashes {
+			if err := dbutil.PutBucketValue(tx, walletOutputsBkt, h, ""); err != nil {
+				return err
+			}
+		}
+
+		return dbutil.PutBucketValue(tx, walletMetaBkt, baselineKey, time.Now().UTC().Unix())
+	})
+}
+
+// IsKnownOutput returns true if the output hash has been seen in the wallet before
+func (s *Store) IsKnownOutput(hash string) (bool, error) {
+	var known bool
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		known, err = dbutil.BucketHasKey(tx, walletOutputsBkt, hash)
+		return err
+	})
+	return known, err
+}
+
+// AddOutputs marks wallet outputs as seen
+func (s *Store) AddOutputs(hashes []string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		for _, h := range hashes {
+			if err := dbutil.PutBucketValue(tx, walletOutputsBkt, h, ""); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// AddTopUp records a top-up in the ledger and marks its output as seen,
+// in the same transaction. If the top-up output was already recorded, the
+// existing record is returned.
+func (s *Store) AddTopUp(t TopUp) (TopUp, error) {
+	if t.OutputHash == "" {
+		return TopUp{}, errors.New("TopUp.OutputHash missing")
+	}
+
+	var saved TopUp
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		err := dbutil.GetBucketObject(tx, walletTopUpsBkt, t.OutputHash, &saved)
+		switch err.(type) {
+		case nil:
+			return nil
+		case dbutil.ObjectNotExistErr:
+		default:
+			return err
+		}
+
+		seq, err := dbutil.NextSequence(tx, walletTopUpsBkt)
+		if err != nil {
+			return err
+		}
+
+		saved = t
+		saved.Seq = seq
+		if saved.DetectedAt == 0 {
+			saved.DetectedAt = time.Now().UTC().Unix()
+		}
+
+		if err := dbutil.PutBucketValue(tx, walletTopUpsBkt, saved.OutputHash, saved); err != nil {
+			return err
+		}
+
+		return dbutil.PutBucketValue(tx, walletOutputsBkt, saved.OutputHash, "")
+	}); err != nil {
+		return TopUp{}, err
+	}
+
+	return saved, nil
+}
+
+// GetTopUps returns all recorded top-ups, ordered by seq
+func (s *Store) GetTopUps() ([]TopUp, error) {
+	var topUps []TopUp
+
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		return dbutil.ForEach(tx, walletTopUpsBkt, func(k, v []byte) error {
+			var t TopUp
+			if err := json.Unmarshal(v, &t); err != nil {
+				return err
+			}
+
+			topUps = append(topUps, t)
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(topUps, func(i, j int) bool {
+		return topUps[i].Seq < topUps[j].Seq
+	})
+
+	return topUps, nil
+}
@@ -0,0 +1,268 @@
+package sender
+
+import (
+	"errors"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/skycoin/skycoin/src/api/webrpc"
+	"github.com/skycoin/skycoin/src/util/droplet"
+	"github.com/skycoin/skycoin/src/visor"
+)
+
+const topUpCheckPeriod = time.Minute
+
+// WalletClient provides read access to the hot wallet's outputs on the skycoin node
+type WalletClient interface {
+	WalletAddresses() []string
+	GetUnspentOutputs([]string) (*webrpc.OutputsResult, error)
+	GetAddressUxOuts([]string) ([]webrpc.AddrUxoutResult, error)
+	GetTransaction(string) (*webrpc.TxnResult, error)
+}
+
+// Resumer is notified when a top-up restores the hot wallet balance,
+// so that payouts paused for a low balance can continue
+type Resumer interface {
+	Paused() bool
+	Resume(reason string)
+}
+
+// TopUpConfig configures the TopUpWatcher
+type TopUpConfig struct {
+	CheckPeriod   time.Duration // how often to check the wallet for new outputs
+	ResumeBalance uint64        // balance in droplets at or above which paused payouts are resumed
+}
+
+// TopUpWatcher detects incoming SKY transfers to the hot wallet and records
+// them in the top-up ledger.
+//
+// A new confirmed output is considered a top-up if its source transaction did
+// not spend any output owned by the wallet's addresses. Change outputs from
+// teller's own sends always spend wallet outputs, so they are not top-ups.
+// The owned outputs are looked up in the address history of the node, since
+// the change outputs of sends between two checks are spent before they are seen.
+// On first run, all existing outputs are recorded as the baseline, which is marked as recorded
+// even if the wallet has no outputs, so that the first transfer to an empty wallet is a top-up.
+type TopUpWatcher struct {
+	log     logrus.FieldLogger
+	cfg     TopUpConfig
+	client  WalletClient
+	store   *Store
+	resumer Resumer
+	quit    chan struct{}
+	done    chan struct{}
+}
+
+// NewTopUpWatcher creates a TopUpWatcher
+func NewTopUpWatcher(log logrus.FieldLogger, store *Store, client WalletClient, cfg TopUpConfig) *TopUpWatcher {
+	if cfg.CheckPeriod == 0 {
+		cfg.CheckPeriod = topUpCheckPeriod
+	}
+
+	return &TopUpWatcher{
+		log:    log.WithField("prefix", "sender.topup"),
+		cfg:    cfg,
+		client: client,
+		store:  store,
+		quit:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+// SetResumer sets the Resumer notified when a top-up restores the balance
+func (w *TopUpWatcher) SetResumer(r Resumer) {
+	w.resumer = r
+}
+
+// Run starts the TopUpWatcher
+func (w *TopUpWatcher) Run() error {
+	log := w.log.WithField("config", w.cfg)
+	log.Info("Start hot wallet top-up watcher")
+	defer log.Info("Hot wallet top-up watcher closed")
+	defer close(w.done)
+
+	for {
+		if _, err := w.Check(); err != nil {
+			log.WithError(err).Error("TopUpWatcher.Check failed")
+		}
+
+		select {
+		case <-w.quit:
+			return nil
+		case <-time.After(w.cfg.CheckPeriod):
+		}
+	}
+}
+
+// Shutdown stops the TopUpWatcher
+func (w *TopUpWatcher) Shutdown() {
+	close(w.quit)
+	<-w.done
+}
+
+// GetTopUps returns the top-up ledger
+func (w *TopUpWatcher) GetTopUps() ([]TopUp, error) {
+	return w.store.GetTopUps()
+}
+
+// Check scans the wallet for new outputs, records any top-ups found and
+// returns them. If a top-up restores the balance to at least ResumeBalance,
+// the Resumer is resumed.
+func (w *TopUpWatcher) Check() ([]TopUp, error) {
+	addrs := w.client.WalletAddresses()
+	if len(addrs) == 0 {
+		return nil, errors.New("Wallet has no addresses")
+	}
+
+	outs, err := w.client.GetUnspentOutputs(addrs)
+	if err != nil {
+		w.log.WithError(err).Error("GetUnspentOutputs failed")
+		return nil, err
+	}
+
+	headOuts := outs.Outputs.HeadOutputs
+
+	hasBaseline, err := w.store.HasBaseline()
+	if err != nil {
+		return nil, err
+	}
+
+	// On the first run, record all existing outputs without treating
+	// them as top-ups
+	if !hasBaseline {
+		hashes := make([]string, 0, len(headOuts))
+		for _, o := range headOuts {
+			hashes = append(hashes, o.Hash)
+		}
+
+		w.log.WithField("outputsLen", len(hashes)).Info("Recording baseline hot wallet outputs")
+		return nil, w.store.SetBaseline(hashes)
+	}
+
+	var topUps []TopUp
+	var ownOutputs []string
+	// The outputs ever owned by the wallet, fetched for the first new output
+	var walletOutputs map[string]struct{}
+	for _, o := range headOuts {
+		known, err := w.store.IsKnownOutput(o.Hash)
+		if err != nil {
+			return nil, err
+		}
+		if known {
+			continue
+		}
+
+		if walletOutputs == nil {
+			walletOutputs, err = w.walletOutputs(addrs)
+			if err != nil {
+				w.log.WithError(err).Error("GetAddressUxOuts failed")
+				return nil, err
+			}
+		}
+
+		isTopUp, err := w.isTopUpOutput(o, walletOutputs)
+		if err != nil {
+			w.log.WithError(err).WithField("output", o).Error("isTopUpOutput failed")
+			return nil, err
+		}
+
+		if !isTopUp {
+			ownOutputs = append(ownOutputs, o.Hash)
+			continue
+		}
+
+		coins, err := droplet.FromString(o.Coins)
+		if err != nil {
+			return nil, err
+		}
+
+		t, err := w.store.AddTopUp(TopUp{
+			OutputHash: o.Hash,
+			Txid:       o.SourceTransaction,
+			Address:    o.Address,
+			Coins:      coins,
+			Hours:      o.Hours,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		w.log.WithField("topUp", t).Info("Detected hot wallet top-up")
+		topUps = append(topUps, t)
+	}
+
+	if len(ownOutputs) > 0 {
+		if err := w.store.AddOutputs(ownOutputs); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(topUps) > 0 {
+		bal, err := headOuts.Balance()
+		if err != nil {
+			return topUps, err
+		}
+
+		w.maybeResume(bal.Coins)
+	}
+
+	return topUps, nil
+}
+
+// walletOutputs returns the hashes of the outputs owned by the addresses, spent or not
+func (w *TopUpWatcher) walletOutputs(addrs []string) (map[string]struct{}, error) {
+	rs, err := w.client.GetAddressUxOuts(addrs)
+	if err != nil {
+		return nil, err
+	}
+
+	outs := make(map[string]struct{})
+	for _, r := range rs {
+		for _, ux := range r.UxOuts {
+			outs[ux.Uxid] = struct{}{}
+		}
+	}
+
+	return outs, nil
+}
+
+// isTopUpOutput returns true if the output's source transaction spent no
+// outputs of walletOutputs
+func (w *TopUpWatcher) isTopUpOutput(o visor.ReadableOutput, walletOutputs map[string]struct{}) (bool, error) {
+	txn, err := w.client.GetTransaction(o.SourceTransaction)
+	if err != nil {
+		return false, err
+	}
+
+	if txn == nil || txn.Transaction == nil {
+		return false, errors.New("GetTransaction returned an empty result")
+	}
+
+	for _, in := range txn.Transaction.Transaction.In {
+		if _, ok := walletOutputs[in]; ok {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+func (w *TopUpWatcher) maybeResume(balance uint64) {
+	log := w.log.WithFields(logrus.Fields{
+		"balance":       balance,
+		"resumeBalance": w.cfg.ResumeBalance,
+	})
+
+	if w.resumer == nil || !w.resumer.Paused() {
+		return
+	}
+
+	if balance < w.cfg.ResumeBalance {
+		log.Info("Hot wallet topped up, but balance is still below the resume threshold")
+		return
+	}
+
+	log.Info("Hot wallet balance restored by top-up, resuming payouts")
+	w.resumer.Resume("hot wallet topped up")
+}
@@ -0,0 +1,284 @@
+package sender
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/skycoin/src/api/webrpc"
+	"github.com/skycoin/skycoin/src/visor"
+	"github.com/skycoin/skycoin/src/visor/historydb"
+
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+type dummyWalletClient struct {
+	addrs []string
+	outs  visor.ReadableOutputs
+	spent []string            // outputs of the wallet that were spent
+	txns  map[string][]string // txid -> inputs
+}
+
+func (c *dummyWalletClient) WalletAddresses() []string {
+	return c.addrs
+}
+
+func (c *dummyWalletClient) GetUnspentOutputs(addrs []string) (*webrpc.OutputsResult, error) {
+	return &webrpc.OutputsResult{
+		Outputs: visor.ReadableOutputSet{
+			HeadOutputs: c.outs,
+		},
+	}, nil
+}
+
+func (c *dummyWalletClient) GetAddressUxOuts(addrs []string) ([]webrpc.AddrUxoutResult, error) {
+	r := webrpc.AddrUxoutResult{
+		Address: c.addrs[0],
+	}
+	for _, o := range c.outs {
+		r.UxOuts = append(r.UxOuts, &historydb.UxOutJSON{
+			Uxid:         o.Hash,
+			SrcTx:        o.SourceTransaction,
+			OwnerAddress: o.Address,
+		})
+	}
+	for _, h := range c.spent {
+		r.UxOuts = append(r.UxOuts, &historydb.UxOutJSON{
+			Uxid:         h,
+			OwnerAddress: c.addrs[0],
+		})
+	}
+	return []webrpc.AddrUxoutResult{r}, nil
+}
+
+func (c *dummyWalletClient) GetTransaction(txid string) (*webrpc.TxnResult, error) {
+	rsp := &webrpc.TxnResult{
+		Transaction: &visor.TransactionResult{},
+	}
+	rsp.Transaction.Transaction.Hash = txid
+	rsp.Transaction.Transaction.In = c.txns[txid]
+	return rsp, nil
+}
+
+type dummyResumer struct {
+	paused  bool
+	resumed int
+}
+
+func (r *dummyResumer) Paused() bool {
+	return r.paused
+}
+
+func (r *dummyResumer) Resume(reason string) {
+	r.paused = false
+	r.resumed++
+}
+
+func TestTopUpWatcherCheck(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	log, _ := testutil.NewLogger(t)
+
+	store, err := NewStore(log, db)
+	require.NoError(t, err)
+
+	client := &dummyWalletClient{
+		addrs: []string{"2do3K1YLMy3Aq6EcPMdncEurP5BfAUdFPJj"},
+		outs: visor.ReadableOutputs{
+			{
+				Hash:              "out1",
+				SourceTransaction: "tx1",
+				Address:           "2do3K1YLMy3Aq6EcPMdncEurP5BfAUdFPJj",
+				Coins:             "10.000000",
+			},
+		},
+		txns: map[string][]string{},
+	}
+
+	resumer := &dummyResumer{paused: true}
+
+	w := NewTopUpWatcher(log, store, client, TopUpConfig{
+		ResumeBalance: 50e6,
+	})
+	w.SetResumer(resumer)
+
+	// The first check records the baseline, existing outputs are not top-ups
+	topUps, err := w.Check()
+	require.NoError(t, err)
+	require.Empty(t, topUps)
+
+	// A change output from a transaction spending a wallet output is not a top-up
+	client.outs = visor.ReadableOutputs{
+		{
+			Hash:              "out2",
+			SourceTransaction: "tx2",
+			Address:           "2do3K1YLMy3Aq6EcPMdncEurP5BfAUdFPJj",
+			Coins:             "4.000000",
+		},
+	}
+	client.spent = []string{"out1"}
+	client.txns["tx2"] = []string{"out1"}
+
+	topUps, err = w.Check()
+	require.NoError(t, err)
+	require.Empty(t, topUps)
+
+	known, err := store.IsKnownOutput("out2")
+	require.NoError(t, err)
+	require.True(t, known)
+
+	// An output from an external transaction is a top-up, but the balance
+	// is not high enough to resume
+	client.outs = append(client.outs, visor.ReadableOutput{
+		Hash:              "out3",
+		SourceTransaction: "tx3",
+		Address:           "2do3K1YLMy3Aq6EcPMdncEurP5BfAUdFPJj",
+		Coins:             "20.000000",
+	})
+	client.txns["tx3"] = []string{"external1"}
+
+	topUps, err = w.Check()
+	require.NoError(t, err)
+	require.Len(t, topUps, 1)
+	require.Equal(t, "out3", topUps[0].OutputHash)
+	require.Equal(t, "tx3", topUps[0].Txid)
+	require.Equal(t, uint64(20e6), topUps[0].Coins)
+	require.True(t, resumer.paused)
+	require.Equal(t, 0, resumer.resumed)
+
+	// Repeated checks don't record the same top-up again
+	topUps, err = w.Check()
+	require.NoError(t, err)
+	require.Empty(t, topUps)
+
+	// A top-up restoring the balance resumes payouts
+	client.outs = append(client.outs, visor.ReadableOutput{
+		Hash:              "out4",
+		SourceTransaction: "tx4",
+		Address:           "2do3K1YLMy3Aq6EcPMdncEurP5BfAUdFPJj",
+		Coins:             "30.000000",
+	})
+	client.txns["tx4"] = []string{"external2"}
+
+	topUps, err = w.Check()
+	require.NoError(t, err)
+	require.Len(t, topUps, 1)
+	require.False(t, resumer.paused)
+	require.Equal(t, 1, resumer.resumed)
+
+	ledger, err := w.GetTopUps()
+	require.NoError(t, err)
+	require.Len(t, ledger, 2)
+	require.Equal(t, "out3", ledger[0].OutputHash)
+	require.Equal(t, "out4", ledger[1].OutputHash)
+	require.True(t, ledger[0].Seq < ledger[1].Seq)
+}
+
+func TestTopUpWatcherCheckEmptyWallet(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	log, _ := testutil.NewLogger(t)
+
+	store, err := NewStore(log, db)
+	require.NoError(t, err)
+
+	client := &dummyWalletClient{
+		addrs: []string{"2do3K1YLMy3Aq6EcPMdncEurP5BfAUdFPJj"},
+		txns:  map[string][]string{},
+	}
+
+	resumer := &dummyResumer{paused: true}
+
+	w := NewTopUpWatcher(log, store, client, TopUpConfig{
+		ResumeBalance: 5e6,
+	})
+	w.SetResumer(resumer)
+
+	// The baseline of a drained wallet has no outputs, but is recorded
+	topUps, err := w.Check()
+	require.NoError(t, err)
+	require.Empty(t, topUps)
+
+	hasBaseline, err := store.HasBaseline()
+	require.NoError(t, err)
+	require.True(t, hasBaseline)
+
+	// The first transfer to the empty wallet is a top-up, and resumes payouts
+	client.outs = visor.ReadableOutputs{
+		{
+			Hash:              "out1",
+			SourceTransaction: "tx1",
+			Address:           "2do3K1YLMy3Aq6EcPMdncEurP5BfAUdFPJj",
+			Coins:             "10.000000",
+		},
+	}
+	client.txns["tx1"] = []string{"external1"}
+
+	topUps, err = w.Check()
+	require.NoError(t, err)
+	require.Len(t, topUps, 1)
+	require.Equal(t, "out1", topUps[0].OutputHash)
+	require.False(t, resumer.paused)
+	require.Equal(t, 1, resumer.resumed)
+}
+
+func TestTopUpWatcherCheckChainedSends(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	log, _ := testutil.NewLogger(t)
+
+	store, err := NewStore(log, db)
+	require.NoError(t, err)
+
+	client := &dummyWalletClient{
+		addrs: []string{"2do3K1YLMy3Aq6EcPMdncEurP5BfAUdFPJj"},
+		outs: visor.ReadableOutputs{
+			{
+				Hash:              "out1",
+				SourceTransaction: "tx1",
+				Address:           "2do3K1YLMy3Aq6EcPMdncEurP5BfAUdFPJj",
+				Coins:             "100.000000",
+			},
+		},
+		txns: map[string][]string{},
+	}
+
+	resumer := &dummyResumer{paused: true}
+
+	w := NewTopUpWatcher(log, store, client, TopUpConfig{
+		ResumeBalance: 50e6,
+	})
+	w.SetResumer(resumer)
+
+	topUps, err := w.Check()
+	require.NoError(t, err)
+	require.Empty(t, topUps)
+
+	// Two sends between checks: the change output of the first send is spent
+	// by the second one before a check sees it
+	client.outs = visor.ReadableOutputs{
+		{
+			Hash:              "change2",
+			SourceTransaction: "send2",
+			Address:           "2do3K1YLMy3Aq6EcPMdncEurP5BfAUdFPJj",
+			Coins:             "80.000000",
+		},
+	}
+	client.spent = []string{"out1", "change1"}
+	client.txns["send1"] = []string{"out1"}
+	client.txns["send2"] = []string{"change1"}
+
+	// The change output of the second send is not a top-up, and doesn't resume payouts
+	topUps, err = w.Check()
+	require.NoError(t, err)
+	require.Empty(t, topUps)
+	require.True(t, resumer.paused)
+	require.Equal(t, 0, resumer.resumed)
+
+	ledger, err := w.GetTopUps()
+	require.NoError(t, err)
+	require.Empty(t, ledger)
+}
@@ -0,0 +1,120 @@
+package sentry
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Fields of a log entry that are sent as tags, so that events can be searched by them
+var tagFields = []string{"requestID", "depositID"}
+
+// Hook is a logrus.Hook that captures error, fatal and panic log entries as Sentry events.
+// The "prefix" field is the logger of the event, the error of WithError its exception,
+// and the other fields are extra data.
+type Hook struct {
+	client *Client
+}
+
+// NewHook creates a Hook
+func NewHook(client *Client) *Hook {
+	return &Hook{
+		client: client,
+	}
+}
+
+// Levels returns the error, fatal and panic levels
+func (h *Hook) Levels() []logrus.Level {
+	return []logrus.Level{
+		logrus.ErrorLevel,
+		logrus.FatalLevel,
+		logrus.PanicLevel,
+	}
+}
+
+// Fire captures a log entry. Fatal and panic entries are sent before Fire returns,
+// since the program exits after logging them.
+func (h *Hook) Fire(entry *logrus.Entry) error {
+	ev := NewEvent(entry)
+
+	switch entry.Level {
+	case logrus.FatalLevel, logrus.PanicLevel:
+		// logrus prints a send failure to stderr
+		return h.client.Send(ev)
+	default:
+		h.client.Capture(ev)
+		return nil
+	}
+}
+
+// NewEvent creates the Sentry event of a log entry
+func NewEvent(entry *logrus.Entry) Event {
+	ev := Event{
+		Timestamp: entry.Time.UTC().Format("2006-01-02T15:04:05"),
+		Level:     eventLevel(entry.Level),
+		Message:   entry.Message,
+		Tags:      make(map[string]string),
+		Extra:     make(map[string]interface{}),
+	}
+
+	for k, v := range entry.Data {
+		switch k {
+		case "prefix":
+			ev.Logger = fmt.Sprint(v)
+			continue
+		case logrus.ErrorKey:
+			if err, ok := v.(error); ok {
+				ev.Exception = &Exceptions{
+					Values: []Exception{{
+						Type:  fmt.Sprintf("%T", err),
+						Value: err.Error(),
+					}},
+				}
+			}
+		}
+
+		ev.Extra[k] = extraValue(v)
+	}
+
+	for _, k := range tagFields {
+		if v, ok := entry.Data[k]; ok {
+			ev.Tags[k] = fmt.Sprint(v)
+		}
+	}
+
+	return ev
+}
+
+// eventLevel returns the Sentry level of a logrus level
+func eventLevel(level logrus.Level) string {
+	switch level {
+	case logrus.PanicLevel, logrus.FatalLevel:
+		return "fatal"
+	case logrus.ErrorLevel:
+		return "error"
+	case logrus.WarnLevel:
+		return "warning"
+	case logrus.InfoLevel:
+		return "info"
+	default:
+		return "debug"
+	}
+}
+
+// extraValue returns a log field value that can be marshaled to JSON.
+// Values other than strings, numbers and booleans are formatted like the text log formats them.
+func extraValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string, bool,
+		int, int8, int16, int32, int64,
+		uint, uint8, uint16, uint32, uint64,
+		float32, float64:
+		return v
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return fmt.Sprintf("%+v", v)
+	}
+}
@@ -0,0 +1,252 @@
+// Package sentry reports errors to Sentry, see https://sentry.io.
+// Errors logged with logrus are sent as Sentry events by a Hook.
+package sentry
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	sendTimeout  = time.Second * 10
+	flushTimeout = time.Second * 5
+	queueSize    = 100
+
+	clientName = "teller/1.0"
+)
+
+// DSN is a parsed Sentry DSN, https://<key>@<host>/<project id>
+type DSN struct {
+	// URL of the project's store API endpoint
+	StoreURL  string
+	PublicKey string
+	SecretKey string
+}
+
+// ParseDSN parses a Sentry DSN. The error does not include the DSN, since its key is a secret.
+func ParseDSN(dsn string) (DSN, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return DSN{}, errors.New("Invalid sentry DSN")
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return DSN{}, errors.New("Sentry DSN must be an http or https URL")
+	}
+
+	if u.User == nil || u.User.Username() == "" {
+		return DSN{}, errors.New("Sentry DSN has no public key")
+	}
+
+	path := strings.TrimSuffix(u.Path, "/")
+	i := strings.LastIndex(path, "/")
+	if i == -1 || path[i+1:] == "" {
+		return DSN{}, errors.New("Sentry DSN has no project ID")
+	}
+
+	secret, _ := u.User.Password()
+
+	return DSN{
+		StoreURL:  fmt.Sprintf("%s://%s%s/api/%s/store/", u.Scheme, u.Host, path[:i], path[i+1:]),
+		PublicKey: u.User.Username(),
+		SecretKey: secret,
+	}, nil
+}
+
+// Exception is the error of an Event
+type Exception struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// Exceptions is the exception interface of an Event
+type Exceptions struct {
+	Values []Exception `json:"values"`
+}
+
+// Event is a Sentry event
+type Event struct {
+	EventID     string                 `json:"event_id"`
+	Timestamp   string                 `json:"timestamp"`
+	Level       string                 `json:"level"`
+	Logger      string                 `json:"logger,omitempty"`
+	Platform    string                 `json:"platform"`
+	Message     string                 `json:"message"`
+	Environment string                 `json:"environment,omitempty"`
+	ServerName  string                 `json:"server_name,omitempty"`
+	Tags        map[string]string      `json:"tags,omitempty"`
+	Extra       map[string]interface{} `json:"extra,omitempty"`
+	Exception   *Exceptions            `json:"exception,omitempty"`
+}
+
+// Config configures a Client
+type Config struct {
+	DSN         string
+	Environment string // environment of the events, e.g. "production"
+	ServerName  string // name of the host of the events
+}
+
+// Client sends events to Sentry. Events are queued and sent in the background by Run,
+// so that capturing an event never blocks.
+type Client struct {
+	log        logrus.FieldLogger
+	cfg        Config
+	dsn        DSN
+	httpClient *http.Client
+	events     chan Event
+	quit       chan struct{}
+	done       chan struct{}
+}
+
+// NewClient creates a Client
+func NewClient(log logrus.FieldLogger, cfg Config) (*Client, error) {
+	dsn, err := ParseDSN(cfg.DSN)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		log: log.WithField("prefix", "sentry.client"),
+		cfg: cfg,
+		dsn: dsn,
+		httpClient: &http.Client{
+			Timeout: sendTimeout,
+		},
+		events: make(chan Event, queueSize),
+		quit:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}, nil
+}
+
+// Run sends the captured events until Shutdown is called
+func (c *Client) Run() error {
+	log := c.log
+	log.Info("Start sentry client")
+	defer log.Info("Sentry client closed")
+	defer close(c.done)
+
+	for {
+		select {
+		case <-c.quit:
+			c.flush()
+			return nil
+		case ev := <-c.events:
+			c.sendLogged(ev)
+		}
+	}
+}
+
+// Shutdown stops the Client, after sending the queued events for up to 5 seconds
+func (c *Client) Shutdown() {
+	close(c.quit)
+	<-c.done
+}
+
+// flush sends the queued events, until the queue is empty or flushTimeout elapsed
+func (c *Client) flush() {
+	timeout := time.After(flushTimeout)
+	for {
+		select {
+		case ev := <-c.events:
+			c.sendLogged(ev)
+		case <-timeout:
+			c.log.WithField("queued", len(c.events)).Warning("Sentry flush timed out, dropping queued events")
+			return
+		default:
+			return
+		}
+	}
+}
+
+// Capture queues an event to be sent. The event is dropped if the queue is full.
+func (c *Client) Capture(ev Event) {
+	select {
+	case c.events <- c.prepare(ev):
+	default:
+		c.log.WithField("eventID", ev.EventID).Warning("Sentry event queue is full, dropping event")
+	}
+}
+
+// Send sends an event, without queueing it
+func (c *Client) Send(ev Event) error {
+	return c.send(c.prepare(ev))
+}
+
+// prepare sets the fields of an event that are the same for every event of the Client
+func (c *Client) prepare(ev Event) Event {
+	if ev.EventID == "" {
+		ev.EventID = newEventID()
+	}
+	if ev.Timestamp == "" {
+		ev.Timestamp = time.Now().UTC().Format("2006-01-02T15:04:05")
+	}
+	ev.Platform = "go"
+	ev.Environment = c.cfg.Environment
+	ev.ServerName = c.cfg.ServerName
+	return ev
+}
+
+// sendLogged sends an event, logging a failure.
+// Failures are logged as warnings, since errors are captured and would be sent again.
+func (c *Client) sendLogged(ev Event) {
+	if err := c.send(ev); err != nil {
+		c.log.WithError(err).WithField("eventID", ev.EventID).Warning("Send sentry event failed")
+	}
+}
+
+func (c *Client) send(ev Event) error {
+	b, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.dsn.StoreURL, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Sentry-Auth", c.authHeader())
+
+	rsp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(io.LimitReader(rsp.Body, 512))
+		return fmt.Errorf("sentry responded %s: %s", rsp.Status, strings.TrimSpace(string(body)))
+	}
+
+	return nil
+}
+
+func (c *Client) authHeader() string {
+	h := fmt.Sprintf("Sentry sentry_version=7, sentry_client=%s, sentry_timestamp=%d, sentry_key=%s",
+		clientName, time.Now().Unix(), c.dsn.PublicKey)
+	if c.dsn.SecretKey != "" {
+		h += ", sentry_secret=" + c.dsn.SecretKey
+	}
+	return h
+}
+
+func newEventID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,119 @@
+package settlement
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	checkPeriod = time.Second * 10
+	retryPeriod = time.Minute * 15
+)
+
+// Partner is notified of settlements. Notify returns nil only if the partner acknowledged the settlement.
+type Partner interface {
+	Notify(Settlement) error
+}
+
+// NotifierConfig configures the Notifier
+type NotifierConfig struct {
+	CheckPeriod time.Duration // how often to check for settlements to notify
+	RetryPeriod time.Duration // wait before notifying an unacknowledged settlement again
+}
+
+// Notifier notifies the partner of new settlements, and notifies unacknowledged
+// settlements again every RetryPeriod until they are acknowledged
+type Notifier struct {
+	log     logrus.FieldLogger
+	cfg     NotifierConfig
+	store   *Store
+	partner Partner
+	quit    chan struct{}
+	done    chan struct{}
+}
+
+// NewNotifier creates a Notifier
+func NewNotifier(log logrus.FieldLogger, store *Store, partner Partner, cfg NotifierConfig) *Notifier {
+	if cfg.CheckPeriod == 0 {
+		cfg.CheckPeriod = checkPeriod
+	}
+
+	if cfg.RetryPeriod == 0 {
+		cfg.RetryPeriod = retryPeriod
+	}
+
+	return &Notifier{
+		log:     log.WithField("prefix", "settlement.notifier"),
+		cfg:     cfg,
+		store:   store,
+		partner: partner,
+		quit:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// Run starts the Notifier
+func (n *Notifier) Run() error {
+	log := n.log.WithField("config", n.cfg)
+	log.Info("Start settlement notifier")
+	defer log.Info("Settlement notifier closed")
+	defer close(n.done)
+
+	for {
+		if _, err := n.NotifyDue(); err != nil {
+			log.WithError(err).Error("Notifier.NotifyDue failed")
+		}
+
+		select {
+		case <-n.quit:
+			return nil
+		case <-time.After(n.cfg.CheckPeriod):
+		}
+	}
+}
+
+// Shutdown stops the Notifier
+func (n *Notifier) Shutdown() {
+	close(n.quit)
+	<-n.done
+}
+
+// NotifyDue notifies the partner of the settlements that are due. A settlement that
+// is not acknowledged does not hold back the others. Returns the number acknowledged.
+func (n *Notifier) NotifyDue() (int, error) {
+	ss, err := n.store.Due(time.Now().UTC(), n.cfg.RetryPeriod)
+	if err != nil {
+		return 0, err
+	}
+
+	var acked int
+	for _, s := range ss {
+		select {
+		case <-n.quit:
+			return acked, nil
+		default:
+		}
+
+		log := n.log.WithFields(logrus.Fields{
+			"settlementID": s.ID,
+			"attempt":      s.Attempts + 1,
+		})
+
+		notifyErr := n.partner.Notify(s)
+		if err := n.store.RecordAttempt(s.ID, notifyErr); err != nil {
+			log.WithError(err).Error("Store.RecordAttempt failed")
+			return acked, err
+		}
+
+		if notifyErr != nil {
+			log.WithError(notifyErr).WithField("retryIn", n.cfg.RetryPeriod).Warning("Settlement not acknowledged")
+			continue
+		}
+
+		log.Info("Settlement acknowledged")
+		acked++
+	}
+
+	return acked, nil
+}
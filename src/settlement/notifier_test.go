@@ -0,0 +1,127 @@
+package settlement
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+type dummyPartner struct {
+	sync.Mutex
+	notified []string
+	nack     map[string]bool
+}
+
+func (p *dummyPartner) Notify(s Settlement) error {
+	p.Lock()
+	defer p.Unlock()
+
+	p.notified = append(p.notified, s.ID)
+	if p.nack[s.ID] {
+		return errors.New("not acknowledged")
+	}
+	return nil
+}
+
+func (p *dummyPartner) getNotified() []string {
+	p.Lock()
+	defer p.Unlock()
+	return append([]string(nil), p.notified...)
+}
+
+func TestNotifierNotifyDue(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	s, err := NewStore(db)
+	require.NoError(t, err)
+
+	require.NoError(t, db.Update(func(tx *bolt.Tx) error {
+		for i, id := range []string{"tx1:0", "tx2:0", "tx3:0"} {
+			if err := PutTx(tx, Settlement{ID: id, SettledAt: int64(i + 1)}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+
+	log, _ := testutil.NewLogger(t)
+	partner := &dummyPartner{
+		nack: map[string]bool{"tx2:0": true},
+	}
+	n := NewNotifier(log, s, partner, NotifierConfig{
+		CheckPeriod: time.Millisecond * 10,
+		RetryPeriod: time.Hour,
+	})
+
+	// An unacknowledged settlement does not hold back the others
+	acked, err := n.NotifyDue()
+	require.NoError(t, err)
+	require.Equal(t, 2, acked)
+	require.Equal(t, []string{"tx1:0", "tx2:0", "tx3:0"}, partner.getNotified())
+
+	// It is not retried before the retry period
+	acked, err = n.NotifyDue()
+	require.NoError(t, err)
+	require.Equal(t, 0, acked)
+	require.Len(t, partner.getNotified(), 3)
+
+	ss, err := s.Settlements(func(st Settlement) bool { return !st.Acked() })
+	require.NoError(t, err)
+	require.Len(t, ss, 1)
+	require.Equal(t, "tx2:0", ss[0].ID)
+	require.Equal(t, "not acknowledged", ss[0].LastError)
+
+	// After the retry period, it is notified again
+	n.cfg.RetryPeriod = 0
+	partner.Lock()
+	partner.nack = nil
+	partner.Unlock()
+
+	acked, err = n.NotifyDue()
+	require.NoError(t, err)
+	require.Equal(t, 1, acked)
+	require.Equal(t, []string{"tx1:0", "tx2:0", "tx3:0", "tx2:0"}, partner.getNotified())
+
+	ss, err = s.Settlements(func(st Settlement) bool { return st.ID == "tx2:0" })
+	require.NoError(t, err)
+	require.Equal(t, 2, ss[0].Attempts)
+	require.True(t, ss[0].Acked())
+}
+
+func TestNotifierRun(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	s, err := NewStore(db)
+	require.NoError(t, err)
+
+	log, _ := testutil.NewLogger(t)
+	partner := &dummyPartner{}
+	n := NewNotifier(log, s, partner, NotifierConfig{
+		CheckPeriod: time.Millisecond * 10,
+	})
+
+	errC := make(chan error, 1)
+	go func() {
+		errC <- n.Run()
+	}()
+
+	require.NoError(t, db.Update(func(tx *bolt.Tx) error {
+		return PutTx(tx, Settlement{ID: "tx1:0"})
+	}))
+
+	for i := 0; i < 500 && len(partner.getNotified()) < 1; i++ {
+		time.Sleep(time.Millisecond * 10)
+	}
+	require.Equal(t, []string{"tx1:0"}, partner.getNotified())
+
+	n.Shutdown()
+	require.NoError(t, <-errC)
+}
@@ -0,0 +1,190 @@
+// Package settlement notifies a partner settlement system of every payout, and tracks
+// the partner's acknowledgement of each one. Settlements are saved in the same db transaction
+// as the deposit status change that completes the payout, and are notified until acknowledged,
+// so that teller and a custodial partner can be reconciled.
+package settlement
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/skycoin/teller/src/util/dbutil"
+)
+
+// settlements of completed payouts, deposit ID as key
+var settlementsBkt = []byte("settlements")
+
+const (
+	// AckedByPartner is Settlement.AckedBy when the partner acknowledged the notification
+	AckedByPartner = "partner"
+	// AckedByAdmin is Settlement.AckedBy when the settlement was acknowledged on the admin API
+	AckedByAdmin = "admin"
+)
+
+// ErrNotFound is returned if a settlement does not exist
+var ErrNotFound = errors.New("Settlement not found")
+
+// Settlement is a completed payout that the partner is notified of
+type Settlement struct {
+	// ID is the deposit ID of the payout
+	ID             string `json:"id"`
+	CoinType       string `json:"coin_type"`
+	SkyAddress     string `json:"skycoin_address"`
+	DepositAddress string `json:"deposit_address"`
+	DepositValue   int64  `json:"deposit_value"`
+	SkySent        uint64 `json:"sky_sent"`
+	Txid           string `json:"txid"`
+	SettledAt      int64  `json:"settled_at"`
+
+	// Number of notifications sent
+	Attempts      int    `json:"attempts"`
+	LastAttemptAt int64  `json:"last_attempt_at,omitempty"`
+	LastError     string `json:"last_error,omitempty"`
+	AckedAt       int64  `json:"acked_at,omitempty"`
+	AckedBy       string `json:"acked_by,omitempty"`
+}
+
+// Acked returns true if the settlement has been acknowledged
+func (s Settlement) Acked() bool {
+	return s.AckedAt != 0
+}
+
+// PutTx adds a settlement inside of tx, to be notified once tx is committed.
+// If a settlement with the same ID exists, it is kept.
+func PutTx(tx *bolt.Tx, s Settlement) error {
+	if _, err := tx.CreateBucketIfNotExists(settlementsBkt); err != nil {
+		return dbutil.NewCreateBucketFailedErr(settlementsBkt, err)
+	}
+
+	if exists, err := dbutil.BucketHasKey(tx, settlementsBkt, s.ID); err != nil {
+		return err
+	} else if exists {
+		return nil
+	}
+
+	if s.SettledAt == 0 {
+		s.SettledAt = time.Now().UTC().Unix()
+	}
+
+	return dbutil.PutBucketValue(tx, settlementsBkt, s.ID, s)
+}
+
+// Filter filters settlements
+type Filter func(s Settlement) bool
+
+// Store reads settlements and records their notifications
+type Store struct {
+	db *bolt.DB
+}
+
+// NewStore creates a Store
+func NewStore(db *bolt.DB) (*Store, error) {
+	if db == nil {
+		return nil, errors.New("new settlement Store failed, db is nil")
+	}
+
+	if err := db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(settlementsBkt); err != nil {
+			return dbutil.NewCreateBucketFailedErr(settlementsBkt, err)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return &Store{
+		db: db,
+	}, nil
+}
+
+// Settlements returns the settlements that flt returns true for, oldest first
+func (s *Store) Settlements(flt Filter) ([]Settlement, error) {
+	var ss []Settlement
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		return dbutil.ForEach(tx, settlementsBkt, func(k, v []byte) error {
+			var st Settlement
+			if err := json.Unmarshal(v, &st); err != nil {
+				return fmt.Errorf("decode settlement %s failed: %v", k, err)
+			}
+
+			if flt(st) {
+				ss = append(ss, st)
+			}
+
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(ss, func(i, j int) bool {
+		if ss[i].SettledAt != ss[j].SettledAt {
+			return ss[i].SettledAt < ss[j].SettledAt
+		}
+		return ss[i].ID < ss[j].ID
+	})
+
+	return ss, nil
+}
+
+// Due returns the unacknowledged settlements that have not been notified yet,
+// or were last notified at least retryPeriod before now, oldest first
+func (s *Store) Due(now time.Time, retryPeriod time.Duration) ([]Settlement, error) {
+	return s.Settlements(func(st Settlement) bool {
+		if st.Acked() {
+			return false
+		}
+		return st.Attempts == 0 || now.Unix() >= st.LastAttemptAt+int64(retryPeriod/time.Second)
+	})
+}
+
+// RecordAttempt records a notification of the settlement with id. If notifyErr is nil,
+// the partner acknowledged it.
+func (s *Store) RecordAttempt(id string, notifyErr error) error {
+	return s.update(id, func(st Settlement) Settlement {
+		now := time.Now().UTC().Unix()
+		st.Attempts++
+		st.LastAttemptAt = now
+		if notifyErr != nil {
+			st.LastError = notifyErr.Error()
+		} else {
+			st.LastError = ""
+			st.AckedAt = now
+			st.AckedBy = AckedByPartner
+		}
+		return st
+	})
+}
+
+// Ack acknowledges the settlement with id on behalf of the partner, e.g. after it was
+// reconciled by other means. Acknowledging an acknowledged settlement is a no-op.
+func (s *Store) Ack(id string) error {
+	return s.update(id, func(st Settlement) Settlement {
+		if !st.Acked() {
+			st.AckedAt = time.Now().UTC().Unix()
+			st.AckedBy = AckedByAdmin
+		}
+		return st
+	})
+}
+
+func (s *Store) update(id string, f func(Settlement) Settlement) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		var st Settlement
+		if err := dbutil.GetBucketObject(tx, settlementsBkt, id, &st); err != nil {
+			switch err.(type) {
+			case dbutil.ObjectNotExistErr:
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		return dbutil.PutBucketValue(tx, settlementsBkt, id, f(st))
+	})
+}
@@ -0,0 +1,94 @@
+package settlement
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+func TestStore(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	// PutTx creates the bucket if needed, and keeps an existing settlement
+	err := db.Update(func(tx *bolt.Tx) error {
+		if err := PutTx(tx, Settlement{ID: "tx2:0", SkySent: 2e6, SettledAt: 200}); err != nil {
+			return err
+		}
+		if err := PutTx(tx, Settlement{ID: "tx1:0", SkySent: 1e6, SettledAt: 100}); err != nil {
+			return err
+		}
+		return PutTx(tx, Settlement{ID: "tx1:0", SkySent: 5e6, SettledAt: 300})
+	})
+	require.NoError(t, err)
+
+	s, err := NewStore(db)
+	require.NoError(t, err)
+
+	all := func(Settlement) bool { return true }
+
+	ss, err := s.Settlements(all)
+	require.NoError(t, err)
+	require.Len(t, ss, 2)
+	require.Equal(t, "tx1:0", ss[0].ID)
+	require.Equal(t, uint64(1e6), ss[0].SkySent)
+	require.Equal(t, "tx2:0", ss[1].ID)
+
+	// Rolled back settlements are not saved
+	rollbackErr := errors.New("rolled back")
+	err = db.Update(func(tx *bolt.Tx) error {
+		if err := PutTx(tx, Settlement{ID: "tx3:0"}); err != nil {
+			return err
+		}
+		return rollbackErr
+	})
+	require.Equal(t, rollbackErr, err)
+
+	now := time.Now().UTC()
+	ss, err = s.Due(now, time.Hour)
+	require.NoError(t, err)
+	require.Len(t, ss, 2)
+
+	require.NoError(t, s.RecordAttempt("tx1:0", errors.New("timeout")))
+	require.NoError(t, s.RecordAttempt("tx2:0", nil))
+	require.Equal(t, ErrNotFound, s.RecordAttempt("tx3:0", nil))
+
+	// A failed settlement is due again after the retry period, an acknowledged one never is
+	ss, err = s.Due(now, time.Hour)
+	require.NoError(t, err)
+	require.Empty(t, ss)
+
+	ss, err = s.Due(now.Add(time.Hour), time.Hour)
+	require.NoError(t, err)
+	require.Len(t, ss, 1)
+	require.Equal(t, "tx1:0", ss[0].ID)
+	require.Equal(t, 1, ss[0].Attempts)
+	require.Equal(t, "timeout", ss[0].LastError)
+	require.False(t, ss[0].Acked())
+
+	ss, err = s.Settlements(func(st Settlement) bool { return st.Acked() })
+	require.NoError(t, err)
+	require.Len(t, ss, 1)
+	require.Equal(t, "tx2:0", ss[0].ID)
+	require.Equal(t, AckedByPartner, ss[0].AckedBy)
+	require.Empty(t, ss[0].LastError)
+
+	// Settlements can be acknowledged by an admin
+	require.NoError(t, s.Ack("tx1:0"))
+	require.NoError(t, s.Ack("tx2:0"))
+	require.Equal(t, ErrNotFound, s.Ack("tx3:0"))
+
+	ss, err = s.Settlements(all)
+	require.NoError(t, err)
+	require.Equal(t, AckedByAdmin, ss[0].AckedBy)
+	require.Equal(t, AckedByPartner, ss[1].AckedBy)
+
+	ss, err = s.Due(now.Add(time.Hour), time.Hour)
+	require.NoError(t, err)
+	require.Empty(t, ss)
+}
@@ -0,0 +1,113 @@
+package settlement
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/skycoin/teller/src/outbox"
+)
+
+const (
+	// IDHeader is the webhook request header with the settlement ID
+	IDHeader = "X-Teller-Settlement-Id"
+
+	webhookTimeout = time.Second * 10
+)
+
+// Notification is the body of a settlement webhook request
+type Notification struct {
+	ID             string `json:"id"`
+	CoinType       string `json:"coin_type"`
+	SkyAddress     string `json:"skycoin_address"`
+	DepositAddress string `json:"deposit_address"`
+	DepositValue   int64  `json:"deposit_value"`
+	SkySent        uint64 `json:"sky_sent"`
+	Txid           string `json:"txid"`
+	SettledAt      int64  `json:"settled_at"`
+	// Attempt is 1 for the first notification of a settlement, and counts up on each retry
+	Attempt int `json:"attempt"`
+}
+
+// Ack is the body of the partner's response acknowledging a settlement
+type Ack struct {
+	Ack string `json:"ack"`
+}
+
+// WebhookPartner notifies the partner by POSTing settlements as JSON to a URL.
+// The partner acknowledges a settlement by responding with a 2xx status and an Ack of its ID.
+type WebhookPartner struct {
+	url    string
+	secret string
+	client *http.Client
+}
+
+// NewWebhookPartner creates a WebhookPartner. If secret is set, requests are signed with it,
+// the same way as outbox webhook requests.
+func NewWebhookPartner(url, secret string) (*WebhookPartner, error) {
+	if url == "" {
+		return nil, errors.New("webhook url is empty")
+	}
+
+	return &WebhookPartner{
+		url:    url,
+		secret: secret,
+		client: &http.Client{
+			Timeout: webhookTimeout,
+		},
+	}, nil
+}
+
+// Notify POSTs the settlement to the webhook URL, and checks that the response acknowledges it
+func (w *WebhookPartner) Notify(s Settlement) error {
+	body, err := json.Marshal(Notification{
+		ID:             s.ID,
+		CoinType:       s.CoinType,
+		SkyAddress:     s.SkyAddress,
+		DepositAddress: s.DepositAddress,
+		DepositValue:   s.DepositValue,
+		SkySent:        s.SkySent,
+		Txid:           s.Txid,
+		SettledAt:      s.SettledAt,
+		Attempt:        s.Attempts + 1,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(IDHeader, s.ID)
+	if w.secret != "" {
+		req.Header.Set(outbox.SignatureHeader, outbox.Sign(w.secret, body))
+	}
+
+	rsp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode < 200 || rsp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded with status %d", rsp.StatusCode)
+	}
+
+	var ack Ack
+	if err := json.NewDecoder(io.LimitReader(rsp.Body, 1<<16)).Decode(&ack); err != nil {
+		return fmt.Errorf("decode webhook ack failed: %v", err)
+	}
+
+	if ack.Ack != s.ID {
+		return fmt.Errorf("webhook did not acknowledge settlement, ack is %q", ack.Ack)
+	}
+
+	return nil
+}
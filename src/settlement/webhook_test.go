@@ -0,0 +1,91 @@
+package settlement
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/outbox"
+)
+
+func TestWebhookPartner(t *testing.T) {
+	var status int
+	var ack string
+	var received Notification
+	var header http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPost, r.Method)
+
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(body, &received))
+
+		header = r.Header
+		if r.Header.Get(outbox.SignatureHeader) != "" {
+			require.Equal(t, outbox.Sign("secret", body), r.Header.Get(outbox.SignatureHeader))
+		}
+
+		w.WriteHeader(status)
+		fmt.Fprint(w, ack)
+	}))
+	defer srv.Close()
+
+	s := Settlement{
+		ID:             "btctx:1",
+		CoinType:       "BTC",
+		SkyAddress:     "2Wbi4wvxC4fkTYMsS2f6HaFfW4pafDjXcQW",
+		DepositAddress: "1FeDtFhARLxjKUPPkQqEBL78tisenc9znS",
+		DepositValue:   1e6,
+		SkySent:        5e8,
+		Txid:           "skytx",
+		SettledAt:      1500000000,
+		Attempts:       2,
+	}
+
+	p, err := NewWebhookPartner(srv.URL, "secret")
+	require.NoError(t, err)
+
+	status = http.StatusOK
+	ack = `{"ack":"btctx:1"}`
+	require.NoError(t, p.Notify(s))
+	require.Equal(t, Notification{
+		ID:             s.ID,
+		CoinType:       s.CoinType,
+		SkyAddress:     s.SkyAddress,
+		DepositAddress: s.DepositAddress,
+		DepositValue:   s.DepositValue,
+		SkySent:        s.SkySent,
+		Txid:           s.Txid,
+		SettledAt:      s.SettledAt,
+		Attempt:        3,
+	}, received)
+	require.Equal(t, "btctx:1", header.Get(IDHeader))
+	require.Equal(t, "application/json", header.Get("Content-Type"))
+	require.NotEmpty(t, header.Get(outbox.SignatureHeader))
+
+	// A 2xx response without an ack of the settlement is not an acknowledgement
+	for _, a := range []string{"", "{}", `{"ack":"btctx:2"}`, "ok"} {
+		ack = a
+		require.Error(t, p.Notify(s), a)
+	}
+
+	status = http.StatusInternalServerError
+	ack = `{"ack":"btctx:1"}`
+	require.Error(t, p.Notify(s))
+
+	// Without a secret, requests are not signed
+	p, err = NewWebhookPartner(srv.URL, "")
+	require.NoError(t, err)
+
+	status = http.StatusOK
+	require.NoError(t, p.Notify(s))
+	require.Empty(t, header.Get(outbox.SignatureHeader))
+
+	_, err = NewWebhookPartner("", "")
+	require.Error(t, err)
+}
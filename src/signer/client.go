@@ -0,0 +1,140 @@
+package signer
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/skycoin/skycoin/src/coin"
+	"github.com/skycoin/skycoin/src/visor"
+)
+
+const clientTimeout = time.Second * 30
+
+// ClientTLSConfig returns the TLS config of a Client from PEM encoded files.
+// The signer must present a certificate signed by ca.
+func ClientTLSConfig(cert, key, ca []byte) (*tls.Config, error) {
+	kp, err := tls.X509KeyPair(cert, key)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid client certificate: %v", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.New("Invalid signer CA certificate")
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{kp},
+		RootCAs:      pool,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// Client is a TxSigner that calls a remote Server
+type Client struct {
+	url    string
+	client *http.Client
+}
+
+// NewClient creates a Client of the Server at url, e.g. "https://10.0.0.5:7090"
+func NewClient(url string, tlsConfig *tls.Config) (*Client, error) {
+	if !strings.HasPrefix(url, "https://") {
+		return nil, errors.New("Signer url must be an https URL")
+	}
+
+	return &Client{
+		url: strings.TrimRight(url, "/"),
+		client: &http.Client{
+			Timeout: clientTimeout,
+			Transport: &http.Transport{
+				TLSClientConfig: tlsConfig,
+			},
+		},
+	}, nil
+}
+
+// Addresses returns the addresses of the signer's wallet
+func (c *Client) Addresses() ([]string, error) {
+	var rsp AddressesResponse
+	if err := c.do(http.MethodGet, "/api/addresses", nil, &rsp); err != nil {
+		return nil, err
+	}
+
+	if len(rsp.Addresses) == 0 {
+		return nil, errors.New("Signer wallet has no addresses")
+	}
+
+	return rsp.Addresses, nil
+}
+
+// Sign requests a signed transaction for intents, spending outs
+func (c *Client) Sign(intents []Intent, outs visor.ReadableOutputSet) (*coin.Transaction, error) {
+	var rsp SignResponse
+	if err := c.do(http.MethodPost, "/api/sign", SignRequest{
+		Intents: intents,
+		Outputs: outs,
+	}, &rsp); err != nil {
+		return nil, err
+	}
+
+	b, err := hex.DecodeString(rsp.Transaction)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid signed transaction: %v", err)
+	}
+
+	tx, err := coin.TransactionDeserialize(b)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid signed transaction: %v", err)
+	}
+
+	if tx.TxIDHex() != rsp.Txid {
+		return nil, errors.New("Signed transaction txid does not match")
+	}
+
+	return &tx, nil
+}
+
+func (c *Client) do(method, path string, reqBody, rspBody interface{}) error {
+	var body []byte
+	if reqBody != nil {
+		var err error
+		body, err = json.Marshal(reqBody)
+		if err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(method, c.url+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if reqBody != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	rsp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+
+	b, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		return err
+	}
+
+	if rsp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Signer returned %d: %s", rsp.StatusCode, strings.TrimSpace(string(b)))
+	}
+
+	return json.Unmarshal(b, rspBody)
+}
@@ -0,0 +1,223 @@
+package signer
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/skycoin/skycoin/src/coin"
+	"github.com/skycoin/skycoin/src/visor"
+
+	"github.com/skycoin/teller/src/util/httputil"
+	"github.com/skycoin/teller/src/util/logger"
+)
+
+const (
+	shutdownTimeout = time.Second * 5
+
+	serverReadTimeout  = time.Second * 10
+	serverWriteTimeout = time.Second * 60
+	serverIdleTimeout  = time.Second * 120
+)
+
+// TxSigner creates signed transactions for intents. A transaction has one output per intent.
+type TxSigner interface {
+	Addresses() ([]string, error)
+	Sign(intents []Intent, outs visor.ReadableOutputSet) (*coin.Transaction, error)
+}
+
+// AddressesResponse is the response of /api/addresses
+type AddressesResponse struct {
+	Addresses []string `json:"addresses"`
+}
+
+// SignRequest is the request body of /api/sign
+type SignRequest struct {
+	Intents []Intent `json:"intents"`
+	// Unspent outputs of the wallet addresses, as returned by the skycoin node
+	Outputs visor.ReadableOutputSet `json:"outputs"`
+}
+
+// SignResponse is the response of /api/sign
+type SignResponse struct {
+	// Hex encoded signed transaction
+	Transaction string `json:"transaction"`
+	Txid        string `json:"txid"`
+}
+
+// ServerTLSConfig returns the TLS config of a Server from PEM encoded files.
+// Clients must present a certificate signed by clientCA.
+func ServerTLSConfig(cert, key, clientCA []byte) (*tls.Config, error) {
+	kp, err := tls.X509KeyPair(cert, key)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid signer certificate: %v", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(clientCA) {
+		return nil, errors.New("Invalid client CA certificate")
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{kp},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// Server serves a TxSigner over HTTPS to clients authenticated by their TLS certificate
+type Server struct {
+	log       logrus.FieldLogger
+	addr      string
+	signer    TxSigner
+	tlsConfig *tls.Config
+	ln        *http.Server
+	quit      chan struct{}
+}
+
+// NewServer creates a Server listening on addr
+func NewServer(log logrus.FieldLogger, addr string, signer TxSigner, tlsConfig *tls.Config) *Server {
+	return &Server{
+		log:       log.WithField("prefix", "signer.server"),
+		addr:      addr,
+		signer:    signer,
+		tlsConfig: tlsConfig,
+		quit:      make(chan struct{}),
+	}
+}
+
+// Run serves until Shutdown is called
+func (s *Server) Run() error {
+	log := s.log.WithField("addr", s.addr)
+	log.Info("Start signer service...")
+	defer log.Info("Signer service closed")
+
+	s.ln = &http.Server{
+		Addr:         s.addr,
+		Handler:      s.setupMux(),
+		TLSConfig:    s.tlsConfig,
+		ReadTimeout:  serverReadTimeout,
+		WriteTimeout: serverWriteTimeout,
+		IdleTimeout:  serverIdleTimeout,
+	}
+
+	if err := s.ln.ListenAndServeTLS("", ""); err != nil {
+		select {
+		case <-s.quit:
+			return nil
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Shutdown stops the Server
+func (s *Server) Shutdown() {
+	close(s.quit)
+	if s.ln != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := s.ln.Shutdown(ctx); err != nil {
+			s.log.WithError(err).Error("Signer service shutdown failed")
+		}
+	}
+}
+
+func (s *Server) setupMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("/api/addresses", httputil.LogHandler(s.log, s.addressesHandler()))
+	mux.Handle("/api/sign", httputil.LogHandler(s.log, s.signHandler()))
+	return mux
+}
+
+// addressesHandler returns the wallet addresses
+// Method: GET
+// URI: /api/addresses
+func (s *Server) addressesHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := logger.FromContext(ctx)
+
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			httputil.ErrResponse(w, http.StatusMethodNotAllowed)
+			return
+		}
+
+		addrs, err := s.signer.Addresses()
+		if err != nil {
+			log.WithError(err).Error("signer.Addresses failed")
+			httputil.ErrResponse(w, http.StatusInternalServerError)
+			return
+		}
+
+		if err := httputil.JSONResponse(w, AddressesResponse{
+			Addresses: addrs,
+		}); err != nil {
+			log.WithError(err).Error("Write json response failed")
+		}
+	}
+}
+
+// signHandler signs a transaction for intents
+// Method: POST
+// URI: /api/sign
+// Args:
+//     SignRequest as json
+func (s *Server) signHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := logger.FromContext(ctx)
+
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			httputil.ErrResponse(w, http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req SignRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			httputil.ErrResponse(w, http.StatusBadRequest, fmt.Sprintf("Invalid json request body: %v", err))
+			return
+		}
+
+		var coins uint64
+		for _, i := range req.Intents {
+			coins += i.Coins
+		}
+
+		log = log.WithFields(logrus.Fields{
+			"intents": len(req.Intents),
+			"coins":   coinsString(coins),
+		})
+		if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+			log = log.WithField("client", r.TLS.PeerCertificates[0].Subject.CommonName)
+		}
+
+		tx, err := s.signer.Sign(req.Intents, req.Outputs)
+		if err != nil {
+			log.WithError(err).Error("signer.Sign failed")
+			httputil.ErrResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		log.WithField("txid", tx.TxIDHex()).Info("Signed transaction")
+
+		if err := httputil.JSONResponse(w, SignResponse{
+			Transaction: hex.EncodeToString(tx.Serialize()),
+			Txid:        tx.TxIDHex(),
+		}); err != nil {
+			log.WithError(err).Error("Write json response failed")
+		}
+	}
+}
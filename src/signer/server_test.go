@@ -0,0 +1,148 @@
+package signer
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/skycoin/src/visor"
+
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	// PEM encoded
+	certPEM []byte
+	keyPEM  []byte
+}
+
+// newTestCert creates a certificate signed by parent, or a self-signed CA if parent is nil
+func newTestCert(t *testing.T, cn string, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	signer, signerKey := tmpl, key
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+func TestServerClient(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+
+	wlt, addrs, cleanup := newTestWallet(t, 0)
+	defer cleanup()
+
+	ca := newTestCert(t, "teller test CA", nil)
+	serverCert := newTestCert(t, "signer", ca)
+	clientCert := newTestCert(t, "teller", ca)
+
+	serverTLS, err := ServerTLSConfig(serverCert.certPEM, serverCert.keyPEM, ca.certPEM)
+	require.NoError(t, err)
+
+	s := NewServer(log, "", wlt, serverTLS)
+	ts := httptest.NewUnstartedServer(s.setupMux())
+	ts.TLS = serverTLS
+	ts.StartTLS()
+	defer ts.Close()
+
+	clientTLS, err := ClientTLSConfig(clientCert.certPEM, clientCert.keyPEM, ca.certPEM)
+	require.NoError(t, err)
+
+	c, err := NewClient(ts.URL, clientTLS)
+	require.NoError(t, err)
+
+	rspAddrs, err := c.Addresses()
+	require.NoError(t, err)
+	require.Equal(t, addrs, rspAddrs)
+
+	outs := visor.ReadableOutputSet{
+		HeadOutputs: visor.ReadableOutputs{
+			testOutput("out1", addrs[0], "20.000000", 100),
+		},
+	}
+
+	tx, err := c.Sign([]Intent{
+		{
+			Address: testRecipient,
+			Coins:   15e6,
+		},
+	}, outs)
+	require.NoError(t, err)
+	require.NoError(t, tx.Verify())
+	require.Equal(t, testRecipient, tx.Out[1].Address.String())
+
+	// Sign errors are returned to the client
+	_, err = c.Sign([]Intent{
+		{
+			Address: testRecipient,
+			Coins:   30e6,
+		},
+	}, outs)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "400")
+
+	// A client without a certificate is rejected
+	noCertTLS := clientTLS.Clone()
+	noCertTLS.Certificates = nil
+	c, err = NewClient(ts.URL, noCertTLS)
+	require.NoError(t, err)
+	_, err = c.Addresses()
+	require.Error(t, err)
+
+	// A client certificate signed by another CA is rejected
+	otherCA := newTestCert(t, "other CA", nil)
+	otherCert := newTestCert(t, "teller", otherCA)
+	otherTLS, err := ClientTLSConfig(otherCert.certPEM, otherCert.keyPEM, ca.certPEM)
+	require.NoError(t, err)
+	c, err = NewClient(ts.URL, otherTLS)
+	require.NoError(t, err)
+	_, err = c.Addresses()
+	require.Error(t, err)
+
+	// Only https URLs are allowed
+	_, err = NewClient("http://127.0.0.1:7090", clientTLS)
+	require.Error(t, err)
+}
@@ -0,0 +1,202 @@
+// Package signer signs skycoin transactions with the hot wallet, so that the wallet can be kept on a separate,
+// locked-down host. teller sends a transaction intent with the wallet's unspent outputs, and the signer chooses the
+// outputs to spend, creates the transaction and signs it. The signer and teller authenticate each other with mutual TLS.
+package signer
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/skycoin/skycoin/src/api/cli"
+	"github.com/skycoin/skycoin/src/cipher"
+	"github.com/skycoin/skycoin/src/coin"
+	"github.com/skycoin/skycoin/src/util/droplet"
+	"github.com/skycoin/skycoin/src/util/fee"
+	"github.com/skycoin/skycoin/src/visor"
+	"github.com/skycoin/skycoin/src/wallet"
+)
+
+var (
+	// ErrZeroCoins is returned if an intent sends no coins
+	ErrZeroCoins = errors.New("Intent coins is 0")
+	// ErrMaxCoinsExceeded is returned if intents send more coins than the signer allows per transaction
+	ErrMaxCoinsExceeded = errors.New("Intent coins exceed the maximum the signer allows per transaction")
+	// ErrNoIntents is returned if a transaction is requested for no intents
+	ErrNoIntents = errors.New("No intents")
+	// ErrDuplicateAddress is returned if intents of a transaction send to the same address
+	ErrDuplicateAddress = errors.New("Intents send to the same address more than once")
+)
+
+// Intent is a request to send coins to an address from the hot wallet
+type Intent struct {
+	Address string `json:"address"`
+	Coins   uint64 `json:"coins"` // measured in droplets
+}
+
+// Validate returns an error if the intent can't be signed
+func (i Intent) Validate() error {
+	if _, err := cipher.DecodeBase58Address(i.Address); err != nil {
+		return fmt.Errorf("Intent address invalid: %v", err)
+	}
+
+	if i.Coins == 0 {
+		return ErrZeroCoins
+	}
+
+	if err := visor.DropletPrecisionCheck(i.Coins); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Wallet signs transactions spending the outputs of a skycoin wallet.
+// Change is sent to the wallet's first address.
+type Wallet struct {
+	wlt *wallet.Wallet
+	// maximum coins of a transaction in droplets, 0 for no limit
+	maxCoins uint64
+}
+
+// LoadWallet loads a wallet file. If maxCoins is not 0, transactions sending more droplets are not signed.
+func LoadWallet(walletFile string, maxCoins uint64) (*Wallet, error) {
+	wlt, err := wallet.Load(walletFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := wlt.Validate(); err != nil {
+		return nil, err
+	}
+
+	if len(wlt.Entries) == 0 {
+		return nil, errors.New("Wallet is empty")
+	}
+
+	return &Wallet{
+		wlt:      wlt,
+		maxCoins: maxCoins,
+	}, nil
+}
+
+// Addresses returns the addresses of the wallet
+func (w *Wallet) Addresses() ([]string, error) {
+	addrs := make([]string, len(w.wlt.Entries))
+	for i, e := range w.wlt.Entries {
+		addrs[i] = e.Address.String()
+	}
+	return addrs, nil
+}
+
+// Sign creates and signs a transaction sending the coins of each intent, spending outs.
+// outs are the wallet's unspent outputs, as returned by the skycoin node.
+// Like the skycoin CLI, as few outputs as possible are spent, and half of the coin hours are burned as the fee.
+func (w *Wallet) Sign(intents []Intent, outs visor.ReadableOutputSet) (*coin.Transaction, error) {
+	if len(intents) == 0 {
+		return nil, ErrNoIntents
+	}
+
+	var coins uint64
+	addrs := make(map[string]struct{}, len(intents))
+	for _, i := range intents {
+		if err := i.Validate(); err != nil {
+			return nil, err
+		}
+
+		if _, ok := addrs[i.Address]; ok {
+			return nil, ErrDuplicateAddress
+		}
+		addrs[i.Address] = struct{}{}
+
+		coins += i.Coins
+	}
+
+	if w.maxCoins != 0 && coins > w.maxCoins {
+		return nil, ErrMaxCoinsExceeded
+	}
+
+	spends, err := chooseSpends(outs, coins)
+	if err != nil {
+		return nil, err
+	}
+
+	var inCoins, inHours uint64
+	keys := make([]cipher.SecKey, len(spends))
+	for i, s := range spends {
+		e, ok := w.wlt.GetEntry(s.Address)
+		if !ok {
+			return nil, fmt.Errorf("Output %s address %s is not in the wallet", s.Hash.Hex(), s.Address.String())
+		}
+
+		keys[i] = e.Secret
+		inCoins += s.Coins
+		inHours += s.Hours
+	}
+
+	if inHours == 0 {
+		return nil, fee.ErrTxnNoFee
+	}
+
+	change := inCoins - coins
+	changeHours, addrHours, outHours := wallet.DistributeSpendHours(inHours, uint64(len(intents)), change > 0)
+	if err := fee.VerifyTransactionFeeForHours(outHours, inHours-outHours); err != nil {
+		return nil, err
+	}
+
+	var tx coin.Transaction
+	for _, s := range spends {
+		tx.PushInput(s.Hash)
+	}
+
+	if change > 0 {
+		tx.PushOutput(w.wlt.Entries[0].Address, change, changeHours)
+	}
+
+	for n, i := range intents {
+		to, err := cipher.DecodeBase58Address(i.Address)
+		if err != nil {
+			return nil, err
+		}
+
+		tx.PushOutput(to, i.Coins, addrHours[n])
+	}
+
+	tx.SignInputs(keys)
+	tx.UpdateHeader()
+
+	return &tx, nil
+}
+
+// chooseSpends chooses the fewest spendable outputs with enough coins
+func chooseSpends(outs visor.ReadableOutputSet, coins uint64) ([]wallet.UxBalance, error) {
+	spendable, err := visor.ReadableOutputsToUxBalances(outs.SpendableOutputs())
+	if err != nil {
+		return nil, err
+	}
+
+	spends, err := wallet.ChooseSpendsMinimizeUxOuts(spendable, coins)
+	if err == wallet.ErrInsufficientBalance {
+		// The balance may be sufficient once unconfirmed transactions confirm
+		expected, err := visor.ReadableOutputsToUxBalances(outs.ExpectedOutputs())
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := wallet.ChooseSpendsMinimizeUxOuts(expected, coins); err == nil {
+			return nil, cli.ErrTemporaryInsufficientBalance
+		}
+
+		return nil, wallet.ErrInsufficientBalance
+	}
+
+	return spends, err
+}
+
+// coinsString formats droplets for logs, falling back to the droplets if they can't be formatted
+func coinsString(coins uint64) string {
+	s, err := droplet.ToString(coins)
+	if err != nil {
+		return fmt.Sprint(coins)
+	}
+	return s
+}
@@ -0,0 +1,198 @@
+package signer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/skycoin/src/api/cli"
+	"github.com/skycoin/skycoin/src/cipher"
+	"github.com/skycoin/skycoin/src/visor"
+	"github.com/skycoin/skycoin/src/wallet"
+)
+
+const (
+	testRecipient  = "2do3K1YLMy3Aq6EcPMdncEurP5BfAUdFPJj"
+	testRecipient2 = "nYTKxHm6SZWAMdDVx6U9BqxKMuCjmSLp93"
+)
+
+func newTestWallet(t *testing.T, maxCoins uint64) (*Wallet, []string, func()) {
+	dir, err := ioutil.TempDir("", "teller-signer")
+	require.NoError(t, err)
+
+	w, err := wallet.NewWallet("test.wlt", wallet.Options{
+		Seed: "teller signer test seed",
+	})
+	require.NoError(t, err)
+	w.GenerateAddresses(2)
+	require.NoError(t, w.Save(dir))
+
+	wlt, err := LoadWallet(filepath.Join(dir, "test.wlt"), maxCoins)
+	require.NoError(t, err)
+
+	addrs, err := wlt.Addresses()
+	require.NoError(t, err)
+	require.Len(t, addrs, 2)
+
+	return wlt, addrs, func() {
+		os.RemoveAll(dir)
+	}
+}
+
+func testOutput(seed, addr, coins string, hours uint64) visor.ReadableOutput {
+	return visor.ReadableOutput{
+		Hash:    cipher.SumSHA256([]byte(seed)).Hex(),
+		Address: addr,
+		Coins:   coins,
+		Hours:   hours,
+	}
+}
+
+func TestWalletSign(t *testing.T) {
+	wlt, addrs, cleanup := newTestWallet(t, 0)
+	defer cleanup()
+
+	outs := visor.ReadableOutputSet{
+		HeadOutputs: visor.ReadableOutputs{
+			testOutput("out1", addrs[0], "1.000000", 10),
+			testOutput("out2", addrs[1], "20.000000", 100),
+		},
+	}
+
+	tx, err := wlt.Sign([]Intent{
+		{
+			Address: testRecipient,
+			Coins:   15e6,
+		},
+	}, outs)
+	require.NoError(t, err)
+	require.NoError(t, tx.Verify())
+
+	// The fewest outputs are spent, and change goes to the first address
+	require.Len(t, tx.In, 1)
+	require.Equal(t, outs.HeadOutputs[1].Hash, tx.In[0].Hex())
+
+	require.Len(t, tx.Out, 2)
+	require.Equal(t, addrs[0], tx.Out[0].Address.String())
+	require.Equal(t, uint64(5e6), tx.Out[0].Coins)
+	require.Equal(t, testRecipient, tx.Out[1].Address.String())
+	require.Equal(t, uint64(15e6), tx.Out[1].Coins)
+	require.Equal(t, uint64(50), tx.Out[0].Hours+tx.Out[1].Hours)
+
+	// Exact amount, no change output
+	tx, err = wlt.Sign([]Intent{
+		{
+			Address: testRecipient,
+			Coins:   20e6,
+		},
+	}, outs)
+	require.NoError(t, err)
+	require.Len(t, tx.Out, 1)
+	require.Equal(t, uint64(20e6), tx.Out[0].Coins)
+
+	// Multiple intents have an output each, after the change output
+	tx, err = wlt.Sign([]Intent{
+		{
+			Address: testRecipient,
+			Coins:   15e6,
+		},
+		{
+			Address: testRecipient2,
+			Coins:   3e6,
+		},
+	}, outs)
+	require.NoError(t, err)
+	require.NoError(t, tx.Verify())
+
+	require.Len(t, tx.Out, 3)
+	require.Equal(t, addrs[0], tx.Out[0].Address.String())
+	require.Equal(t, uint64(2e6), tx.Out[0].Coins)
+	require.Equal(t, testRecipient, tx.Out[1].Address.String())
+	require.Equal(t, uint64(15e6), tx.Out[1].Coins)
+	require.Equal(t, testRecipient2, tx.Out[2].Address.String())
+	require.Equal(t, uint64(3e6), tx.Out[2].Coins)
+}
+
+func TestWalletSignErrors(t *testing.T) {
+	wlt, addrs, cleanup := newTestWallet(t, 20e6)
+	defer cleanup()
+
+	outs := visor.ReadableOutputSet{
+		HeadOutputs: visor.ReadableOutputs{
+			testOutput("out1", addrs[0], "5.000000", 10),
+		},
+		IncomingOutputs: visor.ReadableOutputs{
+			testOutput("out2", addrs[1], "5.000000", 10),
+		},
+	}
+
+	cases := []struct {
+		name    string
+		intents []Intent
+		outs    visor.ReadableOutputSet
+		err     error
+	}{
+		{
+			name:    "invalid address",
+			intents: []Intent{{Address: "bad", Coins: 1e6}},
+			outs:    outs,
+		},
+		{
+			name: "no intents",
+			outs: outs,
+			err:  ErrNoIntents,
+		},
+		{
+			name:    "duplicate address",
+			intents: []Intent{{Address: testRecipient, Coins: 1e6}, {Address: testRecipient, Coins: 2e6}},
+			outs:    outs,
+			err:     ErrDuplicateAddress,
+		},
+		{
+			name:    "zero coins",
+			intents: []Intent{{Address: testRecipient}},
+			outs:    outs,
+			err:     ErrZeroCoins,
+		},
+		{
+			name:    "max coins exceeded",
+			intents: []Intent{{Address: testRecipient, Coins: 21e6}},
+			outs:    outs,
+			err:     ErrMaxCoinsExceeded,
+		},
+		{
+			name:    "temporary insufficient balance",
+			intents: []Intent{{Address: testRecipient, Coins: 8e6}},
+			outs:    outs,
+			err:     cli.ErrTemporaryInsufficientBalance,
+		},
+		{
+			name:    "insufficient balance",
+			intents: []Intent{{Address: testRecipient, Coins: 11e6}},
+			outs:    outs,
+			err:     wallet.ErrInsufficientBalance,
+		},
+		{
+			name:    "output not in wallet",
+			intents: []Intent{{Address: testRecipient, Coins: 1e6}},
+			outs: visor.ReadableOutputSet{
+				HeadOutputs: visor.ReadableOutputs{
+					testOutput("out3", testRecipient, "5.000000", 10),
+				},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := wlt.Sign(tc.intents, tc.outs)
+			require.Error(t, err)
+			if tc.err != nil {
+				require.Equal(t, tc.err, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,441 @@
+// Package support issues time-limited, scope-limited access tokens for looking up a
+// single skycoin address, which can be handed to users or support staff to debug a case.
+// Every mint, use, denied use and revocation of a token is written to an audit log.
+package support
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/skycoin/skycoin/src/cipher"
+
+	"github.com/skycoin/teller/src/util/dbutil"
+)
+
+var (
+	// support tokens, hex SHA256 of the token as key. The tokens themselves are not stored.
+	tokensBkt = []byte("support_tokens")
+
+	// append-only audit log of support token activity, zero-padded event seq as key
+	auditBkt = []byte("support_audit")
+)
+
+// ScopeStatus allows looking up the deposit statuses of the token's skycoin address
+const ScopeStatus = "status"
+
+// Scopes lists the scopes a token can be minted with
+var Scopes = []string{ScopeStatus}
+
+var (
+	// ErrInvalidToken is returned if a token does not exist
+	ErrInvalidToken = errors.New("Invalid support token")
+	// ErrTokenExpired is returned if a token has expired
+	ErrTokenExpired = errors.New("Support token expired")
+	// ErrTokenRevoked is returned if a token has been revoked
+	ErrTokenRevoked = errors.New("Support token revoked")
+	// ErrScopeNotAllowed is returned if a token was not minted with the requested scope
+	ErrScopeNotAllowed = errors.New("Support token scope not allowed")
+	// ErrTokenNotFound is returned when revoking a token ID that does not exist
+	ErrTokenNotFound = errors.New("Support token not found")
+)
+
+// MintError is returned by Mint for invalid token parameters
+type MintError struct {
+	error
+}
+
+// AuditAction is the type of an AuditEvent
+type AuditAction string
+
+const (
+	// AuditMint a token was minted
+	AuditMint AuditAction = "mint"
+	// AuditUse a token was used
+	AuditUse AuditAction = "use"
+	// AuditDeny a request with a token was denied
+	AuditDeny AuditAction = "deny"
+	// AuditRevoke a token was revoked
+	AuditRevoke AuditAction = "revoke"
+)
+
+// Token is a support access token. The token string is only returned by Mint.
+type Token struct {
+	ID         uint64   `json:"id"`
+	SkyAddress string   `json:"sky_address"`
+	Scopes     []string `json:"scopes"`
+	// Who the token was handed to, e.g. a ticket number or the name of a support contractor
+	IssuedTo   string `json:"issued_to"`
+	CreatedAt  int64  `json:"created_at"`
+	ExpiresAt  int64  `json:"expires_at"`
+	RevokedAt  int64  `json:"revoked_at,omitempty"`
+	Uses       uint64 `json:"uses"`
+	LastUsedAt int64  `json:"last_used_at,omitempty"`
+}
+
+// HasScope returns true if the token was minted with scope
+func (t Token) HasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// AuditEvent records an action on a support token
+type AuditEvent struct {
+	Seq        uint64      `json:"seq"`
+	Time       int64       `json:"time"`
+	Action     AuditAction `json:"action"`
+	TokenID    uint64      `json:"token_id,omitempty"`
+	SkyAddress string      `json:"sky_address,omitempty"`
+	Scope      string      `json:"scope,omitempty"`
+	Error      string      `json:"error,omitempty"`
+	RemoteAddr string      `json:"remote_addr,omitempty"`
+	RequestID  string      `json:"request_id,omitempty"`
+}
+
+// Origin identifies the request that acted on a token, for the audit log
+type Origin struct {
+	RemoteAddr string
+	RequestID  string
+}
+
+// Config configures a Store
+type Config struct {
+	// TTL of tokens minted without a TTL
+	DefaultTTL time.Duration
+	// Maximum TTL of a token
+	MaxTTL time.Duration
+}
+
+// Store mints, authorizes and revokes support tokens, and keeps their audit log
+type Store struct {
+	db  *bolt.DB
+	cfg Config
+	now func() time.Time
+}
+
+// NewStore creates a Store
+func NewStore(db *bolt.DB, cfg Config) (*Store, error) {
+	if db == nil {
+		return nil, errors.New("new support Store failed, db is nil")
+	}
+
+	if err := db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(tokensBkt); err != nil {
+			return dbutil.NewCreateBucketFailedErr(tokensBkt, err)
+		}
+
+		if _, err := tx.CreateBucketIfNotExists(auditBkt); err != nil {
+			return dbutil.NewCreateBucketFailedErr(auditBkt, err)
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return &Store{
+		db:  db,
+		cfg: cfg,
+		now: time.Now,
+	}, nil
+}
+
+// tokenKey returns the bucket key of a token string
+func tokenKey(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
+
+// Mint creates a token for skyAddr with scopes, expiring after ttl, or after the default TTL if ttl is 0.
+// It returns the token string, which can't be recovered later, and the token.
+func (s *Store) Mint(skyAddr string, scopes []string, ttl time.Duration, issuedTo string, o Origin) (string, Token, error) {
+	if _, err := cipher.DecodeBase58Address(skyAddr); err != nil {
+		return "", Token{}, MintError{fmt.Errorf("Invalid skycoin address: %v", err)}
+	}
+
+	if len(scopes) == 0 {
+		return "", Token{}, MintError{errors.New("Missing scopes")}
+	}
+
+	for _, scope := range scopes {
+		if !validScope(scope) {
+			return "", Token{}, MintError{fmt.Errorf("Unknown scope %q", scope)}
+		}
+	}
+
+	if issuedTo == "" {
+		return "", Token{}, MintError{errors.New("Missing issued_to")}
+	}
+
+	if ttl == 0 {
+		ttl = s.cfg.DefaultTTL
+	}
+
+	if ttl < time.Second {
+		return "", Token{}, MintError{errors.New("TTL must be at least 1s")}
+	}
+
+	if ttl > s.cfg.MaxTTL {
+		return "", Token{}, MintError{fmt.Errorf("TTL can't be longer than %s", s.cfg.MaxTTL)}
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", Token{}, err
+	}
+	token := hex.EncodeToString(b)
+
+	now := s.now().UTC()
+	t := Token{
+		SkyAddress: skyAddr,
+		Scopes:     scopes,
+		IssuedTo:   issuedTo,
+		CreatedAt:  now.Unix(),
+		ExpiresAt:  now.Add(ttl).Unix(),
+	}
+
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		id, err := dbutil.NextSequence(tx, tokensBkt)
+		if err != nil {
+			return err
+		}
+		t.ID = id
+
+		if err := dbutil.PutBucketValue(tx, tokensBkt, tokenKey(token), t); err != nil {
+			return err
+		}
+
+		return s.auditTx(tx, AuditEvent{
+			Action:     AuditMint,
+			TokenID:    t.ID,
+			SkyAddress: t.SkyAddress,
+		}, o)
+	}); err != nil {
+		return "", Token{}, err
+	}
+
+	return token, t, nil
+}
+
+// Authorize checks that token exists, has not expired or been revoked, and was minted with scope.
+// Uses and denied uses are audited. Returns ErrInvalidToken, ErrTokenExpired, ErrTokenRevoked
+// or ErrScopeNotAllowed if the token is not authorized.
+func (s *Store) Authorize(token, scope string, o Origin) (Token, error) {
+	var t Token
+	var authErr error
+
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		key := tokenKey(token)
+
+		ev := AuditEvent{
+			Action: AuditUse,
+			Scope:  scope,
+		}
+
+		err := dbutil.GetBucketObject(tx, tokensBkt, key, &t)
+		switch err.(type) {
+		case nil:
+			ev.TokenID = t.ID
+			ev.SkyAddress = t.SkyAddress
+
+			now := s.now().UTC().Unix()
+			switch {
+			case t.RevokedAt != 0:
+				authErr = ErrTokenRevoked
+			case now >= t.ExpiresAt:
+				authErr = ErrTokenExpired
+			case !t.HasScope(scope):
+				authErr = ErrScopeNotAllowed
+			default:
+				t.Uses++
+				t.LastUsedAt = now
+				if err := dbutil.PutBucketValue(tx, tokensBkt, key, t); err != nil {
+					return err
+				}
+			}
+		case dbutil.ObjectNotExistErr:
+			authErr = ErrInvalidToken
+		default:
+			return err
+		}
+
+		if authErr != nil {
+			ev.Action = AuditDeny
+			ev.Error = authErr.Error()
+		}
+
+		return s.auditTx(tx, ev, o)
+	}); err != nil {
+		return Token{}, err
+	}
+
+	if authErr != nil {
+		return Token{}, authErr
+	}
+
+	return t, nil
+}
+
+// Revoke revokes the token with id. Returns ErrTokenNotFound if there is no such token.
+// Revoking a revoked token is a no-op.
+func (s *Store) Revoke(id uint64, o Origin) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		var key []byte
+		var t Token
+		if err := dbutil.ForEach(tx, tokensBkt, func(k, v []byte) error {
+			if key != nil {
+				return nil
+			}
+
+			var tk Token
+			if err := json.Unmarshal(v, &tk); err != nil {
+				return fmt.Errorf("decode support token failed: %v", err)
+			}
+
+			if tk.ID == id {
+				key = append([]byte(nil), k...)
+				t = tk
+			}
+
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		if key == nil {
+			return ErrTokenNotFound
+		}
+
+		if t.RevokedAt != 0 {
+			return nil
+		}
+
+		t.RevokedAt = s.now().UTC().Unix()
+		if err := dbutil.PutBucketValue(tx, tokensBkt, string(key), t); err != nil {
+			return err
+		}
+
+		return s.auditTx(tx, AuditEvent{
+			Action:     AuditRevoke,
+			TokenID:    t.ID,
+			SkyAddress: t.SkyAddress,
+		}, o)
+	})
+}
+
+// Tokens returns all tokens, including expired and revoked ones, ordered by ID
+func (s *Store) Tokens() ([]Token, error) {
+	var ts []Token
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		return dbutil.ForEach(tx, tokensBkt, func(k, v []byte) error {
+			var t Token
+			if err := json.Unmarshal(v, &t); err != nil {
+				return fmt.Errorf("decode support token failed: %v", err)
+			}
+
+			ts = append(ts, t)
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(ts, func(i, j int) bool {
+		return ts[i].ID < ts[j].ID
+	})
+
+	return ts, nil
+}
+
+// Audit returns the audit log of the token with tokenID, oldest first.
+// If tokenID is 0, the complete audit log is returned.
+func (s *Store) Audit(tokenID uint64) ([]AuditEvent, error) {
+	var evs []AuditEvent
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return dbutil.ForEach(tx, auditBkt, func(k, v []byte) error {
+			var ev AuditEvent
+			if err := json.Unmarshal(v, &ev); err != nil {
+				return fmt.Errorf("decode support audit event %s failed: %v", k, err)
+			}
+
+			if tokenID == 0 || ev.TokenID == tokenID {
+				evs = append(evs, ev)
+			}
+
+			return nil
+		})
+	})
+	return evs, err
+}
+
+// EraseSkyAddressRemoteAddrs erases the remote addresses from the audit events of the tokens of a skycoin address,
+// and returns the number of events changed. It is the only change ever made to an event of the audit log.
+func (s *Store) EraseSkyAddressRemoteAddrs(skyAddr string) (int, error) {
+	var n int
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		// The bucket can't be written while iterating it
+		evs := make(map[string]AuditEvent)
+		if err := dbutil.ForEach(tx, auditBkt, func(k, v []byte) error {
+			var ev AuditEvent
+			if err := json.Unmarshal(v, &ev); err != nil {
+				return fmt.Errorf("decode support audit event %s failed: %v", k, err)
+			}
+
+			if ev.SkyAddress == skyAddr && ev.RemoteAddr != "" {
+				evs[string(k)] = ev
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		for k, ev := range evs {
+			ev.RemoteAddr = ""
+			if err := dbutil.PutBucketValue(tx, auditBkt, k, ev); err != nil {
+				return err
+			}
+		}
+
+		n = len(evs)
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+// auditTx appends an event to the audit log
+func (s *Store) auditTx(tx *bolt.Tx, ev AuditEvent, o Origin) error {
+	seq, err := dbutil.NextSequence(tx, auditBkt)
+	if err != nil {
+		return err
+	}
+
+	ev.Seq = seq
+	ev.Time = s.now().UTC().Unix()
+	ev.RemoteAddr = o.RemoteAddr
+	ev.RequestID = o.RequestID
+
+	return dbutil.PutBucketValue(tx, auditBkt, fmt.Sprintf("%020d", seq), ev)
+}
+
+func validScope(scope string) bool {
+	for _, s := range Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
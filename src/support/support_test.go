@@ -0,0 +1,187 @@
+package support
+
+import (
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+const testSkyAddr = "2Wbi4wvxC4fkTYMsS2f6HaFfW4pafDjXcQW"
+
+func TestStore(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	s, err := NewStore(db, Config{
+		DefaultTTL: time.Hour,
+		MaxTTL:     time.Hour * 24,
+	})
+	require.NoError(t, err)
+
+	now := time.Unix(1500000000, 0)
+	s.now = func() time.Time {
+		return now
+	}
+
+	admin := Origin{RemoteAddr: "127.0.0.1:1234"}
+	user := Origin{RemoteAddr: "1.2.3.4", RequestID: "req"}
+
+	// Invalid parameters
+	for _, tc := range []struct {
+		skyAddr  string
+		scopes   []string
+		ttl      time.Duration
+		issuedTo string
+	}{
+		{"bad", []string{ScopeStatus}, 0, "ticket 1"},
+		{testSkyAddr, nil, 0, "ticket 1"},
+		{testSkyAddr, []string{"admin"}, 0, "ticket 1"},
+		{testSkyAddr, []string{ScopeStatus}, 0, ""},
+		{testSkyAddr, []string{ScopeStatus}, -time.Hour, "ticket 1"},
+		{testSkyAddr, []string{ScopeStatus}, time.Hour * 25, "ticket 1"},
+	} {
+		_, _, err := s.Mint(tc.skyAddr, tc.scopes, tc.ttl, tc.issuedTo, admin)
+		require.Error(t, err)
+		_, ok := err.(MintError)
+		require.True(t, ok)
+	}
+
+	token, tk, err := s.Mint(testSkyAddr, []string{ScopeStatus}, 0, "ticket 1", admin)
+	require.NoError(t, err)
+	require.Len(t, token, 64)
+	require.Equal(t, Token{
+		ID:         1,
+		SkyAddress: testSkyAddr,
+		Scopes:     []string{ScopeStatus},
+		IssuedTo:   "ticket 1",
+		CreatedAt:  now.Unix(),
+		ExpiresAt:  now.Add(time.Hour).Unix(),
+	}, tk)
+
+	token2, tk2, err := s.Mint(testSkyAddr, []string{ScopeStatus}, time.Minute, "ticket 2", admin)
+	require.NoError(t, err)
+	require.NotEqual(t, token, token2)
+	require.Equal(t, uint64(2), tk2.ID)
+
+	// The token string is not stored
+	require.NoError(t, db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(tokensBkt).ForEach(func(k, v []byte) error {
+			require.NotContains(t, string(k), token)
+			require.NotContains(t, string(v), token)
+			return nil
+		})
+	}))
+
+	tk, err = s.Authorize(token, ScopeStatus, user)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), tk.Uses)
+	require.Equal(t, now.Unix(), tk.LastUsedAt)
+
+	_, err = s.Authorize(token, "admin", user)
+	require.Equal(t, ErrScopeNotAllowed, err)
+
+	_, err = s.Authorize("foo", ScopeStatus, user)
+	require.Equal(t, ErrInvalidToken, err)
+
+	// Tokens expire
+	now = now.Add(time.Minute)
+	_, err = s.Authorize(token2, ScopeStatus, user)
+	require.Equal(t, ErrTokenExpired, err)
+
+	tk, err = s.Authorize(token, ScopeStatus, user)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), tk.Uses)
+
+	// Revoked tokens are denied
+	require.Equal(t, ErrTokenNotFound, s.Revoke(3, admin))
+	require.NoError(t, s.Revoke(1, admin))
+	require.NoError(t, s.Revoke(1, admin))
+
+	_, err = s.Authorize(token, ScopeStatus, user)
+	require.Equal(t, ErrTokenRevoked, err)
+
+	ts, err := s.Tokens()
+	require.NoError(t, err)
+	require.Len(t, ts, 2)
+	require.Equal(t, uint64(1), ts[0].ID)
+	require.Equal(t, now.Unix(), ts[0].RevokedAt)
+	require.Equal(t, uint64(2), ts[0].Uses)
+	require.Equal(t, uint64(2), ts[1].ID)
+	require.Equal(t, int64(0), ts[1].RevokedAt)
+
+	// Everything is audited
+	evs, err := s.Audit(0)
+	require.NoError(t, err)
+
+	type entry struct {
+		action  AuditAction
+		tokenID uint64
+		err     error
+		origin  Origin
+	}
+	expected := []entry{
+		{AuditMint, 1, nil, admin},
+		{AuditMint, 2, nil, admin},
+		{AuditUse, 1, nil, user},
+		{AuditDeny, 1, ErrScopeNotAllowed, user},
+		{AuditDeny, 0, ErrInvalidToken, user},
+		{AuditDeny, 2, ErrTokenExpired, user},
+		{AuditUse, 1, nil, user},
+		{AuditRevoke, 1, nil, admin},
+		{AuditDeny, 1, ErrTokenRevoked, user},
+	}
+	require.Len(t, evs, len(expected))
+	for i, e := range expected {
+		ev := evs[i]
+		require.Equal(t, uint64(i+1), ev.Seq)
+		require.Equal(t, e.action, ev.Action, i)
+		require.Equal(t, e.tokenID, ev.TokenID, i)
+		require.Equal(t, e.origin.RemoteAddr, ev.RemoteAddr, i)
+		require.Equal(t, e.origin.RequestID, ev.RequestID, i)
+		if e.err != nil {
+			require.Equal(t, e.err.Error(), ev.Error, i)
+		} else {
+			require.Empty(t, ev.Error, i)
+		}
+		if e.tokenID != 0 {
+			require.Equal(t, testSkyAddr, ev.SkyAddress, i)
+		}
+	}
+
+	evs, err = s.Audit(2)
+	require.NoError(t, err)
+	require.Len(t, evs, 2)
+	require.Equal(t, AuditMint, evs[0].Action)
+	require.Equal(t, AuditDeny, evs[1].Action)
+
+	// The remote addresses of the events of a skycoin address can be erased
+	n, err := s.EraseSkyAddressRemoteAddrs("2GgFvqoyk9RjwVzj8tqfcXVXB4orBwoc9qv")
+	require.NoError(t, err)
+	require.Equal(t, 0, n)
+
+	n, err = s.EraseSkyAddressRemoteAddrs(testSkyAddr)
+	require.NoError(t, err)
+	require.Equal(t, len(expected)-1, n)
+
+	evs, err = s.Audit(0)
+	require.NoError(t, err)
+	require.Len(t, evs, len(expected))
+	for i, e := range expected {
+		ev := evs[i]
+		require.Equal(t, e.action, ev.Action, i)
+		require.Equal(t, e.origin.RequestID, ev.RequestID, i)
+		if e.tokenID != 0 {
+			require.Empty(t, ev.RemoteAddr, i)
+		} else {
+			require.Equal(t, e.origin.RemoteAddr, ev.RemoteAddr, i)
+		}
+	}
+
+	n, err = s.EraseSkyAddressRemoteAddrs(testSkyAddr)
+	require.NoError(t, err)
+	require.Equal(t, 0, n)
+}
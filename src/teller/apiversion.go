@@ -0,0 +1,132 @@
+package teller
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// apiVersion is a version of the JSON API, served under its prefix, e.g. /api/v1
+type apiVersion int
+
+const (
+	apiV1 apiVersion = 1
+	// apiV2 returns errors as JSON with an error code, see writeError
+	apiV2 apiVersion = 2
+
+	// latestAPIVersion is the newest API version. To change the request or response of an endpoint
+	// without breaking existing clients, add a version and register the new handler of the endpoint
+	// from that version, see apiRoutes.handle. The endpoints it doesn't change keep their handlers.
+	// A change to all endpoints, like the error responses of v2, can check the version of the request
+	// instead, see apiVersionFromContext.
+	latestAPIVersion = apiV2
+
+	// legacyAPIPrefix is the prefix of the unversioned endpoints, which are aliases of v1
+	legacyAPIPrefix = "/api"
+)
+
+func (v apiVersion) prefix() string {
+	return fmt.Sprintf("%s/v%d", legacyAPIPrefix, v)
+}
+
+type apiVersionCtxKey struct{}
+
+// apiVersionHandler puts the API version v of the requests to hd in their context
+func apiVersionHandler(v apiVersion, hd http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hd.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiVersionCtxKey{}, v)))
+	})
+}
+
+// apiVersionFromContext returns the API version of a request, v1 if the request is not to a versioned endpoint
+func apiVersionFromContext(ctx context.Context) apiVersion {
+	v, ok := ctx.Value(apiVersionCtxKey{}).(apiVersion)
+	if !ok {
+		return apiV1
+	}
+	return v
+}
+
+// apiRoutes collects the handlers of the API endpoints by version. An endpoint is served by every
+// version since the one it was added in, with the handler of the latest version that changed it.
+type apiRoutes struct {
+	paths    []string
+	handlers map[string]map[apiVersion]http.Handler
+}
+
+func newAPIRoutes() *apiRoutes {
+	return &apiRoutes{
+		handlers: make(map[string]map[apiVersion]http.Handler),
+	}
+}
+
+// handle sets the handler of the endpoint at path, relative to the version prefix, e.g. "/bind",
+// from version since on
+func (rs *apiRoutes) handle(path string, since apiVersion, h http.Handler) {
+	if since < apiV1 || since > latestAPIVersion {
+		panic(fmt.Sprintf("invalid API version %d of %s", since, path))
+	}
+
+	if _, ok := rs.handlers[path]; !ok {
+		rs.paths = append(rs.paths, path)
+		rs.handlers[path] = make(map[apiVersion]http.Handler)
+	}
+
+	if _, ok := rs.handlers[path][since]; ok {
+		panic(fmt.Sprintf("duplicate handler of %s in API version %d", path, since))
+	}
+
+	rs.handlers[path][since] = h
+}
+
+// handler returns the handler of the endpoint at path in version v, or nil if v doesn't have it
+func (rs *apiRoutes) handler(path string, v apiVersion) http.Handler {
+	for ; v >= apiV1; v-- {
+		if h, ok := rs.handlers[path][v]; ok {
+			return h
+		}
+	}
+
+	return nil
+}
+
+// register calls handle with the version, full path and handler of every endpoint of every version,
+// e.g. /api/v1/bind. The legacy unversioned paths, e.g. /api/bind, are registered too, and serve
+// the v1 handlers as if the request was made to the v1 path, so that the deployed clients
+// keep working and share the rate limits of v1.
+func (rs *apiRoutes) register(handle func(v apiVersion, path string, h http.Handler)) {
+	for v := apiV1; v <= latestAPIVersion; v++ {
+		for _, path := range rs.paths {
+			if h := rs.handler(path, v); h != nil {
+				handle(v, v.prefix()+path, h)
+			}
+		}
+	}
+
+	for _, path := range rs.paths {
+		if h := rs.handler(path, apiV1); h != nil {
+			handle(apiV1, legacyAPIPrefix+path, aliasHandler(apiV1.prefix()+path, h))
+		}
+	}
+}
+
+// endpointPath returns the path of an API endpoint relative to the prefix of its version,
+// e.g. /bind for /api/v2/bind
+func endpointPath(v apiVersion, path string) string {
+	return strings.TrimPrefix(path, v.prefix())
+}
+
+// aliasHandler serves requests with h as if they were made to path
+func aliasHandler(path string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r2 := new(http.Request)
+		*r2 = *r
+		r2.URL = new(url.URL)
+		*r2.URL = *r.URL
+		r2.URL.Path = path
+		r2.URL.RawPath = ""
+		h.ServeHTTP(w, r2)
+	})
+}
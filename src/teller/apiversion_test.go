@@ -0,0 +1,169 @@
+package teller
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/config"
+)
+
+// versionHandler responds with its name, the API version of the request and the path it was served as
+func versionHandler(name string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s v%d %s", name, apiVersionFromContext(r.Context()), r.URL.Path)
+	})
+}
+
+// newRoutesMux registers rs in a mux the way HTTPServer.setupMux does, without the middlewares
+func newRoutesMux(rs *apiRoutes) (*http.ServeMux, []string) {
+	mux := http.NewServeMux()
+	var paths []string
+	rs.register(func(v apiVersion, path string, h http.Handler) {
+		paths = append(paths, path)
+		mux.Handle(path, apiVersionHandler(v, h))
+	})
+	return mux, paths
+}
+
+func serveAPI(mux http.Handler, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	return w
+}
+
+func TestAPIRoutesHandler(t *testing.T) {
+	rs := newAPIRoutes()
+	rs.handle("/bind", apiV1, versionHandler("bind1"))
+	rs.handle("/bind", apiV2, versionHandler("bind2"))
+	rs.handle("/status", apiV1, versionHandler("status1"))
+	rs.handle("/new", apiV2, versionHandler("new2"))
+
+	name := func(h http.Handler) string {
+		require.NotNil(t, h)
+		w := serveAPI(h, "/")
+		return strings.Fields(w.Body.String())[0]
+	}
+
+	// Versions use the handler of the latest version up to them that changed the endpoint
+	require.Equal(t, "bind1", name(rs.handler("/bind", apiV1)))
+	require.Equal(t, "bind2", name(rs.handler("/bind", apiV2)))
+	require.Equal(t, "status1", name(rs.handler("/status", apiV1)))
+	require.Equal(t, "status1", name(rs.handler("/status", apiV2)))
+
+	// Endpoints are not served by the versions before the one they were added in
+	require.Nil(t, rs.handler("/new", apiV1))
+	require.NotNil(t, rs.handler("/new", apiV2))
+	require.Nil(t, rs.handler("/unknown", apiV2))
+}
+
+func TestAPIRoutesRegister(t *testing.T) {
+	rs := newAPIRoutes()
+	rs.handle("/bind", apiV1, versionHandler("bind1"))
+	rs.handle("/bind", apiV2, versionHandler("bind2"))
+	rs.handle("/status", apiV1, versionHandler("status1"))
+	rs.handle("/new", apiV2, versionHandler("new2"))
+
+	mux, paths := newRoutesMux(rs)
+	require.Equal(t, []string{
+		"/api/v1/bind",
+		"/api/v1/status",
+		"/api/v2/bind",
+		"/api/v2/status",
+		"/api/v2/new",
+		"/api/bind",
+		"/api/status",
+	}, paths)
+
+	cases := []struct {
+		path string
+		body string
+	}{
+		{"/api/v1/bind", "bind1 v1 /api/v1/bind"},
+		{"/api/v2/bind", "bind2 v2 /api/v2/bind"},
+		// v2 falls back to the v1 handler of the endpoints it didn't change
+		{"/api/v1/status", "status1 v1 /api/v1/status"},
+		{"/api/v2/status", "status1 v2 /api/v2/status"},
+		{"/api/v2/new", "new2 v2 /api/v2/new"},
+		// The legacy paths serve v1, as if the request was made to the v1 path
+		{"/api/bind", "bind1 v1 /api/v1/bind"},
+		{"/api/status", "status1 v1 /api/v1/status"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.path, func(t *testing.T) {
+			w := serveAPI(mux, tc.path)
+			require.Equal(t, http.StatusOK, w.Code)
+			require.Equal(t, tc.body, w.Body.String())
+		})
+	}
+
+	// Endpoints added in v2 have no v1 or legacy path
+	require.Equal(t, http.StatusNotFound, serveAPI(mux, "/api/v1/new").Code)
+	require.Equal(t, http.StatusNotFound, serveAPI(mux, "/api/new").Code)
+}
+
+func TestAliasHandler(t *testing.T) {
+	var got *http.Request
+	h := aliasHandler("/api/v1/status", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/api/status?skyaddr=abc", nil)
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	require.Equal(t, "/api/v1/status", got.URL.Path)
+	require.Equal(t, "skyaddr=abc", got.URL.RawQuery)
+
+	// The original request is not modified
+	require.Equal(t, "/api/status", r.URL.Path)
+}
+
+func TestAPIRoutesHandlePanics(t *testing.T) {
+	h := versionHandler("bind")
+
+	rs := newAPIRoutes()
+	rs.handle("/bind", apiV1, h)
+
+	require.Panics(t, func() {
+		rs.handle("/bind", apiV1, h)
+	})
+
+	require.Panics(t, func() {
+		rs.handle("/bind", apiVersion(0), h)
+	})
+
+	require.Panics(t, func() {
+		rs.handle("/bind", latestAPIVersion+1, h)
+	})
+
+	require.NotPanics(t, func() {
+		rs.handle("/bind", latestAPIVersion, h)
+	})
+}
+
+func TestAPIRoutesShareIPThrottle(t *testing.T) {
+	remoteIP := func(r *http.Request) string {
+		return strings.Split(r.RemoteAddr, ":")[0]
+	}
+
+	throttle := newIPThrottle(config.Web{
+		ThrottleMax:      2,
+		ThrottleDuration: time.Second,
+	}, remoteIP, versionHandler("bind"))
+
+	rs := newAPIRoutes()
+	rs.handle("/bind", apiV1, throttle)
+	mux, _ := newRoutesMux(rs)
+
+	// The legacy, v1 and v2 paths of an endpoint count against the same limit
+	require.Equal(t, http.StatusOK, serveAPI(mux, "/api/bind").Code)
+	require.Equal(t, http.StatusOK, serveAPI(mux, "/api/v1/bind").Code)
+	require.Equal(t, http.StatusTooManyRequests, serveAPI(mux, "/api/v2/bind").Code)
+	require.Equal(t, http.StatusTooManyRequests, serveAPI(mux, "/api/bind").Code)
+}
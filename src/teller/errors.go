@@ -0,0 +1,274 @@
+package teller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/skycoin/teller/src/addrs"
+	"github.com/skycoin/teller/src/apikey"
+	"github.com/skycoin/teller/src/campaign"
+	"github.com/skycoin/teller/src/captcha"
+	"github.com/skycoin/teller/src/exchange"
+	"github.com/skycoin/teller/src/kyc"
+	"github.com/skycoin/teller/src/notify"
+	"github.com/skycoin/teller/src/ownership"
+	"github.com/skycoin/teller/src/promo"
+	"github.com/skycoin/teller/src/quote"
+	"github.com/skycoin/teller/src/support"
+	"github.com/skycoin/teller/src/util/httputil"
+	"github.com/skycoin/teller/src/util/logger"
+	"github.com/skycoin/teller/src/util/openapi"
+	"github.com/skycoin/teller/src/util/qrutil"
+)
+
+// Error codes of API error responses. Clients should check the code of an error instead of its message,
+// which can change. The code is in the X-Error-Code header, and in the JSON body of errors in API v2.
+const (
+	// Generic codes, of errors without a code of their own
+	ErrCodeInvalidRequest       = "invalid_request"
+	ErrCodeUnauthorized         = "unauthorized"
+	ErrCodeForbidden            = "forbidden"
+	ErrCodeNotFound             = "not_found"
+	ErrCodeMethodNotAllowed     = "method_not_allowed"
+	ErrCodeRequestTooLarge      = "request_too_large"
+	ErrCodeUnsupportedMediaType = "unsupported_media_type"
+	ErrCodeInternalError        = "internal_error"
+	ErrCodeServiceUnavailable   = "service_unavailable"
+	ErrCodeMaintenance          = "maintenance"
+	ErrCodeReadOnly             = "read_only"
+	ErrCodeIPBlocked            = "ip_blocked"
+
+	ErrCodeInvalidJSON               = "invalid_json"
+	ErrCodeRateLimited               = "rate_limited"
+	ErrCodeTooManyConcurrentRequests = "too_many_concurrent_requests"
+	ErrCodeSkyAddrRateLimited        = "skyaddr_rate_limited"
+	ErrCodeAPIDisabled               = "api_disabled"
+	ErrCodeMissingSkyAddr            = "missing_skyaddr"
+	ErrCodeInvalidSkyAddr            = "invalid_skyaddr"
+	ErrCodeMissingCoinType           = "missing_coin_type"
+	ErrCodeInvalidCoinType           = "invalid_coin_type"
+	ErrCodeCoinTypeNotEnabled        = "coin_type_not_enabled"
+	ErrCodeInvalidAmount             = "invalid_amount"
+	ErrCodeAmountNotSupported        = "amount_not_supported"
+	ErrCodeMissingCaptchaToken       = "missing_captcha_token"
+	ErrCodeInvalidCaptchaToken       = "invalid_captcha_token"
+	ErrCodeDepositsPaused            = "deposits_paused"
+	ErrCodeMaxBoundAddresses         = "max_bound_addresses"
+	ErrCodeDepositAddressesEmpty     = "deposit_addresses_empty"
+	ErrCodeMissingSkyAddrs           = "missing_skyaddrs"
+	ErrCodeTooManySkyAddrs           = "too_many_skyaddrs"
+	ErrCodeDuplicateSkyAddr          = "duplicate_skyaddr"
+	ErrCodeMissingTxid               = "missing_txid"
+	ErrCodeMissingN                  = "missing_n"
+	ErrCodeInvalidN                  = "invalid_n"
+	ErrCodeDepositNotFound           = "deposit_not_found"
+	ErrCodeMissingData               = "missing_data"
+	ErrCodeInvalidData               = "invalid_data"
+	ErrCodeInvalidURI                = "invalid_uri"
+	ErrCodeInvalidHistory            = "invalid_history"
+	ErrCodeInvalidSize               = "invalid_size"
+	ErrCodePaymentURINotSupported    = "payment_uri_not_supported"
+	ErrCodeMissingSupportToken       = "missing_support_token"
+	ErrCodeInvalidSupportToken       = "invalid_support_token"
+	ErrCodeSupportTokenExpired       = "support_token_expired"
+	ErrCodeSupportTokenRevoked       = "support_token_revoked"
+	ErrCodeSupportTokenScope         = "support_token_scope_not_allowed"
+	ErrCodeInvalidAPIKey             = "invalid_api_key"
+	ErrCodeAPIKeyRevoked             = "api_key_revoked"
+	ErrCodeInvalidSignature          = "invalid_signature"
+	ErrCodeInvalidTimestamp          = "invalid_timestamp"
+	ErrCodeOwnershipRequired         = "ownership_proof_required"
+	ErrCodeInvalidNonce              = "invalid_nonce"
+	ErrCodeNonceExpired              = "nonce_expired"
+	ErrCodeBindSignatureRequired     = "bind_signature_required"
+	ErrCodeCampaignNotFound          = "campaign_not_found"
+	ErrCodeCampaignDisabled          = "campaign_disabled"
+	ErrCodeCampaignCapReached        = "campaign_cap_reached"
+	ErrCodeQuoteNotFound             = "quote_not_found"
+	ErrCodeQuoteExpired              = "quote_expired"
+	ErrCodeQuoteUsed                 = "quote_used"
+	ErrCodeQuoteCoinTypeMismatch     = "quote_coin_type_mismatch"
+	ErrCodePromoCodeNotFound         = "promo_code_not_found"
+	ErrCodePromoCodeDisabled         = "promo_code_disabled"
+	ErrCodePromoCodeExpired          = "promo_code_expired"
+	ErrCodePromoCodeMaxUses          = "promo_code_max_uses"
+	ErrCodeKYCRequired               = "kyc_required"
+	ErrCodeInvalidEmail              = "invalid_email"
+	ErrCodeNotificationsDisabled     = "email_notifications_disabled"
+	ErrCodeInvalidUnsubscribeToken   = "invalid_unsubscribe_token"
+)
+
+var (
+	errInternalServerError = errors.New("Internal Server Error")
+
+	errSkyAddrLimited = errors.New("Too many requests for this skycoin address")
+
+	errRateLimited = errors.New("You have reached maximum request limit.")
+
+	errAPIDisabled = newAPIError(ErrCodeAPIDisabled, "API disabled")
+
+	errIPBlocked = newAPIError(ErrCodeIPBlocked, "Access from your IP address is blocked")
+
+	// errorCodes are the codes of the errors that are not apiErrors, e.g. of other packages
+	errorCodes = map[error]string{
+		errInternalServerError:                ErrCodeInternalError,
+		errSkyAddrLimited:                     ErrCodeSkyAddrRateLimited,
+		errRateLimited:                        ErrCodeRateLimited,
+		httputil.ErrTooManyConcurrentRequests: ErrCodeTooManyConcurrentRequests,
+		ErrDepositsPaused:                     ErrCodeDepositsPaused,
+		ErrMaxBoundAddresses:                  ErrCodeMaxBoundAddresses,
+		addrs.ErrDepositAddressEmpty:          ErrCodeDepositAddressesEmpty,
+		exchange.ErrDepositNotFound:           ErrCodeDepositNotFound,
+		captcha.ErrInvalidToken:               ErrCodeInvalidCaptchaToken,
+		support.ErrInvalidToken:               ErrCodeInvalidSupportToken,
+		support.ErrTokenExpired:               ErrCodeSupportTokenExpired,
+		support.ErrTokenRevoked:               ErrCodeSupportTokenRevoked,
+		support.ErrScopeNotAllowed:            ErrCodeSupportTokenScope,
+		apikey.ErrInvalidKey:                  ErrCodeInvalidAPIKey,
+		apikey.ErrKeyRevoked:                  ErrCodeAPIKeyRevoked,
+		apikey.ErrInvalidSignature:            ErrCodeInvalidSignature,
+		apikey.ErrInvalidTimestamp:            ErrCodeInvalidTimestamp,
+		ownership.ErrInvalidNonce:             ErrCodeInvalidNonce,
+		ownership.ErrNonceExpired:             ErrCodeNonceExpired,
+		ownership.ErrInvalidSignature:         ErrCodeInvalidSignature,
+		ownership.ErrInvalidTimestamp:         ErrCodeInvalidTimestamp,
+		campaign.ErrNotFound:                  ErrCodeCampaignNotFound,
+		campaign.ErrDisabled:                  ErrCodeCampaignDisabled,
+		campaign.ErrCapReached:                ErrCodeCampaignCapReached,
+		quote.ErrNotFound:                     ErrCodeQuoteNotFound,
+		quote.ErrExpired:                      ErrCodeQuoteExpired,
+		quote.ErrUsed:                         ErrCodeQuoteUsed,
+		quote.ErrCoinTypeMismatch:             ErrCodeQuoteCoinTypeMismatch,
+		promo.ErrNotFound:                     ErrCodePromoCodeNotFound,
+		promo.ErrDisabled:                     ErrCodePromoCodeDisabled,
+		promo.ErrExpired:                      ErrCodePromoCodeExpired,
+		promo.ErrMaxUses:                      ErrCodePromoCodeMaxUses,
+		kyc.ErrNotVerified:                    ErrCodeKYCRequired,
+		notify.ErrInvalidEmail:                ErrCodeInvalidEmail,
+		ErrNotificationsDisabled:              ErrCodeNotificationsDisabled,
+		notify.ErrInvalidToken:                ErrCodeInvalidUnsubscribeToken,
+		qrutil.ErrInvalidAmount:               ErrCodeInvalidAmount,
+		qrutil.ErrInvalidSize:                 ErrCodeInvalidSize,
+	}
+
+	// statusErrorCodes are the codes of the errors without a code of their own, by response status
+	statusErrorCodes = map[int]string{
+		http.StatusBadRequest:            ErrCodeInvalidRequest,
+		http.StatusUnauthorized:          ErrCodeUnauthorized,
+		http.StatusForbidden:             ErrCodeForbidden,
+		http.StatusNotFound:              ErrCodeNotFound,
+		http.StatusMethodNotAllowed:      ErrCodeMethodNotAllowed,
+		http.StatusRequestEntityTooLarge: ErrCodeRequestTooLarge,
+		http.StatusUnsupportedMediaType:  ErrCodeUnsupportedMediaType,
+		http.StatusTooManyRequests:       ErrCodeRateLimited,
+		http.StatusInternalServerError:   ErrCodeInternalError,
+		http.StatusServiceUnavailable:    ErrCodeServiceUnavailable,
+	}
+)
+
+// apiError is an error of an API response with its error code
+type apiError struct {
+	code string
+	msg  string
+}
+
+func newAPIError(code, format string, args ...interface{}) error {
+	return apiError{
+		code: code,
+		msg:  fmt.Sprintf(format, args...),
+	}
+}
+
+func (e apiError) Error() string {
+	return e.msg
+}
+
+// errorCode returns the error code of err in a response with status
+func errorCode(status int, err error) string {
+	if e, ok := err.(apiError); ok {
+		return e.code
+	}
+
+	if code, ok := errorCodes[err]; ok {
+		return code
+	}
+
+	if code, ok := statusErrorCodes[status]; ok {
+		return code
+	}
+
+	return strings.Replace(strings.ToLower(http.StatusText(status)), " ", "_", -1)
+}
+
+// ErrorResponse http response of a failed request in API v2
+type ErrorResponse struct {
+	Error ErrorDetail `json:"error"`
+}
+
+// ErrorDetail is the error of an ErrorResponse
+type ErrorDetail struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// Parameters and request body fields that failed the validation against the API spec, for invalid_request errors
+	InvalidParams []openapi.InvalidParam `json:"invalid_params,omitempty"`
+}
+
+// errorResponse logs err and writes it as the error response of a request
+func errorResponse(ctx context.Context, w http.ResponseWriter, code int, err error) {
+	log := logger.FromContext(ctx)
+	log.WithFields(logrus.Fields{
+		"status":    code,
+		"statusMsg": http.StatusText(code),
+	}).WithError(err).Info()
+
+	writeError(ctx, w, code, err)
+}
+
+// writeError writes err as the error response of a request, with the error code in the X-Error-Code header.
+// The error is written in plain text, or as an ErrorResponse in API v2.
+func writeError(ctx context.Context, w http.ResponseWriter, status int, err error) {
+	writeErrorDetail(ctx, w, status, ErrorDetail{
+		Code:    errorCode(status, err),
+		Message: err.Error(),
+	})
+}
+
+func writeErrorDetail(ctx context.Context, w http.ResponseWriter, status int, e ErrorDetail) {
+	w.Header().Set(httputil.ErrorCodeHeader, e.Code)
+
+	if apiVersionFromContext(ctx) < apiV2 {
+		httputil.ErrResponse(w, status, e.Message)
+		return
+	}
+
+	if err := httputil.JSONStatusResponse(w, status, ErrorResponse{
+		Error: e,
+	}); err != nil {
+		if log := logger.FromContext(ctx); log != nil {
+			log.WithError(err).Error(err)
+		}
+	}
+}
+
+// invalidRequestResponse writes the error response of a request that failed the validation against the API spec.
+// In API v1 the error is written in plain text, or as problem details if the client accepts them.
+func invalidRequestResponse(w http.ResponseWriter, r *http.Request, status int, invalid []openapi.InvalidParam) {
+	code := statusErrorCodes[status]
+
+	if apiVersionFromContext(r.Context()) < apiV2 {
+		w.Header().Set(httputil.ErrorCodeHeader, code)
+		openapi.ProblemResponse(w, r, status, invalid)
+		return
+	}
+
+	writeErrorDetail(r.Context(), w, status, ErrorDetail{
+		Code:          code,
+		Message:       openapi.Detail(invalid),
+		InvalidParams: invalid,
+	})
+}
@@ -1,12 +1,17 @@
 package teller
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
 	"encoding/json"
-	"errors"
 	"fmt"
+	"io/ioutil"
+	"math"
+	"net"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -14,6 +19,8 @@ import (
 
 	"github.com/NYTimes/gziphandler"
 	"github.com/gz-c/tollbooth"
+	"github.com/gz-c/tollbooth/libstring"
+	"github.com/gz-c/tollbooth/limiter"
 	"github.com/rs/cors"
 	"github.com/sirupsen/logrus"
 	"github.com/unrolled/secure"
@@ -23,11 +30,28 @@ import (
 	"github.com/skycoin/skycoin/src/util/droplet"
 
 	"github.com/skycoin/teller/src/addrs"
+	"github.com/skycoin/teller/src/apikey"
+	"github.com/skycoin/teller/src/campaign"
+	"github.com/skycoin/teller/src/captcha"
 	"github.com/skycoin/teller/src/config"
 	"github.com/skycoin/teller/src/exchange"
+	"github.com/skycoin/teller/src/ipfilter"
+	"github.com/skycoin/teller/src/kyc"
+	"github.com/skycoin/teller/src/notify"
+	"github.com/skycoin/teller/src/ownership"
+	"github.com/skycoin/teller/src/pricing"
+	"github.com/skycoin/teller/src/promo"
+	"github.com/skycoin/teller/src/quote"
+	"github.com/skycoin/teller/src/ratelimit"
 	"github.com/skycoin/teller/src/scanner"
+	"github.com/skycoin/teller/src/support"
+	"github.com/skycoin/teller/src/tracing"
 	"github.com/skycoin/teller/src/util/httputil"
+	"github.com/skycoin/teller/src/util/listenutil"
 	"github.com/skycoin/teller/src/util/logger"
+	"github.com/skycoin/teller/src/util/openapi"
+	"github.com/skycoin/teller/src/util/proxyproto"
+	"github.com/skycoin/teller/src/util/qrutil"
 )
 
 const (
@@ -42,59 +66,219 @@ const (
 
 	// Directory where cached SSL certs from Let's Encrypt are stored
 	tlsAutoCertCache = "cert-cache"
+
+	// Default width and height of /api/qr images, in pixels
+	qrDefaultSize = 256
 )
 
 var (
-	errInternalServerError = errors.New("Internal Server Error")
+	// qrURISchemes are the BIP21 payment URI schemes of the coin types that have one
+	qrURISchemes = map[string]string{
+		scanner.CoinTypeBTC: "bitcoin",
+		scanner.CoinTypeLTC: "litecoin",
+	}
+
+	// apiDeprecations lists the deprecated API endpoints and fields.
+	// Their responses get deprecation headers, and they are listed by /api/config.
+	apiDeprecations = []httputil.Deprecation{}
 )
 
+// CaptchaVerifier verifies captcha tokens sent with bind requests
+type CaptchaVerifier interface {
+	Verify(token, remoteIP string) error
+}
+
+// SupportTokenAuthorizer authorizes requests made with support access tokens
+type SupportTokenAuthorizer interface {
+	Authorize(token, scope string, o support.Origin) (support.Token, error)
+}
+
+// APIKeyVerifier verifies the requests of trusted integrators signed with their API keys
+type APIKeyVerifier interface {
+	Verify(id, timestamp, signature, method, uri string, body []byte) (apikey.Key, error)
+}
+
+// OwnershipVerifier issues challenges to prove the ownership of a skycoin address, and verifies their signatures
+type OwnershipVerifier interface {
+	Issue(skyAddr string) (ownership.Challenge, error)
+	Verify(skyAddr, nonce, sig string) error
+}
+
+// BindSignatureVerifier verifies bind requests signed with the secret key of their skycoin address
+type BindSignatureVerifier interface {
+	Verify(timestamp int64, skyAddr, coinType, amount, sig string) error
+}
+
+// KYCVerifier checks whether the owners of skycoin addresses passed KYC
+type KYCVerifier interface {
+	Verified(ctx context.Context, skyAddr, token string) (bool, error)
+}
+
+// ErrorCounter counts the server errors of API handlers, e.g. to alert on repeated errors
+type ErrorCounter interface {
+	Handler(http.Handler) http.Handler
+}
+
 // HTTPServer exposes the API endpoints and static website
 type HTTPServer struct {
-	cfg           config.Config
-	log           logrus.FieldLogger
-	service       *Service
-	httpListener  *http.Server
-	httpsListener *http.Server
-	quit          chan struct{}
-	done          chan struct{}
+	cfg            config.Config
+	cfgLock        sync.RWMutex // guards cfg, maintenance and the rate limiters, which are changed by Reload, and trustedNets
+	log            logrus.FieldLogger
+	service        *Service
+	limitStore     ratelimit.Store
+	localIPStore   *ratelimit.MemoryStore // per IP limit of weighted requests with the local backend
+	addrLimiter    *ratelimit.Limiter
+	ipLimiter      *ratelimit.Limiter
+	ipThrottles    []*ipThrottle // per IP limits kept in memory, one for each rate limited endpoint
+	trustedNets    ipfilter.List // web.trusted_proxies
+	maintenance    MaintenanceState
+	captcha        CaptchaVerifier
+	pricer         *pricing.Pricer
+	supportTokens  SupportTokenAuthorizer
+	errorCounter   ErrorCounter          // optional, counts the server errors of the API
+	apiKeys        APIKeyVerifier        // optional, signed requests are verified if set
+	ipFilter       *ipfilter.Filter      // optional, requests from blocked IPs are denied if set
+	tracer         *tracing.Tracer       // optional, requests are traced if set
+	ownership      OwnershipVerifier     // optional, status requests must prove the ownership of their skycoin address if set
+	bindSignatures BindSignatureVerifier // optional, bind requests must be signed with their skycoin address if set
+	kyc            KYCVerifier           // optional, the owners of the skycoin addresses of bind requests must pass KYC if set
+	readOnly       bool                  // bind and quote requests get a 503 response if set
+	httpListener   *http.Server
+	httpsListener  *http.Server
+	quit           chan struct{}
+	done           chan struct{}
 }
 
-// NewHTTPServer creates an HTTPServer
-func NewHTTPServer(log logrus.FieldLogger, cfg config.Config, service *Service) *HTTPServer {
+// NewHTTPServer creates an HTTPServer. If captchaVerifier is nil, bind requests are not captcha verified.
+// If pricer is nil, all clients get the default pricing. If supportTokens is nil, /api/support/status is not served.
+func NewHTTPServer(log logrus.FieldLogger, cfg config.Config, service *Service, limitStore ratelimit.Store, captchaVerifier CaptchaVerifier, pricer *pricing.Pricer, supportTokens SupportTokenAuthorizer) *HTTPServer {
 	return &HTTPServer{
 		cfg: cfg.Redacted(),
 		log: log.WithFields(logrus.Fields{
 			"prefix": "teller.http",
 		}),
-		service: service,
-		quit:    make(chan struct{}),
-		done:    make(chan struct{}),
+		service:       service,
+		limitStore:    limitStore,
+		localIPStore:  ratelimit.NewMemoryStore(),
+		captcha:       captchaVerifier,
+		pricer:        pricer,
+		supportTokens: supportTokens,
+		maintenance:   newMaintenanceState(cfg.Web.Maintenance, ""),
+		quit:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+}
+
+// config returns the config of the HTTPServer, which is changed by Reload
+func (s *HTTPServer) config() config.Config {
+	s.cfgLock.RLock()
+	defer s.cfgLock.RUnlock()
+	return s.cfg
+}
+
+// Reload applies the exchange rates, max bound addresses, rate limits, maintenance mode and IP lists of cfg,
+// which is the running config with the settings changed by config.Reload. Rate limits kept in redis
+// or the db keep their state, per IP limits kept in memory are reset. Maintenance mode set by
+// SetMaintenance is only replaced if web.maintenance changed. IP bans are kept.
+func (s *HTTPServer) Reload(cfg config.Config) error {
+	addrLimiter, ipLimiter, err := s.newLimiters(cfg.Web)
+	if err != nil {
+		return err
+	}
+
+	if s.ipFilter != nil {
+		if err := s.ipFilter.SetLists(cfg.Web.IPAllowlist, cfg.Web.IPDenylist); err != nil {
+			return err
+		}
+	}
+
+	s.cfgLock.Lock()
+	defer s.cfgLock.Unlock()
+
+	if cfg.Web.Maintenance != s.cfg.Web.Maintenance {
+		s.maintenance = newMaintenanceState(cfg.Web.Maintenance, "")
+	}
+
+	s.cfg = cfg.Redacted()
+	s.addrLimiter = addrLimiter
+	s.ipLimiter = ipLimiter
+	for _, t := range s.ipThrottles {
+		t.setLimit(cfg.Web)
+	}
+
+	return nil
+}
+
+// newLimiters creates the per skycoin address limiter, if enabled, and the per IP limiter.
+// With the local backend, the per IP limit of most requests is kept in tollbooth's memory, which
+// can't weigh requests, so the per IP limiter only limits weighted requests, e.g. batch status requests.
+func (s *HTTPServer) newLimiters(cfg config.Web) (*ratelimit.Limiter, *ratelimit.Limiter, error) {
+	var addrLimiter *ratelimit.Limiter
+
+	if cfg.AddrThrottleBurst > 0 {
+		var err error
+		addrLimiter, err = ratelimit.NewLimiter(s.limitStore, "skyaddr:", cfg.AddrThrottleBurst, cfg.AddrThrottleDuration)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var ipStore ratelimit.Store = s.localIPStore
+	if cfg.RateLimitBackend == config.RateLimitBackendRedis {
+		ipStore = s.limitStore
 	}
+
+	ipLimiter, err := ratelimit.NewLimiter(ipStore, "ip:", cfg.ThrottleMax, cfg.ThrottleDuration)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return addrLimiter, ipLimiter, nil
 }
 
 // Run runs the HTTPServer
 func (s *HTTPServer) Run() error {
+	cfg := s.config()
+
 	log := s.log
-	log.WithField("config", s.cfg).Info("HTTP service start")
+	log.WithField("config", cfg).Info("HTTP service start")
 	defer log.Info("HTTP service closed")
 	defer close(s.done)
 
-	var mux http.Handler = s.setupMux()
+	addrLimiter, ipLimiter, err := s.newLimiters(cfg.Web)
+	if err != nil {
+		log.WithError(err).Error("newLimiters failed")
+		return err
+	}
+
+	trustedProxies, err := ipfilter.ParseList(cfg.Web.TrustedProxies)
+	if err != nil {
+		log.WithError(err).Error("Invalid web.trusted_proxies")
+		return err
+	}
+
+	s.cfgLock.Lock()
+	s.addrLimiter = addrLimiter
+	s.ipLimiter = ipLimiter
+	s.trustedNets = trustedProxies
+	s.cfgLock.Unlock()
+
+	var mux http.Handler = s.setupMux(cfg)
 
 	allowedHosts := []string{} // empty array means all hosts allowed
 	sslHost := ""
-	if s.cfg.Web.AutoTLSHost == "" {
+	if cfg.Web.AutoTLSHost == "" {
 		// Note: if AutoTLSHost is not set, but HTTPSAddr is set, then
 		// http will redirect to the HTTPSAddr listening IP, which would be
 		// either 127.0.0.1 or 0.0.0.0
 		// When running behind a DNS name, make sure to set AutoTLSHost
-		sslHost = s.cfg.Web.HTTPSAddr
+		sslHost = cfg.Web.HTTPSAddr
 	} else {
-		sslHost = s.cfg.Web.AutoTLSHost
+		sslHost = cfg.Web.AutoTLSHost
 		// When using -auto-tls-host,
 		// which implies automatic Let's Encrypt SSL cert generation in production,
 		// restrict allowed hosts to that host.
-		allowedHosts = []string{s.cfg.Web.AutoTLSHost}
+		allowedHosts = []string{cfg.Web.AutoTLSHost}
 	}
 
 	if len(allowedHosts) == 0 {
@@ -110,8 +294,8 @@ func (s *HTTPServer) Run() error {
 	secureMiddleware := configureSecureMiddleware(sslHost, allowedHosts)
 	mux = secureMiddleware.Handler(mux)
 
-	if s.cfg.Web.HTTPAddr != "" {
-		s.httpListener = setupHTTPListener(s.cfg.Web.HTTPAddr, mux)
+	if cfg.Web.HTTPAddr != "" {
+		s.httpListener = setupHTTPListener(cfg.Web.HTTPAddr, mux)
 	}
 
 	handleListenErr := func(f func() error) error {
@@ -127,29 +311,29 @@ func (s *HTTPServer) Run() error {
 		return nil
 	}
 
-	if s.cfg.Web.HTTPAddr != "" {
-		log.Info(fmt.Sprintf("HTTP server listening on http://%s", s.cfg.Web.HTTPAddr))
+	if cfg.Web.HTTPAddr != "" {
+		log.Info(fmt.Sprintf("HTTP server listening on http://%s", cfg.Web.HTTPAddr))
 	}
-	if s.cfg.Web.HTTPSAddr != "" {
-		log.Info(fmt.Sprintf("HTTPS server listening on https://%s", s.cfg.Web.HTTPSAddr))
+	if cfg.Web.HTTPSAddr != "" {
+		log.Info(fmt.Sprintf("HTTPS server listening on https://%s", cfg.Web.HTTPSAddr))
 	}
 
 	var tlsCert, tlsKey string
-	if s.cfg.Web.HTTPSAddr != "" {
+	if cfg.Web.HTTPSAddr != "" {
 		log.Info("Using TLS")
 
-		s.httpsListener = setupHTTPListener(s.cfg.Web.HTTPSAddr, mux)
+		s.httpsListener = setupHTTPListener(cfg.Web.HTTPSAddr, mux)
 
-		tlsCert = s.cfg.Web.TLSCert
-		tlsKey = s.cfg.Web.TLSKey
+		tlsCert = cfg.Web.TLSCert
+		tlsKey = cfg.Web.TLSKey
 
-		if s.cfg.Web.AutoTLSHost != "" {
+		if cfg.Web.AutoTLSHost != "" {
 			log.Info("Using Let's Encrypt autocert")
 			// https://godoc.org/golang.org/x/crypto/acme/autocert
 			// https://stackoverflow.com/a/40494806
 			certManager := autocert.Manager{
 				Prompt:     autocert.AcceptTOS,
-				HostPolicy: autocert.HostWhitelist(s.cfg.Web.AutoTLSHost),
+				HostPolicy: autocert.HostWhitelist(cfg.Web.AutoTLSHost),
 				Cache:      autocert.DirCache(tlsAutoCertCache),
 			}
 
@@ -168,22 +352,22 @@ func (s *HTTPServer) Run() error {
 		var wg sync.WaitGroup
 		errC := make(chan error)
 
-		if s.cfg.Web.HTTPAddr != "" {
+		if cfg.Web.HTTPAddr != "" {
 			wg.Add(1)
 			go func() {
 				defer wg.Done()
-				if err := s.httpListener.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				if err := s.listenAndServe(s.httpListener, false, "", ""); err != nil && err != http.ErrServerClosed {
 					log.WithError(err).Println("ListenAndServe error")
 					errC <- err
 				}
 			}()
 		}
 
-		if s.cfg.Web.HTTPSAddr != "" {
+		if cfg.Web.HTTPSAddr != "" {
 			wg.Add(1)
 			go func() {
 				defer wg.Done()
-				if err := s.httpsListener.ListenAndServeTLS(tlsCert, tlsKey); err != nil && err != http.ErrServerClosed {
+				if err := s.listenAndServe(s.httpsListener, true, tlsCert, tlsKey); err != nil && err != http.ErrServerClosed {
 					log.WithError(err).Error("ListenAndServeTLS error")
 					errC <- err
 				}
@@ -208,6 +392,39 @@ func (s *HTTPServer) Run() error {
 	})
 }
 
+// listenAndServe serves srv on its address, over TLS if useTLS is set. The address can be a unix socket
+// or a systemd socket, see listenutil.Listen. With web.proxy_protocol, the PROXY headers of the connections
+// from web.trusted_proxies are read.
+func (s *HTTPServer) listenAndServe(srv *http.Server, useTLS bool, tlsCert, tlsKey string) error {
+	s.cfgLock.RLock()
+	cfg := s.cfg.Web
+	trustedProxies := s.trustedNets
+	s.cfgLock.RUnlock()
+
+	mode, err := cfg.SocketMode()
+	if err != nil {
+		return err
+	}
+
+	ln, err := listenutil.Listen(srv.Addr, mode)
+	if err != nil {
+		return err
+	}
+
+	if cfg.ProxyProtocol {
+		ln = &proxyproto.Listener{
+			Listener:      ln,
+			Trusted:       trustedProxies.Contains,
+			HeaderTimeout: serverReadTimeout,
+		}
+	}
+
+	if useTLS {
+		return srv.ServeTLS(ln, tlsCert, tlsKey)
+	}
+	return srv.Serve(ln)
+}
+
 func configureSecureMiddleware(sslHost string, allowedHosts []string) *secure.Secure {
 	sslRedirect := true
 	if sslHost == "" {
@@ -256,18 +473,49 @@ func setupHTTPListener(addr string, handler http.Handler) *http.Server {
 	}
 }
 
-func (s *HTTPServer) setupMux() *http.ServeMux {
+func (s *HTTPServer) setupMux(cfg config.Config) *http.ServeMux {
 	mux := http.NewServeMux()
 
 	ratelimit := func(h http.Handler) http.Handler {
-		limiter := tollbooth.NewLimiter(s.cfg.Web.ThrottleMax, s.cfg.Web.ThrottleDuration, nil)
-		if s.cfg.Web.BehindProxy {
-			limiter.SetIPLookups([]string{"X-Forwarded-For", "RemoteAddr", "X-Real-IP"})
+		// The per IP limit is kept in tollbooth's memory, unless it has to be
+		// shared with other teller instances
+		var limited http.Handler
+		if cfg.Web.RateLimitBackend == config.RateLimitBackendRedis {
+			limited = s.limitIP(h)
+		} else {
+			t := newIPThrottle(cfg.Web, s.remoteIP, h)
+
+			s.cfgLock.Lock()
+			s.ipThrottles = append(s.ipThrottles, t)
+			s.cfgLock.Unlock()
+
+			limited = t
 		}
-		return tollbooth.LimitHandler(limiter, h)
+
+		// Signed requests of integrators are not limited
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := apiKeyFromContext(r.Context()); ok {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			limited.ServeHTTP(w, r)
+		})
 	}
 
-	handleAPI := func(path string, h http.Handler) {
+	// Concurrent requests per IP are capped for all requests,
+	// static file bandwidth per IP is capped separately
+	connQuota := httputil.NewQuota(cfg.Web.MaxConnsPerIP, 0)
+	connQuota.SetErrorFunc(func(w http.ResponseWriter, r *http.Request, status int, err error) {
+		writeError(r.Context(), w, status, err)
+	})
+	staticQuota := httputil.NewQuota(0, cfg.Web.StaticBandwidthPerIP)
+
+	handleAPI := func(v apiVersion, path string, h http.Handler) {
+		if s.errorCounter != nil {
+			h = s.errorCounter.Handler(h)
+		}
+
 		// Allow requests from a local skycoin wallet
 		h = cors.New(cors.Options{
 			AllowedOrigins: []string{"http://127.0.0.1:6420"},
@@ -275,16 +523,77 @@ func (s *HTTPServer) setupMux() *http.ServeMux {
 
 		h = gziphandler.GzipHandler(h)
 
+		h = httputil.DeprecationHandler(apiDeprecations, h)
+
+		h = s.tracer.Handler(path, h)
+
+		h = httputil.RequestIDHandler(h)
+
+		h = connQuota.Handler(s.remoteIP, h)
+
+		h = s.ipFilterHandler(h)
+
+		h = apiVersionHandler(v, h)
+
 		mux.Handle(path, h)
 	}
 
+	// Requests are validated against the spec of their API version, after the rate limit
+	specs := make([]*openapi.Document, 0, latestAPIVersion)
+	for v := apiV1; v <= latestAPIVersion; v++ {
+		specs = append(specs, apiSpec(v))
+	}
+
+	validate := func(h http.Handler) http.Handler {
+		return openapi.ValidationHandler(specs, invalidRequestResponse, h)
+	}
+
+	// Requests get a 503 response in maintenance mode, and signed requests are verified,
+	// before the rate limits, which signed requests are exempt from
+	guard := func(h http.Handler) http.Handler {
+		if s.apiKeys != nil {
+			h = s.signedRequestHandler(h)
+		}
+		return s.maintenanceHandler(h)
+	}
+
 	// API Methods
-	handleAPI("/api/bind", ratelimit(httputil.LogHandler(s.log, BindHandler(s))))
-	handleAPI("/api/status", ratelimit(httputil.LogHandler(s.log, StatusHandler(s))))
-	handleAPI("/api/config", ConfigHandler(s))
+	routes := newAPIRoutes()
+	routes.handle("/bind", apiV1, guard(s.readOnlyHandler(ratelimit(httputil.LogHandler(s.log, validate(BindHandler(s)))))))
+	routes.handle("/status", apiV1, guard(ratelimit(httputil.LogHandler(s.log, validate(StatusHandler(s))))))
+	// Limited per IP by the number of addresses in the request, see allowIPN
+	routes.handle("/status/batch", apiV1, guard(httputil.LogHandler(s.log, validate(BatchStatusHandler(s)))))
+	routes.handle("/deposit", apiV1, guard(ratelimit(httputil.LogHandler(s.log, validate(DepositHandler(s))))))
+	routes.handle("/qr", apiV1, guard(ratelimit(httputil.LogHandler(s.log, validate(QRHandler(s))))))
+	// Served in maintenance mode, to report it
+	routes.handle("/config", apiV1, ConfigHandler(s))
+	routes.handle("/spec", apiV1, guard(SpecHandler(specs[apiV1-1])))
+
+	if s.supportTokens != nil {
+		routes.handle("/support/status", apiV1, guard(ratelimit(httputil.LogHandler(s.log, validate(SupportStatusHandler(s))))))
+	}
+
+	if s.ownership != nil {
+		routes.handle("/status/challenge", apiV1, guard(ratelimit(httputil.LogHandler(s.log, validate(StatusChallengeHandler(s))))))
+	}
+
+	if s.service.notifications != nil {
+		routes.handle("/notifications/unsubscribe", apiV1, guard(ratelimit(httputil.LogHandler(s.log, validate(UnsubscribeHandler(s))))))
+	}
+
+	if s.service.quotes != nil {
+		routes.handle("/quote", apiV1, guard(s.readOnlyHandler(ratelimit(httputil.LogHandler(s.log, validate(QuoteHandler(s)))))))
+	}
+
+	routes.register(handleAPI)
 
 	// Static files
-	mux.Handle("/", gziphandler.GzipHandler(http.FileServer(http.Dir(s.cfg.Web.StaticDir))))
+	// Bandwidth is throttled after compression
+	var static http.Handler = gziphandler.GzipHandler(http.FileServer(http.Dir(cfg.Web.StaticDir)))
+	static = staticQuota.Handler(s.remoteIP, static)
+	static = connQuota.Handler(s.remoteIP, static)
+	static = s.ipFilterHandler(static)
+	mux.Handle("/", static)
 
 	return mux
 }
@@ -330,23 +639,59 @@ func (s *HTTPServer) Shutdown() {
 type BindResponse struct {
 	DepositAddress string `json:"deposit_address,omitempty"`
 	CoinType       string `json:"coin_type,omitempty"`
+	PaymentURI     string `json:"payment_uri,omitempty"`
+	// Unix time the deposit address is unbound at if it receives no deposit, omitted if it does not expire
+	ExpiresAt int64 `json:"expires_at,omitempty"`
 }
 
 type bindRequest struct {
-	SkyAddr  string `json:"skyaddr"`
-	CoinType string `json:"coin_type"`
+	SkyAddr      string `json:"skyaddr"`
+	CoinType     string `json:"coin_type"`
+	Amount       string `json:"amount,omitempty"`
+	CaptchaToken string `json:"captcha_token,omitempty"`
+	Campaign     string `json:"campaign,omitempty"`
+	QuoteID      string `json:"quote_id,omitempty"`
+	PromoCode    string `json:"promo_code,omitempty"`
+	KYCToken     string `json:"kyc_token,omitempty"`
+	Email        string `json:"email,omitempty"`
+	Timestamp    int64  `json:"timestamp,omitempty"`
+	Signature    string `json:"signature,omitempty"`
+}
+
+// logged returns the request as it is logged, without the email address
+func (r bindRequest) logged() bindRequest {
+	if r.Email != "" {
+		r.Email = "<redacted>"
+	}
+	return r
 }
 
-// BindHandler binds skycoin address with a bitcoin address
+// BindHandler binds skycoin address with a bitcoin, litecoin or ethereum deposit address
 // Method: POST
 // Accept: application/json
 // URI: /api/bind
 // Args:
-//    {"skyaddr": "...", "coin_type": "BTC"}
+//
+//	{"skyaddr": "...", "coin_type": "BTC", "amount": "0.01", "captcha_token": "...", "campaign": "...", "quote_id": "...", "promo_code": "...", "kyc_token": "...", "email": "...", "timestamp": 1500000000, "signature": "..."}
+//	coin_type is "BTC", "LTC" if LTC is enabled, or an ERC20 token symbol if ERC20 tokens are enabled
+//	amount is optional, the value in BTC or LTC that the deposit is expected to have.
+//	Deposits that don't match it are reported as underpaid or overpaid, but still converted.
+//	captcha_token is required if captcha verification is enabled
+//	campaign is optional, the ID of the campaign to bind a deposit address of
+//	quote_id is optional, the ID of a quote of /api/quote whose rate the deposits get. It can't be used with campaign.
+//	promo_code is optional, a promo or referral code whose bonus the deposits get
+//	kyc_token is optional, a token of the KYC service that links skyaddr to the user, if KYC is required at bind
+//	email is optional, an email address that is notified when deposits to the address are done or fail,
+//	if email notifications are enabled
+//	timestamp and signature are required if bind signatures are enabled: signature is the hex signature,
+//	made with the secret key of skyaddr, of the SHA256 of the message of ownership.BindMessage
+//
+// For BTC and LTC the response includes the BIP21 payment URI of the deposit address, with the amount
 func BindHandler(s *HTTPServer) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 		log := logger.FromContext(ctx)
+		cfg := s.config()
 
 		w.Header().Set("Accept", "application/json")
 
@@ -355,54 +700,112 @@ func BindHandler(s *HTTPServer) http.HandlerFunc {
 		}
 
 		if r.Header.Get("Content-Type") != "application/json" {
-			errorResponse(ctx, w, http.StatusUnsupportedMediaType, errors.New("Invalid content type"))
+			errorResponse(ctx, w, http.StatusUnsupportedMediaType, newAPIError(ErrCodeUnsupportedMediaType, "Invalid content type"))
 			return
 		}
 
 		bindReq := &bindRequest{}
 		decoder := json.NewDecoder(r.Body)
 		if err := decoder.Decode(&bindReq); err != nil {
-			err = fmt.Errorf("Invalid json request body: %v", err)
+			err = newAPIError(ErrCodeInvalidJSON, "Invalid json request body: %v", err)
 			errorResponse(ctx, w, http.StatusBadRequest, err)
 			return
 		}
 		defer r.Body.Close()
 
-		log = log.WithField("bindReq", bindReq)
+		log = log.WithField("bindReq", bindReq.logged())
 		ctx = logger.WithContext(ctx, log)
 		r = r.WithContext(ctx)
 
 		if bindReq.SkyAddr == "" {
-			errorResponse(ctx, w, http.StatusBadRequest, errors.New("Missing skyaddr"))
+			errorResponse(ctx, w, http.StatusBadRequest, newAPIError(ErrCodeMissingSkyAddr, "Missing skyaddr"))
 			return
 		}
 
-		switch bindReq.CoinType {
-		case scanner.CoinTypeBTC:
-		case "":
-			errorResponse(ctx, w, http.StatusBadRequest, errors.New("Missing coin_type"))
+		if err := verifyCoinType(cfg, bindReq.CoinType); err != nil {
+			errorResponse(ctx, w, http.StatusBadRequest, err)
 			return
-		default:
-			errorResponse(ctx, w, http.StatusBadRequest, errors.New("Invalid coin_type"))
+		}
+
+		if bindReq.Campaign != "" && bindReq.QuoteID != "" {
+			errorResponse(ctx, w, http.StatusBadRequest, newAPIError(ErrCodeInvalidRequest, "campaign and quote_id can't be used together"))
 			return
 		}
 
+		var expectedValue int64
+		if bindReq.Amount != "" {
+			if _, ok := qrURISchemes[bindReq.CoinType]; !ok {
+				errorResponse(ctx, w, http.StatusBadRequest, newAPIError(ErrCodeAmountNotSupported, "Amounts are not supported for %s", bindReq.CoinType))
+				return
+			}
+
+			var err error
+			expectedValue, err = qrutil.ParseAmount(bindReq.Amount)
+			if err != nil {
+				errorResponse(ctx, w, http.StatusBadRequest, err)
+				return
+			}
+		}
+
+		if bindReq.Email != "" {
+			if err := notify.ValidateEmail(bindReq.Email); err != nil {
+				errorResponse(ctx, w, http.StatusBadRequest, err)
+				return
+			}
+		}
+
 		log.Info()
 
 		if !verifySkycoinAddress(ctx, w, bindReq.SkyAddr) {
 			return
 		}
 
-		if !s.cfg.Web.APIEnabled {
-			errorResponse(ctx, w, http.StatusForbidden, errors.New("API disabled"))
+		if !s.allowSkyAddr(ctx, w, bindReq.SkyAddr) {
+			return
+		}
+
+		if !cfg.Web.APIEnabled {
+			errorResponse(ctx, w, http.StatusForbidden, errAPIDisabled)
+			return
+		}
+
+		if !s.verifyBindSignature(ctx, w, bindReq) {
+			return
+		}
+
+		if !s.verifyCaptcha(ctx, w, r, bindReq.CaptchaToken) {
+			return
+		}
+
+		if !s.verifyKYC(ctx, w, bindReq) {
 			return
 		}
 
-		log.Info("Calling service.BindAddress")
+		region, _ := s.region(r)
 
-		btcAddr, err := s.service.BindAddress(bindReq.SkyAddr)
+		log.WithField("region", region.Name).Info("Calling service.BindAddress")
+
+		depositAddr, expiresAt, err := s.service.BindAddress(ctx, bindReq.SkyAddr, bindReq.CoinType, region.Name, bindReq.Campaign, bindReq.QuoteID, bindReq.PromoCode, bindReq.Email, expectedValue)
 		if err != nil {
 			log.WithError(err).Error("service.BindAddress failed")
+			switch err {
+			case ErrDepositsPaused:
+				errorResponse(ctx, w, http.StatusServiceUnavailable, err)
+				return
+			case campaign.ErrNotFound, quote.ErrNotFound, promo.ErrNotFound:
+				errorResponse(ctx, w, http.StatusNotFound, err)
+				return
+			case campaign.ErrDisabled, campaign.ErrCapReached, quote.ErrExpired,
+				promo.ErrDisabled, promo.ErrExpired, promo.ErrMaxUses:
+				errorResponse(ctx, w, http.StatusForbidden, err)
+				return
+			case quote.ErrUsed:
+				errorResponse(ctx, w, http.StatusConflict, err)
+				return
+			case quote.ErrCoinTypeMismatch, ErrNotificationsDisabled:
+				errorResponse(ctx, w, http.StatusBadRequest, err)
+				return
+			}
 			if err != addrs.ErrDepositAddressEmpty && err != ErrMaxBoundAddresses {
 				err = errInternalServerError
 			}
@@ -410,16 +813,24 @@ func BindHandler(s *HTTPServer) http.HandlerFunc {
 			return
 		}
 
-		log = log.WithField("btcAddr", btcAddr)
+		log = log.WithField("depositAddr", depositAddr)
 		ctx = logger.WithContext(ctx, log)
 		r = r.WithContext(ctx)
 
-		log.Info("Bound sky and btc addresses")
+		log.Info("Bound sky and deposit addresses")
 
-		if err := httputil.JSONResponse(w, BindResponse{
-			DepositAddress: btcAddr,
-			CoinType:       scanner.CoinTypeBTC,
-		}); err != nil {
+		resp := BindResponse{
+			DepositAddress: depositAddr,
+			CoinType:       bindReq.CoinType,
+			ExpiresAt:      expiresAt,
+		}
+
+		if scheme, ok := qrURISchemes[bindReq.CoinType]; ok {
+			// The amount was validated already, so this can't fail
+			resp.PaymentURI, _ = qrutil.PaymentURI(scheme, depositAddr, bindReq.Amount)
+		}
+
+		if err := httputil.JSONResponse(w, resp); err != nil {
 			log.WithError(err).Error(err)
 		}
 	}
@@ -428,17 +839,24 @@ func BindHandler(s *HTTPServer) http.HandlerFunc {
 // StatusResponse http response for /api/status
 type StatusResponse struct {
 	Statuses []exchange.DepositStatus `json:"statuses,omitempty"`
+	// SKY the skycoin address can still buy, omitted if there is no lifetime purchase limit
+	RemainingSky string `json:"remaining_sky,omitempty"`
 }
 
 // StatusHandler returns the deposit status of specific skycoin address
 // Method: GET
 // URI: /api/status
 // Args:
-//     skyaddr
+//
+//	skyaddr
+//	history [optional] include the status history of each deposit
+//	nonce [optional] nonce of /api/status/challenge, required if status challenges are enabled
+//	signature [optional] signature of the nonce by skyaddr, required if status challenges are enabled
 func StatusHandler(s *HTTPServer) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 		log := logger.FromContext(ctx)
+		cfg := s.config()
 
 		if !validMethod(ctx, w, r, []string{http.MethodGet}) {
 			return
@@ -446,10 +864,20 @@ func StatusHandler(s *HTTPServer) http.HandlerFunc {
 
 		skyAddr := r.URL.Query().Get("skyaddr")
 		if skyAddr == "" {
-			errorResponse(ctx, w, http.StatusBadRequest, errors.New("Missing skyaddr"))
+			errorResponse(ctx, w, http.StatusBadRequest, newAPIError(ErrCodeMissingSkyAddr, "Missing skyaddr"))
 			return
 		}
 
+		var history bool
+		if v := r.URL.Query().Get("history"); v != "" {
+			var err error
+			history, err = strconv.ParseBool(v)
+			if err != nil {
+				errorResponse(ctx, w, http.StatusBadRequest, newAPIError(ErrCodeInvalidHistory, "Invalid history"))
+				return
+			}
+		}
+
 		log = log.WithField("skyAddr", skyAddr)
 		ctx = logger.WithContext(ctx, log)
 		r = r.WithContext(ctx)
@@ -460,14 +888,22 @@ func StatusHandler(s *HTTPServer) http.HandlerFunc {
 			return
 		}
 
-		if !s.cfg.Web.APIEnabled {
-			errorResponse(ctx, w, http.StatusForbidden, errors.New("API disabled"))
+		if !s.allowSkyAddr(ctx, w, skyAddr) {
+			return
+		}
+
+		if !cfg.Web.APIEnabled {
+			errorResponse(ctx, w, http.StatusForbidden, errAPIDisabled)
+			return
+		}
+
+		if !s.verifyOwnership(ctx, w, r, skyAddr) {
 			return
 		}
 
 		log.Info("Sending StatusRequest to teller")
 
-		depositStatuses, err := s.service.GetDepositStatuses(skyAddr)
+		depositStatuses, err := s.service.GetDepositStatuses(ctx, skyAddr, history)
 		if err != nil {
 			log.WithError(err).Error("service.GetDepositStatuses failed")
 			errorResponse(ctx, w, http.StatusInternalServerError, errInternalServerError)
@@ -483,27 +919,30 @@ func StatusHandler(s *HTTPServer) http.HandlerFunc {
 
 		log.Info("Got depositStatuses")
 
+		remainingSky, err := s.service.RemainingSky(ctx, skyAddr)
+		if err != nil {
+			log.WithError(err).Error("service.RemainingSky failed")
+			errorResponse(ctx, w, http.StatusInternalServerError, errInternalServerError)
+			return
+		}
+
 		if err := httputil.JSONResponse(w, StatusResponse{
-			Statuses: depositStatuses,
+			Statuses:     depositStatuses,
+			RemainingSky: remainingSky,
 		}); err != nil {
 			log.WithError(err).Error(err)
 		}
 	}
 }
 
-// ConfigResponse http response for /api/config
-type ConfigResponse struct {
-	Enabled                  bool   `json:"enabled"`
-	BtcConfirmationsRequired int64  `json:"btc_confirmations_required"`
-	MaxBoundBtcAddresses     int    `json:"max_bound_btc_addrs"`
-	SkyBtcExchangeRate       string `json:"sky_btc_exchange_rate"`
-	MaxDecimals              int    `json:"max_decimals"`
-}
-
-// ConfigHandler returns the teller configuration
+// StatusChallengeHandler returns a nonce to sign with the secret key of a skycoin address, to prove its ownership
+// in a status request. Only served if status challenges are enabled.
 // Method: GET
-// URI: /api/config
-func ConfigHandler(s *HTTPServer) http.HandlerFunc {
+// URI: /api/status/challenge
+// Args:
+//
+//	skyaddr
+func StatusChallengeHandler(s *HTTPServer) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 		log := logger.FromContext(ctx)
@@ -512,76 +951,1323 @@ func ConfigHandler(s *HTTPServer) http.HandlerFunc {
 			return
 		}
 
-		// Convert the exchange rate to a skycoin balance string
-		rate := s.cfg.SkyExchanger.SkyBtcExchangeRate
-		maxDecimals := s.cfg.SkyExchanger.MaxDecimals
-		dropletsPerBTC, err := exchange.CalculateBtcSkyValue(exchange.SatoshisPerBTC, rate, maxDecimals)
+		skyAddr := r.URL.Query().Get("skyaddr")
+		if skyAddr == "" {
+			errorResponse(ctx, w, http.StatusBadRequest, newAPIError(ErrCodeMissingSkyAddr, "Missing skyaddr"))
+			return
+		}
+
+		log = log.WithField("skyAddr", skyAddr)
+		ctx = logger.WithContext(ctx, log)
+
+		if !verifySkycoinAddress(ctx, w, skyAddr) {
+			return
+		}
+
+		ch, err := s.ownership.Issue(skyAddr)
 		if err != nil {
-			log.WithError(err).Error("exchange.CalculateBtcSkyValue failed")
+			log.WithError(err).Error("ownership.Issue failed")
 			errorResponse(ctx, w, http.StatusInternalServerError, errInternalServerError)
 			return
 		}
 
-		skyPerBTC, err := droplet.ToString(dropletsPerBTC)
+		if err := httputil.JSONResponse(w, ch); err != nil {
+			log.WithError(err).Error(err)
+		}
+	}
+}
+
+// UnsubscribeResponse http response for /api/notifications/unsubscribe
+type UnsubscribeResponse struct {
+	// Number of deposit addresses the email address was deleted from
+	Unsubscribed int `json:"unsubscribed"`
+}
+
+// UnsubscribeHandler deletes the email address of the unsubscribe link of a notification email from all
+// the deposit addresses it was left for. Only served if email notifications are enabled.
+// Mail clients that support one-click unsubscribe, RFC 8058, POST to the link.
+// Method: GET, POST
+// URI: /api/notifications/unsubscribe
+// Args:
+//
+//	email, the hash of the email address
+//	token, the token of the link
+func UnsubscribeHandler(s *HTTPServer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := logger.FromContext(ctx)
+
+		if !validMethod(ctx, w, r, []string{http.MethodGet, http.MethodPost}) {
+			return
+		}
+
+		emailHash := r.URL.Query().Get("email")
+		token := r.URL.Query().Get("token")
+		if emailHash == "" || token == "" {
+			errorResponse(ctx, w, http.StatusBadRequest, newAPIError(ErrCodeInvalidRequest, "Missing email or token"))
+			return
+		}
+
+		log = log.WithField("emailHash", emailHash)
+		ctx = logger.WithContext(ctx, log)
+
+		n, err := s.service.notifications.Unsubscribe(emailHash, token)
 		if err != nil {
-			log.WithError(err).Error("droplet.ToString failed")
+			if err == notify.ErrInvalidToken {
+				errorResponse(ctx, w, http.StatusForbidden, err)
+				return
+			}
+
+			log.WithError(err).Error("notifications.Unsubscribe failed")
 			errorResponse(ctx, w, http.StatusInternalServerError, errInternalServerError)
 			return
 		}
 
-		if err := httputil.JSONResponse(w, ConfigResponse{
-			Enabled:                  s.cfg.Web.APIEnabled,
-			BtcConfirmationsRequired: s.cfg.BtcScanner.ConfirmationsRequired,
-			SkyBtcExchangeRate:       skyPerBTC,
-			MaxDecimals:              maxDecimals,
-			MaxBoundBtcAddresses:     s.cfg.Teller.MaxBoundBtcAddresses,
+		log.WithField("unsubscribed", n).Info("Unsubscribed email address")
+
+		if err := httputil.JSONResponse(w, UnsubscribeResponse{
+			Unsubscribed: n,
 		}); err != nil {
 			log.WithError(err).Error(err)
 		}
 	}
 }
 
-func validMethod(ctx context.Context, w http.ResponseWriter, r *http.Request, allowed []string) bool {
-	for _, m := range allowed {
-		if r.Method == m {
-			return true
+// QuoteResponse http response for /api/quote
+type QuoteResponse struct {
+	QuoteID  string `json:"quote_id"`
+	CoinType string `json:"coin_type"`
+	// SKY per coin, including the bonus of the pricing region of the client
+	SkyExchangeRate string `json:"sky_exchange_rate"`
+	// Deposit amount range the rate applies to, in coins. Omitted if there is no limit.
+	MinAmount string `json:"min_amount,omitempty"`
+	MaxAmount string `json:"max_amount,omitempty"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+// QuoteHandler returns a fixed-price quote of a coin type. A deposit address bound with the quote ID
+// gets the quoted rate for deposits within the amount range that arrive before the quote expires.
+// Only served if quotes are enabled.
+// Method: POST
+// Accept: application/json
+// URI: /api/quote
+// Args:
+//
+//	{"coin_type": "BTC"}
+func QuoteHandler(s *HTTPServer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := logger.FromContext(ctx)
+		cfg := s.config()
+
+		w.Header().Set("Accept", "application/json")
+
+		if !validMethod(ctx, w, r, []string{http.MethodPost}) {
+			return
 		}
-	}
 
-	w.Header().Set("Allow", strings.Join(allowed, ", "))
+		if r.Header.Get("Content-Type") != "application/json" {
+			errorResponse(ctx, w, http.StatusUnsupportedMediaType, newAPIError(ErrCodeUnsupportedMediaType, "Invalid content type"))
+			return
+		}
 
-	status := http.StatusMethodNotAllowed
-	errorResponse(ctx, w, status, errors.New("Invalid request method"))
+		var req struct {
+			CoinType string `json:"coin_type"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			err = newAPIError(ErrCodeInvalidJSON, "Invalid json request body: %v", err)
+			errorResponse(ctx, w, http.StatusBadRequest, err)
+			return
+		}
+		defer r.Body.Close()
 
-	return false
-}
+		if err := verifyCoinType(cfg, req.CoinType); err != nil {
+			errorResponse(ctx, w, http.StatusBadRequest, err)
+			return
+		}
 
-func verifySkycoinAddress(ctx context.Context, w http.ResponseWriter, skyAddr string) bool {
-	log := logger.FromContext(ctx)
+		if !cfg.Web.APIEnabled {
+			errorResponse(ctx, w, http.StatusForbidden, errAPIDisabled)
+			return
+		}
 
-	if _, err := cipher.DecodeBase58Address(skyAddr); err != nil {
-		msg := fmt.Sprintf("Invalid skycoin address: %v", err)
-		httputil.ErrResponse(w, http.StatusBadRequest, msg)
-		log.WithFields(logrus.Fields{
-			"status":  http.StatusBadRequest,
-			"skyAddr": skyAddr,
-		}).WithError(err).Info("Invalid skycoin address")
-		return false
-	}
+		if s.service.Paused() {
+			errorResponse(ctx, w, http.StatusServiceUnavailable, ErrDepositsPaused)
+			return
+		}
 
-	return true
-}
+		rate, ok := coinRate(cfg, req.CoinType)
+		if !ok {
+			errorResponse(ctx, w, http.StatusBadRequest, newAPIError(ErrCodeInvalidCoinType, "Invalid coin_type"))
+			return
+		}
 
-func errorResponse(ctx context.Context, w http.ResponseWriter, code int, err error) {
-	log := logger.FromContext(ctx)
-	log.WithFields(logrus.Fields{
-		"status":    code,
-		"statusMsg": http.StatusText(code),
-	}).WithError(err).Info()
+		// The quoted rate is final, so it includes the bonus of the client's pricing region
+		region, _ := s.region(r)
+		rate, err := region.Rate(rate)
+		if err != nil {
+			log.WithError(err).Error("region.Rate failed")
+			errorResponse(ctx, w, http.StatusInternalServerError, errInternalServerError)
+			return
+		}
 
-	if err != errInternalServerError {
-		httputil.ErrResponse(w, code, err.Error())
-	} else {
-		httputil.ErrResponse(w, code)
-	}
+		skyPer, err := skyPerCoin(rate, cfg.SkyExchanger.MaxDecimals)
+		if err != nil {
+			log.WithError(err).Error("skyPerCoin failed")
+			errorResponse(ctx, w, http.StatusInternalServerError, errInternalServerError)
+			return
+		}
+
+		q, err := s.service.quotes.Issue(req.CoinType, rate)
+		if err != nil {
+			log.WithError(err).Error("quotes.Issue failed")
+			errorResponse(ctx, w, http.StatusInternalServerError, errInternalServerError)
+			return
+		}
+
+		log.WithFields(logrus.Fields{
+			"quoteID": q.ID,
+			"rate":    q.Rate,
+			"region":  region.Name,
+		}).Info("Issued quote")
+
+		rsp := QuoteResponse{
+			QuoteID:         q.ID,
+			CoinType:        q.CoinType,
+			SkyExchangeRate: skyPer,
+			ExpiresAt:       q.ExpiresAt,
+		}
+		if q.MinAmount > 0 {
+			rsp.MinAmount = qrutil.FormatAmount(q.MinAmount)
+		}
+		if q.MaxAmount > 0 {
+			rsp.MaxAmount = qrutil.FormatAmount(q.MaxAmount)
+		}
+
+		if err := httputil.JSONResponse(w, rsp); err != nil {
+			log.WithError(err).Error(err)
+		}
+	}
+}
+
+// coinRate returns the configured exchange rate of a coin type
+func coinRate(cfg config.Config, coinType string) (string, bool) {
+	switch coinType {
+	case scanner.CoinTypeBTC:
+		return cfg.SkyExchanger.SkyBtcExchangeRate, true
+	case scanner.CoinTypeLTC:
+		return cfg.SkyExchanger.SkyLtcExchangeRate, cfg.LtcScanner.Enabled
+	default:
+		t, ok := cfg.ERC20Scanner.Token(coinType)
+		if !ok {
+			return "", false
+		}
+		return t.SkyExchangeRate, true
+	}
+}
+
+// DepositHandler returns a deposit by its transaction output, with the skycoin address it was bound to,
+// the rate it was converted at, its skycoin txid and its status history
+// Method: GET
+// URI: /api/deposit
+// Args:
+//
+//	txid
+//	n
+func DepositHandler(s *HTTPServer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := logger.FromContext(ctx)
+		cfg := s.config()
+
+		if !validMethod(ctx, w, r, []string{http.MethodGet}) {
+			return
+		}
+
+		txid := r.URL.Query().Get("txid")
+		if txid == "" {
+			errorResponse(ctx, w, http.StatusBadRequest, newAPIError(ErrCodeMissingTxid, "Missing txid"))
+			return
+		}
+
+		nStr := r.URL.Query().Get("n")
+		if nStr == "" {
+			errorResponse(ctx, w, http.StatusBadRequest, newAPIError(ErrCodeMissingN, "Missing n"))
+			return
+		}
+
+		n, err := strconv.ParseUint(nStr, 10, 32)
+		if err != nil {
+			errorResponse(ctx, w, http.StatusBadRequest, newAPIError(ErrCodeInvalidN, "Invalid n"))
+			return
+		}
+
+		log = log.WithFields(logrus.Fields{
+			"txid": txid,
+			"n":    n,
+		})
+		ctx = logger.WithContext(ctx, log)
+		r = r.WithContext(ctx)
+
+		log.Info()
+
+		if !cfg.Web.APIEnabled {
+			errorResponse(ctx, w, http.StatusForbidden, errAPIDisabled)
+			return
+		}
+
+		dd, err := s.service.GetDepositDetail(ctx, txid, uint32(n))
+		switch err {
+		case nil:
+		case exchange.ErrDepositNotFound:
+			errorResponse(ctx, w, http.StatusNotFound, err)
+			return
+		default:
+			errorResponse(ctx, w, http.StatusInternalServerError, errInternalServerError)
+			return
+		}
+
+		if err := httputil.JSONResponse(w, dd); err != nil {
+			log.WithError(err).Error(err)
+		}
+	}
+}
+
+// QRHandler returns a QR code PNG of a deposit address, or of a payment URI to it
+// Method: GET
+// URI: /api/qr
+// Args:
+//
+//	data: deposit address
+//	coin_type: coin type of the deposit address, "BTC" by default
+//	uri: "true" to encode a BIP21 payment URI, e.g. "bitcoin:<data>". BTC and LTC only.
+//	amount: amount of the payment URI in BTC or LTC, e.g. "0.01". Implies uri.
+//	size: width and height in pixels, 256 by default
+func QRHandler(s *HTTPServer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := logger.FromContext(ctx)
+		cfg := s.config()
+
+		if !validMethod(ctx, w, r, []string{http.MethodGet}) {
+			return
+		}
+
+		q := r.URL.Query()
+
+		addr := q.Get("data")
+		if addr == "" {
+			errorResponse(ctx, w, http.StatusBadRequest, newAPIError(ErrCodeMissingData, "Missing data"))
+			return
+		}
+
+		coinType := q.Get("coin_type")
+		if coinType == "" {
+			coinType = scanner.CoinTypeBTC
+		}
+
+		if err := verifyCoinType(cfg, coinType); err != nil {
+			errorResponse(ctx, w, http.StatusBadRequest, err)
+			return
+		}
+
+		addr, err := verifyDepositAddress(coinType, addr)
+		if err != nil {
+			errorResponse(ctx, w, http.StatusBadRequest, newAPIError(ErrCodeInvalidData, "Invalid data: %v", err))
+			return
+		}
+
+		amount := q.Get("amount")
+		uri := amount != ""
+		if v := q.Get("uri"); v != "" {
+			uri, err = strconv.ParseBool(v)
+			if err != nil {
+				errorResponse(ctx, w, http.StatusBadRequest, newAPIError(ErrCodeInvalidURI, "Invalid uri"))
+				return
+			}
+
+			if !uri && amount != "" {
+				errorResponse(ctx, w, http.StatusBadRequest, newAPIError(ErrCodeInvalidURI, "Invalid uri, amount requires a payment URI"))
+				return
+			}
+		}
+
+		size := qrDefaultSize
+		if v := q.Get("size"); v != "" {
+			size, err = strconv.Atoi(v)
+			if err != nil || size < qrutil.MinSize || size > qrutil.MaxSize {
+				errorResponse(ctx, w, http.StatusBadRequest, qrutil.ErrInvalidSize)
+				return
+			}
+		}
+
+		data := addr
+		if uri {
+			scheme, ok := qrURISchemes[coinType]
+			if !ok {
+				errorResponse(ctx, w, http.StatusBadRequest, newAPIError(ErrCodePaymentURINotSupported, "Payment URIs are not supported for %s", coinType))
+				return
+			}
+
+			data, err = qrutil.PaymentURI(scheme, addr, amount)
+			if err != nil {
+				errorResponse(ctx, w, http.StatusBadRequest, err)
+				return
+			}
+		}
+
+		log = log.WithFields(logrus.Fields{
+			"data": data,
+			"size": size,
+		})
+		ctx = logger.WithContext(ctx, log)
+		r = r.WithContext(ctx)
+
+		log.Info()
+
+		if !cfg.Web.APIEnabled {
+			errorResponse(ctx, w, http.StatusForbidden, errAPIDisabled)
+			return
+		}
+
+		b, err := qrutil.PNG(data, size)
+		if err != nil {
+			log.WithError(err).Error("qrutil.PNG failed")
+			errorResponse(ctx, w, http.StatusInternalServerError, errInternalServerError)
+			return
+		}
+
+		// The same arguments always render the same image
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("Cache-Control", "public, max-age=86400")
+		if _, err := w.Write(b); err != nil {
+			log.WithError(err).Error("Write QR code failed")
+		}
+	}
+}
+
+// BatchStatusResponse http response for /api/status/batch
+type BatchStatusResponse struct {
+	Addresses []AddressStatuses `json:"addresses"`
+}
+
+// AddressStatuses are the deposit statuses of a skycoin address in BatchStatusResponse
+type AddressStatuses struct {
+	SkyAddress string                   `json:"skyaddr"`
+	Statuses   []exchange.DepositStatus `json:"statuses"`
+	// Set instead of Statuses if the address is rate limited
+	Error     string `json:"error,omitempty"`
+	ErrorCode string `json:"error_code,omitempty"`
+}
+
+type batchStatusRequest struct {
+	SkyAddrs []string `json:"skyaddrs"`
+}
+
+// BatchStatusHandler returns the deposit statuses of multiple skycoin addresses, in the order they were requested.
+// The request counts as one status request per address for the per IP rate limit.
+// Method: POST
+// Accept: application/json
+// URI: /api/status/batch
+// Args:
+//
+//	{"skyaddrs": ["...", "..."]}
+//	at most web.status_batch_max addresses
+func BatchStatusHandler(s *HTTPServer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := logger.FromContext(ctx)
+		cfg := s.config()
+
+		w.Header().Set("Accept", "application/json")
+
+		if !validMethod(ctx, w, r, []string{http.MethodPost}) {
+			return
+		}
+
+		if r.Header.Get("Content-Type") != "application/json" {
+			errorResponse(ctx, w, http.StatusUnsupportedMediaType, newAPIError(ErrCodeUnsupportedMediaType, "Invalid content type"))
+			return
+		}
+
+		req := &batchStatusRequest{}
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&req); err != nil {
+			err = newAPIError(ErrCodeInvalidJSON, "Invalid json request body: %v", err)
+			errorResponse(ctx, w, http.StatusBadRequest, err)
+			return
+		}
+		defer r.Body.Close()
+
+		if len(req.SkyAddrs) == 0 {
+			errorResponse(ctx, w, http.StatusBadRequest, newAPIError(ErrCodeMissingSkyAddrs, "Missing skyaddrs"))
+			return
+		}
+
+		if len(req.SkyAddrs) > cfg.Web.StatusBatchMax {
+			errorResponse(ctx, w, http.StatusBadRequest, newAPIError(ErrCodeTooManySkyAddrs, "Too many skyaddrs, the maximum is %d", cfg.Web.StatusBatchMax))
+			return
+		}
+
+		log = log.WithField("skyAddrsLen", len(req.SkyAddrs))
+		ctx = logger.WithContext(ctx, log)
+		r = r.WithContext(ctx)
+
+		log.Info()
+
+		seen := make(map[string]struct{}, len(req.SkyAddrs))
+		for _, skyAddr := range req.SkyAddrs {
+			if _, ok := seen[skyAddr]; ok {
+				errorResponse(ctx, w, http.StatusBadRequest, newAPIError(ErrCodeDuplicateSkyAddr, "Duplicate skyaddr %s", skyAddr))
+				return
+			}
+			seen[skyAddr] = struct{}{}
+
+			if !verifySkycoinAddress(ctx, w, skyAddr) {
+				return
+			}
+		}
+
+		if !s.allowIPN(ctx, w, r, int64(len(req.SkyAddrs))) {
+			return
+		}
+
+		// The ownership of multiple addresses can't be proven in one request, only integrators can request them
+		if _, ok := apiKeyFromContext(ctx); s.ownership != nil && !ok {
+			errorResponse(ctx, w, http.StatusForbidden, newAPIError(ErrCodeOwnershipRequired, "Batch status requests must be signed with an API key"))
+			return
+		}
+
+		if !cfg.Web.APIEnabled {
+			errorResponse(ctx, w, http.StatusForbidden, errAPIDisabled)
+			return
+		}
+
+		rsp := BatchStatusResponse{
+			Addresses: make([]AddressStatuses, 0, len(req.SkyAddrs)),
+		}
+
+		for _, skyAddr := range req.SkyAddrs {
+			as := AddressStatuses{
+				SkyAddress: skyAddr,
+				Statuses:   []exchange.DepositStatus{},
+			}
+
+			// Limited addresses are reported per address, so that the statuses of the others are still returned
+			if ok, _ := s.skyAddrAllowed(ctx, skyAddr); !ok {
+				as.Error = errSkyAddrLimited.Error()
+				as.ErrorCode = errorCode(http.StatusTooManyRequests, errSkyAddrLimited)
+				rsp.Addresses = append(rsp.Addresses, as)
+				continue
+			}
+
+			depositStatuses, err := s.service.GetDepositStatuses(ctx, skyAddr, false)
+			if err != nil {
+				log.WithError(err).Error("service.GetDepositStatuses failed")
+				errorResponse(ctx, w, http.StatusInternalServerError, errInternalServerError)
+				return
+			}
+
+			if depositStatuses != nil {
+				as.Statuses = depositStatuses
+			}
+
+			rsp.Addresses = append(rsp.Addresses, as)
+		}
+
+		if err := httputil.JSONResponse(w, rsp); err != nil {
+			log.WithError(err).Error(err)
+		}
+	}
+}
+
+// SupportStatusResponse http response for /api/support/status
+type SupportStatusResponse struct {
+	SkyAddress string `json:"skyaddr"`
+	// Unix time the support token expires at
+	ExpiresAt int64                          `json:"expires_at"`
+	Deposits  []exchange.DepositStatusDetail `json:"deposits"`
+}
+
+// SupportStatusHandler returns the deposits of the skycoin address of a support token,
+// with their deposit addresses and skycoin txids
+// Method: GET
+// URI: /api/support/status
+// Headers:
+//
+//	Authorization: Bearer <support token>
+func SupportStatusHandler(s *HTTPServer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := logger.FromContext(ctx)
+
+		if !validMethod(ctx, w, r, []string{http.MethodGet}) {
+			return
+		}
+
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "Bearer ") {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			errorResponse(ctx, w, http.StatusUnauthorized, newAPIError(ErrCodeMissingSupportToken, "Missing support token"))
+			return
+		}
+
+		t, err := s.supportTokens.Authorize(strings.TrimPrefix(auth, "Bearer "), support.ScopeStatus, support.Origin{
+			RemoteAddr: s.remoteIP(r),
+			RequestID:  logger.RequestIDFromContext(ctx),
+		})
+		switch err {
+		case nil:
+		case support.ErrInvalidToken, support.ErrTokenExpired, support.ErrTokenRevoked:
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			errorResponse(ctx, w, http.StatusUnauthorized, err)
+			return
+		case support.ErrScopeNotAllowed:
+			errorResponse(ctx, w, http.StatusForbidden, err)
+			return
+		default:
+			log.WithError(err).Error("supportTokens.Authorize failed")
+			errorResponse(ctx, w, http.StatusInternalServerError, errInternalServerError)
+			return
+		}
+
+		log = log.WithFields(logrus.Fields{
+			"skyAddr":        t.SkyAddress,
+			"supportTokenID": t.ID,
+		})
+		ctx = logger.WithContext(ctx, log)
+
+		deposits, err := s.service.GetDepositStatusDetails(ctx, t.SkyAddress)
+		if err != nil {
+			errorResponse(ctx, w, http.StatusInternalServerError, errInternalServerError)
+			return
+		}
+
+		if deposits == nil {
+			deposits = []exchange.DepositStatusDetail{}
+		}
+
+		if err := httputil.JSONResponse(w, SupportStatusResponse{
+			SkyAddress: t.SkyAddress,
+			ExpiresAt:  t.ExpiresAt,
+			Deposits:   deposits,
+		}); err != nil {
+			log.WithError(err).Error(err)
+		}
+	}
+}
+
+// ConfigResponse http response for /api/config
+type ConfigResponse struct {
+	Enabled                  bool   `json:"enabled"`
+	BtcConfirmationsRequired int64  `json:"btc_confirmations_required"`
+	MaxBoundBtcAddresses     int    `json:"max_bound_btc_addrs"`
+	SkyBtcExchangeRate       string `json:"sky_btc_exchange_rate"`
+	LtcEnabled               bool   `json:"ltc_enabled"`
+	LtcConfirmationsRequired int64  `json:"ltc_confirmations_required,omitempty"`
+	SkyLtcExchangeRate       string `json:"sky_ltc_exchange_rate,omitempty"`
+	MaxDecimals              int    `json:"max_decimals"`
+	// Maximum number of skycoin addresses in a /api/status/batch request
+	StatusBatchMax  int    `json:"status_batch_max"`
+	CaptchaProvider string `json:"captcha_provider,omitempty"`
+	CaptchaSiteKey  string `json:"captcha_site_key,omitempty"`
+	// Pricing region of the requesting client, omitted for the default pricing.
+	// The exchange rates include the region's bonus.
+	PricingRegion *PricingRegionConfig `json:"pricing_region,omitempty"`
+	// Accepted ERC20 tokens, empty if ERC20 tokens are not enabled
+	ERC20Tokens []ERC20TokenConfig `json:"erc20_tokens"`
+	// Deprecated API endpoints and fields
+	Deprecations []httputil.Deprecation `json:"deprecations"`
+	// Fee deducted from the SKY bought by each deposit
+	Fee FeeConfig `json:"fee"`
+	// Deposits are temporarily paused, e.g. until the hot wallet is topped up. Binding fails while paused.
+	Paused bool `json:"paused"`
+	// The API is down for maintenance, all other endpoints return 503
+	Maintenance        bool   `json:"maintenance"`
+	MaintenanceMessage string `json:"maintenance_message,omitempty"`
+	// Teller serves a copy of the db that deposits are not processed from, binding and quotes fail
+	ReadOnly bool `json:"read_only"`
+	// Status requests must prove the ownership of their skycoin address with /api/status/challenge
+	StatusChallenge bool `json:"status_challenge"`
+	// Bind requests must be signed with the secret key of their skycoin address
+	BindSignature bool `json:"bind_signature"`
+	// Enabled campaigns, which can be passed to /api/bind
+	Campaigns []CampaignConfig `json:"campaigns"`
+	// Fixed-price quotes can be requested from /api/quote
+	Quotes bool `json:"quotes"`
+	// Promo codes can be passed to /api/bind
+	PromoCodes bool `json:"promo_codes"`
+	// The owners of the skycoin addresses of /api/bind requests must pass KYC
+	KYC bool `json:"kyc"`
+	// /api/bind requests can leave an email address to notify of the deposits
+	EmailNotifications bool `json:"email_notifications"`
+}
+
+// CampaignConfig is an enabled campaign in ConfigResponse
+type CampaignConfig struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// SKY per coin of the campaign, by coin type. Coin types without a campaign rate use the default rate.
+	Rates map[string]string `json:"rates,omitempty"`
+	// Maximum SKY sent for the campaign, omitted if there is no cap
+	MaxSky string `json:"max_sky,omitempty"`
+}
+
+// FeeConfig is the fee deducted from conversions in ConfigResponse
+type FeeConfig struct {
+	Percent string `json:"percent"`
+	Fixed   string `json:"fixed"`
+}
+
+// ERC20TokenConfig is an accepted ERC20 token in ConfigResponse
+type ERC20TokenConfig struct {
+	Symbol                string `json:"symbol"`
+	Contract              string `json:"contract"`
+	Decimals              int    `json:"decimals"`
+	ConfirmationsRequired int64  `json:"confirmations_required"`
+	SkyExchangeRate       string `json:"sky_exchange_rate"`
+}
+
+// PricingRegionConfig is the pricing region of the client in ConfigResponse
+type PricingRegionConfig struct {
+	Name         string `json:"name"`
+	BonusPercent string `json:"bonus_percent"`
+	MinSky       string `json:"min_sky"`
+}
+
+// ConfigHandler returns the teller configuration.
+// If pricing regions are enabled, the response depends on the region of the client.
+// Method: GET
+// URI: /api/config
+func ConfigHandler(s *HTTPServer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := logger.FromContext(ctx)
+		cfg := s.config()
+
+		if !validMethod(ctx, w, r, []string{http.MethodGet}) {
+			return
+		}
+
+		region, inRegion := s.region(r)
+		if s.pricer != nil {
+			w.Header().Set("Cache-Control", "private")
+		}
+
+		// Convert the exchange rate to a skycoin balance string
+		maxDecimals := cfg.SkyExchanger.MaxDecimals
+		regionSkyPerCoin := func(rate string) (string, error) {
+			rate, err := region.Rate(rate)
+			if err != nil {
+				return "", err
+			}
+			return skyPerCoin(rate, maxDecimals)
+		}
+
+		skyPerBTC, err := regionSkyPerCoin(cfg.SkyExchanger.SkyBtcExchangeRate)
+		if err != nil {
+			log.WithError(err).Error("skyPerCoin failed")
+			errorResponse(ctx, w, http.StatusInternalServerError, errInternalServerError)
+			return
+		}
+
+		feePercent := cfg.SkyExchanger.FeePercent
+		if feePercent == "" {
+			feePercent = "0"
+		}
+
+		feeFixed, err := droplet.ToString(cfg.SkyExchanger.FeeFixedDroplets)
+		if err != nil {
+			log.WithError(err).Error("droplet.ToString failed")
+			errorResponse(ctx, w, http.StatusInternalServerError, errInternalServerError)
+			return
+		}
+
+		rsp := ConfigResponse{
+			Enabled:                  cfg.Web.APIEnabled,
+			Paused:                   s.service.Paused(),
+			BtcConfirmationsRequired: cfg.BtcScanner.ConfirmationsRequired,
+			SkyBtcExchangeRate:       skyPerBTC,
+			MaxDecimals:              maxDecimals,
+			MaxBoundBtcAddresses:     cfg.Teller.MaxBoundBtcAddresses,
+			StatusBatchMax:           cfg.Web.StatusBatchMax,
+			ERC20Tokens:              []ERC20TokenConfig{},
+			Deprecations:             apiDeprecations,
+			StatusChallenge:          s.ownership != nil,
+			BindSignature:            s.bindSignatures != nil,
+			Campaigns:                []CampaignConfig{},
+			Quotes:                   s.service.quotes != nil,
+			PromoCodes:               s.service.promoCodes != nil,
+			KYC:                      s.kyc != nil,
+			EmailNotifications:       s.service.notifications != nil,
+			Fee: FeeConfig{
+				Percent: feePercent,
+				Fixed:   feeFixed,
+			},
+		}
+
+		if s.service.campaigns != nil {
+			campaigns, err := s.service.campaigns.Campaigns()
+			if err != nil {
+				log.WithError(err).Error("campaigns.Campaigns failed")
+				errorResponse(ctx, w, http.StatusInternalServerError, errInternalServerError)
+				return
+			}
+
+			for _, c := range campaigns {
+				if !c.Enabled {
+					continue
+				}
+
+				rates := make(map[string]string, len(c.Rates))
+				for coinType, rate := range c.Rates {
+					skyPer, err := skyPerCoin(rate, maxDecimals)
+					if err != nil {
+						log.WithError(err).Error("skyPerCoin failed")
+						errorResponse(ctx, w, http.StatusInternalServerError, errInternalServerError)
+						return
+					}
+					rates[coinType] = skyPer
+				}
+
+				rsp.Campaigns = append(rsp.Campaigns, CampaignConfig{
+					ID:     c.ID,
+					Name:   c.Name,
+					Rates:  rates,
+					MaxSky: c.MaxSky,
+				})
+			}
+		}
+
+		if ms := s.GetMaintenanceState(); ms.Enabled {
+			rsp.Maintenance = true
+			rsp.MaintenanceMessage = ms.Message
+		}
+
+		rsp.ReadOnly = s.readOnly
+
+		if cfg.LtcScanner.Enabled {
+			skyPerLTC, err := regionSkyPerCoin(cfg.SkyExchanger.SkyLtcExchangeRate)
+			if err != nil {
+				log.WithError(err).Error("skyPerCoin failed")
+				errorResponse(ctx, w, http.StatusInternalServerError, errInternalServerError)
+				return
+			}
+
+			rsp.LtcEnabled = true
+			rsp.LtcConfirmationsRequired = cfg.LtcScanner.ConfirmationsRequired
+			rsp.SkyLtcExchangeRate = skyPerLTC
+		}
+
+		if cfg.ERC20Scanner.Enabled {
+			for _, t := range cfg.ERC20Scanner.Tokens {
+				// Token deposit values are normalized to 8 decimal places, like BTC
+				skyPerToken, err := regionSkyPerCoin(t.SkyExchangeRate)
+				if err != nil {
+					log.WithError(err).Error("skyPerCoin failed")
+					errorResponse(ctx, w, http.StatusInternalServerError, errInternalServerError)
+					return
+				}
+
+				rsp.ERC20Tokens = append(rsp.ERC20Tokens, ERC20TokenConfig{
+					Symbol:                t.Symbol,
+					Contract:              t.Contract,
+					Decimals:              t.Decimals,
+					ConfirmationsRequired: cfg.ERC20Scanner.ConfirmationsRequired,
+					SkyExchangeRate:       skyPerToken,
+				})
+			}
+		}
+
+		if inRegion {
+			minSky, err := droplet.ToString(region.MinSky)
+			if err != nil {
+				log.WithError(err).Error("droplet.ToString failed")
+				errorResponse(ctx, w, http.StatusInternalServerError, errInternalServerError)
+				return
+			}
+
+			bonus := region.BonusPercent
+			if bonus == "" {
+				bonus = "0"
+			}
+
+			rsp.PricingRegion = &PricingRegionConfig{
+				Name:         region.Name,
+				BonusPercent: bonus,
+				MinSky:       minSky,
+			}
+		}
+
+		if s.captcha != nil {
+			rsp.CaptchaProvider = cfg.Captcha.Provider
+			rsp.CaptchaSiteKey = cfg.Captcha.SiteKey
+		}
+
+		if err := httputil.JSONResponse(w, rsp); err != nil {
+			log.WithError(err).Error(err)
+		}
+	}
+}
+
+// skyPerCoin converts an exchange rate to the skycoin balance string given for one
+// whole coin. BTC and LTC both have 8 decimal places, and ERC20 deposit values are normalized to 8.
+func skyPerCoin(rate string, maxDecimals int) (string, error) {
+	droplets, err := exchange.CalculateBtcSkyValue(exchange.SatoshisPerBTC, rate, maxDecimals)
+	if err != nil {
+		return "", err
+	}
+
+	return droplet.ToString(droplets)
+}
+
+func validMethod(ctx context.Context, w http.ResponseWriter, r *http.Request, allowed []string) bool {
+	for _, m := range allowed {
+		if r.Method == m {
+			return true
+		}
+	}
+
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+
+	status := http.StatusMethodNotAllowed
+	errorResponse(ctx, w, status, newAPIError(ErrCodeMethodNotAllowed, "Invalid request method"))
+
+	return false
+}
+
+// verifyCoinType returns an error unless deposits of coinType are accepted
+func verifyCoinType(cfg config.Config, coinType string) error {
+	switch coinType {
+	case scanner.CoinTypeBTC:
+	case scanner.CoinTypeLTC:
+		if !cfg.LtcScanner.Enabled {
+			return newAPIError(ErrCodeCoinTypeNotEnabled, "LTC is not enabled")
+		}
+	case "":
+		return newAPIError(ErrCodeMissingCoinType, "Missing coin_type")
+	default:
+		if !cfg.ERC20Scanner.Enabled {
+			return newAPIError(ErrCodeInvalidCoinType, "Invalid coin_type")
+		}
+		if _, ok := cfg.ERC20Scanner.Token(coinType); !ok {
+			return newAPIError(ErrCodeInvalidCoinType, "Invalid coin_type")
+		}
+	}
+
+	return nil
+}
+
+// verifyDepositAddress checks that addr is an address of coinType, and returns it normalized
+func verifyDepositAddress(coinType, addr string) (string, error) {
+	switch coinType {
+	case scanner.CoinTypeBTC:
+		addr = addrs.NormalizeBTCAddress(addr)
+		return addr, addrs.VerifyBTCAddress(addr)
+	case scanner.CoinTypeLTC:
+		return addr, addrs.VerifyLTCAddress(addr)
+	default:
+		// ERC20 token
+		return addr, addrs.VerifyETHAddress(addr)
+	}
+}
+
+func verifySkycoinAddress(ctx context.Context, w http.ResponseWriter, skyAddr string) bool {
+	log := logger.FromContext(ctx)
+
+	if _, err := cipher.DecodeBase58Address(skyAddr); err != nil {
+		writeError(ctx, w, http.StatusBadRequest, newAPIError(ErrCodeInvalidSkyAddr, "Invalid skycoin address: %v", err))
+		log.WithFields(logrus.Fields{
+			"status":  http.StatusBadRequest,
+			"skyAddr": skyAddr,
+		}).WithError(err).Info("Invalid skycoin address")
+		return false
+	}
+
+	return true
+}
+
+// verifyOwnership verifies the signature of the nonce of a status request made with the secret key of skyAddr,
+// if status challenges are enabled. Signed requests of integrators don't need to prove ownership.
+// It writes an error response and returns false if the ownership is not proven.
+func (s *HTTPServer) verifyOwnership(ctx context.Context, w http.ResponseWriter, r *http.Request, skyAddr string) bool {
+	if s.ownership == nil {
+		return true
+	}
+
+	if _, ok := apiKeyFromContext(ctx); ok {
+		return true
+	}
+
+	nonce := r.URL.Query().Get("nonce")
+	if nonce == "" {
+		errorResponse(ctx, w, http.StatusUnauthorized, newAPIError(ErrCodeOwnershipRequired, "Missing nonce, sign a nonce of /api/status/challenge with the skycoin address"))
+		return false
+	}
+
+	sig := r.URL.Query().Get("signature")
+	if sig == "" {
+		errorResponse(ctx, w, http.StatusUnauthorized, newAPIError(ErrCodeOwnershipRequired, "Missing signature, sign a nonce of /api/status/challenge with the skycoin address"))
+		return false
+	}
+
+	if err := s.ownership.Verify(skyAddr, nonce, sig); err != nil {
+		switch err {
+		case ownership.ErrInvalidNonce, ownership.ErrNonceExpired, ownership.ErrInvalidSignature:
+			errorResponse(ctx, w, http.StatusForbidden, err)
+		default:
+			logger.FromContext(ctx).WithError(err).Error("ownership.Verify failed")
+			errorResponse(ctx, w, http.StatusInternalServerError, errInternalServerError)
+		}
+		return false
+	}
+
+	return true
+}
+
+// verifyBindSignature verifies the signature of a bind request made with the secret key of its skycoin address,
+// if bind signatures are required. Signed requests of integrators don't need a bind signature.
+// It writes an error response and returns false if the signature is not verified.
+func (s *HTTPServer) verifyBindSignature(ctx context.Context, w http.ResponseWriter, req *bindRequest) bool {
+	if s.bindSignatures == nil {
+		return true
+	}
+
+	if _, ok := apiKeyFromContext(ctx); ok {
+		return true
+	}
+
+	if req.Timestamp == 0 {
+		errorResponse(ctx, w, http.StatusUnauthorized, newAPIError(ErrCodeBindSignatureRequired, "Missing timestamp, sign the bind request with the skycoin address"))
+		return false
+	}
+
+	if req.Signature == "" {
+		errorResponse(ctx, w, http.StatusUnauthorized, newAPIError(ErrCodeBindSignatureRequired, "Missing signature, sign the bind request with the skycoin address"))
+		return false
+	}
+
+	if err := s.bindSignatures.Verify(req.Timestamp, req.SkyAddr, req.CoinType, req.Amount, req.Signature); err != nil {
+		switch err {
+		case ownership.ErrInvalidTimestamp:
+			errorResponse(ctx, w, http.StatusUnauthorized, err)
+		case ownership.ErrInvalidSignature:
+			errorResponse(ctx, w, http.StatusForbidden, err)
+		default:
+			logger.FromContext(ctx).WithError(err).Error("bindSignatures.Verify failed")
+			errorResponse(ctx, w, http.StatusInternalServerError, errInternalServerError)
+		}
+		return false
+	}
+
+	return true
+}
+
+// allowSkyAddr applies the per skycoin address rate limit.
+// If the limit is reached, it writes a 429 response and returns false.
+// If the limiter store fails, the request is allowed.
+func (s *HTTPServer) allowSkyAddr(ctx context.Context, w http.ResponseWriter, skyAddr string) bool {
+	if ok, wait := s.skyAddrAllowed(ctx, skyAddr); !ok {
+		w.Header().Set("Retry-After", fmt.Sprint(int64(math.Ceil(wait.Seconds()))))
+		errorResponse(ctx, w, http.StatusTooManyRequests, errSkyAddrLimited)
+		return false
+	}
+
+	return true
+}
+
+// skyAddrAllowed consumes a request of the per skycoin address limit, if it is enabled. If the limit is reached,
+// it returns false and the duration after which a retry is allowed. If the limiter store fails, the request is allowed.
+func (s *HTTPServer) skyAddrAllowed(ctx context.Context, skyAddr string) (bool, time.Duration) {
+	if _, ok := apiKeyFromContext(ctx); ok {
+		return true, 0
+	}
+
+	s.cfgLock.RLock()
+	addrLimiter := s.addrLimiter
+	s.cfgLock.RUnlock()
+
+	if addrLimiter == nil {
+		return true, 0
+	}
+
+	log := logger.FromContext(ctx)
+
+	ok, wait, err := addrLimiter.Allow(skyAddr)
+	if err != nil {
+		log.WithError(err).Error("addrLimiter.Allow failed, allowing request")
+		return true, 0
+	}
+
+	return ok, wait
+}
+
+// allowIPN consumes n requests of the per IP limit, for a request that counts as n requests.
+// If the limit is reached, it writes an error response and returns false.
+// If the limiter store fails, the request is allowed.
+func (s *HTTPServer) allowIPN(ctx context.Context, w http.ResponseWriter, r *http.Request, n int64) bool {
+	if _, ok := apiKeyFromContext(ctx); ok {
+		return true
+	}
+
+	s.cfgLock.RLock()
+	ipLimiter := s.ipLimiter
+	s.cfgLock.RUnlock()
+
+	log := logger.FromContext(ctx)
+
+	ok, wait, err := ipLimiter.AllowN(s.remoteIP(r), n)
+	if err != nil {
+		log.WithError(err).Error("ipLimiter.AllowN failed, allowing request")
+		return true
+	}
+
+	if !ok {
+		w.Header().Set("Retry-After", fmt.Sprint(int64(math.Ceil(wait.Seconds()))))
+		errorResponse(ctx, w, http.StatusTooManyRequests, errRateLimited)
+		return false
+	}
+
+	return true
+}
+
+// verifyCaptcha verifies the captcha token of a request, if captcha verification is enabled.
+// If the token is missing or invalid, it writes an error response and returns false.
+func (s *HTTPServer) verifyCaptcha(ctx context.Context, w http.ResponseWriter, r *http.Request, token string) bool {
+	if s.captcha == nil {
+		return true
+	}
+
+	log := logger.FromContext(ctx)
+
+	if token == "" {
+		errorResponse(ctx, w, http.StatusBadRequest, newAPIError(ErrCodeMissingCaptchaToken, "Missing captcha_token"))
+		return false
+	}
+
+	if err := s.captcha.Verify(token, s.remoteIP(r)); err != nil {
+		if err == captcha.ErrInvalidToken {
+			errorResponse(ctx, w, http.StatusForbidden, err)
+			return false
+		}
+
+		log.WithError(err).Error("captcha.Verify failed")
+		errorResponse(ctx, w, http.StatusInternalServerError, errInternalServerError)
+		return false
+	}
+
+	return true
+}
+
+// verifyKYC checks that the owner of the skycoin address of a bind request passed KYC, if KYC is required at bind.
+// If the owner did not pass it or the check fails, it writes an error response and returns false.
+func (s *HTTPServer) verifyKYC(ctx context.Context, w http.ResponseWriter, req *bindRequest) bool {
+	if s.kyc == nil {
+		return true
+	}
+
+	log := logger.FromContext(ctx)
+
+	verified, err := s.kyc.Verified(ctx, req.SkyAddr, req.KYCToken)
+	if err != nil {
+		log.WithError(err).Error("kyc.Verified failed")
+		errorResponse(ctx, w, http.StatusInternalServerError, errInternalServerError)
+		return false
+	}
+
+	if !verified {
+		errorResponse(ctx, w, http.StatusForbidden, kyc.ErrNotVerified)
+		return false
+	}
+
+	return true
+}
+
+// region returns the pricing region of the client of a request.
+// Returns false, and a Region with the default pricing, if the client is not in any region.
+func (s *HTTPServer) region(r *http.Request) (pricing.Region, bool) {
+	if s.pricer == nil {
+		return pricing.Region{}, false
+	}
+
+	return s.pricer.Region(r, s.remoteIP(r))
+}
+
+// remoteIP returns the client IP of a request. Behind a proxy, it is the last address of X-Forwarded-For.
+// If web.trusted_proxies is set, X-Forwarded-For is only honored for requests from a trusted proxy or a unix socket,
+// and the client IP is its last address that is not a trusted proxy.
+func (s *HTTPServer) remoteIP(r *http.Request) string {
+	s.cfgLock.RLock()
+	behindProxy := s.cfg.Web.BehindProxy
+	trustedProxies := s.trustedNets
+	s.cfgLock.RUnlock()
+
+	ip := libstring.RemoteIP([]string{"RemoteAddr"}, 0, r)
+	if !behindProxy {
+		return ip
+	}
+
+	if len(trustedProxies) == 0 {
+		return libstring.RemoteIP([]string{"X-Forwarded-For", "RemoteAddr"}, 0, r)
+	}
+
+	// A request over a unix socket is from a local proxy
+	_, unixSocket := r.Context().Value(http.LocalAddrContextKey).(*net.UnixAddr)
+	if !unixSocket && !trustedProxies.Contains(ipfilter.ParseIP(ip)) {
+		return ip
+	}
+
+	forwardedFor := r.Header.Get("X-Forwarded-For")
+	if forwardedFor == "" {
+		return ip
+	}
+
+	// Each proxy appends the address it received the request from, so the addresses
+	// are read from the right, and the first one is used if all are trusted
+	parts := strings.Split(forwardedFor, ",")
+	for i := len(parts) - 1; i >= 0; i-- {
+		ip = strings.TrimSpace(parts[i])
+		if !trustedProxies.Contains(ipfilter.ParseIP(ip)) {
+			break
+		}
+	}
+
+	return ip
+}
+
+// limitIP applies the per IP rate limit using ipLimiter, the same way tollbooth does.
+// If the limiter store fails, the request is allowed.
+func (s *HTTPServer) limitIP(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := s.remoteIP(r)
+
+		s.cfgLock.RLock()
+		ipLimiter := s.ipLimiter
+		s.cfgLock.RUnlock()
+
+		ok, wait, err := ipLimiter.Allow(ip)
+		if err != nil {
+			s.log.WithError(err).Error("ipLimiter.Allow failed, allowing request")
+		} else if !ok {
+			w.Header().Set("Retry-After", fmt.Sprint(int64(math.Ceil(wait.Seconds()))))
+			writeError(r.Context(), w, http.StatusTooManyRequests, errRateLimited)
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+// ipFilterHandler denies the requests from IPs blocked by ipFilter with a 403 response,
+// before any other handling. The client IP is looked up like the rate limits do.
+func (s *HTTPServer) ipFilterHandler(h http.Handler) http.Handler {
+	if s.ipFilter == nil {
+		return h
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.ipFilter.Blocked(s.remoteIP(r)) {
+			writeError(r.Context(), w, http.StatusForbidden, errIPBlocked)
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+type apiKeyCtxKey struct{}
+
+// apiKeyFromContext returns the API key that a request was signed with, see signedRequestHandler
+func apiKeyFromContext(ctx context.Context) (apikey.Key, bool) {
+	k, ok := ctx.Value(apiKeyCtxKey{}).(apikey.Key)
+	return k, ok
+}
+
+// signedRequestHandler verifies the requests signed with an API key, and puts the key in their context.
+// Requests without an API key header are passed to h as they are. A request with an invalid signature,
+// or signed with an unknown or revoked key, gets a 401 response.
+func (s *HTTPServer) signedRequestHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(apikey.KeyHeader)
+		if id == "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := r.Context()
+		log := logger.WithRequestIDField(ctx, s.log).WithField("apiKey", id)
+
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, openapi.MaxBodySize))
+		if err != nil {
+			writeError(ctx, w, http.StatusRequestEntityTooLarge, newAPIError(ErrCodeRequestTooLarge, "Request body too large"))
+			return
+		}
+		r.Body.Close()
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		k, err := s.apiKeys.Verify(id, r.Header.Get(apikey.TimestampHeader), r.Header.Get(apikey.SignatureHeader), r.Method, r.RequestURI, body)
+		switch err {
+		case nil:
+		case apikey.ErrInvalidKey, apikey.ErrKeyRevoked, apikey.ErrInvalidSignature, apikey.ErrInvalidTimestamp:
+			log.WithError(err).Info("Signed request denied")
+			writeError(ctx, w, http.StatusUnauthorized, err)
+			return
+		default:
+			log.WithError(err).Error("apiKeys.Verify failed")
+			writeError(ctx, w, http.StatusInternalServerError, errInternalServerError)
+			return
+		}
+
+		h.ServeHTTP(w, r.WithContext(context.WithValue(ctx, apiKeyCtxKey{}, k)))
+	})
+}
+
+// ipThrottle applies the per IP rate limit kept in tollbooth's memory to a handler
+type ipThrottle struct {
+	handler  http.Handler
+	remoteIP func(*http.Request) string
+	limiter  *limiter.Limiter
+	lock     sync.RWMutex
+}
+
+func newIPThrottle(cfg config.Web, remoteIP func(*http.Request) string, h http.Handler) *ipThrottle {
+	t := &ipThrottle{
+		handler:  h,
+		remoteIP: remoteIP,
+	}
+	t.setLimit(cfg)
+	return t
+}
+
+// setLimit replaces the limiter with one of the limits of cfg. Request counts are reset.
+func (t *ipThrottle) setLimit(cfg config.Web) {
+	lmt := tollbooth.NewLimiter(cfg.ThrottleMax, cfg.ThrottleDuration, nil)
+	lmt.SetIPLookups([]string{"RemoteAddr"})
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.limiter = lmt
+}
+
+func (t *ipThrottle) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	t.lock.RLock()
+	lmt := t.limiter
+	t.lock.RUnlock()
+
+	// tollbooth counts requests by path, the requests to all versions of an endpoint
+	// are counted under its unversioned path so that they share the limit
+	r2 := new(http.Request)
+	*r2 = *r
+	r2.URL = new(url.URL)
+	*r2.URL = *r.URL
+	r2.URL.Path = legacyAPIPrefix + endpointPath(apiVersionFromContext(r.Context()), r.URL.Path)
+	// tollbooth takes the client IP from RemoteAddr, without the port
+	r2.RemoteAddr = t.remoteIP(r) + ":0"
+
+	if httpErr := tollbooth.LimitByRequest(lmt, w, r2); httpErr != nil {
+		writeError(r.Context(), w, httpErr.StatusCode, errRateLimited)
+		return
+	}
+
+	t.handler.ServeHTTP(w, r)
 }
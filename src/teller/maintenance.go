@@ -0,0 +1,115 @@
+package teller
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/skycoin/teller/src/util/httputil"
+)
+
+// defaultMaintenanceMessage is the error message of the responses in maintenance mode, unless one is set
+const defaultMaintenanceMessage = "Teller is down for maintenance, please try again later"
+
+// readOnlyMessage is the error message of the requests that are refused in read-only mode
+const readOnlyMessage = "Teller is read-only, deposit addresses can't be bound"
+
+// MaintenanceState is the maintenance mode of the API. In maintenance mode, API requests get a 503 response,
+// except /api/config, which reports the maintenance.
+type MaintenanceState struct {
+	Enabled bool `json:"enabled"`
+	// Error message of the responses, shown to users
+	Message string `json:"message,omitempty"`
+	// When maintenance mode was enabled
+	Since int64 `json:"since,omitempty"`
+}
+
+func newMaintenanceState(enabled bool, message string) MaintenanceState {
+	if !enabled {
+		return MaintenanceState{}
+	}
+
+	if message == "" {
+		message = defaultMaintenanceMessage
+	}
+
+	return MaintenanceState{
+		Enabled: true,
+		Message: message,
+		Since:   time.Now().UTC().Unix(),
+	}
+}
+
+// SetMaintenance enables or disables maintenance mode, with the error message of the responses.
+// The message defaults to a generic one. It stays in effect until it is set again, or web.maintenance
+// is changed by Reload.
+func (s *HTTPServer) SetMaintenance(enabled bool, message string) MaintenanceState {
+	ms := newMaintenanceState(enabled, message)
+
+	s.cfgLock.Lock()
+	s.maintenance = ms
+	s.cfgLock.Unlock()
+
+	if enabled {
+		s.log.WithField("message", ms.Message).Warning("Maintenance mode enabled")
+	} else {
+		s.log.Info("Maintenance mode disabled")
+	}
+
+	return ms
+}
+
+// GetMaintenanceState returns the maintenance mode of the API
+func (s *HTTPServer) GetMaintenanceState() MaintenanceState {
+	s.cfgLock.RLock()
+	defer s.cfgLock.RUnlock()
+	return s.maintenance
+}
+
+// maintenanceHandler responds to requests with a 503 error in maintenance mode, instead of passing them to h.
+// The error is JSON in every API version, with a Retry-After of web.maintenance_retry_after.
+func (s *HTTPServer) maintenanceHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.cfgLock.RLock()
+		ms := s.maintenance
+		retryAfter := s.cfg.Web.MaintenanceRetryAfter
+		s.cfgLock.RUnlock()
+
+		if !ms.Enabled {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Retry-After", fmt.Sprint(int64(math.Ceil(retryAfter.Seconds()))))
+		w.Header().Set(httputil.ErrorCodeHeader, ErrCodeMaintenance)
+		if err := httputil.JSONStatusResponse(w, http.StatusServiceUnavailable, ErrorResponse{
+			Error: ErrorDetail{
+				Code:    ErrCodeMaintenance,
+				Message: ms.Message,
+			},
+		}); err != nil {
+			s.log.WithError(err).Error(err)
+		}
+	})
+}
+
+// readOnlyHandler responds to requests with a 503 error in read-only mode, instead of passing them to h.
+// Unlike maintenance mode, read-only mode lasts until teller is restarted, so there is no Retry-After.
+func (s *HTTPServer) readOnlyHandler(h http.Handler) http.Handler {
+	if !s.readOnly {
+		return h
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(httputil.ErrorCodeHeader, ErrCodeReadOnly)
+		if err := httputil.JSONStatusResponse(w, http.StatusServiceUnavailable, ErrorResponse{
+			Error: ErrorDetail{
+				Code:    ErrCodeReadOnly,
+				Message: readOnlyMessage,
+			},
+		}); err != nil {
+			s.log.WithError(err).Error(err)
+		}
+	})
+}
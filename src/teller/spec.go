@@ -0,0 +1,431 @@
+package teller
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/skycoin/teller/src/apikey"
+	"github.com/skycoin/teller/src/exchange"
+	"github.com/skycoin/teller/src/ownership"
+	"github.com/skycoin/teller/src/util/httputil"
+	"github.com/skycoin/teller/src/util/logger"
+	"github.com/skycoin/teller/src/util/openapi"
+	"github.com/skycoin/teller/src/util/qrutil"
+)
+
+// amountPattern matches a BIP21 amount, the amount is validated further by qrutil.ParseAmount
+const amountPattern = `^[0-9]*\.?[0-9]+$`
+
+// apiSpec returns the OpenAPI document of API version v. The requests to the API are validated
+// against it, so it must be changed together with the handlers. Responses are described by
+// the schemas of the response types.
+func apiSpec(v apiVersion) *openapi.Document {
+	skyAddr := &openapi.Schema{
+		Type:        "string",
+		Description: "Skycoin address",
+	}
+
+	return &openapi.Document{
+		OpenAPI: openapi.Version,
+		Info: openapi.Info{
+			Title:       "Teller API",
+			Description: "Exchanges BTC, LTC and ERC20 token deposits for skycoin",
+			Version:     fmt.Sprintf("%d", v),
+		},
+		Servers: []openapi.Server{
+			{
+				URL: v.prefix(),
+			},
+			{
+				URL:         legacyAPIPrefix,
+				Description: "Unversioned alias of v1",
+			},
+		},
+		Components: &openapi.Components{
+			SecuritySchemes: map[string]openapi.SecurityScheme{
+				"supportToken": {
+					Type:        "http",
+					Scheme:      "bearer",
+					Description: "Support access token",
+				},
+				"apiKey": {
+					Type:        "apiKey",
+					Name:        apikey.KeyHeader,
+					In:          openapi.InHeader,
+					Description: "API key of a trusted integrator. Signed requests are exempt from the rate limits.",
+				},
+			},
+		},
+		Paths: map[string]*openapi.PathItem{
+			"/bind": {
+				Post: &openapi.Operation{
+					OperationID: "bind",
+					Summary:     "Binds a skycoin address to a new deposit address",
+					RequestBody: &openapi.RequestBody{
+						Required: true,
+						Content: openapi.JSONContent(&openapi.Schema{
+							Type:     "object",
+							Required: []string{"skyaddr", "coin_type"},
+							Properties: map[string]*openapi.Schema{
+								"skyaddr": skyAddr,
+								"coin_type": {
+									Type:        "string",
+									Description: `"BTC", "LTC" if LTC is enabled, or the symbol of an enabled ERC20 token`,
+								},
+								"amount": {
+									Type:        "string",
+									Description: "Amount the deposit is expected to have, in BTC or LTC. BTC and LTC only.",
+									Pattern:     amountPattern,
+								},
+								"captcha_token": {
+									Type:        "string",
+									Description: "Captcha response token, required if captcha verification is enabled",
+								},
+								"campaign": {
+									Type:        "string",
+									Description: "ID of an enabled campaign to bind a deposit address of, see the campaigns of /config",
+								},
+								"quote_id": {
+									Type:        "string",
+									Description: "ID of a quote of /quote, whose rate the deposits to the address get. Can't be used with campaign.",
+								},
+								"promo_code": {
+									Type:        "string",
+									Description: "Promo or referral code, whose bonus the deposits to the address get. Only accepted if promo_codes is set in /config.",
+								},
+								"kyc_token": {
+									Type:        "string",
+									Description: "Token of the KYC service that links skyaddr to the user. Used if kyc is set in /config.",
+								},
+								"email": {
+									Type:        "string",
+									Format:      "email",
+									Description: "Email address notified when deposits to the address are done or fail. Only accepted if email_notifications is set in /config.",
+									MaxLength:   openapi.Int(254),
+								},
+								"timestamp": {
+									Type:        "integer",
+									Description: "Unix time of the request in seconds, required if bind signatures are enabled",
+								},
+								"signature": {
+									Type:        "string",
+									Description: "Hex signature of the bind request made with the secret key of skyaddr, required if bind signatures are enabled",
+								},
+							},
+						}),
+					},
+					Responses: apiResponses(v, BindResponse{}),
+				},
+			},
+			"/status": {
+				Get: &openapi.Operation{
+					OperationID: "status",
+					Summary:     "Returns the deposit statuses of a skycoin address",
+					Parameters: []openapi.Parameter{
+						{
+							Name:     "skyaddr",
+							In:       openapi.InQuery,
+							Required: true,
+							Schema:   skyAddr,
+						},
+						{
+							Name:        "history",
+							In:          openapi.InQuery,
+							Description: "Include the status history of each deposit",
+							Schema:      &openapi.Schema{Type: "boolean"},
+						},
+						{
+							Name:        "nonce",
+							In:          openapi.InQuery,
+							Description: "Nonce of /status/challenge, required if status_challenge is set in /config",
+							Schema:      &openapi.Schema{Type: "string"},
+						},
+						{
+							Name:        "signature",
+							In:          openapi.InQuery,
+							Description: "Hex signature of the hash of the nonce, made with the secret key of skyaddr",
+							Schema:      &openapi.Schema{Type: "string"},
+						},
+					},
+					Responses: apiResponses(v, StatusResponse{}),
+				},
+			},
+			"/status/challenge": {
+				Get: &openapi.Operation{
+					OperationID: "statusChallenge",
+					Summary:     "Returns a nonce to sign with the secret key of a skycoin address, to request its deposit statuses",
+					Description: "Only served if status_challenge is set in /config",
+					Parameters: []openapi.Parameter{
+						{
+							Name:     "skyaddr",
+							In:       openapi.InQuery,
+							Required: true,
+							Schema:   skyAddr,
+						},
+					},
+					Responses: apiResponses(v, ownership.Challenge{}),
+				},
+			},
+			"/quote": {
+				Post: &openapi.Operation{
+					OperationID: "quote",
+					Summary:     "Returns a fixed-price quote of a coin type, to bind a deposit address with",
+					Description: "Only served if quotes is set in /config",
+					RequestBody: &openapi.RequestBody{
+						Required: true,
+						Content: openapi.JSONContent(&openapi.Schema{
+							Type:     "object",
+							Required: []string{"coin_type"},
+							Properties: map[string]*openapi.Schema{
+								"coin_type": {
+									Type:        "string",
+									Description: `"BTC", "LTC" if LTC is enabled, or the symbol of an enabled ERC20 token`,
+								},
+							},
+						}),
+					},
+					Responses: apiResponses(v, QuoteResponse{}),
+				},
+			},
+			"/status/batch": {
+				Post: &openapi.Operation{
+					OperationID: "batchStatus",
+					Summary:     "Returns the deposit statuses of multiple skycoin addresses",
+					RequestBody: &openapi.RequestBody{
+						Required: true,
+						Content: openapi.JSONContent(&openapi.Schema{
+							Type:     "object",
+							Required: []string{"skyaddrs"},
+							Properties: map[string]*openapi.Schema{
+								"skyaddrs": {
+									Type:        "array",
+									Description: "At most status_batch_max addresses, see /config",
+									Items:       skyAddr,
+									MinItems:    openapi.Int(1),
+								},
+							},
+						}),
+					},
+					Responses: apiResponses(v, BatchStatusResponse{}),
+				},
+			},
+			"/deposit": {
+				Get: &openapi.Operation{
+					OperationID: "deposit",
+					Summary:     "Returns a deposit by its transaction output",
+					Parameters: []openapi.Parameter{
+						{
+							Name:        "txid",
+							In:          openapi.InQuery,
+							Description: "Transaction of the deposit",
+							Required:    true,
+							Schema:      &openapi.Schema{Type: "string"},
+						},
+						{
+							Name:        "n",
+							In:          openapi.InQuery,
+							Description: "Index of the deposit in the transaction, the vout for BTC and LTC or the log index for ERC20 tokens",
+							Required:    true,
+							Schema: &openapi.Schema{
+								Type:    "integer",
+								Minimum: openapi.Int64(0),
+								Maximum: openapi.Int64(1<<32 - 1),
+							},
+						},
+					},
+					Responses: apiResponses(v, exchange.DepositDetail{}),
+				},
+			},
+			"/qr": {
+				Get: &openapi.Operation{
+					OperationID: "qr",
+					Summary:     "Returns a QR code PNG of a deposit address, or of a payment URI to it",
+					Parameters: []openapi.Parameter{
+						{
+							Name:        "data",
+							In:          openapi.InQuery,
+							Description: "Deposit address",
+							Required:    true,
+							Schema:      &openapi.Schema{Type: "string"},
+						},
+						{
+							Name:        "coin_type",
+							In:          openapi.InQuery,
+							Description: "Coin type of the deposit address, BTC by default",
+							Schema:      &openapi.Schema{Type: "string"},
+						},
+						{
+							Name:        "uri",
+							In:          openapi.InQuery,
+							Description: "Encode a BIP21 payment URI. BTC and LTC only.",
+							Schema:      &openapi.Schema{Type: "boolean"},
+						},
+						{
+							Name:        "amount",
+							In:          openapi.InQuery,
+							Description: "Amount of the payment URI in BTC or LTC. Implies uri.",
+							Schema: &openapi.Schema{
+								Type:    "string",
+								Pattern: amountPattern,
+							},
+						},
+						{
+							Name:        "size",
+							In:          openapi.InQuery,
+							Description: fmt.Sprintf("Width and height in pixels, %d by default", qrDefaultSize),
+							Schema: &openapi.Schema{
+								Type:    "integer",
+								Minimum: openapi.Int64(qrutil.MinSize),
+								Maximum: openapi.Int64(qrutil.MaxSize),
+							},
+						},
+					},
+					Responses: map[string]openapi.Response{
+						"200": {
+							Description: "QR code",
+							Content: map[string]openapi.MediaType{
+								"image/png": {
+									Schema: &openapi.Schema{Type: "string", Format: "binary"},
+								},
+							},
+						},
+						"400":     invalidRequestSpec(v),
+						"default": errorResponseSpec(v),
+					},
+				},
+			},
+			"/notifications/unsubscribe": {
+				Get:  unsubscribeSpec(v, "unsubscribe"),
+				Post: unsubscribeSpec(v, "unsubscribeOneClick"),
+			},
+			"/config": {
+				Get: &openapi.Operation{
+					OperationID: "config",
+					Summary:     "Returns the teller configuration, with the exchange rates for the region of the client",
+					Responses:   apiResponses(v, ConfigResponse{}),
+				},
+			},
+			"/support/status": {
+				Get: &openapi.Operation{
+					OperationID: "supportStatus",
+					Summary:     "Returns the deposits of the skycoin address of a support token",
+					Description: "Only served if support tokens are enabled",
+					Security: []map[string][]string{
+						{"supportToken": {}},
+					},
+					Responses: apiResponses(v, SupportStatusResponse{}),
+				},
+			},
+			"/spec": {
+				Get: &openapi.Operation{
+					OperationID: "spec",
+					Summary:     "Returns this document",
+					Responses: map[string]openapi.Response{
+						"200": {
+							Description: "OpenAPI document",
+							Content:     openapi.JSONContent(&openapi.Schema{Type: "object"}),
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// unsubscribeSpec returns the operation of the unsubscribe links of notification emails, which are
+// opened with GET, or POSTed to by mail clients that support one-click unsubscribe
+func unsubscribeSpec(v apiVersion, operationID string) *openapi.Operation {
+	return &openapi.Operation{
+		OperationID: operationID,
+		Summary:     "Deletes the email address of the unsubscribe link of a notification email",
+		Description: "Only served if email_notifications is set in /config",
+		Parameters: []openapi.Parameter{
+			{
+				Name:        "email",
+				In:          openapi.InQuery,
+				Description: "Hash of the email address",
+				Required:    true,
+				Schema:      &openapi.Schema{Type: "string"},
+			},
+			{
+				Name:        "token",
+				In:          openapi.InQuery,
+				Description: "Token of the unsubscribe link",
+				Required:    true,
+				Schema:      &openapi.Schema{Type: "string"},
+			},
+		},
+		Responses: apiResponses(v, UnsubscribeResponse{}),
+	}
+}
+
+// invalidRequestSpec returns the response to a request of API version v that doesn't match the API spec
+func invalidRequestSpec(v apiVersion) openapi.Response {
+	if v >= apiV2 {
+		return openapi.Response{
+			Description: "Invalid request, with the invalid parameters",
+			Content:     openapi.JSONContent(openapi.SchemaOf(ErrorResponse{})),
+		}
+	}
+
+	return openapi.Response{
+		Description: "Invalid request. The error is returned as problem details if the client accepts them.",
+		Content: map[string]openapi.MediaType{
+			"text/plain": {
+				Schema: &openapi.Schema{Type: "string"},
+			},
+			openapi.ProblemContentType: {
+				Schema: openapi.SchemaOf(openapi.Problem{}),
+			},
+		},
+	}
+}
+
+// errorResponseSpec returns the response to a failed request of API version v
+func errorResponseSpec(v apiVersion) openapi.Response {
+	if v >= apiV2 {
+		return openapi.Response{
+			Description: "Error with its code",
+			Content:     openapi.JSONContent(openapi.SchemaOf(ErrorResponse{})),
+		}
+	}
+
+	return openapi.Response{
+		Description: "Error message. The error code is in the X-Error-Code header.",
+		Content: map[string]openapi.MediaType{
+			"text/plain": {
+				Schema: &openapi.Schema{Type: "string"},
+			},
+		},
+	}
+}
+
+// apiResponses returns the responses of an operation of API version v that returns a JSON response like resp
+func apiResponses(v apiVersion, resp interface{}) map[string]openapi.Response {
+	return map[string]openapi.Response{
+		"200": {
+			Description: "OK",
+			Content:     openapi.JSONContent(openapi.SchemaOf(resp)),
+		},
+		"400":     invalidRequestSpec(v),
+		"default": errorResponseSpec(v),
+	}
+}
+
+// SpecHandler returns the OpenAPI document of the API
+// Method: GET
+// URI: /api/spec
+func SpecHandler(spec *openapi.Document) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := logger.FromContext(ctx)
+
+		if !validMethod(ctx, w, r, []string{http.MethodGet}) {
+			return
+		}
+
+		if err := httputil.JSONResponse(w, spec); err != nil {
+			log.WithError(err).Error(err)
+		}
+	}
+}
@@ -1,18 +1,43 @@
 package teller
 
 import (
+	"context"
 	"errors"
+	"sync"
+	"time"
 
 	"github.com/sirupsen/logrus"
 
+	"github.com/skycoin/skycoin/src/util/droplet"
+
 	"github.com/skycoin/teller/src/addrs"
+	"github.com/skycoin/teller/src/campaign"
 	"github.com/skycoin/teller/src/config"
 	"github.com/skycoin/teller/src/exchange"
+	"github.com/skycoin/teller/src/ipfilter"
+	"github.com/skycoin/teller/src/pricing"
+	"github.com/skycoin/teller/src/promo"
+	"github.com/skycoin/teller/src/quote"
+	"github.com/skycoin/teller/src/ratelimit"
+	"github.com/skycoin/teller/src/scanner"
+	"github.com/skycoin/teller/src/tracing"
+	"github.com/skycoin/teller/src/util/logger"
+)
+
+const (
+	// expireBindingsInterval is how often the bindings are checked for expiry
+	expireBindingsInterval = time.Minute
+	// recycleBindingsInterval is how often the bindings are checked for recycling, if it is enabled
+	recycleBindingsInterval = time.Hour
 )
 
 var (
 	// ErrMaxBoundAddresses is returned when the maximum number of address to bind to a SKY address has been reached
 	ErrMaxBoundAddresses = errors.New("The maximum number of BTC addresses have been assigned to this SKY address")
+	// ErrDepositsPaused is returned when binding an address while payouts are paused
+	ErrDepositsPaused = errors.New("Deposits are temporarily paused, please try again later")
+	// ErrNotificationsDisabled is returned when binding an address with an email address while email notifications are disabled
+	ErrNotificationsDisabled = errors.New("Email notifications are not enabled")
 )
 
 // Teller provides the HTTP and teller service
@@ -25,20 +50,113 @@ type Teller struct {
 }
 
 // New creates a Teller
-func New(log logrus.FieldLogger, exchanger exchange.Exchanger, addrGen addrs.AddrGenerator, cfg config.Config) *Teller {
+func New(log logrus.FieldLogger, exchanger exchange.Exchanger, addrManager *addrs.AddrManager, limitStore ratelimit.Store, captchaVerifier CaptchaVerifier, pricer *pricing.Pricer, supportTokens SupportTokenAuthorizer, cfg config.Config) *Teller {
 	return &Teller{
 		cfg:  cfg.Teller,
 		log:  log.WithField("prefix", "teller"),
 		quit: make(chan struct{}),
 		done: make(chan struct{}),
 		httpServ: NewHTTPServer(log, cfg.Redacted(), &Service{
-			cfg:       cfg.Teller,
-			exchanger: exchanger,
-			addrGen:   addrGen,
-		}),
+			log:         log.WithField("prefix", "teller.service"),
+			cfg:         cfg.Teller,
+			exchanger:   exchanger,
+			addrManager: addrManager,
+		}, limitStore, captchaVerifier, pricer, supportTokens),
 	}
 }
 
+// SetErrorCounter sets the ErrorCounter that counts the server errors of the API. Must be called before Run.
+func (s *Teller) SetErrorCounter(c ErrorCounter) {
+	s.httpServ.errorCounter = c
+}
+
+// SetAPIKeys sets the APIKeyVerifier that verifies signed API requests. Must be called before Run.
+func (s *Teller) SetAPIKeys(k APIKeyVerifier) {
+	s.httpServ.apiKeys = k
+}
+
+// SetIPFilter sets the Filter that denies requests from blocked IPs. Must be called before Run.
+func (s *Teller) SetIPFilter(f *ipfilter.Filter) {
+	s.httpServ.ipFilter = f
+}
+
+// SetOwnership sets the OwnershipVerifier that status requests must prove the ownership of their
+// skycoin address with. Must be called before Run.
+func (s *Teller) SetOwnership(o OwnershipVerifier) {
+	s.httpServ.ownership = o
+}
+
+// SetBindSignatures sets the BindSignatureVerifier that bind requests must be signed for with the secret key
+// of their skycoin address. Must be called before Run.
+func (s *Teller) SetBindSignatures(v BindSignatureVerifier) {
+	s.httpServ.bindSignatures = v
+}
+
+// SetCampaigns sets the CampaignManager of the campaigns that addresses can be bound for.
+// Must be called before Run.
+func (s *Teller) SetCampaigns(c CampaignManager) {
+	s.httpServ.service.campaigns = c
+}
+
+// SetQuotes sets the QuoteManager that issues fixed-price quotes, which addresses can be bound with.
+// Must be called before Run.
+func (s *Teller) SetQuotes(q QuoteManager) {
+	s.httpServ.service.quotes = q
+}
+
+// SetPromoCodes sets the PromoCodeManager of the promo codes that addresses can be bound with.
+// Must be called before Run.
+func (s *Teller) SetPromoCodes(p PromoCodeManager) {
+	s.httpServ.service.promoCodes = p
+}
+
+// SetNotifications sets the NotificationManager of the email addresses that addresses can be bound with,
+// to notify users of their deposits. Must be called before Run.
+func (s *Teller) SetNotifications(n NotificationManager) {
+	s.httpServ.service.notifications = n
+}
+
+// SetKYC sets the KYCVerifier that the owners of the skycoin addresses of bind requests must pass KYC with.
+// Must be called before Run.
+func (s *Teller) SetKYC(k KYCVerifier) {
+	s.httpServ.kyc = k
+}
+
+// SetTracer sets the Tracer that traces the API requests. Must be called before Run.
+func (s *Teller) SetTracer(t *tracing.Tracer) {
+	s.httpServ.tracer = t
+}
+
+// SetReadOnly makes bind and quote requests fail with a 503 error, for teller started with a copy of the db
+// that deposits are not processed from. Must be called before Run.
+func (s *Teller) SetReadOnly() {
+	s.httpServ.readOnly = true
+}
+
+// SetMaintenance enables or disables maintenance mode of the API, see HTTPServer.SetMaintenance
+func (s *Teller) SetMaintenance(enabled bool, message string) MaintenanceState {
+	return s.httpServ.SetMaintenance(enabled, message)
+}
+
+// GetMaintenanceState returns the maintenance mode of the API
+func (s *Teller) GetMaintenanceState() MaintenanceState {
+	return s.httpServ.GetMaintenanceState()
+}
+
+// Reload applies the settings of cfg that can be changed while teller is running, see config.Reload.
+// If it fails, no setting is changed.
+func (s *Teller) Reload(cfg config.Config) error {
+	if err := s.httpServ.Reload(cfg); err != nil {
+		return err
+	}
+
+	s.httpServ.service.cfgLock.Lock()
+	defer s.httpServ.service.cfgLock.Unlock()
+	s.httpServ.service.cfg = cfg.Teller
+
+	return nil
+}
+
 // Run starts the Teller
 func (s *Teller) Run() error {
 	log := s.log.WithField("config", s.cfg)
@@ -46,6 +164,57 @@ func (s *Teller) Run() error {
 	defer log.Info("Teller closed")
 	defer close(s.done)
 
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	// This loop returns the addresses of the bindings that expired unused to the address pools
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		log := log.WithField("goroutine", "expireBindings")
+		defer logger.LogPanic(log)
+
+		ticker := time.NewTicker(expireBindingsInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-s.quit:
+				return
+			case <-ticker.C:
+				if err := s.httpServ.service.expireBindings(); err != nil {
+					log.WithError(err).Error("expireBindings failed")
+				}
+			}
+		}
+	}()
+
+	// This loop returns the addresses whose deposits were processed to the address pools
+	if s.cfg.RecycleAddresses {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			log := log.WithField("goroutine", "recycleBindings")
+			defer logger.LogPanic(log)
+
+			ticker := time.NewTicker(recycleBindingsInterval)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-s.quit:
+					return
+				case <-ticker.C:
+					if err := s.httpServ.service.recycleBindings(s.cfg.RecycleCoolDown); err != nil {
+						log.WithError(err).Error("recycleBindings failed")
+					}
+				}
+			}
+		}()
+	}
+
 	if err := s.httpServ.Run(); err != nil {
 		log.WithError(err).Error(err)
 		select {
@@ -69,41 +238,336 @@ func (s *Teller) Shutdown() {
 	<-s.done
 }
 
-// Service combines Exchanger and AddrGenerator
+// CampaignManager provides the campaigns that addresses can be bound for, and the addresses of their pools
+type CampaignManager interface {
+	Get(id string) (campaign.Campaign, error)
+	Campaigns() ([]campaign.Campaign, error)
+	NewAddress(id, coinType string) (string, error)
+	Release(id, addr string) error
+}
+
+// QuoteManager issues fixed-price quotes, and binds deposit addresses with them
+type QuoteManager interface {
+	Issue(coinType, rate string) (quote.Quote, error)
+	Verify(id, coinType string) error
+	Bind(id, coinType, depositAddr string) error
+}
+
+// PromoCodeManager provides the promo codes that addresses can be bound with, and counts their uses
+type PromoCodeManager interface {
+	Verify(code string) error
+	Use(code string) (string, error)
+}
+
+// NotificationManager keeps the email addresses that users are notified of the deposits to their deposit addresses at
+type NotificationManager interface {
+	Subscribe(depositAddr, email string) error
+	Unsubscribe(emailHash, token string) (int, error)
+	Delete(depositAddr string) error
+}
+
+// Service combines Exchanger and AddrManager
 type Service struct {
-	cfg       config.Teller
-	exchanger exchange.Exchanger  // exchange Teller client
-	addrGen   addrs.AddrGenerator // address generator
+	log           logrus.FieldLogger
+	cfg           config.Teller
+	cfgLock       sync.RWMutex        // guards cfg, which is changed by Teller.Reload
+	exchanger     exchange.Exchanger  // exchange Teller client
+	addrManager   *addrs.AddrManager  // address generator of each coin type
+	campaigns     CampaignManager     // optional, addresses can be bound for campaigns if set
+	quotes        QuoteManager        // optional, addresses can be bound with quotes if set
+	promoCodes    PromoCodeManager    // optional, addresses can be bound with promo codes if set
+	notifications NotificationManager // optional, addresses can be bound with an email address to notify if set
 }
 
-// BindAddress binds skycoin address with a deposit btc address
-// return btc address
-// TODO -- support multiple coin types
-func (s *Service) BindAddress(skyAddr string) (string, error) {
-	if s.cfg.MaxBoundBtcAddresses > 0 {
+// BindAddress binds skycoin address with a deposit address of coinType,
+// priced for region if not empty. If campaignID is not empty, the deposit address is taken
+// from the pool of the campaign. If quoteID is not empty, deposits to the address get the rate of the quote
+// until it expires. If promoCode is not empty, deposits to the address get the bonus of the promo code.
+// If email is not empty, it is notified of the deposits to the address. If expectedValue is not 0, deposits to the address
+// are compared with it, see exchange.DepositInfo.PaymentStatus. Returns the deposit address, and the unix time
+// the binding expires at if the address receives no deposit, or 0 if it does not expire
+func (s *Service) BindAddress(ctx context.Context, skyAddr, coinType, region, campaignID, quoteID, promoCode, email string, expectedValue int64) (string, int64, error) {
+	log := logger.WithRequestIDField(ctx, s.log).WithFields(logrus.Fields{
+		"skyAddr":       skyAddr,
+		"coinType":      coinType,
+		"region":        region,
+		"campaign":      campaignID,
+		"quoteID":       quoteID,
+		"promoCode":     promoCode,
+		"expectedValue": expectedValue,
+	})
+
+	ctx, span := tracing.StartSpan(ctx, "teller.Service.BindAddress", tracing.KindInternal)
+	span.SetAttribute("deposit.coin_type", coinType)
+	defer span.End()
+
+	if s.exchanger.Paused() {
+		log.Info("Payouts are paused, not binding")
+		return "", 0, ErrDepositsPaused
+	}
+
+	if email != "" && s.notifications == nil {
+		return "", 0, ErrNotificationsDisabled
+	}
+
+	s.cfgLock.RLock()
+	maxBound := s.cfg.MaxBoundBtcAddresses
+	bindTTL := s.cfg.BindTTL
+	s.cfgLock.RUnlock()
+
+	// Integrators have the limit of their API key
+	if k, ok := apiKeyFromContext(ctx); ok {
+		maxBound = k.MaxBoundAddresses
+		log = log.WithField("apiKey", k.ID)
+	}
+
+	if maxBound > 0 {
 		num, err := s.exchanger.GetBindNum(skyAddr)
 		if err != nil {
-			return "", err
+			log.WithError(err).Error("exchanger.GetBindNum failed")
+			return "", 0, err
+		}
+
+		if num >= maxBound {
+			log.WithField("boundNum", num).Info("Max bound addresses reached")
+			return "", 0, ErrMaxBoundAddresses
+		}
+	}
+
+	// The quote and promo code are checked before a deposit address is taken from the pool, so that
+	// invalid ones don't use up addresses
+	if quoteID != "" {
+		if s.quotes == nil {
+			return "", 0, quote.ErrNotFound
+		}
+
+		if err := s.quotes.Verify(quoteID, coinType); err != nil {
+			log.WithError(err).Info("Quote can't be used")
+			return "", 0, err
+		}
+	}
+
+	if promoCode != "" {
+		if s.promoCodes == nil {
+			return "", 0, promo.ErrNotFound
+		}
+
+		if err := s.promoCodes.Verify(promoCode); err != nil {
+			log.WithError(err).Info("Promo code can't be used")
+			return "", 0, err
+		}
+	}
+
+	var depositAddr string
+	var err error
+	if campaignID != "" {
+		depositAddr, err = s.campaignAddress(campaignID, coinType)
+		if err != nil {
+			log.WithError(err).Error("campaignAddress failed")
+			span.SetError(err)
+			return "", 0, err
+		}
+	} else {
+		depositAddr, err = s.addrManager.NewAddress(coinType)
+		if err != nil {
+			log.WithError(err).Error("addrManager.NewAddress failed")
+			span.SetError(err)
+			return "", 0, err
+		}
+	}
+
+	if quoteID != "" {
+		if err := s.quotes.Bind(quoteID, coinType, depositAddr); err != nil {
+			log.WithError(err).WithField("depositAddr", depositAddr).Error("quotes.Bind failed")
+			span.SetError(err)
+			return "", 0, err
+		}
+	}
+
+	// The code is saved in its normalized form, so that the deposits of a code can be looked up
+	if promoCode != "" {
+		promoCode, err = s.promoCodes.Use(promoCode)
+		if err != nil {
+			log.WithError(err).WithField("depositAddr", depositAddr).Error("promoCodes.Use failed")
+			span.SetError(err)
+			return "", 0, err
+		}
+	}
+
+	var expiresAt int64
+	if bindTTL > 0 {
+		expiresAt = time.Now().Add(bindTTL).Unix()
+	}
+
+	if err := s.exchanger.BindAddress(ctx, skyAddr, depositAddr, coinType, region, campaignID, promoCode, expectedValue, expiresAt); err != nil {
+		log.WithError(err).WithField("depositAddr", depositAddr).Error("exchanger.BindAddress failed")
+		span.SetError(err)
+		return "", 0, err
+	}
+
+	if email != "" {
+		if err := s.notifications.Subscribe(depositAddr, email); err != nil {
+			log.WithError(err).WithField("depositAddr", depositAddr).Error("notifications.Subscribe failed")
+			span.SetError(err)
+			return "", 0, err
+		}
+	}
+
+	return depositAddr, expiresAt, nil
+}
+
+// expireBindings unbinds the deposit addresses whose bindings expired without receiving a deposit,
+// and returns them to the address pools they were taken from
+func (s *Service) expireBindings() error {
+	bs, err := s.exchanger.ExpireBindings()
+	if err != nil {
+		return err
+	}
+
+	s.releaseAddresses(bs)
+	return nil
+}
+
+// recycleBindings unbinds the deposit addresses whose deposits were all processed more than coolDown ago,
+// and returns them to the address pools they were taken from
+func (s *Service) recycleBindings(coolDown time.Duration) error {
+	bs, err := s.exchanger.RecycleBindings(coolDown)
+	if err != nil {
+		return err
+	}
+
+	s.releaseAddresses(bs)
+	return nil
+}
+
+// releaseAddresses returns the addresses of removed bindings to the address pools they were taken from
+func (s *Service) releaseAddresses(bs []exchange.Binding) {
+	for _, b := range bs {
+		log := s.log.WithFields(logrus.Fields{
+			"depositAddr": b.DepositAddress,
+			"campaign":    b.Campaign,
+		})
+
+		// The email address left for the binding is not kept for the next binding of the address
+		if s.notifications != nil {
+			if err := s.notifications.Delete(b.DepositAddress); err != nil {
+				log.WithError(err).Error("notifications.Delete failed")
+			}
+		}
+
+		var err error
+		if b.Campaign != "" && s.campaigns != nil {
+			err = s.campaigns.Release(b.Campaign, b.DepositAddress)
+		} else {
+			err = s.addrManager.Release(b.DepositAddress)
 		}
 
-		if num >= s.cfg.MaxBoundBtcAddresses {
-			return "", ErrMaxBoundAddresses
+		if err != nil {
+			log.WithError(err).Error("Releasing the address of a removed binding failed, it is not bound again")
+			continue
 		}
+
+		log.Info("Released the address of a removed binding")
+	}
+}
+
+// campaignAddress returns a new deposit address of coinType from the pool of a campaign.
+// Returns campaign.ErrNotFound, campaign.ErrDisabled or campaign.ErrCapReached if addresses
+// can't be bound for the campaign.
+func (s *Service) campaignAddress(campaignID, coinType string) (string, error) {
+	if s.campaigns == nil {
+		return "", campaign.ErrNotFound
 	}
 
-	btcAddr, err := s.addrGen.NewAddress()
+	c, err := s.campaigns.Get(campaignID)
 	if err != nil {
 		return "", err
 	}
 
-	if err := s.exchanger.BindAddress(skyAddr, btcAddr); err != nil {
+	if !c.Enabled {
+		return "", campaign.ErrDisabled
+	}
+
+	maxSky, err := c.MaxDroplets()
+	if err != nil {
 		return "", err
 	}
 
-	return btcAddr, nil
+	// The cap is checked when binding, deposits to the addresses bound before it was reached are still converted
+	if maxSky > 0 {
+		stats, err := s.exchanger.GetCampaignDepositStats(campaignID)
+		if err != nil {
+			return "", err
+		}
+
+		if uint64(stats.TotalSKYSent) >= maxSky {
+			return "", campaign.ErrCapReached
+		}
+	}
+
+	return s.campaigns.NewAddress(campaignID, coinType)
+}
+
+// Paused returns true if payouts are paused, e.g. for a low hot wallet balance
+func (s *Service) Paused() bool {
+	return s.exchanger.Paused()
 }
 
-// GetDepositStatuses returns deposit status of given skycoin address
-func (s *Service) GetDepositStatuses(skyAddr string) ([]exchange.DepositStatus, error) {
-	return s.exchanger.GetDepositStatuses(skyAddr)
+// GetDepositStatuses returns deposit status of given skycoin address, with the status history of each deposit if history is true
+func (s *Service) GetDepositStatuses(ctx context.Context, skyAddr string, history bool) ([]exchange.DepositStatus, error) {
+	dss, err := s.exchanger.GetDepositStatuses(skyAddr, history)
+	if err != nil {
+		log := logger.WithRequestIDField(ctx, s.log).WithField("skyAddr", skyAddr)
+		log.WithError(err).Error("exchanger.GetDepositStatuses failed")
+		return nil, err
+	}
+
+	return dss, nil
+}
+
+// RemainingSky returns the SKY a skycoin address can still buy before it reaches its lifetime purchase limit,
+// or an empty string if there is no limit
+func (s *Service) RemainingSky(ctx context.Context, skyAddr string) (string, error) {
+	remaining, limited, err := s.exchanger.RemainingSky(skyAddr)
+	if err != nil {
+		log := logger.WithRequestIDField(ctx, s.log).WithField("skyAddr", skyAddr)
+		log.WithError(err).Error("exchanger.RemainingSky failed")
+		return "", err
+	}
+
+	if !limited {
+		return "", nil
+	}
+
+	return droplet.ToString(remaining)
+}
+
+// GetDepositStatusDetails returns the deposits of given skycoin address, with their deposit addresses and skycoin txids
+func (s *Service) GetDepositStatusDetails(ctx context.Context, skyAddr string) ([]exchange.DepositStatusDetail, error) {
+	dss, err := s.exchanger.QueryDepositStatusDetail(exchange.DepositQuery{
+		SkyAddress: skyAddr,
+	})
+	if err != nil {
+		log := logger.WithRequestIDField(ctx, s.log).WithField("skyAddr", skyAddr)
+		log.WithError(err).Error("exchanger.QueryDepositStatusDetail failed")
+		return nil, err
+	}
+
+	return dss, nil
+}
+
+// GetDepositDetail returns the deposit of output n of transaction txid, with its status history
+func (s *Service) GetDepositDetail(ctx context.Context, txid string, n uint32) (exchange.DepositDetail, error) {
+	depositID := scanner.Deposit{
+		Tx: txid,
+		N:  n,
+	}.ID()
+
+	dd, err := s.exchanger.GetDepositDetail(depositID)
+	if err != nil && err != exchange.ErrDepositNotFound {
+		log := logger.WithRequestIDField(ctx, s.log).WithField("depositID", depositID)
+		log.WithError(err).Error("exchanger.GetDepositDetail failed")
+	}
+
+	return dd, err
 }
@@ -1,6 +1,8 @@
 package teller
 
 import (
+	"context"
+
 	"github.com/skycoin/teller/src/exchange"
 )
 
@@ -9,7 +11,7 @@ type dummyExchanger struct {
 	skyAddrs map[string][]string
 }
 
-func (de dummyExchanger) BindAddress(skyAddr, btcAddr string) error {
+func (de dummyExchanger) BindAddress(ctx context.Context, skyAddr, btcAddr, coinType, region, campaign, promoCode string, expectedValue, expiresAt int64) error {
 	if de.err != nil {
 		return de.err
 	}
@@ -29,11 +31,11 @@ func (de dummyExchanger) BindAddress(skyAddr, btcAddr string) error {
 	return de.err
 }
 
-func (de dummyExchanger) GetDepositStatuses(skyAddr string) ([]exchange.DepositStatus, error) {
+func (de dummyExchanger) GetDepositStatuses(skyAddr string, history bool) ([]exchange.DepositStatus, error) {
 	return nil, nil
 }
 
-func (de dummyExchanger) GetDepositStatusDetail(flt exchange.DepositFilter) ([]exchange.DepositStatusDetail, error) {
+func (de dummyExchanger) QueryDepositStatusDetail(q exchange.DepositQuery) ([]exchange.DepositStatusDetail, error) {
 	return nil, nil
 }
 
@@ -0,0 +1,199 @@
+package tor
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const dialTimeout = time.Second * 10
+
+// Tor control port authentication methods
+const (
+	authNull           = "NULL"
+	authHashedPassword = "HASHEDPASSWORD"
+	authCookie         = "COOKIE"
+)
+
+// ErrPasswordRequired is returned if the control port requires a password and none is configured
+var ErrPasswordRequired = errors.New("Tor control port requires a password")
+
+// controlConn is a connection to the Tor control port, see https://spec.torproject.org/control-spec
+type controlConn struct {
+	text *textproto.Conn
+}
+
+func dialControl(addr string) (*controlConn, error) {
+	conn, err := net.DialTimeout("tcp", addr, dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return &controlConn{
+		text: textproto.NewConn(conn),
+	}, nil
+}
+
+// Close closes the connection
+func (c *controlConn) Close() error {
+	return c.text.Close()
+}
+
+// cmd sends a command and returns the lines of its 250 reply, without the final OK line.
+// An error reply is returned as a *textproto.Error.
+func (c *controlConn) cmd(format string, args ...interface{}) ([]string, error) {
+	id, err := c.text.Cmd(format, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	c.text.StartResponse(id)
+	defer c.text.EndResponse(id)
+
+	_, msg, err := c.text.ReadResponse(250)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := strings.Split(msg, "\n")
+	return lines[:len(lines)-1], nil
+}
+
+// wait reads from the connection until it is closed, discarding asynchronous events
+func (c *controlConn) wait() error {
+	for {
+		if _, err := c.text.ReadLine(); err != nil {
+			return err
+		}
+	}
+}
+
+// authenticate authenticates with password if it is not empty, otherwise with no authentication
+// or with the authentication cookie, whichever the control port accepts
+func (c *controlConn) authenticate(password string) error {
+	if password != "" {
+		_, err := c.cmd("AUTHENTICATE %s", strconv.Quote(password))
+		return err
+	}
+
+	methods, cookieFile, err := c.protocolInfo()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case methods[authNull]:
+		_, err := c.cmd("AUTHENTICATE")
+		return err
+
+	case methods[authCookie]:
+		cookie, err := ioutil.ReadFile(cookieFile)
+		if err != nil {
+			return fmt.Errorf("Read Tor auth cookie failed: %v", err)
+		}
+
+		_, err = c.cmd("AUTHENTICATE %s", hex.EncodeToString(cookie))
+		return err
+
+	case methods[authHashedPassword]:
+		return ErrPasswordRequired
+
+	default:
+		return fmt.Errorf("Tor control port has no supported authentication method, it accepts %v", methods)
+	}
+}
+
+// protocolInfo returns the authentication methods of the control port, and the cookie file of COOKIE authentication
+func (c *controlConn) protocolInfo() (map[string]bool, string, error) {
+	lines, err := c.cmd("PROTOCOLINFO 1")
+	if err != nil {
+		return nil, "", err
+	}
+
+	methods := make(map[string]bool)
+	var cookieFile string
+	for _, l := range lines {
+		if !strings.HasPrefix(l, "AUTH ") {
+			continue
+		}
+
+		for _, f := range strings.Fields(l)[1:] {
+			if strings.HasPrefix(f, "METHODS=") {
+				for _, m := range strings.Split(strings.TrimPrefix(f, "METHODS="), ",") {
+					methods[m] = true
+				}
+			}
+		}
+
+		// The cookie file is quoted and may contain spaces
+		if i := strings.Index(l, "COOKIEFILE="); i != -1 {
+			cookieFile, err = unquotePrefix(l[i+len("COOKIEFILE="):])
+			if err != nil {
+				return nil, "", fmt.Errorf("Invalid PROTOCOLINFO COOKIEFILE: %v", err)
+			}
+		}
+	}
+
+	return methods, cookieFile, nil
+}
+
+// unquotePrefix unquotes the quoted string at the start of s
+func unquotePrefix(s string) (string, error) {
+	if !strings.HasPrefix(s, `"`) {
+		return "", errors.New("not quoted")
+	}
+
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return strconv.Unquote(s[:i+1])
+		}
+	}
+
+	return "", errors.New("missing closing quote")
+}
+
+// addOnion publishes a v3 hidden service forwarding virtualPort to target, with the private key key,
+// or a new key if key is empty. It returns the service ID, and the new private key if key is empty.
+// The hidden service is removed when the connection closes.
+func (c *controlConn) addOnion(key string, virtualPort int, target string) (string, string, error) {
+	keyArg := key
+	flags := " Flags=DiscardPK"
+	if key == "" {
+		keyArg = "NEW:" + keyType
+		flags = ""
+	}
+
+	lines, err := c.cmd("ADD_ONION %s%s Port=%d,%s", keyArg, flags, virtualPort, target)
+	if err != nil {
+		return "", "", err
+	}
+
+	var serviceID, privateKey string
+	for _, l := range lines {
+		switch {
+		case strings.HasPrefix(l, "ServiceID="):
+			serviceID = strings.TrimPrefix(l, "ServiceID=")
+		case strings.HasPrefix(l, "PrivateKey="):
+			privateKey = strings.TrimPrefix(l, "PrivateKey=")
+		}
+	}
+
+	if serviceID == "" {
+		return "", "", errors.New("ADD_ONION reply has no ServiceID")
+	}
+
+	if key == "" && privateKey == "" {
+		return "", "", errors.New("ADD_ONION reply has no PrivateKey")
+	}
+
+	return serviceID, privateKey, nil
+}
@@ -0,0 +1,192 @@
+// Package tor publishes teller's HTTP listener as a Tor v3 hidden service, through the control port of a local Tor
+package tor
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// keyType is the ADD_ONION key type of v3 hidden services
+const keyType = "ED25519-V3"
+
+// Config configures a Service
+type Config struct {
+	// host:port of the Tor control port
+	ControlAddr string
+	// Password of the control port, if Tor is configured with HashedControlPassword.
+	// If empty, no authentication or the authentication cookie is used.
+	ControlPassword string
+	// File the private key of the hidden service is saved in, so that its onion address is kept across restarts
+	KeyFile string
+	// Port of the onion address
+	VirtualPort int
+	// Address connections to the onion address are forwarded to, host:port or unix:PATH
+	Target string
+	// How long to wait before connecting to the control port again after it failed or closed
+	RetryDelay time.Duration
+}
+
+// Service publishes a v3 hidden service through the Tor control port. Tor removes the hidden service when
+// the control connection closes, so it is published again with the same key when Tor restarts.
+type Service struct {
+	log       logrus.FieldLogger
+	cfg       Config
+	lock      sync.RWMutex
+	onionAddr string
+	quit      chan struct{}
+	done      chan struct{}
+}
+
+// NewService creates a Service
+func NewService(log logrus.FieldLogger, cfg Config) *Service {
+	return &Service{
+		log:  log.WithField("prefix", "tor"),
+		cfg:  cfg,
+		quit: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+}
+
+// Run publishes the hidden service until Shutdown is called.
+// If the control port fails or closes, the hidden service is published again after RetryDelay.
+func (s *Service) Run() error {
+	log := s.log.WithFields(logrus.Fields{
+		"controlAddr": s.cfg.ControlAddr,
+		"keyFile":     s.cfg.KeyFile,
+		"virtualPort": s.cfg.VirtualPort,
+		"target":      s.cfg.Target,
+	})
+	log.Info("Start tor hidden service")
+	defer log.Info("Tor hidden service closed")
+	defer close(s.done)
+
+	for {
+		err := s.publish()
+
+		select {
+		case <-s.quit:
+			return nil
+		default:
+		}
+
+		log.WithError(err).WithField("retryDelay", s.cfg.RetryDelay).Error("Tor hidden service failed, retrying")
+
+		select {
+		case <-s.quit:
+			return nil
+		case <-time.After(s.cfg.RetryDelay):
+		}
+	}
+}
+
+// Shutdown stops the Service, which closes the control connection and so removes the hidden service
+func (s *Service) Shutdown() {
+	close(s.quit)
+	<-s.done
+}
+
+// OnionAddress returns the onion address of the hidden service, or the empty string if it is not published
+func (s *Service) OnionAddress() string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.onionAddr
+}
+
+func (s *Service) setOnionAddress(addr string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.onionAddr = addr
+}
+
+// publish connects to the control port and publishes the hidden service,
+// then waits until the connection closes or Shutdown is called
+func (s *Service) publish() error {
+	c, err := dialControl(s.cfg.ControlAddr)
+	if err != nil {
+		return err
+	}
+
+	// Closing the connection on Shutdown interrupts a command or wait
+	closed := make(chan struct{})
+	defer close(closed)
+	go func() {
+		select {
+		case <-s.quit:
+		case <-closed:
+		}
+		c.Close()
+	}()
+
+	if err := c.authenticate(s.cfg.ControlPassword); err != nil {
+		return fmt.Errorf("Tor control port authentication failed: %v", err)
+	}
+
+	key, err := loadKey(s.cfg.KeyFile)
+	if err != nil {
+		return err
+	}
+
+	serviceID, newKey, err := c.addOnion(key, s.cfg.VirtualPort, s.cfg.Target)
+	if err != nil {
+		return fmt.Errorf("ADD_ONION failed: %v", err)
+	}
+
+	if key == "" {
+		if err := saveKey(s.cfg.KeyFile, newKey); err != nil {
+			return fmt.Errorf("Save hidden service key failed: %v", err)
+		}
+		s.log.WithField("keyFile", s.cfg.KeyFile).Info("Saved new hidden service key")
+	}
+
+	onionAddr := serviceID + ".onion"
+	s.setOnionAddress(onionAddr)
+	defer s.setOnionAddress("")
+
+	s.log.WithField("onionAddress", onionAddr).Info("Published tor hidden service")
+
+	return c.wait()
+}
+
+// loadKey reads the private key of the hidden service from filename, or returns the empty string if it doesn't exist
+func loadKey(filename string) (string, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+
+	key := strings.TrimSpace(string(b))
+	if !strings.HasPrefix(key, keyType+":") {
+		return "", fmt.Errorf("Invalid hidden service key in %s, expected a %s key", filename, keyType)
+	}
+
+	return key, nil
+}
+
+// saveKey writes the private key of the hidden service to filename, readable only by the owner
+func saveKey(filename, key string) error {
+	if key == "" {
+		return errors.New("Empty key")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+		return err
+	}
+
+	tmp := filename + ".tmp"
+	if err := ioutil.WriteFile(tmp, []byte(key+"\n"), 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, filename)
+}
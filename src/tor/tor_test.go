@@ -0,0 +1,223 @@
+package tor
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+const testKey = "ED25519-V3:aGVsbG8gd29ybGQ="
+
+// fakeTor is a Tor control port which accepts cookie authentication and ADD_ONION
+type fakeTor struct {
+	t          *testing.T
+	ln         net.Listener
+	cookieFile string
+	cookie     []byte
+	lock       sync.Mutex
+	conns      []net.Conn
+	published  chan string
+}
+
+func newFakeTor(t *testing.T, dir string) *fakeTor {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	f := &fakeTor{
+		t:          t,
+		ln:         ln,
+		cookieFile: filepath.Join(dir, "control auth cookie"),
+		cookie:     []byte{1, 2, 3, 4},
+		published:  make(chan string, 10),
+	}
+	require.NoError(t, ioutil.WriteFile(f.cookieFile, f.cookie, 0600))
+
+	go f.serve()
+
+	return f
+}
+
+func (f *fakeTor) serve() {
+	for {
+		conn, err := f.ln.Accept()
+		if err != nil {
+			return
+		}
+
+		f.lock.Lock()
+		f.conns = append(f.conns, conn)
+		f.lock.Unlock()
+
+		go f.handle(conn)
+	}
+}
+
+func (f *fakeTor) handle(conn net.Conn) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimSpace(line)
+
+		switch {
+		case line == "PROTOCOLINFO 1":
+			fmt.Fprintf(conn, "250-PROTOCOLINFO 1\r\n")
+			fmt.Fprintf(conn, "250-AUTH METHODS=COOKIE,SAFECOOKIE COOKIEFILE=%q\r\n", f.cookieFile)
+			fmt.Fprintf(conn, "250-VERSION Tor=\"0.4.8.9\"\r\n")
+			fmt.Fprintf(conn, "250 OK\r\n")
+
+		case line == fmt.Sprintf("AUTHENTICATE %x", f.cookie):
+			fmt.Fprintf(conn, "250 OK\r\n")
+
+		case strings.HasPrefix(line, "AUTHENTICATE"):
+			fmt.Fprintf(conn, "515 Authentication failed\r\n")
+			return
+
+		case strings.HasPrefix(line, "ADD_ONION NEW:ED25519-V3 "):
+			fmt.Fprintf(conn, "250-ServiceID=newservice\r\n")
+			fmt.Fprintf(conn, "250-PrivateKey=%s\r\n", testKey)
+			fmt.Fprintf(conn, "250 OK\r\n")
+			f.published <- line
+
+		case strings.HasPrefix(line, "ADD_ONION "+testKey+" "):
+			fmt.Fprintf(conn, "250-ServiceID=newservice\r\n")
+			fmt.Fprintf(conn, "250 OK\r\n")
+			f.published <- line
+
+		default:
+			fmt.Fprintf(conn, "510 Unrecognized command\r\n")
+		}
+	}
+}
+
+// restart closes the connections, as if Tor was restarted
+func (f *fakeTor) restart() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	for _, c := range f.conns {
+		c.Close()
+	}
+	f.conns = nil
+}
+
+func (f *fakeTor) waitPublished() string {
+	select {
+	case line := <-f.published:
+		return line
+	case <-time.After(time.Second * 5):
+		f.t.Fatal("Hidden service was not published")
+		return ""
+	}
+}
+
+func TestService(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tor")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	f := newFakeTor(t, dir)
+	defer f.ln.Close()
+
+	keyFile := filepath.Join(dir, "keys", "onion.key")
+
+	log, _ := testutil.NewLogger(t)
+	s := NewService(log, Config{
+		ControlAddr: f.ln.Addr().String(),
+		KeyFile:     keyFile,
+		VirtualPort: 80,
+		Target:      "127.0.0.1:7071",
+		RetryDelay:  time.Millisecond * 10,
+	})
+
+	errC := make(chan error, 1)
+	go func() {
+		errC <- s.Run()
+	}()
+
+	// A new key is created and saved
+	require.Equal(t, "ADD_ONION NEW:ED25519-V3 Port=80,127.0.0.1:7071", f.waitPublished())
+
+	// The key is saved before the onion address is set
+	for i := 0; s.OnionAddress() == "" && i < 500; i++ {
+		time.Sleep(time.Millisecond * 10)
+	}
+	require.Equal(t, "newservice.onion", s.OnionAddress())
+
+	b, err := ioutil.ReadFile(keyFile)
+	require.NoError(t, err)
+	require.Equal(t, testKey+"\n", string(b))
+
+	st, err := os.Stat(keyFile)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), st.Mode().Perm())
+
+	// When Tor restarts, the hidden service is published again with the saved key
+	f.restart()
+	require.Equal(t, "ADD_ONION "+testKey+" Flags=DiscardPK Port=80,127.0.0.1:7071", f.waitPublished())
+
+	s.Shutdown()
+	require.NoError(t, <-errC)
+	require.Equal(t, "", s.OnionAddress())
+}
+
+func TestServicePasswordRequired(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		if _, err := r.ReadString('\n'); err != nil {
+			return
+		}
+		fmt.Fprintf(conn, "250-PROTOCOLINFO 1\r\n250-AUTH METHODS=HASHEDPASSWORD\r\n250 OK\r\n")
+	}()
+
+	c, err := dialControl(ln.Addr().String())
+	require.NoError(t, err)
+	defer c.Close()
+
+	require.Equal(t, ErrPasswordRequired, c.authenticate(""))
+}
+
+func TestLoadKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tor")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "onion.key")
+
+	key, err := loadKey(filename)
+	require.NoError(t, err)
+	require.Equal(t, "", key)
+
+	require.NoError(t, ioutil.WriteFile(filename, []byte("RSA1024:abc\n"), 0600))
+	_, err = loadKey(filename)
+	require.Error(t, err)
+
+	require.NoError(t, saveKey(filename, testKey))
+	key, err = loadKey(filename)
+	require.NoError(t, err)
+	require.Equal(t, testKey, key)
+}
@@ -0,0 +1,111 @@
+package tracing
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/skycoin/teller/src/util/logger"
+)
+
+// TraceparentHeader is the W3C trace context header, see https://www.w3.org/TR/trace-context/
+const TraceparentHeader = "traceparent"
+
+// ParseTraceparent parses a traceparent header value, e.g. 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+func ParseTraceparent(h string) (SpanContext, error) {
+	parts := strings.Split(strings.TrimSpace(h), "-")
+	if len(parts) < 4 {
+		return SpanContext{}, fmt.Errorf("Invalid traceparent %q", h)
+	}
+
+	version, traceID, spanID, flags := parts[0], parts[1], parts[2], parts[3]
+
+	// Later versions may append fields, version 00 has exactly four
+	if len(version) != 2 || version == "ff" || (version == "00" && len(parts) != 4) {
+		return SpanContext{}, fmt.Errorf("Invalid traceparent version %q", version)
+	}
+
+	var sc SpanContext
+	if err := decodeHex(sc.TraceID[:], traceID); err != nil || !sc.TraceID.IsValid() {
+		return SpanContext{}, fmt.Errorf("Invalid traceparent trace ID %q", traceID)
+	}
+
+	if err := decodeHex(sc.SpanID[:], spanID); err != nil || !sc.SpanID.IsValid() {
+		return SpanContext{}, fmt.Errorf("Invalid traceparent parent ID %q", spanID)
+	}
+
+	var f [1]byte
+	if err := decodeHex(f[:], flags); err != nil {
+		return SpanContext{}, fmt.Errorf("Invalid traceparent flags %q", flags)
+	}
+	sc.Sampled = f[0]&1 == 1
+
+	return sc, nil
+}
+
+// decodeHex decodes lowercase hex of exactly len(dst) bytes
+func decodeHex(dst []byte, s string) error {
+	if len(s) != hex.EncodedLen(len(dst)) || strings.ToLower(s) != s {
+		return fmt.Errorf("Invalid hex %q", s)
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err
+}
+
+// Traceparent returns the traceparent header value of a span context
+func Traceparent(sc SpanContext) string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", sc.TraceID, sc.SpanID, flags)
+}
+
+// Handler traces each request as a server span named name, continuing the trace of a valid traceparent
+// request header. The span records the method, path, response status and request ID of the request,
+// so httputil.RequestIDHandler must wrap Handler. If t is nil, h is returned.
+func (t *Tracer) Handler(name string, h http.Handler) http.Handler {
+	if t == nil {
+		return h
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if sc, err := ParseTraceparent(r.Header.Get(TraceparentHeader)); err == nil {
+			ctx = ContextWithRemoteSpanContext(ctx, sc)
+		}
+
+		ctx, span := t.StartSpan(ctx, name, KindServer)
+		defer span.End()
+
+		span.SetAttribute("http.method", r.Method)
+		span.SetAttribute("http.target", r.URL.Path)
+		if id := logger.RequestIDFromContext(ctx); id != "" {
+			span.SetAttribute("http.request_id", id)
+		}
+
+		sw := &statusWriter{
+			ResponseWriter: w,
+			status:         http.StatusOK,
+		}
+
+		h.ServeHTTP(sw, r.WithContext(ctx))
+
+		span.SetAttribute("http.status_code", sw.status)
+		if sw.status >= http.StatusInternalServerError {
+			span.SetError(fmt.Errorf("HTTP status %d %s", sw.status, http.StatusText(sw.status)))
+		}
+	})
+}
+
+// Captures the response status of a http handler
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
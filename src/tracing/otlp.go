@@ -0,0 +1,220 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	exportTimeout = time.Second * 10
+	scopeName     = "github.com/skycoin/teller"
+)
+
+// OTLP status codes
+const (
+	otlpStatusUnset = 0
+	otlpStatusError = 2
+)
+
+// OTLPExporter exports spans to an OpenTelemetry collector with OTLP/HTTP, in the JSON encoding
+type OTLPExporter struct {
+	endpoint    string
+	serviceName string
+	httpClient  *http.Client
+}
+
+// NewOTLPExporter creates an OTLPExporter. endpoint is the traces URL of the collector,
+// e.g. http://127.0.0.1:4318/v1/traces. serviceName is the service.name resource attribute of the spans.
+func NewOTLPExporter(endpoint, serviceName string) *OTLPExporter {
+	return &OTLPExporter{
+		endpoint:    endpoint,
+		serviceName: serviceName,
+		httpClient: &http.Client{
+			Timeout: exportTimeout,
+		},
+	}
+}
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+}
+
+// Export sends spans to the collector
+func (e *OTLPExporter) Export(spans []SpanData) error {
+	b, err := json.Marshal(e.request(spans))
+	if err != nil {
+		return err
+	}
+
+	rsp, err := e.httpClient.Post(e.endpoint, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(io.LimitReader(rsp.Body, 512))
+		return fmt.Errorf("OTLP collector responded %s: %s", rsp.Status, strings.TrimSpace(string(body)))
+	}
+
+	return nil
+}
+
+func (e *OTLPExporter) request(spans []SpanData) otlpRequest {
+	ss := make([]otlpSpan, len(spans))
+	for i, d := range spans {
+		s := otlpSpan{
+			TraceID:           d.TraceID.String(),
+			SpanID:            d.SpanID.String(),
+			Name:              d.Name,
+			Kind:              int(d.Kind),
+			StartTimeUnixNano: strconv.FormatInt(d.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(d.End.UnixNano(), 10),
+			Status: otlpStatus{
+				Code: otlpStatusUnset,
+			},
+		}
+
+		if d.ParentID.IsValid() {
+			s.ParentSpanID = d.ParentID.String()
+		}
+
+		keys := make([]string, 0, len(d.Attributes))
+		for k := range d.Attributes {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			s.Attributes = append(s.Attributes, otlpKeyValue{
+				Key:   k,
+				Value: attributeValue(d.Attributes[k]),
+			})
+		}
+
+		if d.Error != "" {
+			s.Status = otlpStatus{
+				Code:    otlpStatusError,
+				Message: d.Error,
+			}
+		}
+
+		ss[i] = s
+	}
+
+	return otlpRequest{
+		ResourceSpans: []otlpResourceSpans{
+			{
+				Resource: otlpResource{
+					Attributes: []otlpKeyValue{
+						{
+							Key:   "service.name",
+							Value: attributeValue(e.serviceName),
+						},
+					},
+				},
+				ScopeSpans: []otlpScopeSpans{
+					{
+						Scope: otlpScope{
+							Name: scopeName,
+						},
+						Spans: ss,
+					},
+				},
+			},
+		},
+	}
+}
+
+// attributeValue returns the OTLP value of an attribute.
+// Values other than strings, integers, floats and booleans are formatted as strings.
+func attributeValue(v interface{}) otlpValue {
+	var i int64
+	switch v := v.(type) {
+	case string:
+		return otlpValue{StringValue: &v}
+	case bool:
+		return otlpValue{BoolValue: &v}
+	case float32:
+		f := float64(v)
+		return otlpValue{DoubleValue: &f}
+	case float64:
+		return otlpValue{DoubleValue: &v}
+	case int:
+		i = int64(v)
+	case int32:
+		i = int64(v)
+	case int64:
+		i = v
+	case uint32:
+		i = int64(v)
+	case uint64:
+		if v > math.MaxInt64 {
+			s := strconv.FormatUint(v, 10)
+			return otlpValue{StringValue: &s}
+		}
+		i = int64(v)
+	default:
+		s := fmt.Sprint(v)
+		return otlpValue{StringValue: &s}
+	}
+
+	s := strconv.FormatInt(i, 10)
+	return otlpValue{IntValue: &s}
+}
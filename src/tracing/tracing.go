@@ -0,0 +1,429 @@
+// Package tracing traces API requests and deposits as spans, which are exported to an
+// OpenTelemetry collector with OTLP/HTTP, e.g. Jaeger or Tempo.
+// Traces are propagated from and to other services with the W3C traceparent header.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	exportPeriod = time.Second * 5
+	flushTimeout = time.Second * 5
+	batchSize    = 512
+	queueSize    = 2048
+)
+
+// TraceID identifies a trace
+type TraceID [16]byte
+
+// String returns the hex encoding of the ID
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// IsValid returns false for the all zero ID
+func (id TraceID) IsValid() bool {
+	return id != TraceID{}
+}
+
+// SpanID identifies a span of a trace
+type SpanID [8]byte
+
+// String returns the hex encoding of the ID
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// IsValid returns false for the all zero ID
+func (id SpanID) IsValid() bool {
+	return id != SpanID{}
+}
+
+// SpanContext is the part of a span that is propagated to its children
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// IsValid returns true if the trace ID and span ID are valid
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// DepositTraceID returns the ID of the trace of a deposit, derived from the deposit ID,
+// so that all the state transitions of a deposit are spans of one trace
+func DepositTraceID(depositID string) TraceID {
+	var id TraceID
+	h := sha256.Sum256([]byte(depositID))
+	copy(id[:], h[:])
+	return id
+}
+
+// Kind is the kind of a span
+type Kind int
+
+const (
+	// KindInternal is a span of an operation within teller
+	KindInternal Kind = iota + 1
+	// KindServer is a span of a request served by teller
+	KindServer
+	// KindClient is a span of a request teller makes to another service, e.g. the skycoin node
+	KindClient
+)
+
+// Span is a timed operation of a trace. A nil *Span is valid and records nothing.
+type Span struct {
+	tracer   *Tracer
+	ctx      SpanContext
+	parentID SpanID
+	name     string
+	kind     Kind
+	start    time.Time
+
+	lock       sync.Mutex
+	end        time.Time
+	attributes map[string]interface{}
+	err        error
+	ended      bool
+}
+
+// SpanContext returns the SpanContext of the span
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.ctx
+}
+
+// SetAttribute sets an attribute of the span. Values other than strings, integers, floats and booleans are formatted as strings.
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.attributes[key] = value
+}
+
+// SetError marks the span failed with err, if err is not nil
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.err = err
+}
+
+// End ends the span, queueing it to be exported if it is sampled. Ending a span again does nothing.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+
+	s.lock.Lock()
+	if s.ended {
+		s.lock.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	data := s.data()
+	s.lock.Unlock()
+
+	if s.ctx.Sampled {
+		s.tracer.export(data)
+	}
+}
+
+// data returns the SpanData of an ended span. The caller holds s.lock.
+func (s *Span) data() SpanData {
+	attributes := make(map[string]interface{}, len(s.attributes))
+	for k, v := range s.attributes {
+		attributes[k] = v
+	}
+
+	d := SpanData{
+		TraceID:    s.ctx.TraceID,
+		SpanID:     s.ctx.SpanID,
+		ParentID:   s.parentID,
+		Name:       s.name,
+		Kind:       s.kind,
+		Start:      s.start,
+		End:        s.end,
+		Attributes: attributes,
+	}
+
+	if s.err != nil {
+		d.Error = s.err.Error()
+	}
+
+	return d
+}
+
+// SpanData is an ended span, as it is exported
+type SpanData struct {
+	TraceID    TraceID
+	SpanID     SpanID
+	ParentID   SpanID // zero for the root span of a trace
+	Name       string
+	Kind       Kind
+	Start      time.Time
+	End        time.Time
+	Attributes map[string]interface{}
+	Error      string // empty if the span succeeded
+}
+
+// Exporter exports ended spans
+type Exporter interface {
+	Export(spans []SpanData) error
+}
+
+// Config configures a Tracer
+type Config struct {
+	// Ratio of the traces that are sampled, between 0 and 1. Traces propagated
+	// with a traceparent header keep the sampling decision of the caller.
+	SampleRatio float64
+}
+
+// Validate returns an error if the configuration is invalid
+func (c Config) Validate() error {
+	if c.SampleRatio < 0 || c.SampleRatio > 1 {
+		return errors.New("SampleRatio must be between 0 and 1")
+	}
+	return nil
+}
+
+// Tracer starts spans and exports them in the background. Ended spans are queued and
+// exported in batches by Run, so that ending a span never blocks.
+// A nil *Tracer is valid and starts nil spans.
+type Tracer struct {
+	log      logrus.FieldLogger
+	cfg      Config
+	exporter Exporter
+	spans    chan SpanData
+	quit     chan struct{}
+	done     chan struct{}
+}
+
+// NewTracer creates a Tracer
+func NewTracer(log logrus.FieldLogger, exporter Exporter, cfg Config) (*Tracer, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &Tracer{
+		log:      log.WithField("prefix", "tracing.tracer"),
+		cfg:      cfg,
+		exporter: exporter,
+		spans:    make(chan SpanData, queueSize),
+		quit:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}, nil
+}
+
+// Run exports the ended spans until Shutdown is called
+func (t *Tracer) Run() error {
+	log := t.log
+	log.Info("Start tracer")
+	defer log.Info("Tracer closed")
+	defer close(t.done)
+
+	ticker := time.NewTicker(exportPeriod)
+	defer ticker.Stop()
+
+	var batch []SpanData
+	for {
+		select {
+		case <-t.quit:
+			t.flush(batch)
+			return nil
+		case <-ticker.C:
+			t.exportLogged(batch)
+			batch = nil
+		case d := <-t.spans:
+			batch = append(batch, d)
+			if len(batch) >= batchSize {
+				t.exportLogged(batch)
+				batch = nil
+			}
+		}
+	}
+}
+
+// Shutdown stops the Tracer, after exporting the queued spans for up to 5 seconds
+func (t *Tracer) Shutdown() {
+	close(t.quit)
+	<-t.done
+}
+
+// flush exports batch and the queued spans, until the queue is empty or flushTimeout elapsed
+func (t *Tracer) flush(batch []SpanData) {
+	timeout := time.After(flushTimeout)
+	for {
+		select {
+		case d := <-t.spans:
+			batch = append(batch, d)
+			if len(batch) >= batchSize {
+				t.exportLogged(batch)
+				batch = nil
+			}
+		case <-timeout:
+			t.log.WithField("queued", len(t.spans)).Warning("Tracer flush timed out, dropping queued spans")
+			return
+		default:
+			t.exportLogged(batch)
+			return
+		}
+	}
+}
+
+// exportLogged exports a batch of spans, logging a failure
+func (t *Tracer) exportLogged(batch []SpanData) {
+	if len(batch) == 0 {
+		return
+	}
+
+	if err := t.exporter.Export(batch); err != nil {
+		t.log.WithError(err).WithField("spans", len(batch)).Warning("Export spans failed")
+	}
+}
+
+// export queues an ended span to be exported. The span is dropped if the queue is full.
+func (t *Tracer) export(d SpanData) {
+	select {
+	case t.spans <- d:
+	default:
+		t.log.WithField("span", d.Name).Warning("Span queue is full, dropping span")
+	}
+}
+
+// StartSpan starts a span. It is a child of the span of ctx, or of the remote span of ctx,
+// see ContextWithRemoteSpanContext. Otherwise it is the root span of a new trace.
+// The returned context carries the span, see SpanFromContext.
+func (t *Tracer) StartSpan(ctx context.Context, name string, kind Kind) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+
+	parent := SpanFromContext(ctx).SpanContext()
+	if !parent.IsValid() {
+		parent = remoteSpanContextFromContext(ctx)
+	}
+
+	if parent.IsValid() {
+		return t.startSpan(ctx, parent.TraceID, parent.SpanID, parent.Sampled, name, kind)
+	}
+
+	traceID := newTraceID()
+	return t.startSpan(ctx, traceID, SpanID{}, t.sampled(traceID), name, kind)
+}
+
+// StartDepositSpan starts a root span in the trace of a deposit, see DepositTraceID
+func (t *Tracer) StartDepositSpan(ctx context.Context, depositID, name string) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+
+	traceID := DepositTraceID(depositID)
+	ctx, span := t.startSpan(ctx, traceID, SpanID{}, t.sampled(traceID), name, KindInternal)
+	span.SetAttribute("deposit.id", depositID)
+	return ctx, span
+}
+
+func (t *Tracer) startSpan(ctx context.Context, traceID TraceID, parentID SpanID, sampled bool, name string, kind Kind) (context.Context, *Span) {
+	span := &Span{
+		tracer: t,
+		ctx: SpanContext{
+			TraceID: traceID,
+			SpanID:  newSpanID(),
+			Sampled: sampled,
+		},
+		parentID:   parentID,
+		name:       name,
+		kind:       kind,
+		start:      time.Now(),
+		attributes: make(map[string]interface{}),
+	}
+
+	return context.WithValue(ctx, spanCtxKey, span), span
+}
+
+// sampled returns the sampling decision of a new trace. It only depends on the trace ID,
+// so that the spans of a deposit's trace are either all sampled or not.
+func (t *Tracer) sampled(traceID TraceID) bool {
+	if t.cfg.SampleRatio >= 1 {
+		return true
+	}
+
+	// Like the TraceIDRatioBased sampler of OpenTelemetry
+	bound := uint64(t.cfg.SampleRatio * (1 << 63))
+	return binary.BigEndian.Uint64(traceID[8:])>>1 < bound
+}
+
+// StartSpan starts a child span of the span of ctx. If ctx has no span, e.g. if tracing is disabled,
+// it returns a nil span, which records nothing.
+func StartSpan(ctx context.Context, name string, kind Kind) (context.Context, *Span) {
+	parent := SpanFromContext(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+
+	return parent.tracer.startSpan(ctx, parent.ctx.TraceID, parent.ctx.SpanID, parent.ctx.Sampled, name, kind)
+}
+
+type ctxKey int
+
+const (
+	spanCtxKey ctxKey = iota
+	remoteSpanCtxKey
+)
+
+// SpanFromContext returns the span of a context, or nil if it has none
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanCtxKey).(*Span)
+	return span
+}
+
+// ContextWithRemoteSpanContext puts the span context of a caller into a context,
+// which the next span started by Tracer.StartSpan is a child of
+func ContextWithRemoteSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteSpanCtxKey, sc)
+}
+
+func remoteSpanContextFromContext(ctx context.Context) SpanContext {
+	sc, _ := ctx.Value(remoteSpanCtxKey).(SpanContext)
+	return sc
+}
+
+func newTraceID() TraceID {
+	var id TraceID
+	randRead(id[:])
+	return id
+}
+
+func newSpanID() SpanID {
+	var id SpanID
+	randRead(id[:])
+	return id
+}
+
+func randRead(b []byte) {
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Errorf("crypto/rand.Read failed: %v", err))
+	}
+}
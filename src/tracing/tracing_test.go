@@ -0,0 +1,366 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/util/httputil"
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+type fakeExporter struct {
+	spans []SpanData
+	sync.Mutex
+}
+
+func (f *fakeExporter) Export(spans []SpanData) error {
+	f.Lock()
+	defer f.Unlock()
+	f.spans = append(f.spans, spans...)
+	return nil
+}
+
+func (f *fakeExporter) getSpans() []SpanData {
+	f.Lock()
+	defer f.Unlock()
+	return append([]SpanData{}, f.spans...)
+}
+
+func newTestTracer(t *testing.T, sampleRatio float64) (*Tracer, *fakeExporter, func()) {
+	log, _ := testutil.NewLogger(t)
+	exporter := &fakeExporter{}
+	tracer, err := NewTracer(log, exporter, Config{
+		SampleRatio: sampleRatio,
+	})
+	require.NoError(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		require.NoError(t, tracer.Run())
+	}()
+
+	return tracer, exporter, func() {
+		tracer.Shutdown()
+		<-done
+	}
+}
+
+func TestParseTraceparent(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		h       string
+		sampled bool
+		err     bool
+	}{
+		{
+			name:    "sampled",
+			h:       "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			sampled: true,
+		},
+		{
+			name: "not sampled",
+			h:    "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00",
+		},
+		{
+			name:    "later version with more fields",
+			h:       "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+			sampled: true,
+		},
+		{
+			name: "version 00 with more fields",
+			h:    "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+			err:  true,
+		},
+		{
+			name: "version ff",
+			h:    "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			err:  true,
+		},
+		{
+			name: "zero trace ID",
+			h:    "00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+			err:  true,
+		},
+		{
+			name: "zero parent ID",
+			h:    "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+			err:  true,
+		},
+		{
+			name: "uppercase",
+			h:    "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+			err:  true,
+		},
+		{
+			name: "short trace ID",
+			h:    "00-4bf92f3577b34da6-00f067aa0ba902b7-01",
+			err:  true,
+		},
+		{
+			name: "empty",
+			err:  true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			sc, err := ParseTraceparent(tc.h)
+			if tc.err {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID.String())
+			require.Equal(t, "00f067aa0ba902b7", sc.SpanID.String())
+			require.Equal(t, tc.sampled, sc.Sampled)
+
+			if tc.h[:2] == "00" {
+				require.Equal(t, tc.h, Traceparent(sc))
+			}
+		})
+	}
+}
+
+func TestSpans(t *testing.T) {
+	tracer, exporter, shutdown := newTestTracer(t, 1)
+
+	ctx, root := tracer.StartSpan(context.Background(), "root", KindInternal)
+	require.Equal(t, root, SpanFromContext(ctx))
+	root.SetAttribute("deposit.id", "btx1:0")
+
+	_, child := StartSpan(ctx, "child", KindClient)
+	child.SetError(errors.New("rpc failed"))
+	child.End()
+	root.End()
+
+	// Ending a span again does nothing
+	root.End()
+
+	// Without a span in the context, StartSpan returns a nil span, which records nothing
+	nctx, span := StartSpan(context.Background(), "orphan", KindInternal)
+	require.Nil(t, span)
+	require.Equal(t, context.Background(), nctx)
+	span.SetAttribute("a", 1)
+	span.SetError(errors.New("failed"))
+	span.End()
+
+	// A nil tracer starts nil spans
+	var nilTracer *Tracer
+	_, span = nilTracer.StartSpan(context.Background(), "disabled", KindInternal)
+	require.Nil(t, span)
+	_, span = nilTracer.StartDepositSpan(context.Background(), "btx1:0", "disabled")
+	require.Nil(t, span)
+
+	shutdown()
+
+	spans := exporter.getSpans()
+	require.Len(t, spans, 2)
+
+	require.Equal(t, "child", spans[0].Name)
+	require.Equal(t, KindClient, spans[0].Kind)
+	require.Equal(t, root.SpanContext().TraceID, spans[0].TraceID)
+	require.Equal(t, root.SpanContext().SpanID, spans[0].ParentID)
+	require.Equal(t, "rpc failed", spans[0].Error)
+
+	require.Equal(t, "root", spans[1].Name)
+	require.False(t, spans[1].ParentID.IsValid())
+	require.Equal(t, map[string]interface{}{"deposit.id": "btx1:0"}, spans[1].Attributes)
+	require.Empty(t, spans[1].Error)
+	require.False(t, spans[1].End.Before(spans[1].Start))
+}
+
+func TestDepositSpans(t *testing.T) {
+	tracer, exporter, shutdown := newTestTracer(t, 1)
+
+	// The spans of a deposit are in one trace, derived from the deposit ID
+	_, s1 := tracer.StartDepositSpan(context.Background(), "btx1:0", "exchange.saveIncomingDeposit")
+	s1.End()
+	_, s2 := tracer.StartDepositSpan(context.Background(), "btx1:0", "exchange.handleDepositInfoState")
+	s2.End()
+	_, s3 := tracer.StartDepositSpan(context.Background(), "btx2:0", "exchange.handleDepositInfoState")
+	s3.End()
+
+	require.Equal(t, DepositTraceID("btx1:0"), s1.SpanContext().TraceID)
+	require.Equal(t, s1.SpanContext().TraceID, s2.SpanContext().TraceID)
+	require.NotEqual(t, s1.SpanContext().SpanID, s2.SpanContext().SpanID)
+	require.NotEqual(t, s1.SpanContext().TraceID, s3.SpanContext().TraceID)
+
+	shutdown()
+
+	spans := exporter.getSpans()
+	require.Len(t, spans, 3)
+	require.Equal(t, "btx1:0", spans[0].Attributes["deposit.id"])
+}
+
+func TestSampling(t *testing.T) {
+	tracer, exporter, shutdown := newTestTracer(t, 0)
+
+	// Traces are not sampled with a 0 ratio, but their context is still propagated
+	ctx, span := tracer.StartSpan(context.Background(), "root", KindInternal)
+	require.False(t, span.SpanContext().Sampled)
+	require.True(t, span.SpanContext().IsValid())
+	_, child := StartSpan(ctx, "child", KindInternal)
+	require.False(t, child.SpanContext().Sampled)
+	child.End()
+	span.End()
+
+	// A remote parent's sampling decision is kept
+	remote, err := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	require.NoError(t, err)
+	_, span = tracer.StartSpan(ContextWithRemoteSpanContext(context.Background(), remote), "server", KindServer)
+	require.True(t, span.SpanContext().Sampled)
+	span.End()
+
+	shutdown()
+
+	spans := exporter.getSpans()
+	require.Len(t, spans, 1)
+	require.Equal(t, "server", spans[0].Name)
+	require.Equal(t, remote.TraceID, spans[0].TraceID)
+	require.Equal(t, remote.SpanID, spans[0].ParentID)
+
+	// The decision only depends on the trace ID
+	tracer, err = NewTracer(tracer.log, exporter, Config{
+		SampleRatio: 0.5,
+	})
+	require.NoError(t, err)
+	sampled := 0
+	for i := 0; i < 1000; i++ {
+		traceID := newTraceID()
+		require.Equal(t, tracer.sampled(traceID), tracer.sampled(traceID))
+		if tracer.sampled(traceID) {
+			sampled++
+		}
+	}
+	require.InDelta(t, 500, sampled, 100)
+
+	_, err = NewTracer(tracer.log, exporter, Config{
+		SampleRatio: 1.5,
+	})
+	require.Error(t, err)
+}
+
+func TestHandler(t *testing.T) {
+	tracer, exporter, shutdown := newTestTracer(t, 1)
+
+	h := httputil.RequestIDHandler(tracer.Handler("/api/bind", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, span := StartSpan(r.Context(), "teller.Service.BindAddress", KindInternal)
+		span.End()
+
+		if r.URL.Query().Get("fail") != "" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	})))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/bind", nil)
+	req.Header.Set(httputil.RequestIDHeader, "abc-123")
+	req.Header.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	req = httptest.NewRequest(http.MethodPost, "/api/bind?fail=1", nil)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	shutdown()
+
+	spans := exporter.getSpans()
+	require.Len(t, spans, 4)
+
+	// The request continues the caller's trace
+	require.Equal(t, "teller.Service.BindAddress", spans[0].Name)
+	require.Equal(t, spans[1].SpanID, spans[0].ParentID)
+	require.Equal(t, "/api/bind", spans[1].Name)
+	require.Equal(t, KindServer, spans[1].Kind)
+	require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[1].TraceID.String())
+	require.Equal(t, "00f067aa0ba902b7", spans[1].ParentID.String())
+	require.Equal(t, map[string]interface{}{
+		"http.method":      http.MethodPost,
+		"http.target":      "/api/bind",
+		"http.request_id":  "abc-123",
+		"http.status_code": http.StatusOK,
+	}, spans[1].Attributes)
+	require.Empty(t, spans[1].Error)
+
+	// Without a traceparent header, the request starts a trace. A 5xx response fails the span.
+	require.False(t, spans[3].ParentID.IsValid())
+	require.NotEqual(t, spans[1].TraceID, spans[3].TraceID)
+	require.Equal(t, http.StatusInternalServerError, spans[3].Attributes["http.status_code"])
+	require.Equal(t, "HTTP status 500 Internal Server Error", spans[3].Error)
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var req otlpRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/v1/traces", r.URL.Path)
+		require.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+	}))
+	defer srv.Close()
+
+	start := time.Unix(1500000000, 0)
+	d := SpanData{
+		TraceID:  DepositTraceID("btx1:0"),
+		SpanID:   SpanID{1, 2, 3, 4, 5, 6, 7, 8},
+		ParentID: SpanID{8, 7, 6, 5, 4, 3, 2, 1},
+		Name:     "sender.BroadcastTransaction",
+		Kind:     KindClient,
+		Start:    start,
+		End:      start.Add(time.Millisecond),
+		Attributes: map[string]interface{}{
+			"skycoin.txid":      "abc",
+			"skycoin.droplets":  uint64(1e6),
+			"skycoin.confirmed": true,
+			"batch.ratio":       0.5,
+			"deposit.status":    struct{ Seq int }{1},
+		},
+		Error: "broadcast failed",
+	}
+
+	e := NewOTLPExporter(srv.URL+"/v1/traces", "teller")
+	require.NoError(t, e.Export([]SpanData{d}))
+
+	require.Len(t, req.ResourceSpans, 1)
+	rs := req.ResourceSpans[0]
+	require.Equal(t, "service.name", rs.Resource.Attributes[0].Key)
+	require.Equal(t, "teller", *rs.Resource.Attributes[0].Value.StringValue)
+	require.Len(t, rs.ScopeSpans, 1)
+	require.Len(t, rs.ScopeSpans[0].Spans, 1)
+
+	s := rs.ScopeSpans[0].Spans[0]
+	require.Equal(t, d.TraceID.String(), s.TraceID)
+	require.Equal(t, "0102030405060708", s.SpanID)
+	require.Equal(t, "0807060504030201", s.ParentSpanID)
+	require.Equal(t, "sender.BroadcastTransaction", s.Name)
+	require.Equal(t, 3, s.Kind)
+	require.Equal(t, "1500000000000000000", s.StartTimeUnixNano)
+	require.Equal(t, "1500000000001000000", s.EndTimeUnixNano)
+	require.Equal(t, otlpStatus{Code: otlpStatusError, Message: "broadcast failed"}, s.Status)
+
+	// Attributes are sorted by key
+	require.Len(t, s.Attributes, 5)
+	require.Equal(t, "batch.ratio", s.Attributes[0].Key)
+	require.Equal(t, 0.5, *s.Attributes[0].Value.DoubleValue)
+	require.Equal(t, "deposit.status", s.Attributes[1].Key)
+	require.Equal(t, "{1}", *s.Attributes[1].Value.StringValue)
+	require.Equal(t, "skycoin.confirmed", s.Attributes[2].Key)
+	require.True(t, *s.Attributes[2].Value.BoolValue)
+	require.Equal(t, "skycoin.droplets", s.Attributes[3].Key)
+	require.Equal(t, "1000000", *s.Attributes[3].Value.IntValue)
+	require.Equal(t, "skycoin.txid", s.Attributes[4].Key)
+	require.Equal(t, "abc", *s.Attributes[4].Value.StringValue)
+
+	// A collector error is returned
+	srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	})
+	err := e.Export([]SpanData{d})
+	require.Error(t, err)
+	require.Equal(t, "OTLP collector responded 503 Service Unavailable: unavailable", err.Error())
+}
@@ -0,0 +1,205 @@
+// Package bech32util decodes and encodes BIP173 bech32 strings and segwit addresses.
+// The vendored btcutil predates bech32, so segwit addresses are handled here.
+package bech32util
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+var charsetRev = func() [128]int8 {
+	var r [128]int8
+	for i := range r {
+		r[i] = -1
+	}
+	for i, c := range charset {
+		r[c] = int8(i)
+	}
+	return r
+}()
+
+var generator = [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+
+func polymod(values []byte) uint32 {
+	chk := uint32(1)
+	for _, v := range values {
+		b := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (b>>uint(i))&1 == 1 {
+				chk ^= generator[i]
+			}
+		}
+	}
+	return chk
+}
+
+func hrpExpand(hrp string) []byte {
+	r := make([]byte, 0, len(hrp)*2+1)
+	for i := 0; i < len(hrp); i++ {
+		r = append(r, hrp[i]>>5)
+	}
+	r = append(r, 0)
+	for i := 0; i < len(hrp); i++ {
+		r = append(r, hrp[i]&31)
+	}
+	return r
+}
+
+func createChecksum(hrp string, data []byte) []byte {
+	values := append(hrpExpand(hrp), data...)
+	values = append(values, 0, 0, 0, 0, 0, 0)
+	mod := polymod(values) ^ 1
+	r := make([]byte, 6)
+	for i := range r {
+		r[i] = byte(mod>>uint(5*(5-i))) & 31
+	}
+	return r
+}
+
+// Decode decodes a bech32 string into its lowercase human readable part and its 5 bit data values,
+// without the checksum
+func Decode(s string) (string, []byte, error) {
+	if len(s) > 90 {
+		return "", nil, errors.New("Invalid bech32 string length")
+	}
+
+	if strings.ToLower(s) != s && strings.ToUpper(s) != s {
+		return "", nil, errors.New("Mixed case bech32 string")
+	}
+	s = strings.ToLower(s)
+
+	pos := strings.LastIndexByte(s, '1')
+	if pos < 1 || pos+7 > len(s) {
+		return "", nil, errors.New("Invalid bech32 separator position")
+	}
+
+	hrp := s[:pos]
+	for i := 0; i < len(hrp); i++ {
+		if hrp[i] < 33 || hrp[i] > 126 {
+			return "", nil, errors.New("Invalid bech32 human readable part")
+		}
+	}
+
+	data := make([]byte, 0, len(s)-pos-1)
+	for i := pos + 1; i < len(s); i++ {
+		c := s[i]
+		if c >= 128 || charsetRev[c] == -1 {
+			return "", nil, fmt.Errorf("Invalid bech32 character %q", c)
+		}
+		data = append(data, byte(charsetRev[c]))
+	}
+
+	if polymod(append(hrpExpand(hrp), data...)) != 1 {
+		return "", nil, errors.New("Invalid bech32 checksum")
+	}
+
+	return hrp, data[:len(data)-6], nil
+}
+
+// Encode encodes a human readable part and 5 bit data values into a lowercase bech32 string
+func Encode(hrp string, data []byte) (string, error) {
+	hrp = strings.ToLower(hrp)
+	if len(hrp)+len(data)+7 > 90 {
+		return "", errors.New("Invalid bech32 string length")
+	}
+
+	for _, v := range data {
+		if v > 31 {
+			return "", errors.New("Invalid bech32 data value")
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(hrp)
+	b.WriteByte('1')
+	for _, v := range data {
+		b.WriteByte(charset[v])
+	}
+	for _, v := range createChecksum(hrp, data) {
+		b.WriteByte(charset[v])
+	}
+
+	return b.String(), nil
+}
+
+// ConvertBits regroups data from fromBits bit values to toBits bit values.
+// If pad is false, leftover bits must be zero padding of less than fromBits bits.
+func ConvertBits(data []byte, fromBits, toBits uint, pad bool) ([]byte, error) {
+	var acc uint32
+	var bits uint
+	maxv := uint32(1)<<toBits - 1
+	r := make([]byte, 0, len(data)*int(fromBits)/int(toBits)+1)
+
+	for _, v := range data {
+		if uint32(v)>>fromBits != 0 {
+			return nil, errors.New("Invalid data value")
+		}
+		acc = acc<<fromBits | uint32(v)
+		bits += fromBits
+		for bits >= toBits {
+			bits -= toBits
+			r = append(r, byte(acc>>bits&maxv))
+		}
+	}
+
+	if pad {
+		if bits > 0 {
+			r = append(r, byte(acc<<(toBits-bits)&maxv))
+		}
+	} else if bits >= fromBits || acc<<(toBits-bits)&maxv != 0 {
+		return nil, errors.New("Invalid padding")
+	}
+
+	return r, nil
+}
+
+// DecodeSegWitAddress decodes a version 0 segwit address with the human readable part hrp,
+// returning its witness program. Later witness versions use BIP350 bech32m checksums and are not supported.
+func DecodeSegWitAddress(hrp, addr string) ([]byte, error) {
+	h, data, err := Decode(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if h != hrp {
+		return nil, fmt.Errorf("Invalid human readable part %q", h)
+	}
+
+	if len(data) < 1 {
+		return nil, errors.New("Missing witness version")
+	}
+
+	if data[0] != 0 {
+		return nil, fmt.Errorf("Unsupported witness version %d", data[0])
+	}
+
+	program, err := ConvertBits(data[1:], 5, 8, false)
+	if err != nil {
+		return nil, err
+	}
+
+	// P2WPKH programs are 20 byte pubkey hashes, P2WSH programs are 32 byte script hashes
+	if len(program) != 20 && len(program) != 32 {
+		return nil, errors.New("Invalid witness program length")
+	}
+
+	return program, nil
+}
+
+// EncodeSegWitAddress encodes a version 0 witness program into a segwit address
+func EncodeSegWitAddress(hrp string, program []byte) (string, error) {
+	if len(program) != 20 && len(program) != 32 {
+		return "", errors.New("Invalid witness program length")
+	}
+
+	data, err := ConvertBits(program, 8, 5, true)
+	if err != nil {
+		return "", err
+	}
+
+	return Encode(hrp, append([]byte{0}, data...))
+}
@@ -0,0 +1,105 @@
+package bech32util
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeSegWitAddress(t *testing.T) {
+	// Test vectors from BIP173
+	cases := []struct {
+		hrp     string
+		addr    string
+		program string
+		err     error
+	}{
+		{
+			hrp:     "bc",
+			addr:    "BC1QW508D6QEJXTDG4Y5R3ZARVARY0C5XW7KV8F3T4",
+			program: "751e76e8199196d454941c45d1b3a323f1433bd6",
+		},
+		{
+			hrp:     "tb",
+			addr:    "tb1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3q0sl5k7",
+			program: "1863143c14c5166804bd19203356da136c985678cd4d27a1b8c6329604903262",
+		},
+		{
+			hrp:     "tb",
+			addr:    "tb1qqqqqp399et2xygdj5xreqhjjvcmzhxw4aywxecjdzew6hylgvsesrxh6hy",
+			program: "000000c4a5cad46221b2a187905e5266362b99d5e91c6ce24d165dab93e86433",
+		},
+		{
+			hrp:  "bc",
+			addr: "tb1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3q0sl5k7",
+			err:  errors.New(`Invalid human readable part "tb"`),
+		},
+		{
+			hrp:  "bc",
+			addr: "bc1zw508d6qejxtdg4y5r3zarvaryvqyzf3du",
+			err:  errors.New("Unsupported witness version 2"),
+		},
+		{
+			hrp:  "bc",
+			addr: "BC1QR508D6QEJXTDG4Y5R3ZARVARYV98GJ9P",
+			err:  errors.New("Invalid witness program length"),
+		},
+		{
+			hrp:  "tb",
+			addr: "tb1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3q0sL5k7",
+			err:  errors.New("Mixed case bech32 string"),
+		},
+		{
+			hrp:  "bc",
+			addr: "bc1zw508d6qejxtdg4y5r3zarvaryvqyzf3du1",
+			err:  errors.New("Invalid bech32 separator position"),
+		},
+		{
+			hrp:  "bc",
+			addr: "bc1gmk9yu",
+			err:  errors.New("Missing witness version"),
+		},
+		{
+			hrp:  "tb",
+			addr: "tb1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3pjxtptv",
+			err:  errors.New("Invalid padding"),
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.addr, func(t *testing.T) {
+			program, err := DecodeSegWitAddress(tc.hrp, tc.addr)
+			if tc.err != nil {
+				require.Equal(t, tc.err, err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tc.program, hex.EncodeToString(program))
+
+			addr, err := EncodeSegWitAddress(tc.hrp, program)
+			require.NoError(t, err)
+			require.Equal(t, strings.ToLower(tc.addr), addr)
+		})
+	}
+}
+
+func TestEncode(t *testing.T) {
+	_, err := Encode("bc", []byte{32})
+	require.Equal(t, errors.New("Invalid bech32 data value"), err)
+
+	_, err = EncodeSegWitAddress("bc", make([]byte, 21))
+	require.Equal(t, errors.New("Invalid witness program length"), err)
+
+	s, err := Encode("a", nil)
+	require.NoError(t, err)
+	require.Equal(t, "a12uel5l", s)
+
+	hrp, data, err := Decode("A12UEL5L")
+	require.NoError(t, err)
+	require.Equal(t, "a", hrp)
+	require.Empty(t, data)
+}
@@ -0,0 +1,339 @@
+// Package compact copies the bolt db into a new file without its free pages, and swaps the copy in
+// at a point where nothing writes to the db.
+// Bolt never shrinks its file, so a long-running teller's db grows to the largest size it ever had.
+package compact
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// Suffix of the compacted db waiting to be swapped in, next to the db
+	pendingSuffix = ".compact"
+	// Suffix of the Result of the pending compaction
+	resultSuffix = ".compact.json"
+	// Suffix of the db replaced by the compacted db
+	backupSuffix = ".bak"
+	// Size of the writes committed at once to the compacted db
+	txMaxSize = 64 * 1024 * 1024
+)
+
+// ErrCompactionInProgress is returned if a compaction is requested while one is running
+var ErrCompactionInProgress = errors.New("Compaction already in progress")
+
+// Result describes a compaction
+type Result struct {
+	// ID of the last transaction written to the db when it was copied
+	TxID          int       `json:"tx_id"`
+	DBSize        int64     `json:"db_size"`
+	CompactedSize int64     `json:"compacted_size"`
+	CompactedAt   time.Time `json:"compacted_at"`
+}
+
+// PendingPath returns the path of the compacted db waiting to be swapped in for the db at dbPath
+func PendingPath(dbPath string) string {
+	return dbPath + pendingSuffix
+}
+
+// BackupPath returns the path the db at dbPath is kept at when the compacted db is swapped in
+func BackupPath(dbPath string) string {
+	return dbPath + backupSuffix
+}
+
+// Compact copies db into a new db at path, bucket by bucket, from a single read transaction.
+// Teller keeps writing to db meanwhile, those writes are not in the copy.
+func Compact(db *bolt.DB, path string) (Result, error) {
+	tmp := path + ".tmp"
+	if err := os.Remove(tmp); err != nil && !os.IsNotExist(err) {
+		return Result{}, err
+	}
+
+	dst, err := bolt.Open(tmp, 0700, nil)
+	if err != nil {
+		return Result{}, err
+	}
+
+	var res Result
+	if err := db.View(func(tx *bolt.Tx) error {
+		fi, err := os.Stat(db.Path())
+		if err != nil {
+			return err
+		}
+
+		res.TxID = tx.ID()
+		res.DBSize = fi.Size()
+		return copyTx(dst, tx)
+	}); err != nil {
+		dst.Close()
+		os.Remove(tmp)
+		return Result{}, err
+	}
+
+	// bolt syncs each commit, the copy is on disk once dst is closed
+	if err := dst.Close(); err != nil {
+		os.Remove(tmp)
+		return Result{}, err
+	}
+
+	fi, err := os.Stat(tmp)
+	if err != nil {
+		os.Remove(tmp)
+		return Result{}, err
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return Result{}, err
+	}
+
+	res.CompactedSize = fi.Size()
+	res.CompactedAt = time.Now().UTC()
+
+	return res, nil
+}
+
+// copyTx copies every bucket of tx into dst, committing about every txMaxSize bytes.
+// Committing reopens the buckets being written to, which are found again by their path of names.
+func copyTx(dst *bolt.DB, tx *bolt.Tx) error {
+	dtx, err := dst.Begin(true)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		dtx.Rollback()
+	}()
+
+	var size int64
+	var copyBucket func(path [][]byte, b *bolt.Bucket) error
+	copyBucket = func(path [][]byte, b *bolt.Bucket) error {
+		if err := createBucket(dtx, path, b.Sequence()); err != nil {
+			return err
+		}
+
+		return b.ForEach(func(k, v []byte) error {
+			if size > txMaxSize {
+				if err := dtx.Commit(); err != nil {
+					return err
+				}
+
+				dtx, err = dst.Begin(true)
+				if err != nil {
+					return err
+				}
+
+				size = 0
+			}
+
+			// The path is copied, since the slices of the nested buckets share its array
+			kpath := append(append([][]byte{}, path...), k)
+
+			// Nested buckets have a nil value
+			if v == nil {
+				return copyBucket(kpath, b.Bucket(k))
+			}
+
+			size += int64(len(k) + len(v))
+
+			return bucket(dtx, path).Put(k, v)
+		})
+	}
+
+	if err := tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+		return copyBucket([][]byte{name}, b)
+	}); err != nil {
+		return err
+	}
+
+	return dtx.Commit()
+}
+
+// createBucket creates the bucket at path, whose parent exists, with its sequence
+func createBucket(tx *bolt.Tx, path [][]byte, seq uint64) error {
+	var b *bolt.Bucket
+	var err error
+	if len(path) == 1 {
+		b, err = tx.CreateBucket(path[0])
+	} else {
+		b, err = bucket(tx, path[:len(path)-1]).CreateBucket(path[len(path)-1])
+	}
+	if err != nil {
+		return err
+	}
+
+	return b.SetSequence(seq)
+}
+
+// bucket returns the bucket at path
+func bucket(tx *bolt.Tx, path [][]byte) *bolt.Bucket {
+	b := tx.Bucket(path[0])
+	for _, name := range path[1:] {
+		b = b.Bucket(name)
+	}
+	return b
+}
+
+// Pending returns the Result of the compaction of the db at dbPath waiting to be swapped in, nil if there is none
+func Pending(dbPath string) (*Result, error) {
+	if _, err := os.Stat(PendingPath(dbPath)); err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	// The result is written after the compacted db, a compacted db without it is incomplete
+	b, err := ioutil.ReadFile(dbPath + resultSuffix)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var res Result
+	if err := json.Unmarshal(b, &res); err != nil {
+		return nil, err
+	}
+
+	return &res, nil
+}
+
+// Compactor compacts the db of a running teller into a pending file, swapped in by Swap at the next start
+type Compactor struct {
+	log     logrus.FieldLogger
+	db      *bolt.DB
+	lock    sync.Mutex
+	running bool
+}
+
+// NewCompactor creates a Compactor
+func NewCompactor(log logrus.FieldLogger, db *bolt.DB) *Compactor {
+	return &Compactor{
+		log: log.WithField("prefix", "compact"),
+		db:  db,
+	}
+}
+
+// Compact copies the db into the pending file, replacing the previous pending compaction.
+// Returns ErrCompactionInProgress if a compaction is running.
+func (c *Compactor) Compact() (Result, error) {
+	c.lock.Lock()
+	if c.running {
+		c.lock.Unlock()
+		return Result{}, ErrCompactionInProgress
+	}
+	c.running = true
+	c.lock.Unlock()
+
+	defer func() {
+		c.lock.Lock()
+		c.running = false
+		c.lock.Unlock()
+	}()
+
+	dbPath := c.db.Path()
+
+	// The previous result is removed first, so that the compacted db is never swapped in with a wrong TxID
+	if err := os.Remove(dbPath + resultSuffix); err != nil && !os.IsNotExist(err) {
+		return Result{}, err
+	}
+
+	res, err := Compact(c.db, PendingPath(dbPath))
+	if err != nil {
+		return Result{}, err
+	}
+
+	b, err := json.Marshal(res)
+	if err != nil {
+		return Result{}, err
+	}
+
+	if err := ioutil.WriteFile(dbPath+resultSuffix, b, 0600); err != nil {
+		return Result{}, err
+	}
+
+	c.log.WithField("result", res).Info("Compacted db, it is swapped in at the next start")
+
+	return res, nil
+}
+
+// Pending returns the Result of the compaction waiting to be swapped in, nil if there is none
+func (c *Compactor) Pending() (*Result, error) {
+	return Pending(c.db.Path())
+}
+
+// Swap swaps the pending compaction in for db, if there is one, and returns the reopened db.
+// It must be called before anything writes to db, so that the compacted db can't miss a write.
+// If db was written to since it was copied, it is compacted again first.
+// The replaced db is kept at BackupPath, replacing the previous backup.
+func Swap(log logrus.FieldLogger, db *bolt.DB, opts *bolt.Options) (*bolt.DB, error) {
+	dbPath := db.Path()
+
+	res, err := Pending(dbPath)
+	if err != nil || res == nil {
+		return db, err
+	}
+
+	log = log.WithFields(logrus.Fields{
+		"dbPath": dbPath,
+		"result": res,
+	})
+
+	var txID int
+	if err := db.View(func(tx *bolt.Tx) error {
+		txID = tx.ID()
+		return nil
+	}); err != nil {
+		return db, err
+	}
+
+	if txID != res.TxID {
+		log.WithField("txID", txID).Info("The db changed since it was compacted, compacting it again")
+
+		r, err := Compact(db, PendingPath(dbPath))
+		if err != nil {
+			return db, err
+		}
+		res = &r
+	}
+
+	if err := swapFiles(dbPath); err != nil {
+		return db, err
+	}
+
+	log.WithField("compactedSize", res.CompactedSize).Info("Swapped in the compacted db")
+
+	// The db file was renamed over, db holds the replaced file
+	if err := db.Close(); err != nil {
+		return nil, err
+	}
+
+	return bolt.Open(dbPath, 0700, opts)
+}
+
+// swapFiles atomically renames the pending compaction over the db at dbPath, keeping the db at BackupPath.
+// The db is linked to BackupPath instead of renamed, so that there is always a db at dbPath.
+func swapFiles(dbPath string) error {
+	backup := BackupPath(dbPath)
+	if err := os.Remove(backup); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if err := os.Link(dbPath, backup); err != nil {
+		return err
+	}
+
+	if err := os.Rename(PendingPath(dbPath), dbPath); err != nil {
+		return err
+	}
+
+	return os.Remove(dbPath + resultSuffix)
+}
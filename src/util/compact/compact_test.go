@@ -0,0 +1,165 @@
+package compact
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+func populateDB(t *testing.T, db *bolt.DB) {
+	require.NoError(t, db.Update(func(tx *bolt.Tx) error {
+		a, err := tx.CreateBucket([]byte("a"))
+		if err != nil {
+			return err
+		}
+
+		for i := 0; i < 1000; i++ {
+			if _, err := a.NextSequence(); err != nil {
+				return err
+			}
+			if err := a.Put([]byte(fmt.Sprintf("k%04d", i)), make([]byte, 1024)); err != nil {
+				return err
+			}
+		}
+
+		nested, err := a.CreateBucket([]byte("nested"))
+		if err != nil {
+			return err
+		}
+
+		if err := nested.Put([]byte("k"), []byte("v")); err != nil {
+			return err
+		}
+
+		_, err = tx.CreateBucket([]byte("empty"))
+		return err
+	}))
+
+	// Deleting most keys leaves free pages in the file
+	require.NoError(t, db.Update(func(tx *bolt.Tx) error {
+		a := tx.Bucket([]byte("a"))
+		for i := 10; i < 1000; i++ {
+			if err := a.Delete([]byte(fmt.Sprintf("k%04d", i))); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+}
+
+func requireDBContent(t *testing.T, db *bolt.DB) {
+	require.NoError(t, db.View(func(tx *bolt.Tx) error {
+		a := tx.Bucket([]byte("a"))
+		require.NotNil(t, a)
+		require.Equal(t, uint64(1000), a.Sequence())
+
+		n := 0
+		require.NoError(t, a.ForEach(func(k, v []byte) error {
+			n++
+			return nil
+		}))
+		require.Equal(t, 11, n)
+
+		require.Equal(t, make([]byte, 1024), a.Get([]byte("k0009")))
+		require.Nil(t, a.Get([]byte("k0010")))
+		require.Equal(t, []byte("v"), a.Bucket([]byte("nested")).Get([]byte("k")))
+		require.NotNil(t, tx.Bucket([]byte("empty")))
+		return nil
+	}))
+}
+
+func TestCompact(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	populateDB(t, db)
+
+	path := PendingPath(db.Path())
+	defer os.Remove(path)
+
+	res, err := Compact(db, path)
+	require.NoError(t, err)
+	require.True(t, res.CompactedSize < res.DBSize)
+
+	cdb, err := bolt.Open(path, 0700, nil)
+	require.NoError(t, err)
+	defer cdb.Close()
+
+	requireDBContent(t, cdb)
+}
+
+func TestSwap(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+
+	for _, written := range []bool{false, true} {
+		t.Run(fmt.Sprintf("written=%v", written), func(t *testing.T) {
+			db, shutdown := testutil.PrepareDB(t)
+			defer shutdown()
+
+			dbPath := db.Path()
+			defer os.Remove(BackupPath(dbPath))
+
+			populateDB(t, db)
+
+			// Nothing to swap in
+			db2, err := Swap(log, db, nil)
+			require.NoError(t, err)
+			require.True(t, db == db2)
+
+			c := NewCompactor(log, db)
+
+			pending, err := c.Pending()
+			require.NoError(t, err)
+			require.Nil(t, pending)
+
+			res, err := c.Compact()
+			require.NoError(t, err)
+
+			pending, err = c.Pending()
+			require.NoError(t, err)
+			require.NotNil(t, pending)
+			require.Equal(t, res.TxID, pending.TxID)
+
+			// A write after the copy must not be lost
+			if written {
+				require.NoError(t, db.Update(func(tx *bolt.Tx) error {
+					return tx.Bucket([]byte("a")).Put([]byte("k0010"), []byte("v"))
+				}))
+			}
+
+			db2, err = Swap(log, db, nil)
+			require.NoError(t, err)
+			defer db2.Close()
+
+			fi, err := os.Stat(dbPath)
+			require.NoError(t, err)
+			require.True(t, fi.Size() < res.DBSize)
+
+			if written {
+				require.NoError(t, db2.View(func(tx *bolt.Tx) error {
+					require.Equal(t, []byte("v"), tx.Bucket([]byte("a")).Get([]byte("k0010")))
+					return nil
+				}))
+			} else {
+				requireDBContent(t, db2)
+			}
+
+			pending, err = Pending(dbPath)
+			require.NoError(t, err)
+			require.Nil(t, pending)
+
+			_, err = os.Stat(PendingPath(dbPath))
+			require.True(t, os.IsNotExist(err))
+
+			// The replaced db is kept
+			fi, err = os.Stat(BackupPath(dbPath))
+			require.NoError(t, err)
+			require.Equal(t, res.DBSize, fi.Size())
+		})
+	}
+}
@@ -0,0 +1,385 @@
+// Package dbcrypt encrypts values stored in the db, with a key derived from a passphrase.
+// A nil *Cipher stores values as they are, so that stores can use a Cipher whether encryption is enabled or not.
+package dbcrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/boltdb/bolt"
+	"golang.org/x/crypto/pbkdf2"
+
+	"github.com/skycoin/teller/src/util/dbutil"
+)
+
+var (
+	// Salt of the key derivation and the check value of the passphrase, and the buckets that were encrypted
+	metaBkt = []byte("encryption_meta")
+
+	// ErrWrongPassphrase is returned by Open if the passphrase is not the one the db was encrypted with
+	ErrWrongPassphrase = errors.New("Wrong db encryption passphrase")
+	// ErrEmptyPassphrase is returned by Open if the passphrase is empty
+	ErrEmptyPassphrase = errors.New("Empty db encryption passphrase")
+	// ErrDecrypt is returned if a value can't be decrypted, e.g. because it was tampered with
+	ErrDecrypt = errors.New("Decrypt value failed")
+)
+
+const (
+	saltKey  = "salt"
+	checkKey = "check"
+
+	saltLen       = 16
+	kdfIterations = 200000
+	checkValue    = "teller"
+)
+
+// Cipher encrypts and decrypts the values of the db with AES-256-GCM,
+// and hashes lookup keys, e.g. addresses, with HMAC-SHA256
+type Cipher struct {
+	aead   cipher.AEAD
+	macKey []byte
+	meta   []byte // bucket of the salt, the check value and the migrated buckets
+}
+
+// Open returns the Cipher of the db for passphrase. The salt of the key derivation is created the first time,
+// with a check value that is used to return ErrWrongPassphrase if a different passphrase is used later.
+// Once they are created, the db is only read, so that a db opened read-only can be decrypted too.
+func Open(db *bolt.DB, passphrase string) (*Cipher, error) {
+	return open(db, metaBkt, passphrase)
+}
+
+// OpenKey returns a Cipher for passphrase like Open, with its salt and check value kept under name,
+// apart from those of the db encryption. It is used for values that are encrypted whether the db is or not.
+func OpenKey(db *bolt.DB, name, passphrase string) (*Cipher, error) {
+	if name == "" {
+		return nil, errors.New("Empty encryption key name")
+	}
+
+	return open(db, []byte(string(metaBkt)+"_"+name), passphrase)
+}
+
+func open(db *bolt.DB, meta []byte, passphrase string) (*Cipher, error) {
+	if passphrase == "" {
+		return nil, ErrEmptyPassphrase
+	}
+
+	var salt, check []byte
+	if err := db.View(func(tx *bolt.Tx) error {
+		if bkt := tx.Bucket(meta); bkt != nil {
+			salt = append([]byte(nil), bkt.Get([]byte(saltKey))...)
+			check = append([]byte(nil), bkt.Get([]byte(checkKey))...)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	if len(salt) != 0 && len(check) != 0 {
+		c, err := newCipher(passphrase, salt, meta)
+		if err != nil {
+			return nil, err
+		}
+
+		if v, err := c.Decrypt(check); err != nil || string(v) != checkValue {
+			return nil, ErrWrongPassphrase
+		}
+
+		return c, nil
+	}
+
+	var c *Cipher
+	if err := db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(meta); err != nil {
+			return dbutil.NewCreateBucketFailedErr(meta, err)
+		}
+
+		salt := tx.Bucket(meta).Get([]byte(saltKey))
+		if salt == nil {
+			salt = make([]byte, saltLen)
+			if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+				return err
+			}
+
+			if err := dbutil.PutBucketValue(tx, meta, saltKey, salt); err != nil {
+				return err
+			}
+		}
+
+		var err error
+		c, err = newCipher(passphrase, salt, meta)
+		if err != nil {
+			return err
+		}
+
+		check := tx.Bucket(meta).Get([]byte(checkKey))
+		if check == nil {
+			check, err := c.Encrypt([]byte(checkValue))
+			if err != nil {
+				return err
+			}
+
+			return dbutil.PutBucketValue(tx, meta, checkKey, check)
+		}
+
+		if v, err := c.Decrypt(check); err != nil || string(v) != checkValue {
+			return ErrWrongPassphrase
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// CopyKey copies the salt and check value of the db encryption of src, with the buckets marked as encrypted, to dst.
+// dst is then encrypted with the same key, e.g. a db rebuilt from the values of src.
+func CopyKey(src, dst *bolt.DB) error {
+	return src.View(func(stx *bolt.Tx) error {
+		sbkt := stx.Bucket(metaBkt)
+		if sbkt == nil {
+			return dbutil.NewBucketNotExistErr(metaBkt)
+		}
+
+		return dst.Update(func(dtx *bolt.Tx) error {
+			dbkt, err := dtx.CreateBucketIfNotExists(metaBkt)
+			if err != nil {
+				return dbutil.NewCreateBucketFailedErr(metaBkt, err)
+			}
+
+			return sbkt.ForEach(dbkt.Put)
+		})
+	})
+}
+
+// IsEncrypted returns true if a Cipher was opened for the db before, so its values must be read with one
+func IsEncrypted(db *bolt.DB) (bool, error) {
+	var encrypted bool
+	if err := db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket(metaBkt) == nil {
+			return nil
+		}
+
+		var err error
+		encrypted, err = dbutil.BucketHasKey(tx, metaBkt, checkKey)
+		return err
+	}); err != nil {
+		return false, err
+	}
+
+	return encrypted, nil
+}
+
+func newCipher(passphrase string, salt, meta []byte) (*Cipher, error) {
+	key := pbkdf2.Key([]byte(passphrase), salt, kdfIterations, 64, sha256.New)
+
+	block, err := aes.NewCipher(key[:32])
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Cipher{
+		aead:   aead,
+		macKey: key[32:],
+		meta:   meta,
+	}, nil
+}
+
+// Encrypt encrypts a value, with a random nonce prepended to it
+func (c *Cipher) Encrypt(v []byte) ([]byte, error) {
+	if c == nil {
+		return v, nil
+	}
+
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	return c.aead.Seal(nonce, nonce, v, nil), nil
+}
+
+// Decrypt decrypts a value encrypted by Encrypt
+func (c *Cipher) Decrypt(v []byte) ([]byte, error) {
+	if c == nil {
+		return v, nil
+	}
+
+	n := c.aead.NonceSize()
+	if len(v) < n {
+		return nil, ErrDecrypt
+	}
+
+	b, err := c.aead.Open(nil, v[:n], v[n:], nil)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+
+	return b, nil
+}
+
+// Hash returns the hex HMAC of a lookup key, so that it can be found in the db without being stored.
+// A nil Cipher returns the key unchanged.
+func (c *Cipher) Hash(key string) string {
+	if c == nil {
+		return key
+	}
+
+	mac := hmac.New(sha256.New, c.macKey)
+	mac.Write([]byte(key)) // nolint: errcheck
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// GetBucketObject decodes the value of key, written by PutBucketValue, into obj, like dbutil.GetBucketObject
+func (c *Cipher) GetBucketObject(tx *bolt.Tx, bktName []byte, key string, obj interface{}) error {
+	v, err := c.getBucketValue(tx, bktName, key)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(v, obj); err != nil {
+		return fmt.Errorf("decode value failed: %v", err)
+	}
+
+	return nil
+}
+
+// GetBucketString returns the string value of key, written by PutBucketValue, like dbutil.GetBucketString
+func (c *Cipher) GetBucketString(tx *bolt.Tx, bktName []byte, key string) (string, error) {
+	v, err := c.getBucketValue(tx, bktName, key)
+	if err != nil {
+		return "", err
+	}
+
+	return string(v), nil
+}
+
+func (c *Cipher) getBucketValue(tx *bolt.Tx, bktName []byte, key string) ([]byte, error) {
+	bkt := tx.Bucket(bktName)
+	if bkt == nil {
+		return nil, dbutil.NewBucketNotExistErr(bktName)
+	}
+
+	v := bkt.Get([]byte(key))
+	if v == nil {
+		return nil, dbutil.NewObjectNotExistErr(bktName, []byte(key))
+	}
+
+	return c.Decrypt(v)
+}
+
+// PutBucketValue encodes obj like dbutil.PutBucketValue, and stores it encrypted
+func (c *Cipher) PutBucketValue(tx *bolt.Tx, bktName []byte, key string, obj interface{}) error {
+	var v []byte
+	switch x := obj.(type) {
+	case []byte:
+		v = x
+	case string:
+		v = []byte(x)
+	default:
+		var err error
+		v, err = json.Marshal(obj)
+		if err != nil {
+			return fmt.Errorf("encode value failed: %v", err)
+		}
+	}
+
+	v, err := c.Encrypt(v)
+	if err != nil {
+		return err
+	}
+
+	return dbutil.PutBucketValue(tx, bktName, key, v)
+}
+
+// ForEach calls f with the decrypted values of a bucket, like dbutil.ForEach
+func (c *Cipher) ForEach(tx *bolt.Tx, bktName []byte, f func(k, v []byte) error) error {
+	return dbutil.ForEach(tx, bktName, func(k, v []byte) error {
+		v, err := c.Decrypt(v)
+		if err != nil {
+			return err
+		}
+
+		return f(k, v)
+	})
+}
+
+// MigrateTx converts the keys and values of a bucket that were stored before encryption was enabled, with convert.
+// It only converts a bucket once, the bucket is marked as encrypted in the same transaction. A nil Cipher does nothing.
+func (c *Cipher) MigrateTx(tx *bolt.Tx, bktName []byte, convert func(k, v []byte) ([]byte, []byte, error)) error {
+	if c == nil {
+		return nil
+	}
+
+	if migrated, err := c.IsMigrated(tx, bktName); err != nil {
+		return err
+	} else if migrated {
+		return nil
+	}
+
+	bkt := tx.Bucket(bktName)
+	if bkt == nil {
+		return dbutil.NewBucketNotExistErr(bktName)
+	}
+
+	// Keys can't be changed while iterating the bucket, so the old keys and values are copied out first
+	type kv struct {
+		k, v []byte
+	}
+
+	var kvs []kv
+	if err := bkt.ForEach(func(k, v []byte) error {
+		kvs = append(kvs, kv{
+			k: append([]byte(nil), k...),
+			v: append([]byte(nil), v...),
+		})
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	for _, x := range kvs {
+		k, v, err := convert(x.k, x.v)
+		if err != nil {
+			return fmt.Errorf("Encrypt %s/%s failed: %v", bktName, x.k, err)
+		}
+
+		if err := bkt.Delete(x.k); err != nil {
+			return err
+		}
+
+		if err := bkt.Put(k, v); err != nil {
+			return err
+		}
+	}
+
+	return dbutil.PutBucketValue(tx, c.meta, migratedKey(bktName), "")
+}
+
+// IsMigrated returns true if MigrateTx converted a bucket, so that its values must be read with the Cipher.
+// A nil Cipher returns false.
+func (c *Cipher) IsMigrated(tx *bolt.Tx, bktName []byte) (bool, error) {
+	if c == nil {
+		return false, nil
+	}
+
+	return dbutil.BucketHasKey(tx, c.meta, migratedKey(bktName))
+}
+
+func migratedKey(bktName []byte) string {
+	return "bucket/" + string(bktName)
+}
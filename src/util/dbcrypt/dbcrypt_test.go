@@ -0,0 +1,324 @@
+package dbcrypt
+
+import (
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/util/dbutil"
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+func TestOpen(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	encrypted, err := IsEncrypted(db)
+	require.NoError(t, err)
+	require.False(t, encrypted)
+
+	_, err = Open(db, "")
+	require.Equal(t, ErrEmptyPassphrase, err)
+
+	c, err := Open(db, "secret")
+	require.NoError(t, err)
+
+	encrypted, err = IsEncrypted(db)
+	require.NoError(t, err)
+	require.True(t, encrypted)
+
+	_, err = Open(db, "wrong")
+	require.Equal(t, ErrWrongPassphrase, err)
+
+	// The same passphrase derives the same key
+	c2, err := Open(db, "secret")
+	require.NoError(t, err)
+	require.Equal(t, c.Hash("addr"), c2.Hash("addr"))
+
+	v, err := c.Encrypt([]byte("value"))
+	require.NoError(t, err)
+	require.NotEqual(t, []byte("value"), v)
+
+	b, err := c2.Decrypt(v)
+	require.NoError(t, err)
+	require.Equal(t, []byte("value"), b)
+
+	v[len(v)-1] ^= 1
+	_, err = c2.Decrypt(v)
+	require.Equal(t, ErrDecrypt, err)
+
+	_, err = c2.Decrypt([]byte("x"))
+	require.Equal(t, ErrDecrypt, err)
+
+	require.NotEqual(t, "addr", c.Hash("addr"))
+	require.NotEqual(t, c.Hash("addr"), c.Hash("addr2"))
+
+	// Another db has another salt
+	db2, shutdown2 := testutil.PrepareDB(t)
+	defer shutdown2()
+
+	c3, err := Open(db2, "secret")
+	require.NoError(t, err)
+	require.NotEqual(t, c.Hash("addr"), c3.Hash("addr"))
+}
+
+func TestOpenKey(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	_, err := OpenKey(db, "", "secret")
+	require.Error(t, err)
+
+	_, err = OpenKey(db, "notify", "")
+	require.Equal(t, ErrEmptyPassphrase, err)
+
+	c, err := OpenKey(db, "notify", "secret")
+	require.NoError(t, err)
+
+	// A named key doesn't make the db encrypted
+	encrypted, err := IsEncrypted(db)
+	require.NoError(t, err)
+	require.False(t, encrypted)
+
+	_, err = OpenKey(db, "notify", "wrong")
+	require.Equal(t, ErrWrongPassphrase, err)
+
+	// The db encryption can have another passphrase, and has another salt
+	dc, err := Open(db, "other")
+	require.NoError(t, err)
+
+	dc2, err := Open(db, "secret")
+	require.Equal(t, ErrWrongPassphrase, err)
+	require.Nil(t, dc2)
+	require.NotEqual(t, c.Hash("addr"), dc.Hash("addr"))
+
+	c2, err := OpenKey(db, "notify", "secret")
+	require.NoError(t, err)
+	require.Equal(t, c.Hash("addr"), c2.Hash("addr"))
+
+	v, err := c.Encrypt([]byte("value"))
+	require.NoError(t, err)
+
+	b, err := c2.Decrypt(v)
+	require.NoError(t, err)
+	require.Equal(t, []byte("value"), b)
+
+	_, err = dc.Decrypt(v)
+	require.Equal(t, ErrDecrypt, err)
+}
+
+func TestNilCipher(t *testing.T) {
+	var c *Cipher
+
+	v, err := c.Encrypt([]byte("value"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("value"), v)
+
+	v, err = c.Decrypt([]byte("value"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("value"), v)
+
+	require.Equal(t, "addr", c.Hash("addr"))
+}
+
+func TestMigrateTx(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	bktName := []byte("test")
+	require.NoError(t, db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucket(bktName); err != nil {
+			return err
+		}
+
+		if err := dbutil.PutBucketValue(tx, bktName, "a", "1"); err != nil {
+			return err
+		}
+
+		return dbutil.PutBucketValue(tx, bktName, "b", "2")
+	}))
+
+	c, err := Open(db, "secret")
+	require.NoError(t, err)
+
+	convert := func(k, v []byte) ([]byte, []byte, error) {
+		v, err := c.Encrypt(v)
+		return []byte(c.Hash(string(k))), v, err
+	}
+
+	require.NoError(t, db.View(func(tx *bolt.Tx) error {
+		migrated, err := c.IsMigrated(tx, bktName)
+		require.False(t, migrated)
+		return err
+	}))
+
+	require.NoError(t, db.Update(func(tx *bolt.Tx) error {
+		return c.MigrateTx(tx, bktName, convert)
+	}))
+
+	// A bucket is only converted once
+	require.NoError(t, db.Update(func(tx *bolt.Tx) error {
+		return c.MigrateTx(tx, bktName, convert)
+	}))
+
+	values := make(map[string]string)
+	require.NoError(t, db.View(func(tx *bolt.Tx) error {
+		return dbutil.ForEach(tx, bktName, func(k, v []byte) error {
+			b, err := c.Decrypt(v)
+			if err != nil {
+				return err
+			}
+
+			values[string(k)] = string(b)
+			return nil
+		})
+	}))
+
+	require.Equal(t, map[string]string{
+		c.Hash("a"): "1",
+		c.Hash("b"): "2",
+	}, values)
+}
+
+func TestOpenReadOnly(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	c, err := Open(db, "secret")
+	require.NoError(t, err)
+
+	path := db.Path()
+	require.NoError(t, db.Close())
+
+	db, err = bolt.Open(path, 0700, &bolt.Options{
+		ReadOnly: true,
+	})
+	require.NoError(t, err)
+	defer db.Close()
+
+	c2, err := Open(db, "secret")
+	require.NoError(t, err)
+	require.Equal(t, c.Hash("addr"), c2.Hash("addr"))
+
+	_, err = Open(db, "wrong")
+	require.Equal(t, ErrWrongPassphrase, err)
+}
+
+func TestBucketValues(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	c, err := Open(db, "secret")
+	require.NoError(t, err)
+
+	bktName := []byte("test")
+	require.NoError(t, db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucket(bktName)
+		return err
+	}))
+
+	type obj struct {
+		Address string
+	}
+
+	for _, c := range []*Cipher{nil, c} {
+		require.NoError(t, db.Update(func(tx *bolt.Tx) error {
+			if err := c.PutBucketValue(tx, bktName, "a", obj{Address: "addr"}); err != nil {
+				return err
+			}
+
+			return c.PutBucketValue(tx, bktName, "b", "addr")
+		}))
+
+		require.NoError(t, db.View(func(tx *bolt.Tx) error {
+			raw := tx.Bucket(bktName).Get([]byte("b"))
+			if c == nil {
+				require.Equal(t, []byte("addr"), raw)
+			} else {
+				require.NotContains(t, string(raw), "addr")
+			}
+
+			var o obj
+			require.NoError(t, c.GetBucketObject(tx, bktName, "a", &o))
+			require.Equal(t, obj{Address: "addr"}, o)
+
+			s, err := c.GetBucketString(tx, bktName, "b")
+			require.NoError(t, err)
+			require.Equal(t, "addr", s)
+
+			err = c.GetBucketObject(tx, bktName, "c", &o)
+			require.IsType(t, dbutil.ObjectNotExistErr{}, err)
+
+			_, err = c.GetBucketString(tx, []byte("missing"), "b")
+			require.IsType(t, dbutil.BucketNotExistErr{}, err)
+
+			values := make(map[string]string)
+			require.NoError(t, c.ForEach(tx, bktName, func(k, v []byte) error {
+				values[string(k)] = string(v)
+				return nil
+			}))
+			require.Equal(t, map[string]string{
+				"a": `{"Address":"addr"}`,
+				"b": "addr",
+			}, values)
+
+			return nil
+		}))
+	}
+
+	// Values that were not encrypted can't be read with the Cipher
+	require.NoError(t, db.Update(func(tx *bolt.Tx) error {
+		return dbutil.PutBucketValue(tx, bktName, "b", "addr")
+	}))
+
+	require.NoError(t, db.View(func(tx *bolt.Tx) error {
+		_, err := c.GetBucketString(tx, bktName, "b")
+		require.Equal(t, ErrDecrypt, err)
+		return nil
+	}))
+}
+
+func TestCopyKey(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	db2, shutdown2 := testutil.PrepareDB(t)
+	defer shutdown2()
+
+	require.IsType(t, dbutil.BucketNotExistErr{}, CopyKey(db, db2))
+
+	c, err := Open(db, "secret")
+	require.NoError(t, err)
+
+	bktName := []byte("test")
+	require.NoError(t, db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucket(bktName); err != nil {
+			return err
+		}
+
+		return c.MigrateTx(tx, bktName, func(k, v []byte) ([]byte, []byte, error) {
+			return k, v, nil
+		})
+	}))
+
+	require.NoError(t, CopyKey(db, db2))
+
+	encrypted, err := IsEncrypted(db2)
+	require.NoError(t, err)
+	require.True(t, encrypted)
+
+	_, err = Open(db2, "wrong")
+	require.Equal(t, ErrWrongPassphrase, err)
+
+	c2, err := Open(db2, "secret")
+	require.NoError(t, err)
+	require.Equal(t, c.Hash("addr"), c2.Hash("addr"))
+
+	// The buckets encrypted in db are not migrated again in db2
+	require.NoError(t, db2.View(func(tx *bolt.Tx) error {
+		migrated, err := c2.IsMigrated(tx, bktName)
+		require.True(t, migrated)
+		return err
+	}))
+}
@@ -1,6 +1,7 @@
 package dbutil
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 
@@ -124,6 +125,16 @@ func PutBucketValue(tx *bolt.Tx, bktName []byte, key string, obj interface{}) er
 	}
 }
 
+// DeleteBucketKey deletes a key from a bucket. Deleting a key that does not exist is not an error.
+func DeleteBucketKey(tx *bolt.Tx, bktName []byte, key string) error {
+	bkt := tx.Bucket(bktName)
+	if bkt == nil {
+		return NewBucketNotExistErr(bktName)
+	}
+
+	return bkt.Delete([]byte(key))
+}
+
 // BucketHasKey returns true if a bucket has a non-nil value for a key
 func BucketHasKey(tx *bolt.Tx, bktName []byte, key string) (bool, error) {
 	bkt := tx.Bucket(bktName)
@@ -154,3 +165,21 @@ func ForEach(tx *bolt.Tx, bktName []byte, f func(k, v []byte) error) error {
 
 	return bkt.ForEach(f)
 }
+
+// ForEachPrefix calls f for each key of the bucket that starts with prefix, in key order
+func ForEachPrefix(tx *bolt.Tx, bktName []byte, prefix string, f func(k, v []byte) error) error {
+	bkt := tx.Bucket(bktName)
+	if bkt == nil {
+		return NewBucketNotExistErr(bktName)
+	}
+
+	p := []byte(prefix)
+	c := bkt.Cursor()
+	for k, v := c.Seek(p); k != nil && bytes.HasPrefix(k, p); k, v = c.Next() {
+		if err := f(k, v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
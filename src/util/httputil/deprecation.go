@@ -0,0 +1,66 @@
+package httputil
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Deprecation marks an API endpoint, or a field of its request or response, as deprecated
+type Deprecation struct {
+	// URI of the endpoint, e.g. /api/bind
+	Endpoint string `json:"endpoint"`
+	// Name of the deprecated field. If empty, the whole endpoint is deprecated.
+	Field string `json:"field,omitempty"`
+	// When the deprecation took effect
+	Since time.Time `json:"since"`
+	// When the endpoint or field will be removed, if scheduled
+	Sunset *time.Time `json:"sunset,omitempty"`
+	// What to use instead
+	Info string `json:"info,omitempty"`
+}
+
+// SetDeprecationHeaders sets the headers for the deprecations of an endpoint.
+// A deprecated endpoint sets the Deprecation header, and the Sunset header if it has a sunset.
+// A deprecated field adds a Warning header, since the endpoint itself remains.
+func SetDeprecationHeaders(w http.ResponseWriter, ds []Deprecation) {
+	for _, d := range ds {
+		if d.Field != "" {
+			msg := fmt.Sprintf("%s is deprecated", d.Field)
+			if d.Sunset != nil {
+				msg = fmt.Sprintf("%s and will be removed after %s", msg, d.Sunset.UTC().Format(http.TimeFormat))
+			}
+			if d.Info != "" {
+				msg = fmt.Sprintf("%s: %s", msg, d.Info)
+			}
+
+			w.Header().Add("Warning", "299 - "+strconv.Quote(msg))
+			continue
+		}
+
+		// https://tools.ietf.org/html/draft-ietf-httpapi-deprecation-header
+		w.Header().Set("Deprecation", fmt.Sprintf("@%d", d.Since.Unix()))
+
+		// https://tools.ietf.org/html/rfc8594
+		if d.Sunset != nil {
+			w.Header().Set("Sunset", d.Sunset.UTC().Format(http.TimeFormat))
+		}
+	}
+}
+
+// DeprecationHandler sets deprecation headers on responses of the endpoints in ds
+func DeprecationHandler(ds []Deprecation, hd http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var matched []Deprecation
+		for _, d := range ds {
+			if d.Endpoint == r.URL.Path {
+				matched = append(matched, d)
+			}
+		}
+
+		SetDeprecationHeaders(w, matched)
+
+		hd.ServeHTTP(w, r)
+	})
+}
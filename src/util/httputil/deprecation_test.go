@@ -0,0 +1,63 @@
+package httputil
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeprecationHandler(t *testing.T) {
+	since := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	sunset := time.Date(2018, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	ds := []Deprecation{
+		{
+			Endpoint: "/api/old",
+			Since:    since,
+			Sunset:   &sunset,
+			Info:     "use /api/new",
+		},
+		{
+			Endpoint: "/api/new",
+			Field:    "foo",
+			Since:    since,
+			Info:     "use bar",
+		},
+	}
+
+	h := DeprecationHandler(ds, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	cases := []struct {
+		path        string
+		deprecation string
+		sunset      string
+		warning     string
+	}{
+		{
+			path:        "/api/old",
+			deprecation: "@1514764800",
+			sunset:      "Fri, 01 Jun 2018 00:00:00 GMT",
+		},
+		{
+			path:    "/api/new",
+			warning: `299 - "foo is deprecated: use bar"`,
+		},
+		{
+			path: "/api/other",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.path, nil))
+
+			require.Equal(t, tc.deprecation, w.Header().Get("Deprecation"))
+			require.Equal(t, tc.sunset, w.Header().Get("Sunset"))
+			require.Equal(t, tc.warning, w.Header().Get("Warning"))
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"runtime/debug"
 	"strings"
 	"time"
 
@@ -12,6 +13,9 @@ import (
 	"github.com/skycoin/teller/src/util/logger"
 )
 
+// ErrorCodeHeader is the header with the machine-readable code of an error response
+const ErrorCodeHeader = "X-Error-Code"
+
 // ErrResponse write error message and code
 func ErrResponse(w http.ResponseWriter, code int, errMsg ...string) {
 	if len(errMsg) > 0 {
@@ -23,21 +27,28 @@ func ErrResponse(w http.ResponseWriter, code int, errMsg ...string) {
 
 // JSONResponse marshal data into json and write response
 func JSONResponse(w http.ResponseWriter, data interface{}) error {
+	return JSONStatusResponse(w, http.StatusOK, data)
+}
+
+// JSONStatusResponse marshal data into json and write response with status
+func JSONStatusResponse(w http.ResponseWriter, status int, data interface{}) error {
 	w.Header().Set("Content-Type", "application/json")
 	d, err := json.MarshalIndent(data, "", "    ")
 	if err != nil {
 		return err
 	}
 
+	w.WriteHeader(status)
 	_, err = w.Write(d)
 	return err
 }
 
-// LogHandler log middleware
+// LogHandler log middleware. It recovers a panic of the handler, logging it as an error with its stack,
+// and responds 500 if the handler had not responded yet.
 func LogHandler(log logrus.FieldLogger, hd http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
-		log = log.WithFields(logrus.Fields{
+		log := logger.WithRequestIDField(ctx, log).WithFields(logrus.Fields{
 			"method":     r.Method,
 			"remoteAddr": r.RemoteAddr,
 			"url":        r.URL.String(),
@@ -49,20 +60,39 @@ func LogHandler(log logrus.FieldLogger, hd http.Handler) http.Handler {
 
 		lrw := newLoggingResponseWriter(w)
 
-		hd.ServeHTTP(lrw, r)
+		defer func() {
+			if p := recover(); p != nil {
+				// http.ErrAbortHandler aborts the response, net/http doesn't log it either
+				if p == http.ErrAbortHandler {
+					panic(p)
+				}
+
+				log.WithFields(logrus.Fields{
+					"panic": fmt.Sprint(p),
+					"stack": string(debug.Stack()),
+				}).Error("HTTP handler panicked")
 
-		log.WithFields(logrus.Fields{
-			"duration":   fmt.Sprintf("%dms", time.Since(t)/time.Millisecond),
-			"status":     lrw.statusCode,
-			"statusText": http.StatusText(lrw.statusCode),
-		}).Info("HTTP Request")
+				if !lrw.wroteHeader {
+					ErrResponse(lrw, http.StatusInternalServerError)
+				}
+			}
+
+			log.WithFields(logrus.Fields{
+				"duration":   fmt.Sprintf("%dms", time.Since(t)/time.Millisecond),
+				"status":     lrw.statusCode,
+				"statusText": http.StatusText(lrw.statusCode),
+			}).Info("HTTP Request")
+		}()
+
+		hd.ServeHTTP(lrw, r)
 	})
 }
 
 // Captures the response status of a http handler
 type loggingResponseWriter struct {
 	http.ResponseWriter
-	statusCode int
+	statusCode  int
+	wroteHeader bool
 }
 
 func newLoggingResponseWriter(w http.ResponseWriter) *loggingResponseWriter {
@@ -74,5 +104,11 @@ func newLoggingResponseWriter(w http.ResponseWriter) *loggingResponseWriter {
 
 func (lrw *loggingResponseWriter) WriteHeader(code int) {
 	lrw.statusCode = code
+	lrw.wroteHeader = true
 	lrw.ResponseWriter.WriteHeader(code)
 }
+
+func (lrw *loggingResponseWriter) Write(b []byte) (int, error) {
+	lrw.wroteHeader = true
+	return lrw.ResponseWriter.Write(b)
+}
@@ -0,0 +1,50 @@
+package httputil
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+func TestLogHandlerPanic(t *testing.T) {
+	log, hook := testutil.NewLogger(t)
+
+	h := RequestIDHandler(LogHandler(log, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("written") != "" {
+			w.WriteHeader(http.StatusAccepted)
+		}
+		panic("handler bug")
+	})))
+
+	// The panic is logged with the request ID, and the request gets a 500 response
+	req := httptest.NewRequest(http.MethodGet, "/api/status", nil)
+	req.Header.Set(RequestIDHeader, "abc-123")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusInternalServerError, w.Code)
+
+	entries := hook.AllEntries()
+	require.Len(t, entries, 2)
+	require.Equal(t, logrus.ErrorLevel, entries[0].Level)
+	require.Equal(t, "HTTP handler panicked", entries[0].Message)
+	require.Equal(t, "handler bug", entries[0].Data["panic"])
+	require.Equal(t, "abc-123", entries[0].Data["requestID"])
+	require.Contains(t, entries[0].Data["stack"], "TestLogHandlerPanic")
+	require.Equal(t, "HTTP Request", entries[1].Message)
+	require.Equal(t, http.StatusInternalServerError, entries[1].Data["status"])
+
+	// The response is left alone if the handler responded before panicking
+	hook.Reset()
+	req = httptest.NewRequest(http.MethodGet, "/api/status?written=1", nil)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusAccepted, w.Code)
+	require.Equal(t, http.StatusAccepted, hook.LastEntry().Data["status"])
+}
@@ -0,0 +1,197 @@
+package httputil
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrTooManyConcurrentRequests is the error of a request over the concurrent request limit of a Quota
+var ErrTooManyConcurrentRequests = errors.New("Too many concurrent requests")
+
+// Quota limits the number of concurrent requests and the response bandwidth of each client.
+// The bandwidth is shared by all concurrent responses to a client.
+type Quota struct {
+	maxConns    int
+	bytesPerSec int64
+	errorFunc   func(w http.ResponseWriter, r *http.Request, status int, err error)
+
+	sync.Mutex
+	clients   map[string]*clientQuota
+	lastSweep time.Time
+}
+
+type clientQuota struct {
+	conns int
+	// Bandwidth token bucket, in bytes. Writes reserve tokens in advance,
+	// so it can be negative, which is the debt to wait for.
+	tokens float64
+	last   time.Time
+}
+
+// NewQuota creates a Quota. maxConns is the maximum number of concurrent requests per client,
+// and bytesPerSec the maximum response bandwidth per client. 0 disables either limit.
+func NewQuota(maxConns int, bytesPerSec int64) *Quota {
+	return &Quota{
+		maxConns:    maxConns,
+		bytesPerSec: bytesPerSec,
+		clients:     make(map[string]*clientQuota),
+	}
+}
+
+// SetErrorFunc sets the function that writes the error response of a request over the concurrent request limit,
+// instead of the plain text ErrResponse
+func (q *Quota) SetErrorFunc(f func(w http.ResponseWriter, r *http.Request, status int, err error)) {
+	q.errorFunc = f
+}
+
+// Handler applies the quota to hd. clientKey identifies the client of a request, e.g. its IP.
+// Requests over the concurrent request limit get a 429 response.
+func (q *Quota) Handler(clientKey func(*http.Request) string, hd http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := clientKey(r)
+
+		if !q.acquire(key) {
+			w.Header().Set("Retry-After", "1")
+			if q.errorFunc != nil {
+				q.errorFunc(w, r, http.StatusTooManyRequests, ErrTooManyConcurrentRequests)
+			} else {
+				ErrResponse(w, http.StatusTooManyRequests, ErrTooManyConcurrentRequests.Error())
+			}
+			return
+		}
+		defer q.release(key)
+
+		if q.bytesPerSec > 0 {
+			w = &throttledResponseWriter{
+				ResponseWriter: w,
+				quota:          q,
+				key:            key,
+				ctx:            r.Context(),
+			}
+		}
+
+		hd.ServeHTTP(w, r)
+	})
+}
+
+func (q *Quota) acquire(key string) bool {
+	q.Lock()
+	defer q.Unlock()
+
+	now := time.Now()
+	q.sweep(now)
+
+	c := q.clients[key]
+	if c == nil {
+		c = &clientQuota{
+			tokens: float64(q.bytesPerSec),
+			last:   now,
+		}
+		q.clients[key] = c
+	}
+
+	if q.maxConns > 0 && c.conns >= q.maxConns {
+		return false
+	}
+
+	c.conns++
+	return true
+}
+
+func (q *Quota) release(key string) {
+	q.Lock()
+	defer q.Unlock()
+
+	c := q.clients[key]
+	c.conns--
+
+	// Without a bandwidth limit, there is nothing to remember of idle clients.
+	// Otherwise they are kept until their bandwidth has refilled, see sweep,
+	// so that a new request doesn't start with a full second of bandwidth.
+	if c.conns == 0 && q.bytesPerSec == 0 {
+		delete(q.clients, key)
+	}
+}
+
+// sweep removes the idle clients whose bandwidth has refilled completely, which are the same as a new client,
+// so that the clients that stopped making requests don't accumulate. It runs at most once a minute.
+func (q *Quota) sweep(now time.Time) {
+	if now.Sub(q.lastSweep) < time.Minute {
+		return
+	}
+	q.lastSweep = now
+
+	rate := float64(q.bytesPerSec)
+	for k, c := range q.clients {
+		if c.conns == 0 && c.tokens+now.Sub(c.last).Seconds()*rate >= rate {
+			delete(q.clients, k)
+		}
+	}
+}
+
+// reserve takes n bytes of bandwidth from the client's bucket and returns how long
+// to wait before writing them
+func (q *Quota) reserve(key string, n int) time.Duration {
+	q.Lock()
+	defer q.Unlock()
+
+	c := q.clients[key]
+	now := time.Now()
+	rate := float64(q.bytesPerSec)
+
+	c.tokens += now.Sub(c.last).Seconds() * rate
+	if c.tokens > rate {
+		c.tokens = rate
+	}
+	c.last = now
+
+	c.tokens -= float64(n)
+	if c.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-c.tokens / rate * float64(time.Second))
+}
+
+// throttledResponseWriter delays writes to keep within the client's bandwidth
+type throttledResponseWriter struct {
+	http.ResponseWriter
+	quota *Quota
+	key   string
+	ctx   context.Context
+}
+
+func (w *throttledResponseWriter) Write(b []byte) (int, error) {
+	var written int
+
+	// Write in chunks of at most one second of bandwidth, so that
+	// concurrent responses to the client are interleaved
+	chunk := int(w.quota.bytesPerSec)
+	for len(b) > 0 {
+		n := len(b)
+		if n > chunk {
+			n = chunk
+		}
+
+		if wait := w.quota.reserve(w.key, n); wait > 0 {
+			select {
+			case <-time.After(wait):
+			case <-w.ctx.Done():
+				return written, w.ctx.Err()
+			}
+		}
+
+		m, err := w.ResponseWriter.Write(b[:n])
+		written += m
+		if err != nil {
+			return written, err
+		}
+
+		b = b[n:]
+	}
+
+	return written, nil
+}
@@ -0,0 +1,132 @@
+package httputil
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuotaMaxConns(t *testing.T) {
+	q := NewQuota(2, 0)
+
+	block := make(chan struct{})
+	started := make(chan struct{}, 3)
+	h := q.Handler(func(r *http.Request) string {
+		return r.RemoteAddr
+	}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-block
+	}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		}()
+		<-started
+	}
+
+	// A third concurrent request from the same client is rejected
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	require.Equal(t, ErrTooManyConcurrentRequests.Error(), strings.TrimSpace(w.Body.String()))
+
+	// The error response can be customized
+	var gotErr error
+	q.SetErrorFunc(func(w http.ResponseWriter, r *http.Request, status int, err error) {
+		gotErr = err
+		w.WriteHeader(status)
+	})
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	require.Equal(t, ErrTooManyConcurrentRequests, gotErr)
+	require.Empty(t, w.Body.String())
+
+	// Other clients are not affected
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	w = httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.ServeHTTP(w, req)
+	}()
+	<-started
+
+	close(block)
+	wg.Wait()
+	<-done
+	require.Equal(t, http.StatusOK, w.Code)
+
+	// Idle clients are forgotten
+	require.Empty(t, q.clients)
+}
+
+func TestQuotaBandwidth(t *testing.T) {
+	q := NewQuota(0, 1000)
+
+	body := strings.Repeat("a", 1500)
+	h := q.Handler(func(r *http.Request) string {
+		return r.RemoteAddr
+	}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := w.Write([]byte(body))
+		require.NoError(t, err)
+	}))
+
+	// The first 1000 bytes are the burst, the other 500 take 0.5s
+	t0 := time.Now()
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	elapsed := time.Since(t0)
+
+	require.Equal(t, body, w.Body.String())
+	require.True(t, elapsed >= 400*time.Millisecond, "elapsed %s", elapsed)
+	require.True(t, elapsed < 2*time.Second, "elapsed %s", elapsed)
+}
+
+func TestQuotaBandwidthBackToBack(t *testing.T) {
+	q := NewQuota(0, 1000)
+
+	body := strings.Repeat("a", 500)
+	h := q.Handler(func(r *http.Request) string {
+		return r.RemoteAddr
+	}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := w.Write([]byte(body))
+		require.NoError(t, err)
+	}))
+
+	// The first two requests use up the burst, the next ones wait for the bandwidth
+	// instead of starting with a new burst
+	t0 := time.Now()
+	for i := 0; i < 4; i++ {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		require.Equal(t, body, w.Body.String())
+	}
+	elapsed := time.Since(t0)
+
+	require.True(t, elapsed >= 900*time.Millisecond, "elapsed %s", elapsed)
+	require.True(t, elapsed < 3*time.Second, "elapsed %s", elapsed)
+
+	// The idle client is kept until its bandwidth has refilled
+	require.Len(t, q.clients, 1)
+
+	now := time.Now()
+	q.lastSweep = time.Time{}
+	q.sweep(now)
+	require.Len(t, q.clients, 1)
+
+	q.lastSweep = time.Time{}
+	q.sweep(now.Add(2 * time.Second))
+	require.Empty(t, q.clients)
+}
@@ -0,0 +1,58 @@
+package httputil
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/skycoin/teller/src/util/logger"
+)
+
+// RequestIDHeader is the header carrying the request ID
+const RequestIDHeader = "X-Request-ID"
+
+const maxRequestIDLen = 128
+
+// RequestIDHandler assigns a request ID to each request, and returns it in the X-Request-ID response header.
+// A valid X-Request-ID request header is honored, otherwise a random ID is generated.
+// The ID is put in the request context, see logger.RequestIDFromContext.
+// LogHandler adds it to the request logger, so it must wrap LogHandler.
+func RequestIDHandler(hd http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+
+		w.Header().Set(RequestIDHeader, id)
+
+		ctx := logger.WithRequestID(r.Context(), id)
+		hd.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// validRequestID accepts IDs of letters, digits and "-_.:", so they can't forge log lines
+func validRequestID(id string) bool {
+	if len(id) == 0 || len(id) > maxRequestIDLen {
+		return false
+	}
+
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,48 @@
+package httputil
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/util/logger"
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+func TestRequestIDHandler(t *testing.T) {
+	log, hook := testutil.NewLogger(t)
+
+	h := RequestIDHandler(LogHandler(log, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger.FromContext(r.Context()).Info("handled")
+	})))
+
+	// A valid incoming ID is honored
+	req := httptest.NewRequest(http.MethodGet, "/api/status", nil)
+	req.Header.Set(RequestIDHeader, "abc-123")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	require.Equal(t, "abc-123", w.Header().Get(RequestIDHeader))
+	for _, e := range hook.AllEntries() {
+		require.Equal(t, "abc-123", e.Data["requestID"])
+	}
+
+	// An invalid incoming ID is replaced
+	hook.Reset()
+	req = httptest.NewRequest(http.MethodGet, "/api/status", nil)
+	req.Header.Set(RequestIDHeader, "bad id\n")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	id := w.Header().Get(RequestIDHeader)
+	require.Len(t, id, 32)
+	require.Equal(t, id, hook.LastEntry().Data["requestID"])
+
+	// A new ID is generated for each request
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/status", nil))
+	require.Len(t, w.Header().Get(RequestIDHeader), 32)
+	require.NotEqual(t, id, w.Header().Get(RequestIDHeader))
+}
@@ -0,0 +1,332 @@
+// Package listenutil opens the listeners of the servers, on a TCP address, a unix socket,
+// or a socket passed by systemd socket activation. The open listeners can be passed to a new
+// process, which takes them over with the same addresses.
+package listenutil
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+const (
+	// UnixPrefix is the prefix of a unix socket address, e.g. unix:/run/teller/teller.sock
+	UnixPrefix = "unix:"
+	// SystemdPrefix is the prefix of a systemd socket address, e.g. systemd:http for the socket
+	// with FileDescriptorName=http. "systemd" alone is the first socket passed by systemd.
+	SystemdPrefix = "systemd"
+
+	// InheritedEnv is the environment variable with the JSON list of the addresses of the sockets
+	// passed to a new process, the first one on file descriptor 3
+	InheritedEnv = "TELLER_LISTEN_ADDRS"
+
+	// The file descriptor of the first socket passed by systemd, see sd_listen_fds(3)
+	listenFdsStart = 3
+)
+
+// ErrNoSystemdSocket is returned when listening on a systemd socket that systemd did not pass
+var ErrNoSystemdSocket = errors.New("socket not passed by systemd")
+
+// UnixSocketPath returns the path of a unix socket address, and false if addr is not one
+func UnixSocketPath(addr string) (string, bool) {
+	if !strings.HasPrefix(addr, UnixPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(addr, UnixPrefix), true
+}
+
+// SystemdSocketName returns the name of a systemd socket address, empty for the first socket,
+// and false if addr is not one
+func SystemdSocketName(addr string) (string, bool) {
+	switch {
+	case addr == SystemdPrefix:
+		return "", true
+	case strings.HasPrefix(addr, SystemdPrefix+":"):
+		return strings.TrimPrefix(addr, SystemdPrefix+":"), true
+	default:
+		return "", false
+	}
+}
+
+// ValidateAddr checks that addr is a host:port TCP address, a unix socket or a systemd socket address
+func ValidateAddr(addr string) error {
+	if path, ok := UnixSocketPath(addr); ok {
+		if path == "" {
+			return fmt.Errorf("%q is missing the socket path", addr)
+		}
+		return nil
+	}
+
+	if _, ok := SystemdSocketName(addr); ok {
+		return nil
+	}
+
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Listen listens on addr. A unix socket is created with permissions mode, replacing a stale socket file
+// left by a previous run. A systemd socket is taken from the sockets passed by systemd, each can be
+// listened on once. A socket passed by the process that started this one, on the same address, is
+// used instead of opening a new one.
+func Listen(addr string, mode os.FileMode) (net.Listener, error) {
+	ln, err := listen(addr, mode)
+	if err != nil {
+		return nil, err
+	}
+
+	return track(addr, ln), nil
+}
+
+func listen(addr string, mode os.FileMode) (net.Listener, error) {
+	if ln, ok, err := listenInherited(addr, false); ok {
+		return ln, err
+	}
+
+	if path, ok := UnixSocketPath(addr); ok {
+		return listenUnix(path, mode)
+	}
+
+	if name, ok := SystemdSocketName(addr); ok {
+		if ln, ok, err := listenInherited(addr, name == ""); ok {
+			return ln, err
+		}
+
+		if name == "" {
+			return nil, ErrNoSystemdSocket
+		}
+		return nil, fmt.Errorf("%v: %s", ErrNoSystemdSocket, name)
+	}
+
+	return net.Listen("tcp", addr)
+}
+
+func listenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	if fi, err := os.Stat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Chmod(path, mode); err != nil {
+		ln.Close()
+		return nil, err
+	}
+
+	return ln, nil
+}
+
+// inheritedSocket is a socket passed by systemd or by the process that started this one
+type inheritedSocket struct {
+	addr    string
+	systemd bool
+	file    *os.File
+}
+
+var (
+	inheritedOnce    sync.Once
+	inheritedLock    sync.Mutex
+	inheritedSockets []*inheritedSocket
+)
+
+// loadInherited takes the sockets passed by the process that started this one, or else by systemd.
+// Their environment variables are unset so that child processes don't use them.
+func loadInherited() {
+	defer os.Unsetenv(InheritedEnv) // nolint: errcheck
+
+	if v := os.Getenv(InheritedEnv); v != "" {
+		var addrs []string
+		if err := json.Unmarshal([]byte(v), &addrs); err != nil {
+			return
+		}
+
+		for i, addr := range addrs {
+			fd := uintptr(listenFdsStart + i)
+			inheritedSockets = append(inheritedSockets, &inheritedSocket{
+				addr: addr,
+				file: os.NewFile(fd, fmt.Sprintf("inherited socket %d %s", fd, addr)),
+			})
+		}
+
+		return
+	}
+
+	loadSystemdSockets()
+}
+
+// loadSystemdSockets takes the sockets passed by systemd with the LISTEN_PID, LISTEN_FDS
+// and LISTEN_FDNAMES environment variables
+func loadSystemdSockets() {
+	defer os.Unsetenv("LISTEN_PID")     // nolint: errcheck
+	defer os.Unsetenv("LISTEN_FDS")     // nolint: errcheck
+	defer os.Unsetenv("LISTEN_FDNAMES") // nolint: errcheck
+
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return
+	}
+
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return
+	}
+
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	for i := 0; i < n; i++ {
+		var name string
+		if i < len(names) {
+			name = names[i]
+		}
+
+		fd := uintptr(listenFdsStart + i)
+		inheritedSockets = append(inheritedSockets, &inheritedSocket{
+			addr:    SystemdPrefix + ":" + name,
+			systemd: true,
+			file:    os.NewFile(fd, fmt.Sprintf("systemd socket %d %s", fd, name)),
+		})
+	}
+}
+
+// listenInherited listens on the unused inherited socket with address addr, or on the first unused
+// systemd socket if anySystemd is true. It returns false if there is no such socket.
+func listenInherited(addr string, anySystemd bool) (net.Listener, bool, error) {
+	inheritedOnce.Do(loadInherited)
+
+	inheritedLock.Lock()
+	defer inheritedLock.Unlock()
+
+	for _, s := range inheritedSockets {
+		if s.file == nil || (s.addr != addr && !(anySystemd && s.systemd)) {
+			continue
+		}
+
+		ln, err := net.FileListener(s.file)
+		if err != nil {
+			return nil, true, err
+		}
+
+		// FileListener dups the file descriptor
+		s.file.Close()
+		s.file = nil
+
+		return ln, true, nil
+	}
+
+	return nil, false, nil
+}
+
+// trackedListener is an open listener, which can be passed to a new process until it is closed
+type trackedListener struct {
+	net.Listener
+	addr string
+}
+
+var (
+	trackedLock sync.Mutex
+	tracked     = make(map[*trackedListener]struct{})
+)
+
+func track(addr string, ln net.Listener) net.Listener {
+	l := &trackedListener{
+		Listener: ln,
+		addr:     addr,
+	}
+
+	trackedLock.Lock()
+	defer trackedLock.Unlock()
+	tracked[l] = struct{}{}
+
+	return l
+}
+
+// Close closes the listener, which is no longer passed to new processes
+func (l *trackedListener) Close() error {
+	trackedLock.Lock()
+	delete(tracked, l)
+	trackedLock.Unlock()
+
+	return l.Listener.Close()
+}
+
+// Files returns the addresses and duplicated files of the open listeners, to pass them to a new process
+// with InheritedEnv. The caller closes the files. Unix sockets are no longer removed when their listener
+// is closed, since the new process keeps listening on them.
+func Files() ([]string, []*os.File, error) {
+	trackedLock.Lock()
+	defer trackedLock.Unlock()
+
+	var addrs []string
+	var files []*os.File
+	for l := range tracked {
+		var f *os.File
+		var err error
+		switch ln := l.Listener.(type) {
+		case *net.TCPListener:
+			f, err = ln.File()
+		case *net.UnixListener:
+			ln.SetUnlinkOnClose(false)
+			f, err = ln.File()
+		default:
+			err = fmt.Errorf("can't pass the %T listener of %s", ln, l.addr)
+		}
+
+		if err != nil {
+			for _, f := range files {
+				f.Close()
+			}
+			return nil, nil, err
+		}
+
+		addrs = append(addrs, l.addr)
+		files = append(files, f)
+	}
+
+	return addrs, files, nil
+}
+
+// SetNonblock puts the open listeners back in non-blocking mode after their files were passed to a
+// new process. os/exec puts the files, which share the socket with the listeners, in blocking mode,
+// and an Accept blocked on a blocking socket isn't interrupted when the listener is closed.
+func SetNonblock() error {
+	trackedLock.Lock()
+	defer trackedLock.Unlock()
+
+	for l := range tracked {
+		sc, ok := l.Listener.(syscall.Conn)
+		if !ok {
+			continue
+		}
+
+		rc, err := sc.SyscallConn()
+		if err != nil {
+			return err
+		}
+
+		var nbErr error
+		if err := rc.Control(func(fd uintptr) {
+			nbErr = syscall.SetNonblock(int(fd), true)
+		}); err != nil {
+			return err
+		}
+		if nbErr != nil {
+			return nbErr
+		}
+	}
+
+	return nil
+}
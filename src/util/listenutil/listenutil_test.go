@@ -0,0 +1,157 @@
+package listenutil
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateAddr(t *testing.T) {
+	for _, addr := range []string{
+		"127.0.0.1:7071",
+		":7071",
+		"[::1]:7071",
+		"unix:/run/teller/teller.sock",
+		"unix:teller.sock",
+		"systemd",
+		"systemd:http",
+	} {
+		require.NoError(t, ValidateAddr(addr), addr)
+	}
+
+	for _, addr := range []string{
+		"127.0.0.1",
+		"unix:",
+		"/run/teller/teller.sock",
+	} {
+		require.Error(t, ValidateAddr(addr), addr)
+	}
+}
+
+func TestListenUnix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "listenutil")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "teller.sock")
+
+	ln, err := Listen(UnixPrefix+path, 0660)
+	require.NoError(t, err)
+
+	fi, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0660), fi.Mode().Perm())
+
+	go func() {
+		c, err := ln.Accept()
+		if err == nil {
+			c.Write([]byte("ok")) // nolint: errcheck
+			c.Close()
+		}
+	}()
+
+	c, err := net.Dial("unix", path)
+	require.NoError(t, err)
+	b, err := ioutil.ReadAll(c)
+	require.NoError(t, err)
+	require.Equal(t, "ok", string(b))
+	c.Close()
+
+	// A stale socket file, e.g. after a crash, is replaced
+	ln.(*trackedListener).Listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	require.NoError(t, ln.Close())
+	_, err = os.Stat(path)
+	require.NoError(t, err)
+
+	ln, err = Listen(UnixPrefix+path, 0600)
+	require.NoError(t, err)
+	defer ln.Close()
+
+	fi, err = os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+
+	// Other files are not removed
+	other := filepath.Join(dir, "other")
+	require.NoError(t, ioutil.WriteFile(other, nil, 0600))
+	_, err = Listen(UnixPrefix+other, 0600)
+	require.Error(t, err)
+}
+
+func TestListenSystemdNotPassed(t *testing.T) {
+	_, err := Listen("systemd:http", 0)
+	require.Error(t, err)
+
+	_, err = Listen("systemd", 0)
+	require.Equal(t, ErrNoSystemdSocket, err)
+}
+
+func TestFilesInherited(t *testing.T) {
+	ln, err := Listen("127.0.0.1:0", 0)
+	require.NoError(t, err)
+	addr := ln.Addr().String()
+
+	addrs, files, err := Files()
+	require.NoError(t, err)
+	require.Equal(t, []string{"127.0.0.1:0"}, addrs)
+	require.Len(t, files, 1)
+
+	// Fd, which os/exec passes the files with, puts the socket in blocking mode
+	files[0].Fd()
+	require.NoError(t, SetNonblock())
+	closed := make(chan error, 1)
+	go func() {
+		_, err := ln.Accept()
+		closed <- err
+	}()
+
+	// A new process takes over the socket with the same address after the listener is closed
+	inheritedOnce.Do(func() {})
+	inheritedSockets = []*inheritedSocket{{
+		addr: addrs[0],
+		file: files[0],
+	}}
+	defer func() {
+		inheritedSockets = nil
+	}()
+
+	// A pending Accept returns when the listener is closed
+	time.Sleep(50 * time.Millisecond)
+	require.NoError(t, ln.Close())
+	require.Error(t, <-closed)
+
+	_, files, err = Files()
+	require.NoError(t, err)
+	require.Empty(t, files)
+
+	ln, err = Listen("127.0.0.1:0", 0)
+	require.NoError(t, err)
+	defer ln.Close()
+	require.Equal(t, addr, ln.Addr().String())
+
+	go func() {
+		c, err := ln.Accept()
+		if err == nil {
+			c.Write([]byte("ok")) // nolint: errcheck
+			c.Close()
+		}
+	}()
+
+	c, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	b, err := ioutil.ReadAll(c)
+	require.NoError(t, err)
+	require.Equal(t, "ok", string(b))
+	c.Close()
+
+	// Each socket is taken once
+	ln2, err := Listen("127.0.0.1:0", 0)
+	require.NoError(t, err)
+	defer ln2.Close()
+	require.NotEqual(t, addr, ln2.Addr().String())
+}
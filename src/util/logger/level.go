@@ -0,0 +1,61 @@
+package logger
+
+import (
+	"errors"
+	"sync/atomic"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ErrInvalidLevel is returned by LevelSetter.SetLevel for a level other than debug, info or warning
+var ErrInvalidLevel = errors.New("Invalid log level, must be debug, info or warn")
+
+// LevelSetter changes the level of a logrus.Logger while it is logging, e.g. to log the debug entries
+// of the scanner and exchange during an incident without restarting
+type LevelSetter struct {
+	log          *logrus.Logger
+	initialLevel logrus.Level
+}
+
+// NewLevelSetter creates a LevelSetter for log. The level of log when NewLevelSetter is called is
+// the level Toggle switches back to from logrus.DebugLevel.
+func NewLevelSetter(log *logrus.Logger) *LevelSetter {
+	l := &LevelSetter{
+		log: log,
+	}
+	l.initialLevel = l.GetLevel()
+	return l
+}
+
+// GetLevel returns the level of the logger
+func (l *LevelSetter) GetLevel() logrus.Level {
+	return logrus.Level(atomic.LoadUint32((*uint32)(&l.log.Level)))
+}
+
+// SetLevel sets the level of the logger to logrus.DebugLevel, logrus.InfoLevel or logrus.WarnLevel
+func (l *LevelSetter) SetLevel(level logrus.Level) error {
+	switch level {
+	case logrus.DebugLevel, logrus.InfoLevel, logrus.WarnLevel:
+	default:
+		return ErrInvalidLevel
+	}
+
+	l.log.SetLevel(level)
+	return nil
+}
+
+// Toggle sets the level to logrus.DebugLevel, or if it is logrus.DebugLevel, back to the initial level.
+// If the initial level is logrus.DebugLevel, Toggle switches between it and logrus.InfoLevel.
+// It returns the new level.
+func (l *LevelSetter) Toggle() logrus.Level {
+	level := logrus.DebugLevel
+	if l.GetLevel() == logrus.DebugLevel {
+		level = l.initialLevel
+		if level == logrus.DebugLevel {
+			level = logrus.InfoLevel
+		}
+	}
+
+	l.log.SetLevel(level)
+	return level
+}
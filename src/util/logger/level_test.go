@@ -0,0 +1,35 @@
+package logger
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLevelSetter(t *testing.T) {
+	log := logrus.New()
+	log.Level = logrus.InfoLevel
+
+	l := NewLevelSetter(log)
+	require.Equal(t, logrus.InfoLevel, l.GetLevel())
+
+	require.NoError(t, l.SetLevel(logrus.WarnLevel))
+	require.Equal(t, logrus.WarnLevel, l.GetLevel())
+	require.Equal(t, logrus.WarnLevel, log.Level)
+
+	require.Equal(t, ErrInvalidLevel, l.SetLevel(logrus.PanicLevel))
+	require.Equal(t, logrus.WarnLevel, l.GetLevel())
+
+	// Toggle switches to debug, then back to the initial level
+	require.Equal(t, logrus.DebugLevel, l.Toggle())
+	require.Equal(t, logrus.DebugLevel, l.GetLevel())
+	require.Equal(t, logrus.InfoLevel, l.Toggle())
+	require.Equal(t, logrus.InfoLevel, l.GetLevel())
+
+	// A logger started in debug toggles to info
+	log.Level = logrus.DebugLevel
+	l = NewLevelSetter(log)
+	require.Equal(t, logrus.InfoLevel, l.Toggle())
+	require.Equal(t, logrus.DebugLevel, l.Toggle())
+}
@@ -6,6 +6,7 @@ import (
 	"os"
 	"path"
 	"runtime"
+	"runtime/debug"
 	"strings"
 
 	prefixed "github.com/gz-c/logrus-prefixed-formatter"
@@ -14,7 +15,10 @@ import (
 
 type ctxKey int
 
-const loggerCtxKey ctxKey = iota
+const (
+	loggerCtxKey ctxKey = iota
+	requestIDCtxKey
+)
 
 // FromContext return a *logrus.Logger from a context
 func FromContext(ctx context.Context) logrus.FieldLogger {
@@ -31,11 +35,83 @@ func WithContext(ctx context.Context, lg logrus.FieldLogger) context.Context {
 	return context.WithValue(ctx, loggerCtxKey, lg)
 }
 
+// WithRequestID puts a request ID into a context
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDCtxKey, id)
+}
+
+// RequestIDFromContext returns the request ID of a context, or the empty string if it has none
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDCtxKey).(string)
+	return id
+}
+
+// WithRequestIDField adds the "requestID" field of ctx's request ID to log, if ctx has a request ID
+func WithRequestIDField(ctx context.Context, log logrus.FieldLogger) logrus.FieldLogger {
+	if id := RequestIDFromContext(ctx); id != "" {
+		return log.WithField("requestID", id)
+	}
+	return log
+}
+
+// LogPanic logs a panic of the calling goroutine at logrus.PanicLevel, with its stack, then panics again.
+// Use it as `defer logger.LogPanic(log)` at the start of a goroutine, so that a panic reaches
+// the log hooks, e.g. error reporting, before the program crashes.
+func LogPanic(log logrus.FieldLogger) {
+	p := recover()
+	if p == nil {
+		return
+	}
+
+	func() {
+		// logrus panics with the log entry after logging it
+		defer func() {
+			recover()
+		}()
+		log.WithField("stack", string(debug.Stack())).Panicf("Panic: %v", p)
+	}()
+
+	panic(p)
+}
+
+// AuditField is the field of the log entries of the audit log, see Audit
+const AuditField = "audit"
+
+// Audit marks the entries logged by log as security relevant, e.g. binds, admin actions and sends.
+// They are logged as usual, and also written to the audit log if Config.AuditFilename is set.
+func Audit(log logrus.FieldLogger) logrus.FieldLogger {
+	return log.WithField(AuditField, true)
+}
+
+// Config configures the logrus.Logger created by New
+type Config struct {
+	// If Debug is true, the log level is logrus.DebugLevel, otherwise logrus.InfoLevel
+	Debug bool
+	// Log in JSON instead of text, one object per line
+	JSON bool
+	// If Filename is not the empty string, logs are also written to that file, rotated by Rotate
+	Filename string
+	// If AuditFilename is not the empty string, the entries marked by Audit are also written to that file
+	// in JSON, rotated by Rotate
+	AuditFilename string
+	Rotate        RotateConfig
+	// If Scrub is not nil, the addresses and IPs of the log fields are scrubbed, except in the audit log
+	Scrub *ScrubConfig
+}
+
 // NewLogger creates a logrus.Logger, which logs to os.Stdout.
 // If debug is true, the log level is logrus.DebugLevel, otherwise logrus.InfoLevel.
 // If logFilename is not the empty string, logs will also be written to that file,
 // in addition to os.Stdout.
 func NewLogger(logFilename string, debug bool) (*logrus.Logger, error) {
+	return New(Config{
+		Filename: logFilename,
+		Debug:    debug,
+	})
+}
+
+// New creates a logrus.Logger configured by cfg, which logs to os.Stdout
+func New(cfg Config) (*logrus.Logger, error) {
 	log := logrus.New()
 	log.Out = os.Stdout
 	log.Formatter = &prefixed.TextFormatter{
@@ -44,18 +120,55 @@ func NewLogger(logFilename string, debug bool) (*logrus.Logger, error) {
 		QuoteEmptyFields:   true,
 		ForceFormatting:    true,
 	}
+	if cfg.JSON {
+		log.Formatter = newJSONFormatter()
+	}
 	log.Level = logrus.InfoLevel
 
-	if debug {
+	if cfg.Debug {
 		log.Level = logrus.DebugLevel
 	}
 
-	if logFilename != "" {
-		hook, err := NewFileWriteHook(logFilename)
+	var scrubHook *ScrubHook
+	if cfg.Scrub != nil {
+		var err error
+		scrubHook, err = NewScrubHook(*cfg.Scrub)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.AuditFilename != "" {
+		f, err := NewRotatingFile(cfg.AuditFilename, cfg.Rotate)
+		if err != nil {
+			return nil, err
+		}
+
+		log.Hooks.Add(&AuditHook{
+			w:         f,
+			formatter: newJSONFormatter(),
+		})
+	}
+
+	// Hooks fire in the order they are added, the audit log is written before the fields are scrubbed
+	if scrubHook != nil {
+		log.Hooks.Add(scrubHook)
+	}
+
+	if cfg.Filename != "" {
+		f, err := NewRotatingFile(cfg.Filename, cfg.Rotate)
 		if err != nil {
 			return nil, err
 		}
 
+		hook := NewWriteHook(f, &TextFormatter{
+			DisableColors: true,
+			FullTimestamp: true,
+		})
+		if cfg.JSON {
+			hook = NewWriteHook(f, newJSONFormatter())
+		}
+
 		log.Hooks.Add(hook)
 	}
 
@@ -72,6 +185,14 @@ type WriteHook struct {
 	formatter logrus.Formatter
 }
 
+// NewWriteHook returns a new WriteHook for an io.Writer
+func NewWriteHook(w io.Writer, formatter logrus.Formatter) *WriteHook {
+	return &WriteHook{
+		w:         w,
+		formatter: formatter,
+	}
+}
+
 // NewFileWriteHook returns a new WriteHook for a file
 func NewFileWriteHook(filename string) (*WriteHook, error) {
 	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
@@ -117,6 +238,39 @@ func (f *WriteHook) Fire(e *logrus.Entry) error {
 	return err
 }
 
+// AuditHook is a logrus.Hook that writes the entries marked by Audit to an io.Writer
+type AuditHook struct {
+	w         io.Writer
+	formatter logrus.Formatter
+}
+
+// Levels returns logrus.AllLevels
+func (h *AuditHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire writes a logrus.Entry to the writer, if it is marked by Audit
+func (h *AuditHook) Fire(e *logrus.Entry) error {
+	if audit, _ := e.Data[AuditField].(bool); !audit {
+		return nil
+	}
+
+	b, err := h.formatter.Format(e)
+	if err != nil {
+		return err
+	}
+
+	_, err = h.w.Write(b)
+	return err
+}
+
+// newJSONFormatter returns the formatter of JSON logs, with RFC 3339 timestamps in milliseconds
+func newJSONFormatter() *logrus.JSONFormatter {
+	return &logrus.JSONFormatter{
+		TimestampFormat: "2006-01-02T15:04:05.000Z07:00",
+	}
+}
+
 // ContextHook adds "file", "func", "lineno" context to log lines
 type ContextHook struct {
 	ExcludeFile bool
@@ -2,8 +2,15 @@ package logger
 
 import (
 	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/sirupsen/logrus"
+	logrus_test "github.com/sirupsen/logrus/hooks/test"
 	"github.com/stretchr/testify/require"
 )
 
@@ -17,3 +24,80 @@ func TestContext(t *testing.T) {
 	ctx = WithContext(ctx, log)
 	require.NotNil(t, FromContext(ctx))
 }
+
+func TestLogPanic(t *testing.T) {
+	log, err := NewLogger("", true)
+	require.NoError(t, err)
+	hook := logrus_test.NewLocal(log)
+
+	// The panic is logged, then the goroutine panics again with the same value
+	var p interface{}
+	func() {
+		defer func() {
+			p = recover()
+		}()
+		defer LogPanic(log.WithField("prefix", "test"))
+		panic("boom")
+	}()
+	require.Equal(t, "boom", p)
+
+	require.Len(t, hook.AllEntries(), 1)
+	e := hook.LastEntry()
+	require.Equal(t, logrus.PanicLevel, e.Level)
+	require.Equal(t, "Panic: boom", e.Message)
+	require.Contains(t, e.Data["stack"], "TestLogPanic")
+
+	// Nothing is logged without a panic
+	hook.Reset()
+	func() {
+		defer LogPanic(log)
+	}()
+	require.Empty(t, hook.AllEntries())
+}
+
+func TestAudit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logger")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	log, err := New(Config{
+		JSON:          true,
+		Filename:      filepath.Join(dir, "teller.log"),
+		AuditFilename: filepath.Join(dir, "audit.log"),
+	})
+	require.NoError(t, err)
+	log.Out = ioutil.Discard
+
+	plog := log.WithField("prefix", "teller.exchange")
+	plog.Info("Received deposit")
+	Audit(plog).WithField("txid", "abc").Info("Sent skycoin")
+
+	readLines := func(name string) []map[string]interface{} {
+		b, err := ioutil.ReadFile(filepath.Join(dir, name))
+		require.NoError(t, err)
+
+		var lines []map[string]interface{}
+		for _, l := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+			var v map[string]interface{}
+			require.NoError(t, json.Unmarshal([]byte(l), &v))
+			lines = append(lines, v)
+		}
+		return lines
+	}
+
+	// Every entry is logged in JSON
+	lines := readLines("teller.log")
+	require.Len(t, lines, 2)
+	require.Equal(t, "Received deposit", lines[0]["msg"])
+	require.Equal(t, "info", lines[0]["level"])
+	require.Equal(t, "teller.exchange", lines[0]["prefix"])
+	require.NotEmpty(t, lines[0]["time"])
+	require.Equal(t, "Sent skycoin", lines[1]["msg"])
+
+	// Only the entries marked by Audit are in the audit log
+	lines = readLines("audit.log")
+	require.Len(t, lines, 1)
+	require.Equal(t, "Sent skycoin", lines[0]["msg"])
+	require.Equal(t, true, lines[0][AuditField])
+	require.Equal(t, "abc", lines[0]["txid"])
+}
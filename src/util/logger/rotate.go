@@ -0,0 +1,168 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const rotatedTimeFormat = "20060102-150405.000"
+
+// RotateConfig configures the rotation of a RotatingFile
+type RotateConfig struct {
+	// The file is rotated before it grows larger than MaxSize bytes, 0 for no limit
+	MaxSize int64
+	// The file is rotated once it has been written to for MaxAge since it was opened, 0 for no limit
+	MaxAge time.Duration
+	// Number of rotated files that are kept, the oldest are deleted. 0 keeps all of them.
+	MaxBackups int
+}
+
+// RotatingFile is an io.Writer appending to a file, which is rotated by its size and age.
+// A rotated file is renamed with the time of the rotation appended, e.g. teller.log.20180102-150405.000
+type RotatingFile struct {
+	filename string
+	cfg      RotateConfig
+	lock     sync.Mutex
+	f        *os.File
+	size     int64
+	openedAt time.Time
+	now      func() time.Time
+}
+
+// NewRotatingFile opens a RotatingFile, appending to filename if it exists
+func NewRotatingFile(filename string, cfg RotateConfig) (*RotatingFile, error) {
+	r := &RotatingFile{
+		filename: filename,
+		cfg:      cfg,
+		now:      time.Now,
+	}
+
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Write writes b to the file, rotating the file first if b would exceed its size or the file is too old
+func (r *RotatingFile) Write(b []byte) (int, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.shouldRotate(int64(len(b))) {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := r.f.Write(b)
+	r.size += int64(n)
+	return n, err
+}
+
+// Close closes the file
+func (r *RotatingFile) Close() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.f.Close()
+}
+
+// shouldRotate returns true if writing n bytes would exceed cfg.MaxSize, or the file is older than cfg.MaxAge.
+// An empty file is never rotated, so that a write larger than cfg.MaxSize is written to a file of its own.
+func (r *RotatingFile) shouldRotate(n int64) bool {
+	if r.size == 0 {
+		return false
+	}
+
+	if r.cfg.MaxSize > 0 && r.size+n > r.cfg.MaxSize {
+		return true
+	}
+
+	return r.cfg.MaxAge > 0 && r.now().Sub(r.openedAt) >= r.cfg.MaxAge
+}
+
+func (r *RotatingFile) open() error {
+	f, err := os.OpenFile(r.filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	r.f = f
+	r.size = st.Size()
+	r.openedAt = r.now()
+	return nil
+}
+
+// rotate renames the file with the current time appended, opens a new file, and deletes the oldest rotated files
+func (r *RotatingFile) rotate() error {
+	if err := r.f.Close(); err != nil {
+		return err
+	}
+
+	rotated := fmt.Sprintf("%s.%s", r.filename, r.now().UTC().Format(rotatedTimeFormat))
+	if err := os.Rename(r.filename, rotated); err != nil {
+		return err
+	}
+
+	if err := r.open(); err != nil {
+		return err
+	}
+
+	return r.prune()
+}
+
+// prune deletes the oldest rotated files beyond cfg.MaxBackups
+func (r *RotatingFile) prune() error {
+	if r.cfg.MaxBackups <= 0 {
+		return nil
+	}
+
+	rotated, err := r.rotatedFiles()
+	if err != nil {
+		return err
+	}
+
+	if len(rotated) <= r.cfg.MaxBackups {
+		return nil
+	}
+
+	for _, f := range rotated[:len(rotated)-r.cfg.MaxBackups] {
+		if err := os.Remove(f); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// rotatedFiles returns the rotated files of the file, oldest first
+func (r *RotatingFile) rotatedFiles() ([]string, error) {
+	matches, err := filepath.Glob(r.filename + ".*")
+	if err != nil {
+		return nil, err
+	}
+
+	var rotated []string
+	for _, m := range matches {
+		suffix := strings.TrimPrefix(m, r.filename+".")
+		if _, err := time.Parse(rotatedTimeFormat, suffix); err == nil {
+			rotated = append(rotated, m)
+		}
+	}
+
+	// The time format sorts chronologically
+	sort.Strings(rotated)
+
+	return rotated, nil
+}
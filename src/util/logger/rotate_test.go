@@ -0,0 +1,77 @@
+package logger
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRotatingFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotate")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "teller.log")
+
+	// Writes are appended to an existing file
+	require.NoError(t, ioutil.WriteFile(filename, []byte("0123"), 0600))
+
+	now := time.Date(2018, 1, 2, 15, 4, 5, 0, time.UTC)
+	f, err := NewRotatingFile(filename, RotateConfig{
+		MaxSize:    10,
+		MaxAge:     time.Hour,
+		MaxBackups: 2,
+	})
+	require.NoError(t, err)
+	f.now = func() time.Time { return now }
+	f.openedAt = now
+	defer f.Close()
+
+	n, err := f.Write([]byte("456789"))
+	require.NoError(t, err)
+	require.Equal(t, 6, n)
+
+	readFile := func(name string) string {
+		b, err := ioutil.ReadFile(name)
+		require.NoError(t, err)
+		return string(b)
+	}
+
+	require.Equal(t, "0123456789", readFile(filename))
+
+	// The file is rotated before it exceeds MaxSize
+	_, err = f.Write([]byte("a"))
+	require.NoError(t, err)
+	require.Equal(t, "a", readFile(filename))
+	require.Equal(t, "0123456789", readFile(filename+".20180102-150405.000"))
+
+	// A write larger than MaxSize is written to a file of its own
+	now = now.Add(time.Second)
+	_, err = f.Write([]byte("bcdefghijklm"))
+	require.NoError(t, err)
+	require.Equal(t, "bcdefghijklm", readFile(filename))
+	require.Equal(t, "a", readFile(filename+".20180102-150406.000"))
+
+	// The file is rotated once it is older than MaxAge, and the oldest rotated files beyond MaxBackups are deleted
+	now = now.Add(time.Second)
+	_, err = f.Write([]byte("n"))
+	require.NoError(t, err)
+	require.Equal(t, "bcdefghijklm", readFile(filename+".20180102-150407.000"))
+
+	now = now.Add(time.Hour)
+	_, err = f.Write([]byte("o"))
+	require.NoError(t, err)
+	require.Equal(t, "o", readFile(filename))
+	require.Equal(t, "n", readFile(filename+".20180102-160407.000"))
+
+	rotated, err := f.rotatedFiles()
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		filename + ".20180102-150407.000",
+		filename + ".20180102-160407.000",
+	}, rotated)
+}
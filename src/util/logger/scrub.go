@@ -0,0 +1,348 @@
+package logger
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// ScrubHash replaces the identifiers with a keyed hash, the same identifier always has the same hash
+	ScrubHash = "hash"
+	// ScrubTruncate keeps the first characters of the identifiers
+	ScrubTruncate = "truncate"
+
+	// scrubHashPrefix marks the hashed identifiers
+	scrubHashPrefix = "h:"
+	// scrubHashLen is the number of hex characters of the hash kept
+	scrubHashLen = 16
+	// scrubTruncateLen is the number of characters of the truncated identifiers kept
+	scrubTruncateLen = 4
+	// scrubMaxDepth bounds the walk of the fields, in case of cycles
+	scrubMaxDepth = 8
+)
+
+// scrubFields are the names of the fields holding addresses and IPs, lowercase without "_" and "-".
+// They are matched against the log fields, and the names and json names of the fields of the structs
+// and maps logged.
+var scrubFields = map[string]struct{}{
+	"addr":              {},
+	"addrs":             {},
+	"address":           {},
+	"addresses":         {},
+	"skyaddr":           {},
+	"skyaddrs":          {},
+	"skyaddress":        {},
+	"skyaddresses":      {},
+	"skycoinaddr":       {},
+	"skycoinaddrs":      {},
+	"skycoinaddress":    {},
+	"skycoinaddresses":  {},
+	"btcaddr":           {},
+	"btcaddrs":          {},
+	"btcaddress":        {},
+	"btcaddresses":      {},
+	"ltcaddr":           {},
+	"ltcaddrs":          {},
+	"ltcaddress":        {},
+	"ltcaddresses":      {},
+	"ethaddr":           {},
+	"ethaddrs":          {},
+	"ethaddress":        {},
+	"ethaddresses":      {},
+	"depositaddr":       {},
+	"depositaddrs":      {},
+	"depositaddress":    {},
+	"depositaddresses":  {},
+	"scanningaddrs":     {},
+	"scanningaddresses": {},
+	"owneraddress":      {},
+	"remoteaddr":        {},
+	"remoteaddrs":       {},
+	"remoteaddress":     {},
+	"ip":                {},
+	"ips":               {},
+	"clientip":          {},
+	"clientips":         {},
+	"email":             {},
+	"emails":            {},
+}
+
+func isScrubField(name string) bool {
+	name = strings.ToLower(name)
+	name = strings.Replace(name, "_", "", -1)
+	name = strings.Replace(name, "-", "", -1)
+	_, ok := scrubFields[name]
+	return ok
+}
+
+// ScrubConfig configures the ScrubHook
+type ScrubConfig struct {
+	// Mode is ScrubHash or ScrubTruncate
+	Mode string
+	// Secret keys the hash of ScrubHash, so that the hashes can't be reversed by hashing known addresses
+	Secret string
+}
+
+// ScrubHook is a logrus.Hook that hashes or truncates the skycoin, deposit and IP addresses of the log fields,
+// including the fields of the structs logged, e.g. a DepositInfo. The log messages and errors are not scrubbed.
+// Hooks fired before it, e.g. the AuditHook, see the original fields.
+type ScrubHook struct {
+	cfg ScrubConfig
+}
+
+// NewScrubHook creates a ScrubHook
+func NewScrubHook(cfg ScrubConfig) (*ScrubHook, error) {
+	switch cfg.Mode {
+	case ScrubHash:
+		if cfg.Secret == "" {
+			return nil, errors.New("scrub secret missing")
+		}
+	case ScrubTruncate:
+	default:
+		return nil, fmt.Errorf("scrub mode must be %q or %q", ScrubHash, ScrubTruncate)
+	}
+
+	return &ScrubHook{
+		cfg: cfg,
+	}, nil
+}
+
+// Scrub returns the scrubbed form of an identifier, as it appears in the logs.
+// Support can find the log entries of an address by scrubbing it.
+func (h *ScrubHook) Scrub(s string) string {
+	if s == "" {
+		return s
+	}
+
+	if h.cfg.Mode == ScrubTruncate {
+		if len(s) <= scrubTruncateLen {
+			return "..."
+		}
+		return s[:scrubTruncateLen] + "..."
+	}
+
+	mac := hmac.New(sha256.New, []byte(h.cfg.Secret))
+	mac.Write([]byte(s)) // nolint: errcheck
+	return scrubHashPrefix + hex.EncodeToString(mac.Sum(nil))[:scrubHashLen]
+}
+
+// Levels returns logrus.AllLevels
+func (h *ScrubHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire replaces the fields of the logrus.Entry holding identifiers with their scrubbed values
+func (h *ScrubHook) Fire(e *logrus.Entry) error {
+	var data logrus.Fields
+	for k, v := range e.Data {
+		sv, ok := h.scrub(k, v)
+		if !ok {
+			continue
+		}
+
+		// The entry.Data map must be copied before writing to, it is not
+		// thread safe.
+		if data == nil {
+			data = make(logrus.Fields, len(e.Data))
+			for k, v := range e.Data {
+				data[k] = v
+			}
+		}
+		data[k] = sv
+	}
+
+	if data != nil {
+		e.Data = data
+	}
+
+	return nil
+}
+
+// scrub returns the scrubbed value of a field and true, or false if it has nothing to scrub
+func (h *ScrubHook) scrub(name string, v interface{}) (interface{}, bool) {
+	if v == nil {
+		return nil, false
+	}
+
+	// Errors are logged by their message
+	if _, ok := v.(error); ok {
+		return nil, false
+	}
+
+	return h.walk(reflect.ValueOf(v), isScrubField(name), 0)
+}
+
+// walk returns the scrubbed value of v and true, or false if it has nothing to scrub.
+// If scrub is true, v is the value of a field named by scrubFields, and its strings are scrubbed.
+// Structs and maps with something to scrub are returned as a map[string]interface{} of their exported fields,
+// keyed as encoding/json would, so that the JSON logs keep their shape, and slices and arrays as a []interface{}.
+func (h *ScrubHook) walk(v reflect.Value, scrub bool, depth int) (interface{}, bool) {
+	if !v.IsValid() || depth > scrubMaxDepth {
+		return nil, false
+	}
+
+	if scrub {
+		if v.Kind() == reflect.String {
+			if v.Len() == 0 {
+				return nil, false
+			}
+			return h.Scrub(v.String()), true
+		}
+
+		// e.g. a cipher.Address. Embedded unexported structs can't be read as a whole
+		if v.CanInterface() {
+			if s, ok := v.Interface().(fmt.Stringer); ok && v.Kind() != reflect.Ptr {
+				return h.Scrub(s.String()), true
+			}
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil, false
+		}
+		return h.walk(v.Elem(), scrub, depth+1)
+
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return nil, false
+		}
+
+		out := make([]interface{}, v.Len())
+		var changed bool
+		for i := 0; i < v.Len(); i++ {
+			x, ok := h.walk(v.Index(i), scrub, depth+1)
+			if ok {
+				changed = true
+			} else {
+				x = v.Index(i).Interface()
+			}
+			out[i] = x
+		}
+		return out, changed
+
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil, false
+		}
+
+		out := make(map[string]interface{}, v.Len())
+		var changed bool
+		for _, k := range v.MapKeys() {
+			x, ok := h.walk(v.MapIndex(k), scrub || isScrubField(k.String()), depth+1)
+			if ok {
+				changed = true
+			} else {
+				x = v.MapIndex(k).Interface()
+			}
+			out[k.String()] = x
+		}
+		return out, changed
+
+	case reflect.Struct:
+		out := make(map[string]interface{}, v.NumField())
+		var changed bool
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Type().Field(i)
+			name, omitEmpty, ok := jsonFieldName(f)
+			if !ok {
+				continue
+			}
+
+			// Unexported fields can't be read, except the exported fields of embedded structs,
+			// and channels and funcs can't be logged
+			if f.PkgPath != "" && !(f.Anonymous && f.Type.Kind() == reflect.Struct) {
+				continue
+			}
+			switch f.Type.Kind() {
+			case reflect.Chan, reflect.Func:
+				continue
+			}
+
+			fv := v.Field(i)
+			if omitEmpty && isEmptyValue(fv) {
+				continue
+			}
+
+			// The fields of embedded structs without a json name are promoted, the fields of the struct taking precedence
+			if f.Anonymous && strings.SplitN(f.Tag.Get("json"), ",", 2)[0] == "" {
+				ft := f.Type
+				if ft.Kind() == reflect.Ptr {
+					ft = ft.Elem()
+				}
+
+				if ft.Kind() == reflect.Struct {
+					// m is nil if fv is a nil pointer
+					x, ok := h.walk(fv, scrub, depth+1)
+					m, _ := x.(map[string]interface{})
+					changed = changed || ok
+					for k, x := range m {
+						if _, exists := out[k]; !exists {
+							out[k] = x
+						}
+					}
+					continue
+				}
+			}
+
+			x, ok := h.walk(fv, scrub || isScrubField(f.Name) || isScrubField(name), depth+1)
+			if ok {
+				changed = true
+			} else {
+				x = fv.Interface()
+			}
+			out[name] = x
+		}
+		return out, changed
+
+	default:
+		return nil, false
+	}
+}
+
+// jsonFieldName returns the name encoding/json encodes a struct field as, whether it is omitted when empty,
+// and false if it is not encoded
+func jsonFieldName(f reflect.StructField) (string, bool, bool) {
+	tag := f.Tag.Get("json")
+	if tag == "-" {
+		return "", false, false
+	}
+
+	name := f.Name
+	var opts string
+	if i := strings.Index(tag, ","); i != -1 {
+		tag, opts = tag[:i], tag[i:]
+	}
+	if tag != "" {
+		name = tag
+	}
+
+	return name, strings.Contains(opts, ",omitempty"), true
+}
+
+// isEmptyValue reports whether encoding/json omits v from a field tagged omitempty
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
@@ -0,0 +1,285 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+const testSkyAddr = "2Wbi4wvxC4fkTYMsS2f6HaFfW4pafDjXcQW"
+
+type testDeposit struct {
+	SkyAddress     string
+	DepositAddress string
+	DepositValue   int64
+	Txids          []string
+	Outputs        []testOutput
+	ErrC           chan error
+	note           string
+}
+
+type testOutput struct {
+	Address string
+	Coins   uint64
+}
+
+type testStringer string
+
+func (s testStringer) String() string {
+	return string(s)
+}
+
+func TestNewScrubHook(t *testing.T) {
+	_, err := NewScrubHook(ScrubConfig{})
+	require.Error(t, err)
+
+	_, err = NewScrubHook(ScrubConfig{Mode: ScrubHash})
+	require.Error(t, err)
+
+	_, err = NewScrubHook(ScrubConfig{Mode: ScrubTruncate})
+	require.NoError(t, err)
+
+	_, err = NewScrubHook(ScrubConfig{Mode: ScrubHash, Secret: "secret"})
+	require.NoError(t, err)
+}
+
+func TestScrubHookScrub(t *testing.T) {
+	h, err := NewScrubHook(ScrubConfig{Mode: ScrubHash, Secret: "secret"})
+	require.NoError(t, err)
+
+	s := h.Scrub(testSkyAddr)
+	require.True(t, strings.HasPrefix(s, scrubHashPrefix))
+	require.Len(t, s, len(scrubHashPrefix)+scrubHashLen)
+	require.NotContains(t, s, testSkyAddr[:8])
+	require.Equal(t, s, h.Scrub(testSkyAddr))
+	require.NotEqual(t, s, h.Scrub("1.2.3.4"))
+	require.Empty(t, h.Scrub(""))
+
+	// The hash depends on the secret
+	h2, err := NewScrubHook(ScrubConfig{Mode: ScrubHash, Secret: "secret2"})
+	require.NoError(t, err)
+	require.NotEqual(t, s, h2.Scrub(testSkyAddr))
+
+	h, err = NewScrubHook(ScrubConfig{Mode: ScrubTruncate})
+	require.NoError(t, err)
+	require.Equal(t, "2Wbi...", h.Scrub(testSkyAddr))
+	require.Equal(t, "...", h.Scrub("1234"))
+}
+
+func TestScrubHookFire(t *testing.T) {
+	h, err := NewScrubHook(ScrubConfig{Mode: ScrubTruncate})
+	require.NoError(t, err)
+
+	errC := make(chan error)
+	dv := testDeposit{
+		SkyAddress:     testSkyAddr,
+		DepositAddress: "1FeDtFhARLxjKUPPkQqEBL78tisenc9znS",
+		DepositValue:   1e6,
+		Txids:          []string{"abcdef"},
+		Outputs: []testOutput{{
+			Address: testSkyAddr,
+			Coins:   1,
+		}},
+		ErrC: errC,
+	}
+
+	data := logrus.Fields{
+		"skyAddr":    testSkyAddr,
+		"hosts":      []string{"localhost"},
+		"addrs":      []string{"1FeDtFhARLxjKUPPkQqEBL78tisenc9znS", "12"},
+		"remoteAddr": "10.0.0.1:1234",
+		"address":    testStringer(testSkyAddr),
+		"deposit":    dv,
+		"depositPtr": &dv,
+		"meta":       map[string]string{"ip": "10.0.0.1", "region": "eu"},
+		"txid":       "abcdef",
+		"n":          1,
+		"error":      errors.New(testSkyAddr),
+		"prefix":     "test",
+	}
+
+	e := logrus.NewEntry(logrus.New())
+	e.Data = data
+	require.NoError(t, h.Fire(e))
+
+	scrubbedDeposit := map[string]interface{}{
+		"SkyAddress":     "2Wbi...",
+		"DepositAddress": "1FeD...",
+		"DepositValue":   int64(1e6),
+		"Txids":          []string{"abcdef"},
+		"Outputs": []interface{}{
+			map[string]interface{}{
+				"Address": "2Wbi...",
+				"Coins":   uint64(1),
+			},
+		},
+	}
+
+	require.Equal(t, logrus.Fields{
+		"skyAddr":    "2Wbi...",
+		"hosts":      []string{"localhost"},
+		"addrs":      []interface{}{"1FeD...", "..."},
+		"remoteAddr": "10.0...",
+		"address":    "2Wbi...",
+		"deposit":    scrubbedDeposit,
+		"depositPtr": scrubbedDeposit,
+		"meta":       map[string]interface{}{"ip": "10.0...", "region": "eu"},
+		"txid":       "abcdef",
+		"n":          1,
+		"error":      data["error"],
+		"prefix":     "test",
+	}, e.Data)
+
+	// The original fields are not modified
+	require.Equal(t, testSkyAddr, data["skyAddr"])
+	require.Equal(t, dv, data["deposit"])
+
+	// Entries with nothing to scrub keep their fields
+	data = logrus.Fields{
+		"txid":    "abcdef",
+		"deposit": testOutput{Coins: 1},
+	}
+	e.Data = data
+	require.NoError(t, h.Fire(e))
+	require.Equal(t, testOutput{Coins: 1}, e.Data["deposit"])
+}
+
+type testEmbedded struct {
+	Seq        uint64 `json:"seq"`
+	RemoteAddr string `json:"remote_addr"`
+}
+
+type testBinding struct {
+	testEmbedded
+	SkyAddress   string   `json:"sky_address"`
+	DepositAddrs []string `json:"deposit_addrs"`
+	Target       string   `json:"skycoin_address"`
+	CoinType     string   `json:"coin_type"`
+	Region       string   `json:"region,omitempty"`
+	Secret       string   `json:"-"`
+}
+
+func TestScrubHookFireVariants(t *testing.T) {
+	h, err := NewScrubHook(ScrubConfig{Mode: ScrubTruncate})
+	require.NoError(t, err)
+
+	b := testBinding{
+		testEmbedded: testEmbedded{
+			Seq:        1,
+			RemoteAddr: "10.0.0.1:1234",
+		},
+		SkyAddress:   testSkyAddr,
+		DepositAddrs: []string{"1FeDtFhARLxjKUPPkQqEBL78tisenc9znS"},
+		Target:       testSkyAddr,
+		CoinType:     "BTC",
+		Secret:       "secret",
+	}
+
+	e := logrus.NewEntry(logrus.New())
+	e.Data = logrus.Fields{
+		"depositAddrs":      []string{"1FeDtFhARLxjKUPPkQqEBL78tisenc9znS"},
+		"skyAddrs":          []string{testSkyAddr},
+		"deposit_addresses": []string{"1FeDtFhARLxjKUPPkQqEBL78tisenc9znS"},
+		"ips":               []string{"10.0.0.1"},
+		"binding":           b,
+	}
+	require.NoError(t, h.Fire(e))
+
+	scrubbedBinding := map[string]interface{}{
+		"seq":             uint64(1),
+		"remote_addr":     "10.0...",
+		"sky_address":     "2Wbi...",
+		"deposit_addrs":   []interface{}{"1FeD..."},
+		"skycoin_address": "2Wbi...",
+		"coin_type":       "BTC",
+	}
+
+	require.Equal(t, logrus.Fields{
+		"depositAddrs":      []interface{}{"1FeD..."},
+		"skyAddrs":          []interface{}{"2Wbi..."},
+		"deposit_addresses": []interface{}{"1FeD..."},
+		"ips":               []interface{}{"10.0..."},
+		"binding":           scrubbedBinding,
+	}, e.Data)
+
+	// The scrubbed struct has the fields of its JSON encoding
+	v, err := json.Marshal(b)
+	require.NoError(t, err)
+	var encoded map[string]interface{}
+	require.NoError(t, json.Unmarshal(v, &encoded))
+	require.Len(t, scrubbedBinding, len(encoded))
+	for k := range encoded {
+		require.Contains(t, scrubbedBinding, k)
+	}
+}
+
+func TestScrub(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logger")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	_, err = New(Config{
+		Scrub: &ScrubConfig{Mode: ScrubHash},
+	})
+	require.Error(t, err)
+
+	scrub := &ScrubConfig{
+		Mode:   ScrubHash,
+		Secret: "secret",
+	}
+
+	log, err := New(Config{
+		JSON:          true,
+		Filename:      filepath.Join(dir, "teller.log"),
+		AuditFilename: filepath.Join(dir, "audit.log"),
+		Scrub:         scrub,
+	})
+	require.NoError(t, err)
+	var out bytes.Buffer
+	log.Out = &out
+
+	plog := log.WithField("prefix", "teller.exchange")
+	plog.WithField("skyAddr", testSkyAddr).Info("Bound address")
+	Audit(plog).WithField("skyAddr", testSkyAddr).Info("Sent skycoin")
+
+	h, err := NewScrubHook(*scrub)
+	require.NoError(t, err)
+	hashed := h.Scrub(testSkyAddr)
+
+	readLines := func(b []byte) []map[string]interface{} {
+		var lines []map[string]interface{}
+		for _, l := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+			var v map[string]interface{}
+			require.NoError(t, json.Unmarshal([]byte(l), &v))
+			lines = append(lines, v)
+		}
+		return lines
+	}
+
+	// The stdout and the log file are scrubbed
+	b, err := ioutil.ReadFile(filepath.Join(dir, "teller.log"))
+	require.NoError(t, err)
+	for _, lines := range [][]map[string]interface{}{readLines(b), readLines(out.Bytes())} {
+		require.Len(t, lines, 2)
+		for _, l := range lines {
+			require.Equal(t, hashed, l["skyAddr"])
+			require.Equal(t, "teller.exchange", l["prefix"])
+		}
+	}
+
+	// The audit log is not
+	b, err = ioutil.ReadFile(filepath.Join(dir, "audit.log"))
+	require.NoError(t, err)
+	lines := readLines(b)
+	require.Len(t, lines, 1)
+	require.Equal(t, "Sent skycoin", lines[0]["msg"])
+	require.Equal(t, testSkyAddr, lines[0]["skyAddr"])
+}
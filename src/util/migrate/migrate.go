@@ -0,0 +1,150 @@
+// Package migrate upgrades the schema of the stores of the db with ordered, versioned migrations.
+// The schema version of each store is kept in the schema_version bucket, keyed by the name of the store,
+// so that every store, e.g. a future SQL store, versions its schema independently.
+package migrate
+
+import (
+	"fmt"
+
+	"github.com/boltdb/bolt"
+	"github.com/sirupsen/logrus"
+
+	"github.com/skycoin/teller/src/util/dbutil"
+)
+
+// schema version of each store, store name as key
+var schemaVersionBkt = []byte("schema_version")
+
+// Migration upgrades the schema of a store from Version-1 to Version
+type Migration struct {
+	// Versions start at 1 and increase by 1
+	Version     int
+	Description string
+	// Migrate runs in the transaction that sets the schema version, so a failed migration changes nothing
+	Migrate func(tx *bolt.Tx) error
+}
+
+// NewerSchemaErr is returned if the db was migrated by a newer version of teller than the running one
+type NewerSchemaErr struct {
+	Store   string
+	Version int
+	Latest  int
+}
+
+func (e NewerSchemaErr) Error() string {
+	return fmt.Sprintf("Schema version %d of store %s is newer than version %d of this teller, upgrade teller", e.Version, e.Store, e.Latest)
+}
+
+// Validate checks that the versions of migrations start at 1 and increase by 1
+func Validate(migrations []Migration) error {
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return fmt.Errorf("Migration %d has version %d, expected %d", i, m.Version, i+1)
+		}
+
+		if m.Migrate == nil {
+			return fmt.Errorf("Migration %d has no Migrate function", m.Version)
+		}
+	}
+
+	return nil
+}
+
+// Version returns the schema version of a store, 0 if it was never migrated.
+// It does not write to db, so db can be opened read-only.
+func Version(db *bolt.DB, store string) (int, error) {
+	var v int
+	if err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		v, err = versionTx(tx, store)
+		return err
+	}); err != nil {
+		return 0, err
+	}
+
+	return v, nil
+}
+
+func versionTx(tx *bolt.Tx, store string) (int, error) {
+	var v int
+	if err := dbutil.GetBucketObject(tx, schemaVersionBkt, store, &v); err != nil {
+		switch err.(type) {
+		case dbutil.BucketNotExistErr, dbutil.ObjectNotExistErr:
+			return 0, nil
+		default:
+			return 0, err
+		}
+	}
+
+	return v, nil
+}
+
+// Pending returns the migrations of a store that were not applied yet.
+// It does not write to db, so db can be opened read-only.
+func Pending(db *bolt.DB, store string, migrations []Migration) ([]Migration, error) {
+	if err := Validate(migrations); err != nil {
+		return nil, err
+	}
+
+	v, err := Version(db, store)
+	if err != nil {
+		return nil, err
+	}
+
+	if v > len(migrations) {
+		return nil, NewerSchemaErr{
+			Store:   store,
+			Version: v,
+			Latest:  len(migrations),
+		}
+	}
+
+	return migrations[v:], nil
+}
+
+// Run applies the pending migrations of a store in order, each in its own transaction,
+// and returns the migrations that were applied
+func Run(log logrus.FieldLogger, db *bolt.DB, store string, migrations []Migration) ([]Migration, error) {
+	pending, err := Pending(db, store, migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	log = log.WithField("store", store)
+
+	for i, m := range pending {
+		log := log.WithFields(logrus.Fields{
+			"version":     m.Version,
+			"description": m.Description,
+		})
+
+		if err := db.Update(func(tx *bolt.Tx) error {
+			// Checked again in the transaction, in case the store was migrated since Pending read its version
+			v, err := versionTx(tx, store)
+			if err != nil {
+				return err
+			}
+
+			if v != m.Version-1 {
+				return fmt.Errorf("Schema version of store %s changed to %d during migration", store, v)
+			}
+
+			if err := m.Migrate(tx); err != nil {
+				return err
+			}
+
+			if _, err := tx.CreateBucketIfNotExists(schemaVersionBkt); err != nil {
+				return dbutil.NewCreateBucketFailedErr(schemaVersionBkt, err)
+			}
+
+			return dbutil.PutBucketValue(tx, schemaVersionBkt, store, m.Version)
+		}); err != nil {
+			log.WithError(err).Error("Migration failed")
+			return pending[:i], fmt.Errorf("Migration %d of store %s failed: %v", m.Version, store, err)
+		}
+
+		log.Info("Applied migration")
+	}
+
+	return pending, nil
+}
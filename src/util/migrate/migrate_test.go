@@ -0,0 +1,127 @@
+package migrate
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+var testBkt = []byte("test")
+
+func testMigrations(applied *[]int) []Migration {
+	m := func(v int) Migration {
+		return Migration{
+			Version:     v,
+			Description: "test",
+			Migrate: func(tx *bolt.Tx) error {
+				*applied = append(*applied, v)
+				_, err := tx.CreateBucketIfNotExists(testBkt)
+				return err
+			},
+		}
+	}
+
+	return []Migration{m(1), m(2), m(3)}
+}
+
+func TestValidate(t *testing.T) {
+	var applied []int
+	require.NoError(t, Validate(testMigrations(&applied)))
+	require.NoError(t, Validate(nil))
+
+	ms := testMigrations(&applied)
+	ms[1].Version = 3
+	require.Error(t, Validate(ms))
+
+	ms = testMigrations(&applied)
+	ms[2].Migrate = nil
+	require.Error(t, Validate(ms))
+}
+
+func TestRun(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	log, _ := testutil.NewLogger(t)
+
+	var applied []int
+	ms := testMigrations(&applied)
+
+	v, err := Version(db, "store")
+	require.NoError(t, err)
+	require.Equal(t, 0, v)
+
+	pending, err := Pending(db, "store", ms[:2])
+	require.NoError(t, err)
+	require.Len(t, pending, 2)
+
+	done, err := Run(log, db, "store", ms[:2])
+	require.NoError(t, err)
+	require.Len(t, done, 2)
+	require.Equal(t, []int{1, 2}, applied)
+
+	v, err = Version(db, "store")
+	require.NoError(t, err)
+	require.Equal(t, 2, v)
+
+	// Only the new migrations are applied
+	applied = nil
+	done, err = Run(log, db, "store", ms)
+	require.NoError(t, err)
+	require.Len(t, done, 1)
+	require.Equal(t, 3, done[0].Version)
+	require.Equal(t, []int{3}, applied)
+
+	done, err = Run(log, db, "store", ms)
+	require.NoError(t, err)
+	require.Empty(t, done)
+
+	// Stores are versioned independently
+	v, err = Version(db, "other")
+	require.NoError(t, err)
+	require.Equal(t, 0, v)
+
+	// A db migrated by a newer teller is not migrated
+	_, err = Run(log, db, "store", ms[:1])
+	require.Equal(t, NewerSchemaErr{
+		Store:   "store",
+		Version: 3,
+		Latest:  1,
+	}, err)
+}
+
+func TestRunFailed(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	log, _ := testutil.NewLogger(t)
+
+	var applied []int
+	ms := testMigrations(&applied)
+	ms[1].Migrate = func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucket([]byte("partial")); err != nil {
+			return err
+		}
+		return errors.New("failed")
+	}
+
+	done, err := Run(log, db, "store", ms)
+	require.Error(t, err)
+	require.Len(t, done, 1)
+	require.Equal(t, []int{1}, applied)
+
+	// The failed migration changed nothing
+	v, err := Version(db, "store")
+	require.NoError(t, err)
+	require.Equal(t, 1, v)
+
+	err = db.View(func(tx *bolt.Tx) error {
+		require.Nil(t, tx.Bucket([]byte("partial")))
+		return nil
+	})
+	require.NoError(t, err)
+}
@@ -0,0 +1,246 @@
+// Package openapi describes HTTP APIs with OpenAPI 3 documents, and validates requests against them
+package openapi
+
+import (
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Version is the version of the OpenAPI specification of the documents
+const Version = "3.0.3"
+
+// Document is an OpenAPI document. Only the parts of the specification that teller uses are supported.
+type Document struct {
+	OpenAPI    string               `json:"openapi"`
+	Info       Info                 `json:"info"`
+	Servers    []Server             `json:"servers,omitempty"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components *Components          `json:"components,omitempty"`
+}
+
+// Info describes the API
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+// Server is a base URL of the API. Paths are relative to it.
+type Server struct {
+	URL         string `json:"url"`
+	Description string `json:"description,omitempty"`
+}
+
+// Components are the objects that operations refer to by name
+type Components struct {
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+// SecurityScheme is a way to authenticate requests, e.g. with a bearer token
+type SecurityScheme struct {
+	Type        string `json:"type"`
+	Scheme      string `json:"scheme,omitempty"`
+	Name        string `json:"name,omitempty"` // Header of an apiKey scheme
+	In          string `json:"in,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// PathItem are the operations of a path, by method
+type PathItem struct {
+	Get  *Operation `json:"get,omitempty"`
+	Post *Operation `json:"post,omitempty"`
+}
+
+// Operation returns the operation of method, or nil if the path has none
+func (p *PathItem) Operation(method string) *Operation {
+	switch method {
+	case "GET":
+		return p.Get
+	case "POST":
+		return p.Post
+	default:
+		return nil
+	}
+}
+
+// Operation is an API endpoint with a method
+type Operation struct {
+	OperationID string                `json:"operationId,omitempty"`
+	Summary     string                `json:"summary,omitempty"`
+	Description string                `json:"description,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]Response   `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+// Parameter locations
+const (
+	InQuery  = "query"
+	InHeader = "header"
+	InBody   = "body" // Not a parameter location, used by InvalidParam for request body fields
+)
+
+// Parameter is a query or header parameter of an operation
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// RequestBody is the request body of an operation, by media type
+type RequestBody struct {
+	Description string               `json:"description,omitempty"`
+	Required    bool                 `json:"required,omitempty"`
+	Content     map[string]MediaType `json:"content"`
+}
+
+// Response is a response of an operation
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+// MediaType is the schema of a request or response body of a media type
+type MediaType struct {
+	Schema *Schema `json:"schema,omitempty"`
+}
+
+// Schema describes a JSON value, or a parameter value
+type Schema struct {
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Minimum              *int64             `json:"minimum,omitempty"`
+	Maximum              *int64             `json:"maximum,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+// Int returns a pointer to n, for the optional limits of a Schema
+func Int(n int) *int {
+	return &n
+}
+
+// Int64 returns a pointer to n, for the optional limits of a Schema
+func Int64(n int64) *int64 {
+	return &n
+}
+
+// JSONContent returns the content of a JSON request or response body with schema s
+func JSONContent(s *Schema) map[string]MediaType {
+	return map[string]MediaType{
+		"application/json": {Schema: s},
+	}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// SchemaOf returns the schema of the JSON encoding of v, following its json struct tags.
+// Struct fields without omitempty are required.
+func SchemaOf(v interface{}) *Schema {
+	return schemaOf(reflect.TypeOf(v))
+}
+
+func schemaOf(t reflect.Type) *Schema {
+	if t == nil {
+		return &Schema{}
+	}
+
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t == timeType {
+		return &Schema{Type: "string", Format: "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64", Minimum: Int64(0)}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: schemaOf(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: schemaOf(t.Elem())}
+	case reflect.Struct:
+		s := &Schema{
+			Type:       "object",
+			Properties: make(map[string]*Schema),
+		}
+		addFields(s, t)
+		return s
+	default:
+		return &Schema{}
+	}
+}
+
+// addFields adds the fields of struct t to the properties of s, including the fields of embedded structs
+func addFields(s *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		opts := strings.Split(tag, ",")
+		name := opts[0]
+
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				addFields(s, ft)
+				continue
+			}
+		}
+
+		if f.PkgPath != "" {
+			continue
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+
+		s.Properties[name] = schemaOf(f.Type)
+
+		omitEmpty := false
+		for _, o := range opts[1:] {
+			if o == "omitempty" {
+				omitEmpty = true
+			}
+		}
+
+		if !omitEmpty {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
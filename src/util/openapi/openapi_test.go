@@ -0,0 +1,192 @@
+package openapi
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/util/logger"
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+func TestSchemaOf(t *testing.T) {
+	type embedded struct {
+		Seq uint64 `json:"seq"`
+	}
+
+	type item struct {
+		embedded
+		Name    string            `json:"name"`
+		Value   int64             `json:"value,omitempty"`
+		Ratio   float64           `json:"ratio"`
+		OK      bool              `json:"ok"`
+		At      *time.Time        `json:"at,omitempty"`
+		Tags    map[string]string `json:"tags,omitempty"`
+		Ignored string            `json:"-"`
+		private string
+	}
+
+	type response struct {
+		Items []item `json:"items"`
+		Data  []byte `json:"data,omitempty"`
+	}
+
+	require.Equal(t, &Schema{
+		Type: "object",
+		Properties: map[string]*Schema{
+			"items": {
+				Type: "array",
+				Items: &Schema{
+					Type: "object",
+					Properties: map[string]*Schema{
+						"seq":   {Type: "integer", Format: "int64", Minimum: Int64(0)},
+						"name":  {Type: "string"},
+						"value": {Type: "integer", Format: "int64"},
+						"ratio": {Type: "number"},
+						"ok":    {Type: "boolean"},
+						"at":    {Type: "string", Format: "date-time"},
+						"tags":  {Type: "object", AdditionalProperties: &Schema{Type: "string"}},
+					},
+					Required: []string{"seq", "name", "ratio", "ok"},
+				},
+			},
+			"data": {Type: "string", Format: "byte"},
+		},
+		Required: []string{"items"},
+	}, SchemaOf(response{}))
+}
+
+func testDocument() *Document {
+	return &Document{
+		OpenAPI: Version,
+		Servers: []Server{{URL: "/api/v1"}},
+		Paths: map[string]*PathItem{
+			"/get": {
+				Get: &Operation{
+					Parameters: []Parameter{
+						{Name: "addr", In: InQuery, Required: true, Schema: &Schema{Type: "string", MaxLength: Int(5)}},
+						{Name: "size", In: InQuery, Schema: &Schema{Type: "integer", Minimum: Int64(1), Maximum: Int64(10)}},
+						{Name: "uri", In: InQuery, Schema: &Schema{Type: "boolean"}},
+					},
+				},
+			},
+			"/post": {
+				Post: &Operation{
+					RequestBody: &RequestBody{
+						Required: true,
+						Content: JSONContent(&Schema{
+							Type:     "object",
+							Required: []string{"addrs"},
+							Properties: map[string]*Schema{
+								"addrs": {
+									Type:     "array",
+									Items:    &Schema{Type: "string", Pattern: "^[a-z]+$"},
+									MinItems: Int(1),
+									MaxItems: Int(2),
+								},
+								"kind": {Type: "string", Enum: []string{"a", "b"}},
+							},
+						}),
+					},
+				},
+			},
+		},
+	}
+}
+
+func newTestRequest(t *testing.T, method, url string, body string) *http.Request {
+	log, _ := testutil.NewLogger(t)
+	r := httptest.NewRequest(method, url, strings.NewReader(body))
+	return r.WithContext(logger.WithContext(r.Context(), log))
+}
+
+func TestValidationHandler(t *testing.T) {
+	var body string
+	h := ValidationHandler([]*Document{testDocument()}, nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		body = string(b)
+	}))
+
+	for _, tc := range []struct {
+		name        string
+		method      string
+		url         string
+		contentType string
+		body        string
+		status      int
+		err         string
+	}{
+		{"valid query", http.MethodGet, "/api/v1/get?addr=abc&size=10&uri=true", "", "", http.StatusOK, ""},
+		{"missing param", http.MethodGet, "/api/v1/get?addr=", "", "", http.StatusBadRequest, "addr is required"},
+		{"invalid params", http.MethodGet, "/api/v1/get?addr=abcdef&size=0&uri=x", "", "", http.StatusBadRequest,
+			"addr must have at most 5 characters; size must be at least 1; uri must be a boolean"},
+		{"not an integer", http.MethodGet, "/api/v1/get?addr=a&size=1.5", "", "", http.StatusBadRequest, "size must be an integer"},
+		{"unknown method", http.MethodPost, "/api/v1/get", "", "", http.StatusOK, ""},
+		{"unknown path", http.MethodGet, "/api/v1/other", "", "", http.StatusOK, ""},
+		{"valid body", http.MethodPost, "/api/v1/post", "application/json; charset=utf-8", `{"addrs":["a","b"],"kind":"a","other":1}`, http.StatusOK, ""},
+		{"missing body", http.MethodPost, "/api/v1/post", "application/json", "", http.StatusBadRequest, "Missing request body"},
+		{"invalid content type", http.MethodPost, "/api/v1/post", "text/plain", "{}", http.StatusUnsupportedMediaType, "Invalid content type"},
+		{"invalid json", http.MethodPost, "/api/v1/post", "application/json", "{", http.StatusBadRequest, "Invalid json request body: unexpected EOF"},
+		{"missing field", http.MethodPost, "/api/v1/post", "application/json", `{"kind":null}`, http.StatusBadRequest, "addrs is required"},
+		{"invalid fields", http.MethodPost, "/api/v1/post", "application/json", `{"addrs":["a","B",1],"kind":"c"}`, http.StatusBadRequest,
+			"addrs must have at most 2 items; kind must be one of a, b"},
+		{"invalid items", http.MethodPost, "/api/v1/post", "application/json", `{"addrs":["B",1]}`, http.StatusBadRequest,
+			"addrs[0] is invalid; addrs[1] must be a string"},
+		{"body too large", http.MethodPost, "/api/v1/post", "application/json", strings.Repeat(" ", MaxBodySize+1), http.StatusRequestEntityTooLarge,
+			"Request body too large"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			body = ""
+			r := newTestRequest(t, tc.method, tc.url, tc.body)
+			if tc.contentType != "" {
+				r.Header.Set("Content-Type", tc.contentType)
+			}
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, r)
+
+			require.Equal(t, tc.status, w.Code)
+			if tc.status == http.StatusOK {
+				// The handler can read the validated body
+				require.Equal(t, tc.body, body)
+			} else {
+				require.Equal(t, tc.err, strings.TrimSpace(w.Body.String()))
+			}
+		})
+	}
+}
+
+func TestValidationHandlerProblem(t *testing.T) {
+	h := ValidationHandler([]*Document{testDocument()}, nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("handler called for an invalid request")
+	}))
+
+	r := newTestRequest(t, http.MethodGet, "/api/v1/get?size=x", "")
+	r.Header.Set("Accept", "application/json, application/problem+json;q=0.9")
+	w := httptest.NewRecorder()
+
+	h.ServeHTTP(w, r)
+
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Equal(t, ProblemContentType, w.Header().Get("Content-Type"))
+
+	var p Problem
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+	require.Equal(t, Problem{
+		Type:   "about:blank",
+		Title:  "Bad Request",
+		Status: http.StatusBadRequest,
+		Detail: "addr is required; size must be an integer",
+		InvalidParams: []InvalidParam{
+			{Name: "addr", In: InQuery, Reason: "is required"},
+			{Name: "size", In: InQuery, Reason: "must be an integer"},
+		},
+	}, p)
+}
@@ -0,0 +1,435 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/skycoin/teller/src/util/logger"
+)
+
+const (
+	// MaxBodySize is the largest request body that is validated, larger bodies get a 413 response
+	MaxBodySize = 1 << 20
+
+	// ProblemContentType is the media type of problem details, https://tools.ietf.org/html/rfc7807
+	ProblemContentType = "application/problem+json"
+)
+
+// InvalidParam is a parameter or request body field that doesn't match the schema of the operation
+type InvalidParam struct {
+	Name   string `json:"name"`
+	In     string `json:"in"`
+	Reason string `json:"reason"`
+}
+
+func (p InvalidParam) String() string {
+	if p.Name == "" {
+		return p.Reason
+	}
+	return fmt.Sprintf("%s %s", p.Name, p.Reason)
+}
+
+// Problem is the problem details response of an invalid request, https://tools.ietf.org/html/rfc7807
+type Problem struct {
+	Type          string         `json:"type"`
+	Title         string         `json:"title"`
+	Status        int            `json:"status"`
+	Detail        string         `json:"detail"`
+	InvalidParams []InvalidParam `json:"invalid_params"`
+}
+
+// Operation returns the operation of a request to path with method, where path includes the URL
+// of a server of d, e.g. /api/v1/bind. Returns nil if d has no such operation.
+func (d *Document) Operation(method, path string) *Operation {
+	for _, srv := range d.Servers {
+		if !strings.HasPrefix(path, srv.URL) {
+			continue
+		}
+
+		p, ok := d.Paths[strings.TrimPrefix(path, srv.URL)]
+		if !ok {
+			continue
+		}
+
+		if op := p.Operation(method); op != nil {
+			return op
+		}
+	}
+
+	return nil
+}
+
+// ValidateParams validates the query and header parameters of r against op
+func ValidateParams(op *Operation, r *http.Request) []InvalidParam {
+	var invalid []InvalidParam
+
+	q := r.URL.Query()
+	for _, p := range op.Parameters {
+		var v string
+		switch p.In {
+		case InQuery:
+			v = q.Get(p.Name)
+		case InHeader:
+			v = r.Header.Get(p.Name)
+		default:
+			continue
+		}
+
+		// Empty parameters are treated as missing, like the handlers do
+		if v == "" {
+			if p.Required {
+				invalid = append(invalid, InvalidParam{Name: p.Name, In: p.In, Reason: "is required"})
+			}
+			continue
+		}
+
+		invalid = append(invalid, validateParam(p, v)...)
+	}
+
+	return invalid
+}
+
+func validateParam(p Parameter, v string) []InvalidParam {
+	if p.Schema == nil {
+		return nil
+	}
+
+	var value interface{} = v
+	switch p.Schema.Type {
+	case "integer", "number":
+		value = json.Number(v)
+	case "boolean":
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return []InvalidParam{{Name: p.Name, In: p.In, Reason: "must be a boolean"}}
+		}
+		value = b
+	}
+
+	return validateValue(p.Schema, value, p.Name, p.In)
+}
+
+// ValidateBody validates the request body of r against op. The body is read, and replaced
+// with a copy so that it can be read again. Returns a 413 or 415 status if the body is too large
+// or not of a media type of op, or a 400 status with the invalid fields.
+func ValidateBody(op *Operation, r *http.Request) (int, []InvalidParam) {
+	if op.RequestBody == nil {
+		return 0, nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		mediaType = ""
+	}
+
+	mt, ok := op.RequestBody.Content[mediaType]
+	if !ok {
+		return http.StatusUnsupportedMediaType, []InvalidParam{{In: InBody, Reason: "Invalid content type"}}
+	}
+
+	b, err := ioutil.ReadAll(http.MaxBytesReader(nil, r.Body, MaxBodySize))
+	if err != nil {
+		return http.StatusRequestEntityTooLarge, []InvalidParam{{In: InBody, Reason: "Request body too large"}}
+	}
+	r.Body.Close()
+	r.Body = ioutil.NopCloser(bytes.NewReader(b))
+
+	if len(bytes.TrimSpace(b)) == 0 {
+		if op.RequestBody.Required {
+			return http.StatusBadRequest, []InvalidParam{{In: InBody, Reason: "Missing request body"}}
+		}
+		return 0, nil
+	}
+
+	if mediaType != "application/json" || mt.Schema == nil {
+		return 0, nil
+	}
+
+	var v interface{}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	if err := d.Decode(&v); err != nil {
+		return http.StatusBadRequest, []InvalidParam{{In: InBody, Reason: fmt.Sprintf("Invalid json request body: %v", err)}}
+	}
+
+	if invalid := validateValue(mt.Schema, v, "", InBody); len(invalid) != 0 {
+		return http.StatusBadRequest, invalid
+	}
+
+	return 0, nil
+}
+
+// patterns caches the compiled patterns of schemas
+var patterns = struct {
+	m map[string]*regexp.Regexp
+	sync.Mutex
+}{
+	m: make(map[string]*regexp.Regexp),
+}
+
+func matchPattern(pattern, v string) bool {
+	patterns.Lock()
+	re, ok := patterns.m[pattern]
+	if !ok {
+		// An invalid pattern is a bug of the document
+		re = regexp.MustCompile(pattern)
+		patterns.m[pattern] = re
+	}
+	patterns.Unlock()
+
+	return re.MatchString(v)
+}
+
+var typeNames = map[string]string{
+	"string":  "a string",
+	"integer": "an integer",
+	"number":  "a number",
+	"boolean": "a boolean",
+	"array":   "an array",
+	"object":  "an object",
+}
+
+// validateValue validates a JSON value decoded with UseNumber against s. name is the path
+// of the value in the request body, e.g. "skyaddrs[1]", or the name of the parameter
+func validateValue(s *Schema, v interface{}, name, in string) []InvalidParam {
+	invalid := func(format string, args ...interface{}) []InvalidParam {
+		return []InvalidParam{{Name: name, In: in, Reason: fmt.Sprintf(format, args...)}}
+	}
+
+	// Nulls are treated as missing values, like the handlers do
+	if v == nil {
+		return nil
+	}
+
+	switch s.Type {
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			return invalid("must be %s", typeNames[s.Type])
+		}
+
+		if len(s.Enum) != 0 {
+			found := false
+			for _, e := range s.Enum {
+				if e == str {
+					found = true
+				}
+			}
+			if !found {
+				return invalid("must be one of %s", strings.Join(s.Enum, ", "))
+			}
+		}
+
+		n := utf8.RuneCountInString(str)
+		if s.MinLength != nil && n < *s.MinLength {
+			return invalid("must have at least %d characters", *s.MinLength)
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			return invalid("must have at most %d characters", *s.MaxLength)
+		}
+
+		if s.Pattern != "" && !matchPattern(s.Pattern, str) {
+			return invalid("is invalid")
+		}
+
+	case "integer", "number":
+		num, ok := v.(json.Number)
+		if !ok {
+			return invalid("must be %s", typeNames[s.Type])
+		}
+
+		f, err := num.Float64()
+		if err != nil {
+			return invalid("must be %s", typeNames[s.Type])
+		}
+
+		if s.Type == "integer" {
+			if _, err := strconv.ParseInt(num.String(), 10, 64); err != nil {
+				return invalid("must be %s", typeNames[s.Type])
+			}
+		}
+
+		if s.Minimum != nil && f < float64(*s.Minimum) {
+			return invalid("must be at least %d", *s.Minimum)
+		}
+		if s.Maximum != nil && f > float64(*s.Maximum) {
+			return invalid("must be at most %d", *s.Maximum)
+		}
+
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return invalid("must be %s", typeNames[s.Type])
+		}
+
+	case "array":
+		items, ok := v.([]interface{})
+		if !ok {
+			return invalid("must be %s", typeNames[s.Type])
+		}
+
+		if s.MinItems != nil && len(items) < *s.MinItems {
+			return invalid("must have at least %d items", *s.MinItems)
+		}
+		if s.MaxItems != nil && len(items) > *s.MaxItems {
+			return invalid("must have at most %d items", *s.MaxItems)
+		}
+
+		if s.Items == nil {
+			return nil
+		}
+
+		var all []InvalidParam
+		for i, item := range items {
+			all = append(all, validateValue(s.Items, item, fmt.Sprintf("%s[%d]", name, i), in)...)
+		}
+		return all
+
+	case "object":
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return invalid("must be %s", typeNames[s.Type])
+		}
+
+		field := func(k string) string {
+			if name == "" {
+				return k
+			}
+			return name + "." + k
+		}
+
+		var all []InvalidParam
+		for _, k := range s.Required {
+			if obj[k] == nil {
+				all = append(all, InvalidParam{Name: field(k), In: in, Reason: "is required"})
+			}
+		}
+
+		keys := make([]string, 0, len(obj))
+		for k := range obj {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			ps, ok := s.Properties[k]
+			if !ok {
+				ps = s.AdditionalProperties
+			}
+			if ps == nil {
+				continue
+			}
+
+			all = append(all, validateValue(ps, obj[k], field(k), in)...)
+		}
+		return all
+	}
+
+	return nil
+}
+
+// ValidationHandler validates the requests to the operations of docs before passing them to hd.
+// Requests to paths or with methods that the documents don't have are passed as they are, so that
+// hd can respond to them. An invalid request gets an error response with the invalid parameters,
+// written by errorFunc, or by ProblemResponse if errorFunc is nil.
+// Invalid requests are logged with the logger of the request context, see httputil.LogHandler.
+func ValidationHandler(docs []*Document, errorFunc ErrorFunc, hd http.Handler) http.Handler {
+	if errorFunc == nil {
+		errorFunc = ProblemResponse
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var op *Operation
+		for _, d := range docs {
+			if op = d.Operation(r.Method, r.URL.Path); op != nil {
+				break
+			}
+		}
+
+		if op == nil {
+			hd.ServeHTTP(w, r)
+			return
+		}
+
+		status := http.StatusBadRequest
+		invalid := ValidateParams(op, r)
+		if len(invalid) == 0 {
+			status, invalid = ValidateBody(op, r)
+		}
+
+		if len(invalid) == 0 {
+			hd.ServeHTTP(w, r)
+			return
+		}
+
+		log := logger.FromContext(r.Context())
+		log.WithField("status", status).WithField("invalidParams", invalid).Info("Invalid request")
+
+		errorFunc(w, r, status, invalid)
+	})
+}
+
+// ErrorFunc writes the error response of an invalid request with status, 400, 413 or 415
+type ErrorFunc func(w http.ResponseWriter, r *http.Request, status int, invalid []InvalidParam)
+
+// Detail returns a message listing the invalid parameters
+func Detail(invalid []InvalidParam) string {
+	msgs := make([]string, len(invalid))
+	for i, p := range invalid {
+		msgs[i] = p.String()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// ProblemResponse writes the error response of an invalid request as problem details,
+// if the client accepts them, otherwise as a plain text list of the invalid parameters
+func ProblemResponse(w http.ResponseWriter, r *http.Request, status int, invalid []InvalidParam) {
+	detail := Detail(invalid)
+	log := logger.FromContext(r.Context())
+
+	if !acceptsProblem(r) {
+		http.Error(w, detail, status)
+		return
+	}
+
+	b, err := json.MarshalIndent(Problem{
+		Type:          "about:blank",
+		Title:         http.StatusText(status),
+		Status:        status,
+		Detail:        detail,
+		InvalidParams: invalid,
+	}, "", "    ")
+	if err != nil {
+		log.WithError(err).Error("json.MarshalIndent failed")
+		http.Error(w, detail, status)
+		return
+	}
+
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	if _, err := w.Write(b); err != nil {
+		log.WithError(err).Error(err)
+	}
+}
+
+// acceptsProblem returns true if the Accept header of r has the problem details media type
+func acceptsProblem(r *http.Request) bool {
+	for _, a := range strings.Split(r.Header.Get("Accept"), ",") {
+		mt, _, err := mime.ParseMediaType(strings.TrimSpace(a))
+		if err == nil && mt == ProblemContentType {
+			return true
+		}
+	}
+
+	return false
+}
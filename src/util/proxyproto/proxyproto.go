@@ -0,0 +1,253 @@
+// Package proxyproto accepts connections from load balancers that send the client address
+// in a PROXY protocol header, version 1 or 2, e.g. HAProxy or AWS ELB.
+// https://www.haproxy.org/download/1.8/doc/proxy-protocol.txt
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Maximum length of a version 1 header, including the CRLF
+const maxV1HeaderLen = 107
+
+var (
+	v1Prefix    = []byte("PROXY ")
+	v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+)
+
+// ErrInvalidHeader is returned by the reads of a connection with an invalid PROXY header
+var ErrInvalidHeader = errors.New("Invalid PROXY protocol header")
+
+// Listener reads the PROXY header of the connections it accepts. The RemoteAddr and LocalAddr of a
+// connection with a header are the addresses of the client connection that the proxy received.
+// Connections without a header are passed through as they are.
+type Listener struct {
+	net.Listener
+	// Trusted reports whether the connections from ip may send a PROXY header. The headers of other
+	// connections are not read, so that they can't spoof their address. If nil, all connections are trusted.
+	Trusted func(ip net.IP) bool
+	// HeaderTimeout is the maximum time to wait for the header, 0 for no limit
+	HeaderTimeout time.Duration
+}
+
+// Accept accepts a connection. The header is read by the first call to Read, RemoteAddr or LocalAddr
+// of the connection, so a slow client doesn't block Accept.
+func (l *Listener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	if l.Trusted != nil {
+		addr, ok := c.RemoteAddr().(*net.TCPAddr)
+		if !ok || !l.Trusted(addr.IP) {
+			return c, nil
+		}
+	}
+
+	return &Conn{
+		Conn:          c,
+		r:             bufio.NewReader(c),
+		headerTimeout: l.HeaderTimeout,
+	}, nil
+}
+
+// Conn is a connection that may start with a PROXY header
+type Conn struct {
+	net.Conn
+	r             *bufio.Reader
+	headerTimeout time.Duration
+	once          sync.Once
+	err           error
+	remoteAddr    net.Addr
+	localAddr     net.Addr
+}
+
+// Read reads from the connection after the header.
+// If the header is invalid, it returns ErrInvalidHeader or the error of reading it.
+func (c *Conn) Read(b []byte) (int, error) {
+	c.once.Do(c.readHeader)
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.r.Read(b)
+}
+
+// RemoteAddr returns the client address from the header, or the address of the connection if it has none
+func (c *Conn) RemoteAddr() net.Addr {
+	c.once.Do(c.readHeader)
+	if c.remoteAddr != nil {
+		return c.remoteAddr
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// LocalAddr returns the address the client connected to from the header, or the address of the connection if it has none
+func (c *Conn) LocalAddr() net.Addr {
+	c.once.Do(c.readHeader)
+	if c.localAddr != nil {
+		return c.localAddr
+	}
+	return c.Conn.LocalAddr()
+}
+
+func (c *Conn) readHeader() {
+	if c.headerTimeout > 0 {
+		if err := c.Conn.SetReadDeadline(time.Now().Add(c.headerTimeout)); err != nil {
+			c.err = err
+			return
+		}
+		defer c.Conn.SetReadDeadline(time.Time{}) // nolint: errcheck
+	}
+
+	b, err := c.r.Peek(1)
+	if err != nil {
+		// Let Read return the error, e.g. io.EOF
+		return
+	}
+
+	switch b[0] {
+	case v1Prefix[0]:
+		if b, err := c.r.Peek(len(v1Prefix)); err == nil && bytes.Equal(b, v1Prefix) {
+			c.err = c.readV1()
+		}
+	case v2Signature[0]:
+		if b, err := c.r.Peek(len(v2Signature)); err == nil && bytes.Equal(b, v2Signature) {
+			c.err = c.readV2()
+		}
+	}
+}
+
+// readV1 reads a header like "PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\n"
+func (c *Conn) readV1() error {
+	var line []byte
+	for {
+		b, err := c.r.ReadByte()
+		if err != nil {
+			return err
+		}
+
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+
+		if len(line) >= maxV1HeaderLen {
+			return ErrInvalidHeader
+		}
+	}
+
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return ErrInvalidHeader
+	}
+
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+	if len(fields) < 2 {
+		return ErrInvalidHeader
+	}
+
+	// The proxy doesn't know the client address, e.g. for a health check
+	if fields[1] == "UNKNOWN" {
+		return nil
+	}
+
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return ErrInvalidHeader
+	}
+
+	src, err := parseV1Addr(fields[1], fields[2], fields[4])
+	if err != nil {
+		return err
+	}
+
+	dst, err := parseV1Addr(fields[1], fields[3], fields[5])
+	if err != nil {
+		return err
+	}
+
+	c.remoteAddr = src
+	c.localAddr = dst
+
+	return nil
+}
+
+func parseV1Addr(proto, ip, port string) (*net.TCPAddr, error) {
+	addr := net.ParseIP(ip)
+	if addr == nil || (proto == "TCP4") != (addr.To4() != nil) {
+		return nil, ErrInvalidHeader
+	}
+
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, ErrInvalidHeader
+	}
+
+	return &net.TCPAddr{
+		IP:   addr,
+		Port: int(p),
+	}, nil
+}
+
+// readV2 reads a binary header: the signature, version and command, address family and protocol,
+// length of the rest, and the addresses, followed by optional TLVs which are skipped
+func (c *Conn) readV2() error {
+	var hdr [16]byte
+	if _, err := io.ReadFull(c.r, hdr[:]); err != nil {
+		return err
+	}
+
+	if hdr[12]>>4 != 2 {
+		return fmt.Errorf("unsupported PROXY protocol version %d", hdr[12]>>4)
+	}
+
+	body := make([]byte, binary.BigEndian.Uint16(hdr[14:16]))
+	if _, err := io.ReadFull(c.r, body); err != nil {
+		return err
+	}
+
+	switch hdr[12] & 0xf {
+	case 0x0:
+		// LOCAL, a connection from the proxy itself, e.g. a health check
+		return nil
+	case 0x1:
+		// PROXY
+	default:
+		return ErrInvalidHeader
+	}
+
+	// Only TCP over IPv4 and IPv6 is supported, the addresses of other protocols are ignored
+	var ipLen int
+	switch hdr[13] {
+	case 0x11:
+		ipLen = net.IPv4len
+	case 0x21:
+		ipLen = net.IPv6len
+	default:
+		return nil
+	}
+
+	if len(body) < 2*ipLen+4 {
+		return ErrInvalidHeader
+	}
+
+	c.remoteAddr = &net.TCPAddr{
+		IP:   net.IP(body[:ipLen]),
+		Port: int(binary.BigEndian.Uint16(body[2*ipLen:])),
+	}
+	c.localAddr = &net.TCPAddr{
+		IP:   net.IP(body[ipLen : 2*ipLen]),
+		Port: int(binary.BigEndian.Uint16(body[2*ipLen+2:])),
+	}
+
+	return nil
+}
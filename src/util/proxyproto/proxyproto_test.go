@@ -0,0 +1,170 @@
+package proxyproto
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func v2Header(cmd, fam byte, addrs []byte) []byte {
+	b := append([]byte{}, v2Signature...)
+	b = append(b, 0x20|cmd, fam, 0, 0)
+	binary.BigEndian.PutUint16(b[14:], uint16(len(addrs)))
+	return append(b, addrs...)
+}
+
+func TestListener(t *testing.T) {
+	v2IPv4 := v2Header(0x1, 0x11, []byte{
+		10, 1, 2, 3, // src
+		10, 0, 0, 1, // dst
+		0xdc, 0x04, // src port 56324
+		0x01, 0xbb, // dst port 443
+		0x03, 0x00, 0x01, 0x00, // a TLV, skipped
+	})
+
+	v2IPv6 := v2Header(0x1, 0x21, append(append(net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::2")...), 0xdc, 0x04, 0x01, 0xbb))
+
+	cases := []struct {
+		name   string
+		data   []byte
+		remote string
+		local  string
+		body   string
+		err    bool
+	}{
+		{
+			name: "no header",
+			data: []byte("GET / HTTP/1.1\r\n"),
+			body: "GET / HTTP/1.1\r\n",
+		},
+		{
+			name:   "v1 tcp4",
+			data:   []byte("PROXY TCP4 10.1.2.3 10.0.0.1 56324 443\r\nPOST /"),
+			remote: "10.1.2.3:56324",
+			local:  "10.0.0.1:443",
+			body:   "POST /",
+		},
+		{
+			name:   "v1 tcp6",
+			data:   []byte("PROXY TCP6 2001:db8::1 2001:db8::2 56324 443\r\nGET /"),
+			remote: "[2001:db8::1]:56324",
+			local:  "[2001:db8::2]:443",
+			body:   "GET /",
+		},
+		{
+			name: "v1 unknown",
+			data: []byte("PROXY UNKNOWN\r\nGET /"),
+			body: "GET /",
+		},
+		{
+			name: "v1 mismatched family",
+			data: []byte("PROXY TCP4 2001:db8::1 10.0.0.1 56324 443\r\nGET /"),
+			err:  true,
+		},
+		{
+			name: "v1 invalid port",
+			data: []byte("PROXY TCP4 10.1.2.3 10.0.0.1 70000 443\r\nGET /"),
+			err:  true,
+		},
+		{
+			name: "v1 no crlf",
+			data: []byte("PROXY TCP4 10.1.2.3 10.0.0.1 56324 443\nGET /"),
+			err:  true,
+		},
+		{
+			name:   "v2 ipv4",
+			data:   append(v2IPv4, "GET /"...),
+			remote: "10.1.2.3:56324",
+			local:  "10.0.0.1:443",
+			body:   "GET /",
+		},
+		{
+			name:   "v2 ipv6",
+			data:   append(v2IPv6, "GET /"...),
+			remote: "[2001:db8::1]:56324",
+			local:  "[2001:db8::2]:443",
+			body:   "GET /",
+		},
+		{
+			name: "v2 local",
+			data: append(v2Header(0x0, 0x00, nil), "GET /"...),
+			body: "GET /",
+		},
+		{
+			name: "v2 short addresses",
+			data: append(v2Header(0x1, 0x11, []byte{10, 1, 2, 3}), "GET /"...),
+			err:  true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			require.NoError(t, err)
+			l := &Listener{
+				Listener:      ln,
+				HeaderTimeout: time.Second,
+			}
+			defer l.Close()
+
+			client, err := net.Dial("tcp", ln.Addr().String())
+			require.NoError(t, err)
+			_, err = client.Write(tc.data)
+			require.NoError(t, err)
+			require.NoError(t, client.Close())
+
+			c, err := l.Accept()
+			require.NoError(t, err)
+			defer c.Close()
+
+			body, err := ioutil.ReadAll(c)
+			if tc.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.body, string(body))
+
+			if tc.remote == "" {
+				require.Equal(t, client.LocalAddr().String(), c.RemoteAddr().String())
+				require.Equal(t, ln.Addr().String(), c.LocalAddr().String())
+			} else {
+				require.Equal(t, tc.remote, c.RemoteAddr().String())
+				require.Equal(t, tc.local, c.LocalAddr().String())
+			}
+		})
+	}
+}
+
+func TestListenerUntrusted(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	l := &Listener{
+		Listener: ln,
+		Trusted: func(ip net.IP) bool {
+			return ip.Equal(net.ParseIP("10.0.0.1"))
+		},
+	}
+	defer l.Close()
+
+	client, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	data := "PROXY TCP4 10.1.2.3 10.0.0.1 56324 443\r\nGET /"
+	_, err = client.Write([]byte(data))
+	require.NoError(t, err)
+	require.NoError(t, client.Close())
+
+	c, err := l.Accept()
+	require.NoError(t, err)
+	defer c.Close()
+
+	// The header of an untrusted connection is not read
+	body, err := ioutil.ReadAll(c)
+	require.NoError(t, err)
+	require.Equal(t, data, string(body))
+	require.Equal(t, client.LocalAddr().String(), c.RemoteAddr().String())
+}
@@ -0,0 +1,89 @@
+// Package qrutil renders QR codes of deposit addresses and BIP21 payment URIs
+package qrutil
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+
+	"github.com/shopspring/decimal"
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+const (
+	// MinSize is the smallest size of a QR code PNG in pixels, below which large codes are unreadable
+	MinSize = 64
+	// MaxSize is the largest size of a QR code PNG in pixels
+	MaxSize = 1024
+
+	// amountDecimals is the precision of BIP21 amounts, in BTC or LTC
+	amountDecimals = 8
+)
+
+var (
+	// ErrInvalidAmount is returned for an amount that is not a positive decimal
+	// with at most 8 decimal places
+	ErrInvalidAmount = errors.New("Invalid amount")
+
+	// ErrInvalidSize is returned by PNG for a size outside of MinSize and MaxSize
+	ErrInvalidSize = fmt.Errorf("Invalid size, must be between %d and %d", MinSize, MaxSize)
+)
+
+// PaymentURI returns the BIP21 URI of a payment to addr, e.g. "bitcoin:<addr>?amount=0.01".
+// scheme is the URI scheme of the coin, e.g. "bitcoin" or "litecoin". amount is the number
+// of coins as a decimal string, or empty to leave the amount to the payer.
+func PaymentURI(scheme, addr, amount string) (string, error) {
+	uri := fmt.Sprintf("%s:%s", scheme, addr)
+	if amount == "" {
+		return uri, nil
+	}
+
+	d, err := parseAmount(amount)
+	if err != nil {
+		return "", err
+	}
+
+	q := url.Values{}
+	q.Set("amount", d.String())
+
+	return uri + "?" + q.Encode(), nil
+}
+
+// ParseAmount parses a BIP21 amount of coins, e.g. "0.01", into satoshis
+func ParseAmount(amount string) (int64, error) {
+	d, err := parseAmount(amount)
+	if err != nil {
+		return 0, err
+	}
+
+	return d.Mul(decimal.New(1, amountDecimals)).IntPart(), nil
+}
+
+// FormatAmount formats a value in satoshis as an amount of coins, e.g. 1000000 as "0.01"
+func FormatAmount(value int64) string {
+	return decimal.New(value, -amountDecimals).String()
+}
+
+func parseAmount(amount string) (decimal.Decimal, error) {
+	d, err := decimal.NewFromString(amount)
+	if err != nil || d.Sign() <= 0 || !d.Equal(d.Truncate(amountDecimals)) {
+		return decimal.Decimal{}, ErrInvalidAmount
+	}
+
+	// The value in satoshis must fit in an int64
+	if d.Mul(decimal.New(1, amountDecimals)).GreaterThan(decimal.New(math.MaxInt64, 0)) {
+		return decimal.Decimal{}, ErrInvalidAmount
+	}
+
+	return d, nil
+}
+
+// PNG renders data as a QR code PNG of size by size pixels, with medium error recovery
+func PNG(data string, size int) ([]byte, error) {
+	if size < MinSize || size > MaxSize {
+		return nil, ErrInvalidSize
+	}
+
+	return qrcode.Encode(data, qrcode.Medium, size)
+}
@@ -0,0 +1,79 @@
+package qrutil
+
+import (
+	"bytes"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPaymentURI(t *testing.T) {
+	addr := "1PZ63K3G4gZP6A6E2TTbBwxT5bFQGL2TLB"
+
+	for _, tc := range []struct {
+		scheme string
+		amount string
+		uri    string
+		err    error
+	}{
+		{"bitcoin", "", "bitcoin:" + addr, nil},
+		{"bitcoin", "0.01", "bitcoin:" + addr + "?amount=0.01", nil},
+		{"litecoin", "2", "litecoin:" + addr + "?amount=2", nil},
+		{"bitcoin", "0.12345678", "bitcoin:" + addr + "?amount=0.12345678", nil},
+		{"bitcoin", "1.50000000000", "bitcoin:" + addr + "?amount=1.5", nil},
+		{"bitcoin", "0.123456789", "", ErrInvalidAmount},
+		{"bitcoin", "0", "", ErrInvalidAmount},
+		{"bitcoin", "-1", "", ErrInvalidAmount},
+		{"bitcoin", "1e", "", ErrInvalidAmount},
+	} {
+		uri, err := PaymentURI(tc.scheme, addr, tc.amount)
+		require.Equal(t, tc.err, err, tc.amount)
+		require.Equal(t, tc.uri, uri)
+	}
+}
+
+func TestParseAmount(t *testing.T) {
+	for _, tc := range []struct {
+		amount string
+		value  int64
+		err    error
+	}{
+		{"0.01", 1e6, nil},
+		{"2", 2e8, nil},
+		{"0.00000001", 1, nil},
+		{"1.50000000000", 1.5e8, nil},
+		{"92233720368.54775807", 9223372036854775807, nil},
+		{"92233720368.54775808", 0, ErrInvalidAmount},
+		{"0.123456789", 0, ErrInvalidAmount},
+		{"0", 0, ErrInvalidAmount},
+		{"-1", 0, ErrInvalidAmount},
+		{"", 0, ErrInvalidAmount},
+	} {
+		value, err := ParseAmount(tc.amount)
+		require.Equal(t, tc.err, err, tc.amount)
+		require.Equal(t, tc.value, value, tc.amount)
+	}
+}
+
+func TestFormatAmount(t *testing.T) {
+	require.Equal(t, "0.01", FormatAmount(1e6))
+	require.Equal(t, "2", FormatAmount(2e8))
+	require.Equal(t, "0.00000001", FormatAmount(1))
+}
+
+func TestPNG(t *testing.T) {
+	b, err := PNG("bitcoin:1PZ63K3G4gZP6A6E2TTbBwxT5bFQGL2TLB?amount=0.01", 256)
+	require.NoError(t, err)
+
+	img, err := png.Decode(bytes.NewReader(b))
+	require.NoError(t, err)
+	require.Equal(t, 256, img.Bounds().Dx())
+	require.Equal(t, 256, img.Bounds().Dy())
+
+	_, err = PNG("foo", MinSize-1)
+	require.Equal(t, ErrInvalidSize, err)
+
+	_, err = PNG("foo", MaxSize+1)
+	require.Equal(t, ErrInvalidSize, err)
+}
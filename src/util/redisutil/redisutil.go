@@ -0,0 +1,300 @@
+// Package redisutil provides a minimal Redis client speaking the RESP2 protocol
+package redisutil
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultDialTimeout = time.Second * 5
+	defaultIOTimeout   = time.Second * 5
+	defaultPoolSize    = 10
+)
+
+// ErrNil is returned when Redis replies with a nil bulk string or nil array
+var ErrNil = errors.New("redis: nil reply")
+
+// Error is an error reply from the Redis server
+type Error string
+
+func (e Error) Error() string {
+	return string(e)
+}
+
+// Config configures a Client
+type Config struct {
+	Addr        string
+	Password    string
+	DB          int
+	DialTimeout time.Duration
+	IOTimeout   time.Duration
+	PoolSize    int
+}
+
+// Client is a Redis client with a small connection pool. It is safe for concurrent use.
+type Client struct {
+	cfg  Config
+	pool chan *conn
+}
+
+type conn struct {
+	net.Conn
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+// NewClient creates a Client. Connections are established lazily.
+func NewClient(cfg Config) *Client {
+	if cfg.DialTimeout == 0 {
+		cfg.DialTimeout = defaultDialTimeout
+	}
+	if cfg.IOTimeout == 0 {
+		cfg.IOTimeout = defaultIOTimeout
+	}
+	if cfg.PoolSize == 0 {
+		cfg.PoolSize = defaultPoolSize
+	}
+
+	return &Client{
+		cfg:  cfg,
+		pool: make(chan *conn, cfg.PoolSize),
+	}
+}
+
+// Do sends a command and returns the reply. Replies are returned as
+// int64, string, []interface{} or nil. Error replies are returned as Error.
+func (c *Client) Do(args ...interface{}) (interface{}, error) {
+	cn, err := c.get()
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := cn.do(c.cfg.IOTimeout, args...)
+	if err != nil {
+		if _, ok := err.(Error); !ok && err != ErrNil {
+			// Connection state is unknown after an I/O or protocol error
+			cn.Close()
+			return nil, err
+		}
+	}
+
+	c.put(cn)
+
+	return reply, err
+}
+
+// Close closes all pooled connections
+func (c *Client) Close() error {
+	for {
+		select {
+		case cn := <-c.pool:
+			cn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+func (c *Client) get() (*conn, error) {
+	select {
+	case cn := <-c.pool:
+		return cn, nil
+	default:
+	}
+
+	nc, err := net.DialTimeout("tcp", c.cfg.Addr, c.cfg.DialTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	cn := &conn{
+		Conn: nc,
+		r:    bufio.NewReader(nc),
+		w:    bufio.NewWriter(nc),
+	}
+
+	if c.cfg.Password != "" {
+		if _, err := cn.do(c.cfg.IOTimeout, "AUTH", c.cfg.Password); err != nil {
+			cn.Close()
+			return nil, fmt.Errorf("redis AUTH failed: %v", err)
+		}
+	}
+
+	if c.cfg.DB != 0 {
+		if _, err := cn.do(c.cfg.IOTimeout, "SELECT", c.cfg.DB); err != nil {
+			cn.Close()
+			return nil, fmt.Errorf("redis SELECT failed: %v", err)
+		}
+	}
+
+	return cn, nil
+}
+
+func (c *Client) put(cn *conn) {
+	select {
+	case c.pool <- cn:
+	default:
+		cn.Close()
+	}
+}
+
+func (cn *conn) do(timeout time.Duration, args ...interface{}) (interface{}, error) {
+	if err := cn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+
+	if err := writeCommand(cn.w, args); err != nil {
+		return nil, err
+	}
+
+	if err := cn.w.Flush(); err != nil {
+		return nil, err
+	}
+
+	return readReply(cn.r)
+}
+
+func writeCommand(w *bufio.Writer, args []interface{}) error {
+	if _, err := fmt.Fprintf(w, "*%d\r\n", len(args)); err != nil {
+		return err
+	}
+
+	for _, a := range args {
+		var s string
+		switch v := a.(type) {
+		case string:
+			s = v
+		case []byte:
+			s = string(v)
+		default:
+			s = fmt.Sprint(v)
+		}
+
+		if _, err := fmt.Fprintf(w, "$%d\r\n%s\r\n", len(s), s); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return "", errors.New("redis: invalid reply line")
+	}
+
+	return line[:len(line)-2], nil
+}
+
+func readReply(r *bufio.Reader) (interface{}, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(line) == 0 {
+		return nil, errors.New("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, Error(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, ErrNil
+		}
+
+		b := make([]byte, n+2)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+
+		return string(b[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, ErrNil
+		}
+
+		values := make([]interface{}, n)
+		for i := range values {
+			v, err := readReply(r)
+			if err != nil && err != ErrNil {
+				return nil, err
+			}
+			values[i] = v
+		}
+
+		return values, nil
+	default:
+		return nil, fmt.Errorf("redis: unexpected reply type %q", line[0])
+	}
+}
+
+// Int64 converts a reply to an int64
+func Int64(reply interface{}, err error) (int64, error) {
+	if err != nil {
+		return 0, err
+	}
+
+	switch v := reply.(type) {
+	case int64:
+		return v, nil
+	case string:
+		return strconv.ParseInt(v, 10, 64)
+	default:
+		return 0, fmt.Errorf("redis: unexpected reply type %T for Int64", reply)
+	}
+}
+
+// String converts a reply to a string
+func String(reply interface{}, err error) (string, error) {
+	if err != nil {
+		return "", err
+	}
+
+	switch v := reply.(type) {
+	case string:
+		return v, nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	default:
+		return "", fmt.Errorf("redis: unexpected reply type %T for String", reply)
+	}
+}
+
+// Values converts a reply to a []interface{}
+func Values(reply interface{}, err error) ([]interface{}, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	v, ok := reply.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("redis: unexpected reply type %T for Values", reply)
+	}
+
+	return v, nil
+}
@@ -0,0 +1,74 @@
+package redisutil
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/teller/src/util/testutil"
+)
+
+func TestClientDo(t *testing.T) {
+	var commands []string
+	addr, shutdown := testutil.NewFakeRedis(t, func(args []string) string {
+		commands = append(commands, strings.Join(args, " "))
+		switch args[0] {
+		case "AUTH", "SELECT", "SET":
+			return "+OK\r\n"
+		case "GET":
+			if args[1] == "missing" {
+				return "$-1\r\n"
+			}
+			return "$5\r\nhello\r\n"
+		case "INCR":
+			return ":42\r\n"
+		case "EVAL":
+			return "*2\r\n:1\r\n$-1\r\n"
+		default:
+			return "-ERR unknown command\r\n"
+		}
+	})
+	defer shutdown()
+
+	c := NewClient(Config{
+		Addr:     addr,
+		Password: "secret",
+		DB:       2,
+	})
+	defer c.Close()
+
+	s, err := String(c.Do("SET", "k", "hello"))
+	require.NoError(t, err)
+	require.Equal(t, "OK", s)
+
+	s, err = String(c.Do("GET", "k"))
+	require.NoError(t, err)
+	require.Equal(t, "hello", s)
+
+	_, err = String(c.Do("GET", "missing"))
+	require.Equal(t, ErrNil, err)
+
+	n, err := Int64(c.Do("INCR", "n"))
+	require.NoError(t, err)
+	require.Equal(t, int64(42), n)
+
+	vs, err := Values(c.Do("EVAL", "return 1", 0))
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{int64(1), nil}, vs)
+
+	_, err = c.Do("BOGUS")
+	require.Equal(t, Error("ERR unknown command"), err)
+
+	// The connection is reused, so AUTH and SELECT are only sent once
+	require.Equal(t, []string{
+		"AUTH secret",
+		"SELECT 2",
+		"SET k hello",
+		"GET k",
+		"GET missing",
+		"INCR n",
+		"EVAL return 1 0",
+		"BOGUS",
+	}, commands)
+}
@@ -0,0 +1,96 @@
+package testutil
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// NewFakeRedis starts a redis server that replies to each command with the RESP reply returned by reply.
+// reply is called concurrently by the goroutines of the connections.
+// The returned func stops the server and closes its connections, like a redis server going down.
+func NewFakeRedis(t *testing.T, reply func(args []string) string) (string, func()) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	var conns []net.Conn
+	var mu sync.Mutex
+
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+
+			mu.Lock()
+			conns = append(conns, c)
+			mu.Unlock()
+
+			go func(c net.Conn) {
+				defer c.Close()
+				r := bufio.NewReader(c)
+				for {
+					args, err := readFakeRedisCommand(r)
+					if err != nil {
+						return
+					}
+
+					if _, err := io.WriteString(c, reply(args)); err != nil {
+						return
+					}
+				}
+			}(c)
+		}
+	}()
+
+	return ln.Addr().String(), func() {
+		ln.Close()
+
+		mu.Lock()
+		defer mu.Unlock()
+		for _, c := range conns {
+			c.Close()
+		}
+	}
+}
+
+// readFakeRedisCommand reads a command sent as a RESP array of bulk strings
+func readFakeRedisCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := strconv.Atoi(strings.TrimSpace(line)[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]string, n)
+	for i := range args {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+
+		size, err := strconv.Atoi(strings.TrimSpace(line)[1:])
+		if err != nil {
+			return nil, err
+		}
+
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+
+	return args, nil
+}
@@ -0,0 +1,281 @@
+// Package zmqutil provides a minimal ZeroMQ SUB socket speaking ZMTP 3.0 over TCP,
+// with the NULL security mechanism, for bitcoind's ZMQ notifications
+package zmqutil
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	defaultDialTimeout = time.Second * 5
+	tcpKeepAlive       = time.Second * 30
+
+	greetingLen = 64
+
+	flagMore    = 0x01
+	flagLong    = 0x02
+	flagCommand = 0x04
+
+	// maxFrameSize limits frames read from the publisher. bitcoind's largest
+	// notifications are raw transactions.
+	maxFrameSize = 16 << 20
+)
+
+var (
+	// ErrFrameTooLarge is returned if the publisher sends a frame larger than maxFrameSize
+	ErrFrameTooLarge = errors.New("zmq: frame too large")
+
+	// ErrBadGreeting is returned if the peer is not a ZMTP 3 peer using the NULL mechanism
+	ErrBadGreeting = errors.New("zmq: bad greeting")
+)
+
+// Subscriber is a ZeroMQ SUB socket connected to a single publisher.
+// It does not reconnect, create a new Subscriber if Recv fails.
+type Subscriber struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// Dial connects to a publisher at addr, e.g. "tcp://127.0.0.1:28332" or "127.0.0.1:28332",
+// and subscribes to topics
+func Dial(addr string, timeout time.Duration, topics ...string) (*Subscriber, error) {
+	if timeout == 0 {
+		timeout = defaultDialTimeout
+	}
+
+	if strings.Contains(addr, "://") {
+		if !strings.HasPrefix(addr, "tcp://") {
+			return nil, fmt.Errorf("zmq: unsupported transport in %s, only tcp is supported", addr)
+		}
+		addr = strings.TrimPrefix(addr, "tcp://")
+	}
+
+	d := net.Dialer{
+		Timeout:   timeout,
+		KeepAlive: tcpKeepAlive,
+	}
+
+	conn, err := d.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Subscriber{
+		conn: conn,
+		r:    bufio.NewReader(conn),
+	}
+
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if err := s.handshake(topics); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Close closes the connection. A blocked Recv returns an error.
+func (s *Subscriber) Close() error {
+	return s.conn.Close()
+}
+
+// Recv blocks until a message is received and returns its frames.
+// For bitcoind, these are the topic, the body and a 4-byte little-endian sequence number.
+func (s *Subscriber) Recv() ([][]byte, error) {
+	var msg [][]byte
+	for {
+		flags, body, err := readFrame(s.r)
+		if err != nil {
+			return nil, err
+		}
+
+		// Commands between messages, e.g. PING from ZMTP 3.1 peers, are ignored
+		if flags&flagCommand != 0 {
+			continue
+		}
+
+		msg = append(msg, body)
+
+		if flags&flagMore == 0 {
+			return msg, nil
+		}
+	}
+}
+
+func (s *Subscriber) handshake(topics []string) error {
+	if _, err := s.conn.Write(greeting()); err != nil {
+		return err
+	}
+
+	peer := make([]byte, greetingLen)
+	if _, err := io.ReadFull(s.r, peer); err != nil {
+		return err
+	}
+
+	if err := checkGreeting(peer); err != nil {
+		return err
+	}
+
+	if err := writeFrame(s.conn, flagCommand, readyCommand("SUB")); err != nil {
+		return err
+	}
+
+	flags, body, err := readFrame(s.r)
+	if err != nil {
+		return err
+	}
+
+	if flags&flagCommand == 0 {
+		return errors.New("zmq: expected READY command")
+	}
+
+	name, _, err := parseCommand(body)
+	if err != nil {
+		return err
+	}
+
+	switch name {
+	case "READY":
+	case "ERROR":
+		return fmt.Errorf("zmq: handshake rejected: %s", commandData(body))
+	default:
+		return fmt.Errorf("zmq: expected READY command, got %s", name)
+	}
+
+	// ZMTP 3.0 subscriptions are messages of 0x01 followed by the topic prefix
+	for _, topic := range topics {
+		if err := writeFrame(s.conn, 0, append([]byte{0x01}, topic...)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// greeting returns the ZMTP 3.0 greeting of a client using the NULL mechanism
+func greeting() []byte {
+	g := make([]byte, greetingLen)
+	g[0] = 0xFF
+	g[9] = 0x7F
+	g[10] = 3 // version major
+	g[11] = 0 // version minor
+	copy(g[12:32], "NULL")
+	return g
+}
+
+func checkGreeting(g []byte) error {
+	if g[0] != 0xFF || g[9]&0x01 != 0x01 {
+		return ErrBadGreeting
+	}
+
+	if g[10] < 3 {
+		return fmt.Errorf("zmq: unsupported ZMTP version %d.%d", g[10], g[11])
+	}
+
+	if mechanism := string(bytes.TrimRight(g[12:32], "\x00")); mechanism != "NULL" {
+		return fmt.Errorf("zmq: unsupported security mechanism %q", mechanism)
+	}
+
+	return nil
+}
+
+// readyCommand returns the body of a READY command with the Socket-Type property
+func readyCommand(socketType string) []byte {
+	var b bytes.Buffer
+	b.WriteByte(byte(len("READY")))
+	b.WriteString("READY")
+
+	b.WriteByte(byte(len("Socket-Type")))
+	b.WriteString("Socket-Type")
+	binary.Write(&b, binary.BigEndian, uint32(len(socketType))) // nolint: errcheck
+	b.WriteString(socketType)
+
+	return b.Bytes()
+}
+
+// parseCommand returns the name and data of a command frame body
+func parseCommand(body []byte) (string, []byte, error) {
+	if len(body) == 0 || int(body[0]) > len(body)-1 {
+		return "", nil, errors.New("zmq: malformed command")
+	}
+
+	n := int(body[0])
+	return string(body[1 : 1+n]), body[1+n:], nil
+}
+
+// commandData returns the reason of an ERROR command, for error messages
+func commandData(body []byte) string {
+	_, data, err := parseCommand(body)
+	if err != nil || len(data) == 0 || int(data[0]) > len(data)-1 {
+		return ""
+	}
+
+	return string(data[1 : 1+int(data[0])])
+}
+
+func writeFrame(w io.Writer, flags byte, body []byte) error {
+	var hdr []byte
+	if len(body) > 255 {
+		hdr = make([]byte, 9)
+		hdr[0] = flags | flagLong
+		binary.BigEndian.PutUint64(hdr[1:], uint64(len(body)))
+	} else {
+		hdr = []byte{flags, byte(len(body))}
+	}
+
+	if _, err := w.Write(append(hdr, body...)); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func readFrame(r *bufio.Reader) (byte, []byte, error) {
+	flags, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var size uint64
+	if flags&flagLong != 0 {
+		var b [8]byte
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			return 0, nil, err
+		}
+		size = binary.BigEndian.Uint64(b[:])
+	} else {
+		n, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		size = uint64(n)
+	}
+
+	if size > maxFrameSize {
+		return 0, nil, ErrFrameTooLarge
+	}
+
+	body := make([]byte, size)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+
+	return flags, body, nil
+}
@@ -0,0 +1,155 @@
+package zmqutil
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakePublisher accepts one SUB connection, completes the handshake,
+// reports the subscriptions and sends the messages written to msgs
+type fakePublisher struct {
+	ln   net.Listener
+	subs chan string
+	msgs chan [][]byte
+}
+
+func newFakePublisher(t *testing.T) *fakePublisher {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	p := &fakePublisher{
+		ln:   ln,
+		subs: make(chan string, 10),
+		msgs: make(chan [][]byte, 10),
+	}
+
+	go p.serve()
+
+	return p
+}
+
+func (p *fakePublisher) serve() {
+	conn, err := p.ln.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+
+	g := make([]byte, greetingLen)
+	if _, err := io.ReadFull(r, g); err != nil {
+		return
+	}
+	if checkGreeting(g) != nil {
+		return
+	}
+
+	// Send a ZMTP 3.1 greeting, like current libzmq
+	g = greeting()
+	g[11] = 1
+	if _, err := conn.Write(g); err != nil {
+		return
+	}
+
+	if _, _, err := readFrame(r); err != nil {
+		return
+	}
+	if err := writeFrame(conn, flagCommand, readyCommand("PUB")); err != nil {
+		return
+	}
+
+	go func() {
+		for {
+			flags, body, err := readFrame(r)
+			if err != nil {
+				return
+			}
+			if flags&flagCommand == 0 && len(body) > 0 && body[0] == 0x01 {
+				p.subs <- string(body[1:])
+			}
+		}
+	}()
+
+	for msg := range p.msgs {
+		// A PING command between messages must be ignored
+		if err := writeFrame(conn, flagCommand, append([]byte{4}, "PING"...)); err != nil {
+			return
+		}
+
+		for i, frame := range msg {
+			var flags byte
+			if i < len(msg)-1 {
+				flags = flagMore
+			}
+			if err := writeFrame(conn, flags, frame); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func TestSubscriber(t *testing.T) {
+	p := newFakePublisher(t)
+	defer p.ln.Close()
+
+	s, err := Dial("tcp://"+p.ln.Addr().String(), time.Second, "hashblock", "rawtx")
+	require.NoError(t, err)
+	defer s.Close()
+
+	require.Equal(t, "hashblock", <-p.subs)
+	require.Equal(t, "rawtx", <-p.subs)
+
+	seq := make([]byte, 4)
+	binary.LittleEndian.PutUint32(seq, 7)
+	hash := bytes.Repeat([]byte{0xab}, 32)
+	p.msgs <- [][]byte{[]byte("hashblock"), hash, seq}
+
+	msg, err := s.Recv()
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{[]byte("hashblock"), hash, seq}, msg)
+
+	// Frames over 255 bytes use the long size
+	rawtx := bytes.Repeat([]byte{0x01}, 1000)
+	p.msgs <- [][]byte{[]byte("rawtx"), rawtx, seq}
+
+	msg, err = s.Recv()
+	require.NoError(t, err)
+	require.Equal(t, rawtx, msg[1])
+
+	// Recv fails once the publisher goes away
+	close(p.msgs)
+	_, err = s.Recv()
+	require.Error(t, err)
+}
+
+func TestDialErrors(t *testing.T) {
+	_, err := Dial("ipc:///tmp/bitcoind", time.Second)
+	require.Error(t, err)
+	require.True(t, strings.Contains(err.Error(), "unsupported transport"))
+
+	// A peer that is not a ZMTP peer
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write(bytes.Repeat([]byte("HTTP/1.1 400 Bad Request\r\n"), 3)) // nolint: errcheck
+	}()
+
+	_, err = Dial(ln.Addr().String(), time.Second)
+	require.Equal(t, ErrBadGreeting, err)
+}